@@ -0,0 +1,154 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::api_surface::{self, ApiDiff, ApiError, ApiSurface, Compatibility};
+use cruxe_state::{db, project};
+use rusqlite::Connection;
+use std::path::{Path, PathBuf};
+
+/// `cruxe api`: the exported functions, methods, types, fields and
+/// constants of a ref, with their signatures.
+pub fn run(
+    workspace: &Path,
+    path_prefix: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let (workspace, project_id, conn, default_ref) = open(workspace, config_file)?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &default_ref);
+    let surface = api_surface::extract_api(&conn, &project_id, &resolved_ref, path_prefix)
+        .map_err(api_error)?;
+    super::render::render_records(format, &surface, &surface.items, print_surface)
+}
+
+/// `cruxe api diff`: API changes between two indexed refs, classified as
+/// breaking or additive. With `fail_on_breaking`, breaking changes fail
+/// the run.
+pub fn diff(
+    workspace: &Path,
+    base_ref: &str,
+    head_ref: &str,
+    path_prefix: Option<&str>,
+    format: &str,
+    fail_on_breaking: bool,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let (_, project_id, conn, _) = open(workspace, config_file)?;
+    let diff = api_surface::diff_api(&conn, &project_id, base_ref, head_ref, path_prefix)
+        .map_err(api_error)?;
+    super::render::render_records(format, &diff, &diff.changes, print_diff)?;
+
+    let mut failures = Vec::new();
+    if fail_on_breaking && diff.breaking > 0 {
+        failures.push(format!(
+            "{} breaking API change(s) between {} and {}",
+            diff.breaking, diff.base_ref, diff.head_ref
+        ));
+    }
+    super::gate::enforce("API check failed", &failures)
+}
+
+fn open(
+    workspace: &Path,
+    config_file: Option<&Path>,
+) -> Result<(PathBuf, String, Connection, String)> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    Ok((workspace, project_id, conn, proj.default_ref))
+}
+
+fn api_error(err: ApiError) -> anyhow::Error {
+    match err {
+        ApiError::RefNotIndexed(r#ref) => anyhow::anyhow!(
+            "Ref `{}` is not indexed. Run `cruxe index --ref {}` first.",
+            r#ref,
+            r#ref
+        ),
+        other => anyhow::anyhow!("API extraction failed: {}", other),
+    }
+}
+
+fn print_surface(surface: &ApiSurface) {
+    let mut current = None;
+    for item in &surface.items {
+        if current != Some(item.package.as_str()) {
+            if current.is_some() {
+                println!();
+            }
+            println!("{}", item.package);
+            current = Some(item.package.as_str());
+        }
+        println!(
+            "  {:<10} {}  {}:{}",
+            item.kind,
+            item.signature.as_deref().unwrap_or(&item.qualified_name),
+            item.path,
+            item.line
+        );
+    }
+    if !surface.items.is_empty() {
+        println!();
+    }
+    println!(
+        "{} exported item(s) in {} package(s) on ref {}",
+        surface.items.len(),
+        surface.packages.len(),
+        surface.ref_name
+    );
+}
+
+fn print_diff(diff: &ApiDiff) {
+    if diff.changes.is_empty() {
+        println!(
+            "No exported API changes between {} and {}.",
+            diff.base_ref, diff.head_ref
+        );
+        return;
+    }
+    for change in &diff.changes {
+        let marker = match change.compatibility {
+            Compatibility::Breaking => "!",
+            Compatibility::Additive => "+",
+        };
+        println!(
+            "{} {:<18} {:<10} {}  {}:{}",
+            marker,
+            change.change.as_str(),
+            change.item.kind,
+            change.item.qualified_name,
+            change.item.path,
+            change.item.line
+        );
+        if let Some(old) = &change.old_package {
+            println!("      package {} -> {}", old, change.item.package);
+        }
+        if let Some(old) = &change.old_signature {
+            println!("      - {}", old);
+            if let Some(new) = &change.item.signature {
+                println!("      + {}", new);
+            }
+        }
+    }
+    println!();
+    println!(
+        "{} -> {}: {} breaking, {} additive; needs a {} version bump",
+        diff.base_ref, diff.head_ref, diff.breaking, diff.additive, diff.bump
+    );
+}
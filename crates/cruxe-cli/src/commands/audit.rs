@@ -0,0 +1,25 @@
+use anyhow::{Result, bail};
+use cruxe_core::audit;
+use cruxe_core::config::Config;
+use std::path::Path;
+
+/// Check the audit log's hash chain; fails on the first broken entry.
+pub fn verify(path: Option<&Path>, config_file: Option<&Path>) -> Result<()> {
+    let path = match path {
+        Some(path) => path.to_path_buf(),
+        None => audit::audit_path(&Config::load_with_file(None, config_file)?),
+    };
+    if !path.exists() {
+        bail!("No audit log at {}", path.display());
+    }
+    match audit::verify(&path) {
+        Ok(entries) => {
+            println!("{}: {} entries, chain intact", path.display(), entries);
+            Ok(())
+        }
+        Err(audit::AuditError::Broken { line, reason }) => {
+            bail!("{}: line {}: {}", path.display(), line, reason)
+        }
+        Err(err) => Err(err.into()),
+    }
+}
@@ -0,0 +1,101 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::deadcode::{self, DeadCodeOptions};
+use cruxe_query::deps::{self, DepsOptions};
+use cruxe_query::findings::baseline::{self, Baseline};
+use cruxe_query::findings::{self, RuleSet};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe baseline write`: snapshot today's check findings, dead code,
+/// import cycles and complex functions, so `--baseline` runs report only
+/// what is new.
+pub fn write(
+    workspace: &Path,
+    output: Option<&str>,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let profile = super::check::resolve_profile(None, &config)?;
+    let rule_set =
+        RuleSet::from_config(&config.rules, profile.unwrap_or_default()).with_taint(&config.taint);
+    let found = findings::run_checks(&conn, &project_id, &resolved_ref, &rule_set)
+        .map_err(|e| anyhow::anyhow!("Check failed: {}", e))?;
+    let dead = deadcode::find_dead_code(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        &DeadCodeOptions {
+            include_exported: config.deadcode.include_exported,
+            allow: config.deadcode.allow.clone(),
+            unused_exports: config.deadcode.unused_exports,
+            ..DeadCodeOptions::default()
+        },
+    )
+    .map_err(|e| anyhow::anyhow!("Dead code analysis failed: {}", e))?;
+    let graph = deps::build_deps_graph(&conn, &project_id, &resolved_ref, &DepsOptions::default())?;
+    let complex = findings::complex_functions(
+        &conn,
+        &project_id,
+        &resolved_ref,
+        &config.index.languages,
+        baseline::COMPLEXITY_THRESHOLD,
+    )
+    .map_err(|e| anyhow::anyhow!("Complexity scan failed: {}", e))?;
+
+    let mut snapshot = Baseline::new(&resolved_ref);
+    snapshot.record_findings(&found);
+    snapshot.record_dead_code(&dead.dead);
+    snapshot.record_cycles(&graph.cycles);
+    snapshot.record_complexity(&complex);
+    let path = workspace.join(output.unwrap_or(baseline::BASELINE_FILE));
+    snapshot.save(&path)?;
+
+    println!(
+        "Baselined {} finding(s), {} dead symbol(s), {} import cycle(s) and {} function(s) above complexity {} on ref {}",
+        found.len(),
+        dead.dead.len(),
+        graph.cycles.len(),
+        complex.len(),
+        baseline::COMPLEXITY_THRESHOLD,
+        resolved_ref
+    );
+    println!(
+        "Wrote {}; commit it and pass --baseline to report only new findings.",
+        path.display()
+    );
+    Ok(())
+}
+
+/// The baseline at `path`, relative to the workspace, for `--baseline`.
+pub(crate) fn load(workspace: &Path, path: &str) -> Result<Baseline> {
+    let path = workspace.join(path);
+    Baseline::load(&path)?.ok_or_else(|| {
+        anyhow::anyhow!(
+            "No baseline at {}; run `cruxe baseline write` first",
+            path.display()
+        )
+    })
+}
@@ -0,0 +1,161 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_indexer::bench::{self, BenchDelta, BenchReport, PhaseTimings};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::path::Path;
+
+#[derive(Debug, Serialize, JsonSchema)]
+pub struct Bench {
+    pub report: BenchReport,
+    /// Against `--baseline`; empty without one.
+    pub comparison: Vec<BenchDelta>,
+}
+
+#[derive(Debug)]
+pub struct BenchOptions<'a> {
+    pub iterations: u32,
+    pub format: &'a str,
+    /// Write the report here for later comparisons.
+    pub save_baseline: Option<&'a Path>,
+    /// Compare against this saved report and fail on regressions.
+    pub baseline: Option<&'a Path>,
+    pub max_regression_pct: f64,
+}
+
+pub fn run(root: &Path, options: &BenchOptions<'_>, config_file: Option<&Path>) -> Result<()> {
+    let root = std::fs::canonicalize(root).context("Failed to resolve benchmark path")?;
+    let config = Config::load_with_file(Some(&root), config_file)?;
+    // Read the baseline first so a bad path fails before the run.
+    let baseline: Option<BenchReport> = match options.baseline {
+        Some(path) => {
+            let raw = std::fs::read_to_string(path)
+                .with_context(|| format!("Failed to read baseline {}", path.display()))?;
+            Some(
+                serde_json::from_str(&raw)
+                    .with_context(|| format!("Invalid baseline {}", path.display()))?,
+            )
+        }
+        None => None,
+    };
+
+    let scratch = tempfile::tempdir().context("Failed to create scratch directory")?;
+    let report = bench::run(
+        &root,
+        &config.index.languages,
+        config.index.max_file_size,
+        options.iterations,
+        scratch.path(),
+    )
+    .map_err(|e| anyhow::anyhow!("Benchmark failed: {}", e))?;
+    if report.total.files == 0 {
+        anyhow::bail!("No source files to benchmark under {}", root.display());
+    }
+
+    let deltas = baseline
+        .as_ref()
+        .map(|baseline| bench::compare(baseline, &report, options.max_regression_pct))
+        .unwrap_or_default();
+    let output = Bench {
+        report,
+        comparison: deltas,
+    };
+    super::render::render(options.format, &output, |output| {
+        print_report(&output.report);
+        if !output.comparison.is_empty() {
+            println!();
+            print_deltas(&output.comparison, options.max_regression_pct);
+        }
+    })?;
+
+    if let Some(path) = options.save_baseline {
+        std::fs::write(path, serde_json::to_string_pretty(&output.report)?)
+            .with_context(|| format!("Failed to write baseline {}", path.display()))?;
+        eprintln!("Baseline saved to {}", path.display());
+    }
+    let regressions: Vec<String> = output
+        .comparison
+        .iter()
+        .filter(|delta| delta.regressed)
+        .map(|delta| {
+            format!(
+                "{} {}: {:+.1}% ({} -> {})",
+                delta.scope,
+                delta.metric,
+                delta.change_pct,
+                format_value(delta.metric, delta.baseline),
+                format_value(delta.metric, delta.current)
+            )
+        })
+        .collect();
+    if !regressions.is_empty() {
+        anyhow::bail!(
+            "Benchmark regressed by more than {}%:\n  {}",
+            options.max_regression_pct,
+            regressions.join("\n  ")
+        );
+    }
+    Ok(())
+}
+
+fn print_report(report: &BenchReport) {
+    println!(
+        "{:<12} {:>7} {:>9} {:>10} {:>10} {:>10} {:>10} {:>11}",
+        "LANGUAGE", "FILES", "LOC", "PARSE ms", "RESOLVE ms", "STORE ms", "FILES/s", "LOC/s"
+    );
+    println!("{}", "-".repeat(86));
+    for (language, timings) in &report.languages {
+        print_row(language, timings);
+    }
+    print_row("total", &report.total);
+    println!();
+    println!(
+        "Best of {} iteration(s); peak RSS {}",
+        report.iterations,
+        report
+            .peak_rss_bytes
+            .map(format_bytes)
+            .unwrap_or_else(|| "n/a".to_string())
+    );
+}
+
+fn print_row(scope: &str, timings: &PhaseTimings) {
+    println!(
+        "{:<12} {:>7} {:>9} {:>10.1} {:>10.1} {:>10.1} {:>10.1} {:>11.0}",
+        scope,
+        timings.files,
+        timings.loc,
+        timings.parse_ms,
+        timings.resolve_ms,
+        timings.store_ms,
+        timings.files_per_sec,
+        timings.loc_per_sec,
+    );
+}
+
+fn print_deltas(deltas: &[BenchDelta], max_regression_pct: f64) {
+    println!("Against baseline (regression threshold {max_regression_pct}%):");
+    for delta in deltas {
+        println!(
+            "  {:<12} {:<15} {:>12} -> {:>12} {:>+8.1}%{}",
+            delta.scope,
+            delta.metric,
+            format_value(delta.metric, delta.baseline),
+            format_value(delta.metric, delta.current),
+            delta.change_pct,
+            if delta.regressed { "  REGRESSED" } else { "" }
+        );
+    }
+}
+
+fn format_value(metric: &str, value: f64) -> String {
+    if metric == "peak_rss_bytes" {
+        format_bytes(value as u64)
+    } else {
+        format!("{value:.1}")
+    }
+}
+
+fn format_bytes(bytes: u64) -> String {
+    format!("{:.1} MiB", bytes as f64 / (1024.0 * 1024.0))
+}
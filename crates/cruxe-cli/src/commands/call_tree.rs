@@ -0,0 +1,200 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::call_graph::{
+    self, CallGraphDirection, CallGraphError, CallGraphRequest, CallGraphSymbol, CallTree,
+    CallTreeNode,
+};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+use crate::style::{self, Style};
+
+#[derive(Debug)]
+pub struct CallTreeOptions<'a> {
+    /// Restrict the symbol lookup to this file.
+    pub path: Option<&'a str>,
+    pub depth: u32,
+    pub limit: usize,
+    pub format: &'a str,
+}
+
+/// `cruxe callers` / `cruxe callees`: the call tree of a symbol in one
+/// direction, as an indented tree, JSON or Graphviz DOT.
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    direction: CallGraphDirection,
+    options: &CallTreeOptions<'_>,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let request = CallGraphRequest {
+        symbol_name: symbol,
+        path: options.path,
+        direction,
+        depth: options.depth,
+        limit: options.limit,
+    };
+    let tree = call_graph::get_call_tree(&conn, &project_id, &resolved_ref, &request).map_err(
+        |e| match e {
+            CallGraphError::SymbolNotFound => {
+                anyhow::anyhow!("Symbol `{symbol}` not found in ref {resolved_ref}")
+            }
+            CallGraphError::State(e) => anyhow::anyhow!("Call graph failed: {}", e),
+        },
+    )?;
+
+    let callers = direction == CallGraphDirection::Callers;
+    if options.format == "dot" {
+        print!("{}", render_dot(&tree, callers));
+        return Ok(());
+    }
+    let nodes = if callers {
+        &tree.callers
+    } else {
+        &tree.callees
+    };
+    super::render::render_records(options.format, &tree, nodes, |tree| {
+        print_tree(tree, callers)
+    })
+}
+
+fn print_tree(tree: &CallTree, callers: bool) {
+    let nodes = if callers {
+        &tree.callers
+    } else {
+        &tree.callees
+    };
+    let style = style::current();
+    println!(
+        "{} {}",
+        style.name(&tree.symbol.qualified_name),
+        style.path(&format!(
+            "({}:{})",
+            tree.symbol.path, tree.symbol.line_start
+        ))
+    );
+    if nodes.is_empty() {
+        println!(
+            "  (no {} in the index)",
+            if callers { "callers" } else { "callees" }
+        );
+        return;
+    }
+    print_nodes(nodes, "", &style);
+    println!();
+    println!(
+        "{} node(s), depth {}{}{}",
+        tree.total_nodes,
+        tree.depth_applied,
+        if tree.truncated {
+            ", truncated (raise --limit)"
+        } else {
+            ""
+        },
+        if has_repeats(nodes) {
+            "; (*) = expanded above"
+        } else {
+            ""
+        }
+    );
+}
+
+fn print_nodes(nodes: &[CallTreeNode], prefix: &str, style: &Style) {
+    for (idx, node) in nodes.iter().enumerate() {
+        let last = idx + 1 == nodes.len();
+        println!(
+            "{}{}  {}  {}{}",
+            style.muted(&format!("{}{}", prefix, if last { "└── " } else { "├── " })),
+            style.name(&node.symbol.qualified_name),
+            style.path(&format!("{}:{}", node.symbol.path, node.symbol.line_start)),
+            style.muted(&format!(
+                "[call at {}:{}]",
+                node.call_site.file, node.call_site.line
+            )),
+            if node.repeated { " (*)" } else { "" }
+        );
+        let child_prefix = format!("{}{}", prefix, if last { "    " } else { "│   " });
+        print_nodes(&node.children, &child_prefix, style);
+    }
+}
+
+fn has_repeats(nodes: &[CallTreeNode]) -> bool {
+    nodes
+        .iter()
+        .any(|node| node.repeated || has_repeats(&node.children))
+}
+
+/// Edges always point from caller to callee.
+fn render_dot(tree: &CallTree, callers: bool) -> String {
+    let mut out = String::from("digraph calls {\n  rankdir=LR;\n  node [shape=box];\n");
+    out.push_str(&format!("  {} [style=bold];\n", dot_id(&tree.symbol)));
+    let mut lines = Vec::new();
+    let nodes = if callers {
+        &tree.callers
+    } else {
+        &tree.callees
+    };
+    collect_dot_edges(&tree.symbol, nodes, callers, &mut lines);
+    for line in lines {
+        out.push_str(&line);
+    }
+    out.push_str("}\n");
+    out
+}
+
+fn collect_dot_edges(
+    parent: &CallGraphSymbol,
+    nodes: &[CallTreeNode],
+    callers: bool,
+    out: &mut Vec<String>,
+) {
+    for node in nodes {
+        let (from, to) = if callers {
+            (&node.symbol, parent)
+        } else {
+            (parent, &node.symbol)
+        };
+        let line = format!(
+            "  {} -> {} [label=\"{}:{}\"];\n",
+            dot_id(from),
+            dot_id(to),
+            dot_escape(&node.call_site.file),
+            node.call_site.line
+        );
+        // A repeated symbol re-emits an edge already written above.
+        if !out.contains(&line) {
+            out.push(line);
+        }
+        collect_dot_edges(&node.symbol, &node.children, callers, out);
+    }
+}
+
+fn dot_id(symbol: &CallGraphSymbol) -> String {
+    format!("\"{}\"", dot_escape(&symbol.qualified_name))
+}
+
+fn dot_escape(value: &str) -> String {
+    value.replace('\\', "\\\\").replace('"', "\\\"")
+}
@@ -0,0 +1,119 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::changed::{self, ChangedReport};
+use cruxe_state::{branch_state, db, project};
+use std::path::Path;
+
+/// `cruxe changed <base>..<head>`: the symbols the range's hunks touch,
+/// grouped by package and flagged for exported and signature changes.
+pub fn run(
+    workspace: &Path,
+    range: &str,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+
+    // Line numbers must come from the new side, so prefer the index of the
+    // range's head when it has one (`cruxe index --ref <head>`).
+    let head_ref = match r#ref {
+        Some(r#ref) => Some(r#ref.to_string()),
+        None => match range_head(range) {
+            Some(head) if branch_state::get_branch_state(&conn, &project_id, head)?.is_some() => {
+                Some(head.to_string())
+            }
+            _ => None,
+        },
+    };
+    let resolved_ref =
+        vcs::resolve_effective_ref(&workspace, head_ref.as_deref(), &proj.default_ref);
+
+    let files = cruxe_vcs::with_deepening(&workspace, config.history.deepen, || {
+        changed::diff_range(&workspace, range)
+    })
+    .map_err(|e| anyhow::anyhow!("Failed to collect changes: {}", e))?;
+    let report = changed::changed_symbols(&conn, &project_id, &resolved_ref, range, files)
+        .map_err(|e| anyhow::anyhow!("Failed to map changes to symbols: {}", e))?;
+
+    if format == "packages" {
+        for package in &report.packages {
+            println!("{}", package.package);
+        }
+        return Ok(());
+    }
+    super::render::render_records(format, &report, &report.packages, print_report)
+}
+
+/// The new side of `base..head` or `base...head`; `HEAD` when it is left
+/// out, `None` for a single revision (diffed against the working tree).
+fn range_head(range: &str) -> Option<&str> {
+    let (_, head) = range.split_once("...").or_else(|| range.split_once(".."))?;
+    Some(if head.is_empty() { "HEAD" } else { head })
+}
+
+fn print_report(report: &ChangedReport) {
+    if report.files_changed == 0 {
+        println!("No changes in {}.", report.range);
+        return;
+    }
+    println!(
+        "{} in ref {}: {} file(s), {} symbol(s), {} exported API change(s)",
+        report.range,
+        report.r#ref,
+        report.files_changed,
+        report.symbols_changed,
+        report.api_changes
+    );
+    for package in &report.packages {
+        println!();
+        println!("{}", package.package);
+        for file in &package.files {
+            match &file.old_path {
+                Some(old_path) => println!("  {} {} (from {})", file.status, file.path, old_path),
+                None => println!("  {} {}", file.status, file.path),
+            }
+        }
+        for changed in &package.symbols {
+            let mut flags = Vec::new();
+            if changed.exported {
+                flags.push("exported");
+            }
+            if changed.signature_changed {
+                flags.push("signature");
+            }
+            let flags = if flags.is_empty() {
+                String::new()
+            } else {
+                format!("  [{}]", flags.join(", "))
+            };
+            println!(
+                "    {} {}:{}  {} {}{}",
+                changed.change,
+                changed.symbol.path,
+                changed.symbol.line_start,
+                changed.symbol.kind,
+                changed.symbol.qualified_name,
+                flags
+            );
+        }
+    }
+}
@@ -0,0 +1,453 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::codeowners::CodeOwners;
+use cruxe_query::findings::baseline::{self, Baseline};
+use cruxe_query::findings::ratchet::{self, Ratchet};
+use cruxe_query::findings::{self, Finding, Profile, RuleSet};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_query::github;
+use cruxe_state::{db, project, schema};
+use serde::Serialize;
+use serde_json::json;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+
+const WEBHOOK_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// How findings are split by CODEOWNERS owner.
+#[derive(Debug, Default)]
+pub struct OwnerRouting<'a> {
+    /// Group printed output by owner.
+    pub by_owner: bool,
+    /// Write one `<owner>.json` per owner into this directory.
+    pub owners_dir: Option<&'a Path>,
+    /// POST each owner's findings to its `[routing.webhooks]` URL.
+    pub notify: bool,
+}
+
+/// One NDJSON record of owner-routed output.
+#[derive(Serialize)]
+struct OwnedFinding<'a> {
+    owner: &'a str,
+    #[serde(flatten)]
+    finding: &'a Finding,
+}
+
+impl OwnerRouting<'_> {
+    fn is_enabled(&self) -> bool {
+        self.by_owner || self.owners_dir.is_some() || self.notify
+    }
+}
+
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    rules: &[String],
+    format: &str,
+    r#ref: Option<&str>,
+    profile: Option<&str>,
+    ratchet: bool,
+    baseline: Option<&str>,
+    routing: &OwnerRouting<'_>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let gate = resolve_profile(profile, &config)?;
+    let mut rule_set =
+        RuleSet::from_config(&config.rules, gate.unwrap_or_default()).with_taint(&config.taint);
+    if !rules.is_empty() {
+        rule_set.restrict_to(rules);
+    }
+    for warning in rule_set.warnings() {
+        eprintln!("warning: {warning}");
+    }
+
+    let all_findings = findings::run_checks(&conn, &project_id, &resolved_ref, &rule_set)
+        .map_err(|e| anyhow::anyhow!("Check failed: {}", e))?;
+    // The ratchet counts every finding; reports and gates see only new ones
+    // in files in scope.
+    let baseline = baseline
+        .map(|path| super::baseline::load(&workspace, path))
+        .transpose()?;
+    let scope = super::scope::path_scope(&config, &workspace)?;
+    let mut findings = match &baseline {
+        Some(baseline) => baseline.new_findings(all_findings.clone()),
+        None => all_findings.clone(),
+    };
+    let baselined = all_findings.len() - findings.len();
+    findings.retain(|finding| scope.contains(&finding.path));
+    if routing.is_enabled() {
+        route_by_owner(
+            &workspace,
+            &config,
+            format,
+            &resolved_ref,
+            routing,
+            &findings,
+        )?;
+    } else if super::github::is_github_format(format) {
+        super::github::emit(format, "cruxe check", &github::findings_report(&findings))?;
+    } else {
+        super::render::render_records(format, &findings, &findings, |findings| {
+            print_findings(findings)
+        })?;
+    }
+
+    let mut failures = Vec::new();
+    if let Some(profile) = gate {
+        let count = findings::gate_failures(&findings, profile.fail_on());
+        if count > 0 {
+            failures.push(format!(
+                "{} finding(s) at or above {} (profile {})",
+                count,
+                profile.fail_on().as_str(),
+                profile.as_str()
+            ));
+        }
+    }
+    let use_ratchet = ratchet || config.check.ratchet;
+    let measure_complexity =
+        use_ratchet || fail_on.is_some_and(|spec| spec.mentions("complexity.max"));
+    let peak = if measure_complexity {
+        findings::max_complexity(&conn, &project_id, &resolved_ref, &config.index.languages)
+            .map_err(|e| anyhow::anyhow!("Complexity scan failed: {}", e))?
+    } else {
+        None
+    };
+    if use_ratchet {
+        let metrics = ratchet::measure(&all_findings, &rule_set, peak.as_ref());
+        let on_default_branch = resolved_ref == proj.default_ref;
+        failures.extend(apply_ratchet(
+            &workspace,
+            &metrics,
+            &resolved_ref,
+            on_default_branch,
+        )?);
+    }
+    if let Some(baseline) = &baseline {
+        report_baseline(
+            &conn,
+            &project_id,
+            &resolved_ref,
+            &config,
+            baseline,
+            baselined,
+        )?;
+    }
+    failures.extend(super::gate::violations(
+        fail_on,
+        "check",
+        &gate::check_metrics(&findings, peak.as_ref(), measure_complexity),
+    ));
+    super::gate::enforce("Check failed", &failures)
+}
+
+/// Say how much the baseline hid, and warn about functions that became
+/// too complex since it was written.
+fn report_baseline(
+    conn: &rusqlite::Connection,
+    project_id: &str,
+    resolved_ref: &str,
+    config: &Config,
+    known: &Baseline,
+    hidden: usize,
+) -> Result<()> {
+    let complex = findings::complex_functions(
+        conn,
+        project_id,
+        resolved_ref,
+        &config.index.languages,
+        baseline::COMPLEXITY_THRESHOLD,
+    )
+    .map_err(|e| anyhow::anyhow!("Complexity scan failed: {}", e))?;
+    for function in known.new_complexity(complex) {
+        eprintln!(
+            "warning: {}:{}: {} has complexity {} (baseline allows {})",
+            function.path,
+            function.line,
+            function.symbol,
+            function.complexity,
+            known
+                .known_complexity(&function)
+                .unwrap_or(baseline::COMPLEXITY_THRESHOLD)
+        );
+    }
+    eprintln!("{hidden} baselined finding(s) not shown");
+    Ok(())
+}
+
+/// Compare against the ratchet file and, on the default branch, tighten it.
+/// Returns one message per regressed metric.
+fn apply_ratchet(
+    workspace: &Path,
+    metrics: &BTreeMap<String, u64>,
+    resolved_ref: &str,
+    on_default_branch: bool,
+) -> Result<Vec<String>> {
+    let path = workspace.join(ratchet::RATCHET_FILE);
+    let existing = Ratchet::load(&path)?;
+    if existing.is_none() && !on_default_branch {
+        eprintln!(
+            "warning: no {} yet; run `cruxe check --ratchet` on the default branch to start one",
+            ratchet::RATCHET_FILE
+        );
+        return Ok(Vec::new());
+    }
+    let mut state = existing.unwrap_or_default();
+    let regressions = state.regressions(metrics);
+    if !regressions.is_empty() {
+        return Ok(regressions
+            .into_iter()
+            .map(|regression| {
+                format!(
+                    "ratchet: {} is {} (best so far: {})",
+                    regression.metric, regression.actual, regression.threshold
+                )
+            })
+            .collect());
+    }
+    if on_default_branch {
+        let changes = state.tighten(metrics, resolved_ref);
+        if !changes.is_empty() {
+            state.save(&path)?;
+            for change in &changes {
+                match change.from {
+                    Some(from) => {
+                        eprintln!(
+                            "ratchet: {} tightened {} -> {}",
+                            change.metric, from, change.to
+                        )
+                    }
+                    None => eprintln!("ratchet: {} starts at {}", change.metric, change.to),
+                }
+            }
+            eprintln!(
+                "Updated {}; commit it to keep the new thresholds.",
+                path.display()
+            );
+        }
+    }
+    Ok(Vec::new())
+}
+
+/// `--profile`, else `[check] profile`. `None` means report without gating.
+pub(crate) fn resolve_profile(cli: Option<&str>, config: &Config) -> Result<Option<Profile>> {
+    let Some(raw) = cli.or(config.check.profile.as_deref()) else {
+        return Ok(None);
+    };
+    Profile::parse(raw)
+        .map(Some)
+        .ok_or_else(|| anyhow::anyhow!("Unknown check profile `{raw}` (strict, standard, lenient)"))
+}
+
+fn route_by_owner(
+    workspace: &Path,
+    config: &Config,
+    format: &str,
+    resolved_ref: &str,
+    routing: &OwnerRouting<'_>,
+    findings: &[Finding],
+) -> Result<()> {
+    let owners = load_codeowners(workspace, config)?;
+    let grouped = findings::group_by_owner(findings, &owners);
+    let records: Vec<OwnedFinding<'_>> = grouped
+        .iter()
+        .flat_map(|(owner, owned)| {
+            owned
+                .iter()
+                .map(move |finding| OwnedFinding { owner, finding })
+        })
+        .collect();
+    super::render::render_records(format, &grouped, &records, |grouped| {
+        for (owner, owned) in grouped {
+            println!("## {} ({})", owner, owned.len());
+            print_findings(owned);
+            println!();
+        }
+    })?;
+    if let Some(dir) = routing.owners_dir {
+        write_owner_files(dir, resolved_ref, &grouped)?;
+    }
+    if routing.notify {
+        notify_owners(&config.routing.webhooks, resolved_ref, &grouped)?;
+    }
+    Ok(())
+}
+
+fn load_codeowners(workspace: &Path, config: &Config) -> Result<CodeOwners> {
+    let path = config.routing.codeowners.as_deref();
+    let owners = CodeOwners::load(workspace, path).with_context(|| {
+        format!(
+            "Failed to read {}",
+            workspace.join(path.unwrap_or("")).display()
+        )
+    })?;
+    let owners = owners.unwrap_or_else(|| {
+        eprintln!("warning: no CODEOWNERS file found; every finding is unowned");
+        CodeOwners::default()
+    });
+    Ok(owners.with_teams(&config.routing.teams))
+}
+
+fn write_owner_files(
+    dir: &Path,
+    resolved_ref: &str,
+    grouped: &BTreeMap<String, Vec<Finding>>,
+) -> Result<()> {
+    std::fs::create_dir_all(dir).with_context(|| format!("Failed to create {}", dir.display()))?;
+    for (owner, owned) in grouped {
+        let path = owner_file(dir, owner);
+        let body = json!({ "owner": owner, "ref": resolved_ref, "findings": owned });
+        std::fs::write(&path, serde_json::to_vec_pretty(&body)?)
+            .with_context(|| format!("Failed to write {}", path.display()))?;
+    }
+    eprintln!("Wrote {} owner file(s) to {}", grouped.len(), dir.display());
+    Ok(())
+}
+
+/// `@acme/payments` -> `acme-payments.json`, `(unowned)` -> `unowned.json`.
+fn owner_file(dir: &Path, owner: &str) -> PathBuf {
+    let name: String = owner
+        .trim_start_matches('@')
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() || matches!(c, '.' | '_' | '-') {
+                c
+            } else {
+                '-'
+            }
+        })
+        .collect();
+    let name = name.trim_matches('-');
+    let name = if name.is_empty() { "owner" } else { name };
+    dir.join(format!("{name}.json"))
+}
+
+/// Deliver every owner's findings to its webhook. Owners without a webhook
+/// are skipped; failed deliveries are reported together at the end.
+fn notify_owners(
+    webhooks: &BTreeMap<String, String>,
+    resolved_ref: &str,
+    grouped: &BTreeMap<String, Vec<Finding>>,
+) -> Result<()> {
+    if webhooks.is_empty() {
+        anyhow::bail!("--notify needs at least one `[routing.webhooks]` entry");
+    }
+    let client = reqwest::blocking::Client::builder()
+        .timeout(WEBHOOK_TIMEOUT)
+        .build()?;
+    let mut failed = Vec::new();
+    for (owner, owned) in grouped {
+        let Some(url) = webhooks.get(owner) else {
+            continue;
+        };
+        let body = json!({ "owner": owner, "ref": resolved_ref, "findings": owned });
+        match client
+            .post(url)
+            .json(&body)
+            .send()
+            .and_then(|response| response.error_for_status())
+        {
+            Ok(_) => eprintln!("Sent {} finding(s) to {}", owned.len(), owner),
+            Err(e) => failed.push(format!("{owner}: {e}")),
+        }
+    }
+    if !failed.is_empty() {
+        anyhow::bail!("Failed to notify owners:\n  {}", failed.join("\n  "));
+    }
+    Ok(())
+}
+
+/// `cruxe check --list-rules`: built-in rules with their effective state.
+pub fn list_rules(
+    workspace: &Path,
+    profile: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let gate = resolve_profile(profile, &config)?;
+    let rule_set =
+        RuleSet::from_config(&config.rules, gate.unwrap_or_default()).with_taint(&config.taint);
+    let enabled: Vec<_> = rule_set.enabled().collect();
+
+    println!(
+        "{:<32} {:<8} {:<8} {:<8} {:<10}",
+        "RULE", "LANG", "ENABLED", "SEVERITY", "CONFIDENCE"
+    );
+    println!("{}", "-".repeat(90));
+    for rule in findings::builtin_rules() {
+        let severity = enabled
+            .iter()
+            .find(|(active, _)| active.id == rule.id)
+            .map(|(_, severity)| *severity);
+        println!(
+            "{:<32} {:<8} {:<8} {:<8} {:<10} {}",
+            rule.id,
+            rule.language,
+            if severity.is_some() { "yes" } else { "no" },
+            severity.unwrap_or(rule.default_severity).as_str(),
+            rule.confidence.as_str(),
+            rule.summary,
+        );
+    }
+    if let Some(profile) = gate {
+        println!(
+            "\nProfile: {} (fails on {} or above)",
+            profile.as_str(),
+            profile.fail_on().as_str()
+        );
+    }
+    for warning in rule_set.warnings() {
+        eprintln!("warning: {warning}");
+    }
+    Ok(())
+}
+
+fn print_findings(findings: &[Finding]) {
+    for finding in findings {
+        println!(
+            "{}:{}: {} [{}] {} (in {}; {} confidence, id {})",
+            finding.path,
+            finding.line,
+            finding.severity.as_str(),
+            finding.rule,
+            finding.message,
+            finding.symbol,
+            finding.confidence.as_str(),
+            finding.id,
+        );
+        for other in &finding.also_reported_by {
+            println!(
+                "    also {} [{}] {}",
+                other.severity.as_str(),
+                other.rule,
+                other.message
+            );
+        }
+    }
+    eprintln!("{} finding(s)", findings.len());
+}
@@ -0,0 +1,144 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_indexer::chunker::{self, ChunkOptions, SourceChunk};
+use cruxe_indexer::scanner;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::BTreeSet;
+use std::path::Path;
+
+#[derive(Debug, Serialize, JsonSchema)]
+pub struct ChunkReport {
+    pub files: usize,
+    pub max_lines: usize,
+    pub overlap_lines: usize,
+    pub max_tokens: usize,
+    pub chunks: Vec<SourceChunk>,
+}
+
+/// `cruxe chunk [paths]...`: split source files into syntax-aware chunks for
+/// retrieval pipelines. Directories are scanned like `cruxe index` does (same
+/// languages and ignore files); no paths means the whole workspace. Works
+/// from the files on disk, so no index is needed.
+pub fn run(
+    workspace: &Path,
+    paths: &[String],
+    max_lines: Option<usize>,
+    overlap_lines: Option<usize>,
+    max_tokens: Option<usize>,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let defaults = ChunkOptions::from_config(&config.search.semantic.chunking);
+    let options = ChunkOptions {
+        max_lines: max_lines.unwrap_or(defaults.max_lines).max(1),
+        overlap_lines: overlap_lines.unwrap_or(defaults.overlap_lines),
+        max_tokens: max_tokens.unwrap_or(defaults.max_tokens).max(1),
+    };
+
+    let files = collect_files(&workspace, &config, paths)?;
+    let mut chunks = Vec::new();
+    for relative in &files {
+        let absolute = workspace.join(relative);
+        let Ok(content) = std::fs::read_to_string(&absolute) else {
+            eprintln!("warning: skipping {relative}: not UTF-8 text");
+            continue;
+        };
+        let language = scanner::detect_language(&absolute);
+        chunks.extend(chunker::chunk_source(
+            relative,
+            &content,
+            language.as_deref(),
+            &options,
+        ));
+    }
+
+    let report = ChunkReport {
+        files: files.len(),
+        max_lines: options.max_lines,
+        overlap_lines: options.overlap_lines,
+        max_tokens: options.max_tokens,
+        chunks,
+    };
+    super::render::render_records(format, &report, &report.chunks, print_report)
+}
+
+/// Workspace-relative paths to chunk: files as given, directories through
+/// the scanner.
+fn collect_files(workspace: &Path, config: &Config, paths: &[String]) -> Result<Vec<String>> {
+    let mut files = BTreeSet::new();
+    let mut dirs = Vec::new();
+    for path in paths {
+        let absolute = std::fs::canonicalize(path)
+            .or_else(|_| std::fs::canonicalize(workspace.join(path)))
+            .with_context(|| format!("No such file or directory: {path}"))?;
+        let relative = absolute
+            .strip_prefix(workspace)
+            .map_err(|_| anyhow::anyhow!("{path} is outside the workspace"))?
+            .to_string_lossy()
+            .replace('\\', "/");
+        if absolute.is_dir() {
+            dirs.push(relative);
+        } else {
+            files.insert(relative);
+        }
+    }
+    if paths.is_empty() || !dirs.is_empty() {
+        let scanned = scanner::scan_directory_with_ignores(
+            workspace,
+            config.index.max_file_size,
+            &config.index.languages,
+            true,
+            config.index.symlink_policy(),
+            &mut Vec::new(),
+        );
+        for file in scanned {
+            let inside = paths.is_empty()
+                || dirs.iter().any(|dir| {
+                    dir.is_empty()
+                        || file
+                            .relative_path
+                            .strip_prefix(dir.as_str())
+                            .is_some_and(|rest| rest.starts_with('/'))
+                });
+            if inside {
+                files.insert(file.relative_path);
+            }
+        }
+    }
+    Ok(files.into_iter().collect())
+}
+
+fn print_report(report: &ChunkReport) {
+    for chunk in &report.chunks {
+        let mut notes = Vec::new();
+        if chunk.overlap_lines > 0 {
+            notes.push(format!("{} overlap", chunk.overlap_lines));
+        }
+        if chunk.oversized {
+            notes.push("oversized".to_string());
+        }
+        let notes = if notes.is_empty() {
+            String::new()
+        } else {
+            format!(" ({})", notes.join(", "))
+        };
+        println!(
+            "{}  {}:{}-{}  ~{} tokens{}",
+            chunk.chunk_id, chunk.path, chunk.line_start, chunk.line_end, chunk.tokens, notes
+        );
+        if !chunk.symbols.is_empty() {
+            println!("    {}", chunk.symbols.join(", "));
+        }
+    }
+    println!(
+        "{} chunk(s) from {} file(s), at most {} lines / {} tokens with {} lines of overlap.",
+        report.chunks.len(),
+        report.files,
+        report.max_lines,
+        report.max_tokens,
+        report.overlap_lines
+    );
+}
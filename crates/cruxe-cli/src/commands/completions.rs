@@ -0,0 +1,162 @@
+use anyhow::Result;
+use clap_complete::Shell;
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_state::{db, project, symbols};
+use std::io::Write;
+use std::path::Path;
+
+/// Hidden subcommand the generated scripts call to list symbol names.
+pub const COMPLETE_SYMBOLS_COMMAND: &str = "__complete-symbols";
+
+/// Subcommand paths whose first positional argument is a symbol name.
+const SYMBOL_COMMANDS: &[&[&str]] = &[
+    &["refs"],
+    &["callers"],
+    &["callees"],
+    &["query", "call-graph"],
+];
+
+/// `cruxe completions <shell>`: clap's static completion script followed by
+/// a hook that completes symbol arguments from the index.
+pub fn print(shell: &str, command: &mut clap::Command) -> Result<()> {
+    let (target, hook) = match shell {
+        "bash" => (Shell::Bash, bash_hook()),
+        "zsh" => (Shell::Zsh, zsh_hook()),
+        "fish" => (Shell::Fish, fish_hook()),
+        other => anyhow::bail!("Unsupported shell: {}", other),
+    };
+    let mut stdout = std::io::stdout().lock();
+    clap_complete::generate(target, command, "cruxe", &mut stdout);
+    writeln!(stdout, "\n{hook}")?;
+    Ok(())
+}
+
+/// Print symbol names starting with `prefix`, one per line. Completion must
+/// stay quiet, so an uninitialized or unreadable project prints nothing.
+pub fn complete_symbols(
+    workspace: &Path,
+    prefix: &str,
+    limit: usize,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let Ok(workspace) = std::fs::canonicalize(workspace) else {
+        return Ok(());
+    };
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let Ok(config) = Config::load_with_file(Some(&workspace), config_file) else {
+        return Ok(());
+    };
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    if !db_path.exists() {
+        return Ok(());
+    }
+    let Ok(conn) = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    ) else {
+        return Ok(());
+    };
+    let Ok(Some(proj)) = project::get_by_root(&conn, &workspace_str) else {
+        return Ok(());
+    };
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, None, &proj.default_ref);
+
+    let names = symbols::complete_symbol_names(&conn, &project_id, &resolved_ref, prefix, limit)
+        .unwrap_or_default();
+    let mut stdout = std::io::stdout().lock();
+    for name in names {
+        writeln!(stdout, "{name}")?;
+    }
+    Ok(())
+}
+
+/// Shell test that the word being completed is the symbol argument of one
+/// of `SYMBOL_COMMANDS`. `word(i)` renders the i-th word (0 = `cruxe`) and
+/// `position` the index of the word under the cursor.
+fn symbol_position_test(word: impl Fn(usize) -> String, position: &str) -> String {
+    SYMBOL_COMMANDS
+        .iter()
+        .map(|path| {
+            let mut checks = vec![format!("{position} -eq {}", path.len() + 1)];
+            checks.extend(
+                path.iter()
+                    .enumerate()
+                    .map(|(i, name)| format!("\"{}\" == {name}", word(i + 1))),
+            );
+            format!("[[ {} ]]", checks.join(" && "))
+        })
+        .collect::<Vec<_>>()
+        .join(" || ")
+}
+
+fn bash_hook() -> String {
+    let test = symbol_position_test(|i| format!("${{words[{i}]}}"), "$cword");
+    // Bash splits words on `:`; bash-completion can rejoin them so qualified
+    // names like `crate::run` complete as one word.
+    format!(
+        r#"_cruxe_symbols() {{
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n : cur words cword
+    else
+        cur="${{COMP_WORDS[COMP_CWORD]}}"
+        words=("${{COMP_WORDS[@]}}")
+        cword=$COMP_CWORD
+    fi
+    if [[ "$cur" != -* ]] && {{ {test}; }}; then
+        COMPREPLY=($(compgen -W "$(cruxe {COMPLETE_SYMBOLS_COMMAND} -- "$cur" 2>/dev/null)" -- "$cur"))
+        if declare -F __ltrim_colon_completions >/dev/null; then
+            __ltrim_colon_completions "$cur"
+        fi
+        return 0
+    fi
+    _cruxe "$@"
+}}
+complete -F _cruxe_symbols -o bashdefault -o default cruxe"#
+    )
+}
+
+fn zsh_hook() -> String {
+    let test = symbol_position_test(|i| format!("${{words[{}]}}", i + 1), "$((CURRENT - 1))");
+    format!(
+        r#"_cruxe_symbols() {{
+    if [[ "${{words[CURRENT]}}" != -* ]] && {{ {test}; }}; then
+        local -a symbols
+        symbols=(${{(f)"$(cruxe {COMPLETE_SYMBOLS_COMMAND} -- "${{words[CURRENT]}}" 2>/dev/null)"}})
+        compadd -a symbols
+        return
+    fi
+    _cruxe "$@"
+}}
+compdef _cruxe_symbols cruxe"#
+    )
+}
+
+fn fish_hook() -> String {
+    SYMBOL_COMMANDS
+        .iter()
+        .map(|path| {
+            let mut conditions: Vec<String> = path
+                .iter()
+                .map(|name| format!("__fish_seen_subcommand_from {name}"))
+                .collect();
+            conditions.push(format!(
+                "test (count (commandline -opc)) -eq {}",
+                path.len() + 1
+            ));
+            format!(
+                "complete -c cruxe -n \"{}\" -f -a \"(cruxe {COMPLETE_SYMBOLS_COMMAND} -- (commandline -ct) 2>/dev/null)\"",
+                conditions.join("; and ")
+            )
+        })
+        .collect::<Vec<_>>()
+        .join("\n")
+}
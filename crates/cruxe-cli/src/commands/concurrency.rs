@@ -0,0 +1,89 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::concurrency::{self, ConcurrencyOptions, ConcurrencyReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe concurrency`: goroutine launches, channels, mutexes and
+/// WaitGroups per package, busiest first, then every site.
+pub fn run(
+    workspace: &Path,
+    mut options: ConcurrencyOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    options.scope = super::scope::path_scope(&config, &workspace)?;
+
+    let report = concurrency::summarize(&conn, &project_id, &resolved_ref, &options)
+        .map_err(|e| anyhow::anyhow!("Concurrency summary failed: {}", e))?;
+    super::render::render_records(format, &report, &report.sites, print_report)
+}
+
+fn print_report(report: &ConcurrencyReport) {
+    if report.sites.is_empty() {
+        println!("No concurrency sites on ref {}.", report.ref_name);
+        return;
+    }
+    println!(
+        "{:<40} {:>10} {:>8} {:>7} {:>10}",
+        "PACKAGE", "GOROUTINES", "CHANNELS", "MUTEXES", "WAITGROUPS"
+    );
+    for package in &report.packages {
+        println!(
+            "{:<40} {:>10} {:>8} {:>7} {:>10}",
+            package.package,
+            package.goroutines,
+            package.channels,
+            package.mutexes,
+            package.waitgroups
+        );
+    }
+
+    println!();
+    for site in &report.sites {
+        println!(
+            "{:<10} {:<40} {}{}",
+            site.kind,
+            format!("{}:{}", site.path, site.line),
+            site.detail,
+            site.symbol
+                .as_deref()
+                .map(|symbol| format!("  in {symbol}"))
+                .unwrap_or_default()
+        );
+    }
+    let counts: Vec<String> = report
+        .by_kind
+        .iter()
+        .map(|(kind, count)| format!("{count} {kind}"))
+        .collect();
+    println!();
+    println!(
+        "{} site(s) in {} package(s) on ref {}: {}",
+        report.total,
+        report.packages.len(),
+        report.ref_name,
+        counts.join(", ")
+    );
+}
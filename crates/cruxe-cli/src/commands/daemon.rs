@@ -0,0 +1,28 @@
+use anyhow::{Context, Result};
+use cruxe_mcp::daemon::{self, DaemonOptions};
+use std::path::Path;
+use std::time::Duration;
+
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    socket: Option<&Path>,
+    poll_interval_ms: u64,
+    no_prewarm: bool,
+    metrics_addr: Option<&str>,
+    refs: Vec<String>,
+    worktrees: bool,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let options = DaemonOptions {
+        socket_path: socket.map(Path::to_path_buf),
+        poll_interval: Duration::from_millis(poll_interval_ms.max(50)),
+        no_prewarm,
+        metrics_addr: metrics_addr.map(str::to_string),
+        refs,
+        worktrees,
+    };
+    daemon::run_daemon(&workspace, config_file, options)
+        .map_err(|e| anyhow::anyhow!("Daemon error: {}", e))
+}
@@ -0,0 +1,104 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::deadcode::{self, DeadCodeOptions, DeadCodeReport};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_query::github;
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe deadcode`: functions no entry point reaches and types/constants
+/// nothing mentions, plus, with `unused_exports`, exported API no other
+/// package uses. `allow` adds to the `[deadcode] allow` config globs.
+/// Symbols of generated files are left out unless `include_generated`.
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    allow: &[String],
+    include_exported: bool,
+    unused_exports: bool,
+    include_generated: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    baseline: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let options = DeadCodeOptions {
+        include_exported: include_exported || config.deadcode.include_exported,
+        allow: config.deadcode.allow.iter().chain(allow).cloned().collect(),
+        unused_exports: unused_exports || config.deadcode.unused_exports,
+        scope: super::scope::path_scope(&config, &workspace)?,
+        include_generated,
+    };
+    let mut report =
+        deadcode::find_dead_code(&conn, &workspace, &project_id, &resolved_ref, &options)
+            .map_err(|e| anyhow::anyhow!("Dead code analysis failed: {}", e))?;
+    if let Some(path) = baseline {
+        let known = super::baseline::load(&workspace, path)?;
+        let total = report.dead.len();
+        report.dead = known.new_dead_code(std::mem::take(&mut report.dead));
+        eprintln!(
+            "{} baselined dead symbol(s) not shown",
+            total - report.dead.len()
+        );
+    }
+
+    if super::github::is_github_format(format) {
+        super::github::emit(format, "cruxe deadcode", &github::deadcode_report(&report))?;
+    } else {
+        super::render::render_records(format, &report, &report.dead, print_report)?;
+    }
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(fail_on, "deadcode", &gate::deadcode_metrics(&report)),
+    )
+}
+
+fn print_report(report: &DeadCodeReport) {
+    println!(
+        "{} entry point(s), {} reachable symbol(s), {} allowlisted",
+        report.entry_points, report.reachable, report.allowed
+    );
+    if report.dead.is_empty() {
+        println!("No dead code found.");
+        return;
+    }
+    println!();
+    println!("{:<50} {:<10} {:<13} SYMBOL", "LOCATION", "KIND", "REASON");
+    println!("{}", "-".repeat(100));
+    for dead in &report.dead {
+        println!(
+            "{:<50} {:<10} {:<13} {}",
+            format!("{}:{}-{}", dead.path, dead.line_start, dead.line_end),
+            dead.kind,
+            dead.reason.as_str(),
+            dead.qualified_name
+        );
+    }
+    println!();
+    println!(
+        "{} candidate(s). Allowlist false positives with --allow or `[deadcode] allow` in the config.",
+        report.dead.len()
+    );
+}
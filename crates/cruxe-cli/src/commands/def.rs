@@ -0,0 +1,82 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::goto_definition::{self, DefinitionLookup, Position};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe def <file>:<line>:<col>`: the definition of the identifier at a
+/// source position. `file` is relative to the current directory.
+pub fn run(
+    workspace: &Path,
+    position: &str,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let mut position = Position::parse(position).map_err(|e| anyhow::anyhow!("{}", e))?;
+    // Accept paths relative to the current directory, not just the root.
+    if let Ok(absolute) = std::fs::canonicalize(&position.path) {
+        position.path = absolute.to_string_lossy().to_string();
+    }
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let lookup =
+        goto_definition::goto_definition(&conn, &workspace, &project_id, &resolved_ref, &position)
+            .map_err(|e| anyhow::anyhow!("Definition lookup failed: {}", e))?;
+
+    super::render::render_records(format, &lookup, &lookup.definitions, print_lookup)?;
+    if lookup.definitions.is_empty() && lookup.external.is_none() {
+        anyhow::bail!("No definition found for `{}`", lookup.identifier);
+    }
+    Ok(())
+}
+
+fn print_lookup(lookup: &DefinitionLookup) {
+    let name = match &lookup.qualifier {
+        Some(qualifier) => format!("{}.{}", qualifier, lookup.identifier),
+        None => lookup.identifier.clone(),
+    };
+    if let Some(import) = &lookup.external {
+        println!(
+            "`{}` is not in the index; it comes from a dependency imported at {}:{}: {}",
+            name, import.path, import.line, import.text
+        );
+        return;
+    }
+    if lookup.definitions.len() > 1 {
+        println!(
+            "`{}` is ambiguous; {} candidates matched by {}:",
+            name,
+            lookup.definitions.len(),
+            lookup.definitions[0].via.as_str()
+        );
+    }
+    for hit in &lookup.definitions {
+        println!(
+            "{}:{}  {} {}",
+            hit.path, hit.line_start, hit.kind, hit.canonical_id
+        );
+        if let Some(signature) = &hit.signature {
+            println!("    {}", signature);
+        }
+    }
+}
@@ -0,0 +1,197 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::deps::{self, DepsGraph, DepsOptions, ExternalDeps};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_query::github;
+use cruxe_query::import_check::{self, ImportCheck, ImportCheckReport};
+use cruxe_query::precommit::Layers;
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe deps`: the package-level import graph as text, JSON, DOT or Mermaid.
+/// With `check`, import cycles and `[layers]` violations instead, each with
+/// the imports behind it, failing when there are any.
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    external: &str,
+    group_depth: usize,
+    cycles_only: bool,
+    check: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    baseline: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let external = ExternalDeps::parse(external).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unknown --external mode `{}` (expected keep, collapse or hide)",
+            external
+        )
+    })?;
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    let scope = super::scope::path_scope(&config, &workspace)?;
+
+    if check {
+        if !matches!(format, "text" | "json" | "ndjson") {
+            anyhow::bail!("--check prints text, json or ndjson, not `{}`", format);
+        }
+        let layers = Layers::from_config(&config.layers)?;
+        let mut report = import_check::check_imports(&conn, &project_id, &resolved_ref, &layers)?;
+        report
+            .violations
+            .retain(|violation| violation.chain.iter().any(|hop| scope.contains(&hop.path)));
+        if let Some(path) = baseline {
+            let known = super::baseline::load(&workspace, path)?;
+            let total = report.violations.len();
+            report.violations.retain(|violation| {
+                violation.check != ImportCheck::ImportCycle
+                    || !known.is_known_cycle(&violation.packages)
+            });
+            eprintln!(
+                "{} baselined import cycle(s) not shown",
+                total - report.violations.len()
+            );
+        }
+        super::render::render_records(format, &report, &report.violations, print_check)?;
+
+        let mut failures =
+            super::gate::violations(fail_on, "deps", &gate::import_check_metrics(&report));
+        if !report.violations.is_empty() {
+            failures.push(format!(
+                "{} import cycle(s), {} layer violation(s)",
+                report.count(ImportCheck::ImportCycle),
+                report.count(ImportCheck::LayerViolation)
+            ));
+        }
+        return super::gate::enforce("Import check failed", &failures);
+    }
+
+    let mut graph = deps::build_deps_graph(
+        &conn,
+        &project_id,
+        &resolved_ref,
+        &DepsOptions {
+            external,
+            group_depth,
+            scope,
+        },
+    )?;
+    if let Some(path) = baseline {
+        let known = super::baseline::load(&workspace, path)?;
+        let total = graph.cycles.len();
+        graph.retain_cycles(|cycle| !known.is_known_cycle(cycle));
+        eprintln!(
+            "{} baselined import cycle(s) not shown",
+            total - graph.cycles.len()
+        );
+    }
+    // Measured before --cycles trims the graph for display.
+    let metrics = gate::deps_metrics(&graph);
+    if cycles_only {
+        graph.edges.retain(|edge| edge.in_cycle);
+        graph.nodes.retain(|node| node.in_cycle);
+    }
+
+    match format {
+        "dot" => print!("{}", deps::render_dot(&graph)),
+        "mermaid" => print!("{}", deps::render_mermaid(&graph)),
+        "github" | "github-check" => {
+            super::github::emit(format, "cruxe deps", &github::deps_report(&graph))?
+        }
+        format => super::render::render_records(format, &graph, &graph.edges, print_graph)?,
+    }
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(fail_on, "deps", &metrics),
+    )
+}
+
+fn print_graph(graph: &DepsGraph) {
+    let internal = graph.nodes.iter().filter(|node| !node.external).count();
+    println!(
+        "{} package(s), {} external, {} dependency edge(s) on ref {}",
+        internal,
+        graph.nodes.len() - internal,
+        graph.edges.len(),
+        graph.ref_name
+    );
+    let mut current = None;
+    for edge in &graph.edges {
+        if current != Some(edge.from.as_str()) {
+            println!();
+            println!("{}", edge.from);
+            current = Some(edge.from.as_str());
+        }
+        let external = graph
+            .nodes
+            .iter()
+            .any(|node| node.external && node.name == edge.to);
+        println!(
+            "  -> {}  ({} import(s)){}{}",
+            edge.to,
+            edge.imports,
+            if external { "  [external]" } else { "" },
+            if edge.in_cycle { "  [cycle]" } else { "" }
+        );
+    }
+
+    println!();
+    if graph.cycles.is_empty() {
+        println!("No import cycles between packages.");
+    } else {
+        println!("{} import cycle(s):", graph.cycles.len());
+        for cycle in &graph.cycles {
+            println!("  {}", cycle.join(" <-> "));
+        }
+    }
+}
+
+fn print_check(report: &ImportCheckReport) {
+    for violation in &report.violations {
+        let (path, line) = violation
+            .chain
+            .first()
+            .map(|hop| (hop.path.as_str(), hop.line))
+            .unwrap_or_default();
+        println!(
+            "{}:{}: {}: {}",
+            path,
+            line,
+            violation.check.as_str(),
+            violation.message
+        );
+        for hop in &violation.chain {
+            println!(
+                "    {} -> {}  {}:{} imports {}",
+                hop.from, hop.to, hop.path, hop.line, hop.target_path
+            );
+        }
+    }
+    if report.violations.is_empty() {
+        println!(
+            "{} package(s) on ref {}: no import cycles or layer violations",
+            report.packages, report.ref_name
+        );
+    }
+}
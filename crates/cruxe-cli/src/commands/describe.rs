@@ -0,0 +1,120 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::describe::{self, DescribeError, SymbolCard};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe describe <symbol>`: signature, docs, location, call graph
+/// neighbours, supertypes, reference count and recent history in one card.
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    symbol_path: Option<&str>,
+    history: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let card = describe::describe_symbol(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        symbol,
+        symbol_path,
+        history,
+    )
+    .map_err(|e| match e {
+        DescribeError::SymbolNotFound => {
+            anyhow::anyhow!("Symbol `{}` not found in ref `{}`", symbol, resolved_ref)
+        }
+        DescribeError::Ambiguous { candidates } => anyhow::anyhow!(
+            "`{}` matches {} symbols; pass a qualified name or --path:\n  {}",
+            symbol,
+            candidates.len(),
+            candidates.join("\n  ")
+        ),
+        other => anyhow::anyhow!("Describe failed: {}", other),
+    })?;
+
+    super::render::render(format, &card, print_card)
+}
+
+fn print_card(card: &SymbolCard) {
+    println!("{} ({}, {})", card.qualified_name, card.kind, card.language);
+    println!("  {}:{}-{}", card.path, card.line_start, card.line_end);
+    if let Some(signature) = &card.signature {
+        println!("  {}", signature.trim());
+    }
+    if let Some(visibility) = &card.visibility {
+        println!("  visibility: {}", visibility);
+    }
+    if let Some(parent) = &card.parent {
+        println!("  member of:  {}", parent);
+    }
+
+    if let Some(doc) = &card.doc {
+        println!();
+        for line in doc.lines() {
+            println!("  {}", line);
+        }
+    }
+
+    println!();
+    println!("Callers:    {}", card.callers);
+    println!("References: {}", card.references);
+    if !card.supertypes.is_empty() {
+        let supertypes: Vec<String> = card
+            .supertypes
+            .iter()
+            .map(|supertype| format!("{} {}", supertype.relation, supertype.name))
+            .collect();
+        println!("Supertypes: {}", supertypes.join(", "));
+    }
+
+    if !card.callees.is_empty() {
+        println!();
+        println!("Callees ({}):", card.callees.len());
+        for callee in &card.callees {
+            match (&callee.qualified_name, &callee.path) {
+                (Some(qualified_name), Some(path)) => {
+                    println!("  {:<40} {}", qualified_name, path)
+                }
+                _ => println!("  {:<40} (unresolved)", callee.name),
+            }
+        }
+    }
+
+    if !card.history.is_empty() {
+        println!();
+        println!("History:");
+        for entry in &card.history {
+            println!(
+                "  {} {} {:<20} {}",
+                entry.commit, entry.date, entry.author, entry.subject
+            );
+        }
+    }
+}
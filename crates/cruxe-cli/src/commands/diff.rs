@@ -0,0 +1,112 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_query::github;
+use cruxe_query::symbol_diff::{self, ChangeKind, SymbolDiff, SymbolDiffError, SymbolDiffOptions};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe diff`: added, removed, renamed and signature-changed symbols
+/// between two indexed refs, with exported API changes flagged.
+pub fn run(
+    workspace: &Path,
+    base_ref: &str,
+    head_ref: &str,
+    options: &SymbolDiffOptions,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+
+    let diff = symbol_diff::diff_symbols(&conn, &project_id, base_ref, head_ref, options).map_err(
+        |e| match e {
+            SymbolDiffError::RefNotIndexed(r#ref) => anyhow::anyhow!(
+                "Ref `{}` is not indexed. Run `cruxe index --ref {}` first.",
+                r#ref,
+                r#ref
+            ),
+            other => anyhow::anyhow!("Symbol diff failed: {}", other),
+        },
+    )?;
+
+    if super::github::is_github_format(format) {
+        return super::github::emit(format, "cruxe diff", &github::diff_report(&diff));
+    }
+    super::render::render_records(format, &diff, &diff.changes, print_diff)
+}
+
+fn print_diff(diff: &SymbolDiff) {
+    if diff.changes.is_empty() {
+        println!(
+            "No symbol changes between {} and {}.",
+            diff.base_ref, diff.head_ref
+        );
+        return;
+    }
+    for change in &diff.changes {
+        let marker = match change.change {
+            ChangeKind::Added => "+",
+            ChangeKind::Removed => "-",
+            _ => "~",
+        };
+        let api = if change.api_changed { "  [API]" } else { "" };
+        let detail = match change.change {
+            ChangeKind::Renamed => format!(
+                " (was {})",
+                change.old_qualified_name.as_deref().unwrap_or_default()
+            ),
+            ChangeKind::Moved => {
+                format!(" (from {})", change.old_path.as_deref().unwrap_or_default())
+            }
+            _ => String::new(),
+        };
+        println!(
+            "{} {:<18} {:<10} {}{}{}  {}:{}",
+            marker,
+            change.change.as_str(),
+            change.kind,
+            change.qualified_name,
+            detail,
+            api,
+            change.path,
+            change.line
+        );
+        if change.change == ChangeKind::SignatureChanged {
+            if let Some(old) = &change.old_signature {
+                println!("      - {}", old.trim());
+            }
+            if let Some(new) = &change.signature {
+                println!("      + {}", new.trim());
+            }
+        }
+    }
+    let counts: Vec<String> = diff
+        .counts
+        .iter()
+        .map(|(kind, count)| format!("{count} {kind}"))
+        .collect();
+    println!();
+    println!(
+        "{} -> {}: {}; {} exported API change(s)",
+        diff.base_ref,
+        diff.head_ref,
+        counts.join(", "),
+        diff.api_changes
+    );
+}
@@ -0,0 +1,92 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::doc_coverage::{self, DocCoverageReport};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe doc-coverage`: exported symbols without a doc comment, with the
+/// coverage of each package, least documented first.
+pub fn run(
+    workspace: &Path,
+    path_prefix: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let scope = super::scope::path_scope(&config, &workspace)?;
+    let report = doc_coverage::doc_coverage(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        path_prefix,
+        &scope,
+    )
+    .map_err(|e| anyhow::anyhow!("Doc coverage failed: {}", e))?;
+    super::render::render_records(format, &report, &report.undocumented, print_report)?;
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(
+            fail_on,
+            "doc-coverage",
+            &gate::doc_coverage_metrics(&report),
+        ),
+    )
+}
+
+fn print_report(report: &DocCoverageReport) {
+    if report.exported == 0 {
+        println!("No exported symbols on ref {}.", report.ref_name);
+        return;
+    }
+    println!(
+        "{:<40} {:>9} {:>10} {:>9}",
+        "PACKAGE", "EXPORTED", "DOCUMENTED", "COVERAGE"
+    );
+    for package in &report.packages {
+        println!(
+            "{:<40} {:>9} {:>10} {:>8.1}%",
+            package.package, package.exported, package.documented, package.coverage
+        );
+    }
+    if !report.undocumented.is_empty() {
+        println!();
+        println!("Undocumented:");
+        for symbol in &report.undocumented {
+            println!(
+                "  {:<50} {} {}",
+                format!("{}:{}", symbol.path, symbol.line),
+                symbol.kind,
+                symbol.qualified_name
+            );
+        }
+    }
+    println!();
+    println!(
+        "{} of {} exported symbol(s) documented ({:.1}%) on ref {}",
+        report.documented, report.exported, report.coverage, report.ref_name
+    );
+}
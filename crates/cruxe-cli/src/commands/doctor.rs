@@ -1,12 +1,17 @@
 use anyhow::{Context, Result};
 use cruxe_core::config::Config;
 use cruxe_core::constants;
-use cruxe_core::types::generate_project_id;
-use cruxe_indexer::parser;
-use cruxe_state::{db, project};
+use cruxe_core::types::{Project, generate_project_id};
+use cruxe_core::vcs;
+use cruxe_indexer::{import_extract, parser, writer};
+use cruxe_state::{db, edges, integrity, jobs, manifest, project, symbols, tantivy_index};
+use rusqlite::Connection;
 use std::path::Path;
 
-pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
+/// How many offending paths to list per check before summarising.
+const MAX_LISTED_PATHS: usize = 5;
+
+pub fn run(repo_root: &Path, config_file: Option<&Path>, repair: bool) -> Result<()> {
     let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
     let repo_root_str = repo_root.to_string_lossy().to_string();
 
@@ -84,6 +89,15 @@ pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
         }
     }
 
+    // Check index integrity against the working tree
+    if db_path.exists() {
+        let conn = db::open_connection(&db_path)?;
+        if let Some(proj) = project::get_by_root(&conn, &repo_root_str)? {
+            println!();
+            all_ok &= check_index_integrity(&conn, &proj, &repo_root, &data_dir, repair)?;
+        }
+    }
+
     // Check tree-sitter grammars
     println!();
     println!("Tree-sitter grammars:");
@@ -131,3 +145,172 @@ pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
 
     Ok(())
 }
+
+/// Verify persisted index consistency for the checked-out ref. With `repair`,
+/// drops rows that can never be valid and invalidates the manifest hashes of
+/// affected files so the next `cruxe index` re-processes only those.
+fn check_index_integrity(
+    conn: &Connection,
+    proj: &Project,
+    repo_root: &Path,
+    data_dir: &Path,
+    repair: bool,
+) -> Result<bool> {
+    let repo = proj.project_id.as_str();
+    let effective_ref = vcs::resolve_effective_ref(repo_root, None, &proj.default_ref);
+    println!("Index integrity (ref: {}):", effective_ref);
+
+    let repair = match jobs::get_active_job(conn, repo)? {
+        Some(active) if repair => {
+            println!(
+                "  Repair skipped: index job {} is in progress",
+                active.job_id
+            );
+            false
+        }
+        _ => repair,
+    };
+
+    let mut ok = true;
+    let mut invalidated = 0usize;
+
+    print!("  Schema version ... ");
+    let applied = integrity::applied_schema_version(conn)?;
+    if integrity::schema_is_newer_than_binary(applied) {
+        println!(
+            "FAIL: database is at v{} but this cruxe supports v{} - upgrade cruxe",
+            applied.unwrap_or_default(),
+            cruxe_state::schema::CURRENT_SCHEMA_VERSION
+        );
+        // Nothing below can be trusted against a newer layout.
+        return Ok(false);
+    }
+    match applied {
+        Some(version) => println!("OK (v{})", version),
+        None => println!("not migrated yet (run `cruxe index`)"),
+    }
+
+    print!("  Parser version ... ");
+    if proj.parser_version == constants::PARSER_VERSION {
+        println!("OK (v{})", proj.parser_version);
+    } else {
+        ok = false;
+        println!(
+            "WARN: indexed with parser v{}, current is v{}",
+            proj.parser_version,
+            constants::PARSER_VERSION
+        );
+        if repair {
+            invalidated += manifest::invalidate_hashes(conn, repo, None)?;
+            project::update_project(
+                conn,
+                &Project {
+                    parser_version: constants::PARSER_VERSION,
+                    updated_at: cruxe_core::time::now_iso8601(),
+                    ..proj.clone()
+                },
+            )?;
+        }
+    }
+
+    print!("  Tantivy schema ... ");
+    match tantivy_index::IndexSet::open_existing(data_dir) {
+        Ok(_) => println!("OK"),
+        Err(e) => {
+            ok = false;
+            println!("FAIL: {} - run `cruxe index --force`", e);
+        }
+    }
+
+    print!("  Dangling edges ... ");
+    let dangling = integrity::find_dangling_edges(conn, repo, &effective_ref)?;
+    if dangling.is_empty() {
+        println!("OK");
+    } else {
+        ok = false;
+        println!("WARN: {} edge(s) reference missing symbols", dangling.len());
+        let affected = integrity::affected_paths(&dangling);
+        print_paths(&affected);
+        if repair {
+            integrity::delete_dangling_edges(conn, repo, &effective_ref)?;
+            invalidated += manifest::invalidate_paths(conn, repo, &effective_ref, &affected)?;
+        }
+    }
+
+    print!("  Orphaned symbols ... ");
+    let orphans = integrity::find_orphan_symbol_paths(conn, repo, &effective_ref)?;
+    if orphans.is_empty() {
+        println!("OK");
+    } else {
+        ok = false;
+        println!(
+            "WARN: {} file(s) have symbols but no manifest entry",
+            orphans.len()
+        );
+        print_paths(&orphans);
+        if repair {
+            delete_orphaned_files(conn, repo, &effective_ref, data_dir, &orphans)?;
+        }
+    }
+
+    print!("  Working tree ... ");
+    let drift = integrity::check_working_tree(conn, repo, &effective_ref, repo_root)?;
+    if drift.missing_files.is_empty() && drift.hash_mismatches.is_empty() {
+        println!("OK (in sync)");
+    } else {
+        // Drift is expected after edits; only `cruxe index` is needed.
+        println!(
+            "STALE: {} changed, {} deleted since last index - run `cruxe index`",
+            drift.hash_mismatches.len(),
+            drift.missing_files.len()
+        );
+        print_paths(&drift.hash_mismatches);
+        print_paths(&drift.missing_files);
+    }
+
+    if repair && !ok {
+        println!(
+            "  Repair complete: {} file(s) invalidated; run `cruxe index` to rebuild them",
+            invalidated
+        );
+    } else if !ok {
+        println!("  Run `cruxe doctor --repair` to drop bad rows and invalidate affected files");
+    }
+    Ok(ok)
+}
+
+/// Remove symbols, edges and search documents of files the manifest no
+/// longer tracks. They are unreachable by incremental indexing otherwise.
+fn delete_orphaned_files(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    data_dir: &Path,
+    paths: &[String],
+) -> Result<()> {
+    let index_set = tantivy_index::IndexSet::open(data_dir)?;
+    let batch = writer::BatchWriter::new(&index_set)?;
+    for path in paths {
+        let symbol_ids: Vec<String> = symbols::list_symbols_in_file(conn, repo, ref_name, path)?
+            .into_iter()
+            .map(|symbol| symbol.symbol_stable_id)
+            .collect();
+        batch.delete_file_docs(&index_set, repo, ref_name, path);
+        symbols::delete_symbols_for_file(conn, repo, ref_name, path)?;
+        let source_edge_id = import_extract::source_symbol_id_for_path(path);
+        edges::delete_edges_for_file(conn, repo, ref_name, vec![source_edge_id.as_str()])?;
+        edges::delete_call_edges_for_file(conn, repo, ref_name, path)?;
+        edges::delete_call_edges_to_symbols(conn, repo, ref_name, &symbol_ids)?;
+    }
+    batch.commit()?;
+    Ok(())
+}
+
+fn print_paths(paths: &[String]) {
+    for path in paths.iter().take(MAX_LISTED_PATHS) {
+        println!("      {}", path);
+    }
+    if paths.len() > MAX_LISTED_PATHS {
+        println!("      ... and {} more", paths.len() - MAX_LISTED_PATHS);
+    }
+}
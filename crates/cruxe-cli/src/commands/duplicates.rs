@@ -0,0 +1,81 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::duplicates::{self, DuplicateOptions, DuplicateReport};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe duplicates`: clusters of duplicated and near-duplicated function
+/// bodies, most removable lines first.
+pub fn run(
+    workspace: &Path,
+    mut options: DuplicateOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    options.scope = super::scope::path_scope(&config, &workspace)?;
+
+    let report = duplicates::find_duplicates(&conn, &project_id, &resolved_ref, &options)
+        .map_err(|e| anyhow::anyhow!("Duplicate detection failed: {}", e))?;
+    super::render::render_records(format, &report, &report.clusters, print_report)?;
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(fail_on, "duplicates", &gate::duplicates_metrics(&report)),
+    )
+}
+
+fn print_report(report: &DuplicateReport) {
+    if report.clusters.is_empty() {
+        println!(
+            "No duplicates among {} function(s) on ref {}.",
+            report.functions, report.ref_name
+        );
+        return;
+    }
+    for cluster in &report.clusters {
+        println!(
+            "{} copies, similarity {:.2}{}, {} duplicated line(s)",
+            cluster.members.len(),
+            cluster.similarity,
+            if cluster.exact { " (exact)" } else { "" },
+            cluster.duplicated_lines
+        );
+        for member in &cluster.members {
+            println!(
+                "  {:<50} {}",
+                format!("{}:{}-{}", member.path, member.line_start, member.line_end),
+                member.qualified_name
+            );
+        }
+        println!();
+    }
+    println!(
+        "{} cluster(s), {} duplicated line(s) across {} function(s) on ref {}",
+        report.clusters.len(),
+        report.duplicated_lines,
+        report.functions,
+        report.ref_name
+    );
+}
@@ -0,0 +1,90 @@
+use anyhow::{Context, Result};
+use cruxe_core::cancel::CancellationToken;
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_indexer::embed_refresh::{self, EmbedRefreshReport};
+use cruxe_state::tantivy_index::IndexSet;
+use cruxe_state::{db, project, schema};
+use std::path::Path;
+
+/// `cruxe embed`: embed the snippets of every symbol of the ref with the
+/// configured provider, re-embedding only files that changed since the last
+/// run (every file with `force`). Stops between files when `cancel` fires.
+pub fn run(
+    workspace: &Path,
+    r#ref: Option<&str>,
+    force: bool,
+    format: &str,
+    config_file: Option<&Path>,
+    cancel: &CancellationToken,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let data_dir = config.project_data_dir(&project_id);
+    let conn = db::open_connection_with_config(
+        &data_dir.join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    let index_set = IndexSet::open_existing(&data_dir)
+        .map_err(|e| anyhow::anyhow!("Failed to open indices: {}. Run `cruxe index` first.", e))?;
+
+    let semantic = &config.search.semantic;
+    let report = embed_refresh::refresh_embeddings(
+        &conn,
+        &index_set,
+        semantic,
+        &project_id,
+        &resolved_ref,
+        force,
+        cancel,
+    )
+    .map_err(|e| match e {
+        StateError::Cancelled(cancelled) => anyhow::Error::new(cancelled),
+        e => anyhow::anyhow!("Embedding failed: {}", e),
+    })?;
+
+    if report.external_provider_blocked {
+        eprintln!(
+            "note: provider `{}` sends code off this machine; set \
+             search.semantic.external_provider_enabled and allow_code_payload_to_external \
+             to use it. The local model was used instead.",
+            semantic.embedding.provider
+        );
+    }
+    if !semantic.mode.eq_ignore_ascii_case("hybrid") {
+        eprintln!(
+            "note: search.semantic.mode is `{}`; search uses the stored vectors once it is `hybrid`.",
+            semantic.mode
+        );
+    }
+    super::render::render(format, &report, |report| {
+        print_report(report, &resolved_ref)
+    })
+}
+
+fn print_report(report: &EmbedRefreshReport, ref_name: &str) {
+    println!(
+        "Embedded {} file(s) ({} vectors) on ref `{}` with {} ({}).",
+        report.files_embedded,
+        report.vectors_written,
+        ref_name,
+        report.model_id,
+        report.model_version
+    );
+    println!(
+        "{} unchanged, {} removed.",
+        report.files_unchanged, report.files_removed
+    );
+}
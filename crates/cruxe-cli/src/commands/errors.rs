@@ -0,0 +1,111 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::error_paths::{self, ErrorPathError, ErrorReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe errors`: what a Go function does with the errors of its calls,
+/// and the caller paths the errors it returns take until they stop.
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    path: Option<&str>,
+    depth: u32,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let report = error_paths::error_paths(&conn, &project_id, &resolved_ref, symbol, path, depth)
+        .map_err(|e| match e {
+        ErrorPathError::SymbolNotFound => {
+            anyhow::anyhow!("Symbol `{symbol}` not found in ref {resolved_ref}")
+        }
+        other => anyhow::anyhow!("Error analysis failed: {}", other),
+    })?;
+    super::render::render_records(format, &report, &report.paths, print_report)
+}
+
+fn print_report(report: &ErrorReport) {
+    let symbol = &report.symbol;
+    println!(
+        "{} ({}:{}){}",
+        symbol.qualified_name,
+        symbol.path,
+        symbol.line_start,
+        if report.returns_error {
+            ", returns error"
+        } else {
+            ""
+        }
+    );
+
+    println!();
+    if report.sites.is_empty() {
+        println!("No calls with error results.");
+    } else {
+        println!("Errors received:");
+        for site in &report.sites {
+            println!("  {:<6} {:<11} {}", site.line, site.handling, site.callee);
+        }
+    }
+
+    if !report.returns_error {
+        return;
+    }
+    println!();
+    if report.paths.is_empty() {
+        println!("No indexed callers.");
+        return;
+    }
+    println!("Errors returned:");
+    for path in &report.paths {
+        let hops: Vec<String> = path
+            .hops
+            .iter()
+            .map(|hop| {
+                format!(
+                    "{} ({}:{}, {})",
+                    hop.function, hop.path, hop.line, hop.handling
+                )
+            })
+            .collect();
+        println!("  {} -> {}", symbol.name, hops.join(" -> "));
+        if path.hops.last().is_none_or(|hop| hop.handling != path.end) {
+            println!("      ends: {}", path.end);
+        }
+    }
+    let ends: Vec<String> = report
+        .ends
+        .iter()
+        .map(|(end, count)| format!("{count} {end}"))
+        .collect();
+    println!();
+    println!(
+        "{} path(s), depth {}: {}{}",
+        report.paths.len(),
+        report.depth_applied,
+        ends.join(", "),
+        if report.truncated { " (truncated)" } else { "" }
+    );
+}
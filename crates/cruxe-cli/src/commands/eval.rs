@@ -93,6 +93,7 @@ pub fn run_retrieval(
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         );
 
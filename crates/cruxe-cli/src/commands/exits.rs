@@ -0,0 +1,99 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::exits::{self, ExitReport};
+use cruxe_query::gate::{self, FailOn};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe exits`: call paths from library or handler code to `os.Exit`,
+/// `Fatal` loggers and unrecovered panics.
+pub fn run(
+    workspace: &Path,
+    from: &[String],
+    format: &str,
+    r#ref: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let scope = super::scope::path_scope(&config, &workspace)?;
+    let report = exits::find_exits(&conn, &project_id, &resolved_ref, from, &scope)
+        .map_err(|e| anyhow::anyhow!("Exit analysis failed: {}", e))?;
+    super::render::render_records(format, &report, &report.paths, print_report)?;
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(fail_on, "exits", &gate::exits_metrics(&report)),
+    )
+}
+
+fn print_report(report: &ExitReport) {
+    if report.sites.is_empty() {
+        println!("No exit calls on ref {}.", report.ref_name);
+        return;
+    }
+    println!("Exit calls:");
+    for site in &report.sites {
+        println!(
+            "  {:<40} {:<6} {}{}",
+            format!("{}:{}", site.path, site.line),
+            site.kind,
+            site.call,
+            if site.in_goroutine {
+                " (in goroutine)"
+            } else {
+                ""
+            }
+        );
+    }
+
+    println!();
+    if report.paths.is_empty() {
+        println!(
+            "None reachable from the {} function(s) in scope.",
+            report.scope
+        );
+        return;
+    }
+    println!("Reachable from:");
+    for path in &report.paths {
+        let hops: Vec<String> = path
+            .hops
+            .iter()
+            .map(|hop| format!("{} ({}:{})", hop.function, hop.path, hop.line))
+            .collect();
+        println!(
+            "  {:<6} {} -> {}",
+            path.kind,
+            hops.join(" -> "),
+            path.site.call
+        );
+    }
+    println!();
+    println!(
+        "{} exit path(s), {} panic path(s) from {} function(s) in scope on ref {}",
+        report.count("exit"),
+        report.count("panic"),
+        report.scope,
+        report.ref_name
+    );
+}
@@ -0,0 +1,307 @@
+use anyhow::{Context, Result};
+use cruxe_core::audit::{AuditEvent, AuditLog};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::graph_export::{self, ExportFormat, ExportOptions};
+use cruxe_state::artifact::{self, ArtifactWriter};
+use cruxe_state::{db, project, schema};
+use rusqlite::Connection;
+use serde_json::json;
+use std::io::IsTerminal;
+use std::path::Path;
+use std::time::Instant;
+
+pub fn run(
+    workspace: &Path,
+    format: &str,
+    output: Option<&Path>,
+    out_dir: Option<&Path>,
+    call_path: &[String],
+    compress: bool,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let format = ExportFormat::parse(format)
+        .ok_or_else(|| anyhow::anyhow!("Unsupported export format: {format}"))?;
+    if format.writes_directory() {
+        if out_dir.is_none() {
+            anyhow::bail!(
+                "{} export writes {} and {}; pass --out-dir DIR",
+                format.as_str(),
+                graph_export::SYMBOLS_FILE,
+                graph_export::EDGES_FILE
+            );
+        }
+    } else if out_dir.is_some() {
+        anyhow::bail!("--out-dir is only used with --format csv; use --output instead");
+    }
+
+    if !call_path.is_empty() && format != ExportFormat::Plantuml {
+        anyhow::bail!("--call-path is only used with --format plantuml");
+    }
+
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let started = Instant::now();
+    let exported = if let Some(dir) = out_dir {
+        write_csv_tables(&conn, &project_id, &resolved_ref, dir, compress)?
+    } else if format == ExportFormat::Ndjson {
+        // NDJSON streams rows as they are read instead of loading a snapshot.
+        stream_ndjson(&conn, &project_id, &resolved_ref, output, compress)?
+    } else {
+        write_snapshot(
+            &conn,
+            &workspace,
+            &project_id,
+            &resolved_ref,
+            format,
+            output,
+            call_path,
+            compress,
+        )?
+    };
+
+    let written_bytes = output
+        .and_then(|path| std::fs::metadata(path).ok())
+        .map_or(0, |meta| meta.len());
+    audit_export(
+        &config,
+        &project_id,
+        format,
+        json!({
+            "ref": resolved_ref,
+            "output": output.map(|path| path.display().to_string()),
+            "out_dir": out_dir.map(|path| path.display().to_string()),
+            "call_path": call_path,
+            "compress": compress,
+        }),
+        exported,
+        written_bytes,
+        started,
+    );
+    Ok(())
+}
+
+/// `cruxe index --format pb`: write the index that was just built as a
+/// binary file, by default next to the state DB.
+pub fn write_index_file(
+    workspace: &Path,
+    format: &str,
+    output: Option<&Path>,
+    compress: bool,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let output = match output {
+        Some(path) => path.to_path_buf(),
+        None => {
+            let workspace =
+                std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+            let config = Config::load_with_file(Some(&workspace), config_file)?;
+            let project_id = generate_project_id(&workspace.to_string_lossy());
+            config
+                .project_data_dir(&project_id)
+                .join(graph_export::INDEX_PB_FILE)
+        }
+    };
+    run(
+        workspace,
+        format,
+        Some(&output),
+        None,
+        &[],
+        compress,
+        r#ref,
+        config_file,
+    )
+}
+
+/// Write a whole-snapshot format; returns the number of nodes and edges.
+fn write_snapshot(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    format: ExportFormat,
+    output: Option<&Path>,
+    call_path: &[String],
+    compress: bool,
+) -> Result<u64> {
+    let snapshot = graph_export::load_graph_snapshot(conn, project_id, ref_name)?;
+    let options = ExportOptions {
+        source_root: Some(workspace.to_path_buf()),
+        call_path: call_path.to_vec(),
+    };
+
+    match output {
+        Some(path) => {
+            let mut writer = ArtifactWriter::create(path, compress)
+                .with_context(|| format!("Failed to create {}", path.display()))?;
+            graph_export::write_graph(&snapshot, format, &options, &mut writer)?;
+            writer.finish()?;
+            eprintln!(
+                "Exported {} nodes, {} edges ({}) to {}",
+                snapshot.nodes.len(),
+                snapshot.edges.len(),
+                format.as_str(),
+                path.display()
+            );
+            if snapshot.unresolved_edges > 0 {
+                eprintln!("  Skipped {} unresolved edges", snapshot.unresolved_edges);
+            }
+        }
+        None => {
+            let stdout = std::io::stdout();
+            if (format.is_binary() || compress) && stdout.is_terminal() {
+                anyhow::bail!(
+                    "Refusing to write binary {} output to a terminal; use --output",
+                    format.as_str()
+                );
+            }
+            let mut writer = ArtifactWriter::new(std::io::BufWriter::new(stdout.lock()), compress)?;
+            graph_export::write_graph(&snapshot, format, &options, &mut writer)?;
+            writer.finish()?;
+        }
+    }
+
+    Ok((snapshot.nodes.len() + snapshot.edges.len()) as u64)
+}
+
+/// Record the export in the audit log when `audit.enabled` is set. Best
+/// effort: a finished export is not failed by a logging error.
+fn audit_export(
+    config: &Config,
+    project_id: &str,
+    format: ExportFormat,
+    arguments: serde_json::Value,
+    exported: u64,
+    written_bytes: u64,
+    started: Instant,
+) {
+    let log = match AuditLog::from_config(config) {
+        Ok(Some(log)) => log,
+        Ok(None) => return,
+        Err(err) => {
+            eprintln!("Warning: failed to open audit log: {err}");
+            return;
+        }
+    };
+    let client = std::env::var("USER")
+        .or_else(|_| std::env::var("USERNAME"))
+        .unwrap_or_else(|_| "unknown".to_string());
+    let event = AuditEvent {
+        timestamp: cruxe_core::time::now_iso8601(),
+        action: "export".to_string(),
+        client,
+        tenant: None,
+        project_id: project_id.to_string(),
+        operation: format.as_str().to_string(),
+        arguments,
+        outcome: "ok".to_string(),
+        result_count: Some(exported),
+        result_bytes: written_bytes,
+        duration_ms: started.elapsed().as_millis() as u64,
+    };
+    if let Err(err) = log.record(event) {
+        eprintln!(
+            "Warning: failed to write audit log {}: {err}",
+            log.path().display()
+        );
+    }
+}
+
+fn stream_ndjson(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    output: Option<&Path>,
+    compress: bool,
+) -> Result<u64> {
+    let stats = match output {
+        Some(path) => {
+            let mut writer = ArtifactWriter::create(path, compress)
+                .with_context(|| format!("Failed to create {}", path.display()))?;
+            let stats = graph_export::stream_ndjson(conn, project_id, ref_name, &mut writer)?;
+            writer.finish()?;
+            eprintln!(
+                "Exported {} nodes, {} edges (ndjson) to {}",
+                stats.nodes,
+                stats.edges,
+                path.display()
+            );
+            if stats.unresolved_edges > 0 {
+                eprintln!("  Skipped {} unresolved edges", stats.unresolved_edges);
+            }
+            stats
+        }
+        None => {
+            let stdout = std::io::stdout();
+            if compress && stdout.is_terminal() {
+                anyhow::bail!("Refusing to write compressed output to a terminal; use --output");
+            }
+            let mut writer = ArtifactWriter::new(std::io::BufWriter::new(stdout.lock()), compress)?;
+            let stats = graph_export::stream_ndjson(conn, project_id, ref_name, &mut writer)?;
+            writer.finish()?;
+            stats
+        }
+    };
+    Ok((stats.nodes + stats.edges) as u64)
+}
+
+fn write_csv_tables(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    dir: &Path,
+    compress: bool,
+) -> Result<u64> {
+    std::fs::create_dir_all(dir).with_context(|| format!("Failed to create {}", dir.display()))?;
+    let create = |name: &str| -> Result<ArtifactWriter<std::io::BufWriter<std::fs::File>>> {
+        let mut path = dir.join(name);
+        if compress {
+            path = artifact::with_zstd_extension(&path);
+        }
+        ArtifactWriter::create(&path, compress)
+            .with_context(|| format!("Failed to create {}", path.display()))
+    };
+    let mut symbols_out = create(graph_export::SYMBOLS_FILE)?;
+    let mut edges_out = create(graph_export::EDGES_FILE)?;
+    let stats = graph_export::write_csv_tables(
+        conn,
+        project_id,
+        ref_name,
+        &mut symbols_out,
+        &mut edges_out,
+    )?;
+    symbols_out.finish()?;
+    edges_out.finish()?;
+    eprintln!(
+        "Exported {} nodes, {} edges (csv) to {}",
+        stats.nodes,
+        stats.edges,
+        dir.display()
+    );
+    if stats.unresolved_edges > 0 {
+        eprintln!("  Skipped {} unresolved edges", stats.unresolved_edges);
+    }
+    Ok((stats.nodes + stats.edges) as u64)
+}
@@ -0,0 +1,296 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::call_graph::CallGraphEdgeResult;
+use cruxe_query::federation::{self, Federated, IndexSource};
+use cruxe_query::fuzzy::SymbolFilter;
+use cruxe_query::ref_sites::ReferenceSite;
+use cruxe_query::search::{SearchExecutionOptions, SearchResult};
+use cruxe_state::{db, project, tantivy_index::IndexSet};
+use rusqlite::Connection;
+use std::path::{Path, PathBuf};
+
+use crate::style::{self, Style};
+
+/// An index of the federation, opened for this run.
+struct OpenIndex {
+    name: String,
+    workspace: PathBuf,
+    project_id: String,
+    ref_name: String,
+    conn: Connection,
+    index_set: IndexSet,
+}
+
+impl OpenIndex {
+    fn source(&self) -> IndexSource<'_> {
+        IndexSource {
+            name: &self.name,
+            workspace: &self.workspace,
+            repo: &self.project_id,
+            ref_name: &self.ref_name,
+            conn: &self.conn,
+            index_set: &self.index_set,
+        }
+    }
+}
+
+/// The index of `workspace`, named after its directory, followed by those
+/// declared under `[federation]`. `ref` applies to the local index only. A
+/// declared index that cannot be opened is reported and skipped.
+fn open_indexes(
+    workspace: &Path,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<Vec<OpenIndex>> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    if config.federation.is_empty() {
+        anyhow::bail!(
+            "No federated indexes are configured; declare them as [federation.<name>] with a `workspace`"
+        );
+    }
+    let local_name = workspace
+        .file_name()
+        .map(|name| name.to_string_lossy().to_string())
+        .unwrap_or_else(|| "local".to_string());
+    let mut indexes = vec![open_index(local_name, &workspace, r#ref, config_file)?];
+    for (name, entry) in &config.federation {
+        let root = workspace.join(&entry.workspace);
+        match open_index(name.clone(), &root, entry.r#ref.as_deref(), None) {
+            Ok(index) => indexes.push(index),
+            Err(e) => eprintln!("warning: skipping federated index `{}`: {:#}", name, e),
+        }
+    }
+    Ok(indexes)
+}
+
+fn open_index(
+    name: String,
+    root: &Path,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<OpenIndex> {
+    let workspace = std::fs::canonicalize(root)
+        .with_context(|| format!("Failed to resolve {}", root.display()))?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    // Each repository keeps its index where its own configuration says.
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let data_dir = config.project_data_dir(&project_id);
+    let conn = db::open_for_query(
+        &data_dir.join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?.ok_or_else(|| {
+        anyhow::anyhow!(
+            "{} is not indexed. Run `cruxe index` there first.",
+            workspace_str
+        )
+    })?;
+    let index_set = IndexSet::open_existing(&data_dir)
+        .map_err(|e| anyhow::anyhow!("Failed to open indices: {}", e))?;
+    let ref_name = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    Ok(OpenIndex {
+        name,
+        workspace,
+        project_id,
+        ref_name,
+        conn,
+        index_set,
+    })
+}
+
+/// `cruxe search --federated`.
+#[allow(clippy::too_many_arguments)]
+pub fn search(
+    workspace: &Path,
+    query: &str,
+    r#ref: Option<&str>,
+    filter: &SymbolFilter,
+    in_docs: bool,
+    limit: usize,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let indexes = open_indexes(workspace, r#ref, config_file)?;
+    let sources: Vec<IndexSource<'_>> = indexes.iter().map(OpenIndex::source).collect();
+    // Kind and package filters run after retrieval, as in a local search.
+    let fetch_limit = if filter.kinds.is_empty() && filter.package.is_none() {
+        limit
+    } else {
+        limit.saturating_mul(4)
+    };
+    let options = SearchExecutionOptions {
+        in_docs,
+        ..SearchExecutionOptions::default()
+    };
+    let mut federated = federation::search(
+        &sources,
+        query,
+        filter.language.as_deref(),
+        fetch_limit,
+        &options,
+    );
+    federated
+        .results
+        .retain(|result| filter.matches_result(&result.item));
+    federated.truncate(limit);
+    super::render::render_records(format, &federated, &federated.results, |federated| {
+        print_federated(federated, &["PATH", "KIND", "NAME"], |result| {
+            search_columns(&result.item)
+        })
+    })
+}
+
+/// `cruxe refs --federated`.
+pub fn refs(
+    workspace: &Path,
+    symbol: &str,
+    kinds: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let kinds = super::refs::parse_kinds(kinds.unwrap_or_default())?;
+    let indexes = open_indexes(workspace, r#ref, config_file)?;
+    let sources: Vec<IndexSource<'_>> = indexes.iter().map(OpenIndex::source).collect();
+    let federated = federation::references(&sources, symbol, &kinds);
+    super::render::render_records(format, &federated, &federated.results, |federated| {
+        print_federated(federated, &["LOCATION", "KIND", "TEXT"], |site| {
+            reference_columns(&site.item)
+        })
+    })
+}
+
+/// `cruxe callers --federated`.
+pub fn callers(
+    workspace: &Path,
+    symbol: &str,
+    depth: u32,
+    limit: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let indexes = open_indexes(workspace, r#ref, config_file)?;
+    let sources: Vec<IndexSource<'_>> = indexes.iter().map(OpenIndex::source).collect();
+    let federated = federation::callers(&sources, symbol, depth, limit);
+    super::render::render_records(format, &federated, &federated.results, |federated| {
+        print_federated(federated, &["CALL SITE", "DEPTH", "CALLER"], |caller| {
+            caller_columns(&caller.item)
+        })
+    })
+}
+
+fn search_columns(result: &SearchResult) -> [String; 3] {
+    let location = if result.line_start > 0 {
+        format!("{}:{}", result.path, result.line_start)
+    } else {
+        result.path.clone()
+    };
+    [
+        location,
+        result.kind.clone().unwrap_or_else(|| "-".to_string()),
+        result
+            .canonical_id
+            .clone()
+            .or_else(|| result.name.clone())
+            .unwrap_or_else(|| "-".to_string()),
+    ]
+}
+
+fn reference_columns(site: &ReferenceSite) -> [String; 3] {
+    [
+        format!("{}:{}:{}", site.path, site.line, site.column),
+        site.kind.as_str().to_string(),
+        site.text.trim().to_string(),
+    ]
+}
+
+fn caller_columns(caller: &CallGraphEdgeResult) -> [String; 3] {
+    [
+        format!("{}:{}", caller.call_site.file, caller.call_site.line),
+        caller.depth.to_string(),
+        format!("{} ({})", caller.symbol.qualified_name, caller.symbol.kind),
+    ]
+}
+
+/// One line per result, led by the index it came from, then a line per
+/// index that could not be queried.
+fn print_federated<T>(
+    federated: &Federated<T>,
+    headers: &[&str; 3],
+    columns: impl Fn(&federation::Attributed<T>) -> [String; 3],
+) {
+    let style = style::current();
+    println!(
+        "{}",
+        style.heading(&format!(
+            "{} result(s) for `{}` across {} index(es){}",
+            federated.results.len(),
+            federated.query,
+            federated.indexes.len(),
+            if federated.truncated {
+                " (truncated)"
+            } else {
+                ""
+            }
+        ))
+    );
+    println!();
+    if federated.results.is_empty() {
+        println!("No results found.");
+    } else {
+        print_rows(federated, headers, &columns, &style);
+    }
+    for index in &federated.indexes {
+        if let Some(error) = &index.error {
+            eprintln!("warning: index `{}` failed: {}", index.name, error);
+        }
+    }
+}
+
+fn print_rows<T>(
+    federated: &Federated<T>,
+    headers: &[&str; 3],
+    columns: &impl Fn(&federation::Attributed<T>) -> [String; 3],
+    style: &Style,
+) {
+    let rows: Vec<[String; 3]> = federated.results.iter().map(columns).collect();
+    if style.plain {
+        println!(
+            "{:<16} {:<50} {:<10} {}",
+            "INDEX", headers[0], headers[1], headers[2]
+        );
+        println!("{}", "-".repeat(100));
+        for (result, row) in federated.results.iter().zip(&rows) {
+            println!(
+                "{:<16} {:<50} {:<10} {}",
+                result.index, row[0], row[1], row[2]
+            );
+        }
+        return;
+    }
+    let index_width = style::column_width(
+        federated.results.iter().map(|result| result.index.as_str()),
+        4,
+        24,
+    );
+    let location_width = style::column_width(rows.iter().map(|row| row[0].as_str()), 8, 60);
+    let middle_width = style::column_width(rows.iter().map(|row| row[1].as_str()), 4, 12);
+    for (result, row) in federated.results.iter().zip(&rows) {
+        println!(
+            "{} {} {} {}",
+            style.heading(&style::pad(&result.index, index_width)),
+            style.path(&style::pad(&row[0], location_width)),
+            style.kind(&style::pad(&row[1], middle_width)),
+            style.name(&row[2]),
+        );
+    }
+}
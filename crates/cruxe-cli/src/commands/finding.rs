@@ -0,0 +1,92 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::findings::{self, Finding, RuleSet};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe finding show <id>`: one finding with its confidence and evidence
+/// chain. `id` may be any unambiguous prefix of the id `cruxe check` prints.
+pub fn show(
+    workspace: &Path,
+    id: &str,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let profile = super::check::resolve_profile(None, &config)?;
+    let rule_set =
+        RuleSet::from_config(&config.rules, profile.unwrap_or_default()).with_taint(&config.taint);
+    let all = findings::run_checks(&conn, &project_id, &resolved_ref, &rule_set)
+        .map_err(|e| anyhow::anyhow!("Check failed: {}", e))?;
+    let finding = match findings::find_by_id(&all, id).as_slice() {
+        [] => anyhow::bail!(
+            "No finding with id `{id}` on ref `{resolved_ref}`. Run `cruxe check` to list them."
+        ),
+        [finding] => *finding,
+        matches => anyhow::bail!(
+            "Finding id `{id}` is ambiguous ({} matches); use more characters.",
+            matches.len()
+        ),
+    };
+
+    super::render::render(format, finding, print_finding)
+}
+
+fn print_finding(finding: &Finding) {
+    println!("Finding {}", finding.id);
+    println!("  rule:       {}", finding.rule);
+    println!("  severity:   {}", finding.severity.as_str());
+    println!("  confidence: {}", finding.confidence.as_str());
+    println!("  location:   {}:{}", finding.path, finding.line);
+    if !finding.symbol.is_empty() {
+        println!("  symbol:     {}", finding.symbol);
+    }
+    println!("  message:    {}", finding.message);
+    for other in &finding.also_reported_by {
+        println!(
+            "  also:       {} [{}] {}",
+            other.severity.as_str(),
+            other.rule,
+            other.message
+        );
+    }
+    if finding.evidence.is_empty() {
+        return;
+    }
+    println!("\nEvidence:");
+    for (step, evidence) in finding.evidence.iter().enumerate() {
+        let location = match (&evidence.path, evidence.line) {
+            (Some(path), Some(line)) => format!(" ({path}:{line})"),
+            (Some(path), None) => format!(" ({path})"),
+            _ => String::new(),
+        };
+        println!(
+            "  {}. {:<10} {}{}",
+            step + 1,
+            evidence.kind.as_str(),
+            evidence.detail,
+            location
+        );
+    }
+}
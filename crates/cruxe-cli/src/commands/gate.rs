@@ -0,0 +1,70 @@
+use anyhow::Result;
+use cruxe_query::gate::FailOn;
+use std::collections::BTreeMap;
+use std::fmt;
+
+/// Exit status when a command ran but a CI gate failed (`--fail-on`, a
+/// check profile or the ratchet). Errors exit with 1 and usage errors with 2.
+pub const GATE_EXIT_CODE: i32 = 3;
+
+pub fn parse(spec: Option<&str>) -> Result<Option<FailOn>> {
+    spec.map(|spec| FailOn::parse(spec).map_err(|e| anyhow::anyhow!("Invalid --fail-on: {}", e)))
+        .transpose()
+}
+
+/// One message per crossed threshold. Thresholds over metrics `command`
+/// does not measure are noted on stderr and otherwise ignored.
+pub fn violations(
+    fail_on: Option<&FailOn>,
+    command: &str,
+    metrics: &BTreeMap<String, f64>,
+) -> Vec<String> {
+    let Some(fail_on) = fail_on else {
+        return Vec::new();
+    };
+    let outcome = fail_on.evaluate(metrics);
+    for threshold in &outcome.unmeasured {
+        eprintln!(
+            "note: `cruxe {}` does not measure `{}`; ignoring `{}`",
+            command, threshold.metric, threshold
+        );
+    }
+    outcome
+        .violations
+        .iter()
+        .map(|v| {
+            format!(
+                "{} is {} (fails on {})",
+                v.threshold.metric, v.actual, v.threshold
+            )
+        })
+        .collect()
+}
+
+/// A CI gate that failed after the command finished its work. `main`
+/// prints it and exits with [`GATE_EXIT_CODE`].
+#[derive(Debug)]
+pub struct GateFailed {
+    title: String,
+    failures: Vec<String>,
+}
+
+impl fmt::Display for GateFailed {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}:\n  {}", self.title, self.failures.join("\n  "))
+    }
+}
+
+impl std::error::Error for GateFailed {}
+
+/// Fail with [`GateFailed`] listing `failures`, if there are any.
+pub fn enforce(title: &str, failures: &[String]) -> Result<()> {
+    if failures.is_empty() {
+        return Ok(());
+    }
+    Err(GateFailed {
+        title: title.to_string(),
+        failures: failures.to_vec(),
+    }
+    .into())
+}
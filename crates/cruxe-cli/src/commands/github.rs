@@ -0,0 +1,35 @@
+use anyhow::{Context, Result};
+use cruxe_query::github::GithubReport;
+use std::io::Write;
+
+/// The `--format` values printed by [`emit`] rather than [`super::render`].
+pub fn is_github_format(format: &str) -> bool {
+    matches!(format, "github" | "github-check")
+}
+
+/// `github` prints one workflow command per annotation and, under Actions,
+/// appends the Markdown summary to the job summary. `github-check` prints
+/// the Checks API payload of a check run called `name`, for `$GITHUB_SHA`
+/// when set.
+pub fn emit(format: &str, name: &str, report: &GithubReport) -> Result<()> {
+    let mut stdout = std::io::stdout().lock();
+    if format == "github-check" {
+        let head_sha = std::env::var("GITHUB_SHA").ok();
+        serde_json::to_writer_pretty(&mut stdout, &report.check_run(name, head_sha.as_deref()))?;
+        writeln!(stdout)?;
+        return Ok(());
+    }
+
+    for annotation in &report.annotations {
+        writeln!(stdout, "{}", annotation.workflow_command())?;
+    }
+    if let Some(path) = std::env::var_os("GITHUB_STEP_SUMMARY") {
+        let mut summary = std::fs::OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&path)
+            .with_context(|| format!("Failed to open {}", path.to_string_lossy()))?;
+        writeln!(summary, "{}", report.summary)?;
+    }
+    Ok(())
+}
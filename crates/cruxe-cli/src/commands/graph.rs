@@ -0,0 +1,54 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_mcp::daemon::DEFAULT_POLL_INTERVAL;
+use cruxe_mcp::graph_server::{self, GraphServeOptions};
+use cruxe_state::{db, project, schema};
+use std::path::Path;
+
+pub fn serve(
+    workspace: &Path,
+    r#ref: Option<&str>,
+    bind: &str,
+    port: u16,
+    no_watch: bool,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    drop(conn);
+
+    let options = GraphServeOptions {
+        ref_name: resolved_ref,
+        bind_addr: bind.to_string(),
+        port,
+        watch: !no_watch,
+        poll_interval: DEFAULT_POLL_INTERVAL,
+    };
+    let runtime = tokio::runtime::Runtime::new()?;
+    runtime
+        .block_on(graph_server::run_graph_server(
+            &workspace,
+            config_file,
+            options,
+        ))
+        .map_err(|e| anyhow::anyhow!("Graph server error: {}", e))
+}
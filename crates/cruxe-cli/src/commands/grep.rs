@@ -0,0 +1,71 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::grep::{self, GrepOptions, GrepResults, PatternKind};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe grep`: regex or structural search over the indexed files, with
+/// each match tagged by its enclosing symbol and package.
+pub fn run(
+    workspace: &Path,
+    options: &GrepOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let results = grep::grep(&conn, &workspace, &project_id, &resolved_ref, options)?;
+    super::render::render_records(format, &results, &results.matches, print_results)
+}
+
+fn print_results(results: &GrepResults) {
+    for m in &results.matches {
+        let context = match &m.enclosing {
+            Some(symbol) => format!("{} {}", symbol.kind, symbol.qualified_name),
+            None => "(top level)".to_string(),
+        };
+        println!(
+            "{}:{}:{}  [{} · {}]  {}",
+            m.path, m.line, m.column, m.package, context, m.text
+        );
+    }
+    if results.kind == PatternKind::Structural && !results.skipped_languages.is_empty() {
+        eprintln!(
+            "Pattern not valid for: {} (skipped)",
+            results.skipped_languages.join(", ")
+        );
+    }
+    if results.truncated {
+        eprintln!(
+            "Showing {} of {} matches in {} files; raise --limit to see more.",
+            results.matches.len(),
+            results.total,
+            results.files_scanned
+        );
+    } else {
+        eprintln!(
+            "{} matches in {} files.",
+            results.total, results.files_scanned
+        );
+    }
+}
@@ -0,0 +1,75 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::precommit::{self, HookReport, Layers};
+use cruxe_state::{db, project};
+use std::path::Path;
+use std::time::Instant;
+
+/// `cruxe hook pre-commit`: check the staged change against the cached
+/// index and fail when it adds an import cycle, breaks a reference or
+/// crosses a forbidden layer boundary.
+pub fn pre_commit(
+    workspace: &Path,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let started = Instant::now();
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let layers = Layers::from_config(&config.layers)?;
+    let staged = cruxe_vcs::staged_changes(&workspace)
+        .map_err(|e| anyhow::anyhow!("Failed to read staged changes: {}", e))?;
+
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let report = precommit::check_staged(&conn, &project_id, &resolved_ref, &staged, &layers)?;
+    super::render::render_records(format, &report, &report.violations, |report| {
+        print_report(report, started)
+    })?;
+
+    let mut failures = Vec::new();
+    if !report.violations.is_empty() {
+        failures.push(format!(
+            "{} problem(s) in the staged change (`git commit --no-verify` skips the hook)",
+            report.violations.len()
+        ));
+    }
+    super::gate::enforce("Pre-commit check failed", &failures)
+}
+
+fn print_report(report: &HookReport, started: Instant) {
+    for violation in &report.violations {
+        println!(
+            "{}:{}: {}: {}",
+            violation.path,
+            violation.line,
+            violation.check.as_str(),
+            violation.message
+        );
+    }
+    if report.violations.is_empty() {
+        println!(
+            "cruxe: {} staged file(s) checked in {} ms, no problems",
+            report.files_checked,
+            started.elapsed().as_millis()
+        );
+    }
+}
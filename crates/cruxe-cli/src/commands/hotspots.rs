@@ -0,0 +1,113 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::hotspots::{self, HotspotError, HotspotOptions, HotspotReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+use tracing::warn;
+
+/// `cruxe hotspots`: functions ranked by commits in the window times
+/// cyclomatic complexity, the riskiest code first.
+pub fn run(
+    workspace: &Path,
+    since: Option<&str>,
+    limit: usize,
+    path_prefix: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let options = HotspotOptions {
+        since: since
+            .or(config.hotspots.since.as_deref())
+            .unwrap_or(hotspots::DEFAULT_SINCE)
+            .to_string(),
+        limit,
+        path_prefix: path_prefix.map(str::to_string),
+        scope: super::scope::path_scope(&config, &workspace)?,
+    };
+    if config.history.deepen > 0
+        && cruxe_vcs::history_info(&workspace).shallow
+        && let Err(err) = cruxe_vcs::history::deepen_since(&workspace, &options.since)
+    {
+        warn!(error = %err, "Failed to fetch the history of the window");
+    }
+    let report = hotspots::find_hotspots(&conn, &workspace, &project_id, &resolved_ref, &options)
+        .map_err(|e| match e {
+        HotspotError::NotGitRepo => anyhow::anyhow!(
+            "`cruxe hotspots` needs git history; {} is not a git repository",
+            workspace.display()
+        ),
+        other => anyhow::anyhow!("Hotspots failed: {}", other),
+    })?;
+    super::render::render_records(format, &report, &report.hotspots, print_report)
+}
+
+fn print_report(report: &HotspotReport) {
+    if report.hotspots.is_empty() {
+        println!(
+            "No functions changed since {} on ref {}.",
+            report.since, report.ref_name
+        );
+        return;
+    }
+    println!(
+        "{:>6} {:>7} {:>10} {:>6} {:>7}  {}",
+        "score", "commits", "complexity", "lines", "authors", "function"
+    );
+    for hotspot in &report.hotspots {
+        let last_change = hotspot
+            .last_change
+            .as_ref()
+            .map(|change| format!("  (last: {}, {}d ago)", change.author, change.age_days))
+            .unwrap_or_default();
+        println!(
+            "{:>6} {:>7} {:>10} {:>6} {:>7}  {} {}:{}{}",
+            hotspot.score,
+            hotspot.commits,
+            hotspot.complexity,
+            hotspot.lines,
+            hotspot.authors,
+            hotspot.qualified_name,
+            hotspot.path,
+            hotspot.line_start,
+            last_change
+        );
+    }
+    println!();
+    println!(
+        "{} hotspot(s) of {} changed function(s), {} commit(s) since {} on ref {}",
+        report.hotspots.len(),
+        report.functions,
+        report.commits,
+        report.since,
+        report.ref_name
+    );
+    if report.shallow {
+        println!(
+            "Shallow clone: only commits after its boundary are counted \
+             (`git fetch --shallow-since=\"{}\"`, or set `[history] deepen`).",
+            report.since
+        );
+    }
+}
@@ -0,0 +1,140 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::impact::{self, ChangeSpec, ImpactReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe impact --changed <files or git range>`: the symbols, packages and
+/// tests that may be affected by a change, via the reverse call graph.
+pub fn run(
+    workspace: &Path,
+    changed: &[String],
+    depth: u32,
+    limit: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let specs: Vec<ChangeSpec> = changed
+        .iter()
+        .flat_map(|value| value.split(','))
+        .map(str::trim)
+        .filter(|value| !value.is_empty())
+        .map(|value| change_spec(&workspace, value))
+        .collect();
+    let changes = cruxe_vcs::with_deepening(&workspace, config.history.deepen, || {
+        impact::collect_changes(&workspace, &specs)
+    })
+    .map_err(|e| anyhow::anyhow!("Failed to collect changes: {}", e))?;
+    let report = impact::analyze_impact(&conn, &project_id, &resolved_ref, changes, depth, limit)
+        .map_err(|e| anyhow::anyhow!("Impact analysis failed: {}", e))?;
+
+    if format == "tests" {
+        for path in &report.test_files {
+            println!("{}", path);
+        }
+        return Ok(());
+    }
+    super::render::render_records(format, &report, &report.affected_symbols, print_report)
+}
+
+/// An existing file (relative to the current directory or the workspace) is
+/// changed in full; anything else is handed to `git diff` as a range.
+fn change_spec(workspace: &Path, value: &str) -> ChangeSpec {
+    let candidates = [Path::new(value).to_path_buf(), workspace.join(value)];
+    for candidate in candidates {
+        if let Ok(absolute) = std::fs::canonicalize(&candidate)
+            && absolute.is_file()
+            && let Ok(relative) = absolute.strip_prefix(workspace)
+        {
+            return ChangeSpec::File(relative.to_string_lossy().replace('\\', "/"));
+        }
+    }
+    ChangeSpec::Range(value.to_string())
+}
+
+fn print_report(report: &ImpactReport) {
+    if report.changed_files.is_empty() {
+        println!("No changes found.");
+        return;
+    }
+    println!(
+        "Changed: {} file(s), {} indexed symbol(s)",
+        report.changed_files.len(),
+        report.changed_symbols.len()
+    );
+    for symbol in &report.changed_symbols {
+        println!(
+            "  {}:{}  {} {}",
+            symbol.path, symbol.line_start, symbol.kind, symbol.qualified_name
+        );
+    }
+
+    println!();
+    println!(
+        "Affected callers (depth <= {}): {}{}",
+        report.depth_applied,
+        report.affected_symbols.len(),
+        if report.truncated {
+            " (truncated, raise --limit)"
+        } else {
+            ""
+        }
+    );
+    for impacted in &report.affected_symbols {
+        println!(
+            "  [{}] {}:{}  {}  (calls at {}:{})",
+            impacted.depth,
+            impacted.symbol.path,
+            impacted.symbol.line_start,
+            impacted.symbol.qualified_name,
+            impacted.call_site.file,
+            impacted.call_site.line
+        );
+    }
+
+    println!();
+    println!("Packages ({}):", report.affected_packages.len());
+    for package in &report.affected_packages {
+        println!("  {}", package);
+    }
+
+    println!();
+    println!(
+        "Tests: {} function(s) in {} file(s)",
+        report.affected_tests.len(),
+        report.test_files.len()
+    );
+    for test in &report.affected_tests {
+        println!(
+            "  {}:{}  {}",
+            test.path, test.line_start, test.qualified_name
+        );
+    }
+    for path in &report.test_files {
+        if !report.affected_tests.iter().any(|test| &test.path == path) {
+            println!("  {}", path);
+        }
+    }
+}
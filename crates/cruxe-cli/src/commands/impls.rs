@@ -0,0 +1,95 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::impls::{self, ImplsError, ImplsReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe impls <interface>`: the indexed types that implement an interface
+/// or trait, with their locations.
+pub fn run(
+    workspace: &Path,
+    interface: &str,
+    interface_path: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let report = impls::find_implementations(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        interface,
+        interface_path,
+    )
+    .map_err(|e| match e {
+        ImplsError::NotFound => {
+            anyhow::anyhow!(
+                "Interface `{}` not found in ref `{}`",
+                interface,
+                resolved_ref
+            )
+        }
+        ImplsError::Ambiguous { candidates } => anyhow::anyhow!(
+            "`{}` matches {} interfaces; pass a qualified name or --path:\n  {}",
+            interface,
+            candidates.len(),
+            candidates.join("\n  ")
+        ),
+        other => anyhow::anyhow!("Impls failed: {}", other),
+    })?;
+
+    super::render::render_records(format, &report, &report.implementations, print_report)
+}
+
+fn print_report(report: &ImplsReport) {
+    println!(
+        "{} ({}, {}) {}:{}",
+        report.interface, report.kind, report.language, report.path, report.line
+    );
+    if !report.methods.is_empty() {
+        println!("  methods: {}", report.methods.join(", "));
+    }
+    if !report.unresolved.is_empty() {
+        println!(
+            "  not indexed, methods not required: {}",
+            report.unresolved.join(", ")
+        );
+    }
+    println!();
+    for found in &report.implementations {
+        println!(
+            "  {:<8} {:<40} {}:{}  ({})",
+            found.kind, found.qualified_name, found.path, found.line, found.via
+        );
+    }
+    if !report.implementations.is_empty() {
+        println!();
+    }
+    println!(
+        "{} implementation(s) on ref {}",
+        report.implementations.len(),
+        report.ref_name
+    );
+}
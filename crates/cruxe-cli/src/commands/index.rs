@@ -1,40 +1,114 @@
 use anyhow::{Context, Result, bail};
+use cruxe_core::cancel::{CancellationToken, Cancelled};
 use cruxe_core::config::Config;
 use cruxe_core::constants;
+use cruxe_core::error::LogCode;
 use cruxe_core::ids::new_job_id;
 use cruxe_core::time::now_iso8601;
-use cruxe_core::types::{FileRecord, JobStatus, generate_project_id};
+use cruxe_core::types::{
+    DependencyMode, FileRecord, JobStatus, Project, SkipReason, SkippedFileRecord,
+    generate_project_id,
+};
 use cruxe_core::vcs;
+use cruxe_core::{stats, telemetry};
 use cruxe_indexer::{
-    call_extract, embed_writer, import_extract, prepare, scanner,
+    blob_cache::{self, BlobCacheReader},
+    call_extract, dependencies, embed_writer, generated, go_embed, go_template, go_workspace,
+    import_extract, language_settings,
+    limits::{FileLimits, Skip},
+    pipeline,
+    plugins::{PluginHost, PluginInput},
+    prepare, project_discovery, runtime_grammars, scanner,
+    spill::{self, MemoryBudget, SpillBuffer},
     sync_incremental::{self, IncrementalSyncRequest},
     writer,
 };
 use cruxe_state::{
-    branch_state, db, edges, jobs, manifest, project, schema, symbols, tantivy_index,
+    blob_artifacts, branch_state, concurrency, db, edges, file_encodings, generated_files,
+    go_embeds, go_modules, go_templates, import_paths, index_journal, index_modes, injections,
+    jobs, literals, locals, manifest, parse_errors, plugin_findings, project, routes, schema,
+    shards, skipped_files, submodules, symbol_blame, symbols, tantivy_index, todos,
+    workspace_projects,
 };
 use cruxe_vcs::Git2VcsAdapter;
+
+use super::webhook;
+use crate::progress::{Progress, ProgressMode};
 use rayon::prelude::*;
 use std::collections::{HashMap, HashSet};
 use std::path::Path;
-use std::time::Instant;
-use tracing::{info, warn};
+use std::time::{Duration, Instant};
+use tracing::{info, info_span, warn};
 
 const PROGRESS_UPDATE_EVERY: u64 = 100;
 const INDEX_PARALLELISM_ENV: &str = "CRUXE_INDEX_PARALLELISM";
+const INDEX_MAX_MEMORY_ENV: &str = "CRUXE_INDEX_MAX_MEMORY";
 
+/// Index a workspace. With `shard`, only the files of that `[shards.<name>]`
+/// entry are indexed, into the shard's own data directory; without it, files
+/// claimed by a configured shard are left to that shard.
+///
+/// `bodies: Some(false)` builds a signatures-only skeleton. `None` keeps the
+/// mode the ref was last indexed with; switching modes re-indexes every file.
+///
+/// `include_submodules` descends into initialized git submodules even when
+/// `[index] submodules` is off.
+///
+/// Progress (phase, files done, ETA) goes to stderr as `progress_mode` asks.
+///
+/// A `ref` naming a git revision other than the checked-out branch (a
+/// branch, tag or commit id) is indexed from the object database, without
+/// checking it out or touching the working tree. Dependencies, submodules
+/// and Go templates are working-tree features and are left out of such a
+/// run; module and project layout still come from the working tree.
+#[allow(clippy::too_many_arguments)]
 pub fn run(
     repo_root: &Path,
     force: bool,
     r#ref: Option<&str>,
     config_file: Option<&Path>,
+    jobs: Option<usize>,
+    max_memory: Option<&str>,
+    shard: Option<&str>,
+    bodies: Option<bool>,
+    respect_ignore_files: bool,
+    include_submodules: bool,
+    symlinks: Option<&str>,
+    progress_mode: ProgressMode,
+    cancel: &CancellationToken,
 ) -> Result<()> {
+    let mut progress = Progress::new(progress_mode);
+    let memory_budget = resolve_memory_budget(max_memory)?;
     let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
     let repo_root_str = repo_root.to_string_lossy().to_string();
 
     let config = Config::load_with_file(Some(&repo_root), config_file)?;
+    runtime_grammars::register(&config.grammars, &repo_root);
+    let scope = super::scope::path_scope(&config, &repo_root)?;
+    let symlink_policy = match symlinks {
+        Some(symlinks) => symlinks
+            .parse()
+            .map_err(|_| anyhow::anyhow!("Unknown symlink policy `{symlinks}`"))?,
+        None => config.index.symlink_policy(),
+    };
     let project_id = generate_project_id(&repo_root_str);
-    let data_dir = config.project_data_dir(&project_id);
+    let project_data_dir = config.project_data_dir(&project_id);
+    let shard_config = match shard {
+        Some(name) => {
+            let Some(shard_config) = config.shards.get(name) else {
+                bail!("Unknown shard `{name}`; declare it under [shards.{name}] in the config");
+            };
+            if !shards::is_valid_shard_name(name) {
+                bail!("Invalid shard name `{name}` (letters, digits, `-`, `_` and `.` only)");
+            }
+            Some(shard_config)
+        }
+        None => None,
+    };
+    let data_dir = match shard {
+        Some(name) => shards::shard_data_dir(&project_data_dir, name),
+        None => project_data_dir.clone(),
+    };
 
     // Open SQLite with configured pragmas
     let db_path = data_dir.join(constants::STATE_DB_FILE);
@@ -45,20 +119,73 @@ pub fn run(
     )?;
     schema::create_tables(&conn)?;
 
-    // Verify project exists
-    let proj = project::get_by_root(&conn, &repo_root_str)?
-        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    // Verify project exists. A shard's own state DB starts out as a copy of
+    // the main project row.
+    let proj = match project::get_by_root(&conn, &repo_root_str)? {
+        Some(proj) => proj,
+        None if shard.is_some() => {
+            seed_shard_project(&conn, &project_data_dir, &repo_root_str, &config)?
+        }
+        None => bail!("Project not initialized. Run `cruxe init` first."),
+    };
+
+    // A journal left on disk means a previous run died between its SQLite
+    // writes and the Tantivy commit. Its manifest hashes may describe files
+    // whose search documents were never committed, so distrust them: every
+    // file of that ref is re-processed on the next run.
+    if let Some(stale) = index_journal::take_stale(&data_dir)? {
+        if !stale.job_id.is_empty() {
+            jobs::mark_job_interrupted(
+                &conn,
+                &stale.job_id,
+                "index process exited before committing",
+            )?;
+        }
+        let stale_ref = Some(stale.r#ref.as_str()).filter(|r| !r.is_empty());
+        let invalidated = manifest::invalidate_hashes(&conn, &project_id, stale_ref)?;
+        warn!(
+            job_id = %stale.job_id,
+            ref_name = %stale.r#ref,
+            invalidated,
+            "Recovered from an interrupted index run; affected files will be re-indexed"
+        );
+        println!(
+            "Previous index run did not finish; re-indexing {} file(s).",
+            invalidated
+        );
+    }
 
     // Check for active jobs
     if let Some(active) = jobs::get_active_job(&conn, &project_id)? {
         bail!("Index already in progress: job_id={}", active.job_id);
     }
+    // Edge shards left behind by a run that was killed mid-way.
+    let _ = std::fs::remove_dir_all(data_dir.join("spill"));
 
     // Determine ref: explicit > current HEAD branch > project default
     let effective_ref = vcs::resolve_effective_ref(&repo_root, r#ref, &proj.default_ref);
 
+    if shard.is_some() && effective_ref != proj.default_ref {
+        bail!(
+            "Shards are built from the default branch ({}), not {}",
+            proj.default_ref,
+            effective_ref
+        );
+    }
+
     // VCS mode non-default refs use spec-005 overlay incremental sync path.
-    if proj.vcs_mode && effective_ref != proj.default_ref {
+    // An overlay needs its base in the clone; a single-branch CI checkout may
+    // not have it, and then the ref is indexed in full.
+    let mut overlay = proj.vcs_mode && effective_ref != proj.default_ref;
+    if overlay && cruxe_vcs::history::commit_of(&repo_root, &proj.default_ref).is_none() {
+        println!(
+            "Base ref {} is not in this clone (`git fetch origin {}` to sync an overlay); \
+             indexing {} in full.",
+            proj.default_ref, proj.default_ref, effective_ref
+        );
+        overlay = false;
+    }
+    if overlay {
         let last_indexed_commit =
             branch_state::get_branch_state(&conn, &project_id, &effective_ref)?
                 .map(|state| state.last_indexed_commit);
@@ -69,6 +196,8 @@ pub fn run(
             effective_ref, proj.default_ref
         );
         let started = Instant::now();
+        let _span = info_span!("index.sync", "ref" = %effective_ref).entered();
+        progress.phase("sync", None);
         let stats = sync_incremental::run_incremental_sync(
             &adapter,
             &mut conn,
@@ -83,6 +212,7 @@ pub fn run(
                 is_default_branch: false,
             },
         )?;
+        progress.finish();
         println!();
         println!("Overlay sync complete!");
         println!("  Changed files:  {}", stats.changed_files);
@@ -90,9 +220,96 @@ pub fn run(
         println!("  Symbols written: {}", stats.symbols_written);
         println!("  Rebuild:        {}", stats.rebuild_triggered);
         println!("  Duration:       {:.1}s", started.elapsed().as_secs_f64());
+        if !config.index.webhooks.is_empty() {
+            let totals = RunTotals {
+                files: manifest::file_count(&conn, &project_id, &effective_ref)?,
+                symbols: symbols::symbol_count(&conn, &project_id, &effective_ref)?,
+                commit: Some(stats.head_commit.clone()),
+                ..RunTotals::default()
+            };
+            webhook::notify(
+                &config.index.webhooks,
+                &webhook::IndexCompleted {
+                    event: webhook::INDEX_COMPLETED,
+                    status: "published",
+                    project_id: project_id.clone(),
+                    workspace: repo_root_str.clone(),
+                    r#ref: effective_ref.clone(),
+                    commit: totals.commit,
+                    job_id: sync_id,
+                    mode: "overlay".to_string(),
+                    duration_ms: started.elapsed().as_millis() as u64,
+                    files: webhook::FileCounts {
+                        indexed: stats.processed_files as u64,
+                        skipped: 0,
+                        changed: stats.changed_files as u64,
+                        total: totals.files,
+                    },
+                    symbols: webhook::SymbolCounts {
+                        extracted: stats.symbols_written as u64,
+                        total: totals.symbols,
+                    },
+                    findings: None,
+                    error: None,
+                },
+            );
+        }
         return Ok(());
     }
 
+    let commit_tree = match r#ref {
+        Some(rev) if vcs::detect_head_branch(&repo_root).ok().as_deref() != Some(rev) => {
+            cruxe_vcs::commit_tree(&repo_root, rev)?
+        }
+        _ => None,
+    };
+    if let Some(tree) = &commit_tree {
+        println!(
+            "Reading {} at commit {} from the object database",
+            effective_ref,
+            &tree.commit[..12]
+        );
+    }
+    let blame_enabled = config.index.blame && vcs::is_git_repo(&repo_root);
+    if config.index.blame && !blame_enabled {
+        warn!("[index] blame is set but the project is not a git repository");
+    }
+    if blame_enabled {
+        let history = cruxe_vcs::history_info(&repo_root);
+        if history.shallow {
+            warn!(
+                "Shallow clone: lines last changed at or before its boundary get no blame; \
+                 `git fetch --unshallow` for complete blame"
+            );
+        }
+        if history.partial {
+            warn!(
+                "Partial clone: blame cannot read file history whose contents were not \
+                 fetched; such files get no blame"
+            );
+        }
+    }
+
+    // Files indexed in the other mode would keep their old artifacts.
+    let previous_bodies = index_modes::bodies_indexed(&conn, &project_id, &effective_ref)?;
+    let bodies = bodies.or(previous_bodies).unwrap_or(true);
+    let force = if !force && previous_bodies.unwrap_or(true) != bodies {
+        println!(
+            "Switching to {} indexing; re-indexing every file.",
+            if bodies { "full" } else { "signatures-only" }
+        );
+        true
+    } else {
+        force
+    };
+    // Dependency files indexed in the other mode are re-indexed the same way.
+    let dependency_mode = config.index.dependencies.mode_typed();
+    let dependencies_changed =
+        index_modes::dependencies_indexed(&conn, &project_id, &effective_ref)?
+            .as_deref()
+            .unwrap_or(DependencyMode::None.as_str())
+            != dependency_mode.as_str();
+
     // Create job (allow MCP wrapper to inject a stable job id)
     let job_id = std::env::var("CRUXE_JOB_ID")
         .ok()
@@ -123,13 +340,31 @@ pub fn run(
         updated_at: now.clone(),
     };
     jobs::create_job(&conn, &job)?;
+    let journal = index_journal::IndexJournal::begin(
+        &data_dir,
+        &index_journal::JournalEntry {
+            job_id: job_id.clone(),
+            r#ref: effective_ref.clone(),
+            pid: std::process::id(),
+            started_at: now.clone(),
+        },
+    )?;
 
     println!(
         "Indexing {} (ref: {}, mode: {}) ...",
         repo_root_str, effective_ref, job.mode
     );
     let start = Instant::now();
-    let index_result: Result<(u64, u64, u64, u64)> = (|| {
+    let mut telemetry = telemetry::Recorder::from_config(&config);
+    let _run_span = info_span!(
+        "index",
+        repo = %repo_root_str,
+        "ref" = %effective_ref,
+        mode = %job.mode
+    )
+    .entered();
+    let mut totals = RunTotals::default();
+    let index_result: Result<(u64, u64, u64, u64, u64)> = (|| {
         // Open Tantivy indices. In --force mode, recover by rebuilding incompatible indices.
         let index_set = match tantivy_index::IndexSet::open(&data_dir) {
             Ok(set) => set,
@@ -137,11 +372,24 @@ pub fn run(
                 cruxe_core::error::StateError::SchemaMigrationRequired { .. }
                 | cruxe_core::error::StateError::CorruptManifest(_),
             ) if force => {
-                let base_dir = data_dir.join("base");
-                if base_dir.exists() {
-                    std::fs::remove_dir_all(&base_dir)
-                        .context("Failed to remove incompatible Tantivy indices")?;
-                }
+                tantivy_index::discard_index_set(&data_dir)
+                    .context("Failed to remove incompatible Tantivy indices")?;
+                tantivy_index::IndexSet::open(&data_dir)?
+            }
+            // Unparseable rather than outdated, e.g. the process was killed
+            // mid-merge. Everything in the index is derived from source, so
+            // discard it and make every ref re-index all of its files. IO,
+            // permission and lock errors are not corruption and fall through
+            // to the last arm with the index left in place.
+            Err(cruxe_core::error::StateError::CorruptManifest(reason)) => {
+                tantivy_index::discard_index_set(&data_dir)
+                    .context("Failed to remove corrupt Tantivy indices")?;
+                let invalidated = manifest::invalidate_hashes(&conn, &project_id, None)?;
+                warn!(%reason, invalidated, "Discarded corrupt Tantivy indices");
+                println!(
+                    "Search index was corrupt and has been discarded; re-indexing {} file(s).",
+                    invalidated
+                );
                 tantivy_index::IndexSet::open(&data_dir)?
             }
             Err(e) => return Err(e.into()),
@@ -151,9 +399,14 @@ pub fn run(
         // NOTE: SQLite writes are auto-committed (no explicit transaction) so that
         // progress updates in `index_jobs` are immediately visible to `index_status`
         // polling from the MCP server.  Tantivy is committed at the end via
-        // `batch.commit()`.  A crash mid-indexing may leave partial SQLite data, but
-        // the next incremental or force index run will reconcile both stores.
-        let batch = writer::BatchWriter::new(&index_set)?;
+        // `batch.commit()`.  The index journal stays on disk until both are
+        // committed, so a crash in between is detected and repaired next run.
+        let batch = match memory_budget {
+            Some(budget) => {
+                writer::BatchWriter::with_heap_size(&index_set, budget.writer_heap_bytes())?
+            }
+            None => writer::BatchWriter::new(&index_set)?,
+        };
         let mut embedding_writer = embed_writer::EmbeddingWriter::new(
             &config.search.semantic,
             &project_id,
@@ -174,6 +427,76 @@ pub fn run(
                 (&project_id, &effective_ref),
             )
             .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM file_reference_fingerprints WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM string_injections WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM go_embeds WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM todo_markers WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM concurrency_sites WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM http_routes WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM generated_files WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM file_encodings WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM local_bindings WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM literals WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM symbol_blame WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM parse_errors WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM plugin_findings WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
+            conn.execute(
+                "DELETE FROM package_summaries WHERE repo = ?1 AND \"ref\" = ?2",
+                (&project_id, &effective_ref),
+            )
+            .map_err(cruxe_core::error::StateError::sqlite)?;
             conn.execute(
                 "DELETE FROM file_manifest WHERE repo = ?1 AND \"ref\" = ?2",
                 (&project_id, &effective_ref),
@@ -182,11 +505,120 @@ pub fn run(
         }
 
         // Scan files (filtered by configured languages)
-        let files = scanner::scan_directory_filtered(
-            &repo_root,
-            config.index.max_file_size,
-            &config.index.languages,
-        );
+        let phase_start = Instant::now();
+        let scan_span = info_span!("index.scan").entered();
+        progress.phase("scan", None);
+        let mut oversized = Vec::new();
+        let mut files = match &commit_tree {
+            Some(tree) => scanner::scan_tree_files(
+                &repo_root,
+                tree.files
+                    .iter()
+                    .map(|file| (file.path.as_str(), file.size)),
+                config.index.max_file_size,
+                &config.index.languages,
+                &mut oversized,
+            ),
+            None => scanner::scan_directory_with_ignores(
+                &repo_root,
+                config.index.max_file_size,
+                &config.index.languages,
+                respect_ignore_files,
+                symlink_policy,
+                &mut oversized,
+            ),
+        };
+        // The regular scan never enters vendor/ or node_modules/.
+        let mut dependency_paths: HashSet<String> = HashSet::new();
+        if dependency_mode != DependencyMode::None && commit_tree.is_none() {
+            let found = dependencies::discover_dependencies(
+                &repo_root,
+                &project_discovery::discover_projects(&repo_root),
+                config.index.dependencies.depth,
+            );
+            let dirs: Vec<String> = found
+                .iter()
+                .map(|dependency| dependency.dir.clone())
+                .collect();
+            let dependency_files = scanner::scan_dependency_files(
+                &repo_root,
+                &dirs,
+                config.index.max_file_size,
+                &config.index.languages,
+            );
+            println!(
+                "Indexing {} dependencies ({}): {} files",
+                found.len(),
+                dependency_mode,
+                dependency_files.len()
+            );
+            dependency_paths.extend(
+                dependency_files
+                    .iter()
+                    .map(|file| file.relative_path.clone()),
+            );
+            files.extend(dependency_files);
+        }
+        // Submodule checkouts are left out of the regular scan.
+        let indexed_submodules =
+            if (include_submodules || config.index.submodules) && commit_tree.is_none() {
+                cruxe_vcs::initialized_submodules(&repo_root).unwrap_or_else(|err| {
+                    warn!("Failed to list git submodules: {}", err);
+                    Vec::new()
+                })
+            } else {
+                Vec::new()
+            };
+        if !indexed_submodules.is_empty() {
+            let dirs: Vec<String> = indexed_submodules
+                .iter()
+                .map(|submodule| submodule.path.clone())
+                .collect();
+            files.retain(|file| {
+                submodules::origin(&indexed_submodules, &file.relative_path).is_none()
+            });
+            let submodule_files = scanner::scan_submodule_files(
+                &repo_root,
+                &dirs,
+                config.index.max_file_size,
+                &config.index.languages,
+                respect_ignore_files,
+                symlink_policy,
+            );
+            println!(
+                "Indexing {} submodules: {} files",
+                indexed_submodules.len(),
+                submodule_files.len()
+            );
+            files.extend(submodule_files);
+        }
+        let in_this_index = |relative_path: &str| {
+            scope.contains(relative_path)
+                && match shard_config {
+                    Some(shard_config) => shard_config.contains(relative_path),
+                    None => config.shard_for(relative_path).is_none(),
+                }
+        };
+        files.retain(|file| in_this_index(&file.relative_path));
+        // Files in scope left out of this run, with why; recorded when the
+        // run is published.
+        let mut skipped_records: Vec<SkippedFileRecord> = oversized
+            .into_iter()
+            .filter(|file| in_this_index(&file.relative_path))
+            .map(|file| SkippedFileRecord {
+                repo: project_id.clone(),
+                r#ref: effective_ref.clone(),
+                path: file.relative_path,
+                reason: SkipReason::TooLarge,
+                detail: format!("{} bytes", file.size),
+            })
+            .collect();
+        scan_span.exit();
+        progress.finish();
+        record_phase(&mut telemetry, "index.scan", phase_start.elapsed());
+        if let Some(recorder) = telemetry.as_mut() {
+            recorder.repo_size(files.len() as u64);
+        }
         let total_scanned = files.len() as i64;
         if let Err(err) = jobs::update_progress(&conn, &job_id, total_scanned, 0, 0) {
             warn!(job_id = %job_id, "Failed to update index progress: {}", err);
@@ -199,56 +631,24 @@ pub fn run(
         } else {
             manifest::get_all_entries(&conn, &project_id, &effective_ref)?
         };
-        let existing_hashes: HashMap<String, String> = existing_manifest_entries
+        let existing_files: HashMap<&str, &manifest::ManifestEntry> = existing_manifest_entries
             .iter()
-            .map(|entry| (entry.path.clone(), entry.content_hash.clone()))
+            .map(|entry| (entry.path.as_str(), entry))
             .collect();
 
         let mut removed_count = 0u64;
         if !force {
             for entry in &existing_manifest_entries {
                 if !scanned_paths.contains(entry.path.as_str()) {
-                    let deleted_symbol_ids: Vec<String> = symbols::list_symbols_in_file(
-                        &conn,
-                        &project_id,
-                        &effective_ref,
-                        &entry.path,
-                    )?
-                    .into_iter()
-                    .map(|symbol| symbol.symbol_stable_id)
-                    .collect();
-                    batch.delete_file_docs(&index_set, &project_id, &effective_ref, &entry.path);
-                    symbols::delete_symbols_for_file(
-                        &conn,
-                        &project_id,
-                        &effective_ref,
-                        &entry.path,
-                    )?;
-                    let source_edge_id = import_extract::source_symbol_id_for_path(&entry.path);
-                    edges::delete_edges_for_file(
-                        &conn,
-                        &project_id,
-                        &effective_ref,
-                        vec![source_edge_id.as_str()],
-                    )?;
-                    edges::delete_call_edges_for_file(
-                        &conn,
-                        &project_id,
-                        &effective_ref,
-                        &entry.path,
-                    )?;
-                    edges::delete_call_edges_to_symbols(
-                        &conn,
-                        &project_id,
-                        &effective_ref,
-                        &deleted_symbol_ids,
-                    )?;
-                    embedding_writer.delete_for_file_vectors_with_symbols(
-                        &conn,
-                        &entry.path,
-                        &deleted_symbol_ids,
-                    )?;
-                    manifest::delete_manifest(&conn, &project_id, &effective_ref, &entry.path)?;
+                    let removal = FileRemoval {
+                        conn: &conn,
+                        batch: &batch,
+                        index_set: &index_set,
+                        embedding_writer: &embedding_writer,
+                        project_id: &project_id,
+                        ref_name: &effective_ref,
+                    };
+                    removal.remove(&entry.path)?;
                     removed_count += 1;
                 }
             }
@@ -256,12 +656,25 @@ pub fn run(
 
         let mut indexed_count = 0u64;
         let mut symbol_count = 0u64;
-        let mut skipped = 0u64;
-        let mut pending_imports: Vec<(String, Vec<import_extract::RawImport>)> = Vec::new();
-        let mut pending_call_edges: Vec<(String, Vec<cruxe_core::types::CallEdge>)> = Vec::new();
+        let mut skipped = skipped_records.len() as u64;
+        let mut shared_count = 0u64;
+        // Imports and call edges are resolved once every symbol is written. On
+        // large repos they are the bulk of what a run holds in memory, so under
+        // --max-memory they spill to disk in shards.
+        let spill_dir = data_dir.join("spill").join(&job_id);
+        let spill_threshold = memory_budget.map(|budget| budget.spill_threshold_bytes());
+        let mut pending_imports: SpillBuffer<(String, Vec<import_extract::RawImport>)> =
+            SpillBuffer::new(&spill_dir.join("imports"), spill_threshold);
+        let mut pending_call_edges: SpillBuffer<(String, Vec<cruxe_core::types::CallEdge>)> =
+            SpillBuffer::new(&spill_dir.join("calls"), spill_threshold);
 
-        let parallelism = resolve_index_parallelism();
-        let chunk_size = std::cmp::max(parallelism * 8, PROGRESS_UPDATE_EVERY as usize);
+        let parallelism = resolve_index_parallelism(jobs);
+        let initial_batch = std::cmp::max(parallelism * 8, PROGRESS_UPDATE_EVERY as usize);
+        let batch_sizer = pipeline::AdaptiveBatchSizer::new(
+            parallelism * 2,
+            std::cmp::max(parallelism * 64, initial_batch),
+            initial_batch,
+        );
         let worker_pool = rayon::ThreadPoolBuilder::new()
             .num_threads(parallelism)
             .thread_name(|idx| format!("cruxe-index-{idx}"))
@@ -273,141 +686,477 @@ pub fn run(
             parallelism
         );
 
-        for file_chunk in files.chunks(chunk_size) {
-            let prepared_chunk: Vec<PreparedIndexOutcome> = worker_pool.install(|| {
-                file_chunk
-                    .par_iter()
-                    .map(|file| {
-                        prepare_file_for_indexing(
-                            file,
-                            &project_id,
-                            &effective_ref,
-                            force,
-                            existing_hashes.get(&file.relative_path).map(String::as_str),
-                        )
-                    })
-                    .collect()
-            });
-
-            let mut pending_embedding_batches = Vec::new();
-            for prepared in prepared_chunk {
-                match prepared {
-                    PreparedIndexOutcome::Unchanged => {}
-                    PreparedIndexOutcome::SkippedRead { path, error } => {
-                        warn!(path = %path, error = %error, "Failed to read file");
-                        skipped += 1;
-                    }
-                    PreparedIndexOutcome::Ready(prepared) => {
-                        let PreparedIndexFile {
-                            symbols_for_file,
-                            snippets,
-                            raw_imports,
-                            call_edges,
-                            file_record,
-                            mtime_ns,
-                            parse_error,
+        // Parsing runs ahead on its own thread; the bounded queue keeps it from
+        // outpacing the SQLite/Tantivy writes below on fast disks.
+        let mut processed_paths: Vec<String> = Vec::new();
+        let phase_start = Instant::now();
+        // Parsing runs on other threads, which do not inherit the current
+        // span, so file spans name their parent.
+        let blame_source = blame_enabled.then(|| BlameSource {
+            repo_root: &repo_root,
+            revision: commit_tree.as_ref().map(|tree| tree.commit.as_str()),
+        });
+        let limits = FileLimits::from_config(&config.index);
+        // Plugins see each file as it is written; workers keep the source
+        // for them only when one is running.
+        let mut plugin_host = PluginHost::start(&config.plugins, &repo_root);
+        let keep_source = !plugin_host.is_empty();
+        let blob_cache = config.index.blob_cache.then(|| BlobCacheReader {
+            db_path: &db_path,
+            storage: &config.storage,
+            repo: &project_id,
+            ref_name: &effective_ref,
+        });
+        let parse_span = info_span!("index.parse_write", files = files.len());
+        let parse_guard = parse_span.enter();
+        progress.phase("parse", Some(files.len() as u64));
+        let pipeline_result = pipeline::run_bounded(
+            &files,
+            batch_sizer,
+            pipeline::DEFAULT_QUEUE_DEPTH,
+            |file_chunk| {
+                worker_pool.install(|| {
+                    file_chunk
+                        .par_iter()
+                        .map(|file| {
+                            let _span = info_span!(
+                                parent: &parse_span,
+                                "index.parse_file",
+                                path = %file.relative_path,
+                                language = %file.language
+                            )
+                            .entered();
+                            let dependency = dependency_paths.contains(&file.relative_path);
+                            prepare_file_for_indexing(
+                                file,
+                                &limits,
+                                commit_tree.as_ref(),
+                                blame_source.as_ref(),
+                                blob_cache.as_ref(),
+                                &project_id,
+                                &effective_ref,
+                                force || (dependency && dependencies_changed),
+                                bodies
+                                    && !(dependency
+                                        && dependency_mode == DependencyMode::Signatures),
+                                existing_files.get(file.relative_path.as_str()).copied(),
+                                keep_source,
+                            )
+                        })
+                        .collect::<Vec<PreparedIndexOutcome>>()
+                })
+            },
+            |prepared_chunk| -> Result<()> {
+                // Batches are the unit of cancellation: every file in a batch is
+                // fully written before the next check.
+                cancel.check()?;
+                let mut pending_embedding_batches = Vec::new();
+                let chunk_len = prepared_chunk.len() as u64;
+                for prepared in prepared_chunk {
+                    match prepared {
+                        PreparedIndexOutcome::Unchanged => stats::count(stats::FILES_REUSED, 1),
+                        PreparedIndexOutcome::Touched(entry) => {
+                            manifest::upsert_manifest(&conn, &entry)?;
+                            stats::count(stats::FILES_REUSED, 1);
+                        }
+                        PreparedIndexOutcome::Skipped {
+                            path,
+                            skip,
                             had_previous_index,
-                        } = *prepared;
-
-                        if let Some(parse_error) = parse_error.as_deref() {
+                        } => {
                             warn!(
-                                path = %file_record.path,
-                                error = %parse_error,
-                                "Parse failed"
+                                code = skip.reason.log_code().as_str(),
+                                path = %path,
+                                reason = skip.reason.as_str(),
+                                detail = %skip.detail,
+                                "Skipped file"
                             );
+                            if had_previous_index {
+                                let removal = FileRemoval {
+                                    conn: &conn,
+                                    batch: &batch,
+                                    index_set: &index_set,
+                                    embedding_writer: &embedding_writer,
+                                    project_id: &project_id,
+                                    ref_name: &effective_ref,
+                                };
+                                removal.remove(&path)?;
+                            }
+                            skipped_records.push(SkippedFileRecord {
+                                repo: project_id.clone(),
+                                r#ref: effective_ref.clone(),
+                                path,
+                                reason: skip.reason,
+                                detail: skip.detail,
+                            });
+                            skipped += 1;
                         }
+                        PreparedIndexOutcome::Ready(prepared) => {
+                            let PreparedIndexFile {
+                                mut symbols_for_file,
+                                snippets,
+                                raw_imports,
+                                mut call_edges,
+                                injections: file_injections,
+                                embeds: file_embeds,
+                                todos: file_todos,
+                                concurrency: file_concurrency,
+                                routes: file_routes,
+                                locals: file_locals,
+                                literals: file_literals,
+                                generated,
+                                encoding,
+                                blame,
+                                file_record,
+                                mtime_ns,
+                                parse_error,
+                                parse_errors: file_parse_errors,
+                                had_previous_index,
+                                bodies: file_bodies,
+                                blob,
+                                shared,
+                                source,
+                            } = *prepared;
+                            let _span =
+                                info_span!("index.store_file", path = %file_record.path).entered();
 
-                        if !force {
-                            batch.delete_file_docs(
-                                &index_set,
+                            if let Some(parse_error) = parse_error.as_deref() {
+                                warn!(
+                                    code = LogCode::ParseFailed.as_str(),
+                                    path = %file_record.path,
+                                    error = %parse_error,
+                                    regions = file_parse_errors.len(),
+                                    "Parse failed"
+                                );
+                            }
+
+                            let mut file_plugin_findings = Vec::new();
+                            if let Some(source) = source.as_deref() {
+                                let added = plugin_host.analyze(&PluginInput {
+                                    repo: &project_id,
+                                    r#ref: &effective_ref,
+                                    commit: commit_tree.as_ref().map(|tree| tree.commit.as_str()),
+                                    path: &file_record.path,
+                                    language: &file_record.language,
+                                    source,
+                                    symbols: &symbols_for_file,
+                                    call_edges: &call_edges,
+                                });
+                                symbols_for_file.extend(added.symbols);
+                                call_edges.extend(added.call_edges);
+                                file_plugin_findings = added.findings;
+                            }
+
+                            if !force {
+                                batch.delete_file_docs(
+                                    &index_set,
+                                    &project_id,
+                                    &effective_ref,
+                                    &file_record.path,
+                                );
+                            }
+
+                            if had_previous_index {
+                                embedding_writer
+                                    .delete_for_file_vectors(&conn, &file_record.path)?;
+                            }
+
+                            symbols::delete_symbols_for_file(
+                                &conn,
                                 &project_id,
                                 &effective_ref,
                                 &file_record.path,
-                            );
-                        }
+                            )?;
+                            batch.add_symbols(&index_set.symbols, &symbols_for_file)?;
+                            batch.add_snippets(&index_set.snippets, &snippets)?;
+                            batch.add_file(&index_set.files, &file_record)?;
+                            batch.write_sqlite(&conn, &symbols_for_file, &file_record, mtime_ns)?;
+                            injections::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_injections,
+                            )?;
+                            go_embeds::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_embeds,
+                            )?;
+                            todos::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_todos,
+                            )?;
+                            parse_errors::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_parse_errors,
+                            )?;
+                            plugin_findings::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_plugin_findings,
+                            )?;
+                            concurrency::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_concurrency,
+                            )?;
+                            routes::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_routes,
+                            )?;
+                            locals::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_locals,
+                            )?;
+                            literals::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &file_literals,
+                            )?;
+                            generated_files::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                generated,
+                            )?;
+                            file_encodings::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                encoding,
+                            )?;
+                            symbol_blame::replace_for_file(
+                                &conn,
+                                &project_id,
+                                &effective_ref,
+                                &file_record.path,
+                                &blame,
+                            )?;
+                            if let Some(blob) = blob {
+                                blob_artifacts::put(
+                                    &conn,
+                                    &project_id,
+                                    &file_record.path,
+                                    &file_record.content_hash,
+                                    &file_record.language,
+                                    file_bodies,
+                                    &effective_ref,
+                                    &blob,
+                                )?;
+                            }
+                            if shared {
+                                shared_count += 1;
+                            }
 
-                        if had_previous_index {
-                            embedding_writer.delete_for_file_vectors(&conn, &file_record.path)?;
-                        }
+                            let symbol_delta = symbols_for_file.len() as u64;
+                            pending_imports.push((file_record.path.clone(), raw_imports))?;
+                            pending_call_edges.push((file_record.path.clone(), call_edges))?;
+                            processed_paths.push(file_record.path.clone());
+                            pending_embedding_batches.push((symbols_for_file, snippets));
 
-                        symbols::delete_symbols_for_file(
-                            &conn,
-                            &project_id,
-                            &effective_ref,
-                            &file_record.path,
-                        )?;
-                        batch.add_symbols(&index_set.symbols, &symbols_for_file)?;
-                        batch.add_snippets(&index_set.snippets, &snippets)?;
-                        batch.add_file(&index_set.files, &file_record)?;
-                        batch.write_sqlite(&conn, &symbols_for_file, &file_record, mtime_ns)?;
-
-                        let symbol_delta = symbols_for_file.len() as u64;
-                        pending_imports.push((file_record.path.clone(), raw_imports));
-                        pending_call_edges.push((file_record.path.clone(), call_edges));
-                        pending_embedding_batches.push((symbols_for_file, snippets));
-
-                        symbol_count += symbol_delta;
-                        indexed_count += 1;
-                        if indexed_count.is_multiple_of(PROGRESS_UPDATE_EVERY)
-                            && let Err(err) = jobs::update_progress(
-                                &conn,
-                                &job_id,
-                                total_scanned,
-                                indexed_count as i64,
-                                symbol_count as i64,
-                            )
-                        {
-                            warn!(job_id = %job_id, "Failed to update index progress: {}", err);
+                            symbol_count += symbol_delta;
+                            indexed_count += 1;
+                            if indexed_count.is_multiple_of(PROGRESS_UPDATE_EVERY)
+                                && let Err(err) = jobs::update_progress(
+                                    &conn,
+                                    &job_id,
+                                    total_scanned,
+                                    indexed_count as i64,
+                                    symbol_count as i64,
+                                )
+                            {
+                                warn!(job_id = %job_id, "Failed to update index progress: {}", err);
+                            }
                         }
                     }
                 }
-            }
 
-            embedding_writer.write_embeddings_for_files(
-                &conn,
-                pending_embedding_batches
-                    .iter()
-                    .map(|(symbols, snippets)| (symbols.as_slice(), snippets.as_slice())),
-            )?;
+                embedding_writer.write_embeddings_for_files(
+                    &conn,
+                    pending_embedding_batches
+                        .iter()
+                        .map(|(symbols, snippets)| (symbols.as_slice(), snippets.as_slice())),
+                )?;
+                progress.advance(chunk_len);
+                Ok(())
+            },
+        );
+        drop(parse_guard);
+        progress.finish();
+        record_phase(&mut telemetry, "index.parse_write", phase_start.elapsed());
+        if let Err(err) = pipeline_result {
+            if err.downcast_ref::<Cancelled>().is_some() {
+                // Commit Tantivy so it matches the auto-committed SQLite rows, and
+                // forget the manifest hashes of files touched in this run: their
+                // edges were never resolved, so the next run must redo them.
+                batch.commit()?;
+                for path in &processed_paths {
+                    manifest::delete_manifest(&conn, &project_id, &effective_ref, path)?;
+                }
+            }
+            return Err(err);
         }
 
         // Resolve imports after all symbols are written so cross-file lookups can
         // match symbols regardless of scan order.
-        for (path, raw_imports) in pending_imports {
-            batch.replace_import_edges_for_file(
-                &conn,
-                &project_id,
-                &effective_ref,
-                &path,
-                raw_imports,
-            )?;
+        let phase_start = Instant::now();
+        let resolve_span = info_span!("index.resolve_edges").entered();
+        progress.phase("resolve", None);
+        let spilled_shards = pending_imports.spilled_shards() + pending_call_edges.spilled_shards();
+        if spilled_shards > 0 {
+            info!(spilled_shards, "Merging spilled edge shards");
         }
+        // Go imports between workspace modules resolve through the module
+        // paths, and Python and TypeScript ones through the `[languages]`
+        // settings, so those are recorded before any import is resolved.
+        go_modules::replace_for_ref(
+            &conn,
+            &project_id,
+            &effective_ref,
+            &go_workspace::discover_modules(&repo_root),
+        )?;
+        import_paths::replace_for_ref(
+            &conn,
+            &project_id,
+            &effective_ref,
+            &language_settings::import_paths(&repo_root, &config.languages),
+        )?;
+        workspace_projects::replace_for_ref(
+            &conn,
+            &project_id,
+            &effective_ref,
+            &project_discovery::discover_projects(&repo_root),
+        )?;
+        submodules::replace_for_ref(&conn, &project_id, &effective_ref, &indexed_submodules)?;
+        pending_imports.for_each_shard(|shard| -> Result<()> {
+            let mut package_spans = PackageSpans::new("imports");
+            for (path, raw_imports) in shard {
+                package_spans.enter(&path);
+                batch.replace_import_edges_for_file(
+                    &conn,
+                    &project_id,
+                    &effective_ref,
+                    &path,
+                    raw_imports,
+                )?;
+            }
+            Ok(())
+        })?;
         if !pending_call_edges.is_empty() {
             let lookup = call_extract::load_symbol_lookup(&conn, &project_id, &effective_ref)?;
-            for (_, call_edges) in pending_call_edges.iter_mut() {
-                call_extract::resolve_call_targets_with_lookup(&lookup, call_edges);
+            pending_call_edges.for_each_shard(|mut shard| -> Result<()> {
+                let mut package_spans = PackageSpans::new("calls");
+                for (path, call_edges) in shard.iter_mut() {
+                    package_spans.enter(path);
+                    go_workspace::resolve_qualified_go_calls(
+                        &conn,
+                        &project_id,
+                        &effective_ref,
+                        call_edges,
+                    )?;
+                    call_extract::resolve_call_targets_with_lookup(&lookup, call_edges);
+                }
+                drop(package_spans);
+                let _span = info_span!("index.store_call_edges", files = shard.len()).entered();
+                batch.replace_call_edges_for_files(&conn, &project_id, &effective_ref, shard)?;
+                Ok(())
+            })?;
+        }
+        let _ = std::fs::remove_dir(&spill_dir);
+        let _ = std::fs::remove_dir(data_dir.join("spill"));
+
+        resolve_span.exit();
+        progress.finish();
+        record_phase(&mut telemetry, "index.resolve_edges", phase_start.elapsed());
+
+        // Go templates are few and cheap to parse, so every run re-reads them
+        // all instead of tracking them in the manifest.
+        let mut templates = Vec::new();
+        let wants_go = commit_tree.is_none()
+            && (config.index.languages.is_empty()
+                || config.index.languages.iter().any(|l| l == "go"));
+        if wants_go {
+            for file in scanner::scan_template_files(
+                &repo_root,
+                config.index.max_file_size,
+                respect_ignore_files,
+                symlink_policy,
+            ) {
+                if !in_this_index(&file.relative_path) {
+                    continue;
+                }
+                let Ok(source) = std::fs::read_to_string(&file.path) else {
+                    continue;
+                };
+                let name = file
+                    .path
+                    .file_name()
+                    .map(|name| name.to_string_lossy().to_string())
+                    .unwrap_or_default();
+                templates.extend(go_template::parse_template(
+                    &project_id,
+                    &effective_ref,
+                    &file.relative_path,
+                    &name,
+                    "file",
+                    &source,
+                    1,
+                ));
             }
-            batch.replace_call_edges_for_files(
-                &conn,
-                &project_id,
-                &effective_ref,
-                pending_call_edges,
-            )?;
+        }
+        go_templates::replace_for_ref(&conn, &project_id, &effective_ref, &templates)?;
+        skipped_files::replace_for_ref(&conn, &project_id, &effective_ref, &skipped_records)?;
+
+        // Embedded files change without their Go file changing, so every
+        // directive is resolved against the working tree again.
+        if commit_tree.is_none() {
+            let mut embeds = go_embeds::list_embeds(&conn, &project_id, &effective_ref)?;
+            go_embed::resolve_embeds(&repo_root, &mut embeds);
+            go_embeds::update_resolution(&conn, &project_id, &effective_ref, &embeds)?;
         }
 
         // Commit Tantivy segment updates.
-        match batch.commit() {
+        let phase_start = Instant::now();
+        progress.phase("commit", None);
+        match info_span!("index.commit").in_scope(|| batch.commit()) {
             Ok(()) => {}
             Err(e) => {
                 return Err(e.into());
             }
         }
+        progress.finish();
+        record_phase(&mut telemetry, "index.commit", phase_start.elapsed());
 
         let changed_files = indexed_count + removed_count;
         let file_count = manifest::file_count(&conn, &project_id, &effective_ref)?;
         let total_symbol_count = symbols::symbol_count(&conn, &project_id, &effective_ref)?;
         let now = now_iso8601();
-        let indexed_commit = if vcs::is_git_repo(&repo_root) {
+        let indexed_commit = if let Some(tree) = &commit_tree {
+            tree.commit[..12].to_string()
+        } else if vcs::is_git_repo(&repo_root) {
             vcs::detect_head_commit(&repo_root).unwrap_or_else(|_| effective_ref.clone())
         } else {
             effective_ref.clone()
@@ -427,6 +1176,19 @@ pub fn run(
             last_accessed_at: now,
         };
         branch_state::upsert_branch_state(&conn, &branch_entry)?;
+        totals = RunTotals {
+            files: file_count,
+            symbols: total_symbol_count,
+            commit: Some(branch_entry.last_indexed_commit),
+            changed_paths: std::mem::take(&mut processed_paths),
+        };
+        index_modes::set_bodies_indexed(&conn, &project_id, &effective_ref, bodies)?;
+        index_modes::set_dependencies_indexed(
+            &conn,
+            &project_id,
+            &effective_ref,
+            dependency_mode.as_str(),
+        )?;
         if let Err(err) = jobs::update_progress(
             &conn,
             &job_id,
@@ -437,11 +1199,35 @@ pub fn run(
             warn!(job_id = %job_id, "Failed to update index progress: {}", err);
         }
 
-        Ok((indexed_count, skipped, symbol_count, changed_files))
+        Ok((
+            indexed_count,
+            shared_count,
+            skipped,
+            symbol_count,
+            changed_files,
+        ))
     })();
 
+    // Failed runs keep the journal: their writes are as partial as a crash's.
+    // Cancelled runs have already reconciled the stores above.
+    let consistent = match &index_result {
+        Ok(_) => true,
+        Err(err) => err.downcast_ref::<Cancelled>().is_some(),
+    };
+    if consistent {
+        journal.commit()?;
+    } else {
+        drop(journal);
+    }
+    if let Some(recorder) = telemetry {
+        recorder.flush();
+    }
+
     match index_result {
-        Ok((indexed_count, skipped, symbol_count, changed_files)) => {
+        Ok((indexed_count, shared_count, skipped, symbol_count, changed_files)) => {
+            stats::count(stats::FILES_REPARSED, indexed_count - shared_count);
+            stats::count(stats::FILES_SHARED, shared_count);
+            stats::count("files.skipped", skipped);
             let duration = start.elapsed();
             let duration_ms = duration.as_millis() as i64;
 
@@ -456,28 +1242,77 @@ pub fn run(
                 &now_iso8601(),
             )?;
 
+            // Entries for file versions no ref has anymore.
+            if config.index.blob_cache
+                && let Err(err) = blob_artifacts::prune(&conn, &project_id)
+            {
+                warn!("Failed to prune the blob cache: {}", err);
+            }
+
             println!();
             println!("Indexing complete!");
             println!("  Files indexed: {}", indexed_count);
+            if shared_count > 0 {
+                println!("  Files shared:  {}", shared_count);
+            }
             println!("  Files skipped: {}", skipped);
             println!("  Symbols found: {}", symbol_count);
             println!("  Changed files: {}", changed_files);
             println!("  Duration:      {:.1}s", duration.as_secs_f64());
             println!("  Job ID:        {}", job_id);
+            match skipped_files::list_for_ref(&conn, &project_id, &effective_ref) {
+                Ok(records) => print_skipped_files(&records),
+                Err(err) => warn!(error = %err, "Failed to list skipped files"),
+            }
+            match parse_errors::list_for_ref(&conn, &project_id, &effective_ref) {
+                Ok(regions) => print_parse_errors(&regions),
+                Err(err) => warn!(error = %err, "Failed to list parse errors"),
+            }
 
             info!(
                 indexed_count,
                 symbol_count, changed_files, duration_ms, "Indexing complete"
             );
+            if !config.index.webhooks.is_empty() {
+                let findings = webhook::new_findings(
+                    &conn,
+                    &config,
+                    &project_id,
+                    &effective_ref,
+                    &totals.changed_paths,
+                );
+                let mut event = totals.event("published", &repo_root_str, &job, duration);
+                event.files.indexed = indexed_count;
+                event.files.skipped = skipped;
+                event.files.changed = changed_files;
+                event.symbols.extracted = symbol_count;
+                event.findings = findings;
+                webhook::notify(&config.index.webhooks, &event);
+            }
             Ok(())
         }
         Err(err) => {
             let duration_ms = start.elapsed().as_millis() as i64;
             let error_message = format!("{err:#}");
+            let status = if err.downcast_ref::<Cancelled>().is_some() {
+                JobStatus::Interrupted
+            } else {
+                JobStatus::Failed
+            };
+            if !config.index.webhooks.is_empty() {
+                let label = if status == JobStatus::Interrupted {
+                    "interrupted"
+                } else {
+                    "failed"
+                };
+                let mut event = totals.event(label, &repo_root_str, &job, start.elapsed());
+                event.error = Some(error_message.clone());
+                webhook::notify(&config.index.webhooks, &event);
+            }
             let _ = jobs::update_job_status(
                 &conn,
                 &job_id,
-                JobStatus::Failed,
+                status,
                 None,
                 Some(duration_ms),
                 Some(&error_message),
@@ -488,10 +1323,210 @@ pub fn run(
     }
 }
 
-fn file_mtime_ns(path: &Path) -> Option<i64> {
-    std::fs::metadata(path)
+/// What the end of a successful run leaves for the `[index] webhooks`
+/// summary; empty when the run failed before reaching it.
+#[derive(Default)]
+struct RunTotals {
+    files: u64,
+    symbols: u64,
+    commit: Option<String>,
+    changed_paths: Vec<String>,
+}
+
+impl RunTotals {
+    fn event(
+        &self,
+        status: &'static str,
+        workspace: &str,
+        job: &jobs::IndexJob,
+        duration: Duration,
+    ) -> webhook::IndexCompleted {
+        webhook::IndexCompleted {
+            event: webhook::INDEX_COMPLETED,
+            status,
+            project_id: job.project_id.clone(),
+            workspace: workspace.to_string(),
+            r#ref: job.r#ref.clone(),
+            commit: self.commit.clone(),
+            job_id: job.job_id.clone(),
+            mode: job.mode.clone(),
+            duration_ms: duration.as_millis() as u64,
+            files: webhook::FileCounts {
+                total: self.files,
+                ..webhook::FileCounts::default()
+            },
+            symbols: webhook::SymbolCounts {
+                total: self.symbols,
+                ..webhook::SymbolCounts::default()
+            },
+            findings: None,
+            error: None,
+        }
+    }
+}
+
+/// One span per run of consecutive files of a package (directory) while edges
+/// are resolved, so a trace shows where resolution time goes without a span
+/// per file.
+struct PackageSpans {
+    edges: &'static str,
+    current: Option<(String, tracing::span::EnteredSpan)>,
+}
+
+impl PackageSpans {
+    fn new(edges: &'static str) -> Self {
+        Self {
+            edges,
+            current: None,
+        }
+    }
+
+    fn enter(&mut self, path: &str) {
+        let package = path.rsplit_once('/').map_or("", |(dir, _)| dir);
+        if self
+            .current
+            .as_ref()
+            .is_some_and(|(current, _)| current == package)
+        {
+            return;
+        }
+        // The previous package's span closes before the next one opens.
+        self.current = None;
+        let span = info_span!("index.resolve_package", package, edges = self.edges).entered();
+        self.current = Some((package.to_string(), span));
+    }
+}
+
+/// What dropping a file from the index touches.
+struct FileRemoval<'a> {
+    conn: &'a rusqlite::Connection,
+    batch: &'a writer::BatchWriter,
+    index_set: &'a tantivy_index::IndexSet,
+    embedding_writer: &'a embed_writer::EmbeddingWriter,
+    project_id: &'a str,
+    ref_name: &'a str,
+}
+
+impl FileRemoval<'_> {
+    /// Drop everything indexed from `path`, which was deleted or is now
+    /// skipped.
+    fn remove(&self, path: &str) -> Result<()> {
+        let Self {
+            conn,
+            batch,
+            index_set,
+            embedding_writer,
+            project_id,
+            ref_name,
+        } = *self;
+        let deleted_symbol_ids: Vec<String> =
+            symbols::list_symbols_in_file(conn, project_id, ref_name, path)?
+                .into_iter()
+                .map(|symbol| symbol.symbol_stable_id)
+                .collect();
+        batch.delete_file_docs(index_set, project_id, ref_name, path);
+        symbols::delete_symbols_for_file(conn, project_id, ref_name, path)?;
+        let source_edge_id = import_extract::source_symbol_id_for_path(path);
+        edges::delete_edges_for_file(conn, project_id, ref_name, vec![source_edge_id.as_str()])?;
+        edges::delete_call_edges_for_file(conn, project_id, ref_name, path)?;
+        edges::delete_call_edges_to_symbols(conn, project_id, ref_name, &deleted_symbol_ids)?;
+        embedding_writer.delete_for_file_vectors_with_symbols(conn, path, &deleted_symbol_ids)?;
+        injections::delete_for_file(conn, project_id, ref_name, path)?;
+        go_embeds::delete_for_file(conn, project_id, ref_name, path)?;
+        todos::delete_for_file(conn, project_id, ref_name, path)?;
+        parse_errors::delete_for_file(conn, project_id, ref_name, path)?;
+        plugin_findings::delete_for_file(conn, project_id, ref_name, path)?;
+        generated_files::delete_for_file(conn, project_id, ref_name, path)?;
+        file_encodings::delete_for_file(conn, project_id, ref_name, path)?;
+        concurrency::delete_for_file(conn, project_id, ref_name, path)?;
+        routes::delete_for_file(conn, project_id, ref_name, path)?;
+        locals::delete_for_file(conn, project_id, ref_name, path)?;
+        literals::delete_for_file(conn, project_id, ref_name, path)?;
+        symbol_blame::delete_for_file(conn, project_id, ref_name, path)?;
+        manifest::delete_manifest(conn, project_id, ref_name, path)?;
+        Ok(())
+    }
+}
+
+/// Record a phase for `--stats` and, when enabled, telemetry.
+fn record_phase(
+    telemetry: &mut Option<telemetry::Recorder>,
+    name: &'static str,
+    elapsed: std::time::Duration,
+) {
+    stats::phase(name, elapsed);
+    if let Some(recorder) = telemetry.as_mut() {
+        recorder.phase(name, elapsed);
+    }
+}
+
+/// Files shown by the parse error and skipped file summaries; the rest are
+/// only counted.
+const SUMMARY_FILES_SHOWN: usize = 10;
+
+/// List the files left out for being over a limit or unreadable, by reason.
+fn print_skipped_files(records: &[SkippedFileRecord]) {
+    if records.is_empty() {
+        return;
+    }
+    let mut by_reason: Vec<(SkipReason, usize)> = Vec::new();
+    for record in records {
+        match by_reason
+            .iter_mut()
+            .find(|(reason, _)| *reason == record.reason)
+        {
+            Some((_, count)) => *count += 1,
+            None => by_reason.push((record.reason, 1)),
+        }
+    }
+    let counts: Vec<String> = by_reason
+        .iter()
+        .map(|(reason, count)| format!("{reason}: {count}"))
+        .collect();
+    println!("  Skip reasons:  {}", counts.join(", "));
+    for record in records.iter().take(SUMMARY_FILES_SHOWN) {
+        println!("    {} ({}, {})", record.path, record.reason, record.detail);
+    }
+    if records.len() > SUMMARY_FILES_SHOWN {
+        println!("    ... and {} more", records.len() - SUMMARY_FILES_SHOWN);
+    }
+}
+
+/// Summarize the regions the parser could not make sense of. The rest of
+/// each file was indexed, so these are the only places search is blind.
+fn print_parse_errors(regions: &[cruxe_core::types::ParseErrorRecord]) {
+    if regions.is_empty() {
+        return;
+    }
+    let mut files: Vec<(&str, Vec<String>)> = Vec::new();
+    for region in regions {
+        let lines = if region.start_line == region.end_line {
+            region.start_line.to_string()
+        } else {
+            format!("{}-{}", region.start_line, region.end_line)
+        };
+        match files.last_mut() {
+            Some((path, spans)) if *path == region.path => spans.push(lines),
+            _ => files.push((&region.path, vec![lines])),
+        }
+    }
+    println!(
+        "  Parse errors:  {} file(s), {} region(s) skipped; the rest was indexed",
+        files.len(),
+        regions.len()
+    );
+    for (path, spans) in files.iter().take(SUMMARY_FILES_SHOWN) {
+        println!("    {}: lines {}", path, spans.join(", "));
+    }
+    if files.len() > SUMMARY_FILES_SHOWN {
+        println!("    ... and {} more", files.len() - SUMMARY_FILES_SHOWN);
+    }
+}
+
+fn metadata_mtime_ns(metadata: &std::fs::Metadata) -> Option<i64> {
+    metadata
+        .modified()
         .ok()
-        .and_then(|m| m.modified().ok())
         .and_then(|t| t.duration_since(std::time::UNIX_EPOCH).ok())
         .map(|d| d.as_nanos() as i64)
 }
@@ -501,50 +1536,157 @@ struct PreparedIndexFile {
     snippets: Vec<cruxe_core::types::SnippetRecord>,
     raw_imports: Vec<import_extract::RawImport>,
     call_edges: Vec<cruxe_core::types::CallEdge>,
+    injections: Vec<cruxe_core::types::InjectionRecord>,
+    embeds: Vec<cruxe_core::types::EmbedRecord>,
+    todos: Vec<cruxe_core::types::TodoRecord>,
+    concurrency: Vec<cruxe_core::types::ConcurrencyRecord>,
+    routes: Vec<cruxe_core::types::RouteRecord>,
+    locals: Vec<cruxe_core::types::LocalRecord>,
+    literals: Vec<cruxe_core::types::LiteralRecord>,
+    generated: Option<&'static str>,
+    /// Encoding the file was transcoded from; `None` for plain UTF-8.
+    encoding: Option<&'static str>,
+    blame: Vec<symbol_blame::SymbolBlame>,
     file_record: FileRecord,
     mtime_ns: Option<i64>,
     parse_error: Option<String>,
+    parse_errors: Vec<cruxe_core::types::ParseErrorRecord>,
     had_previous_index: bool,
+    /// Whether symbol bodies were extracted, part of the blob cache key.
+    bodies: bool,
+    /// Encoded artifacts to store in the blob cache, when freshly extracted.
+    blob: Option<Vec<u8>>,
+    /// Reused from the blob cache instead of parsed.
+    shared: bool,
+    /// The file's text, kept for `[plugins]`.
+    source: Option<String>,
 }
 
 enum PreparedIndexOutcome {
     Unchanged,
-    SkippedRead { path: String, error: String },
+    /// Same content, but the size or mtime moved (touched, checked out
+    /// again): the refreshed entry lets the next run skip reading it.
+    Touched(Box<manifest::ManifestEntry>),
+    /// Unreadable, or over one of the `[index]` limits.
+    Skipped {
+        path: String,
+        skip: Skip,
+        had_previous_index: bool,
+    },
     Ready(Box<PreparedIndexFile>),
 }
 
+/// Where `[index] blame` reads history: the repository and, when the run
+/// indexes a revision that is not checked out, that commit.
+struct BlameSource<'a> {
+    repo_root: &'a Path,
+    revision: Option<&'a str>,
+}
+
+/// Read and extract one file, from `commit_tree` when the run indexes a
+/// revision that is not checked out, else from the working tree. With
+/// `blob_cache`, a version of the file another ref already extracted is
+/// reused rather than parsed, except on `--force` runs. Files over `limits`
+/// are skipped before they reach the parser. With `keep_source`, the text
+/// is handed on for plugins.
+#[allow(clippy::too_many_arguments)]
 fn prepare_file_for_indexing(
     file: &scanner::ScannedFile,
+    limits: &FileLimits,
+    commit_tree: Option<&cruxe_vcs::CommitTree>,
+    blame_source: Option<&BlameSource>,
+    blob_cache: Option<&BlobCacheReader>,
     project_id: &str,
     effective_ref: &str,
     force: bool,
-    existing_hash: Option<&str>,
+    bodies: bool,
+    existing: Option<&manifest::ManifestEntry>,
+    keep_source: bool,
 ) -> PreparedIndexOutcome {
-    let content = match std::fs::read_to_string(&file.path) {
-        Ok(c) => c,
-        Err(err) => {
-            return PreparedIndexOutcome::SkippedRead {
+    // Taken before the read: a write racing with it changes the mtime again,
+    // so the next run cannot mistake stale content for current. Blobs have
+    // no mtime; their content hash decides.
+    let metadata = match commit_tree {
+        Some(_) => None,
+        None => std::fs::metadata(&file.path).ok(),
+    };
+    let mtime_ns = metadata.as_ref().and_then(metadata_mtime_ns);
+    if !force
+        && let (Some(entry), Some(metadata)) = (existing, metadata.as_ref())
+        && entry.mtime_ns.is_some()
+        && entry.mtime_ns == mtime_ns
+        && entry.size_bytes == metadata.len()
+    {
+        // Same size and mtime as when it was indexed: skip reading and hashing.
+        return PreparedIndexOutcome::Unchanged;
+    }
+
+    let had_previous_index = existing.is_some();
+    let read = match commit_tree {
+        Some(tree) => tree
+            .read(&file.relative_path)
+            .map_err(|err| err.to_string()),
+        None => std::fs::read(&file.path).map_err(|err| err.to_string()),
+    };
+    let content = read
+        .map_err(|detail| Skip {
+            reason: SkipReason::Unreadable,
+            detail,
+        })
+        .and_then(|bytes| limits.decode(bytes));
+    let (content, encoding) = match content {
+        Ok(decoded) => (decoded.text, decoded.encoding.recorded()),
+        Err(skip) => {
+            return PreparedIndexOutcome::Skipped {
                 path: file.relative_path.clone(),
-                error: err.to_string(),
+                skip,
+                had_previous_index,
             };
         }
     };
 
     let content_hash = blake3::hash(content.as_bytes()).to_hex().to_string();
-    let had_previous_index = existing_hash.is_some();
-    if !force && existing_hash == Some(content_hash.as_str()) {
-        return PreparedIndexOutcome::Unchanged;
+    if !force
+        && let Some(entry) = existing
+        && entry.content_hash == content_hash
+    {
+        return match metadata {
+            // Record the on-disk size and mtime the fast path above compares.
+            Some(metadata) => PreparedIndexOutcome::Touched(Box::new(manifest::ManifestEntry {
+                size_bytes: metadata.len(),
+                mtime_ns,
+                ..entry.clone()
+            })),
+            None => PreparedIndexOutcome::Unchanged,
+        };
     }
 
-    let artifacts = prepare::build_source_artifacts(
-        &content,
-        &file.language,
-        &file.relative_path,
-        project_id,
-        effective_ref,
-        None,
-        true,
-    );
+    let cached = blob_cache.filter(|_| !force).and_then(|cache| {
+        cache.lookup(
+            &file.relative_path,
+            &content_hash,
+            &file.language,
+            bodies,
+            generated::generated_reason(&file.relative_path, &content),
+        )
+    });
+    let shared = cached.is_some();
+    let artifacts = cached.unwrap_or_else(|| {
+        prepare::build_source_artifacts(
+            &content,
+            &file.language,
+            &file.relative_path,
+            project_id,
+            effective_ref,
+            None,
+            true,
+            bodies,
+        )
+    });
+    let blob = match blob_cache {
+        Some(_) if !shared => blob_cache::encode(&artifacts),
+        _ => None,
+    };
     let filename = file
         .path
         .file_name()
@@ -560,27 +1702,164 @@ fn prepare_file_for_indexing(
     );
     // Reuse the precomputed hash used for unchanged short-circuit checks.
     file_record.content_hash = content_hash;
+    let blame = blame_source
+        .map(|source| {
+            prepare::blame_symbols(
+                source.repo_root,
+                source.revision,
+                &file.relative_path,
+                &content,
+                &artifacts.symbols,
+            )
+        })
+        .unwrap_or_default();
 
     PreparedIndexOutcome::Ready(Box::new(PreparedIndexFile {
         symbols_for_file: artifacts.symbols,
         snippets: artifacts.snippets,
         raw_imports: artifacts.raw_imports,
         call_edges: artifacts.call_edges,
+        injections: artifacts.injections,
+        embeds: artifacts.embeds,
+        todos: artifacts.todos,
+        concurrency: artifacts.concurrency,
+        routes: artifacts.routes,
+        locals: artifacts.locals,
+        literals: artifacts.literals,
+        generated: artifacts.generated,
+        encoding,
+        blame,
         file_record,
-        mtime_ns: file_mtime_ns(&file.path),
+        mtime_ns,
         parse_error: artifacts.parse_error,
+        parse_errors: artifacts.parse_errors,
         had_previous_index,
+        bodies,
+        blob,
+        shared,
+        source: keep_source.then_some(content),
     }))
 }
 
-fn resolve_index_parallelism() -> usize {
-    std::env::var(INDEX_PARALLELISM_ENV)
-        .ok()
-        .and_then(|raw| raw.parse::<usize>().ok())
-        .filter(|value| *value > 0)
+/// Worker count: `--jobs`, then `CRUXE_INDEX_PARALLELISM`, then the number
+/// of available cores.
+fn seed_shard_project(
+    conn: &rusqlite::Connection,
+    project_data_dir: &Path,
+    repo_root_str: &str,
+    config: &Config,
+) -> Result<Project> {
+    let main_conn = db::open_connection_with_config(
+        &project_data_dir.join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )?;
+    schema::create_tables(&main_conn)?;
+    let proj = project::get_by_root(&main_conn, repo_root_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    project::create_project(conn, &proj)?;
+    Ok(proj)
+}
+
+/// `--max-memory`, else `CRUXE_INDEX_MAX_MEMORY`; `None` leaves memory
+/// unbounded.
+fn resolve_memory_budget(max_memory: Option<&str>) -> Result<Option<MemoryBudget>> {
+    let env_value = std::env::var(INDEX_MAX_MEMORY_ENV).ok();
+    let Some(raw) = max_memory
+        .or(env_value.as_deref())
+        .filter(|raw| !raw.trim().is_empty())
+    else {
+        return Ok(None);
+    };
+    let budget = MemoryBudget::parse(raw)
+        .ok_or_else(|| anyhow::anyhow!("Invalid memory size `{raw}` (e.g. 512M, 4G)"))?;
+    if budget.total() < spill::MIN_MEMORY_BUDGET {
+        bail!(
+            "--max-memory must be at least {} MiB",
+            spill::MIN_MEMORY_BUDGET >> 20
+        );
+    }
+    Ok(Some(budget))
+}
+
+fn resolve_index_parallelism(jobs: Option<usize>) -> usize {
+    jobs.filter(|value| *value > 0)
+        .or_else(|| {
+            std::env::var(INDEX_PARALLELISM_ENV)
+                .ok()
+                .and_then(|raw| raw.parse::<usize>().ok())
+                .filter(|value| *value > 0)
+        })
         .unwrap_or_else(|| {
             std::thread::available_parallelism()
                 .map(std::num::NonZeroUsize::get)
                 .unwrap_or(1)
         })
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn prepare(
+        file: &scanner::ScannedFile,
+        existing: Option<&manifest::ManifestEntry>,
+    ) -> PreparedIndexOutcome {
+        prepare_file_for_indexing(
+            file,
+            &FileLimits::from_config(&Config::default().index),
+            None,
+            None,
+            None,
+            "proj",
+            "main",
+            false,
+            true,
+            existing,
+            false,
+        )
+    }
+
+    #[test]
+    fn touched_files_refresh_the_manifest_and_then_take_the_fast_path() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("lib.rs");
+        let content = "fn main() {}\n";
+        std::fs::write(&path, content).unwrap();
+        let file = scanner::ScannedFile {
+            path: path.clone(),
+            relative_path: "lib.rs".to_string(),
+            language: "rust".to_string(),
+        };
+        // Indexed before the file was touched: same content, older mtime.
+        let stale = manifest::ManifestEntry {
+            repo: "proj".to_string(),
+            r#ref: "main".to_string(),
+            path: "lib.rs".to_string(),
+            content_hash: blake3::hash(content.as_bytes()).to_hex().to_string(),
+            size_bytes: content.len() as u64,
+            mtime_ns: Some(1),
+            language: Some("rust".to_string()),
+            indexed_at: "2026-01-01T00:00:00Z".to_string(),
+        };
+
+        let PreparedIndexOutcome::Touched(refreshed) = prepare(&file, Some(&stale)) else {
+            panic!("expected the manifest entry to be refreshed");
+        };
+        let metadata = std::fs::metadata(&path).unwrap();
+        assert_eq!(refreshed.mtime_ns, metadata_mtime_ns(&metadata));
+        assert_eq!(refreshed.size_bytes, metadata.len());
+        assert_eq!(refreshed.content_hash, stale.content_hash);
+
+        // The next run matches on size and mtime alone: a hash that no
+        // longer matches the content is never looked at.
+        let fast_path_only = manifest::ManifestEntry {
+            content_hash: String::new(),
+            ..*refreshed
+        };
+        assert!(matches!(
+            prepare(&file, Some(&fast_path_only)),
+            PreparedIndexOutcome::Unchanged
+        ));
+    }
+}
@@ -5,13 +5,41 @@ use cruxe_core::time::now_iso8601;
 use cruxe_core::types::{Project, generate_project_id};
 use cruxe_core::vcs;
 use cruxe_state::{db, project, schema, tantivy_index};
+use rusqlite::Connection;
 use std::path::Path;
 use tracing::info;
 
-pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
+/// Starter project configs for `cruxe init --template`, by name.
+pub const TEMPLATES: &[(&str, &str)] = &[
+    (
+        "security-audit",
+        include_str!("../../templates/security-audit.toml"),
+    ),
+    (
+        "architecture",
+        include_str!("../../templates/architecture.toml"),
+    ),
+    (
+        "llm-context",
+        include_str!("../../templates/llm-context.toml"),
+    ),
+];
+
+pub fn run(
+    repo_root: &Path,
+    template: Option<&str>,
+    force: bool,
+    config_file: Option<&Path>,
+) -> Result<()> {
     let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
     let repo_root_str = repo_root.to_string_lossy().to_string();
 
+    // Written before the config is loaded so its settings (a custom data
+    // dir, for one) apply to this run too.
+    if let Some(name) = template {
+        write_template(&repo_root, name, force)?;
+    }
+
     let config = Config::load_with_file(Some(&repo_root), config_file)?;
     let project_id = generate_project_id(&repo_root_str);
     let data_dir = config.project_data_dir(&project_id);
@@ -37,18 +65,37 @@ pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
         return Ok(());
     }
 
+    let vcs_mode = register(&conn, &repo_root, &data_dir)?.vcs_mode;
+
+    println!("Project initialized successfully!");
+    println!("  ID:       {}", project_id);
+    println!("  Root:     {}", repo_root_str);
+    println!("  VCS mode: {}", if vcs_mode { "yes" } else { "no" });
+    println!("  Data dir: {}", data_dir.display());
+    println!();
+    println!("Next step: run `cruxe index` to index your codebase.");
+
+    info!(project_id, repo_root = %repo_root_str, vcs_mode, "Project initialized");
+    Ok(())
+}
+
+/// Create the project row for `repo_root` (canonical) and its search
+/// index directories under `data_dir`.
+pub fn register(conn: &Connection, repo_root: &Path, data_dir: &Path) -> Result<Project> {
+    let repo_root_str = repo_root.to_string_lossy().to_string();
+
     // Detect VCS mode
-    let vcs_mode = vcs::is_git_repo(&repo_root);
+    let vcs_mode = vcs::is_git_repo(repo_root);
     let default_ref = if vcs_mode {
-        vcs::detect_default_ref(&repo_root, "main")
+        vcs::detect_default_ref(repo_root, "main")
     } else {
         constants::REF_LIVE.to_string()
     };
 
     let now = now_iso8601();
     let project = Project {
-        project_id: project_id.clone(),
-        repo_root: repo_root_str.clone(),
+        project_id: generate_project_id(&repo_root_str),
+        repo_root: repo_root_str,
         display_name: repo_root
             .file_name()
             .map(|n| n.to_string_lossy().to_string()),
@@ -60,19 +107,37 @@ pub fn run(repo_root: &Path, config_file: Option<&Path>) -> Result<()> {
         updated_at: now,
     };
 
-    project::create_project(&conn, &project)?;
+    project::create_project(conn, &project)?;
 
     // Create Tantivy index directories
-    let _index_set = tantivy_index::IndexSet::open(&data_dir)?;
-
-    println!("Project initialized successfully!");
-    println!("  ID:       {}", project_id);
-    println!("  Root:     {}", repo_root_str);
-    println!("  VCS mode: {}", if vcs_mode { "yes" } else { "no" });
-    println!("  Data dir: {}", data_dir.display());
-    println!();
-    println!("Next step: run `cruxe index` to index your codebase.");
+    let _index_set = tantivy_index::IndexSet::open(data_dir)?;
+    Ok(project)
+}
 
-    info!(project_id, repo_root = %repo_root_str, vcs_mode, "Project initialized");
+/// Write the named template to the project config file, refusing to replace
+/// an existing one unless `force` is set.
+fn write_template(repo_root: &Path, name: &str, force: bool) -> Result<()> {
+    let Some((_, contents)) = TEMPLATES.iter().find(|(template, _)| *template == name) else {
+        let names: Vec<&str> = TEMPLATES.iter().map(|(template, _)| *template).collect();
+        anyhow::bail!(
+            "Unknown template `{}` (available: {})",
+            name,
+            names.join(", ")
+        );
+    };
+    let path = repo_root.join(constants::PROJECT_CONFIG_FILE);
+    if path.exists() && !force {
+        anyhow::bail!(
+            "{} already exists; pass --force to replace it with the `{}` template",
+            path.display(),
+            name
+        );
+    }
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent).context("Failed to create config directory")?;
+    }
+    std::fs::write(&path, contents)
+        .with_context(|| format!("Failed to write {}", path.display()))?;
+    println!("Wrote `{}` template to {}", name, path.display());
     Ok(())
 }
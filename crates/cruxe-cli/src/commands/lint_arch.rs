@@ -0,0 +1,85 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::{ArchRulesFile, Config};
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::arch_rules::{self, ArchReport, ArchRules};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe lint-arch`: check calls and imports against the architecture
+/// rules file, failing when any rule is broken.
+pub fn run(
+    workspace: &Path,
+    rules_file: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let rules_path = workspace.join(rules_file.unwrap_or(constants::ARCH_RULES_FILE));
+    let file = ArchRulesFile::load(&rules_path)
+        .map_err(|e| anyhow::anyhow!("Failed to load architecture rules: {}", e))?;
+    let rules = ArchRules::compile(&file)
+        .map_err(|e| anyhow::anyhow!("Invalid {}: {}", rules_path.display(), e))?;
+    if rules.is_empty() {
+        anyhow::bail!("{} declares no [[rule]]", rules_path.display());
+    }
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let report = arch_rules::lint_architecture(&conn, &project_id, &resolved_ref, &rules)
+        .map_err(|e| anyhow::anyhow!("Architecture lint failed: {}", e))?;
+    super::render::render_records(format, &report, &report.violations, print_report)?;
+
+    let mut failures = Vec::new();
+    if !report.violations.is_empty() {
+        failures.push(format!(
+            "{} architecture rule violation(s)",
+            report.violations.len()
+        ));
+    }
+    super::gate::enforce("Architecture check failed", &failures)
+}
+
+fn print_report(report: &ArchReport) {
+    for violation in &report.violations {
+        println!(
+            "{}:{}: {} [{}]: {}",
+            violation.path,
+            violation.line,
+            violation.rule,
+            violation.constraint.as_str(),
+            violation.message
+        );
+        println!("    {} -> {}", violation.from, violation.to);
+    }
+    if report.violations.is_empty() {
+        println!(
+            "{} rule(s) over {} cross-package call(s) and import(s) on ref {}: no violations",
+            report.rules, report.edges, report.ref_name
+        );
+    } else {
+        println!();
+        println!(
+            "{} violation(s) of {} rule(s) on ref {}",
+            report.violations.len(),
+            report.rules,
+            report.ref_name
+        );
+    }
+}
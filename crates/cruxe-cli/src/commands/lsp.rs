@@ -0,0 +1,42 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_mcp::lsp::{self, LspSession};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe lsp`: serve definitions, references, symbols and call hierarchy
+/// from the index to an editor over stdio.
+pub fn run(workspace: &Path, r#ref: Option<&str>, config_file: Option<&Path>) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    drop(conn);
+
+    let session = LspSession::open(&workspace, config_file, &resolved_ref)
+        .map_err(|e| anyhow::anyhow!("Failed to open LSP session: {}", e))?;
+    let shut_down = lsp::run_lsp(&session, std::io::stdin().lock(), std::io::stdout().lock())
+        .context("LSP connection failed")?;
+    if !shut_down {
+        // The protocol asks for a non-zero exit when `exit` comes without
+        // a prior `shutdown`.
+        std::process::exit(1);
+    }
+    Ok(())
+}
@@ -0,0 +1,53 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::repo_map::{self, DEFAULT_BUDGET_TOKENS, RepoMap, RepoMapOptions};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe map`: the most important types and function signatures of the
+/// repository, ranked over the call graph and cut to `budget` tokens, for
+/// agents to keep as standing context. Only files in scope are listed.
+pub fn run(
+    workspace: &Path,
+    budget: Option<usize>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let options = RepoMapOptions {
+        budget_tokens: budget.unwrap_or(DEFAULT_BUDGET_TOKENS),
+        scope: super::scope::path_scope(&config, &workspace)?,
+    };
+    let map = repo_map::build_repo_map(&conn, &project_id, &resolved_ref, &options)
+        .map_err(|e| anyhow::anyhow!("Repo map failed: {}", e))?;
+    super::render::render_records(format, &map, &map.files, print_map)
+}
+
+fn print_map(map: &RepoMap) {
+    print!("{}", repo_map::render_text(map));
+    eprintln!(
+        "{} of {} symbol(s) shown in ~{} of {} tokens.",
+        map.symbols_shown, map.symbols_total, map.used_tokens, map.budget_tokens
+    );
+}
@@ -1,9 +1,78 @@
+pub mod api;
+pub mod ask;
+pub mod audit;
+pub mod baseline;
+pub mod batch;
+pub mod bench;
+pub mod call_tree;
+pub mod changed;
+pub mod check;
+pub mod chunk;
+pub mod completions;
+pub mod concurrency;
+pub mod context;
+pub mod daemon;
+pub mod deadcode;
+pub mod def;
+pub mod deps;
+pub mod describe;
+pub mod diff;
+pub mod doc_coverage;
 pub mod doctor;
+pub mod duplicates;
+pub mod editor;
+pub mod embed;
+pub mod errors;
 pub mod eval;
+pub mod exits;
+pub mod export;
+pub mod federation;
+pub mod finding;
+pub mod gate;
+pub mod github;
+pub mod graph;
+pub mod grep;
+pub mod hook;
+pub mod hotspots;
+pub mod impact;
+pub mod impls;
 pub mod index;
 pub mod init;
+pub mod lint_arch;
+pub mod lsp;
+pub mod map;
+pub mod outline;
+pub mod preflight;
+pub mod projects;
 pub mod prune_overlays;
+pub mod query;
+pub mod refs;
+pub mod relevant;
+pub mod remote;
+pub mod remote_cache;
+pub mod rename;
+pub mod render;
+pub mod report;
+pub mod resolve;
+pub mod routes;
+pub mod schema;
+pub mod scope;
 pub mod search;
+pub mod serve;
 pub mod serve_mcp;
+pub mod shard;
+pub mod snippet;
 pub mod state_export;
 pub mod state_import;
+pub mod stats;
+pub mod summarize;
+pub mod tags;
+pub mod telemetry;
+pub mod templates;
+pub mod tests_for;
+pub mod todos;
+pub mod tui;
+pub mod upload;
+pub mod watch;
+pub mod webhook;
+pub mod where_used;
@@ -0,0 +1,178 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_indexer::{scanner, skeleton};
+use cruxe_state::symbols::{self, OutlineSymbol};
+use cruxe_state::{db, manifest, project};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::path::Path;
+
+#[derive(Debug, Serialize, JsonSchema)]
+pub struct Outline {
+    pub file_path: String,
+    pub language: String,
+    #[serde(rename = "ref")]
+    pub ref_name: String,
+    pub symbol_count: usize,
+    /// Nested through `children` unless `--top-only`.
+    pub symbols: Vec<OutlineSymbol>,
+}
+
+/// `cruxe outline <file>`: the symbol hierarchy of one file with line ranges.
+/// `file` is relative to the current directory or the workspace root. The
+/// `skeleton` format prints the source with function bodies elided instead,
+/// and also takes a package directory.
+pub fn run(
+    workspace: &Path,
+    file: &str,
+    top_only: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let path = relative_path(&workspace, file);
+    if format == "skeleton" {
+        return print_skeleton(&conn, &workspace, &project_id, &resolved_ref, &path);
+    }
+    let flat = symbols::get_file_outline_query(&conn, &project_id, &resolved_ref, &path, top_only)?;
+    if flat.is_empty()
+        && manifest::get_content_hash(&conn, &project_id, &resolved_ref, &path)?.is_none()
+    {
+        anyhow::bail!(
+            "No symbols found for path '{}' on ref '{}'. Verify the path and ensure the project is indexed.",
+            path,
+            resolved_ref
+        );
+    }
+
+    let symbol_count = flat.len();
+    let language = flat
+        .first()
+        .map(|symbol| symbol.language.clone())
+        .unwrap_or_default();
+    let outline = if top_only {
+        flat
+    } else {
+        symbols::build_symbol_tree(flat)
+    };
+
+    let output = Outline {
+        file_path: path,
+        language,
+        ref_name: resolved_ref,
+        symbol_count,
+        symbols: outline,
+    };
+    super::render::render_records(format, &output, &output.symbols, |output| {
+        println!(
+            "{} ({}, {} symbol(s))",
+            output.file_path, output.language, output.symbol_count
+        );
+        if output.symbols.is_empty() {
+            println!("  (no symbols)");
+        }
+        print_symbols(&output.symbols, 1);
+    })
+}
+
+/// Index paths are workspace-relative; accept paths relative to the current
+/// directory too, as long as they resolve inside the workspace.
+fn relative_path(workspace: &Path, file: &str) -> String {
+    std::fs::canonicalize(file)
+        .ok()
+        .and_then(|absolute| {
+            absolute
+                .strip_prefix(workspace)
+                .ok()
+                .map(|relative| relative.to_string_lossy().replace('\\', "/"))
+        })
+        .unwrap_or_else(|| file.trim_start_matches("./").to_string())
+}
+
+/// The file, or each indexed file directly in the directory, with function
+/// bodies elided; several files each under a `==> path <==` header.
+fn print_skeleton(
+    conn: &rusqlite::Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<()> {
+    let dir = match path.trim_end_matches('/') {
+        "." => "",
+        dir => dir,
+    };
+    let mut files: Vec<(String, Option<String>)> =
+        manifest::get_all_entries(conn, project_id, ref_name)?
+            .into_iter()
+            .filter(|entry| {
+                entry.path == path
+                    || entry.path.rsplit_once('/').map_or("", |(parent, _)| parent) == dir
+            })
+            .map(|entry| (entry.path, entry.language))
+            .collect();
+    if files.is_empty() {
+        anyhow::bail!(
+            "No indexed files found for path '{}' on ref '{}'. Verify the path and ensure the project is indexed.",
+            path,
+            ref_name
+        );
+    }
+    files.sort();
+
+    let mut rendered = Vec::new();
+    for (file, language) in &files {
+        let language = language
+            .clone()
+            .or_else(|| scanner::detect_language(Path::new(file)))
+            .unwrap_or_default();
+        let content = std::fs::read_to_string(workspace.join(file))
+            .with_context(|| format!("Failed to read {file}"))?;
+        if let Some(skeleton) = skeleton::skeleton_source(&content, &language) {
+            rendered.push((file, skeleton));
+        }
+    }
+    match rendered.as_slice() {
+        [] => anyhow::bail!("No source files with a supported grammar in '{}'.", path),
+        [(_, skeleton)] => print!("{skeleton}"),
+        _ => {
+            for (idx, (file, skeleton)) in rendered.iter().enumerate() {
+                if idx > 0 {
+                    println!();
+                }
+                println!("==> {file} <==");
+                print!("{skeleton}");
+            }
+        }
+    }
+    Ok(())
+}
+
+fn print_symbols(symbols: &[OutlineSymbol], indent: usize) {
+    for symbol in symbols {
+        let label = format!("{}{} {}", "  ".repeat(indent), symbol.kind, symbol.name);
+        println!("{:<60} {}-{}", label, symbol.line_start, symbol.line_end);
+        print_symbols(&symbol.children, indent + 1);
+    }
+}
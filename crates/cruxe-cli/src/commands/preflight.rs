@@ -0,0 +1,153 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_indexer::preflight::{self, FileStatus, PreflightReport};
+use std::path::Path;
+
+use crate::style;
+
+/// Left-out files listed in text output; JSON lists them all.
+const LISTED_LEFT_OUT: usize = 50;
+
+/// `cruxe preflight`: what `cruxe index` would cover, and why files are
+/// left out. With `explain`, only the status of those files is printed.
+pub fn run(
+    workspace: &Path,
+    explain: &[String],
+    respect_ignore_files: bool,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config =
+        Config::load_with_file(Some(&workspace), config_file).context("Invalid configuration")?;
+    let scope = super::scope::path_scope(&config, &workspace)?;
+    let report = preflight::run(&workspace, &config.index, &scope, respect_ignore_files);
+
+    if !explain.is_empty() {
+        return explain_files(&workspace, &report, explain);
+    }
+    super::render::render_records(format, &report, &report.left_out, print_report)
+}
+
+fn explain_files(workspace: &Path, report: &PreflightReport, files: &[String]) -> Result<()> {
+    let style = style::current();
+    for file in files {
+        // Accept paths relative to the current directory as well.
+        let relative = std::fs::canonicalize(file)
+            .ok()
+            .and_then(|path| {
+                path.strip_prefix(workspace)
+                    .ok()
+                    .map(|path| path.to_string_lossy().replace('\\', "/"))
+            })
+            .unwrap_or_else(|| file.clone());
+        let status = match report.status_of(&relative) {
+            Some(FileStatus::Indexed(language)) => format!("indexed as {language}"),
+            Some(FileStatus::LeftOut(left_out)) => match &left_out.detail {
+                Some(detail) => format!("left out: {} ({})", left_out.reason.as_str(), detail),
+                None => format!("left out: {}", left_out.reason.as_str()),
+            },
+            None => "not a file in the workspace".to_string(),
+        };
+        println!("{}  {}", style.path(&relative), status);
+    }
+    Ok(())
+}
+
+fn print_report(report: &PreflightReport) {
+    let style = style::current();
+    println!(
+        "{}",
+        style.heading(&format!(
+            "Would index {} file(s), {} in {} language(s)",
+            report.files,
+            format_size(report.bytes),
+            report.languages.len()
+        ))
+    );
+    if !report.languages.is_empty() {
+        println!();
+        println!(
+            "{:<12} {:>8} {:>10} {:>12}",
+            "LANGUAGE", "FILES", "LINES", "SIZE"
+        );
+        for (language, summary) in &report.languages {
+            println!(
+                "{:<12} {:>8} {:>10} {:>12}",
+                language,
+                summary.files,
+                summary.lines,
+                format_size(summary.bytes)
+            );
+        }
+    }
+
+    if !report.encodings.is_empty() {
+        let counts: Vec<String> = report
+            .encodings
+            .iter()
+            .map(|(encoding, count)| format!("{count} {encoding}"))
+            .collect();
+        println!();
+        println!("Transcoded to UTF-8: {}", counts.join(", "));
+    }
+
+    if !report.left_out.is_empty() {
+        let counts: Vec<String> = report
+            .left_out_counts
+            .iter()
+            .map(|(reason, count)| format!("{count} {reason}"))
+            .collect();
+        println!();
+        println!(
+            "{}",
+            style.heading(&format!("Left out: {}", counts.join(", ")))
+        );
+        // Files without a known language are rarely the ones looked for.
+        let listed: Vec<_> = report
+            .left_out
+            .iter()
+            .filter(|file| file.reason != preflight::LeftOutReason::Unsupported)
+            .collect();
+        for file in listed.iter().take(LISTED_LEFT_OUT) {
+            println!(
+                "  {} {}{}",
+                style.kind(&style::pad(file.reason.as_str(), 17)),
+                style.path(&file.path),
+                file.detail
+                    .as_deref()
+                    .map(|detail| style.muted(&format!(" ({detail})")))
+                    .unwrap_or_default()
+            );
+        }
+        if listed.len() > LISTED_LEFT_OUT {
+            println!(
+                "  {}",
+                style.muted(&format!(
+                    "... and {} more; --format json lists them all",
+                    listed.len() - LISTED_LEFT_OUT
+                ))
+            );
+        }
+    }
+
+    println!();
+    println!(
+        "Estimated index: about {}, built in about {:.0}s {}",
+        format_size(report.estimate.index_bytes),
+        report.estimate.seconds.ceil(),
+        style.muted("(rough; `cruxe bench` measures this machine)")
+    );
+    for warning in &report.warnings {
+        eprintln!("warning: {}", warning);
+    }
+}
+
+fn format_size(bytes: u64) -> String {
+    const MIB: f64 = 1024.0 * 1024.0;
+    if bytes >= 1024 * 1024 {
+        format!("{:.1} MiB", bytes as f64 / MIB)
+    } else {
+        format!("{:.1} KiB", bytes as f64 / 1024.0)
+    }
+}
@@ -0,0 +1,79 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::projects::{self, ProjectReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe projects`: the project roots of a monorepo found at index time,
+/// with the files and symbols each owns.
+pub fn run(
+    workspace: &Path,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let report = projects::list_projects(&conn, &project_id, &resolved_ref)
+        .map_err(|e| anyhow::anyhow!("Listing projects failed: {}", e))?;
+    super::render::render_records(format, &report, &report.projects, print_report)
+}
+
+fn print_report(report: &ProjectReport) {
+    if report.projects.is_empty() {
+        println!(
+            "No projects recorded on ref {}. Run `cruxe index` to discover them.",
+            report.ref_name
+        );
+        return;
+    }
+    println!(
+        "{:<30} {:<6} {:<40} {:>7} {:>8}  LANGUAGES",
+        "PROJECT", "KIND", "DIRECTORY", "FILES", "SYMBOLS"
+    );
+    for summary in &report.projects {
+        let dir = if summary.project.dir.is_empty() {
+            "."
+        } else {
+            summary.project.dir.as_str()
+        };
+        let languages: Vec<String> = summary
+            .languages
+            .iter()
+            .map(|(language, files)| format!("{language} {files}"))
+            .collect();
+        println!(
+            "{:<30} {:<6} {:<40} {:>7} {:>8}  {}",
+            summary.project.name,
+            summary.project.kind,
+            dir,
+            summary.files,
+            summary.symbols,
+            languages.join(", ")
+        );
+    }
+    println!();
+    println!(
+        "{} project(s) on ref {}, {} file(s) outside any project",
+        report.total, report.ref_name, report.unowned_files
+    );
+}
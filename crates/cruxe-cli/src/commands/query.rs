@@ -0,0 +1,427 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::call_graph::{
+    self, CallGraphDirection, CallGraphEdgeResult, CallGraphError, CallGraphRequest,
+};
+use cruxe_query::codeowners::{self, CodeOwners};
+use cruxe_query::explain_plan::{self, CallGraphExplain, SearchExplain};
+use cruxe_query::fuzzy::SymbolFilter;
+use cruxe_query::graph_export;
+use cruxe_query::query_expr::{self, EdgeRow, QueryExpr, QueryMatches, SymbolRow};
+use cruxe_state::{
+    db, generated_files, project, submodules, symbol_blame, tantivy_index::IndexSet,
+};
+use rusqlite::Connection;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+struct QueryContext {
+    repo_root: PathBuf,
+    config: Config,
+    project_id: String,
+    data_dir: PathBuf,
+    conn: Connection,
+    resolved_ref: String,
+}
+
+fn open(repo_root: &Path, r#ref: Option<&str>, config_file: Option<&Path>) -> Result<QueryContext> {
+    let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
+    let repo_root_str = repo_root.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&repo_root), config_file)?;
+    let project_id = generate_project_id(&repo_root_str);
+    let data_dir = config.project_data_dir(&project_id);
+    let conn = db::open_for_query(
+        &data_dir.join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &repo_root_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&repo_root, r#ref, &proj.default_ref);
+    Ok(QueryContext {
+        repo_root,
+        config,
+        project_id,
+        data_dir,
+        conn,
+        resolved_ref,
+    })
+}
+
+/// `cruxe query search`: run the search, or with `explain` print its plan.
+#[allow(clippy::too_many_arguments)]
+pub fn search(
+    repo_root: &Path,
+    query: &str,
+    r#ref: Option<&str>,
+    language: Option<&str>,
+    limit: usize,
+    explain: bool,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    if !explain {
+        let filter = SymbolFilter {
+            language: language.map(str::to_string),
+            ..SymbolFilter::default()
+        };
+        return super::search::run(repo_root, query, r#ref, &filter, limit, format, config_file);
+    }
+
+    let ctx = open(repo_root, r#ref, config_file)?;
+    let index_set = IndexSet::open_existing(&ctx.data_dir)
+        .map_err(|e| anyhow::anyhow!("Failed to open indices: {}. Run `cruxe index` first.", e))?;
+    let explain = explain_plan::explain_search(
+        &index_set,
+        Some(&ctx.conn),
+        query,
+        Some(&ctx.resolved_ref),
+        language,
+        limit,
+        &ctx.config.search,
+    )
+    .map_err(|e| anyhow::anyhow!("Explain failed: {}", e))?;
+    print_search_explain(&explain);
+    Ok(())
+}
+
+/// `cruxe query call-graph`: walk callers/callees of a symbol, or with
+/// `explain` print the traversal estimate.
+#[allow(clippy::too_many_arguments)]
+pub fn call_graph(
+    repo_root: &Path,
+    symbol: &str,
+    path: Option<&str>,
+    direction: &str,
+    depth: u32,
+    limit: usize,
+    r#ref: Option<&str>,
+    explain: bool,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let direction = CallGraphDirection::parse(direction)
+        .ok_or_else(|| anyhow::anyhow!("Unsupported direction: {direction}"))?;
+    let ctx = open(repo_root, r#ref, config_file)?;
+    let request = CallGraphRequest {
+        symbol_name: symbol,
+        path,
+        direction,
+        depth,
+        limit,
+    };
+    let not_found = |e: CallGraphError| match e {
+        CallGraphError::SymbolNotFound => {
+            anyhow::anyhow!("Symbol `{symbol}` not found in ref {}", ctx.resolved_ref)
+        }
+        CallGraphError::State(e) => anyhow::anyhow!("Call graph failed: {}", e),
+    };
+
+    if explain {
+        let explain = explain_plan::explain_call_graph(
+            &ctx.conn,
+            &ctx.project_id,
+            &ctx.resolved_ref,
+            &request,
+        )
+        .map_err(not_found)?;
+        print_call_graph_explain(&explain);
+        return Ok(());
+    }
+
+    let graph = call_graph::get_call_graph(&ctx.conn, &ctx.project_id, &ctx.resolved_ref, &request)
+        .map_err(not_found)?;
+    let edges: Vec<&CallGraphEdgeResult> = graph.callers.iter().chain(&graph.callees).collect();
+    super::render::render_records(format, &graph, &edges, |graph| {
+        println!(
+            "Symbol: {} ({}:{})",
+            graph.symbol.qualified_name, graph.symbol.path, graph.symbol.line_start
+        );
+        println!(
+            "Edges: {} (depth {}{})",
+            graph.total_edges,
+            graph.depth_applied,
+            if graph.truncated { ", truncated" } else { "" }
+        );
+        print_edges("Callers", &graph.callers);
+        print_edges("Callees", &graph.callees);
+    })
+}
+
+/// CODEOWNERS with `[routing.teams]` applied; empty when there is no file,
+/// which is only worth a warning when `fields` are queried.
+fn load_owners(ctx: &QueryContext, expr: &QueryExpr, fields: &[&str]) -> Result<CodeOwners> {
+    let path = ctx.config.routing.codeowners.as_deref();
+    let owners = CodeOwners::load(&ctx.repo_root, path)
+        .with_context(|| format!("Failed to read CODEOWNERS {}", path.unwrap_or_default()))?;
+    let owners = owners.unwrap_or_else(|| {
+        if fields.iter().any(|field| expr.uses(field)) {
+            eprintln!("warning: no CODEOWNERS file found; every symbol is unowned");
+        }
+        CodeOwners::default()
+    });
+    Ok(owners.with_teams(&ctx.config.routing.teams))
+}
+
+/// `cruxe query symbols`: symbols matching a query expression, optionally
+/// in one section per CODEOWNERS owner.
+#[allow(clippy::too_many_arguments)]
+pub fn symbols(
+    repo_root: &Path,
+    expr: &str,
+    limit: usize,
+    by_owner: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let expr = QueryExpr::parse(expr, &query_expr::SYMBOL_FIELDS)
+        .map_err(|e| anyhow::anyhow!("Invalid query: {e}"))?;
+    let ctx = open(repo_root, r#ref, config_file)?;
+    let snapshot =
+        graph_export::load_graph_snapshot(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    let owners = load_owners(&ctx, &expr, &["owner", "unowned"])?;
+    let submodules = submodules::list_for_ref(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    let generated = generated_files::paths_for_ref(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    let blame = symbol_blame::list_for_ref(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    if blame.is_empty() && (expr.uses("author") || expr.uses("age")) {
+        eprintln!(
+            "warning: ref `{}` was indexed without blame; set `[index] blame = true` and run `cruxe index --force`",
+            ctx.resolved_ref
+        );
+    }
+    let matches = query_expr::query_symbols(
+        &snapshot,
+        &owners,
+        &submodules,
+        &generated,
+        &blame,
+        &expr,
+        limit,
+    );
+    super::render::render_records(format, &matches, &matches.matches, |matches| {
+        if by_owner {
+            for (owner, rows) in group_by_owner(&matches.matches) {
+                println!("## {} ({})", owner, rows.len());
+                print_symbol_rows(&rows);
+                println!();
+            }
+        } else {
+            print_symbol_rows(&matches.matches.iter().collect::<Vec<_>>());
+        }
+        print_totals(matches);
+    })
+}
+
+/// Rows per owner, in owner order; a row with several owners is listed
+/// under each.
+fn group_by_owner(rows: &[SymbolRow]) -> BTreeMap<&str, Vec<&SymbolRow>> {
+    let mut grouped: BTreeMap<&str, Vec<&SymbolRow>> = BTreeMap::new();
+    for row in rows {
+        if row.owners.is_empty() {
+            grouped.entry(codeowners::UNOWNED).or_default().push(row);
+        }
+        for owner in &row.owners {
+            grouped.entry(owner.as_str()).or_default().push(row);
+        }
+    }
+    grouped
+}
+
+fn print_symbol_rows(rows: &[&SymbolRow]) {
+    println!(
+        "{:<8} {:<6} {:<6} {:<50} LOCATION",
+        "KIND", "IN", "OUT", "SYMBOL"
+    );
+    println!("{}", "-".repeat(100));
+    for row in rows {
+        let mut origin = row
+            .submodule
+            .as_deref()
+            .map(|name| format!(" [{name}]"))
+            .unwrap_or_default();
+        if let Some(change) = &row.last_change {
+            origin.push_str(&format!("  ({}, {}d ago)", change.author, change.age_days));
+        }
+        println!(
+            "{:<8} {:<6} {:<6} {:<50} {}:{}{}",
+            row.node.kind,
+            row.fan_in,
+            row.fan_out,
+            row.node.qualified_name,
+            row.node.path,
+            row.node.line_start,
+            origin
+        );
+    }
+}
+
+/// `cruxe query edges`: graph edges matching a query expression.
+pub fn edges(
+    repo_root: &Path,
+    expr: &str,
+    limit: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let expr = QueryExpr::parse(expr, &query_expr::EDGE_FIELDS)
+        .map_err(|e| anyhow::anyhow!("Invalid query: {e}"))?;
+    let ctx = open(repo_root, r#ref, config_file)?;
+    let snapshot =
+        graph_export::load_graph_snapshot(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    let owners = load_owners(&ctx, &expr, &["from.owner", "to.owner"])?;
+    let submodules = submodules::list_for_ref(&ctx.conn, &ctx.project_id, &ctx.resolved_ref)?;
+    let matches = query_expr::query_edges(&snapshot, &owners, &submodules, &expr, limit);
+    super::render::render_records(format, &matches, &matches.matches, |matches| {
+        for row in &matches.matches {
+            print_edge_row(row);
+        }
+        print_totals(matches);
+    })
+}
+
+fn print_edge_row(row: &EdgeRow) {
+    let site = match (&row.edge.file, row.edge.line) {
+        (Some(file), Some(line)) => format!("  ({file}:{line})"),
+        (Some(file), None) => format!("  ({file})"),
+        _ => String::new(),
+    };
+    println!(
+        "{} -[{}]-> {}{}",
+        row.from.qualified_name, row.edge.kind, row.to.qualified_name, site
+    );
+}
+
+fn print_totals<T>(matches: &QueryMatches<T>) {
+    println!();
+    if matches.truncated {
+        println!(
+            "{} of {} match(es) on ref {} (raise --limit for more)",
+            matches.matches.len(),
+            matches.total,
+            matches.ref_name
+        );
+    } else {
+        println!("{} match(es) on ref {}", matches.total, matches.ref_name);
+    }
+}
+
+fn print_edges(title: &str, edges: &[CallGraphEdgeResult]) {
+    if edges.is_empty() {
+        return;
+    }
+    println!();
+    println!("{title}:");
+    println!("{:<6} {:<40} {:<40}", "DEPTH", "SYMBOL", "CALL SITE");
+    println!("{}", "-".repeat(88));
+    for edge in edges {
+        println!(
+            "{:<6} {:<40} {:<40}",
+            edge.depth,
+            edge.symbol.qualified_name,
+            format!("{}:{}", edge.call_site.file, edge.call_site.line),
+        );
+    }
+}
+
+fn print_search_explain(explain: &SearchExplain) {
+    println!("Query: {}", explain.query);
+    println!(
+        "Ref: {}{}",
+        explain.ref_name,
+        explain
+            .language
+            .as_deref()
+            .map(|lang| format!(" (language {lang})"))
+            .unwrap_or_default()
+    );
+    println!(
+        "Intent: {:?} (confidence {:.2})",
+        explain.intent, explain.intent_confidence
+    );
+    println!(
+        "Semantic runtime: {}",
+        if explain.semantic_runtime_available {
+            "available"
+        } else {
+            "unavailable"
+        }
+    );
+    println!();
+
+    println!(
+        "{:<10} {:<6} {:<8} {:<12} {:<8}",
+        "INDEX", "USED", "WEIGHT", "DOCUMENTS", "FETCH"
+    );
+    println!("{}", "-".repeat(48));
+    for scan in &explain.indexes {
+        println!(
+            "{:<10} {:<6} {:<8.1} {:<12} {:<8}",
+            scan.index,
+            if scan.used { "yes" } else { "no" },
+            scan.weight,
+            scan.documents,
+            scan.fetch_limit,
+        );
+    }
+    println!();
+
+    println!("Plans (limit {}):", explain.limit);
+    for candidate in &explain.plans {
+        println!(
+            "  {} [{}] when {}: lexical fanout {}, semantic limit {}, semantic fanout {}, budget {} ms",
+            candidate.plan,
+            candidate.reason,
+            candidate.when,
+            candidate.lexical_fanout,
+            candidate.semantic_limit,
+            candidate.semantic_fanout,
+            candidate.latency_budget_ms,
+        );
+    }
+}
+
+fn print_call_graph_explain(explain: &CallGraphExplain) {
+    println!("Symbol: {} ({})", explain.qualified_name, explain.path);
+    let clamped = if explain.depth_applied != explain.depth_requested {
+        format!(
+            " (requested {}, clamped to 1..={})",
+            explain.depth_requested, explain.max_depth
+        )
+    } else {
+        String::new()
+    };
+    println!("Depth: {}{}", explain.depth_applied, clamped);
+    println!("Limit: {} edges per direction", explain.limit);
+
+    for direction in &explain.directions {
+        println!();
+        println!(
+            "{}: ~{} edges{}",
+            direction.direction,
+            direction.estimated_edges,
+            if direction.truncated_by_limit {
+                ", stops at the limit"
+            } else {
+                ""
+            }
+        );
+        println!(
+            "{:<6} {:<10} {:<8} {:<12}",
+            "DEPTH", "FRONTIER", "EDGES", "NEW SYMBOLS"
+        );
+        println!("{}", "-".repeat(38));
+        for level in &direction.levels {
+            println!(
+                "{:<6} {:<10} {:<8} {:<12}",
+                level.depth, level.frontier, level.edges, level.new_symbols
+            );
+        }
+    }
+}
@@ -0,0 +1,156 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::languages;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::ref_sites::{self, RefKind, ReferenceSite, ReferenceSites};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+use crate::style::{self, Style};
+
+/// `cruxe refs <symbol>`: every occurrence of the symbol with its position,
+/// reference kind and enclosing symbol.
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    kinds: Option<&str>,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let kinds = parse_kinds(kinds.unwrap_or_default())?;
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let sites = ref_sites::find_reference_sites(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        symbol,
+        &kinds,
+    )
+    .map_err(|e| anyhow::anyhow!("Reference lookup failed: {}", e))?;
+
+    super::render::render_records(format, &sites, &sites.references, print_sites)
+}
+
+pub fn parse_kinds(spec: &str) -> Result<Vec<RefKind>> {
+    spec.split(',')
+        .map(str::trim)
+        .filter(|token| !token.is_empty())
+        .map(|token| {
+            RefKind::parse(token).ok_or_else(|| {
+                let known: Vec<&str> = RefKind::ALL.iter().map(RefKind::as_str).collect();
+                anyhow::anyhow!(
+                    "Unknown reference kind `{}` (expected one of: {})",
+                    token,
+                    known.join(", ")
+                )
+            })
+        })
+        .collect()
+}
+
+fn print_sites(sites: &ReferenceSites) {
+    if sites.references.is_empty() {
+        println!("No references to `{}` found.", sites.symbol);
+        return;
+    }
+    let style = style::current();
+    println!(
+        "{}",
+        style.heading(&format!(
+            "{} reference(s) to `{}` ({} indexed definition(s))",
+            sites.references.len(),
+            sites.symbol,
+            sites.definitions
+        ))
+    );
+    println!();
+    if style.plain {
+        print_plain(sites);
+    } else {
+        print_rich(sites, &style);
+    }
+    if sites
+        .references
+        .iter()
+        .any(|site| site.kind == RefKind::Call && !site.resolved)
+    {
+        println!();
+        println!("call? = name match without a call edge resolved to this symbol");
+    }
+}
+
+fn print_plain(sites: &ReferenceSites) {
+    println!("{:<50} {:<11} {:<30} TEXT", "LOCATION", "KIND", "ENCLOSING");
+    println!("{}", "-".repeat(100));
+    for site in &sites.references {
+        println!(
+            "{:<50} {:<11} {:<30} {}",
+            location(site),
+            kind(site),
+            enclosing(site),
+            site.text
+        );
+    }
+}
+
+/// Columns sized to the sites, with the source line highlighted.
+fn print_rich(sites: &ReferenceSites, style: &Style) {
+    let locations: Vec<String> = sites.references.iter().map(location).collect();
+    let location_width = style::column_width(locations.iter().map(String::as_str), 8, 60);
+    let kind_width = style::column_width(sites.references.iter().map(kind), 4, 11);
+    let enclosing_width = style::column_width(sites.references.iter().map(enclosing), 4, 40);
+    for (site, location) in sites.references.iter().zip(&locations) {
+        let language = Path::new(&site.path)
+            .extension()
+            .and_then(|ext| ext.to_str())
+            .and_then(languages::detect_language_from_extension)
+            .unwrap_or_default();
+        println!(
+            "{} {} {} {}",
+            style.path(&style::pad(location, location_width)),
+            style.kind(&style::pad(kind(site), kind_width)),
+            style.name(&style::pad(enclosing(site), enclosing_width)),
+            style.code(&site.text, language)
+        );
+    }
+}
+
+fn location(site: &ReferenceSite) -> String {
+    format!("{}:{}:{}", site.path, site.line, site.column)
+}
+
+fn kind(site: &ReferenceSite) -> &str {
+    if site.kind == RefKind::Call && !site.resolved {
+        "call?"
+    } else {
+        site.kind.as_str()
+    }
+}
+
+fn enclosing(site: &ReferenceSite) -> &str {
+    site.enclosing
+        .as_ref()
+        .map(|enclosing| enclosing.qualified_name.as_str())
+        .unwrap_or("-")
+}
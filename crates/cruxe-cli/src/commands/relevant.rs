@@ -0,0 +1,57 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::relevant::{self, RelevantOptions};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe relevant --task <text>`: files and symbols to read for a task,
+/// from the symbols matching its words (and meaning, once `cruxe embed` has
+/// run) and their callers and callees. Only files in scope are listed.
+pub fn run(
+    workspace: &Path,
+    task: &str,
+    limit: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let options = RelevantOptions {
+        limit,
+        scope: super::scope::path_scope(&config, &workspace)?,
+    };
+    let report = relevant::find_relevant(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        task,
+        &config.search,
+        &options,
+    )
+    .map_err(|e| anyhow::anyhow!("Relevance ranking failed: {}", e))?;
+
+    super::render::render_records(format, &report, &report.symbols, |report| {
+        print!("{}", relevant::render_text(report));
+    })
+}
@@ -0,0 +1,87 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::{self, Config};
+use cruxe_core::constants;
+use cruxe_core::time::now_iso8601;
+use cruxe_core::types::generate_project_id;
+use cruxe_state::remote_origins::{self, RemoteOrigin};
+use cruxe_state::{db, project, schema};
+use cruxe_vcs::RemoteSpec;
+use std::path::{Path, PathBuf};
+
+/// A shallow clone made for `cruxe index <url>`.
+pub struct RemoteCheckout {
+    /// Canonical path of the clone, the project root of its index.
+    pub path: PathBuf,
+    pub url: String,
+    /// Ref the clone was fetched at, which its index goes under.
+    pub ref_name: String,
+    pub commit: String,
+}
+
+/// Fetch `url[@ref]` with depth 1 into `<data_dir>/remotes/<host>/<path>`,
+/// reusing the clone of an earlier run, and initialize its project on
+/// first use. The clone is marked so that its own `.cruxe.yaml` and
+/// `.cruxe/config.toml` are never read; only the global config and
+/// `--config` apply to it.
+pub fn checkout(spec: &str, config_file: Option<&Path>) -> Result<RemoteCheckout> {
+    let Some(remote) = RemoteSpec::parse(spec) else {
+        anyhow::bail!("`{spec}` is not a repository URL; pass a local directory with --path");
+    };
+    let config = Config::load_with_file(None, config_file)?;
+    let dir = PathBuf::from(&config.storage.data_dir)
+        .join("remotes")
+        .join(remote.cache_path());
+    let url = remote.public_url();
+    println!("Fetching {url} ...");
+    let fetched = cruxe_vcs::fetch_shallow(&remote, &dir)
+        .map_err(|e| anyhow::anyhow!("Failed to fetch {url}: {e}"))?;
+    let path = std::fs::canonicalize(&dir).context("Failed to resolve clone path")?;
+    // The clone's own config could run plugins or load native grammars.
+    config::mark_remote_checkout(&path).context("Failed to mark the clone")?;
+
+    let path_str = path.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&path), config_file)?;
+    let data_dir = config.project_data_dir(&generate_project_id(&path_str));
+    std::fs::create_dir_all(&data_dir).context("Failed to create data directory")?;
+    let conn = db::open_connection(&data_dir.join(constants::STATE_DB_FILE))?;
+    schema::create_tables(&conn)?;
+    if project::get_by_root(&conn, &path_str)?.is_none() {
+        super::init::register(&conn, &path, &data_dir)?;
+    }
+
+    Ok(RemoteCheckout {
+        path,
+        url,
+        ref_name: fetched.ref_name,
+        commit: fetched.commit,
+    })
+}
+
+/// Tag the index of `checkout` with the URL and commit it came from.
+pub fn record_origin(checkout: &RemoteCheckout, config_file: Option<&Path>) -> Result<()> {
+    let project_id = generate_project_id(&checkout.path.to_string_lossy());
+    let config = Config::load_with_file(Some(&checkout.path), config_file)?;
+    let conn = db::open_connection(
+        &config
+            .project_data_dir(&project_id)
+            .join(constants::STATE_DB_FILE),
+    )?;
+    remote_origins::record(
+        &conn,
+        &project_id,
+        &checkout.ref_name,
+        &RemoteOrigin {
+            url: checkout.url.clone(),
+            commit: checkout.commit.clone(),
+            fetched_at: now_iso8601(),
+        },
+    )?;
+    println!(
+        "Indexed {}@{} ({}) at {}",
+        checkout.url,
+        checkout.ref_name,
+        &checkout.commit[..checkout.commit.len().min(12)],
+        checkout.path.display()
+    );
+    Ok(())
+}
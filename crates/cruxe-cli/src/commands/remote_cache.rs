@@ -0,0 +1,209 @@
+use crate::progress::ProgressMode;
+use anyhow::{Context, Result, bail};
+use cruxe_core::cancel::CancellationToken;
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_state::remote_cache::RemoteCache;
+use cruxe_state::{branch_state, db, export, project, schema};
+use std::path::Path;
+
+/// `cruxe state push`: upload the workspace's index to the remote cache,
+/// keyed by the commit it was built at.
+pub fn push(workspace: &Path, commit: Option<&str>, config_file: Option<&Path>) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let cache = configured_cache(&config)?;
+    let project_id = generate_project_id(&workspace_str);
+    let data_dir = config.project_data_dir(&project_id);
+    let conn = db::open_connection(&data_dir.join(constants::STATE_DB_FILE))?;
+    schema::create_tables(&conn)?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+
+    let commit = match commit {
+        Some(commit) => commit.to_string(),
+        None => {
+            let head = head_commit(&workspace)?;
+            // Indexes record a 12-character commit; a bundle keyed by HEAD
+            // must have been built at HEAD or pulls would trust stale rows.
+            let indexed = branch_state::get_branch_state(&conn, &project_id, &proj.default_ref)?
+                .map(|state| state.last_indexed_commit);
+            match indexed {
+                Some(indexed) if head.starts_with(&indexed) => head,
+                Some(indexed) => bail!(
+                    "Index of {} was built at {indexed}, not HEAD {head}. Run `cruxe index` first or pass --commit.",
+                    proj.default_ref
+                ),
+                None => bail!(
+                    "{} is not indexed. Run `cruxe index` first.",
+                    proj.default_ref
+                ),
+            }
+        }
+    };
+
+    let key = RemoteCache::object_key(&namespace(&config, &workspace), &commit);
+    let staging = tempfile::tempdir().context("Failed to create staging directory")?;
+    let bundle_path = staging.path().join("bundle.tar.zst");
+    let metadata = export::PortableStateMetadata::new(
+        proj.schema_version,
+        proj.parser_version,
+        proj.project_id,
+        workspace_str,
+    );
+    export::export_bundle(&data_dir, &bundle_path, &metadata)?;
+    cache
+        .upload(&key, &bundle_path)
+        .with_context(|| format!("Failed to upload {}", cache.location(&key)))?;
+
+    println!("Pushed index of {} to {}", commit, cache.location(&key));
+    Ok(())
+}
+
+/// `cruxe state pull`: import the cached index of the nearest ancestor of
+/// HEAD and bring it up to date with an incremental `cruxe index`.
+pub fn pull(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    cancel: &CancellationToken,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let cache = configured_cache(&config)?;
+    let Some(commit) = pull_nearest(&workspace, &config, &cache, config_file)? else {
+        bail!(
+            "No cached index for HEAD or its {} nearest ancestors",
+            config.remote_cache.max_ancestors.saturating_sub(1)
+        );
+    };
+    println!("Imported cached index of {commit}; updating to the working tree ...");
+    super::index::run(
+        &workspace,
+        false,
+        None,
+        config_file,
+        None,
+        None,
+        None,
+        None,
+        true,
+        false,
+        None,
+        ProgressMode::Auto,
+        cancel,
+    )
+}
+
+/// Before `cruxe query`: pull from the remote cache when one is configured
+/// and the workspace has no index yet. Falls through silently otherwise, so
+/// the query reports the missing index as usual.
+pub fn pull_if_missing(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    cancel: &CancellationToken,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    if config.remote_cache.url.is_none() || !config.remote_cache.pull_on_query {
+        return Ok(());
+    }
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    if db_path.exists() {
+        let conn = db::open_connection(&db_path)?;
+        schema::create_tables(&conn)?;
+        if let Some(proj) = project::get_by_root(&conn, &workspace_str)?
+            && branch_state::get_branch_state(&conn, &project_id, &proj.default_ref)?.is_some()
+        {
+            return Ok(());
+        }
+    }
+
+    let cache = configured_cache(&config)?;
+    match pull_nearest(&workspace, &config, &cache, config_file) {
+        Ok(Some(commit)) => {
+            eprintln!("No local index; pulled the cached index of {commit}");
+            super::index::run(
+                &workspace,
+                false,
+                None,
+                config_file,
+                None,
+                None,
+                None,
+                None,
+                true,
+                false,
+                None,
+                ProgressMode::Auto,
+                cancel,
+            )
+        }
+        Ok(None) => Ok(()),
+        Err(err) => {
+            eprintln!("warning: remote cache pull failed: {err:#}");
+            Ok(())
+        }
+    }
+}
+
+/// Download and import the bundle of the nearest cached ancestor of HEAD.
+fn pull_nearest(
+    workspace: &Path,
+    config: &Config,
+    cache: &RemoteCache,
+    config_file: Option<&Path>,
+) -> Result<Option<String>> {
+    let commits = vcs::list_ancestor_commits(workspace, config.remote_cache.max_ancestors)
+        .map_err(|e| anyhow::anyhow!("Failed to list commits: {}", e))?;
+    let namespace = namespace(config, workspace);
+    let staging = tempfile::tempdir().context("Failed to create staging directory")?;
+    let bundle_path = staging.path().join("bundle.tar.zst");
+    for commit in commits {
+        let key = RemoteCache::object_key(&namespace, &commit);
+        if !cache
+            .download(&key, &bundle_path)
+            .with_context(|| format!("Failed to download {}", cache.location(&key)))?
+        {
+            continue;
+        }
+        super::state_import::import_into_workspace(workspace, &bundle_path, config_file, true)?;
+        return Ok(Some(commit));
+    }
+    Ok(None)
+}
+
+fn configured_cache(config: &Config) -> Result<RemoteCache> {
+    let Some(url) = config.remote_cache.url.as_deref() else {
+        bail!("No remote cache configured; set `url` under [remote_cache]");
+    };
+    let token = config
+        .remote_cache
+        .token_env
+        .as_deref()
+        .and_then(|var| std::env::var(var).ok());
+    Ok(RemoteCache::from_url(url, token))
+}
+
+fn namespace(config: &Config, workspace: &Path) -> String {
+    config.remote_cache.namespace.clone().unwrap_or_else(|| {
+        workspace
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+            .unwrap_or_else(|| "default".to_string())
+    })
+}
+
+fn head_commit(workspace: &Path) -> Result<String> {
+    vcs::list_ancestor_commits(workspace, 1)
+        .map_err(|e| anyhow::anyhow!("Failed to resolve HEAD: {}", e))?
+        .into_iter()
+        .next()
+        .ok_or_else(|| anyhow::anyhow!("Repository has no commits"))
+}
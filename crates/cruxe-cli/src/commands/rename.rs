@@ -0,0 +1,111 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::rename::{self, RenamePlan};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+use crate::style;
+
+/// `cruxe rename <symbol> <new-name>`: rewrite every indexed occurrence of a
+/// symbol, or print the change as a diff with `--dry-run`.
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    new_name: &str,
+    dry_run: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let plan = rename::plan_rename(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        symbol,
+        new_name,
+    )
+    .map_err(|e| anyhow::anyhow!("Rename failed: {}", e))?;
+
+    if !dry_run {
+        write_files(&workspace, &plan)?;
+    }
+    super::render::render_records(format, &plan, &plan.files, |plan| print_plan(plan, dry_run))
+}
+
+/// Write every planned file, after checking none changed since the plan was
+/// made so no edit lands on the wrong text.
+fn write_files(workspace: &Path, plan: &RenamePlan) -> Result<()> {
+    for file in &plan.files {
+        let path = workspace.join(&file.path);
+        let current = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", file.path))?;
+        if current != file.original {
+            anyhow::bail!(
+                "{} changed while planning the rename; nothing was written",
+                file.path
+            );
+        }
+    }
+    for file in &plan.files {
+        std::fs::write(workspace.join(&file.path), &file.updated)
+            .with_context(|| format!("Failed to write {}", file.path))?;
+    }
+    Ok(())
+}
+
+fn print_plan(plan: &RenamePlan, dry_run: bool) {
+    let style = style::current();
+    if dry_run {
+        for file in &plan.files {
+            print!("{}", file.diff);
+        }
+    } else {
+        for file in &plan.files {
+            println!(
+                "{}  {} occurrence(s)",
+                style.path(&file.path),
+                file.occurrences
+            );
+        }
+    }
+    for skipped in &plan.skipped {
+        eprintln!(
+            "skipped {}:{}:{}: {}",
+            skipped.path, skipped.line, skipped.column, skipped.reason
+        );
+    }
+    let summary = format!(
+        "{} `{}` to `{}`: {} occurrence(s) in {} file(s)",
+        if dry_run { "Would rename" } else { "Renamed" },
+        plan.symbol,
+        plan.new_name,
+        plan.occurrences,
+        plan.files.len()
+    );
+    eprintln!("{}", style.heading(&summary));
+    if !dry_run && !plan.files.is_empty() {
+        eprintln!("{}", style.muted("Run `cruxe sync` to update the index."));
+    }
+}
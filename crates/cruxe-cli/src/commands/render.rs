@@ -0,0 +1,36 @@
+use anyhow::Result;
+use serde::Serialize;
+use std::io::Write;
+
+/// Print a command's output in `format`: `json` pretty-prints `value`,
+/// `ndjson` writes it on one line, and anything else runs `text`.
+pub fn render<T: Serialize>(format: &str, value: &T, text: impl FnOnce(&T)) -> Result<()> {
+    render_records(format, value, std::slice::from_ref(value), text)
+}
+
+/// Like [`render`], but `ndjson` writes one line per element of `records`
+/// (the command's primary list) instead of the whole document, so results
+/// can be streamed through line-oriented tools.
+pub fn render_records<T: Serialize, R: Serialize>(
+    format: &str,
+    value: &T,
+    records: &[R],
+    text: impl FnOnce(&T),
+) -> Result<()> {
+    match format {
+        "json" => {
+            let mut stdout = std::io::stdout().lock();
+            serde_json::to_writer_pretty(&mut stdout, value)?;
+            writeln!(stdout)?;
+        }
+        "ndjson" => {
+            let mut stdout = std::io::stdout().lock();
+            for record in records {
+                serde_json::to_writer(&mut stdout, record)?;
+                writeln!(stdout)?;
+            }
+        }
+        _ => text(value),
+    }
+    Ok(())
+}
@@ -0,0 +1,75 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::aliases;
+use cruxe_query::graph_export;
+use cruxe_query::report::{self, ReportFormat, ReportOptions};
+use cruxe_state::{db, go_embeds, injections, project, schema};
+use std::path::Path;
+
+pub fn run(
+    workspace: &Path,
+    format: &str,
+    output: Option<&Path>,
+    top: usize,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let format = ReportFormat::parse(format)
+        .ok_or_else(|| anyhow::anyhow!("Unsupported report format: {format}"))?;
+
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let mut snapshot = graph_export::load_graph_snapshot(&conn, &project_id, &resolved_ref)?;
+    // Vendored and forked copies count as their canonical symbol, so callers
+    // of either copy keep both out of the dead-code list.
+    let folded = aliases::load_symbol_aliases(&conn, &project_id, &resolved_ref)?
+        .apply_to_snapshot(&mut snapshot);
+    if folded > 0 {
+        eprintln!("Folded {folded} content-identical copies into their canonical symbols");
+    }
+    let mut report = report::build_report(&snapshot, &ReportOptions { top });
+    let sql = injections::list_injections(&conn, &project_id, &resolved_ref, Some("sql"))?;
+    report.sql_tables = report::sql_table_usage(&sql, top);
+    let embeds = go_embeds::list_embeds(&conn, &project_id, &resolved_ref)?;
+    (report.embedded_assets, report.embedded_bytes_total) =
+        report::embedded_asset_usage(&embeds, top);
+    let rendered = match format {
+        ReportFormat::Markdown => report::render_markdown(&report),
+    };
+
+    match output {
+        Some(path) => {
+            std::fs::write(path, rendered)
+                .with_context(|| format!("Failed to write {}", path.display()))?;
+            eprintln!(
+                "Wrote {} report for {} symbols in {} packages to {}",
+                format.as_str(),
+                report.totals.symbols,
+                report.totals.packages,
+                path.display()
+            );
+        }
+        None => print!("{rendered}"),
+    }
+    Ok(())
+}
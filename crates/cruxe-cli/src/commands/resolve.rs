@@ -0,0 +1,62 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::symbol_ids::{self, ResolvedSymbol};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe resolve <id>`: where the symbol a canonical id names is defined.
+pub fn run(
+    workspace: &Path,
+    id: &str,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    if cruxe_core::canonical_id::split(id).is_none() {
+        anyhow::bail!(
+            "`{}` is not a symbol id; ids start with their language, e.g. `go example.com/api.Server.Handle`",
+            id
+        );
+    }
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let symbols = symbol_ids::resolve(&conn, &project_id, &resolved_ref, id)
+        .map_err(|e| anyhow::anyhow!("Symbol id lookup failed: {}", e))?;
+
+    super::render::render_records(format, &symbols, &symbols, |symbols| print_symbols(symbols))?;
+    if symbols.is_empty() {
+        anyhow::bail!("No symbol has id `{}` in ref `{}`", id.trim(), resolved_ref);
+    }
+    Ok(())
+}
+
+fn print_symbols(symbols: &[ResolvedSymbol]) {
+    for symbol in symbols {
+        println!(
+            "{}:{}-{}  {} {}",
+            symbol.path, symbol.line_start, symbol.line_end, symbol.kind, symbol.qualified_name
+        );
+        if let Some(signature) = &symbol.signature {
+            println!("    {}", signature);
+        }
+    }
+}
@@ -0,0 +1,82 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::call_graph::CallTreeNode;
+use cruxe_query::routes::{self, RouteOptions, RouteReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe routes`: HTTP routes with the handler each is bound to and the
+/// calls that handler makes.
+pub fn run(
+    workspace: &Path,
+    mut options: RouteOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    options.scope = super::scope::path_scope(&config, &workspace)?;
+
+    let report = routes::list_routes(&conn, &project_id, &resolved_ref, &options)
+        .map_err(|e| anyhow::anyhow!("Listing routes failed: {}", e))?;
+    super::render::render_records(format, &report, &report.routes, print_report)
+}
+
+fn print_report(report: &RouteReport) {
+    if report.routes.is_empty() {
+        println!("No HTTP routes on ref {}.", report.ref_name);
+        return;
+    }
+    for route in &report.routes {
+        let handler = match &route.handler_symbol {
+            Some(symbol) => format!(
+                "{} ({}:{})",
+                symbol.qualified_name, symbol.path, symbol.line_start
+            ),
+            None => format!("{} (unresolved)", route.handler),
+        };
+        println!("{:<7} {:<40} -> {}", route.method, route.route, handler);
+        println!(
+            "{:<7} {:<40}    registered at {}:{} [{}]",
+            "", "", route.path, route.line, route.framework
+        );
+        print_callees(&route.callees, 1);
+    }
+    println!();
+    println!(
+        "{} route(s) on ref {}, {} with a resolved handler",
+        report.total, report.ref_name, report.resolved
+    );
+}
+
+fn print_callees(nodes: &[CallTreeNode], level: usize) {
+    for node in nodes {
+        println!(
+            "{:indent$}{}{}",
+            "",
+            node.symbol.qualified_name,
+            if node.repeated { " (repeated)" } else { "" },
+            indent = 8 + level * 2
+        );
+        print_callees(&node.children, level + 1);
+    }
+}
@@ -0,0 +1,303 @@
+use anyhow::Result;
+use cruxe_indexer::preflight::{LeftOutFile, PreflightReport};
+use cruxe_query::api_surface::{ApiChange, ApiDiff, ApiItem, ApiSurface};
+use cruxe_query::arch_rules::{ArchReport, ArchViolation};
+use cruxe_query::call_graph::{CallGraphEdgeResult, CallGraphResult, CallTree, CallTreeNode};
+use cruxe_query::changed::{ChangedPackage, ChangedReport};
+use cruxe_query::concurrency::{ConcurrencyReport, ConcurrencySite};
+use cruxe_query::deadcode::{DeadCodeReport, DeadSymbol};
+use cruxe_query::deps::{DepsEdge, DepsGraph};
+use cruxe_query::describe::SymbolCard;
+use cruxe_query::doc_coverage::{DocCoverageReport, UndocumentedSymbol};
+use cruxe_query::duplicates::{DuplicateCluster, DuplicateReport};
+use cruxe_query::error_paths::{ErrorPath, ErrorReport};
+use cruxe_query::exits::{ExitPath, ExitReport};
+use cruxe_query::findings::Finding;
+use cruxe_query::goto_definition::{DefinitionHit, DefinitionLookup};
+use cruxe_query::grep::{GrepMatch, GrepResults};
+use cruxe_query::hotspots::{Hotspot, HotspotReport};
+use cruxe_query::impact::{ImpactReport, ImpactedSymbol};
+use cruxe_query::impls::{Implementation, ImplsReport};
+use cruxe_query::precommit::{HookReport, HookViolation};
+use cruxe_query::projects::{ProjectReport, ProjectSummary};
+use cruxe_query::query_expr::{EdgeRow, QueryMatches, SymbolRow};
+use cruxe_query::ref_sites::{ReferenceSite, ReferenceSites};
+use cruxe_query::relevant::{RelevantReport, RelevantSymbol};
+use cruxe_query::rename::{FileRename, RenamePlan};
+use cruxe_query::repo_map::{MapFile, RepoMap};
+use cruxe_query::routes::{Route, RouteReport};
+use cruxe_query::search::{SearchResponse, SearchResult};
+use cruxe_query::snippet::Snippet;
+use cruxe_query::stats::RepoStats;
+use cruxe_query::symbol_diff::{SymbolChange, SymbolDiff};
+use cruxe_query::symbol_ids::ResolvedSymbol;
+use cruxe_query::templates::TemplateIssue;
+use cruxe_query::test_map::{CoveringTest, TestsFor};
+use cruxe_query::todos::{TodoItem, TodoReport};
+use cruxe_query::where_used::{LiteralSite, WhereUsedReport};
+use cruxe_state::symbols::OutlineSymbol;
+use schemars::{JsonSchema, Schema};
+
+/// The output types behind one command's `--format`: `document` is what
+/// `json` prints, `record` what each `ndjson` line holds.
+struct OutputSchema {
+    command: &'static str,
+    document: fn() -> Schema,
+    record: fn() -> Schema,
+}
+
+fn schema<T: JsonSchema>() -> Schema {
+    schemars::schema_for!(T)
+}
+
+const OUTPUT_SCHEMAS: &[OutputSchema] = &[
+    OutputSchema {
+        command: "search",
+        document: schema::<SearchResponse>,
+        record: schema::<SearchResult>,
+    },
+    OutputSchema {
+        command: "refs",
+        document: schema::<ReferenceSites>,
+        record: schema::<ReferenceSite>,
+    },
+    OutputSchema {
+        command: "def",
+        document: schema::<DefinitionLookup>,
+        record: schema::<DefinitionHit>,
+    },
+    OutputSchema {
+        command: "resolve",
+        document: schema::<Vec<ResolvedSymbol>>,
+        record: schema::<ResolvedSymbol>,
+    },
+    OutputSchema {
+        command: "rename",
+        document: schema::<RenamePlan>,
+        record: schema::<FileRename>,
+    },
+    OutputSchema {
+        command: "callers",
+        document: schema::<CallTree>,
+        record: schema::<CallTreeNode>,
+    },
+    OutputSchema {
+        command: "callees",
+        document: schema::<CallTree>,
+        record: schema::<CallTreeNode>,
+    },
+    OutputSchema {
+        command: "impact",
+        document: schema::<ImpactReport>,
+        record: schema::<ImpactedSymbol>,
+    },
+    OutputSchema {
+        command: "changed",
+        document: schema::<ChangedReport>,
+        record: schema::<ChangedPackage>,
+    },
+    OutputSchema {
+        command: "impls",
+        document: schema::<ImplsReport>,
+        record: schema::<Implementation>,
+    },
+    OutputSchema {
+        command: "tests-for",
+        document: schema::<TestsFor>,
+        record: schema::<CoveringTest>,
+    },
+    OutputSchema {
+        command: "outline",
+        document: schema::<super::outline::Outline>,
+        record: schema::<OutlineSymbol>,
+    },
+    OutputSchema {
+        command: "deps",
+        document: schema::<DepsGraph>,
+        record: schema::<DepsEdge>,
+    },
+    OutputSchema {
+        command: "deadcode",
+        document: schema::<DeadCodeReport>,
+        record: schema::<DeadSymbol>,
+    },
+    OutputSchema {
+        command: "duplicates",
+        document: schema::<DuplicateReport>,
+        record: schema::<DuplicateCluster>,
+    },
+    OutputSchema {
+        command: "hotspots",
+        document: schema::<HotspotReport>,
+        record: schema::<Hotspot>,
+    },
+    OutputSchema {
+        command: "lint-arch",
+        document: schema::<ArchReport>,
+        record: schema::<ArchViolation>,
+    },
+    OutputSchema {
+        command: "doc-coverage",
+        document: schema::<DocCoverageReport>,
+        record: schema::<UndocumentedSymbol>,
+    },
+    OutputSchema {
+        command: "todos",
+        document: schema::<TodoReport>,
+        record: schema::<TodoItem>,
+    },
+    OutputSchema {
+        command: "errors",
+        document: schema::<ErrorReport>,
+        record: schema::<ErrorPath>,
+    },
+    OutputSchema {
+        command: "exits",
+        document: schema::<ExitReport>,
+        record: schema::<ExitPath>,
+    },
+    OutputSchema {
+        command: "concurrency",
+        document: schema::<ConcurrencyReport>,
+        record: schema::<ConcurrencySite>,
+    },
+    OutputSchema {
+        command: "routes",
+        document: schema::<RouteReport>,
+        record: schema::<Route>,
+    },
+    OutputSchema {
+        command: "where-used",
+        document: schema::<WhereUsedReport>,
+        record: schema::<LiteralSite>,
+    },
+    OutputSchema {
+        command: "projects",
+        document: schema::<ProjectReport>,
+        record: schema::<ProjectSummary>,
+    },
+    OutputSchema {
+        command: "preflight",
+        document: schema::<PreflightReport>,
+        record: schema::<LeftOutFile>,
+    },
+    OutputSchema {
+        command: "bench",
+        document: schema::<super::bench::Bench>,
+        record: schema::<super::bench::Bench>,
+    },
+    OutputSchema {
+        command: "diff",
+        document: schema::<SymbolDiff>,
+        record: schema::<SymbolChange>,
+    },
+    OutputSchema {
+        command: "api",
+        document: schema::<ApiSurface>,
+        record: schema::<ApiItem>,
+    },
+    OutputSchema {
+        command: "api diff",
+        document: schema::<ApiDiff>,
+        record: schema::<ApiChange>,
+    },
+    OutputSchema {
+        command: "describe",
+        document: schema::<SymbolCard>,
+        record: schema::<SymbolCard>,
+    },
+    OutputSchema {
+        command: "grep",
+        document: schema::<GrepResults>,
+        record: schema::<GrepMatch>,
+    },
+    OutputSchema {
+        command: "stats",
+        document: schema::<RepoStats>,
+        record: schema::<RepoStats>,
+    },
+    OutputSchema {
+        command: "map",
+        document: schema::<RepoMap>,
+        record: schema::<MapFile>,
+    },
+    OutputSchema {
+        command: "relevant",
+        document: schema::<RelevantReport>,
+        record: schema::<RelevantSymbol>,
+    },
+    OutputSchema {
+        command: "snippet",
+        document: schema::<Snippet>,
+        record: schema::<Snippet>,
+    },
+    OutputSchema {
+        command: "templates",
+        document: schema::<super::templates::Templates>,
+        record: schema::<TemplateIssue>,
+    },
+    OutputSchema {
+        command: "check",
+        document: schema::<Vec<Finding>>,
+        record: schema::<Finding>,
+    },
+    OutputSchema {
+        command: "finding show",
+        document: schema::<Finding>,
+        record: schema::<Finding>,
+    },
+    OutputSchema {
+        command: "query search",
+        document: schema::<SearchResponse>,
+        record: schema::<SearchResult>,
+    },
+    OutputSchema {
+        command: "query call-graph",
+        document: schema::<CallGraphResult>,
+        record: schema::<CallGraphEdgeResult>,
+    },
+    OutputSchema {
+        command: "query symbols",
+        document: schema::<QueryMatches<SymbolRow>>,
+        record: schema::<SymbolRow>,
+    },
+    OutputSchema {
+        command: "query edges",
+        document: schema::<QueryMatches<EdgeRow>>,
+        record: schema::<EdgeRow>,
+    },
+    OutputSchema {
+        command: "hook pre-commit",
+        document: schema::<HookReport>,
+        record: schema::<HookViolation>,
+    },
+];
+
+/// `cruxe schema [command]`: the JSON Schema of a command's `--format json`
+/// output (or of one `ndjson` record), or the commands that have one.
+pub fn run(command: &[String], ndjson: bool) -> Result<()> {
+    if command.is_empty() {
+        for entry in OUTPUT_SCHEMAS {
+            println!("{}", entry.command);
+        }
+        return Ok(());
+    }
+
+    let name = command.join(" ");
+    let entry = OUTPUT_SCHEMAS
+        .iter()
+        .find(|entry| entry.command == name)
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "No output schema for `{}`; run `cruxe schema` to list commands",
+                name
+            )
+        })?;
+    let schema = if ndjson {
+        (entry.record)()
+    } else {
+        (entry.document)()
+    };
+    println!("{}", serde_json::to_string_pretty(&schema)?);
+    Ok(())
+}
@@ -0,0 +1,108 @@
+use anyhow::Result;
+use cruxe_core::config::Config;
+use cruxe_indexer::scanner::{self, PathScope};
+use cruxe_indexer::{build_constraints, project_discovery};
+use std::collections::HashSet;
+use std::path::Path;
+use std::sync::Mutex;
+
+/// Projects named by `--project`; empty selects the whole workspace.
+static SELECTED_PROJECTS: Mutex<Vec<String>> = Mutex::new(Vec::new());
+
+/// `[[build.configurations]]` entry named by `--build`, if any.
+static SELECTED_BUILD: Mutex<Option<String>> = Mutex::new(None);
+
+/// Narrow every path scope from now on to the named projects.
+pub fn select_projects(names: Vec<String>) {
+    if let Ok(mut guard) = SELECTED_PROJECTS.lock() {
+        *guard = names;
+    }
+}
+
+/// Narrow every path scope from now on to the files compiled by the named
+/// build configuration.
+pub fn select_build(name: String) {
+    if let Ok(mut guard) = SELECTED_BUILD.lock() {
+        *guard = Some(name);
+    }
+}
+
+/// Files a run covers: `[index] include`/`exclude`, as replaced by
+/// `--include`/`--exclude` on the command line, within the projects of the
+/// workspace selected by `--project` (by name or directory) and the build
+/// configuration selected by `--build`.
+pub fn path_scope(config: &Config, workspace: &Path) -> Result<PathScope> {
+    let scope = PathScope::new(&config.index.include, &config.index.exclude)
+        .map_err(|e| anyhow::anyhow!("Invalid include/exclude glob: {}", e))?;
+    let scope = within_build(scope, config, workspace)?;
+    let names = SELECTED_PROJECTS
+        .lock()
+        .map(|guard| guard.clone())
+        .unwrap_or_default();
+    if names.is_empty() {
+        return Ok(scope);
+    }
+    let projects = project_discovery::discover_projects(workspace);
+    let mut selected = Vec::new();
+    for name in &names {
+        let name = name.trim_end_matches('/');
+        let dirs: Vec<&str> = projects
+            .iter()
+            .filter(|project| project.name == name || project.dir == name)
+            .map(|project| project.dir.as_str())
+            .collect();
+        if dirs.is_empty() {
+            anyhow::bail!("Unknown project `{name}`. Run `cruxe projects` to list them.");
+        }
+        selected.extend(dirs);
+    }
+    Ok(scope.within_projects(&projects, &selected))
+}
+
+/// Leave out the Go files of the workspace whose build constraints exclude
+/// them from the `--build` configuration, or without one from the build
+/// set under `[languages.go]`. Constraints are read from the working tree,
+/// like the projects.
+fn within_build(scope: PathScope, config: &Config, workspace: &Path) -> Result<PathScope> {
+    let name = SELECTED_BUILD.lock().ok().and_then(|guard| guard.clone());
+    let build = match name {
+        Some(name) => match config.build.get(&name) {
+            Some(build) => build.clone(),
+            None => {
+                let names: Vec<&str> = config
+                    .build
+                    .configurations
+                    .iter()
+                    .map(|configuration| configuration.name.as_str())
+                    .collect();
+                if names.is_empty() {
+                    anyhow::bail!(
+                        "Unknown build configuration `{name}`; declare it under [[build.configurations]]"
+                    );
+                }
+                anyhow::bail!(
+                    "Unknown build configuration `{name}` (configured: {})",
+                    names.join(", ")
+                );
+            }
+        },
+        None => match config.languages.go.build() {
+            Some(build) => build,
+            None => return Ok(scope),
+        },
+    };
+    let mut left_out = HashSet::new();
+    let go = ["go".to_string()];
+    for file in scanner::scan_directory_filtered(workspace, config.index.max_file_size, &go) {
+        let Ok(content) = std::fs::read_to_string(&file.path) else {
+            continue;
+        };
+        let path = file.relative_path.replace('\\', "/");
+        if build_constraints::file_constraint(&path, &content)
+            .is_some_and(|constraint| !constraint.is_satisfied_by(&build))
+        {
+            left_out.insert(path);
+        }
+    }
+    Ok(scope.without_files(left_out))
+}
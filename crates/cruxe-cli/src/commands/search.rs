@@ -3,16 +3,29 @@ use cruxe_core::config::Config;
 use cruxe_core::constants;
 use cruxe_core::types::generate_project_id;
 use cruxe_core::vcs;
-use cruxe_query::search;
-use cruxe_state::{db, project, schema, tantivy_index::IndexSet};
+use cruxe_indexer::doc_extract;
+use cruxe_query::fuzzy::{self, SymbolFilter};
+use cruxe_query::search::{self, SearchExecutionOptions, SearchResponse, SearchResult};
+use cruxe_query::shards::{self, ShardSource};
+use cruxe_query::signature_search::{self, SignatureSearch};
+use cruxe_query::symbol_ids;
+use cruxe_state::{db, project, tantivy_index::IndexSet};
 use std::path::Path;
 
+use crate::style::{self, Style};
+
+/// Snippet lines shown under each result in rich output.
+const SNIPPET_LINES: usize = 3;
+
+#[allow(clippy::too_many_arguments)]
 pub fn run(
     repo_root: &Path,
     query: &str,
     r#ref: Option<&str>,
-    language: Option<&str>,
+    filter: &SymbolFilter,
+    in_docs: bool,
     limit: usize,
+    format: &str,
     config_file: Option<&Path>,
 ) -> Result<()> {
     let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
@@ -43,29 +56,186 @@ pub fn run(
         _ => anyhow::anyhow!("Failed to open indices: {}. Run `cruxe index` first.", e),
     })?;
 
-    let conn = db::open_connection_with_config(
+    let conn = db::open_for_query(
         &db_path,
         config.storage.busy_timeout_ms,
         config.storage.cache_size,
+        config.storage.mmap_size,
     )
     .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
-    schema::create_tables(&conn)
-        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
     let proj = project::get_by_root(&conn, &repo_root_str)?
         .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
     let resolved_ref = vcs::resolve_effective_ref(&repo_root, r#ref, &proj.default_ref);
-    let response = search::search_code(
-        &index_set,
-        Some(&conn),
-        query,
-        Some(&resolved_ref),
-        language,
-        limit,
-        false,
-    )
+    let shard_sets = open_shards(&data_dir, &config);
+    let language = filter.language.as_deref();
+    // Kind and package filters run after retrieval, so over-fetch to keep
+    // `limit` results once they have been applied.
+    let fetch_limit = if filter.kinds.is_empty() && filter.package.is_none() {
+        limit
+    } else {
+        limit.saturating_mul(4)
+    };
+    let options = SearchExecutionOptions {
+        in_docs,
+        ..SearchExecutionOptions::default()
+    };
+    let mut response = if shard_sets.is_empty() {
+        search::search_code_with_options(
+            &index_set,
+            Some(&conn),
+            query,
+            Some(&resolved_ref),
+            language,
+            fetch_limit,
+            false,
+            options,
+        )
+    } else {
+        let sources: Vec<ShardSource<'_>> = shard_sets
+            .iter()
+            .map(|(name, index_set, conn)| ShardSource {
+                name,
+                index_set,
+                conn: Some(conn),
+            })
+            .collect();
+        shards::search_sharded(
+            ShardSource {
+                name: "main",
+                index_set: &index_set,
+                conn: Some(&conn),
+            },
+            &sources,
+            &project_id,
+            query,
+            Some(&resolved_ref),
+            language,
+            fetch_limit,
+            &options,
+        )
+    }
     .map_err(|e| anyhow::anyhow!("Search failed: {}", e))?;
 
-    println!("Query intent: {:?}", response.query_intent);
+    response
+        .results
+        .retain(|result| filter.matches_result(result));
+    // Fuzzy name matches only fill in when lexical search comes up short,
+    // and match symbol names, not what their docs say.
+    if !in_docs && response.results.len() < limit && fuzzy::is_identifier(query) {
+        let conns: Vec<&rusqlite::Connection> = std::iter::once(&conn)
+            .chain(shard_sets.iter().map(|(_, _, conn)| conn))
+            .collect();
+        let hits =
+            fuzzy::search_symbols_across(&conns, &project_id, &resolved_ref, query, filter, limit)
+                .map_err(|e| anyhow::anyhow!("Fuzzy symbol search failed: {}", e))?;
+        let lexical = std::mem::take(&mut response.results);
+        response.results = fuzzy::merge(lexical, hits, limit);
+        // Fuzzy hits skip the search pipeline that fills in canonical ids.
+        symbol_ids::annotate(&conn, &resolved_ref, &mut response.results)
+            .map_err(|e| anyhow::anyhow!("Failed to compute symbol ids: {}", e))?;
+    } else {
+        response.results.truncate(limit);
+    }
+
+    super::render::render_records(format, &response, &response.results, print_response)
+}
+
+/// `search --sig`: functions matched by parameter and result types, read
+/// from the symbol table rather than the search indices.
+pub fn run_signature(
+    repo_root: &Path,
+    pattern: &str,
+    r#ref: Option<&str>,
+    filter: &SymbolFilter,
+    limit: usize,
+    format: &str,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let repo_root = std::fs::canonicalize(repo_root).context("Failed to resolve project path")?;
+    let repo_root_str = repo_root.to_string_lossy().to_string();
+
+    let config = Config::load_with_file(Some(&repo_root), config_file)?;
+    let project_id = generate_project_id(&repo_root_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &repo_root_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&repo_root, r#ref, &proj.default_ref);
+
+    let report = signature_search::search_signatures(
+        &conn,
+        &project_id,
+        &resolved_ref,
+        pattern,
+        filter,
+        limit,
+    )?;
+    super::render::render_records(format, &report, &report.matches, print_signatures)
+}
+
+fn print_signatures(report: &SignatureSearch) {
+    let style = style::current();
+    if report.matches.is_empty() {
+        println!("No functions match `{}`.", report.pattern);
+        return;
+    }
+    let locations: Vec<String> = report
+        .matches
+        .iter()
+        .map(|found| format!("{}:{}", found.path, found.line_start))
+        .collect();
+    let location_width = style::column_width(locations.iter().map(String::as_str), 8, 60);
+    for (found, location) in report.matches.iter().zip(&locations) {
+        let results = match found.results.as_slice() {
+            [] => String::new(),
+            [single] => format!(" {single}"),
+            many => format!(" ({})", many.join(", ")),
+        };
+        let params: Vec<&str> = found
+            .params
+            .iter()
+            .map(|param| {
+                if param.is_empty() {
+                    "?"
+                } else {
+                    param.as_str()
+                }
+            })
+            .collect();
+        println!(
+            "{} {} {}",
+            style.path(&style::pad(location, location_width)),
+            style.name(&found.qualified_name),
+            style.muted(&format!("({}){}", params.join(", "), results)),
+        );
+    }
+    println!();
+    if report.total > report.matches.len() {
+        println!(
+            "{} of {} matching functions shown",
+            report.matches.len(),
+            report.total
+        );
+    } else {
+        println!("{} matching functions", report.total);
+    }
+}
+
+fn print_response(response: &SearchResponse) {
+    let style = style::current();
+    println!(
+        "{}",
+        style.heading(&format!("Query intent: {:?}", response.query_intent))
+    );
     println!(
         "Results: {} (of {} candidates)",
         response.results.len(),
@@ -75,7 +245,11 @@ pub fn run(
 
     if response.results.is_empty() {
         println!("No results found.");
-        return Ok(());
+        return;
+    }
+    if !style.plain {
+        print_rich(response, &style);
+        return;
     }
 
     // Print results as table
@@ -86,11 +260,7 @@ pub fn run(
     println!("{}", "-".repeat(88));
 
     for result in &response.results {
-        let location = if result.line_start > 0 {
-            format!("{}:{}", result.path, result.line_start)
-        } else {
-            result.path.clone()
-        };
+        let location = location(result);
         println!(
             "{:<50} {:<10} {:<20} {:<8.2}",
             location,
@@ -98,7 +268,117 @@ pub fn run(
             result.name.as_deref().unwrap_or("-"),
             result.score,
         );
+        if let Some(id) = &result.canonical_id {
+            println!("    {}", id);
+        }
+        if is_comment(result)
+            && let Some(summary) = result.snippet.as_deref().and_then(|doc| doc.lines().next())
+        {
+            println!("    {}", summary);
+        }
+    }
+}
+
+/// Columns sized to the results, each followed by the start of its snippet.
+fn print_rich(response: &SearchResponse, style: &Style) {
+    let locations: Vec<String> = response.results.iter().map(location).collect();
+    let location_width = style::column_width(locations.iter().map(String::as_str), 8, 60);
+    let kind_width = style::column_width(
+        response
+            .results
+            .iter()
+            .map(|result| result.kind.as_deref().unwrap_or("-")),
+        4,
+        12,
+    );
+    let name_width = style::column_width(
+        response
+            .results
+            .iter()
+            .map(|result| result.name.as_deref().unwrap_or("-")),
+        4,
+        40,
+    );
+    for (result, location) in response.results.iter().zip(&locations) {
+        println!(
+            "{} {} {} {}",
+            style.path(&style::pad(location, location_width)),
+            style.kind(&style::pad(
+                result.kind.as_deref().unwrap_or("-"),
+                kind_width
+            )),
+            style.name(&style::pad(
+                result.name.as_deref().unwrap_or("-"),
+                name_width
+            )),
+            style.muted(&format!("{:.2}", result.score)),
+        );
+        if let Some(id) = &result.canonical_id {
+            println!("    {}", style.muted(id));
+        }
+        let Some(snippet) = result.snippet.as_deref() else {
+            continue;
+        };
+        if is_comment(result) {
+            if let Some(summary) = snippet.lines().next() {
+                println!("    {}", style.muted(summary));
+            }
+            continue;
+        }
+        let excerpt = style::excerpt(snippet, SNIPPET_LINES);
+        for line in style.code(&excerpt, &result.language).lines() {
+            println!("    {line}");
+        }
+        println!();
     }
+}
+
+/// Doc comments and comments print their first line rather than a code
+/// excerpt.
+fn is_comment(result: &SearchResult) -> bool {
+    result
+        .chunk_type
+        .as_deref()
+        .is_some_and(|chunk_type| doc_extract::DOCS_CHUNK_TYPES.contains(&chunk_type))
+}
+
+fn location(result: &SearchResult) -> String {
+    if result.line_start > 0 {
+        format!("{}:{}", result.path, result.line_start)
+    } else {
+        result.path.clone()
+    }
+}
 
-    Ok(())
+/// Built shards that open cleanly; a broken shard is reported and skipped.
+fn open_shards(data_dir: &Path, config: &Config) -> Vec<(String, IndexSet, rusqlite::Connection)> {
+    let names = match cruxe_state::shards::list_built_shards(data_dir) {
+        Ok(names) => names,
+        Err(e) => {
+            eprintln!("warning: failed to list index shards: {}", e);
+            return Vec::new();
+        }
+    };
+    names
+        .into_iter()
+        .filter_map(|name| {
+            let shard_dir = cruxe_state::shards::shard_data_dir(data_dir, &name);
+            let opened = IndexSet::open_existing(&shard_dir).and_then(|index_set| {
+                let conn = db::open_for_query(
+                    &shard_dir.join(constants::STATE_DB_FILE),
+                    config.storage.busy_timeout_ms,
+                    config.storage.cache_size,
+                    config.storage.mmap_size,
+                )?;
+                Ok((index_set, conn))
+            });
+            match opened {
+                Ok((index_set, conn)) => Some((name, index_set, conn)),
+                Err(e) => {
+                    eprintln!("warning: skipping shard `{}`: {}", name, e);
+                    None
+                }
+            }
+        })
+        .collect()
 }
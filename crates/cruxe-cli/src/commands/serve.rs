@@ -0,0 +1,65 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_mcp::rest::{self, RestServeOptions};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe serve --http`: the REST and gRPC APIs over this workspace's index.
+pub fn run(
+    workspace: &Path,
+    http: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let (bind_addr, port) = parse_listen_addr(http)?;
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    drop(conn);
+
+    eprintln!(
+        "Serving ref {} on http://{}:{} (OpenAPI spec at /openapi.json, gRPC on the same port)",
+        resolved_ref, bind_addr, port
+    );
+    let options = RestServeOptions {
+        ref_name: resolved_ref,
+        bind_addr,
+        port,
+    };
+    let runtime = tokio::runtime::Runtime::new()?;
+    runtime
+        .block_on(rest::run_rest_server(&workspace, config_file, options))
+        .map_err(|e| anyhow::anyhow!("REST server error: {}", e))
+}
+
+/// `[HOST]:PORT`; an empty host means loopback, so `:7474` stays local.
+fn parse_listen_addr(spec: &str) -> Result<(String, u16)> {
+    let (host, port) = spec
+        .rsplit_once(':')
+        .ok_or_else(|| anyhow::anyhow!("--http expects [HOST]:PORT, got `{spec}`"))?;
+    let port = port
+        .parse::<u16>()
+        .map_err(|_| anyhow::anyhow!("--http: `{port}` is not a valid port"))?;
+    let host = match host.trim_start_matches('[').trim_end_matches(']') {
+        "" => "127.0.0.1",
+        host => host,
+    };
+    Ok((host.to_string(), port))
+}
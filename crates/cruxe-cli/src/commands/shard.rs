@@ -0,0 +1,128 @@
+use anyhow::{Context, Result, bail};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_state::{db, export, import, maintenance_lock, manifest, project, schema, shards};
+use std::path::Path;
+
+pub fn list(workspace: &Path, config_file: Option<&Path>) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let data_dir = config.project_data_dir(&generate_project_id(&workspace.to_string_lossy()));
+    let built = shards::list_built_shards(&data_dir)?;
+
+    if config.shards.is_empty() && built.is_empty() {
+        println!("No shards configured. Declare them under [shards.<name>] in the config.");
+        return Ok(());
+    }
+    println!("{:<20} {:<8} {:<8} PATHS", "SHARD", "BUILT", "FILES");
+    println!("{}", "-".repeat(72));
+    for (name, shard) in &config.shards {
+        let files = if built.contains(name) {
+            shard_file_count(&shards::shard_data_dir(&data_dir, name), &config)?.to_string()
+        } else {
+            "-".to_string()
+        };
+        println!(
+            "{:<20} {:<8} {:<8} {}",
+            name,
+            if built.contains(name) { "yes" } else { "no" },
+            files,
+            shard.paths.join(", ")
+        );
+    }
+    for name in built
+        .iter()
+        .filter(|name| !config.shards.contains_key(*name))
+    {
+        println!("{:<20} {:<8} {:<8} (not in config)", name, "yes", "-");
+    }
+    Ok(())
+}
+
+pub fn export(
+    workspace: &Path,
+    name: &str,
+    output_path: &Path,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let data_dir = config.project_data_dir(&generate_project_id(&workspace_str));
+    let shard_dir = shards::shard_data_dir(&data_dir, name);
+    let db_path = shard_dir.join(constants::STATE_DB_FILE);
+    let project_row = if db_path.exists() {
+        project::get_by_root(&db::open_connection(&db_path)?, &workspace_str)?
+    } else {
+        None
+    };
+    let Some(project_row) = project_row else {
+        bail!("Shard `{name}` has not been built here. Run `cruxe index --shard {name}` first.");
+    };
+
+    let metadata = export::PortableStateMetadata::new(
+        project_row.schema_version,
+        project_row.parser_version,
+        project_row.project_id,
+        workspace_str,
+    );
+    export::export_bundle(&shard_dir, output_path, &metadata)?;
+    println!("Shard export complete");
+    println!("  Shard: {}", name);
+    println!("  Output: {}", output_path.display());
+    Ok(())
+}
+
+/// Install a shard bundle built elsewhere. The shard keeps its own state DB,
+/// including the project id of the machine that built it; search relabels
+/// its results.
+pub fn import(
+    workspace: &Path,
+    name: &str,
+    bundle_path: &Path,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    if !shards::is_valid_shard_name(name) {
+        bail!("Invalid shard name `{name}` (letters, digits, `-`, `_` and `.` only)");
+    }
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let data_dir = config.project_data_dir(&generate_project_id(&workspace.to_string_lossy()));
+    if !config.shards.contains_key(name) {
+        eprintln!(
+            "warning: shard `{name}` is not declared under [shards]; the main index will not skip its files"
+        );
+    }
+    let _maintenance_lock = maintenance_lock::acquire_project_lock(&data_dir, "shard_import")?;
+
+    let shard_dir = shards::shard_data_dir(&data_dir, name);
+    let metadata = import::import_bundle(bundle_path, &shard_dir)?;
+    if metadata.parser_version != constants::PARSER_VERSION {
+        eprintln!(
+            "Warning: shard parser_version={} differs from local parser_version={}. Rebuild it with `cruxe index --shard {}`.",
+            metadata.parser_version,
+            constants::PARSER_VERSION,
+            name
+        );
+    }
+    println!("Shard import complete");
+    println!("  Shard: {}", name);
+    println!("  Built from: {}", metadata.repo_root);
+    println!("  Files: {}", shard_file_count(&shard_dir, &config)?);
+    Ok(())
+}
+
+fn shard_file_count(shard_dir: &Path, config: &Config) -> Result<u64> {
+    let conn = db::open_connection_with_config(
+        &shard_dir.join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )?;
+    schema::create_tables(&conn)?;
+    let mut total = 0;
+    for proj in project::list_projects(&conn)? {
+        total += manifest::file_count(&conn, &proj.project_id, &proj.default_ref)?;
+    }
+    Ok(total)
+}
@@ -0,0 +1,66 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::describe::DescribeError;
+use cruxe_query::snippet::{self, SnippetError, SnippetOptions};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe snippet <symbol>`: the symbol's exact source range with byte
+/// offsets, plus the doc comment, imports, referenced types and call sites
+/// `options` asks for.
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    symbol_path: Option<&str>,
+    options: &SnippetOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let snippet = snippet::extract_snippet(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        symbol,
+        symbol_path,
+        options,
+    )
+    .map_err(|e| match e {
+        SnippetError::Resolve(DescribeError::SymbolNotFound) => {
+            anyhow::anyhow!("Symbol `{}` not found in ref `{}`", symbol, resolved_ref)
+        }
+        SnippetError::Resolve(DescribeError::Ambiguous { candidates }) => anyhow::anyhow!(
+            "`{}` matches {} symbols; pass a qualified name or --path:\n  {}",
+            symbol,
+            candidates.len(),
+            candidates.join("\n  ")
+        ),
+        other => anyhow::anyhow!("Snippet failed: {}", other),
+    })?;
+
+    super::render::render(format, &snippet, |snippet| {
+        print!("{}", snippet::render_text(snippet));
+    })
+}
@@ -4,7 +4,7 @@ use cruxe_core::constants;
 use cruxe_core::time::now_iso8601;
 use cruxe_core::types::generate_project_id;
 use cruxe_core::vcs;
-use cruxe_state::{db, import, maintenance_lock, schema};
+use cruxe_state::{db, export, import, maintenance_lock, project, schema};
 use std::path::Path;
 
 struct ImportRemapSpec<'a> {
@@ -21,7 +21,32 @@ struct ImportRemapSpec<'a> {
 pub fn run(workspace: &Path, bundle_path: &Path, config_file: Option<&Path>) -> Result<()> {
     let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
     let workspace_str = workspace.to_string_lossy().to_string();
-    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let metadata = import_into_workspace(&workspace, bundle_path, config_file, false)?;
+
+    println!("State import complete");
+    println!("  Workspace: {}", workspace.display());
+    println!("  Bundle: {}", bundle_path.display());
+    println!("  Imported project ID: {}", metadata.project_id);
+    println!(
+        "  Local project ID: {}",
+        generate_project_id(&workspace_str)
+    );
+    println!("  Schema version: {}", metadata.schema_version);
+    Ok(())
+}
+
+/// Unpack a bundle into the data directory of `workspace` (canonical) and
+/// re-key its rows to the local project. The local HEAD branch becomes the
+/// default ref unless `keep_default_ref`, which keeps the bundle's (a cache
+/// bundle's default branch is where its rows live).
+pub(crate) fn import_into_workspace(
+    workspace: &Path,
+    bundle_path: &Path,
+    config_file: Option<&Path>,
+    keep_default_ref: bool,
+) -> Result<export::PortableStateMetadata> {
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(workspace), config_file)?;
     let project_id = generate_project_id(&workspace_str);
     let data_dir = config.project_data_dir(&project_id);
     let _maintenance_lock = maintenance_lock::acquire_project_lock(&data_dir, "state_import")?;
@@ -39,11 +64,16 @@ pub fn run(workspace: &Path, bundle_path: &Path, config_file: Option<&Path>) ->
     let mut conn = db::open_connection(&db_path)?;
     schema::create_tables(&conn)?;
 
-    let is_vcs_repo = vcs::is_git_repo(&workspace);
-    let default_ref = if is_vcs_repo {
-        vcs::detect_default_ref(&workspace, "main")
+    let is_vcs_repo = vcs::is_git_repo(workspace);
+    let imported_default_ref = if keep_default_ref {
+        project::get_by_id(&conn, &metadata.project_id)?.map(|imported| imported.default_ref)
     } else {
-        constants::REF_LIVE.to_string()
+        None
+    };
+    let default_ref = match imported_default_ref {
+        Some(default_ref) => default_ref,
+        None if is_vcs_repo => vcs::detect_default_ref(workspace, "main"),
+        None => constants::REF_LIVE.to_string(),
     };
     remap_imported_project_data(
         &mut conn,
@@ -66,17 +96,7 @@ pub fn run(workspace: &Path, bundle_path: &Path, config_file: Option<&Path>) ->
         rusqlite::params![project_id],
     )
     .map_err(cruxe_core::error::StateError::sqlite)?;
-
-    println!("State import complete");
-    println!("  Workspace: {}", workspace.display());
-    println!("  Bundle: {}", bundle_path.display());
-    println!("  Imported project ID: {}", metadata.project_id);
-    println!(
-        "  Local project ID: {}",
-        generate_project_id(&workspace_str)
-    );
-    println!("  Schema version: {}", metadata.schema_version);
-    Ok(())
+    Ok(metadata)
 }
 
 fn remap_imported_project_data(
@@ -163,6 +183,27 @@ fn remap_repo_tables(
         "branch_state",
         "branch_tombstones",
         "worktree_leases",
+        "file_reference_fingerprints",
+        "string_injections",
+        "go_templates",
+        "go_embeds",
+        "go_modules",
+        "workspace_projects",
+        "submodules",
+        "import_paths",
+        "remote_origins",
+        "generated_files",
+        "embedded_files",
+        "package_summaries",
+        "symbol_blame",
+        "blob_artifacts",
+        "parse_errors",
+        "skipped_files",
+        "plugin_findings",
+        "file_encodings",
+        "local_bindings",
+        "literals",
+        "index_modes",
     ] {
         let sql = format!("UPDATE {table} SET repo = ?1 WHERE repo = ?2");
         tx.execute(
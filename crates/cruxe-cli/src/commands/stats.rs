@@ -0,0 +1,137 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::gate::{self, FailOn};
+use cruxe_query::graph_export;
+use cruxe_query::stats::{self, Distribution, GroupStats, RepoStats};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe stats`: per-package and per-language size, symbol and
+/// connectivity counts.
+pub fn run(
+    workspace: &Path,
+    top: usize,
+    format: &str,
+    r#ref: Option<&str>,
+    fail_on: Option<&FailOn>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let snapshot = graph_export::load_graph_snapshot(&conn, &project_id, &resolved_ref)?;
+    let files = stats::load_file_lines(&conn, &workspace, &project_id, &resolved_ref)?;
+    let stats = stats::build_stats(&snapshot, &files, top);
+
+    super::render::render(format, &stats, |stats| print_stats(stats, top))?;
+    super::gate::enforce(
+        "Gate failed",
+        &super::gate::violations(fail_on, "stats", &gate::stats_metrics(&stats)),
+    )
+}
+
+fn print_stats(stats: &RepoStats, top: usize) {
+    let totals = &stats.totals;
+    println!(
+        "{} files, {} LOC, {} symbols ({} functions, avg {} lines) on ref {}",
+        totals.files,
+        totals.loc,
+        totals.symbols,
+        totals.functions,
+        totals.avg_function_length,
+        stats.ref_name
+    );
+    println!("Symbols by kind: {}", kinds(totals));
+
+    println!();
+    println!("By language:");
+    print_groups(&stats.languages, usize::MAX);
+
+    println!();
+    if stats.packages.len() > top {
+        println!(
+            "By package (largest {} of {} by LOC):",
+            top,
+            stats.packages.len()
+        );
+    } else {
+        println!("By package:");
+    }
+    print_groups(&stats.packages, top);
+
+    println!();
+    println!("Fan-in  (functions): {}", distribution(&stats.fan_in));
+    println!("Fan-out (functions): {}", distribution(&stats.fan_out));
+
+    if !stats.most_connected.is_empty() {
+        println!();
+        println!("Most connected:");
+        for metric in &stats.most_connected {
+            println!(
+                "  {:>4} in {:>4} out  {}  {}:{}",
+                metric.fan_in,
+                metric.fan_out,
+                metric.qualified_name,
+                metric.path,
+                metric.line_start
+            );
+        }
+    }
+}
+
+fn print_groups(groups: &[GroupStats], top: usize) {
+    let mut groups: Vec<&GroupStats> = groups.iter().collect();
+    groups.sort_by(|a, b| b.loc.cmp(&a.loc).then_with(|| a.name.cmp(&b.name)));
+    println!(
+        "  {:<40} {:>6} {:>8} {:>8} {:>9} {:>8}",
+        "NAME", "FILES", "LOC", "SYMBOLS", "FUNCTIONS", "AVG LEN"
+    );
+    for group in groups.into_iter().take(top) {
+        println!(
+            "  {:<40} {:>6} {:>8} {:>8} {:>9} {:>8}",
+            group.name,
+            group.files,
+            group.loc,
+            group.symbols,
+            group.functions,
+            group.avg_function_length
+        );
+    }
+}
+
+fn kinds(group: &GroupStats) -> String {
+    if group.symbols_by_kind.is_empty() {
+        return "-".to_string();
+    }
+    group
+        .symbols_by_kind
+        .iter()
+        .map(|(kind, count)| format!("{kind} {count}"))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+fn distribution(dist: &Distribution) -> String {
+    format!(
+        "min {} / p50 {} / p90 {} / p99 {} / max {} (mean {})",
+        dist.min, dist.p50, dist.p90, dist.p99, dist.max, dist.mean
+    )
+}
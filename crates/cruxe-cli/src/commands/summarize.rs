@@ -0,0 +1,90 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::summarize::{self, SummaryBackend};
+use cruxe_state::{db, project, schema};
+use std::path::Path;
+
+/// `cruxe summarize <package>`: purpose, key types, main call flows and
+/// dependencies of a directory, from the `[summarize]` backend. Stored
+/// summaries are reused until a file of the package changes (always
+/// rebuilt with `refresh`); `heuristic` skips a configured chat backend.
+pub fn run(
+    workspace: &Path,
+    package: &str,
+    refresh: bool,
+    heuristic: bool,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let conn = db::open_connection_with_config(
+        &config
+            .project_data_dir(&project_id)
+            .join(constants::STATE_DB_FILE),
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let backend = if heuristic {
+        SummaryBackend::Heuristic
+    } else {
+        match SummaryBackend::from_config(&config.summarize, &config.search.semantic) {
+            Ok(backend) => backend,
+            Err(endpoint) => {
+                eprintln!(
+                    "note: {endpoint} is not on this machine; set \
+                     search.semantic.external_provider_enabled and allow_code_payload_to_external \
+                     to send package details to it. Using the heuristic summary."
+                );
+                SummaryBackend::Heuristic
+            }
+        }
+    };
+    let package = relative_package(&workspace, package);
+    let summary = summarize::summarize(
+        &conn,
+        &workspace,
+        &project_id,
+        &resolved_ref,
+        &package,
+        &backend,
+        refresh,
+    )?;
+    super::render::render(format, &summary, |summary| {
+        print!("{}", summarize::render_text(summary));
+    })
+}
+
+/// A package given relative to the current directory, as a path relative
+/// to the workspace root when it lies inside it.
+fn relative_package(workspace: &Path, package: &str) -> String {
+    std::fs::canonicalize(package)
+        .ok()
+        .and_then(|absolute| {
+            absolute
+                .strip_prefix(workspace)
+                .ok()
+                .map(|relative| relative.to_string_lossy().replace('\\', "/"))
+        })
+        .map(|relative| {
+            if relative.is_empty() {
+                ".".to_string()
+            } else {
+                relative
+            }
+        })
+        .unwrap_or_else(|| package.to_string())
+}
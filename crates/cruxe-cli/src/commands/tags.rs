@@ -0,0 +1,63 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::tags::{self, TagsFormat};
+use cruxe_state::{db, project, schema, symbols};
+use std::io::Write;
+use std::path::Path;
+
+pub fn run(
+    workspace: &Path,
+    format: &str,
+    output: Option<&Path>,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let format = TagsFormat::parse(format)
+        .ok_or_else(|| anyhow::anyhow!("Unsupported tags format: {format}"))?;
+
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let symbols = symbols::list_symbols_for_ref(&conn, &project_id, &resolved_ref)?;
+    // Tag paths are relative to the workspace root, which is where editors
+    // look for the file by default.
+    let output = match output {
+        Some(path) => path.to_path_buf(),
+        None => workspace.join(format.default_file_name()),
+    };
+    let file = std::fs::File::create(&output)
+        .with_context(|| format!("Failed to create {}", output.display()))?;
+    let mut writer = std::io::BufWriter::new(file);
+    let written = match format {
+        TagsFormat::Ctags => tags::write_ctags(&symbols, &mut writer)?,
+        TagsFormat::Etags => tags::write_etags(&symbols, Some(&workspace), &mut writer)?,
+    };
+    writer.flush()?;
+
+    eprintln!(
+        "Wrote {} {} tags to {}",
+        written,
+        format.as_str(),
+        output.display()
+    );
+    Ok(())
+}
@@ -0,0 +1,77 @@
+use anyhow::{Context, Result, bail};
+use cruxe_core::config::Config;
+use cruxe_core::telemetry;
+use std::path::Path;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+const SEND_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// Print the pending report exactly as it would be sent.
+pub fn show(config_file: Option<&Path>) -> Result<()> {
+    let config = Config::load_with_file(None, config_file)?;
+    let path = telemetry::telemetry_path(&config);
+    let stored = telemetry::load(&path);
+
+    eprintln!(
+        "Telemetry: {} (endpoint: {})",
+        if config.telemetry.enabled {
+            "enabled"
+        } else {
+            "disabled"
+        },
+        config.telemetry.endpoint.as_deref().unwrap_or("none"),
+    );
+    eprintln!("Stored at: {}", path.display());
+    if let Some(sent) = stored.last_sent_unix {
+        eprintln!("Last sent: {} (unix)", sent);
+    }
+    println!("{}", serde_json::to_string_pretty(&stored.report)?);
+    Ok(())
+}
+
+/// Upload the pending report and start a fresh one.
+pub fn send(config_file: Option<&Path>) -> Result<()> {
+    let config = Config::load_with_file(None, config_file)?;
+    if !config.telemetry.enabled {
+        bail!("Telemetry is disabled. Set `telemetry.enabled = true` to opt in.");
+    }
+    let Some(endpoint) = config.telemetry.endpoint.as_deref() else {
+        bail!("No telemetry endpoint configured (`telemetry.endpoint`).");
+    };
+
+    let path = telemetry::telemetry_path(&config);
+    let mut stored = telemetry::load(&path);
+    if stored.report.is_empty() {
+        println!("Nothing to send.");
+        return Ok(());
+    }
+
+    reqwest::blocking::Client::builder()
+        .timeout(SEND_TIMEOUT)
+        .build()?
+        .post(endpoint)
+        .json(&stored.report)
+        .send()
+        .and_then(|response| response.error_for_status())
+        .with_context(|| format!("Failed to send telemetry to {endpoint}"))?;
+
+    stored.report = telemetry::TelemetryReport::default();
+    stored.last_sent_unix = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .ok()
+        .map(|elapsed| elapsed.as_secs());
+    telemetry::save(&path, &stored).context("Failed to update telemetry state")?;
+    println!("Telemetry sent to {endpoint}.");
+    Ok(())
+}
+
+/// Discard the pending report without sending it.
+pub fn reset(config_file: Option<&Path>) -> Result<()> {
+    let config = Config::load_with_file(None, config_file)?;
+    let path = telemetry::telemetry_path(&config);
+    let mut stored = telemetry::load(&path);
+    stored.report = telemetry::TelemetryReport::default();
+    telemetry::save(&path, &stored).context("Failed to update telemetry state")?;
+    println!("Pending telemetry discarded.");
+    Ok(())
+}
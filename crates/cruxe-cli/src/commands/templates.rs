@@ -0,0 +1,99 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::{TemplateRecord, generate_project_id};
+use cruxe_core::vcs;
+use cruxe_query::templates::{self, ExecuteSite, TemplateIssue};
+use cruxe_state::{db, project, schema};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::path::Path;
+
+#[derive(Debug, Serialize, JsonSchema)]
+pub struct Templates {
+    pub templates: Vec<TemplateRecord>,
+    pub execute_sites: Vec<ExecuteSite>,
+    /// Fields a template uses that its data type does not have.
+    pub issues: Vec<TemplateIssue>,
+}
+
+pub fn run(
+    workspace: &Path,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_connection_with_config(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    schema::create_tables(&conn)
+        .map_err(|e| anyhow::anyhow!("Failed to initialize schema: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let index = templates::load(&conn, &project_id, &resolved_ref)
+        .map_err(|e| anyhow::anyhow!("Failed to load templates: {}", e))?;
+    let issues = index.check();
+
+    let output = Templates {
+        templates: index.templates,
+        execute_sites: index.sites,
+        issues,
+    };
+    super::render::render_records(format, &output, &output.issues, |output| {
+        print_templates(output);
+        eprintln!(
+            "{} template(s), {} execute site(s), {} unknown field(s)",
+            output.templates.len(),
+            output.execute_sites.len(),
+            output.issues.len()
+        );
+    })
+}
+
+fn print_templates(output: &Templates) {
+    println!(
+        "{:<28} {:<7} {:<40} {:>6} {:>6}",
+        "TEMPLATE", "KIND", "LOCATION", "FIELDS", "CALLS"
+    );
+    println!("{}", "-".repeat(90));
+    for template in &output.templates {
+        println!(
+            "{:<28} {:<7} {:<40} {:>6} {:>6}",
+            template.name,
+            template.kind,
+            format!("{}:{}", template.path, template.line),
+            template.fields.len(),
+            template.calls.len(),
+        );
+    }
+    if !output.execute_sites.is_empty() {
+        println!("\nExecuted with:");
+        for site in &output.execute_sites {
+            println!(
+                "  {} <- {} at {}:{} (in {})",
+                site.template, site.data_type, site.path, site.line, site.symbol
+            );
+        }
+    }
+    if !output.issues.is_empty() {
+        println!("\nUnknown fields:");
+        for issue in &output.issues {
+            println!(
+                "  {}:{}: {} (in template {})",
+                issue.path, issue.line, issue.message, issue.template
+            );
+        }
+    }
+}
@@ -0,0 +1,152 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::test_map::{self, CoverageProfile, TestEvidence, TestMapError, TestsFor};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe tests-for <symbol>`: the tests that exercise a symbol, by reverse
+/// call graph and optional per-test cover profiles, with the commands that
+/// run just those tests.
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    workspace: &Path,
+    symbol: &str,
+    symbol_path: Option<&str>,
+    depth: u32,
+    limit: usize,
+    coverage: &[String],
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let profiles = coverage
+        .iter()
+        .map(|path| load_profile(Path::new(path)))
+        .collect::<Result<Vec<_>>>()?;
+    let report = test_map::tests_for(
+        &conn,
+        &project_id,
+        &resolved_ref,
+        &test_map::TestsForRequest {
+            symbol,
+            path: symbol_path,
+            depth,
+            limit,
+            coverage: &profiles,
+        },
+    )
+    .map_err(|e| match e {
+        TestMapError::SymbolNotFound => {
+            anyhow::anyhow!("Symbol `{}` not found in ref `{}`", symbol, resolved_ref)
+        }
+        other => anyhow::anyhow!("Test lookup failed: {}", other),
+    })?;
+
+    match format {
+        "tests" => {
+            for path in &report.test_files {
+                println!("{}", path);
+            }
+            Ok(())
+        }
+        "run" => {
+            for command in &report.run {
+                println!("{}", command);
+            }
+            Ok(())
+        }
+        _ => super::render::render_records(format, &report, &report.tests, print_report),
+    }
+}
+
+/// A Go cover profile recorded for one test, named after it
+/// (`TestLoad.out` holds what `TestLoad` executed).
+fn load_profile(path: &Path) -> Result<CoverageProfile> {
+    let text = std::fs::read_to_string(path)
+        .with_context(|| format!("Failed to read cover profile {}", path.display()))?;
+    let test = path
+        .file_stem()
+        .map(|stem| stem.to_string_lossy().to_string())
+        .ok_or_else(|| anyhow::anyhow!("Cover profile {} has no file name", path.display()))?;
+    Ok(CoverageProfile::parse_go(&test, &text))
+}
+
+fn print_report(report: &TestsFor) {
+    println!(
+        "{} ({}) {}:{}",
+        report.symbol.qualified_name,
+        report.symbol.kind,
+        report.symbol.path,
+        report.symbol.line_start
+    );
+    println!();
+    println!(
+        "Tests (call depth <= {}): {} in {} file(s){}",
+        report.depth_applied,
+        report.tests.len(),
+        report.test_files.len(),
+        if report.truncated {
+            " (truncated, raise --limit)"
+        } else {
+            ""
+        }
+    );
+    for found in &report.tests {
+        let evidence: Vec<&str> = found
+            .evidence
+            .iter()
+            .map(|evidence| match evidence {
+                TestEvidence::CallGraph => "calls",
+                TestEvidence::Coverage => "coverage",
+            })
+            .collect();
+        let depth = if found.depth == 0 {
+            "-".to_string()
+        } else {
+            found.depth.to_string()
+        };
+        println!(
+            "  [{}] {}:{}  {}  ({})",
+            depth,
+            found.test.path,
+            found.test.line_start,
+            found.test.qualified_name,
+            evidence.join(", ")
+        );
+    }
+    if !report.unindexed_tests.is_empty() {
+        println!();
+        println!(
+            "Covered by tests that are not indexed: {}",
+            report.unindexed_tests.join(", ")
+        );
+    }
+    if !report.run.is_empty() {
+        println!();
+        println!("Run:");
+        for command in &report.run {
+            println!("  {}", command);
+        }
+    }
+}
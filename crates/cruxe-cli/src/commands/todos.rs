@@ -0,0 +1,88 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::todos::{self, TodoError, TodoOptions, TodoReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe todos`: TODO, FIXME and HACK comments and deprecation notices,
+/// oldest first, with the symbol each belongs to and its blame author.
+pub fn run(
+    workspace: &Path,
+    mut options: TodoOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    options.scope = super::scope::path_scope(&config, &workspace)?;
+
+    let report = todos::list_todos(&conn, &workspace, &project_id, &resolved_ref, &options)
+        .map_err(|e| match e {
+            TodoError::NotGitRepo => anyhow::anyhow!(
+                "--owner and --min-age need git history; {} is not a git repository",
+                workspace.display()
+            ),
+            other => anyhow::anyhow!("Listing TODOs failed: {}", other),
+        })?;
+    super::render::render_records(format, &report, &report.items, print_report)
+}
+
+fn print_report(report: &TodoReport) {
+    if report.items.is_empty() {
+        println!("No TODO markers on ref {}.", report.ref_name);
+        return;
+    }
+    for item in &report.items {
+        let age = item
+            .age_days
+            .map_or_else(|| "-".to_string(), |days| format!("{days}d"));
+        let owner = item
+            .assignee
+            .as_deref()
+            .or(item.author.as_deref())
+            .unwrap_or("-");
+        println!(
+            "{:<10} {:>6}  {:<20} {}:{}  {}",
+            item.marker.to_uppercase(),
+            age,
+            owner,
+            item.path,
+            item.line,
+            item.text
+        );
+        if let Some(symbol) = item.symbol.as_deref() {
+            println!("{:<10} {:>6}  {:<20} in {}", "", "", "", symbol);
+        }
+    }
+    let counts: Vec<String> = report
+        .by_marker
+        .iter()
+        .map(|(marker, count)| format!("{count} {marker}"))
+        .collect();
+    println!();
+    println!(
+        "{} marker(s) on ref {}: {}",
+        report.total,
+        report.ref_name,
+        counts.join(", ")
+    );
+}
@@ -0,0 +1,465 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::call_graph::{self, CallGraphDirection, CallGraphRequest};
+use cruxe_query::find_references;
+use cruxe_query::fuzzy::{self, SymbolFilter};
+use cruxe_state::{db, project};
+use ratatui::crossterm::event::{self, Event, KeyCode, KeyEvent, KeyEventKind, KeyModifiers};
+use ratatui::layout::{Constraint, Layout, Rect};
+use ratatui::style::{Color, Modifier, Style};
+use ratatui::text::{Line, Span};
+use ratatui::widgets::{Block, List, ListItem, ListState, Paragraph};
+use ratatui::{DefaultTerminal, Frame};
+use rusqlite::Connection;
+use std::path::{Path, PathBuf};
+
+const SEARCH_LIMIT: usize = 200;
+const NAVIGATION_LIMIT: usize = 200;
+const HELP: &str = "type to search  Tab switch pane  ↑/↓ move  c callers  e callees  r references  Backspace back  q quit";
+
+/// `cruxe tui`: browse the index interactively. A search pane lists fuzzy
+/// symbol matches, the preview pane shows the selected definition or call
+/// site, and callers/callees/references open as new lists on a stack.
+pub fn run(workspace: &Path, r#ref: Option<&str>, config_file: Option<&Path>) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+
+    let mut app = App {
+        conn,
+        workspace,
+        project_id,
+        ref_name: resolved_ref,
+        query: String::new(),
+        focus: Focus::Search,
+        views: vec![View::new("Symbols".to_string(), Vec::new())],
+        status: HELP.to_string(),
+        quit: false,
+    };
+    let mut terminal = ratatui::init();
+    let result = app.run(&mut terminal);
+    ratatui::restore();
+    result
+}
+
+/// A symbol in a list, with the location the preview shows: its definition
+/// for search results, the call or reference site for navigation lists.
+#[derive(Debug, Clone)]
+struct Entry {
+    qualified_name: String,
+    kind: String,
+    symbol_path: String,
+    site_path: String,
+    site_line: u32,
+    site_end: u32,
+}
+
+struct View {
+    title: String,
+    entries: Vec<Entry>,
+    state: ListState,
+}
+
+impl View {
+    fn new(title: String, entries: Vec<Entry>) -> Self {
+        let selected = (!entries.is_empty()).then_some(0);
+        Self {
+            title,
+            entries,
+            state: ListState::default().with_selected(selected),
+        }
+    }
+
+    fn selected(&self) -> Option<&Entry> {
+        self.state.selected().and_then(|i| self.entries.get(i))
+    }
+
+    fn move_by(&mut self, delta: isize) {
+        if self.entries.is_empty() {
+            return;
+        }
+        let current = self.state.selected().unwrap_or(0) as isize;
+        let last = self.entries.len() as isize - 1;
+        self.state
+            .select(Some((current + delta).clamp(0, last) as usize));
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Focus {
+    Search,
+    List,
+}
+
+#[derive(Debug, Clone, Copy)]
+enum Jump {
+    Callers,
+    Callees,
+    References,
+}
+
+struct App {
+    conn: Connection,
+    workspace: PathBuf,
+    project_id: String,
+    ref_name: String,
+    query: String,
+    focus: Focus,
+    /// The search results at the bottom, navigation lists above them.
+    views: Vec<View>,
+    status: String,
+    quit: bool,
+}
+
+impl App {
+    fn run(&mut self, terminal: &mut DefaultTerminal) -> Result<()> {
+        while !self.quit {
+            terminal.draw(|frame| self.draw(frame))?;
+            if let Event::Key(key) = event::read()?
+                && key.kind == KeyEventKind::Press
+            {
+                self.handle_key(key);
+            }
+        }
+        Ok(())
+    }
+
+    fn view(&mut self) -> &mut View {
+        self.views.last_mut().expect("search view is never popped")
+    }
+
+    fn handle_key(&mut self, key: KeyEvent) {
+        if key.modifiers.contains(KeyModifiers::CONTROL) && key.code == KeyCode::Char('c') {
+            self.quit = true;
+            return;
+        }
+        match key.code {
+            KeyCode::Tab | KeyCode::BackTab => {
+                self.focus = match self.focus {
+                    Focus::Search => Focus::List,
+                    Focus::List => Focus::Search,
+                };
+            }
+            KeyCode::Up => self.view().move_by(-1),
+            KeyCode::Down => self.view().move_by(1),
+            KeyCode::PageUp => self.view().move_by(-10),
+            KeyCode::PageDown => self.view().move_by(10),
+            KeyCode::Esc if self.views.len() > 1 => self.back(),
+            KeyCode::Esc => self.quit = true,
+            _ if self.focus == Focus::Search => self.edit_query(key.code),
+            KeyCode::Char('q') => self.quit = true,
+            KeyCode::Char('/') => self.focus = Focus::Search,
+            KeyCode::Char('k') => self.view().move_by(-1),
+            KeyCode::Char('j') => self.view().move_by(1),
+            KeyCode::Char('c') => self.jump(Jump::Callers),
+            KeyCode::Char('e') | KeyCode::Enter => self.jump(Jump::Callees),
+            KeyCode::Char('r') => self.jump(Jump::References),
+            KeyCode::Backspace | KeyCode::Left | KeyCode::Char('h') => self.back(),
+            _ => {}
+        }
+    }
+
+    fn edit_query(&mut self, code: KeyCode) {
+        match code {
+            KeyCode::Char(c) => self.query.push(c),
+            KeyCode::Backspace => {
+                self.query.pop();
+            }
+            KeyCode::Enter => {
+                self.focus = Focus::List;
+                return;
+            }
+            _ => return,
+        }
+        // A new search replaces whatever was being navigated.
+        self.views.truncate(1);
+        self.search();
+    }
+
+    fn search(&mut self) {
+        let query = self.query.trim();
+        let entries = if query.is_empty() {
+            Ok(Vec::new())
+        } else {
+            fuzzy::search_symbols(
+                &self.conn,
+                &self.project_id,
+                &self.ref_name,
+                query,
+                &SymbolFilter::default(),
+                SEARCH_LIMIT,
+            )
+            .map(|results| {
+                results
+                    .into_iter()
+                    .map(|result| Entry {
+                        qualified_name: result.qualified_name.or(result.name).unwrap_or_default(),
+                        kind: result.kind.unwrap_or_default(),
+                        symbol_path: result.path.clone(),
+                        site_path: result.path,
+                        site_line: result.line_start,
+                        site_end: result.line_end,
+                    })
+                    .collect()
+            })
+        };
+        match entries {
+            Ok(entries) => {
+                self.status = format!("{} match(es)", entries.len());
+                self.views[0] = View::new("Symbols".to_string(), entries);
+            }
+            Err(e) => self.status = format!("Search failed: {e}"),
+        }
+    }
+
+    fn back(&mut self) {
+        if self.views.len() > 1 {
+            self.views.pop();
+            self.status = HELP.to_string();
+        }
+    }
+
+    fn jump(&mut self, jump: Jump) {
+        let Some(entry) = self.view().selected().cloned() else {
+            return;
+        };
+        let loaded = match jump {
+            Jump::Callers | Jump::Callees => self.call_graph_entries(&entry, jump),
+            Jump::References => self.reference_entries(&entry),
+        };
+        match loaded {
+            Ok(entries) if entries.is_empty() => {
+                self.status = format!("No {} for {}", jump.label(), entry.qualified_name);
+            }
+            Ok(entries) => {
+                self.status = format!("{} {}", entries.len(), jump.label());
+                self.views.push(View::new(
+                    format!("{} of {}", jump.title(), entry.qualified_name),
+                    entries,
+                ));
+                self.focus = Focus::List;
+            }
+            Err(e) => self.status = e,
+        }
+    }
+
+    fn call_graph_entries(&self, entry: &Entry, jump: Jump) -> Result<Vec<Entry>, String> {
+        let direction = match jump {
+            Jump::Callers => CallGraphDirection::Callers,
+            _ => CallGraphDirection::Callees,
+        };
+        let request = CallGraphRequest {
+            symbol_name: &entry.qualified_name,
+            path: Some(&entry.symbol_path),
+            direction,
+            depth: 1,
+            limit: NAVIGATION_LIMIT,
+        };
+        let graph =
+            call_graph::get_call_graph(&self.conn, &self.project_id, &self.ref_name, &request)
+                .map_err(|e| format!("Call graph failed: {e}"))?;
+        let edges = match jump {
+            Jump::Callers => graph.callers,
+            _ => graph.callees,
+        };
+        Ok(edges
+            .into_iter()
+            .map(|edge| {
+                // Callers preview where they make the call; callees their body.
+                let (site_path, site_line, site_end) = match jump {
+                    Jump::Callers => (
+                        edge.call_site.file.clone(),
+                        edge.call_site.line,
+                        edge.call_site.line,
+                    ),
+                    _ => (
+                        edge.symbol.path.clone(),
+                        edge.symbol.line_start,
+                        edge.symbol.line_end,
+                    ),
+                };
+                Entry {
+                    qualified_name: edge.symbol.qualified_name,
+                    kind: edge.symbol.kind,
+                    symbol_path: edge.symbol.path,
+                    site_path,
+                    site_line,
+                    site_end,
+                }
+            })
+            .collect())
+    }
+
+    fn reference_entries(&self, entry: &Entry) -> Result<Vec<Entry>, String> {
+        let result = find_references::find_references(
+            &self.conn,
+            &self.workspace,
+            &self.project_id,
+            &self.ref_name,
+            None,
+            &entry.qualified_name,
+            NAVIGATION_LIMIT,
+        )
+        .map_err(|e| format!("Find references failed: {e}"))?;
+        Ok(result
+            .references
+            .into_iter()
+            .map(|reference| Entry {
+                qualified_name: reference.from_symbol.qualified_name,
+                kind: reference.edge_type,
+                symbol_path: reference.from_symbol.path,
+                site_line: reference.line_start,
+                site_end: reference.line_end.unwrap_or(reference.line_start),
+                site_path: reference.path,
+            })
+            .collect())
+    }
+
+    fn draw(&mut self, frame: &mut Frame) {
+        let [input_area, body, status_area] = Layout::vertical([
+            Constraint::Length(3),
+            Constraint::Min(0),
+            Constraint::Length(1),
+        ])
+        .areas(frame.area());
+        let [list_area, preview_area] =
+            Layout::horizontal([Constraint::Percentage(40), Constraint::Percentage(60)])
+                .areas(body);
+
+        let focused = Style::new().fg(Color::Cyan);
+        let input = Paragraph::new(self.query.as_str()).block(
+            Block::bordered()
+                .title(format!(" Search ({}) ", self.ref_name))
+                .border_style(if self.focus == Focus::Search {
+                    focused
+                } else {
+                    Style::new()
+                }),
+        );
+        frame.render_widget(input, input_area);
+        if self.focus == Focus::Search {
+            let width = self.query.chars().count() as u16;
+            frame.set_cursor_position((
+                (input_area.x + 1 + width).min(input_area.right().saturating_sub(2)),
+                input_area.y + 1,
+            ));
+        }
+
+        let depth = self.views.len();
+        let focus = self.focus;
+        let view = self.view();
+        let items: Vec<ListItem> = view
+            .entries
+            .iter()
+            .map(|entry| {
+                ListItem::new(Line::from(vec![
+                    Span::styled(
+                        format!("{:<9}", entry.kind),
+                        Style::new().fg(Color::DarkGray),
+                    ),
+                    Span::raw(entry.qualified_name.clone()),
+                ]))
+            })
+            .collect();
+        let title = if depth > 1 {
+            format!(" {} [{}] ", view.title, depth - 1)
+        } else {
+            format!(" {} ", view.title)
+        };
+        let list = List::new(items)
+            .block(
+                Block::bordered()
+                    .title(title)
+                    .border_style(if focus == Focus::List {
+                        focused
+                    } else {
+                        Style::new()
+                    }),
+            )
+            .highlight_style(Style::new().add_modifier(Modifier::REVERSED));
+        frame.render_stateful_widget(list, list_area, &mut view.state);
+
+        let selected = view.selected().cloned();
+        self.draw_preview(frame, preview_area, selected.as_ref());
+        frame.render_widget(
+            Paragraph::new(self.status.as_str()).style(Style::new().fg(Color::DarkGray)),
+            status_area,
+        );
+    }
+
+    fn draw_preview(&self, frame: &mut Frame, area: Rect, entry: Option<&Entry>) {
+        let Some(entry) = entry else {
+            frame.render_widget(Block::bordered().title(" Preview "), area);
+            return;
+        };
+        let height = area.height.saturating_sub(2) as usize;
+        let lines = match std::fs::read_to_string(self.workspace.join(&entry.site_path)) {
+            Ok(content) => preview_lines(&content, entry.site_line, entry.site_end, height),
+            Err(e) => vec![Line::from(format!("Cannot read {}: {e}", entry.site_path))],
+        };
+        let title = format!(" {}:{} ", entry.site_path, entry.site_line);
+        frame.render_widget(
+            Paragraph::new(lines).block(Block::bordered().title(title)),
+            area,
+        );
+    }
+}
+
+impl Jump {
+    fn label(self) -> &'static str {
+        match self {
+            Self::Callers => "callers",
+            Self::Callees => "callees",
+            Self::References => "references",
+        }
+    }
+
+    fn title(self) -> &'static str {
+        match self {
+            Self::Callers => "Callers",
+            Self::Callees => "Callees",
+            Self::References => "References",
+        }
+    }
+}
+
+/// Numbered source lines starting a little above `start`, with the
+/// `start..=end` span highlighted.
+fn preview_lines(content: &str, start: u32, end: u32, height: usize) -> Vec<Line<'static>> {
+    let first = start.saturating_sub(3).max(1) as usize;
+    content
+        .lines()
+        .enumerate()
+        .skip(first - 1)
+        .take(height)
+        .map(|(index, text)| {
+            let number = index as u32 + 1;
+            let style = if (start..=end.max(start)).contains(&number) {
+                Style::new().fg(Color::Yellow)
+            } else {
+                Style::new()
+            };
+            Line::from(vec![
+                Span::styled(format!("{number:>5} "), Style::new().fg(Color::DarkGray)),
+                Span::styled(text.replace('\t', "    "), style),
+            ])
+        })
+        .collect()
+}
@@ -0,0 +1,143 @@
+use anyhow::{Context, Result};
+use cruxe_core::vcs;
+use cruxe_state::scip_upload::{self, UploadMetadata, UploadTarget};
+use std::io::IsTerminal;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::sync::atomic::{AtomicU64, Ordering};
+
+/// Token read when `--token` is not given, as by `src code-intel upload`.
+const TOKEN_ENV: &str = "SRC_ACCESS_TOKEN";
+
+#[derive(Debug)]
+pub struct UploadOptions<'a> {
+    pub endpoint: &'a str,
+    pub token: Option<&'a str>,
+    /// SCIP file to upload instead of exporting the index.
+    pub file: Option<&'a Path>,
+    pub repo: Option<&'a str>,
+    pub commit: Option<&'a str>,
+    pub root: &'a str,
+    pub attempts: u32,
+    pub r#ref: Option<&'a str>,
+}
+
+/// `cruxe upload`: push a SCIP index to Sourcegraph or a bucket. Without
+/// `--file`, the index of the workspace is exported first.
+pub fn run(
+    workspace: &Path,
+    options: &UploadOptions<'_>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let repository = match options.repo {
+        Some(repo) => repo.to_string(),
+        None => vcs::origin_repository_name(&workspace)
+            .map_err(|e| anyhow::anyhow!("Failed to read the origin remote: {}", e))?
+            .ok_or_else(|| {
+                anyhow::anyhow!("No `origin` remote to name the repository; pass --repo")
+            })?,
+    };
+    let commit = match options.commit {
+        Some(commit) => commit.to_string(),
+        None => vcs::list_ancestor_commits(&workspace, 1)
+            .map_err(|e| anyhow::anyhow!("Failed to resolve HEAD: {}", e))?
+            .into_iter()
+            .next()
+            .ok_or_else(|| anyhow::anyhow!("Repository has no commits; pass --commit"))?,
+    };
+
+    let staging = tempfile::tempdir().context("Failed to create staging directory")?;
+    let index: PathBuf = match options.file {
+        Some(file) => file.to_path_buf(),
+        None => {
+            let path = staging.path().join("index.scip");
+            super::export::run(
+                &workspace,
+                "scip",
+                Some(&path),
+                None,
+                &[],
+                false,
+                options.r#ref,
+                config_file,
+            )?;
+            path
+        }
+    };
+
+    let token = options
+        .token
+        .map(str::to_string)
+        .or_else(|| std::env::var(TOKEN_ENV).ok().filter(|t| !t.is_empty()));
+    let target = UploadTarget::from_endpoint(options.endpoint, token);
+    if matches!(&target, UploadTarget::Sourcegraph { token: None, .. }) {
+        eprintln!("warning: no --token or ${TOKEN_ENV}; uploading anonymously");
+    }
+    let metadata = UploadMetadata {
+        repository,
+        commit,
+        root: options.root.trim_matches('/').to_string(),
+        indexer_name: "cruxe".to_string(),
+        indexer_version: env!("CARGO_PKG_VERSION").to_string(),
+    };
+    let upload_options = scip_upload::UploadOptions {
+        attempts: options.attempts,
+        ..scip_upload::UploadOptions::default()
+    };
+
+    eprintln!(
+        "Uploading {} for {}@{}",
+        index.display(),
+        metadata.repository,
+        metadata.commit
+    );
+    let uploaded =
+        scip_upload::upload_index(&target, &index, &metadata, &upload_options, progress())
+            .with_context(|| format!("Failed to upload to {}", options.endpoint))?;
+    if std::io::stderr().is_terminal() {
+        eprintln!();
+    }
+
+    match target {
+        UploadTarget::Sourcegraph { endpoint, .. } => println!(
+            "Uploaded index {uploaded}: {endpoint}/{}/-/code-graph/uploads",
+            metadata.repository
+        ),
+        UploadTarget::Object(_) => println!("Uploaded index to {uploaded}"),
+    }
+    Ok(())
+}
+
+/// Progress on stderr: a line redrawn in place on a terminal, otherwise a
+/// line per 10% so CI logs stay short.
+fn progress() -> scip_upload::Progress {
+    let interactive = std::io::stderr().is_terminal();
+    let last_step = AtomicU64::new(u64::MAX);
+    Arc::new(move |sent, total| {
+        let percent = if total == 0 { 100 } else { sent * 100 / total };
+        let step = if interactive { percent } else { percent / 10 };
+        if last_step.swap(step, Ordering::Relaxed) == step {
+            return;
+        }
+        let line = format!(
+            "  {} / {} ({percent}%)",
+            format_size(sent),
+            format_size(total)
+        );
+        if interactive {
+            eprint!("\r{line}");
+        } else {
+            eprintln!("{line}");
+        }
+    })
+}
+
+fn format_size(bytes: u64) -> String {
+    const MIB: f64 = 1024.0 * 1024.0;
+    if bytes >= 1024 * 1024 {
+        format!("{:.1} MiB", bytes as f64 / MIB)
+    } else {
+        format!("{:.1} KiB", bytes as f64 / 1024.0)
+    }
+}
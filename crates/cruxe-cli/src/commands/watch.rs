@@ -0,0 +1,228 @@
+use anyhow::{Context, Result};
+use cruxe_core::cancel::CancellationToken;
+use cruxe_core::config::Config;
+use cruxe_mcp::daemon::{Debounce, workspace_fingerprint};
+use std::path::Path;
+use std::process::{Command, Stdio};
+use std::time::{Duration, Instant};
+
+/// Outputs larger than this many lines on both sides are diffed by a plain
+/// set comparison instead of the quadratic LCS table.
+const MAX_LCS_LINES: usize = 4000;
+
+/// `cruxe watch`: re-index incrementally whenever the workspace settles after
+/// a change, then re-run `exec` (a cruxe subcommand line) and print how its
+/// output differs from the previous run.
+pub fn run(
+    workspace: &Path,
+    exec: &str,
+    interval: Duration,
+    config_file: Option<&Path>,
+    cancel: &CancellationToken,
+) -> Result<()> {
+    let args = split_command(exec).map_err(|e| anyhow::anyhow!("Invalid --exec: {}", e))?;
+    let args = match args.first().map(String::as_str) {
+        Some("cruxe") => args[1..].to_vec(),
+        _ => args,
+    };
+    match args.first().map(String::as_str) {
+        None => anyhow::bail!("--exec needs a cruxe subcommand, e.g. --exec 'deadcode'"),
+        Some("watch" | "tui" | "daemon" | "serve-mcp") => {
+            anyhow::bail!("`{}` does not exit and cannot be re-run by watch", args[0])
+        }
+        Some(_) => {}
+    }
+
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let exe = std::env::current_exe().context("Failed to locate the cruxe executable")?;
+    let fingerprint = || {
+        workspace_fingerprint(
+            &workspace,
+            config.index.max_file_size,
+            &config.index.languages,
+            config.index.symlink_policy(),
+        )
+    };
+
+    eprintln!(
+        "Watching {} (every {}ms); re-running `cruxe {}` after each change. Ctrl-C stops.",
+        workspace.display(),
+        interval.as_millis(),
+        args.join(" ")
+    );
+    let mut debounce = Debounce::new(fingerprint());
+    let mut previous: Option<String> = None;
+    let mut run = 1;
+    loop {
+        let started = Instant::now();
+        sync(&exe, &workspace, config_file)?;
+        let synced_ms = started.elapsed().as_millis();
+        let output = execute(&exe, &workspace, &args, config_file)?;
+
+        match &previous {
+            None => {
+                eprintln!("-- run {run} (sync {synced_ms}ms) --");
+                print!("{output}");
+            }
+            Some(previous) if *previous == output => {
+                eprintln!("-- run {run} (sync {synced_ms}ms): output unchanged --");
+            }
+            Some(previous) => {
+                eprintln!("-- run {run} (sync {synced_ms}ms): output changed --");
+                for line in diff_lines(previous, &output) {
+                    println!("{line}");
+                }
+            }
+        }
+        previous = Some(output);
+        run += 1;
+
+        loop {
+            if cancel.is_cancelled() {
+                return Ok(());
+            }
+            std::thread::sleep(interval);
+            if debounce.observe(fingerprint(), Instant::now(), interval) {
+                break;
+            }
+        }
+    }
+}
+
+/// Incremental `cruxe index`; unchanged files are skipped by the manifest.
+fn sync(exe: &Path, workspace: &Path, config_file: Option<&Path>) -> Result<()> {
+    let mut cmd = Command::new(exe);
+    cmd.arg("index").arg("--path").arg(workspace);
+    if let Some(config_file) = config_file {
+        cmd.arg("--config").arg(config_file);
+    }
+    let output = cmd
+        .stdout(Stdio::null())
+        .stderr(Stdio::piped())
+        .output()
+        .context("Failed to run cruxe index")?;
+    if !output.status.success() {
+        eprintln!(
+            "cruxe index failed ({}); results may be stale:\n{}",
+            output.status,
+            String::from_utf8_lossy(&output.stderr).trim_end()
+        );
+    }
+    Ok(())
+}
+
+/// Run the watched subcommand; stderr passes through, stdout is captured.
+fn execute(
+    exe: &Path,
+    workspace: &Path,
+    args: &[String],
+    config_file: Option<&Path>,
+) -> Result<String> {
+    let mut cmd = Command::new(exe);
+    if let Some(config_file) = config_file {
+        cmd.arg("--config").arg(config_file);
+    }
+    let output = cmd
+        .args(args)
+        .current_dir(workspace)
+        .stderr(Stdio::inherit())
+        .output()
+        .with_context(|| format!("Failed to run cruxe {}", args.join(" ")))?;
+    if !output.status.success() {
+        eprintln!("cruxe {} exited with {}", args.join(" "), output.status);
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+/// Split a command line on whitespace, honouring single and double quotes
+/// and backslash escapes outside single quotes.
+fn split_command(line: &str) -> Result<Vec<String>, String> {
+    let mut args = Vec::new();
+    let mut current = String::new();
+    let mut in_arg = false;
+    let mut quote: Option<char> = None;
+    let mut chars = line.chars();
+    while let Some(c) = chars.next() {
+        match (quote, c) {
+            (Some(q), c) if c == q => quote = None,
+            (Some('\''), c) => current.push(c),
+            (_, '\\') => match chars.next() {
+                Some(escaped) => {
+                    current.push(escaped);
+                    in_arg = true;
+                }
+                None => return Err("trailing backslash".to_string()),
+            },
+            (Some(_), c) => current.push(c),
+            (None, '\'' | '"') => {
+                quote = Some(c);
+                in_arg = true;
+            }
+            (None, c) if c.is_whitespace() => {
+                if in_arg {
+                    args.push(std::mem::take(&mut current));
+                    in_arg = false;
+                }
+            }
+            (None, c) => {
+                current.push(c);
+                in_arg = true;
+            }
+        }
+    }
+    if quote.is_some() {
+        return Err("unterminated quote".to_string());
+    }
+    if in_arg {
+        args.push(current);
+    }
+    Ok(args)
+}
+
+/// Unified-style line diff (`-` removed, `+` added) without context lines.
+fn diff_lines(old: &str, new: &str) -> Vec<String> {
+    let old: Vec<&str> = old.lines().collect();
+    let new: Vec<&str> = new.lines().collect();
+    if old.len() > MAX_LCS_LINES || new.len() > MAX_LCS_LINES {
+        let old_set: std::collections::HashSet<&str> = old.iter().copied().collect();
+        let new_set: std::collections::HashSet<&str> = new.iter().copied().collect();
+        return old
+            .iter()
+            .filter(|line| !new_set.contains(*line))
+            .map(|line| format!("- {line}"))
+            .chain(
+                new.iter()
+                    .filter(|line| !old_set.contains(*line))
+                    .map(|line| format!("+ {line}")),
+            )
+            .collect();
+    }
+
+    // lcs[i][j]: longest common subsequence of old[i..] and new[j..].
+    let mut lcs = vec![vec![0usize; new.len() + 1]; old.len() + 1];
+    for i in (0..old.len()).rev() {
+        for j in (0..new.len()).rev() {
+            lcs[i][j] = if old[i] == new[j] {
+                lcs[i + 1][j + 1] + 1
+            } else {
+                lcs[i + 1][j].max(lcs[i][j + 1])
+            };
+        }
+    }
+    let (mut i, mut j) = (0, 0);
+    let mut out = Vec::new();
+    while i < old.len() || j < new.len() {
+        if i < old.len() && j < new.len() && old[i] == new[j] {
+            i += 1;
+            j += 1;
+        } else if i < old.len() && (j == new.len() || lcs[i + 1][j] >= lcs[i][j + 1]) {
+            out.push(format!("- {}", old[i]));
+            i += 1;
+        } else {
+            out.push(format!("+ {}", new[j]));
+            j += 1;
+        }
+    }
+    out
+}
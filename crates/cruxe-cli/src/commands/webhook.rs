@@ -0,0 +1,131 @@
+use cruxe_core::config::Config;
+use cruxe_query::findings::{self, Finding, RuleSet};
+use rusqlite::Connection;
+use serde::Serialize;
+use std::collections::HashSet;
+use std::time::Duration;
+
+const WEBHOOK_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// `event` of every index summary, for receivers that share a URL with other
+/// senders.
+pub const INDEX_COMPLETED: &str = "index.completed";
+
+/// At most this many findings are sent inline; `findings.new` still counts
+/// them all.
+const MAX_FINDINGS: usize = 100;
+
+/// What `[index] webhooks` receive when a `cruxe index` run ends.
+#[derive(Debug, Serialize)]
+pub struct IndexCompleted {
+    pub event: &'static str,
+    /// `published`, `failed` or `interrupted`.
+    pub status: &'static str,
+    pub project_id: String,
+    pub workspace: String,
+    #[serde(rename = "ref")]
+    pub r#ref: String,
+    pub commit: Option<String>,
+    pub job_id: String,
+    /// `full`, `incremental` or `overlay`.
+    pub mode: String,
+    pub duration_ms: u64,
+    pub files: FileCounts,
+    pub symbols: SymbolCounts,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub findings: Option<NewFindings>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+#[derive(Debug, Default, Serialize)]
+pub struct FileCounts {
+    pub indexed: u64,
+    pub skipped: u64,
+    pub changed: u64,
+    /// Files in the index of the ref after the run.
+    pub total: u64,
+}
+
+#[derive(Debug, Default, Serialize)]
+pub struct SymbolCounts {
+    /// Symbols extracted by this run.
+    pub extracted: u64,
+    /// Symbols in the index of the ref after the run.
+    pub total: u64,
+}
+
+/// Findings of `cruxe check`'s configured rules in the files this run
+/// changed; a finding is only new to a file the run reindexed.
+#[derive(Debug, Serialize)]
+pub struct NewFindings {
+    pub total: usize,
+    pub new: usize,
+    pub items: Vec<Finding>,
+}
+
+/// Findings in `changed_paths`, or `None` when checks cannot run.
+pub fn new_findings(
+    conn: &Connection,
+    config: &Config,
+    project_id: &str,
+    ref_name: &str,
+    changed_paths: &[String],
+) -> Option<NewFindings> {
+    let profile = match super::check::resolve_profile(None, config) {
+        Ok(profile) => profile,
+        Err(e) => {
+            eprintln!("warning: webhook findings skipped: {e}");
+            return None;
+        }
+    };
+    let rule_set =
+        RuleSet::from_config(&config.rules, profile.unwrap_or_default()).with_taint(&config.taint);
+    let all = match findings::run_checks(conn, project_id, ref_name, &rule_set) {
+        Ok(all) => all,
+        Err(e) => {
+            eprintln!("warning: webhook findings skipped: {e}");
+            return None;
+        }
+    };
+    let changed: HashSet<&str> = changed_paths.iter().map(String::as_str).collect();
+    let new: Vec<Finding> = all
+        .iter()
+        .filter(|finding| changed.contains(finding.path.as_str()))
+        .cloned()
+        .collect();
+    Some(NewFindings {
+        total: all.len(),
+        new: new.len(),
+        items: new.into_iter().take(MAX_FINDINGS).collect(),
+    })
+}
+
+/// POST `event` to every URL. Delivery failures are warnings: the index
+/// itself is done by now and must not be reported as failed.
+pub fn notify(urls: &[String], event: &IndexCompleted) {
+    if urls.is_empty() {
+        return;
+    }
+    let client = match reqwest::blocking::Client::builder()
+        .timeout(WEBHOOK_TIMEOUT)
+        .build()
+    {
+        Ok(client) => client,
+        Err(e) => {
+            eprintln!("warning: failed to create webhook client: {e}");
+            return;
+        }
+    };
+    for url in urls {
+        match client
+            .post(url)
+            .json(event)
+            .send()
+            .and_then(|response| response.error_for_status())
+        {
+            Ok(_) => eprintln!("Notified {url}"),
+            Err(e) => eprintln!("warning: webhook {url} failed: {e}"),
+        }
+    }
+}
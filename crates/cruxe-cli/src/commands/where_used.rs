@@ -0,0 +1,93 @@
+use anyhow::{Context, Result};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_core::vcs;
+use cruxe_query::where_used::{self, WhereUsedOptions, WhereUsedReport};
+use cruxe_state::{db, project};
+use std::path::Path;
+
+/// `cruxe where-used --literal`: every site of a constant value or string
+/// literal, and the uses of the constants holding it.
+pub fn run(
+    workspace: &Path,
+    mut options: WhereUsedOptions,
+    format: &str,
+    r#ref: Option<&str>,
+    config_file: Option<&Path>,
+) -> Result<()> {
+    let workspace = std::fs::canonicalize(workspace).context("Failed to resolve workspace path")?;
+    let workspace_str = workspace.to_string_lossy().to_string();
+    let config = Config::load_with_file(Some(&workspace), config_file)?;
+    let project_id = generate_project_id(&workspace_str);
+    let db_path = config
+        .project_data_dir(&project_id)
+        .join(constants::STATE_DB_FILE);
+    let conn = db::open_for_query(
+        &db_path,
+        config.storage.busy_timeout_ms,
+        config.storage.cache_size,
+        config.storage.mmap_size,
+    )
+    .map_err(|e| anyhow::anyhow!("Failed to open state DB: {}", e))?;
+    let proj = project::get_by_root(&conn, &workspace_str)?
+        .ok_or_else(|| anyhow::anyhow!("Project not initialized. Run `cruxe init` first."))?;
+    let resolved_ref = vcs::resolve_effective_ref(&workspace, r#ref, &proj.default_ref);
+    options.scope = super::scope::path_scope(&config, &workspace)?;
+
+    let report = where_used::where_used(&conn, &workspace, &project_id, &resolved_ref, &options)
+        .map_err(|e| anyhow::anyhow!("Literal lookup failed: {}", e))?;
+    super::render::render_records(format, &report, &report.sites, print_report)
+}
+
+fn print_report(report: &WhereUsedReport) {
+    if report.sites.is_empty() {
+        println!(
+            "No literal {:?} on ref {}.",
+            report.literal, report.ref_name
+        );
+        return;
+    }
+    for site in &report.sites {
+        let role = if site.defines { "defines " } else { "in " };
+        println!(
+            "{:<9} {:<40} {:?}{}",
+            site.kind,
+            format!("{}:{}", site.path, site.line),
+            site.value,
+            site.symbol
+                .as_deref()
+                .map(|symbol| format!("  {role}{symbol}"))
+                .unwrap_or_default()
+        );
+    }
+    if !report.constant_uses.is_empty() {
+        println!();
+        for usage in &report.constant_uses {
+            println!(
+                "{:<9} {:<40} {}{}",
+                usage.kind.as_str(),
+                format!("{}:{}:{}", usage.path, usage.line, usage.column),
+                usage.constant,
+                usage
+                    .enclosing
+                    .as_deref()
+                    .map(|symbol| format!("  in {symbol}"))
+                    .unwrap_or_default()
+            );
+        }
+    }
+    let counts: Vec<String> = report
+        .by_kind
+        .iter()
+        .map(|(kind, count)| format!("{count} {kind}"))
+        .collect();
+    println!();
+    println!(
+        "{} site(s) and {} use(s) through constants on ref {}: {}",
+        report.total,
+        report.constant_uses.len(),
+        report.ref_name,
+        counts.join(", ")
+    );
+}
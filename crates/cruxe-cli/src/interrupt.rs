@@ -0,0 +1,133 @@
+use cruxe_core::cancel::{CancellationToken, Cancelled};
+use std::time::Duration;
+use tracing::warn;
+
+/// Exit code of an interrupted run (128 + SIGINT), also when a second
+/// interrupt forces an immediate exit.
+const INTERRUPTED_EXIT_CODE: i32 = 130;
+
+/// Exit code of a run that hit `--timeout`, as with timeout(1).
+const TIMED_OUT_EXIT_CODE: i32 = 124;
+
+/// Time a command that stops cooperatively gets past `--timeout` to reach
+/// its next safe point before the process is ended anyway.
+pub const STOP_GRACE: Duration = Duration::from_secs(30);
+
+/// Install SIGINT/SIGTERM handling for long-running commands.
+///
+/// The first signal cancels the returned token so the command can stop at its
+/// next safe point and leave the index consistent. A second signal exits
+/// immediately.
+pub fn install() -> CancellationToken {
+    let token = CancellationToken::new();
+    let handler_token = token.clone();
+    let spawned = std::thread::Builder::new()
+        .name("cruxe-interrupt".into())
+        .spawn(move || {
+            let runtime = match tokio::runtime::Builder::new_current_thread()
+                .enable_all()
+                .build()
+            {
+                Ok(runtime) => runtime,
+                Err(err) => {
+                    warn!("Failed to start interrupt handler: {}", err);
+                    return;
+                }
+            };
+            runtime.block_on(async move {
+                if wait_for_signal().await.is_err() {
+                    return;
+                }
+                eprintln!(
+                    "\nInterrupt received; finishing current batch (press Ctrl-C again to abort)..."
+                );
+                handler_token.cancel();
+                if wait_for_signal().await.is_ok() {
+                    std::process::exit(INTERRUPTED_EXIT_CODE);
+                }
+            });
+        });
+    if let Err(err) = spawned {
+        warn!("Failed to spawn interrupt handler: {}", err);
+    }
+    token
+}
+
+/// End the process `timeout + grace` after now. Read-only commands get no
+/// grace: there is nothing to leave consistent. Commands that poll their
+/// token get `grace` to stop on their own; past it, the next index run
+/// repairs what they left half-written, as after a crash.
+pub fn arm_deadline(timeout: Duration, grace: Duration) {
+    let spawned = std::thread::Builder::new()
+        .name("cruxe-deadline".into())
+        .spawn(move || {
+            std::thread::sleep(timeout + grace);
+            if grace.is_zero() {
+                eprintln!("Timed out after {} (--timeout).", seconds(timeout));
+            } else {
+                eprintln!(
+                    "Timed out after {} (--timeout) and did not stop within {}; \
+                     the next `cruxe index` repairs any partial writes.",
+                    seconds(timeout),
+                    seconds(grace)
+                );
+            }
+            std::process::exit(TIMED_OUT_EXIT_CODE);
+        });
+    if let Err(err) = spawned {
+        warn!("Failed to spawn deadline watchdog: {}", err);
+    }
+}
+
+/// What to tell the user when a command stopped early at a safe point.
+pub fn stopped_message(cancelled: Cancelled, timeout: Option<Duration>) -> String {
+    let kept = "Work finished before then is kept and consistent; \
+                run the command again to continue from there.";
+    match (cancelled, timeout) {
+        (Cancelled::DeadlineExceeded, Some(timeout)) => {
+            format!("Timed out after {} (--timeout). {kept}", seconds(timeout))
+        }
+        (Cancelled::DeadlineExceeded, None) => format!("Timed out. {kept}"),
+        (Cancelled::Requested, _) => format!("Interrupted. {kept}"),
+    }
+}
+
+pub fn exit_code(cancelled: Cancelled) -> i32 {
+    match cancelled {
+        Cancelled::Requested => INTERRUPTED_EXIT_CODE,
+        Cancelled::DeadlineExceeded => TIMED_OUT_EXIT_CODE,
+    }
+}
+
+fn seconds(duration: Duration) -> String {
+    format!("{}s", duration.as_secs())
+}
+
+#[cfg(unix)]
+async fn wait_for_signal() -> std::io::Result<()> {
+    use tokio::signal::unix::{SignalKind, signal};
+    let mut terminate = signal(SignalKind::terminate())?;
+    tokio::select! {
+        result = tokio::signal::ctrl_c() => result,
+        _ = terminate.recv() => Ok(()),
+    }
+}
+
+#[cfg(not(unix))]
+async fn wait_for_signal() -> std::io::Result<()> {
+    tokio::signal::ctrl_c().await
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn stopped_runs_say_why_and_exit_like_timeout_and_sigint() {
+        let message = stopped_message(Cancelled::DeadlineExceeded, Some(Duration::from_secs(90)));
+        assert!(message.starts_with("Timed out after 90s (--timeout). Work finished"));
+        assert!(stopped_message(Cancelled::Requested, None).starts_with("Interrupted. "));
+        assert_eq!(exit_code(Cancelled::DeadlineExceeded), 124);
+        assert_eq!(exit_code(Cancelled::Requested), 130);
+    }
+}
@@ -0,0 +1,179 @@
+//! `--log-level` and `--log-format`: which events are logged and how.
+//!
+//! `json` writes one object per event to stderr with `timestamp`, `level`,
+//! `target`, `message`, the names of the enclosing `spans` and every field
+//! of the event, so per-file warnings can be filtered on their `code`
+//! ([`cruxe_core::error::LogCode`]) and `path`.
+
+use clap::ValueEnum;
+use cruxe_core::time::now_iso8601;
+use serde_json::{Map, Value};
+use tracing::field::{Field, Visit};
+use tracing::{Event, Subscriber};
+use tracing_subscriber::EnvFilter;
+use tracing_subscriber::fmt::format::Writer;
+use tracing_subscriber::fmt::{FmtContext, FormatEvent, FormatFields};
+use tracing_subscriber::registry::LookupSpan;
+
+#[derive(Debug, Clone, Copy, ValueEnum, PartialEq, Eq)]
+pub enum LogLevel {
+    Error,
+    Warn,
+    Info,
+    Debug,
+    Trace,
+}
+
+impl LogLevel {
+    fn as_str(self) -> &'static str {
+        match self {
+            Self::Error => "error",
+            Self::Warn => "warn",
+            Self::Info => "info",
+            Self::Debug => "debug",
+            Self::Trace => "trace",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, Default, ValueEnum, PartialEq, Eq)]
+pub enum LogFormat {
+    /// Human-readable lines
+    #[default]
+    Text,
+    /// One JSON object per event, on stderr
+    Json,
+}
+
+/// `--log-level` wins, then `RUST_LOG`, then `--verbose` (debug) or info.
+pub fn filter(level: Option<LogLevel>, verbose: bool) -> EnvFilter {
+    if let Some(level) = level {
+        return EnvFilter::new(level.as_str());
+    }
+    EnvFilter::try_from_default_env()
+        .unwrap_or_else(|_| EnvFilter::new(if verbose { "debug" } else { "info" }))
+}
+
+/// Event formatter of `--log-format json`.
+pub struct JsonFormat;
+
+impl<S, N> FormatEvent<S, N> for JsonFormat
+where
+    S: Subscriber + for<'a> LookupSpan<'a>,
+    N: for<'a> FormatFields<'a> + 'static,
+{
+    fn format_event(
+        &self,
+        ctx: &FmtContext<'_, S, N>,
+        mut writer: Writer<'_>,
+        event: &Event<'_>,
+    ) -> std::fmt::Result {
+        let metadata = event.metadata();
+        let mut fields = Map::new();
+        event.record(&mut JsonFields(&mut fields));
+
+        let mut line = Map::new();
+        line.insert("timestamp".into(), now_iso8601().into());
+        line.insert(
+            "level".into(),
+            metadata.level().as_str().to_ascii_lowercase().into(),
+        );
+        line.insert("target".into(), metadata.target().into());
+        if let Some(message) = fields.remove("message") {
+            line.insert("message".into(), message);
+        }
+        if let Some(scope) = ctx.event_scope() {
+            let spans: Vec<Value> = scope.from_root().map(|span| span.name().into()).collect();
+            line.insert("spans".into(), spans.into());
+        }
+        line.extend(fields);
+        let json = serde_json::to_string(&Value::Object(line)).map_err(|_| std::fmt::Error)?;
+        writeln!(writer, "{json}")
+    }
+}
+
+/// Collects the fields of an event as JSON values.
+struct JsonFields<'a>(&'a mut Map<String, Value>);
+
+impl Visit for JsonFields<'_> {
+    fn record_debug(&mut self, field: &Field, value: &dyn std::fmt::Debug) {
+        self.0
+            .insert(field.name().to_string(), format!("{value:?}").into());
+    }
+
+    fn record_str(&mut self, field: &Field, value: &str) {
+        self.0.insert(field.name().to_string(), value.into());
+    }
+
+    fn record_i64(&mut self, field: &Field, value: i64) {
+        self.0.insert(field.name().to_string(), value.into());
+    }
+
+    fn record_u64(&mut self, field: &Field, value: u64) {
+        self.0.insert(field.name().to_string(), value.into());
+    }
+
+    fn record_f64(&mut self, field: &Field, value: f64) {
+        self.0.insert(field.name().to_string(), value.into());
+    }
+
+    fn record_bool(&mut self, field: &Field, value: bool) {
+        self.0.insert(field.name().to_string(), value.into());
+    }
+
+    fn record_error(&mut self, field: &Field, value: &(dyn std::error::Error + 'static)) {
+        self.0
+            .insert(field.name().to_string(), value.to_string().into());
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::error::LogCode;
+    use std::sync::{Arc, Mutex};
+
+    #[derive(Clone, Default)]
+    struct Buffer(Arc<Mutex<Vec<u8>>>);
+
+    impl std::io::Write for Buffer {
+        fn write(&mut self, bytes: &[u8]) -> std::io::Result<usize> {
+            self.0.lock().unwrap().write(bytes)
+        }
+
+        fn flush(&mut self) -> std::io::Result<()> {
+            Ok(())
+        }
+    }
+
+    #[test]
+    fn json_format_writes_one_object_per_event() {
+        let buffer = Buffer::default();
+        let writer = buffer.clone();
+        let subscriber = tracing_subscriber::fmt()
+            .event_format(JsonFormat)
+            .with_writer(move || writer.clone())
+            .finish();
+        tracing::subscriber::with_default(subscriber, || {
+            let _span = tracing::info_span!("index.parse_write").entered();
+            tracing::warn!(
+                code = LogCode::ParseFailed.as_str(),
+                path = %"auth/token.go",
+                size = 42u64,
+                "Parse failed"
+            );
+        });
+
+        let output = String::from_utf8(buffer.0.lock().unwrap().clone()).unwrap();
+        let lines: Vec<&str> = output.lines().collect();
+        assert_eq!(lines.len(), 1);
+        let event: Value = serde_json::from_str(lines[0]).unwrap();
+        assert_eq!(event["level"], "warn");
+        assert_eq!(event["message"], "Parse failed");
+        assert_eq!(event["code"], "parse_failed");
+        assert_eq!(event["path"], "auth/token.go");
+        assert_eq!(event["size"], 42);
+        assert_eq!(event["spans"], serde_json::json!(["index.parse_write"]));
+        assert!(event["timestamp"].is_string());
+    }
+}
@@ -1,7 +1,13 @@
 mod commands;
+mod interrupt;
+mod logging;
+mod otel;
+mod progress;
+mod style;
 
-use clap::{Parser, Subcommand, ValueEnum};
-use tracing_subscriber::EnvFilter;
+use clap::{CommandFactory, FromArgMatches, Parser, Subcommand, ValueEnum};
+use tracing_subscriber::layer::SubscriberExt;
+use tracing_subscriber::util::SubscriberInitExt;
 
 #[derive(Parser)]
 #[command(
@@ -22,17 +28,96 @@ struct Cli {
     #[arg(short, long, global = true)]
     verbose: bool,
 
+    /// Log level; overrides --verbose and RUST_LOG
+    #[arg(long, global = true, value_enum, value_name = "LEVEL")]
+    log_level: Option<logging::LogLevel>,
+
+    /// Log format: text, or json for one object per event on stderr with
+    /// level, message, spans and fields such as a warning's stable `code`
+    #[arg(
+        long,
+        global = true,
+        value_enum,
+        value_name = "FORMAT",
+        default_value = "text"
+    )]
+    log_format: logging::LogFormat,
+
+    /// Print results as bare fixed-width columns, without colors or
+    /// snippets (for scripts and diffs)
+    #[arg(long, global = true)]
+    plain: bool,
+
+    /// Never color the output; colors are also off when NO_COLOR is set or
+    /// stdout is not a terminal
+    #[arg(long, global = true)]
+    no_color: bool,
+
+    /// Color theme of the output
+    #[arg(
+        long,
+        global = true,
+        value_enum,
+        value_name = "THEME",
+        default_value = "dark"
+    )]
+    theme: style::ThemeName,
+
     /// Path to config file (default: .cruxe/config.toml)
     #[arg(long, global = true)]
     config: Option<String>,
 
+    /// Only index and analyze files matching this glob, e.g.
+    /// 'services/payments/**' (repeatable; `*` stays within a directory and
+    /// `**` spans any number; replaces `[index] include`)
+    #[arg(long, global = true, value_name = "GLOB")]
+    include: Vec<String>,
+
+    /// Skip files matching this glob when indexing and analyzing
+    /// (repeatable; replaces `[index] exclude`)
+    #[arg(long, global = true, value_name = "GLOB")]
+    exclude: Vec<String>,
+
+    /// Only index and analyze files of this monorepo project, by name or
+    /// directory as listed by `cruxe projects` (repeatable)
+    #[arg(long, global = true, value_name = "NAME")]
+    project: Vec<String>,
+
+    /// Only index and analyze the Go files compiled by this
+    /// `[[build.configurations]]` entry (GOOS, GOARCH and build tags)
+    #[arg(long, global = true, value_name = "NAME")]
+    build: Option<String>,
+
+    /// Print run statistics (phase timings, cache hits and misses, files
+    /// reparsed vs reused, peak memory) to stderr when the command exits
+    #[arg(long, global = true, value_enum, value_name = "FORMAT")]
+    stats: Option<StatsFormat>,
+
+    /// Give up after N seconds. Indexing, sync and embedding stop at their
+    /// next safe point and keep what they finished (like Ctrl-C); other
+    /// commands exit right away. The exit code is then 124
+    #[arg(long = "timeout", global = true, value_name = "SECS")]
+    timeout_secs: Option<u64>,
+
+    /// Export tracing spans of the run (per phase and per file while
+    /// indexing) over OTLP/HTTP to this collector, e.g. http://localhost:4318
+    #[arg(long, global = true, value_name = "URL")]
+    otlp_endpoint: Option<String>,
+
     #[command(subcommand)]
     command: Commands,
 }
 
+#[derive(Debug, Clone, Copy, ValueEnum, PartialEq, Eq)]
+enum StatsFormat {
+    Json,
+}
+
 #[derive(Debug, Clone, Copy, ValueEnum, PartialEq, Eq)]
 enum McpTransport {
     Stdio,
+    /// JSON-RPC over `POST /`, plus MCP's HTTP+SSE transport on `/sse`
+    #[value(alias = "sse")]
     Http,
 }
 
@@ -48,28 +133,89 @@ enum Commands {
         /// Path to the project root (default: current directory)
         #[arg(short, long)]
         path: Option<String>,
+
+        /// Write a starter .cruxe/config.toml for a workflow
+        #[arg(long, value_parser = ["security-audit", "architecture", "llm-context"])]
+        template: Option<String>,
+
+        /// Replace an existing .cruxe/config.toml with the template
+        #[arg(long, requires = "template")]
+        force: bool,
     },
     /// Check project health and diagnose issues
     ///
-    /// Verifies SQLite integrity, Tantivy index accessibility,
-    /// tree-sitter grammar availability, and ignore rule configuration.
+    /// Verifies SQLite integrity, Tantivy index accessibility, index
+    /// consistency (dangling edges, orphaned symbols, working-tree hash
+    /// drift, version skew), tree-sitter grammar availability, and ignore
+    /// rule configuration.
     ///
-    /// Example: cruxe doctor
+    /// Examples:
+    ///   cruxe doctor
+    ///   cruxe doctor --repair
     Doctor {
         /// Path to the project root (default: current directory)
         #[arg(short, long)]
         path: Option<String>,
+
+        /// Drop inconsistent rows and invalidate affected files so the next
+        /// `cruxe index` rebuilds only those
+        #[arg(long)]
+        repair: bool,
+    },
+    /// Show what `cruxe index` would cover, without indexing
+    ///
+    /// Scans the workspace under the same configuration, ignore rules,
+    /// include/exclude scope and limits as an index run. Every file left
+    /// out is listed with the reason: ignored, out of scope, unsupported,
+    /// language disabled, too large, long lines, binary or unreadable. The
+    /// index size and build time are estimated roughly.
+    ///
+    /// Examples:
+    ///   cruxe preflight
+    ///   cruxe preflight --explain internal/gen/api.go
+    ///   cruxe preflight --no-ignore --format json
+    Preflight {
+        /// Path to the project root (default: current directory)
+        path: Option<String>,
+
+        /// Only say whether this file would be indexed, and why not
+        /// (repeatable)
+        #[arg(long, value_name = "FILE")]
+        explain: Vec<String>,
+
+        /// Scan files listed in .gitignore and .cruxeignore too, as
+        /// `cruxe index --no-ignore` does
+        #[arg(long)]
+        no_ignore: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
     },
     /// Index a project's source code
     ///
     /// Scans source files, extracts symbols via tree-sitter, and populates
     /// Tantivy search indices. Uses content hashing for incremental updates.
+    /// `--ref` naming a branch, tag or commit other than the checked-out
+    /// branch reads it from the git object database, leaving the working
+    /// tree untouched.
     ///
     /// Examples:
     ///   cruxe index
     ///   cruxe index --force
     ///   cruxe index --ref feat/auth
+    ///   cruxe index --ref v1.4.0
+    ///   cruxe index --format pb --output index.pb
+    ///   cruxe index --bodies=false
+    ///   cruxe index --no-ignore
+    ///   cruxe index --submodules
+    ///   cruxe index https://github.com/org/repo@v1.2.0
     Index {
+        /// Repository URL, optionally with `@ref`, to clone shallowly into
+        /// the data directory and index there
+        #[arg(value_name = "URL", conflicts_with_all = ["path", "ref", "shard"])]
+        url: Option<String>,
+
         /// Path to the project root (default: current directory)
         #[arg(short, long)]
         path: Option<String>,
@@ -78,9 +224,63 @@ enum Commands {
         #[arg(long)]
         force: bool,
 
-        /// Ref/branch to index under (default: auto-detect or "live")
+        /// Ref to index (default: the checked-out branch or "live"); another
+        /// branch, tag or commit is read from git without a checkout
         #[arg(long)]
         r#ref: Option<String>,
+
+        /// Also write the index as a versioned binary file (pb: protobuf,
+        /// schema in docs/reference/cruxe-index.proto)
+        #[arg(long, value_parser = ["pb"])]
+        format: Option<String>,
+
+        /// Binary index path (default: index.pb in the project data directory)
+        #[arg(short, long, requires = "format")]
+        output: Option<String>,
+
+        /// Compress the binary index with zstd (implied by a .zst output path)
+        #[arg(long, requires = "format")]
+        compress: bool,
+
+        /// Parse worker threads (default: CRUXE_INDEX_PARALLELISM or all cores)
+        #[arg(short, long)]
+        jobs: Option<usize>,
+
+        /// Memory budget such as 2G; edge buffers beyond it spill to disk
+        /// (default: CRUXE_INDEX_MAX_MEMORY or unbounded)
+        #[arg(long, value_name = "SIZE")]
+        max_memory: Option<String>,
+
+        /// Build only this `[shards.<name>]` module into its own shard
+        #[arg(long, value_name = "NAME", conflicts_with = "ref")]
+        shard: Option<String>,
+
+        /// Index function bodies; `--bodies=false` keeps only declarations,
+        /// signatures and doc comments for a smaller, faster index
+        /// (default: the mode the ref was last indexed with)
+        #[arg(long, value_name = "BOOL", num_args = 0..=1, default_missing_value = "true")]
+        bodies: Option<bool>,
+
+        /// Also index files listed in .gitignore and .cruxeignore (built-in
+        /// ignores such as node_modules and vendor still apply)
+        #[arg(long)]
+        no_ignore: bool,
+
+        /// Descend into initialized git submodules, tagging their symbols
+        /// with the submodule (default: `[index] submodules`)
+        #[arg(long)]
+        submodules: bool,
+
+        /// Symbolic links to follow: skip, follow, or follow-within-root
+        /// (those leading inside the repository); a file reachable under
+        /// several paths is indexed once (default: `[index] symlinks`)
+        #[arg(long, value_name = "POLICY", value_parser = ["skip", "follow", "follow-within-root"])]
+        symlinks: Option<String>,
+
+        /// Progress on stderr: phase, files done and ETA (auto: redrawn on a
+        /// terminal, plain lines otherwise; json: one event per line)
+        #[arg(long, value_enum, value_name = "MODE", default_value = "auto")]
+        progress: progress::ProgressMode,
     },
     /// Search code in the index
     ///
@@ -92,9 +292,26 @@ enum Commands {
     ///   cruxe search "src/auth/handler.rs"
     ///   cruxe search "connection refused" --lang rust
     ///   cruxe search "AuthHandler" --ref main --limit 5
+    ///   cruxe search hGU --kind func,method --package internal/api
+    ///   cruxe search "graceful shutdown" --docs
+    ///   cruxe search --sig 'func(*handlers.Request) *handlers.Response'
+    ///   cruxe search --sig 'func(context.Context, ..) (_, error)'
+    ///
+    /// When an identifier-like query finds fewer than --limit results, fuzzy
+    /// symbol-name matches fill in, including camel humps (`hGU` finds
+    /// `handleGetUser`). `--docs` matches only
+    /// doc comments and comments in code, and returns the symbols they
+    /// document or sit in. `--sig` matches functions and methods by their
+    /// parameter and result types instead of a query: `_` is any one type,
+    /// `..` any number of them, and `*` inside a name any run of characters.
     Search {
         /// Search query (symbol name, file path, error string, or natural language)
-        query: String,
+        #[arg(required_unless_present = "sig")]
+        query: Option<String>,
+
+        /// Match functions by type signature, e.g. 'func(*pkg.Request) error'
+        #[arg(long, value_name = "SIGNATURE", conflicts_with_all = ["query", "in_docs", "federated"])]
+        sig: Option<String>,
 
         /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
@@ -104,390 +321,5842 @@ enum Commands {
         #[arg(long)]
         lang: Option<String>,
 
+        /// Only these symbol kinds, comma-separated (func, method, type, ...)
+        #[arg(long, value_name = "KINDS")]
+        kind: Option<String>,
+
+        /// Only symbols under this directory or qualified-name prefix
+        #[arg(long)]
+        package: Option<String>,
+
+        /// Search doc comments and code comments only
+        #[arg(long = "docs", alias = "in-docs")]
+        in_docs: bool,
+
         /// Maximum number of results to return
         #[arg(long, default_value = "10")]
         limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Also query the indexes declared under [federation] and name the
+        /// index each result comes from
+        #[arg(long)]
+        federated: bool,
     },
-    /// Incremental sync based on file changes
+    /// List every reference to a symbol with its exact position
     ///
-    /// Detects changed files since last index and updates only those entries.
-    /// Equivalent to `cruxe index` without `--force`.
+    /// Scans the indexed files for the identifier and classifies each
+    /// occurrence as a definition, call, read, write or import, with the
+    /// symbol that encloses it. Calls backed by a resolved call edge are
+    /// marked as resolved; the rest are name matches.
     ///
     /// Examples:
-    ///   cruxe sync
-    ///   cruxe sync --force
-    ///   cruxe sync --workspace /path/to/project
-    Sync {
+    ///   cruxe refs validate_token
+    ///   cruxe refs auth.Validate --kind call,write
+    ///   cruxe refs MaxConns --format json
+    Refs {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Only these reference kinds, comma-separated
+        /// (definition, call, read, write, import)
+        #[arg(long, value_name = "KINDS")]
+        kind: Option<String>,
+
+        /// Also query the indexes declared under [federation] and name the
+        /// index each result comes from
+        #[arg(long)]
+        federated: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
         /// Path to the project root (default: current directory)
         #[arg(long)]
         workspace: Option<String>,
+    },
+    /// Go to the definition of the identifier at a source position
+    ///
+    /// Uses the call edge resolved at index time when there is one, then the
+    /// qualifier (`auth.` in `auth.Validate`), the file and the package to
+    /// choose among same-named symbols. Identifiers that are not in the index
+    /// are traced to the import they come from.
+    ///
+    /// Examples:
+    ///   cruxe def cmd/server/main.go:42:17
+    ///   cruxe def src/lib.rs:10:5 --format json
+    Def {
+        /// Position as <file>:<line>:<col> (1-based; file relative to the
+        /// current directory)
+        position: String,
 
-        /// Force full re-index instead of incremental
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
-        force: bool,
-    },
-    /// Run evaluation and quality-gate tooling
-    Eval {
-        #[command(subcommand)]
-        command: EvalCommands,
-    },
-    /// Export/import portable Cruxe state bundles
-    State {
-        #[command(subcommand)]
-        command: StateCommands,
-    },
-    /// Remove stale overlay indices while preserving active leases
-    #[command(name = "prune-overlays")]
-    PruneOverlays {
+        r#ref: Option<String>,
+
         /// Path to the project root (default: current directory)
         #[arg(long)]
         workspace: Option<String>,
-
-        /// Remove overlays not accessed in the last N days
-        #[arg(long = "older-than", default_value = "30")]
-        older_than_days: u64,
     },
-    /// Start MCP server (stdio or HTTP JSON-RPC transport)
+    /// Find the symbol a canonical symbol id names
     ///
-    /// Exposes tools (locate_symbol, search_code, index_status, index_repo,
-    /// sync_repo) to AI coding assistants via the Model Context Protocol.
+    /// Ids are printed by `search` and `def` and look like
+    /// `<language> <package>.<qualified name>`; they survive re-indexing and
+    /// line moves, so baselines and other tools can keep them.
     ///
     /// Examples:
-    ///   cruxe serve-mcp --workspace .
-    ///   cruxe serve-mcp --transport http --port 9100
-    ///   cruxe serve-mcp --auto-workspace --allowed-root /home/user/projects
-    ServeMcp {
-        /// Path to the default project root (default: current directory)
+    ///   cruxe resolve "go github.com/acme/api/user.Server.Handle"
+    ///   cruxe resolve "rust crates/api/src/user::Server::handle" --format json
+    Resolve {
+        /// Canonical symbol id
+        id: String,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
         #[arg(long)]
         workspace: Option<String>,
+    },
+    /// Rename a symbol everywhere the index finds it
+    ///
+    /// Rewrites the definition and every reference found by `refs`.
+    /// Occurrences in comments and string literals (such as struct tags) are
+    /// left alone, and so are uses that may belong to another symbol of the
+    /// same name; those are listed as skipped. Run `cruxe sync` afterwards.
+    ///
+    /// Examples:
+    ///   cruxe rename Account User --dry-run
+    ///   cruxe rename api.Validate Check
+    Rename {
+        /// Symbol name or qualified name
+        symbol: String,
 
-        /// Skip Tantivy index prewarming on startup
+        /// New name
+        new_name: String,
+
+        /// Print a unified diff instead of writing files
         #[arg(long)]
-        no_prewarm: bool,
+        dry_run: bool,
 
-        /// Transport mode: "stdio" (default) or "http"
-        #[arg(long, value_enum, default_value_t = McpTransport::Stdio)]
-        transport: McpTransport,
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
 
-        /// HTTP server port (only used with --transport http)
-        #[arg(long, default_value = "9100")]
-        port: u16,
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
 
-        /// HTTP server bind address (only used with --transport http)
-        #[arg(long, default_value = "127.0.0.1")]
-        bind: String,
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print the callers of a symbol as a tree
+    ///
+    /// Walks the call edges recorded at index time up to `--depth` levels.
+    /// Each symbol is expanded once; later occurrences are marked `(*)`.
+    ///
+    /// Examples:
+    ///   cruxe callers validate_token
+    ///   cruxe callers Server.Handle --depth 4 --format dot | dot -Tsvg > callers.svg
+    Callers {
+        /// Symbol name or qualified name
+        symbol: String,
 
-        /// Enable auto-discovery of workspaces passed via the `workspace` tool parameter.
-        /// Requires at least one --allowed-root.
+        /// Restrict the symbol lookup to this file
         #[arg(long)]
-        auto_workspace: bool,
+        path: Option<String>,
 
-        /// Allowed root directory prefix for auto-discovered workspaces (repeatable).
-        /// Only workspace paths under these roots will be accepted.
-        #[arg(long = "allowed-root")]
-        allowed_roots: Vec<String>,
+        /// Tree depth (clamped to 1..=5)
+        #[arg(long, default_value = "3")]
+        depth: u32,
 
-        /// Maximum number of auto-discovered workspaces to keep (LRU eviction).
-        #[arg(long, default_value = "10")]
-        max_auto_workspaces: usize,
-    },
-}
+        /// Maximum number of nodes in the tree
+        #[arg(long, default_value = "200")]
+        limit: usize,
 
-#[derive(Subcommand)]
-enum StateCommands {
-    /// Export state bundle to `.tar.zst`
-    Export {
-        /// Output archive path (for example: /tmp/state.tar.zst)
-        path: String,
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "dot"])]
+        format: String,
 
-        /// Path to the project root (default: current directory)
+        /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
-        workspace: Option<String>,
-    },
-    /// Import state bundle from `.tar.zst`
-    Import {
-        /// Input archive path
-        path: String,
+        r#ref: Option<String>,
 
         /// Path to the project root (default: current directory)
         #[arg(long)]
         workspace: Option<String>,
+
+        /// Also query the indexes declared under [federation] and name the
+        /// index each result comes from
+        #[arg(long)]
+        federated: bool,
     },
-}
+    /// Print the callees of a symbol as a tree
+    ///
+    /// The same walk as `cruxe callers`, following calls out of the symbol.
+    ///
+    /// Examples:
+    ///   cruxe callees main
+    ///   cruxe callees handle_request --depth 2 --format json
+    Callees {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Tree depth (clamped to 1..=5)
+        #[arg(long, default_value = "3")]
+        depth: u32,
+
+        /// Maximum number of nodes in the tree
+        #[arg(long, default_value = "200")]
+        limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "dot"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
 
-#[derive(Subcommand)]
-enum EvalCommands {
-    /// Evaluate retrieval quality and compare against baseline/policy gates
-    Retrieval {
         /// Path to the project root (default: current directory)
         #[arg(long)]
         workspace: Option<String>,
+    },
+    /// List the types that implement an interface or trait
+    ///
+    /// Go types qualify when their indexed methods cover the interface's
+    /// method set, embedded interfaces included; Rust types through their
+    /// `impl Trait for Type` blocks; TypeScript and Python classes through
+    /// their `implements`/`extends` clauses. Indexed dependencies count
+    /// like any other code.
+    ///
+    /// Examples:
+    ///   cruxe impls Store
+    ///   cruxe impls Handler --format json
+    ///   cruxe impls Render --path src/render.rs
+    Impls {
+        /// Interface or trait name, or qualified name
+        interface: String,
 
-        /// Retrieval suite JSON path
+        /// Restrict the interface lookup to this file
         #[arg(long)]
-        suite: Option<String>,
+        path: Option<String>,
 
-        /// Baseline snapshot JSON path
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
-        baseline: String,
+        r#ref: Option<String>,
 
-        /// Gate policy JSON path (thresholds + tolerances)
+        /// Path to the project root (default: current directory)
         #[arg(long)]
-        policy: String,
+        workspace: Option<String>,
+    },
+    /// Report the code affected by a change
+    ///
+    /// Maps changed lines to their enclosing symbols and walks the reverse
+    /// call graph to find the symbols, packages and tests that may be
+    /// affected. Each `--changed` value is an existing file (changed in full)
+    /// or a git range; without `--changed`, uncommitted changes are used.
+    ///
+    /// Examples:
+    ///   cruxe impact --changed main..HEAD
+    ///   cruxe impact --changed src/auth/token.rs --depth 4
+    ///   cruxe impact --changed origin/main...HEAD --format tests
+    Impact {
+        /// Changed files or a git range (repeatable or comma-separated)
+        #[arg(long)]
+        changed: Vec<String>,
 
-        /// Ref/branch scope (default: live)
-        #[arg(long, default_value = "live")]
-        r#ref: String,
+        /// Reverse call-graph depth (clamped to 1..=5)
+        #[arg(long, default_value = "3")]
+        depth: u32,
 
-        /// Maximum number of hits considered per query
-        #[arg(long, default_value = "10")]
+        /// Maximum number of affected symbols
+        #[arg(long, default_value = "500")]
         limit: usize,
 
-        /// Report output path (JSON)
-        #[arg(long)]
-        output: Option<String>,
+        /// Output format (`tests` prints only the affected test files)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "tests"])]
+        format: String,
 
-        /// Rollout mode: do not fail process on gate failures
+        /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
-        dry_run: bool,
+        r#ref: Option<String>,
 
-        /// Update baseline snapshot from current run before comparison
+        /// Path to the project root (default: current directory)
         #[arg(long)]
-        update_baseline: bool,
+        workspace: Option<String>,
+    },
+    /// List the tests that exercise a symbol
+    ///
+    /// Walks the reverse call graph from the symbol to test functions
+    /// (`TestXxx`, `BenchmarkXxx`, `test_*`, Rust `tests` modules) and, with
+    /// `--coverage`, adds tests whose Go cover profile executed its lines.
+    /// Each profile must be recorded for a single test and named after it,
+    /// e.g. `go test -run '^TestLoad$' -coverprofile TestLoad.out`.
+    /// `--format run` prints the commands that run only those tests.
+    ///
+    /// Examples:
+    ///   cruxe tests-for handlers.HandleRequest
+    ///   cruxe tests-for Load --format run | sh
+    ///   cruxe tests-for Load --coverage cover/TestLoad.out --format json
+    TestsFor {
+        /// Symbol name, qualified name, or `package.Name`
+        symbol: String,
 
-        /// Optional BEIR corpus path (`corpus.jsonl`)
+        /// Restrict the symbol lookup to this file
         #[arg(long)]
-        beir_corpus: Option<String>,
+        path: Option<String>,
 
-        /// Optional BEIR queries path (`queries.jsonl`)
-        #[arg(long)]
-        beir_queries: Option<String>,
+        /// Reverse call-graph depth (clamped to 1..=5)
+        #[arg(long, default_value = "5")]
+        depth: u32,
 
-        /// Optional BEIR qrels path (`qrels.tsv`)
+        /// Maximum number of callers walked
+        #[arg(long, default_value = "1000")]
+        limit: usize,
+
+        /// Per-test Go cover profile, named after its test (repeatable)
         #[arg(long)]
-        beir_qrels: Option<String>,
+        coverage: Vec<String>,
 
-        /// Optional TREC run output path
+        /// Output format (`tests` prints test files, `run` test commands)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "tests", "run"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
         #[arg(long)]
-        trec_run_out: Option<String>,
+        r#ref: Option<String>,
 
-        /// Optional TREC qrels output path
+        /// Path to the project root (default: current directory)
         #[arg(long)]
-        trec_qrels_out: Option<String>,
+        workspace: Option<String>,
     },
-}
+    /// Print the symbol outline of a file
+    ///
+    /// Types, functions, methods and fields with their line ranges, nested
+    /// by parent, as a cheap map of a file before reading it. `--format
+    /// skeleton` prints the source itself with every function body elided
+    /// (`func HandleRequest(req *Request) *Response { ... }`), keeping doc
+    /// comments, types and signatures; given a directory, it prints each
+    /// indexed file of that package.
+    ///
+    /// Examples:
+    ///   cruxe outline src/server.rs
+    ///   cruxe outline pkg/auth/token.go --top
+    ///   cruxe outline app/models.py --format json
+    ///   cruxe outline internal/auth --format skeleton
+    Outline {
+        /// File path, or with `--format skeleton` a package directory,
+        /// relative to the current directory or the project root
+        file: String,
 
-fn main() -> anyhow::Result<()> {
-    let cli = Cli::parse();
+        /// Only list top-level symbols
+        #[arg(long)]
+        top: bool,
 
-    // Set up tracing
-    let filter = if cli.verbose { "debug" } else { "info" };
-    tracing_subscriber::fmt()
-        .with_env_filter(
-            EnvFilter::try_from_default_env().unwrap_or_else(|_| EnvFilter::new(filter)),
+        /// Output format (`skeleton` prints the source with bodies elided)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "skeleton"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print the package-level import graph
+    ///
+    /// Packages are source directories; edges come from import statements,
+    /// not calls. Import cycles between packages are highlighted.
+    /// `--check` lists each import cycle and each import forbidden under
+    /// `[layers]` with the file and line of the imports behind it, and
+    /// fails when there are any.
+    ///
+    /// Examples:
+    ///   cruxe deps
+    ///   cruxe deps --external collapse --group-depth 2
+    ///   cruxe deps --format dot | dot -Tsvg > deps.svg
+    ///   cruxe deps --cycles --format mermaid
+    ///   cruxe deps --fail-on 'cycles>0'
+    ///   cruxe deps --check
+    Deps {
+        /// Unresolved (external) imports: keep one node each, collapse into a
+        /// single node, or hide
+        #[arg(long, default_value = "keep", value_parser = ["keep", "collapse", "hide"])]
+        external: String,
+
+        /// Group packages by their first N directory components (0 = full path)
+        #[arg(long, default_value = "0")]
+        group_depth: usize,
+
+        /// Only print packages and edges that are part of an import cycle
+        #[arg(long)]
+        cycles: bool,
+
+        /// Report import cycles and `[layers]` violations with their import
+        /// chains instead of the graph; exits non-zero when there are any
+        #[arg(long, conflicts_with = "cycles")]
+        check: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "dot", "mermaid", "github", "github-check"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'cycles>0'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Report only import cycles not in a baseline file (default:
+        /// `.cruxe/baseline.json`); baselined cycles use full package paths
+        #[arg(long, value_name = "FILE", num_args = 0..=1, default_missing_value = ".cruxe/baseline.json")]
+        baseline: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Report code no entry point can reach
+    ///
+    /// Walks the call graph from `main`, Go `init`, tests, top-level code
+    /// and (unless `--include-exported`) exported API, and reports the
+    /// functions and methods left over plus types and constants whose name
+    /// appears nowhere but their definition. Symbols used through
+    /// reflection can be allowlisted with `--allow` or `[deadcode] allow`.
+    /// Generated files are not reported unless `--include-generated`.
+    ///
+    /// Examples:
+    ///   cruxe deadcode
+    ///   cruxe deadcode --include-exported --format json
+    ///   cruxe deadcode --unused-exports
+    ///   cruxe deadcode --include-generated
+    ///   cruxe deadcode --allow '*Handler' --allow 'internal/generated/**'
+    ///   cruxe deadcode --fail-on 'deadcode>50'
+    Deadcode {
+        /// Glob over symbol name, qualified name or path to never report
+        /// (repeatable)
+        #[arg(long)]
+        allow: Vec<String>,
+
+        /// Report exported API too instead of treating it as an entry point
+        #[arg(long)]
+        include_exported: bool,
+
+        /// Also report exported symbols no other package calls or mentions
+        #[arg(long)]
+        unused_exports: bool,
+
+        /// Report symbols of generated files (`DO NOT EDIT` headers,
+        /// protobuf stubs, mocks) too
+        #[arg(long)]
+        include_generated: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "github", "github-check"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'deadcode>50'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Report only findings not in a baseline file (default:
+        /// `.cruxe/baseline.json`); see `cruxe baseline write`
+        #[arg(long, value_name = "FILE", num_args = 0..=1, default_missing_value = ".cruxe/baseline.json")]
+        baseline: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Report duplicated and near-duplicated functions
+    ///
+    /// Compares function and method bodies by winnowed token fingerprints,
+    /// with identifiers and literals normalized away, and reports clusters
+    /// of copies with their locations and similarity, most duplicated lines
+    /// first.
+    ///
+    /// Examples:
+    ///   cruxe duplicates
+    ///   cruxe duplicates --path internal/handlers --min-similarity 0.7
+    ///   cruxe duplicates --min-lines 15 --format json
+    ///   cruxe duplicates --fail-on 'duplicated_lines>200'
+    Duplicates {
+        /// Ignore bodies shorter than this many lines
+        #[arg(long, default_value = "6")]
+        min_lines: u32,
+
+        /// Ignore bodies with fewer normalized tokens than this
+        #[arg(long, default_value = "40")]
+        min_tokens: usize,
+
+        /// Lowest similarity (0.0 to 1.0) that makes two bodies copies
+        #[arg(long, default_value = "0.85")]
+        min_similarity: f64,
+
+        /// Only bodies under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Compare bodies in generated files too
+        #[arg(long)]
+        include_generated: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'duplicates>0'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Rank the riskiest code by change frequency and complexity
+    ///
+    /// Joins each function's cyclomatic complexity and size with the git
+    /// commits that changed it within a window, and lists the highest
+    /// `commits × complexity` first: a prioritized refactoring list. The
+    /// window defaults to `[hotspots] since` in the config, else 6 months.
+    ///
+    /// Examples:
+    ///   cruxe hotspots
+    ///   cruxe hotspots --since "3 months ago" --limit 50
+    ///   cruxe hotspots --path internal/billing --format json
+    Hotspots {
+        /// Change-frequency window, any `git log --since` value
+        #[arg(long)]
+        since: Option<String>,
+
+        /// Hotspots to report
+        #[arg(long, default_value = "20")]
+        limit: usize,
+
+        /// Only functions under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Check calls and imports against declarative architecture rules
+    ///
+    /// Reads `[[rule]]` entries from `.cruxe/rules.toml`: which packages
+    /// (directory globs) a package may or must not call and import, and
+    /// whether its calls into other packages must go through interfaces.
+    /// Every resolved call and import between two packages is checked, and
+    /// the command exits with status 3 when any rule is broken.
+    ///
+    /// Examples:
+    ///   cruxe lint-arch
+    ///   cruxe lint-arch --rules ci/architecture.toml --format json
+    LintArch {
+        /// Rules file, relative to the workspace (default: .cruxe/rules.toml)
+        #[arg(long, value_name = "FILE")]
+        rules: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Report exported symbols without doc comments
+    ///
+    /// Checks every exported function, method, type, constant and variable
+    /// (those `cruxe api` lists, without struct fields) for a doc comment or
+    /// docstring, and reports the coverage of each package, least
+    /// documented first, with the undocumented symbols.
+    ///
+    /// Examples:
+    ///   cruxe doc-coverage
+    ///   cruxe doc-coverage --path pkg/client --format json
+    ///   cruxe doc-coverage --fail-on 'doc_coverage<80,doc_coverage.min<50'
+    DocCoverage {
+        /// Only symbols under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'undocumented>0'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// List TODO, FIXME and HACK comments and deprecation notices
+    ///
+    /// Markers are collected from comments at index time and attached to the
+    /// function they sit in, or the symbol they document. Each is blamed to
+    /// report its author and age, oldest first; `--owner` matches the blame
+    /// author's name or email or a `TODO(name)` assignee.
+    ///
+    /// Examples:
+    ///   cruxe todos
+    ///   cruxe todos --marker fixme,hack --package pkg/store
+    ///   cruxe todos --owner ada@example.com --min-age 180 --format json
+    Todos {
+        /// Comma-separated markers to keep: todo, fixme, hack, deprecated
+        #[arg(long, value_delimiter = ',')]
+        marker: Vec<String>,
+
+        /// Only markers in this package (directory) or below it
+        #[arg(long)]
+        package: Option<String>,
+
+        /// Only markers blamed to, or assigned to, this name or email
+        #[arg(long)]
+        owner: Option<String>,
+
+        /// Only markers whose line is at least this many days old
+        #[arg(long, value_name = "DAYS")]
+        min_age: Option<u64>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Trace how a Go function's errors are handled and propagated
+    ///
+    /// Lists the calls whose errors the function receives and whether it
+    /// returns them (as is, wrapped with `%w`, or flattened with `%v`),
+    /// logs them, swallows them with `_`, ignores them or leaves them
+    /// unchecked. When the function returns an error, its callers are
+    /// followed up to `--depth` levels until one stops the error.
+    ///
+    /// Examples:
+    ///   cruxe errors HandleRequest
+    ///   cruxe errors Store.Load --depth 5 --format json
+    Errors {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Caller levels to follow (clamped to 1..=5)
+        #[arg(long, default_value = "4")]
+        depth: u32,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Find call paths from library code to `os.Exit`, `Fatal` and `panic`
+    ///
+    /// Lists every `os.Exit`, `log.Fatal*`/`log.Panic*` and `panic` call in
+    /// Go code, then the shortest call path from each function in scope to
+    /// one. The scope is every function outside `main` packages, or those
+    /// in files matching `--from`. Panics stop at functions that defer a
+    /// `recover()`.
+    ///
+    /// Examples:
+    ///   cruxe exits
+    ///   cruxe exits --from 'internal/handlers/**' --fail-on 'exit_paths>0'
+    Exits {
+        /// Start paths from functions in files matching this glob (repeatable)
+        #[arg(long, value_name = "GLOB")]
+        from: Vec<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'exit_paths>0'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Summarize where Go code uses goroutines, channels and locks
+    ///
+    /// `go` statements, channels, `sync.Mutex`/`RWMutex` fields and
+    /// variables and `sync.WaitGroup`s are recorded at index time with the
+    /// function or field they belong to. Packages are listed busiest first,
+    /// followed by every site: a starting point for a race review.
+    ///
+    /// Examples:
+    ///   cruxe concurrency
+    ///   cruxe concurrency --kind goroutine,mutex --package internal/worker
+    ///   cruxe concurrency --format json
+    Concurrency {
+        /// Comma-separated kinds to keep: goroutine, channel, mutex, waitgroup
+        #[arg(long, value_delimiter = ',')]
+        kind: Vec<String>,
+
+        /// Only sites in this package (directory) or below it
+        #[arg(long)]
+        package: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// List HTTP routes with their handlers and what the handlers call
+    ///
+    /// Routes are recorded at index time from net/http, gorilla/mux, chi,
+    /// gin and echo registrations, with group prefixes applied, and from
+    /// `switch` statements dispatching on the request method and path. Each
+    /// handler is resolved to its function or method, and its callees are
+    /// shown `--depth` levels deep.
+    ///
+    /// Examples:
+    ///   cruxe routes
+    ///   cruxe routes --method POST,PUT --prefix /api/v1
+    ///   cruxe routes --depth 3 --format json
+    Routes {
+        /// Comma-separated methods to keep; any-method routes are kept too
+        #[arg(long, value_delimiter = ',')]
+        method: Vec<String>,
+
+        /// Only routes whose pattern starts with this prefix
+        #[arg(long)]
+        prefix: Option<String>,
+
+        /// Handler callee levels to show (0 for none, clamped to 5)
+        #[arg(long, default_value = "1")]
+        depth: u32,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Find where a constant value or string literal is used
+    ///
+    /// Every constant's value is recorded at index time, with string
+    /// literals shaped like routes, environment variable names, error codes
+    /// or URLs. Sites are listed with the function or constant they are in,
+    /// followed by the references to the constants holding the value.
+    ///
+    /// Examples:
+    ///   cruxe where-used --literal "/api/user"
+    ///   cruxe where-used --literal DATABASE_URL --kind env
+    ///   cruxe where-used --literal https://api.example.com --prefix --format json
+    WhereUsed {
+        /// The value to look for, without quotes
+        #[arg(long)]
+        literal: String,
+
+        /// Match values starting with the literal
+        #[arg(long)]
+        prefix: bool,
+
+        /// Comma-separated kinds to keep: route, env, code, url, constant
+        #[arg(long, value_delimiter = ',')]
+        kind: Vec<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// List the projects of a monorepo
+    ///
+    /// Every directory with its own go.mod, Cargo.toml package or
+    /// package.json is a project, discovered at index time and named by its
+    /// manifest. The tree is still one index; a file belongs to the project
+    /// with the deepest directory holding it, and `--project NAME` scopes
+    /// indexing and analysis commands to that project's files.
+    ///
+    /// Examples:
+    ///   cruxe projects
+    ///   cruxe projects --format json
+    ///   cruxe deadcode --project billing
+    Projects {
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Incremental sync based on file changes
+    ///
+    /// Detects changed files since last index and updates only those entries.
+    /// Equivalent to `cruxe index` without `--force`.
+    ///
+    /// Examples:
+    ///   cruxe sync
+    ///   cruxe sync --force
+    ///   cruxe sync --workspace /path/to/project
+    Sync {
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Force full re-index instead of incremental
+        #[arg(long)]
+        force: bool,
+
+        /// Parse worker threads (default: CRUXE_INDEX_PARALLELISM or all cores)
+        #[arg(short, long)]
+        jobs: Option<usize>,
+
+        /// Memory budget such as 2G; edge buffers beyond it spill to disk
+        /// (default: CRUXE_INDEX_MAX_MEMORY or unbounded)
+        #[arg(long, value_name = "SIZE")]
+        max_memory: Option<String>,
+
+        /// Also index files listed in .gitignore and .cruxeignore
+        #[arg(long)]
+        no_ignore: bool,
+
+        /// Descend into initialized git submodules (default: `[index] submodules`)
+        #[arg(long)]
+        submodules: bool,
+
+        /// Symbolic links to follow (as for `cruxe index`)
+        #[arg(long, value_name = "POLICY", value_parser = ["skip", "follow", "follow-within-root"])]
+        symlinks: Option<String>,
+
+        /// Progress on stderr: auto, plain, json or none (as for `cruxe index`)
+        #[arg(long, value_enum, value_name = "MODE", default_value = "auto")]
+        progress: progress::ProgressMode,
+    },
+    /// Time the indexing phases per language on a source tree
+    ///
+    /// Parses, stores and resolves every file single-threaded into a scratch
+    /// index and reports parse, resolve and store times, files/sec, LOC/sec
+    /// and peak RSS. The project's own index is not touched.
+    ///
+    /// Examples:
+    ///   cruxe bench
+    ///   cruxe bench ../service --iterations 3 --save-baseline bench.json
+    ///   cruxe bench --baseline bench.json --max-regression 5
+    Bench {
+        /// Source tree to benchmark (default: current directory)
+        path: Option<String>,
+
+        /// Run this many times and keep the fastest time of each phase
+        #[arg(long, default_value = "1", value_parser = clap::value_parser!(u32).range(1..))]
+        iterations: u32,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Save the report as a baseline for later runs
+        #[arg(long, value_name = "FILE")]
+        save_baseline: Option<String>,
+
+        /// Compare against a saved baseline and fail on regressions
+        #[arg(long, value_name = "FILE")]
+        baseline: Option<String>,
+
+        /// Allowed drop in throughput (or growth in peak RSS), in percent
+        #[arg(long, default_value = "10", value_name = "PCT")]
+        max_regression: f64,
+    },
+    /// Run evaluation and quality-gate tooling
+    Eval {
+        #[command(subcommand)]
+        command: EvalCommands,
+    },
+    /// Export the symbol graph for external graph tools
+    ///
+    /// Writes all indexed symbols and resolved edges for a ref in an
+    /// interchange format. Output goes to stdout unless --output is given.
+    ///
+    /// Examples:
+    ///   cruxe export --format graphml --output graph.graphml
+    ///   cruxe export --format graphml --ref feat/auth > graph.graphml
+    ///   cruxe export --format scip --output index.scip
+    ///   cruxe export --format lsif --output dump.lsif
+    ///   cruxe export --format ndjson | jq 'select(.type == "edge")'
+    ///   cruxe export --format csv --out-dir graph/
+    ///   cruxe export --format html --output graph.html
+    ///   cruxe export --format plantuml --output classes.puml
+    ///   cruxe export --format plantuml --call-path main,HandleRequest,authenticate
+    ///   cruxe export --format cypher --output graph.cypher
+    ///   cruxe export --format pb --output index.pb
+    ///   cruxe export --format ndjson --output graph.ndjson.zst
+    ///   cruxe export --format usage --output usage-$(git rev-parse --short HEAD).csv
+    Export {
+        /// Export format: graphml, scip, lsif, ndjson (streamed), csv, html, plantuml, cypher, pb, usage
+        #[arg(long, default_value = "graphml")]
+        format: String,
+
+        /// Output file path (default: stdout)
+        #[arg(short, long, conflicts_with = "out_dir")]
+        output: Option<String>,
+
+        /// Directory for multi-file formats (csv: symbols.csv and edges.csv)
+        #[arg(long)]
+        out_dir: Option<String>,
+
+        /// Comma-separated caller-to-callee symbol names; with plantuml,
+        /// writes a sequence diagram of this call path
+        #[arg(long, value_delimiter = ',')]
+        call_path: Vec<String>,
+
+        /// Compress the output with zstd (implied by a .zst output path);
+        /// cruxe reads compressed artifacts transparently
+        #[arg(long)]
+        compress: bool,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Generate a human-readable architecture report
+    ///
+    /// Summarizes packages, the largest and most connected symbols, package
+    /// dependencies and cycles, and dead code candidates for a ref, plus the
+    /// tables embedded SQL touches and the bytes each `//go:embed` adds.
+    ///
+    /// Examples:
+    ///   cruxe report > docs/architecture.md
+    ///   cruxe report --format markdown --top 20 --output report.md
+    Report {
+        /// Report format: markdown
+        #[arg(long, default_value = "markdown")]
+        format: String,
+
+        /// Output file path (default: stdout)
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Rows per ranked section
+        #[arg(long, default_value = "10")]
+        top: usize,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Serve read-only REST and gRPC APIs over the index
+    ///
+    /// JSON endpoints for search, definitions, references, call graphs and
+    /// analysis findings under /api/v1, described by /openapi.json. The same
+    /// port serves the streaming gRPC service of
+    /// docs/reference/cruxe-query.proto over plaintext HTTP/2. An empty host
+    /// (`:7474`) binds to loopback; listening on other interfaces, such as
+    /// `0.0.0.0:7474`, requires `[[server.api_keys]]`, whose bearer tokens and
+    /// `read_prefixes` then guard every query.
+    ///
+    /// Examples:
+    ///   cruxe serve --http :7474
+    ///   curl 'http://127.0.0.1:7474/api/v1/references?symbol=validate_token'
+    ///   grpcurl -plaintext -proto cruxe-query.proto -d '{"symbol":"validate_token"}' \
+    ///     127.0.0.1:7474 cruxe.query.v1.CruxeQuery/FindReferences
+    Serve {
+        /// Listen address, [HOST]:PORT
+        #[arg(long, default_value = ":7474")]
+        http: String,
+
+        /// Default branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Report symbol-level changes between two indexed refs
+    ///
+    /// Pairs symbols by kind and qualified name and reports those added,
+    /// removed, renamed (same body under a new name), with a changed
+    /// signature or visibility, or moved to another file. Changes that
+    /// alter exported API are flagged. Both refs must be indexed.
+    ///
+    /// Examples:
+    ///   cruxe diff main feat/auth
+    ///   cruxe diff v1.2.0 main --exported-only
+    ///   cruxe diff main HEAD --include-bodies --path src/api --format json
+    ///   cruxe diff origin/main HEAD --format github-check > check-run.json
+    Diff {
+        /// Base ref
+        base: String,
+
+        /// Head ref
+        head: String,
+
+        /// Only report changes to exported symbols
+        #[arg(long)]
+        exported_only: bool,
+
+        /// Also report symbols whose body changed but signature did not
+        #[arg(long)]
+        include_bodies: bool,
+
+        /// Only symbols under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "github", "github-check"])]
+        format: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print the exported API, or classify its changes between two refs
+    ///
+    /// Lists exported functions, methods, types, struct fields, constants
+    /// and variables with their signatures, grouped by package. `api diff`
+    /// pairs the API of two indexed refs by kind and qualified name and
+    /// classifies each change as breaking (removed, signature or package
+    /// changed, new interface method) or additive, with the semver bump
+    /// they call for.
+    ///
+    /// Examples:
+    ///   cruxe api
+    ///   cruxe api --path pkg/client --format json
+    ///   cruxe api diff v1.4.0 main
+    ///   cruxe api diff v1.4.0 HEAD --fail-on-breaking
+    #[command(args_conflicts_with_subcommands = true)]
+    Api {
+        #[command(subcommand)]
+        command: Option<ApiCommands>,
+
+        /// Only items under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print everything known about a symbol
+    ///
+    /// Signature, doc comment, location, caller count, callees, the types
+    /// it extends or implements, reference count and the recent commits
+    /// that touched its lines, in one card.
+    ///
+    /// Examples:
+    ///   cruxe describe validate_token
+    ///   cruxe describe auth.Validate --history 10
+    ///   cruxe describe Pool --path src/pool.rs --format json
+    Describe {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Number of recent commits to list (0 to skip git history)
+        #[arg(long, default_value = "5")]
+        history: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Assemble a token-budgeted context pack for a symbol
+    ///
+    /// Collects the symbol's definition, the types it names, what it calls,
+    /// where it is called from and the config entries for keys it reads,
+    /// then keeps the most relevant pieces that fit the budget, cutting
+    /// callees and types down to signatures and callers to the calling line
+    /// when the whole piece does not fit. Prints Markdown ready to paste
+    /// into a prompt.
+    ///
+    /// Examples:
+    ///   cruxe context auth.Validate
+    ///   cruxe context Pool --budget 2000
+    ///   cruxe context handle --path src/server.rs --format json
+    Context {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Token budget of the pack
+        #[arg(long, default_value = "8000")]
+        budget: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Ask a natural-language question about the code
+    ///
+    /// Ranks the ref's symbols against the question by the words of their
+    /// names, doc comments, signatures and bodies (`expiry` matches
+    /// `IsExpired`), fused with the nearest stored vectors when `cruxe
+    /// embed` has run. Each hit shows the symbol's first lines and the
+    /// question terms it matched.
+    ///
+    /// Examples:
+    ///   cruxe ask "where do we validate JWT expiry?"
+    ///   cruxe ask "how are database connections retried" --limit 5 --format json
+    Ask {
+        /// The question, in plain words
+        question: String,
+
+        /// Maximum number of symbols
+        #[arg(long, default_value = "10")]
+        limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Embed indexed symbols for semantic retrieval
+    ///
+    /// Sends the snippet of every symbol of the ref to the embedding
+    /// provider in `search.semantic.embedding` and stores the vectors next
+    /// to the symbols. Providers: `local` (bundled ONNX models), `openai`,
+    /// `voyage`, and `openai-compatible` for any server speaking the OpenAI
+    /// embeddings API, such as `llama-server --embeddings`; `endpoint` sets
+    /// its base URL. Files whose snippets did not change since the last run
+    /// are skipped, and vectors of deleted files are dropped.
+    ///
+    /// Examples:
+    ///   cruxe embed
+    ///   cruxe embed --force --format json
+    Embed {
+        /// Re-embed every file, even unchanged ones
+        #[arg(long)]
+        force: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Split source files into syntax-aware chunks for RAG pipelines
+    ///
+    /// Cuts along the syntax tree instead of fixed line windows: comments
+    /// and attributes stay with their item, containers (impl, class,
+    /// module) are opened up when too large, and functions are never split
+    /// (one larger than the limits becomes an `oversized` chunk). Each
+    /// chunk has a stable ID from its path and text, its line range and
+    /// the symbols it declares. Limits default to
+    /// `search.semantic.chunking`. Reads the files on disk; no index needed.
+    ///
+    /// Examples:
+    ///   cruxe chunk src/
+    ///   cruxe chunk src/auth/token.rs --max-lines 60 --overlap-lines 5
+    ///   cruxe chunk --format ndjson > chunks.ndjson
+    Chunk {
+        /// Files or directories to chunk (default: the whole workspace)
+        paths: Vec<String>,
+
+        /// Maximum lines per chunk (default: chunk_size_lines)
+        #[arg(long)]
+        max_lines: Option<usize>,
+
+        /// Lines of whole items repeated from the previous chunk (default: chunk_overlap_lines)
+        #[arg(long)]
+        overlap_lines: Option<usize>,
+
+        /// Maximum estimated tokens per chunk (default: max_chunk_tokens)
+        #[arg(long)]
+        max_tokens: Option<usize>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Summarize what a package does
+    ///
+    /// Reports the package's purpose (from its package doc comment or
+    /// README, else described from its contents), its key exported types,
+    /// the main call flows through it and the packages and external
+    /// modules it imports. With `[summarize] backend = "openai-compatible"`
+    /// a chat model (llama.cpp, Ollama, OpenAI...) also writes a prose
+    /// overview. Summaries are stored in the index and rebuilt when a file
+    /// of the package changes.
+    ///
+    /// Examples:
+    ///   cruxe summarize internal/auth
+    ///   cruxe summarize crates/cruxe-query --format json
+    ///   cruxe summarize src/billing --heuristic --refresh
+    Summarize {
+        /// Package directory, relative to the current directory or the workspace root
+        package: String,
+
+        /// Rebuild the summary even if the stored one is current
+        #[arg(long)]
+        refresh: bool,
+
+        /// Skip the configured chat backend
+        #[arg(long)]
+        heuristic: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print a ranked map of the repository within a token budget
+    ///
+    /// Lists the signatures of the most important types and functions,
+    /// grouped by file with methods under their type, after a line ranking
+    /// the packages. Importance is PageRank over the call and import graph
+    /// plus the types each signature names; calls from tests are ignored.
+    /// As many symbols as fit in `--budget` tokens are shown, so the output
+    /// can be kept in an agent's context.
+    ///
+    /// Examples:
+    ///   cruxe map
+    ///   cruxe map --budget 4000 > .cruxe-map.txt
+    ///   cruxe map --budget 2000 --format json
+    Map {
+        /// Token budget for the map (default: 1024)
+        #[arg(long)]
+        budget: Option<usize>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Rank the files and symbols relevant to a task
+    ///
+    /// Matches the task description against the ref's symbols like `cruxe
+    /// ask` (words, and meaning once `cruxe embed` has run), then follows
+    /// the call graph two calls out from the best matches to add the code
+    /// around them, such as the route registration calling a matched
+    /// handler. Each file and symbol comes with its score and the reasons
+    /// it was picked.
+    ///
+    /// Examples:
+    ///   cruxe relevant --task "add rate limiting to the user creation endpoint"
+    ///   cruxe relevant --task "retry failed webhook deliveries" --limit 5 --format json
+    Relevant {
+        /// What you are about to change, in plain words
+        #[arg(long)]
+        task: String,
+
+        /// Maximum number of files and of symbols
+        #[arg(long, default_value = "15")]
+        limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print the exact source range of a symbol
+    ///
+    /// Gives the symbol's lines with their byte offsets in the file (end
+    /// exclusive), read from the working tree, so an agent can read or
+    /// patch exactly that span. Optionally adds the comments above it, the
+    /// file's imports it uses, the definitions of the types it names and
+    /// the first call sites of N callers, each with its own range. Flags the
+    /// result as stale when the file changed since it was indexed.
+    ///
+    /// Examples:
+    ///   cruxe snippet auth.Validate
+    ///   cruxe snippet Validate --with-doc --with-imports --with-types --format json
+    ///   cruxe snippet handle --path src/server.rs --with-callers 3
+    Snippet {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Include the doc comment and attributes above the symbol
+        #[arg(long)]
+        with_doc: bool,
+
+        /// Include the file's import statements the symbol uses
+        #[arg(long)]
+        with_imports: bool,
+
+        /// Include the definitions of the types the symbol names
+        #[arg(long)]
+        with_types: bool,
+
+        /// Include the call sites of up to N callers
+        #[arg(long, value_name = "N", default_value = "0")]
+        with_callers: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Map the hunks of a commit range onto symbols, grouped by package
+    ///
+    /// Runs `git diff` on the range and reports the innermost indexed
+    /// symbol each hunk touches, marked `added` or `modified` and flagged
+    /// when it is exported or its declaration lines changed. Symbols are
+    /// read from the index of the range's head when it has one (`cruxe
+    /// index --ref <head>`), else from `--ref`. `--format packages` prints
+    /// only the changed packages, one per line, for selective test runs.
+    ///
+    /// Examples:
+    ///   cruxe changed main..HEAD
+    ///   cruxe changed origin/main...feature --format json
+    ///   cruxe changed v1.4.0..v1.5.0 --format packages
+    Changed {
+        /// Git revision range, e.g. `main..HEAD` (a single revision is
+        /// diffed against the working tree)
+        range: String,
+
+        /// Output format (`packages` prints only the changed packages)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "packages"])]
+        format: String,
+
+        /// Ref to read symbols from (default: the range's head when indexed)
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Answer newline-delimited JSON queries from stdin
+    ///
+    /// Each stdin line is a request such as
+    /// `{"id": 1, "op": "definitions", "name": "validate_token"}`; each
+    /// answer is one JSON line on stdout, `{id, ok, result}` or
+    /// `{id, ok: false, error}`. Ops: search, definitions, references,
+    /// call_graph and describe, with the REST API's parameters. The index
+    /// is opened once for the whole stream.
+    ///
+    /// Examples:
+    ///   cruxe batch < queries.ndjson
+    ///   printf '{"op":"describe","symbol":"Pool"}\n' | cruxe batch
+    Batch {
+        /// Default branch/ref for requests without a `ref` (default:
+        /// auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Run the editor JSON-RPC protocol on stdio
+    ///
+    /// For editor plugins that need more than `cruxe lsp` offers: every
+    /// query tool (search, call graphs, hierarchies, context packs, ...) as a
+    /// `cruxe/<tool>` method returning plain JSON, plus `cruxe/findings` and
+    /// `cruxe/deadCode`. Messages use LSP's Content-Length framing;
+    /// `initialize` lists every method with the JSON Schema of its params.
+    ///
+    /// Examples:
+    ///   cruxe editor
+    ///   cruxe editor --workspace ~/src/monorepo --ref main
+    Editor {
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Run a Language Server Protocol server on stdio
+    ///
+    /// Serves go-to-definition, find references, document and workspace
+    /// symbols, and incoming/outgoing call hierarchy from the index, with
+    /// the same answers in every indexed language. Answers follow the index
+    /// and the files on disk, not unsaved buffers; pair it with `cruxe watch`
+    /// or `cruxe daemon` to keep the index current.
+    ///
+    /// Examples:
+    ///   cruxe lsp
+    ///   cruxe lsp --workspace ~/src/monorepo --ref main
+    Lsp {
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Upload a SCIP index to Sourcegraph or a bucket
+    ///
+    /// Exports the workspace's index as SCIP (or takes `--file`) and pushes
+    /// it to a Sourcegraph instance for an `http(s)://` endpoint, or stores
+    /// it under `<repo>/<commit>/index.scip` for `gs://`, `s3://` or a
+    /// directory. Requests are retried with backoff on network errors, 429
+    /// and 5xx. The token defaults to $SRC_ACCESS_TOKEN; the repository to
+    /// the `origin` remote and the commit to HEAD.
+    ///
+    /// Examples:
+    ///   cruxe upload --endpoint https://sourcegraph.example.com --token "$SRC_TOKEN"
+    ///   cruxe upload --endpoint gs://acme-scip --file index.scip
+    ///   cruxe upload --endpoint https://sourcegraph.com --repo github.com/acme/api --root services/api
+    Upload {
+        /// Sourcegraph URL, or gs://, s3:// or directory to store the index in
+        #[arg(long)]
+        endpoint: String,
+
+        /// Sourcegraph access token (default: $SRC_ACCESS_TOKEN)
+        #[arg(long)]
+        token: Option<String>,
+
+        /// SCIP file to upload (default: export the workspace's index)
+        #[arg(long)]
+        file: Option<String>,
+
+        /// Repository name, e.g. github.com/acme/api (default: from the origin remote)
+        #[arg(long)]
+        repo: Option<String>,
+
+        /// Full commit hash the index was built at (default: HEAD)
+        #[arg(long)]
+        commit: Option<String>,
+
+        /// Directory of the index relative to the repository root
+        #[arg(long, default_value = "")]
+        root: String,
+
+        /// Attempts per request before giving up
+        #[arg(long, default_value_t = 3, value_parser = clap::value_parser!(u32).range(1..))]
+        retries: u32,
+
+        /// Branch/ref to export (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Run git hook checks
+    ///
+    /// `pre-commit` parses only the staged files and checks them against the
+    /// cached index, without updating it, in well under a second on an
+    /// indexed repository. It fails when the change adds a package import
+    /// cycle, removes a symbol other files still use, or imports across a
+    /// boundary forbidden in `[layers]`. Install it with a one-line hook:
+    ///
+    ///   printf '#!/bin/sh\nexec cruxe hook pre-commit\n' > .git/hooks/pre-commit
+    ///   chmod +x .git/hooks/pre-commit
+    ///
+    /// Examples:
+    ///   cruxe hook pre-commit
+    ///   cruxe hook pre-commit --format json
+    Hook {
+        #[command(subcommand)]
+        command: HookCommands,
+    },
+    /// Snapshot current findings so later runs report only new ones
+    ///
+    /// `write` records today's `cruxe check` findings, dead code, package
+    /// import cycles and functions above complexity 15 in
+    /// `.cruxe/baseline.json`. With `--baseline`, `cruxe check`,
+    /// `cruxe deadcode` and `cruxe deps` then hide what the file lists, so a
+    /// legacy codebase can adopt them without a wall of known findings.
+    /// Entries ignore line numbers; commit the file and rewrite it as known
+    /// findings get fixed.
+    ///
+    /// Examples:
+    ///   cruxe baseline write
+    ///   cruxe check --baseline --profile standard
+    Baseline {
+        #[command(subcommand)]
+        command: BaselineCommands,
+    },
+    /// Print the JSON Schema of a command's `--format json` output
+    ///
+    /// Integrators can validate against the schema or generate types from
+    /// it. With `--ndjson` the schema is for one `--format ndjson` line
+    /// instead. Without a command, lists the commands that have a schema.
+    ///
+    /// Examples:
+    ///   cruxe schema
+    ///   cruxe schema refs
+    ///   cruxe schema query symbols --ndjson
+    Schema {
+        /// Command name, e.g. `refs` or `query symbols`
+        command: Vec<String>,
+
+        /// Schema of one ndjson record rather than the json document
+        #[arg(long)]
+        ndjson: bool,
+    },
+    /// Search indexed files, tagging matches with their enclosing symbol
+    ///
+    /// Runs a regex over every indexed file (or, with `--structural`, a
+    /// tree-sitter query against each file's syntax tree) and reports each
+    /// match with the innermost indexed symbol and the package around it.
+    /// Structural patterns mark the node to report with `@match`.
+    ///
+    /// Examples:
+    ///   cruxe grep 'TODO|FIXME'
+    ///   cruxe grep -i 'retry' --path 'src/**' --lang rust
+    ///   cruxe grep --structural '(macro_invocation macro: (identifier) @m (#eq? @m "panic")) @match'
+    Grep {
+        /// Regex, or tree-sitter query with --structural
+        pattern: String,
+
+        /// Treat the pattern as a tree-sitter query
+        #[arg(long)]
+        structural: bool,
+
+        /// Match the regex case-insensitively
+        #[arg(short = 'i', long)]
+        ignore_case: bool,
+
+        /// Only files matching this glob (repeatable)
+        #[arg(long)]
+        path: Vec<String>,
+
+        /// Filter by programming language (rust, typescript, python, go)
+        #[arg(long)]
+        lang: Option<String>,
+
+        /// Maximum matches to print
+        #[arg(long, default_value = "200")]
+        limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print repository statistics
+    ///
+    /// Files, LOC, symbols by kind and average function length per package
+    /// and per language, fan-in/fan-out distributions over functions, and
+    /// the most connected symbols.
+    ///
+    /// Examples:
+    ///   cruxe stats
+    ///   cruxe stats --top 25
+    ///   cruxe stats --format json > stats.json
+    ///   cruxe stats --fail-on 'fanin.max>40,function_length.avg>30'
+    Stats {
+        /// Packages and most-connected symbols to list
+        #[arg(long, default_value = "10")]
+        top: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Exit with status 3 when a threshold is crossed, e.g. 'fanin.max>40'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Browse the index in a terminal UI
+    ///
+    /// Type to fuzzy-search symbols; the preview pane shows the selected
+    /// definition. In the list, `c`, `e` and `r` open the callers, callees
+    /// and references of the selection, Backspace returns to the previous
+    /// list, Tab switches between the search box and the list, and `q`
+    /// quits.
+    ///
+    /// Examples:
+    ///   cruxe tui
+    ///   cruxe tui --ref main
+    Tui {
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Re-run a cruxe subcommand whenever the workspace changes
+    ///
+    /// Polls the workspace like `cruxe daemon`; once a change has settled
+    /// for one interval it re-indexes incrementally, re-runs the --exec
+    /// subcommand and prints a line diff of its output against the previous
+    /// run (`-` removed, `+` added). Progress notes go to stderr.
+    ///
+    /// Examples:
+    ///   cruxe watch --exec deadcode
+    ///   cruxe watch --exec 'impact --format tests'
+    ///   cruxe watch --exec "query symbols 'fanin > 10'" --interval-ms 1000
+    Watch {
+        /// Subcommand line to re-run, without the leading `cruxe`
+        #[arg(long)]
+        exec: String,
+
+        /// Poll interval and settle time in milliseconds
+        #[arg(long, default_value = "500")]
+        interval_ms: u64,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Print a shell completion script
+    ///
+    /// Besides subcommands and flags, the script completes the symbol
+    /// argument of `refs`, `callers`, `callees` and `query call-graph` from
+    /// the index of the current directory.
+    ///
+    /// Examples:
+    ///   source <(cruxe completions bash)
+    ///   source <(cruxe completions zsh)
+    ///   cruxe completions fish > ~/.config/fish/completions/cruxe.fish
+    Completions {
+        /// Shell to generate the script for
+        #[arg(value_parser = ["bash", "zsh", "fish"])]
+        shell: String,
+    },
+    /// List indexed symbol names starting with a prefix (used by completion)
+    #[command(name = "__complete-symbols", hide = true)]
+    CompleteSymbols {
+        /// Name or qualified-name prefix
+        #[arg(default_value = "")]
+        prefix: String,
+
+        /// Maximum names to print
+        #[arg(long, default_value = "200")]
+        limit: usize,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Write a ctags/etags tag file from the symbol index
+    ///
+    /// The file lists every indexed symbol with its path and line, so vim
+    /// (`:tag`, Ctrl-]) and emacs (`M-.`) jump using cruxe's parsers instead
+    /// of regex-based taggers. It is written at the workspace root by default.
+    ///
+    /// Examples:
+    ///   cruxe tags
+    ///   cruxe tags --format etags
+    ///   cruxe tags --output .git/tags --ref main
+    Tags {
+        /// Tag file format: ctags (vim) or etags (emacs)
+        #[arg(long, default_value = "ctags", value_parser = ["ctags", "etags"])]
+        format: String,
+
+        /// Output file path (default: <workspace>/tags or <workspace>/TAGS)
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// List Go templates and check them against the data they are executed with
+    ///
+    /// Template files (.tmpl, .gohtml, .html with actions, ...) are parsed at
+    /// index time. Each `Execute`/`ExecuteTemplate` call whose data is a repo
+    /// struct is followed into the template and its `{{template}}` callees;
+    /// fields the struct does not have are listed. `cruxe check` reports them
+    /// as `go/template-unknown-field`.
+    ///
+    /// Examples:
+    ///   cruxe templates
+    ///   cruxe templates --format json --ref main
+    Templates {
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Report common API misuse, malformed SQL/HTML/regex strings, unknown template fields and broken embeds in indexed code
+    ///
+    /// Runs the built-in heuristic rules over indexed function bodies. Rules
+    /// are on by default; `[rules."<id>"]` in the config sets `enabled` and
+    /// `severity` per rule.
+    ///
+    /// Examples:
+    ///   cruxe check
+    ///   cruxe check --rule go/http-body-not-closed --format json
+    ///   cruxe check --list-rules
+    ///   cruxe check --by-owner --owners-dir findings/
+    ///   cruxe check --profile strict
+    ///   cruxe check --ratchet
+    ///   cruxe check --baseline
+    ///   cruxe check --fail-on 'findings.error>0,complexity.max>25'
+    ///   cruxe check --format github   # PR annotations in GitHub Actions
+    Check {
+        /// Run only these rules (repeatable), even if disabled in the config
+        #[arg(long = "rule")]
+        rules: Vec<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson", "github", "github-check"])]
+        format: String,
+
+        /// List the built-in rules and their configured state
+        #[arg(long)]
+        list_rules: bool,
+
+        /// Policy profile: shifts rule severities and fails on findings at
+        /// its gate severity (default: `[check] profile`, else no gate)
+        #[arg(long, value_parser = ["strict", "standard", "lenient"])]
+        profile: Option<String>,
+
+        /// Fail when a finding count or the max function complexity is worse
+        /// than `.cruxe/ratchet.json`; on the default branch, tighten it
+        #[arg(long)]
+        ratchet: bool,
+
+        /// Report only findings not in a baseline file (default:
+        /// `.cruxe/baseline.json`); see `cruxe baseline write`
+        #[arg(long, value_name = "FILE", num_args = 0..=1, default_missing_value = ".cruxe/baseline.json")]
+        baseline: Option<String>,
+
+        /// Group findings by CODEOWNERS owner
+        #[arg(long)]
+        by_owner: bool,
+
+        /// Write one JSON file of findings per owner into this directory
+        #[arg(long)]
+        owners_dir: Option<String>,
+
+        /// POST each owner's findings to its `[routing.webhooks]` URL
+        #[arg(long)]
+        notify: bool,
+
+        /// Exit with status 3 when a threshold is crossed, e.g.
+        /// 'findings.error>0,complexity.max>25'
+        #[arg(long, value_name = "THRESHOLDS")]
+        fail_on: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Explain a finding reported by `cruxe check`
+    ///
+    /// Examples:
+    ///   cruxe finding show 3f9c2a
+    ///   cruxe finding show 3f9c2a71d0e4 --format json
+    Finding {
+        #[command(subcommand)]
+        command: FindingCommands,
+    },
+    /// List, export and import index shards of a monorepo
+    ///
+    /// Shards are declared under `[shards.<name>]` with the directories they
+    /// own, built with `cruxe index --shard <name>` (on any machine), and
+    /// searched together with the main index by `cruxe search`.
+    ///
+    /// Examples:
+    ///   cruxe shard list
+    ///   cruxe shard export payments payments.tar.zst
+    ///   cruxe shard import payments payments.tar.zst
+    Shard {
+        #[command(subcommand)]
+        command: ShardCommands,
+    },
+    /// Export/import portable Cruxe state bundles, or share them through a
+    /// remote cache
+    ///
+    /// With `[remote_cache] url` set, CI runs `cruxe index && cruxe state
+    /// push` to publish the index keyed by commit; `cruxe state pull` (and
+    /// `cruxe query` in a workspace without an index) imports the nearest
+    /// cached ancestor of HEAD and updates it incrementally.
+    ///
+    /// Examples:
+    ///   cruxe state export /tmp/state.tar.zst
+    ///   cruxe state push
+    ///   cruxe state pull
+    State {
+        #[command(subcommand)]
+        command: StateCommands,
+    },
+    /// Remove stale overlay indices while preserving active leases
+    #[command(name = "prune-overlays")]
+    PruneOverlays {
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Remove overlays not accessed in the last N days
+        #[arg(long = "older-than", default_value = "30")]
+        older_than_days: u64,
+    },
+    /// Start MCP server (stdio, HTTP JSON-RPC or SSE transport)
+    ///
+    /// Exposes tools (search_code, locate_symbol, get_call_graph,
+    /// get_file_outline, build_context_pack, index_status, ...) to AI coding
+    /// assistants via the Model Context Protocol. Also available as
+    /// `cruxe mcp`.
+    ///
+    /// The HTTP transport serves JSON-RPC on `POST /` and MCP's HTTP+SSE
+    /// transport on `GET /sse` (`--transport sse` is the same server).
+    ///
+    /// Examples:
+    ///   cruxe mcp --workspace .
+    ///   cruxe serve-mcp --transport http --port 9100
+    ///   cruxe mcp --transport sse --port 9100
+    ///   cruxe serve-mcp --auto-workspace --allowed-root /home/user/projects
+    ///
+    /// With `[[server.tenants]]` in the config, the HTTP transport hosts every
+    /// listed project behind per-tenant bearer tokens and quotas.
+    #[command(visible_alias = "mcp")]
+    ServeMcp {
+        /// Path to the default project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Skip Tantivy index prewarming on startup
+        #[arg(long)]
+        no_prewarm: bool,
+
+        /// Transport mode: "stdio" (default), or "http"/"sse" for the HTTP server
+        #[arg(long, value_enum, default_value_t = McpTransport::Stdio)]
+        transport: McpTransport,
+
+        /// HTTP server port (only used with --transport http)
+        #[arg(long, default_value = "9100")]
+        port: u16,
+
+        /// HTTP server bind address (only used with --transport http)
+        #[arg(long, default_value = "127.0.0.1")]
+        bind: String,
+
+        /// Enable auto-discovery of workspaces passed via the `workspace` tool parameter.
+        /// Requires at least one --allowed-root.
+        #[arg(long)]
+        auto_workspace: bool,
+
+        /// Allowed root directory prefix for auto-discovered workspaces (repeatable).
+        /// Only workspace paths under these roots will be accepted.
+        #[arg(long = "allowed-root")]
+        allowed_roots: Vec<String>,
+
+        /// Maximum number of auto-discovered workspaces to keep (LRU eviction).
+        #[arg(long, default_value = "10")]
+        max_auto_workspaces: usize,
+    },
+    /// Watch the workspace, keep the index hot, and answer queries on a socket
+    ///
+    /// Re-indexes incrementally shortly after files change and serves the
+    /// MCP JSON-RPC protocol, one request per line, on a Unix domain socket
+    /// (default: daemon.sock in the project data directory).
+    ///
+    /// Examples:
+    ///   cruxe daemon --workspace .
+    ///   cruxe daemon --socket /tmp/cruxe.sock --poll-interval-ms 250
+    ///   cruxe daemon --metrics-addr 127.0.0.1:9464
+    ///   cruxe daemon --ref main --ref release/1.2 --worktrees
+    Daemon {
+        /// Project root to watch (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Unix socket path to listen on
+        #[arg(long)]
+        socket: Option<String>,
+
+        /// How often to check the workspace for changes; a sync starts once
+        /// changes have been quiet for one interval
+        #[arg(long, default_value = "500")]
+        poll_interval_ms: u64,
+
+        /// Skip Tantivy index prewarming on startup
+        #[arg(long)]
+        no_prewarm: bool,
+
+        /// Serve Prometheus metrics on `GET /metrics` at this address
+        #[arg(long, value_name = "HOST:PORT")]
+        metrics_addr: Option<String>,
+
+        /// Also keep this ref indexed, re-indexing it when its tip moves
+        /// (repeatable)
+        #[arg(long = "ref", value_name = "REF")]
+        refs: Vec<String>,
+
+        /// Also keep the branches checked out in linked worktrees indexed
+        #[arg(long)]
+        worktrees: bool,
+    },
+    /// Browse the symbol graph in a web page
+    ///
+    /// Examples:
+    ///   cruxe graph serve
+    ///   cruxe graph serve --ref feat/auth --port 9200 --no-watch
+    Graph {
+        #[command(subcommand)]
+        command: GraphCommands,
+    },
+    /// Inspect or send opt-in anonymous usage statistics
+    ///
+    /// Nothing is collected unless `telemetry.enabled = true` is set in the
+    /// config (or CRUXE_TELEMETRY_ENABLED=1). Reports hold only aggregate
+    /// counters: command usage, index phase durations, and repository size
+    /// buckets. No paths, names, or queries are recorded.
+    ///
+    /// Examples:
+    ///   cruxe telemetry show
+    ///   cruxe telemetry send
+    Telemetry {
+        #[command(subcommand)]
+        command: TelemetryCommands,
+    },
+    /// Inspect the audit log of HTTP queries and exports
+    ///
+    /// Entries are only written when `audit.enabled = true`. Each entry
+    /// carries the hash of the one before it, so `verify` detects entries
+    /// that were edited or removed.
+    ///
+    /// Examples:
+    ///   cruxe audit verify
+    ///   cruxe audit verify --path /var/log/cruxe/audit.log
+    Audit {
+        #[command(subcommand)]
+        command: AuditCommands,
+    },
+    /// Run a search, call-graph or structured symbol/edge query, or explain
+    /// how a search or call-graph query would run
+    ///
+    /// With --explain nothing is executed: the command prints the indices the
+    /// search scans and how many documents each holds, the adaptive plans and
+    /// their fan-out/latency budgets, or for call graphs the depth limit
+    /// applied and the symbols and edges each traversal level would reach.
+    ///
+    /// `symbols` and `edges` take a query expression: `field:glob` terms,
+    /// count comparisons such as `fanin > 5`, flags such as `test`, combined
+    /// with AND, OR, NOT and parentheses.
+    ///
+    /// Without a local index, the nearest cached ancestor is pulled from
+    /// `[remote_cache]` first (disable with `pull_on_query = false`).
+    ///
+    /// Examples:
+    ///   cruxe query search "validate token" --explain
+    ///   cruxe query call-graph handle_request --direction both --depth 4 --explain
+    ///   cruxe query symbols 'kind:func AND package:handlers AND fanin > 5 AND NOT test'
+    ///   cruxe query symbols 'owner:@platform-team AND fanin > 20' --by-owner
+    ///   cruxe query edges 'cross AND from.pkg:api AND to.pkg:db' --format json
+    Query {
+        #[command(subcommand)]
+        command: QueryCommands,
+    },
+}
+
+#[derive(Subcommand)]
+enum QueryCommands {
+    /// Search code, like `cruxe search`
+    Search {
+        /// Search query (symbol name, file path, error string, or natural language)
+        query: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Filter by programming language (rust, typescript, python, go)
+        #[arg(long)]
+        lang: Option<String>,
+
+        /// Maximum number of results to return
+        #[arg(long, default_value = "10")]
+        limit: usize,
+
+        /// Print the query plan instead of running it
+        #[arg(long)]
+        explain: bool,
+
+        /// Output format (ignored with --explain)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+    },
+    /// Walk the callers and/or callees of a symbol
+    CallGraph {
+        /// Symbol name or qualified name
+        symbol: String,
+
+        /// Restrict the symbol lookup to this file
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Traversal direction
+        #[arg(long, default_value = "both", value_parser = ["callers", "callees", "both"])]
+        direction: String,
+
+        /// Traversal depth (clamped to 1..=5)
+        #[arg(long, default_value = "1")]
+        depth: u32,
+
+        /// Maximum edges returned per direction
+        #[arg(long, default_value = "20")]
+        limit: usize,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Print the traversal estimate instead of running it
+        #[arg(long)]
+        explain: bool,
+
+        /// Output format (ignored with --explain)
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+    },
+    /// List symbols matching a query expression
+    ///
+    /// Fields: kind, name, package (pkg), path, lang, owner (CODEOWNERS);
+    /// counts: fanin, fanout, degree, loc, line; flags: test, unowned.
+    Symbols {
+        /// Query expression, e.g. 'kind:func AND fanin > 5 AND NOT test'
+        expr: String,
+
+        /// Maximum number of matches to print
+        #[arg(long, default_value = "50")]
+        limit: usize,
+
+        /// Print one section per CODEOWNERS owner
+        #[arg(long)]
+        by_owner: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+    },
+    /// List graph edges matching a query expression
+    ///
+    /// Fields: kind, confidence, path, from, to, from.kind, to.kind,
+    /// from.pkg, to.pkg, from.owner, to.owner; counts: line; flags: cross
+    /// (between packages).
+    Edges {
+        /// Query expression, e.g. 'kind:calls AND cross AND to.pkg:db'
+        expr: String,
+
+        /// Maximum number of matches to print
+        #[arg(long, default_value = "50")]
+        limit: usize,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum AuditCommands {
+    /// Check the hash chain of the audit log
+    Verify {
+        /// Log file to check (default: `audit.path` or <data_dir>/audit.log)
+        #[arg(long)]
+        path: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum FindingCommands {
+    /// Show a finding's confidence and the evidence chain behind it: the
+    /// matched line, call edges, data-flow steps and parser or resolution
+    /// results
+    Show {
+        /// Finding id, or an unambiguous prefix of one
+        id: String,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum GraphCommands {
+    /// Serve an interactive viewer with live filters, neighborhood
+    /// expansion, path highlighting and PNG/SVG export
+    ///
+    /// Filters combine terms such as `kind:function`, `lang:go`,
+    /// `path:src/api/*`, `pkg:internal/*`, `name:handler`, `degree>5`;
+    /// prefix a term with `-` to exclude it and join two with `OR`. The
+    /// workspace is re-indexed on edits (like `cruxe daemon`) and the page
+    /// refreshes when the index changes.
+    Serve {
+        /// Project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Bind address
+        #[arg(long, default_value = "127.0.0.1")]
+        bind: String,
+
+        /// Port
+        #[arg(long, default_value = "9200")]
+        port: u16,
+
+        /// Serve the current index without watching the workspace
+        #[arg(long)]
+        no_watch: bool,
+    },
+}
+
+#[derive(Subcommand)]
+enum TelemetryCommands {
+    /// Print the pending report exactly as it would be sent
+    Show,
+    /// Send the pending report to `telemetry.endpoint` and start a new one
+    Send,
+    /// Discard the pending report
+    Reset,
+}
+
+#[derive(Subcommand)]
+enum BaselineCommands {
+    /// Write the current findings to the baseline file
+    Write {
+        /// Baseline file, relative to the workspace (default:
+        /// `.cruxe/baseline.json`)
+        #[arg(long)]
+        output: Option<String>,
+
+        /// Branch/ref scope (default: auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum HookCommands {
+    /// Check the staged change for new import cycles, broken references and
+    /// forbidden layer imports
+    #[command(name = "pre-commit")]
+    PreCommit {
+        /// Branch/ref whose index the change is checked against (default:
+        /// auto-detect or "live")
+        #[arg(long)]
+        r#ref: Option<String>,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum StateCommands {
+    /// Export state bundle to `.tar.zst`
+    Export {
+        /// Output archive path (for example: /tmp/state.tar.zst)
+        path: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Import state bundle from `.tar.zst`
+    Import {
+        /// Input archive path
+        path: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Upload the index to `[remote_cache]`, keyed by the commit it was built at
+    Push {
+        /// Key the bundle by this commit instead of HEAD (skips the check
+        /// that the index was built at HEAD)
+        #[arg(long)]
+        commit: Option<String>,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Import the cached index of the nearest ancestor of HEAD from
+    /// `[remote_cache]` and update it incrementally
+    Pull {
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum ApiCommands {
+    /// Classify exported API changes between two indexed refs as breaking
+    /// or additive
+    Diff {
+        /// Base ref
+        base: String,
+
+        /// Head ref
+        head: String,
+
+        /// Only items under this path prefix
+        #[arg(long)]
+        path: Option<String>,
+
+        /// Exit non-zero when any change is breaking
+        #[arg(long)]
+        fail_on_breaking: bool,
+
+        /// Output format
+        #[arg(long, default_value = "text", value_parser = ["text", "json", "ndjson"])]
+        format: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum ShardCommands {
+    /// Show configured and built shards
+    List {
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Export a built shard to `.tar.zst`
+    Export {
+        /// Shard name
+        name: String,
+
+        /// Output archive path
+        path: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+    /// Install a shard bundle built elsewhere
+    Import {
+        /// Shard name
+        name: String,
+
+        /// Input archive path
+        path: String,
+
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+    },
+}
+
+#[derive(Subcommand)]
+enum EvalCommands {
+    /// Evaluate retrieval quality and compare against baseline/policy gates
+    Retrieval {
+        /// Path to the project root (default: current directory)
+        #[arg(long)]
+        workspace: Option<String>,
+
+        /// Retrieval suite JSON path
+        #[arg(long)]
+        suite: Option<String>,
+
+        /// Baseline snapshot JSON path
+        #[arg(long)]
+        baseline: String,
+
+        /// Gate policy JSON path (thresholds + tolerances)
+        #[arg(long)]
+        policy: String,
+
+        /// Ref/branch scope (default: live)
+        #[arg(long, default_value = "live")]
+        r#ref: String,
+
+        /// Maximum number of hits considered per query
+        #[arg(long, default_value = "10")]
+        limit: usize,
+
+        /// Report output path (JSON)
+        #[arg(long)]
+        output: Option<String>,
+
+        /// Rollout mode: do not fail process on gate failures
+        #[arg(long)]
+        dry_run: bool,
+
+        /// Update baseline snapshot from current run before comparison
+        #[arg(long)]
+        update_baseline: bool,
+
+        /// Optional BEIR corpus path (`corpus.jsonl`)
+        #[arg(long)]
+        beir_corpus: Option<String>,
+
+        /// Optional BEIR queries path (`queries.jsonl`)
+        #[arg(long)]
+        beir_queries: Option<String>,
+
+        /// Optional BEIR qrels path (`qrels.tsv`)
+        #[arg(long)]
+        beir_qrels: Option<String>,
+
+        /// Optional TREC run output path
+        #[arg(long)]
+        trec_run_out: Option<String>,
+
+        /// Optional TREC qrels output path
+        #[arg(long)]
+        trec_qrels_out: Option<String>,
+    },
+}
+
+fn main() -> anyhow::Result<()> {
+    let cli = parse_cli();
+
+    // Set up tracing
+    let (otel_layer, _otel_exporter) = match cli.otlp_endpoint.as_deref() {
+        Some(endpoint) => {
+            let (layer, exporter) = otel::layer(endpoint)?;
+            (Some(layer), Some(exporter))
+        }
+        None => (None, None),
+    };
+    let (text_layer, json_layer) = match cli.log_format {
+        logging::LogFormat::Text => (
+            Some(tracing_subscriber::fmt::layer().with_target(false)),
+            None,
+        ),
+        logging::LogFormat::Json => (
+            None,
+            Some(
+                tracing_subscriber::fmt::layer()
+                    .event_format(logging::JsonFormat)
+                    .with_writer(std::io::stderr),
+            ),
+        ),
+    };
+    tracing_subscriber::registry()
+        .with(logging::filter(cli.log_level, cli.verbose))
+        .with(text_layer)
+        .with(json_layer)
+        .with(otel_layer)
+        .init();
+
+    style::init(cli.plain, cli.no_color, cli.theme);
+    let config_file = cli.config.as_deref().map(std::path::Path::new);
+    if !cli.include.is_empty() || !cli.exclude.is_empty() {
+        cruxe_core::config::override_path_scope(cli.include.clone(), cli.exclude.clone());
+    }
+    if !cli.project.is_empty() {
+        commands::scope::select_projects(cli.project.clone());
+    }
+    if let Some(build) = cli.build.clone() {
+        commands::scope::select_build(build);
+    }
+
+    if let Some(name) = cli.command.telemetry_name()
+        && let Some(mut recorder) = cruxe_core::config::Config::load_with_file(None, config_file)
+            .ok()
+            .and_then(|config| cruxe_core::telemetry::Recorder::from_config(&config))
+    {
+        recorder.feature(name);
+        recorder.flush();
+    }
+
+    if cli.stats.is_some() {
+        cruxe_core::stats::enable(cli.command.telemetry_name().unwrap_or("telemetry"));
+    }
+    let timeout = cli.timeout_secs.map(std::time::Duration::from_secs);
+    if let Some(timeout) = timeout {
+        let grace = if cli.command.stops_cooperatively() {
+            interrupt::STOP_GRACE
+        } else {
+            std::time::Duration::ZERO
+        };
+        interrupt::arm_deadline(timeout, grace);
+    }
+    let result = run(cli.command, config_file, timeout);
+    // Printed for failed runs too: a regression that ends in an error is
+    // still worth timing.
+    if let Some(StatsFormat::Json) = cli.stats
+        && let Some(stats) = cruxe_core::stats::finish()
+    {
+        eprintln!("{}", serde_json::to_string(&stats)?);
+    }
+    if let Err(err) = &result
+        && let Some(cancelled) = err.downcast_ref::<cruxe_core::cancel::Cancelled>()
+    {
+        eprintln!("{}", interrupt::stopped_message(*cancelled, timeout));
+        std::process::exit(interrupt::exit_code(*cancelled));
+    }
+    if let Err(err) = &result
+        && let Some(failed) = err.downcast_ref::<commands::gate::GateFailed>()
+    {
+        std::io::Write::flush(&mut std::io::stdout())?;
+        eprintln!("{failed}");
+        std::process::exit(commands::gate::GATE_EXIT_CODE);
+    }
+    result
+}
+
+fn run(
+    command: Commands,
+    config_file: Option<&std::path::Path>,
+    timeout: Option<std::time::Duration>,
+) -> anyhow::Result<()> {
+    match command {
+        Commands::Init {
+            path,
+            template,
+            force,
+        } => {
+            let path = resolve_path(path)?;
+            commands::init::run(&path, template.as_deref(), force, config_file)?;
+        }
+        Commands::Doctor { path, repair } => {
+            let path = resolve_path(path)?;
+            commands::doctor::run(&path, config_file, repair)?;
+        }
+        Commands::Preflight {
+            path,
+            explain,
+            no_ignore,
+            format,
+        } => {
+            let path = resolve_path(path)?;
+            commands::preflight::run(&path, &explain, !no_ignore, &format, config_file)?;
+        }
+        Commands::Index {
+            url,
+            path,
+            force,
+            r#ref,
+            format,
+            output,
+            compress,
+            jobs,
+            max_memory,
+            shard,
+            bodies,
+            no_ignore,
+            submodules,
+            symlinks,
+            progress,
+        } => {
+            let remote = url
+                .as_deref()
+                .map(|url| commands::remote::checkout(url, config_file))
+                .transpose()?;
+            let (path, r#ref) = match &remote {
+                Some(remote) => (remote.path.clone(), Some(remote.ref_name.clone())),
+                None => (resolve_path(path)?, r#ref),
+            };
+            let cancel = cancellation_token(timeout);
+            commands::index::run(
+                &path,
+                force,
+                r#ref.as_deref(),
+                config_file,
+                jobs,
+                max_memory.as_deref(),
+                shard.as_deref(),
+                bodies,
+                !no_ignore,
+                submodules,
+                symlinks.as_deref(),
+                progress,
+                &cancel,
+            )?;
+            if let Some(format) = format {
+                commands::export::write_index_file(
+                    &path,
+                    &format,
+                    output.as_deref().map(std::path::Path::new),
+                    compress,
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            }
+            if let Some(remote) = &remote {
+                commands::remote::record_origin(remote, config_file)?;
+            }
+        }
+        Commands::Search {
+            query,
+            sig,
+            r#ref,
+            lang,
+            kind,
+            package,
+            in_docs,
+            limit,
+            format,
+            federated,
+        } => {
+            let path = std::env::current_dir()?;
+            let kinds = match kind.as_deref() {
+                Some(spec) => cruxe_query::fuzzy::parse_kinds(spec).map_err(anyhow::Error::msg)?,
+                None => Vec::new(),
+            };
+            let filter = cruxe_query::fuzzy::SymbolFilter {
+                kinds,
+                package,
+                language: lang,
+            };
+            if let Some(sig) = sig {
+                commands::search::run_signature(
+                    &path,
+                    &sig,
+                    r#ref.as_deref(),
+                    &filter,
+                    limit,
+                    &format,
+                    config_file,
+                )?;
+            } else if federated {
+                commands::federation::search(
+                    &path,
+                    &query.unwrap_or_default(),
+                    r#ref.as_deref(),
+                    &filter,
+                    in_docs,
+                    limit,
+                    &format,
+                    config_file,
+                )?;
+            } else {
+                commands::search::run(
+                    &path,
+                    &query.unwrap_or_default(),
+                    r#ref.as_deref(),
+                    &filter,
+                    in_docs,
+                    limit,
+                    &format,
+                    config_file,
+                )?;
+            }
+        }
+        Commands::Refs {
+            symbol,
+            kind,
+            federated,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            if federated {
+                commands::federation::refs(
+                    &path,
+                    &symbol,
+                    kind.as_deref(),
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            } else {
+                commands::refs::run(
+                    &path,
+                    &symbol,
+                    kind.as_deref(),
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            }
+        }
+        Commands::Def {
+            position,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::def::run(&path, &position, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Resolve {
+            id,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::resolve::run(&path, &id, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Rename {
+            symbol,
+            new_name,
+            dry_run,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::rename::run(
+                &path,
+                &symbol,
+                &new_name,
+                dry_run,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Callers {
+            symbol,
+            path: symbol_path,
+            depth,
+            limit,
+            format,
+            r#ref,
+            workspace,
+            federated,
+        } => {
+            let path = resolve_path(workspace)?;
+            if federated {
+                if symbol_path.is_some() || format == "dot" {
+                    anyhow::bail!("--federated callers support neither --path nor --format dot");
+                }
+                commands::federation::callers(
+                    &path,
+                    &symbol,
+                    depth,
+                    limit,
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            } else {
+                commands::call_tree::run(
+                    &path,
+                    &symbol,
+                    cruxe_query::call_graph::CallGraphDirection::Callers,
+                    &commands::call_tree::CallTreeOptions {
+                        path: symbol_path.as_deref(),
+                        depth,
+                        limit,
+                        format: &format,
+                    },
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            }
+        }
+        Commands::Callees {
+            symbol,
+            path: symbol_path,
+            depth,
+            limit,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::call_tree::run(
+                &path,
+                &symbol,
+                cruxe_query::call_graph::CallGraphDirection::Callees,
+                &commands::call_tree::CallTreeOptions {
+                    path: symbol_path.as_deref(),
+                    depth,
+                    limit,
+                    format: &format,
+                },
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Impls {
+            interface,
+            path,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::impls::run(
+                &workspace,
+                &interface,
+                path.as_deref(),
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Impact {
+            changed,
+            depth,
+            limit,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::impact::run(
+                &path,
+                &changed,
+                depth,
+                limit,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::TestsFor {
+            symbol,
+            path,
+            depth,
+            limit,
+            coverage,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::tests_for::run(
+                &workspace,
+                &symbol,
+                path.as_deref(),
+                depth,
+                limit,
+                &coverage,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Outline {
+            file,
+            top,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::outline::run(&path, &file, top, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Deps {
+            external,
+            group_depth,
+            cycles,
+            check,
+            format,
+            fail_on,
+            baseline,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            commands::deps::run(
+                &path,
+                &external,
+                group_depth,
+                cycles,
+                check,
+                &format,
+                r#ref.as_deref(),
+                baseline.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Deadcode {
+            allow,
+            include_exported,
+            unused_exports,
+            include_generated,
+            format,
+            fail_on,
+            baseline,
+            r#ref,
+            workspace,
+        } => {
+            let path = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            commands::deadcode::run(
+                &path,
+                &allow,
+                include_exported,
+                unused_exports,
+                include_generated,
+                &format,
+                r#ref.as_deref(),
+                baseline.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Duplicates {
+            min_lines,
+            min_tokens,
+            min_similarity,
+            path,
+            include_generated,
+            format,
+            fail_on,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            let options = cruxe_query::duplicates::DuplicateOptions {
+                min_lines,
+                min_tokens,
+                min_similarity,
+                path_prefix: path,
+                include_generated,
+                ..Default::default()
+            };
+            commands::duplicates::run(
+                &workspace,
+                options,
+                &format,
+                r#ref.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Hotspots {
+            since,
+            limit,
+            path,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::hotspots::run(
+                &workspace,
+                since.as_deref(),
+                limit,
+                path.as_deref(),
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::LintArch {
+            rules,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::lint_arch::run(
+                &workspace,
+                rules.as_deref(),
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::DocCoverage {
+            path,
+            format,
+            fail_on,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            commands::doc_coverage::run(
+                &workspace,
+                path.as_deref(),
+                &format,
+                r#ref.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Todos {
+            marker,
+            package,
+            owner,
+            min_age,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::todos::TodoOptions {
+                markers: marker,
+                package,
+                owner,
+                min_age_days: min_age,
+                ..Default::default()
+            };
+            commands::todos::run(&workspace, options, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Errors {
+            symbol,
+            path,
+            depth,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::errors::run(
+                &workspace,
+                &symbol,
+                path.as_deref(),
+                depth,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Exits {
+            from,
+            format,
+            fail_on,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            commands::exits::run(
+                &workspace,
+                &from,
+                &format,
+                r#ref.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Concurrency {
+            kind,
+            package,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::concurrency::ConcurrencyOptions {
+                kinds: kind,
+                package,
+                ..Default::default()
+            };
+            commands::concurrency::run(
+                &workspace,
+                options,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Routes {
+            method,
+            prefix,
+            depth,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::routes::RouteOptions {
+                methods: method,
+                prefix,
+                depth,
+                ..Default::default()
+            };
+            commands::routes::run(&workspace, options, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::WhereUsed {
+            literal,
+            prefix,
+            kind,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::where_used::WhereUsedOptions {
+                literal,
+                prefix,
+                kinds: kind,
+                ..Default::default()
+            };
+            commands::where_used::run(&workspace, options, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Projects {
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::projects::run(&workspace, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Sync {
+            workspace,
+            force,
+            jobs,
+            max_memory,
+            no_ignore,
+            submodules,
+            symlinks,
+            progress,
+        } => {
+            let path = resolve_path(workspace)?;
+            let cancel = cancellation_token(timeout);
+            commands::index::run(
+                &path,
+                force,
+                None,
+                config_file,
+                jobs,
+                max_memory.as_deref(),
+                None,
+                None,
+                !no_ignore,
+                submodules,
+                symlinks.as_deref(),
+                progress,
+                &cancel,
+            )?;
+        }
+        Commands::Bench {
+            path,
+            iterations,
+            format,
+            save_baseline,
+            baseline,
+            max_regression,
+        } => {
+            let path = resolve_path(path)?;
+            let options = commands::bench::BenchOptions {
+                iterations,
+                format: &format,
+                save_baseline: save_baseline.as_deref().map(std::path::Path::new),
+                baseline: baseline.as_deref().map(std::path::Path::new),
+                max_regression_pct: max_regression,
+            };
+            commands::bench::run(&path, &options, config_file)?;
+        }
+        Commands::Eval { command } => match command {
+            EvalCommands::Retrieval {
+                workspace,
+                suite,
+                baseline,
+                policy,
+                r#ref,
+                limit,
+                output,
+                dry_run,
+                update_baseline,
+                beir_corpus,
+                beir_queries,
+                beir_qrels,
+                trec_run_out,
+                trec_qrels_out,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                let suite_path = suite.as_deref().map(std::path::Path::new);
+                let output_path = output.as_deref().map(std::path::Path::new);
+                let beir_corpus_path = beir_corpus.as_deref().map(std::path::Path::new);
+                let beir_queries_path = beir_queries.as_deref().map(std::path::Path::new);
+                let beir_qrels_path = beir_qrels.as_deref().map(std::path::Path::new);
+                let trec_run_out = trec_run_out.as_deref().map(std::path::Path::new);
+                let trec_qrels_out = trec_qrels_out.as_deref().map(std::path::Path::new);
+                commands::eval::run_retrieval(
+                    &workspace,
+                    suite_path,
+                    std::path::Path::new(&baseline),
+                    std::path::Path::new(&policy),
+                    &r#ref,
+                    limit,
+                    output_path,
+                    dry_run,
+                    update_baseline,
+                    beir_corpus_path,
+                    beir_queries_path,
+                    beir_qrels_path,
+                    trec_run_out,
+                    trec_qrels_out,
+                    config_file,
+                )?;
+            }
+        },
+        Commands::Export {
+            format,
+            output,
+            out_dir,
+            call_path,
+            compress,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::export::run(
+                &workspace,
+                &format,
+                output.as_deref().map(std::path::Path::new),
+                out_dir.as_deref().map(std::path::Path::new),
+                &call_path,
+                compress,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Report {
+            format,
+            output,
+            top,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::report::run(
+                &workspace,
+                &format,
+                output.as_deref().map(std::path::Path::new),
+                top,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Serve {
+            http,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::serve::run(&workspace, &http, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Diff {
+            base,
+            head,
+            exported_only,
+            include_bodies,
+            path,
+            format,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::symbol_diff::SymbolDiffOptions {
+                include_body_changes: include_bodies,
+                exported_only,
+                path_prefix: path,
+            };
+            commands::diff::run(&workspace, &base, &head, &options, &format, config_file)?;
+        }
+        Commands::Api {
+            command,
+            path,
+            format,
+            r#ref,
+            workspace,
+        } => match command {
+            Some(ApiCommands::Diff {
+                base,
+                head,
+                path,
+                fail_on_breaking,
+                format,
+                workspace,
+            }) => {
+                let workspace = resolve_path(workspace)?;
+                commands::api::diff(
+                    &workspace,
+                    &base,
+                    &head,
+                    path.as_deref(),
+                    &format,
+                    fail_on_breaking,
+                    config_file,
+                )?;
+            }
+            None => {
+                let workspace = resolve_path(workspace)?;
+                commands::api::run(
+                    &workspace,
+                    path.as_deref(),
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            }
+        },
+        Commands::Describe {
+            symbol,
+            path: symbol_path,
+            history,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::describe::run(
+                &workspace,
+                &symbol,
+                symbol_path.as_deref(),
+                history,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Context {
+            symbol,
+            path: symbol_path,
+            budget,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::context::run(
+                &workspace,
+                &symbol,
+                symbol_path.as_deref(),
+                budget,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Ask {
+            question,
+            limit,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::ask::run(
+                &workspace,
+                &question,
+                limit,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Embed {
+            force,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let cancel = cancellation_token(timeout);
+            commands::embed::run(
+                &workspace,
+                r#ref.as_deref(),
+                force,
+                &format,
+                config_file,
+                &cancel,
+            )?;
+        }
+        Commands::Chunk {
+            paths,
+            max_lines,
+            overlap_lines,
+            max_tokens,
+            format,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::chunk::run(
+                &workspace,
+                &paths,
+                max_lines,
+                overlap_lines,
+                max_tokens,
+                &format,
+                config_file,
+            )?;
+        }
+        Commands::Summarize {
+            package,
+            refresh,
+            heuristic,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::summarize::run(
+                &workspace,
+                &package,
+                refresh,
+                heuristic,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Map {
+            budget,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::map::run(&workspace, budget, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Relevant {
+            task,
+            limit,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::relevant::run(
+                &workspace,
+                &task,
+                limit,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Snippet {
+            symbol,
+            path: symbol_path,
+            with_doc,
+            with_imports,
+            with_types,
+            with_callers,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::snippet::SnippetOptions {
+                with_doc,
+                with_imports,
+                with_types,
+                with_callers,
+            };
+            commands::snippet::run(
+                &workspace,
+                &symbol,
+                symbol_path.as_deref(),
+                &options,
+                &format,
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Changed {
+            range,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::changed::run(&workspace, &range, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Batch { r#ref, workspace } => {
+            let workspace = resolve_path(workspace)?;
+            commands::batch::run(&workspace, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Upload {
+            endpoint,
+            token,
+            file,
+            repo,
+            commit,
+            root,
+            retries,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = commands::upload::UploadOptions {
+                endpoint: &endpoint,
+                token: token.as_deref(),
+                file: file.as_deref().map(std::path::Path::new),
+                repo: repo.as_deref(),
+                commit: commit.as_deref(),
+                root: &root,
+                attempts: retries,
+                r#ref: r#ref.as_deref(),
+            };
+            commands::upload::run(&workspace, &options, config_file)?;
+        }
+        Commands::Hook { command } => match command {
+            HookCommands::PreCommit {
+                r#ref,
+                format,
+                workspace,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                commands::hook::pre_commit(&workspace, &format, r#ref.as_deref(), config_file)?;
+            }
+        },
+        Commands::Editor { r#ref, workspace } => {
+            let workspace = resolve_path(workspace)?;
+            commands::editor::run(&workspace, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Baseline { command } => match command {
+            BaselineCommands::Write {
+                output,
+                r#ref,
+                workspace,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                commands::baseline::write(
+                    &workspace,
+                    output.as_deref(),
+                    r#ref.as_deref(),
+                    config_file,
+                )?;
+            }
+        },
+        Commands::Lsp { r#ref, workspace } => {
+            let workspace = resolve_path(workspace)?;
+            commands::lsp::run(&workspace, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Schema { command, ndjson } => {
+            commands::schema::run(&command, ndjson)?;
+        }
+        Commands::Grep {
+            pattern,
+            structural,
+            ignore_case,
+            path,
+            lang,
+            limit,
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let options = cruxe_query::grep::GrepOptions {
+                pattern,
+                kind: if structural {
+                    cruxe_query::grep::PatternKind::Structural
+                } else {
+                    cruxe_query::grep::PatternKind::Regex
+                },
+                ignore_case,
+                paths: path,
+                language: lang,
+                limit,
+            };
+            commands::grep::run(&workspace, &options, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Stats {
+            top,
+            format,
+            fail_on,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let fail_on = commands::gate::parse(fail_on.as_deref())?;
+            commands::stats::run(
+                &workspace,
+                top,
+                &format,
+                r#ref.as_deref(),
+                fail_on.as_ref(),
+                config_file,
+            )?;
+        }
+        Commands::Tui { r#ref, workspace } => {
+            let workspace = resolve_path(workspace)?;
+            commands::tui::run(&workspace, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Watch {
+            exec,
+            interval_ms,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            let cancel = cancellation_token(timeout);
+            commands::watch::run(
+                &workspace,
+                &exec,
+                std::time::Duration::from_millis(interval_ms.max(50)),
+                config_file,
+                &cancel,
+            )?;
+        }
+        Commands::Completions { shell } => {
+            commands::completions::print(&shell, &mut Cli::command())?;
+        }
+        Commands::CompleteSymbols {
+            prefix,
+            limit,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::completions::complete_symbols(&workspace, &prefix, limit, config_file)?;
+        }
+        Commands::Tags {
+            format,
+            output,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::tags::run(
+                &workspace,
+                &format,
+                output.as_deref().map(std::path::Path::new),
+                r#ref.as_deref(),
+                config_file,
+            )?;
+        }
+        Commands::Templates {
+            format,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::templates::run(&workspace, &format, r#ref.as_deref(), config_file)?;
+        }
+        Commands::Check {
+            rules,
+            format,
+            list_rules,
+            profile,
+            ratchet,
+            baseline,
+            by_owner,
+            owners_dir,
+            notify,
+            fail_on,
+            r#ref,
+            workspace,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            if list_rules {
+                commands::check::list_rules(&workspace, profile.as_deref(), config_file)?;
+            } else {
+                let fail_on = commands::gate::parse(fail_on.as_deref())?;
+                let routing = commands::check::OwnerRouting {
+                    by_owner,
+                    owners_dir: owners_dir.as_deref().map(std::path::Path::new),
+                    notify,
+                };
+                commands::check::run(
+                    &workspace,
+                    &rules,
+                    &format,
+                    r#ref.as_deref(),
+                    profile.as_deref(),
+                    ratchet,
+                    baseline.as_deref(),
+                    &routing,
+                    fail_on.as_ref(),
+                    config_file,
+                )?;
+            }
+        }
+        Commands::Shard { command } => match command {
+            ShardCommands::List { workspace } => {
+                let workspace = resolve_path(workspace)?;
+                commands::shard::list(&workspace, config_file)?;
+            }
+            ShardCommands::Export {
+                name,
+                path,
+                workspace,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                commands::shard::export(
+                    &workspace,
+                    &name,
+                    std::path::Path::new(&path),
+                    config_file,
+                )?;
+            }
+            ShardCommands::Import {
+                name,
+                path,
+                workspace,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                commands::shard::import(
+                    &workspace,
+                    &name,
+                    std::path::Path::new(&path),
+                    config_file,
+                )?;
+            }
+        },
+        Commands::State { command } => match command {
+            StateCommands::Export { path, workspace } => {
+                let workspace = resolve_path(workspace)?;
+                commands::state_export::run(&workspace, std::path::Path::new(&path), config_file)?;
+            }
+            StateCommands::Import { path, workspace } => {
+                let workspace = resolve_path(workspace)?;
+                commands::state_import::run(&workspace, std::path::Path::new(&path), config_file)?;
+            }
+            StateCommands::Push { commit, workspace } => {
+                let workspace = resolve_path(workspace)?;
+                commands::remote_cache::push(&workspace, commit.as_deref(), config_file)?;
+            }
+            StateCommands::Pull { workspace } => {
+                let workspace = resolve_path(workspace)?;
+                let cancel = cancellation_token(timeout);
+                commands::remote_cache::pull(&workspace, config_file, &cancel)?;
+            }
+        },
+        Commands::PruneOverlays {
+            workspace,
+            older_than_days,
+        } => {
+            let workspace = resolve_path(workspace)?;
+            commands::prune_overlays::run(&workspace, older_than_days, config_file)?;
+        }
+        Commands::ServeMcp {
+            workspace,
+            no_prewarm,
+            transport,
+            port,
+            bind,
+            auto_workspace,
+            allowed_roots,
+            max_auto_workspaces,
+        } => {
+            let path = resolve_path(workspace)?;
+            validate_serve_mcp_args(auto_workspace, &allowed_roots)?;
+            // HIGH-4: Canonicalize --allowed-root paths at startup; reject nonexistent
+            let mut canonical_roots = Vec::new();
+            for root in &allowed_roots {
+                let root_path = std::path::Path::new(root);
+                match root_path.canonicalize() {
+                    Ok(canonical) => canonical_roots.push(canonical),
+                    Err(e) => {
+                        anyhow::bail!("--allowed-root '{}' is not a valid path: {}", root, e);
+                    }
+                }
+            }
+            let ws_config = cruxe_core::types::WorkspaceConfig {
+                auto_workspace,
+                allowed_roots: cruxe_core::types::AllowedRoots::new(canonical_roots),
+                max_auto_workspaces,
+            };
+            match transport {
+                McpTransport::Http => {
+                    commands::serve_mcp::run_http(
+                        &path,
+                        config_file,
+                        no_prewarm,
+                        ws_config,
+                        &bind,
+                        port,
+                    )?;
+                }
+                McpTransport::Stdio => {
+                    commands::serve_mcp::run(&path, config_file, no_prewarm, ws_config)?;
+                }
+            }
+        }
+        Commands::Daemon {
+            workspace,
+            socket,
+            poll_interval_ms,
+            no_prewarm,
+            metrics_addr,
+            refs,
+            worktrees,
+        } => {
+            let path = resolve_path(workspace)?;
+            commands::daemon::run(
+                &path,
+                socket.as_deref().map(std::path::Path::new),
+                poll_interval_ms,
+                no_prewarm,
+                metrics_addr.as_deref(),
+                refs,
+                worktrees,
+                config_file,
+            )?;
+        }
+        Commands::Telemetry { command } => match command {
+            TelemetryCommands::Show => commands::telemetry::show(config_file)?,
+            TelemetryCommands::Send => commands::telemetry::send(config_file)?,
+            TelemetryCommands::Reset => commands::telemetry::reset(config_file)?,
+        },
+        Commands::Finding { command } => match command {
+            FindingCommands::Show {
+                id,
+                format,
+                r#ref,
+                workspace,
+            } => {
+                let workspace = resolve_path(workspace)?;
+                commands::finding::show(&workspace, &id, &format, r#ref.as_deref(), config_file)?;
+            }
+        },
+        Commands::Graph { command } => match command {
+            GraphCommands::Serve {
+                workspace,
+                r#ref,
+                bind,
+                port,
+                no_watch,
+            } => {
+                let path = resolve_path(workspace)?;
+                commands::graph::serve(
+                    &path,
+                    r#ref.as_deref(),
+                    &bind,
+                    port,
+                    no_watch,
+                    config_file,
+                )?;
+            }
+        },
+        Commands::Audit { command } => match command {
+            AuditCommands::Verify { path } => {
+                commands::audit::verify(path.as_deref().map(std::path::Path::new), config_file)?
+            }
+        },
+        Commands::Query { command } => {
+            let path = std::env::current_dir()?;
+            let cancel = cancellation_token(timeout);
+            commands::remote_cache::pull_if_missing(&path, config_file, &cancel)?;
+            match command {
+                QueryCommands::Search {
+                    query,
+                    r#ref,
+                    lang,
+                    limit,
+                    explain,
+                    format,
+                } => commands::query::search(
+                    &path,
+                    &query,
+                    r#ref.as_deref(),
+                    lang.as_deref(),
+                    limit,
+                    explain,
+                    &format,
+                    config_file,
+                )?,
+                QueryCommands::CallGraph {
+                    symbol,
+                    path: symbol_path,
+                    direction,
+                    depth,
+                    limit,
+                    r#ref,
+                    explain,
+                    format,
+                } => commands::query::call_graph(
+                    &path,
+                    &symbol,
+                    symbol_path.as_deref(),
+                    &direction,
+                    depth,
+                    limit,
+                    r#ref.as_deref(),
+                    explain,
+                    &format,
+                    config_file,
+                )?,
+                QueryCommands::Symbols {
+                    expr,
+                    limit,
+                    by_owner,
+                    format,
+                    r#ref,
+                } => commands::query::symbols(
+                    &path,
+                    &expr,
+                    limit,
+                    by_owner,
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?,
+                QueryCommands::Edges {
+                    expr,
+                    limit,
+                    format,
+                    r#ref,
+                } => commands::query::edges(
+                    &path,
+                    &expr,
+                    limit,
+                    &format,
+                    r#ref.as_deref(),
+                    config_file,
+                )?,
+            }
+        }
+    }
+
+    Ok(())
+}
+
+impl Commands {
+    /// Feature name counted by opt-in telemetry; `None` for the telemetry
+    /// command itself so inspecting a report does not change it.
+    fn telemetry_name(&self) -> Option<&'static str> {
+        Some(match self {
+            Commands::Init { .. } => "init",
+            Commands::Doctor { .. } => "doctor",
+            Commands::Preflight { .. } => "preflight",
+            Commands::Index { force: true, .. } => "index.force",
+            Commands::Index { .. } => "index",
+            Commands::Search {
+                federated: true, ..
+            } => "search.federated",
+            Commands::Search { sig: Some(_), .. } => "search.sig",
+            Commands::Search { .. } => "search",
+            Commands::Refs {
+                federated: true, ..
+            } => "refs.federated",
+            Commands::Refs { .. } => "refs",
+            Commands::Def { .. } => "def",
+            Commands::Resolve { .. } => "resolve",
+            Commands::Rename { .. } => "rename",
+            Commands::Callers {
+                federated: true, ..
+            } => "callers.federated",
+            Commands::Callers { .. } => "callers",
+            Commands::Callees { .. } => "callees",
+            Commands::Impls { .. } => "impls",
+            Commands::Impact { .. } => "impact",
+            Commands::TestsFor { .. } => "tests_for",
+            Commands::Outline { .. } => "outline",
+            Commands::Deps { .. } => "deps",
+            Commands::Deadcode { .. } => "deadcode",
+            Commands::Duplicates { .. } => "duplicates",
+            Commands::Hotspots { .. } => "hotspots",
+            Commands::LintArch { .. } => "lint_arch",
+            Commands::DocCoverage { .. } => "doc_coverage",
+            Commands::Todos { .. } => "todos",
+            Commands::Errors { .. } => "errors",
+            Commands::Exits { .. } => "exits",
+            Commands::Concurrency { .. } => "concurrency",
+            Commands::Routes { .. } => "routes",
+            Commands::WhereUsed { .. } => "where-used",
+            Commands::Projects { .. } => "projects",
+            Commands::Sync { .. } => "sync",
+            Commands::Bench { .. } => "bench",
+            Commands::Eval { .. } => "eval",
+            Commands::Export { .. } => "export",
+            Commands::Report { .. } => "report",
+            Commands::Serve { .. } => "serve",
+            Commands::Diff { .. } => "diff",
+            Commands::Api { .. } => "api",
+            Commands::Describe { .. } => "describe",
+            Commands::Context { .. } => "context",
+            Commands::Ask { .. } => "ask",
+            Commands::Embed { .. } => "embed",
+            Commands::Chunk { .. } => "chunk",
+            Commands::Summarize { .. } => "summarize",
+            Commands::Map { .. } => "map",
+            Commands::Relevant { .. } => "relevant",
+            Commands::Snippet { .. } => "snippet",
+            Commands::Changed { .. } => "changed",
+            Commands::Batch { .. } => "batch",
+            Commands::Lsp { .. } => "lsp",
+            Commands::Baseline { .. } => "baseline",
+            Commands::Editor { .. } => "editor",
+            Commands::Hook { .. } => "hook",
+            Commands::Upload { .. } => "upload",
+            Commands::Schema { .. } => "schema",
+            Commands::Grep { .. } => "grep",
+            Commands::Stats { .. } => "stats",
+            Commands::Tui { .. } => "tui",
+            Commands::Watch { .. } => "watch",
+            Commands::Tags { .. } => "tags",
+            Commands::Templates { .. } => "templates",
+            Commands::Check { .. } => "check",
+            Commands::Shard { .. } => "shard",
+            Commands::State { .. } => "state",
+            Commands::PruneOverlays { .. } => "prune_overlays",
+            Commands::ServeMcp {
+                transport: McpTransport::Http,
+                ..
+            } => "serve_mcp.http",
+            Commands::ServeMcp { .. } => "serve_mcp.stdio",
+            Commands::Daemon { .. } => "daemon",
+            Commands::Finding { .. } => "finding",
+            Commands::Graph { .. } => "graph",
+            Commands::Audit { .. } => "audit",
+            Commands::Query { .. } => "query",
+            Commands::Completions { .. } | Commands::CompleteSymbols { .. } => return None,
+            Commands::Telemetry { .. } => return None,
+        })
+    }
+
+    /// Whether the command polls its cancellation token, so `--timeout`
+    /// lets it stop at a safe point before the process is ended.
+    fn stops_cooperatively(&self) -> bool {
+        matches!(
+            self,
+            Commands::Index { .. }
+                | Commands::Sync { .. }
+                | Commands::Embed { .. }
+                | Commands::Watch { .. }
+                | Commands::State {
+                    command: StateCommands::Pull { .. }
+                }
         )
-        .with_target(false)
-        .init();
+    }
+}
+
+fn validate_serve_mcp_args(auto_workspace: bool, allowed_roots: &[String]) -> anyhow::Result<()> {
+    if auto_workspace && allowed_roots.is_empty() {
+        anyhow::bail!("--auto-workspace requires at least one --allowed-root");
+    }
+    Ok(())
+}
+
+/// Token for long-running commands: cancelled by SIGINT/SIGTERM or after
+/// `--timeout`.
+fn cancellation_token(
+    timeout: Option<std::time::Duration>,
+) -> cruxe_core::cancel::CancellationToken {
+    let token = interrupt::install();
+    match timeout {
+        Some(timeout) => token.with_timeout(timeout),
+        None => token,
+    }
+}
+
+/// Parse the command line, letting `[output] format` from the config stand in
+/// for a `--format` the command takes but was not given.
+fn parse_cli() -> Cli {
+    let args: Vec<std::ffi::OsString> = std::env::args_os().collect();
+    let matches = Cli::command().get_matches_from(&args);
+    let cli = Cli::from_arg_matches(&matches).unwrap_or_else(|err| err.exit());
+    // Anything after `--` is positional, so an appended flag would not parse.
+    if args.iter().any(|arg| arg == "--") {
+        return cli;
+    }
+    match configured_format(&matches) {
+        Some(format) => {
+            let mut args = args;
+            args.push("--format".into());
+            args.push(format.into());
+            // A format the command does not accept keeps its own default.
+            Cli::try_parse_from(args).unwrap_or(cli)
+        }
+        None => cli,
+    }
+}
+
+/// The configured output format, when the invoked subcommand has a
+/// `--format` left at its default.
+fn configured_format(matches: &clap::ArgMatches) -> Option<String> {
+    let mut leaf = matches;
+    while let Some((_, sub)) = leaf.subcommand() {
+        leaf = sub;
+    }
+    if !leaf.try_contains_id("format").unwrap_or(false)
+        || leaf.value_source("format") != Some(clap::parser::ValueSource::DefaultValue)
+    {
+        return None;
+    }
+    let root = ["workspace", "path"]
+        .into_iter()
+        .find_map(|id| leaf.try_get_one::<String>(id).ok().flatten())
+        .map(std::path::PathBuf::from)
+        .or_else(|| std::env::current_dir().ok())?;
+    let config_file = matches
+        .get_one::<String>("config")
+        .map(std::path::Path::new);
+    cruxe_core::config::Config::load_with_file(Some(&root), config_file)
+        .ok()?
+        .output
+        .format
+}
+
+fn resolve_path(path: Option<String>) -> anyhow::Result<std::path::PathBuf> {
+    match path {
+        Some(p) => Ok(std::path::PathBuf::from(p)),
+        None => Ok(std::env::current_dir()?),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn serve_mcp_rejects_invalid_transport_value() {
+        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "httpp"]);
+        assert!(parsed.is_err(), "invalid transport should be rejected");
+    }
+
+    #[test]
+    fn mcp_alias_accepts_sse_transport() {
+        let parsed = Cli::try_parse_from(["cruxe", "mcp", "--transport", "sse"])
+            .expect("mcp alias with sse transport should parse");
+        assert_eq!(parsed.command.telemetry_name(), Some("serve_mcp.http"));
+        match parsed.command {
+            Commands::ServeMcp { transport, .. } => assert_eq!(transport, McpTransport::Http),
+            _ => panic!("expected serve-mcp command"),
+        }
+    }
+
+    #[test]
+    fn serve_mcp_accepts_http_transport_value() {
+        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "http"])
+            .expect("http transport should parse");
+
+        match parsed.command {
+            Commands::ServeMcp { transport, .. } => assert_eq!(transport, McpTransport::Http),
+            _ => panic!("expected serve-mcp command"),
+        }
+    }
+
+    #[test]
+    fn serve_mcp_rejects_empty_transport_value() {
+        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", ""]);
+        assert!(parsed.is_err(), "empty transport should be rejected");
+    }
+
+    #[test]
+    fn serve_mcp_rejects_uppercase_transport_value() {
+        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "HTTP"]);
+        assert!(parsed.is_err(), "uppercase transport should be rejected");
+    }
+
+    #[test]
+    fn serve_mcp_validate_requires_allowed_root_when_auto_workspace_enabled() {
+        let err = validate_serve_mcp_args(true, &[]).expect_err("validation should fail");
+        assert!(
+            err.to_string()
+                .contains("--auto-workspace requires at least one --allowed-root"),
+            "unexpected validation message: {err}"
+        );
+    }
+
+    #[test]
+    fn telemetry_command_is_not_counted_as_feature_usage() {
+        let show = Cli::try_parse_from(["cruxe", "telemetry", "show"]).unwrap();
+        assert_eq!(show.command.telemetry_name(), None);
+
+        let index = Cli::try_parse_from(["cruxe", "index", "--force"]).unwrap();
+        assert_eq!(index.command.telemetry_name(), Some("index.force"));
+    }
+
+    #[test]
+    fn stats_flag_is_accepted_after_any_subcommand() {
+        let parsed = Cli::try_parse_from(["cruxe", "index", "--force", "--stats", "json"]).unwrap();
+        assert_eq!(parsed.stats, Some(StatsFormat::Json));
+        assert!(Cli::try_parse_from(["cruxe", "--stats", "yaml", "search", "x"]).is_err());
+    }
+
+    #[test]
+    fn daemon_metrics_address_is_optional() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "daemon", "--metrics-addr", "127.0.0.1:9464"]).unwrap();
+        match parsed.command {
+            Commands::Daemon { metrics_addr, .. } => {
+                assert_eq!(metrics_addr.as_deref(), Some("127.0.0.1:9464"));
+            }
+            _ => panic!("expected daemon"),
+        }
+    }
+
+    #[test]
+    fn log_flags_are_global() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "index",
+            "--log-level",
+            "warn",
+            "--log-format",
+            "json",
+        ])
+        .unwrap();
+        assert_eq!(parsed.log_level, Some(logging::LogLevel::Warn));
+        assert_eq!(parsed.log_format, logging::LogFormat::Json);
+        let parsed = Cli::try_parse_from(["cruxe", "search", "x"]).unwrap();
+        assert_eq!(parsed.log_format, logging::LogFormat::Text);
+        assert!(Cli::try_parse_from(["cruxe", "--log-level", "loud", "search", "x"]).is_err());
+    }
+
+    #[test]
+    fn output_style_flags_are_global() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "refs",
+            "Validate",
+            "--no-color",
+            "--theme",
+            "light",
+        ])
+        .unwrap();
+        assert!(parsed.no_color);
+        assert!(!parsed.plain);
+        assert_eq!(parsed.theme, style::ThemeName::Light);
+        let parsed = Cli::try_parse_from(["cruxe", "--plain", "search", "x"]).unwrap();
+        assert!(parsed.plain);
+        assert_eq!(parsed.theme, style::ThemeName::Dark);
+        assert!(Cli::try_parse_from(["cruxe", "search", "x", "--theme", "neon"]).is_err());
+    }
+
+    #[test]
+    fn timeout_is_global() {
+        let parsed = Cli::try_parse_from(["cruxe", "index", "--timeout", "600"]).unwrap();
+        assert_eq!(parsed.timeout_secs, Some(600));
+        assert!(parsed.command.stops_cooperatively());
+        let parsed = Cli::try_parse_from(["cruxe", "--timeout", "5", "search", "x"]).unwrap();
+        assert_eq!(parsed.timeout_secs, Some(5));
+        assert!(!parsed.command.stops_cooperatively());
+        assert!(Cli::try_parse_from(["cruxe", "sync", "--timeout", "soon"]).is_err());
+    }
+
+    #[test]
+    fn index_progress_defaults_to_auto() {
+        let parsed = Cli::try_parse_from(["cruxe", "index", "--progress", "json"]).unwrap();
+        match parsed.command {
+            Commands::Index { progress, .. } => {
+                assert_eq!(progress, progress::ProgressMode::Json);
+            }
+            _ => panic!("expected index"),
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "sync"]).unwrap();
+        match parsed.command {
+            Commands::Sync { progress, .. } => {
+                assert_eq!(progress, progress::ProgressMode::Auto);
+            }
+            _ => panic!("expected sync"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "index", "--progress", "fancy"]).is_err());
+    }
+
+    #[test]
+    fn daemon_ref_flag_is_repeatable() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "daemon",
+            "--ref",
+            "main",
+            "--ref",
+            "release/1.2",
+            "--worktrees",
+        ])
+        .unwrap();
+        match parsed.command {
+            Commands::Daemon {
+                refs, worktrees, ..
+            } => {
+                assert_eq!(refs, vec!["main", "release/1.2"]);
+                assert!(worktrees);
+            }
+            _ => panic!("expected daemon"),
+        }
+    }
+
+    #[test]
+    fn otlp_endpoint_is_a_global_flag() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "index", "--otlp-endpoint", "http://localhost:4318"])
+                .unwrap();
+        assert_eq!(
+            parsed.otlp_endpoint.as_deref(),
+            Some("http://localhost:4318")
+        );
+        assert!(
+            Cli::try_parse_from(["cruxe", "search", "x"])
+                .unwrap()
+                .otlp_endpoint
+                .is_none()
+        );
+    }
+
+    #[test]
+    fn graph_serve_parses_with_defaults() {
+        let parsed = Cli::try_parse_from(["cruxe", "graph", "serve", "--no-watch"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("graph"));
+        match parsed.command {
+            Commands::Graph {
+                command:
+                    GraphCommands::Serve {
+                        bind,
+                        port,
+                        no_watch,
+                        ..
+                    },
+            } => {
+                assert_eq!(bind, "127.0.0.1");
+                assert_eq!(port, 9200);
+                assert!(no_watch);
+            }
+            _ => panic!("expected graph serve command"),
+        }
+    }
+
+    #[test]
+    fn init_templates_are_valid_configs() {
+        let parsed = Cli::try_parse_from(["cruxe", "init", "--template", "llm-context"]).unwrap();
+        assert!(matches!(
+            parsed.command,
+            Commands::Init { template: Some(ref name), force: false, .. } if name == "llm-context"
+        ));
+        assert!(Cli::try_parse_from(["cruxe", "init", "--template", "nope"]).is_err());
+        assert!(Cli::try_parse_from(["cruxe", "init", "--force"]).is_err());
+
+        let dir = tempfile::tempdir().unwrap();
+        for (name, contents) in commands::init::TEMPLATES {
+            let path = dir.path().join(format!("{name}.toml"));
+            std::fs::write(&path, contents).unwrap();
+            let config = cruxe_core::config::Config::load_with_file(None, Some(&path))
+                .unwrap_or_else(|e| panic!("template {name}: {e}"));
+            match *name {
+                "security-audit" => {
+                    assert_eq!(config.check.profile.as_deref(), Some("strict"));
+                    assert!(config.audit.enabled);
+                }
+                "architecture" => assert!(config.check.ratchet),
+                "llm-context" => assert_eq!(config.search.semantic.mode, "hybrid"),
+                _ => panic!("untested template {name}"),
+            }
+        }
+    }
+
+    #[test]
+    fn search_takes_kind_and_package_filters() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "search",
+            "hGU",
+            "--kind",
+            "func,method",
+            "--package",
+            "internal/api",
+        ])
+        .unwrap();
+        match parsed.command {
+            Commands::Search {
+                query,
+                kind,
+                package,
+                ..
+            } => {
+                assert_eq!(query.as_deref(), Some("hGU"));
+                let kinds = cruxe_query::fuzzy::parse_kinds(kind.as_deref().unwrap()).unwrap();
+                assert_eq!(kinds.len(), 2);
+                assert_eq!(package.as_deref(), Some("internal/api"));
+            }
+            _ => panic!("expected search command"),
+        }
+    }
+
+    #[test]
+    fn search_sig_replaces_the_query() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "search",
+            "--sig",
+            "func(*handlers.Request) *handlers.Response",
+            "--kind",
+            "method",
+        ])
+        .unwrap();
+        match parsed.command {
+            Commands::Search { query, sig, .. } => {
+                assert_eq!(query, None);
+                assert_eq!(
+                    sig.as_deref(),
+                    Some("func(*handlers.Request) *handlers.Response")
+                );
+            }
+            _ => panic!("expected search command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "search"]).is_err());
+        assert!(Cli::try_parse_from(["cruxe", "search", "--sig", "func()", "--docs"]).is_err());
+    }
+
+    #[test]
+    fn search_docs_flag_parses() {
+        for flag in ["--docs", "--in-docs"] {
+            let parsed =
+                Cli::try_parse_from(["cruxe", "search", "graceful shutdown", flag]).unwrap();
+            match parsed.command {
+                Commands::Search { in_docs, .. } => assert!(in_docs),
+                _ => panic!("expected search command"),
+            }
+        }
+    }
+
+    #[test]
+    fn refs_takes_a_symbol_and_kind_filter() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "refs", "auth.Validate", "--kind", "call,write"])
+                .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("refs"));
+        match parsed.command {
+            Commands::Refs {
+                symbol,
+                kind,
+                format,
+                ..
+            } => {
+                assert_eq!(symbol, "auth.Validate");
+                assert_eq!(kind.as_deref(), Some("call,write"));
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected refs command"),
+        }
+    }
+
+    #[test]
+    fn federated_flag_parses_on_search_refs_and_callers() {
+        for (args, name) in [
+            (["cruxe", "search", "Post"], "search.federated"),
+            (["cruxe", "refs", "ledger.Post"], "refs.federated"),
+            (["cruxe", "callers", "ledger.Post"], "callers.federated"),
+        ] {
+            let parsed = Cli::try_parse_from(args.iter().chain(&["--federated"])).unwrap();
+            assert_eq!(parsed.command.telemetry_name(), Some(name));
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "refs", "ledger.Post"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("refs"));
+    }
+
+    #[test]
+    fn def_takes_a_position() {
+        let parsed = Cli::try_parse_from(["cruxe", "def", "cmd/main.go:42:17"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("def"));
+        match parsed.command {
+            Commands::Def { position, .. } => {
+                let position = cruxe_query::goto_definition::Position::parse(&position).unwrap();
+                assert_eq!(position.path, "cmd/main.go");
+                assert_eq!((position.line, position.column), (42, 17));
+            }
+            _ => panic!("expected def command"),
+        }
+    }
+
+    #[test]
+    fn resolve_takes_a_symbol_id() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "resolve",
+            "go github.com/acme/api/user.Server.Handle",
+            "--format",
+            "json",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("resolve"));
+        match parsed.command {
+            Commands::Resolve { id, format, .. } => {
+                assert_eq!(id, "go github.com/acme/api/user.Server.Handle");
+                assert_eq!(format, "json");
+            }
+            _ => panic!("expected resolve command"),
+        }
+    }
+
+    #[test]
+    fn rename_takes_symbol_new_name_and_dry_run() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "rename", "Account", "User", "--dry-run"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("rename"));
+        match parsed.command {
+            Commands::Rename {
+                symbol,
+                new_name,
+                dry_run,
+                ..
+            } => {
+                assert_eq!(symbol, "Account");
+                assert_eq!(new_name, "User");
+                assert!(dry_run);
+            }
+            _ => panic!("expected rename command"),
+        }
+    }
+
+    #[test]
+    fn callers_and_callees_take_depth_and_format() {
+        let parsed = Cli::try_parse_from([
+            "cruxe", "callers", "validate", "--depth", "4", "--format", "dot",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("callers"));
+        match parsed.command {
+            Commands::Callers {
+                symbol,
+                depth,
+                format,
+                limit,
+                ..
+            } => {
+                assert_eq!(symbol, "validate");
+                assert_eq!(depth, 4);
+                assert_eq!(format, "dot");
+                assert_eq!(limit, 200);
+            }
+            _ => panic!("expected callers command"),
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "callees", "main"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("callees"));
+        assert!(Cli::try_parse_from(["cruxe", "callees", "main", "--format", "svg"]).is_err());
+    }
+
+    #[test]
+    fn impact_takes_repeatable_changed_values() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "impact",
+            "--changed",
+            "main..HEAD",
+            "--changed",
+            "src/lib.rs",
+            "--format",
+            "tests",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("impact"));
+        match parsed.command {
+            Commands::Impact {
+                changed,
+                depth,
+                format,
+                ..
+            } => {
+                assert_eq!(changed, vec!["main..HEAD", "src/lib.rs"]);
+                assert_eq!(depth, 3);
+                assert_eq!(format, "tests");
+            }
+            _ => panic!("expected impact command"),
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "impact"]).unwrap();
+        match parsed.command {
+            Commands::Impact { changed, .. } => assert!(changed.is_empty()),
+            _ => panic!("expected impact command"),
+        }
+    }
+
+    #[test]
+    fn outline_takes_a_file_and_top_flag() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "outline",
+            "src/lib.rs",
+            "--top",
+            "--format",
+            "json",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("outline"));
+        match parsed.command {
+            Commands::Outline {
+                file, top, format, ..
+            } => {
+                assert_eq!(file, "src/lib.rs");
+                assert!(top);
+                assert_eq!(format, "json");
+            }
+            _ => panic!("expected outline command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "outline"]).is_err());
+        let parsed =
+            Cli::try_parse_from(["cruxe", "outline", "internal/auth", "--format", "skeleton"])
+                .unwrap();
+        assert!(matches!(
+            parsed.command,
+            Commands::Outline { format, .. } if format == "skeleton"
+        ));
+    }
+
+    #[test]
+    fn deps_takes_external_mode_and_format() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "deps",
+            "--external",
+            "collapse",
+            "--group-depth",
+            "2",
+            "--format",
+            "mermaid",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("deps"));
+        match parsed.command {
+            Commands::Deps {
+                external,
+                group_depth,
+                cycles,
+                format,
+                ..
+            } => {
+                assert_eq!(external, "collapse");
+                assert_eq!(group_depth, 2);
+                assert!(!cycles);
+                assert_eq!(format, "mermaid");
+            }
+            _ => panic!("expected deps command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "deps", "--external", "drop"]).is_err());
+        assert!(Cli::try_parse_from(["cruxe", "deps", "--check", "--cycles"]).is_err());
+    }
+
+    #[test]
+    fn deadcode_takes_repeatable_allow_globs() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "deadcode",
+            "--allow",
+            "*Handler",
+            "--allow",
+            "gen/**",
+            "--include-exported",
+            "--unused-exports",
+            "--include-generated",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("deadcode"));
+        match parsed.command {
+            Commands::Deadcode {
+                allow,
+                include_exported,
+                unused_exports,
+                include_generated,
+                format,
+                ..
+            } => {
+                assert_eq!(allow, vec!["*Handler", "gen/**"]);
+                assert!(include_exported);
+                assert!(unused_exports);
+                assert!(include_generated);
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected deadcode command"),
+        }
+    }
+
+    #[test]
+    fn diff_takes_two_refs() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "diff", "main", "feat/auth", "--exported-only"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("diff"));
+        match parsed.command {
+            Commands::Diff {
+                base,
+                head,
+                exported_only,
+                include_bodies,
+                ..
+            } => {
+                assert_eq!(base, "main");
+                assert_eq!(head, "feat/auth");
+                assert!(exported_only);
+                assert!(!include_bodies);
+            }
+            _ => panic!("expected diff command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "diff", "main"]).is_err());
+    }
+
+    #[test]
+    fn impls_takes_an_interface_and_lookup_path() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "impls",
+            "Store",
+            "--path",
+            "store/store.go",
+            "--format",
+            "json",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("impls"));
+        match parsed.command {
+            Commands::Impls {
+                interface,
+                path,
+                format,
+                ..
+            } => {
+                assert_eq!(interface, "Store");
+                assert_eq!(path.as_deref(), Some("store/store.go"));
+                assert_eq!(format, "json");
+            }
+            _ => panic!("expected impls command"),
+        }
+    }
+
+    #[test]
+    fn tests_for_takes_repeatable_coverage_profiles() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "tests-for",
+            "handlers.HandleRequest",
+            "--coverage",
+            "cover/TestA.out",
+            "--coverage",
+            "cover/TestB.out",
+            "--format",
+            "run",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("tests_for"));
+        match parsed.command {
+            Commands::TestsFor {
+                symbol,
+                depth,
+                coverage,
+                format,
+                ..
+            } => {
+                assert_eq!(symbol, "handlers.HandleRequest");
+                assert_eq!(depth, 5);
+                assert_eq!(coverage, vec!["cover/TestA.out", "cover/TestB.out"]);
+                assert_eq!(format, "run");
+            }
+            _ => panic!("expected tests-for command"),
+        }
+    }
+
+    #[test]
+    fn duplicates_takes_thresholds() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "duplicates",
+            "--min-similarity",
+            "0.7",
+            "--path",
+            "internal/handlers",
+            "--fail-on",
+            "duplicates>0",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("duplicates"));
+        match parsed.command {
+            Commands::Duplicates {
+                min_lines,
+                min_similarity,
+                path,
+                fail_on,
+                ..
+            } => {
+                assert_eq!(min_lines, 6);
+                assert_eq!(min_similarity, 0.7);
+                assert_eq!(path.as_deref(), Some("internal/handlers"));
+                assert_eq!(fail_on.as_deref(), Some("duplicates>0"));
+            }
+            _ => panic!("expected duplicates command"),
+        }
+    }
+
+    #[test]
+    fn hotspots_takes_window_and_limit() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "hotspots",
+            "--since",
+            "3 months ago",
+            "--path",
+            "internal/billing",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("hotspots"));
+        match parsed.command {
+            Commands::Hotspots {
+                since, limit, path, ..
+            } => {
+                assert_eq!(since.as_deref(), Some("3 months ago"));
+                assert_eq!(limit, 20);
+                assert_eq!(path.as_deref(), Some("internal/billing"));
+            }
+            _ => panic!("expected hotspots command"),
+        }
+    }
+
+    #[test]
+    fn lint_arch_takes_a_rules_file() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "lint-arch", "--rules", "ci/architecture.toml"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("lint_arch"));
+        match parsed.command {
+            Commands::LintArch { rules, format, .. } => {
+                assert_eq!(rules.as_deref(), Some("ci/architecture.toml"));
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected lint-arch command"),
+        }
+    }
+
+    #[test]
+    fn doc_coverage_takes_a_path_and_thresholds() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "doc-coverage",
+            "--path",
+            "pkg/client",
+            "--fail-on",
+            "doc_coverage<80",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("doc_coverage"));
+        match parsed.command {
+            Commands::DocCoverage { path, fail_on, .. } => {
+                assert_eq!(path.as_deref(), Some("pkg/client"));
+                assert_eq!(fail_on.as_deref(), Some("doc_coverage<80"));
+            }
+            _ => panic!("expected doc-coverage command"),
+        }
+    }
+
+    #[test]
+    fn todos_takes_marker_list_and_filters() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "todos",
+            "--marker",
+            "fixme,hack",
+            "--package",
+            "pkg/store",
+            "--owner",
+            "ada",
+            "--min-age",
+            "90",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("todos"));
+        match parsed.command {
+            Commands::Todos {
+                marker,
+                package,
+                owner,
+                min_age,
+                ..
+            } => {
+                assert_eq!(marker, ["fixme", "hack"]);
+                assert_eq!(package.as_deref(), Some("pkg/store"));
+                assert_eq!(owner.as_deref(), Some("ada"));
+                assert_eq!(min_age, Some(90));
+            }
+            _ => panic!("expected todos command"),
+        }
+    }
+
+    #[test]
+    fn errors_takes_a_symbol_and_depth() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "errors", "Store.Load", "--depth", "2"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("errors"));
+        match parsed.command {
+            Commands::Errors { symbol, depth, .. } => {
+                assert_eq!(symbol, "Store.Load");
+                assert_eq!(depth, 2);
+            }
+            _ => panic!("expected errors command"),
+        }
+    }
+
+    #[test]
+    fn exits_takes_repeated_from_globs() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "exits",
+            "--from",
+            "api/**",
+            "--from",
+            "internal/handlers/**",
+            "--fail-on",
+            "exit_paths>0",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("exits"));
+        match parsed.command {
+            Commands::Exits { from, fail_on, .. } => {
+                assert_eq!(from, ["api/**", "internal/handlers/**"]);
+                assert_eq!(fail_on.as_deref(), Some("exit_paths>0"));
+            }
+            _ => panic!("expected exits command"),
+        }
+    }
+
+    #[test]
+    fn concurrency_takes_kind_list_and_package() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "concurrency",
+            "--kind",
+            "goroutine,mutex",
+            "--package",
+            "internal/worker",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("concurrency"));
+        match parsed.command {
+            Commands::Concurrency { kind, package, .. } => {
+                assert_eq!(kind, ["goroutine", "mutex"]);
+                assert_eq!(package.as_deref(), Some("internal/worker"));
+            }
+            _ => panic!("expected concurrency command"),
+        }
+    }
+
+    #[test]
+    fn routes_takes_methods_prefix_and_depth() {
+        let parsed = Cli::try_parse_from([
+            "cruxe", "routes", "--method", "post,put", "--prefix", "/api", "--depth", "0",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("routes"));
+        match parsed.command {
+            Commands::Routes {
+                method,
+                prefix,
+                depth,
+                ..
+            } => {
+                assert_eq!(method, ["post", "put"]);
+                assert_eq!(prefix.as_deref(), Some("/api"));
+                assert_eq!(depth, 0);
+            }
+            _ => panic!("expected routes command"),
+        }
+    }
+
+    #[test]
+    fn where_used_takes_a_literal_and_kinds() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "where-used",
+            "--literal",
+            "/api/user",
+            "--kind",
+            "route,constant",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("where-used"));
+        match parsed.command {
+            Commands::WhereUsed {
+                literal,
+                prefix,
+                kind,
+                ..
+            } => {
+                assert_eq!(literal, "/api/user");
+                assert!(!prefix);
+                assert_eq!(kind, ["route", "constant"]);
+            }
+            _ => panic!("expected where-used command"),
+        }
+    }
+
+    #[test]
+    fn output_format_from_config_fills_an_unset_format() {
+        let temp = tempfile::tempdir().unwrap();
+        std::fs::write(temp.path().join(".cruxe.yaml"), "output:\n  format: json\n").unwrap();
+        let workspace = temp.path().to_string_lossy().to_string();
+        let matches = |args: &[&str]| Cli::command().try_get_matches_from(args).unwrap();
+
+        let unset = matches(&["cruxe", "routes", "--workspace", &workspace]);
+        assert_eq!(configured_format(&unset).as_deref(), Some("json"));
+        let explicit = matches(&[
+            "cruxe",
+            "routes",
+            "--workspace",
+            &workspace,
+            "--format",
+            "text",
+        ]);
+        assert_eq!(configured_format(&explicit), None);
+    }
+
+    #[test]
+    fn api_lists_or_diffs() {
+        let parsed = Cli::try_parse_from(["cruxe", "api", "--path", "pkg/client"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("api"));
+        match parsed.command {
+            Commands::Api { command, path, .. } => {
+                assert!(command.is_none());
+                assert_eq!(path.as_deref(), Some("pkg/client"));
+            }
+            _ => panic!("expected api command"),
+        }
+
+        let parsed =
+            Cli::try_parse_from(["cruxe", "api", "diff", "v1", "v2", "--fail-on-breaking"])
+                .unwrap();
+        match parsed.command {
+            Commands::Api {
+                command:
+                    Some(ApiCommands::Diff {
+                        base,
+                        head,
+                        fail_on_breaking,
+                        ..
+                    }),
+                ..
+            } => {
+                assert_eq!((base.as_str(), head.as_str()), ("v1", "v2"));
+                assert!(fail_on_breaking);
+            }
+            _ => panic!("expected api diff command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "api", "--path", "x", "diff", "v1", "v2"]).is_err());
+    }
+
+    #[test]
+    fn ci_commands_accept_github_formats() {
+        for args in [
+            &["cruxe", "check", "--format", "github"][..],
+            &["cruxe", "diff", "main", "HEAD", "--format", "github-check"],
+            &["cruxe", "deadcode", "--format", "github"],
+            &["cruxe", "deps", "--cycles", "--format", "github-check"],
+        ] {
+            assert!(Cli::try_parse_from(args).is_ok(), "{args:?}");
+        }
+        assert!(Cli::try_parse_from(["cruxe", "stats", "--format", "github"]).is_err());
+    }
+
+    #[test]
+    fn describe_takes_a_symbol_and_history_depth() {
+        let parsed = Cli::try_parse_from(["cruxe", "describe", "auth.Validate"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("describe"));
+        match parsed.command {
+            Commands::Describe {
+                symbol,
+                path,
+                history,
+                format,
+                ..
+            } => {
+                assert_eq!(symbol, "auth.Validate");
+                assert!(path.is_none());
+                assert_eq!(history, 5);
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected describe command"),
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "describe", "Pool", "--history", "0"]).unwrap();
+        assert!(matches!(
+            parsed.command,
+            Commands::Describe { history: 0, .. }
+        ));
+    }
+
+    #[test]
+    fn context_takes_a_symbol_and_token_budget() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "context", "auth.Validate", "--budget", "2000"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("context"));
+        match parsed.command {
+            Commands::Context {
+                symbol,
+                budget,
+                format,
+                ..
+            } => {
+                assert_eq!(symbol, "auth.Validate");
+                assert_eq!(budget, 2000);
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected context command"),
+        }
+        let parsed = Cli::try_parse_from(["cruxe", "context", "Pool"]).unwrap();
+        assert!(matches!(
+            parsed.command,
+            Commands::Context { budget: 8000, .. }
+        ));
+    }
+
+    #[test]
+    fn ask_takes_a_question_and_limit() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "ask",
+            "where do we validate JWT expiry?",
+            "--limit",
+            "5",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("ask"));
+        match parsed.command {
+            Commands::Ask {
+                question, limit, ..
+            } => {
+                assert_eq!(question, "where do we validate JWT expiry?");
+                assert_eq!(limit, 5);
+            }
+            _ => panic!("expected ask command"),
+        }
+    }
+
+    #[test]
+    fn embed_is_incremental_unless_forced() {
+        let parsed = Cli::try_parse_from(["cruxe", "embed"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("embed"));
+        assert!(matches!(
+            parsed.command,
+            Commands::Embed { force: false, .. }
+        ));
+        let parsed = Cli::try_parse_from(["cruxe", "embed", "--force"]).unwrap();
+        assert!(matches!(
+            parsed.command,
+            Commands::Embed { force: true, .. }
+        ));
+    }
+
+    #[test]
+    fn chunk_takes_paths_and_optional_limits() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "chunk", "src/", "README.md", "--max-lines", "60"])
+                .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("chunk"));
+        match parsed.command {
+            Commands::Chunk {
+                paths,
+                max_lines,
+                overlap_lines,
+                max_tokens,
+                ..
+            } => {
+                assert_eq!(paths, vec!["src/", "README.md"]);
+                assert_eq!(max_lines, Some(60));
+                assert!(overlap_lines.is_none());
+                assert!(max_tokens.is_none());
+            }
+            _ => panic!("expected chunk command"),
+        }
+    }
+
+    #[test]
+    fn summarize_takes_a_package() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "summarize", "internal/auth", "--refresh"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("summarize"));
+        match parsed.command {
+            Commands::Summarize {
+                package,
+                refresh,
+                heuristic,
+                ..
+            } => {
+                assert_eq!(package, "internal/auth");
+                assert!(refresh);
+                assert!(!heuristic);
+            }
+            _ => panic!("expected summarize command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "summarize"]).is_err());
+    }
+
+    #[test]
+    fn map_takes_an_optional_budget() {
+        let parsed = Cli::try_parse_from(["cruxe", "map", "--budget", "4000"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("map"));
+        match parsed.command {
+            Commands::Map { budget, format, .. } => {
+                assert_eq!(budget, Some(4000));
+                assert_eq!(format, "text");
+            }
+            _ => panic!("expected map command"),
+        }
+        match Cli::try_parse_from(["cruxe", "map"]).unwrap().command {
+            Commands::Map { budget, .. } => assert!(budget.is_none()),
+            _ => panic!("expected map command"),
+        }
+    }
+
+    #[test]
+    fn relevant_requires_a_task() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "relevant",
+            "--task",
+            "add rate limiting to the user creation endpoint",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("relevant"));
+        match parsed.command {
+            Commands::Relevant { task, limit, .. } => {
+                assert_eq!(task, "add rate limiting to the user creation endpoint");
+                assert_eq!(limit, 15);
+            }
+            _ => panic!("expected relevant command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "relevant"]).is_err());
+    }
+
+    #[test]
+    fn snippet_surroundings_are_opt_in() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "snippet",
+            "auth.Validate",
+            "--with-types",
+            "--with-callers",
+            "3",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("snippet"));
+        match parsed.command {
+            Commands::Snippet {
+                symbol,
+                with_doc,
+                with_imports,
+                with_types,
+                with_callers,
+                ..
+            } => {
+                assert_eq!(symbol, "auth.Validate");
+                assert!(!with_doc && !with_imports);
+                assert!(with_types);
+                assert_eq!(with_callers, 3);
+            }
+            _ => panic!("expected snippet command"),
+        }
+        assert!(matches!(
+            Cli::try_parse_from(["cruxe", "snippet", "Validate"])
+                .unwrap()
+                .command,
+            Commands::Snippet {
+                with_callers: 0,
+                ..
+            }
+        ));
+    }
+
+    #[test]
+    fn changed_takes_a_range_and_lists_packages() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "changed", "main..HEAD", "--format", "packages"])
+                .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("changed"));
+        match parsed.command {
+            Commands::Changed {
+                range,
+                format,
+                r#ref,
+                ..
+            } => {
+                assert_eq!(range, "main..HEAD");
+                assert_eq!(format, "packages");
+                assert!(r#ref.is_none());
+            }
+            _ => panic!("expected changed command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "changed"]).is_err());
+    }
+
+    #[test]
+    fn batch_takes_a_default_ref() {
+        let parsed = Cli::try_parse_from(["cruxe", "batch", "--ref", "main"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("batch"));
+        match parsed.command {
+            Commands::Batch { r#ref, workspace } => {
+                assert_eq!(r#ref.as_deref(), Some("main"));
+                assert!(workspace.is_none());
+            }
+            _ => panic!("expected batch command"),
+        }
+    }
+
+    #[test]
+    fn upload_defaults_to_three_attempts_at_the_root() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "upload",
+            "--endpoint",
+            "https://sourcegraph.example.com",
+            "--file",
+            "index.scip",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("upload"));
+        match parsed.command {
+            Commands::Upload {
+                endpoint,
+                file,
+                root,
+                retries,
+                ..
+            } => {
+                assert_eq!(endpoint, "https://sourcegraph.example.com");
+                assert_eq!(file.as_deref(), Some("index.scip"));
+                assert_eq!(root, "");
+                assert_eq!(retries, 3);
+            }
+            _ => panic!("expected upload command"),
+        }
+        assert!(
+            Cli::try_parse_from(["cruxe", "upload", "--endpoint", "gs://b", "--retries", "0"])
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn hook_pre_commit_parses() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "hook", "pre-commit", "--format", "json"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("hook"));
+        match parsed.command {
+            Commands::Hook {
+                command: HookCommands::PreCommit { format, r#ref, .. },
+            } => {
+                assert_eq!(format, "json");
+                assert!(r#ref.is_none());
+            }
+            _ => panic!("expected hook pre-commit command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "hook", "post-commit"]).is_err());
+    }
 
-    let config_file = cli.config.as_deref().map(std::path::Path::new);
+    #[test]
+    fn editor_takes_a_workspace_and_ref() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "editor", "--workspace", "/repo", "--ref", "main"])
+                .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("editor"));
+        match parsed.command {
+            Commands::Editor { r#ref, workspace } => {
+                assert_eq!(r#ref.as_deref(), Some("main"));
+                assert_eq!(workspace.as_deref(), Some("/repo"));
+            }
+            _ => panic!("expected editor command"),
+        }
+    }
 
-    match cli.command {
-        Commands::Init { path } => {
-            let path = resolve_path(path)?;
-            commands::init::run(&path, config_file)?;
+    #[test]
+    fn baseline_flag_defaults_to_the_baseline_file() {
+        let parsed = Cli::try_parse_from(["cruxe", "check", "--baseline"]).unwrap();
+        match parsed.command {
+            Commands::Check { baseline, .. } => {
+                assert_eq!(baseline.as_deref(), Some(".cruxe/baseline.json"));
+            }
+            _ => panic!("expected check command"),
         }
-        Commands::Doctor { path } => {
-            let path = resolve_path(path)?;
-            commands::doctor::run(&path, config_file)?;
+        let parsed =
+            Cli::try_parse_from(["cruxe", "deadcode", "--baseline", "legacy.json"]).unwrap();
+        match parsed.command {
+            Commands::Deadcode { baseline, .. } => {
+                assert_eq!(baseline.as_deref(), Some("legacy.json"));
+            }
+            _ => panic!("expected deadcode command"),
         }
-        Commands::Index { path, force, r#ref } => {
-            let path = resolve_path(path)?;
-            commands::index::run(&path, force, r#ref.as_deref(), config_file)?;
+        let parsed = Cli::try_parse_from(["cruxe", "deps"]).unwrap();
+        match parsed.command {
+            Commands::Deps { baseline, .. } => assert_eq!(baseline, None),
+            _ => panic!("expected deps command"),
         }
-        Commands::Search {
-            query,
-            r#ref,
-            lang,
-            limit,
-        } => {
-            let path = std::env::current_dir()?;
-            commands::search::run(
-                &path,
-                &query,
-                r#ref.as_deref(),
-                lang.as_deref(),
-                limit,
-                config_file,
-            )?;
+
+        let parsed = Cli::try_parse_from(["cruxe", "baseline", "write", "--ref", "main"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("baseline"));
+        match parsed.command {
+            Commands::Baseline {
+                command: BaselineCommands::Write { output, r#ref, .. },
+            } => {
+                assert_eq!(output, None);
+                assert_eq!(r#ref.as_deref(), Some("main"));
+            }
+            _ => panic!("expected baseline write command"),
         }
-        Commands::Sync { workspace, force } => {
-            let path = resolve_path(workspace)?;
-            commands::index::run(&path, force, None, config_file)?;
+    }
+
+    #[test]
+    fn lsp_takes_a_workspace_and_ref() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "lsp", "--workspace", "/repo", "--ref", "main"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("lsp"));
+        match parsed.command {
+            Commands::Lsp { r#ref, workspace } => {
+                assert_eq!(r#ref.as_deref(), Some("main"));
+                assert_eq!(workspace.as_deref(), Some("/repo"));
+            }
+            _ => panic!("expected lsp command"),
         }
-        Commands::Eval { command } => match command {
-            EvalCommands::Retrieval {
-                workspace,
-                suite,
-                baseline,
-                policy,
-                r#ref,
+    }
+
+    #[test]
+    fn schema_takes_a_multi_word_command() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "schema", "query", "symbols", "--ndjson"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("schema"));
+        match parsed.command {
+            Commands::Schema { command, ndjson } => {
+                assert_eq!(command, vec!["query".to_string(), "symbols".to_string()]);
+                assert!(ndjson);
+            }
+            _ => panic!("expected schema command"),
+        }
+    }
+
+    #[test]
+    fn search_accepts_ndjson_format() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "search", "pool", "--format", "ndjson"]).unwrap();
+        match parsed.command {
+            Commands::Search { format, .. } => assert_eq!(format, "ndjson"),
+            _ => panic!("expected search command"),
+        }
+    }
+
+    #[test]
+    fn grep_takes_a_pattern_and_filters() {
+        let parsed = Cli::try_parse_from([
+            "cruxe", "grep", "-i", "retry", "--path", "src/**", "--lang", "rust",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("grep"));
+        match parsed.command {
+            Commands::Grep {
+                pattern,
+                structural,
+                ignore_case,
+                path,
+                lang,
                 limit,
-                output,
-                dry_run,
-                update_baseline,
-                beir_corpus,
-                beir_queries,
-                beir_qrels,
-                trec_run_out,
-                trec_qrels_out,
+                ..
             } => {
-                let workspace = resolve_path(workspace)?;
-                let suite_path = suite.as_deref().map(std::path::Path::new);
-                let output_path = output.as_deref().map(std::path::Path::new);
-                let beir_corpus_path = beir_corpus.as_deref().map(std::path::Path::new);
-                let beir_queries_path = beir_queries.as_deref().map(std::path::Path::new);
-                let beir_qrels_path = beir_qrels.as_deref().map(std::path::Path::new);
-                let trec_run_out = trec_run_out.as_deref().map(std::path::Path::new);
-                let trec_qrels_out = trec_qrels_out.as_deref().map(std::path::Path::new);
-                commands::eval::run_retrieval(
-                    &workspace,
-                    suite_path,
-                    std::path::Path::new(&baseline),
-                    std::path::Path::new(&policy),
-                    &r#ref,
-                    limit,
-                    output_path,
-                    dry_run,
-                    update_baseline,
-                    beir_corpus_path,
-                    beir_queries_path,
-                    beir_qrels_path,
-                    trec_run_out,
-                    trec_qrels_out,
-                    config_file,
-                )?;
+                assert_eq!(pattern, "retry");
+                assert!(!structural);
+                assert!(ignore_case);
+                assert_eq!(path, vec!["src/**".to_string()]);
+                assert_eq!(lang.as_deref(), Some("rust"));
+                assert_eq!(limit, 200);
             }
-        },
-        Commands::State { command } => match command {
-            StateCommands::Export { path, workspace } => {
-                let workspace = resolve_path(workspace)?;
-                commands::state_export::run(&workspace, std::path::Path::new(&path), config_file)?;
+            _ => panic!("expected grep command"),
+        }
+    }
+
+    #[test]
+    fn analysis_commands_take_fail_on() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "deps", "--fail-on", "cycles>0,complexity.max>25"])
+                .unwrap();
+        match parsed.command {
+            Commands::Deps { fail_on, .. } => {
+                assert_eq!(fail_on.as_deref(), Some("cycles>0,complexity.max>25"));
             }
-            StateCommands::Import { path, workspace } => {
-                let workspace = resolve_path(workspace)?;
-                commands::state_import::run(&workspace, std::path::Path::new(&path), config_file)?;
+            _ => panic!("expected deps command"),
+        }
+        for command in ["deadcode", "stats", "check"] {
+            let parsed =
+                Cli::try_parse_from(["cruxe", command, "--fail-on", "deadcode>50"]).unwrap();
+            assert_eq!(parsed.command.telemetry_name(), Some(command));
+        }
+    }
+
+    #[test]
+    fn stats_takes_top_and_format() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "stats", "--top", "5", "--format", "json"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("stats"));
+        match parsed.command {
+            Commands::Stats { top, format, .. } => {
+                assert_eq!(top, 5);
+                assert_eq!(format, "json");
             }
-        },
-        Commands::PruneOverlays {
-            workspace,
-            older_than_days,
-        } => {
-            let workspace = resolve_path(workspace)?;
-            commands::prune_overlays::run(&workspace, older_than_days, config_file)?;
+            _ => panic!("expected stats command"),
         }
-        Commands::ServeMcp {
-            workspace,
-            no_prewarm,
-            transport,
-            port,
-            bind,
-            auto_workspace,
-            allowed_roots,
-            max_auto_workspaces,
-        } => {
-            let path = resolve_path(workspace)?;
-            validate_serve_mcp_args(auto_workspace, &allowed_roots)?;
-            // HIGH-4: Canonicalize --allowed-root paths at startup; reject nonexistent
-            let mut canonical_roots = Vec::new();
-            for root in &allowed_roots {
-                let root_path = std::path::Path::new(root);
-                match root_path.canonicalize() {
-                    Ok(canonical) => canonical_roots.push(canonical),
-                    Err(e) => {
-                        anyhow::bail!("--allowed-root '{}' is not a valid path: {}", root, e);
-                    }
-                }
+    }
+
+    #[test]
+    fn query_symbols_takes_an_expression() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "query",
+            "symbols",
+            "kind:func AND fanin > 5 AND NOT test",
+            "--limit",
+            "5",
+            "--by-owner",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("query"));
+        match parsed.command {
+            Commands::Query {
+                command:
+                    QueryCommands::Symbols {
+                        expr,
+                        limit,
+                        by_owner,
+                        ..
+                    },
+            } => {
+                assert_eq!(expr, "kind:func AND fanin > 5 AND NOT test");
+                assert_eq!(limit, 5);
+                assert!(by_owner);
             }
-            let ws_config = cruxe_core::types::WorkspaceConfig {
-                auto_workspace,
-                allowed_roots: cruxe_core::types::AllowedRoots::new(canonical_roots),
-                max_auto_workspaces,
-            };
-            match transport {
-                McpTransport::Http => {
-                    commands::serve_mcp::run_http(
-                        &path,
-                        config_file,
-                        no_prewarm,
-                        ws_config,
-                        &bind,
-                        port,
-                    )?;
-                }
-                McpTransport::Stdio => {
-                    commands::serve_mcp::run(&path, config_file, no_prewarm, ws_config)?;
-                }
+            _ => panic!("expected query symbols command"),
+        }
+    }
+
+    #[test]
+    fn tui_takes_an_optional_ref() {
+        let parsed = Cli::try_parse_from(["cruxe", "tui", "--ref", "main"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("tui"));
+        match parsed.command {
+            Commands::Tui { r#ref, .. } => assert_eq!(r#ref.as_deref(), Some("main")),
+            _ => panic!("expected tui command"),
+        }
+    }
+
+    #[test]
+    fn watch_takes_an_exec_line() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "watch", "--exec", "impact --format tests"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("watch"));
+        match parsed.command {
+            Commands::Watch {
+                exec, interval_ms, ..
+            } => {
+                assert_eq!(exec, "impact --format tests");
+                assert_eq!(interval_ms, 500);
             }
+            _ => panic!("expected watch command"),
         }
     }
 
-    Ok(())
-}
+    #[test]
+    fn serve_takes_an_http_listen_address() {
+        let parsed = Cli::try_parse_from(["cruxe", "serve", "--http", "0.0.0.0:8080"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("serve"));
+        match parsed.command {
+            Commands::Serve { http, .. } => assert_eq!(http, "0.0.0.0:8080"),
+            _ => panic!("expected serve command"),
+        }
+        let default = Cli::try_parse_from(["cruxe", "serve"]).unwrap();
+        assert!(matches!(default.command, Commands::Serve { http, .. } if http == ":7474"));
+    }
 
-fn validate_serve_mcp_args(auto_workspace: bool, allowed_roots: &[String]) -> anyhow::Result<()> {
-    if auto_workspace && allowed_roots.is_empty() {
-        anyhow::bail!("--auto-workspace requires at least one --allowed-root");
+    #[test]
+    fn completions_take_a_shell_and_symbol_prefix() {
+        let parsed = Cli::try_parse_from(["cruxe", "completions", "zsh"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), None);
+        match parsed.command {
+            Commands::Completions { shell } => assert_eq!(shell, "zsh"),
+            _ => panic!("expected completions command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "completions", "tcsh"]).is_err());
+
+        let parsed =
+            Cli::try_parse_from(["cruxe", "__complete-symbols", "--", "crate::ru"]).unwrap();
+        match parsed.command {
+            Commands::CompleteSymbols { prefix, limit, .. } => {
+                assert_eq!(prefix, "crate::ru");
+                assert_eq!(limit, 200);
+            }
+            _ => panic!("expected __complete-symbols command"),
+        }
     }
-    Ok(())
-}
 
-fn resolve_path(path: Option<String>) -> anyhow::Result<std::path::PathBuf> {
-    match path {
-        Some(p) => Ok(std::path::PathBuf::from(p)),
-        None => Ok(std::env::current_dir()?),
+    #[test]
+    fn preflight_takes_files_to_explain() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "preflight",
+            "--explain",
+            "gen/api.go",
+            "--explain",
+            "web/app.min.js",
+            "--no-ignore",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("preflight"));
+        match parsed.command {
+            Commands::Preflight {
+                path,
+                explain,
+                no_ignore,
+                ..
+            } => {
+                assert_eq!(path, None);
+                assert_eq!(explain, ["gen/api.go", "web/app.min.js"]);
+                assert!(no_ignore);
+            }
+            _ => panic!("expected preflight command"),
+        }
     }
-}
 
-#[cfg(test)]
-mod tests {
-    use super::*;
+    #[test]
+    fn bench_takes_an_optional_path_and_baseline() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "bench",
+            "../service",
+            "--baseline",
+            "bench.json",
+            "--max-regression",
+            "5",
+        ])
+        .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("bench"));
+        match parsed.command {
+            Commands::Bench {
+                path,
+                iterations,
+                baseline,
+                max_regression,
+                ..
+            } => {
+                assert_eq!(path.as_deref(), Some("../service"));
+                assert_eq!(iterations, 1);
+                assert_eq!(baseline.as_deref(), Some("bench.json"));
+                assert_eq!(max_regression, 5.0);
+            }
+            _ => panic!("expected bench command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "bench", "--iterations", "0"]).is_err());
+    }
 
     #[test]
-    fn serve_mcp_rejects_invalid_transport_value() {
-        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "httpp"]);
-        assert!(parsed.is_err(), "invalid transport should be rejected");
+    fn finding_show_takes_an_id() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "finding", "show", "3f9c2a", "--format", "json"])
+                .unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("finding"));
+        match parsed.command {
+            Commands::Finding {
+                command: FindingCommands::Show { id, format, .. },
+            } => {
+                assert_eq!(id, "3f9c2a");
+                assert_eq!(format, "json");
+            }
+            _ => panic!("expected finding show command"),
+        }
+        assert!(Cli::try_parse_from(["cruxe", "finding", "show"]).is_err());
     }
 
     #[test]
-    fn serve_mcp_accepts_http_transport_value() {
-        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "http"])
-            .expect("http transport should parse");
+    fn bodies_flag_takes_an_optional_bool() {
+        let bodies = |args: &[&str]| match Cli::try_parse_from(args).unwrap().command {
+            Commands::Index { bodies, .. } => bodies,
+            _ => panic!("expected index command"),
+        };
+        assert_eq!(bodies(&["cruxe", "index"]), None);
+        assert_eq!(bodies(&["cruxe", "index", "--bodies=false"]), Some(false));
+        assert_eq!(bodies(&["cruxe", "index", "--bodies"]), Some(true));
+    }
 
+    #[test]
+    fn include_and_exclude_are_global_and_repeatable() {
+        let parsed = Cli::try_parse_from([
+            "cruxe",
+            "deadcode",
+            "--include",
+            "services/payments/**",
+            "--include",
+            "pkg/billing/**",
+            "--exclude",
+            "**/*_mock.go",
+        ])
+        .unwrap();
+        assert_eq!(parsed.include, ["services/payments/**", "pkg/billing/**"]);
+        assert_eq!(parsed.exclude, ["**/*_mock.go"]);
+        let before = Cli::try_parse_from(["cruxe", "--include", "cmd/**", "index"]).unwrap();
+        assert_eq!(before.include, ["cmd/**"]);
+    }
+
+    #[test]
+    fn project_is_global_and_projects_lists_them() {
+        let parsed =
+            Cli::try_parse_from(["cruxe", "todos", "--project", "billing", "--project", "web"])
+                .unwrap();
+        assert_eq!(parsed.project, ["billing", "web"]);
+        let parsed = Cli::try_parse_from(["cruxe", "projects", "--format", "json"]).unwrap();
+        assert_eq!(parsed.command.telemetry_name(), Some("projects"));
         match parsed.command {
-            Commands::ServeMcp { transport, .. } => assert_eq!(transport, McpTransport::Http),
-            _ => panic!("expected serve-mcp command"),
+            Commands::Projects { format, .. } => assert_eq!(format, "json"),
+            _ => panic!("expected projects command"),
         }
     }
 
     #[test]
-    fn serve_mcp_rejects_empty_transport_value() {
-        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", ""]);
-        assert!(parsed.is_err(), "empty transport should be rejected");
+    fn build_is_global() {
+        let parsed = Cli::try_parse_from(["cruxe", "deadcode", "--build", "windows"]).unwrap();
+        assert_eq!(parsed.build.as_deref(), Some("windows"));
+        let parsed = Cli::try_parse_from(["cruxe", "--build", "linux", "index"]).unwrap();
+        assert_eq!(parsed.build.as_deref(), Some("linux"));
+        assert!(
+            Cli::try_parse_from(["cruxe", "index"])
+                .unwrap()
+                .build
+                .is_none()
+        );
     }
 
     #[test]
-    fn serve_mcp_rejects_uppercase_transport_value() {
-        let parsed = Cli::try_parse_from(["cruxe", "serve-mcp", "--transport", "HTTP"]);
-        assert!(parsed.is_err(), "uppercase transport should be rejected");
+    fn no_ignore_applies_to_index_and_sync() {
+        let no_ignore = |args: &[&str]| match Cli::try_parse_from(args).unwrap().command {
+            Commands::Index { no_ignore, .. } | Commands::Sync { no_ignore, .. } => no_ignore,
+            _ => panic!("expected index or sync command"),
+        };
+        assert!(!no_ignore(&["cruxe", "index"]));
+        assert!(no_ignore(&["cruxe", "index", "--no-ignore"]));
+        assert!(no_ignore(&["cruxe", "sync", "--no-ignore"]));
     }
 
     #[test]
-    fn serve_mcp_validate_requires_allowed_root_when_auto_workspace_enabled() {
-        let err = validate_serve_mcp_args(true, &[]).expect_err("validation should fail");
+    fn submodules_flag_applies_to_index_and_sync() {
+        let submodules = |args: &[&str]| match Cli::try_parse_from(args).unwrap().command {
+            Commands::Index { submodules, .. } | Commands::Sync { submodules, .. } => submodules,
+            _ => panic!("expected index or sync command"),
+        };
+        assert!(!submodules(&["cruxe", "index"]));
+        assert!(submodules(&["cruxe", "index", "--submodules"]));
+        assert!(submodules(&["cruxe", "sync", "--submodules"]));
+    }
+
+    #[test]
+    fn symlinks_flag_takes_a_policy() {
+        let symlinks = |args: &[&str]| match Cli::try_parse_from(args).unwrap().command {
+            Commands::Index { symlinks, .. } | Commands::Sync { symlinks, .. } => symlinks,
+            _ => panic!("expected index or sync command"),
+        };
+        assert_eq!(symlinks(&["cruxe", "index"]), None);
+        assert_eq!(
+            symlinks(&["cruxe", "sync", "--symlinks", "follow-within-root"]).as_deref(),
+            Some("follow-within-root")
+        );
+        assert!(Cli::try_parse_from(["cruxe", "index", "--symlinks", "sometimes"]).is_err());
+    }
+
+    #[test]
+    fn index_takes_a_repository_url_instead_of_a_path() {
+        let cli =
+            Cli::try_parse_from(["cruxe", "index", "https://github.com/org/repo@v1.2.0"]).unwrap();
+        match cli.command {
+            Commands::Index { url, path, .. } => {
+                assert_eq!(url.as_deref(), Some("https://github.com/org/repo@v1.2.0"));
+                assert!(path.is_none());
+            }
+            _ => panic!("expected index command"),
+        }
         assert!(
-            err.to_string()
-                .contains("--auto-workspace requires at least one --allowed-root"),
-            "unexpected validation message: {err}"
+            Cli::try_parse_from([
+                "cruxe",
+                "index",
+                "https://github.com/org/repo",
+                "--ref",
+                "x"
+            ])
+            .is_err()
         );
     }
 
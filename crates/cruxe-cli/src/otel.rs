@@ -0,0 +1,64 @@
+use anyhow::{Context, Result};
+use opentelemetry::trace::TracerProvider as _;
+use opentelemetry_otlp::{SpanExporter, WithExportConfig};
+use opentelemetry_sdk::Resource;
+use opentelemetry_sdk::trace::{SdkTracerProvider, Tracer};
+use tracing_opentelemetry::OpenTelemetryLayer;
+use tracing_subscriber::registry::LookupSpan;
+
+/// Path OTLP/HTTP collectors accept spans on.
+const TRACES_PATH: &str = "/v1/traces";
+
+/// Flushes buffered spans to the collector when dropped, so every exit path
+/// of `main` exports the run's spans.
+pub struct Exporter {
+    provider: SdkTracerProvider,
+}
+
+impl Drop for Exporter {
+    fn drop(&mut self) {
+        if let Err(err) = self.provider.shutdown() {
+            eprintln!("warning: failed to export traces: {err}");
+        }
+    }
+}
+
+/// A tracing layer exporting spans over OTLP/HTTP to `endpoint`, a collector
+/// base URL such as `http://localhost:4318`.
+pub fn layer<S>(endpoint: &str) -> Result<(OpenTelemetryLayer<S, Tracer>, Exporter)>
+where
+    S: tracing::Subscriber + for<'span> LookupSpan<'span>,
+{
+    let exporter = SpanExporter::builder()
+        .with_http()
+        .with_endpoint(traces_url(endpoint))
+        .build()
+        .with_context(|| format!("Failed to create OTLP exporter for {endpoint}"))?;
+    let provider = SdkTracerProvider::builder()
+        .with_batch_exporter(exporter)
+        .with_resource(
+            Resource::builder()
+                .with_service_name("cruxe")
+                .with_attribute(opentelemetry::KeyValue::new(
+                    "service.version",
+                    env!("CARGO_PKG_VERSION"),
+                ))
+                .build(),
+        )
+        .build();
+    let tracer = provider.tracer("cruxe");
+    Ok((
+        tracing_opentelemetry::layer().with_tracer(tracer),
+        Exporter { provider },
+    ))
+}
+
+/// `endpoint` with the traces path, unless it already names it.
+fn traces_url(endpoint: &str) -> String {
+    let endpoint = endpoint.trim_end_matches('/');
+    if endpoint.ends_with(TRACES_PATH) {
+        endpoint.to_string()
+    } else {
+        format!("{endpoint}{TRACES_PATH}")
+    }
+}
@@ -0,0 +1,296 @@
+//! `--progress`: live feedback on stderr during long runs, phase by phase,
+//! with an ETA for phases whose amount of work is known up front.
+
+use clap::ValueEnum;
+use serde::Serialize;
+use std::io::{IsTerminal, Write};
+use std::time::{Duration, Instant};
+
+/// Redraws of the terminal line are at least this far apart.
+const REDRAW_EVERY: Duration = Duration::from_millis(100);
+/// Plain lines come every 10% of a phase, and at least this often.
+const PLAIN_EVERY: Duration = Duration::from_secs(10);
+/// JSON progress events are at most this frequent.
+const JSON_EVERY: Duration = Duration::from_secs(1);
+
+#[derive(Debug, Clone, Copy, Default, ValueEnum, PartialEq, Eq)]
+pub enum ProgressMode {
+    /// A line redrawn in place on a terminal, plain lines otherwise
+    #[default]
+    Auto,
+    /// A line per 10% of each phase, for logs
+    Plain,
+    /// One JSON event per line, for CI log parsers
+    Json,
+    /// No progress output
+    None,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Style {
+    Redraw,
+    Plain,
+    Json,
+    Off,
+}
+
+/// Progress of one run, reported to stderr as `mode` asks.
+pub struct Progress {
+    style: Style,
+    phase: Option<Phase>,
+}
+
+struct Phase {
+    name: &'static str,
+    /// Files the phase will go through, when known.
+    total: Option<u64>,
+    done: u64,
+    started: Instant,
+    reported: Instant,
+    /// Tenths of the phase last reported by plain output.
+    reported_step: u64,
+}
+
+/// What `--progress json` writes, one object per line.
+#[derive(Debug, Serialize)]
+#[serde(tag = "event", rename_all = "snake_case")]
+enum ProgressEvent {
+    PhaseStarted {
+        phase: &'static str,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        total: Option<u64>,
+    },
+    Progress {
+        phase: &'static str,
+        done: u64,
+        total: u64,
+        elapsed_ms: u64,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        eta_ms: Option<u64>,
+    },
+    PhaseFinished {
+        phase: &'static str,
+        done: u64,
+        elapsed_ms: u64,
+    },
+}
+
+impl Progress {
+    pub fn new(mode: ProgressMode) -> Self {
+        let style = match mode {
+            ProgressMode::Auto if std::io::stderr().is_terminal() => Style::Redraw,
+            ProgressMode::Auto | ProgressMode::Plain => Style::Plain,
+            ProgressMode::Json => Style::Json,
+            ProgressMode::None => Style::Off,
+        };
+        Self { style, phase: None }
+    }
+
+    /// End the current phase, if any, and start `name`; `total` is the
+    /// number of files it will go through, when known.
+    pub fn phase(&mut self, name: &'static str, total: Option<u64>) {
+        self.finish();
+        let now = Instant::now();
+        self.phase = Some(Phase {
+            name,
+            total,
+            done: 0,
+            started: now,
+            reported: now,
+            reported_step: 0,
+        });
+        match self.style {
+            Style::Redraw => self.redraw(),
+            Style::Plain => match total {
+                Some(total) => eprintln!("[{name}] 0/{total} files"),
+                None => eprintln!("[{name}] ..."),
+            },
+            Style::Json => emit(&ProgressEvent::PhaseStarted { phase: name, total }),
+            Style::Off => {}
+        }
+    }
+
+    /// Count `files` more files as done in the current phase.
+    pub fn advance(&mut self, files: u64) {
+        let style = self.style;
+        let Some(phase) = self.phase.as_mut() else {
+            return;
+        };
+        phase.done += files;
+        let now = Instant::now();
+        let since = now.duration_since(phase.reported);
+        let due = match style {
+            Style::Redraw => since >= REDRAW_EVERY,
+            Style::Plain => phase.step() > phase.reported_step || since >= PLAIN_EVERY,
+            Style::Json => since >= JSON_EVERY,
+            Style::Off => false,
+        };
+        if !due {
+            return;
+        }
+        phase.reported = now;
+        phase.reported_step = phase.step();
+        match style {
+            Style::Redraw => {
+                eprint!("\r\x1b[K{}", phase.line());
+                let _ = std::io::stderr().flush();
+            }
+            Style::Plain => eprintln!("{}", phase.line()),
+            Style::Json => {
+                if let Some(total) = phase.total {
+                    emit(&ProgressEvent::Progress {
+                        phase: phase.name,
+                        done: phase.done,
+                        total,
+                        elapsed_ms: phase.started.elapsed().as_millis() as u64,
+                        eta_ms: phase.eta().map(|eta| eta.as_millis() as u64),
+                    });
+                }
+            }
+            Style::Off => {}
+        }
+    }
+
+    /// End the current phase. The terminal line is cleared so the summary
+    /// printed afterwards starts on a clean line.
+    pub fn finish(&mut self) {
+        let Some(phase) = self.phase.take() else {
+            return;
+        };
+        let elapsed = phase.started.elapsed();
+        match self.style {
+            Style::Redraw => eprint!("\r\x1b[K"),
+            Style::Plain => match phase.total {
+                Some(_) => eprintln!(
+                    "[{}] done: {} files in {}",
+                    phase.name,
+                    phase.done,
+                    format_duration(elapsed)
+                ),
+                None => eprintln!("[{}] done in {}", phase.name, format_duration(elapsed)),
+            },
+            Style::Json => emit(&ProgressEvent::PhaseFinished {
+                phase: phase.name,
+                done: phase.done,
+                elapsed_ms: elapsed.as_millis() as u64,
+            }),
+            Style::Off => {}
+        }
+    }
+
+    fn redraw(&self) {
+        if let Some(phase) = &self.phase {
+            eprint!("\r\x1b[K{}", phase.line());
+            let _ = std::io::stderr().flush();
+        }
+    }
+}
+
+impl Drop for Progress {
+    fn drop(&mut self) {
+        // A run that fails mid-phase must not leave a half-drawn line.
+        if self.style == Style::Redraw && self.phase.is_some() {
+            eprint!("\r\x1b[K");
+        }
+    }
+}
+
+impl Phase {
+    fn step(&self) -> u64 {
+        match self.total {
+            Some(total) if total > 0 => self.done * 10 / total,
+            _ => 0,
+        }
+    }
+
+    fn eta(&self) -> Option<Duration> {
+        eta(self.done, self.total?, self.started.elapsed())
+    }
+
+    fn line(&self) -> String {
+        let elapsed = format_duration(self.started.elapsed());
+        let Some(total) = self.total else {
+            return format!("[{}] {elapsed}", self.name);
+        };
+        let percent = if total == 0 {
+            100
+        } else {
+            self.done * 100 / total
+        };
+        let eta = match self.eta() {
+            Some(eta) => format!(", ETA {}", format_duration(eta)),
+            None => String::new(),
+        };
+        format!(
+            "[{}] {}/{total} files ({percent}%), {elapsed}{eta}",
+            self.name, self.done
+        )
+    }
+}
+
+fn emit(event: &ProgressEvent) {
+    if let Ok(line) = serde_json::to_string(event) {
+        eprintln!("{line}");
+    }
+}
+
+/// Time left for `total - done` more files at the rate of the first `done`;
+/// `None` before the first file is done.
+fn eta(done: u64, total: u64, elapsed: Duration) -> Option<Duration> {
+    if done == 0 {
+        return None;
+    }
+    let left = total.saturating_sub(done);
+    Some(elapsed.mul_f64(left as f64 / done as f64))
+}
+
+/// `42s`, `3m05s` or `1h02m`.
+fn format_duration(duration: Duration) -> String {
+    let secs = duration.as_secs();
+    match secs {
+        0..60 => format!("{secs}s"),
+        60..3600 => format!("{}m{:02}s", secs / 60, secs % 60),
+        _ => format!("{}h{:02}m", secs / 3600, secs % 3600 / 60),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn eta_extrapolates_the_rate_so_far() {
+        assert_eq!(eta(0, 100, Duration::from_secs(5)), None);
+        assert_eq!(
+            eta(25, 100, Duration::from_secs(10)),
+            Some(Duration::from_secs(30))
+        );
+        assert_eq!(eta(100, 100, Duration::from_secs(10)), Some(Duration::ZERO));
+        assert_eq!(format_duration(Duration::from_secs(42)), "42s");
+        assert_eq!(format_duration(Duration::from_secs(185)), "3m05s");
+        assert_eq!(format_duration(Duration::from_secs(3720)), "1h02m");
+    }
+
+    #[test]
+    fn json_events_are_tagged() {
+        let event = ProgressEvent::Progress {
+            phase: "parse",
+            done: 25,
+            total: 100,
+            elapsed_ms: 10_000,
+            eta_ms: Some(30_000),
+        };
+        assert_eq!(
+            serde_json::to_string(&event).unwrap(),
+            r#"{"event":"progress","phase":"parse","done":25,"total":100,"elapsed_ms":10000,"eta_ms":30000}"#
+        );
+        let started = ProgressEvent::PhaseStarted {
+            phase: "resolve",
+            total: None,
+        };
+        assert_eq!(
+            serde_json::to_string(&started).unwrap(),
+            r#"{"event":"phase_started","phase":"resolve"}"#
+        );
+    }
+}
@@ -0,0 +1,257 @@
+//! How results are printed for people: `--plain`, `--no-color` and
+//! `--theme`.
+//!
+//! Rich output (the default) sizes columns to the results, dims paths and
+//! shows syntax-highlighted snippets. Colors are used only when stdout is a
+//! terminal, `NO_COLOR` is unset or empty, `TERM` is not `dumb` and
+//! `--no-color` is not given. `--plain` keeps the bare fixed-width columns,
+//! for scripts and diffs.
+
+use clap::ValueEnum;
+use cruxe_indexer::highlight::{self, TokenClass};
+use std::io::IsTerminal;
+use std::sync::OnceLock;
+
+static STYLE: OnceLock<Style> = OnceLock::new();
+
+#[derive(Debug, Clone, Copy, Default, ValueEnum, PartialEq, Eq)]
+pub enum ThemeName {
+    /// Bright colors for dark backgrounds
+    #[default]
+    Dark,
+    /// Deeper colors for light backgrounds
+    Light,
+}
+
+/// What each part of the output is painted with: SGR parameters.
+#[derive(Debug, PartialEq, Eq)]
+pub struct Theme {
+    pub heading: &'static str,
+    pub path: &'static str,
+    pub name: &'static str,
+    pub kind: &'static str,
+    pub muted: &'static str,
+    pub keyword: &'static str,
+    pub string: &'static str,
+    pub comment: &'static str,
+    pub number: &'static str,
+    pub r#type: &'static str,
+}
+
+const DARK: Theme = Theme {
+    heading: "1",
+    path: "2",
+    name: "1;96",
+    kind: "93",
+    muted: "2",
+    keyword: "95",
+    string: "92",
+    comment: "2;3",
+    number: "33",
+    r#type: "94",
+};
+
+const LIGHT: Theme = Theme {
+    heading: "1",
+    path: "90",
+    name: "1;34",
+    kind: "33",
+    muted: "90",
+    keyword: "35",
+    string: "32",
+    comment: "3;90",
+    number: "31",
+    r#type: "34",
+};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Style {
+    /// The bare fixed-width columns of `--plain`.
+    pub plain: bool,
+    theme: Option<&'static Theme>,
+}
+
+/// Settle the style of this run; called once from `main`.
+pub fn init(plain: bool, no_color: bool, theme: ThemeName) {
+    let color = !plain && !no_color && color_wanted(std::io::stdout().is_terminal());
+    let _ = STYLE.set(Style::new(plain, color, theme));
+}
+
+/// The style of this run: rich and uncolored when [`init`] was not called.
+pub fn current() -> Style {
+    STYLE
+        .get()
+        .copied()
+        .unwrap_or(Style::new(false, false, ThemeName::Dark))
+}
+
+fn color_wanted(terminal: bool) -> bool {
+    let no_color = std::env::var_os("NO_COLOR").is_some_and(|value| !value.is_empty());
+    let dumb = std::env::var_os("TERM").is_some_and(|term| term == "dumb");
+    terminal && !no_color && !dumb
+}
+
+impl Style {
+    pub fn new(plain: bool, color: bool, theme: ThemeName) -> Self {
+        let theme = match theme {
+            ThemeName::Dark => &DARK,
+            ThemeName::Light => &LIGHT,
+        };
+        Self {
+            plain,
+            theme: color.then_some(theme),
+        }
+    }
+
+    pub fn heading(&self, text: &str) -> String {
+        self.paint(|theme| theme.heading, text)
+    }
+
+    pub fn path(&self, text: &str) -> String {
+        self.paint(|theme| theme.path, text)
+    }
+
+    pub fn name(&self, text: &str) -> String {
+        self.paint(|theme| theme.name, text)
+    }
+
+    pub fn kind(&self, text: &str) -> String {
+        self.paint(|theme| theme.kind, text)
+    }
+
+    pub fn muted(&self, text: &str) -> String {
+        self.paint(|theme| theme.muted, text)
+    }
+
+    /// `source` with its tokens painted by class; as is without colors or
+    /// a grammar for `language`.
+    pub fn code(&self, source: &str, language: &str) -> String {
+        let Some(theme) = self.theme else {
+            return source.to_string();
+        };
+        let mut out = String::with_capacity(source.len());
+        let mut at = 0;
+        for span in highlight::spans(source, language) {
+            if span.start < at {
+                continue;
+            }
+            out.push_str(&source[at..span.start]);
+            let sgr = match span.class {
+                TokenClass::Keyword => theme.keyword,
+                TokenClass::String => theme.string,
+                TokenClass::Comment => theme.comment,
+                TokenClass::Number => theme.number,
+                TokenClass::Type => theme.r#type,
+            };
+            // A multi-line token is painted line by line so the indent
+            // added by the caller stays unpainted.
+            let token = &source[span.start..span.end];
+            let painted: Vec<String> = token.split('\n').map(|line| paint(sgr, line)).collect();
+            out.push_str(&painted.join("\n"));
+            at = span.end;
+        }
+        out.push_str(&source[at..]);
+        out
+    }
+
+    fn paint(&self, sgr: impl FnOnce(&Theme) -> &'static str, text: &str) -> String {
+        match self.theme {
+            Some(theme) => paint(sgr(theme), text),
+            None => text.to_string(),
+        }
+    }
+}
+
+fn paint(sgr: &str, text: &str) -> String {
+    if text.is_empty() {
+        return String::new();
+    }
+    format!("\x1b[{sgr}m{text}\x1b[0m")
+}
+
+/// `text` padded to `width` characters; pad before painting so escapes do
+/// not count toward the width.
+pub fn pad(text: &str, width: usize) -> String {
+    format!("{text:<width$}")
+}
+
+/// The widest of `values` in characters, at least `min` and at most `max`.
+pub fn column_width<'a>(
+    values: impl IntoIterator<Item = &'a str>,
+    min: usize,
+    max: usize,
+) -> usize {
+    values
+        .into_iter()
+        .map(|value| value.chars().count())
+        .max()
+        .unwrap_or(0)
+        .clamp(min, max)
+}
+
+/// Up to `max_lines` lines of `text` from its first non-blank line, with
+/// their common indent removed.
+pub fn excerpt(text: &str, max_lines: usize) -> String {
+    let lines: Vec<&str> = text
+        .lines()
+        .skip_while(|line| line.trim().is_empty())
+        .take(max_lines)
+        .collect();
+    let indent = lines
+        .iter()
+        .filter(|line| !line.trim().is_empty())
+        .map(|line| line.len() - line.trim_start().len())
+        .min()
+        .unwrap_or(0);
+    lines
+        .iter()
+        .map(|line| line.get(indent..).unwrap_or("").trim_end())
+        .collect::<Vec<_>>()
+        .join("\n")
+        .trim_end()
+        .to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn colors_are_only_added_when_enabled() {
+        let colored = Style::new(false, true, ThemeName::Dark);
+        assert_eq!(colored.path("src/lib.rs"), "\x1b[2msrc/lib.rs\x1b[0m");
+        assert_eq!(
+            colored.code("let n = 3;", "rust"),
+            "\x1b[95mlet\x1b[0m n = \x1b[33m3\x1b[0m;"
+        );
+        assert_eq!(
+            colored.code("/* a\nb */", "rust"),
+            "\x1b[2;3m/* a\x1b[0m\n\x1b[2;3mb */\x1b[0m"
+        );
+
+        let uncolored = Style::new(false, false, ThemeName::Light);
+        assert_eq!(uncolored.path("src/lib.rs"), "src/lib.rs");
+        assert_eq!(uncolored.code("let n = 3;", "rust"), "let n = 3;");
+        assert!(!color_wanted(false));
+    }
+
+    #[test]
+    fn columns_fit_the_widest_value() {
+        assert_eq!(
+            column_width(["a.go:1", "internal/api/server.go:42"], 8, 60),
+            25
+        );
+        assert_eq!(column_width(["a"], 8, 60), 8);
+        assert_eq!(column_width(["x".repeat(90).as_str()], 8, 60), 60);
+        assert_eq!(pad("go", 4), "go  ");
+    }
+
+    #[test]
+    fn excerpts_drop_the_common_indent() {
+        let body = "\n    func (s *Server) Handle() {\n        s.mu.Lock()\n\n        defer s.mu.Unlock()\n    }\n";
+        assert_eq!(
+            excerpt(body, 3),
+            "func (s *Server) Handle() {\n    s.mu.Lock()"
+        );
+    }
+}
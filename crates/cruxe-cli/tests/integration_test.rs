@@ -3093,6 +3093,70 @@ fn t330_state_import_fails_fast_when_maintenance_lock_is_held() {
     );
 }
 
+#[test]
+fn t360_index_recovers_from_abandoned_journal() {
+    let fixture = fixture_repo_path();
+    let tmp = tempdir().expect("tempdir");
+    let workspace = tmp.path().join("workspace");
+    copy_dir_recursive(&fixture, &workspace);
+
+    let data_root = tmp.path().join("cc-data");
+    std::fs::create_dir_all(&data_root).unwrap();
+    let config_path = tmp.path().join("config.toml");
+    write_test_config(&config_path, &data_root);
+
+    let config_arg = config_path.to_string_lossy().to_string();
+    let workspace_arg = workspace.to_string_lossy().to_string();
+    run_cruxe_checked(&[
+        "--config".to_string(),
+        config_arg.clone(),
+        "init".to_string(),
+        "--path".to_string(),
+        workspace_arg.clone(),
+    ]);
+    run_cruxe_checked(&[
+        "--config".to_string(),
+        config_arg.clone(),
+        "index".to_string(),
+        "--path".to_string(),
+        workspace_arg.clone(),
+    ]);
+
+    // Simulate a run killed between its SQLite writes and the Tantivy commit.
+    let workspace_canonical = std::fs::canonicalize(&workspace).unwrap();
+    let project_id = cruxe_core::types::generate_project_id(&workspace_canonical.to_string_lossy());
+    let data_dir = data_root.join("data").join(project_id);
+    std::fs::write(
+        data_dir.join("index.journal"),
+        r#"{"job_id":"job-killed","ref":"live","pid":1,"started_at":"2026-01-01T00:00:00Z"}"#,
+    )
+    .unwrap();
+
+    let output = run_cruxe(&[
+        "--config".to_string(),
+        config_arg,
+        "index".to_string(),
+        "--path".to_string(),
+        workspace_arg,
+    ]);
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    assert!(
+        output.status.success(),
+        "index should recover:\nstdout:{}\nstderr:{}",
+        stdout,
+        String::from_utf8_lossy(&output.stderr)
+    );
+    assert!(
+        stdout.contains("Previous index run did not finish"),
+        "stdout:\n{stdout}"
+    );
+    assert!(
+        !stdout.contains("Files indexed: 0"),
+        "recovery should re-index files, stdout:\n{stdout}"
+    );
+    assert!(!data_dir.join("index.journal").exists());
+}
+
 #[test]
 fn t321_prune_overlays_removes_stale_overlay_dirs() {
     let tmp = tempdir().expect("tempdir");
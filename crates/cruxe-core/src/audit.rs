@@ -0,0 +1,248 @@
+//! Append-only audit log of HTTP queries and graph exports.
+//!
+//! Off unless `audit.enabled = true`. Each entry is one JSON object per line
+//! recording who ran what: client identity, tool or export format, the
+//! arguments as sent (query text, ref, paths), the outcome, and the result
+//! size. Every line also carries `prev`, the BLAKE3 hash of the line before
+//! it, so edits or deletions inside the file are detected by [`verify`]
+//! (`cruxe audit verify`). The file is only ever opened in append mode.
+
+use crate::config::Config;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::fs::{File, OpenOptions};
+use std::io::{self, BufRead, Read, Seek, SeekFrom, Write};
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+pub const AUDIT_FILE: &str = "audit.log";
+
+/// `prev` of the first entry in a log.
+pub const GENESIS_HASH: &str = "0000000000000000000000000000000000000000000000000000000000000000";
+
+/// Initial tail read when looking for the last entry of an existing log.
+const TAIL_CHUNK: u64 = 64 * 1024;
+
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct AuditEvent {
+    pub timestamp: String,
+    /// `query` for HTTP tool calls, `export` for `cruxe export`.
+    pub action: String,
+    /// Credential name or remote address over HTTP; the OS user for the CLI.
+    pub client: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub tenant: Option<String>,
+    pub project_id: String,
+    /// Tool name or export format.
+    pub operation: String,
+    /// Tool arguments or export options, as given.
+    #[serde(default)]
+    pub arguments: Value,
+    /// `ok`, or the protocol error code that ended the request.
+    pub outcome: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub result_count: Option<u64>,
+    #[serde(default)]
+    pub result_bytes: u64,
+    #[serde(default)]
+    pub duration_ms: u64,
+}
+
+#[derive(Serialize, Deserialize)]
+struct AuditLine {
+    #[serde(flatten)]
+    event: AuditEvent,
+    prev: String,
+}
+
+#[derive(Debug, thiserror::Error)]
+pub enum AuditError {
+    #[error(transparent)]
+    Io(#[from] io::Error),
+
+    #[error("line {line}: {reason}")]
+    Broken { line: usize, reason: String },
+}
+
+pub fn audit_path(config: &Config) -> PathBuf {
+    config
+        .audit
+        .path
+        .as_ref()
+        .map(PathBuf::from)
+        .unwrap_or_else(|| PathBuf::from(&config.storage.data_dir).join(AUDIT_FILE))
+}
+
+struct Chain {
+    file: File,
+    last_hash: String,
+}
+
+/// Writer for one audit log file; entries from all threads are serialized.
+pub struct AuditLog {
+    path: PathBuf,
+    chain: Mutex<Chain>,
+}
+
+impl AuditLog {
+    /// The configured log, or `None` when auditing is disabled.
+    pub fn from_config(config: &Config) -> io::Result<Option<Self>> {
+        if !config.audit.enabled {
+            return Ok(None);
+        }
+        Self::open(&audit_path(config)).map(Some)
+    }
+
+    pub fn open(path: &Path) -> io::Result<Self> {
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)?;
+        }
+        let mut options = OpenOptions::new();
+        options.create(true).append(true).read(true);
+        #[cfg(unix)]
+        {
+            use std::os::unix::fs::OpenOptionsExt;
+            options.mode(0o600);
+        }
+        let mut file = options.open(path)?;
+        let last_hash = match last_line(&mut file)? {
+            Some(line) => line_hash(&line),
+            None => GENESIS_HASH.to_string(),
+        };
+        Ok(Self {
+            path: path.to_path_buf(),
+            chain: Mutex::new(Chain { file, last_hash }),
+        })
+    }
+
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Append one entry. Callers should log failures rather than fail the
+    /// audited request.
+    pub fn record(&self, event: AuditEvent) -> io::Result<()> {
+        let mut chain = self.chain.lock().unwrap_or_else(|e| e.into_inner());
+        let line = serde_json::to_vec(&AuditLine {
+            event,
+            prev: chain.last_hash.clone(),
+        })
+        .map_err(io::Error::other)?;
+        let mut buf = line.clone();
+        buf.push(b'\n');
+        chain.file.write_all(&buf)?;
+        chain.file.flush()?;
+        chain.last_hash = line_hash(&line);
+        Ok(())
+    }
+}
+
+/// Check the hash chain of a log; returns the number of entries.
+pub fn verify(path: &Path) -> Result<usize, AuditError> {
+    let reader = io::BufReader::new(File::open(path)?);
+    let mut expected = GENESIS_HASH.to_string();
+    let mut entries = 0;
+    for (idx, line) in reader.split(b'\n').enumerate() {
+        let line = line?;
+        if line.is_empty() {
+            continue;
+        }
+        let broken = |reason: String| AuditError::Broken {
+            line: idx + 1,
+            reason,
+        };
+        let parsed: AuditLine =
+            serde_json::from_slice(&line).map_err(|e| broken(format!("invalid entry: {e}")))?;
+        if parsed.prev != expected {
+            return Err(broken(
+                "hash chain mismatch; an earlier entry was changed or removed".to_string(),
+            ));
+        }
+        expected = line_hash(&line);
+        entries += 1;
+    }
+    Ok(entries)
+}
+
+fn line_hash(line: &[u8]) -> String {
+    blake3::hash(line).to_hex().to_string()
+}
+
+/// The last non-empty line of `file`, read from the end.
+fn last_line(file: &mut File) -> io::Result<Option<Vec<u8>>> {
+    let len = file.metadata()?.len();
+    let mut chunk = TAIL_CHUNK;
+    loop {
+        let start = len.saturating_sub(chunk);
+        file.seek(SeekFrom::Start(start))?;
+        let mut tail = Vec::new();
+        file.read_to_end(&mut tail)?;
+        let trimmed = tail.strip_suffix(b"\n").unwrap_or(&tail);
+        match trimmed.iter().rposition(|byte| *byte == b'\n') {
+            Some(at) => return Ok(Some(trimmed[at + 1..].to_vec())),
+            None if start == 0 => {
+                return Ok((!trimmed.is_empty()).then(|| trimmed.to_vec()));
+            }
+            None => chunk *= 2,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn event(operation: &str) -> AuditEvent {
+        AuditEvent {
+            timestamp: "2026-01-01T00:00:00Z".to_string(),
+            action: "query".to_string(),
+            client: "ci".to_string(),
+            project_id: "p1".to_string(),
+            operation: operation.to_string(),
+            arguments: json!({"query": "ValidateToken"}),
+            outcome: "ok".to_string(),
+            result_count: Some(3),
+            ..AuditEvent::default()
+        }
+    }
+
+    #[test]
+    fn disabled_by_default() {
+        assert!(AuditLog::from_config(&Config::default()).unwrap().is_none());
+    }
+
+    #[test]
+    fn entries_chain_across_reopen_and_tampering_is_detected() {
+        let tmp = tempfile::tempdir().unwrap();
+        let path = tmp.path().join("logs").join(AUDIT_FILE);
+
+        let log = AuditLog::open(&path).unwrap();
+        log.record(event("search_code")).unwrap();
+        log.record(event("get_call_graph")).unwrap();
+        drop(log);
+        // Reopening continues the chain from the last entry.
+        AuditLog::open(&path)
+            .unwrap()
+            .record(event("locate_symbol"))
+            .unwrap();
+        assert_eq!(verify(&path).unwrap(), 3);
+
+        let content = std::fs::read_to_string(&path).unwrap();
+        let first: Value = serde_json::from_str(content.lines().next().unwrap()).unwrap();
+        assert_eq!(first["prev"], GENESIS_HASH);
+        assert_eq!(first["arguments"]["query"], "ValidateToken");
+
+        let without_second: Vec<&str> = content
+            .lines()
+            .enumerate()
+            .filter(|(idx, _)| *idx != 1)
+            .map(|(_, line)| line)
+            .collect();
+        std::fs::write(&path, without_second.join("\n") + "\n").unwrap();
+        assert!(matches!(
+            verify(&path),
+            Err(AuditError::Broken { line: 2, .. })
+        ));
+    }
+}
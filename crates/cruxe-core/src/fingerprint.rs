@@ -0,0 +1,226 @@
+/// Bits per distinct key; with [`FINGERPRINT_PROBES`] probes this keeps the
+/// false-positive rate near 1% however many identifiers a file references.
+const BITS_PER_KEY: usize = 10;
+
+/// Smallest filter, for files that reference almost nothing.
+const MIN_FINGERPRINT_BITS: usize = 256;
+
+/// Number of probe positions derived per key.
+const FINGERPRINT_PROBES: usize = 7;
+
+/// First byte of a stored fingerprint. Older layouts (a fixed 2048-bit
+/// filter with 3 probes) do not carry it and are read as "may contain".
+const LAYOUT_VERSION: u8 = 2;
+
+/// Bloom filter over the identifiers a file references, sized from how many
+/// there are.
+///
+/// Used as a prefilter for reference queries: a negative answer from
+/// [`ReferenceFingerprint::may_contain`] or
+/// [`ReferenceFingerprint::may_reference`] proves the file cannot reference
+/// the identifier, so its edge rows never need to be scanned. Positive
+/// answers may be false positives and must be confirmed against the edge
+/// table.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ReferenceFingerprint {
+    bits: Vec<u8>,
+    identifier_count: u32,
+}
+
+impl Default for ReferenceFingerprint {
+    fn default() -> Self {
+        Self::from_names([])
+    }
+}
+
+impl ReferenceFingerprint {
+    /// Build a fingerprint from raw referenced names (call targets, imports).
+    pub fn from_names<'a>(names: impl IntoIterator<Item = &'a str>) -> Self {
+        Self::from_references(names, [])
+    }
+
+    /// Build a fingerprint from referenced names and the ids of the symbols
+    /// they were resolved to. Qualified names are reduced to their last
+    /// segment so `auth::validate_token` and `pkg.ValidateToken` match
+    /// lookups by bare symbol name.
+    pub fn from_references<'a>(
+        names: impl IntoIterator<Item = &'a str>,
+        symbol_ids: impl IntoIterator<Item = &'a str>,
+    ) -> Self {
+        let mut keys: Vec<String> = names
+            .into_iter()
+            .map(reference_key)
+            .filter(|key| !key.is_empty())
+            .map(name_key)
+            .chain(
+                symbol_ids
+                    .into_iter()
+                    .filter(|id| !id.is_empty())
+                    .map(id_key),
+            )
+            .collect();
+        keys.sort();
+        keys.dedup();
+
+        let len = (keys.len() * BITS_PER_KEY)
+            .max(MIN_FINGERPRINT_BITS)
+            .next_power_of_two();
+        let mut fingerprint = Self {
+            bits: vec![0; len / 8],
+            identifier_count: u32::try_from(keys.len()).unwrap_or(u32::MAX),
+        };
+        for key in &keys {
+            for position in fingerprint.probe_positions(key) {
+                fingerprint.bits[position / 8] |= 1 << (position % 8);
+            }
+        }
+        fingerprint
+    }
+
+    /// Returns false only when `name` is definitely not referenced.
+    pub fn may_contain(&self, name: &str) -> bool {
+        let key = reference_key(name);
+        !key.is_empty() && self.probe(&name_key(key))
+    }
+
+    /// Returns false only when no reference was resolved to `symbol_id`.
+    pub fn may_reference(&self, symbol_id: &str) -> bool {
+        !symbol_id.is_empty() && self.probe(&id_key(symbol_id))
+    }
+
+    pub fn identifier_count(&self) -> u32 {
+        self.identifier_count
+    }
+
+    /// The stored form: a layout byte, then the filter.
+    pub fn to_bytes(&self) -> Vec<u8> {
+        let mut bytes = Vec::with_capacity(self.bits.len() + 1);
+        bytes.push(LAYOUT_VERSION);
+        bytes.extend_from_slice(&self.bits);
+        bytes
+    }
+
+    /// Restore a fingerprint from [`Self::to_bytes`]. Returns `None` for any
+    /// other layout (e.g. older builds), which callers must treat as
+    /// "may contain anything".
+    pub fn from_bytes(bytes: &[u8], identifier_count: u32) -> Option<Self> {
+        let (&version, bits) = bytes.split_first()?;
+        (version == LAYOUT_VERSION
+            && bits.len() * 8 >= MIN_FINGERPRINT_BITS
+            && bits.len().is_power_of_two())
+        .then(|| Self {
+            bits: bits.to_vec(),
+            identifier_count,
+        })
+    }
+
+    fn probe(&self, key: &str) -> bool {
+        self.probe_positions(key)
+            .into_iter()
+            .all(|position| self.bits[position / 8] & (1 << (position % 8)) != 0)
+    }
+
+    fn probe_positions(&self, key: &str) -> [usize; FINGERPRINT_PROBES] {
+        let len = self.bits.len() * 8;
+        let digest = blake3::hash(key.as_bytes());
+        let bytes = digest.as_bytes();
+        let mut positions = [0usize; FINGERPRINT_PROBES];
+        for (idx, position) in positions.iter_mut().enumerate() {
+            let offset = idx * 4;
+            let word = u32::from_le_bytes([
+                bytes[offset],
+                bytes[offset + 1],
+                bytes[offset + 2],
+                bytes[offset + 3],
+            ]);
+            *position = word as usize % len;
+        }
+        positions
+    }
+}
+
+/// Normalize a referenced name to the key stored in fingerprints.
+pub fn reference_key(name: &str) -> &str {
+    let trimmed = name.trim();
+    let tail = trimmed.rsplit("::").next().unwrap_or(trimmed);
+    tail.rsplit('.').next().unwrap_or(tail).trim()
+}
+
+/// Names and symbol ids hash in separate spaces.
+fn name_key(key: &str) -> String {
+    format!("name:{key}")
+}
+
+fn id_key(symbol_id: &str) -> String {
+    format!("id:{symbol_id}")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn inserted_names_are_reported_present() {
+        let fingerprint =
+            ReferenceFingerprint::from_names(["validate_token", "auth::Claims", "pkg.Load"]);
+        assert!(fingerprint.may_contain("validate_token"));
+        assert!(fingerprint.may_contain("Claims"));
+        assert!(fingerprint.may_contain("Load"));
+        assert_eq!(fingerprint.identifier_count(), 3);
+    }
+
+    #[test]
+    fn empty_fingerprint_rejects_everything() {
+        let fingerprint = ReferenceFingerprint::default();
+        assert!(!fingerprint.may_contain("anything"));
+        assert!(!fingerprint.may_contain(""));
+        assert!(!fingerprint.may_reference("stable::anything"));
+    }
+
+    #[test]
+    fn reference_key_strips_rust_and_dotted_qualifiers() {
+        assert_eq!(reference_key("crate::auth::validate"), "validate");
+        assert_eq!(reference_key("handlers.HandleRequest"), "HandleRequest");
+        assert_eq!(reference_key("  plain  "), "plain");
+    }
+
+    #[test]
+    fn bytes_roundtrip_preserves_membership() {
+        let fingerprint = ReferenceFingerprint::from_references(["alpha", "beta"], ["stable::x"]);
+        let restored =
+            ReferenceFingerprint::from_bytes(&fingerprint.to_bytes(), 3).expect("valid layout");
+        assert_eq!(restored, fingerprint);
+        assert!(restored.may_reference("stable::x"));
+        assert!(!restored.may_contain("x"));
+        assert!(ReferenceFingerprint::from_bytes(&[0u8; 4], 0).is_none());
+        // The fixed 2048-bit layout of older builds.
+        assert!(ReferenceFingerprint::from_bytes(&[0u8; 256], 0).is_none());
+    }
+
+    #[test]
+    fn unrelated_names_are_mostly_rejected() {
+        let names: Vec<String> = (0..64).map(|idx| format!("callee_{idx}")).collect();
+        let fingerprint = ReferenceFingerprint::from_names(names.iter().map(String::as_str));
+        let false_positives = (0..1000)
+            .filter(|idx| fingerprint.may_contain(&format!("unrelated_{idx}")))
+            .count();
+        assert!(
+            false_positives < 20,
+            "false positive rate too high: {false_positives}/1000"
+        );
+    }
+
+    #[test]
+    fn large_files_do_not_saturate() {
+        let names: Vec<String> = (0..20_000).map(|idx| format!("callee_{idx}")).collect();
+        let fingerprint = ReferenceFingerprint::from_names(names.iter().map(String::as_str));
+        assert!(names.iter().all(|name| fingerprint.may_contain(name)));
+        let false_positives = (0..1000)
+            .filter(|idx| fingerprint.may_contain(&format!("unrelated_{idx}")))
+            .count();
+        assert!(
+            false_positives < 20,
+            "false positive rate too high: {false_positives}/1000"
+        );
+    }
+}
@@ -1,10 +1,17 @@
+pub mod audit;
 pub mod cache;
+pub mod cancel;
+pub mod canonical_id;
 pub mod config;
 pub mod constants;
 pub mod edge_confidence;
 pub mod error;
+pub mod fingerprint;
 pub mod ids;
 pub mod languages;
+pub mod metrics;
+pub mod stats;
+pub mod telemetry;
 pub mod time;
 pub mod tokens;
 pub mod types;
@@ -0,0 +1,312 @@
+//! Process-wide metrics of a long-running server, served on `/metrics` in
+//! the Prometheus text format.
+//!
+//! Unlike [`crate::stats`], collection is always on and never reset: values
+//! accumulate for the life of the process, as Prometheus expects of counters
+//! and histograms. Values that are cheaper to read than to track, such as
+//! index size, are passed to [`render`] by the server at scrape time.
+
+use std::collections::BTreeMap;
+use std::fmt::Write as _;
+use std::sync::Mutex;
+use std::time::Duration;
+
+/// Upper bounds, in seconds, of query latency buckets.
+pub const QUERY_BUCKETS: &[f64] = &[
+    0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0,
+];
+
+/// Upper bounds, in seconds, of incremental update latency buckets.
+pub const SYNC_BUCKETS: &[f64] = &[0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0, 60.0, 300.0];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum MetricKind {
+    Counter,
+    Gauge,
+}
+
+impl MetricKind {
+    fn as_str(self) -> &'static str {
+        match self {
+            Self::Counter => "counter",
+            Self::Gauge => "gauge",
+        }
+    }
+}
+
+/// A metric family read at scrape time.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Family {
+    pub name: &'static str,
+    pub help: &'static str,
+    pub kind: MetricKind,
+    pub samples: Vec<Sample>,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct Sample {
+    pub labels: Vec<(&'static str, String)>,
+    pub value: f64,
+}
+
+#[derive(Debug, Clone, Default)]
+struct Histogram {
+    /// Per-bucket (not cumulative) counts; the last slot is `+Inf`.
+    counts: Vec<u64>,
+    sum: f64,
+    count: u64,
+}
+
+impl Histogram {
+    fn observe(&mut self, buckets: &[f64], seconds: f64) {
+        if self.counts.is_empty() {
+            self.counts = vec![0; buckets.len() + 1];
+        }
+        let slot = buckets
+            .iter()
+            .position(|bound| seconds <= *bound)
+            .unwrap_or(buckets.len());
+        self.counts[slot] += 1;
+        self.sum += seconds;
+        self.count += 1;
+    }
+}
+
+#[derive(Debug, Default)]
+struct Registry {
+    queries: BTreeMap<String, Histogram>,
+    syncs: Histogram,
+    sync_failures: u64,
+    cache_hits: u64,
+    cache_misses: u64,
+}
+
+static REGISTRY: Mutex<Option<Registry>> = Mutex::new(None);
+
+fn update(apply: impl FnOnce(&mut Registry)) {
+    if let Ok(mut guard) = REGISTRY.lock() {
+        apply(guard.get_or_insert_with(Registry::default));
+    }
+}
+
+/// Record one query (an MCP tool call) taking `elapsed`.
+pub fn observe_query(tool: &str, elapsed: Duration) {
+    update(|registry| {
+        registry
+            .queries
+            .entry(tool.to_string())
+            .or_default()
+            .observe(QUERY_BUCKETS, elapsed.as_secs_f64());
+    });
+}
+
+/// Record one incremental index update; failed updates are counted but not
+/// timed, since they may stop anywhere.
+pub fn observe_sync(elapsed: Duration, success: bool) {
+    update(|registry| {
+        if success {
+            registry.syncs.observe(SYNC_BUCKETS, elapsed.as_secs_f64());
+        } else {
+            registry.sync_failures += 1;
+        }
+    });
+}
+
+pub fn cache_hit() {
+    update(|registry| registry.cache_hits += 1);
+}
+
+pub fn cache_miss() {
+    update(|registry| registry.cache_misses += 1);
+}
+
+/// Every metric of the process, followed by `families`, in the Prometheus
+/// text exposition format.
+pub fn render(families: &[Family]) -> String {
+    match REGISTRY.lock() {
+        Ok(guard) => render_registry(guard.as_ref().unwrap_or(&Registry::default()), families),
+        Err(_) => render_registry(&Registry::default(), families),
+    }
+}
+
+fn render_registry(registry: &Registry, families: &[Family]) -> String {
+    let mut out = String::new();
+    header(
+        &mut out,
+        "cruxe_query_duration_seconds",
+        "Latency of queries (MCP tool calls) by tool.",
+        "histogram",
+    );
+    for (tool, histogram) in &registry.queries {
+        write_histogram(
+            &mut out,
+            "cruxe_query_duration_seconds",
+            &[("tool", tool.as_str())],
+            QUERY_BUCKETS,
+            histogram,
+        );
+    }
+    header(
+        &mut out,
+        "cruxe_index_update_duration_seconds",
+        "Latency of successful incremental index updates.",
+        "histogram",
+    );
+    write_histogram(
+        &mut out,
+        "cruxe_index_update_duration_seconds",
+        &[],
+        SYNC_BUCKETS,
+        &registry.syncs,
+    );
+    header(
+        &mut out,
+        "cruxe_index_update_failures_total",
+        "Incremental index updates that failed.",
+        "counter",
+    );
+    let _ = writeln!(
+        out,
+        "cruxe_index_update_failures_total {}",
+        registry.sync_failures
+    );
+    header(
+        &mut out,
+        "cruxe_cache_requests_total",
+        "Lookups in the in-process query caches, by result.",
+        "counter",
+    );
+    let _ = writeln!(
+        out,
+        "cruxe_cache_requests_total{{result=\"hit\"}} {}",
+        registry.cache_hits
+    );
+    let _ = writeln!(
+        out,
+        "cruxe_cache_requests_total{{result=\"miss\"}} {}",
+        registry.cache_misses
+    );
+
+    for family in families {
+        header(&mut out, family.name, family.help, family.kind.as_str());
+        for sample in &family.samples {
+            let labels: Vec<(&str, &str)> = sample
+                .labels
+                .iter()
+                .map(|(name, value)| (*name, value.as_str()))
+                .collect();
+            let _ = writeln!(
+                out,
+                "{}{} {}",
+                family.name,
+                format_labels(&labels),
+                format_value(sample.value)
+            );
+        }
+    }
+    out
+}
+
+fn header(out: &mut String, name: &str, help: &str, kind: &str) {
+    let _ = writeln!(out, "# HELP {name} {help}");
+    let _ = writeln!(out, "# TYPE {name} {kind}");
+}
+
+fn write_histogram(
+    out: &mut String,
+    name: &str,
+    labels: &[(&str, &str)],
+    buckets: &[f64],
+    histogram: &Histogram,
+) {
+    let mut cumulative = 0;
+    for (slot, bound) in buckets
+        .iter()
+        .map(|bound| format_value(*bound))
+        .chain(std::iter::once("+Inf".to_string()))
+        .enumerate()
+    {
+        cumulative += histogram.counts.get(slot).copied().unwrap_or(0);
+        let mut bucket_labels = labels.to_vec();
+        bucket_labels.push(("le", &bound));
+        let _ = writeln!(
+            out,
+            "{name}_bucket{} {cumulative}",
+            format_labels(&bucket_labels)
+        );
+    }
+    let labels = format_labels(labels);
+    let _ = writeln!(out, "{name}_sum{labels} {}", format_value(histogram.sum));
+    let _ = writeln!(out, "{name}_count{labels} {}", histogram.count);
+}
+
+fn format_labels(labels: &[(&str, &str)]) -> String {
+    if labels.is_empty() {
+        return String::new();
+    }
+    let pairs: Vec<String> = labels
+        .iter()
+        .map(|(name, value)| {
+            let value = value
+                .replace('\\', "\\\\")
+                .replace('"', "\\\"")
+                .replace('\n', "\\n");
+            format!("{name}=\"{value}\"")
+        })
+        .collect();
+    format!("{{{}}}", pairs.join(","))
+}
+
+fn format_value(value: f64) -> String {
+    if value.is_finite() && value.fract() == 0.0 && value.abs() < 1e15 {
+        format!("{}", value as i64)
+    } else {
+        format!("{value}")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn renders_cumulative_histograms_and_scrape_time_families() {
+        let mut registry = Registry::default();
+        let mut search = Histogram::default();
+        search.observe(QUERY_BUCKETS, 0.003);
+        search.observe(QUERY_BUCKETS, 0.2);
+        search.observe(QUERY_BUCKETS, 30.0);
+        registry.queries.insert("search_code".to_string(), search);
+        registry.cache_hits = 4;
+        registry.sync_failures = 1;
+
+        let text = render_registry(
+            &registry,
+            &[Family {
+                name: "cruxe_index_files",
+                help: "Files in the index.",
+                kind: MetricKind::Gauge,
+                samples: vec![Sample {
+                    labels: vec![("project", "a\"b".to_string())],
+                    value: 12.0,
+                }],
+            }],
+        );
+        let lines: Vec<&str> = text.lines().collect();
+        for expected in [
+            "cruxe_query_duration_seconds_bucket{tool=\"search_code\",le=\"0.001\"} 0",
+            "cruxe_query_duration_seconds_bucket{tool=\"search_code\",le=\"0.005\"} 1",
+            "cruxe_query_duration_seconds_bucket{tool=\"search_code\",le=\"0.25\"} 2",
+            "cruxe_query_duration_seconds_bucket{tool=\"search_code\",le=\"10\"} 2",
+            "cruxe_query_duration_seconds_bucket{tool=\"search_code\",le=\"+Inf\"} 3",
+            "cruxe_query_duration_seconds_count{tool=\"search_code\"} 3",
+            "cruxe_index_update_duration_seconds_count 0",
+            "cruxe_index_update_failures_total 1",
+            "cruxe_cache_requests_total{result=\"hit\"} 4",
+            "# TYPE cruxe_index_files gauge",
+            "cruxe_index_files{project=\"a\\\"b\"} 12",
+        ] {
+            assert!(lines.contains(&expected), "missing {expected:?} in\n{text}");
+        }
+    }
+}
@@ -0,0 +1,145 @@
+//! Statistics of the current command, printed by `--stats json`.
+//!
+//! Unlike [`crate::telemetry`], nothing here is stored or sent: the numbers
+//! describe one run and are printed when it exits, so CI can track cruxe's
+//! own performance from build to build. Collection is off until [`enable`];
+//! recording is a no-op before that.
+
+use crate::telemetry::PhaseStats;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+/// Counter names shared by the call sites that record them.
+pub const CACHE_HIT: &str = "cache.hit";
+pub const CACHE_MISS: &str = "cache.miss";
+pub const FILES_REPARSED: &str = "files.reparsed";
+pub const FILES_REUSED: &str = "files.reused";
+pub const FILES_SHARED: &str = "files.shared";
+
+/// What `--stats json` prints.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct RunStats {
+    pub command: String,
+    pub cruxe_version: String,
+    pub wall_ms: u64,
+    pub phases: BTreeMap<String, PhaseStats>,
+    pub counters: BTreeMap<String, u64>,
+    /// Peak resident set size of the process; `None` where the platform
+    /// does not report it.
+    pub peak_memory_bytes: Option<u64>,
+}
+
+struct Collector {
+    started: Instant,
+    stats: RunStats,
+}
+
+static COLLECTOR: Mutex<Option<Collector>> = Mutex::new(None);
+
+/// Start collecting for `command`, discarding anything collected before.
+pub fn enable(command: &str) {
+    let collector = Collector {
+        started: Instant::now(),
+        stats: RunStats {
+            command: command.to_string(),
+            cruxe_version: env!("CARGO_PKG_VERSION").to_string(),
+            wall_ms: 0,
+            phases: BTreeMap::new(),
+            counters: BTreeMap::new(),
+            peak_memory_bytes: None,
+        },
+    };
+    if let Ok(mut guard) = COLLECTOR.lock() {
+        *guard = Some(collector);
+    }
+}
+
+/// Add one run of phase `name`.
+pub fn phase(name: &'static str, elapsed: Duration) {
+    with_collector(|stats| {
+        let ms = elapsed.as_millis() as u64;
+        let entry = stats.phases.entry(name.to_string()).or_default();
+        entry.count += 1;
+        entry.total_ms += ms;
+        entry.max_ms = entry.max_ms.max(ms);
+    });
+}
+
+/// Add `delta` to counter `name`.
+pub fn count(name: &'static str, delta: u64) {
+    if delta == 0 {
+        return;
+    }
+    with_collector(|stats| {
+        *stats.counters.entry(name.to_string()).or_default() += delta;
+    });
+}
+
+/// Stop collecting and return the statistics, or `None` if collection was
+/// never enabled.
+pub fn finish() -> Option<RunStats> {
+    let collector = COLLECTOR.lock().ok()?.take()?;
+    let mut stats = collector.stats;
+    stats.wall_ms = collector.started.elapsed().as_millis() as u64;
+    stats.peak_memory_bytes = peak_memory_bytes();
+    Some(stats)
+}
+
+fn with_collector(update: impl FnOnce(&mut RunStats)) {
+    if let Ok(mut guard) = COLLECTOR.lock()
+        && let Some(collector) = guard.as_mut()
+    {
+        update(&mut collector.stats);
+    }
+}
+
+/// High-water mark of the resident set (`VmHWM`), on Linux.
+pub fn peak_memory_bytes() -> Option<u64> {
+    let status = std::fs::read_to_string("/proc/self/status").ok()?;
+    let line = status.lines().find(|line| line.starts_with("VmHWM:"))?;
+    let kib: u64 = line
+        .trim_start_matches("VmHWM:")
+        .trim()
+        .trim_end_matches("kB")
+        .trim()
+        .parse()
+        .ok()?;
+    Some(kib * 1024)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn collects_only_between_enable_and_finish() {
+        count(CACHE_HIT, 1);
+        assert_eq!(finish(), None);
+
+        enable("index");
+        phase("index.scan", Duration::from_millis(5));
+        phase("index.scan", Duration::from_millis(9));
+        count(FILES_REPARSED, 3);
+        count(FILES_REUSED, 0);
+        let stats = finish().unwrap();
+        assert_eq!(stats.command, "index");
+        assert_eq!(
+            stats.phases["index.scan"],
+            PhaseStats {
+                count: 2,
+                total_ms: 14,
+                max_ms: 9,
+            }
+        );
+        assert_eq!(stats.counters.len(), 1);
+        assert_eq!(stats.counters[FILES_REPARSED], 3);
+        if cfg!(target_os = "linux") {
+            assert!(stats.peak_memory_bytes.unwrap() > 0);
+        }
+
+        count(CACHE_HIT, 1);
+        assert_eq!(finish(), None);
+    }
+}
@@ -0,0 +1,220 @@
+//! Opt-in, anonymous performance telemetry.
+//!
+//! Nothing is recorded unless `telemetry.enabled = true`, and nothing leaves
+//! the machine unless an endpoint is configured as well. Only aggregate
+//! counters are kept: feature usage counts, phase durations, and repository
+//! size buckets. Names come from `&'static str` call sites, so paths, symbol
+//! names, or queries cannot end up in a report. The pending report lives in
+//! `<data_dir>/telemetry.json`; `cruxe telemetry show` prints it verbatim.
+
+use crate::config::Config;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+
+pub const TELEMETRY_FILE: &str = "telemetry.json";
+pub const REPORT_VERSION: u32 = 1;
+
+/// Aggregate duration of one instrumented phase.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PhaseStats {
+    pub count: u64,
+    pub total_ms: u64,
+    pub max_ms: u64,
+}
+
+/// The exact payload sent to the collector.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TelemetryReport {
+    pub report_version: u32,
+    pub cruxe_version: String,
+    pub os: String,
+    pub arch: String,
+    #[serde(default)]
+    pub features: BTreeMap<String, u64>,
+    #[serde(default)]
+    pub phases: BTreeMap<String, PhaseStats>,
+    /// Index runs per repository size bucket (file count).
+    #[serde(default)]
+    pub repo_sizes: BTreeMap<String, u64>,
+}
+
+impl Default for TelemetryReport {
+    fn default() -> Self {
+        Self {
+            report_version: REPORT_VERSION,
+            cruxe_version: env!("CARGO_PKG_VERSION").to_string(),
+            os: std::env::consts::OS.to_string(),
+            arch: std::env::consts::ARCH.to_string(),
+            features: BTreeMap::new(),
+            phases: BTreeMap::new(),
+            repo_sizes: BTreeMap::new(),
+        }
+    }
+}
+
+impl TelemetryReport {
+    pub fn is_empty(&self) -> bool {
+        self.features.is_empty() && self.phases.is_empty() && self.repo_sizes.is_empty()
+    }
+
+    fn merge(&mut self, other: &TelemetryReport) {
+        for (name, count) in &other.features {
+            *self.features.entry(name.clone()).or_default() += count;
+        }
+        for (name, stats) in &other.phases {
+            let entry = self.phases.entry(name.clone()).or_default();
+            entry.count += stats.count;
+            entry.total_ms += stats.total_ms;
+            entry.max_ms = entry.max_ms.max(stats.max_ms);
+        }
+        for (bucket, count) in &other.repo_sizes {
+            *self.repo_sizes.entry(bucket.clone()).or_default() += count;
+        }
+    }
+}
+
+/// Locally stored state: the pending report plus upload bookkeeping, which is
+/// never part of the payload.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct StoredTelemetry {
+    #[serde(default)]
+    pub last_sent_unix: Option<u64>,
+    #[serde(default)]
+    pub report: TelemetryReport,
+}
+
+pub fn telemetry_path(config: &Config) -> PathBuf {
+    PathBuf::from(&config.storage.data_dir).join(TELEMETRY_FILE)
+}
+
+/// Load the stored telemetry; a missing or unreadable file starts fresh.
+pub fn load(path: &Path) -> StoredTelemetry {
+    std::fs::read(path)
+        .ok()
+        .and_then(|bytes| serde_json::from_slice(&bytes).ok())
+        .unwrap_or_default()
+}
+
+pub fn save(path: &Path, stored: &StoredTelemetry) -> std::io::Result<()> {
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)?;
+    }
+    let payload = serde_json::to_vec_pretty(stored).map_err(std::io::Error::other)?;
+    let tmp = path.with_extension("json.tmp");
+    std::fs::write(&tmp, payload)?;
+    std::fs::rename(&tmp, path)
+}
+
+/// Coarse repository size bucket by indexed file count.
+pub fn repo_size_bucket(files: u64) -> &'static str {
+    match files {
+        0..100 => "<100",
+        100..1_000 => "100-1k",
+        1_000..10_000 => "1k-10k",
+        10_000..100_000 => "10k-100k",
+        _ => ">=100k",
+    }
+}
+
+/// Collects counters for one process and merges them into the stored report
+/// on [`Recorder::flush`]. Only constructed when telemetry is enabled.
+#[derive(Debug)]
+pub struct Recorder {
+    path: PathBuf,
+    pending: TelemetryReport,
+}
+
+impl Recorder {
+    pub fn from_config(config: &Config) -> Option<Self> {
+        config.telemetry.enabled.then(|| Self {
+            path: telemetry_path(config),
+            pending: TelemetryReport::default(),
+        })
+    }
+
+    pub fn feature(&mut self, name: &'static str) {
+        *self.pending.features.entry(name.to_string()).or_default() += 1;
+    }
+
+    pub fn phase(&mut self, name: &'static str, elapsed: Duration) {
+        let ms = elapsed.as_millis() as u64;
+        let entry = self.pending.phases.entry(name.to_string()).or_default();
+        entry.count += 1;
+        entry.total_ms += ms;
+        entry.max_ms = entry.max_ms.max(ms);
+    }
+
+    pub fn repo_size(&mut self, files: u64) {
+        *self
+            .pending
+            .repo_sizes
+            .entry(repo_size_bucket(files).to_string())
+            .or_default() += 1;
+    }
+
+    /// Merge the counters into the stored report. Best effort: telemetry
+    /// must never fail a command, so errors are only logged.
+    pub fn flush(self) {
+        if self.pending.is_empty() {
+            return;
+        }
+        let mut stored = load(&self.path);
+        stored.report.merge(&self.pending);
+        if let Err(err) = save(&self.path, &stored) {
+            tracing::debug!(error = %err, "Failed to persist telemetry");
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn enabled_config(dir: &Path) -> Config {
+        let mut config = Config::default();
+        config.storage.data_dir = dir.to_string_lossy().to_string();
+        config.telemetry.enabled = true;
+        config
+    }
+
+    #[test]
+    fn recorder_is_off_by_default() {
+        assert!(Recorder::from_config(&Config::default()).is_none());
+    }
+
+    #[test]
+    fn flush_accumulates_across_runs() {
+        let tmp = tempfile::tempdir().unwrap();
+        let config = enabled_config(tmp.path());
+        for ms in [30, 10] {
+            let mut recorder = Recorder::from_config(&config).unwrap();
+            recorder.feature("index");
+            recorder.phase("index.scan", Duration::from_millis(ms));
+            recorder.repo_size(2_500);
+            recorder.flush();
+        }
+
+        let stored = load(&telemetry_path(&config));
+        assert_eq!(stored.report.features["index"], 2);
+        assert_eq!(
+            stored.report.phases["index.scan"],
+            PhaseStats {
+                count: 2,
+                total_ms: 40,
+                max_ms: 30
+            }
+        );
+        assert_eq!(stored.report.repo_sizes["1k-10k"], 2);
+        assert_eq!(stored.report.report_version, REPORT_VERSION);
+    }
+
+    #[test]
+    fn repo_size_buckets_are_coarse() {
+        assert_eq!(repo_size_bucket(0), "<100");
+        assert_eq!(repo_size_bucket(100), "100-1k");
+        assert_eq!(repo_size_bucket(99_999), "10k-100k");
+        assert_eq!(repo_size_bucket(5_000_000), ">=100k");
+    }
+}
@@ -1,3 +1,4 @@
+use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::path::{Path, PathBuf};
 use std::str::FromStr;
@@ -152,6 +153,13 @@ pub struct SymbolRecord {
     pub content: Option<String>,
 }
 
+/// Name of a symbol synthesized for an anonymous struct or inline interface
+/// type, which is named by its members: `struct{Host,Port}`,
+/// `interface{Close}`.
+pub fn is_anonymous_type_name(name: &str) -> bool {
+    name.starts_with("struct{") || name.starts_with("interface{")
+}
+
 /// A code snippet (function body, class body) for full-text search.
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct SnippetRecord {
@@ -171,6 +179,24 @@ pub struct SnippetRecord {
     pub content: String,
 }
 
+/// A finding a `[plugins]` analyzer reported on a file, kept with the file's
+/// other artifacts until it is indexed again.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PluginFindingRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub plugin: String,
+    /// The plugin's own rule id, without the `plugin/<name>/` prefix.
+    pub rule: String,
+    /// `info`, `warning` or `error` as the plugin sent it.
+    pub severity: String,
+    pub line: u32,
+    /// Qualified name of the symbol the finding is about; may be empty.
+    pub symbol: String,
+    pub message: String,
+}
+
 /// A source file record.
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct FileRecord {
@@ -201,7 +227,7 @@ pub struct SymbolEdge {
 ///
 /// `to_symbol_id` is `None` when the callee cannot be resolved to an indexed symbol.
 /// In that case `to_name` carries the best-effort callee text from the call site.
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
 pub struct CallEdge {
     pub repo: String,
     pub ref_name: String,
@@ -214,6 +240,278 @@ pub struct CallEdge {
     pub source_line: u32,
 }
 
+/// A string literal whose content is code in another language (SQL, HTML,
+/// regex), with the result of checking it with that language's parser.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct InjectionRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub line: u32,
+    /// Embedded language: `sql`, `html` or `regex`.
+    pub language: String,
+    /// Callee the literal is passed to, e.g. `db.QueryContext`, when known.
+    pub host: Option<String>,
+    /// Enclosing function or method.
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+    pub content: String,
+    /// Tables a SQL statement reads or writes.
+    pub tables: Vec<String>,
+    /// Syntax problem reported by the embedded language's parser.
+    pub error: Option<String>,
+}
+
+/// A named Go text/html template: a template file, or a `define` or `block`
+/// inside one, with the data fields its actions reference.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct TemplateRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub name: String,
+    /// `file`, `define`, `block` or `inline` (parsed from a Go string).
+    pub kind: String,
+    pub line: u32,
+    pub fields: Vec<TemplateFieldRef>,
+    pub calls: Vec<TemplateCall>,
+}
+
+/// A field chain such as `.User.Name`, relative to the data the template is
+/// executed with. A `[]` step is an element of a ranged-over value.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct TemplateFieldRef {
+    pub line: u32,
+    pub chain: Vec<String>,
+}
+
+/// A `{{template "name" pipeline}}` (or `block`) invocation.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct TemplateCall {
+    pub name: String,
+    pub line: u32,
+    /// Field chain passed as the callee's data; `None` when nothing or
+    /// something other than a field chain is passed.
+    pub arg: Option<Vec<String>>,
+}
+
+/// A TODO, FIXME or HACK comment, or a deprecation notice, attached to the
+/// symbol it sits in or documents.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct TodoRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub line: u32,
+    /// `todo`, `fixme`, `hack` or `deprecated`.
+    pub marker: String,
+    /// Comment text after the marker.
+    pub text: String,
+    /// Name in `TODO(name)`, when given.
+    pub assignee: Option<String>,
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+}
+
+/// Lines of a file tree-sitter could not parse. Extraction recovers around
+/// them, so the rest of the file is still indexed.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct ParseErrorRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub start_line: u32,
+    pub end_line: u32,
+    /// `syntax` (text that fits no rule), `missing` (an expected token is
+    /// absent) or `unparsed` (the parser gave up on the whole file).
+    pub kind: String,
+}
+
+/// Why a file in scope was left out of the index.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum SkipReason {
+    /// Larger than `[index] max_file_size`.
+    TooLarge,
+    /// A line longer than `[index] max_line_length`, as in minified bundles.
+    LongLines,
+    /// Binary content.
+    Binary,
+    /// The file could not be read, or is not UTF-8.
+    Unreadable,
+}
+
+impl SkipReason {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::TooLarge => "too_large",
+            Self::LongLines => "long_lines",
+            Self::Binary => "binary",
+            Self::Unreadable => "unreadable",
+        }
+    }
+
+    /// Code of the warning logged for a file skipped for this reason.
+    pub fn log_code(&self) -> crate::error::LogCode {
+        use crate::error::LogCode;
+        match self {
+            Self::TooLarge => LogCode::FileTooLarge,
+            Self::LongLines => LogCode::LineTooLong,
+            Self::Binary => LogCode::BinaryFile,
+            Self::Unreadable => LogCode::ReadFailed,
+        }
+    }
+}
+
+impl std::fmt::Display for SkipReason {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+impl FromStr for SkipReason {
+    type Err = ();
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "too_large" => Ok(Self::TooLarge),
+            "long_lines" => Ok(Self::LongLines),
+            "binary" => Ok(Self::Binary),
+            "unreadable" => Ok(Self::Unreadable),
+            _ => Err(()),
+        }
+    }
+}
+
+/// A file in scope that an index run left out, and why.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct SkippedFileRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub reason: SkipReason,
+    /// What tripped the limit, e.g. `line of 48213 bytes`.
+    pub detail: String,
+}
+
+/// A goroutine launch, channel, mutex or WaitGroup in Go code, attached to
+/// the function or field it belongs to.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct ConcurrencyRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub line: u32,
+    /// `goroutine`, `channel`, `mutex` or `waitgroup`.
+    pub kind: String,
+    /// What was found: `go s.serve`, `make(chan Job, 16)`, `mu sync.RWMutex`.
+    pub detail: String,
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+}
+
+/// An HTTP route registered in Go code, with the handler it is bound to as
+/// written at the registration.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct RouteRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub line: u32,
+    /// `GET`, `POST`, ..., or `*` when any method matches.
+    pub method: String,
+    /// Path pattern with group prefixes applied: `/api/v1/users/{id}`.
+    pub route: String,
+    /// Handler expression: `h.listUsers`, `handlers.Health`.
+    pub handler: String,
+    /// `net/http`, `chi`, `gin`, `echo`, `gorilla` or `switch`.
+    pub framework: String,
+    /// The function making the registration.
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+}
+
+/// A parameter or local variable and every occurrence the language's scope
+/// rules bind to it.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct LocalRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub name: String,
+    /// `parameter` or `local`.
+    pub kind: String,
+    /// Where it is declared, 1-based; `column` counts characters.
+    pub line: u32,
+    pub column: u32,
+    /// The function declaring it.
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+    /// Every occurrence in source order, the declaration included.
+    pub uses: Vec<LocalUse>,
+}
+
+/// One occurrence of a [`LocalRecord`].
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq)]
+pub struct LocalUse {
+    pub line: u32,
+    pub column: u32,
+    /// Assigned (or declared) here rather than read.
+    #[serde(default)]
+    pub write: bool,
+}
+
+/// The value of a constant, or a notable string literal in code (a route,
+/// an environment variable name, an error code, a URL), attached to the
+/// symbol it appears in.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct LiteralRecord {
+    pub repo: String,
+    pub r#ref: String,
+    pub path: String,
+    pub line: u32,
+    /// The value without quotes: `/api/user`, `JWT_SECRET`, `30`.
+    pub value: String,
+    /// `route`, `env`, `code`, `url` or `constant`.
+    pub kind: String,
+    /// The literal is the value of the constant `symbol` declares.
+    #[serde(default)]
+    pub defines: bool,
+    pub symbol_id: Option<String>,
+    pub symbol: Option<String>,
+}
+
+/// A `//go:embed` directive and, once resolved against the working tree,
+/// the files its patterns capture.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct EmbedRecord {
+    pub repo: String,
+    pub r#ref: String,
+    /// Go file holding the directive.
+    pub path: String,
+    pub line: u32,
+    /// Variable the files are embedded into.
+    pub variable: String,
+    pub patterns: Vec<String>,
+    pub files: Vec<EmbeddedFile>,
+    /// Patterns that match no file; `go build` rejects these.
+    pub missing: Vec<String>,
+    /// The variable is handed to a file server or walked as a whole, so its
+    /// files are not expected to be referenced by name.
+    pub served: bool,
+}
+
+/// A file captured by a `//go:embed` directive.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct EmbeddedFile {
+    /// Repo-relative path.
+    pub path: String,
+    pub size: u64,
+    /// Named by the directive itself, or its file name appears in the
+    /// package's Go sources or in another embedded text file.
+    pub referenced: bool,
+}
+
 /// Detail level for response verbosity control.
 /// Controls how many fields are included in search/locate results.
 #[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize, Deserialize)]
@@ -313,6 +611,90 @@ impl FromStr for PolicyMode {
     }
 }
 
+/// How much of third-party dependency code is indexed.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum DependencyMode {
+    /// Dependencies are skipped entirely.
+    #[default]
+    None,
+    /// Symbols, signatures and doc comments, without bodies.
+    Signatures,
+    /// Indexed like the project's own code.
+    Full,
+}
+
+impl DependencyMode {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::None => "none",
+            Self::Signatures => "signatures",
+            Self::Full => "full",
+        }
+    }
+}
+
+impl std::fmt::Display for DependencyMode {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+impl FromStr for DependencyMode {
+    type Err = ();
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.trim().to_ascii_lowercase().as_str() {
+            "none" | "off" => Ok(Self::None),
+            "signatures" | "signatures_only" | "skeleton" => Ok(Self::Signatures),
+            "full" => Ok(Self::Full),
+            _ => Err(()),
+        }
+    }
+}
+
+/// How the scanner treats symbolic links to files and directories.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum SymlinkPolicy {
+    /// Symlinks are never indexed or entered.
+    Skip,
+    /// Every symlink is followed, wherever it leads.
+    Follow,
+    /// Symlinks are followed when they lead inside the repository.
+    #[default]
+    FollowWithinRoot,
+}
+
+impl SymlinkPolicy {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Skip => "skip",
+            Self::Follow => "follow",
+            Self::FollowWithinRoot => "follow-within-root",
+        }
+    }
+}
+
+impl std::fmt::Display for SymlinkPolicy {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+impl FromStr for SymlinkPolicy {
+    type Err = ();
+
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.trim().to_ascii_lowercase().replace('_', "-").as_str() {
+            "skip" | "none" | "off" => Ok(Self::Skip),
+            "follow" | "all" => Ok(Self::Follow),
+            "follow-within-root" | "within-root" => Ok(Self::FollowWithinRoot),
+            _ => Err(()),
+        }
+    }
+}
+
 /// Composite confidence guidance payload for search responses.
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct ConfidenceGuidance {
@@ -334,7 +716,7 @@ pub struct RerankResult {
 }
 
 /// Per-signal ranking contribution accounting.
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, JsonSchema)]
 pub struct RankingSignalContribution {
     pub signal: String,
     pub raw_value: f64,
@@ -343,7 +725,7 @@ pub struct RankingSignalContribution {
 }
 
 /// Additive precedence-audit payload for full explainability mode.
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, JsonSchema)]
 pub struct RankingPrecedenceAudit {
     pub lexical_dominance_applied: bool,
     pub exact_match_present: bool,
@@ -352,7 +734,7 @@ pub struct RankingPrecedenceAudit {
 }
 
 /// Per-result ranking explanation for debug mode.
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct RankingReasons {
     pub result_index: usize,
     #[serde(default)]
@@ -401,7 +783,7 @@ pub struct BasicRankingReasons {
 }
 
 /// Query intent classification.
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
 #[serde(rename_all = "snake_case")]
 pub enum QueryIntent {
     Symbol,
@@ -508,7 +890,7 @@ impl OverlayMergeKey {
 }
 
 /// Origin of a VCS-mode query result.
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
 #[serde(rename_all = "snake_case")]
 pub enum SourceLayer {
     Base,
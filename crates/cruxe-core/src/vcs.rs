@@ -65,6 +65,57 @@ pub fn detect_head_commit(repo_root: &Path) -> Result<String, VcsError> {
     Ok(oid[..12].to_string())
 }
 
+/// Full hashes of HEAD and its ancestors, newest first, at most `limit`.
+pub fn list_ancestor_commits(repo_root: &Path, limit: usize) -> Result<Vec<String>, VcsError> {
+    let repo = git2::Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+        path: repo_root.display().to_string(),
+    })?;
+    let mut walk = repo
+        .revwalk()
+        .map_err(|e| VcsError::GitError(format!("Failed to walk history: {}", e)))?;
+    walk.set_sorting(git2::Sort::TOPOLOGICAL | git2::Sort::TIME)
+        .map_err(|e| VcsError::GitError(format!("Failed to walk history: {}", e)))?;
+    walk.push_head()
+        .map_err(|e| VcsError::GitError(format!("Failed to read HEAD: {}", e)))?;
+    walk.take(limit)
+        .map(|oid| {
+            oid.map(|oid| oid.to_string())
+                .map_err(|e| VcsError::GitError(format!("Failed to walk history: {}", e)))
+        })
+        .collect()
+}
+
+/// Repository name (`host/path`, as Sourcegraph names repositories) of the
+/// `origin` remote, or `None` when there is no such remote.
+pub fn origin_repository_name(repo_root: &Path) -> Result<Option<String>, VcsError> {
+    let repo = git2::Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+        path: repo_root.display().to_string(),
+    })?;
+    let Ok(remote) = repo.find_remote("origin") else {
+        return Ok(None);
+    };
+    Ok(remote.url().and_then(repository_name_from_url))
+}
+
+/// `github.com/org/repo` for `https://github.com/org/repo.git`,
+/// `git@github.com:org/repo.git` and `ssh://git@github.com/org/repo`.
+pub fn repository_name_from_url(url: &str) -> Option<String> {
+    let url = url.trim().trim_end_matches('/');
+    let url = url.strip_suffix(".git").unwrap_or(url);
+    let (host, path) = match url.split_once("://") {
+        Some((_, rest)) => rest.split_once('/')?,
+        // scp-like syntax: [user@]host:path
+        None => url.split_once(':')?,
+    };
+    let host = host.rsplit('@').next()?;
+    let host = host.split(':').next()?;
+    let path = path.trim_matches('/');
+    if host.is_empty() || path.is_empty() {
+        return None;
+    }
+    Some(format!("{host}/{path}"))
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -95,4 +146,25 @@ mod tests {
             "feature/x"
         );
     }
+
+    #[test]
+    fn test_list_ancestor_commits_fails_on_non_repo() {
+        let dir = tempfile::tempdir().unwrap();
+        assert!(list_ancestor_commits(dir.path(), 10).is_err());
+    }
+
+    #[test]
+    fn test_repository_name_from_url() {
+        for url in [
+            "https://github.com/acme/api.git",
+            "git@github.com:acme/api.git",
+            "ssh://git@github.com:22/acme/api/",
+        ] {
+            assert_eq!(
+                repository_name_from_url(url).as_deref(),
+                Some("github.com/acme/api")
+            );
+        }
+        assert_eq!(repository_name_from_url("/srv/repos/api"), None);
+    }
 }
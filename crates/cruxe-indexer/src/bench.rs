@@ -0,0 +1,388 @@
+//! `cruxe bench`: time the indexing phases per language on a source tree.
+//!
+//! Every file is parsed, stored and resolved single-threaded into a scratch
+//! index, so the numbers measure cruxe rather than the machine's core count
+//! and stay comparable between runs. With several iterations the fastest run
+//! of each phase counts. A report saved as a baseline can be compared with a
+//! later one to catch throughput or memory regressions before a release.
+
+use crate::{call_extract, prepare, scanner, writer};
+use cruxe_core::error::StateError;
+use cruxe_state::{db, schema, tantivy_index::IndexSet};
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::Path;
+use std::time::Instant;
+
+const BENCH_REPO: &str = "bench";
+const BENCH_REF: &str = "bench";
+
+/// Phase times and throughput of one language, or of all of them.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize, JsonSchema)]
+pub struct PhaseTimings {
+    pub files: u64,
+    pub loc: u64,
+    /// Reading and parsing files, extracting symbols, snippets and edges.
+    pub parse_ms: f64,
+    /// Resolving imports and call targets against the stored symbols.
+    pub resolve_ms: f64,
+    /// Writing SQLite rows and Tantivy documents, including the commit.
+    pub store_ms: f64,
+    pub files_per_sec: f64,
+    pub loc_per_sec: f64,
+}
+
+impl PhaseTimings {
+    pub fn total_ms(&self) -> f64 {
+        self.parse_ms + self.resolve_ms + self.store_ms
+    }
+
+    fn keep_fastest(&mut self, other: &PhaseTimings) {
+        self.parse_ms = self.parse_ms.min(other.parse_ms);
+        self.resolve_ms = self.resolve_ms.min(other.resolve_ms);
+        self.store_ms = self.store_ms.min(other.store_ms);
+    }
+
+    fn compute_throughput(&mut self) {
+        let secs = self.total_ms() / 1000.0;
+        if secs > 0.0 {
+            self.files_per_sec = self.files as f64 / secs;
+            self.loc_per_sec = self.loc as f64 / secs;
+        }
+    }
+}
+
+/// What `cruxe bench` prints and saves as a baseline.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize, JsonSchema)]
+pub struct BenchReport {
+    pub cruxe_version: String,
+    pub iterations: u32,
+    pub languages: BTreeMap<String, PhaseTimings>,
+    pub total: PhaseTimings,
+    /// Peak resident set size of the process; `None` where the platform
+    /// does not report it.
+    pub peak_rss_bytes: Option<u64>,
+}
+
+/// Index every file under `root` in `languages` into `scratch_dir`
+/// `iterations` times and report the fastest time of each phase.
+pub fn run(
+    root: &Path,
+    languages: &[String],
+    max_file_size: u64,
+    iterations: u32,
+    scratch_dir: &Path,
+) -> Result<BenchReport, StateError> {
+    let files = scanner::scan_directory_filtered(root, max_file_size, languages);
+    let iterations = iterations.max(1);
+    let mut best: Option<(BTreeMap<String, PhaseTimings>, PhaseTimings)> = None;
+    for iteration in 0..iterations {
+        let run_dir = scratch_dir.join(format!("run-{iteration}"));
+        let (by_language, total) = run_once(&files, &run_dir)?;
+        let _ = std::fs::remove_dir_all(&run_dir);
+        match best.as_mut() {
+            None => best = Some((by_language, total)),
+            Some((best_languages, best_total)) => {
+                for (language, timings) in &by_language {
+                    if let Some(kept) = best_languages.get_mut(language) {
+                        kept.keep_fastest(timings);
+                    }
+                }
+                best_total.keep_fastest(&total);
+            }
+        }
+    }
+    let (mut languages, mut total) = best.unwrap_or_default();
+    for timings in languages.values_mut() {
+        timings.compute_throughput();
+    }
+    total.compute_throughput();
+    Ok(BenchReport {
+        cruxe_version: env!("CARGO_PKG_VERSION").to_string(),
+        iterations,
+        languages,
+        total,
+        peak_rss_bytes: cruxe_core::stats::peak_memory_bytes(),
+    })
+}
+
+struct ParsedFile {
+    artifacts: prepare::SourceArtifacts,
+    record: cruxe_core::types::FileRecord,
+}
+
+fn run_once(
+    files: &[scanner::ScannedFile],
+    run_dir: &Path,
+) -> Result<(BTreeMap<String, PhaseTimings>, PhaseTimings), StateError> {
+    let conn = db::open_connection(&run_dir.join("state.db"))?;
+    schema::create_tables(&conn)?;
+    let index_set = IndexSet::open(run_dir)?;
+
+    let mut by_language: BTreeMap<String, Vec<&scanner::ScannedFile>> = BTreeMap::new();
+    for file in files {
+        by_language
+            .entry(file.language.clone())
+            .or_default()
+            .push(file);
+    }
+
+    let mut timings: BTreeMap<String, PhaseTimings> = BTreeMap::new();
+    let mut total = PhaseTimings::default();
+    let mut pending: BTreeMap<String, Vec<ParsedFile>> = BTreeMap::new();
+    for (language, language_files) in &by_language {
+        let entry = timings.entry(language.clone()).or_default();
+
+        let started = Instant::now();
+        let mut parsed = Vec::with_capacity(language_files.len());
+        for file in language_files {
+            let Ok(content) = std::fs::read_to_string(&file.path) else {
+                continue;
+            };
+            entry.files += 1;
+            entry.loc += content.lines().count() as u64;
+            let artifacts = prepare::build_source_artifacts(
+                &content,
+                language,
+                &file.relative_path,
+                BENCH_REPO,
+                BENCH_REF,
+                None,
+                true,
+                true,
+            );
+            let filename = file
+                .path
+                .file_name()
+                .map(|name| name.to_string_lossy().to_string())
+                .unwrap_or_default();
+            let record = prepare::build_file_record(
+                BENCH_REPO,
+                BENCH_REF,
+                &file.relative_path,
+                &filename,
+                language,
+                &content,
+            );
+            parsed.push(ParsedFile { artifacts, record });
+        }
+        entry.parse_ms = elapsed_ms(started);
+
+        let started = Instant::now();
+        let batch = writer::BatchWriter::new(&index_set)?;
+        for file in &parsed {
+            batch.add_symbols(&index_set.symbols, &file.artifacts.symbols)?;
+            batch.add_snippets(&index_set.snippets, &file.artifacts.snippets)?;
+            batch.add_file(&index_set.files, &file.record)?;
+            batch.write_sqlite(&conn, &file.artifacts.symbols, &file.record, None)?;
+        }
+        batch.commit()?;
+        entry.store_ms = elapsed_ms(started);
+        pending.insert(language.clone(), parsed);
+    }
+
+    // Call targets resolve against every stored symbol, so this runs once all
+    // languages are written; loading the lookup counts toward the total only.
+    let started = Instant::now();
+    let lookup = call_extract::load_symbol_lookup(&conn, BENCH_REPO, BENCH_REF)?;
+    total.resolve_ms = elapsed_ms(started);
+    for (language, parsed) in pending {
+        let started = Instant::now();
+        let mut call_edges = Vec::with_capacity(parsed.len());
+        for file in parsed {
+            writer::replace_import_edges_for_file(
+                &conn,
+                BENCH_REPO,
+                BENCH_REF,
+                &file.record.path,
+                file.artifacts.raw_imports,
+            )?;
+            let mut edges = file.artifacts.call_edges;
+            call_extract::resolve_call_targets_with_lookup(&lookup, &mut edges);
+            call_edges.push((file.record.path, edges));
+        }
+        writer::replace_call_edges_for_files(&conn, BENCH_REPO, BENCH_REF, call_edges)?;
+        if let Some(entry) = timings.get_mut(&language) {
+            entry.resolve_ms = elapsed_ms(started);
+        }
+    }
+
+    for entry in timings.values() {
+        total.files += entry.files;
+        total.loc += entry.loc;
+        total.parse_ms += entry.parse_ms;
+        total.resolve_ms += entry.resolve_ms;
+        total.store_ms += entry.store_ms;
+    }
+    Ok((timings, total))
+}
+
+fn elapsed_ms(started: Instant) -> f64 {
+    started.elapsed().as_secs_f64() * 1000.0
+}
+
+/// One metric of a language (or `total`) against the baseline.
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct BenchDelta {
+    pub scope: String,
+    pub metric: &'static str,
+    pub baseline: f64,
+    pub current: f64,
+    /// Signed change relative to the baseline, in percent.
+    pub change_pct: f64,
+    /// Worse than the baseline by more than the allowed percentage.
+    pub regressed: bool,
+}
+
+/// Throughput of every language in both reports, and peak RSS, against the
+/// baseline. Throughput regresses when it drops, memory when it grows, by
+/// more than `max_regression_pct`.
+pub fn compare(
+    baseline: &BenchReport,
+    current: &BenchReport,
+    max_regression_pct: f64,
+) -> Vec<BenchDelta> {
+    let mut deltas = Vec::new();
+    let scopes = current
+        .languages
+        .iter()
+        .filter_map(|(language, timings)| {
+            baseline
+                .languages
+                .get(language)
+                .map(|before| (language.as_str(), before, timings))
+        })
+        .chain(std::iter::once(("total", &baseline.total, &current.total)));
+    for (scope, before, after) in scopes {
+        for (metric, old, new) in [
+            ("files_per_sec", before.files_per_sec, after.files_per_sec),
+            ("loc_per_sec", before.loc_per_sec, after.loc_per_sec),
+        ] {
+            deltas.push(delta(scope, metric, old, new, -max_regression_pct));
+        }
+    }
+    if let (Some(old), Some(new)) = (baseline.peak_rss_bytes, current.peak_rss_bytes) {
+        deltas.push(delta(
+            "total",
+            "peak_rss_bytes",
+            old as f64,
+            new as f64,
+            max_regression_pct,
+        ));
+    }
+    deltas
+}
+
+/// `limit_pct` is signed: negative for metrics where lower is worse.
+fn delta(
+    scope: &str,
+    metric: &'static str,
+    baseline: f64,
+    current: f64,
+    limit_pct: f64,
+) -> BenchDelta {
+    let change_pct = if baseline > 0.0 {
+        (current - baseline) / baseline * 100.0
+    } else {
+        0.0
+    };
+    let regressed = if limit_pct < 0.0 {
+        change_pct < limit_pct
+    } else {
+        change_pct > limit_pct
+    };
+    BenchDelta {
+        scope: scope.to_string(),
+        metric,
+        baseline,
+        current,
+        change_pct,
+        regressed,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    #[test]
+    fn reports_every_phase_per_language() {
+        let repo = tempdir().unwrap();
+        std::fs::write(
+            repo.path().join("main.go"),
+            "package main\n\nfunc helper() int {\n\treturn 1\n}\n\nfunc main() {\n\thelper()\n}\n",
+        )
+        .unwrap();
+        std::fs::write(
+            repo.path().join("util.py"),
+            "def helper():\n    return 1\n\n\ndef run():\n    return helper()\n",
+        )
+        .unwrap();
+        let scratch = tempdir().unwrap();
+
+        let report = run(
+            repo.path(),
+            &["go".to_string(), "python".to_string()],
+            1_048_576,
+            2,
+            scratch.path(),
+        )
+        .unwrap();
+        assert_eq!(report.iterations, 2);
+        assert_eq!(
+            report.languages.keys().collect::<Vec<_>>(),
+            ["go", "python"]
+        );
+        assert_eq!(report.languages["go"].files, 1);
+        assert_eq!(report.languages["go"].loc, 9);
+        assert_eq!(report.total.files, 2);
+        assert_eq!(report.total.loc, 15);
+        assert!(report.total.parse_ms > 0.0 && report.total.store_ms > 0.0);
+        assert!(report.total.files_per_sec > 0.0);
+        assert_eq!(std::fs::read_dir(scratch.path()).unwrap().count(), 0);
+    }
+
+    #[test]
+    fn regressions_beyond_the_threshold_are_flagged() {
+        let report = |files_per_sec, peak_rss_bytes| BenchReport {
+            cruxe_version: "0.0.0".to_string(),
+            iterations: 1,
+            languages: BTreeMap::from([(
+                "go".to_string(),
+                PhaseTimings {
+                    files_per_sec,
+                    loc_per_sec: 1000.0,
+                    ..PhaseTimings::default()
+                },
+            )]),
+            total: PhaseTimings {
+                files_per_sec,
+                loc_per_sec: 1000.0,
+                ..PhaseTimings::default()
+            },
+            peak_rss_bytes: Some(peak_rss_bytes),
+        };
+        let deltas = compare(&report(100.0, 1000), &report(85.0, 1050), 10.0);
+        let flagged: Vec<(&str, &str)> = deltas
+            .iter()
+            .filter(|delta| delta.regressed)
+            .map(|delta| (delta.scope.as_str(), delta.metric))
+            .collect();
+        assert_eq!(
+            flagged,
+            [("go", "files_per_sec"), ("total", "files_per_sec")]
+        );
+        assert_eq!(deltas.len(), 5);
+        assert!((deltas[0].change_pct + 15.0).abs() < 1e-9);
+
+        let deltas = compare(&report(100.0, 1000), &report(120.0, 1200), 10.0);
+        let flagged: Vec<&str> = deltas
+            .iter()
+            .filter(|delta| delta.regressed)
+            .map(|delta| delta.metric)
+            .collect();
+        assert_eq!(flagged, ["peak_rss_bytes"]);
+    }
+}
@@ -0,0 +1,270 @@
+//! Encoding of [`SourceArtifacts`] for the blob cache
+//! (`cruxe_state::blob_artifacts`), so a file version extracted for one ref
+//! is reused by the others instead of being parsed again.
+//!
+//! Records carry their repo and ref, and symbol ids hash both, so cached
+//! artifacts are retargeted on the way out: every id of a symbol of the file
+//! is recomputed for the new ref and replaced wherever it appears.
+
+use crate::import_extract::RawImport;
+use crate::prepare::SourceArtifacts;
+use cruxe_core::config::StorageConfig;
+use cruxe_core::types::{
+    CallEdge, ConcurrencyRecord, EmbedRecord, InjectionRecord, LiteralRecord, LocalRecord,
+    ParseErrorRecord, RouteRecord, SnippetRecord, SymbolRecord, TodoRecord, compute_symbol_id,
+};
+use cruxe_state::artifact::{self, ArtifactWriter};
+use cruxe_state::{blob_artifacts, db};
+use rusqlite::Connection;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::io::Write;
+use std::path::{Path, PathBuf};
+
+thread_local! {
+    // Indexing workers read the cache on connections of their own while the
+    // writer thread keeps the main one.
+    static READER: RefCell<Option<(PathBuf, Connection)>> = const { RefCell::new(None) };
+}
+
+/// Cached artifacts lookup for indexing workers.
+#[derive(Debug, Clone, Copy)]
+pub struct BlobCacheReader<'a> {
+    pub db_path: &'a Path,
+    pub storage: &'a StorageConfig,
+    pub repo: &'a str,
+    pub ref_name: &'a str,
+}
+
+impl BlobCacheReader<'_> {
+    /// Artifacts of `path` at `content_hash` some ref of the repo already
+    /// extracted, retargeted to this reader's ref; `None` on a miss.
+    pub fn lookup(
+        &self,
+        path: &str,
+        content_hash: &str,
+        language: &str,
+        bodies: bool,
+        generated: Option<&'static str>,
+    ) -> Option<SourceArtifacts> {
+        let entry = READER.with(|cell| {
+            let mut slot = cell.borrow_mut();
+            if slot
+                .as_ref()
+                .is_none_or(|(db_path, _)| db_path != self.db_path)
+            {
+                let conn = db::open_read_only(
+                    self.db_path,
+                    self.storage.busy_timeout_ms,
+                    self.storage.cache_size,
+                    self.storage.mmap_size,
+                )
+                .ok()?;
+                *slot = Some((self.db_path.to_path_buf(), conn));
+            }
+            let (_, conn) = slot.as_ref()?;
+            blob_artifacts::get(conn, self.repo, path, content_hash, language, bodies)
+                .ok()
+                .flatten()
+        })?;
+        decode(&entry.artifacts, self.repo, self.ref_name, generated)
+    }
+}
+
+/// Everything in [`SourceArtifacts`] but the generated-code mark, which is
+/// cheap to recompute and not serializable.
+#[derive(Serialize, Deserialize)]
+struct CachedArtifacts {
+    /// Version of cruxe that extracted them; entries of other versions are
+    /// ignored, as extraction may have changed.
+    version: String,
+    symbols: Vec<SymbolRecord>,
+    snippets: Vec<SnippetRecord>,
+    call_edges: Vec<CallEdge>,
+    raw_imports: Vec<RawImport>,
+    injections: Vec<InjectionRecord>,
+    embeds: Vec<EmbedRecord>,
+    todos: Vec<TodoRecord>,
+    concurrency: Vec<ConcurrencyRecord>,
+    routes: Vec<RouteRecord>,
+    locals: Vec<LocalRecord>,
+    literals: Vec<LiteralRecord>,
+    parse_error: Option<String>,
+    parse_errors: Vec<ParseErrorRecord>,
+}
+
+/// Compressed JSON of `artifacts`; `None` if it cannot be encoded.
+pub fn encode(artifacts: &SourceArtifacts) -> Option<Vec<u8>> {
+    let cached = CachedArtifacts {
+        version: env!("CARGO_PKG_VERSION").to_string(),
+        symbols: artifacts.symbols.clone(),
+        snippets: artifacts.snippets.clone(),
+        call_edges: artifacts.call_edges.clone(),
+        raw_imports: artifacts.raw_imports.clone(),
+        injections: artifacts.injections.clone(),
+        embeds: artifacts.embeds.clone(),
+        todos: artifacts.todos.clone(),
+        concurrency: artifacts.concurrency.clone(),
+        routes: artifacts.routes.clone(),
+        locals: artifacts.locals.clone(),
+        literals: artifacts.literals.clone(),
+        parse_error: artifacts.parse_error.clone(),
+        parse_errors: artifacts.parse_errors.clone(),
+    };
+    let json = serde_json::to_vec(&cached).ok()?;
+    let mut writer = ArtifactWriter::new(Vec::new(), true).ok()?;
+    writer.write_all(&json).ok()?;
+    writer.finish().ok()
+}
+
+/// Decode artifacts cached for another ref and retarget them to
+/// `repo`/`ref_name`; `generated` is the file's current mark. `None` when
+/// the entry cannot be read or was written by another version of cruxe.
+pub fn decode(
+    bytes: &[u8],
+    repo: &str,
+    ref_name: &str,
+    generated: Option<&'static str>,
+) -> Option<SourceArtifacts> {
+    let json = artifact::decode(bytes.to_vec()).ok()?;
+    let mut value: Value = serde_json::from_slice(&json).ok()?;
+    if value.get("version")?.as_str()? != env!("CARGO_PKG_VERSION") {
+        return None;
+    }
+    let symbols: Vec<SymbolRecord> = serde_json::from_value(value.get("symbols")?.clone()).ok()?;
+    let ids: HashMap<String, String> = symbols
+        .iter()
+        .map(|symbol| {
+            let id = compute_symbol_id(
+                repo,
+                ref_name,
+                &symbol.path,
+                &symbol.kind,
+                symbol.line_start,
+                &symbol.name,
+            );
+            (symbol.symbol_id.clone(), id)
+        })
+        .collect();
+    retarget(&mut value, None, repo, ref_name, &ids);
+    let cached: CachedArtifacts = serde_json::from_value(value).ok()?;
+    Some(SourceArtifacts {
+        symbols: cached.symbols,
+        snippets: cached.snippets,
+        call_edges: cached.call_edges,
+        raw_imports: cached.raw_imports,
+        injections: cached.injections,
+        embeds: cached.embeds,
+        todos: cached.todos,
+        concurrency: cached.concurrency,
+        routes: cached.routes,
+        locals: cached.locals,
+        literals: cached.literals,
+        generated,
+        parse_error: cached.parse_error,
+        parse_errors: cached.parse_errors,
+    })
+}
+
+/// Point `repo`, `ref` and `ref_name` fields at the new repo and ref, and
+/// replace symbol ids by their counterparts in `ids`.
+fn retarget(
+    value: &mut Value,
+    key: Option<&str>,
+    repo: &str,
+    ref_name: &str,
+    ids: &HashMap<String, String>,
+) {
+    match value {
+        Value::String(text) => match key {
+            Some("repo") => *text = repo.to_string(),
+            Some("ref" | "ref_name") => *text = ref_name.to_string(),
+            _ => {
+                if let Some(id) = ids.get(text.as_str()) {
+                    *text = id.clone();
+                }
+            }
+        },
+        Value::Array(items) => {
+            for item in items {
+                retarget(item, None, repo, ref_name, ids);
+            }
+        }
+        Value::Object(fields) => {
+            for (field, item) in fields.iter_mut() {
+                retarget(item, Some(field), repo, ref_name, ids);
+            }
+        }
+        _ => {}
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::prepare;
+
+    #[test]
+    fn cached_artifacts_match_a_fresh_build_for_another_ref() {
+        let source = "package auth\n\n\
+            // TODO: rotate keys\n\
+            func Validate(token string) bool {\n\treturn check(token)\n}\n\n\
+            func check(token string) bool {\n\treturn token != \"\"\n}\n";
+        let build = |ref_name: &str| {
+            prepare::build_source_artifacts(
+                source,
+                "go",
+                "auth/token.go",
+                "repo",
+                ref_name,
+                None,
+                true,
+                true,
+            )
+        };
+        let main = build("main");
+        let feat = build("feat");
+        assert_ne!(main.symbols[0].symbol_id, feat.symbols[0].symbol_id);
+
+        let bytes = encode(&main).unwrap();
+        let reused = decode(&bytes, "repo", "feat", feat.generated).unwrap();
+        let ids = |artifacts: &SourceArtifacts| -> Vec<(String, String)> {
+            artifacts
+                .symbols
+                .iter()
+                .map(|symbol| (symbol.symbol_id.clone(), symbol.r#ref.clone()))
+                .collect()
+        };
+        assert_eq!(ids(&reused), ids(&feat));
+        let edges = |artifacts: &SourceArtifacts| -> Vec<(String, Option<String>, String)> {
+            artifacts
+                .call_edges
+                .iter()
+                .map(|edge| {
+                    (
+                        edge.from_symbol_id.clone(),
+                        edge.to_symbol_id.clone(),
+                        edge.ref_name.clone(),
+                    )
+                })
+                .collect()
+        };
+        assert!(!feat.call_edges.is_empty());
+        assert_eq!(edges(&reused), edges(&feat));
+        assert_eq!(reused.todos, feat.todos);
+        assert!(!feat.locals.is_empty());
+        assert_eq!(reused.locals, feat.locals);
+        assert_eq!(reused.literals, feat.literals);
+        assert_eq!(reused.snippets.len(), feat.snippets.len());
+        assert!(
+            reused
+                .snippets
+                .iter()
+                .all(|snippet| snippet.r#ref == "feat")
+        );
+
+        assert!(decode(b"not an entry", "repo", "feat", None).is_none());
+    }
+}
@@ -0,0 +1,370 @@
+//! Go build constraints, for `--build`: the `//go:build` line (or legacy
+//! `// +build` lines) of a file and the GOOS/GOARCH suffixes of its name
+//! (`poll_linux.go`, `fd_windows_amd64.go`), evaluated against one entry
+//! of `[[build.configurations]]`. A selected configuration narrows a run
+//! the way `--include` does; without one every file is in.
+//!
+//! As with the go tool, `unix` holds on
+//! Unix-like systems, `android` implies `linux`, `ios` implies `darwin` and
+//! `illumos` implies `solaris`, and release tags such as `go1.21` always
+//! hold. `cgo` and any other tag hold only when listed in `tags`.
+
+use cruxe_core::config::BuildConfiguration;
+
+const KNOWN_OS: &[&str] = &[
+    "aix",
+    "android",
+    "darwin",
+    "dragonfly",
+    "freebsd",
+    "hurd",
+    "illumos",
+    "ios",
+    "js",
+    "linux",
+    "nacl",
+    "netbsd",
+    "openbsd",
+    "plan9",
+    "solaris",
+    "wasip1",
+    "windows",
+    "zos",
+];
+
+const KNOWN_ARCH: &[&str] = &[
+    "386",
+    "amd64",
+    "amd64p32",
+    "arm",
+    "armbe",
+    "arm64",
+    "arm64be",
+    "loong64",
+    "mips",
+    "mipsle",
+    "mips64",
+    "mips64le",
+    "mips64p32",
+    "mips64p32le",
+    "ppc",
+    "ppc64",
+    "ppc64le",
+    "riscv",
+    "riscv64",
+    "s390",
+    "s390x",
+    "sparc",
+    "sparc64",
+    "wasm",
+];
+
+const UNIX_OS: &[&str] = &[
+    "aix",
+    "android",
+    "darwin",
+    "dragonfly",
+    "freebsd",
+    "hurd",
+    "illumos",
+    "ios",
+    "linux",
+    "netbsd",
+    "openbsd",
+    "solaris",
+];
+
+/// A build constraint expression.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Constraint {
+    Tag(String),
+    Not(Box<Constraint>),
+    And(Vec<Constraint>),
+    Or(Vec<Constraint>),
+}
+
+impl Constraint {
+    pub fn is_satisfied_by(&self, build: &BuildConfiguration) -> bool {
+        match self {
+            Self::Tag(tag) => tag_holds(tag, build),
+            Self::Not(inner) => !inner.is_satisfied_by(build),
+            Self::And(terms) => terms.iter().all(|term| term.is_satisfied_by(build)),
+            Self::Or(terms) => terms.iter().any(|term| term.is_satisfied_by(build)),
+        }
+    }
+}
+
+fn tag_holds(tag: &str, build: &BuildConfiguration) -> bool {
+    let goos = build.goos.as_str();
+    tag == goos
+        || tag == build.goarch
+        || build.tags.iter().any(|t| t == tag)
+        || (tag == "unix" && UNIX_OS.contains(&goos))
+        || (tag == "linux" && goos == "android")
+        || (tag == "darwin" && goos == "ios")
+        || (tag == "solaris" && goos == "illumos")
+        || tag == "gc"
+        || tag
+            .strip_prefix("go1.")
+            .is_some_and(|minor| !minor.is_empty() && minor.bytes().all(|b| b.is_ascii_digit()))
+}
+
+/// The constraint of the Go file at `path` with source `content`, or `None`
+/// when it builds everywhere. Only `.go` files are constrained.
+pub fn file_constraint(path: &str, content: &str) -> Option<Constraint> {
+    if !path.ends_with(".go") {
+        return None;
+    }
+    let mut terms = file_name_constraint(path);
+    if let Some(expr) = header_constraint(content) {
+        terms.push(expr);
+    }
+    match terms.len() {
+        0 => None,
+        1 => terms.pop(),
+        _ => Some(Constraint::And(terms)),
+    }
+}
+
+/// `_GOOS`, `_GOARCH` and `_GOOS_GOARCH` name suffixes, before `_test`.
+fn file_name_constraint(path: &str) -> Vec<Constraint> {
+    let name = path.rsplit('/').next().unwrap_or(path);
+    let stem = name.split_once('.').map_or(name, |(stem, _)| stem);
+    let mut parts: Vec<&str> = stem.split('_').collect();
+    if parts.last() == Some(&"test") {
+        parts.pop();
+    }
+    // The first element is the name itself: `linux.go` is not constrained.
+    let n = parts.len();
+    let tag = |part: &str| Constraint::Tag(part.to_string());
+    if n >= 3 && KNOWN_OS.contains(&parts[n - 2]) && KNOWN_ARCH.contains(&parts[n - 1]) {
+        return vec![tag(parts[n - 2]), tag(parts[n - 1])];
+    }
+    if n >= 2 && (KNOWN_OS.contains(&parts[n - 1]) || KNOWN_ARCH.contains(&parts[n - 1])) {
+        return vec![tag(parts[n - 1])];
+    }
+    Vec::new()
+}
+
+/// The constraint in the comments before the package clause: the
+/// `//go:build` line, or else the conjunction of every `// +build` line.
+fn header_constraint(content: &str) -> Option<Constraint> {
+    let mut plus_lines = Vec::new();
+    for line in content.lines() {
+        let line = line.trim();
+        if line.is_empty() {
+            continue;
+        }
+        if !line.starts_with("//") {
+            break;
+        }
+        if let Some(expr) = line.strip_prefix("//go:build") {
+            return parse_expr(expr);
+        }
+        if let Some(expr) = line.strip_prefix("// +build") {
+            plus_lines.push(parse_plus_line(expr)?);
+        }
+    }
+    match plus_lines.len() {
+        0 => None,
+        1 => plus_lines.pop(),
+        _ => Some(Constraint::And(plus_lines)),
+    }
+}
+
+/// A legacy `// +build` line: spaces separate alternatives, commas join
+/// terms and `!` negates one.
+fn parse_plus_line(line: &str) -> Option<Constraint> {
+    let options: Vec<Constraint> = line
+        .split_whitespace()
+        .map(|option| {
+            let terms: Vec<Constraint> = option
+                .split(',')
+                .map(|term| match term.strip_prefix('!') {
+                    Some(tag) => Constraint::Not(Box::new(Constraint::Tag(tag.to_string()))),
+                    None => Constraint::Tag(term.to_string()),
+                })
+                .collect();
+            Constraint::And(terms)
+        })
+        .collect();
+    (!options.is_empty()).then_some(Constraint::Or(options))
+}
+
+/// A `//go:build` expression; `None` when it does not parse.
+pub fn parse_expr(expr: &str) -> Option<Constraint> {
+    let tokens = tokenize(expr)?;
+    let mut parser = ExprParser { tokens, pos: 0 };
+    let parsed = parser.or()?;
+    (parser.pos == parser.tokens.len()).then_some(parsed)
+}
+
+fn tokenize(expr: &str) -> Option<Vec<String>> {
+    let mut tokens = Vec::new();
+    let mut chars = expr.chars().peekable();
+    while let Some(&c) = chars.peek() {
+        match c {
+            c if c.is_whitespace() => {
+                chars.next();
+            }
+            '(' | ')' | '!' => {
+                tokens.push(c.to_string());
+                chars.next();
+            }
+            '&' | '|' => {
+                chars.next();
+                if chars.next() != Some(c) {
+                    return None;
+                }
+                tokens.push(format!("{c}{c}"));
+            }
+            c if c.is_alphanumeric() || c == '_' || c == '.' => {
+                let mut tag = String::new();
+                while let Some(&c) = chars.peek() {
+                    if !(c.is_alphanumeric() || c == '_' || c == '.') {
+                        break;
+                    }
+                    tag.push(c);
+                    chars.next();
+                }
+                tokens.push(tag);
+            }
+            _ => return None,
+        }
+    }
+    Some(tokens)
+}
+
+struct ExprParser {
+    tokens: Vec<String>,
+    pos: usize,
+}
+
+impl ExprParser {
+    fn peek(&self) -> Option<&str> {
+        self.tokens.get(self.pos).map(String::as_str)
+    }
+
+    fn or(&mut self) -> Option<Constraint> {
+        let mut terms = vec![self.and()?];
+        while self.peek() == Some("||") {
+            self.pos += 1;
+            terms.push(self.and()?);
+        }
+        Some(if terms.len() == 1 {
+            terms.pop()?
+        } else {
+            Constraint::Or(terms)
+        })
+    }
+
+    fn and(&mut self) -> Option<Constraint> {
+        let mut terms = vec![self.not()?];
+        while self.peek() == Some("&&") {
+            self.pos += 1;
+            terms.push(self.not()?);
+        }
+        Some(if terms.len() == 1 {
+            terms.pop()?
+        } else {
+            Constraint::And(terms)
+        })
+    }
+
+    fn not(&mut self) -> Option<Constraint> {
+        let token = self.tokens.get(self.pos)?.clone();
+        self.pos += 1;
+        match token.as_str() {
+            "!" => Some(Constraint::Not(Box::new(self.not()?))),
+            "(" => {
+                let inner = self.or()?;
+                if self.peek() != Some(")") {
+                    return None;
+                }
+                self.pos += 1;
+                Some(inner)
+            }
+            ")" | "&&" | "||" => None,
+            _ => Some(Constraint::Tag(token)),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn build(goos: &str, goarch: &str, tags: &[&str]) -> BuildConfiguration {
+        BuildConfiguration {
+            name: format!("{goos}-{goarch}"),
+            goos: goos.to_string(),
+            goarch: goarch.to_string(),
+            tags: tags.iter().map(|tag| tag.to_string()).collect(),
+        }
+    }
+
+    #[test]
+    fn go_build_lines_and_file_names_constrain_files() {
+        let linux = build("linux", "amd64", &[]);
+        let linux_integration = build("linux", "amd64", &["integration"]);
+        let windows = build("windows", "arm64", &[]);
+        let holds = |path: &str, content: &str, build: &BuildConfiguration| {
+            file_constraint(path, content).is_none_or(|c| c.is_satisfied_by(build))
+        };
+
+        let integration = "// Copyright\n\n//go:build integration && !windows\n\npackage db\n";
+        assert!(!holds("db/db_it_test.go", integration, &linux));
+        assert!(holds("db/db_it_test.go", integration, &linux_integration));
+        assert!(!holds("db/db_it_test.go", integration, &windows));
+
+        assert!(holds(
+            "poll/fd_windows_arm64.go",
+            "package poll\n",
+            &windows
+        ));
+        assert!(!holds(
+            "poll/fd_windows_amd64.go",
+            "package poll\n",
+            &windows
+        ));
+        assert!(!holds("poll/fd_linux_test.go", "package poll\n", &windows));
+        assert!(holds("cmd/linux.go", "package main\n", &windows));
+        assert!(holds(
+            "poll/fd_unix.go",
+            "//go:build unix\n\npackage poll\n",
+            &linux
+        ));
+        assert!(holds(
+            "x.go",
+            "//go:build go1.21 && (linux || darwin)\n",
+            &linux
+        ));
+        assert!(!holds("x.go", "//go:build cgo\n", &linux));
+
+        let legacy = "// +build linux darwin\n// +build !386\n\npackage sys\n";
+        assert!(holds("sys/sys.go", legacy, &linux));
+        assert!(!holds("sys/sys.go", legacy, &build("linux", "386", &[])));
+        assert!(!holds("sys/sys.go", legacy, &windows));
+
+        let after_package = "package main\n\n//go:build ignore\n";
+        assert!(file_constraint("main.go", after_package).is_none());
+        assert!(file_constraint("gen.py", "//go:build ignore\n").is_none());
+    }
+
+    #[test]
+    fn malformed_expressions_do_not_parse() {
+        assert!(parse_expr("linux &&").is_none());
+        assert!(parse_expr("(linux").is_none());
+        assert!(parse_expr("linux & amd64").is_none());
+        assert_eq!(
+            parse_expr("!a || b && c"),
+            Some(Constraint::Or(vec![
+                Constraint::Not(Box::new(Constraint::Tag("a".to_string()))),
+                Constraint::And(vec![
+                    Constraint::Tag("b".to_string()),
+                    Constraint::Tag("c".to_string()),
+                ]),
+            ]))
+        );
+    }
+}
@@ -115,7 +115,7 @@ pub fn dedup_call_edges(edges: Vec<CallEdge>) -> Vec<CallEdge> {
     deduped
 }
 
-fn resolve_caller_symbol(symbols: &[SymbolRecord], line: u32) -> Option<&SymbolRecord> {
+pub(crate) fn resolve_caller_symbol(symbols: &[SymbolRecord], line: u32) -> Option<&SymbolRecord> {
     symbols
         .iter()
         .filter(|symbol| matches!(symbol.kind, SymbolKind::Function | SymbolKind::Method))
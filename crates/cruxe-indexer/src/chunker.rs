@@ -0,0 +1,488 @@
+//! Syntax-aware chunks of a source file for retrieval pipelines (`cruxe
+//! chunk`).
+//!
+//! A file is cut along its syntax tree: every top-level node (function,
+//! type, impl, import block, ...) is a unit, with the comments and
+//! attributes directly above it attached. Units are packed into chunks up
+//! to a line and token limit. A unit too large for one chunk is opened up
+//! when it is a container (impl, class, module, trait) and its members
+//! packed instead; functions are never cut, and one that exceeds the
+//! limits on its own becomes a chunk marked `oversized`. Each chunk starts
+//! with the whole units of the end of the previous chunk that fit in
+//! `overlap_lines`.
+//!
+//! Chunk IDs hash the path and the chunk text, so an edit elsewhere in the
+//! file leaves the IDs of untouched chunks alone. Files without a grammar
+//! are cut at blank lines.
+
+use crate::{languages, parser};
+use cruxe_core::config::SemanticChunkingConfig;
+use cruxe_core::tokens::estimate_tokens;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, VecDeque};
+
+/// Hex digits of the chunk ID.
+const CHUNK_ID_LEN: usize = 16;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ChunkOptions {
+    pub max_lines: usize,
+    pub overlap_lines: usize,
+    pub max_tokens: usize,
+}
+
+impl Default for ChunkOptions {
+    fn default() -> Self {
+        Self::from_config(&SemanticChunkingConfig::default())
+    }
+}
+
+impl ChunkOptions {
+    /// Limits of the indexer's snippet chunking (`search.semantic.chunking`).
+    pub fn from_config(chunking: &SemanticChunkingConfig) -> Self {
+        Self {
+            max_lines: chunking.chunk_size_lines.max(1),
+            overlap_lines: chunking.chunk_overlap_lines,
+            max_tokens: chunking.max_chunk_tokens.max(1),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SourceChunk {
+    pub chunk_id: String,
+    pub path: String,
+    pub language: String,
+    pub chunk_index: usize,
+    pub line_start: u32,
+    pub line_end: u32,
+    /// Leading lines repeated from the previous chunk.
+    pub overlap_lines: u32,
+    /// Qualified names of the symbols declared in the chunk.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub symbols: Vec<String>,
+    pub tokens: usize,
+    /// A single function or other unit larger than the limits.
+    pub oversized: bool,
+    pub content: String,
+}
+
+/// A run of whole lines (0-based, inclusive) that is never split, with the
+/// node it came from when it may be opened up.
+#[derive(Debug, Clone, Copy)]
+struct Unit<'tree> {
+    start: usize,
+    end: usize,
+    tokens: usize,
+    node: Option<tree_sitter::Node<'tree>>,
+}
+
+/// Cut `content` into chunks. `language` selects the grammar; `None` or a
+/// language without one cuts at blank lines.
+pub fn chunk_source(
+    path: &str,
+    content: &str,
+    language: Option<&str>,
+    options: &ChunkOptions,
+) -> Vec<SourceChunk> {
+    let lines: Vec<&str> = content.lines().collect();
+    if lines.iter().all(|line| line.trim().is_empty()) {
+        return Vec::new();
+    }
+    let tree = language
+        .filter(|language| parser::is_language_supported(language))
+        .and_then(|language| parser::parse_file(content, language).ok());
+    let (units, symbols) = match (&tree, language) {
+        (Some(tree), Some(language)) => {
+            let root = tree.root_node();
+            let mut cursor = root.walk();
+            let nodes: Vec<_> = root.named_children(&mut cursor).collect();
+            let symbols: Vec<(u32, String)> = languages::extract_symbols(tree, content, language)
+                .into_iter()
+                .map(|symbol| (symbol.line_start, symbol.qualified_name))
+                .collect();
+            (node_units(&nodes, &lines, None), symbols)
+        }
+        _ => (paragraph_units(&lines), Vec::new()),
+    };
+    if units.is_empty() {
+        return Vec::new();
+    }
+
+    let mut chunks = Vec::new();
+    let mut emit = |current: &[Unit], overlap: usize| {
+        let start = current[0].start;
+        let end = current[current.len() - 1].end;
+        let text = lines[start..=end].join("\n");
+        let line_start = start as u32 + 1;
+        let line_end = end as u32 + 1;
+        let mut names: Vec<String> = Vec::new();
+        for (line, name) in &symbols {
+            if (line_start..=line_end).contains(line) && !names.contains(name) {
+                names.push(name.clone());
+            }
+        }
+        chunks.push(SourceChunk {
+            chunk_id: String::new(),
+            path: path.to_string(),
+            language: language.unwrap_or("text").to_string(),
+            chunk_index: chunks.len(),
+            line_start,
+            line_end,
+            overlap_lines: if overlap == 0 {
+                0
+            } else {
+                (current[overlap - 1].end - start + 1) as u32
+            },
+            symbols: names,
+            tokens: estimate_tokens(&text),
+            oversized: !fits(options, start, end, span_tokens(current)),
+            content: text,
+        });
+    };
+
+    let mut pending: VecDeque<Unit> = units.into();
+    let mut current: Vec<Unit> = Vec::new();
+    let mut overlap = 0usize;
+    while let Some(unit) = pending.pop_front() {
+        if !fits(options, unit.start, unit.end, unit.tokens)
+            && let Some(members) = unit.node.and_then(|node| open_container(node, &lines))
+        {
+            for member in members.into_iter().rev() {
+                pending.push_front(member);
+            }
+            continue;
+        }
+        if !current.is_empty()
+            && !fits(
+                options,
+                current[0].start,
+                unit.end,
+                span_tokens(&current) + unit.tokens,
+            )
+        {
+            emit(&current, overlap);
+            let mut tail = overlap_tail(&current[overlap..], options.overlap_lines);
+            if !tail.is_empty()
+                && !fits(
+                    options,
+                    tail[0].start,
+                    unit.end,
+                    span_tokens(&tail) + unit.tokens,
+                )
+            {
+                tail.clear();
+            }
+            overlap = tail.len();
+            current = tail;
+        }
+        current.push(unit);
+    }
+    if current.len() > overlap {
+        emit(&current, overlap);
+    }
+
+    assign_chunk_ids(&mut chunks);
+    chunks
+}
+
+fn fits(options: &ChunkOptions, start: usize, end: usize, tokens: usize) -> bool {
+    end - start < options.max_lines && tokens <= options.max_tokens
+}
+
+fn span_tokens(units: &[Unit]) -> usize {
+    units.iter().map(|unit| unit.tokens).sum()
+}
+
+/// The trailing units of `units` spanning at most `overlap_lines` lines.
+fn overlap_tail<'tree>(units: &[Unit<'tree>], overlap_lines: usize) -> Vec<Unit<'tree>> {
+    let Some(last) = units.last() else {
+        return Vec::new();
+    };
+    let taken = units
+        .iter()
+        .rev()
+        .take_while(|unit| last.end - unit.start < overlap_lines)
+        .count();
+    units[units.len() - taken..].to_vec()
+}
+
+/// Units of sibling nodes. Comments and attributes directly above a node
+/// (no blank line between) join it. `after` is the last line already
+/// covered, so units never overlap a previous one.
+fn node_units<'tree>(
+    nodes: &[tree_sitter::Node<'tree>],
+    lines: &[&str],
+    mut after: Option<usize>,
+) -> Vec<Unit<'tree>> {
+    let mut units = Vec::new();
+    let mut leading: Option<(usize, usize)> = None;
+    for node in nodes {
+        let (mut start, end) = node_rows(*node);
+        if let Some(covered) = after {
+            start = start.max(covered + 1);
+        }
+        if start > end {
+            continue;
+        }
+        if is_attachable(node.kind()) {
+            leading = match leading {
+                Some((lead_start, lead_end)) if lead_end + 1 >= start => Some((lead_start, end)),
+                Some((lead_start, lead_end)) => {
+                    units.push(line_unit(lead_start, lead_end, lines));
+                    Some((start, end))
+                }
+                None => Some((start, end)),
+            };
+            after = Some(end);
+            continue;
+        }
+        if let Some((lead_start, lead_end)) = leading.take() {
+            if lead_end + 1 >= start {
+                start = lead_start;
+            } else {
+                units.push(line_unit(lead_start, lead_end, lines));
+            }
+        }
+        let mut unit = line_unit(start, end, lines);
+        unit.node = Some(*node);
+        units.push(unit);
+        after = Some(end);
+    }
+    if let Some((lead_start, lead_end)) = leading {
+        units.push(line_unit(lead_start, lead_end, lines));
+    }
+    units
+}
+
+/// Members of a container node too large for one chunk: its header, the
+/// units of its body and its closing lines. `None` for functions, which are
+/// never cut, and for nodes without a body of several members.
+fn open_container<'tree>(
+    node: tree_sitter::Node<'tree>,
+    lines: &[&str],
+) -> Option<Vec<Unit<'tree>>> {
+    // `export class ...` and decorated Python definitions wrap the declaration.
+    let declaration = node
+        .child_by_field_name("declaration")
+        .or_else(|| node.child_by_field_name("definition"))
+        .unwrap_or(node);
+    if is_function_like(declaration.kind()) {
+        return None;
+    }
+    let body = declaration.child_by_field_name("body")?;
+    let mut cursor = body.walk();
+    let members: Vec<_> = body.named_children(&mut cursor).collect();
+    if members.len() < 2 {
+        return None;
+    }
+
+    let (start, end) = node_rows(node);
+    let (first_member, _) = node_rows(members[0]);
+    let mut units = Vec::new();
+    let mut covered = None;
+    if first_member > start {
+        units.push(line_unit(start, first_member - 1, lines));
+        covered = Some(first_member - 1);
+    }
+    let member_units = node_units(&members, lines, covered);
+    let last_member = member_units.last().map_or(start, |unit| unit.end);
+    units.extend(member_units);
+    if end > last_member {
+        units.push(line_unit(last_member + 1, end, lines));
+    }
+    Some(units)
+}
+
+fn paragraph_units(lines: &[&str]) -> Vec<Unit<'static>> {
+    let mut units = Vec::new();
+    let mut start = None;
+    for (row, line) in lines.iter().enumerate() {
+        match (line.trim().is_empty(), start) {
+            (false, None) => start = Some(row),
+            (true, Some(from)) => {
+                units.push(line_unit(from, row - 1, lines));
+                start = None;
+            }
+            _ => {}
+        }
+    }
+    if let Some(from) = start {
+        units.push(line_unit(from, lines.len() - 1, lines));
+    }
+    units
+}
+
+fn line_unit<'tree>(start: usize, end: usize, lines: &[&str]) -> Unit<'tree> {
+    Unit {
+        start,
+        end,
+        tokens: lines[start..=end]
+            .iter()
+            .map(|line| estimate_tokens(line))
+            .sum(),
+        node: None,
+    }
+}
+
+/// First and last row of a node; a node ending at column 0 ends on the
+/// row before.
+fn node_rows(node: tree_sitter::Node) -> (usize, usize) {
+    let start = node.start_position().row;
+    let end_position = node.end_position();
+    let end = if end_position.column == 0 && end_position.row > start {
+        end_position.row - 1
+    } else {
+        end_position.row
+    };
+    (start, end)
+}
+
+fn is_attachable(kind: &str) -> bool {
+    kind.contains("comment") || kind == "attribute_item" || kind == "decorator"
+}
+
+pub(crate) fn is_function_like(kind: &str) -> bool {
+    kind.contains("function") || kind.contains("method") || kind == "closure_expression"
+}
+
+/// IDs from the path and text; a text repeated in the file gets `-2`, `-3`, ...
+fn assign_chunk_ids(chunks: &mut [SourceChunk]) {
+    let mut seen: HashMap<String, usize> = HashMap::new();
+    for chunk in chunks {
+        let hash = blake3::hash(format!("{}\n{}", chunk.path, chunk.content).as_bytes())
+            .to_hex()
+            .to_string();
+        let base = hash[..CHUNK_ID_LEN].to_string();
+        let count = seen.entry(base.clone()).or_default();
+        *count += 1;
+        chunk.chunk_id = if *count == 1 {
+            base
+        } else {
+            format!("{base}-{count}")
+        };
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn rust_source() -> String {
+        let mut source = String::from(
+            "use std::fmt;\n\n/// A pool of connections.\npub struct Pool {\n    size: usize,\n}\n\nimpl Pool {\n",
+        );
+        for name in ["open", "close", "resize", "drain"] {
+            source.push_str(&format!(
+                "    /// {name} the pool.\n    pub fn {name}(&mut self) {{\n        let a = 1;\n        let b = 2;\n        self.size = a + b;\n    }}\n\n"
+            ));
+        }
+        source.push_str("}\n\nfn long() {\n");
+        for i in 0..12 {
+            source.push_str(&format!("    let v{i} = {i};\n"));
+        }
+        source.push_str("}\n");
+        source
+    }
+
+    fn options() -> ChunkOptions {
+        ChunkOptions {
+            max_lines: 10,
+            overlap_lines: 3,
+            max_tokens: 1000,
+        }
+    }
+
+    fn covers(chunks: &[SourceChunk], start: u32, end: u32) -> bool {
+        chunks
+            .iter()
+            .any(|chunk| chunk.line_start <= start && chunk.line_end >= end)
+    }
+
+    #[test]
+    fn functions_are_never_split_and_containers_open_up() {
+        let source = rust_source();
+        let chunks = chunk_source("src/pool.rs", &source, Some("rust"), &options());
+        assert!(chunks.len() > 2, "{chunks:#?}");
+
+        let tree = parser::parse_file(&source, "rust").unwrap();
+        for symbol in languages::extract_symbols(&tree, &source, "rust") {
+            if matches!(
+                symbol.kind,
+                cruxe_core::types::SymbolKind::Function | cruxe_core::types::SymbolKind::Method
+            ) {
+                assert!(
+                    covers(&chunks, symbol.line_start, symbol.line_end),
+                    "{} ({}-{}) split: {chunks:#?}",
+                    symbol.qualified_name,
+                    symbol.line_start,
+                    symbol.line_end
+                );
+            }
+        }
+
+        // Doc comments travel with their function.
+        let open = chunks
+            .iter()
+            .find(|chunk| chunk.content.contains("pub fn open"))
+            .unwrap();
+        assert!(open.content.contains("/// open the pool."));
+
+        let long = chunks.last().unwrap();
+        assert!(long.content.starts_with("fn long()"));
+        assert!(long.oversized);
+        assert_eq!(long.line_end - long.line_start + 1, 14);
+        assert!(
+            chunks[..chunks.len() - 1]
+                .iter()
+                .all(|chunk| !chunk.oversized)
+        );
+        assert!(chunks.iter().any(|chunk| chunk.overlap_lines > 0));
+        assert!(
+            chunks
+                .iter()
+                .all(|chunk| chunk.line_end - chunk.line_start < 10 || chunk.oversized)
+        );
+    }
+
+    #[test]
+    fn chunk_ids_survive_edits_elsewhere_in_the_file() {
+        let source = rust_source();
+        let before = chunk_source("src/pool.rs", &source, Some("rust"), &options());
+        let edited = source.replacen("use std::fmt;", "use std::fmt;\nuse std::io;", 1);
+        let after = chunk_source("src/pool.rs", &edited, Some("rust"), &options());
+
+        let long_before = before.last().unwrap();
+        let long_after = after.last().unwrap();
+        assert_eq!(long_before.chunk_id, long_after.chunk_id);
+        assert_eq!(long_after.line_start, long_before.line_start + 1);
+        assert_ne!(before[0].chunk_id, after[0].chunk_id);
+        assert_eq!(long_before.chunk_id.len(), CHUNK_ID_LEN);
+    }
+
+    #[test]
+    fn files_without_a_grammar_are_cut_at_blank_lines() {
+        let text = "# Title\nintro\n\nfirst paragraph\nstill first\n\nsecond paragraph\n";
+        let chunks = chunk_source(
+            "README.md",
+            text,
+            None,
+            &ChunkOptions {
+                max_lines: 3,
+                overlap_lines: 0,
+                max_tokens: 1000,
+            },
+        );
+        let contents: Vec<&str> = chunks.iter().map(|chunk| chunk.content.as_str()).collect();
+        assert_eq!(
+            contents,
+            vec![
+                "# Title\nintro",
+                "first paragraph\nstill first",
+                "second paragraph"
+            ]
+        );
+        assert!(chunks.iter().all(|chunk| chunk.language == "text"));
+    }
+}
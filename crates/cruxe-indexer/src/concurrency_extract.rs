@@ -0,0 +1,248 @@
+//! Where Go code uses concurrency: `go` statements, channels made with
+//! `make` or declared as fields and variables, and `sync.Mutex`,
+//! `sync.RWMutex` and `sync.WaitGroup` fields, variables and literals.
+//!
+//! Types that only appear in a signature (a `<-chan Job` parameter, a
+//! `*sync.WaitGroup` argument) are uses of a primitive declared elsewhere
+//! and are skipped. Each site is attached to the enclosing function, or to
+//! the innermost symbol containing it (a struct field, a package variable).
+
+use crate::call_extract::resolve_caller_symbol;
+use cruxe_core::types::{ConcurrencyRecord, SymbolRecord};
+
+/// Concurrency sites of a parsed Go file, in line order.
+pub fn extract_concurrency(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<ConcurrencyRecord> {
+    let mut sites = Vec::new();
+    collect(tree.root_node(), source, &mut sites);
+    let mut records: Vec<ConcurrencyRecord> = sites
+        .into_iter()
+        .map(|(line, kind, detail)| {
+            let symbol = attach(symbols, line);
+            ConcurrencyRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line,
+                kind: kind.to_string(),
+                detail,
+                symbol_id: symbol.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: symbol.map(|symbol| symbol.qualified_name.clone()),
+            }
+        })
+        .collect();
+    records.sort_by_key(|record| record.line);
+    records
+}
+
+fn collect(
+    node: tree_sitter::Node<'_>,
+    source: &str,
+    sites: &mut Vec<(u32, &'static str, String)>,
+) {
+    let line = node.start_position().row as u32 + 1;
+    match node.kind() {
+        "go_statement" => {
+            let launched = node
+                .named_child(0)
+                .filter(|call| call.kind() == "call_expression")
+                .and_then(|call| call.child_by_field_name("function"));
+            let detail = match launched {
+                Some(function) if function.kind() == "func_literal" => {
+                    "go func literal".to_string()
+                }
+                Some(function) => format!("go {}", squash(text(function, source))),
+                None => "go".to_string(),
+            };
+            sites.push((line, "goroutine", detail));
+        }
+        "channel_type" => {
+            if let Some(detail) = channel_site(node, source) {
+                sites.push((line, "channel", detail));
+            }
+        }
+        "qualified_type" => {
+            let kind = match text(node, source) {
+                "sync.Mutex" | "sync.RWMutex" => Some("mutex"),
+                "sync.WaitGroup" => Some("waitgroup"),
+                _ => None,
+            };
+            if let Some(kind) = kind
+                && let Some(detail) = declared(node, source, text(node, source))
+            {
+                sites.push((line, kind, detail));
+            }
+        }
+        _ => {}
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect(child, source, sites);
+    }
+}
+
+/// `make(chan Job, 16)`, or a channel field or variable.
+fn channel_site(node: tree_sitter::Node<'_>, source: &str) -> Option<String> {
+    let make = node
+        .parent()
+        .filter(|list| list.kind() == "argument_list")
+        .and_then(|list| list.parent())
+        .filter(|call| {
+            call.child_by_field_name("function")
+                .is_some_and(|function| text(function, source) == "make")
+        });
+    match make {
+        Some(call) => {
+            let created = squash(text(call, source));
+            Some(declared(call, source, &created).unwrap_or(created))
+        }
+        None => declared(node, source, &squash(text(node, source))),
+    }
+}
+
+/// `what` prefixed with the names it is declared as, when `node` is the
+/// type or value of a field, variable or assignment; `None` anywhere else.
+fn declared(node: tree_sitter::Node<'_>, source: &str, what: &str) -> Option<String> {
+    let mut at = node;
+    while let Some(parent) = at.parent() {
+        if !matches!(
+            parent.kind(),
+            "pointer_type" | "composite_literal" | "unary_expression" | "expression_list"
+        ) {
+            break;
+        }
+        at = parent;
+    }
+    let declaration = at.parent()?;
+    let names = match declaration.kind() {
+        "field_declaration" | "var_spec" => {
+            let mut cursor = declaration.walk();
+            declaration
+                .children_by_field_name("name", &mut cursor)
+                .map(|name| text(name, source))
+                .collect::<Vec<_>>()
+                .join(", ")
+        }
+        "short_var_declaration" | "assignment_statement" => declaration
+            .child_by_field_name("left")
+            .map(|left| squash(text(left, source)))
+            .unwrap_or_default(),
+        _ => return None,
+    };
+    Some(if names.is_empty() {
+        what.to_string()
+    } else {
+        format!("{names}: {what}")
+    })
+}
+
+/// The function around `line`, or else the innermost symbol containing it.
+pub(crate) fn attach(symbols: &[SymbolRecord], line: u32) -> Option<&SymbolRecord> {
+    resolve_caller_symbol(symbols, line).or_else(|| {
+        symbols
+            .iter()
+            .filter(|symbol| line >= symbol.line_start && line <= symbol.line_end)
+            .min_by_key(|symbol| symbol.line_end.saturating_sub(symbol.line_start))
+    })
+}
+
+fn text<'s>(node: tree_sitter::Node<'_>, source: &'s str) -> &'s str {
+    source.get(node.byte_range()).unwrap_or_default()
+}
+
+/// Collapse whitespace so multi-line expressions read on one line.
+fn squash(text: &str) -> String {
+    text.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+    use cruxe_core::types::SymbolKind;
+
+    fn symbol(name: &str, kind: SymbolKind, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "pool.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("pool.{name}"),
+            kind,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn finds_launches_channels_and_sync_primitives() {
+        let source = r#"package pool
+
+type Pool struct {
+	sync.Mutex
+	jobs    chan Job
+	pending sync.WaitGroup
+}
+
+var registry = struct{ mu sync.RWMutex }{}
+
+func (p *Pool) Run(results chan<- Result, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	var errs = make(chan error,
+		4)
+	go p.drain(done)
+	go func() {
+		wg.Wait()
+	}()
+	lock := &sync.Mutex{}
+	_ = lock
+}
+"#;
+        let symbols = [
+            symbol("Pool", SymbolKind::Struct, 3, 7),
+            symbol("Pool.jobs", SymbolKind::Variable, 5, 5),
+            symbol("Run", SymbolKind::Method, 11, 21),
+        ];
+        let tree = parse_file(source, "go").unwrap();
+        let found = extract_concurrency(&tree, source, "pool.go", &symbols, "repo", "main");
+        let summary: Vec<(u32, &str, &str, Option<&str>)> = found
+            .iter()
+            .map(|record| {
+                (
+                    record.line,
+                    record.kind.as_str(),
+                    record.detail.as_str(),
+                    record.symbol.as_deref(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            summary,
+            [
+                (4, "mutex", "sync.Mutex", Some("pool.Pool")),
+                (5, "channel", "jobs: chan Job", Some("pool.Pool.jobs")),
+                (6, "waitgroup", "pending: sync.WaitGroup", Some("pool.Pool")),
+                (9, "mutex", "mu: sync.RWMutex", None),
+                (12, "channel", "done: make(chan struct{})", Some("pool.Run")),
+                (13, "channel", "errs: make(chan error, 4)", Some("pool.Run")),
+                (15, "goroutine", "go p.drain", Some("pool.Run")),
+                (16, "goroutine", "go func literal", Some("pool.Run")),
+                (19, "mutex", "lock: sync.Mutex", Some("pool.Run")),
+            ]
+        );
+    }
+}
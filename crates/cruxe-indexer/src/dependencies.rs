@@ -0,0 +1,279 @@
+//! Third-party dependencies present in the working tree, for
+//! `[index.dependencies]`: Go modules vendored under `vendor/` and npm
+//! packages installed under `node_modules/`. Registry caches outside the
+//! repository (`$GOPATH/pkg/mod`, `~/.cargo/registry`) are not indexed.
+//!
+//! Depth 1 is what a project asks for directly. For npm packages each
+//! further level is read from the installed packages' own `package.json`,
+//! resolved the way Node does, from the requiring package up to the root.
+//! `vendor/modules.txt` only marks which modules are required explicitly,
+//! so every other vendored module counts as depth 2.
+
+use cruxe_state::workspace_projects::WorkspaceProject;
+use std::collections::{HashSet, VecDeque};
+use std::path::Path;
+
+/// A dependency directory to index.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Dependency {
+    /// Module path or package name.
+    pub name: String,
+    /// `go` or `node`.
+    pub ecosystem: String,
+    /// Repository-relative directory, e.g. `vendor/github.com/pkg/errors`.
+    pub dir: String,
+    /// 1 for direct dependencies, 2 for theirs, and so on.
+    pub depth: u32,
+}
+
+/// Dependencies of `projects` installed under `repo_root`, down to
+/// `max_depth` levels (0 for every level), ordered by directory.
+pub fn discover_dependencies(
+    repo_root: &Path,
+    projects: &[WorkspaceProject],
+    max_depth: u32,
+) -> Vec<Dependency> {
+    let within = |depth: u32| max_depth == 0 || depth <= max_depth;
+    let mut dependencies = Vec::new();
+
+    // The root may vendor a go.work workspace without a go.mod of its own.
+    let mut go_dirs: Vec<&str> = vec![""];
+    go_dirs.extend(
+        projects
+            .iter()
+            .filter(|project| project.kind == "go" && !project.dir.is_empty())
+            .map(|project| project.dir.as_str()),
+    );
+    for dir in go_dirs {
+        let vendor = join(dir, "vendor");
+        let Ok(source) = std::fs::read_to_string(repo_root.join(&vendor).join("modules.txt"))
+        else {
+            continue;
+        };
+        for (module_path, depth) in parse_vendored_modules(&source) {
+            if within(depth) {
+                dependencies.push(Dependency {
+                    dir: join(&vendor, &module_path),
+                    name: module_path,
+                    ecosystem: "go".to_string(),
+                    depth,
+                });
+            }
+        }
+    }
+
+    let mut seen = HashSet::new();
+    let mut queue = VecDeque::new();
+    for project in projects.iter().filter(|project| project.kind == "node") {
+        for name in package_dependencies(repo_root, &project.dir) {
+            queue.push_back((name, project.dir.clone(), 1));
+        }
+    }
+    while let Some((name, from, depth)) = queue.pop_front() {
+        if !within(depth) {
+            continue;
+        }
+        let Some(dir) = resolve_package(repo_root, &from, &name) else {
+            continue;
+        };
+        if !seen.insert(dir.clone()) {
+            continue;
+        }
+        for next in package_dependencies(repo_root, &dir) {
+            queue.push_back((next, dir.clone(), depth + 1));
+        }
+        dependencies.push(Dependency {
+            name,
+            ecosystem: "node".to_string(),
+            dir,
+            depth,
+        });
+    }
+
+    dependencies.sort_by(|a, b| a.dir.cmp(&b.dir));
+    dependencies
+}
+
+/// `(module path, depth)` of every module in a `vendor/modules.txt`: 1 for
+/// modules marked `## explicit`, 2 for the rest. Files written before Go
+/// 1.14 carry no markers, so their modules all count as direct.
+pub fn parse_vendored_modules(source: &str) -> Vec<(String, u32)> {
+    let mut modules: Vec<(String, bool)> = Vec::new();
+    for line in source.lines() {
+        if let Some(annotations) = line.strip_prefix("## ") {
+            if annotations.split(';').any(|a| a.trim() == "explicit")
+                && let Some(last) = modules.last_mut()
+            {
+                last.1 = true;
+            }
+        } else if let Some(rest) = line.strip_prefix("# ") {
+            // `# path version`, `# path version => replacement` or, for a
+            // replacement of every version, `# path => replacement`.
+            let Some(module_path) = rest.split_whitespace().next() else {
+                continue;
+            };
+            modules.push((module_path.to_string(), false));
+        }
+    }
+    let marked = modules.iter().any(|(_, explicit)| *explicit);
+    modules
+        .into_iter()
+        .map(|(module_path, explicit)| {
+            let depth = if explicit || !marked { 1 } else { 2 };
+            (module_path, depth)
+        })
+        .collect()
+}
+
+/// Names in `dependencies`, `optionalDependencies` and, for a workspace
+/// project, `devDependencies` of the `package.json` in `dir`.
+fn package_dependencies(repo_root: &Path, dir: &str) -> Vec<String> {
+    let Ok(source) = std::fs::read_to_string(repo_root.join(dir).join("package.json")) else {
+        return Vec::new();
+    };
+    let Ok(manifest) = serde_json::from_str::<serde_json::Value>(&source) else {
+        return Vec::new();
+    };
+    // Development dependencies of installed packages are never installed.
+    let installed = dir.split('/').any(|part| part == "node_modules");
+    let mut fields = vec!["dependencies", "optionalDependencies"];
+    if !installed {
+        fields.push("devDependencies");
+    }
+    let mut names: Vec<String> = fields
+        .into_iter()
+        .filter_map(|field| manifest.get(field)?.as_object())
+        .flat_map(|deps| deps.keys().cloned())
+        .collect();
+    names.sort();
+    names.dedup();
+    names
+}
+
+/// Directory of the package `name` as Node resolves it from `from`: the
+/// first `node_modules/<name>` in `from` or one of its parents. Packages
+/// linked to a directory outside `node_modules` (workspace packages) are
+/// the project's own code, not dependencies.
+fn resolve_package(repo_root: &Path, from: &str, name: &str) -> Option<String> {
+    let mut dir = from.to_string();
+    loop {
+        let candidate = join(&join(&dir, "node_modules"), name);
+        let path = repo_root.join(&candidate);
+        if path.join("package.json").is_file() {
+            let linked = path
+                .symlink_metadata()
+                .is_ok_and(|meta| meta.file_type().is_symlink());
+            return (!linked).then_some(candidate);
+        }
+        if dir.is_empty() {
+            return None;
+        }
+        dir = match dir.rsplit_once('/') {
+            // Leave `.../node_modules/pkg` for the `node_modules` holding it.
+            Some((parent, _)) => parent
+                .strip_suffix("/node_modules")
+                .or_else(|| (parent == "node_modules").then_some(""))
+                .unwrap_or(parent)
+                .to_string(),
+            None => String::new(),
+        };
+    }
+}
+
+fn join(dir: &str, name: &str) -> String {
+    if dir.is_empty() {
+        name.to_string()
+    } else {
+        format!("{dir}/{name}")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+
+    #[test]
+    fn vendored_modules_are_direct_when_explicit() {
+        let source = "\
+# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# golang.org/x/sys v0.1.0
+## explicit; go 1.17
+golang.org/x/sys/unix
+# golang.org/x/text v0.3.7
+golang.org/x/text/unicode/norm
+# example.com/fork => ./fork
+## explicit
+";
+        assert_eq!(
+            parse_vendored_modules(source),
+            [
+                ("github.com/pkg/errors".to_string(), 1),
+                ("golang.org/x/sys".to_string(), 1),
+                ("golang.org/x/text".to_string(), 2),
+                ("example.com/fork".to_string(), 1),
+            ]
+        );
+        let unmarked = parse_vendored_modules("# github.com/pkg/errors v0.9.1\n");
+        assert_eq!(unmarked, [("github.com/pkg/errors".to_string(), 1)]);
+    }
+
+    #[test]
+    fn node_dependencies_resolve_to_the_configured_depth() {
+        let tmp = tempfile::tempdir().unwrap();
+        let root = tmp.path();
+        for (path, content) in [
+            (
+                "web/package.json",
+                r#"{"name": "web", "dependencies": {"express": "4"}, "devDependencies": {"jest": "29"}}"#,
+            ),
+            (
+                "node_modules/express/package.json",
+                r#"{"name": "express", "dependencies": {"debug": "2"}, "devDependencies": {"mocha": "1"}}"#,
+            ),
+            (
+                "node_modules/express/node_modules/debug/package.json",
+                r#"{"name": "debug", "dependencies": {"ms": "2"}}"#,
+            ),
+            ("node_modules/ms/package.json", r#"{"name": "ms"}"#),
+            ("node_modules/jest/package.json", r#"{"name": "jest"}"#),
+            ("vendor/modules.txt", "# github.com/pkg/errors v0.9.1\n"),
+        ] {
+            let full = root.join(path);
+            fs::create_dir_all(full.parent().unwrap()).unwrap();
+            fs::write(full, content).unwrap();
+        }
+        let projects = [WorkspaceProject {
+            name: "web".to_string(),
+            kind: "node".to_string(),
+            dir: "web".to_string(),
+        }];
+
+        let found = |max_depth: u32| -> Vec<(String, u32)> {
+            discover_dependencies(root, &projects, max_depth)
+                .into_iter()
+                .map(|dependency| (dependency.dir, dependency.depth))
+                .collect()
+        };
+        assert_eq!(
+            found(1),
+            [
+                ("node_modules/express".to_string(), 1),
+                ("node_modules/jest".to_string(), 1),
+                ("vendor/github.com/pkg/errors".to_string(), 1),
+            ]
+        );
+        assert_eq!(
+            found(0),
+            [
+                ("node_modules/express".to_string(), 1),
+                ("node_modules/express/node_modules/debug".to_string(), 2),
+                ("node_modules/jest".to_string(), 1),
+                ("node_modules/ms".to_string(), 3),
+                ("vendor/github.com/pkg/errors".to_string(), 1),
+            ]
+        );
+    }
+}
@@ -0,0 +1,404 @@
+//! Doc comments of declarations, read from the source around them.
+//!
+//! Symbol bodies start at the declaration, so the comment block above it
+//! (or a Python docstring below it) is not part of any indexed content.
+//! [`build_doc_snippet_records`] indexes that text as `doc_comment`
+//! snippets so searches can match what the documentation says.
+//! [`build_comment_snippet_records`] does the same for comment blocks inside
+//! code ("Set up graceful shutdown on SIGINT/SIGTERM."), which carry design
+//! context no declaration does.
+
+use crate::languages::ExtractedSymbol;
+use cruxe_core::types::{SnippetRecord, compute_symbol_stable_id};
+use std::collections::HashSet;
+
+/// Comment lines further than this above the declaration are not read.
+const MAX_DOC_LINES: usize = 40;
+
+/// Snippet `chunk_type` of indexed doc comments.
+pub const DOC_CHUNK_TYPE: &str = "doc_comment";
+
+/// Snippet `chunk_type` of indexed comment blocks that document no
+/// declaration.
+pub const COMMENT_CHUNK_TYPE: &str = "comment";
+
+/// Chunk types `cruxe search --docs` matches.
+pub const DOCS_CHUNK_TYPES: [&str; 2] = [DOC_CHUNK_TYPE, COMMENT_CHUNK_TYPE];
+
+/// Comment blocks with fewer words are labels, not context.
+const MIN_COMMENT_WORDS: usize = 3;
+
+/// Tool directives and file headers, not prose.
+const DIRECTIVE_PREFIXES: [&str; 12] = [
+    "go:",
+    "+build",
+    "nolint",
+    "eslint-",
+    "@ts-",
+    "prettier-",
+    "noqa",
+    "type:",
+    "pylint:",
+    "fmt:",
+    "!",
+    "-*-",
+];
+
+/// The documentation attached to a declaration on 1-based `line_start`:
+/// a Python docstring, or the comment block directly above (attributes and
+/// decorators in between are skipped). Comment markers are stripped.
+pub fn doc_comment<S: AsRef<str>>(source: &[S], line_start: u32, language: &str) -> Option<String> {
+    if line_start == 0 || line_start as usize > source.len() {
+        return None;
+    }
+    let decl = line_start as usize - 1;
+    if language == "python"
+        && let Some(doc) = python_docstring(source, decl)
+    {
+        return Some(doc);
+    }
+
+    let line_comment = if language == "python" { "#" } else { "//" };
+    let mut lines = Vec::new();
+    let mut in_block = false;
+    for text in source[..decl].iter().rev().take(MAX_DOC_LINES) {
+        let text = text.as_ref().trim();
+        if in_block {
+            if let Some(rest) = text.strip_prefix("/**").or_else(|| text.strip_prefix("/*")) {
+                lines.push(rest.trim());
+                break;
+            }
+            lines.push(text.trim_start_matches('*').trim());
+        } else if let Some(rest) = text.strip_suffix("*/") {
+            if let Some(single) = rest.strip_prefix("/**").or_else(|| rest.strip_prefix("/*")) {
+                lines.push(single.trim());
+                break;
+            }
+            lines.push(rest.trim_start_matches('*').trim());
+            in_block = true;
+        } else if let Some(rest) = text.strip_prefix(line_comment) {
+            let rest = rest.trim_start_matches(['/', '!']);
+            lines.push(rest.strip_prefix(' ').unwrap_or(rest));
+        } else if lines.is_empty() && (text.starts_with("#[") || text.starts_with('@')) {
+            continue;
+        } else {
+            break;
+        }
+    }
+    lines.reverse();
+    let doc = lines.join("\n").trim().to_string();
+    (!doc.is_empty()).then_some(doc)
+}
+
+/// The string literal opening the body of the `def`/`class` on `decl`.
+fn python_docstring<S: AsRef<str>>(source: &[S], decl: usize) -> Option<String> {
+    let header_end = (decl..source.len().min(decl + MAX_DOC_LINES)).find(|&idx| {
+        source[idx]
+            .as_ref()
+            .split('#')
+            .next()
+            .unwrap_or("")
+            .trim_end()
+            .ends_with(':')
+    })?;
+    let first = source
+        .get(header_end + 1..)?
+        .iter()
+        .position(|line| !line.as_ref().trim().is_empty())?;
+    let body = &source[header_end + 1 + first..];
+    let opening = body[0].as_ref().trim_start();
+    let opening = opening.strip_prefix(['r', 'R']).unwrap_or(opening);
+    let quote = ["\"\"\"", "'''"]
+        .into_iter()
+        .find(|q| opening.starts_with(q))?;
+    let rest = &opening[quote.len()..];
+    if let Some(end) = rest.find(quote) {
+        return Some(rest[..end].trim().to_string());
+    }
+    let mut lines = vec![rest.trim()];
+    for line in body.iter().skip(1).take(MAX_DOC_LINES) {
+        let line = line.as_ref();
+        if let Some(end) = line.find(quote) {
+            lines.push(line[..end].trim());
+            break;
+        }
+        lines.push(line.trim());
+    }
+    Some(lines.join("\n").trim().to_string())
+}
+
+/// One `doc_comment` snippet per documented symbol, spanning the
+/// declaration line and tied to the symbol by its stable id.
+pub fn build_doc_snippet_records(
+    extracted: &[ExtractedSymbol],
+    repo: &str,
+    r#ref: &str,
+    path: &str,
+    commit: Option<&str>,
+    content: &str,
+) -> Vec<SnippetRecord> {
+    let source: Vec<&str> = content.lines().collect();
+    let mut snippets = Vec::new();
+    for sym in extracted {
+        let Some(doc) = doc_comment(&source, sym.line_start, &sym.language) else {
+            continue;
+        };
+        snippets.push(SnippetRecord {
+            repo: repo.to_string(),
+            r#ref: r#ref.to_string(),
+            commit: commit.map(String::from),
+            path: path.to_string(),
+            language: sym.language.clone(),
+            chunk_type: DOC_CHUNK_TYPE.to_string(),
+            origin: "symbol_doc".to_string(),
+            parent_symbol_stable_id: Some(compute_symbol_stable_id(
+                &sym.language,
+                &sym.kind,
+                &sym.qualified_name,
+                sym.signature.as_deref(),
+            )),
+            chunk_index: 0,
+            truncated: false,
+            imports: None,
+            line_start: sym.line_start,
+            line_end: sym.line_start,
+            content: doc,
+        });
+    }
+    snippets
+}
+
+/// One `comment` snippet per significant block of whole-line comments that
+/// is not the doc comment of a declaration, spanning the block and tied to
+/// the innermost symbol around it. Directives, license headers and
+/// commented-out code are left out.
+pub fn build_comment_snippet_records(
+    extracted: &[ExtractedSymbol],
+    repo: &str,
+    r#ref: &str,
+    path: &str,
+    commit: Option<&str>,
+    language: &str,
+    content: &str,
+) -> Vec<SnippetRecord> {
+    let source: Vec<&str> = content.lines().collect();
+    let line_comment = if language == "python" { "#" } else { "//" };
+    let declarations: HashSet<usize> = extracted
+        .iter()
+        .map(|sym| sym.line_start as usize)
+        .collect();
+    let mut snippets = Vec::new();
+    let mut idx = 0;
+    while idx < source.len() {
+        let first = idx;
+        let mut lines = Vec::new();
+        while let Some(rest) = source
+            .get(idx)
+            .and_then(|line| line.trim().strip_prefix(line_comment))
+        {
+            // `#!` is a shebang; `//!` and `///` are still comments.
+            let rest = if language == "python" {
+                rest
+            } else {
+                rest.trim_start_matches(['/', '!'])
+            };
+            lines.push(rest.trim());
+            idx += 1;
+        }
+        if lines.is_empty() {
+            idx += 1;
+            continue;
+        }
+        // The block a declaration (past its attributes) follows is its doc.
+        let mut next = idx;
+        while source
+            .get(next)
+            .is_some_and(|line| line.trim().starts_with("#[") || line.trim().starts_with('@'))
+        {
+            next += 1;
+        }
+        if declarations.contains(&(next + 1)) {
+            continue;
+        }
+        let Some(text) = significant_comment(&lines) else {
+            continue;
+        };
+        let (line_start, line_end) = (first as u32 + 1, idx as u32);
+        let enclosing = extracted
+            .iter()
+            .filter(|sym| sym.line_start <= line_start && line_end <= sym.line_end)
+            .min_by_key(|sym| sym.line_end - sym.line_start);
+        snippets.push(SnippetRecord {
+            repo: repo.to_string(),
+            r#ref: r#ref.to_string(),
+            commit: commit.map(String::from),
+            path: path.to_string(),
+            language: language.to_string(),
+            chunk_type: COMMENT_CHUNK_TYPE.to_string(),
+            origin: "inline_comment".to_string(),
+            parent_symbol_stable_id: enclosing.map(|sym| {
+                compute_symbol_stable_id(
+                    &sym.language,
+                    &sym.kind,
+                    &sym.qualified_name,
+                    sym.signature.as_deref(),
+                )
+            }),
+            chunk_index: 0,
+            truncated: false,
+            imports: None,
+            line_start,
+            line_end,
+            content: text,
+        });
+    }
+    snippets
+}
+
+/// The prose of a comment block, or `None` for directives, license
+/// headers, short labels and commented-out code.
+fn significant_comment(lines: &[&str]) -> Option<String> {
+    let lines: Vec<&str> = lines
+        .iter()
+        .copied()
+        .filter(|line| {
+            !DIRECTIVE_PREFIXES
+                .iter()
+                .any(|prefix| line.starts_with(prefix))
+        })
+        .collect();
+    let text = lines.join("\n").trim().to_string();
+    let lower = text.to_lowercase();
+    if ["copyright", "spdx-license", "licensed under"]
+        .iter()
+        .any(|marker| lower.contains(marker))
+    {
+        return None;
+    }
+    let code_like = lines
+        .iter()
+        .filter(|line| !line.is_empty())
+        .all(|line| line.ends_with([';', '{', '}', '(', ')', ',']));
+    let words = text
+        .split_whitespace()
+        .filter(|word| word.chars().any(char::is_alphabetic))
+        .count();
+    (!code_like && words >= MIN_COMMENT_WORDS).then_some(text)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+
+    #[test]
+    fn doc_comment_reads_comment_blocks_and_docstrings() {
+        let lines = |text: &'static str| text.lines().collect::<Vec<_>>();
+        let rust = lines(
+            "/// Parses a token.\n///\n/// Errors on bad input.\n#[inline]\npub fn parse() {}\n",
+        );
+        assert_eq!(
+            doc_comment(&rust, 5, "rust").as_deref(),
+            Some("Parses a token.\n\nErrors on bad input.")
+        );
+        let ts = lines(
+            "/**\n * Opens the pool.\n * @param size max connections\n */\nexport function open() {}\n",
+        );
+        assert_eq!(
+            doc_comment(&ts, 5, "typescript").as_deref(),
+            Some("Opens the pool.\n@param size max connections")
+        );
+        let go = lines("package api\n\n// Validate checks the token.\nfunc Validate() {}\n");
+        assert_eq!(
+            doc_comment(&go, 4, "go").as_deref(),
+            Some("Validate checks the token.")
+        );
+        let python = lines(
+            "def load(path):\n    \"\"\"Load a file.\n\n    Returns bytes.\n    \"\"\"\n    return b''\n",
+        );
+        assert_eq!(
+            doc_comment(&python, 1, "python").as_deref(),
+            Some("Load a file.\n\nReturns bytes.")
+        );
+        let bare = lines("let x = 1;\n\nfn undocumented() {}\n");
+        assert_eq!(doc_comment(&bare, 3, "rust"), None);
+    }
+
+    #[test]
+    fn comment_blocks_inside_code_become_comment_snippets() {
+        let content = "// Copyright 2026 Acme\n\npackage main\n\n// main runs the server.\nfunc main() {\n\t// Set up graceful shutdown on SIGINT/SIGTERM.\n\tquit := make(chan os.Signal, 1)\n\t//nolint:errcheck\n\t// retry once\n\tdefer cleanup()\n\t// defer db.Close(ctx, true)\n}\n";
+        let main = ExtractedSymbol {
+            name: "main".to_string(),
+            qualified_name: "main.main".to_string(),
+            kind: SymbolKind::Function,
+            language: "go".to_string(),
+            signature: Some("func main()".to_string()),
+            line_start: 6,
+            line_end: 13,
+            visibility: None,
+            parent_name: None,
+            body: None,
+        };
+        let snippets =
+            build_comment_snippet_records(&[main], "repo", "main", "main.go", None, "go", content);
+        assert_eq!(snippets.len(), 1);
+        let comment = &snippets[0];
+        assert_eq!(comment.chunk_type, COMMENT_CHUNK_TYPE);
+        assert_eq!(
+            comment.content,
+            "Set up graceful shutdown on SIGINT/SIGTERM."
+        );
+        assert_eq!((comment.line_start, comment.line_end), (7, 7));
+        assert_eq!(
+            comment.parent_symbol_stable_id.as_deref(),
+            Some(
+                compute_symbol_stable_id(
+                    "go",
+                    &SymbolKind::Function,
+                    "main.main",
+                    Some("func main()")
+                )
+                .as_str()
+            )
+        );
+    }
+
+    #[test]
+    fn documented_symbols_become_doc_snippets() {
+        let content = "package api\n\n// Validate rejects expired session tokens.\nfunc Validate() {}\n\nfunc helper() {}\n";
+        let symbol = |name: &str, line: u32| ExtractedSymbol {
+            name: name.to_string(),
+            qualified_name: format!("api.{name}"),
+            kind: SymbolKind::Function,
+            language: "go".to_string(),
+            signature: Some(format!("func {name}()")),
+            line_start: line,
+            line_end: line,
+            visibility: None,
+            parent_name: None,
+            body: Some(format!("func {name}() {{}}")),
+        };
+        let extracted = vec![symbol("Validate", 4), symbol("helper", 6)];
+        let snippets =
+            build_doc_snippet_records(&extracted, "repo", "main", "api/api.go", None, content);
+        assert_eq!(snippets.len(), 1);
+        assert_eq!(snippets[0].chunk_type, DOC_CHUNK_TYPE);
+        assert_eq!(
+            snippets[0].content,
+            "Validate rejects expired session tokens."
+        );
+        assert_eq!(snippets[0].line_start, 4);
+        assert_eq!(
+            snippets[0].parent_symbol_stable_id.as_deref(),
+            Some(
+                compute_symbol_stable_id(
+                    "go",
+                    &SymbolKind::Function,
+                    "api.Validate",
+                    Some("func Validate()")
+                )
+                .as_str()
+            )
+        );
+    }
+}
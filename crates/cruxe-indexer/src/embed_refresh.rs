@@ -0,0 +1,189 @@
+//! `cruxe embed`: bring the stored embedding vectors of a ref up to date.
+//!
+//! Every file whose snippets were embedded has a fingerprint in
+//! `embedded_files`. A refresh recomputes the fingerprints from the indexed
+//! symbols and snippets and only re-embeds the files whose fingerprint or
+//! embedding model changed, so a rerun after an edit costs one provider call
+//! per touched file. Progress is recorded file by file: a run that fails
+//! or is cancelled halfway (provider down, rate limit, Ctrl-C) resumes where
+//! it stopped.
+
+use cruxe_core::cancel::CancellationToken;
+use cruxe_core::config::SemanticConfig;
+use cruxe_core::error::StateError;
+use cruxe_state::embedded_files::{self, EmbeddedFile};
+use cruxe_state::manifest;
+use cruxe_state::tantivy_index::IndexSet;
+use rusqlite::Connection;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use tracing::info_span;
+
+use crate::embed_writer::{self, EmbeddingWriter};
+use crate::sync_incremental::load_snippets_for_file;
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct EmbedRefreshReport {
+    pub model_id: String,
+    pub model_version: String,
+    /// The configured provider would send code off this machine and the
+    /// privacy gates are closed, so the local model was used instead.
+    pub external_provider_blocked: bool,
+    pub files_embedded: usize,
+    pub files_unchanged: usize,
+    pub files_removed: usize,
+    pub vectors_written: usize,
+}
+
+#[derive(Debug, Default, PartialEq, Eq)]
+struct RefreshPlan {
+    embed: Vec<String>,
+    unchanged: Vec<String>,
+    remove: Vec<String>,
+}
+
+/// Re-embed the files of `ref_name` whose snippets changed since they were
+/// last embedded (every file with `force`), and drop the vectors of files
+/// that are gone. `cancel` is checked between files.
+pub fn refresh_embeddings(
+    conn: &Connection,
+    index_set: &IndexSet,
+    semantic: &SemanticConfig,
+    project_id: &str,
+    ref_name: &str,
+    force: bool,
+    cancel: &CancellationToken,
+) -> Result<EmbedRefreshReport, StateError> {
+    let mut writer = EmbeddingWriter::new_explicit(semantic, project_id, ref_name)?;
+    let model_id = writer.model_id().unwrap_or_default().to_string();
+    let model_version = writer.model_version().unwrap_or_default().to_string();
+
+    let mut files = BTreeMap::new();
+    for entry in manifest::get_all_entries(conn, project_id, ref_name)? {
+        let symbols =
+            cruxe_state::symbols::list_symbols_in_file(conn, project_id, ref_name, &entry.path)?;
+        let snippets = load_snippets_for_file(index_set, project_id, ref_name, &entry.path)?;
+        let fingerprint = embed_writer::file_fingerprint(&symbols, &snippets);
+        files.insert(entry.path, (fingerprint, symbols, snippets));
+    }
+    let current: BTreeMap<String, Option<String>> = files
+        .iter()
+        .map(|(path, (fingerprint, _, _))| (path.clone(), fingerprint.clone()))
+        .collect();
+    let recorded = embedded_files::for_ref(conn, project_id, ref_name)?;
+    let plan = plan_refresh(&current, &recorded, &model_id, &model_version, force);
+
+    let mut report = EmbedRefreshReport {
+        model_id,
+        model_version,
+        external_provider_blocked: writer.external_provider_blocked(),
+        files_unchanged: plan.unchanged.len(),
+        ..EmbedRefreshReport::default()
+    };
+    for path in &plan.remove {
+        cancel.check()?;
+        let symbol_stable_ids: Vec<String> = files
+            .get(path)
+            .map(|(_, symbols, _)| {
+                symbols
+                    .iter()
+                    .map(|symbol| symbol.symbol_stable_id.clone())
+                    .collect()
+            })
+            .unwrap_or_default();
+        writer.delete_for_file_vectors_with_symbols(conn, path, &symbol_stable_ids)?;
+        report.files_removed += 1;
+    }
+    for path in &plan.embed {
+        cancel.check()?;
+        let _span = info_span!("embed.file", path = path.as_str()).entered();
+        let (_, symbols, snippets) = &files[path];
+        let symbol_stable_ids: Vec<String> = symbols
+            .iter()
+            .map(|symbol| symbol.symbol_stable_id.clone())
+            .collect();
+        writer.delete_for_file_vectors_with_symbols(conn, path, &symbol_stable_ids)?;
+        report.vectors_written += writer.write_file_embeddings(conn, symbols, snippets)?;
+        report.files_embedded += 1;
+    }
+    Ok(report)
+}
+
+/// Sort files into re-embed, unchanged and remove. `current` maps each
+/// indexed file to its fingerprint (`None`: nothing to embed); `recorded` is
+/// what the stored vectors were computed from.
+fn plan_refresh(
+    current: &BTreeMap<String, Option<String>>,
+    recorded: &HashMap<String, EmbeddedFile>,
+    model_id: &str,
+    model_version: &str,
+    force: bool,
+) -> RefreshPlan {
+    let mut plan = RefreshPlan::default();
+    for (path, fingerprint) in current {
+        match (fingerprint, recorded.get(path)) {
+            (None, Some(_)) => plan.remove.push(path.clone()),
+            (None, None) => {}
+            (Some(fingerprint), Some(stored))
+                if !force
+                    && stored.fingerprint == *fingerprint
+                    && stored.model_id == model_id
+                    && stored.model_version == model_version =>
+            {
+                plan.unchanged.push(path.clone());
+            }
+            (Some(_), _) => plan.embed.push(path.clone()),
+        }
+    }
+    let mut gone: Vec<String> = recorded
+        .keys()
+        .filter(|path| !current.contains_key(*path))
+        .cloned()
+        .collect();
+    gone.sort();
+    plan.remove.extend(gone);
+    plan
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn stored(fingerprint: &str, model_version: &str) -> EmbeddedFile {
+        EmbeddedFile {
+            fingerprint: fingerprint.to_string(),
+            model_id: "nomic-embed-text".to_string(),
+            model_version: model_version.to_string(),
+        }
+    }
+
+    #[test]
+    fn only_changed_files_are_re_embedded() {
+        let current = BTreeMap::from([
+            ("src/changed.rs".to_string(), Some("new".to_string())),
+            ("src/empty.rs".to_string(), None),
+            ("src/emptied.rs".to_string(), None),
+            ("src/new.rs".to_string(), Some("fresh".to_string())),
+            ("src/same.rs".to_string(), Some("same".to_string())),
+        ]);
+        let recorded = HashMap::from([
+            ("src/changed.rs".to_string(), stored("old", "v1")),
+            ("src/deleted.rs".to_string(), stored("gone", "v1")),
+            ("src/emptied.rs".to_string(), stored("had-code", "v1")),
+            ("src/same.rs".to_string(), stored("same", "v1")),
+        ]);
+
+        let plan = plan_refresh(&current, &recorded, "nomic-embed-text", "v1", false);
+        assert_eq!(plan.embed, vec!["src/changed.rs", "src/new.rs"]);
+        assert_eq!(plan.unchanged, vec!["src/same.rs"]);
+        assert_eq!(plan.remove, vec!["src/emptied.rs", "src/deleted.rs"]);
+
+        // A new model version invalidates every stored vector; so does --force.
+        let plan = plan_refresh(&current, &recorded, "nomic-embed-text", "v2", false);
+        assert!(plan.unchanged.is_empty());
+        assert_eq!(plan.embed.len(), 3);
+        let plan = plan_refresh(&current, &recorded, "nomic-embed-text", "v1", true);
+        assert!(plan.unchanged.is_empty());
+        assert_eq!(plan.embed.len(), 3);
+    }
+}
@@ -1,9 +1,11 @@
 use cruxe_core::config::SemanticConfig;
 use cruxe_core::error::StateError;
 use cruxe_core::types::{SnippetRecord, SymbolRecord};
+use cruxe_state::embedded_files::{self, EmbeddedFile};
 use cruxe_state::embedding::{self, EmbeddingProvider};
 use cruxe_state::vector_index::{self, VectorRecord};
 use rusqlite::Connection;
+use std::collections::BTreeMap;
 
 pub struct EmbeddingWriter {
     enabled: bool,
@@ -31,7 +33,16 @@ impl EmbeddingWriter {
                 vector_backend: None,
             });
         }
+        Self::new_explicit(semantic, project_id, ref_name)
+    }
 
+    /// Writer that embeds whatever `search.semantic.mode` says, for an
+    /// explicit `cruxe embed` run.
+    pub fn new_explicit(
+        semantic: &SemanticConfig,
+        project_id: &str,
+        ref_name: &str,
+    ) -> Result<Self, StateError> {
         let built = embedding::build_embedding_provider(semantic)?;
         Ok(Self {
             enabled: true,
@@ -51,10 +62,21 @@ impl EmbeddingWriter {
         self.external_provider_blocked
     }
 
+    pub fn model_id(&self) -> Option<&str> {
+        self.provider.as_ref().map(|provider| provider.model_id())
+    }
+
+    pub fn model_version(&self) -> Option<&str> {
+        self.provider
+            .as_ref()
+            .map(|provider| provider.model_version())
+    }
+
     pub fn delete_for_ref(&self, conn: &Connection) -> Result<usize, StateError> {
         if !self.enabled {
             return Ok(0);
         }
+        embedded_files::delete_for_ref(conn, &self.project_id, &self.ref_name)?;
         vector_index::delete_vectors_for_ref_with_backend(
             conn,
             &self.project_id,
@@ -67,6 +89,7 @@ impl EmbeddingWriter {
         if !self.enabled {
             return Ok(0);
         }
+        embedded_files::delete_for_file(conn, &self.project_id, &self.ref_name, path)?;
         vector_index::delete_vectors_for_path_with_backend(
             conn,
             &self.project_id,
@@ -173,6 +196,7 @@ impl EmbeddingWriter {
         let model_id = provider.model_id().to_string();
         let model_version = provider.model_version().to_string();
         let dimensions = provider.dimensions();
+        let fingerprints = fingerprints_by_path(&candidates);
 
         let records: Vec<VectorRecord> = candidates
             .into_iter()
@@ -195,10 +219,57 @@ impl EmbeddingWriter {
             })
             .collect();
 
-        vector_index::upsert_vectors_with_backend(conn, &records, self.vector_backend.as_deref())
+        let written = vector_index::upsert_vectors_with_backend(
+            conn,
+            &records,
+            self.vector_backend.as_deref(),
+        )?;
+        for (path, fingerprint) in fingerprints {
+            embedded_files::record(
+                conn,
+                &self.project_id,
+                &self.ref_name,
+                &path,
+                &EmbeddedFile {
+                    fingerprint,
+                    model_id: model_id.clone(),
+                    model_version: model_version.clone(),
+                },
+            )?;
+        }
+        Ok(written)
     }
 }
 
+/// Fingerprint of what a file would embed: its snippet hashes and the symbols
+/// they attach to. `None` when nothing in the file is embeddable.
+pub fn file_fingerprint(symbols: &[SymbolRecord], snippets: &[SnippetRecord]) -> Option<String> {
+    fingerprints_by_path(&build_embedding_candidates(symbols, snippets))
+        .into_values()
+        .next()
+}
+
+fn fingerprints_by_path(candidates: &[EmbeddingSnippet]) -> BTreeMap<String, String> {
+    let mut keys: BTreeMap<String, Vec<String>> = BTreeMap::new();
+    for candidate in candidates {
+        keys.entry(candidate.path.clone())
+            .or_default()
+            .push(format!(
+                "{}|{}",
+                candidate.symbol_stable_id, candidate.snippet_hash
+            ));
+    }
+    keys.into_iter()
+        .map(|(path, mut keys)| {
+            keys.sort_unstable();
+            let fingerprint = blake3::hash(keys.join("\n").as_bytes())
+                .to_hex()
+                .to_string();
+            (path, fingerprint)
+        })
+        .collect()
+}
+
 #[derive(Debug)]
 struct EmbeddingSnippet {
     symbol_stable_id: String,
@@ -0,0 +1,196 @@
+//! Source files that are not plain UTF-8: UTF-8 with a byte order mark,
+//! UTF-16 (common in older C# and Java trees) and Latin-1. They are
+//! transcoded to UTF-8 before parsing, and the index records the encoding
+//! each file had.
+
+/// Bytes inspected to recognize UTF-16 without a byte order mark.
+const SNIFF_BYTES: usize = 8000;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum SourceEncoding {
+    Utf8,
+    /// UTF-8 led by a byte order mark, which is dropped.
+    Utf8Bom,
+    Utf16Le,
+    Utf16Be,
+    Latin1,
+}
+
+impl SourceEncoding {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Utf8 => "utf-8",
+            Self::Utf8Bom => "utf-8-bom",
+            Self::Utf16Le => "utf-16le",
+            Self::Utf16Be => "utf-16be",
+            Self::Latin1 => "latin-1",
+        }
+    }
+
+    /// Name recorded in the index; plain UTF-8 is not recorded.
+    pub fn recorded(&self) -> Option<&'static str> {
+        (*self != Self::Utf8).then(|| self.as_str())
+    }
+
+    pub fn is_utf16(&self) -> bool {
+        matches!(self, Self::Utf16Le | Self::Utf16Be)
+    }
+}
+
+/// A file's text, transcoded to UTF-8, and the encoding it had.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Decoded {
+    pub text: String,
+    pub encoding: SourceEncoding,
+}
+
+/// The encoding of `content`. A byte order mark decides; without one,
+/// UTF-16 is recognized by the NUL bytes every ASCII character carries, and
+/// content that is not valid UTF-8 is taken as Latin-1.
+pub fn detect(content: &[u8]) -> SourceEncoding {
+    if content.starts_with(&[0xEF, 0xBB, 0xBF]) {
+        return SourceEncoding::Utf8Bom;
+    }
+    if content.starts_with(&[0xFF, 0xFE]) {
+        return SourceEncoding::Utf16Le;
+    }
+    if content.starts_with(&[0xFE, 0xFF]) {
+        return SourceEncoding::Utf16Be;
+    }
+    if let Some(encoding) = sniff_utf16(content) {
+        return encoding;
+    }
+    if std::str::from_utf8(content).is_ok() {
+        SourceEncoding::Utf8
+    } else {
+        SourceEncoding::Latin1
+    }
+}
+
+/// UTF-16 of mostly ASCII text: a NUL in the high byte of at least half the
+/// code units and in none of the low bytes.
+fn sniff_utf16(content: &[u8]) -> Option<SourceEncoding> {
+    if content.len() % 2 != 0 || content.len() < 4 {
+        return None;
+    }
+    let sample = &content[..content.len().min(SNIFF_BYTES)];
+    let units = sample.len() / 2;
+    let even_nuls = sample.iter().step_by(2).filter(|&&b| b == 0).count();
+    let odd_nuls = sample
+        .iter()
+        .skip(1)
+        .step_by(2)
+        .filter(|&&b| b == 0)
+        .count();
+    if odd_nuls * 2 >= units && even_nuls == 0 {
+        Some(SourceEncoding::Utf16Le)
+    } else if even_nuls * 2 >= units && odd_nuls == 0 {
+        Some(SourceEncoding::Utf16Be)
+    } else {
+        None
+    }
+}
+
+/// `content`, in `encoding`, as UTF-8 without a byte order mark; `None`
+/// when it is not valid in that encoding, or holds control characters no
+/// Latin-1 text has.
+pub fn transcode(mut content: Vec<u8>, encoding: SourceEncoding) -> Option<String> {
+    match encoding {
+        SourceEncoding::Utf8 => String::from_utf8(content).ok(),
+        SourceEncoding::Utf8Bom => {
+            content.drain(..3);
+            String::from_utf8(content).ok()
+        }
+        SourceEncoding::Utf16Le | SourceEncoding::Utf16Be => {
+            let bytes = match content.get(..2) {
+                Some([0xFF, 0xFE] | [0xFE, 0xFF]) => &content[2..],
+                _ => &content[..],
+            };
+            if bytes.len() % 2 != 0 {
+                return None;
+            }
+            let units: Vec<u16> = bytes
+                .chunks_exact(2)
+                .map(|pair| match encoding {
+                    SourceEncoding::Utf16Le => u16::from_le_bytes([pair[0], pair[1]]),
+                    _ => u16::from_be_bytes([pair[0], pair[1]]),
+                })
+                .collect();
+            String::from_utf16(&units).ok()
+        }
+        SourceEncoding::Latin1 => {
+            let text_byte = |b: &u8| *b >= 0x20 || matches!(b, b'\t' | b'\n' | b'\r' | 0x0C);
+            content
+                .iter()
+                .all(text_byte)
+                .then(|| content.iter().map(|&b| b as char).collect())
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn utf16(text: &str, little_endian: bool, bom: bool) -> Vec<u8> {
+        let mut bytes = Vec::new();
+        for unit in std::iter::once(0xFEFF)
+            .filter(|_| bom)
+            .chain(text.encode_utf16())
+        {
+            if little_endian {
+                bytes.extend(unit.to_le_bytes());
+            } else {
+                bytes.extend(unit.to_be_bytes());
+            }
+        }
+        bytes
+    }
+
+    fn decode(content: Vec<u8>) -> (Option<String>, SourceEncoding) {
+        let encoding = detect(&content);
+        (transcode(content, encoding), encoding)
+    }
+
+    #[test]
+    fn transcodes_boms_utf16_and_latin1() {
+        let source = "class Café {}\n";
+        assert_eq!(
+            decode(source.as_bytes().to_vec()),
+            (Some(source.to_string()), SourceEncoding::Utf8)
+        );
+        let mut bom = vec![0xEF, 0xBB, 0xBF];
+        bom.extend(source.as_bytes());
+        assert_eq!(
+            decode(bom),
+            (Some(source.to_string()), SourceEncoding::Utf8Bom)
+        );
+        for (little_endian, encoding) in [
+            (true, SourceEncoding::Utf16Le),
+            (false, SourceEncoding::Utf16Be),
+        ] {
+            for bom in [true, false] {
+                assert_eq!(
+                    decode(utf16(source, little_endian, bom)),
+                    (Some(source.to_string()), encoding)
+                );
+            }
+        }
+        assert_eq!(
+            decode(b"class Caf\xe9 {}\n".to_vec()),
+            (Some(source.to_string()), SourceEncoding::Latin1)
+        );
+        assert_eq!(SourceEncoding::Utf8.recorded(), None);
+        assert_eq!(SourceEncoding::Utf16Le.recorded(), Some("utf-16le"));
+    }
+
+    #[test]
+    fn binary_content_is_not_text_in_any_encoding() {
+        assert_eq!(decode(vec![0x7f, b'E', b'L', b'F', 0xff, 0x01]).0, None);
+        // An unpaired surrogate.
+        assert_eq!(
+            transcode(vec![0xFF, 0xFE, 0x00, 0xD8], SourceEncoding::Utf16Le),
+            None
+        );
+    }
+}
@@ -0,0 +1,616 @@
+//! What Go functions do with the errors their calls return.
+//!
+//! Every call whose error result is bound, discarded or returned is a site.
+//! A bound error (`v, err := f()`) is classified by the statement that
+//! follows it: the `if err != nil` block, a `return`, or nothing at all.
+//! The analysis reads one function body at a time and knows no types, so an
+//! error is any last result bound to a name starting or ending in `err`,
+//! and a discarded or `_`-assigned result only counts when the caller says
+//! the callee returns an error.
+
+use crate::parser;
+
+/// Calls that build a new error rather than return one from elsewhere.
+const ERROR_CONSTRUCTORS: &[&str] = &["errors.New", "fmt.Errorf"];
+
+/// Calls that wrap their error argument and keep it inspectable with
+/// `errors.Is`/`errors.As`.
+const WRAPPERS: &[&str] = &[
+    "Wrap",
+    "Wrapf",
+    "WithMessage",
+    "WithMessagef",
+    "WithStack",
+    "Join",
+];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ErrorHandling {
+    /// Returned to the caller unchanged.
+    Propagated,
+    /// Returned wrapped (`%w`, `errors.Wrap`, a custom error type).
+    Wrapped,
+    /// Returned as a new error formatted with `%v`/`%s`: the message
+    /// survives, `errors.Is` does not.
+    Flattened,
+    /// Logged and not returned.
+    Logged,
+    /// Passed to `panic` or a `Fatal` logger.
+    Panicked,
+    /// Checked, then neither returned, logged nor used.
+    Dropped,
+    /// Checked and used some other way (converted to a response, retried,
+    /// collected).
+    Handled,
+    /// Assigned to `_`.
+    Swallowed,
+    /// The call is a statement of its own and its results are discarded.
+    Ignored,
+    /// Bound to a variable that is never read.
+    Unchecked,
+}
+
+impl ErrorHandling {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Propagated => "propagated",
+            Self::Wrapped => "wrapped",
+            Self::Flattened => "flattened",
+            Self::Logged => "logged",
+            Self::Panicked => "panicked",
+            Self::Dropped => "dropped",
+            Self::Handled => "handled",
+            Self::Swallowed => "swallowed",
+            Self::Ignored => "ignored",
+            Self::Unchecked => "unchecked",
+        }
+    }
+
+    /// The error reaches the caller.
+    pub fn propagates(self) -> bool {
+        matches!(self, Self::Propagated | Self::Wrapped | Self::Flattened)
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ErrorSite {
+    /// Line of the call.
+    pub line: u32,
+    /// The called expression, e.g. `json.Marshal` or `h.db.Query`.
+    pub callee: String,
+    pub handling: ErrorHandling,
+    /// Line of the statement that decided the handling.
+    pub handled_at: u32,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct FunctionErrors {
+    /// The last result of the function is an `error`.
+    pub returns_error: bool,
+    /// In line order.
+    pub sites: Vec<ErrorSite>,
+}
+
+/// Error sites of one Go function or method whose source starts on 1-based
+/// `line_start`. `calls_error` tells whether a call, by its callee text,
+/// returns an error, for results that are discarded or assigned to `_`.
+pub fn go_function_errors(
+    content: &str,
+    line_start: u32,
+    calls_error: &dyn Fn(&str) -> bool,
+) -> FunctionErrors {
+    let Ok(tree) = parser::parse_file(content, "go") else {
+        return FunctionErrors::default();
+    };
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let Some(function) = root
+        .named_children(&mut cursor)
+        .find(|node| matches!(node.kind(), "function_declaration" | "method_declaration"))
+    else {
+        return FunctionErrors::default();
+    };
+    let returns_error = function
+        .child_by_field_name("result")
+        .is_some_and(|result| last_result_is_error(text(result, content)));
+    let mut analysis = Analysis {
+        source: content,
+        line_offset: line_start.saturating_sub(1),
+        returns_error,
+        calls_error,
+        sites: Vec::new(),
+    };
+    if let Some(body) = function.child_by_field_name("body") {
+        analysis.block(body);
+    }
+    let mut sites = analysis.sites;
+    sites.sort_by_key(|site| (site.line, site.handled_at));
+    FunctionErrors {
+        returns_error,
+        sites,
+    }
+}
+
+/// Whether a Go function with this signature (`func Load(path string)
+/// (*Config, error)`) returns an error last.
+pub fn signature_returns_error(signature: &str) -> bool {
+    go_function_errors(&format!("{signature} {{}}"), 1, &|_| false).returns_error
+}
+
+/// `error`, `(int, error)` or `(n int, err error)`.
+fn last_result_is_error(result: &str) -> bool {
+    let result = result.trim().trim_end_matches(')').trim_end();
+    result == "error"
+        || result
+            .strip_suffix("error")
+            .is_some_and(|rest| rest.ends_with([' ', ',', '(', '\t']))
+}
+
+fn text<'s>(node: tree_sitter::Node<'_>, source: &'s str) -> &'s str {
+    source.get(node.byte_range()).unwrap_or_default()
+}
+
+/// `log.Printf`, `slog.Error`, `h.logger.Warn`: a call on a logger.
+pub(crate) fn is_logger(callee: &str) -> bool {
+    let Some((receiver, _)) = callee.rsplit_once('.') else {
+        return false;
+    };
+    receiver.split('.').any(|segment| {
+        let segment = segment.to_ascii_lowercase();
+        segment.starts_with("log")
+            || segment.ends_with("logger")
+            || matches!(
+                segment.as_str(),
+                "slog" | "zap" | "zerolog" | "klog" | "glog"
+            )
+    })
+}
+
+fn is_error_name(name: &str) -> bool {
+    let lower = name.to_ascii_lowercase();
+    lower.starts_with("err") || lower.ends_with("err")
+}
+
+/// Statements of a block; newer grammars nest them in a `statement_list`.
+fn statements(block: tree_sitter::Node<'_>) -> Vec<tree_sitter::Node<'_>> {
+    let mut cursor = block.walk();
+    let mut statements = Vec::new();
+    for child in block.named_children(&mut cursor) {
+        if child.kind() == "statement_list" {
+            let mut inner = child.walk();
+            statements.extend(child.named_children(&mut inner));
+        } else {
+            statements.push(child);
+        }
+    }
+    statements
+}
+
+/// The single call on the right of an assignment.
+fn sole_call(list: tree_sitter::Node<'_>) -> Option<tree_sitter::Node<'_>> {
+    let node = if list.kind() == "expression_list" {
+        if list.named_child_count() != 1 {
+            return None;
+        }
+        list.named_child(0)?
+    } else {
+        list
+    };
+    (node.kind() == "call_expression").then_some(node)
+}
+
+fn last_named_child(node: tree_sitter::Node<'_>) -> Option<tree_sitter::Node<'_>> {
+    node.named_child(node.named_child_count().checked_sub(1)?)
+}
+
+/// Whether `node` mentions the identifier `name`, outside nested closures.
+fn mentions(node: tree_sitter::Node<'_>, source: &str, name: &str) -> bool {
+    if node.kind() == "identifier" {
+        return text(node, source) == name;
+    }
+    if node.kind() == "func_literal" {
+        return false;
+    }
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .any(|child| mentions(child, source, name))
+}
+
+/// Every node of `kind` under `node`, outside nested closures.
+fn descendants<'t>(
+    node: tree_sitter::Node<'t>,
+    kind: &str,
+    found: &mut Vec<tree_sitter::Node<'t>>,
+) {
+    if node.kind() == kind {
+        found.push(node);
+    }
+    if node.kind() == "func_literal" {
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        descendants(child, kind, found);
+    }
+}
+
+struct Analysis<'a> {
+    source: &'a str,
+    line_offset: u32,
+    returns_error: bool,
+    calls_error: &'a dyn Fn(&str) -> bool,
+    sites: Vec<ErrorSite>,
+}
+
+impl Analysis<'_> {
+    fn line(&self, node: tree_sitter::Node<'_>) -> u32 {
+        node.start_position().row as u32 + 1 + self.line_offset
+    }
+
+    fn mentions_error(&self, node: tree_sitter::Node<'_>) -> bool {
+        if node.kind() == "identifier" {
+            return is_error_name(text(node, self.source));
+        }
+        let mut cursor = node.walk();
+        node.named_children(&mut cursor)
+            .any(|child| self.mentions_error(child))
+    }
+
+    fn callee(&self, call: tree_sitter::Node<'_>) -> String {
+        call.child_by_field_name("function")
+            .map(|function| text(function, self.source).to_string())
+            .unwrap_or_default()
+    }
+
+    fn push(
+        &mut self,
+        call: tree_sitter::Node<'_>,
+        handling: ErrorHandling,
+        at: tree_sitter::Node<'_>,
+    ) {
+        let site = ErrorSite {
+            line: self.line(call),
+            callee: self.callee(call),
+            handling,
+            handled_at: self.line(at),
+        };
+        self.sites.push(site);
+    }
+
+    fn block(&mut self, block: tree_sitter::Node<'_>) {
+        let statements = statements(block);
+        for (idx, statement) in statements.iter().enumerate() {
+            self.statement(*statement, &statements[idx + 1..]);
+        }
+    }
+
+    fn statement(&mut self, statement: tree_sitter::Node<'_>, rest: &[tree_sitter::Node<'_>]) {
+        match statement.kind() {
+            "short_var_declaration" | "assignment_statement" => {
+                self.binding(statement, rest.first().copied(), rest);
+            }
+            "if_statement" => {
+                if let Some(initializer) = statement.child_by_field_name("initializer")
+                    && matches!(
+                        initializer.kind(),
+                        "short_var_declaration" | "assignment_statement"
+                    )
+                {
+                    self.binding(initializer, Some(statement), &[]);
+                }
+            }
+            "expression_statement" => {
+                if let Some(call) = statement
+                    .named_child(0)
+                    .filter(|node| node.kind() == "call_expression")
+                    && (self.calls_error)(&self.callee(call))
+                {
+                    self.push(call, ErrorHandling::Ignored, statement);
+                }
+            }
+            "return_statement" => {
+                if self.returns_error
+                    && let Some(call) = statement
+                        .named_child(0)
+                        .and_then(last_named_child_or_self)
+                        .filter(|node| node.kind() == "call_expression")
+                {
+                    let callee = self.callee(call);
+                    // Constructors and wrappers, including custom ones that
+                    // take the error being handled, build the returned error.
+                    let builds_error = ERROR_CONSTRUCTORS.contains(&callee.as_str())
+                        || WRAPPERS
+                            .iter()
+                            .any(|wrapper| callee.rsplit('.').next() == Some(wrapper))
+                        || call
+                            .child_by_field_name("arguments")
+                            .is_some_and(|arguments| self.mentions_error(arguments));
+                    if !builds_error {
+                        self.push(call, ErrorHandling::Propagated, statement);
+                    }
+                }
+            }
+            _ => {}
+        }
+        self.nested_blocks(statement);
+    }
+
+    /// Blocks inside a statement (`if`, `for`, `switch` bodies, closures).
+    fn nested_blocks(&mut self, node: tree_sitter::Node<'_>) {
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            if child.kind() == "block" {
+                self.block(child);
+            } else if child.kind() == "if_statement" {
+                // `else if`
+                self.statement(child, &[]);
+            } else if matches!(
+                child.kind(),
+                "expression_case"
+                    | "default_case"
+                    | "type_case"
+                    | "communication_case"
+                    | "statement_list"
+            ) {
+                let statements = statements(child);
+                for (idx, statement) in statements.iter().enumerate() {
+                    self.statement(*statement, &statements[idx + 1..]);
+                }
+            } else {
+                self.nested_blocks(child);
+            }
+        }
+    }
+
+    /// `v, err := f()` followed by `next`; `rest` are the statements after
+    /// the binding in the same block.
+    fn binding(
+        &mut self,
+        binding: tree_sitter::Node<'_>,
+        next: Option<tree_sitter::Node<'_>>,
+        rest: &[tree_sitter::Node<'_>],
+    ) {
+        let (Some(left), Some(right)) = (
+            binding.child_by_field_name("left"),
+            binding.child_by_field_name("right"),
+        ) else {
+            return;
+        };
+        let Some(call) = sole_call(right) else {
+            return;
+        };
+        let last = last_named_child(left).unwrap_or(left);
+        let name = text(last, self.source);
+        if name == "_" {
+            if (self.calls_error)(&self.callee(call)) {
+                self.push(call, ErrorHandling::Swallowed, binding);
+            }
+            return;
+        }
+        if last.kind() != "identifier" || !is_error_name(name) {
+            return;
+        }
+        let name = name.to_string();
+        match next {
+            Some(statement)
+                if statement.kind() == "if_statement"
+                    && statement
+                        .child_by_field_name("condition")
+                        .is_some_and(|condition| mentions(condition, self.source, &name)) =>
+            {
+                let handling = self.if_handling(statement, &name);
+                self.push(call, handling, statement);
+            }
+            Some(statement)
+                if statement.kind() == "return_statement"
+                    && mentions(statement, self.source, &name) =>
+            {
+                let handling = self
+                    .return_handling(statement, &name)
+                    .unwrap_or(ErrorHandling::Handled);
+                self.push(call, handling, statement);
+            }
+            _ => {
+                let used = rest
+                    .iter()
+                    .find(|statement| mentions(**statement, self.source, &name))
+                    .copied();
+                match used {
+                    Some(statement) => self.push(call, ErrorHandling::Handled, statement),
+                    None => self.push(call, ErrorHandling::Unchecked, binding),
+                }
+            }
+        }
+    }
+
+    /// The block that runs on error: the consequence of `err != nil`, the
+    /// alternative of `err == nil`.
+    fn if_handling(&self, statement: tree_sitter::Node<'_>, name: &str) -> ErrorHandling {
+        let condition = statement
+            .child_by_field_name("condition")
+            .map(|condition| text(condition, self.source))
+            .unwrap_or_default();
+        let inverted = condition.contains("== nil") && !condition.contains("!= nil");
+        let branch = if inverted {
+            statement.child_by_field_name("alternative")
+        } else {
+            statement.child_by_field_name("consequence")
+        };
+        match branch {
+            Some(branch) => self.branch_handling(branch, name),
+            None => ErrorHandling::Handled,
+        }
+    }
+
+    fn branch_handling(&self, branch: tree_sitter::Node<'_>, name: &str) -> ErrorHandling {
+        let mut calls = Vec::new();
+        descendants(branch, "call_expression", &mut calls);
+        let mut logged = false;
+        for call in &calls {
+            let callee = self.callee(*call);
+            let Some(arguments) = call.child_by_field_name("arguments") else {
+                continue;
+            };
+            if !mentions(arguments, self.source, name) {
+                continue;
+            }
+            let method = callee.rsplit('.').next().unwrap_or_default();
+            if callee == "panic" || method.starts_with("Fatal") || method.starts_with("Panic") {
+                return ErrorHandling::Panicked;
+            }
+            if is_logger(&callee) {
+                logged = true;
+            }
+        }
+        let mut returns = Vec::new();
+        descendants(branch, "return_statement", &mut returns);
+        if let Some(handling) = returns
+            .iter()
+            .find_map(|statement| self.return_handling(*statement, name))
+        {
+            return handling;
+        }
+        if logged {
+            ErrorHandling::Logged
+        } else if mentions(branch, self.source, name) {
+            ErrorHandling::Handled
+        } else {
+            ErrorHandling::Dropped
+        }
+    }
+
+    /// How a `return` hands the error `name` to the caller, if it does.
+    fn return_handling(
+        &self,
+        statement: tree_sitter::Node<'_>,
+        name: &str,
+    ) -> Option<ErrorHandling> {
+        if !self.returns_error {
+            return None;
+        }
+        let value = statement
+            .named_child(0)
+            .and_then(last_named_child_or_self)?;
+        if value.kind() == "identifier" {
+            return (text(value, self.source) == name).then_some(ErrorHandling::Propagated);
+        }
+        if value.kind() != "call_expression" || !mentions(value, self.source, name) {
+            return None;
+        }
+        let callee = self.callee(value);
+        if callee == "fmt.Errorf" {
+            let format = value
+                .child_by_field_name("arguments")
+                .and_then(|arguments| arguments.named_child(0))
+                .map(|format| text(format, self.source))
+                .unwrap_or_default();
+            return Some(if format.contains("%w") {
+                ErrorHandling::Wrapped
+            } else {
+                ErrorHandling::Flattened
+            });
+        }
+        Some(ErrorHandling::Wrapped)
+    }
+}
+
+/// The last expression of a `return` list, or the expression itself.
+fn last_named_child_or_self(node: tree_sitter::Node<'_>) -> Option<tree_sitter::Node<'_>> {
+    if node.kind() == "expression_list" {
+        last_named_child(node)
+    } else {
+        Some(node)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn handlings(source: &str, discards: &[&str]) -> (bool, Vec<(u32, String, &'static str)>) {
+        let errors = go_function_errors(source, 10, &|callee| discards.contains(&callee));
+        let sites = errors
+            .sites
+            .into_iter()
+            .map(|site| (site.line, site.callee, site.handling.as_str()))
+            .collect();
+        (errors.returns_error, sites)
+    }
+
+    #[test]
+    fn classifies_error_handling_per_call() {
+        let source = r#"func (s *Store) Save(ctx context.Context, u User) (int64, error) {
+	body, _ := json.Marshal(u)
+	if err := s.validate(u); err != nil {
+		return 0, err
+	}
+	id, err := s.db.Exec(ctx, string(body))
+	if err != nil {
+		return 0, fmt.Errorf("save %s: %w", u.Name, err)
+	}
+	if _, err := s.cache.Put(id); err != nil {
+		log.Printf("cache: %v", err)
+	}
+	rows, err := s.db.Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("count: %v", err)
+	}
+	s.audit.Record(id)
+	_, err = s.index.Add(id)
+	return id + rows, s.flush(ctx)
+}
+"#;
+        let (returns_error, sites) = handlings(source, &["json.Marshal", "s.audit.Record"]);
+        assert!(returns_error);
+        assert_eq!(
+            sites,
+            [
+                (11, "json.Marshal".to_string(), "swallowed"),
+                (12, "s.validate".to_string(), "propagated"),
+                (15, "s.db.Exec".to_string(), "wrapped"),
+                (19, "s.cache.Put".to_string(), "logged"),
+                (22, "s.db.Count".to_string(), "flattened"),
+                (26, "s.audit.Record".to_string(), "ignored"),
+                (27, "s.index.Add".to_string(), "unchecked"),
+                (28, "s.flush".to_string(), "propagated"),
+            ]
+        );
+    }
+
+    #[test]
+    fn errors_turned_into_responses_are_handled_or_dropped() {
+        let source = r#"func (h *Handler) Get(id string) *Response {
+	row, err := h.db.Query(id)
+	if err != nil {
+		return errorResponse(500, err.Error())
+	}
+	if err := h.touch(id); err != nil {
+		return errorResponse(500, "touch failed")
+	}
+	return ok(row)
+}
+"#;
+        let (returns_error, sites) = handlings(source, &[]);
+        assert!(!returns_error);
+        assert_eq!(
+            sites,
+            [
+                (11, "h.db.Query".to_string(), "handled"),
+                (15, "h.touch".to_string(), "dropped"),
+            ]
+        );
+    }
+
+    #[test]
+    fn reads_error_results() {
+        assert!(last_result_is_error("error"));
+        assert!(last_result_is_error("(*Claims, error)"));
+        assert!(last_result_is_error("(n int, err error)"));
+        assert!(!last_result_is_error("*Response"));
+        assert!(!last_result_is_error("myerror"));
+        assert!(signature_returns_error(
+            "func (h *Handler) authenticate(req *Request) (*Claims, error)"
+        ));
+        assert!(!signature_returns_error("func report(err error)"));
+    }
+}
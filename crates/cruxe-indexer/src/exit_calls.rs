@@ -0,0 +1,261 @@
+//! Calls that end a Go program or unwind its stack: `os.Exit`, `panic` and
+//! the `Fatal`/`Panic` methods of loggers, read one function body at a time.
+//!
+//! A panic counts as recovered when the function it is raised in defers a
+//! call to `recover()` or to a helper whose name says it recovers. Inside a
+//! `go func() { ... }()` literal only the literal's own deferred calls
+//! count, since a panic never unwinds past the goroutine it started in.
+
+use crate::error_flow::is_logger;
+use crate::parser;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ExitKind {
+    /// `os.Exit`, `log.Fatalf`: the process ends without running deferred
+    /// calls.
+    Exit,
+    /// `panic`, `log.Panicf`: the stack unwinds until a deferred
+    /// `recover()`, and the process ends when there is none.
+    Panic,
+}
+
+impl ExitKind {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Exit => "exit",
+            Self::Panic => "panic",
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ExitCall {
+    pub line: u32,
+    /// The called expression, e.g. `log.Fatalf` or `panic`.
+    pub call: String,
+    pub kind: ExitKind,
+    /// Made inside a `go func() { ... }()` literal.
+    pub in_goroutine: bool,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct FunctionExits {
+    /// In line order, without the panics the function recovers.
+    pub calls: Vec<ExitCall>,
+    /// The function defers a recover, so panics raised by its callees stop
+    /// in it.
+    pub recovers: bool,
+}
+
+/// Exit calls of one Go function or method whose source starts on 1-based
+/// `line_start`.
+pub fn go_function_exits(content: &str, line_start: u32) -> FunctionExits {
+    let Ok(tree) = parser::parse_file(content, "go") else {
+        return FunctionExits::default();
+    };
+    let root = tree.root_node();
+    let mut cursor = root.walk();
+    let Some(body) = root
+        .named_children(&mut cursor)
+        .find(|node| matches!(node.kind(), "function_declaration" | "method_declaration"))
+        .and_then(|function| function.child_by_field_name("body"))
+    else {
+        return FunctionExits::default();
+    };
+    let recovers = defers_recover(body, content);
+    let mut scan = Scan {
+        source: content,
+        line_offset: line_start.saturating_sub(1),
+        calls: Vec::new(),
+    };
+    scan.node(body, false, recovers);
+    let mut calls = scan.calls;
+    calls.sort_by_key(|call| call.line);
+    FunctionExits { calls, recovers }
+}
+
+/// How a call ends the program, by its callee text.
+fn exit_kind(callee: &str) -> Option<ExitKind> {
+    match callee {
+        "panic" => return Some(ExitKind::Panic),
+        "os.Exit" | "syscall.Exit" => return Some(ExitKind::Exit),
+        _ => {}
+    }
+    let (_, method) = callee.rsplit_once('.')?;
+    if !is_logger(callee) {
+        return None;
+    }
+    match method {
+        "Fatal" | "Fatalf" | "Fatalln" | "Fatalw" => Some(ExitKind::Exit),
+        "Panic" | "Panicf" | "Panicln" | "Panicw" => Some(ExitKind::Panic),
+        _ => None,
+    }
+}
+
+fn text<'s>(node: tree_sitter::Node<'_>, source: &'s str) -> &'s str {
+    source.get(node.byte_range()).unwrap_or_default()
+}
+
+/// Whether `body` defers a recover outside nested closures.
+fn defers_recover(body: tree_sitter::Node<'_>, source: &str) -> bool {
+    if body.kind() == "defer_statement" {
+        return calls_recover(body, source);
+    }
+    if body.kind() == "func_literal" {
+        return false;
+    }
+    let mut cursor = body.walk();
+    body.named_children(&mut cursor)
+        .any(|child| defers_recover(child, source))
+}
+
+/// `recover()`, or a helper such as `defer recoverPanic(w)`.
+fn calls_recover(node: tree_sitter::Node<'_>, source: &str) -> bool {
+    if node.kind() == "call_expression"
+        && let Some(function) = node.child_by_field_name("function")
+    {
+        let name = text(function, source)
+            .rsplit('.')
+            .next()
+            .unwrap_or_default();
+        if name.to_ascii_lowercase().contains("recover") {
+            return true;
+        }
+    }
+    let mut cursor = node.walk();
+    node.named_children(&mut cursor)
+        .any(|child| calls_recover(child, source))
+}
+
+/// `go func() { ... }()`.
+fn starts_goroutine(literal: tree_sitter::Node<'_>) -> bool {
+    literal.parent().is_some_and(|call| {
+        call.kind() == "call_expression"
+            && call.child_by_field_name("function") == Some(literal)
+            && call
+                .parent()
+                .is_some_and(|statement| statement.kind() == "go_statement")
+    })
+}
+
+struct Scan<'a> {
+    source: &'a str,
+    line_offset: u32,
+    calls: Vec<ExitCall>,
+}
+
+impl Scan<'_> {
+    fn node(&mut self, node: tree_sitter::Node<'_>, in_goroutine: bool, recovers: bool) {
+        if node.kind() == "func_literal" {
+            let Some(body) = node.child_by_field_name("body") else {
+                return;
+            };
+            let own = defers_recover(body, self.source);
+            // Other literals run on the stack of whoever calls them, which
+            // the enclosing function's recover covers as well.
+            if starts_goroutine(node) {
+                self.node(body, true, own);
+            } else {
+                self.node(body, in_goroutine, recovers || own);
+            }
+            return;
+        }
+        if node.kind() == "call_expression"
+            && let Some(function) = node.child_by_field_name("function")
+        {
+            let callee = text(function, self.source);
+            if let Some(kind) = exit_kind(callee)
+                && !(kind == ExitKind::Panic && recovers)
+            {
+                self.calls.push(ExitCall {
+                    line: node.start_position().row as u32 + 1 + self.line_offset,
+                    call: callee.to_string(),
+                    kind,
+                    in_goroutine,
+                });
+            }
+        }
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            self.node(child, in_goroutine, recovers);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn calls(exits: &FunctionExits) -> Vec<(u32, &str, &str, bool)> {
+        exits
+            .calls
+            .iter()
+            .map(|call| {
+                (
+                    call.line,
+                    call.call.as_str(),
+                    call.kind.as_str(),
+                    call.in_goroutine,
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn finds_exits_and_unrecovered_panics() {
+        let source = r#"func main() {
+	cfg, err := load()
+	if err != nil {
+		log.Fatalf("load: %v", err)
+	}
+	go func() {
+		if err := serve(cfg); err != nil {
+			logger.Fatal("serve", err)
+		}
+	}()
+	if cfg.Strict {
+		panic("strict mode")
+	}
+	t.Fatal("not a logger")
+	os.Exit(run(cfg))
+}"#;
+        let exits = go_function_exits(source, 20);
+        assert!(!exits.recovers);
+        assert_eq!(
+            calls(&exits),
+            [
+                (23, "log.Fatalf", "exit", false),
+                (27, "logger.Fatal", "exit", true),
+                (31, "panic", "panic", false),
+                (34, "os.Exit", "exit", false),
+            ]
+        );
+    }
+
+    #[test]
+    fn deferred_recover_covers_panics_outside_goroutines() {
+        let source = r#"func (s *Server) Handle(w http.ResponseWriter, r *http.Request) {
+	defer s.recoverPanic(w)
+	if r.Body == nil {
+		panic("no body")
+	}
+	go func() {
+		panic("background")
+	}()
+	go func() {
+		defer func() { _ = recover() }()
+		panic("guarded")
+	}()
+	log.Fatal("still exits")
+}"#;
+        let exits = go_function_exits(source, 1);
+        assert!(exits.recovers);
+        assert_eq!(
+            calls(&exits),
+            [
+                (7, "panic", "panic", true),
+                (13, "log.Fatal", "exit", false),
+            ]
+        );
+    }
+}
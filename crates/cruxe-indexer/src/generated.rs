@@ -0,0 +1,126 @@
+//! Generated code: files whose header says so (`// Code generated ... DO
+//! NOT EDIT.`, `@generated`, protoc's `Generated by the protocol buffer
+//! compiler. DO NOT EDIT!`), protobuf/gRPC stubs, mocks and the usual
+//! generator output names.
+//!
+//! Symbols of generated files stay in the graph as call targets; dead-code,
+//! complexity and duplicate analyses leave them out unless asked.
+
+use regex::Regex;
+use std::sync::LazyLock;
+
+/// Header lines searched for a marker. Go requires the marker before the
+/// package clause; other generators put it in the first few lines.
+const HEADER_LINES: usize = 30;
+
+static HEADER_MARKER: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(
+        r"(?i)(\b(code generated|generated by|auto-?generated)\b.*\bdo not edit\b|@generated\b|<auto-generated)",
+    )
+    .expect("generated header regex")
+});
+
+/// Why `path` is generated code (`header`, `protobuf`, `mock` or `name`);
+/// `None` for hand-written files.
+pub fn generated_reason(path: &str, content: &str) -> Option<&'static str> {
+    let file_name = path.rsplit('/').next().unwrap_or(path);
+    if [
+        ".pb.go",
+        ".pb.gw.go",
+        "_pb2.py",
+        "_pb2_grpc.py",
+        "_pb.js",
+        "_pb.d.ts",
+    ]
+    .iter()
+    .any(|suffix| file_name.ends_with(suffix))
+    {
+        return Some("protobuf");
+    }
+    if content
+        .lines()
+        .take(HEADER_LINES)
+        .any(|line| is_comment(line) && HEADER_MARKER.is_match(line))
+    {
+        return Some("header");
+    }
+    let stem = file_name.split('.').next().unwrap_or(file_name);
+    let in_mocks_dir = path
+        .split('/')
+        .rev()
+        .skip(1)
+        .any(|dir| dir == "mocks" || dir == "__mocks__");
+    if in_mocks_dir
+        || stem.starts_with("mock_")
+        || stem.ends_with("_mock")
+        || stem.ends_with("_mocks")
+    {
+        return Some("mock");
+    }
+    if stem.starts_with("zz_generated")
+        || stem.ends_with("_gen")
+        || stem.ends_with("_generated")
+        || file_name.ends_with(".gen.go")
+        || file_name.ends_with(".generated.ts")
+    {
+        return Some("name");
+    }
+    None
+}
+
+/// Markers only count in comments, so a string mentioning one does not
+/// mark the file.
+fn is_comment(line: &str) -> bool {
+    let line = line.trim_start();
+    ["//", "#", "/*", "*", "<!--", "--", ";"]
+        .iter()
+        .any(|prefix| line.starts_with(prefix))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn headers_stubs_mocks_and_generator_names_are_generated() {
+        let header = "// Code generated by stringer -type=Kind; DO NOT EDIT.\n\npackage kind\n";
+        assert_eq!(
+            generated_reason("kind/kind_string.go", header),
+            Some("header")
+        );
+        assert_eq!(
+            generated_reason("api/schema.py", "# @generated by codegen\nclass A: ...\n"),
+            Some("header")
+        );
+        assert_eq!(
+            generated_reason("api/api.pb.go", "package api\n"),
+            Some("protobuf")
+        );
+        assert_eq!(generated_reason("api/api_pb2.py", ""), Some("protobuf"));
+        assert_eq!(
+            generated_reason("store/mocks/store.go", "package mocks\n"),
+            Some("mock")
+        );
+        assert_eq!(
+            generated_reason("store/mock_store.go", "package store\n"),
+            Some("mock")
+        );
+        assert_eq!(
+            generated_reason("store/store_mock.go", "package store\n"),
+            Some("mock")
+        );
+        assert_eq!(
+            generated_reason("apis/v1/zz_generated.deepcopy.go", "package v1\n"),
+            Some("name")
+        );
+        assert_eq!(
+            generated_reason("db/queries.gen.go", "package db\n"),
+            Some("name")
+        );
+
+        let handwritten = "package lint\n\nconst marker = \"Code generated by x; DO NOT EDIT.\"\n";
+        assert_eq!(generated_reason("lint/marker.go", handwritten), None);
+        assert_eq!(generated_reason("mocks.go", "package store\n"), None);
+        assert_eq!(generated_reason("store/store.go", "package store\n"), None);
+    }
+}
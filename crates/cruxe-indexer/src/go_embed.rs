@@ -0,0 +1,391 @@
+//! `//go:embed` directives and the files they capture. Directives are read
+//! from Go source when the file is indexed; resolving them against the
+//! working tree waits until every file is written, since the captured files
+//! change without the Go file changing.
+//!
+//! Resolution follows the `embed` package: patterns are relative to the Go
+//! file's directory and `*` does not cross `/`. A matched directory brings in
+//! its whole tree except names starting with `.` or `_`, unless the pattern
+//! has an `all:` prefix, and stops at nested modules.
+
+use cruxe_core::types::{EmbedRecord, EmbeddedFile};
+use globset::Glob;
+use regex::Regex;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+/// Calls that take an embedded FS as a whole, to serve or walk it. Files of
+/// an FS passed to one are not expected to be named anywhere.
+const WHOLESALE_CALLS: &[&str] = &[
+    "FS",
+    "FileServerFS",
+    "ServeFileFS",
+    "Sub",
+    "ParseFS",
+    "Glob",
+    "WalkDir",
+    "ReadDir",
+];
+
+/// Extensions of embedded files searched for references to their siblings,
+/// e.g. a stylesheet naming an image.
+const TEXT_EXTENSIONS: &[&str] = &[
+    "html", "htm", "css", "js", "mjs", "json", "svg", "xml", "txt", "md", "tmpl", "tpl", "gohtml",
+    "gotmpl", "yaml", "yml", "toml", "sql",
+];
+
+/// Embedded text files larger than this are not searched for references.
+const MAX_TEXT_SIZE: u64 = 1024 * 1024;
+
+/// `//go:embed` directives of a Go source, each attached to the variable
+/// declared right after it. Files are left empty until [`resolve_embeds`].
+pub fn extract_embeds(repo: &str, ref_name: &str, path: &str, source: &str) -> Vec<EmbedRecord> {
+    let mut records = Vec::new();
+    let mut pending: Option<(u32, Vec<String>)> = None;
+    let mut in_var_block = false;
+    for (idx, line) in source.lines().enumerate() {
+        let trimmed = line.trim();
+        if let Some(rest) = trimmed.strip_prefix("//go:embed") {
+            if rest.starts_with([' ', '\t']) {
+                let (_, patterns) = pending.get_or_insert_with(|| (idx as u32 + 1, Vec::new()));
+                patterns.extend(split_patterns(rest));
+            }
+            continue;
+        }
+        // Only blank lines and line comments may sit between the directives
+        // and the variable.
+        if trimmed.is_empty() || trimmed.starts_with("//") {
+            continue;
+        }
+        let directive = pending.take();
+        let variable = declared_variable(trimmed, in_var_block);
+        if trimmed.starts_with("var (") {
+            in_var_block = true;
+        } else if trimmed.starts_with(')') {
+            in_var_block = false;
+        }
+        if let (Some((line, patterns)), Some(variable)) = (directive, variable) {
+            records.push(EmbedRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line,
+                variable,
+                patterns,
+                files: Vec::new(),
+                missing: Vec::new(),
+                served: false,
+            });
+        }
+    }
+    records
+}
+
+/// Fill in the files, missing patterns and reference flags of `records`
+/// from the working tree at `repo_root`.
+pub fn resolve_embeds(repo_root: &Path, records: &mut [EmbedRecord]) {
+    for record in records.iter_mut() {
+        let dir = Path::new(&record.path)
+            .parent()
+            .map(Path::to_path_buf)
+            .unwrap_or_default();
+        // Path -> (size, named by the pattern itself).
+        let mut captured: BTreeMap<String, (u64, bool)> = BTreeMap::new();
+        record.missing.clear();
+        for pattern in &record.patterns {
+            let matched = match_pattern(repo_root, &dir, pattern);
+            if matched.is_empty() {
+                record.missing.push(pattern.clone());
+            }
+            for (path, size, literal) in matched {
+                captured.entry(path).or_insert((size, false)).1 |= literal;
+            }
+        }
+
+        let sources = package_sources(repo_root, &dir);
+        record.served = uses_wholesale(&sources, &record.variable);
+        let texts: Vec<(&str, String)> = captured
+            .iter()
+            .filter(|(path, (size, _))| *size <= MAX_TEXT_SIZE && is_text(path))
+            .filter_map(|(path, _)| {
+                let text = std::fs::read_to_string(repo_root.join(path)).ok()?;
+                Some((path.as_str(), text))
+            })
+            .collect();
+        record.files = captured
+            .iter()
+            .map(|(path, (size, literal))| {
+                let name = path.rsplit('/').next().unwrap_or(path);
+                let referenced = *literal
+                    || sources.contains(name)
+                    || texts
+                        .iter()
+                        .any(|(other, text)| *other != path.as_str() && text.contains(name));
+                EmbeddedFile {
+                    path: path.clone(),
+                    size: *size,
+                    referenced,
+                }
+            })
+            .collect();
+    }
+}
+
+/// Split the arguments of a directive; patterns may be quoted with `"` or
+/// backquotes to hold spaces.
+fn split_patterns(args: &str) -> Vec<String> {
+    let mut patterns = Vec::new();
+    let mut chars = args.chars().peekable();
+    while let Some(&c) = chars.peek() {
+        if c.is_whitespace() {
+            chars.next();
+            continue;
+        }
+        let mut pattern = String::new();
+        match c {
+            '"' | '`' => {
+                chars.next();
+                while let Some(next) = chars.next() {
+                    match next {
+                        '\\' if c == '"' => pattern.extend(chars.next()),
+                        next if next == c => break,
+                        next => pattern.push(next),
+                    }
+                }
+            }
+            _ => {
+                while let Some(&next) = chars.peek() {
+                    if next.is_whitespace() {
+                        break;
+                    }
+                    pattern.push(next);
+                    chars.next();
+                }
+            }
+        }
+        if !pattern.is_empty() {
+            patterns.push(pattern);
+        }
+    }
+    patterns
+}
+
+/// Name declared by `var name T` or, inside a `var (...)` block, `name T`.
+fn declared_variable(line: &str, in_var_block: bool) -> Option<String> {
+    let rest = match line.strip_prefix("var ") {
+        Some(rest) => rest.trim_start(),
+        None if in_var_block => line,
+        None => return None,
+    };
+    let name: String = rest
+        .chars()
+        .take_while(|c| c.is_alphanumeric() || *c == '_')
+        .collect();
+    let is_declaration = !name.is_empty() && rest[name.len()..].starts_with([' ', '\t']);
+    is_declaration.then_some(name)
+}
+
+/// Files a pattern captures, repo-relative, with their size and whether the
+/// pattern names the file itself rather than a directory or wildcard.
+fn match_pattern(repo_root: &Path, dir: &Path, pattern: &str) -> Vec<(String, u64, bool)> {
+    let (include_hidden, pattern) = match pattern.strip_prefix("all:") {
+        Some(pattern) => (true, pattern),
+        None => (false, pattern),
+    };
+    let segments: Vec<&str> = pattern.split('/').collect();
+    if pattern.is_empty() || segments.iter().any(|s| matches!(*s, "" | "." | "..")) {
+        return Vec::new();
+    }
+    let mut current = vec![dir.to_path_buf()];
+    for segment in &segments {
+        let Ok(glob) = Glob::new(segment) else {
+            return Vec::new();
+        };
+        let matcher = glob.compile_matcher();
+        let mut next = Vec::new();
+        for parent in &current {
+            let Ok(entries) = std::fs::read_dir(repo_root.join(parent)) else {
+                continue;
+            };
+            for entry in entries.flatten() {
+                let name = entry.file_name().to_string_lossy().to_string();
+                if matcher.is_match(&name) {
+                    next.push(parent.join(name));
+                }
+            }
+        }
+        next.sort();
+        current = next;
+    }
+
+    let literal = !pattern.contains(['*', '?', '[', '\\']);
+    let mut files = Vec::new();
+    for path in current {
+        let full = repo_root.join(&path);
+        if full.is_dir() {
+            collect_tree(repo_root, &path, include_hidden, &mut files);
+        } else if let Ok(metadata) = std::fs::metadata(&full) {
+            files.push((to_slash(&path), metadata.len(), literal));
+        }
+    }
+    files
+}
+
+/// Every file under `dir`, skipping `.`/`_` names unless `include_hidden`
+/// and directories of other modules.
+fn collect_tree(
+    repo_root: &Path,
+    dir: &Path,
+    include_hidden: bool,
+    files: &mut Vec<(String, u64, bool)>,
+) {
+    let Ok(entries) = std::fs::read_dir(repo_root.join(dir)) else {
+        return;
+    };
+    let mut entries: Vec<_> = entries.flatten().collect();
+    entries.sort_by_key(|entry| entry.file_name());
+    for entry in entries {
+        let name = entry.file_name().to_string_lossy().to_string();
+        if !include_hidden && (name.starts_with('.') || name.starts_with('_')) {
+            continue;
+        }
+        let path: PathBuf = dir.join(&name);
+        let Ok(file_type) = entry.file_type() else {
+            continue;
+        };
+        if file_type.is_dir() {
+            if !entry.path().join("go.mod").exists() {
+                collect_tree(repo_root, &path, include_hidden, files);
+            }
+        } else if file_type.is_file()
+            && let Ok(metadata) = entry.metadata()
+        {
+            files.push((to_slash(&path), metadata.len(), false));
+        }
+    }
+}
+
+/// Non-test Go sources of the package in `dir`, concatenated.
+fn package_sources(repo_root: &Path, dir: &Path) -> String {
+    let mut sources = String::new();
+    let Ok(entries) = std::fs::read_dir(repo_root.join(dir)) else {
+        return sources;
+    };
+    for entry in entries.flatten() {
+        let name = entry.file_name().to_string_lossy().to_string();
+        if name.ends_with(".go")
+            && !name.ends_with("_test.go")
+            && let Ok(source) = std::fs::read_to_string(entry.path())
+        {
+            sources.push_str(&source);
+            sources.push('\n');
+        }
+    }
+    sources
+}
+
+fn uses_wholesale(sources: &str, variable: &str) -> bool {
+    let variable = regex::escape(variable);
+    let pattern = format!(
+        r"\b(?:{})\(\s*&?{variable}\b|\b{variable}\.ReadDir\(",
+        WHOLESALE_CALLS.join("|")
+    );
+    Regex::new(&pattern).is_ok_and(|regex| regex.is_match(sources))
+}
+
+fn is_text(path: &str) -> bool {
+    path.rsplit_once('.').is_some_and(|(_, ext)| {
+        TEXT_EXTENSIONS
+            .iter()
+            .any(|known| known.eq_ignore_ascii_case(ext))
+    })
+}
+
+fn to_slash(path: &Path) -> String {
+    path.to_string_lossy().replace('\\', "/")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+
+    #[test]
+    fn directives_attach_to_the_next_variable() {
+        let source = r#"package web
+
+import "embed"
+
+//go:embed static "with space.txt"
+//go:embed `raw.txt`
+var assets embed.FS
+
+var (
+	//go:embed all:_private
+	private embed.FS
+)
+
+//go:embed orphan.txt
+func notAVariable() {}
+"#;
+        let records = extract_embeds("repo", "main", "web/web.go", source);
+        assert_eq!(records.len(), 2);
+        assert_eq!(records[0].line, 5);
+        assert_eq!(records[0].variable, "assets");
+        assert_eq!(records[0].patterns, ["static", "with space.txt", "raw.txt"]);
+        assert_eq!(records[1].variable, "private");
+        assert_eq!(records[1].patterns, ["all:_private"]);
+    }
+
+    #[test]
+    fn resolution_captures_trees_and_flags_missing_and_unreferenced_files() {
+        let dir = tempfile::tempdir().unwrap();
+        let root = dir.path();
+        let write = |path: &str, content: &str| {
+            let path = root.join(path);
+            fs::create_dir_all(path.parent().unwrap()).unwrap();
+            fs::write(path, content).unwrap();
+        };
+        write(
+            "web/web.go",
+            "package web\n\nfunc logo() { assets.ReadFile(\"static/logo.png\") }\n",
+        );
+        write("web/static/logo.png", "png");
+        write("web/static/site.css", "body { background: url(bg.jpg) }");
+        write("web/static/bg.jpg", "jpg");
+        write("web/static/old.gif", "gif");
+        write("web/static/_draft.gif", "gif");
+        write("web/static/.keep", "");
+        write("web/robots.txt", "User-agent: *");
+        write("web/served/index.html", "<html>");
+
+        let source = "package web\n\n//go:embed static robots.txt gone/*.svg\nvar assets embed.FS\n\n//go:embed served\nvar public embed.FS\n\nvar handler = http.FileServer(http.FS(public))\n";
+        write("web/embed.go", source);
+        let mut records = extract_embeds("repo", "main", "web/embed.go", source);
+        resolve_embeds(root, &mut records);
+
+        let assets = &records[0];
+        assert_eq!(assets.missing, ["gone/*.svg"]);
+        assert!(!assets.served);
+        let files: Vec<(&str, u64, bool)> = assets
+            .files
+            .iter()
+            .map(|f| (f.path.as_str(), f.size, f.referenced))
+            .collect();
+        assert_eq!(
+            files,
+            [
+                ("web/robots.txt", 13, true),
+                ("web/static/bg.jpg", 3, true),
+                ("web/static/logo.png", 3, true),
+                ("web/static/old.gif", 3, false),
+                ("web/static/site.css", 32, false),
+            ]
+        );
+
+        let public = &records[1];
+        assert!(public.served);
+        assert!(public.missing.is_empty());
+        assert_eq!(public.files[0].path, "web/served/index.html");
+    }
+}
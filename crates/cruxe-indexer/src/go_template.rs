@@ -0,0 +1,465 @@
+//! Parser for Go `text/template` and `html/template` sources. It finds the
+//! named templates a source defines and, for each, the field chains its
+//! actions read and the templates it invokes. `range` and `with` move the
+//! dot, so chains are recorded relative to the data the template itself is
+//! executed with.
+
+use cruxe_core::types::{TemplateCall, TemplateFieldRef, TemplateRecord};
+use std::collections::HashMap;
+
+/// Chain step for an element of a ranged-over value.
+pub const ELEMENT: &str = "[]";
+
+/// Parse a template source. Text outside any `define` belongs to a template
+/// named `root_name` of kind `root_kind` (`file` for template files, which
+/// `ParseFiles` names after their base name). `first_line` is the line of
+/// `path` the source starts on. The root template comes first; it is kept
+/// even when it only holds `define`s.
+pub fn parse_template(
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    root_name: &str,
+    root_kind: &str,
+    source: &str,
+    first_line: u32,
+) -> Vec<TemplateRecord> {
+    let record = |name: &str, kind: &str, line: u32| TemplateRecord {
+        repo: repo.to_string(),
+        r#ref: ref_name.to_string(),
+        path: path.to_string(),
+        name: name.to_string(),
+        kind: kind.to_string(),
+        line,
+        fields: Vec::new(),
+        calls: Vec::new(),
+    };
+    let mut parser = Parser {
+        records: vec![record(root_name, root_kind, first_line)],
+        current: 0,
+        dot: Some(Vec::new()),
+        vars: HashMap::new(),
+        frames: Vec::new(),
+    };
+    for (offset, action) in actions(source) {
+        let line = first_line + source[..offset].matches('\n').count() as u32;
+        let tokens = tokenize(action);
+        let Some(Token::Word(keyword)) = tokens.first() else {
+            continue;
+        };
+        match keyword.as_str() {
+            "define" | "block" => {
+                let Some(Token::Str(name)) = tokens.get(1) else {
+                    continue;
+                };
+                if keyword == "block" {
+                    let pipeline = &tokens[2..];
+                    parser.record_refs(pipeline, line);
+                    let arg = parser.pipeline_chain(pipeline);
+                    parser.records[parser.current].calls.push(TemplateCall {
+                        name: name.clone(),
+                        line,
+                        arg,
+                    });
+                }
+                parser.push_frame(true);
+                parser.records.push(record(name, keyword, line));
+                parser.current = parser.records.len() - 1;
+                parser.dot = Some(Vec::new());
+                parser.vars.clear();
+            }
+            "template" => {
+                let Some(Token::Str(name)) = tokens.get(1) else {
+                    continue;
+                };
+                let pipeline = &tokens[2..];
+                parser.record_refs(pipeline, line);
+                let arg = parser.pipeline_chain(pipeline);
+                parser.records[parser.current].calls.push(TemplateCall {
+                    name: name.clone(),
+                    line,
+                    arg,
+                });
+            }
+            "if" => {
+                parser.record_refs(&tokens[1..], line);
+                parser.push_frame(false);
+            }
+            "range" | "with" => {
+                let (declared, pipeline) = split_declaration(&tokens[1..]);
+                parser.record_refs(pipeline, line);
+                let value = parser.pipeline_chain(pipeline);
+                parser.push_frame(false);
+                parser.enter(keyword == "range", &declared, value);
+            }
+            "else" => {
+                let Some(frame) = parser.frames.last() else {
+                    continue;
+                };
+                parser.dot = frame.dot.clone();
+                parser.vars = frame.vars.clone();
+                match tokens.get(1) {
+                    Some(Token::Word(word)) if word == "if" => {
+                        parser.record_refs(&tokens[2..], line);
+                    }
+                    Some(Token::Word(word)) if word == "with" || word == "range" => {
+                        let (declared, pipeline) = split_declaration(&tokens[2..]);
+                        parser.record_refs(pipeline, line);
+                        let value = parser.pipeline_chain(pipeline);
+                        parser.enter(word == "range", &declared, value);
+                    }
+                    _ => {}
+                }
+            }
+            "end" => parser.pop_frame(),
+            "break" | "continue" => {}
+            _ => {
+                let (declared, pipeline) = split_declaration(&tokens);
+                parser.record_refs(pipeline, line);
+                if !declared.is_empty() {
+                    let value = parser.pipeline_chain(pipeline);
+                    for name in declared {
+                        parser.vars.insert(name, value.clone());
+                    }
+                }
+            }
+        }
+    }
+    parser.records
+}
+
+struct Frame {
+    /// `define`/`block` frames switch the template being recorded.
+    template: bool,
+    record: usize,
+    dot: Option<Vec<String>>,
+    vars: HashMap<String, Option<Vec<String>>>,
+}
+
+struct Parser {
+    records: Vec<TemplateRecord>,
+    current: usize,
+    /// Chain the dot stands for, `None` once it is no longer a known field
+    /// chain (e.g. `with` over a function result).
+    dot: Option<Vec<String>>,
+    vars: HashMap<String, Option<Vec<String>>>,
+    frames: Vec<Frame>,
+}
+
+impl Parser {
+    fn push_frame(&mut self, template: bool) {
+        self.frames.push(Frame {
+            template,
+            record: self.current,
+            dot: self.dot.clone(),
+            vars: self.vars.clone(),
+        });
+    }
+
+    fn pop_frame(&mut self) {
+        if let Some(frame) = self.frames.pop() {
+            if frame.template {
+                self.current = frame.record;
+            }
+            self.dot = frame.dot;
+            self.vars = frame.vars;
+        }
+    }
+
+    /// Move the dot into a `range` element or `with` value and bind the
+    /// declared variables (`$k, $v := ...` binds the element to the last).
+    fn enter(&mut self, range: bool, declared: &[String], value: Option<Vec<String>>) {
+        let value = if range {
+            value.map(|mut chain| {
+                chain.push(ELEMENT.to_string());
+                chain
+            })
+        } else {
+            value
+        };
+        if let Some((element, keys)) = declared.split_last() {
+            for key in keys {
+                self.vars.insert(key.clone(), None);
+            }
+            self.vars.insert(element.clone(), value.clone());
+        }
+        self.dot = value;
+    }
+
+    /// Chain a word stands for: `.A.B` relative to the dot, `$.A` relative to
+    /// the template's data, `$x.A` relative to a variable.
+    fn resolve(&self, word: &str) -> Option<Vec<String>> {
+        let (base, fields) = if word == "." {
+            (self.dot.clone()?, "")
+        } else if let Some(fields) = word.strip_prefix('.') {
+            if !fields.starts_with(|c: char| c.is_alphabetic() || c == '_') {
+                return None;
+            }
+            (self.dot.clone()?, fields)
+        } else if word.starts_with('$') {
+            let (var, fields) = word.split_once('.').unwrap_or((word, ""));
+            let base = if var == "$" {
+                Vec::new()
+            } else {
+                self.vars.get(var).cloned()??
+            };
+            (base, fields)
+        } else {
+            return None;
+        };
+        let mut chain = base;
+        chain.extend(
+            fields
+                .split('.')
+                .filter(|field| !field.is_empty())
+                .map(str::to_string),
+        );
+        Some(chain)
+    }
+
+    /// Chain of a pipeline that is a single field chain.
+    fn pipeline_chain(&self, pipeline: &[Token]) -> Option<Vec<String>> {
+        match pipeline {
+            [Token::Word(word)] => self.resolve(word),
+            _ => None,
+        }
+    }
+
+    fn record_refs(&mut self, tokens: &[Token], line: u32) {
+        let mut after_paren = false;
+        for token in tokens {
+            let Token::Word(word) = token else {
+                after_paren = false;
+                continue;
+            };
+            // `(f .X).Y` reads `.Y` off a call result, not off the dot.
+            let field_of_result = after_paren && word.starts_with('.');
+            after_paren = word == ")";
+            if field_of_result || word == "." || word == "$" {
+                continue;
+            }
+            let Some(chain) = self.resolve(word) else {
+                continue;
+            };
+            if chain.is_empty() || chain.last().is_some_and(|step| step == ELEMENT) {
+                continue;
+            }
+            let fields = &mut self.records[self.current].fields;
+            if !fields.iter().any(|field| field.chain == chain) {
+                fields.push(TemplateFieldRef { line, chain });
+            }
+        }
+    }
+}
+
+/// `$a, $b := pipeline` split into the declared names and the pipeline.
+fn split_declaration(tokens: &[Token]) -> (Vec<String>, &[Token]) {
+    let assign = tokens
+        .iter()
+        .position(|token| matches!(token, Token::Word(word) if word == ":=" || word == "="));
+    match assign {
+        Some(at) => {
+            let declared = tokens[..at]
+                .iter()
+                .filter_map(|token| match token {
+                    Token::Word(word) if word.starts_with('$') => Some(word.clone()),
+                    _ => None,
+                })
+                .collect();
+            (declared, &tokens[at + 1..])
+        }
+        None => (Vec::new(), tokens),
+    }
+}
+
+#[derive(Debug, PartialEq)]
+enum Token {
+    Str(String),
+    Word(String),
+}
+
+/// Actions of a template with the byte offset of their `{{`. Trim markers
+/// are removed and comments skipped.
+fn actions(source: &str) -> Vec<(usize, &str)> {
+    let mut actions = Vec::new();
+    let mut from = 0;
+    while let Some(found) = source[from..].find("{{") {
+        let start = from + found;
+        let body_start = start + 2;
+        let Some(len) = action_len(&source[body_start..]) else {
+            break;
+        };
+        let mut action = &source[body_start..body_start + len];
+        from = body_start + len + 2;
+        if let Some(rest) = action.strip_prefix('-') {
+            action = rest;
+        }
+        if let Some(rest) = action.strip_suffix('-') {
+            action = rest;
+        }
+        let action = action.trim();
+        if !action.starts_with("/*") {
+            actions.push((start, action));
+        }
+    }
+    actions
+}
+
+/// Length of an action body up to its closing `}}`, skipping quoted strings.
+fn action_len(body: &str) -> Option<usize> {
+    let bytes = body.as_bytes();
+    let mut i = 0;
+    while i < bytes.len() {
+        match bytes[i] {
+            quote @ (b'"' | b'`' | b'\'') => {
+                i += 1;
+                while i < bytes.len() && bytes[i] != quote {
+                    if bytes[i] == b'\\' && quote != b'`' {
+                        i += 1;
+                    }
+                    i += 1;
+                }
+            }
+            b'}' if bytes.get(i + 1) == Some(&b'}') => return Some(i),
+            _ => {}
+        }
+        i += 1;
+    }
+    None
+}
+
+fn tokenize(action: &str) -> Vec<Token> {
+    let mut tokens = Vec::new();
+    let mut chars = action.char_indices().peekable();
+    while let Some((start, c)) = chars.next() {
+        match c {
+            c if c.is_whitespace() => {}
+            '"' | '`' | '\'' => {
+                let mut value = String::new();
+                while let Some((_, next)) = chars.next() {
+                    if next == c {
+                        break;
+                    }
+                    if next == '\\' && c != '`' {
+                        if let Some((_, escaped)) = chars.next() {
+                            value.push(escaped);
+                        }
+                        continue;
+                    }
+                    value.push(next);
+                }
+                if c == '\'' {
+                    tokens.push(Token::Word(format!("'{value}'")));
+                } else {
+                    tokens.push(Token::Str(value));
+                }
+            }
+            '(' | ')' | '|' | ',' | '=' => tokens.push(Token::Word(c.to_string())),
+            ':' if chars.peek().is_some_and(|&(_, next)| next == '=') => {
+                chars.next();
+                tokens.push(Token::Word(":=".to_string()));
+            }
+            _ => {
+                let mut end = start + c.len_utf8();
+                while let Some(&(at, next)) = chars.peek() {
+                    if next.is_whitespace() || "()|,\"`':=".contains(next) {
+                        break;
+                    }
+                    end = at + next.len_utf8();
+                    chars.next();
+                }
+                tokens.push(Token::Word(action[start..end].to_string()));
+            }
+        }
+    }
+    tokens
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn parse(source: &str) -> Vec<TemplateRecord> {
+        parse_template(
+            "repo",
+            "main",
+            "page.gohtml",
+            "page.gohtml",
+            "file",
+            source,
+            1,
+        )
+    }
+
+    fn chains(record: &TemplateRecord) -> Vec<String> {
+        record
+            .fields
+            .iter()
+            .map(|field| field.chain.join("."))
+            .collect()
+    }
+
+    #[test]
+    fn range_and_with_move_the_dot() {
+        let records = parse(
+            "<h1>{{ .Title }}</h1>\n\
+             {{range .Items}}<li>{{.Name}} {{$.Title}}</li>{{else}}{{.Empty}}{{end}}\n\
+             {{with .User}}{{.Email}}{{end}}\n\
+             {{if .Admin}}{{.Panel}}{{end}}\n\
+             {{range $i, $item := .Rows}}{{$item.ID}}{{end}}\n\
+             {{$u := .Owner}}{{$u.Name}}\n\
+             {{with index .Lookup 0}}{{.Anything}}{{end}}\n\
+             {{/* .Ignored */}}{{(call .Fn).Result}}",
+        );
+        assert_eq!(records.len(), 1);
+        assert_eq!(
+            chains(&records[0]),
+            vec![
+                "Title",
+                "Items",
+                "Items.[].Name",
+                "Empty",
+                "User",
+                "User.Email",
+                "Admin",
+                "Panel",
+                "Rows",
+                "Rows.[].ID",
+                "Owner",
+                "Owner.Name",
+                "Lookup",
+                "Fn",
+            ]
+        );
+        assert_eq!(records[0].fields[4].line, 3);
+    }
+
+    #[test]
+    fn defines_blocks_and_invocations_are_recorded() {
+        let records = parse(
+            "{{define \"layout\"}}<main>{{block \"content\" .Page}}{{.Body}}{{end}}</main>{{end}}\n\
+             {{- template \"row\" .User -}}\n\
+             {{template \"footer\"}}",
+        );
+        let names: Vec<(&str, &str)> = records
+            .iter()
+            .map(|record| (record.name.as_str(), record.kind.as_str()))
+            .collect();
+        assert_eq!(
+            names,
+            vec![
+                ("page.gohtml", "file"),
+                ("layout", "define"),
+                ("content", "block")
+            ]
+        );
+        assert_eq!(chains(&records[1]), vec!["Page"]);
+        assert_eq!(records[1].calls[0].name, "content");
+        assert_eq!(records[1].calls[0].arg, Some(vec!["Page".to_string()]));
+        assert_eq!(chains(&records[2]), vec!["Body"]);
+        assert_eq!(records[0].calls.len(), 2);
+        assert_eq!(records[0].calls[0].arg, Some(vec!["User".to_string()]));
+        assert_eq!(records[0].calls[0].line, 2);
+        assert_eq!(records[0].calls[1].arg, None);
+    }
+}
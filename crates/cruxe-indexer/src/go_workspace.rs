@@ -0,0 +1,417 @@
+//! Go modules of a workspace, from `go.work` and every `go.mod` in the tree.
+//! Import paths of one module into another are resolved through them, so a
+//! multi-module repository is indexed as one graph rather than as islands.
+//!
+//! `go.work` `use` entries come first, then local `replace` directives, then
+//! any other `go.mod` found by walking the tree; the first directory seen for
+//! a module path wins. Directories outside the repository are ignored.
+
+use cruxe_core::error::StateError;
+use cruxe_core::types::CallEdge;
+use cruxe_state::go_modules::{self, GoModule};
+use ignore::WalkBuilder;
+use rusqlite::{Connection, OptionalExtension, params};
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+
+/// Directories never holding workspace modules.
+const SKIPPED_DIRS: &[&str] = &["vendor", "node_modules", "testdata"];
+
+/// Directives of a `go.work` file relevant to module discovery.
+#[derive(Debug, Default, PartialEq, Eq)]
+pub struct WorkFile {
+    /// Module directories of `use`, relative to the file.
+    pub uses: Vec<String>,
+    /// `(module path, directory)` of `replace` directives with a local target.
+    pub replaces: Vec<(String, String)>,
+}
+
+/// Modules of the workspace at `repo_root`.
+pub fn discover_modules(repo_root: &Path) -> Vec<GoModule> {
+    let mut modules = Vec::new();
+    let mut seen = HashSet::new();
+    let mut add = |modules: &mut Vec<GoModule>, module_path: String, dir: String| {
+        if seen.insert(module_path.clone()) {
+            modules.push(GoModule { module_path, dir });
+        }
+    };
+
+    if let Ok(source) = std::fs::read_to_string(repo_root.join("go.work")) {
+        let work = parse_work_file(&source);
+        for used in &work.uses {
+            let Some(dir) = join_relative("", used) else {
+                continue;
+            };
+            if let Some(module_path) = read_module_path(repo_root, &dir) {
+                add(&mut modules, module_path, dir);
+            }
+        }
+        for (module_path, target) in work.replaces {
+            if let Some(dir) = join_relative("", &target) {
+                add(&mut modules, module_path, dir);
+            }
+        }
+    }
+
+    let mut mod_dirs = Vec::new();
+    let walker = WalkBuilder::new(repo_root)
+        .hidden(true)
+        .filter_entry(|entry| {
+            let name = entry.file_name().to_string_lossy();
+            !(entry.file_type().is_some_and(|t| t.is_dir())
+                && SKIPPED_DIRS.contains(&name.as_ref()))
+        })
+        .build();
+    for entry in walker.flatten() {
+        if entry.file_name() != "go.mod" || !entry.file_type().is_some_and(|t| t.is_file()) {
+            continue;
+        }
+        let Some(parent) = entry.path().parent() else {
+            continue;
+        };
+        let Ok(relative) = parent.strip_prefix(repo_root) else {
+            continue;
+        };
+        mod_dirs.push(relative.to_string_lossy().replace('\\', "/"));
+    }
+    // Shallow modules first, so the root's replacements take precedence.
+    mod_dirs.sort_by_key(|dir| {
+        (
+            dir.matches('/').count() + usize::from(!dir.is_empty()),
+            dir.clone(),
+        )
+    });
+    for dir in mod_dirs {
+        let Ok(source) = std::fs::read_to_string(repo_root.join(&dir).join("go.mod")) else {
+            continue;
+        };
+        if let Some(module_path) = parse_module_path(&source) {
+            add(&mut modules, module_path, dir.clone());
+        }
+        for (module_path, target) in parse_directives(&source).replaces {
+            if let Some(target_dir) = join_relative(&dir, &target) {
+                add(&mut modules, module_path, target_dir);
+            }
+        }
+    }
+    modules
+}
+
+/// Module path of a `go.mod` source.
+pub fn parse_module_path(source: &str) -> Option<String> {
+    source.lines().find_map(|line| {
+        let line = strip_comment(line).trim();
+        let rest = line.strip_prefix("module")?;
+        if !rest.starts_with(char::is_whitespace) {
+            return None;
+        }
+        let path = unquote(rest.trim());
+        (!path.is_empty()).then(|| path.to_string())
+    })
+}
+
+/// `use` and local `replace` directives of a `go.work` source.
+pub fn parse_work_file(source: &str) -> WorkFile {
+    parse_directives(source)
+}
+
+fn parse_directives(source: &str) -> WorkFile {
+    let mut work = WorkFile::default();
+    let mut block: Option<&str> = None;
+    for line in source.lines() {
+        let line = strip_comment(line).trim();
+        if line.is_empty() {
+            continue;
+        }
+        let (verb, args) = match block {
+            Some(_) if line == ")" => {
+                block = None;
+                continue;
+            }
+            Some(verb) => (verb, line),
+            None => {
+                let (verb, rest) = line.split_once(char::is_whitespace).unwrap_or((line, ""));
+                let rest = rest.trim();
+                if rest == "(" {
+                    block = Some(match verb {
+                        "use" => "use",
+                        "replace" => "replace",
+                        _ => "",
+                    });
+                    continue;
+                }
+                (verb, rest)
+            }
+        };
+        match verb {
+            "use" => work.uses.push(unquote(args).to_string()),
+            "replace" => {
+                let Some((old, new)) = args.split_once("=>") else {
+                    continue;
+                };
+                let module_path = old.split_whitespace().next().map(unquote);
+                let target = new.split_whitespace().next().map(unquote);
+                if let (Some(module_path), Some(target)) = (module_path, target)
+                    && (target.starts_with("./") || target.starts_with("../") || target == ".")
+                {
+                    work.replaces
+                        .push((module_path.to_string(), target.to_string()));
+                }
+            }
+            _ => {}
+        }
+    }
+    work
+}
+
+fn read_module_path(repo_root: &Path, dir: &str) -> Option<String> {
+    let source = std::fs::read_to_string(repo_root.join(dir).join("go.mod")).ok()?;
+    parse_module_path(&source)
+}
+
+fn strip_comment(line: &str) -> &str {
+    line.split_once("//").map_or(line, |(code, _)| code)
+}
+
+fn unquote(value: &str) -> &str {
+    value.trim().trim_matches('"').trim_matches('`')
+}
+
+/// `relative` resolved against the repository directory `base`; `None` when
+/// it leaves the repository.
+fn join_relative(base: &str, relative: &str) -> Option<String> {
+    let mut parts: Vec<&str> = base.split('/').filter(|p| !p.is_empty()).collect();
+    for part in relative.split('/') {
+        match part {
+            "" | "." => {}
+            ".." => {
+                parts.pop()?;
+            }
+            part => parts.push(part),
+        }
+    }
+    Some(parts.join("/"))
+}
+
+/// Resolve `pkg.Name` calls of Go files to the top-level `Name` of the
+/// workspace package the file imports as `pkg`. The package name is taken to
+/// be the last element of its import path (ignoring a `/vN` major version
+/// suffix), as Go convention has it; aliased imports are left to the
+/// name-based resolver like every other edge.
+pub fn resolve_qualified_go_calls(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    edges: &mut [CallEdge],
+) -> Result<(), StateError> {
+    let modules = go_modules::list_for_ref(conn, repo, ref_name)?;
+    if modules.is_empty() {
+        return Ok(());
+    }
+    let mut packages_by_file: HashMap<String, HashMap<String, String>> = HashMap::new();
+    let mut lookup = conn
+        .prepare_cached(
+            "SELECT symbol_stable_id FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND language = 'go'
+               AND name = ?3 AND qualified_name = ?3
+               AND path LIKE ?4 ESCAPE '\\' AND path NOT LIKE ?5 ESCAPE '\\'
+               AND path NOT LIKE '%\\_test.go' ESCAPE '\\'
+             ORDER BY path, line_start
+             LIMIT 1",
+        )
+        .map_err(StateError::sqlite)?;
+    for edge in edges.iter_mut() {
+        if edge.to_symbol_id.is_some() || !edge.source_file.ends_with(".go") {
+            continue;
+        }
+        let Some((qualifier, name)) = edge.to_name.as_deref().and_then(|t| t.split_once('.'))
+        else {
+            continue;
+        };
+        if qualifier.is_empty() || name.is_empty() || name.contains('.') {
+            continue;
+        }
+        if !packages_by_file.contains_key(&edge.source_file) {
+            let packages = imported_packages(conn, repo, ref_name, &modules, &edge.source_file)?;
+            packages_by_file.insert(edge.source_file.clone(), packages);
+        }
+        let Some(dir) = packages_by_file[&edge.source_file].get(qualifier) else {
+            continue;
+        };
+        let (direct, nested) = dir_patterns(dir);
+        let resolved: Option<String> = lookup
+            .query_row(params![repo, ref_name, name, direct, nested], |row| {
+                row.get(0)
+            })
+            .optional()
+            .map_err(StateError::sqlite)?;
+        if let Some(symbol_id) = resolved {
+            edge.to_symbol_id = Some(symbol_id);
+            edge.to_name = None;
+        }
+    }
+    Ok(())
+}
+
+/// Package name to directory of the workspace packages `file` imports, read
+/// from its resolved import edges.
+fn imported_packages(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    modules: &[GoModule],
+    file: &str,
+) -> Result<HashMap<String, String>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT s.path
+             FROM symbol_edges e
+             JOIN symbol_relations s
+               ON s.repo = e.repo AND s.\"ref\" = e.\"ref\" AND s.symbol_stable_id = e.to_symbol_id
+             WHERE e.repo = ?1 AND e.\"ref\" = ?2 AND e.from_symbol_id = ?3
+               AND e.edge_type = 'imports' AND s.language = 'go'",
+        )
+        .map_err(StateError::sqlite)?;
+    let source = crate::import_extract::source_symbol_id_for_path(file);
+    let paths = stmt
+        .query_map(params![repo, ref_name, source], |row| {
+            row.get::<_, String>(0)
+        })
+        .map_err(StateError::sqlite)?;
+    let mut packages = HashMap::new();
+    for path in paths {
+        let path = path.map_err(StateError::sqlite)?;
+        let dir = path.rsplit_once('/').map_or("", |(dir, _)| dir);
+        if let Some(package) = package_name_for_dir(modules, dir) {
+            packages.entry(package).or_insert_with(|| dir.to_string());
+        }
+    }
+    Ok(packages)
+}
+
+/// Conventional package name of the workspace directory `dir`: the last
+/// element of its import path, skipping a major version suffix.
+fn package_name_for_dir(modules: &[GoModule], dir: &str) -> Option<String> {
+    let module = modules
+        .iter()
+        .filter(|m| m.dir.is_empty() || dir == m.dir || dir.starts_with(&format!("{}/", m.dir)))
+        .max_by_key(|m| m.dir.len())?;
+    let rest = dir[module.dir.len()..].trim_start_matches('/');
+    let import_path = if rest.is_empty() {
+        module.module_path.clone()
+    } else {
+        format!("{}/{rest}", module.module_path)
+    };
+    let mut elements = import_path.rsplit('/');
+    let last = elements.next()?;
+    let is_major_version =
+        last.len() > 1 && last.starts_with('v') && last[1..].bytes().all(|b| b.is_ascii_digit());
+    let name = if is_major_version {
+        elements.next()?
+    } else {
+        last
+    };
+    Some(name.to_string())
+}
+
+/// LIKE patterns matching files directly in `dir` and files in its
+/// subdirectories.
+pub(crate) fn dir_patterns(dir: &str) -> (String, String) {
+    let escaped = dir
+        .replace('\\', "\\\\")
+        .replace('%', "\\%")
+        .replace('_', "\\_");
+    if escaped.is_empty() {
+        ("%".to_string(), "%/%".to_string())
+    } else {
+        (format!("{escaped}/%"), format!("{escaped}/%/%"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn work_files_list_uses_and_local_replacements() {
+        let work = parse_work_file(
+            "go 1.22\n\
+             \n\
+             use ./api\n\
+             use (\n\
+             \t./services/billing // billing\n\
+             \t\"./tools\"\n\
+             )\n\
+             replace example.com/shared v1.2.0 => ./libs/shared\n\
+             replace (\n\
+             \tgithub.com/pkg/errors => github.com/pkg/errors v0.9.1\n\
+             \texample.com/legacy => ../legacy\n\
+             )\n",
+        );
+        assert_eq!(work.uses, vec!["./api", "./services/billing", "./tools"]);
+        assert_eq!(
+            work.replaces,
+            vec![
+                (
+                    "example.com/shared".to_string(),
+                    "./libs/shared".to_string()
+                ),
+                ("example.com/legacy".to_string(), "../legacy".to_string()),
+            ]
+        );
+        assert_eq!(
+            parse_module_path("// Module api.\nmodule \"example.com/api\"\n\ngo 1.22\n").as_deref(),
+            Some("example.com/api")
+        );
+        assert_eq!(parse_module_path("modulepath x\n"), None);
+    }
+
+    #[test]
+    fn package_names_follow_the_import_path() {
+        let modules = vec![
+            GoModule {
+                module_path: "example.com/acme/v2".to_string(),
+                dir: String::new(),
+            },
+            GoModule {
+                module_path: "example.com/billing".to_string(),
+                dir: "services/billing".to_string(),
+            },
+        ];
+        let name = |dir: &str| package_name_for_dir(&modules, dir);
+        assert_eq!(name("").as_deref(), Some("acme"));
+        assert_eq!(name("auth").as_deref(), Some("auth"));
+        assert_eq!(name("services/billing").as_deref(), Some("billing"));
+        assert_eq!(name("services/billing/invoice").as_deref(), Some("invoice"));
+    }
+
+    #[test]
+    fn modules_are_discovered_from_go_work_and_nested_go_mods() {
+        let dir = tempfile::tempdir().unwrap();
+        let write = |path: &str, content: &str| {
+            let path = dir.path().join(path);
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(path, content).unwrap();
+        };
+        write("go.work", "go 1.22\nuse (\n\t./api\n\t../outside\n)\n");
+        write("api/go.mod", "module example.com/api\n");
+        write(
+            "services/billing/go.mod",
+            "module example.com/billing\nreplace example.com/api => ../../api\n",
+        );
+        write("vendor/example.com/dep/go.mod", "module example.com/dep\n");
+
+        let modules = discover_modules(dir.path());
+        let module = |path: &str, dir: &str| GoModule {
+            module_path: path.to_string(),
+            dir: dir.to_string(),
+        };
+        assert_eq!(
+            modules,
+            vec![
+                module("example.com/api", "api"),
+                module("example.com/billing", "services/billing"),
+            ]
+        );
+    }
+}
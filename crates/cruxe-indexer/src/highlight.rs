@@ -0,0 +1,121 @@
+//! Token classes of a source snippet for terminal highlighting, taken from
+//! the tree-sitter parse. Snippets are usually fragments; the spans of the
+//! parts error recovery could not place are still classified by token.
+
+use crate::parser;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TokenClass {
+    Keyword,
+    String,
+    Comment,
+    Number,
+    Type,
+}
+
+/// A classified byte range of the source.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct HighlightSpan {
+    pub start: usize,
+    pub end: usize,
+    pub class: TokenClass,
+}
+
+/// The classified tokens of `source` in order; empty when `language` has no
+/// grammar.
+pub fn spans(source: &str, language: &str) -> Vec<HighlightSpan> {
+    let Ok(tree) = parser::parse_file(source, language) else {
+        return Vec::new();
+    };
+    let mut spans = Vec::new();
+    let mut cursor = tree.walk();
+    loop {
+        let node = cursor.node();
+        let class = classify(node, source);
+        // Strings and comments are painted whole, escapes and interpolation
+        // included.
+        let whole = matches!(class, Some(TokenClass::String | TokenClass::Comment));
+        if let Some(class) = class
+            && (whole || node.child_count() == 0)
+        {
+            spans.push(HighlightSpan {
+                start: node.start_byte(),
+                end: node.end_byte(),
+                class,
+            });
+        }
+        if !whole && cursor.goto_first_child() {
+            continue;
+        }
+        loop {
+            if cursor.goto_next_sibling() {
+                break;
+            }
+            if !cursor.goto_parent() {
+                return spans;
+            }
+        }
+    }
+}
+
+fn classify(node: tree_sitter::Node<'_>, source: &str) -> Option<TokenClass> {
+    let kind = node.kind();
+    if kind.contains("comment") {
+        return Some(TokenClass::Comment);
+    }
+    if kind.contains("string") || kind == "char_literal" || kind == "rune_literal" {
+        return Some(TokenClass::String);
+    }
+    if node.is_named() {
+        return match kind {
+            "integer_literal" | "float_literal" | "int_literal" | "imaginary_literal"
+            | "number" | "integer" | "float" => Some(TokenClass::Number),
+            "type_identifier" | "primitive_type" | "predefined_type" => Some(TokenClass::Type),
+            _ => None,
+        };
+    }
+    // Anonymous nodes spelled as words are the grammar's keywords.
+    let text = source.get(node.start_byte()..node.end_byte())?;
+    (!text.is_empty() && text.chars().all(|c| c.is_ascii_alphabetic() || c == '_'))
+        .then_some(TokenClass::Keyword)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn classes(source: &str, language: &str) -> Vec<(String, TokenClass)> {
+        spans(source, language)
+            .into_iter()
+            .map(|span| {
+                (
+                    source[span.start..span.end].trim_end().to_string(),
+                    span.class,
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn keywords_literals_and_types_are_classified() {
+        let spans = classes(
+            "fn retry(n: u32) -> &'static str { // backoff\n    if n > 3 { return \"gave up\"; } \"ok\" }",
+            "rust",
+        );
+        for expected in [
+            ("fn", TokenClass::Keyword),
+            ("u32", TokenClass::Type),
+            ("return", TokenClass::Keyword),
+            ("3", TokenClass::Number),
+            ("\"gave up\"", TokenClass::String),
+            ("// backoff", TokenClass::Comment),
+        ] {
+            assert!(
+                spans.contains(&(expected.0.to_string(), expected.1)),
+                "{expected:?} in {spans:?}"
+            );
+        }
+        assert!(!spans.iter().any(|(text, _)| text == "retry"));
+        assert!(classes("x := 1", "cobol").is_empty());
+    }
+}
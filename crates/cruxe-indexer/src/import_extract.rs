@@ -4,7 +4,8 @@ use cruxe_core::edge_confidence::{
     RESOLUTION_UNRESOLVED, assign_edge_confidence, looks_external_reference,
 };
 use cruxe_core::error::StateError;
-use rusqlite::{Connection, params};
+use cruxe_state::import_paths::Mapping;
+use rusqlite::{Connection, OptionalExtension, params};
 use serde::{Deserialize, Serialize};
 use std::collections::{HashMap, HashSet};
 use std::path::{Path, PathBuf};
@@ -31,6 +32,9 @@ pub struct ResolvedImportEdge {
     pub edge_provider: String,
     pub resolution_outcome: String,
     pub confidence_weight: f64,
+    /// Line of the first import statement behind the edge.
+    #[serde(default)]
+    pub source_line: u32,
 }
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
@@ -212,6 +216,7 @@ pub fn resolve_imports_with_stats(
             edge_provider: confidence.provider,
             resolution_outcome: confidence.outcome,
             confidence_weight: confidence.weight,
+            source_line: raw.import_line,
         };
 
         let dedupe_key = (
@@ -282,6 +287,21 @@ fn resolve_target_symbol_stable_id_generic(
     raw: &RawImport,
     provider: &'static str,
 ) -> Result<ImportResolution, StateError> {
+    if let Some(importing_file) = raw.source_qualified_name.strip_prefix("file::")
+        && infer_language_from_path(importing_file) == "go"
+        && let Some(dir) =
+            cruxe_state::go_modules::package_dir(conn, repo, ref_name, &raw.target_qualified_name)?
+    {
+        return resolve_go_workspace_package(conn, repo, ref_name, &dir, provider);
+    }
+
+    if let Some(importing_file) = raw.source_qualified_name.strip_prefix("file::")
+        && let Some(resolution) =
+            resolve_through_import_paths(conn, repo, ref_name, importing_file, raw, provider)?
+    {
+        return Ok(resolution);
+    }
+
     if !raw.target_qualified_name.is_empty() {
         let mut stmt = conn
             .prepare(
@@ -341,40 +361,7 @@ fn resolve_target_symbol_stable_id_generic(
                     provider,
                 });
             }
-            let mut stmt = conn
-                .prepare(
-                    "SELECT symbol_stable_id
-                     FROM symbol_relations
-                     WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3
-                       AND (qualified_name = ?4 OR name = ?5)
-                     ORDER BY line_start
-                     LIMIT 1",
-                )
-                .map_err(StateError::sqlite)?;
-            let from_resolved_path = stmt
-                .query_row(
-                    params![
-                        repo,
-                        ref_name,
-                        resolved_path,
-                        raw.target_qualified_name,
-                        raw.target_name
-                    ],
-                    |row| row.get::<_, String>(0),
-                )
-                .ok();
-            if from_resolved_path.is_some() {
-                return Ok(ImportResolution {
-                    to_symbol_id: from_resolved_path,
-                    outcome: ResolveOutcome::ResolvedInternal,
-                    provider,
-                });
-            }
-            return Ok(ImportResolution {
-                to_symbol_id: None,
-                outcome: ResolveOutcome::Unresolved,
-                provider,
-            });
+            return resolve_in_file(conn, repo, ref_name, &resolved_path, raw, provider);
         }
     }
 
@@ -390,6 +377,148 @@ fn resolve_target_symbol_stable_id_generic(
     })
 }
 
+/// The symbol `raw` imports from the indexed file at `path`.
+fn resolve_in_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    raw: &RawImport,
+    provider: &'static str,
+) -> Result<ImportResolution, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT symbol_stable_id
+             FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3
+               AND (qualified_name = ?4 OR name = ?5)
+             ORDER BY line_start
+             LIMIT 1",
+        )
+        .map_err(StateError::sqlite)?;
+    let from_resolved_path = stmt
+        .query_row(
+            params![
+                repo,
+                ref_name,
+                path,
+                raw.target_qualified_name,
+                raw.target_name
+            ],
+            |row| row.get::<_, String>(0),
+        )
+        .ok();
+    let outcome = if from_resolved_path.is_some() {
+        ResolveOutcome::ResolvedInternal
+    } else {
+        ResolveOutcome::Unresolved
+    };
+    Ok(ImportResolution {
+        to_symbol_id: from_resolved_path,
+        outcome,
+        provider,
+    })
+}
+
+/// Python and TypeScript imports through the mappings recorded from the
+/// `[languages]` settings: the first mapping to an indexed file wins, and
+/// a module of an installed third-party package is external. `None`
+/// leaves the import to the lookups by name.
+fn resolve_through_import_paths(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    importing_file: &str,
+    raw: &RawImport,
+    provider: &'static str,
+) -> Result<Option<ImportResolution>, StateError> {
+    let language = infer_language_from_path(importing_file);
+    let suffixes: &[&str] = match language {
+        "python" => &[".py", "/__init__.py", ".pyi"],
+        "typescript" => &[
+            ".ts",
+            ".tsx",
+            ".d.ts",
+            "/index.ts",
+            "/index.tsx",
+            ".js",
+            ".jsx",
+            "",
+        ],
+        _ => return Ok(None),
+    };
+    let module_spec = module_spec_for_lookup(raw);
+    if module_spec.is_empty() {
+        return Ok(None);
+    }
+    let spec = if language == "python" {
+        module_spec.replace('.', "/")
+    } else {
+        module_spec
+    };
+    for import_path in cruxe_state::import_paths::list_for_language(conn, repo, ref_name, language)?
+    {
+        match import_path.map(&spec) {
+            None => {}
+            Some(Mapping::External) => {
+                return Ok(Some(ImportResolution {
+                    to_symbol_id: None,
+                    outcome: ResolveOutcome::ExternalReference,
+                    provider,
+                }));
+            }
+            Some(Mapping::Path(base)) => {
+                for suffix in suffixes {
+                    let candidate = format!("{base}{suffix}");
+                    if file_exists_in_manifest(conn, repo, ref_name, &candidate)? {
+                        return resolve_in_file(conn, repo, ref_name, &candidate, raw, provider)
+                            .map(Some);
+                    }
+                }
+            }
+        }
+    }
+    Ok(None)
+}
+
+/// A Go import of a workspace package resolves to the first symbol of the
+/// package directory, which carries the package name in its qualified name.
+fn resolve_go_workspace_package(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    dir: &str,
+    provider: &'static str,
+) -> Result<ImportResolution, StateError> {
+    let (direct, nested) = crate::go_workspace::dir_patterns(dir);
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT symbol_stable_id FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND language = 'go'
+               AND path LIKE ?3 ESCAPE '\\' AND path NOT LIKE ?4 ESCAPE '\\'
+               AND path NOT LIKE '%\\_test.go' ESCAPE '\\'
+             ORDER BY path, line_start
+             LIMIT 1",
+        )
+        .map_err(StateError::sqlite)?;
+    let symbol_id = stmt
+        .query_row(params![repo, ref_name, direct, nested], |row| {
+            row.get::<_, String>(0)
+        })
+        .optional()
+        .map_err(StateError::sqlite)?;
+    let outcome = if symbol_id.is_some() {
+        ResolveOutcome::ResolvedInternal
+    } else {
+        ResolveOutcome::Unresolved
+    };
+    Ok(ImportResolution {
+        to_symbol_id: symbol_id,
+        outcome,
+        provider,
+    })
+}
+
 fn file_exists_in_manifest(
     conn: &Connection,
     repo: &str,
@@ -755,6 +884,105 @@ mod tests {
         assert!((edges[0].confidence_weight - 1.0).abs() < f64::EPSILON);
     }
 
+    #[test]
+    fn resolve_imports_follows_configured_import_paths() {
+        use cruxe_state::import_paths::{self, ImportPath};
+        use cruxe_state::manifest::{self, ManifestEntry};
+
+        let conn = setup_test_db();
+        let mapping = |language: &str, pattern: &str, target: Option<&str>| ImportPath {
+            language: language.to_string(),
+            pattern: pattern.to_string(),
+            target: target.map(str::to_string),
+        };
+        import_paths::replace_for_ref(
+            &conn,
+            "my-repo",
+            "main",
+            &[
+                mapping("typescript", "@app/*", Some("web/src/*")),
+                mapping("python", "*", Some("src/*")),
+                mapping("python", "requests", None),
+            ],
+        )
+        .unwrap();
+        for (path, name, language) in [
+            ("web/src/auth/index.ts", "login", "typescript"),
+            ("src/billing/invoice.py", "Invoice", "python"),
+            ("scripts/http.py", "get", "python"),
+        ] {
+            manifest::upsert_manifest(
+                &conn,
+                &ManifestEntry {
+                    repo: "my-repo".to_string(),
+                    r#ref: "main".to_string(),
+                    path: path.to_string(),
+                    content_hash: "hash".to_string(),
+                    size_bytes: 10,
+                    mtime_ns: None,
+                    language: Some(language.to_string()),
+                    indexed_at: "2026-01-01T00:00:00Z".to_string(),
+                },
+            )
+            .unwrap();
+            let record = SymbolRecord {
+                repo: "my-repo".to_string(),
+                r#ref: "main".to_string(),
+                commit: None,
+                path: path.to_string(),
+                language: language.to_string(),
+                symbol_id: format!("sym_{name}"),
+                symbol_stable_id: format!("stable_{name}"),
+                name: name.to_string(),
+                qualified_name: format!("other::{name}"),
+                kind: SymbolKind::Function,
+                signature: None,
+                line_start: 1,
+                line_end: 5,
+                parent_symbol_id: None,
+                visibility: None,
+                content: None,
+            };
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        let import = |from: &str, target: &str, name: &str| RawImport {
+            source_qualified_name: source_symbol_id_for_path(from),
+            target_qualified_name: target.to_string(),
+            target_name: name.to_string(),
+            import_line: 1,
+        };
+
+        let edges = resolve_imports(
+            &conn,
+            vec![
+                import("web/src/app.ts", "@app/auth::login", "login"),
+                import("src/main.py", "billing.invoice.Invoice", "Invoice"),
+                // `get` is also the name of a project function.
+                import("src/main.py", "requests.get", "get"),
+            ],
+            "my-repo",
+            "main",
+        )
+        .unwrap();
+        let outcomes: Vec<(Option<&str>, &str)> = edges
+            .iter()
+            .map(|edge| {
+                (
+                    edge.to_symbol_id.as_deref(),
+                    edge.resolution_outcome.as_str(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            outcomes,
+            [
+                (Some("stable_login"), "resolved_internal"),
+                (Some("stable_Invoice"), "resolved_internal"),
+                (None, "external_reference"),
+            ]
+        );
+    }
+
     #[test]
     fn resolve_imports_uses_to_name_for_unresolved_target() {
         let conn = setup_test_db();
@@ -0,0 +1,862 @@
+//! Code embedded in string literals: SQL passed to database calls, HTML
+//! handed to template parsers and patterns passed to regex constructors.
+//!
+//! A literal is attributed to an embedded language by the call it is passed
+//! to, or, for SQL and HTML only, by its content alone. Each one is then run
+//! through a checker for that language, so a typo inside a query string is
+//! reported like any other syntax error. The checkers are deliberately
+//! shallow: they catch unbalanced and unterminated constructs, not every
+//! grammar rule of every SQL dialect.
+
+use crate::call_extract::resolve_caller_symbol;
+use cruxe_core::types::{InjectionRecord, SymbolRecord};
+use regex::Regex;
+use std::collections::HashSet;
+use std::sync::LazyLock;
+
+pub const SQL: &str = "sql";
+pub const HTML: &str = "html";
+pub const REGEX: &str = "regex";
+
+/// Methods that take a SQL statement (database/sql, sqlx, rusqlite, DB-API).
+const SQL_METHODS: &[&str] = &[
+    "Query",
+    "QueryContext",
+    "QueryRow",
+    "QueryRowContext",
+    "Queryx",
+    "QueryRowx",
+    "Exec",
+    "ExecContext",
+    "MustExec",
+    "NamedExec",
+    "NamedQuery",
+    "Prepare",
+    "PrepareContext",
+    "Select",
+    "Get",
+    "execute",
+    "executemany",
+    "execute_batch",
+    "query",
+    "query_row",
+    "query_map",
+    "prepare",
+    "prepare_cached",
+];
+
+/// Callees whose first string argument is a regular expression.
+const REGEX_CALLS: &[&str] = &[
+    "regexp.MustCompile",
+    "regexp.Compile",
+    "regexp.MustCompilePOSIX",
+    "regexp.CompilePOSIX",
+    "regexp.MatchString",
+    "regexp.Match",
+    "Regex::new",
+    "RegexBuilder::new",
+    "re.compile",
+    "re.match",
+    "re.search",
+    "re.fullmatch",
+    "re.sub",
+    "re.findall",
+    "re.finditer",
+    "re.split",
+    "RegExp",
+];
+
+/// Statements a SQL literal may start with.
+const SQL_STATEMENTS: &[&str] = &[
+    "SELECT",
+    "INSERT",
+    "UPDATE",
+    "DELETE",
+    "WITH",
+    "CREATE",
+    "ALTER",
+    "DROP",
+    "REPLACE",
+    "UPSERT",
+    "MERGE",
+    "TRUNCATE",
+    "PRAGMA",
+    "EXPLAIN",
+    "BEGIN",
+    "COMMIT",
+    "ROLLBACK",
+    "SAVEPOINT",
+    "RELEASE",
+    "VALUES",
+];
+
+/// SQL literals outside a known database call must look like a full statement.
+static SQL_SHAPE: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(
+        r"(?is)^\s*(?:SELECT\b.+\bFROM\b|INSERT\s+INTO\b|UPDATE\s+\S+\s+SET\b|DELETE\s+FROM\b|(?:CREATE|ALTER|DROP)\s+(?:TABLE|INDEX|UNIQUE\s+INDEX|VIEW)\b|WITH\b.+\bAS\s*\()",
+    )
+    .expect("valid regex")
+});
+
+/// HTML literals outside a template call must open with a tag and close one.
+static HTML_SHAPE: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"(?s)^\s*<(?:[A-Za-z][A-Za-z0-9-]*|!DOCTYPE|!--).*(?:</[A-Za-z]|/>)")
+        .expect("valid regex")
+});
+
+/// Find embedded SQL, HTML and regex strings in a parsed file and check them.
+pub fn extract_injections(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    language: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<InjectionRecord> {
+    let mut found = Vec::new();
+    let mut hosted = HashSet::new();
+    collect_hosted(tree.root_node(), source, language, &mut hosted, &mut found);
+    collect_unhosted(tree.root_node(), source, &hosted, &mut found);
+    found.sort_by_key(|found: &Found| found.line);
+
+    found
+        .into_iter()
+        .map(|found| {
+            let enclosing = resolve_caller_symbol(symbols, found.line);
+            let (tables, error) = match found.language {
+                SQL => {
+                    let check = check_sql(&found.content);
+                    (check.tables, check.error)
+                }
+                HTML => (Vec::new(), check_html(&found.content)),
+                _ => (Vec::new(), check_regex(&found.content, language)),
+            };
+            InjectionRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line: found.line,
+                language: found.language.to_string(),
+                host: found.host,
+                symbol_id: enclosing.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: enclosing.map(|symbol| symbol.qualified_name.clone()),
+                content: found.content,
+                tables,
+                error,
+            }
+        })
+        .collect()
+}
+
+struct Found {
+    line: u32,
+    language: &'static str,
+    host: Option<String>,
+    content: String,
+}
+
+/// Literals passed as the first string argument of a known host call.
+fn collect_hosted(
+    node: tree_sitter::Node,
+    source: &str,
+    language: &str,
+    hosted: &mut HashSet<usize>,
+    found: &mut Vec<Found>,
+) {
+    if matches!(node.kind(), "call_expression" | "call" | "new_expression")
+        && let Some(callee) = node
+            .child_by_field_name("function")
+            .or_else(|| node.child_by_field_name("constructor"))
+        && let Some(arguments) = node.child_by_field_name("arguments")
+    {
+        let host: String = source[callee.byte_range()]
+            .chars()
+            .filter(|c| !c.is_whitespace())
+            .collect();
+        let mut cursor = arguments.walk();
+        let first_literal = arguments
+            .named_children(&mut cursor)
+            .find_map(|arg| literal_value(arg, source).map(|value| (arg, value)));
+        if let Some((arg, content)) = first_literal
+            && let Some(embedded) = hosted_language(&host, &content, language)
+        {
+            hosted.insert(arg.start_byte());
+            found.push(Found {
+                line: arg.start_position().row as u32 + 1,
+                language: embedded,
+                host: Some(host),
+                content,
+            });
+        }
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_hosted(child, source, language, hosted, found);
+    }
+}
+
+/// Remaining literals that are unmistakably SQL or HTML on their own.
+fn collect_unhosted(
+    node: tree_sitter::Node,
+    source: &str,
+    hosted: &HashSet<usize>,
+    found: &mut Vec<Found>,
+) {
+    if hosted.contains(&node.start_byte()) && literal_value(node, source).is_some() {
+        return;
+    }
+    if is_string_literal(node.kind())
+        && let Some(content) = decode_literal(node, source)
+    {
+        let embedded = if SQL_SHAPE.is_match(&content) {
+            Some(SQL)
+        } else if HTML_SHAPE.is_match(&content) {
+            Some(HTML)
+        } else {
+            None
+        };
+        if let Some(embedded) = embedded {
+            found.push(Found {
+                line: node.start_position().row as u32 + 1,
+                language: embedded,
+                host: None,
+                content,
+            });
+        }
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_unhosted(child, source, hosted, found);
+    }
+}
+
+fn hosted_language(host: &str, content: &str, language: &str) -> Option<&'static str> {
+    let method = host.rsplit(['.', ':']).next().unwrap_or(host);
+    if REGEX_CALLS
+        .iter()
+        .any(|call| host == *call || host.ends_with(&format!("::{call}")))
+    {
+        return Some(REGEX);
+    }
+    // Generic names such as `Get` or `query` only count when the argument
+    // starts like a statement.
+    if SQL_METHODS.contains(&method) && starts_with_statement(content) {
+        return Some(SQL);
+    }
+    let template_parse = language == "go"
+        && method == "Parse"
+        && (host.contains("template.") || HTML_SHAPE.is_match(content));
+    if template_parse || host == "template.HTML" {
+        return Some(HTML);
+    }
+    None
+}
+
+fn starts_with_statement(content: &str) -> bool {
+    let first: String = content
+        .trim_start()
+        .chars()
+        .take_while(|c| c.is_ascii_alphabetic())
+        .collect();
+    SQL_STATEMENTS
+        .iter()
+        .any(|statement| statement.eq_ignore_ascii_case(&first))
+}
+
+pub(crate) fn is_string_literal(kind: &str) -> bool {
+    matches!(
+        kind,
+        "interpreted_string_literal"
+            | "raw_string_literal"
+            | "string_literal"
+            | "string"
+            | "template_string"
+    )
+}
+
+/// Value of a literal, or of a `+` concatenation of literals.
+fn literal_value(node: tree_sitter::Node, source: &str) -> Option<String> {
+    match node.kind() {
+        "binary_expression" | "binary_operator" => {
+            let operator = node.child_by_field_name("operator")?;
+            if &source[operator.byte_range()] != "+" {
+                return None;
+            }
+            let left = literal_value(node.child_by_field_name("left")?, source)?;
+            let right = literal_value(node.child_by_field_name("right")?, source)?;
+            Some(left + &right)
+        }
+        kind if is_string_literal(kind) => decode_literal(node, source),
+        _ => None,
+    }
+}
+
+/// Content of a string literal with quotes removed and escapes resolved.
+/// `None` for interpolated strings (f-strings, template literals with
+/// `${}`), whose content is not known statically.
+pub(crate) fn decode_literal(node: tree_sitter::Node, source: &str) -> Option<String> {
+    let text = &source[node.byte_range()];
+    match node.kind() {
+        "raw_string_literal" if text.starts_with('`') => Some(strip(text, 1, 1).to_string()),
+        "raw_string_literal" => {
+            // Rust: r#"..."#, br"..."
+            let body = text.trim_start_matches(['b', 'c']).strip_prefix('r')?;
+            let hashes = body.chars().take_while(|c| *c == '#').count();
+            Some(strip(body, hashes + 1, hashes + 1).to_string())
+        }
+        "template_string" => {
+            let mut cursor = node.walk();
+            let interpolated = node
+                .named_children(&mut cursor)
+                .any(|child| child.kind() == "template_substitution");
+            (!interpolated).then(|| unescape(strip(text, 1, 1)))
+        }
+        "string" => {
+            let prefix: String = text
+                .chars()
+                .take_while(|c| c.is_ascii_alphabetic())
+                .collect::<String>()
+                .to_ascii_lowercase();
+            if prefix.contains('f') {
+                return None;
+            }
+            let body = &text[prefix.len()..];
+            let quote = if body.starts_with("\"\"\"") || body.starts_with("'''") {
+                3
+            } else {
+                1
+            };
+            let inner = strip(body, quote, quote);
+            Some(if prefix.contains('r') {
+                inner.to_string()
+            } else {
+                unescape(inner)
+            })
+        }
+        _ => Some(unescape(strip(text.trim_start_matches(['b', 'c']), 1, 1))),
+    }
+}
+
+fn strip(text: &str, head: usize, tail: usize) -> &str {
+    text.get(head..text.len().saturating_sub(tail))
+        .unwrap_or_default()
+}
+
+fn unescape(raw: &str) -> String {
+    let mut out = String::with_capacity(raw.len());
+    let mut chars = raw.chars();
+    while let Some(c) = chars.next() {
+        if c != '\\' {
+            out.push(c);
+            continue;
+        }
+        match chars.next() {
+            Some('n') => out.push('\n'),
+            Some('t') => out.push('\t'),
+            Some('r') => out.push('\r'),
+            Some('0') => out.push('\0'),
+            Some('\n') => {}
+            Some(other) => out.push(other),
+            None => out.push('\\'),
+        }
+    }
+    out
+}
+
+/// Result of [`check_sql`].
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct SqlCheck {
+    /// Tables named after `FROM`, `JOIN`, `INTO`, `UPDATE` or `TABLE`,
+    /// lowercased, without CTE names, in order of first use.
+    pub tables: Vec<String>,
+    pub error: Option<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum SqlToken {
+    Word(String),
+    Quoted(String),
+    Open,
+    Close,
+    Comma,
+    Other,
+}
+
+/// Keywords that end a `FROM a, b` list.
+const SQL_CLAUSE_KEYWORDS: &[&str] = &[
+    "WHERE",
+    "GROUP",
+    "ORDER",
+    "HAVING",
+    "LIMIT",
+    "OFFSET",
+    "UNION",
+    "EXCEPT",
+    "INTERSECT",
+    "JOIN",
+    "ON",
+    "USING",
+    "SET",
+    "VALUES",
+    "RETURNING",
+    "WINDOW",
+    "FOR",
+];
+
+/// Lex a SQL statement, report unterminated or unbalanced constructs and
+/// list the tables it touches. Placeholders (`?`, `$1`, `:name`, `@p`) are
+/// treated as values.
+pub fn check_sql(sql: &str) -> SqlCheck {
+    let tokens = match lex_sql(sql) {
+        Ok(tokens) => tokens,
+        Err(error) => {
+            return SqlCheck {
+                tables: Vec::new(),
+                error: Some(error),
+            };
+        }
+    };
+    SqlCheck {
+        tables: sql_tables(&tokens),
+        error: sql_structure_error(&tokens),
+    }
+}
+
+fn lex_sql(sql: &str) -> Result<Vec<SqlToken>, String> {
+    let mut tokens = Vec::new();
+    let mut chars = sql.chars().peekable();
+    while let Some(c) = chars.next() {
+        match c {
+            c if c.is_whitespace() => {}
+            '-' if chars.peek() == Some(&'-') => {
+                for next in chars.by_ref() {
+                    if next == '\n' {
+                        break;
+                    }
+                }
+            }
+            '/' if chars.peek() == Some(&'*') => {
+                chars.next();
+                let mut prev = ' ';
+                let mut closed = false;
+                for next in chars.by_ref() {
+                    if prev == '*' && next == '/' {
+                        closed = true;
+                        break;
+                    }
+                    prev = next;
+                }
+                if !closed {
+                    return Err("unterminated `/*` comment".to_string());
+                }
+            }
+            '\'' | '"' | '`' => {
+                let mut value = String::new();
+                let mut closed = false;
+                while let Some(next) = chars.next() {
+                    if next == c {
+                        // A doubled quote is an escaped quote.
+                        if chars.peek() == Some(&c) {
+                            chars.next();
+                            value.push(c);
+                            continue;
+                        }
+                        closed = true;
+                        break;
+                    }
+                    value.push(next);
+                }
+                if !closed {
+                    return Err(if c == '\'' {
+                        "unterminated string literal".to_string()
+                    } else {
+                        format!("unterminated quoted identifier `{c}{value}`")
+                    });
+                }
+                tokens.push(if c == '\'' {
+                    SqlToken::Other
+                } else {
+                    SqlToken::Quoted(value)
+                });
+            }
+            '(' => tokens.push(SqlToken::Open),
+            ')' => tokens.push(SqlToken::Close),
+            ',' => tokens.push(SqlToken::Comma),
+            c if c.is_alphanumeric() || c == '_' => {
+                let mut word = String::from(c);
+                while let Some(&next) = chars.peek() {
+                    if next.is_alphanumeric() || matches!(next, '_' | '.' | '$') {
+                        word.push(next);
+                        chars.next();
+                    } else {
+                        break;
+                    }
+                }
+                tokens.push(SqlToken::Word(word));
+            }
+            _ => tokens.push(SqlToken::Other),
+        }
+    }
+    Ok(tokens)
+}
+
+fn sql_structure_error(tokens: &[SqlToken]) -> Option<String> {
+    match tokens.first() {
+        Some(SqlToken::Word(first)) if is_keyword(first, SQL_STATEMENTS) => {}
+        Some(SqlToken::Open) => {}
+        Some(SqlToken::Word(first)) => return Some(format!("unknown statement `{first}`")),
+        _ => return Some("statement does not start with a keyword".to_string()),
+    }
+    let mut depth = 0usize;
+    for (index, token) in tokens.iter().enumerate() {
+        match token {
+            SqlToken::Open => depth += 1,
+            SqlToken::Close if depth == 0 => return Some("unexpected `)`".to_string()),
+            SqlToken::Close => depth -= 1,
+            SqlToken::Comma => match tokens.get(index + 1) {
+                Some(SqlToken::Word(next)) if is_keyword(next, &["FROM", "WHERE", "VALUES"]) => {
+                    return Some(format!("dangling `,` before `{}`", next.to_uppercase()));
+                }
+                Some(SqlToken::Close) => return Some("dangling `,` before `)`".to_string()),
+                _ => {}
+            },
+            _ => {}
+        }
+    }
+    (depth > 0).then(|| format!("{depth} unclosed `(`"))
+}
+
+fn sql_tables(tokens: &[SqlToken]) -> Vec<String> {
+    // `WITH name AS (` and `, name AS (` introduce CTEs, not tables.
+    let ctes: HashSet<String> = tokens
+        .windows(4)
+        .filter_map(|window| match window {
+            [
+                SqlToken::Word(lead),
+                SqlToken::Word(name),
+                SqlToken::Word(r#as),
+                SqlToken::Open,
+            ] if r#as.eq_ignore_ascii_case("AS") && is_keyword(lead, &["WITH", "RECURSIVE"]) => {
+                Some(name.to_ascii_lowercase())
+            }
+            [
+                SqlToken::Comma,
+                SqlToken::Word(name),
+                SqlToken::Word(r#as),
+                SqlToken::Open,
+            ] if r#as.eq_ignore_ascii_case("AS") => Some(name.to_ascii_lowercase()),
+            _ => None,
+        })
+        .collect();
+
+    let mut tables: Vec<String> = Vec::new();
+    let mut expect_table = false;
+    let mut in_from_list = false;
+    for token in tokens {
+        let name = match token {
+            SqlToken::Word(word) if expect_table => {
+                if is_keyword(word, &["IF", "NOT", "EXISTS", "ONLY", "LATERAL", "TABLE"]) {
+                    continue;
+                }
+                let keyword =
+                    is_keyword(word, SQL_STATEMENTS) || is_keyword(word, SQL_CLAUSE_KEYWORDS);
+                (!keyword).then(|| word.to_ascii_lowercase())
+            }
+            SqlToken::Quoted(quoted) if expect_table => Some(quoted.to_ascii_lowercase()),
+            SqlToken::Word(word) => {
+                let upper = word.to_ascii_uppercase();
+                if matches!(
+                    upper.as_str(),
+                    "FROM" | "JOIN" | "INTO" | "UPDATE" | "TABLE"
+                ) {
+                    expect_table = true;
+                    in_from_list = upper == "FROM";
+                } else if SQL_CLAUSE_KEYWORDS.contains(&upper.as_str()) {
+                    in_from_list = false;
+                }
+                continue;
+            }
+            SqlToken::Comma if in_from_list => {
+                expect_table = true;
+                continue;
+            }
+            SqlToken::Open | SqlToken::Close => {
+                expect_table = false;
+                in_from_list = false;
+                continue;
+            }
+            _ => {
+                expect_table = false;
+                continue;
+            }
+        };
+        expect_table = false;
+        if let Some(name) = name
+            && !ctes.contains(&name)
+            && !tables.contains(&name)
+        {
+            tables.push(name);
+        }
+    }
+    tables
+}
+
+fn is_keyword(word: &str, keywords: &[&str]) -> bool {
+    keywords
+        .iter()
+        .any(|keyword| keyword.eq_ignore_ascii_case(word))
+}
+
+/// Elements that never have a closing tag.
+const VOID_ELEMENTS: &[&str] = &[
+    "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track",
+    "wbr",
+];
+
+/// Elements whose closing tag may be omitted.
+const OPTIONAL_END: &[&str] = &[
+    "html", "head", "body", "p", "li", "dt", "dd", "tr", "td", "th", "thead", "tbody", "tfoot",
+    "option", "optgroup", "colgroup", "rt", "rp",
+];
+
+/// Elements whose content is raw text up to their closing tag.
+const RAW_TEXT: &[&str] = &["script", "style", "textarea", "title"];
+
+/// Check markup for unterminated tags, comments and `{{ }}` template
+/// actions, and for tags that are never closed or closed out of order.
+/// Markup containing template actions is usually a fragment of a page whose
+/// other tags live in another template, so only the lexical checks apply
+/// to it.
+pub fn check_html(markup: &str) -> Option<String> {
+    let fragment = markup.contains("{{");
+    let mut open: Vec<String> = Vec::new();
+    let mut rest = markup;
+    while let Some(at) = rest.find(['<', '{']) {
+        rest = &rest[at..];
+        if let Some(action) = rest.strip_prefix("{{") {
+            let Some(end) = action.find("}}") else {
+                return Some("unterminated `{{` template action".to_string());
+            };
+            rest = &action[end + 2..];
+        } else if let Some(comment) = rest.strip_prefix("<!--") {
+            let Some(end) = comment.find("-->") else {
+                return Some("unterminated `<!--` comment".to_string());
+            };
+            rest = &comment[end + 3..];
+        } else if rest.starts_with("<!") || rest.starts_with("<?") {
+            let Some(end) = rest.find('>') else {
+                return Some("unterminated `<!` declaration".to_string());
+            };
+            rest = &rest[end + 1..];
+        } else if let Some(closing) = rest.strip_prefix("</") {
+            let name = tag_name(closing);
+            let Some(end) = closing.find('>') else {
+                return Some(format!("unterminated tag `</{name}`"));
+            };
+            rest = &closing[end + 1..];
+            if fragment || name.is_empty() {
+                continue;
+            }
+            // Implicitly close elements whose end tag is optional.
+            while open
+                .last()
+                .is_some_and(|top| *top != name && OPTIONAL_END.contains(&top.as_str()))
+            {
+                open.pop();
+            }
+            match open.last() {
+                Some(top) if *top == name => {
+                    open.pop();
+                }
+                Some(top) => return Some(format!("`</{name}>` closes `<{top}>`")),
+                None => return Some(format!("`</{name}>` without matching `<{name}>`")),
+            }
+        } else if let Some(tag) = rest.strip_prefix('<') {
+            let name = tag_name(tag);
+            if name.is_empty() {
+                // A bare `<` in text, e.g. `a < b`.
+                rest = tag;
+                continue;
+            }
+            let Some(end) = tag_end(tag) else {
+                return Some(format!("unterminated tag `<{name}`"));
+            };
+            let self_closing = tag[..end].trim_end().ends_with('/');
+            rest = &tag[end + 1..];
+            if RAW_TEXT.contains(&name.as_str()) {
+                let close = format!("</{name}");
+                let Some(end) = rest.to_ascii_lowercase().find(&close) else {
+                    return Some(format!("`<{name}>` is never closed"));
+                };
+                let closing = &rest[end..];
+                rest = closing.find('>').map_or("", |gt| &closing[gt + 1..]);
+            } else if !self_closing && !VOID_ELEMENTS.contains(&name.as_str()) {
+                open.push(name);
+            }
+        } else {
+            rest = &rest[1..];
+        }
+    }
+    if fragment {
+        return None;
+    }
+    open.retain(|name| !OPTIONAL_END.contains(&name.as_str()));
+    open.last()
+        .map(|name| format!("`<{name}>` is never closed"))
+}
+
+fn tag_name(tag: &str) -> String {
+    tag.chars()
+        .take_while(|c| c.is_ascii_alphanumeric() || *c == '-')
+        .collect::<String>()
+        .to_ascii_lowercase()
+}
+
+/// Offset of the `>` ending a tag, skipping quoted attribute values and
+/// template actions inside them.
+fn tag_end(tag: &str) -> Option<usize> {
+    let mut quote = None;
+    for (offset, c) in tag.char_indices() {
+        match (quote, c) {
+            (None, '"' | '\'') => quote = Some(c),
+            (Some(open), c) if c == open => quote = None,
+            (None, '>') => return Some(offset),
+            _ => {}
+        }
+    }
+    None
+}
+
+/// Compile a pattern to find syntax errors. Go's RE2 syntax is the one the
+/// `regex` crate implements; patterns of other hosts (Python, JavaScript)
+/// allow constructs it rejects, such as lookaround, so they are not checked.
+pub fn check_regex(pattern: &str, host_language: &str) -> Option<String> {
+    if !matches!(host_language, "go" | "rust") {
+        return None;
+    }
+    Regex::new(pattern).err().map(|err| {
+        // The crate's message spans several lines with a caret diagram; the
+        // last line names the problem.
+        err.to_string()
+            .lines()
+            .rev()
+            .find(|line| !line.trim().is_empty())
+            .map(|line| line.trim().trim_start_matches("error: ").to_string())
+            .unwrap_or_else(|| "invalid regular expression".to_string())
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+
+    fn extract(source: &str, language: &str) -> Vec<InjectionRecord> {
+        let tree = parse_file(source, language).unwrap();
+        extract_injections(&tree, source, language, "store.go", &[], "repo", "main")
+    }
+
+    #[test]
+    fn go_host_calls_classify_their_string_arguments() {
+        let source = r#"package store
+
+func load(ctx context.Context, db *sql.DB) {
+	db.QueryContext(ctx, "SELECT u.id FROM users u JOIN orders o ON o.user_id = u.id WHERE u.id = $1", 1)
+	db.Exec(`INSERT INTO audit (id, note) VALUES (?, ?`, 1, "x")
+	re := regexp.MustCompile("^v(\\d+\\.\\d+$")
+	t := template.Must(template.New("row").Parse("<tr><td>{{.Name}}</td></tr>"))
+	http.Get("https://example.com")
+	msg := "DELETE FROM sessions WHERE expires < now()"
+}
+"#;
+        let found = extract(source, "go");
+        let summary: Vec<(&str, u32, Option<&str>)> = found
+            .iter()
+            .map(|record| {
+                (
+                    record.language.as_str(),
+                    record.line,
+                    record.error.as_deref(),
+                )
+            })
+            .collect();
+        assert_eq!(summary.len(), 5, "{summary:?}");
+        assert_eq!(summary[0], (SQL, 4, None));
+        assert_eq!(found[0].tables, ["users", "orders"]);
+        assert_eq!(found[0].host.as_deref(), Some("db.QueryContext"));
+        assert_eq!(summary[1], (SQL, 5, Some("1 unclosed `(`")));
+        assert_eq!(summary[2].0, REGEX);
+        assert!(summary[2].2.is_some());
+        assert_eq!(summary[3], (HTML, 7, None));
+        assert_eq!(summary[4], (SQL, 9, None));
+        assert_eq!(found[4].host, None);
+        assert_eq!(found[4].tables, ["sessions"]);
+    }
+
+    #[test]
+    fn concatenated_literals_are_joined() {
+        let source =
+            "package store\n\nfunc f() {\n\tdb.Query(\"SELECT id \" +\n\t\t\"FROM accounts\")\n}\n";
+        let found = extract(source, "go");
+        assert_eq!(found.len(), 1);
+        assert_eq!(found[0].content, "SELECT id FROM accounts");
+        assert_eq!(found[0].tables, ["accounts"]);
+    }
+
+    #[test]
+    fn sql_checks_report_structure_and_skip_ctes() {
+        let check = check_sql(
+            "WITH recent AS (SELECT * FROM events) SELECT * FROM recent, \"Users\" u WHERE u.id = 1",
+        );
+        assert_eq!(check.error, None);
+        assert_eq!(check.tables, ["events", "users"]);
+
+        assert_eq!(
+            check_sql("SELECT a, b, FROM t").error.as_deref(),
+            Some("dangling `,` before `FROM`")
+        );
+        assert_eq!(
+            check_sql("SELECT 'oops FROM t").error.as_deref(),
+            Some("unterminated string literal")
+        );
+        assert_eq!(
+            check_sql("SELECT 1)").error.as_deref(),
+            Some("unexpected `)`")
+        );
+        assert_eq!(
+            check_sql("CREATE TABLE IF NOT EXISTS jobs (id INTEGER)").tables,
+            ["jobs"]
+        );
+    }
+
+    #[test]
+    fn html_checks_nesting_but_not_fragments() {
+        assert_eq!(
+            check_html("<ul><li>one<li>two</ul><br><img src=\"a>b\"/>"),
+            None
+        );
+        assert_eq!(
+            check_html("<div><span>x</div>").as_deref(),
+            Some("`</div>` closes `<span>`")
+        );
+        assert_eq!(
+            check_html("<section><p>x").as_deref(),
+            Some("`<section>` is never closed")
+        );
+        assert_eq!(check_html("{{define \"head\"}}<body><div>{{end}}"), None);
+        assert_eq!(
+            check_html("<p>{{.Name</p>").as_deref(),
+            Some("unterminated `{{` template action")
+        );
+        assert_eq!(check_html("<script>if (a < b) {}</script>"), None);
+    }
+
+    #[test]
+    fn regexes_are_checked_for_go_and_rust_only() {
+        assert_eq!(check_regex(r"^\d+$", "go"), None);
+        assert!(check_regex("(unclosed", "go").is_some());
+        assert_eq!(check_regex("(?<=a)b", "python"), None);
+    }
+}
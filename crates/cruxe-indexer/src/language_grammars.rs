@@ -1,3 +1,5 @@
+use crate::runtime_grammars;
+
 pub const TAG_LANGUAGE_IDS: &[&str] = &["rust", "typescript", "python", "go"];
 
 pub struct TagLanguageSpec {
@@ -27,12 +29,17 @@ pub fn tag_language_spec(language: &str) -> Option<TagLanguageSpec> {
     }
 }
 
+/// Grammar of `language`: built in, or loaded from `[grammars]`.
 pub fn parser_language(language: &str) -> Option<tree_sitter::Language> {
-    tag_language_spec(language).map(|spec| spec.language)
+    tag_language_spec(language)
+        .map(|spec| spec.language)
+        .or_else(|| runtime_grammars::language(language))
 }
 
 pub fn combined_tags_query(language: &str) -> Option<String> {
-    let spec = tag_language_spec(language)?;
+    let Some(spec) = tag_language_spec(language) else {
+        return runtime_grammars::tags_query(language);
+    };
     Some(format!(
         "{}{}",
         spec.tags_query,
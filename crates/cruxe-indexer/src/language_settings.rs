@@ -0,0 +1,277 @@
+//! Import path mappings derived from `[languages]`, recorded with each
+//! index run for the import resolver.
+//!
+//! Python modules are looked up under each of `source_roots` before the
+//! workspace root, and the top-level packages installed in `virtualenv`
+//! (`lib/python3.*/site-packages`, or `Lib/site-packages` on Windows) are
+//! third-party: importing them never resolves to a same-named symbol of
+//! the project. For TypeScript the `compilerOptions.paths` of the tsconfig
+//! map aliases as `tsc` does, exact patterns first and then the longest
+//! prefix, and `baseUrl` maps every other bare specifier. An `extends`
+//! chain is not followed.
+
+use cruxe_core::config::LanguagesConfig;
+use cruxe_state::import_paths::ImportPath;
+use std::path::Path;
+
+/// Mappings for the workspace at `repo_root`, in the order they are tried.
+pub fn import_paths(repo_root: &Path, languages: &LanguagesConfig) -> Vec<ImportPath> {
+    let mut paths = Vec::new();
+    let python = &languages.python;
+    for root in &python.source_roots {
+        let root = normalize("", root);
+        if !root.is_empty() {
+            paths.push(mapping("python", "*", Some(format!("{root}/*"))));
+        }
+    }
+    if let Some(virtualenv) = &python.virtualenv {
+        for package in installed_packages(&repo_root.join(virtualenv)) {
+            paths.push(mapping("python", &package, None));
+        }
+    }
+
+    let tsconfig = match &languages.typescript.tsconfig {
+        Some(path) => Some(path.as_str()),
+        None => repo_root
+            .join("tsconfig.json")
+            .is_file()
+            .then_some("tsconfig.json"),
+    };
+    if let Some(tsconfig) = tsconfig {
+        paths.extend(tsconfig_paths(repo_root, tsconfig));
+    }
+    paths
+}
+
+fn mapping(language: &str, pattern: &str, target: Option<String>) -> ImportPath {
+    ImportPath {
+        language: language.to_string(),
+        pattern: pattern.to_string(),
+        target,
+    }
+}
+
+/// Top-level module names importable from the site-packages of a
+/// virtualenv, sorted.
+fn installed_packages(virtualenv: &Path) -> Vec<String> {
+    let mut site_packages = vec![virtualenv.join("Lib").join("site-packages")];
+    if let Ok(entries) = std::fs::read_dir(virtualenv.join("lib")) {
+        for entry in entries.flatten() {
+            if entry.file_name().to_string_lossy().starts_with("python") {
+                site_packages.push(entry.path().join("site-packages"));
+            }
+        }
+    }
+    let mut packages = Vec::new();
+    for dir in site_packages {
+        let Ok(entries) = std::fs::read_dir(&dir) else {
+            continue;
+        };
+        for entry in entries.flatten() {
+            let name = entry.file_name().to_string_lossy().to_string();
+            let is_dir = entry.file_type().is_ok_and(|t| t.is_dir());
+            let module = if is_dir {
+                (!name.contains('.') && name != "__pycache__").then_some(name.as_str())
+            } else {
+                // `six.py`, or an extension module such as
+                // `_cffi_backend.cpython-312-x86_64-linux-gnu.so`.
+                [".py", ".so", ".pyd"]
+                    .iter()
+                    .any(|ext| name.ends_with(ext))
+                    .then(|| name.split('.').next().unwrap_or_default())
+            };
+            if let Some(module) = module.filter(|module| !module.is_empty()) {
+                packages.push(module.to_string());
+            }
+        }
+    }
+    packages.sort();
+    packages.dedup();
+    packages
+}
+
+/// `paths` and `baseUrl` mappings of the tsconfig at `tsconfig`, relative
+/// to `repo_root`.
+fn tsconfig_paths(repo_root: &Path, tsconfig: &str) -> Vec<ImportPath> {
+    let Ok(source) = std::fs::read_to_string(repo_root.join(tsconfig)) else {
+        return Vec::new();
+    };
+    let Ok(value) = serde_json::from_str::<serde_json::Value>(&strip_jsonc(&source)) else {
+        return Vec::new();
+    };
+    let Some(options) = value.get("compilerOptions") else {
+        return Vec::new();
+    };
+    let config_dir = normalize("", tsconfig)
+        .rsplit_once('/')
+        .map(|(dir, _)| dir.to_string())
+        .unwrap_or_default();
+    let base_url = options
+        .get("baseUrl")
+        .and_then(|base| base.as_str())
+        .map(|base| normalize(&config_dir, base));
+    let paths_base = base_url.clone().unwrap_or_else(|| config_dir.clone());
+
+    let mut aliases: Vec<(&String, &serde_json::Value)> = options
+        .get("paths")
+        .and_then(|paths| paths.as_object())
+        .map(|paths| paths.iter().collect())
+        .unwrap_or_default();
+    aliases.sort_by_key(|(pattern, _)| match pattern.split_once('*') {
+        None => (false, 0),
+        Some((prefix, _)) => (true, usize::MAX - prefix.len()),
+    });
+    let mut paths = Vec::new();
+    for (pattern, targets) in aliases {
+        for target in targets.as_array().into_iter().flatten() {
+            if let Some(target) = target.as_str() {
+                let target = normalize(&paths_base, target);
+                paths.push(mapping("typescript", pattern, Some(target)));
+            }
+        }
+    }
+    if let Some(base) = base_url {
+        let target = if base.is_empty() {
+            "*".to_string()
+        } else {
+            format!("{base}/*")
+        };
+        paths.push(mapping("typescript", "*", Some(target)));
+    }
+    paths
+}
+
+/// `relative` joined to the repository-relative `dir`, with `.` and `..`
+/// elements folded and no trailing `/`.
+fn normalize(dir: &str, relative: &str) -> String {
+    let mut parts: Vec<&str> = dir.split('/').filter(|part| !part.is_empty()).collect();
+    for part in relative.split(['/', '\\']) {
+        match part {
+            "" | "." => {}
+            ".." => {
+                parts.pop();
+            }
+            _ => parts.push(part),
+        }
+    }
+    parts.join("/")
+}
+
+/// tsconfig files are JSON with comments and trailing commas; drop both.
+fn strip_jsonc(source: &str) -> String {
+    let mut out = String::with_capacity(source.len());
+    let mut chars = source.chars().peekable();
+    let mut in_string = false;
+    while let Some(c) = chars.next() {
+        if in_string {
+            out.push(c);
+            match c {
+                '\\' => out.extend(chars.next()),
+                '"' => in_string = false,
+                _ => {}
+            }
+            continue;
+        }
+        match (c, chars.peek()) {
+            ('"', _) => {
+                in_string = true;
+                out.push(c);
+            }
+            ('/', Some('/')) => while chars.next_if(|&next| next != '\n').is_some() {},
+            ('/', Some('*')) => {
+                chars.next();
+                let mut last = ' ';
+                for next in chars.by_ref() {
+                    if last == '*' && next == '/' {
+                        break;
+                    }
+                    last = next;
+                }
+            }
+            (',', _) => {
+                let next = chars.clone().find(|next| !next.is_whitespace());
+                if !matches!(next, Some('}' | ']')) {
+                    out.push(c);
+                }
+            }
+            _ => out.push(c),
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::config::{PythonLanguageConfig, TypeScriptLanguageConfig};
+    use std::fs;
+
+    #[test]
+    fn settings_become_import_paths_in_lookup_order() {
+        let tmp = tempfile::tempdir().unwrap();
+        let root = tmp.path();
+        for (path, content) in [
+            (
+                ".venv/lib/python3.12/site-packages/requests/__init__.py",
+                "",
+            ),
+            (
+                ".venv/lib/python3.12/site-packages/requests-2.32.dist-info/METADATA",
+                "",
+            ),
+            (".venv/lib/python3.12/site-packages/six.py", ""),
+            (
+                "web/tsconfig.json",
+                r#"{
+                    // Aliases of the web app.
+                    "compilerOptions": {
+                        "baseUrl": "./src",
+                        "paths": {
+                            "@/*": ["*"],
+                            "@app/auth/*": ["features/auth/*", "legacy/auth/*"],
+                            "config": ["../config/index.ts"], /* exact */
+                        },
+                    },
+                }"#,
+            ),
+        ] {
+            let full = root.join(path);
+            fs::create_dir_all(full.parent().unwrap()).unwrap();
+            fs::write(full, content).unwrap();
+        }
+        let languages = LanguagesConfig {
+            python: PythonLanguageConfig {
+                virtualenv: Some(".venv".to_string()),
+                source_roots: vec!["./src/".to_string(), ".".to_string()],
+            },
+            typescript: TypeScriptLanguageConfig {
+                tsconfig: Some("web/tsconfig.json".to_string()),
+            },
+            ..LanguagesConfig::default()
+        };
+
+        let found: Vec<(String, String, Option<String>)> = import_paths(root, &languages)
+            .into_iter()
+            .map(|path| (path.language, path.pattern, path.target))
+            .collect();
+        let expected = [
+            ("python", "*", Some("src/*")),
+            ("python", "requests", None),
+            ("python", "six", None),
+            ("typescript", "config", Some("web/config/index.ts")),
+            ("typescript", "@app/auth/*", Some("web/src/features/auth/*")),
+            ("typescript", "@app/auth/*", Some("web/src/legacy/auth/*")),
+            ("typescript", "@/*", Some("web/src/*")),
+            ("typescript", "*", Some("web/src/*")),
+        ];
+        assert_eq!(
+            found,
+            expected.map(|(language, pattern, target)| (
+                language.to_string(),
+                pattern.to_string(),
+                target.map(str::to_string)
+            ))
+        );
+        assert!(import_paths(root, &LanguagesConfig::default()).is_empty());
+    }
+}
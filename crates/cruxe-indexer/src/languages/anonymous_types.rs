@@ -0,0 +1,338 @@
+//! Nodes for Go anonymous struct types and inline interface types.
+//!
+//! `var cfg struct{ Host string }`, `data := struct{ Title string }{...}`
+//! and `func Copy(dst interface{ Write([]byte) (int, error) })` declare types
+//! the tags query has no name for. Each one with members becomes a symbol
+//! named by its member set (`struct{Host,Port}`, `interface{Write}`) and
+//! qualified by where it is declared (`Render.data.struct{Title}`,
+//! `Page.Meta.struct{Title}`), so the name survives edits elsewhere in the
+//! file. Its content holds the field or method set.
+
+use super::ExtractedSymbol;
+use super::generic_mapper;
+use super::text::node_text_owned;
+use cruxe_core::types::SymbolKind;
+use std::collections::HashMap;
+
+/// Member names spelled out in a synthesized name; the rest are elided.
+const MAX_NAMED_MEMBERS: usize = 6;
+
+/// Symbols for the anonymous struct and interface types in `tree`.
+pub fn extract_anonymous_types(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    language: &str,
+) -> Vec<ExtractedSymbol> {
+    if language != "go" {
+        return Vec::new();
+    }
+    let mut symbols = Vec::new();
+    let mut stack = vec![tree.root_node()];
+    while let Some(node) = stack.pop() {
+        if let Some(name) = anonymous_name(node, source) {
+            let (owner, parent_name) = owner_path(node, source);
+            let qualified_name = if owner.is_empty() {
+                name.clone()
+            } else {
+                format!("{}.{}", owner.join("."), name)
+            };
+            symbols.push(ExtractedSymbol {
+                name,
+                qualified_name,
+                kind: if node.kind() == "struct_type" {
+                    SymbolKind::Struct
+                } else {
+                    SymbolKind::Interface
+                },
+                language: language.to_string(),
+                signature: None,
+                line_start: node.start_position().row as u32 + 1,
+                line_end: node.end_position().row as u32 + 1,
+                visibility: None,
+                parent_name,
+                body: Some(node_text_owned(node, source)),
+            });
+        }
+        for idx in (0..node.child_count()).rev() {
+            if let Some(child) = node.child(idx) {
+                stack.push(child);
+            }
+        }
+    }
+
+    // The same shape declared twice in one place: `#2`, `#3` in source order.
+    let mut seen: HashMap<String, usize> = HashMap::new();
+    for symbol in &mut symbols {
+        let count = seen.entry(symbol.qualified_name.clone()).or_insert(0);
+        *count += 1;
+        if *count > 1 {
+            symbol.name = format!("{}#{}", symbol.name, count);
+            symbol.qualified_name = format!("{}#{}", symbol.qualified_name, count);
+        }
+    }
+    symbols
+}
+
+/// `struct{Host,Port}` or `interface{Close}` for an anonymous struct or
+/// interface type with members; `None` for named and empty ones
+/// (`struct{}`, `interface{}`) and for pure type constraints.
+fn anonymous_name(node: tree_sitter::Node, source: &str) -> Option<String> {
+    let keyword = match node.kind() {
+        "struct_type" => "struct",
+        "interface_type" => "interface",
+        _ => return None,
+    };
+    if node
+        .parent()
+        .is_some_and(|parent| matches!(parent.kind(), "type_spec" | "type_alias"))
+    {
+        return None;
+    }
+    let members = if keyword == "struct" {
+        struct_members(node, source)
+    } else {
+        interface_members(node, source)
+    };
+    if members.is_empty() {
+        return None;
+    }
+    let mut listed: Vec<&str> = members
+        .iter()
+        .take(MAX_NAMED_MEMBERS)
+        .map(String::as_str)
+        .collect();
+    if members.len() > MAX_NAMED_MEMBERS {
+        listed.push("...");
+    }
+    Some(format!("{keyword}{{{}}}", listed.join(",")))
+}
+
+/// Field names in declaration order; embedded fields by their type name.
+fn struct_members(node: tree_sitter::Node, source: &str) -> Vec<String> {
+    let mut members = Vec::new();
+    let mut cursor = node.walk();
+    for list in node.named_children(&mut cursor) {
+        if list.kind() != "field_declaration_list" {
+            continue;
+        }
+        let mut list_cursor = list.walk();
+        for field in list.named_children(&mut list_cursor) {
+            if field.kind() != "field_declaration" {
+                continue;
+            }
+            let mut name_cursor = field.walk();
+            let names: Vec<String> = field
+                .children_by_field_name("name", &mut name_cursor)
+                .map(|name| node_text_owned(name, source))
+                .collect();
+            if !names.is_empty() {
+                members.extend(names);
+            } else if let Some(ty) = field.child_by_field_name("type") {
+                members.push(type_name(&node_text_owned(ty, source)));
+            }
+        }
+    }
+    members
+}
+
+/// Method names and embedded interface names; constraint elements such as
+/// `~int | ~string` are left out.
+fn interface_members(node: tree_sitter::Node, source: &str) -> Vec<String> {
+    let mut members = Vec::new();
+    let mut cursor = node.walk();
+    for element in node.named_children(&mut cursor) {
+        match element.kind() {
+            "method_elem" | "method_spec" => {
+                if let Some(name) = element.child_by_field_name("name") {
+                    members.push(node_text_owned(name, source));
+                }
+            }
+            "type_elem" | "interface_type_name" | "constraint_elem" => {
+                let text = node_text_owned(element, source);
+                if !text.contains(['|', '~']) {
+                    members.push(type_name(&text));
+                }
+            }
+            _ => {}
+        }
+    }
+    members
+}
+
+/// `Base` for `*pkg.Base[T]`.
+fn type_name(ty: &str) -> String {
+    let ty = generic_mapper::strip_generic_args(ty.trim().trim_start_matches('*'));
+    ty.rsplit('.').next().unwrap_or(&ty).to_string()
+}
+
+/// Names of the declarations around an anonymous type, outermost first
+/// (`Handler.Render.data`), and the name of the innermost one that is a
+/// symbol itself, which becomes its parent.
+fn owner_path(node: tree_sitter::Node, source: &str) -> (Vec<String>, Option<String>) {
+    let mut segments = Vec::new();
+    let mut parent_name = None;
+    let named = |node: tree_sitter::Node| {
+        node.child_by_field_name("name")
+            .map(|name| node_text_owned(name, source))
+    };
+    let mut current = node.parent();
+    while let Some(ancestor) = current {
+        match ancestor.kind() {
+            "field_declaration" | "parameter_declaration" => {
+                segments.extend(named(ancestor));
+            }
+            "short_var_declaration" | "assignment_statement" => {
+                let left = ancestor
+                    .child_by_field_name("left")
+                    .and_then(|left| left.named_child(0))
+                    .filter(|left| left.kind() == "identifier");
+                segments.extend(left.map(|left| node_text_owned(left, source)));
+            }
+            "var_spec" | "const_spec" | "type_spec" | "type_alias" | "function_declaration" => {
+                if let Some(name) = named(ancestor) {
+                    parent_name.get_or_insert_with(|| name.clone());
+                    segments.push(name);
+                }
+            }
+            "method_declaration" => {
+                if let Some(name) = named(ancestor) {
+                    parent_name.get_or_insert_with(|| name.clone());
+                    segments.push(name);
+                }
+                segments.extend(generic_mapper::find_parent_scope(ancestor, source));
+            }
+            "struct_type" | "interface_type" => {
+                if parent_name.is_none() {
+                    parent_name = anonymous_name(ancestor, source);
+                }
+            }
+            _ => {}
+        }
+        current = ancestor.parent();
+    }
+    segments.reverse();
+    (segments, parent_name)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+
+    fn extract(source: &str) -> Vec<ExtractedSymbol> {
+        let tree = parse_file(source, "go").unwrap();
+        extract_anonymous_types(&tree, source, "go")
+    }
+
+    #[test]
+    fn anonymous_types_are_named_by_owner_and_members() {
+        let source = r#"
+package web
+
+type Page struct {
+	Title string
+	Meta  struct {
+		Author, Lang string
+	}
+	done chan struct{}
+}
+
+var config struct {
+	Host string
+	Port int
+}
+
+func (h *Handler) Render(w io.Writer, dst interface{ Write([]byte) (int, error) }) error {
+	data := struct {
+		Title string
+		*Base
+	}{Title: "home"}
+	rows := []struct{ ID int }{{1}, {2}}
+	other := []struct{ ID int }{{3}}
+	return tmpl.Execute(w, data)
+}
+
+func Sum[T interface{ ~int | ~float64 }](values []T) T {
+	var total T
+	return total
+}
+"#;
+        let symbols = extract(source);
+        let found: Vec<(&str, &str, SymbolKind, Option<&str>)> = symbols
+            .iter()
+            .map(|symbol| {
+                (
+                    symbol.name.as_str(),
+                    symbol.qualified_name.as_str(),
+                    symbol.kind,
+                    symbol.parent_name.as_deref(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            found,
+            [
+                (
+                    "struct{Author,Lang}",
+                    "Page.Meta.struct{Author,Lang}",
+                    SymbolKind::Struct,
+                    Some("Page")
+                ),
+                (
+                    "struct{Host,Port}",
+                    "config.struct{Host,Port}",
+                    SymbolKind::Struct,
+                    Some("config")
+                ),
+                (
+                    "interface{Write}",
+                    "Handler.Render.dst.interface{Write}",
+                    SymbolKind::Interface,
+                    Some("Render")
+                ),
+                (
+                    "struct{Title,Base}",
+                    "Handler.Render.data.struct{Title,Base}",
+                    SymbolKind::Struct,
+                    Some("Render")
+                ),
+                (
+                    "struct{ID}",
+                    "Handler.Render.rows.struct{ID}",
+                    SymbolKind::Struct,
+                    Some("Render")
+                ),
+                (
+                    "struct{ID}",
+                    "Handler.Render.other.struct{ID}",
+                    SymbolKind::Struct,
+                    Some("Render")
+                ),
+            ]
+        );
+        assert_eq!(symbols[0].line_start, 6);
+        assert_eq!(symbols[0].line_end, 8);
+        assert!(
+            symbols[1]
+                .body
+                .as_deref()
+                .is_some_and(|body| body.contains("Port int"))
+        );
+    }
+
+    #[test]
+    fn repeated_shapes_in_one_place_are_numbered() {
+        let source = r#"
+package web
+
+func pair() (interface{ Close() error }, interface{ Close() error }) {
+	return nil, nil
+}
+"#;
+        let names: Vec<String> = extract(source)
+            .into_iter()
+            .map(|symbol| symbol.qualified_name)
+            .collect();
+        assert_eq!(names, ["pair.interface{Close}", "pair.interface{Close}#2"]);
+    }
+}
@@ -5,6 +5,7 @@ pub mod rust;
 pub mod typescript;
 
 // Shared query-driven symbol extraction pipeline.
+pub mod anonymous_types;
 pub mod generic_mapper;
 pub mod tag_extract;
 pub(crate) mod text;
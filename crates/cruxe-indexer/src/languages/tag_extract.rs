@@ -1,4 +1,5 @@
 use super::ExtractedSymbol;
+use super::anonymous_types;
 use super::generic_mapper;
 use crate::language_grammars;
 use std::cell::RefCell;
@@ -48,7 +49,7 @@ pub fn extract_symbols_via_tags_with_diagnostics(
         return (Vec::new(), TagExtractionDiagnostics { had_parse_error });
     };
 
-    let symbols = match with_compiled_query(language_id, |query| {
+    let mut symbols = match with_compiled_query(language_id, |query| {
         collect_definition_symbols(query, tree, source, language_id)
     }) {
         Ok(symbols) => symbols,
@@ -67,6 +68,12 @@ pub fn extract_symbols_via_tags_with_diagnostics(
         }
     };
 
+    let anonymous = anonymous_types::extract_anonymous_types(tree, source, language_id);
+    if !anonymous.is_empty() {
+        symbols.extend(anonymous);
+        sort_symbols(&mut symbols);
+    }
+
     (symbols, TagExtractionDiagnostics { had_parse_error })
 }
 
@@ -76,7 +83,9 @@ fn canonical_tag_language(language: &str) -> Option<&'static str> {
         "typescript" => Some("typescript"),
         "python" => Some("python"),
         "go" => Some("go"),
-        _ => None,
+        // Loaded grammars without a tags query yield no symbols.
+        _ => crate::runtime_grammars::canonical_name(language)
+            .filter(|name| crate::runtime_grammars::tags_query(name).is_some()),
     }
 }
 
@@ -151,13 +160,17 @@ fn collect_definition_symbols(
         symbols.push(symbol);
     }
 
+    sort_symbols(&mut symbols);
+    symbols
+}
+
+fn sort_symbols(symbols: &mut [ExtractedSymbol]) {
     symbols.sort_by(|a, b| {
         a.line_start
             .cmp(&b.line_start)
             .then_with(|| a.line_end.cmp(&b.line_end))
             .then_with(|| a.name.cmp(&b.name))
     });
-    symbols
 }
 
 fn select_definition_captures<'cursor, 'tree: 'cursor>(
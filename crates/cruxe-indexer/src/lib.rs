@@ -1,15 +1,46 @@
+pub mod bench;
+pub mod blob_cache;
+pub mod build_constraints;
 pub mod call_extract;
 pub mod centrality;
+pub mod chunker;
+pub mod concurrency_extract;
+pub mod dependencies;
+pub mod doc_extract;
+pub mod embed_refresh;
 pub mod embed_writer;
+pub mod encoding;
+pub mod error_flow;
+pub mod exit_calls;
+pub mod generated;
+pub mod go_embed;
+pub mod go_template;
+pub mod go_workspace;
+pub mod highlight;
 pub mod import_extract;
+pub mod injection;
 pub mod language_grammars;
+pub mod language_settings;
 pub mod languages;
+pub mod limits;
+pub mod literal_extract;
+pub mod local_extract;
 pub mod overlay;
 pub mod parser;
+pub mod pipeline;
+pub mod plugins;
+pub mod preflight;
 pub mod prepare;
+pub mod project_discovery;
+pub mod route_extract;
+pub mod runtime_grammars;
 pub mod scanner;
+pub mod skeleton;
 pub mod snippet_extract;
+pub mod spill;
 pub mod staging;
+pub mod structural;
 pub mod symbol_extract;
 pub mod sync_incremental;
+pub mod todo_extract;
 pub mod writer;
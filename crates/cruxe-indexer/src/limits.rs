@@ -0,0 +1,153 @@
+//! Limits that keep minified bundles, giant generated files and binaries
+//! away from the parser (`[index] max_file_size`, `max_line_length`,
+//! `skip_binary`). A file over a limit is left out of the index and
+//! recorded as skipped with the reason.
+
+use crate::encoding::{self, Decoded};
+use cruxe_core::config::IndexConfig;
+use cruxe_core::types::SkipReason;
+
+/// Bytes searched for a NUL byte to tell binary files apart, as git does.
+const BINARY_SNIFF_BYTES: usize = 8000;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FileLimits {
+    pub max_file_size: u64,
+    /// 0 for no limit.
+    pub max_line_length: usize,
+    pub skip_binary: bool,
+}
+
+/// Why a file is not indexed, with what tripped the limit.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Skip {
+    pub reason: SkipReason,
+    pub detail: String,
+}
+
+impl FileLimits {
+    pub fn from_config(index: &IndexConfig) -> Self {
+        Self {
+            max_file_size: index.max_file_size,
+            max_line_length: index.max_line_length,
+            skip_binary: index.skip_binary,
+        }
+    }
+
+    /// `content` as UTF-8 text (see [`encoding`]), or why it is not
+    /// indexed: over a limit, or not text in any encoding recognized.
+    pub fn decode(&self, content: Vec<u8>) -> Result<Decoded, Skip> {
+        let encoding = encoding::detect(&content);
+        // UTF-16 is full of NUL bytes; its other limits apply to the text.
+        let raw_check = if encoding.is_utf16() {
+            self.check_size(&content)
+        } else {
+            self.check(&content)
+        };
+        if let Some(skip) = raw_check {
+            return Err(skip);
+        }
+        let text = encoding::transcode(content, encoding).ok_or_else(|| Skip {
+            reason: SkipReason::Unreadable,
+            detail: format!("not valid {}", encoding.as_str()),
+        })?;
+        if encoding.is_utf16()
+            && let Some(skip) = self.check(text.as_bytes())
+        {
+            return Err(skip);
+        }
+        Ok(Decoded { text, encoding })
+    }
+
+    /// Why `content` is over a limit, if it is.
+    pub fn check(&self, content: &[u8]) -> Option<Skip> {
+        if let Some(skip) = self.check_size(content) {
+            return Some(skip);
+        }
+        if self.skip_binary && looks_binary(content) {
+            return Some(Skip {
+                reason: SkipReason::Binary,
+                detail: "NUL byte".to_string(),
+            });
+        }
+        if self.max_line_length > 0 {
+            let longest = longest_line(content);
+            if longest > self.max_line_length {
+                return Some(Skip {
+                    reason: SkipReason::LongLines,
+                    detail: format!("line of {longest} bytes"),
+                });
+            }
+        }
+        None
+    }
+
+    fn check_size(&self, content: &[u8]) -> Option<Skip> {
+        (content.len() as u64 > self.max_file_size).then(|| Skip {
+            reason: SkipReason::TooLarge,
+            detail: format!("{} bytes", content.len()),
+        })
+    }
+}
+
+/// Whether a NUL byte appears early in `content`.
+pub fn looks_binary(content: &[u8]) -> bool {
+    content[..content.len().min(BINARY_SNIFF_BYTES)].contains(&0)
+}
+
+fn longest_line(content: &[u8]) -> usize {
+    content
+        .split(|&byte| byte == b'\n')
+        .map(<[u8]>::len)
+        .max()
+        .unwrap_or(0)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const LIMITS: FileLimits = FileLimits {
+        max_file_size: 1_000,
+        max_line_length: 80,
+        skip_binary: true,
+    };
+
+    #[test]
+    fn each_limit_names_its_reason() {
+        assert_eq!(
+            LIMITS.decode(b"fn main() {}\n".to_vec()).unwrap().text,
+            "fn main() {}\n"
+        );
+
+        let minified = format!("var a={};\n", "1,".repeat(60));
+        let skip = LIMITS.decode(minified.into_bytes()).unwrap_err();
+        assert_eq!(skip.reason, SkipReason::LongLines);
+        assert_eq!(skip.detail, "line of 127 bytes");
+
+        let skip = LIMITS.decode(b"\x7fELF\0\0\x01".to_vec()).unwrap_err();
+        assert_eq!(skip.reason, SkipReason::Binary);
+
+        let skip = LIMITS.decode("x\n".repeat(600).into_bytes()).unwrap_err();
+        assert_eq!(skip.reason, SkipReason::TooLarge);
+
+        let skip = LIMITS.decode(vec![0xff, 0xfe, b'a']).unwrap_err();
+        assert_eq!(skip.reason, SkipReason::Unreadable);
+
+        let utf16: Vec<u8> = "x\n"
+            .repeat(200)
+            .encode_utf16()
+            .flat_map(u16::to_le_bytes)
+            .collect();
+        assert_eq!(LIMITS.decode(utf16).unwrap().text.len(), 400);
+    }
+
+    #[test]
+    fn zero_lifts_the_line_limit() {
+        let limits = FileLimits {
+            max_line_length: 0,
+            ..LIMITS
+        };
+        assert!(limits.check("a".repeat(900).as_bytes()).is_none());
+    }
+}
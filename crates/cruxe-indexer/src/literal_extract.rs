@@ -0,0 +1,420 @@
+//! Constant values and notable string literals: routes (`"/api/user"`,
+//! `"GET /users/{id}"`), environment variable names read through
+//! `os.Getenv`, `std::env::var`, `process.env` or `os.environ`, error codes
+//! (`"MALFORMED"`) and URLs.
+//!
+//! Every literal a constant is declared with is recorded, whatever its
+//! shape, and attached to that constant; other literals are recorded only
+//! when they have one of the shapes above, attached to the function (or
+//! innermost symbol) they appear in. Imports, attributes and interpolated
+//! strings are skipped.
+
+use crate::concurrency_extract::attach;
+use crate::injection::{decode_literal, is_string_literal};
+use cruxe_core::types::{LiteralRecord, SymbolRecord};
+
+/// Longer literals are messages or templates, not values looked up by name.
+const MAX_VALUE_CHARS: usize = 200;
+
+/// Calls and objects whose string argument or key names an environment
+/// variable.
+const ENV_HOSTS: &[&str] = &[
+    "os.Getenv",
+    "os.LookupEnv",
+    "os.Setenv",
+    "os.Unsetenv",
+    "env::var",
+    "env::var_os",
+    "env::set_var",
+    "env::remove_var",
+    "os.getenv",
+    "os.putenv",
+    "os.environ",
+    "os.environ.get",
+    "process.env",
+];
+
+const HTTP_METHODS: &[&str] = &[
+    "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE",
+];
+
+/// Literals of a parsed file, in line order.
+pub fn extract_literals(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    language: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<LiteralRecord> {
+    let mut found = Vec::new();
+    collect(tree.root_node(), source, language, &mut found);
+    let mut records: Vec<LiteralRecord> = found
+        .into_iter()
+        .map(|literal| {
+            let symbol = literal
+                .constant
+                .as_deref()
+                .and_then(|name| {
+                    symbols.iter().find(|symbol| {
+                        symbol.name == name
+                            && symbol.line_start <= literal.line
+                            && literal.line <= symbol.line_end
+                    })
+                })
+                .or_else(|| attach(symbols, literal.line));
+            LiteralRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line: literal.line,
+                value: literal.value,
+                kind: literal.kind.to_string(),
+                defines: literal.constant.is_some(),
+                symbol_id: symbol.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: symbol.map(|symbol| symbol.qualified_name.clone()),
+            }
+        })
+        .collect();
+    records.sort_by_key(|record| record.line);
+    records
+}
+
+struct Found {
+    line: u32,
+    value: String,
+    kind: &'static str,
+    /// Name of the constant the literal is the value of.
+    constant: Option<String>,
+}
+
+fn collect(node: tree_sitter::Node<'_>, source: &str, language: &str, found: &mut Vec<Found>) {
+    let kind = node.kind();
+    if matches!(
+        kind,
+        "import_declaration"
+            | "import_statement"
+            | "import_from_statement"
+            | "use_declaration"
+            | "attribute_item"
+            | "decorator"
+    ) {
+        return;
+    }
+    let line = node.start_position().row as u32 + 1;
+    if is_string_literal(kind) {
+        if let Some(value) = decode_literal(node, source)
+            && !value.is_empty()
+            && value.chars().count() <= MAX_VALUE_CHARS
+        {
+            let constant = constant_name(node, source, language);
+            let shape = shape(&value, host(node, source).as_deref());
+            if let Some(kind) = shape.or(constant.as_ref().map(|_| "constant")) {
+                found.push(Found {
+                    line,
+                    value,
+                    kind,
+                    constant,
+                });
+            }
+        }
+        return;
+    }
+    if is_scalar_literal(kind)
+        && let Some(constant) = constant_name(node, source, language)
+    {
+        found.push(Found {
+            line,
+            value: text(node, source).to_string(),
+            kind: "constant",
+            constant: Some(constant),
+        });
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect(child, source, language, found);
+    }
+}
+
+fn is_scalar_literal(kind: &str) -> bool {
+    matches!(
+        kind,
+        "int_literal"
+            | "float_literal"
+            | "imaginary_literal"
+            | "rune_literal"
+            | "integer_literal"
+            | "boolean_literal"
+            | "char_literal"
+            | "number"
+            | "integer"
+            | "float"
+            | "true"
+            | "false"
+    )
+}
+
+/// `route`, `env`, `code` or `url` for a notable value; `host` is the call
+/// or object the literal is an argument or key of.
+fn shape(value: &str, host: Option<&str>) -> Option<&'static str> {
+    if value.chars().any(char::is_whitespace) {
+        let (method, path) = value.split_once(' ')?;
+        return (HTTP_METHODS.contains(&method) && is_route(path)).then_some("route");
+    }
+    let identifier = value.chars().all(|c| c.is_ascii_alphanumeric() || c == '_')
+        && !value.starts_with(|c: char| c.is_ascii_digit());
+    if identifier
+        && host.is_some_and(|host| {
+            ENV_HOSTS
+                .iter()
+                .any(|env| host == *env || host.ends_with(&format!("::{env}")))
+        })
+    {
+        return Some("env");
+    }
+    if value.contains("://") {
+        return Some("url");
+    }
+    if is_route(value) {
+        return Some("route");
+    }
+    let code = identifier
+        && value.len() >= 3
+        && value.chars().any(|c| c.is_ascii_uppercase())
+        && !value.chars().any(|c| c.is_ascii_lowercase())
+        && !value.starts_with('_')
+        && !value.ends_with('_');
+    code.then_some("code")
+}
+
+fn is_route(value: &str) -> bool {
+    value.len() > 1
+        && value.starts_with('/')
+        && !value.starts_with("//")
+        && !value.chars().any(char::is_whitespace)
+}
+
+/// The call a literal is an argument of (`os.Getenv`), or the object it
+/// indexes (`process.env`, `os.environ`).
+fn host(node: tree_sitter::Node<'_>, source: &str) -> Option<String> {
+    let parent = node.parent()?;
+    match parent.kind() {
+        "argument_list" | "arguments" => {
+            let call = parent.parent()?;
+            call.child_by_field_name("function")
+                .map(|function| text(function, source).to_string())
+        }
+        "subscript_expression" => parent
+            .child_by_field_name("object")
+            .map(|object| text(object, source).to_string()),
+        "subscript" => parent
+            .child_by_field_name("value")
+            .map(|value| text(value, source).to_string()),
+        _ => None,
+    }
+}
+
+/// Name of the constant `node` is the declared value of: a Go `const`, a
+/// Rust `const` or `static`, a top-level TypeScript `const`, or a Python
+/// module-level `UPPER_CASE` assignment.
+fn constant_name(node: tree_sitter::Node<'_>, source: &str, language: &str) -> Option<String> {
+    let parent = node.parent()?;
+    let name = match language {
+        "go" => {
+            let spec = parent
+                .parent()
+                .filter(|spec| parent.kind() == "expression_list" && spec.kind() == "const_spec")?;
+            let mut cursor = parent.walk();
+            let index = parent
+                .named_children(&mut cursor)
+                .position(|value| value == node)?;
+            let mut cursor = spec.walk();
+            let names: Vec<_> = spec.children_by_field_name("name", &mut cursor).collect();
+            names.get(index).or(names.first()).copied()?
+        }
+        "rust" => {
+            if !matches!(parent.kind(), "const_item" | "static_item")
+                || parent.child_by_field_name("value") != Some(node)
+            {
+                return None;
+            }
+            parent.child_by_field_name("name")?
+        }
+        "typescript" => {
+            let declaration = parent.parent()?;
+            let top_level = declaration
+                .parent()
+                .is_some_and(|scope| matches!(scope.kind(), "program" | "export_statement"));
+            let is_const = declaration
+                .child(0)
+                .is_some_and(|keyword| keyword.kind() == "const");
+            if parent.kind() != "variable_declarator"
+                || parent.child_by_field_name("value") != Some(node)
+                || declaration.kind() != "lexical_declaration"
+                || !is_const
+                || !top_level
+            {
+                return None;
+            }
+            parent
+                .child_by_field_name("name")
+                .filter(|name| name.kind() == "identifier")?
+        }
+        "python" => {
+            let module_level = parent
+                .parent()
+                .filter(|statement| statement.kind() == "expression_statement")
+                .and_then(|statement| statement.parent())
+                .is_some_and(|module| module.kind() == "module");
+            let left = parent.child_by_field_name("left")?;
+            let upper = text(left, source)
+                .chars()
+                .all(|c| c.is_ascii_uppercase() || c.is_ascii_digit() || c == '_');
+            if parent.kind() != "assignment"
+                || parent.child_by_field_name("right") != Some(node)
+                || left.kind() != "identifier"
+                || !upper
+                || !module_level
+            {
+                return None;
+            }
+            left
+        }
+        _ => return None,
+    };
+    Some(text(name, source).to_string())
+}
+
+fn text<'s>(node: tree_sitter::Node<'_>, source: &'s str) -> &'s str {
+    source.get(node.byte_range()).unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+    use cruxe_core::types::SymbolKind;
+
+    fn symbol(name: &str, kind: SymbolKind, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "api.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("api.{name}"),
+            kind,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn summary(found: &[LiteralRecord]) -> Vec<(u32, &str, &str, bool, Option<&str>)> {
+        found
+            .iter()
+            .map(|record| {
+                (
+                    record.line,
+                    record.value.as_str(),
+                    record.kind.as_str(),
+                    record.defines,
+                    record.symbol.as_deref(),
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn records_go_constants_routes_env_names_and_codes() {
+        let source = r#"package api
+
+import "net/http"
+
+const RouteUser = "/api/user"
+const MaxRetries, Greeting = 3, "hello there"
+
+func Handle() error {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return errors.New("MALFORMED")
+	}
+	http.HandleFunc("GET /api/user/{id}", nil)
+	log.Printf("token is bad")
+	_ = "https://auth.example.com/keys"
+	return nil
+}
+"#;
+        let symbols = [
+            symbol("RouteUser", SymbolKind::Constant, 5, 5),
+            symbol("MaxRetries", SymbolKind::Constant, 6, 6),
+            symbol("Greeting", SymbolKind::Constant, 6, 6),
+            symbol("Handle", SymbolKind::Function, 8, 17),
+        ];
+        let tree = parse_file(source, "go").unwrap();
+        let found = extract_literals(&tree, source, "go", "api.go", &symbols, "repo", "main");
+        assert_eq!(
+            summary(&found),
+            [
+                (5, "/api/user", "route", true, Some("api.RouteUser")),
+                (6, "3", "constant", true, Some("api.MaxRetries")),
+                (6, "hello there", "constant", true, Some("api.Greeting")),
+                (9, "JWT_SECRET", "env", false, Some("api.Handle")),
+                (11, "MALFORMED", "code", false, Some("api.Handle")),
+                (13, "GET /api/user/{id}", "route", false, Some("api.Handle")),
+                (
+                    15,
+                    "https://auth.example.com/keys",
+                    "url",
+                    false,
+                    Some("api.Handle")
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    fn records_env_reads_and_constants_in_other_languages() {
+        let python = "import os\n\nTIMEOUT = 30\nname = \"LOCAL\"\n\ndef load():\n    return os.environ[\"DATABASE_URL\"]\n";
+        let tree = parse_file(python, "python").unwrap();
+        let found = extract_literals(&tree, python, "python", "conf.py", &[], "repo", "main");
+        assert_eq!(
+            summary(&found),
+            [
+                (3, "30", "constant", true, None),
+                (4, "LOCAL", "code", false, None),
+                (7, "DATABASE_URL", "env", false, None),
+            ]
+        );
+
+        let ts = "export const API_BASE = \"/api\";\nfunction secret() {\n  const key = \"x\";\n  return process.env[\"JWT_SECRET\"] ?? key;\n}\n";
+        let tree = parse_file(ts, "typescript").unwrap();
+        let found = extract_literals(&tree, ts, "typescript", "conf.ts", &[], "repo", "main");
+        assert_eq!(
+            summary(&found),
+            [
+                (1, "/api", "route", true, None),
+                (4, "JWT_SECRET", "env", false, None),
+            ]
+        );
+
+        let rust = "#[serde(rename = \"USER_ID\")]\nstruct User;\nconst PORT: u16 = 8080;\nfn secret() -> String {\n    std::env::var(\"JWT_SECRET\").unwrap()\n}\n";
+        let tree = parse_file(rust, "rust").unwrap();
+        let found = extract_literals(&tree, rust, "rust", "conf.rs", &[], "repo", "main");
+        assert_eq!(
+            summary(&found),
+            [
+                (3, "8080", "constant", true, None),
+                (5, "JWT_SECRET", "env", false, None),
+            ]
+        );
+    }
+}
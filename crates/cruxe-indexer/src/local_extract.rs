@@ -0,0 +1,823 @@
+//! Parameters and local variables of functions, with every occurrence each
+//! one binds under the language's scope rules, so `def`, `refs` and
+//! `rename` inside a function body resolve by position instead of by name.
+//!
+//! Go, Rust and TypeScript scope a local to the rest of its block, and a
+//! later declaration of the same name shadows it (TypeScript `var` is
+//! treated like `let`). Python binds a name assigned anywhere in a function
+//! for the whole function, unless it is declared `global` or `nonlocal`.
+//! Closures see the locals around them; a Rust `fn` inside a function does
+//! not. Names no enclosing scope binds are globals, fields or imports and
+//! are left to the symbol index.
+
+use crate::call_extract::resolve_caller_symbol;
+use cruxe_core::types::{LocalRecord, LocalUse, SymbolRecord};
+use std::collections::HashSet;
+use tree_sitter::Node;
+
+/// Kinds that only group the targets of an assignment or declaration.
+const TARGET_LISTS: &[&str] = &[
+    "expression_list",
+    "pattern_list",
+    "tuple_pattern",
+    "list_pattern",
+    "array_pattern",
+    "object_pattern",
+    "list_splat_pattern",
+    "tuple",
+    "list",
+    "parenthesized_expression",
+    "as_pattern_target",
+];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Language {
+    Go,
+    Rust,
+    TypeScript,
+    Python,
+}
+
+impl Language {
+    fn parse(language: &str) -> Option<Self> {
+        match language {
+            "go" => Some(Self::Go),
+            "rust" => Some(Self::Rust),
+            "typescript" | "tsx" | "javascript" => Some(Self::TypeScript),
+            "python" => Some(Self::Python),
+            _ => None,
+        }
+    }
+
+    /// Nodes whose parameters and body form a function scope.
+    fn is_function(self, kind: &str) -> bool {
+        match self {
+            Self::Go => matches!(
+                kind,
+                "function_declaration" | "method_declaration" | "func_literal"
+            ),
+            Self::Rust => matches!(kind, "function_item" | "closure_expression"),
+            Self::TypeScript => matches!(
+                kind,
+                "function_declaration"
+                    | "function_expression"
+                    | "function"
+                    | "arrow_function"
+                    | "method_definition"
+                    | "generator_function_declaration"
+                    | "generator_function"
+            ),
+            // Comprehension variables do not leak into the function.
+            Self::Python => matches!(
+                kind,
+                "function_definition"
+                    | "lambda"
+                    | "list_comprehension"
+                    | "set_comprehension"
+                    | "dictionary_comprehension"
+                    | "generator_expression"
+            ),
+        }
+    }
+
+    /// Nodes opening a block scope inside a function.
+    fn is_block(self, kind: &str) -> bool {
+        match self {
+            Self::Go => matches!(
+                kind,
+                "block"
+                    | "if_statement"
+                    | "for_statement"
+                    | "expression_switch_statement"
+                    | "type_switch_statement"
+                    | "select_statement"
+                    | "expression_case"
+                    | "type_case"
+                    | "default_case"
+                    | "communication_case"
+            ),
+            Self::Rust => matches!(
+                kind,
+                "block" | "for_expression" | "if_expression" | "while_expression" | "match_arm"
+            ),
+            Self::TypeScript => matches!(
+                kind,
+                "statement_block" | "for_statement" | "for_in_statement" | "catch_clause"
+            ),
+            Self::Python => false,
+        }
+    }
+
+    fn is_use(self, kind: &str) -> bool {
+        kind == "identifier"
+            || (self == Self::TypeScript && kind == "shorthand_property_identifier")
+    }
+}
+
+/// Locals of a parsed file, ordered by declaration.
+pub fn extract_locals(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    language: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<LocalRecord> {
+    let Some(language) = Language::parse(language) else {
+        return Vec::new();
+    };
+    let mut walker = Walker {
+        language,
+        source,
+        scopes: Vec::new(),
+        bindings: Vec::new(),
+        declared: HashSet::new(),
+    };
+    walker.walk(tree.root_node());
+
+    let mut records: Vec<LocalRecord> = walker
+        .bindings
+        .into_iter()
+        .map(|binding| {
+            let symbol = resolve_caller_symbol(symbols, binding.line);
+            let mut uses = binding.uses;
+            uses.sort_by_key(|use_| (use_.line, use_.column));
+            LocalRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                name: binding.name,
+                kind: binding.kind.to_string(),
+                line: binding.line,
+                column: binding.column,
+                symbol_id: symbol.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: symbol.map(|symbol| symbol.qualified_name.clone()),
+                uses,
+            }
+        })
+        .collect();
+    records.sort_by_key(|record| (record.line, record.column));
+    records
+}
+
+struct Binding {
+    name: String,
+    kind: &'static str,
+    line: u32,
+    column: u32,
+    uses: Vec<LocalUse>,
+}
+
+#[derive(Default)]
+struct Scope {
+    /// Indexes into `Walker::bindings`, in declaration order.
+    bindings: Vec<usize>,
+    /// Names bound outside it are not visible inside (a Rust `fn` nested
+    /// in a function).
+    opaque: bool,
+}
+
+/// What a declaration node binds: `values` are evaluated before the names
+/// in `targets` come into scope.
+struct Declaration<'t> {
+    values: Vec<Node<'t>>,
+    targets: Vec<Node<'t>>,
+}
+
+struct Walker<'s> {
+    language: Language,
+    source: &'s str,
+    scopes: Vec<Scope>,
+    bindings: Vec<Binding>,
+    /// Identifier nodes already recorded as declarations.
+    declared: HashSet<usize>,
+}
+
+impl<'s> Walker<'s> {
+    fn walk(&mut self, node: Node<'_>) {
+        let kind = node.kind();
+        if self.language.is_function(kind) {
+            self.walk_function(node);
+            return;
+        }
+        if self.scopes.is_empty() {
+            self.walk_children(node, &[]);
+            return;
+        }
+        let block = self.language.is_block(kind);
+        if block {
+            self.scopes.push(Scope::default());
+        }
+        if let Some(declaration) = self.declaration(node) {
+            for value in &declaration.values {
+                self.walk(*value);
+            }
+            for target in declaration.targets {
+                self.bind(target, "local");
+            }
+            let values: Vec<usize> = declaration.values.iter().map(Node::id).collect();
+            self.walk_children(node, &values);
+        } else if self.language.is_use(kind) {
+            self.record_use(node);
+        } else {
+            self.walk_children(node, &[]);
+        }
+        if block {
+            self.scopes.pop();
+        }
+    }
+
+    fn walk_children(&mut self, node: Node<'_>, skip: &[usize]) {
+        let mut cursor = node.walk();
+        let children: Vec<Node<'_>> = node.named_children(&mut cursor).collect();
+        for child in children {
+            if !skip.contains(&child.id()) {
+                self.walk(child);
+            }
+        }
+    }
+
+    fn walk_function(&mut self, node: Node<'_>) {
+        // A nested TypeScript function declaration is a local of its own.
+        if self.language == Language::TypeScript
+            && !self.scopes.is_empty()
+            && node.kind().ends_with("function_declaration")
+            && let Some(name) = node.child_by_field_name("name")
+        {
+            self.bind(name, "local");
+        }
+        self.scopes.push(Scope {
+            bindings: Vec::new(),
+            opaque: self.language == Language::Rust && node.kind() == "function_item",
+        });
+        for parameter in self.parameters(node) {
+            self.bind(parameter, "parameter");
+        }
+        if self.language == Language::Python {
+            for target in self.python_targets(node) {
+                self.bind(target, "local");
+            }
+        }
+        self.walk_children(node, &[]);
+        self.scopes.pop();
+    }
+
+    /// Bring the name at `node` into the innermost scope. A Go `:=` (and
+    /// every Python assignment) naming a variable the scope already has
+    /// assigns it instead.
+    fn bind(&mut self, node: Node<'_>, kind: &'static str) {
+        let name = self.text(node);
+        if name == "_" || !self.declared.insert(node.id()) {
+            return;
+        }
+        let (line, column) = self.position(node);
+        let scope = self.scopes.last().expect("bind inside a scope");
+        let existing = scope
+            .bindings
+            .iter()
+            .rev()
+            .copied()
+            .find(|&idx| self.bindings[idx].name == name);
+        if let Some(idx) = existing
+            && matches!(self.language, Language::Go | Language::Python)
+        {
+            self.bindings[idx].uses.push(LocalUse {
+                line,
+                column,
+                write: true,
+            });
+            return;
+        }
+        self.bindings.push(Binding {
+            name: name.to_string(),
+            kind,
+            line,
+            column,
+            uses: vec![LocalUse {
+                line,
+                column,
+                write: true,
+            }],
+        });
+        let idx = self.bindings.len() - 1;
+        self.scopes
+            .last_mut()
+            .expect("bind inside a scope")
+            .bindings
+            .push(idx);
+    }
+
+    fn record_use(&mut self, node: Node<'_>) {
+        if self.declared.contains(&node.id()) || !self.is_reference(node) {
+            return;
+        }
+        let name = self.text(node);
+        let Some(idx) = self.resolve(name) else {
+            return;
+        };
+        let (line, column) = self.position(node);
+        let write = is_write(node);
+        self.bindings[idx].uses.push(LocalUse {
+            line,
+            column,
+            write,
+        });
+    }
+
+    /// The binding `name` refers to from the current scope: the latest
+    /// declaration in the innermost scope that has one.
+    fn resolve(&self, name: &str) -> Option<usize> {
+        for scope in self.scopes.iter().rev() {
+            let found = scope
+                .bindings
+                .iter()
+                .rev()
+                .copied()
+                .find(|&idx| self.bindings[idx].name == name);
+            if found.is_some() {
+                return found;
+            }
+            if scope.opaque {
+                break;
+            }
+        }
+        None
+    }
+
+    /// Whether an identifier names a variable rather than a field, a
+    /// path segment, a declared item or a keyword argument.
+    fn is_reference(&self, node: Node<'_>) -> bool {
+        let Some(parent) = node.parent() else {
+            return true;
+        };
+        let is_field = |field: &str| {
+            parent
+                .child_by_field_name(field)
+                .is_some_and(|child| child.id() == node.id())
+        };
+        if is_field("name") {
+            return false;
+        }
+        match self.language {
+            Language::Rust => {
+                !(parent.kind() == "scoped_identifier"
+                    || (parent.kind() == "macro_invocation" && is_field("macro")))
+            }
+            Language::Python => !(parent.kind() == "attribute" && is_field("attribute")),
+            Language::Go => !is_struct_literal_key(node),
+            Language::TypeScript => true,
+        }
+    }
+
+    fn declaration<'t>(&self, node: Node<'t>) -> Option<Declaration<'t>> {
+        let field = |name: &str| node.child_by_field_name(name);
+        let mut targets = Vec::new();
+        let values = match (self.language, node.kind()) {
+            (Language::Go, "short_var_declaration") => {
+                self.pattern_names(field("left")?, &mut targets);
+                field("right").into_iter().collect()
+            }
+            (Language::Go, "var_spec" | "const_spec") => {
+                let mut cursor = node.walk();
+                targets.extend(node.children_by_field_name("name", &mut cursor));
+                let mut cursor = node.walk();
+                let values = node.children_by_field_name("value", &mut cursor).collect();
+                values
+            }
+            (Language::Go, "range_clause") => {
+                let left = field("left")?;
+                let right = field("right")?;
+                let operator = self.source.get(left.end_byte()..right.start_byte())?;
+                if !operator.contains(":=") {
+                    return None;
+                }
+                self.pattern_names(left, &mut targets);
+                vec![right]
+            }
+            (Language::Go, "type_switch_statement") => {
+                self.pattern_names(field("alias")?, &mut targets);
+                [field("initializer"), field("value")]
+                    .into_iter()
+                    .flatten()
+                    .collect()
+            }
+            (Language::Rust, "let_declaration") => {
+                self.pattern_names(field("pattern")?, &mut targets);
+                [field("value"), field("alternative")]
+                    .into_iter()
+                    .flatten()
+                    .collect()
+            }
+            (Language::Rust, "for_expression" | "let_condition") => {
+                self.pattern_names(field("pattern")?, &mut targets);
+                field("value").into_iter().collect()
+            }
+            (Language::Rust, "match_arm") => {
+                self.pattern_names(field("pattern")?, &mut targets);
+                Vec::new()
+            }
+            (Language::TypeScript, "variable_declarator") => {
+                self.pattern_names(field("name")?, &mut targets);
+                field("value").into_iter().collect()
+            }
+            (Language::TypeScript, "for_in_statement") => {
+                field("kind")?;
+                self.pattern_names(field("left")?, &mut targets);
+                field("right").into_iter().collect()
+            }
+            (Language::TypeScript, "catch_clause") => {
+                self.pattern_names(field("parameter")?, &mut targets);
+                Vec::new()
+            }
+            _ => return None,
+        };
+        Some(Declaration { values, targets })
+    }
+
+    /// Identifier nodes a function binds as parameters.
+    fn parameters<'t>(&self, function: Node<'t>) -> Vec<Node<'t>> {
+        let mut names = Vec::new();
+        match self.language {
+            Language::Go => {
+                for list in ["receiver", "parameters", "result"]
+                    .into_iter()
+                    .filter_map(|field| function.child_by_field_name(field))
+                    .filter(|list| list.kind() == "parameter_list")
+                {
+                    let mut cursor = list.walk();
+                    for parameter in list.named_children(&mut cursor) {
+                        let mut names_cursor = parameter.walk();
+                        names.extend(parameter.children_by_field_name("name", &mut names_cursor));
+                    }
+                }
+            }
+            Language::Rust | Language::TypeScript => {
+                if let Some(parameter) = function.child_by_field_name("parameter") {
+                    self.pattern_names(parameter, &mut names);
+                }
+                let Some(list) = function.child_by_field_name("parameters") else {
+                    return names;
+                };
+                let mut list_cursor = list.walk();
+                for parameter in list.named_children(&mut list_cursor) {
+                    let pattern = match parameter.kind() {
+                        "parameter" | "required_parameter" | "optional_parameter" => {
+                            parameter.child_by_field_name("pattern")
+                        }
+                        "self_parameter" | "variadic_parameter" | "attribute_item" => None,
+                        _ => Some(parameter),
+                    };
+                    if let Some(pattern) = pattern {
+                        self.pattern_names(pattern, &mut names);
+                    }
+                }
+            }
+            Language::Python => {
+                let Some(list) = function.child_by_field_name("parameters") else {
+                    return names;
+                };
+                let mut list_cursor = list.walk();
+                for parameter in list.named_children(&mut list_cursor) {
+                    let name = match parameter.kind() {
+                        "identifier" => Some(parameter),
+                        "default_parameter" | "typed_default_parameter" => {
+                            parameter.child_by_field_name("name")
+                        }
+                        _ => first_identifier(parameter),
+                    };
+                    names.extend(name);
+                }
+            }
+        }
+        names
+    }
+
+    /// Names a Python function assigns anywhere in its body, outside nested
+    /// functions and classes, in source order; the variables of a
+    /// comprehension.
+    fn python_targets<'t>(&self, function: Node<'t>) -> Vec<Node<'t>> {
+        let mut targets = Vec::new();
+        if function.kind().ends_with("comprehension") || function.kind() == "generator_expression" {
+            let mut cursor = function.walk();
+            for clause in function.named_children(&mut cursor) {
+                if clause.kind() == "for_in_clause"
+                    && let Some(left) = clause.child_by_field_name("left")
+                {
+                    self.pattern_names(left, &mut targets);
+                }
+            }
+            return targets;
+        }
+        if function.kind() != "function_definition" {
+            return targets;
+        }
+        let Some(body) = function.child_by_field_name("body") else {
+            return Vec::new();
+        };
+        let mut outer = HashSet::new();
+        self.collect_python_targets(body, &mut targets, &mut outer);
+        targets.retain(|target| !outer.contains(self.text(*target)));
+        targets
+    }
+
+    fn collect_python_targets<'t>(
+        &self,
+        node: Node<'t>,
+        targets: &mut Vec<Node<'t>>,
+        outer: &mut HashSet<&'s str>,
+    ) {
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            let field = |name: &str| child.child_by_field_name(name);
+            match child.kind() {
+                "function_definition" | "class_definition" => {
+                    targets.extend(field("name"));
+                    continue;
+                }
+                "lambda"
+                | "list_comprehension"
+                | "set_comprehension"
+                | "dictionary_comprehension"
+                | "generator_expression" => continue,
+                "global_statement" | "nonlocal_statement" => {
+                    let mut names = child.walk();
+                    outer.extend(
+                        child
+                            .named_children(&mut names)
+                            .filter(|name| name.kind() == "identifier")
+                            .map(|name| self.text(name)),
+                    );
+                    continue;
+                }
+                "assignment" | "augmented_assignment" | "for_statement" => {
+                    if let Some(left) = field("left") {
+                        self.pattern_names(left, targets);
+                    }
+                }
+                "named_expression" => targets.extend(field("name")),
+                "as_pattern" | "except_clause" => {
+                    if let Some(alias) = field("alias") {
+                        self.pattern_names(alias, targets);
+                    }
+                }
+                _ => {}
+            }
+            self.collect_python_targets(child, targets, outer);
+        }
+    }
+
+    /// Identifiers a pattern (or assignment target) binds, leaving out type
+    /// annotations, default values, enum variants and path segments.
+    fn pattern_names<'t>(&self, node: Node<'t>, out: &mut Vec<Node<'t>>) {
+        match (self.language, node.kind()) {
+            (Language::Rust, "identifier") => {
+                // `None` or `Ordering::Less` in a pattern is not a binding.
+                if !self.text(node).starts_with(|c: char| c.is_uppercase()) {
+                    out.push(node);
+                }
+                return;
+            }
+            (_, "identifier")
+            | (Language::Rust, "shorthand_field_identifier")
+            | (Language::TypeScript, "shorthand_property_identifier_pattern") => {
+                out.push(node);
+                return;
+            }
+            (Language::Rust, "scoped_identifier" | "range_pattern") => return,
+            (Language::Go | Language::Python, kind) if !TARGET_LISTS.contains(&kind) => return,
+            _ => {}
+        }
+        let skipped: Vec<usize> = ["type", "right", "value", "condition"]
+            .into_iter()
+            .filter_map(|field| node.child_by_field_name(field))
+            .map(|child| child.id())
+            .collect();
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            if !skipped.contains(&child.id()) {
+                self.pattern_names(child, out);
+            }
+        }
+    }
+
+    fn text(&self, node: Node<'_>) -> &'s str {
+        self.source.get(node.byte_range()).unwrap_or_default()
+    }
+
+    /// 1-based line and character column of `node`.
+    fn position(&self, node: Node<'_>) -> (u32, u32) {
+        let start = node.start_position();
+        let line_start = node.start_byte() - start.column;
+        let column = self
+            .source
+            .get(line_start..node.start_byte())
+            .map_or(start.column, |prefix| prefix.chars().count());
+        (start.row as u32 + 1, column as u32 + 1)
+    }
+}
+
+fn first_identifier(node: Node<'_>) -> Option<Node<'_>> {
+    if node.kind() == "identifier" {
+        return Some(node);
+    }
+    let mut cursor = node.walk();
+    let found = node
+        .named_children(&mut cursor)
+        .find_map(|child| first_identifier(child));
+    found
+}
+
+/// Whether an identifier is assigned to: the target of an assignment,
+/// `++`/`--`, or a loop variable re-assigned by a later loop.
+fn is_write(node: Node<'_>) -> bool {
+    let mut at = node;
+    while let Some(parent) = at.parent() {
+        let is_field = |field: &str| {
+            parent
+                .child_by_field_name(field)
+                .is_some_and(|child| child.id() == at.id())
+        };
+        match parent.kind() {
+            "inc_dec_statement" => return true,
+            "update_expression" => return is_field("argument"),
+            "named_expression" => return is_field("name"),
+            "assignment_statement"
+            | "assignment_expression"
+            | "compound_assignment_expr"
+            | "augmented_assignment_expression"
+            | "assignment"
+            | "augmented_assignment"
+            | "for_statement"
+            | "for_in_clause"
+            | "range_clause" => return is_field("left"),
+            kind if TARGET_LISTS.contains(&kind) => at = parent,
+            _ => return false,
+        }
+    }
+    false
+}
+
+/// `Name` in `User{Name: name}`: a field key of a Go struct literal. Keys of
+/// map literals are expressions.
+fn is_struct_literal_key(node: Node<'_>) -> bool {
+    let Some(element) = node.parent().filter(|p| p.kind() == "literal_element") else {
+        return false;
+    };
+    let Some(keyed) = element.parent().filter(|p| p.kind() == "keyed_element") else {
+        return false;
+    };
+    if keyed.named_child(0).map(|key| key.id()) != Some(element.id()) {
+        return false;
+    }
+    let literal = keyed.parent().and_then(|value| value.parent());
+    !literal
+        .filter(|literal| literal.kind() == "composite_literal")
+        .and_then(|literal| literal.child_by_field_name("type"))
+        .is_some_and(|ty| ty.kind() == "map_type")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+
+    fn locals(source: &str, language: &str) -> Vec<LocalRecord> {
+        let tree = parse_file(source, language).unwrap();
+        extract_locals(&tree, source, language, "src", &[], "repo", "main")
+    }
+
+    /// `name@line:column` of every use, `!` marking writes.
+    fn uses(record: &LocalRecord) -> Vec<String> {
+        record
+            .uses
+            .iter()
+            .map(|use_| {
+                let write = if use_.write { "!" } else { "" };
+                format!("{}{}:{}", write, use_.line, use_.column)
+            })
+            .collect()
+    }
+
+    #[test]
+    fn go_locals_follow_block_scopes_and_redeclaration() {
+        let source = "package api\n\n\
+            func HandleRequest(w Writer, r *Request) error {\n\
+            \tclaims, err := parse(r)\n\
+            \tif err != nil {\n\
+            \t\treturn err\n\
+            \t}\n\
+            \tuser, err := load(claims)\n\
+            \tfor _, claims := range user.Roles {\n\
+            \t\tuse(claims)\n\
+            \t}\n\
+            \tclaims = nil\n\
+            \treturn write(w, User{Name: user.Name})\n\
+            }\n";
+        let records = locals(source, "go");
+        let names: Vec<(&str, &str, u32)> = records
+            .iter()
+            .map(|r| (r.name.as_str(), r.kind.as_str(), r.line))
+            .collect();
+        assert_eq!(
+            names,
+            vec![
+                ("w", "parameter", 3),
+                ("r", "parameter", 3),
+                ("claims", "local", 4),
+                ("err", "local", 4),
+                ("user", "local", 8),
+                ("claims", "local", 9),
+            ]
+        );
+        assert_eq!(uses(&records[2]), vec!["!4:2", "8:20", "!12:2"]);
+        // `user, err :=` assigns the existing `err`.
+        assert_eq!(uses(&records[3]), vec!["!4:10", "5:5", "6:10", "!8:8"]);
+        assert_eq!(uses(&records[5]), vec!["!9:9", "10:7"]);
+        // The struct key `Name` is not a use of anything.
+        assert_eq!(uses(&records[4]).len(), 3);
+    }
+
+    #[test]
+    fn rust_shadowing_patterns_and_closures() {
+        let source = "fn total(items: &[Item], limit: u32) -> u32 {\n\
+            \x20   let mut sum = 0;\n\
+            \x20   for Item { price, .. } in items {\n\
+            \x20       sum += price;\n\
+            \x20   }\n\
+            \x20   let sum = sum.min(limit);\n\
+            \x20   let cap = |x: u32| x.min(sum);\n\
+            \x20   match cap(sum) {\n\
+            \x20       Some(n) if n > 0 => n,\n\
+            \x20       None => sum,\n\
+            \x20   }\n\
+            }\n";
+        let records = locals(source, "rust");
+        let find = |name: &str, line: u32| {
+            records
+                .iter()
+                .find(|r| r.name == name && r.line == line)
+                .unwrap_or_else(|| panic!("{name}@{line}"))
+        };
+        assert_eq!(find("limit", 1).kind, "parameter");
+        assert_eq!(uses(find("sum", 2)), vec!["!2:13", "!4:9", "6:15"]);
+        assert_eq!(uses(find("price", 3)), vec!["!3:16", "4:16"]);
+        assert_eq!(uses(find("sum", 6)), vec!["!6:9", "7:30", "8:15", "10:17"]);
+        assert_eq!(uses(find("x", 7)), vec!["!7:16", "7:24"]);
+        assert_eq!(uses(find("n", 9)), vec!["!9:14", "9:20", "9:29"]);
+        assert!(records.iter().all(|r| r.name != "None"));
+    }
+
+    #[test]
+    fn python_binds_assignments_for_the_whole_function() {
+        let source = "def handle(request, *args, retries=3):\n\
+            \x20   for attempt in range(retries):\n\
+            \x20       if attempt:\n\
+            \x20           log(claims)\n\
+            \x20       claims = parse(request)\n\
+            \x20   global CACHE\n\
+            \x20   CACHE = claims\n\
+            \x20   return [c for c in claims if c]\n";
+        let records = locals(source, "python");
+        let names: Vec<(&str, &str)> = records
+            .iter()
+            .map(|r| (r.name.as_str(), r.kind.as_str()))
+            .collect();
+        assert_eq!(
+            names,
+            vec![
+                ("request", "parameter"),
+                ("args", "parameter"),
+                ("retries", "parameter"),
+                ("attempt", "local"),
+                ("claims", "local"),
+                ("c", "local"),
+            ]
+        );
+        // Read on line 4 before the assignment on line 5: still the local.
+        assert_eq!(uses(&records[4]), vec!["4:17", "!5:9", "7:13", "8:24"]);
+        assert_eq!(uses(&records[5]), vec!["8:13", "!8:19", "8:34"]);
+    }
+
+    #[test]
+    fn typescript_parameters_destructuring_and_catch() {
+        let source = "function load(id: string, { retries = 1 }: Options) {\n\
+            \x20 const user = fetch(id, { retries });\n\
+            \x20 try {\n\
+            \x20   let id = user.id;\n\
+            \x20   id += 1;\n\
+            \x20 } catch (err) {\n\
+            \x20   report(err, id);\n\
+            \x20 }\n\
+            \x20 return user;\n\
+            }\n";
+        let records = locals(source, "typescript");
+        let find =
+            |name: &str, line: u32| records.iter().find(|r| r.name == name && r.line == line);
+        assert_eq!(uses(find("id", 1).unwrap()), vec!["!1:15", "2:22", "7:17"]);
+        assert_eq!(uses(find("retries", 1).unwrap()), vec!["!1:29", "2:28"]);
+        assert_eq!(uses(find("id", 4).unwrap()), vec!["!4:9", "!5:5"]);
+        assert_eq!(uses(find("err", 6).unwrap()), vec!["!6:12", "7:12"]);
+        assert_eq!(uses(find("user", 2).unwrap()), vec!["!2:9", "4:14", "9:10"]);
+    }
+}
@@ -1,23 +1,100 @@
 use crate::language_grammars;
 use cruxe_core::error::ParseError;
 use cruxe_core::languages;
+use std::cell::RefCell;
+use std::collections::HashMap;
+
+thread_local! {
+    /// One parser per language per thread. Index workers parse many files of
+    /// the same language, and reusing the parser skips re-loading the grammar.
+    static PARSERS: RefCell<HashMap<String, tree_sitter::Parser>> = RefCell::new(HashMap::new());
+}
 
 /// Parse a source file with tree-sitter and return the syntax tree.
 pub fn parse_file(source: &str, language: &str) -> Result<tree_sitter::Tree, ParseError> {
-    let mut parser = tree_sitter::Parser::new();
+    PARSERS.with(|parsers| {
+        let mut parsers = parsers.borrow_mut();
+        let parser = match parsers.entry(language.to_string()) {
+            std::collections::hash_map::Entry::Occupied(entry) => entry.into_mut(),
+            std::collections::hash_map::Entry::Vacant(entry) => {
+                let mut parser = tree_sitter::Parser::new();
+                let ts_language = get_language(language)?;
+                if ts_language.is_wasm() {
+                    let store = crate::runtime_grammars::wasm_store().map_err(|e| {
+                        ParseError::GrammarNotAvailable {
+                            language: format!("{}: {}", language, e),
+                        }
+                    })?;
+                    parser
+                        .set_wasm_store(store)
+                        .map_err(|e| ParseError::GrammarNotAvailable {
+                            language: format!("{}: {}", language, e),
+                        })?;
+                }
+                parser
+                    .set_language(&ts_language)
+                    .map_err(|e| ParseError::GrammarNotAvailable {
+                        language: format!("{}: {}", language, e),
+                    })?;
+                entry.insert(parser)
+            }
+        };
+        // Drop any state left by a previous parse that did not finish.
+        parser.reset();
+        parser
+            .parse(source, None)
+            .ok_or_else(|| ParseError::TreeSitterFailed {
+                path: format!("<{} source>", language),
+            })
+    })
+}
 
-    let ts_language = get_language(language)?;
-    parser
-        .set_language(&ts_language)
-        .map_err(|e| ParseError::GrammarNotAvailable {
-            language: format!("{}: {}", language, e),
-        })?;
+/// Lines tree-sitter's error recovery skipped (`ERROR` nodes) or patched
+/// (`MISSING` nodes), 1-based and merged where they touch.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct ErrorRegion {
+    pub start_line: u32,
+    pub end_line: u32,
+    /// Only tokens the parser inserted, no skipped text.
+    pub missing: bool,
+}
 
-    parser
-        .parse(source, None)
-        .ok_or_else(|| ParseError::TreeSitterFailed {
-            path: format!("<{} source>", language),
-        })
+/// The error regions of a parsed tree; empty when it parsed cleanly.
+pub fn error_regions(tree: &tree_sitter::Tree) -> Vec<ErrorRegion> {
+    let mut regions = Vec::new();
+    let mut stack = vec![tree.root_node()];
+    while let Some(node) = stack.pop() {
+        if node.is_error() || node.is_missing() {
+            let start = node.start_position();
+            let end = node.end_position();
+            // A region ending at the start of a line does not cover it.
+            let end_row = if end.column == 0 && end.row > start.row {
+                end.row - 1
+            } else {
+                end.row
+            };
+            regions.push(ErrorRegion {
+                start_line: start.row as u32 + 1,
+                end_line: end_row as u32 + 1,
+                missing: node.is_missing(),
+            });
+        } else if node.has_error() {
+            let mut cursor = node.walk();
+            stack.extend(node.children(&mut cursor));
+        }
+    }
+    regions.sort_by_key(|region| (region.start_line, region.end_line));
+    let mut merged: Vec<ErrorRegion> = Vec::with_capacity(regions.len());
+    for region in regions {
+        match merged.last_mut() {
+            Some(last) if region.start_line <= last.end_line + 1 => {
+                last.end_line = last.end_line.max(region.end_line);
+                last.missing &= region.missing;
+            }
+            _ => merged.push(region),
+        }
+    }
+    merged
 }
 
 /// Get the tree-sitter language grammar for a given language.
@@ -27,12 +104,47 @@ pub fn get_language(language: &str) -> Result<tree_sitter::Language, ParseError>
     })
 }
 
-/// Check if a language grammar is available.
+/// Check if a language grammar is available, built in or loaded from
+/// `[grammars]`.
 pub fn is_language_supported(language: &str) -> bool {
     languages::is_indexable_source_language(language)
+        || crate::runtime_grammars::is_registered(language)
 }
 
 /// Get list of supported languages.
 pub fn supported_languages() -> Vec<&'static str> {
     languages::supported_indexable_languages().to_vec()
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parsers_are_reused_per_language_on_a_thread() {
+        let rust = parse_file("fn a() {}", "rust").unwrap();
+        let go = parse_file("package main\n\nfunc a() {}\n", "go").unwrap();
+        let rust_again = parse_file("struct S;", "rust").unwrap();
+        assert_eq!(rust.root_node().kind(), "source_file");
+        assert_eq!(go.root_node().child(0).unwrap().kind(), "package_clause");
+        assert_eq!(
+            rust_again.root_node().child(0).unwrap().kind(),
+            "struct_item"
+        );
+        assert!(!rust_again.root_node().has_error());
+        PARSERS.with(|parsers| assert_eq!(parsers.borrow().len(), 2));
+        assert!(parse_file("x", "cobol").is_err());
+    }
+
+    #[test]
+    fn error_regions_skip_the_lines_that_parsed() {
+        let clean = parse_file("fn a() {}\n", "rust").unwrap();
+        assert!(error_regions(&clean).is_empty());
+
+        let source = "package main\n\nfunc a() {}\n\nfunc b( {\n\t@@@\n}\n";
+        let tree = parse_file(source, "go").unwrap();
+        let regions = error_regions(&tree);
+        assert!(!regions.is_empty());
+        assert!(regions[0].start_line >= 5);
+    }
+}
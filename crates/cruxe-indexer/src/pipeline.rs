@@ -0,0 +1,161 @@
+use std::sync::mpsc;
+use std::time::{Duration, Instant};
+
+/// Number of prepared batches allowed in flight between the parse stage and
+/// the write/resolve stage. Once full, the parse stage blocks (backpressure).
+pub const DEFAULT_QUEUE_DEPTH: usize = 2;
+
+/// Batch sizer that reacts to backpressure from the downstream stage.
+///
+/// When the producer spends a large share of its time blocked on a full
+/// queue, the consumer is the bottleneck and batches shrink so fewer parsed
+/// files sit in memory. When the producer never blocks, batches grow toward
+/// `max` to amortize per-batch overhead.
+#[derive(Debug, Clone)]
+pub struct AdaptiveBatchSizer {
+    min: usize,
+    max: usize,
+    current: usize,
+}
+
+impl AdaptiveBatchSizer {
+    pub fn new(min: usize, max: usize, initial: usize) -> Self {
+        let min = min.max(1);
+        let max = max.max(min);
+        Self {
+            min,
+            max,
+            current: initial.clamp(min, max),
+        }
+    }
+
+    pub fn current(&self) -> usize {
+        self.current
+    }
+
+    /// Record one batch: how long it took to produce and how long the
+    /// producer then waited for queue space. Returns the next batch size.
+    pub fn observe(&mut self, produce: Duration, blocked: Duration) -> usize {
+        if blocked > produce / 2 {
+            self.current = (self.current / 2).max(self.min);
+        } else if blocked <= produce / 10 {
+            self.current = (self.current + self.current / 4 + 1).min(self.max);
+        }
+        self.current
+    }
+}
+
+/// Run a two-stage pipeline over `items` with a bounded queue between stages.
+///
+/// `produce` runs on a dedicated thread and turns a slice of items into a
+/// batch; `consume` runs on the calling thread (so it may hold non-`Send`
+/// state such as a SQLite connection). If `consume` fails, the producer is
+/// stopped at its next send and the error is returned.
+pub fn run_bounded<I, T, E, P, C>(
+    items: &[I],
+    mut sizer: AdaptiveBatchSizer,
+    queue_depth: usize,
+    produce: P,
+    mut consume: C,
+) -> Result<(), E>
+where
+    I: Sync,
+    T: Send,
+    P: Fn(&[I]) -> Vec<T> + Sync,
+    C: FnMut(Vec<T>) -> Result<(), E>,
+{
+    let (tx, rx) = mpsc::sync_channel::<Vec<T>>(queue_depth.max(1));
+    std::thread::scope(|scope| {
+        let produce = &produce;
+        scope.spawn(move || {
+            let mut offset = 0usize;
+            while offset < items.len() {
+                let end = (offset + sizer.current()).min(items.len());
+                let started = Instant::now();
+                let batch = produce(&items[offset..end]);
+                let produced_in = started.elapsed();
+                offset = end;
+
+                let send_started = Instant::now();
+                if tx.send(batch).is_err() {
+                    // Consumer bailed out; stop producing.
+                    return;
+                }
+                sizer.observe(produced_in, send_started.elapsed());
+            }
+        });
+
+        // Iterating by value moves `rx` into the loop, so an early return
+        // drops it and the producer's pending `send` fails instead of hanging.
+        for batch in rx {
+            consume(batch)?;
+        }
+        Ok(())
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    #[test]
+    fn sizer_shrinks_under_backpressure_and_grows_when_idle() {
+        let mut sizer = AdaptiveBatchSizer::new(8, 256, 64);
+        let shrunk = sizer.observe(Duration::from_millis(10), Duration::from_millis(40));
+        assert_eq!(shrunk, 32);
+        let grown = sizer.observe(Duration::from_millis(10), Duration::ZERO);
+        assert_eq!(grown, 41);
+    }
+
+    #[test]
+    fn sizer_respects_bounds() {
+        let mut sizer = AdaptiveBatchSizer::new(4, 16, 100);
+        assert_eq!(sizer.current(), 16);
+        for _ in 0..10 {
+            sizer.observe(Duration::from_millis(1), Duration::from_secs(1));
+        }
+        assert_eq!(sizer.current(), 4);
+        for _ in 0..10 {
+            sizer.observe(Duration::from_millis(1), Duration::ZERO);
+        }
+        assert_eq!(sizer.current(), 16);
+    }
+
+    #[test]
+    fn run_bounded_delivers_every_item_in_order() {
+        let items: Vec<usize> = (0..1000).collect();
+        let mut seen = Vec::new();
+        run_bounded::<_, _, (), _, _>(
+            &items,
+            AdaptiveBatchSizer::new(1, 64, 7),
+            1,
+            |chunk| chunk.iter().map(|item| item * 2).collect(),
+            |batch| {
+                seen.extend(batch);
+                Ok(())
+            },
+        )
+        .unwrap();
+        assert_eq!(seen, items.iter().map(|item| item * 2).collect::<Vec<_>>());
+    }
+
+    #[test]
+    fn run_bounded_stops_producer_when_consumer_fails() {
+        let items: Vec<usize> = (0..10_000).collect();
+        let produced = AtomicUsize::new(0);
+        let result = run_bounded(
+            &items,
+            AdaptiveBatchSizer::new(10, 10, 10),
+            1,
+            |chunk| {
+                produced.fetch_add(chunk.len(), Ordering::SeqCst);
+                chunk.to_vec()
+            },
+            |_batch| Err("write failed"),
+        );
+        assert_eq!(result, Err("write failed"));
+        // At most the failing batch, one queued batch and one in production.
+        assert!(produced.load(Ordering::SeqCst) <= 40);
+    }
+}
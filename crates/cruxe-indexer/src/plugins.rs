@@ -0,0 +1,614 @@
+//! `[plugins]`: external analyzers that see every indexed file and can add
+//! symbols, calls and findings, so teams can ship in-house checks without
+//! forking cruxe.
+//!
+//! A plugin is a program started once per run from the repository root. For
+//! each file of a language it wants, cruxe writes one JSON line to its stdin:
+//!
+//! ```json
+//! {"protocol":1,"path":"api/user.go","language":"go","source":"...",
+//!  "symbols":[{"symbol_id":"...","name":"getUser","qualified_name":"api.getUser",
+//!              "kind":"function","line_start":7,"line_end":19}],
+//!  "calls":[{"from_symbol_id":"...","to_name":"db.Query","line":9}],
+//!  "ast":{"kind":"source_file","start_line":1,"end_line":40,"children":[...]}}
+//! ```
+//!
+//! (`ast` only with `ast = true`) and reads one JSON line back, every field
+//! optional:
+//!
+//! ```json
+//! {"symbols":[{"name":"GET /users","kind":"constant","line_start":7}],
+//!  "calls":[{"from":"api.getUser","to":"auth.Check","line":8}],
+//!  "findings":[{"rule":"handler-case","severity":"warning","line":7,
+//!               "symbol":"api.getUser","message":"..."}]}
+//! ```
+//!
+//! A call's `from` is a symbol id, qualified name or name of the file's
+//! symbols, its own included; `to` is resolved the same way and kept as a
+//! name otherwise. Findings show up in `cruxe check` as
+//! `plugin/<name>/<rule>`. A plugin that exits, answers garbage to every
+//! request or takes longer than `timeout_ms` on a file is stopped for the
+//! rest of the run with a `plugin_failed` warning; indexing goes on.
+//!
+//! Plugins run arbitrary programs, so they are only read from the global
+//! config and `--config`; a `[plugins]` section in a repository's own
+//! `.cruxe.yaml` or `.cruxe/config.toml` is ignored with a warning.
+
+use cruxe_core::config::PluginConfig;
+use cruxe_core::error::LogCode;
+use cruxe_core::types::{
+    CallEdge, PluginFindingRecord, SymbolKind, SymbolRecord, compute_symbol_id,
+    compute_symbol_stable_id,
+};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::io::{BufRead, BufReader, Write};
+use std::path::Path;
+use std::process::{Child, ChildStdin, Command, Stdio};
+use std::sync::mpsc::{self, Receiver, RecvTimeoutError};
+use std::time::Duration;
+use tracing::warn;
+
+use crate::parser;
+
+/// Version of the line protocol, sent with every request.
+pub const PROTOCOL_VERSION: u32 = 1;
+
+const DEFAULT_TIMEOUT_MS: u64 = 10_000;
+
+/// A file handed to the plugins, with what cruxe extracted from it.
+pub struct PluginInput<'a> {
+    pub repo: &'a str,
+    pub r#ref: &'a str,
+    pub commit: Option<&'a str>,
+    pub path: &'a str,
+    pub language: &'a str,
+    pub source: &'a str,
+    pub symbols: &'a [SymbolRecord],
+    pub call_edges: &'a [CallEdge],
+}
+
+/// What the plugins added to a file.
+#[derive(Debug, Default)]
+pub struct PluginOutput {
+    pub symbols: Vec<SymbolRecord>,
+    pub call_edges: Vec<CallEdge>,
+    pub findings: Vec<PluginFindingRecord>,
+}
+
+#[derive(Serialize)]
+struct Request<'a> {
+    protocol: u32,
+    path: &'a str,
+    language: &'a str,
+    source: &'a str,
+    symbols: Vec<RequestSymbol<'a>>,
+    calls: Vec<RequestCall<'a>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    ast: Option<AstNode>,
+}
+
+#[derive(Serialize)]
+struct RequestSymbol<'a> {
+    symbol_id: &'a str,
+    name: &'a str,
+    qualified_name: &'a str,
+    kind: &'static str,
+    line_start: u32,
+    line_end: u32,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    signature: Option<&'a str>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    parent_symbol_id: Option<&'a str>,
+}
+
+#[derive(Serialize)]
+struct RequestCall<'a> {
+    from_symbol_id: &'a str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    to_symbol_id: Option<&'a str>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    to_name: Option<&'a str>,
+    line: u32,
+}
+
+/// A named node of the syntax tree; anonymous tokens are left out.
+#[derive(Debug, Serialize)]
+struct AstNode {
+    kind: &'static str,
+    start_line: u32,
+    end_line: u32,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    children: Vec<AstNode>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(default)]
+struct Response {
+    symbols: Vec<ResponseSymbol>,
+    calls: Vec<ResponseCall>,
+    findings: Vec<ResponseFinding>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ResponseSymbol {
+    name: String,
+    #[serde(default)]
+    qualified_name: Option<String>,
+    kind: String,
+    line_start: u32,
+    #[serde(default)]
+    line_end: Option<u32>,
+    #[serde(default)]
+    signature: Option<String>,
+    #[serde(default)]
+    visibility: Option<String>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ResponseCall {
+    from: String,
+    to: String,
+    line: u32,
+}
+
+#[derive(Debug, Deserialize)]
+struct ResponseFinding {
+    rule: String,
+    #[serde(default)]
+    severity: Option<String>,
+    line: u32,
+    #[serde(default)]
+    symbol: Option<String>,
+    message: String,
+}
+
+/// The plugins of a run, started once and fed file by file.
+#[derive(Default)]
+pub struct PluginHost {
+    plugins: Vec<RunningPlugin>,
+}
+
+struct RunningPlugin {
+    name: String,
+    config: PluginConfig,
+    timeout: Duration,
+    child: Child,
+    /// Taken on drop: closing it is the plugin's cue to exit.
+    stdin: Option<ChildStdin>,
+    lines: Receiver<std::io::Result<String>>,
+    /// Stopped after a failure; skipped for the rest of the run.
+    stopped: bool,
+}
+
+impl PluginHost {
+    /// Start the enabled plugins of `plugins` in `root`. A plugin that
+    /// cannot be started is reported and left out.
+    pub fn start(plugins: &BTreeMap<String, PluginConfig>, root: &Path) -> Self {
+        let plugins = plugins
+            .iter()
+            .filter(|(_, config)| !config.disabled)
+            .filter_map(
+                |(name, config)| match RunningPlugin::spawn(name, config, root) {
+                    Ok(plugin) => Some(plugin),
+                    Err(err) => {
+                        warn!(
+                            code = LogCode::PluginFailed.as_str(),
+                            plugin = %name,
+                            error = %err,
+                            "Plugin could not be started"
+                        );
+                        None
+                    }
+                },
+            )
+            .collect();
+        Self { plugins }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.plugins.is_empty()
+    }
+
+    /// Send `input` to every running plugin that wants its language and
+    /// collect what they add.
+    pub fn analyze(&mut self, input: &PluginInput<'_>) -> PluginOutput {
+        let mut output = PluginOutput::default();
+        let wanted: Vec<usize> = self
+            .plugins
+            .iter()
+            .enumerate()
+            .filter(|(_, plugin)| !plugin.stopped && plugin.config.wants(input.language))
+            .map(|(idx, _)| idx)
+            .collect();
+        if wanted.is_empty() {
+            return output;
+        }
+        let ast = wanted
+            .iter()
+            .any(|&idx| self.plugins[idx].config.ast)
+            .then(|| syntax_tree(input.source, input.language))
+            .flatten();
+        let mut request = Request {
+            protocol: PROTOCOL_VERSION,
+            path: input.path,
+            language: input.language,
+            source: input.source,
+            symbols: input
+                .symbols
+                .iter()
+                .map(|symbol| RequestSymbol {
+                    symbol_id: &symbol.symbol_id,
+                    name: &symbol.name,
+                    qualified_name: &symbol.qualified_name,
+                    kind: symbol.kind.as_str(),
+                    line_start: symbol.line_start,
+                    line_end: symbol.line_end,
+                    signature: symbol.signature.as_deref(),
+                    parent_symbol_id: symbol.parent_symbol_id.as_deref(),
+                })
+                .collect(),
+            calls: input
+                .call_edges
+                .iter()
+                .map(|edge| RequestCall {
+                    from_symbol_id: &edge.from_symbol_id,
+                    to_symbol_id: edge.to_symbol_id.as_deref(),
+                    to_name: edge.to_name.as_deref(),
+                    line: edge.source_line,
+                })
+                .collect(),
+            ast: None,
+        };
+        let Ok(without_ast) = serde_json::to_string(&request) else {
+            return output;
+        };
+        let with_ast = match ast {
+            Some(ast) => {
+                request.ast = Some(ast);
+                serde_json::to_string(&request).unwrap_or_else(|_| without_ast.clone())
+            }
+            None => without_ast.clone(),
+        };
+        for idx in wanted {
+            let plugin = &mut self.plugins[idx];
+            let line = if plugin.config.ast {
+                &with_ast
+            } else {
+                &without_ast
+            };
+            let Some(response) = plugin.exchange(line, input.path) else {
+                continue;
+            };
+            let name = plugin.name.clone();
+            output.add(&name, response, input);
+        }
+        output
+    }
+}
+
+impl RunningPlugin {
+    fn spawn(name: &str, config: &PluginConfig, root: &Path) -> std::io::Result<Self> {
+        let Some((program, args)) = config.command.split_first() else {
+            return Err(std::io::Error::new(
+                std::io::ErrorKind::InvalidInput,
+                "empty `command`",
+            ));
+        };
+        let mut child = Command::new(program)
+            .args(args)
+            .current_dir(root)
+            .stdin(Stdio::piped())
+            .stdout(Stdio::piped())
+            .stderr(Stdio::inherit())
+            .spawn()?;
+        let stdin = child.stdin.take().expect("stdin is piped");
+        let stdout = child.stdout.take().expect("stdout is piped");
+        // Responses are read on their own thread so a plugin that hangs can
+        // be timed out.
+        let (sender, lines) = mpsc::channel();
+        std::thread::Builder::new()
+            .name(format!("cruxe-plugin-{name}"))
+            .spawn(move || {
+                for line in BufReader::new(stdout).lines() {
+                    if sender.send(line).is_err() {
+                        break;
+                    }
+                }
+            })?;
+        Ok(Self {
+            name: name.to_string(),
+            config: config.clone(),
+            timeout: Duration::from_millis(config.timeout_ms.unwrap_or(DEFAULT_TIMEOUT_MS)),
+            child,
+            stdin: Some(stdin),
+            lines,
+            stopped: false,
+        })
+    }
+
+    /// Write one request and wait for its answer. A broken or slow plugin is
+    /// stopped; a response that does not parse is reported and skipped.
+    fn exchange(&mut self, request: &str, path: &str) -> Option<Response> {
+        let Some(stdin) = self.stdin.as_mut() else {
+            return None;
+        };
+        let sent = writeln!(stdin, "{request}").and_then(|()| stdin.flush());
+        if let Err(err) = sent {
+            self.stop(path, &format!("write failed: {err}"));
+            return None;
+        }
+        let line = match self.lines.recv_timeout(self.timeout) {
+            Ok(Ok(line)) => line,
+            Ok(Err(err)) => {
+                self.stop(path, &format!("read failed: {err}"));
+                return None;
+            }
+            Err(RecvTimeoutError::Timeout) => {
+                self.stop(
+                    path,
+                    &format!("no answer within {} ms", self.timeout.as_millis()),
+                );
+                return None;
+            }
+            Err(RecvTimeoutError::Disconnected) => {
+                self.stop(path, "exited");
+                return None;
+            }
+        };
+        match serde_json::from_str(&line) {
+            Ok(response) => Some(response),
+            Err(err) => {
+                warn!(
+                    code = LogCode::PluginFailed.as_str(),
+                    plugin = %self.name,
+                    path,
+                    error = %err,
+                    "Plugin answered with invalid JSON"
+                );
+                None
+            }
+        }
+    }
+
+    fn stop(&mut self, path: &str, reason: &str) {
+        warn!(
+            code = LogCode::PluginFailed.as_str(),
+            plugin = %self.name,
+            path,
+            error = reason,
+            "Plugin stopped for the rest of the run"
+        );
+        self.stopped = true;
+        let _ = self.child.kill();
+        let _ = self.child.wait();
+    }
+}
+
+impl Drop for RunningPlugin {
+    fn drop(&mut self) {
+        if self.stopped {
+            return;
+        }
+        // A plugin that lingers after stdin closes is killed rather than
+        // waited for.
+        drop(self.stdin.take());
+        for _ in 0..20 {
+            if matches!(self.child.try_wait(), Ok(Some(_))) {
+                return;
+            }
+            std::thread::sleep(Duration::from_millis(50));
+        }
+        let _ = self.child.kill();
+        let _ = self.child.wait();
+    }
+}
+
+impl PluginOutput {
+    fn add(&mut self, plugin: &str, response: Response, input: &PluginInput<'_>) {
+        let commit = input.commit.map(str::to_string);
+        for symbol in response.symbols {
+            let Some(kind) = SymbolKind::parse_kind(&symbol.kind) else {
+                warn!(
+                    code = LogCode::PluginFailed.as_str(),
+                    plugin,
+                    path = input.path,
+                    kind = %symbol.kind,
+                    "Plugin symbol of unknown kind skipped"
+                );
+                continue;
+            };
+            let qualified_name = symbol.qualified_name.unwrap_or_else(|| symbol.name.clone());
+            self.symbols.push(SymbolRecord {
+                repo: input.repo.to_string(),
+                r#ref: input.r#ref.to_string(),
+                commit: commit.clone(),
+                path: input.path.to_string(),
+                language: input.language.to_string(),
+                symbol_id: compute_symbol_id(
+                    input.repo,
+                    input.r#ref,
+                    input.path,
+                    &kind,
+                    symbol.line_start,
+                    &symbol.name,
+                ),
+                symbol_stable_id: compute_symbol_stable_id(
+                    input.language,
+                    &kind,
+                    &qualified_name,
+                    symbol.signature.as_deref(),
+                ),
+                name: symbol.name,
+                qualified_name,
+                kind,
+                signature: symbol.signature,
+                line_start: symbol.line_start,
+                line_end: symbol.line_end.unwrap_or(symbol.line_start),
+                parent_symbol_id: None,
+                visibility: symbol.visibility,
+                content: None,
+            });
+        }
+        for call in response.calls {
+            let Some(from) = self.resolve(input.symbols, &call.from) else {
+                warn!(
+                    code = LogCode::PluginFailed.as_str(),
+                    plugin,
+                    path = input.path,
+                    from = %call.from,
+                    "Plugin call from an unknown symbol skipped"
+                );
+                continue;
+            };
+            let to = self.resolve(input.symbols, &call.to);
+            self.call_edges.push(CallEdge {
+                repo: input.repo.to_string(),
+                ref_name: input.r#ref.to_string(),
+                from_symbol_id: from,
+                to_name: to.is_none().then_some(call.to),
+                to_symbol_id: to,
+                edge_type: "calls".to_string(),
+                confidence: "heuristic".to_string(),
+                source_file: input.path.to_string(),
+                source_line: call.line,
+            });
+        }
+        for finding in response.findings {
+            self.findings.push(PluginFindingRecord {
+                repo: input.repo.to_string(),
+                r#ref: input.r#ref.to_string(),
+                path: input.path.to_string(),
+                plugin: plugin.to_string(),
+                rule: finding.rule,
+                severity: finding.severity.unwrap_or_else(|| "warning".to_string()),
+                line: finding.line,
+                symbol: finding.symbol.unwrap_or_default(),
+                message: finding.message,
+            });
+        }
+    }
+
+    /// Symbol id of the file's symbol, extracted or added by a plugin, with
+    /// this id, qualified name or name.
+    fn resolve(&self, extracted: &[SymbolRecord], reference: &str) -> Option<String> {
+        extracted
+            .iter()
+            .chain(&self.symbols)
+            .find(|symbol| symbol.symbol_id == reference)
+            .or_else(|| {
+                extracted
+                    .iter()
+                    .chain(&self.symbols)
+                    .find(|symbol| symbol.qualified_name == reference)
+            })
+            .or_else(|| {
+                extracted
+                    .iter()
+                    .chain(&self.symbols)
+                    .find(|symbol| symbol.name == reference)
+            })
+            .map(|symbol| symbol.symbol_id.clone())
+    }
+}
+
+/// The named nodes of `source`, when `language` has a grammar.
+fn syntax_tree(source: &str, language: &str) -> Option<AstNode> {
+    let tree = parser::parse_file(source, language).ok()?;
+    Some(ast_node(tree.root_node()))
+}
+
+fn ast_node(node: tree_sitter::Node<'_>) -> AstNode {
+    let mut cursor = node.walk();
+    AstNode {
+        kind: node.kind(),
+        start_line: node.start_position().row as u32 + 1,
+        end_line: node.end_position().row as u32 + 1,
+        children: node.named_children(&mut cursor).map(ast_node).collect(),
+    }
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+
+    fn plugin(script: &str, timeout_ms: u64) -> BTreeMap<String, PluginConfig> {
+        BTreeMap::from([(
+            "naming".to_string(),
+            PluginConfig {
+                command: vec!["sh".to_string(), "-c".to_string(), script.to_string()],
+                languages: vec!["go".to_string()],
+                timeout_ms: Some(timeout_ms),
+                ..PluginConfig::default()
+            },
+        )])
+    }
+
+    fn symbol(name: &str, line_start: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "api/user.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("id-{name}"),
+            symbol_stable_id: format!("stable-{name}"),
+            name: name.to_string(),
+            qualified_name: format!("api.{name}"),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end: line_start + 5,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn input<'a>(symbols: &'a [SymbolRecord], language: &'a str) -> PluginInput<'a> {
+        PluginInput {
+            repo: "repo",
+            r#ref: "main",
+            commit: None,
+            path: "api/user.go",
+            language,
+            source: "package api\n",
+            symbols,
+            call_edges: &[],
+        }
+    }
+
+    #[test]
+    fn plugins_add_symbols_calls_and_findings() {
+        let response = r#"{"symbols":[{"name":"GET /users","kind":"constant","line_start":3}],"calls":[{"from":"api.getUser","to":"GET /users","line":4},{"from":"getUser","to":"log.Printf","line":5}],"findings":[{"rule":"handler-case","line":3,"symbol":"api.getUser","message":"exported handlers start with a capital"}]}"#;
+        let script = format!("while read -r line; do echo '{response}'; done");
+        let mut host = PluginHost::start(&plugin(&script, 5_000), Path::new("."));
+        let symbols = [symbol("getUser", 3)];
+
+        let output = host.analyze(&input(&symbols, "go"));
+        assert_eq!(output.symbols.len(), 1);
+        assert_eq!(output.symbols[0].qualified_name, "GET /users");
+        assert_eq!(output.symbols[0].kind, SymbolKind::Constant);
+        assert_eq!(output.call_edges.len(), 2);
+        assert_eq!(output.call_edges[0].from_symbol_id, "id-getUser");
+        assert_eq!(
+            output.call_edges[0].to_symbol_id.as_deref(),
+            Some(output.symbols[0].symbol_id.as_str())
+        );
+        assert_eq!(output.call_edges[1].to_name.as_deref(), Some("log.Printf"));
+        assert_eq!(output.findings[0].rule, "handler-case");
+        assert_eq!(output.findings[0].severity, "warning");
+
+        // Other languages are not sent.
+        let output = host.analyze(&input(&symbols, "rust"));
+        assert!(output.symbols.is_empty() && output.findings.is_empty());
+    }
+
+    #[test]
+    fn a_plugin_that_hangs_is_stopped_for_the_run() {
+        let mut host = PluginHost::start(&plugin("sleep 5", 100), Path::new("."));
+        let symbols = [symbol("getUser", 3)];
+        assert!(host.analyze(&input(&symbols, "go")).findings.is_empty());
+        assert!(host.plugins[0].stopped);
+    }
+}
@@ -0,0 +1,351 @@
+//! `cruxe preflight`: what `cruxe index` would cover, without indexing.
+//!
+//! The workspace is scanned under the same ignore rules, path scope,
+//! language list and limits as an index run. Every other file is listed with
+//! the reason it is left out, so a missing file can be explained without a
+//! full run. The size and time estimates are rough figures from typical
+//! repositories; `cruxe bench` measures the real throughput.
+
+use crate::limits::FileLimits;
+use crate::scanner::{self, PathScope};
+use crate::{parser, runtime_grammars};
+use cruxe_core::config::IndexConfig;
+use cruxe_core::types::{SkipReason, SymlinkPolicy};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::path::Path;
+
+/// Bytes of index (SQLite and Tantivy) per byte of indexed source.
+const INDEX_BYTES_PER_SOURCE_BYTE: f64 = 3.0;
+
+/// Source bytes indexed per second.
+const SOURCE_BYTES_PER_SECOND: f64 = 2.0 * 1024.0 * 1024.0;
+
+/// Why a file would not be indexed.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum LeftOutReason {
+    /// Matched by `.gitignore`, `.cruxeignore` or a built-in ignore, or
+    /// hidden.
+    Ignored,
+    /// Outside `[index] include`/`exclude` or the selected projects.
+    OutOfScope,
+    /// No language is known for its extension.
+    Unsupported,
+    /// A known language that `[index] languages` does not list.
+    LanguageDisabled,
+    TooLarge,
+    LongLines,
+    Binary,
+    Unreadable,
+}
+
+impl LeftOutReason {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Ignored => "ignored",
+            Self::OutOfScope => "out_of_scope",
+            Self::Unsupported => "unsupported",
+            Self::LanguageDisabled => "language_disabled",
+            Self::TooLarge => "too_large",
+            Self::LongLines => "long_lines",
+            Self::Binary => "binary",
+            Self::Unreadable => "unreadable",
+        }
+    }
+}
+
+impl From<SkipReason> for LeftOutReason {
+    fn from(reason: SkipReason) -> Self {
+        match reason {
+            SkipReason::TooLarge => Self::TooLarge,
+            SkipReason::LongLines => Self::LongLines,
+            SkipReason::Binary => Self::Binary,
+            SkipReason::Unreadable => Self::Unreadable,
+        }
+    }
+}
+
+/// A file, or a directory (ending in `/`) that is not entered, left out of
+/// the index.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct LeftOutFile {
+    pub path: String,
+    pub reason: LeftOutReason,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub detail: Option<String>,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct LanguageSummary {
+    pub files: u64,
+    pub bytes: u64,
+    pub lines: u64,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct IndexEstimate {
+    pub index_bytes: u64,
+    pub seconds: f64,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct PreflightReport {
+    /// Configuration that will not do what it seems to.
+    pub warnings: Vec<String>,
+    pub files: u64,
+    pub bytes: u64,
+    pub languages: BTreeMap<String, LanguageSummary>,
+    /// Files that would be transcoded to UTF-8, by original encoding.
+    pub encodings: BTreeMap<String, u64>,
+    /// Left-out files by reason.
+    pub left_out_counts: BTreeMap<String, u64>,
+    pub left_out: Vec<LeftOutFile>,
+    pub estimate: IndexEstimate,
+    /// Language of every file that would be indexed, by path.
+    #[serde(skip)]
+    indexed: HashMap<String, String>,
+}
+
+/// What preflight found for one path.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum FileStatus<'a> {
+    /// Indexed, as this language.
+    Indexed(&'a str),
+    LeftOut(&'a LeftOutFile),
+}
+
+impl PreflightReport {
+    /// What happens to the workspace-relative `path`; `None` when it is not
+    /// a file in the workspace.
+    pub fn status_of(&self, path: &str) -> Option<FileStatus<'_>> {
+        let path = path.trim_start_matches("./");
+        if let Some(language) = self.indexed.get(path) {
+            return Some(FileStatus::Indexed(language));
+        }
+        self.left_out
+            .iter()
+            .find(|file| {
+                file.path == path || (file.path.ends_with('/') && path.starts_with(&file.path))
+            })
+            .map(FileStatus::LeftOut)
+    }
+}
+
+/// Scan `repo_root` as `cruxe index` would under `index` and `scope`, and
+/// explain every file it leaves out.
+pub fn run(
+    repo_root: &Path,
+    index: &IndexConfig,
+    scope: &PathScope,
+    respect_ignore_files: bool,
+) -> PreflightReport {
+    let limits = FileLimits::from_config(index);
+    let mut oversized = Vec::new();
+    let scanned = scanner::scan_directory_with_ignores(
+        repo_root,
+        index.max_file_size,
+        &index.languages,
+        respect_ignore_files,
+        index.symlink_policy(),
+        &mut oversized,
+    );
+
+    let mut report = PreflightReport {
+        warnings: config_warnings(index),
+        files: 0,
+        bytes: 0,
+        languages: BTreeMap::new(),
+        encodings: BTreeMap::new(),
+        left_out_counts: BTreeMap::new(),
+        left_out: Vec::new(),
+        estimate: IndexEstimate {
+            index_bytes: 0,
+            seconds: 0.0,
+        },
+        indexed: HashMap::new(),
+    };
+    let mut seen: HashSet<String> = HashSet::new();
+    for file in scanned {
+        let path = file.relative_path.replace('\\', "/");
+        seen.insert(path.clone());
+        if !scope.contains(&path) {
+            report
+                .left_out
+                .push(left_out(path, LeftOutReason::OutOfScope, None));
+            continue;
+        }
+        let decoded = std::fs::read(&file.path)
+            .map_err(|err| (LeftOutReason::Unreadable, err.to_string()))
+            .and_then(|content| {
+                limits
+                    .decode(content)
+                    .map_err(|skip| (skip.reason.into(), skip.detail))
+            });
+        let content = match decoded {
+            Ok(decoded) => {
+                if let Some(encoding) = decoded.encoding.recorded() {
+                    *report.encodings.entry(encoding.to_string()).or_default() += 1;
+                }
+                decoded.text
+            }
+            Err((reason, detail)) => {
+                report.left_out.push(left_out(path, reason, Some(detail)));
+                continue;
+            }
+        };
+        let summary = report.languages.entry(file.language.clone()).or_default();
+        summary.files += 1;
+        summary.bytes += content.len() as u64;
+        summary.lines += content.lines().count() as u64;
+        report.files += 1;
+        report.bytes += content.len() as u64;
+        report.indexed.insert(path, file.language);
+    }
+    for file in oversized {
+        let path = file.relative_path.replace('\\', "/");
+        seen.insert(path.clone());
+        let detail = format!("{} bytes", file.size);
+        report
+            .left_out
+            .push(left_out(path, LeftOutReason::TooLarge, Some(detail)));
+    }
+
+    let mut pruned = Vec::new();
+    for (path, _) in scanner::list_all_files(repo_root, &mut pruned) {
+        if seen.contains(&path) {
+            continue;
+        }
+        let (reason, detail) = unscanned_reason(&path, &index.languages);
+        report.left_out.push(left_out(path, reason, detail));
+    }
+    for dir in pruned {
+        let detail = if scanner::is_builtin_ignored(&format!("{dir}/")) {
+            "built-in ignored directory"
+        } else {
+            "git submodule"
+        };
+        report.left_out.push(left_out(
+            format!("{dir}/"),
+            LeftOutReason::Ignored,
+            Some(detail.to_string()),
+        ));
+    }
+    report.left_out.sort_by(|a, b| a.path.cmp(&b.path));
+    for file in &report.left_out {
+        *report
+            .left_out_counts
+            .entry(file.reason.as_str().to_string())
+            .or_default() += 1;
+    }
+    report.estimate = IndexEstimate {
+        index_bytes: (report.bytes as f64 * INDEX_BYTES_PER_SOURCE_BYTE) as u64,
+        seconds: report.bytes as f64 / SOURCE_BYTES_PER_SECOND,
+    };
+    report
+}
+
+fn left_out(path: String, reason: LeftOutReason, detail: Option<String>) -> LeftOutFile {
+    LeftOutFile {
+        path,
+        reason,
+        detail,
+    }
+}
+
+/// Why the scan did not return `path` at all.
+fn unscanned_reason(path: &str, languages: &[String]) -> (LeftOutReason, Option<String>) {
+    let Some(language) = scanner::detect_language(Path::new(path)) else {
+        return (LeftOutReason::Unsupported, None);
+    };
+    if !languages.is_empty()
+        && !languages.contains(&language)
+        && !runtime_grammars::is_registered(&language)
+    {
+        return (LeftOutReason::LanguageDisabled, Some(language));
+    }
+    let detail = if scanner::is_builtin_ignored(path) {
+        "built-in ignore"
+    } else if path.split('/').any(|part| part.starts_with('.')) {
+        "hidden path"
+    } else {
+        ".gitignore or .cruxeignore"
+    };
+    (LeftOutReason::Ignored, Some(detail.to_string()))
+}
+
+fn config_warnings(index: &IndexConfig) -> Vec<String> {
+    let mut warnings = Vec::new();
+    for language in &index.languages {
+        if !parser::is_language_supported(language) {
+            warnings.push(format!(
+                "`[index] languages` lists `{language}`, which has no grammar; declare one under `[grammars]` or its files are indexed as plain text"
+            ));
+        }
+    }
+    if index.symlinks.parse::<SymlinkPolicy>().is_err() {
+        warnings.push(format!(
+            "`[index] symlinks = \"{}\"` is not skip, follow or follow-within-root; the default applies",
+            index.symlinks
+        ));
+    }
+    if index.max_file_size == 0 {
+        warnings.push("`[index] max_file_size` is 0, so every file is too large".to_string());
+    }
+    warnings
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn explains_every_file_left_out() {
+        let dir = tempfile::tempdir().unwrap();
+        let root = dir.path();
+        let files = [
+            ("src/main.rs", "fn main() {}\n".to_string()),
+            ("src/app.min.js", "x".repeat(100)),
+            ("src/big.go", "package big\n".repeat(40)),
+            ("gen/out.rs", "fn out() {}\n".to_string()),
+            ("docs/README.md", "# Readme\n".to_string()),
+            ("tools/Main.java", "class Main {}\n".to_string()),
+            ("node_modules/lib/index.ts", "export {}\n".to_string()),
+            ("scratch/tmp.py", "x = 1\n".to_string()),
+            (".gitignore", "scratch/\n".to_string()),
+        ];
+        for (path, content) in &files {
+            let path = root.join(path);
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(path, content).unwrap();
+        }
+        let mut index = IndexConfig::default();
+        index.languages.push("javascript".to_string());
+        index.max_file_size = 200;
+        index.max_line_length = 80;
+        let scope = PathScope::new(&[], &["gen/".to_string()]).unwrap();
+
+        let report = run(root, &index, &scope, true);
+        assert_eq!(report.files, 1);
+        assert_eq!(report.languages["rust"].lines, 1);
+        assert_eq!(
+            report.status_of("src/main.rs"),
+            Some(FileStatus::Indexed("rust"))
+        );
+        let reason = |path: &str| match report.status_of(path) {
+            Some(FileStatus::LeftOut(file)) => file.reason,
+            other => panic!("{path}: {other:?}"),
+        };
+        assert_eq!(reason("src/app.min.js"), LeftOutReason::Ignored);
+        assert_eq!(reason("src/big.go"), LeftOutReason::TooLarge);
+        assert_eq!(reason("gen/out.rs"), LeftOutReason::OutOfScope);
+        assert_eq!(reason("docs/README.md"), LeftOutReason::Unsupported);
+        assert_eq!(reason("tools/Main.java"), LeftOutReason::LanguageDisabled);
+        assert_eq!(reason("node_modules/lib/index.ts"), LeftOutReason::Ignored);
+        assert_eq!(reason("scratch/tmp.py"), LeftOutReason::Ignored);
+        assert_eq!(report.status_of("missing.rs"), None);
+        assert!(report.warnings[0].contains("`javascript`"));
+        assert!(report.estimate.index_bytes > report.bytes);
+    }
+}
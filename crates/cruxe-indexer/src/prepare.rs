@@ -1,7 +1,19 @@
-use crate::{call_extract, import_extract, languages, parser, snippet_extract, symbol_extract};
+use crate::languages::ExtractedSymbol;
+use crate::{
+    call_extract, concurrency_extract, doc_extract, generated, go_embed, import_extract, injection,
+    languages, literal_extract, local_extract, parser, route_extract, snippet_extract,
+    symbol_extract, todo_extract,
+};
 use cruxe_core::config::SemanticChunkingConfig;
+use cruxe_core::error::LogCode;
 use cruxe_core::time::now_iso8601;
-use cruxe_core::types::{CallEdge, FileRecord, SnippetRecord, SymbolRecord};
+use cruxe_core::types::{
+    CallEdge, ConcurrencyRecord, EmbedRecord, FileRecord, InjectionRecord, LiteralRecord,
+    LocalRecord, ParseErrorRecord, RouteRecord, SnippetRecord, SymbolRecord, TodoRecord,
+};
+use cruxe_state::symbol_blame::SymbolBlame;
+use std::path::Path;
+use tracing::debug;
 
 #[derive(Debug, Clone)]
 pub struct SourceArtifacts {
@@ -9,7 +21,27 @@ pub struct SourceArtifacts {
     pub snippets: Vec<SnippetRecord>,
     pub call_edges: Vec<CallEdge>,
     pub raw_imports: Vec<import_extract::RawImport>,
+    /// SQL, HTML and regex strings found in the file.
+    pub injections: Vec<InjectionRecord>,
+    /// `//go:embed` directives, unresolved.
+    pub embeds: Vec<EmbedRecord>,
+    /// TODO/FIXME/HACK comments and deprecation notices.
+    pub todos: Vec<TodoRecord>,
+    /// Goroutine launches, channels, mutexes and WaitGroups (Go only).
+    pub concurrency: Vec<ConcurrencyRecord>,
+    /// HTTP route registrations and switch dispatch (Go only).
+    pub routes: Vec<RouteRecord>,
+    /// Parameters and local variables of functions, with their uses.
+    pub locals: Vec<LocalRecord>,
+    /// Constant values and notable string literals; constants only in a
+    /// skeleton.
+    pub literals: Vec<LiteralRecord>,
+    /// Why the file is generated code, `None` when it is hand-written.
+    pub generated: Option<&'static str>,
     pub parse_error: Option<String>,
+    /// Regions the parser recovered around; the whole file when it could not
+    /// be parsed at all.
+    pub parse_errors: Vec<ParseErrorRecord>,
 }
 
 #[derive(Debug, Clone, Copy)]
@@ -21,6 +53,11 @@ pub struct ArtifactBuildInput<'a> {
     pub ref_name: &'a str,
     pub source_layer: Option<&'a str>,
     pub include_imports: bool,
+    /// `false` builds a skeleton: symbols keep their doc comments and
+    /// signatures, and body snippets, comment snippets, call edges and
+    /// embedded strings are skipped. Doc comment snippets are built either
+    /// way.
+    pub bodies: bool,
     pub chunking: Option<&'a SemanticChunkingConfig>,
 }
 
@@ -28,6 +65,9 @@ pub struct ArtifactBuildInput<'a> {
 ///
 /// `include_imports` can be disabled in flows that do not need import edges
 /// (e.g. overlay incremental sync currently manages call edges only).
+/// `bodies: false` builds a signatures-only skeleton (`cruxe index
+/// --bodies=false`).
+#[allow(clippy::too_many_arguments)]
 pub fn build_source_artifacts(
     content: &str,
     language: &str,
@@ -36,6 +76,7 @@ pub fn build_source_artifacts(
     ref_name: &str,
     source_layer: Option<&str>,
     include_imports: bool,
+    bodies: bool,
 ) -> SourceArtifacts {
     let input = ArtifactBuildInput {
         content,
@@ -45,6 +86,7 @@ pub fn build_source_artifacts(
         ref_name,
         source_layer,
         include_imports,
+        bodies,
         chunking: None,
     };
     build_source_artifacts_with_parser(input, |source, lang| {
@@ -68,10 +110,12 @@ where
         ref_name,
         source_layer,
         include_imports,
+        bodies,
         chunking,
     } = input;
+    let generated = generated::generated_reason(source_path, content);
 
-    let (parsed_tree, extracted, raw_imports, parse_error) =
+    let (parsed_tree, mut extracted, raw_imports, parse_error) =
         if parser::is_language_supported(language) {
             match parse_source(content, language) {
                 Ok(tree) => {
@@ -93,6 +137,93 @@ where
         } else {
             (None, Vec::new(), Vec::new(), None)
         };
+    let parse_errors = if parse_error.is_some() {
+        parse_error_records(
+            parsed_tree.as_ref(),
+            content,
+            source_path,
+            project_id,
+            ref_name,
+        )
+    } else {
+        Vec::new()
+    };
+
+    let doc_snippets = doc_extract::build_doc_snippet_records(
+        &extracted,
+        project_id,
+        ref_name,
+        source_path,
+        source_layer,
+        content,
+    );
+
+    if !bodies {
+        for symbol in &mut extracted {
+            symbol.body = skeleton_body(content, symbol);
+        }
+        let symbols = symbol_extract::build_symbol_records(
+            &extracted,
+            project_id,
+            ref_name,
+            source_path,
+            source_layer,
+        );
+        let embeds = if language == "go" {
+            go_embed::extract_embeds(project_id, ref_name, source_path, content)
+        } else {
+            Vec::new()
+        };
+        let todos = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+            todo_extract::extract_todos(tree, content, source_path, &symbols, project_id, ref_name)
+        });
+        let concurrency = extract_concurrency(
+            parsed_tree.as_ref(),
+            language,
+            content,
+            source_path,
+            &symbols,
+            project_id,
+            ref_name,
+        );
+        let routes = extract_routes(
+            parsed_tree.as_ref(),
+            language,
+            content,
+            source_path,
+            &symbols,
+            project_id,
+            ref_name,
+        );
+        let mut literals = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+            literal_extract::extract_literals(
+                tree,
+                content,
+                language,
+                source_path,
+                &symbols,
+                project_id,
+                ref_name,
+            )
+        });
+        literals.retain(|literal| literal.defines);
+        return SourceArtifacts {
+            symbols,
+            snippets: doc_snippets,
+            call_edges: Vec::new(),
+            raw_imports,
+            injections: Vec::new(),
+            embeds,
+            todos,
+            concurrency,
+            routes,
+            locals: Vec::new(),
+            literals,
+            generated,
+            parse_error,
+            parse_errors,
+        };
+    }
 
     let symbols = symbol_extract::build_symbol_records(
         &extracted,
@@ -101,7 +232,7 @@ where
         source_path,
         source_layer,
     );
-    let snippets = snippet_extract::build_snippet_records_with_options(
+    let mut snippets = snippet_extract::build_snippet_records_with_options(
         &extracted,
         project_id,
         ref_name,
@@ -111,6 +242,16 @@ where
         Some(content),
         chunking,
     );
+    snippets.extend(doc_snippets);
+    snippets.extend(doc_extract::build_comment_snippet_records(
+        &extracted,
+        project_id,
+        ref_name,
+        source_path,
+        source_layer,
+        language,
+        content,
+    ));
     let call_edges = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
         call_extract::extract_call_edges_for_file(
             tree,
@@ -123,15 +264,181 @@ where
         )
     });
 
+    let injections = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+        injection::extract_injections(
+            tree,
+            content,
+            language,
+            source_path,
+            &symbols,
+            project_id,
+            ref_name,
+        )
+    });
+
+    let embeds = if language == "go" {
+        go_embed::extract_embeds(project_id, ref_name, source_path, content)
+    } else {
+        Vec::new()
+    };
+
+    let todos = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+        todo_extract::extract_todos(tree, content, source_path, &symbols, project_id, ref_name)
+    });
+    let concurrency = extract_concurrency(
+        parsed_tree.as_ref(),
+        language,
+        content,
+        source_path,
+        &symbols,
+        project_id,
+        ref_name,
+    );
+    let routes = extract_routes(
+        parsed_tree.as_ref(),
+        language,
+        content,
+        source_path,
+        &symbols,
+        project_id,
+        ref_name,
+    );
+    let locals = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+        local_extract::extract_locals(
+            tree,
+            content,
+            language,
+            source_path,
+            &symbols,
+            project_id,
+            ref_name,
+        )
+    });
+
+    let literals = parsed_tree.as_ref().map_or_else(Vec::new, |tree| {
+        literal_extract::extract_literals(
+            tree,
+            content,
+            language,
+            source_path,
+            &symbols,
+            project_id,
+            ref_name,
+        )
+    });
+
     SourceArtifacts {
         symbols,
         snippets,
         call_edges,
         raw_imports,
+        injections,
+        embeds,
+        todos,
+        concurrency,
+        routes,
+        locals,
+        literals,
+        generated,
         parse_error,
+        parse_errors,
     }
 }
 
+fn parse_error_records(
+    tree: Option<&tree_sitter::Tree>,
+    content: &str,
+    source_path: &str,
+    project_id: &str,
+    ref_name: &str,
+) -> Vec<ParseErrorRecord> {
+    let record = |start_line: u32, end_line: u32, kind: &str| ParseErrorRecord {
+        repo: project_id.to_string(),
+        r#ref: ref_name.to_string(),
+        path: source_path.to_string(),
+        start_line,
+        end_line,
+        kind: kind.to_string(),
+    };
+    match tree {
+        Some(tree) => parser::error_regions(tree)
+            .into_iter()
+            .map(|region| {
+                let kind = if region.missing { "missing" } else { "syntax" };
+                record(region.start_line, region.end_line, kind)
+            })
+            .collect(),
+        None => vec![record(1, content.lines().count().max(1) as u32, "unparsed")],
+    }
+}
+
+fn extract_concurrency(
+    tree: Option<&tree_sitter::Tree>,
+    language: &str,
+    content: &str,
+    source_path: &str,
+    symbols: &[SymbolRecord],
+    project_id: &str,
+    ref_name: &str,
+) -> Vec<ConcurrencyRecord> {
+    match tree {
+        Some(tree) if language == "go" => concurrency_extract::extract_concurrency(
+            tree,
+            content,
+            source_path,
+            symbols,
+            project_id,
+            ref_name,
+        ),
+        _ => Vec::new(),
+    }
+}
+
+fn extract_routes(
+    tree: Option<&tree_sitter::Tree>,
+    language: &str,
+    content: &str,
+    source_path: &str,
+    symbols: &[SymbolRecord],
+    project_id: &str,
+    ref_name: &str,
+) -> Vec<RouteRecord> {
+    match tree {
+        Some(tree) if language == "go" => {
+            route_extract::extract_routes(tree, content, source_path, symbols, project_id, ref_name)
+        }
+        _ => Vec::new(),
+    }
+}
+
+/// Doc comment lines directly above a symbol, then its signature (or the
+/// first line of its body when the extractor found no signature).
+fn skeleton_body(content: &str, symbol: &ExtractedSymbol) -> Option<String> {
+    let lines: Vec<&str> = content.lines().collect();
+    let start = (symbol.line_start as usize)
+        .saturating_sub(1)
+        .min(lines.len());
+    let doc_start = lines[..start]
+        .iter()
+        .rposition(|line| !is_doc_line(line))
+        .map_or(0, |at| at + 1);
+    let mut skeleton: Vec<&str> = lines[doc_start..start].to_vec();
+    let signature = symbol
+        .signature
+        .as_deref()
+        .or_else(|| symbol.body.as_deref().and_then(|body| body.lines().next()))?;
+    skeleton.push(signature);
+    Some(skeleton.join("\n"))
+}
+
+/// Comment or attribute line that belongs to the declaration below it.
+fn is_doc_line(line: &str) -> bool {
+    let line = line.trim_start();
+    ["//", "/*", "*", "#", "@"]
+        .iter()
+        .any(|prefix| line.starts_with(prefix))
+}
+
 pub fn build_file_record(
     project_id: &str,
     ref_name: &str,
@@ -153,3 +460,108 @@ pub fn build_file_record(
         content_head: Some(content.lines().take(20).collect::<Vec<_>>().join("\n")),
     }
 }
+
+/// The last change to each of `symbols` per `git blame` of `path` at
+/// `revision` (default `HEAD`, with `content` standing in for uncommitted
+/// edits); none when git cannot blame the file (untracked, or from a
+/// submodule or dependency).
+pub fn blame_symbols(
+    repo_root: &Path,
+    revision: Option<&str>,
+    path: &str,
+    content: &str,
+    symbols: &[SymbolRecord],
+) -> Vec<SymbolBlame> {
+    let hunks = match cruxe_vcs::blame_file(repo_root, path, revision, content) {
+        Ok(hunks) => hunks,
+        Err(err) => {
+            debug!(
+                code = LogCode::BlameFailed.as_str(),
+                path,
+                error = %err,
+                "Skipping blame"
+            );
+            return Vec::new();
+        }
+    };
+    symbols
+        .iter()
+        .filter_map(|symbol| {
+            let hunk = cruxe_vcs::last_change(&hunks, symbol.line_start, symbol.line_end)?;
+            Some(SymbolBlame {
+                symbol_stable_id: symbol.symbol_stable_id.clone(),
+                path: path.to_string(),
+                commit: hunk.commit.clone(),
+                author: hunk.author.clone(),
+                author_email: hunk.author_email.clone(),
+                author_time: hunk.time,
+            })
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const SOURCE: &str = "package store
+
+import \"database/sql\"
+
+// Load reads a user.
+// It returns nil when none exists.
+func Load(db *sql.DB, id int) *User {
+\trow := db.QueryRow(\"SELECT name FROM users WHERE id = ?\", id)
+\treturn scan(row)
+}
+";
+
+    #[test]
+    fn skeleton_keeps_doc_comments_and_signatures_only() {
+        let build = |bodies| {
+            build_source_artifacts(SOURCE, "go", "store.go", "repo", "main", None, true, bodies)
+        };
+        let full = build(true);
+        assert!(!full.call_edges.is_empty());
+        assert!(!full.injections.is_empty());
+
+        let skeleton = build(false);
+        assert_eq!(skeleton.symbols.len(), full.symbols.len());
+        assert!(
+            skeleton
+                .snippets
+                .iter()
+                .all(|snippet| snippet.chunk_type == doc_extract::DOC_CHUNK_TYPE)
+        );
+        assert_eq!(skeleton.snippets.len(), 1);
+        assert!(skeleton.call_edges.is_empty());
+        assert!(skeleton.injections.is_empty());
+        assert_eq!(skeleton.raw_imports.len(), full.raw_imports.len());
+        let load = skeleton
+            .symbols
+            .iter()
+            .find(|symbol| symbol.name == "Load")
+            .unwrap();
+        let content = load.content.as_deref().unwrap();
+        assert!(content.starts_with("// Load reads a user.\n// It returns nil"));
+        assert!(content.contains("func Load(db *sql.DB, id int)"));
+        assert!(!content.contains("QueryRow"));
+    }
+
+    #[test]
+    fn a_syntax_error_keeps_the_symbols_that_parsed() {
+        let broken = format!("{SOURCE}\nfunc Save(db *sql.DB {{\n\t@@@\n");
+        let artifacts =
+            build_source_artifacts(&broken, "go", "store.go", "repo", "main", None, true, true);
+        assert!(artifacts.parse_error.is_some());
+        assert!(artifacts.symbols.iter().any(|symbol| symbol.name == "Load"));
+        assert!(!artifacts.parse_errors.is_empty());
+        assert!(artifacts.parse_errors.iter().all(|region| {
+            region.path == "store.go" && region.r#ref == "main" && region.start_line > 10
+        }));
+
+        let clean =
+            build_source_artifacts(SOURCE, "go", "store.go", "repo", "main", None, true, true);
+        assert!(clean.parse_errors.is_empty());
+    }
+}
@@ -0,0 +1,215 @@
+//! Project roots of a monorepo: every directory with its own `go.mod`,
+//! `Cargo.toml` package or `package.json`. The whole tree is still one
+//! index; projects only name the parts of it, so queries can be scoped to
+//! one of them. A file belongs to the project with the deepest directory
+//! holding it.
+//!
+//! A directory with several manifests is one project, named by the first
+//! of `go.mod`, `Cargo.toml` and `package.json`. Virtual Cargo workspaces
+//! (no `[package]`) are not projects themselves, their members are. When
+//! two projects share a name, the later ones by directory go by their
+//! directory instead.
+
+use cruxe_state::workspace_projects::WorkspaceProject;
+use ignore::WalkBuilder;
+use std::collections::{BTreeMap, HashSet};
+use std::path::Path;
+
+/// Directories never holding workspace projects.
+const SKIPPED_DIRS: &[&str] = &["vendor", "node_modules", "testdata", "target"];
+
+/// Manifest file names with the project kind each marks, by precedence.
+const MANIFESTS: &[(&str, &str)] = &[
+    ("go.mod", "go"),
+    ("Cargo.toml", "rust"),
+    ("package.json", "node"),
+];
+
+/// Projects of the workspace at `repo_root`, ordered by directory.
+pub fn discover_projects(repo_root: &Path) -> Vec<WorkspaceProject> {
+    let mut manifests: BTreeMap<String, Vec<&str>> = BTreeMap::new();
+    let walker = WalkBuilder::new(repo_root)
+        .hidden(true)
+        .filter_entry(|entry| {
+            let name = entry.file_name().to_string_lossy();
+            !(entry.file_type().is_some_and(|t| t.is_dir())
+                && SKIPPED_DIRS.contains(&name.as_ref()))
+        })
+        .build();
+    for entry in walker.flatten() {
+        if !entry.file_type().is_some_and(|t| t.is_file()) {
+            continue;
+        }
+        let Some(&(file_name, _)) = MANIFESTS
+            .iter()
+            .find(|(file_name, _)| entry.file_name() == *file_name)
+        else {
+            continue;
+        };
+        let Some(relative) = entry
+            .path()
+            .parent()
+            .and_then(|parent| parent.strip_prefix(repo_root).ok())
+        else {
+            continue;
+        };
+        manifests
+            .entry(relative.to_string_lossy().replace('\\', "/"))
+            .or_default()
+            .push(file_name);
+    }
+
+    let mut projects = Vec::new();
+    let mut names = HashSet::new();
+    for (dir, found) in manifests {
+        let named = MANIFESTS.iter().find_map(|&(file_name, kind)| {
+            if !found.contains(&file_name) {
+                return None;
+            }
+            let source = std::fs::read_to_string(repo_root.join(&dir).join(file_name)).ok()?;
+            let name = match kind {
+                "go" => crate::go_workspace::parse_module_path(&source)
+                    .and_then(|path| go_module_name(&path)),
+                "rust" => Some(cargo_package_name(&source)?.unwrap_or_default()),
+                _ => Some(package_json_name(&source).unwrap_or_default()),
+            }?;
+            Some((name, kind))
+        });
+        let Some((name, kind)) = named else {
+            continue;
+        };
+        let name = if name.is_empty() {
+            dir_name(repo_root, &dir)
+        } else {
+            name
+        };
+        let name = if names.contains(&name) && !dir.is_empty() {
+            dir.clone()
+        } else {
+            name
+        };
+        names.insert(name.clone());
+        projects.push(WorkspaceProject {
+            name,
+            kind: kind.to_string(),
+            dir,
+        });
+    }
+    projects
+}
+
+/// Last element of a Go module path, skipping a major version suffix.
+fn go_module_name(module_path: &str) -> Option<String> {
+    let mut elements = module_path.rsplit('/');
+    let last = elements.next()?;
+    let is_major_version =
+        last.len() > 1 && last.starts_with('v') && last[1..].bytes().all(|b| b.is_ascii_digit());
+    let name = if is_major_version {
+        elements.next()?
+    } else {
+        last
+    };
+    Some(name.to_string())
+}
+
+/// `name` of the `[package]` table of a `Cargo.toml`: `None` for a virtual
+/// workspace manifest, `Some("")` for a package without a literal name.
+fn cargo_package_name(source: &str) -> Option<Option<String>> {
+    let mut in_package = false;
+    let mut name = None;
+    for line in source.lines() {
+        let line = line.split_once('#').map_or(line, |(code, _)| code).trim();
+        if line.starts_with('[') {
+            if in_package {
+                break;
+            }
+            in_package = line == "[package]";
+            if in_package {
+                name = Some(None);
+            }
+            continue;
+        }
+        if !in_package {
+            continue;
+        }
+        if let Some((key, value)) = line.split_once('=')
+            && key.trim() == "name"
+        {
+            let value = value.trim().trim_matches('"').trim_matches('\'');
+            name = Some(Some(value.to_string()));
+        }
+    }
+    name
+}
+
+fn package_json_name(source: &str) -> Option<String> {
+    let value: serde_json::Value = serde_json::from_str(source).ok()?;
+    value.get("name")?.as_str().map(str::to_string)
+}
+
+/// Last element of `dir`, or of the repository root for the root project.
+fn dir_name(repo_root: &Path, dir: &str) -> String {
+    match dir.rsplit('/').next().filter(|name| !name.is_empty()) {
+        Some(name) => name.to_string(),
+        None => repo_root
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+            .unwrap_or_else(|| ".".to_string()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+
+    #[test]
+    fn discovers_named_projects_of_each_kind() {
+        let tmp = tempfile::tempdir().unwrap();
+        let root = tmp.path();
+        for (path, content) in [
+            ("go.mod", "module example.com/acme/platform/v2\n"),
+            (
+                "services/billing/go.mod",
+                "module example.com/acme/billing\n",
+            ),
+            (
+                "services/billing/package.json",
+                r#"{"name": "billing-scripts"}"#,
+            ),
+            ("web/package.json", r#"{"name": "@acme/web"}"#),
+            (
+                "web/node_modules/left-pad/package.json",
+                r#"{"name": "left-pad"}"#,
+            ),
+            ("tools/Cargo.toml", "[workspace]\nmembers = [\"lint\"]\n"),
+            (
+                "tools/lint/Cargo.toml",
+                "[package]\nname = \"acme-lint\" # the linter\nversion = \"0.1.0\"\n\n[dependencies]\nname = \"x\"\n",
+            ),
+            ("apps/billing/package.json", r#"{"name": "billing"}"#),
+            ("apps/admin/package.json", r#"{"private": true}"#),
+        ] {
+            let full = root.join(path);
+            fs::create_dir_all(full.parent().unwrap()).unwrap();
+            fs::write(full, content).unwrap();
+        }
+
+        let projects: Vec<(String, String, String)> = discover_projects(root)
+            .into_iter()
+            .map(|p| (p.dir, p.name, p.kind))
+            .collect();
+        let expected = [
+            ("", "platform", "go"),
+            ("apps/admin", "admin", "node"),
+            ("apps/billing", "billing", "node"),
+            ("services/billing", "services/billing", "go"),
+            ("tools/lint", "acme-lint", "rust"),
+            ("web", "@acme/web", "node"),
+        ];
+        assert_eq!(
+            projects,
+            expected.map(|(dir, name, kind)| (dir.to_string(), name.to_string(), kind.to_string()))
+        );
+    }
+}
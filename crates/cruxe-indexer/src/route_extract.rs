@@ -0,0 +1,737 @@
+//! HTTP routes registered in Go code and the handler each is bound to.
+//!
+//! Registrations are recognised by call shape: `HandleFunc`/`Handle` with a
+//! literal pattern (net/http, including Go 1.22 `"GET /users/{id}"`
+//! patterns, gorilla/mux with `.Methods(...)`, chi), chi's `Get`/`Post`/...
+//! and `Method`, and gin's and echo's `GET`/`POST`/.../`Any`. The capitalized
+//! and upper-case verbs only count in files importing chi, gin or echo, so
+//! a `cache.Get("key", v)` is not a route. Prefixes from gin/echo `Group`,
+//! gorilla `PathPrefix(...).Subrouter()` and chi `Route` closures are
+//! applied to the routes registered through them within the same function.
+//!
+//! Hand-rolled dispatch is read from `switch` statements: a case comparing
+//! `req.Method` and `req.Path` (or switching on `r.URL.Path`) is a route
+//! to the first call in its body.
+
+use crate::call_extract::resolve_caller_symbol;
+use cruxe_core::types::{RouteRecord, SymbolRecord};
+use std::collections::HashMap;
+
+const HTTP_METHODS: &[&str] = &[
+    "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS", "CONNECT", "TRACE",
+];
+
+/// Routes registered in a parsed Go file, in line order.
+pub fn extract_routes(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<RouteRecord> {
+    let root = tree.root_node();
+    let mut walk = Walk {
+        source,
+        router: router_import(root, source),
+        prefixes: HashMap::new(),
+        routes: Vec::new(),
+    };
+    walk.node(root);
+    let mut records: Vec<RouteRecord> = walk
+        .routes
+        .into_iter()
+        .map(|route| {
+            let symbol = resolve_caller_symbol(symbols, route.line);
+            RouteRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line: route.line,
+                method: route.method,
+                route: route.route,
+                handler: route.handler,
+                framework: route.framework.to_string(),
+                symbol_id: symbol.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: symbol.map(|symbol| symbol.qualified_name.clone()),
+            }
+        })
+        .collect();
+    records.sort_by_key(|record| record.line);
+    records
+}
+
+/// The router library a file imports, if any.
+fn router_import(root: tree_sitter::Node<'_>, source: &str) -> Option<&'static str> {
+    let mut specs = Vec::new();
+    let mut cursor = root.walk();
+    for declaration in root.named_children(&mut cursor) {
+        if declaration.kind() == "import_declaration" {
+            collect_kind(declaration, "import_spec", &mut specs);
+        }
+    }
+    specs.into_iter().find_map(|spec| {
+        let path = spec.child_by_field_name("path")?;
+        let path = string_value(path, source)?;
+        match path.as_str() {
+            "github.com/gin-gonic/gin" => Some("gin"),
+            "github.com/gorilla/mux" => Some("gorilla"),
+            _ if path.starts_with("github.com/labstack/echo") => Some("echo"),
+            _ if path.starts_with("github.com/go-chi/chi") => Some("chi"),
+            _ => None,
+        }
+    })
+}
+
+fn collect_kind<'t>(
+    node: tree_sitter::Node<'t>,
+    kind: &str,
+    found: &mut Vec<tree_sitter::Node<'t>>,
+) {
+    if node.kind() == kind {
+        found.push(node);
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect_kind(child, kind, found);
+    }
+}
+
+struct Route {
+    line: u32,
+    method: String,
+    route: String,
+    handler: String,
+    framework: &'static str,
+}
+
+struct Walk<'a> {
+    source: &'a str,
+    router: Option<&'static str>,
+    /// Router variables bound to a group prefix: `v1 := r.Group("/v1")`.
+    prefixes: HashMap<String, String>,
+    routes: Vec<Route>,
+}
+
+impl Walk<'_> {
+    fn node(&mut self, node: tree_sitter::Node<'_>) {
+        match node.kind() {
+            "short_var_declaration" | "assignment_statement" => self.group_binding(node),
+            "expression_switch_statement" => self.switch_routes(node),
+            "call_expression" => {
+                if self.registration(node) {
+                    return;
+                }
+            }
+            _ => {}
+        }
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            self.node(child);
+        }
+    }
+
+    fn text(&self, node: tree_sitter::Node<'_>) -> &str {
+        self.source.get(node.byte_range()).unwrap_or_default()
+    }
+
+    /// `v1 := r.Group("/v1")` or `api := r.PathPrefix("/api").Subrouter()`.
+    fn group_binding(&mut self, node: tree_sitter::Node<'_>) {
+        let (Some(left), Some(right)) = (
+            node.child_by_field_name("left").and_then(single),
+            node.child_by_field_name("right").and_then(single),
+        ) else {
+            return;
+        };
+        if left.kind() == "identifier"
+            && let Some(prefix) = self.group_prefix(right)
+        {
+            let name = self.text(left).to_string();
+            self.prefixes.insert(name, prefix);
+        }
+    }
+
+    /// The prefix a group-creating call adds to its receiver's.
+    fn group_prefix(&self, call: tree_sitter::Node<'_>) -> Option<String> {
+        let (receiver, method, args) = selector_call(call)?;
+        match (self.text(method), args.first()) {
+            ("Group", Some(&arg)) => {
+                let path = string_value(arg, self.source)?;
+                Some(join(&self.prefix_of(receiver), &path))
+            }
+            ("Subrouter", None) => {
+                let (inner, method, args) = selector_call(receiver)?;
+                if self.text(method) != "PathPrefix" {
+                    return None;
+                }
+                let path = string_value(*args.first()?, self.source)?;
+                Some(join(&self.prefix_of(inner), &path))
+            }
+            _ => None,
+        }
+    }
+
+    /// Prefix routes registered on `receiver` get.
+    fn prefix_of(&self, receiver: tree_sitter::Node<'_>) -> String {
+        match receiver.kind() {
+            "identifier" => self
+                .prefixes
+                .get(self.text(receiver))
+                .cloned()
+                .unwrap_or_default(),
+            // `r.Group("/x").GET(...)`, chi's `r.With(mw).Get(...)`.
+            "call_expression" => self.group_prefix(receiver).unwrap_or_else(|| {
+                selector_call(receiver)
+                    .map(|(inner, _, _)| self.prefix_of(inner))
+                    .unwrap_or_default()
+            }),
+            _ => String::new(),
+        }
+    }
+
+    /// Records a route registered by `call`. Returns true when `call` was a
+    /// chi `Route`/`Group` closure, which this walks itself.
+    fn registration(&mut self, call: tree_sitter::Node<'_>) -> bool {
+        let Some((receiver, method, args)) = selector_call(call) else {
+            return false;
+        };
+        let line = call.start_position().row as u32 + 1;
+        let name = self.text(method).to_string();
+        let strings: Vec<Option<String>> = args
+            .iter()
+            .map(|arg| string_value(*arg, self.source))
+            .collect();
+        let prefix = self.prefix_of(receiver);
+        match (name.as_str(), self.router) {
+            ("Route", Some("chi")) if args.len() == 2 => {
+                let Some(path) = strings[0].as_deref() else {
+                    return false;
+                };
+                let prefix = join(&prefix, path);
+                self.closure(args[1], prefix);
+                true
+            }
+            ("Group", Some("chi")) if args.len() == 1 => {
+                self.closure(args[0], prefix);
+                true
+            }
+            ("HandleFunc" | "Handle", router) if args.len() == 2 => {
+                let Some(pattern) = strings[0].as_deref() else {
+                    return false;
+                };
+                let framework = match router {
+                    Some(router @ ("chi" | "gorilla")) => router,
+                    _ => "net/http",
+                };
+                let (method, path) = split_pattern(pattern);
+                let methods = match self.chained_methods(call) {
+                    Some(methods) => methods,
+                    None => vec![method.unwrap_or("*").to_string()],
+                };
+                let handler = self.handler(args[1]);
+                for method in methods {
+                    self.push(line, method, join(&prefix, path), &handler, framework);
+                }
+                false
+            }
+            // gin `Handle(method, path, handlers...)`, echo `Add(method, path, h)`,
+            // chi `Method(method, path, h)`.
+            ("Handle", Some(router @ "gin"))
+            | ("Add", Some(router @ "echo"))
+            | ("Method" | "MethodFunc", Some(router @ "chi"))
+                if args.len() >= 3 =>
+            {
+                let (Some(method), Some(path)) = (strings[0].as_deref(), route_path(&strings[1]))
+                else {
+                    return false;
+                };
+                let handler = match router {
+                    "gin" => args[args.len() - 1],
+                    _ => args[2],
+                };
+                let handler = self.handler(handler);
+                let route = join(&prefix, path);
+                self.push(line, method.to_ascii_uppercase(), route, &handler, router);
+                false
+            }
+            (verb, Some(router)) if args.len() >= 2 => {
+                let method = match router {
+                    "chi" => verb.to_ascii_uppercase(),
+                    "gin" | "echo" if verb == "Any" => "*".to_string(),
+                    "gin" | "echo" => verb.to_string(),
+                    _ => return false,
+                };
+                let verb_matches = match router {
+                    "chi" => verb != method && HTTP_METHODS.contains(&method.as_str()),
+                    _ => method == "*" || HTTP_METHODS.contains(&verb),
+                };
+                let Some(path) = route_path(&strings[0]).filter(|_| verb_matches) else {
+                    return false;
+                };
+                // gin takes middleware before the handler, echo after it.
+                let handler = match router {
+                    "gin" => args[args.len() - 1],
+                    _ => args[1],
+                };
+                let handler = self.handler(handler);
+                self.push(line, method, join(&prefix, path), &handler, router);
+                false
+            }
+            _ => false,
+        }
+    }
+
+    /// chi's `func(r chi.Router) { ... }`, with `r` bound to `prefix`.
+    fn closure(&mut self, literal: tree_sitter::Node<'_>, prefix: String) {
+        if literal.kind() != "func_literal" {
+            self.node(literal);
+            return;
+        }
+        let param = literal
+            .child_by_field_name("parameters")
+            .and_then(|params| params.named_child(0))
+            .and_then(|param| param.child_by_field_name("name"))
+            .map(|name| self.text(name).to_string());
+        let Some(param) = param else {
+            self.node(literal);
+            return;
+        };
+        let shadowed = self.prefixes.insert(param.clone(), prefix);
+        self.node(literal);
+        match shadowed {
+            Some(previous) => self.prefixes.insert(param, previous),
+            None => self.prefixes.remove(&param),
+        };
+    }
+
+    /// gorilla's `r.HandleFunc(...).Methods("GET", "POST")`.
+    fn chained_methods(&self, call: tree_sitter::Node<'_>) -> Option<Vec<String>> {
+        let selector = call
+            .parent()
+            .filter(|parent| parent.kind() == "selector_expression")?;
+        if selector.child_by_field_name("field").map(|f| self.text(f)) != Some("Methods") {
+            return None;
+        }
+        let chained = selector
+            .parent()
+            .filter(|parent| parent.kind() == "call_expression")?;
+        let (_, _, args) = selector_call(chained)?;
+        let methods: Vec<String> = args
+            .iter()
+            .filter_map(|arg| self.method_value(*arg))
+            .collect();
+        (!methods.is_empty()).then_some(methods)
+    }
+
+    /// `"GET"` or `http.MethodGet`.
+    fn method_value(&self, node: tree_sitter::Node<'_>) -> Option<String> {
+        if let Some(value) = string_value(node, self.source) {
+            return Some(value.to_ascii_uppercase());
+        }
+        let method = self.text(node).strip_prefix("http.Method")?;
+        Some(method.to_ascii_uppercase()).filter(|method| HTTP_METHODS.contains(&method.as_str()))
+    }
+
+    /// What a handler argument names: the function or method value, the
+    /// handler wrapped by `http.HandlerFunc` or middleware, or the factory
+    /// called to build it.
+    fn handler(&self, node: tree_sitter::Node<'_>) -> String {
+        match node.kind() {
+            "func_literal" => "func literal".to_string(),
+            "call_expression" => {
+                let Some(function) = node.child_by_field_name("function") else {
+                    return squash(self.text(node));
+                };
+                let callee = self.text(function);
+                let args = arguments(node);
+                let wrapped = match callee {
+                    "http.HandlerFunc" | "http.TimeoutHandler" | "http.MaxBytesHandler" => {
+                        args.first().copied()
+                    }
+                    "http.StripPrefix" => args.get(1).copied(),
+                    _ if callee.starts_with("http.") => None,
+                    _ => args.last().copied().filter(|arg| {
+                        matches!(
+                            arg.kind(),
+                            "identifier"
+                                | "selector_expression"
+                                | "call_expression"
+                                | "func_literal"
+                        )
+                    }),
+                };
+                wrapped.map_or_else(|| squash(callee), |arg| self.handler(arg))
+            }
+            _ => squash(self.text(node)),
+        }
+    }
+
+    fn push(
+        &mut self,
+        line: u32,
+        method: String,
+        route: String,
+        handler: &str,
+        framework: &'static str,
+    ) {
+        self.routes.push(Route {
+            line,
+            method,
+            route,
+            handler: handler.to_string(),
+            framework,
+        });
+    }
+
+    /// `switch { case req.Method == "GET" && req.Path == "/users": ... }`
+    /// and `switch r.URL.Path { case "/users": ... }`.
+    fn switch_routes(&mut self, node: tree_sitter::Node<'_>) {
+        let tag = node.child_by_field_name("value");
+        if let Some(tag) = tag
+            && !is_path(self.text(tag))
+        {
+            return;
+        }
+        let mut cursor = node.walk();
+        let cases: Vec<_> = node
+            .named_children(&mut cursor)
+            .filter(|child| child.kind() == "expression_case")
+            .collect();
+        for case in cases {
+            let Some(values) = case.child_by_field_name("value") else {
+                continue;
+            };
+            let mut routes = Vec::new();
+            let mut cursor = values.walk();
+            for value in values.named_children(&mut cursor) {
+                let route = match tag {
+                    Some(_) => string_value(value, self.source).map(|path| ("*".to_string(), path)),
+                    None => self.compared_route(value),
+                };
+                routes.extend(route);
+            }
+            if routes.is_empty() {
+                continue;
+            }
+            let mut cursor = case.walk();
+            let handler = case
+                .named_children(&mut cursor)
+                .filter(|child| child.id() != values.id())
+                .find_map(|child| first_call(child))
+                .and_then(|call| call.child_by_field_name("function"))
+                .map(|function| squash(self.text(function)));
+            let Some(handler) = handler else {
+                continue;
+            };
+            let line = case.start_position().row as u32 + 1;
+            for (method, route) in routes {
+                self.push(line, method, route, &handler, "switch");
+            }
+        }
+    }
+
+    /// `req.Method == "GET" && req.Path == "/users"`, in either order and
+    /// with `http.MethodGet`; a path alone matches any method.
+    fn compared_route(&self, condition: tree_sitter::Node<'_>) -> Option<(String, String)> {
+        let mut comparisons = Vec::new();
+        collect_kind_all(condition, "binary_expression", &mut comparisons);
+        let mut method = None;
+        let mut path = None;
+        for comparison in comparisons {
+            let operator = comparison.child_by_field_name("operator");
+            if operator.map(|op| self.text(op)) != Some("==") {
+                continue;
+            }
+            let (Some(left), Some(right)) = (
+                comparison.child_by_field_name("left"),
+                comparison.child_by_field_name("right"),
+            ) else {
+                continue;
+            };
+            for (subject, value) in [(left, right), (right, left)] {
+                let subject = self.text(subject);
+                if subject.ends_with("Method") {
+                    method = method.or_else(|| self.method_value(value));
+                } else if is_path(subject) {
+                    path = path.or_else(|| string_value(value, self.source));
+                }
+            }
+        }
+        Some((method.unwrap_or_else(|| "*".to_string()), path?))
+    }
+}
+
+/// Every node of `kind` under `node`, nested ones included.
+fn collect_kind_all<'t>(
+    node: tree_sitter::Node<'t>,
+    kind: &str,
+    found: &mut Vec<tree_sitter::Node<'t>>,
+) {
+    if node.kind() == kind {
+        found.push(node);
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        collect_kind_all(child, kind, found);
+    }
+}
+
+fn first_call(node: tree_sitter::Node<'_>) -> Option<tree_sitter::Node<'_>> {
+    if node.kind() == "call_expression" {
+        return Some(node);
+    }
+    let mut cursor = node.walk();
+    let children: Vec<_> = node.named_children(&mut cursor).collect();
+    children.into_iter().find_map(first_call)
+}
+
+/// `req.Path`, `r.URL.Path`.
+fn is_path(subject: &str) -> bool {
+    subject.ends_with(".Path") || subject == "path"
+}
+
+/// `(receiver, method, args)` of a `receiver.method(args...)` call.
+fn selector_call(
+    call: tree_sitter::Node<'_>,
+) -> Option<(
+    tree_sitter::Node<'_>,
+    tree_sitter::Node<'_>,
+    Vec<tree_sitter::Node<'_>>,
+)> {
+    if call.kind() != "call_expression" {
+        return None;
+    }
+    let function = call.child_by_field_name("function")?;
+    if function.kind() != "selector_expression" {
+        return None;
+    }
+    Some((
+        function.child_by_field_name("operand")?,
+        function.child_by_field_name("field")?,
+        arguments(call),
+    ))
+}
+
+fn arguments(call: tree_sitter::Node<'_>) -> Vec<tree_sitter::Node<'_>> {
+    let Some(list) = call.child_by_field_name("arguments") else {
+        return Vec::new();
+    };
+    let mut cursor = list.walk();
+    list.named_children(&mut cursor)
+        .filter(|arg| arg.kind() != "comment")
+        .collect()
+}
+
+fn single(list: tree_sitter::Node<'_>) -> Option<tree_sitter::Node<'_>> {
+    if list.kind() != "expression_list" {
+        return Some(list);
+    }
+    (list.named_child_count() == 1)
+        .then(|| list.named_child(0))
+        .flatten()
+}
+
+/// Content of a Go string literal; route patterns need no unescaping.
+fn string_value(node: tree_sitter::Node<'_>, source: &str) -> Option<String> {
+    if !matches!(
+        node.kind(),
+        "interpreted_string_literal" | "raw_string_literal"
+    ) {
+        return None;
+    }
+    let text = source.get(node.byte_range())?;
+    Some(text.get(1..text.len().saturating_sub(1))?.to_string())
+}
+
+/// A literal that reads as a route: `"/users"`, not the `"key"` of a
+/// `cache.Get("key", v)`.
+fn route_path(literal: &Option<String>) -> Option<&str> {
+    literal.as_deref().filter(|path| path.starts_with('/'))
+}
+
+/// `"GET /users/{id}"` into its method and path.
+fn split_pattern(pattern: &str) -> (Option<&str>, &str) {
+    match pattern.split_once(' ') {
+        Some((method, path)) if HTTP_METHODS.contains(&method) => (Some(method), path.trim()),
+        _ => (None, pattern),
+    }
+}
+
+fn join(prefix: &str, path: &str) -> String {
+    if prefix.is_empty() {
+        return path.to_string();
+    }
+    if path.is_empty() || path == "/" {
+        return prefix.to_string();
+    }
+    format!(
+        "{}/{}",
+        prefix.trim_end_matches('/'),
+        path.trim_start_matches('/')
+    )
+}
+
+/// Collapse whitespace so multi-line expressions read on one line.
+fn squash(text: &str) -> String {
+    text.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+
+    fn routes(source: &str) -> Vec<(u32, String, String, String, String)> {
+        let tree = parse_file(source, "go").unwrap();
+        extract_routes(&tree, source, "server/routes.go", &[], "repo", "main")
+            .into_iter()
+            .map(|route| {
+                (
+                    route.line,
+                    route.method,
+                    route.route,
+                    route.handler,
+                    route.framework,
+                )
+            })
+            .collect()
+    }
+
+    fn route(
+        line: u32,
+        method: &str,
+        route: &str,
+        handler: &str,
+        framework: &str,
+    ) -> (u32, String, String, String, String) {
+        (
+            line,
+            method.to_string(),
+            route.to_string(),
+            handler.to_string(),
+            framework.to_string(),
+        )
+    }
+
+    #[test]
+    fn finds_registrations_with_group_prefixes() {
+        let chi = r#"package server
+
+import "github.com/go-chi/chi/v5"
+
+func (s *Server) Routes(r chi.Router) {
+	r.Get("/health", s.health)
+	r.Route("/users", func(r chi.Router) {
+		r.Get("/", s.listUsers)
+		r.With(auth).Post("/{id}", http.HandlerFunc(s.updateUser))
+	})
+	r.Method("DELETE", "/cache", requireAdmin(s.flush))
+	s.cache.Get("key", &value)
+}
+"#;
+        assert_eq!(
+            routes(chi),
+            [
+                route(6, "GET", "/health", "s.health", "chi"),
+                route(8, "GET", "/users", "s.listUsers", "chi"),
+                route(9, "POST", "/users/{id}", "s.updateUser", "chi"),
+                route(11, "DELETE", "/cache", "s.flush", "chi"),
+            ]
+        );
+
+        let gin = r#"package server
+
+import "github.com/gin-gonic/gin"
+
+func Register(r *gin.Engine, h *Handlers) {
+	api := r.Group("/api")
+	v1 := api.Group("/v1")
+	v1.GET("/users", authRequired, h.ListUsers)
+	v1.POST("/users", h.CreateUser)
+	r.Any("/ping", func(c *gin.Context) { c.String(200, "pong") })
+}
+"#;
+        assert_eq!(
+            routes(gin),
+            [
+                route(8, "GET", "/api/v1/users", "h.ListUsers", "gin"),
+                route(9, "POST", "/api/v1/users", "h.CreateUser", "gin"),
+                route(10, "*", "/ping", "func literal", "gin"),
+            ]
+        );
+
+        let http = r#"package server
+
+import "net/http"
+
+func (s *Server) routes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /users/{id}", s.getUser)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web"))))
+}
+"#;
+        assert_eq!(
+            routes(http),
+            [
+                route(6, "GET", "/users/{id}", "s.getUser", "net/http"),
+                route(7, "*", "/static/", "http.FileServer", "net/http"),
+            ]
+        );
+
+        let gorilla = r#"package server
+
+import "github.com/gorilla/mux"
+
+func (s *Server) routes(r *mux.Router) {
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/stats", s.handleStats()).Methods("GET", http.MethodHead)
+}
+"#;
+        assert_eq!(
+            routes(gorilla),
+            [
+                route(7, "GET", "/admin/stats", "s.handleStats", "gorilla"),
+                route(7, "HEAD", "/admin/stats", "s.handleStats", "gorilla"),
+            ]
+        );
+    }
+
+    #[test]
+    fn finds_routes_in_switch_dispatch() {
+        let source = r#"package handlers
+
+func (h *RequestHandler) HandleRequest(req *Request) *Response {
+	switch {
+	case req.Method == "GET" && req.Path == "/api/health":
+		return h.handleHealth()
+	case req.Method == http.MethodPost && req.Path == "/api/user":
+		return h.handleCreateUser(req)
+	case strings.HasPrefix(req.Path, "/debug"):
+		return debug(req)
+	default:
+		return errorResponse(404, "not found")
+	}
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/", "/index.html":
+		renderIndex(w)
+	}
+	switch r.Method {
+	case "GET":
+		get(w, r)
+	}
+}
+"#;
+        assert_eq!(
+            routes(source),
+            [
+                route(5, "GET", "/api/health", "h.handleHealth", "switch"),
+                route(7, "POST", "/api/user", "h.handleCreateUser", "switch"),
+                route(18, "*", "/", "renderIndex", "switch"),
+                route(18, "*", "/index.html", "renderIndex", "switch"),
+            ]
+        );
+    }
+}
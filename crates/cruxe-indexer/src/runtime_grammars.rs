@@ -0,0 +1,217 @@
+//! `[grammars]`: tree-sitter grammars compiled to WebAssembly and loaded
+//! when indexing starts, so languages and DSLs without built-in support are
+//! parsed, and their symbols extracted with a tags query, without rebuilding
+//! cruxe.
+//!
+//! Grammars run in tree-sitter's WASM store, sandboxed by wasmtime, so a
+//! grammar named by a repository's own config cannot run native code. Native
+//! grammar libraries are not loaded; `tree-sitter build --wasm` produces the
+//! `.wasm` file. Parsers of these languages need a store of their own from
+//! [`wasm_store`].
+//!
+//! Grammars are registered once per process; the first registration of a
+//! language wins and built-in languages cannot be replaced. A grammar that
+//! fails to load is reported with `grammar_load_failed` and its files are
+//! indexed as plain text.
+
+use cruxe_core::config::GrammarConfig;
+use cruxe_core::error::LogCode;
+use cruxe_core::languages;
+use std::collections::BTreeMap;
+use std::path::Path;
+use std::sync::{OnceLock, RwLock};
+use tracing::{info, warn};
+use tree_sitter::{WasmStore, wasmtime};
+
+struct RuntimeGrammar {
+    /// Leaked once per grammar so it can key the per-thread query caches.
+    name: &'static str,
+    language: tree_sitter::Language,
+    extensions: Vec<String>,
+    tags_query: Option<String>,
+}
+
+static GRAMMARS: RwLock<Vec<RuntimeGrammar>> = RwLock::new(Vec::new());
+
+/// A WASM language can only be used by parsers whose store shares the
+/// engine it was loaded with, so every store comes from this one.
+fn engine() -> &'static wasmtime::Engine {
+    static ENGINE: OnceLock<wasmtime::Engine> = OnceLock::new();
+    ENGINE.get_or_init(wasmtime::Engine::default)
+}
+
+/// A store for a parser of a registered language (`Language::is_wasm`).
+pub fn wasm_store() -> Result<WasmStore, String> {
+    WasmStore::new(engine()).map_err(|err| err.to_string())
+}
+
+/// Load the grammars of `[grammars]`, with paths relative to `root`.
+pub fn register(grammars: &BTreeMap<String, GrammarConfig>, root: &Path) {
+    for (name, config) in grammars {
+        if languages::is_indexable_source_language(name) {
+            warn!(
+                code = LogCode::GrammarLoadFailed.as_str(),
+                language = %name,
+                "Built-in languages cannot be replaced by a [grammars] entry"
+            );
+            continue;
+        }
+        if is_registered(name) {
+            continue;
+        }
+        match load(name, config, root) {
+            Ok(grammar) => {
+                info!(
+                    language = %name,
+                    extensions = ?grammar.extensions,
+                    symbols = grammar.tags_query.is_some(),
+                    "Loaded grammar"
+                );
+                write().push(grammar);
+            }
+            Err(err) => warn!(
+                code = LogCode::GrammarLoadFailed.as_str(),
+                language = %name,
+                library = %config.library,
+                error = %err,
+                "Grammar could not be loaded; its files are indexed as plain text"
+            ),
+        }
+    }
+}
+
+fn load(name: &str, config: &GrammarConfig, root: &Path) -> Result<RuntimeGrammar, String> {
+    let library = root.join(&config.library);
+    if !library
+        .extension()
+        .is_some_and(|extension| extension == "wasm")
+    {
+        return Err(
+            "only WASM grammars are loaded; build one with `tree-sitter build --wasm`".to_string(),
+        );
+    }
+    let module = std::fs::read(&library).map_err(|err| format!("{}: {err}", config.library))?;
+    // The store looks up `tree_sitter_<name>` in the module.
+    let symbol = config.symbol_for(name);
+    let mut store = wasm_store()?;
+    let language = store
+        .load_language(
+            symbol.strip_prefix("tree_sitter_").unwrap_or(&symbol),
+            &module,
+        )
+        .map_err(|err| err.to_string())?;
+    // Rejects grammars generated for an ABI this tree-sitter cannot run.
+    let mut parser = tree_sitter::Parser::new();
+    parser
+        .set_wasm_store(store)
+        .map_err(|err| err.to_string())?;
+    parser
+        .set_language(&language)
+        .map_err(|err| err.to_string())?;
+    let tags_query = match &config.tags_query {
+        Some(path) => {
+            let source = std::fs::read_to_string(root.join(path))
+                .map_err(|err| format!("tags query {path}: {err}"))?;
+            tree_sitter::Query::new(&language, &source)
+                .map_err(|err| format!("tags query {path}: {err}"))?;
+            Some(source)
+        }
+        None => None,
+    };
+    let extensions = if config.extensions.is_empty() {
+        vec![name.to_string()]
+    } else {
+        config
+            .extensions
+            .iter()
+            .map(|extension| extension.trim_start_matches('.').to_string())
+            .collect()
+    };
+    Ok(RuntimeGrammar {
+        name: Box::leak(name.to_string().into_boxed_str()),
+        language,
+        extensions,
+        tags_query,
+    })
+}
+
+fn read() -> std::sync::RwLockReadGuard<'static, Vec<RuntimeGrammar>> {
+    GRAMMARS
+        .read()
+        .unwrap_or_else(|poisoned| poisoned.into_inner())
+}
+
+fn write() -> std::sync::RwLockWriteGuard<'static, Vec<RuntimeGrammar>> {
+    GRAMMARS
+        .write()
+        .unwrap_or_else(|poisoned| poisoned.into_inner())
+}
+
+pub fn is_registered(language: &str) -> bool {
+    canonical_name(language).is_some()
+}
+
+/// The registered name of `language`, which lives for the whole process.
+pub fn canonical_name(language: &str) -> Option<&'static str> {
+    read()
+        .iter()
+        .find(|grammar| grammar.name == language)
+        .map(|grammar| grammar.name)
+}
+
+pub fn language(language: &str) -> Option<tree_sitter::Language> {
+    read()
+        .iter()
+        .find(|grammar| grammar.name == language)
+        .map(|grammar| grammar.language.clone())
+}
+
+/// Tags query of `language`, when it was given one.
+pub fn tags_query(language: &str) -> Option<String> {
+    read()
+        .iter()
+        .find(|grammar| grammar.name == language)
+        .and_then(|grammar| grammar.tags_query.clone())
+}
+
+/// The registered language files with extension `extension` belong to.
+pub fn language_for_extension(extension: &str) -> Option<&'static str> {
+    read()
+        .iter()
+        .find(|grammar| grammar.extensions.iter().any(|known| known == extension))
+        .map(|grammar| grammar.name)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn grammars_that_cannot_load_stay_unregistered() {
+        let dir = tempfile::tempdir().unwrap();
+        let grammar = |library: &str| GrammarConfig {
+            library: library.to_string(),
+            extensions: vec!["hcl".to_string()],
+            ..GrammarConfig::default()
+        };
+
+        let err = load("hcl", &grammar("grammars/hcl.so"), dir.path())
+            .err()
+            .unwrap();
+        assert!(err.contains("tree-sitter build --wasm"), "{err}");
+        assert!(load("hcl", &grammar("grammars/missing.wasm"), dir.path()).is_err());
+        std::fs::create_dir_all(dir.path().join("grammars")).unwrap();
+        std::fs::write(dir.path().join("grammars/hcl.wasm"), b"not wasm").unwrap();
+        assert!(load("hcl", &grammar("grammars/hcl.wasm"), dir.path()).is_err());
+
+        register(
+            &BTreeMap::from([
+                ("hcl".to_string(), grammar("grammars/hcl.wasm")),
+                ("go".to_string(), grammar("grammars/go.wasm")),
+            ]),
+            dir.path(),
+        );
+        assert!(!is_registered("hcl"));
+        assert_eq!(language_for_extension("hcl"), None);
+    }
+}
@@ -1,6 +1,10 @@
 use cruxe_core::constants;
-use globset::{Glob, GlobSet, GlobSetBuilder};
+use cruxe_core::error::LogCode;
+use cruxe_core::types::SymlinkPolicy;
+use cruxe_state::workspace_projects::{self, WorkspaceProject};
+use globset::{Glob, GlobBuilder, GlobSet, GlobSetBuilder};
 use ignore::WalkBuilder;
+use std::collections::{HashMap, HashSet};
 use std::path::{Path, PathBuf};
 use std::sync::OnceLock;
 use tracing::{debug, warn};
@@ -13,6 +17,13 @@ pub struct ScannedFile {
     pub language: String,
 }
 
+/// A source file left out of a scan for being larger than `max_file_size`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct OversizedFile {
+    pub relative_path: String,
+    pub size: u64,
+}
+
 /// Built-in default ignore patterns for binary/generated files.
 const BUILTIN_IGNORE_EXTENSIONS: &[&str] = &[
     ".exe", ".dll", ".so", ".dylib", ".o", ".a", ".wasm", ".pyc", ".class", ".jar", ".min.js",
@@ -34,6 +45,11 @@ const BUILTIN_IGNORE_DIRS: &[&str] = &[
     "venv",
 ];
 
+/// Directories never entered while walking a dependency: nested
+/// dependencies are walked on their own, and `build`/`dist` often hold the
+/// only code a package ships.
+const DEPENDENCY_PRUNED_DIRS: &[&str] = &[".git", "node_modules", "vendor"];
+
 const BUILTIN_IGNORE_PATTERNS: &[&str] = &["*.generated.*", "*.pb.go", "*_generated.rs"];
 
 /// Scan a directory for source files, respecting ignore rules.
@@ -49,29 +65,307 @@ pub fn scan_directory_filtered(
     max_file_size: u64,
     languages: &[String],
 ) -> Vec<ScannedFile> {
-    let mut walker = WalkBuilder::new(repo_root);
+    scan_directory_with_ignores(
+        repo_root,
+        max_file_size,
+        languages,
+        true,
+        SymlinkPolicy::default(),
+        &mut Vec::new(),
+    )
+}
+
+/// Scan like [`scan_directory_filtered`]. With `respect_ignore_files` false
+/// (`--no-ignore`), paths listed in `.gitignore` and `.cruxeignore` are
+/// scanned too; the built-in ignores always apply. `symlinks` decides which
+/// symbolic links are followed (`[index] symlinks`). Source files over
+/// `max_file_size` are added to `oversized`.
+pub fn scan_directory_with_ignores(
+    repo_root: &Path,
+    max_file_size: u64,
+    languages: &[String],
+    respect_ignore_files: bool,
+    symlinks: SymlinkPolicy,
+    oversized: &mut Vec<OversizedFile>,
+) -> Vec<ScannedFile> {
+    walk_files(
+        repo_root,
+        repo_root,
+        BUILTIN_IGNORE_DIRS,
+        max_file_size,
+        respect_ignore_files,
+        symlinks,
+        oversized,
+        |path| language_of(path, languages),
+    )
+}
+
+/// Scan the dependency directories `dirs` (repository-relative, e.g.
+/// `vendor/github.com/pkg/errors` or `node_modules/lodash`), which the
+/// regular scan never enters. Ignore files do not apply, and nested
+/// dependency directories are left to their own entry in `dirs`.
+pub fn scan_dependency_files(
+    repo_root: &Path,
+    dirs: &[String],
+    max_file_size: u64,
+    languages: &[String],
+) -> Vec<ScannedFile> {
+    let mut seen = HashSet::new();
+    let mut files = Vec::new();
+    for dir in dirs {
+        let walk_root = repo_root.join(dir);
+        if !walk_root.is_dir() {
+            continue;
+        }
+        for file in walk_files(
+            repo_root,
+            &walk_root,
+            DEPENDENCY_PRUNED_DIRS,
+            max_file_size,
+            false,
+            SymlinkPolicy::default(),
+            &mut Vec::new(),
+            |path| language_of(path, languages),
+        ) {
+            if seen.insert(file.relative_path.clone()) {
+                files.push(file);
+            }
+        }
+    }
+    files
+}
+
+/// Scan the checkouts of git submodules `dirs` (repository-relative), which
+/// the regular scan leaves out. Each is walked under the same rules as the
+/// superproject; submodules nested in them are not entered.
+pub fn scan_submodule_files(
+    repo_root: &Path,
+    dirs: &[String],
+    max_file_size: u64,
+    languages: &[String],
+    respect_ignore_files: bool,
+    symlinks: SymlinkPolicy,
+) -> Vec<ScannedFile> {
+    let mut files = Vec::new();
+    for dir in dirs {
+        let walk_root = repo_root.join(dir);
+        if !walk_root.is_dir() {
+            continue;
+        }
+        files.extend(walk_files(
+            repo_root,
+            &walk_root,
+            BUILTIN_IGNORE_DIRS,
+            max_file_size,
+            respect_ignore_files,
+            symlinks,
+            &mut Vec::new(),
+            |path| language_of(path, languages),
+        ));
+    }
+    files
+}
+
+/// Source files among the files of a commit (`cruxe index --ref` on a
+/// revision that is not checked out), as `(path, size)` pairs. The built-in
+/// ignores apply; ignore files do not, since only committed files are
+/// listed. `path` of each result is where the file would be checked out
+/// under `repo_root`. Source files over `max_file_size` go to `oversized`.
+pub fn scan_tree_files<'a>(
+    repo_root: &Path,
+    files: impl IntoIterator<Item = (&'a str, u64)>,
+    max_file_size: u64,
+    languages: &[String],
+    oversized: &mut Vec<OversizedFile>,
+) -> Vec<ScannedFile> {
+    files
+        .into_iter()
+        .filter(|(path, _)| !should_ignore_builtin(path, BUILTIN_IGNORE_DIRS))
+        .filter_map(|(path, size)| {
+            let language = language_of(Path::new(path), languages)?;
+            if size > max_file_size {
+                warn!(
+                    code = LogCode::FileTooLarge.as_str(),
+                    path, size, "Skipped: file too large"
+                );
+                oversized.push(OversizedFile {
+                    relative_path: path.to_string(),
+                    size,
+                });
+                return None;
+            }
+            Some(ScannedFile {
+                path: repo_root.join(path),
+                relative_path: path.to_string(),
+                language,
+            })
+        })
+        .collect()
+}
+
+/// Language of a source file, when it is one of `languages` (or any
+/// supported language if that is empty).
+fn language_of(path: &Path, languages: &[String]) -> Option<String> {
+    let language = detect_language(path)?;
+    // Filter by configured languages (if non-empty); a language declared in
+    // `[grammars]` is always indexed.
+    if !languages.is_empty()
+        && !languages.iter().any(|l| l == &language)
+        && !crate::runtime_grammars::is_registered(&language)
+    {
+        return None;
+    }
+    Some(language)
+}
+
+/// File extensions Go text/html templates are kept under. `.html` and
+/// `.htm` files only count when they contain a template action.
+const TEMPLATE_EXTENSIONS: &[&str] = &["tmpl", "tpl", "gotmpl", "gohtml", "html", "htm"];
+
+/// Scan a directory for Go template files under the same ignore rules as
+/// source files. Every returned file has language `gotmpl`.
+pub fn scan_template_files(
+    repo_root: &Path,
+    max_file_size: u64,
+    respect_ignore_files: bool,
+    symlinks: SymlinkPolicy,
+) -> Vec<ScannedFile> {
+    walk_files(
+        repo_root,
+        repo_root,
+        BUILTIN_IGNORE_DIRS,
+        max_file_size,
+        respect_ignore_files,
+        symlinks,
+        &mut Vec::new(),
+        |path| {
+            let ext = path.extension()?.to_str()?.to_ascii_lowercase();
+            if !TEMPLATE_EXTENSIONS.contains(&ext.as_str()) {
+                return None;
+            }
+            if matches!(ext.as_str(), "html" | "htm") {
+                let content = std::fs::read_to_string(path).ok()?;
+                if !content.contains("{{") {
+                    return None;
+                }
+            }
+            Some("gotmpl".to_string())
+        },
+    )
+}
+
+/// File extensions of configuration files.
+const CONFIG_EXTENSIONS: &[&str] = &[
+    "yaml",
+    "yml",
+    "toml",
+    "json",
+    "ini",
+    "env",
+    "properties",
+    "conf",
+];
+
+/// Scan a directory for configuration files (YAML, TOML, JSON, INI,
+/// `.env`, Java properties) under the same ignore rules as source files,
+/// lock files aside. Each file's language is its extension.
+pub fn scan_config_files(
+    repo_root: &Path,
+    max_file_size: u64,
+    respect_ignore_files: bool,
+) -> Vec<ScannedFile> {
+    walk_files(
+        repo_root,
+        repo_root,
+        BUILTIN_IGNORE_DIRS,
+        max_file_size,
+        respect_ignore_files,
+        SymlinkPolicy::default(),
+        &mut Vec::new(),
+        |path| {
+            let name = path.file_name()?.to_str()?;
+            if name.ends_with("-lock.json") || name.ends_with("-lock.yaml") {
+                return None;
+            }
+            let ext = path.extension()?.to_str()?.to_ascii_lowercase();
+            CONFIG_EXTENSIONS.contains(&ext.as_str()).then_some(ext)
+        },
+    )
+}
+
+/// Walk `walk_root` under the ignore rules and size limit, never entering
+/// `pruned_dirs`, and keep the files `classify` assigns a language to with
+/// their path relative to `repo_root`. Symbolic links are followed as
+/// `symlinks` says; see [`dedup_linked_files`]. Files `classify` would keep
+/// but for their size go to `oversized`.
+#[allow(clippy::too_many_arguments)]
+fn walk_files<F>(
+    repo_root: &Path,
+    walk_root: &Path,
+    pruned_dirs: &[&str],
+    max_file_size: u64,
+    respect_ignore_files: bool,
+    symlinks: SymlinkPolicy,
+    oversized: &mut Vec<OversizedFile>,
+    mut classify: F,
+) -> Vec<ScannedFile>
+where
+    F: FnMut(&Path) -> Option<String>,
+{
+    let real_root = std::fs::canonicalize(repo_root).unwrap_or_else(|_| repo_root.to_path_buf());
+    let mut walker = WalkBuilder::new(walk_root);
+    let link_root = real_root.clone();
     walker
+        .follow_links(symlinks != SymlinkPolicy::Skip)
         .hidden(true)
-        .git_ignore(true)
+        .git_ignore(respect_ignore_files)
         .git_global(false)
-        .git_exclude(false);
+        .git_exclude(false)
+        // Honor .gitignore in exported trees and tarballs, not only clones.
+        .require_git(false)
+        .parents(respect_ignore_files)
+        .ignore(respect_ignore_files)
+        // Never descend into dependency and build trees at all, nor into
+        // submodule checkouts (a `.git` file pointing at the superproject's
+        // git directory); those are walked on their own when enabled.
+        .filter_entry(move |entry| {
+            // Links the policy does not follow are neither indexed nor
+            // entered.
+            if entry.depth() > 0
+                && entry.path_is_symlink()
+                && !link_allowed(entry.path(), symlinks, &link_root)
+            {
+                return false;
+            }
+            entry.depth() == 0
+                || !entry.file_type().is_some_and(|kind| kind.is_dir())
+                || !(pruned_dirs
+                    .iter()
+                    .any(|dir| entry.file_name() == std::ffi::OsStr::new(dir))
+                    || entry.path().join(".git").is_file())
+        });
 
-    // Add .cruxeignore
-    let ignore_file = repo_root.join(constants::IGNORE_FILE);
-    if ignore_file.exists() {
+    // .cruxeignore files (at the root or in any directory) add patterns on
+    // top of .gitignore.
+    if respect_ignore_files {
         walker.add_custom_ignore_filename(constants::IGNORE_FILE);
     }
 
     let mut files = Vec::new();
+    let mut followed_link = false;
 
     for entry in walker.build() {
         let entry = match entry {
             Ok(e) => e,
             Err(e) => {
-                warn!("Walk error: {}", e);
+                match symlink_loop(&e) {
+                    Some(child) => debug!(path = ?child, "Skipped: symlink cycle"),
+                    None => warn!("Walk error: {}", e),
+                }
                 continue;
             }
         };
+        followed_link |= entry.path_is_symlink();
 
         let path = entry.path();
 
@@ -81,32 +375,40 @@ pub fn scan_directory_filtered(
         }
 
         // Skip files matching built-in ignore patterns
-        let path_str = path.to_string_lossy();
-        if should_ignore_builtin(&path_str) {
+        let within_walk = path.strip_prefix(walk_root).unwrap_or(path);
+        if should_ignore_builtin(&within_walk.to_string_lossy(), pruned_dirs) {
             debug!(?path, "Skipped by built-in ignore");
             continue;
         }
 
+        let relative = || {
+            path.strip_prefix(repo_root)
+                .unwrap_or(path)
+                .to_string_lossy()
+                .to_string()
+        };
+
         // Check file size
         if let Ok(metadata) = std::fs::metadata(path)
             && metadata.len() > max_file_size
         {
-            warn!(?path, size = metadata.len(), "Skipped: file too large");
+            warn!(
+                code = LogCode::FileTooLarge.as_str(),
+                ?path,
+                size = metadata.len(),
+                "Skipped: file too large"
+            );
+            if classify(path).is_some() {
+                oversized.push(OversizedFile {
+                    relative_path: relative(),
+                    size: metadata.len(),
+                });
+            }
             continue;
         }
 
-        // Detect language
-        if let Some(language) = detect_language(path) {
-            // Filter by configured languages (if non-empty)
-            if !languages.is_empty() && !languages.iter().any(|l| l == &language) {
-                continue;
-            }
-
-            let relative = path
-                .strip_prefix(repo_root)
-                .unwrap_or(path)
-                .to_string_lossy()
-                .to_string();
+        if let Some(language) = classify(path) {
+            let relative = relative();
 
             files.push(ScannedFile {
                 path: path.to_path_buf(),
@@ -116,14 +418,139 @@ pub fn scan_directory_filtered(
         }
     }
 
+    if followed_link {
+        dedup_linked_files(&real_root, &mut files);
+    }
     files
 }
 
-fn should_ignore_builtin(path: &str) -> bool {
-    let normalized_path = path.replace('\\', "/");
+/// Every regular file under `repo_root` whatever the ignore rules say, as
+/// workspace-relative paths with their sizes, for `cruxe preflight` to
+/// explain what a scan leaves out. Symbolic links are not followed and
+/// `.git` is not entered. Neither are the built-in ignored directories and
+/// submodule checkouts; their paths go to `pruned` instead.
+pub fn list_all_files(repo_root: &Path, pruned: &mut Vec<String>) -> Vec<(String, u64)> {
+    let entered_root = repo_root.to_path_buf();
+    let pruned_dirs = std::sync::Arc::new(std::sync::Mutex::new(Vec::new()));
+    let record = pruned_dirs.clone();
+    let mut walker = WalkBuilder::new(repo_root);
+    walker
+        .standard_filters(false)
+        .follow_links(false)
+        .filter_entry(move |entry| {
+            if entry.depth() == 0 || !entry.file_type().is_some_and(|kind| kind.is_dir()) {
+                return true;
+            }
+            if entry.file_name() == std::ffi::OsStr::new(".git") {
+                return false;
+            }
+            let prune = BUILTIN_IGNORE_DIRS
+                .iter()
+                .any(|dir| entry.file_name() == std::ffi::OsStr::new(dir))
+                || entry.path().join(".git").is_file();
+            if prune && let Ok(mut dirs) = record.lock() {
+                dirs.push(relative_path(&entered_root, entry.path()));
+            }
+            !prune
+        });
+
+    let mut files = Vec::new();
+    for entry in walker.build().flatten() {
+        if !entry.file_type().is_some_and(|kind| kind.is_file()) {
+            continue;
+        }
+        let size = entry.metadata().map(|metadata| metadata.len()).unwrap_or(0);
+        files.push((relative_path(repo_root, entry.path()), size));
+    }
+    if let Ok(mut dirs) = pruned_dirs.lock() {
+        pruned.append(&mut dirs);
+    }
+    files
+}
+
+fn relative_path(repo_root: &Path, path: &Path) -> String {
+    path.strip_prefix(repo_root)
+        .unwrap_or(path)
+        .to_string_lossy()
+        .replace('\\', "/")
+}
+
+/// Whether the built-in ignores (dependency and build directories, binary
+/// and generated file patterns) leave out `relative_path`.
+pub fn is_builtin_ignored(relative_path: &str) -> bool {
+    should_ignore_builtin(relative_path, BUILTIN_IGNORE_DIRS)
+}
+
+/// Whether the walk may index or enter the symlink at `path`.
+fn link_allowed(path: &Path, symlinks: SymlinkPolicy, real_root: &Path) -> bool {
+    match symlinks {
+        SymlinkPolicy::Skip => false,
+        SymlinkPolicy::Follow => true,
+        SymlinkPolicy::FollowWithinRoot => {
+            let within =
+                std::fs::canonicalize(path).is_ok_and(|target| target.starts_with(real_root));
+            if !within {
+                debug!(?path, "Skipped: symlink leads outside the repository");
+            }
+            within
+        }
+    }
+}
+
+/// The path at which the walk found it had come back to one of its own
+/// ancestors through a symlink; the walk does not enter it again.
+fn symlink_loop(err: &ignore::Error) -> Option<&Path> {
+    match err {
+        ignore::Error::Loop { child, .. } => Some(child),
+        ignore::Error::WithPath { err, .. } | ignore::Error::WithDepth { err, .. } => {
+            symlink_loop(err)
+        }
+        _ => None,
+    }
+}
+
+/// Keep one path per file when followed links make the same file (or a
+/// directory holding it) reachable under several paths: its real path when
+/// the walk found it there, else the first path found.
+fn dedup_linked_files(real_root: &Path, files: &mut Vec<ScannedFile>) {
+    let mut kept: HashMap<PathBuf, usize> = HashMap::new();
+    let mut keep = vec![true; files.len()];
+    for (index, file) in files.iter().enumerate() {
+        let Ok(target) = std::fs::canonicalize(&file.path) else {
+            continue;
+        };
+        let is_real = target == real_root.join(&file.relative_path);
+        match kept.get(&target) {
+            None => {
+                kept.insert(target, index);
+            }
+            Some(&first) => {
+                let (dropped, winner) = if is_real {
+                    (first, index)
+                } else {
+                    (index, first)
+                };
+                debug!(
+                    path = %files[dropped].relative_path,
+                    same_as = %files[winner].relative_path,
+                    "Skipped: same file as another path"
+                );
+                keep[dropped] = false;
+                if is_real {
+                    kept.insert(target, index);
+                }
+            }
+        }
+    }
+    let mut keep = keep.into_iter();
+    files.retain(|_| keep.next().unwrap_or(true));
+}
+
+fn should_ignore_builtin(path: &str, pruned_dirs: &[&str]) -> bool {
+    let normalized_path = format!("/{}", path.replace('\\', "/"));
 
     // Check directory components
-    for dir in BUILTIN_IGNORE_DIRS {
+    for dir in pruned_dirs {
         if normalized_path.contains(&format!("/{dir}/")) {
             return true;
         }
@@ -152,10 +579,108 @@ fn builtin_ignore_globset() -> &'static GlobSet {
     })
 }
 
+/// `[index] include`/`exclude` globs (or `--include`/`--exclude`) over
+/// workspace-relative paths. A file is in scope when it matches an include
+/// pattern (or there are none) and no exclude pattern. Globs have doublestar
+/// semantics: `*` stays within one path segment and `**` spans any number of
+/// them; a pattern ending in `/` covers the whole directory.
+///
+/// With `--project`, a file must also belong to one of the selected
+/// projects; see [`PathScope::within_projects`]. With `--build`, Go files
+/// excluded by the selected build configuration are out of scope too.
+#[derive(Debug, Clone, Default)]
+pub struct PathScope {
+    include: Option<GlobSet>,
+    exclude: Option<GlobSet>,
+    /// Directory of every workspace project with whether it is selected,
+    /// deepest first.
+    projects: Option<Vec<(String, bool)>>,
+    /// Files whose build constraint rules them out of the selected build.
+    left_out: Option<HashSet<String>>,
+}
+
+impl PathScope {
+    pub fn new(include: &[String], exclude: &[String]) -> Result<Self, globset::Error> {
+        Ok(Self {
+            include: scope_set(include)?,
+            exclude: scope_set(exclude)?,
+            projects: None,
+            left_out: None,
+        })
+    }
+
+    /// Narrow the scope to files of the `selected` projects among all the
+    /// workspace's `projects`. A file belongs to the project with the
+    /// deepest directory holding it, so selecting a root project leaves out
+    /// the projects nested in it.
+    pub fn within_projects(mut self, projects: &[WorkspaceProject], selected: &[&str]) -> Self {
+        let mut dirs: Vec<(String, bool)> = projects
+            .iter()
+            .map(|project| {
+                (
+                    project.dir.clone(),
+                    selected.contains(&project.dir.as_str()),
+                )
+            })
+            .collect();
+        dirs.sort_by_key(|(dir, _)| std::cmp::Reverse(dir.len()));
+        self.projects = Some(dirs);
+        self
+    }
+
+    /// Leave out `paths` (workspace-relative), e.g. the Go files a build
+    /// configuration does not compile.
+    pub fn without_files(mut self, paths: HashSet<String>) -> Self {
+        self.left_out = Some(paths);
+        self
+    }
+
+    /// Whether nothing narrows the scope, so every path is in it.
+    pub fn is_unrestricted(&self) -> bool {
+        self.include.is_none()
+            && self.exclude.is_none()
+            && self.projects.is_none()
+            && self.left_out.is_none()
+    }
+
+    pub fn contains(&self, relative_path: &str) -> bool {
+        let path = relative_path.replace('\\', "/");
+        self.include.as_ref().is_none_or(|set| set.is_match(&path))
+            && !self.exclude.as_ref().is_some_and(|set| set.is_match(&path))
+            && self.projects.as_ref().is_none_or(|dirs| {
+                dirs.iter()
+                    .find(|(dir, _)| workspace_projects::dir_contains(dir, &path))
+                    .is_some_and(|(_, selected)| *selected)
+            })
+            && !self
+                .left_out
+                .as_ref()
+                .is_some_and(|paths| paths.contains(&path))
+    }
+}
+
+fn scope_set(patterns: &[String]) -> Result<Option<GlobSet>, globset::Error> {
+    if patterns.is_empty() {
+        return Ok(None);
+    }
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        let pattern = pattern.trim_start_matches("./");
+        let pattern = match pattern.strip_suffix('/') {
+            Some(dir) => format!("{dir}/**"),
+            None => pattern.to_string(),
+        };
+        builder.add(GlobBuilder::new(&pattern).literal_separator(true).build()?);
+    }
+    builder.build().map(Some)
+}
+
 /// Detect programming language from file extension.
 pub fn detect_language(path: &Path) -> Option<String> {
     let ext = path.extension()?.to_str()?;
-    cruxe_core::languages::detect_language_from_extension(ext).map(str::to_string)
+    cruxe_core::languages::detect_language_from_extension(ext)
+        .or_else(|| crate::runtime_grammars::language_for_extension(ext))
+        .map(str::to_string)
 }
 
 #[cfg(test)]
@@ -176,6 +701,51 @@ mod tests {
         dir
     }
 
+    #[test]
+    fn path_scope_applies_include_then_exclude() {
+        let scope = PathScope::new(
+            &["cmd/".to_string(), "internal/**/*.go".to_string()],
+            &["**/*_mock.go".to_string()],
+        )
+        .unwrap();
+        assert!(scope.contains("cmd/server/main.go"));
+        assert!(scope.contains("internal/store/users.go"));
+        assert!(!scope.contains("internal/store/users_mock.go"));
+        assert!(!scope.contains("pkg/util/strings.go"));
+        assert!(!scope.is_unrestricted());
+
+        let payments = PathScope::new(&["services/payments/*.go".to_string()], &[]).unwrap();
+        assert!(payments.contains("services/payments/charge.go"));
+        assert!(!payments.contains("services/payments/stripe/client.go"));
+
+        let all = PathScope::new(&[], &[]).unwrap();
+        assert!(all.is_unrestricted());
+        assert!(all.contains("anything/at/all.rs"));
+        assert!(PathScope::new(&["src/[".to_string()], &[]).is_err());
+    }
+
+    #[test]
+    fn path_scope_within_projects_leaves_out_nested_projects() {
+        let project = |dir: &str| WorkspaceProject {
+            name: dir.to_string(),
+            kind: "go".to_string(),
+            dir: dir.to_string(),
+        };
+        let projects = [project(""), project("services/billing"), project("web")];
+        let root = PathScope::new(&[], &["**/*_test.go".to_string()])
+            .unwrap()
+            .within_projects(&projects, &[""]);
+        assert!(root.contains("cmd/main.go"));
+        assert!(!root.contains("cmd/main_test.go"));
+        assert!(!root.contains("services/billing/invoice.go"));
+        assert!(!root.is_unrestricted());
+
+        let billing = PathScope::default().within_projects(&projects, &["services/billing"]);
+        assert!(billing.contains("services/billing/invoice.go"));
+        assert!(!billing.contains("services/billingx/main.go"));
+        assert!(!billing.contains("web/app.ts"));
+    }
+
     #[test]
     fn test_scan_discovers_supported_languages() {
         let dir = create_temp_project(&[
@@ -219,6 +789,35 @@ mod tests {
         );
     }
 
+    #[test]
+    fn tree_files_get_the_builtin_ignores_and_size_limit() {
+        let mut oversized = Vec::new();
+        let files = scan_tree_files(
+            Path::new("/repo"),
+            [
+                ("src/main.rs", 12),
+                ("vendor/dep/lib.go", 10),
+                ("api/types.pb.go", 10),
+                ("big.py", 5_000),
+                ("README.md", 10),
+            ],
+            1_000,
+            &["rust".to_string(), "go".to_string(), "python".to_string()],
+            &mut oversized,
+        );
+        let paths: Vec<&str> = files.iter().map(|f| f.relative_path.as_str()).collect();
+        assert_eq!(paths, ["src/main.rs"]);
+        assert_eq!(
+            oversized,
+            [OversizedFile {
+                relative_path: "big.py".to_string(),
+                size: 5_000,
+            }]
+        );
+        assert_eq!(files[0].path, Path::new("/repo/src/main.rs"));
+        assert_eq!(files[0].language, "rust");
+    }
+
     #[test]
     fn test_scan_skips_files_over_max_size() {
         let dir = create_temp_project(&[
@@ -237,6 +836,34 @@ mod tests {
         );
     }
 
+    #[test]
+    fn oversized_source_files_are_reported() {
+        let dir = create_temp_project(&[
+            ("small.rs", "fn small() {}"),
+            ("large.rs", &"x".repeat(2_000_000)),
+            ("large.txt", &"x".repeat(2_000_000)),
+        ]);
+
+        let mut oversized = Vec::new();
+        let files = scan_directory_with_ignores(
+            dir.path(),
+            1_048_576,
+            &[],
+            true,
+            SymlinkPolicy::default(),
+            &mut oversized,
+        );
+        assert_eq!(files.len(), 1);
+        // Only source files are reported.
+        assert_eq!(
+            oversized,
+            [OversizedFile {
+                relative_path: "large.rs".to_string(),
+                size: 2_000_000,
+            }]
+        );
+    }
+
     #[test]
     fn test_cruxeignore_basic_patterns() {
         let dir = create_temp_project(&[
@@ -288,6 +915,160 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_gitignore_applies_outside_git_and_no_ignore_lifts_it() {
+        let dir = create_temp_project(&[
+            ("src/main.rs", "fn main() {}"),
+            ("gen/api.rs", "fn generated() {}"),
+            ("scratch/try.py", "def try_it(): pass"),
+            (".gitignore", "gen/\n"),
+            ("scratch/.cruxeignore", "*.py\n"),
+            ("web/node_modules/pkg/index.ts", "export {}"),
+        ]);
+
+        let paths = |respect: bool| {
+            let mut paths: Vec<String> = scan_directory_with_ignores(
+                dir.path(),
+                1_048_576,
+                &[],
+                respect,
+                SymlinkPolicy::default(),
+                &mut Vec::new(),
+            )
+            .into_iter()
+            .map(|f| f.relative_path.replace('\\', "/"))
+            .collect();
+            paths.sort();
+            paths
+        };
+        assert_eq!(paths(true), ["src/main.rs"]);
+        assert_eq!(
+            paths(false),
+            ["gen/api.rs", "scratch/try.py", "src/main.rs"]
+        );
+    }
+
+    #[test]
+    fn test_dependency_scan_enters_dist_but_not_nested_dependencies() {
+        let dir = create_temp_project(&[
+            (".gitignore", "node_modules/\nvendor/\n"),
+            (
+                "node_modules/left-pad/dist/index.js",
+                "export function pad() {}",
+            ),
+            ("node_modules/left-pad/dist/index.min.js", "function p(){}"),
+            (
+                "node_modules/left-pad/node_modules/inner/index.js",
+                "export {}",
+            ),
+            ("vendor/github.com/pkg/errors/errors.go", "package errors"),
+        ]);
+
+        let mut paths: Vec<String> = scan_dependency_files(
+            dir.path(),
+            &[
+                "node_modules/left-pad".to_string(),
+                "vendor/github.com/pkg/errors".to_string(),
+                "vendor/missing".to_string(),
+            ],
+            1_048_576,
+            &[],
+        )
+        .into_iter()
+        .map(|f| f.relative_path.replace('\\', "/"))
+        .collect();
+        paths.sort();
+        assert_eq!(
+            paths,
+            [
+                "node_modules/left-pad/dist/index.js",
+                "vendor/github.com/pkg/errors/errors.go"
+            ]
+        );
+    }
+
+    #[test]
+    fn test_submodule_checkouts_are_scanned_only_on_their_own() {
+        let dir = create_temp_project(&[
+            ("main.go", "package main"),
+            ("third_party/lib/.git", "gitdir: ../../.git/modules/lib\n"),
+            ("third_party/lib/lib.go", "package lib"),
+            ("third_party/lib/build/gen.go", "package gen"),
+        ]);
+        let scanned = |files: Vec<ScannedFile>| -> Vec<String> {
+            let mut paths: Vec<String> = files
+                .into_iter()
+                .map(|f| f.relative_path.replace('\\', "/"))
+                .collect();
+            paths.sort();
+            paths
+        };
+
+        assert_eq!(scanned(scan_directory(dir.path(), 1_048_576)), ["main.go"]);
+        assert_eq!(
+            scanned(scan_submodule_files(
+                dir.path(),
+                &["third_party/lib".to_string()],
+                1_048_576,
+                &[],
+                true,
+                SymlinkPolicy::default(),
+            )),
+            ["third_party/lib/lib.go"]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_symlink_policies() {
+        let outside = create_temp_project(&[("lib.go", "package shared")]);
+        let dir = create_temp_project(&[
+            ("main.go", "package main"),
+            ("common/util.go", "package common"),
+        ]);
+        let link = |target: &Path, at: &str| {
+            std::os::unix::fs::symlink(target, dir.path().join(at)).expect("create symlink");
+        };
+        link(&dir.path().join("common"), "shared");
+        link(&dir.path().join("main.go"), "alias.go");
+        link(outside.path(), "external");
+        // A cycle back to the root.
+        link(dir.path(), "common/root");
+
+        let paths = |symlinks: SymlinkPolicy| {
+            let mut paths: Vec<String> = scan_directory_with_ignores(
+                dir.path(),
+                1_048_576,
+                &[],
+                true,
+                symlinks,
+                &mut Vec::new(),
+            )
+            .into_iter()
+            .map(|f| f.relative_path.replace('\\', "/"))
+            .collect();
+            paths.sort();
+            paths
+        };
+        assert_eq!(paths(SymlinkPolicy::Skip), ["common/util.go", "main.go"]);
+        assert_eq!(
+            paths(SymlinkPolicy::FollowWithinRoot),
+            ["common/util.go", "main.go"]
+        );
+        assert_eq!(
+            paths(SymlinkPolicy::Follow),
+            ["common/util.go", "external/lib.go", "main.go"]
+        );
+
+        // A linked directory whose real path is ignored is indexed once,
+        // under the link.
+        fs::write(dir.path().join(".cruxeignore"), "common/\n").unwrap();
+        assert_eq!(
+            paths(SymlinkPolicy::FollowWithinRoot),
+            ["main.go", "shared/util.go"]
+        );
+    }
+
     #[test]
     fn test_scan_filtered_by_languages() {
         let dir = create_temp_project(&[
@@ -323,6 +1104,53 @@ mod tests {
         assert!(files.len() >= 2, "all supported files should be included");
     }
 
+    #[test]
+    fn test_scan_template_files() {
+        let dir = create_temp_project(&[
+            ("web/page.gohtml", "<h1>{{.Title}}</h1>"),
+            ("web/index.html", "<p>{{.Body}}</p>"),
+            ("web/static.html", "<p>plain</p>"),
+            ("mail/welcome.tmpl", "Hi {{.Name}}"),
+            ("main.go", "package main"),
+        ]);
+
+        let mut paths: Vec<String> =
+            scan_template_files(dir.path(), 1_048_576, true, SymlinkPolicy::default())
+                .into_iter()
+                .map(|f| f.relative_path.replace('\\', "/"))
+                .collect();
+        paths.sort();
+        assert_eq!(
+            paths,
+            vec!["mail/welcome.tmpl", "web/index.html", "web/page.gohtml"]
+        );
+    }
+
+    #[test]
+    fn test_scan_config_files() {
+        let dir = create_temp_project(&[
+            ("config/app.yaml", "server:\n  port: 8080\n"),
+            ("Cargo.toml", "[package]\n"),
+            ("web/package.json", "{}"),
+            ("web/package-lock.json", "{}"),
+            ("main.go", "package main"),
+        ]);
+
+        let mut found: Vec<(String, String)> = scan_config_files(dir.path(), 1_048_576, true)
+            .into_iter()
+            .map(|f| (f.relative_path.replace('\\', "/"), f.language))
+            .collect();
+        found.sort();
+        assert_eq!(
+            found,
+            vec![
+                ("Cargo.toml".to_string(), "toml".to_string()),
+                ("config/app.yaml".to_string(), "yaml".to_string()),
+                ("web/package.json".to_string(), "json".to_string()),
+            ]
+        );
+    }
+
     #[test]
     fn test_detect_language() {
         assert_eq!(detect_language(Path::new("foo.rs")), Some("rust".into()));
@@ -0,0 +1,183 @@
+//! Signatures-only rendering of a source file (`cruxe outline --format
+//! skeleton`): the file as written with every function body replaced by
+//! `{ ... }`, so types, fields, imports, doc comments and signatures remain
+//! in a fraction of the text.
+//!
+//! Bodies are found on the syntax tree; a function nested in an elided
+//! body goes with it. Python bodies become `...`, keeping a leading
+//! docstring. Empty bodies and expression-bodied lambdas stay as they are.
+
+use crate::chunker::is_function_like;
+use crate::parser;
+
+const ELIDED_BLOCK: &str = "{ ... }";
+const ELIDED_SUITE: &str = "...";
+
+/// The skeleton of `content`, or `None` when `language` has no grammar.
+pub fn skeleton_source(content: &str, language: &str) -> Option<String> {
+    if !parser::is_language_supported(language) {
+        return None;
+    }
+    let tree = parser::parse_file(content, language).ok()?;
+    let mut elisions = Vec::new();
+    collect_elisions(tree.root_node(), content, &mut elisions);
+
+    // In source order and disjoint: elided bodies are not descended into.
+    let mut out = String::with_capacity(content.len());
+    let mut copied = 0;
+    for (start, end, replacement) in elisions {
+        out.push_str(&content[copied..start]);
+        out.push_str(&replacement);
+        copied = end;
+    }
+    out.push_str(&content[copied..]);
+    Some(out)
+}
+
+fn collect_elisions(
+    node: tree_sitter::Node,
+    content: &str,
+    elisions: &mut Vec<(usize, usize, String)>,
+) {
+    if is_function_like(node.kind())
+        && let Some(body) = node.child_by_field_name("body")
+        && let Some(elision) = elide_body(body, content)
+    {
+        elisions.push(elision);
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_elisions(child, content, elisions);
+    }
+}
+
+/// The byte range of `body` to replace and its replacement.
+fn elide_body(body: tree_sitter::Node, content: &str) -> Option<(usize, usize, String)> {
+    let start = body.start_byte();
+    // Trailing newlines stay, so blank lines between members survive.
+    let end = start + content[start..body.end_byte()].trim_end().len();
+    if content[start..end].starts_with('{') {
+        return (body.named_child_count() > 0).then(|| (start, end, ELIDED_BLOCK.to_string()));
+    }
+    if body.kind() != "block" {
+        return None;
+    }
+    let first = body.named_child(0)?;
+    let is_docstring = first.kind() == "expression_statement"
+        && first
+            .named_child(0)
+            .is_some_and(|child| child.kind() == "string");
+    if !is_docstring {
+        return Some((start, end, ELIDED_SUITE.to_string()));
+    }
+    if body.named_child_count() == 1 {
+        return None;
+    }
+    let line_start = content[..first.start_byte()]
+        .rfind('\n')
+        .map_or(0, |newline| newline + 1);
+    let indent = &content[line_start..first.start_byte()];
+    Some((first.end_byte(), end, format!("\n{indent}{ELIDED_SUITE}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn go_and_rust_bodies_become_ellipses() {
+        let go = "package api
+
+import \"net/http\"
+
+// Request is an incoming call.
+type Request struct {
+\tPath string
+}
+
+// HandleRequest routes a request.
+func HandleRequest(req *Request) *Response {
+\tif req.Path == \"\" {
+\t\treturn nil
+\t}
+\treturn &Response{}
+}
+
+func (s *Server) Close() {}
+";
+        assert_eq!(
+            skeleton_source(go, "go").unwrap(),
+            "package api
+
+import \"net/http\"
+
+// Request is an incoming call.
+type Request struct {
+\tPath string
+}
+
+// HandleRequest routes a request.
+func HandleRequest(req *Request) *Response { ... }
+
+func (s *Server) Close() {}
+"
+        );
+
+        let rust = "/// Stores rows.
+pub trait Store {
+    fn get(&self, key: &str) -> Option<Row>;
+}
+
+impl Store for Memory {
+    /// Looks the row up.
+    fn get(&self, key: &str) -> Option<Row> {
+        let found = self.rows.get(key);
+        found.cloned()
+    }
+}
+";
+        assert_eq!(
+            skeleton_source(rust, "rust").unwrap(),
+            "/// Stores rows.
+pub trait Store {
+    fn get(&self, key: &str) -> Option<Row>;
+}
+
+impl Store for Memory {
+    /// Looks the row up.
+    fn get(&self, key: &str) -> Option<Row> { ... }
+}
+"
+        );
+        assert!(skeleton_source("# Notes\n", "markdown").is_none());
+    }
+
+    #[test]
+    fn python_bodies_keep_their_docstring() {
+        let python = "class Store:
+    \"\"\"Keeps rows.\"\"\"
+
+    def get(self, key):
+        \"\"\"Return the row for key.\"\"\"
+        row = self.rows[key]
+        return row
+
+    def put(self, key, row):
+        self.rows[key] = row
+";
+        assert_eq!(
+            skeleton_source(python, "python").unwrap(),
+            "class Store:
+    \"\"\"Keeps rows.\"\"\"
+
+    def get(self, key):
+        \"\"\"Return the row for key.\"\"\"
+        ...
+
+    def put(self, key, row):
+        ...
+"
+        );
+    }
+}
@@ -1,5 +1,6 @@
 use crate::languages::ExtractedSymbol;
 use cruxe_core::config::SemanticChunkingConfig;
+use cruxe_core::error::LogCode;
 use cruxe_core::types::{SnippetRecord, compute_symbol_stable_id};
 use tracing::warn;
 
@@ -169,6 +170,7 @@ fn truncate_to_token_budget(content: &str, max_chunk_tokens: usize) -> (String,
     }
     let truncated = content[..end].to_string();
     warn!(
+        code = LogCode::SnippetTruncated.as_str(),
         original_bytes = content.len(),
         truncated_bytes = truncated.len(),
         max_chunk_tokens,
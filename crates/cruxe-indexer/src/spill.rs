@@ -0,0 +1,225 @@
+//! Memory budget for `cruxe index --max-memory`.
+//!
+//! Tantivy writers already flush segments to disk once their heap is full, so
+//! the budget caps their heap. The remaining unbounded state of a run is the
+//! per-file import and call-edge lists held until every symbol is written;
+//! [`SpillBuffer`] moves completed shards of those to disk and replays them
+//! at the end.
+
+use cruxe_core::error::StateError;
+use serde::Serialize;
+use serde::de::DeserializeOwned;
+use std::io::{BufRead, BufReader, BufWriter, Write};
+use std::path::{Path, PathBuf};
+
+/// Smallest budget accepted: three Tantivy writers need 15 MB each.
+pub const MIN_MEMORY_BUDGET: u64 = 64 * 1024 * 1024;
+
+/// Default Tantivy writer heap per index when no budget is set.
+pub const DEFAULT_WRITER_HEAP_BYTES: usize = 50_000_000;
+
+/// Tantivy refuses writer heaps below this.
+const MIN_WRITER_HEAP_BYTES: usize = 15_000_000;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct MemoryBudget {
+    total: u64,
+}
+
+impl MemoryBudget {
+    /// Parse a size such as `4G`, `512MiB`, `750mb` or a plain byte count.
+    pub fn parse(value: &str) -> Option<Self> {
+        let value = value.trim();
+        let split = value
+            .find(|c: char| !c.is_ascii_digit())
+            .unwrap_or(value.len());
+        let (digits, unit) = value.split_at(split);
+        let count: u64 = digits.parse().ok()?;
+        let multiplier: u64 = match unit.trim().to_ascii_lowercase().as_str() {
+            "" | "b" => 1,
+            "k" | "kb" | "kib" => 1 << 10,
+            "m" | "mb" | "mib" => 1 << 20,
+            "g" | "gb" | "gib" => 1 << 30,
+            "t" | "tb" | "tib" => 1 << 40,
+            _ => return None,
+        };
+        Some(Self {
+            total: count.checked_mul(multiplier)?,
+        })
+    }
+
+    pub fn total(&self) -> u64 {
+        self.total
+    }
+
+    /// Heap for each of the three Tantivy writers: half the budget overall.
+    pub fn writer_heap_bytes(&self) -> usize {
+        let share = usize::try_from(self.total / 6).unwrap_or(usize::MAX);
+        share.clamp(MIN_WRITER_HEAP_BYTES, DEFAULT_WRITER_HEAP_BYTES * 4)
+    }
+
+    /// Bytes each of the two edge buffers may hold before spilling.
+    pub fn spill_threshold_bytes(&self) -> usize {
+        usize::try_from(self.total / 4).unwrap_or(usize::MAX)
+    }
+}
+
+/// Append-only buffer that writes its contents to a new shard file whenever
+/// the serialized size of the buffered items passes the threshold. Without a
+/// threshold it never touches the disk.
+pub struct SpillBuffer<T> {
+    items: Vec<T>,
+    buffered_bytes: usize,
+    threshold: Option<usize>,
+    dir: PathBuf,
+    shards: Vec<PathBuf>,
+}
+
+impl<T: Serialize + DeserializeOwned> SpillBuffer<T> {
+    pub fn new(dir: &Path, threshold: Option<usize>) -> Self {
+        Self {
+            items: Vec::new(),
+            buffered_bytes: 0,
+            threshold,
+            dir: dir.to_path_buf(),
+            shards: Vec::new(),
+        }
+    }
+
+    pub fn push(&mut self, item: T) -> Result<(), StateError> {
+        if let Some(threshold) = self.threshold {
+            self.buffered_bytes += serde_json::to_vec(&item)
+                .map_err(std::io::Error::other)?
+                .len();
+            self.items.push(item);
+            if self.buffered_bytes > threshold {
+                self.spill()?;
+            }
+        } else {
+            self.items.push(item);
+        }
+        Ok(())
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.items.is_empty() && self.shards.is_empty()
+    }
+
+    /// Number of shards written to disk so far.
+    pub fn spilled_shards(&self) -> usize {
+        self.shards.len()
+    }
+
+    /// Hand every shard to `visit` in push order, loading one shard at a time,
+    /// then the items still in memory. Shard files are removed as they are
+    /// consumed.
+    pub fn for_each_shard<E>(
+        mut self,
+        mut visit: impl FnMut(Vec<T>) -> Result<(), E>,
+    ) -> Result<(), E>
+    where
+        E: From<StateError>,
+    {
+        for path in std::mem::take(&mut self.shards) {
+            let shard = read_shard(&path)?;
+            visit(shard)?;
+            let _ = std::fs::remove_file(&path);
+        }
+        let tail = std::mem::take(&mut self.items);
+        if !tail.is_empty() {
+            visit(tail)?;
+        }
+        Ok(())
+    }
+
+    fn spill(&mut self) -> Result<(), StateError> {
+        std::fs::create_dir_all(&self.dir)?;
+        let path = self
+            .dir
+            .join(format!("shard-{:05}.jsonl", self.shards.len()));
+        let mut out = BufWriter::new(std::fs::File::create(&path)?);
+        for item in self.items.drain(..) {
+            serde_json::to_writer(&mut out, &item).map_err(std::io::Error::other)?;
+            out.write_all(b"\n")?;
+        }
+        out.flush()?;
+        self.shards.push(path);
+        self.buffered_bytes = 0;
+        Ok(())
+    }
+}
+
+impl<T> Drop for SpillBuffer<T> {
+    fn drop(&mut self) {
+        for path in &self.shards {
+            let _ = std::fs::remove_file(path);
+        }
+        // Only succeeds once the directory is empty, i.e. no sibling buffer
+        // still has shards in it.
+        let _ = std::fs::remove_dir(&self.dir);
+    }
+}
+
+fn read_shard<T: DeserializeOwned>(path: &Path) -> Result<Vec<T>, StateError> {
+    let reader = BufReader::new(std::fs::File::open(path)?);
+    let mut items = Vec::new();
+    for line in reader.lines() {
+        let line = line?;
+        if !line.is_empty() {
+            items.push(serde_json::from_str(&line).map_err(std::io::Error::other)?);
+        }
+    }
+    Ok(items)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_sizes_with_units() {
+        assert_eq!(MemoryBudget::parse("2G").unwrap().total(), 2 << 30);
+        assert_eq!(MemoryBudget::parse("512 MiB").unwrap().total(), 512 << 20);
+        assert_eq!(MemoryBudget::parse("1024").unwrap().total(), 1024);
+        assert!(MemoryBudget::parse("lots").is_none());
+        assert!(MemoryBudget::parse("5X").is_none());
+
+        let small = MemoryBudget::parse("64M").unwrap();
+        assert_eq!(small.writer_heap_bytes(), MIN_WRITER_HEAP_BYTES);
+        assert_eq!(small.spill_threshold_bytes(), 16 << 20);
+    }
+
+    #[test]
+    fn spilled_shards_replay_in_push_order() {
+        let dir = tempfile::tempdir().unwrap();
+        let spill_dir = dir.path().join("spill");
+        let mut buffer = SpillBuffer::new(&spill_dir, Some(16));
+        for i in 0..10u32 {
+            buffer.push((format!("file-{i}.rs"), vec![i])).unwrap();
+        }
+        assert!(buffer.spilled_shards() > 1);
+        assert!(spill_dir.exists());
+
+        let mut seen = Vec::new();
+        buffer
+            .for_each_shard(|shard: Vec<(String, Vec<u32>)>| -> Result<(), StateError> {
+                seen.extend(shard.into_iter().map(|(_, ids)| ids[0]));
+                Ok(())
+            })
+            .unwrap();
+        assert_eq!(seen, (0..10).collect::<Vec<_>>());
+        assert!(!spill_dir.exists());
+    }
+
+    #[test]
+    fn without_a_threshold_nothing_reaches_disk() {
+        let dir = tempfile::tempdir().unwrap();
+        let spill_dir = dir.path().join("spill");
+        let mut buffer = SpillBuffer::new(&spill_dir, None);
+        for i in 0..1000u32 {
+            buffer.push(i).unwrap();
+        }
+        assert_eq!(buffer.spilled_shards(), 0);
+        assert!(!spill_dir.exists());
+    }
+}
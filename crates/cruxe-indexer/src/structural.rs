@@ -0,0 +1,161 @@
+//! Structural search: run a user-supplied tree-sitter query over a file and
+//! report the captured nodes, for `cruxe grep --structural`.
+//!
+//! A match is reported at each capture named `@match`, or at every capture
+//! when the pattern has none by that name. Patterns are written against one
+//! grammar's node types, so a pattern is compiled per language and languages
+//! whose grammar rejects it are skipped.
+
+use crate::{language_grammars, parser};
+use cruxe_core::error::ParseError;
+use std::collections::{HashMap, HashSet};
+use streaming_iterator::StreamingIterator;
+use tree_sitter::{Query, QueryCursor};
+
+/// Capture name that marks the node to report.
+pub const MATCH_CAPTURE: &str = "match";
+
+/// A node captured by a structural pattern. Lines and columns are 1-based;
+/// columns count bytes.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct StructuralMatch {
+    pub line_start: u32,
+    pub column: u32,
+    pub line_end: u32,
+    pub start_byte: usize,
+    pub end_byte: usize,
+}
+
+/// One pattern compiled for every language whose grammar accepts it.
+pub struct StructuralPattern {
+    queries: HashMap<String, Query>,
+    rejected: Vec<(String, String)>,
+}
+
+impl StructuralPattern {
+    /// Compile `source` for each of `languages`. Fails when no grammar
+    /// accepts it, reporting each grammar's complaint.
+    pub fn compile(source: &str, languages: &[&str]) -> Result<Self, String> {
+        let mut queries = HashMap::new();
+        let mut rejected = Vec::new();
+        for &language in languages {
+            let Some(grammar) = language_grammars::parser_language(language) else {
+                continue;
+            };
+            match Query::new(&grammar, source) {
+                Ok(query) if query.capture_names().is_empty() => {
+                    return Err(format!(
+                        "the pattern has no captures; add one such as `@{MATCH_CAPTURE}` to mark what to report"
+                    ));
+                }
+                Ok(query) => {
+                    queries.insert(language.to_string(), query);
+                }
+                Err(err) => rejected.push((language.to_string(), err.to_string())),
+            }
+        }
+        if queries.is_empty() {
+            let reasons: Vec<String> = rejected
+                .iter()
+                .map(|(language, err)| format!("{language}: {err}"))
+                .collect();
+            return Err(if reasons.is_empty() {
+                "no tree-sitter grammar is available for the indexed languages".to_string()
+            } else {
+                format!("no grammar accepts the pattern ({})", reasons.join("; "))
+            });
+        }
+        Ok(Self { queries, rejected })
+    }
+
+    pub fn supports(&self, language: &str) -> bool {
+        self.queries.contains_key(language)
+    }
+
+    /// Languages whose grammar rejected the pattern, with the reason.
+    pub fn rejected(&self) -> &[(String, String)] {
+        &self.rejected
+    }
+
+    /// Captured nodes in `source`, in document order. Languages the pattern
+    /// was not compiled for have no matches.
+    pub fn find_matches(
+        &self,
+        source: &str,
+        language: &str,
+    ) -> Result<Vec<StructuralMatch>, ParseError> {
+        let Some(query) = self.queries.get(language) else {
+            return Ok(Vec::new());
+        };
+        let tree = parser::parse_file(source, language)?;
+        let names = query.capture_names();
+        let marked = names.iter().position(|name| *name == MATCH_CAPTURE);
+
+        let mut cursor = QueryCursor::new();
+        let mut matches = cursor.matches(query, tree.root_node(), source.as_bytes());
+        let mut seen = HashSet::new();
+        let mut out = Vec::new();
+        while let Some(query_match) = matches.next() {
+            for capture in query_match.captures {
+                if marked.is_some_and(|index| capture.index as usize != index) {
+                    continue;
+                }
+                let node = capture.node;
+                if !seen.insert((node.start_byte(), node.end_byte())) {
+                    continue;
+                }
+                out.push(StructuralMatch {
+                    line_start: node.start_position().row as u32 + 1,
+                    column: node.start_position().column as u32 + 1,
+                    line_end: node.end_position().row as u32 + 1,
+                    start_byte: node.start_byte(),
+                    end_byte: node.end_byte(),
+                });
+            }
+        }
+        out.sort_by_key(|m| (m.start_byte, m.end_byte));
+        Ok(out)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn reports_match_captures_in_document_order() {
+        let pattern = StructuralPattern::compile(
+            r#"(call_expression
+                 function: (field_expression field: (field_identifier) @method)
+                 (#eq? @method "unwrap")) @match"#,
+            &["rust", "go"],
+        )
+        .unwrap();
+        assert!(pattern.supports("rust"));
+        // Go has no `field_expression`.
+        assert!(!pattern.supports("go"));
+        assert_eq!(pattern.rejected().len(), 1);
+
+        let source =
+            "fn a() {\n    let x = b().unwrap();\n    c(x.unwrap());\n    d.expect(\"\");\n}\n";
+        let matches = pattern.find_matches(source, "rust").unwrap();
+        let found: Vec<(u32, u32, &str)> = matches
+            .iter()
+            .map(|m| (m.line_start, m.column, &source[m.start_byte..m.end_byte]))
+            .collect();
+        assert_eq!(found, vec![(2, 13, "b().unwrap()"), (3, 7, "x.unwrap()")]);
+        assert!(pattern.find_matches("package a", "go").unwrap().is_empty());
+    }
+
+    #[test]
+    fn rejects_patterns_without_captures_or_grammar() {
+        let err = StructuralPattern::compile("(call_expression)", &["rust"])
+            .err()
+            .unwrap();
+        assert!(err.contains("no captures"));
+        let err = StructuralPattern::compile("(no_such_node) @match", &["rust"])
+            .err()
+            .unwrap();
+        assert!(err.contains("rust:"));
+    }
+}
@@ -22,10 +22,17 @@ pub fn build_symbol_records(
             );
 
             let parent_symbol_id = sym.parent_name.as_ref().and_then(|parent_name| {
-                // Find the parent in the extracted symbols to get its ID
+                // Find the parent in the extracted symbols to get its ID; an
+                // anonymous type can start on its parent's first line.
                 extracted
                     .iter()
-                    .find(|s| s.name == *parent_name && s.line_start < sym.line_start)
+                    .find(|s| {
+                        s.name == *parent_name
+                            && (s.line_start < sym.line_start
+                                || (s.line_start == sym.line_start
+                                    && s.line_end >= sym.line_end
+                                    && !std::ptr::eq(*s, sym)))
+                    })
                     .map(|parent| {
                         compute_symbol_id(
                             repo,
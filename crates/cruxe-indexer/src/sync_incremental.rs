@@ -1,23 +1,25 @@
-use cruxe_core::config::{Config, SemanticConfig};
-use cruxe_core::error::{StateError, VcsError};
+use cruxe_core::config::{Config, IndexConfig, LanguagesConfig, PluginConfig, SemanticConfig};
+use cruxe_core::error::{LogCode, StateError, VcsError};
 use cruxe_core::ids::new_job_id;
 use cruxe_core::time::now_iso8601;
-use cruxe_core::types::JobStatus;
+use cruxe_core::types::{JobStatus, SkippedFileRecord};
 use cruxe_state::branch_state::{self, BranchState};
 use cruxe_state::jobs;
 use cruxe_state::semantic_queue;
 use cruxe_state::tombstones::BranchTombstone;
-use cruxe_vcs::{DiffEntry, FileChangeKind, VcsAdapter, WorktreeManager};
+use cruxe_vcs::{DiffEntry, FileChangeKind, VcsAdapter, WorktreeManager, history};
 use rusqlite::Connection;
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap};
 use std::path::{Path, PathBuf};
 use std::time::Instant;
 use tantivy::Term;
 use tantivy::collector::TopDocs;
 use tantivy::query::TermQuery;
 use tantivy::schema::{IndexRecordOption, Value};
-use tracing::{info, warn};
+use tracing::{info, info_span, warn};
 
+use crate::limits::FileLimits;
+use crate::plugins::{PluginHost, PluginInput};
 use crate::{call_extract, embed_writer, parser, prepare, staging, writer};
 
 const DEFAULT_SEMANTIC_WORKER_DEQUEUE_CAP: usize = 32;
@@ -107,6 +109,30 @@ where
     })
 }
 
+/// Build a sync plan against the tip of `base_ref`, for a shallow clone whose
+/// history does not reach the merge base. Files the base changed since the
+/// branch point are re-indexed as the branch has them, which costs time but
+/// not correctness.
+pub fn build_sync_plan_from_base_tip<A>(
+    adapter: &A,
+    repo_root: &Path,
+    base_ref: &str,
+    head_ref: &str,
+) -> Result<SyncPlan, VcsError>
+where
+    A: VcsAdapter<FileChange = FileChangeKind, DiffEntry = DiffEntry>,
+{
+    let base_commit = history::commit_of(repo_root, base_ref)
+        .ok_or_else(|| VcsError::GitError(format!("base ref `{base_ref}` is not in this clone")))?;
+    let head_commit = adapter.resolve_head(repo_root)?;
+    let diff_entries = adapter.diff_name_status(repo_root, &base_commit, head_ref)?;
+    Ok(SyncPlan {
+        merge_base_commit: base_commit,
+        head_commit,
+        actions: expand_diff_entries(&diff_entries),
+    })
+}
+
 /// Returns `true` when ancestry is broken and overlay rebuild is required.
 pub fn should_rebuild_overlay<A>(
     adapter: &A,
@@ -347,6 +373,54 @@ fn default_worktrees_root(data_dir: &Path, project_id: &str) -> PathBuf {
     storage_root.join("worktrees").join(project_id)
 }
 
+/// Drop the rows a file left in SQLite and its vectors (file deleted, or
+/// now over a limit).
+fn delete_file_rows(
+    conn: &Connection,
+    embedding_writer: &embed_writer::EmbeddingWriter,
+    project_id: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    let deleted_symbol_ids: Vec<String> =
+        cruxe_state::symbols::list_symbols_in_file(conn, project_id, ref_name, path)?
+            .into_iter()
+            .map(|symbol| symbol.symbol_stable_id)
+            .collect();
+    cruxe_state::symbols::delete_symbols_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::manifest::delete_manifest(conn, project_id, ref_name, path)?;
+    cruxe_state::injections::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::go_embeds::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::todos::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::concurrency::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::routes::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::locals::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::literals::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::generated_files::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::file_encodings::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::symbol_blame::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::parse_errors::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::plugin_findings::delete_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::skipped_files::delete_for_file(conn, project_id, ref_name, path)?;
+    let source_edge_id = crate::import_extract::source_symbol_id_for_path(path);
+    cruxe_state::edges::delete_edges_for_file(
+        conn,
+        project_id,
+        ref_name,
+        vec![source_edge_id.as_str()],
+    )?;
+    cruxe_state::edges::delete_call_edges_for_file(conn, project_id, ref_name, path)?;
+    cruxe_state::edges::delete_call_edges_to_symbols(
+        conn,
+        project_id,
+        ref_name,
+        &deleted_symbol_ids,
+    )?;
+    embedding_writer.delete_for_file_vectors_with_symbols(conn, path, &deleted_symbol_ids)?;
+    Ok(())
+}
+
+#[allow(clippy::too_many_arguments)]
 fn write_actions_to_staging(
     conn: &Connection,
     index_set: &cruxe_state::tantivy_index::IndexSet,
@@ -355,6 +429,10 @@ fn write_actions_to_staging(
     ref_name: &str,
     actions: &[SyncAction],
     semantic: &SemanticConfig,
+    languages: &LanguagesConfig,
+    blame: bool,
+    limits: FileLimits,
+    plugins: &BTreeMap<String, PluginConfig>,
 ) -> Result<(usize, usize, Vec<SyncAction>), StateError> {
     write_actions_to_staging_with_parser(
         StagingWriteContext {
@@ -365,6 +443,10 @@ fn write_actions_to_staging(
             ref_name,
             actions,
             semantic,
+            languages,
+            blame,
+            limits,
+            plugins,
         },
         |content, language| parser::parse_file(content, language).map_err(|err| err.to_string()),
     )
@@ -378,6 +460,13 @@ struct StagingWriteContext<'a> {
     ref_name: &'a str,
     actions: &'a [SyncAction],
     semantic: &'a SemanticConfig,
+    languages: &'a LanguagesConfig,
+    /// Record each changed symbol's last commit (`[index] blame`).
+    blame: bool,
+    /// Changed files over these are skipped.
+    limits: FileLimits,
+    /// `[plugins]` run on each changed file.
+    plugins: &'a BTreeMap<String, PluginConfig>,
 }
 
 fn write_actions_to_staging_with_parser<F>(
@@ -395,6 +484,10 @@ where
         ref_name,
         actions,
         semantic,
+        languages,
+        blame,
+        limits,
+        plugins,
     } = ctx;
 
     let batch = writer::BatchWriter::new(index_set)?;
@@ -406,47 +499,49 @@ where
     let mut pending_symbol_batches: Vec<(String, Vec<cruxe_core::types::SymbolRecord>)> =
         Vec::new();
     let embedding_enabled = embedding_writer.enabled();
+    let mut plugin_host = if actions
+        .iter()
+        .any(|action| !matches!(action, SyncAction::Deleted { .. }))
+    {
+        PluginHost::start(plugins, repo_root)
+    } else {
+        PluginHost::default()
+    };
+    cruxe_state::go_modules::replace_for_ref(
+        conn,
+        project_id,
+        ref_name,
+        &crate::go_workspace::discover_modules(repo_root),
+    )?;
+    cruxe_state::import_paths::replace_for_ref(
+        conn,
+        project_id,
+        ref_name,
+        &crate::language_settings::import_paths(repo_root, languages),
+    )?;
+    cruxe_state::workspace_projects::replace_for_ref(
+        conn,
+        project_id,
+        ref_name,
+        &crate::project_discovery::discover_projects(repo_root),
+    )?;
 
     for action in actions {
         let path = action.path();
+        let _span = info_span!("index.sync_file", path).entered();
         match action {
             SyncAction::Deleted { .. } => {
                 // Keep SQLite side consistent with the staged overlay snapshot:
                 // deleted files must not leave stale symbols/manifest/import edges behind.
-                let deleted_symbol_ids: Vec<String> =
-                    cruxe_state::symbols::list_symbols_in_file(conn, project_id, ref_name, path)?
-                        .into_iter()
-                        .map(|symbol| symbol.symbol_stable_id)
-                        .collect();
-                cruxe_state::symbols::delete_symbols_for_file(conn, project_id, ref_name, path)?;
-                cruxe_state::manifest::delete_manifest(conn, project_id, ref_name, path)?;
-                let source_edge_id = crate::import_extract::source_symbol_id_for_path(path);
-                cruxe_state::edges::delete_edges_for_file(
-                    conn,
-                    project_id,
-                    ref_name,
-                    vec![source_edge_id.as_str()],
-                )?;
-                cruxe_state::edges::delete_call_edges_for_file(conn, project_id, ref_name, path)?;
-                cruxe_state::edges::delete_call_edges_to_symbols(
-                    conn,
-                    project_id,
-                    ref_name,
-                    &deleted_symbol_ids,
-                )?;
-                embedding_writer.delete_for_file_vectors_with_symbols(
-                    conn,
-                    path,
-                    &deleted_symbol_ids,
-                )?;
+                delete_file_rows(conn, &embedding_writer, project_id, ref_name, path)?;
                 applied_actions.push(action.clone());
                 continue;
             }
             SyncAction::Added { .. } | SyncAction::Modified { .. } => {
                 let is_modified = matches!(action, SyncAction::Modified { .. });
                 let full_path = repo_root.join(path);
-                let content = match std::fs::read_to_string(&full_path) {
-                    Ok(c) => c,
+                let bytes = match std::fs::read(&full_path) {
+                    Ok(bytes) => bytes,
                     Err(err) => {
                         return Err(StateError::Io(std::io::Error::new(
                             err.kind(),
@@ -454,14 +549,44 @@ where
                         )));
                     }
                 };
+                let (content, encoding) = match limits.decode(bytes) {
+                    Ok(decoded) => (decoded.text, decoded.encoding.recorded()),
+                    Err(skip) => {
+                        // Over a limit now: drop what an earlier version left
+                        // behind, as for a deleted file.
+                        warn!(
+                            code = skip.reason.log_code().as_str(),
+                            path,
+                            reason = skip.reason.as_str(),
+                            detail = %skip.detail,
+                            "Skipped changed file"
+                        );
+                        delete_file_rows(conn, &embedding_writer, project_id, ref_name, path)?;
+                        cruxe_state::skipped_files::record_skip(
+                            conn,
+                            project_id,
+                            ref_name,
+                            &SkippedFileRecord {
+                                repo: project_id.to_string(),
+                                r#ref: ref_name.to_string(),
+                                path: path.to_string(),
+                                reason: skip.reason,
+                                detail: skip.detail,
+                            },
+                        )?;
+                        applied_actions.push(action.clone());
+                        continue;
+                    }
+                };
                 let language = crate::scanner::detect_language(&full_path).unwrap_or_else(|| {
                     warn!(
+                        code = LogCode::UnsupportedLanguage.as_str(),
                         path,
                         "Changed file language unsupported; indexing via file_fallback snippets"
                     );
                     "text".to_string()
                 });
-                let artifacts = prepare::build_source_artifacts_with_parser(
+                let mut artifacts = prepare::build_source_artifacts_with_parser(
                     prepare::ArtifactBuildInput {
                         content: &content,
                         language: &language,
@@ -470,17 +595,31 @@ where
                         ref_name,
                         source_layer: Some("overlay"),
                         include_imports: false,
+                        bodies: true,
                         chunking: Some(&semantic.chunking),
                     },
                     &mut parse_changed_file,
                 );
                 if let Some(err) = artifacts.parse_error.as_deref() {
                     warn!(
+                        code = LogCode::ParseFailed.as_str(),
                         path,
                         error = %err,
                         "Parse failed for changed file; continuing with metadata-only update"
                     );
                 }
+                let added = plugin_host.analyze(&PluginInput {
+                    repo: project_id,
+                    r#ref: ref_name,
+                    commit: None,
+                    path,
+                    language: &language,
+                    source: &content,
+                    symbols: &artifacts.symbols,
+                    call_edges: &artifacts.call_edges,
+                });
+                artifacts.symbols.extend(added.symbols);
+                artifacts.call_edges.extend(added.call_edges);
 
                 let filename = full_path
                     .file_name()
@@ -499,6 +638,92 @@ where
                 batch.add_snippets(&index_set.snippets, &artifacts.snippets)?;
                 batch.add_file(&index_set.files, &file)?;
                 batch.write_sqlite(conn, &artifacts.symbols, &file, file_mtime_ns(&full_path))?;
+                cruxe_state::injections::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.injections,
+                )?;
+                cruxe_state::go_embeds::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.embeds,
+                )?;
+                cruxe_state::todos::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.todos,
+                )?;
+                cruxe_state::parse_errors::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.parse_errors,
+                )?;
+                cruxe_state::plugin_findings::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &added.findings,
+                )?;
+                cruxe_state::skipped_files::delete_for_file(conn, project_id, ref_name, path)?;
+                cruxe_state::concurrency::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.concurrency,
+                )?;
+                cruxe_state::routes::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.routes,
+                )?;
+                cruxe_state::locals::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.locals,
+                )?;
+                cruxe_state::literals::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &artifacts.literals,
+                )?;
+                cruxe_state::generated_files::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    artifacts.generated,
+                )?;
+                cruxe_state::file_encodings::replace_for_file(
+                    conn, project_id, ref_name, path, encoding,
+                )?;
+                let symbol_blame = if blame {
+                    prepare::blame_symbols(repo_root, None, path, &content, &artifacts.symbols)
+                } else {
+                    Vec::new()
+                };
+                cruxe_state::symbol_blame::replace_for_file(
+                    conn,
+                    project_id,
+                    ref_name,
+                    path,
+                    &symbol_blame,
+                )?;
                 if is_modified || !artifacts.call_edges.is_empty() {
                     pending_call_edges.push((path.to_string(), artifacts.call_edges));
                 }
@@ -524,6 +749,7 @@ where
     }
 
     if !pending_call_edges.is_empty() {
+        let _span = info_span!("index.resolve_edges", files = pending_call_edges.len()).entered();
         if pending_call_edges
             .iter()
             .any(|(_, call_edges)| !call_edges.is_empty())
@@ -531,6 +757,9 @@ where
             let lookup = call_extract::load_symbol_lookup(conn, project_id, ref_name)?;
             for (_, call_edges) in pending_call_edges.iter_mut() {
                 if !call_edges.is_empty() {
+                    crate::go_workspace::resolve_qualified_go_calls(
+                        conn, project_id, ref_name, call_edges,
+                    )?;
                     call_extract::resolve_call_targets_with_lookup(&lookup, call_edges);
                 }
             }
@@ -538,6 +767,10 @@ where
         writer::replace_call_edges_for_files(conn, project_id, ref_name, pending_call_edges)?;
     }
 
+    let mut embeds = cruxe_state::go_embeds::list_embeds(conn, project_id, ref_name)?;
+    crate::go_embed::resolve_embeds(repo_root, &mut embeds);
+    cruxe_state::go_embeds::update_resolution(conn, project_id, ref_name, &embeds)?;
+
     let file_centrality =
         match crate::centrality::compute_file_centrality(conn, project_id, ref_name) {
             Ok(map) => map,
@@ -687,7 +920,7 @@ fn process_semantic_enrichment_job(
     Ok(())
 }
 
-fn load_snippets_for_file(
+pub(crate) fn load_snippets_for_file(
     index_set: &cruxe_state::tantivy_index::IndexSet,
     project_id: &str,
     ref_name: &str,
@@ -833,25 +1066,56 @@ where
     }
 
     let mut job_id: Option<String> = None;
-    let semantic_config = Config::load(Some(&execution_root))
-        .map(|config| config.search.semantic)
-        .unwrap_or_else(|err| {
-            warn!(
-                project_id = request.project_id,
-                ref_name = request.ref_name,
-                error = %err,
-                "Failed to load semantic config for incremental sync, defaulting to semantic=off"
-            );
-            SemanticConfig::default()
-        });
+    let (semantic_config, languages_config, blame, deepen, limits, plugins) =
+        Config::load(Some(&execution_root))
+            .map(|config| {
+                crate::runtime_grammars::register(&config.grammars, &execution_root);
+                (
+                    config.search.semantic,
+                    config.languages,
+                    config.index.blame,
+                    config.history.deepen,
+                    FileLimits::from_config(&config.index),
+                    config.plugins,
+                )
+            })
+            .unwrap_or_else(|err| {
+                warn!(
+                    project_id = request.project_id,
+                    ref_name = request.ref_name,
+                    error = %err,
+                    "Failed to load config for incremental sync, defaulting to semantic=off"
+                );
+                (
+                    SemanticConfig::default(),
+                    LanguagesConfig::default(),
+                    false,
+                    0,
+                    FileLimits::from_config(&IndexConfig::default()),
+                    BTreeMap::new(),
+                )
+            });
     let sync_result = (|| -> Result<IncrementalSyncStats, StateError> {
         let head_commit = adapter
             .resolve_head(&execution_root)
             .map_err(StateError::vcs)?;
 
         let rebuild_triggered = if let Some(last) = request.last_indexed_commit {
-            should_rebuild_overlay(adapter, &execution_root, last, &head_commit)
-                .map_err(StateError::vcs)?
+            match should_rebuild_overlay(adapter, &execution_root, last, &head_commit) {
+                Ok(rebuild) => rebuild,
+                // A fresh shallow clone need not contain the commit the
+                // overlay was last synced at.
+                Err(err) if history::history_info(&execution_root).shallow => {
+                    warn!(
+                        ref_name = request.ref_name,
+                        last_indexed_commit = last,
+                        error = %err,
+                        "Last synced commit is not in this shallow clone; rebuilding the overlay"
+                    );
+                    true
+                }
+                Err(err) => return Err(StateError::vcs(err)),
+            }
         } else {
             false
         };
@@ -883,8 +1147,27 @@ where
             }
         }
 
-        let plan = build_sync_plan(adapter, &execution_root, request.base_ref, request.ref_name)
-            .map_err(StateError::vcs)?;
+        let plan = match history::with_deepening(&execution_root, deepen, || {
+            build_sync_plan(adapter, &execution_root, request.base_ref, request.ref_name)
+        }) {
+            Ok(plan) => plan,
+            Err(err) if history::history_info(&execution_root).shallow => {
+                warn!(
+                    ref_name = request.ref_name,
+                    base_ref = request.base_ref,
+                    error = %err,
+                    "No merge base in this shallow clone; syncing against the tip of the base ref"
+                );
+                build_sync_plan_from_base_tip(
+                    adapter,
+                    &execution_root,
+                    request.base_ref,
+                    request.ref_name,
+                )
+                .map_err(StateError::vcs)?
+            }
+            Err(err) => return Err(StateError::vcs(err)),
+        };
 
         let staging_index_set =
             staging::create_staging_index_set(request.data_dir, request.sync_id)?;
@@ -898,6 +1181,10 @@ where
             request.ref_name,
             &plan.actions,
             &semantic_config,
+            &languages_config,
+            blame,
+            limits,
+            &plugins,
         )?;
         apply_tombstones_for_actions(&tx, request.project_id, request.ref_name, &applied_actions)?;
         let total_file_count =
@@ -952,6 +1239,11 @@ where
 
     let outcome = match sync_result {
         Ok(stats) => {
+            cruxe_core::stats::phase("sync.overlay", started.elapsed());
+            cruxe_core::stats::count(
+                cruxe_core::stats::FILES_REPARSED,
+                stats.processed_files as u64,
+            );
             if let Some(job_id) = job_id.as_deref() {
                 match mark_sync_job_published(
                     conn,
@@ -1284,6 +1576,10 @@ mod tests {
                     ref_name: "feat/auth",
                     actions: &actions,
                     semantic: &SemanticConfig::default(),
+                    languages: &LanguagesConfig::default(),
+                    blame: false,
+                    limits: FileLimits::from_config(&IndexConfig::default()),
+                    plugins: &BTreeMap::new(),
                 },
                 |_content, _language| Err("synthetic parse failure".to_string()),
             )
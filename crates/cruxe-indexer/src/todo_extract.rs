@@ -0,0 +1,224 @@
+//! TODO, FIXME and HACK comments and deprecation notices (`Deprecated:` in
+//! Go doc comments, `@deprecated` in JSDoc/Javadoc), each attached to the
+//! symbol it belongs to.
+//!
+//! A marker inside a function belongs to that function. One outside any
+//! function belongs to the symbol it documents, when only comments and
+//! attributes separate the two, and otherwise to the innermost symbol that
+//! contains it (a struct field, a class body).
+
+use crate::call_extract::resolve_caller_symbol;
+use cruxe_core::types::{SymbolRecord, TodoRecord};
+use regex::Regex;
+use std::sync::LazyLock;
+
+static WORK_MARKER: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"^(TODO|FIXME|HACK)\b(?:\(([^)]*)\))?[:\s-]*(.*)$").expect("work marker regex")
+});
+
+static DEPRECATION: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"^(?:Deprecated:|@deprecated\b)\s*(.*)$").expect("deprecation regex")
+});
+
+/// Markers found in the comments of a parsed file, in line order.
+pub fn extract_todos(
+    tree: &tree_sitter::Tree,
+    source: &str,
+    path: &str,
+    symbols: &[SymbolRecord],
+    repo: &str,
+    ref_name: &str,
+) -> Vec<TodoRecord> {
+    let lines: Vec<&str> = source.lines().collect();
+    let mut comments = Vec::new();
+    collect_comments(tree.root_node(), &mut comments);
+
+    let mut records = Vec::new();
+    for comment in comments {
+        let first_line = comment.start_position().row;
+        let Some(text) = source.get(comment.byte_range()) else {
+            continue;
+        };
+        for (offset, raw) in text.lines().enumerate() {
+            let Some((marker, assignee, body)) = parse_marker(strip_comment_syntax(raw)) else {
+                continue;
+            };
+            let line = (first_line + offset) as u32 + 1;
+            let symbol = attach(symbols, &lines, line);
+            records.push(TodoRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: path.to_string(),
+                line,
+                marker,
+                text: body,
+                assignee,
+                symbol_id: symbol.map(|symbol| symbol.symbol_stable_id.clone()),
+                symbol: symbol.map(|symbol| symbol.qualified_name.clone()),
+            });
+        }
+    }
+    records.sort_by_key(|record| record.line);
+    records
+}
+
+fn collect_comments<'t>(node: tree_sitter::Node<'t>, comments: &mut Vec<tree_sitter::Node<'t>>) {
+    if node.kind().contains("comment") {
+        comments.push(node);
+        return;
+    }
+    let mut cursor = node.walk();
+    for child in node.children(&mut cursor) {
+        collect_comments(child, comments);
+    }
+}
+
+/// One comment line without its `//`, `/*`, `*`, `#` or `*/` decoration.
+fn strip_comment_syntax(line: &str) -> &str {
+    line.trim()
+        .trim_start_matches(['/', '*', '#', '!'])
+        .trim_end_matches("*/")
+        .trim()
+}
+
+/// `(marker, assignee, text)` of a comment line that starts with a marker.
+fn parse_marker(line: &str) -> Option<(String, Option<String>, String)> {
+    if let Some(captures) = WORK_MARKER.captures(line) {
+        let assignee = captures
+            .get(2)
+            .map(|name| name.as_str().trim().to_string())
+            .filter(|name| !name.is_empty());
+        return Some((
+            captures[1].to_ascii_lowercase(),
+            assignee,
+            captures[3].trim().to_string(),
+        ));
+    }
+    DEPRECATION.captures(line).map(|captures| {
+        (
+            "deprecated".to_string(),
+            None,
+            captures[1].trim().to_string(),
+        )
+    })
+}
+
+fn attach<'s>(symbols: &'s [SymbolRecord], lines: &[&str], line: u32) -> Option<&'s SymbolRecord> {
+    resolve_caller_symbol(symbols, line)
+        .or_else(|| documented_symbol(symbols, lines, line))
+        .or_else(|| {
+            symbols
+                .iter()
+                .filter(|symbol| line >= symbol.line_start && line <= symbol.line_end)
+                .min_by_key(|symbol| symbol.line_end.saturating_sub(symbol.line_start))
+        })
+}
+
+/// The symbol declared right below `line` with only comments and attributes
+/// in between.
+fn documented_symbol<'s>(
+    symbols: &'s [SymbolRecord],
+    lines: &[&str],
+    line: u32,
+) -> Option<&'s SymbolRecord> {
+    let symbol = symbols
+        .iter()
+        .filter(|symbol| symbol.line_start > line)
+        .min_by_key(|symbol| symbol.line_start)?;
+    let between = lines
+        .get(line as usize..(symbol.line_start as usize).saturating_sub(1))
+        .unwrap_or_default();
+    between
+        .iter()
+        .map(|text| text.trim_start())
+        .all(|text| {
+            ["//", "/*", "*", "#", "@"]
+                .iter()
+                .any(|prefix| text.starts_with(prefix))
+        })
+        .then_some(symbol)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::parse_file;
+    use cruxe_core::types::SymbolKind;
+
+    fn symbol(name: &str, kind: SymbolKind, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "client.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn markers_attach_to_enclosing_or_documented_symbols() {
+        let source = r#"package client
+
+// TODO(ada): move to config
+var Timeout = 5
+
+// Fetch loads a page.
+//
+// Deprecated: use FetchContext.
+func Fetch() {
+	/* FIXME: retries are not bounded */
+	go poll() // HACK - poll until ready
+}
+
+// todo lowercase is prose, not a marker
+"#;
+        let symbols = [
+            symbol("Timeout", SymbolKind::Variable, 4, 4),
+            symbol("Fetch", SymbolKind::Function, 9, 12),
+        ];
+        let tree = parse_file(source, "go").unwrap();
+        let found = extract_todos(&tree, source, "client.go", &symbols, "repo", "main");
+        let summary: Vec<(u32, &str, &str, Option<&str>, Option<&str>)> = found
+            .iter()
+            .map(|record| {
+                (
+                    record.line,
+                    record.marker.as_str(),
+                    record.text.as_str(),
+                    record.assignee.as_deref(),
+                    record.symbol.as_deref(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            summary,
+            [
+                (3, "todo", "move to config", Some("ada"), Some("Timeout")),
+                (8, "deprecated", "use FetchContext.", None, Some("Fetch")),
+                (10, "fixme", "retries are not bounded", None, Some("Fetch")),
+                (11, "hack", "poll until ready", None, Some("Fetch")),
+            ]
+        );
+        assert_eq!(found[0].symbol_id.as_deref(), Some("stable::Timeout"));
+    }
+
+    #[test]
+    fn jsdoc_deprecations_are_markers() {
+        assert_eq!(
+            parse_marker(strip_comment_syntax(" * @deprecated since 2.0 */")),
+            Some(("deprecated".to_string(), None, "since 2.0".to_string()))
+        );
+        assert_eq!(parse_marker(strip_comment_syntax("# TODOS are fine")), None);
+    }
+}
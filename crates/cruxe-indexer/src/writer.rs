@@ -1,9 +1,10 @@
 use crate::import_extract::{self, RawImport};
+use crate::spill;
 use cruxe_core::error::StateError;
 use cruxe_core::time::now_iso8601;
 use cruxe_core::types::{CallEdge, FileRecord, SnippetRecord, SymbolRecord};
 use cruxe_state::tantivy_index::{self, IndexSet};
-use cruxe_state::{edges, manifest, symbols};
+use cruxe_state::{edges, manifest, reference_fingerprints, symbols};
 use rusqlite::Connection;
 use std::collections::HashMap;
 use std::path::{Path, PathBuf};
@@ -61,18 +62,24 @@ pub struct BatchWriter {
 impl BatchWriter {
     /// Create a new batch writer. Allocates one IndexWriter per index (50MB buffer each).
     pub fn new(index_set: &IndexSet) -> Result<Self, StateError> {
+        Self::with_heap_size(index_set, spill::DEFAULT_WRITER_HEAP_BYTES)
+    }
+
+    /// Create a batch writer whose IndexWriters each get `heap_bytes`. A
+    /// writer whose heap fills up flushes a segment to disk and carries on.
+    pub fn with_heap_size(index_set: &IndexSet, heap_bytes: usize) -> Result<Self, StateError> {
         Ok(Self {
             symbol_writer: index_set
                 .symbols
-                .writer(50_000_000)
+                .writer(heap_bytes)
                 .map_err(StateError::tantivy)?,
             snippet_writer: index_set
                 .snippets
-                .writer(50_000_000)
+                .writer(heap_bytes)
                 .map_err(StateError::tantivy)?,
             file_writer: index_set
                 .files
-                .writer(50_000_000)
+                .writer(heap_bytes)
                 .map_err(StateError::tantivy)?,
         })
     }
@@ -438,8 +445,8 @@ pub fn replace_import_edges_for_file(
         let mut stmt = conn
             .prepare(
                 "INSERT OR REPLACE INTO symbol_edges
-                 (repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence, edge_provider, resolution_outcome, confidence_weight)
-                 VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)",
+                 (repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence, edge_provider, resolution_outcome, confidence_weight, source_file, source_line)
+                 VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12)",
             )
             .map_err(StateError::sqlite)?;
         for edge in resolved {
@@ -454,6 +461,8 @@ pub fn replace_import_edges_for_file(
                 edge.edge_provider,
                 edge.resolution_outcome,
                 edge.confidence_weight,
+                file_path,
+                edge.source_line,
             ])
             .map_err(StateError::sqlite)?;
         }
@@ -489,7 +498,8 @@ pub fn replace_call_edges_for_file(
         return Ok(());
     }
     edges::insert_call_edges(conn, repo, ref_name, &call_edges)?;
-    Ok(())
+    let fingerprint = reference_fingerprints::fingerprint_for_call_edges(&call_edges);
+    reference_fingerprints::upsert_fingerprint(conn, repo, ref_name, file_path, &fingerprint)
 }
 
 /// Replace call edges for multiple files atomically.
@@ -0,0 +1,454 @@
+//! Role-based access control for the HTTP query API.
+//!
+//! Every authenticated HTTP request carries a [`Grant`]: a role and the path
+//! prefixes it may read. Tenant tokens grant [`Role::Admin`] over the whole
+//! project; `[[server.api_keys]]` entries grant narrower access. Grants are
+//! enforced around tool dispatch rather than inside each tool:
+//!
+//! - readers may not call tools that write index state;
+//! - path arguments outside the granted prefixes are refused, as are path
+//!   arguments that are not strings and so cannot be checked;
+//! - result objects whose path lies outside the prefixes are removed wherever
+//!   they appear in the tool payload, and the removal is counted in
+//!   `metadata.access_filtered_count`.
+//!
+//! Path arguments are the properties of each tool's input schema that
+//! [`is_path_argument`] recognises; result paths are found by
+//! [`is_path_key`] at any depth.
+
+use crate::protocol::{JsonRpcRequest, JsonRpcResponse};
+use cruxe_core::error::ProtocolErrorCode;
+use serde_json::{Map, Value, json};
+use std::collections::HashMap;
+use std::sync::OnceLock;
+
+/// Tools that start index jobs or otherwise change stored state.
+const WRITE_TOOLS: &[&str] = &["index_repo", "sync_repo"];
+
+/// Path arguments of each tool, collected from its input schema.
+static TOOL_PATH_ARGUMENTS: OnceLock<HashMap<String, Vec<String>>> = OnceLock::new();
+
+/// Whether a result key names a repository-relative file: `path`, `file`, or
+/// a `*_path` / `*_file` compound such as `result_path` or `source_file`.
+pub(crate) fn is_path_key(key: &str) -> bool {
+    key == "path" || key == "file" || key.ends_with("_path") || key.ends_with("_file")
+}
+
+/// Whether an argument names a file or a path prefix: a path key, or a
+/// `path_*` filter such as `path_filter` or `path_prefix`.
+pub(crate) fn is_path_argument(key: &str) -> bool {
+    is_path_key(key) || key.starts_with("path_")
+}
+
+fn tool_path_arguments(tool: &str) -> &'static [String] {
+    let tools = TOOL_PATH_ARGUMENTS.get_or_init(|| {
+        crate::tools::list_tools()
+            .into_iter()
+            .map(|tool| {
+                let keys = tool
+                    .input_schema
+                    .get("properties")
+                    .and_then(Value::as_object)
+                    .map(|properties| {
+                        properties
+                            .keys()
+                            .filter(|key| is_path_argument(key))
+                            .cloned()
+                            .collect()
+                    })
+                    .unwrap_or_default();
+                (tool.name, keys)
+            })
+            .collect()
+    });
+    tools.get(tool).map(Vec::as_slice).unwrap_or_default()
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Role {
+    /// Query tools only.
+    Reader,
+    /// Query tools plus indexing.
+    Admin,
+}
+
+impl Role {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "reader" | "read" => Some(Self::Reader),
+            "admin" => Some(Self::Admin),
+            _ => None,
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Grant {
+    /// Credential name, for logs.
+    pub name: String,
+    pub role: Role,
+    /// Readable path prefixes; empty means the whole project.
+    pub read_prefixes: Vec<String>,
+}
+
+impl Grant {
+    /// Unrestricted access, as held by tenant tokens.
+    pub fn admin(name: impl Into<String>) -> Self {
+        Self {
+            name: name.into(),
+            role: Role::Admin,
+            read_prefixes: Vec::new(),
+        }
+    }
+
+    /// Whether `path` lies under a readable prefix. Paths with `.` or `..`
+    /// segments are refused rather than resolved, so `src/public/../secret`
+    /// cannot pass as `src/public`.
+    pub fn allows_path(&self, path: &str) -> bool {
+        if self.read_prefixes.is_empty() {
+            return true;
+        }
+        let path = normalize_path(path);
+        if path
+            .split(['/', '\\'])
+            .any(|segment| segment == "." || segment == "..")
+        {
+            return false;
+        }
+        self.read_prefixes.iter().any(|prefix| {
+            path == prefix.trim_end_matches('/')
+                || (path.starts_with(prefix.as_str())
+                    && (prefix.ends_with('/') || path[prefix.len()..].starts_with('/')))
+        })
+    }
+
+    /// Refuse a request this grant does not cover, before it is dispatched.
+    pub fn check_request(&self, request: &JsonRpcRequest) -> Result<(), JsonRpcResponse> {
+        if request.method != "tools/call" {
+            return Ok(());
+        }
+        let tool = request
+            .params
+            .get("name")
+            .and_then(Value::as_str)
+            .unwrap_or("");
+        if self.role == Role::Reader && WRITE_TOOLS.contains(&tool) {
+            return Err(forbidden(
+                request,
+                format!("credential {} may not call {tool}", self.name),
+            ));
+        }
+        if let Some(arguments) = request.params.get("arguments").and_then(Value::as_object)
+            && let Err(message) = self.check_arguments(tool, arguments)
+        {
+            return Err(forbidden(request, message));
+        }
+        Ok(())
+    }
+
+    /// Check the path arguments of one call: those the tool's schema declares,
+    /// plus any other argument named like a path.
+    fn check_arguments(&self, tool: &str, arguments: &Map<String, Value>) -> Result<(), String> {
+        let declared = tool_path_arguments(tool);
+        for (key, value) in arguments {
+            if !declared.contains(key) && !is_path_argument(key) {
+                continue;
+            }
+            match value {
+                Value::Null => {}
+                Value::String(path) if self.allows_path(path) => {}
+                Value::String(path) => {
+                    return Err(format!("credential {} may not read {path}", self.name));
+                }
+                _ => {
+                    return Err(format!(
+                        "credential {} may not pass a non-string `{key}`",
+                        self.name
+                    ));
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Drop result entries outside the readable prefixes from a tool payload.
+    pub fn filter_response(&self, mut response: JsonRpcResponse) -> JsonRpcResponse {
+        if self.read_prefixes.is_empty() {
+            return response;
+        }
+        let Some(content) = response
+            .result
+            .as_mut()
+            .and_then(|result| result.get_mut("content"))
+            .and_then(Value::as_array_mut)
+        else {
+            return response;
+        };
+        for item in content {
+            let Some(text) = item.get("text").and_then(Value::as_str) else {
+                continue;
+            };
+            let Ok(mut payload) = serde_json::from_str::<Value>(text) else {
+                continue;
+            };
+            let removed = self.prune(&mut payload);
+            if removed == 0 {
+                continue;
+            }
+            if let Some(metadata) = payload.get_mut("metadata").and_then(Value::as_object_mut) {
+                metadata.insert("access_filtered_count".to_string(), json!(removed));
+            }
+            item["text"] = Value::String(serde_json::to_string(&payload).unwrap_or_default());
+        }
+        response
+    }
+
+    /// Remove objects naming a disallowed path from `value`; returns how
+    /// many. Array items are dropped and object fields removed at any depth.
+    /// When `value` itself names such a path, only its `metadata` is kept.
+    pub(crate) fn prune(&self, value: &mut Value) -> usize {
+        if !self.allows_object(value) {
+            let metadata = value.get("metadata").cloned();
+            *value = json!({});
+            if let Some(metadata) = metadata {
+                value["metadata"] = metadata;
+            }
+            return 1;
+        }
+        self.prune_children(value)
+    }
+
+    fn prune_children(&self, value: &mut Value) -> usize {
+        match value {
+            Value::Array(items) => {
+                let before = items.len();
+                items.retain(|item| self.allows_object(item));
+                let mut removed = before - items.len();
+                for item in items {
+                    removed += self.prune_children(item);
+                }
+                removed
+            }
+            Value::Object(map) => {
+                let before = map.len();
+                map.retain(|_, child| self.allows_object(child));
+                let mut removed = before - map.len();
+                for child in map.values_mut() {
+                    removed += self.prune_children(child);
+                }
+                removed
+            }
+            _ => 0,
+        }
+    }
+
+    fn allows_object(&self, value: &Value) -> bool {
+        let Some(map) = value.as_object() else {
+            return true;
+        };
+        map.iter()
+            .filter(|(key, _)| is_path_key(key))
+            .filter_map(|(_, value)| value.as_str())
+            .all(|path| path.is_empty() || self.allows_path(path))
+    }
+}
+
+/// Normalize a configured prefix: repository-relative, `/`-separated.
+pub fn normalize_prefix(prefix: &str) -> String {
+    normalize_path(prefix).to_string()
+}
+
+fn normalize_path(path: &str) -> &str {
+    path.trim().trim_start_matches("./").trim_start_matches('/')
+}
+
+fn forbidden(request: &JsonRpcRequest, message: String) -> JsonRpcResponse {
+    crate::server::tool_text_response_public(
+        request.id.clone(),
+        json!({
+            "error": {
+                "code": ProtocolErrorCode::Forbidden.as_str(),
+                "message": message,
+            }
+        }),
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn reader(prefixes: &[&str]) -> Grant {
+        Grant {
+            name: "ci".to_string(),
+            role: Role::Reader,
+            read_prefixes: prefixes.iter().map(|p| normalize_prefix(p)).collect(),
+        }
+    }
+
+    fn call(tool: &str, arguments: Value) -> JsonRpcRequest {
+        JsonRpcRequest {
+            jsonrpc: "2.0".into(),
+            id: Some(json!(1)),
+            method: "tools/call".into(),
+            params: json!({"name": tool, "arguments": arguments}),
+        }
+    }
+
+    fn payload(response: &JsonRpcResponse) -> Value {
+        let text = response.result.as_ref().unwrap()["content"][0]["text"]
+            .as_str()
+            .unwrap();
+        serde_json::from_str(text).unwrap()
+    }
+
+    #[test]
+    fn prefixes_match_whole_path_segments() {
+        let grant = reader(&["./src/public", "docs/"]);
+        assert!(grant.allows_path("src/public/api.rs"));
+        assert!(grant.allows_path("src/public"));
+        assert!(grant.allows_path("/docs/guide.md"));
+        assert!(!grant.allows_path("src/publicity.rs"));
+        assert!(!grant.allows_path("src/internal/keys.rs"));
+        assert!(Grant::admin("tenant").allows_path("anything.rs"));
+    }
+
+    #[test]
+    fn dot_segments_cannot_escape_a_prefix() {
+        let grant = reader(&["src/public/"]);
+        assert!(!grant.allows_path("src/public/../internal/secret.go"));
+        assert!(!grant.allows_path("src/public/./../../etc/passwd"));
+        assert!(!grant.allows_path("src/public\\..\\internal\\secret.go"));
+        assert!(!grant.allows_path("./src/public/.."));
+        assert!(grant.allows_path("./src/public/api.go"));
+        assert!(grant.allows_path("src/public/..hidden.go"));
+    }
+
+    #[test]
+    fn readers_cannot_index_or_name_hidden_paths() {
+        let grant = reader(&["src/public/"]);
+        assert!(grant.check_request(&call("search_code", json!({}))).is_ok());
+
+        let denied = grant
+            .check_request(&call("index_repo", json!({})))
+            .unwrap_err();
+        assert_eq!(payload(&denied)["error"]["code"], "forbidden");
+
+        let denied = grant
+            .check_request(&call(
+                "get_file_outline",
+                json!({"path": "src/internal/a.rs"}),
+            ))
+            .unwrap_err();
+        assert_eq!(payload(&denied)["error"]["code"], "forbidden");
+
+        assert!(
+            Grant::admin("tenant")
+                .check_request(&call("index_repo", json!({})))
+                .is_ok()
+        );
+    }
+
+    #[test]
+    fn path_arguments_come_from_tool_schemas() {
+        let grant = reader(&["src/public/"]);
+        assert!(tool_path_arguments("explain_ranking").contains(&"result_path".to_string()));
+        assert!(tool_path_arguments("diff_context").contains(&"path_filter".to_string()));
+
+        let denied = grant
+            .check_request(&call(
+                "explain_ranking",
+                json!({"query": "key", "result_path": "src/internal/keys.rs", "result_line_start": 1}),
+            ))
+            .unwrap_err();
+        assert_eq!(payload(&denied)["error"]["code"], "forbidden");
+        assert!(
+            grant
+                .check_request(&call(
+                    "explain_ranking",
+                    json!({"query": "key", "result_path": "src/public/api.rs", "result_line_start": 1}),
+                ))
+                .is_ok()
+        );
+
+        // A path that is not a string cannot be checked, so it is refused.
+        let denied = grant
+            .check_request(&call(
+                "get_file_outline",
+                json!({"path": ["src/public/a.rs", "src/internal/b.rs"]}),
+            ))
+            .unwrap_err();
+        assert_eq!(payload(&denied)["error"]["code"], "forbidden");
+    }
+
+    #[test]
+    fn nested_and_top_level_results_are_pruned() {
+        let grant = reader(&["src/public/"]);
+        let response = crate::server::tool_text_response_public(
+            Some(json!(1)),
+            json!({
+                "context": {
+                    "primary": {"source_file": "src/internal/keys.rs", "body": "secret"},
+                    "related": {"items": [{"symbol": {"file_path": "src/internal/keys.rs"}}]},
+                },
+                "metadata": {},
+            }),
+        );
+        let filtered = payload(&grant.filter_response(response));
+        assert!(filtered["context"].get("primary").is_none());
+        assert!(
+            filtered["context"]["related"]["items"][0]
+                .get("symbol")
+                .is_none()
+        );
+        assert_eq!(filtered["metadata"]["access_filtered_count"], 2);
+
+        let explanation = crate::server::tool_text_response_public(
+            Some(json!(1)),
+            json!({
+                "result_path": "src/internal/keys.rs",
+                "scoring_details": {"path_affinity_reason": "no path match"},
+                "metadata": {"ref": "main"},
+            }),
+        );
+        let filtered = payload(&grant.filter_response(explanation));
+        assert!(filtered.get("result_path").is_none());
+        assert!(filtered.get("scoring_details").is_none());
+        assert_eq!(filtered["metadata"]["ref"], "main");
+        assert_eq!(filtered["metadata"]["access_filtered_count"], 1);
+
+        let allowed = crate::server::tool_text_response_public(
+            Some(json!(1)),
+            json!({
+                "result_path": "src/public/api.rs",
+                "scoring_details": {"path_affinity_reason": "no path match"},
+                "metadata": {},
+            }),
+        );
+        let filtered = payload(&grant.filter_response(allowed));
+        assert_eq!(filtered["result_path"], "src/public/api.rs");
+        assert!(filtered["metadata"].get("access_filtered_count").is_none());
+    }
+
+    #[test]
+    fn responses_drop_entries_outside_prefixes() {
+        let grant = reader(&["src/public/"]);
+        let response = crate::server::tool_text_response_public(
+            Some(json!(1)),
+            json!({
+                "results": [
+                    {"path": "src/public/api.rs", "name": "serve"},
+                    {"path": "src/internal/keys.rs", "name": "secret"},
+                ],
+                "graph": {"edges": [{"file": "src/internal/keys.rs"}]},
+                "metadata": {},
+            }),
+        );
+
+        let filtered = payload(&grant.filter_response(response));
+        assert_eq!(filtered["results"].as_array().unwrap().len(), 1);
+        assert_eq!(filtered["results"][0]["name"], "serve");
+        assert!(filtered["graph"]["edges"].as_array().unwrap().is_empty());
+        assert_eq!(filtered["metadata"]["access_filtered_count"], 2);
+    }
+}
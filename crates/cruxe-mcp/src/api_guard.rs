@@ -0,0 +1,176 @@
+//! Admission for the REST and gRPC APIs of `cruxe serve --http`, sharing the
+//! JSON-RPC server's `[[server.api_keys]]`, `[server.limits]` and `[audit]`
+//! settings.
+//!
+//! With API keys configured, every query must carry
+//! `Authorization: Bearer <token>`; the key's [`Grant`] then restricts the
+//! paths a query may name and the results it returns. Without keys the APIs
+//! are unauthenticated, so the server refuses to listen beyond loopback.
+//! Either way each query is charged to its client's rate window and written
+//! to the audit log.
+
+use crate::access::Grant;
+use crate::limits::{Rejection, ServerLimits};
+use crate::tenants::ApiKeys;
+use axum::http::HeaderMap;
+use cruxe_core::audit::{AuditEvent, AuditLog};
+use cruxe_core::config::Config;
+use serde_json::Value;
+use std::net::{IpAddr, SocketAddr};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+use tracing::warn;
+
+pub(crate) struct ApiGuard {
+    keys: Option<ApiKeys>,
+    limits: ServerLimits,
+    audit: Option<Arc<AuditLog>>,
+    project_id: String,
+}
+
+/// The party behind one API request.
+pub(crate) struct ApiCaller {
+    /// Key name, or remote address when no keys are configured.
+    pub(crate) client: String,
+    /// `None` when no keys are configured.
+    pub(crate) grant: Option<Arc<Grant>>,
+}
+
+impl ApiGuard {
+    pub(crate) fn from_config(
+        config: &Config,
+        project_id: &str,
+    ) -> Result<Self, Box<dyn std::error::Error>> {
+        Ok(Self {
+            keys: ApiKeys::from_config(config)?,
+            limits: ServerLimits::from_config(&config.server.limits),
+            audit: AuditLog::from_config(config)?.map(Arc::new),
+            project_id: project_id.to_string(),
+        })
+    }
+
+    /// Refuse to expose unauthenticated APIs beyond this machine.
+    pub(crate) fn check_bind(&self, bind_addr: &str) -> Result<(), String> {
+        if self.keys.is_some() || is_loopback(bind_addr) {
+            return Ok(());
+        }
+        Err(format!(
+            "refusing to serve {bind_addr} without authentication; configure \
+             [[server.api_keys]] or listen on 127.0.0.1"
+        ))
+    }
+
+    pub(crate) fn timeout(&self) -> Option<Duration> {
+        self.limits.timeout()
+    }
+
+    /// Identify the caller, checking its bearer token when keys are
+    /// configured.
+    pub(crate) fn authenticate(
+        &self,
+        headers: &HeaderMap,
+        remote: Option<SocketAddr>,
+    ) -> Result<ApiCaller, Rejection> {
+        match &self.keys {
+            Some(keys) => {
+                let grant = keys.authenticate(headers)?;
+                Ok(ApiCaller {
+                    client: grant.name.clone(),
+                    grant: Some(grant),
+                })
+            }
+            None => Ok(ApiCaller {
+                client: remote
+                    .map(|addr| addr.ip().to_string())
+                    .unwrap_or_else(|| "unknown".to_string()),
+                grant: None,
+            }),
+        }
+    }
+
+    /// Count one query against the caller's `[server.limits]` window.
+    pub(crate) fn admit(&self, caller: &ApiCaller) -> Result<(), Rejection> {
+        self.limits
+            .admit(&caller.client, 1, Instant::now())
+            .inspect_err(|rejection| {
+                tracing::debug!(client = %caller.client, ?rejection, "Rejected API request");
+            })
+    }
+
+    /// Record one query in the audit log, if enabled. `summary` is
+    /// `(outcome, result_count, result_bytes)`.
+    pub(crate) fn audit(
+        &self,
+        caller: &ApiCaller,
+        operation: &str,
+        arguments: Value,
+        summary: (String, Option<u64>, u64),
+        elapsed: Duration,
+    ) {
+        let Some(audit) = &self.audit else {
+            return;
+        };
+        let (outcome, result_count, result_bytes) = summary;
+        let event = AuditEvent {
+            timestamp: cruxe_core::time::now_iso8601(),
+            action: "query".to_string(),
+            client: caller.client.clone(),
+            tenant: None,
+            project_id: self.project_id.clone(),
+            operation: operation.to_string(),
+            arguments,
+            outcome,
+            result_count,
+            result_bytes,
+            duration_ms: elapsed.as_millis() as u64,
+        };
+        if let Err(err) = audit.record(event) {
+            warn!(
+                path = %audit.path().display(),
+                error = %err,
+                "Failed to write audit log entry"
+            );
+        }
+    }
+
+    pub(crate) fn audits(&self) -> bool {
+        self.audit.is_some()
+    }
+}
+
+/// `localhost` or a loopback IP, with or without IPv6 brackets.
+fn is_loopback(host: &str) -> bool {
+    let host = host.trim_start_matches('[').trim_end_matches(']');
+    host.eq_ignore_ascii_case("localhost")
+        || host.parse::<IpAddr>().is_ok_and(|ip| ip.is_loopback())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::config::ApiKeyConfig;
+
+    #[test]
+    fn unauthenticated_apis_stay_on_loopback() {
+        let open = ApiGuard::from_config(&Config::default(), "p").unwrap();
+        for host in ["127.0.0.1", "::1", "[::1]", "localhost"] {
+            assert!(open.check_bind(host).is_ok(), "{host}");
+        }
+        for host in ["0.0.0.0", "::", "10.0.0.5", "example.com"] {
+            assert!(open.check_bind(host).is_err(), "{host}");
+        }
+
+        let mut config = Config::default();
+        config.server.api_keys = vec![ApiKeyConfig {
+            name: "ci".to_string(),
+            token: Some("tok".to_string()),
+            ..ApiKeyConfig::default()
+        }];
+        let keyed = ApiGuard::from_config(&config, "p").unwrap();
+        assert!(keyed.check_bind("0.0.0.0").is_ok());
+        assert_eq!(
+            keyed.authenticate(&HeaderMap::new(), None).err(),
+            Some(Rejection::Unauthorized)
+        );
+    }
+}
@@ -0,0 +1,416 @@
+//! `cruxe batch`: newline-delimited JSON queries in, one JSON response per
+//! line out, all served from one SQLite connection and one set of open
+//! indices so callers making hundreds of lookups pay start-up once.
+//!
+//! A request is an object naming an `op` plus that op's parameters, and an
+//! optional `id` echoed back verbatim:
+//!
+//! ```text
+//! {"id": 1, "op": "search", "q": "retry backoff", "limit": 5}
+//! {"id": 2, "op": "definitions", "name": "validate_token"}
+//! {"id": 3, "op": "definitions", "position": "src/auth.rs:42:17"}
+//! {"id": 4, "op": "references", "symbol": "validate_token"}
+//! {"id": 5, "op": "call_graph", "symbol": "handle", "direction": "callers", "depth": 2}
+//! {"id": 6, "op": "describe", "symbol": "Pool", "history": 0}
+//! ```
+//!
+//! Parameters mirror the REST routes in [`crate::rest`]; `ref` defaults to
+//! the session ref. Responses are `{id, ok: true, result}` or
+//! `{id, ok: false, error}`. A bad line gets an error response and the
+//! batch carries on.
+
+use crate::rest::clamp_limit;
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::types::generate_project_id;
+use cruxe_query::call_graph::{self, CallGraphDirection, CallGraphError, CallGraphRequest};
+use cruxe_query::describe::{self, DescribeError};
+use cruxe_query::find_references::{self, FindReferencesError};
+use cruxe_query::goto_definition::{self, Position};
+use cruxe_query::{locate, search};
+use cruxe_state::tantivy_index::IndexSet;
+use rusqlite::Connection;
+use serde::{Deserialize, Serialize};
+use serde_json::{Value, json};
+use std::io::{self, BufRead, Write};
+use std::path::{Path, PathBuf};
+
+/// Commits listed by `describe` when the request does not say.
+const DEFAULT_HISTORY: usize = 5;
+
+#[derive(Debug, Deserialize)]
+#[serde(tag = "op", rename_all = "snake_case")]
+enum BatchQuery {
+    Search {
+        q: String,
+        lang: Option<String>,
+        limit: Option<usize>,
+        #[serde(rename = "ref")]
+        ref_name: Option<String>,
+    },
+    Definitions {
+        name: Option<String>,
+        position: Option<String>,
+        kind: Option<String>,
+        lang: Option<String>,
+        limit: Option<usize>,
+        #[serde(rename = "ref")]
+        ref_name: Option<String>,
+    },
+    References {
+        symbol: String,
+        kind: Option<String>,
+        limit: Option<usize>,
+        #[serde(rename = "ref")]
+        ref_name: Option<String>,
+    },
+    CallGraph {
+        symbol: String,
+        path: Option<String>,
+        direction: Option<String>,
+        depth: Option<u32>,
+        limit: Option<usize>,
+        #[serde(rename = "ref")]
+        ref_name: Option<String>,
+    },
+    Describe {
+        symbol: String,
+        path: Option<String>,
+        history: Option<usize>,
+        #[serde(rename = "ref")]
+        ref_name: Option<String>,
+    },
+}
+
+/// Requests answered and how many of them failed.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize)]
+pub struct BatchSummary {
+    pub requests: usize,
+    pub errors: usize,
+}
+
+/// The state shared by every request in a batch.
+pub struct BatchSession {
+    workspace: PathBuf,
+    project_id: String,
+    ref_name: String,
+    conn: Connection,
+    /// `None` when the workspace has no Tantivy indices; only `search` and
+    /// `definitions` by name need them.
+    index_set: Option<IndexSet>,
+}
+
+impl BatchSession {
+    pub fn open(
+        workspace: &Path,
+        config_file: Option<&Path>,
+        ref_name: &str,
+    ) -> Result<Self, Box<dyn std::error::Error>> {
+        let config = Config::load_with_file(Some(workspace), config_file)?;
+        let project_id = generate_project_id(&workspace.to_string_lossy());
+        let data_dir = config.project_data_dir(&project_id);
+        let conn = cruxe_state::db::open_for_query(
+            &data_dir.join(constants::STATE_DB_FILE),
+            config.storage.busy_timeout_ms,
+            config.storage.cache_size,
+            config.storage.mmap_size,
+        )?;
+        Ok(Self {
+            workspace: workspace.to_path_buf(),
+            project_id,
+            ref_name: ref_name.to_string(),
+            conn,
+            index_set: IndexSet::open_existing(&data_dir).ok(),
+        })
+    }
+
+    /// Answer one request line.
+    pub fn handle_line(&self, line: &str) -> Value {
+        let request: Value = match serde_json::from_str(line) {
+            Ok(request) => request,
+            Err(e) => return failure(Value::Null, format!("invalid JSON: {e}")),
+        };
+        let id = request.get("id").cloned().unwrap_or(Value::Null);
+        let query: BatchQuery = match serde_json::from_value(request) {
+            Ok(query) => query,
+            Err(e) => return failure(id, format!("invalid request: {e}")),
+        };
+        match self.execute(query) {
+            Ok(result) => json!({ "id": id, "ok": true, "result": result }),
+            Err(message) => failure(id, message),
+        }
+    }
+
+    fn ref_or_default<'a>(&'a self, requested: &'a Option<String>) -> &'a str {
+        requested.as_deref().unwrap_or(&self.ref_name)
+    }
+
+    fn indices(&self) -> Result<&IndexSet, String> {
+        self.index_set
+            .as_ref()
+            .ok_or_else(|| "search indices not found; run `cruxe index` first".to_string())
+    }
+
+    fn execute(&self, query: BatchQuery) -> Result<Value, String> {
+        let conn = &self.conn;
+        let result = match query {
+            BatchQuery::Search {
+                q,
+                lang,
+                limit,
+                ref_name,
+            } => {
+                if q.trim().is_empty() {
+                    return Err("`q` must not be empty".to_string());
+                }
+                let response = search::search_code(
+                    self.indices()?,
+                    Some(conn),
+                    &q,
+                    Some(self.ref_or_default(&ref_name)),
+                    lang.as_deref(),
+                    clamp_limit(limit),
+                    false,
+                )
+                .map_err(|e| e.to_string())?;
+                serde_json::to_value(response)
+            }
+            BatchQuery::Definitions {
+                name,
+                position,
+                kind,
+                lang,
+                limit,
+                ref_name,
+            } => {
+                let ref_name = self.ref_or_default(&ref_name);
+                match (name, position) {
+                    (_, Some(position)) => {
+                        let position = Position::parse(&position).map_err(|e| e.to_string())?;
+                        let lookup = goto_definition::goto_definition(
+                            conn,
+                            &self.workspace,
+                            &self.project_id,
+                            ref_name,
+                            &position,
+                        )
+                        .map_err(|e| e.to_string())?;
+                        serde_json::to_value(lookup)
+                    }
+                    (Some(name), None) => {
+                        let definitions = locate::locate_symbol(
+                            &self.indices()?.symbols,
+                            &name,
+                            kind.as_deref(),
+                            None,
+                            lang.as_deref(),
+                            Some(ref_name),
+                            clamp_limit(limit),
+                        )
+                        .map_err(|e| e.to_string())?;
+                        Ok(json!({ "ref": ref_name, "definitions": definitions }))
+                    }
+                    (None, None) => return Err("pass `name` or `position`".to_string()),
+                }
+            }
+            BatchQuery::References {
+                symbol,
+                kind,
+                limit,
+                ref_name,
+            } => {
+                let result = find_references::find_references(
+                    conn,
+                    &self.workspace,
+                    &self.project_id,
+                    self.ref_or_default(&ref_name),
+                    kind.as_deref(),
+                    &symbol,
+                    clamp_limit(limit),
+                )
+                .map_err(|e| match e {
+                    FindReferencesError::SymbolNotFound => {
+                        format!("symbol `{symbol}` not found")
+                    }
+                    other => other.to_string(),
+                })?;
+                serde_json::to_value(result)
+            }
+            BatchQuery::CallGraph {
+                symbol,
+                path,
+                direction,
+                depth,
+                limit,
+                ref_name,
+            } => {
+                let direction = direction.as_deref().unwrap_or("both");
+                let direction = CallGraphDirection::parse(direction).ok_or_else(|| {
+                    format!("unknown direction `{direction}` (expected callers, callees or both)")
+                })?;
+                let request = CallGraphRequest {
+                    symbol_name: &symbol,
+                    path: path.as_deref(),
+                    direction,
+                    depth: depth.unwrap_or(1),
+                    limit: clamp_limit(limit),
+                };
+                let graph = call_graph::get_call_graph(
+                    conn,
+                    &self.project_id,
+                    self.ref_or_default(&ref_name),
+                    &request,
+                )
+                .map_err(|e| match e {
+                    CallGraphError::SymbolNotFound => format!("symbol `{symbol}` not found"),
+                    other => other.to_string(),
+                })?;
+                serde_json::to_value(graph)
+            }
+            BatchQuery::Describe {
+                symbol,
+                path,
+                history,
+                ref_name,
+            } => {
+                let card = describe::describe_symbol(
+                    conn,
+                    &self.workspace,
+                    &self.project_id,
+                    self.ref_or_default(&ref_name),
+                    &symbol,
+                    path.as_deref(),
+                    history.unwrap_or(DEFAULT_HISTORY),
+                )
+                .map_err(|e| match e {
+                    DescribeError::SymbolNotFound => format!("symbol `{symbol}` not found"),
+                    DescribeError::Ambiguous { candidates } => format!(
+                        "`{symbol}` is ambiguous; pass a qualified name or `path`: {}",
+                        candidates.join("; ")
+                    ),
+                    other => other.to_string(),
+                })?;
+                serde_json::to_value(card)
+            }
+        };
+        result.map_err(|e| e.to_string())
+    }
+}
+
+fn failure(id: Value, message: String) -> Value {
+    json!({ "id": id, "ok": false, "error": message })
+}
+
+/// Answer every non-blank line of `input` on `output`, flushing after each
+/// response so a caller can interleave requests and reads.
+pub fn run_batch<R: BufRead, W: Write>(
+    session: &BatchSession,
+    input: R,
+    mut output: W,
+) -> io::Result<BatchSummary> {
+    let mut summary = BatchSummary::default();
+    for line in input.lines() {
+        let line = line?;
+        if line.trim().is_empty() {
+            continue;
+        }
+        let response = session.handle_line(&line);
+        summary.requests += 1;
+        if response["ok"] != Value::Bool(true) {
+            summary.errors += 1;
+        }
+        serde_json::to_writer(&mut output, &response)?;
+        output.write_all(b"\n")?;
+        output.flush()?;
+    }
+    Ok(summary)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema, symbols};
+
+    fn session(workspace: &Path) -> BatchSession {
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        symbols::insert_symbol(
+            &conn,
+            &SymbolRecord {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                commit: None,
+                path: "src/pool.rs".to_string(),
+                language: "rust".to_string(),
+                symbol_id: "sym::Pool".to_string(),
+                symbol_stable_id: "stable::Pool".to_string(),
+                name: "Pool".to_string(),
+                qualified_name: "crate::Pool".to_string(),
+                kind: SymbolKind::Struct,
+                signature: Some("pub struct Pool".to_string()),
+                line_start: 1,
+                line_end: 3,
+                parent_symbol_id: None,
+                visibility: Some("pub".to_string()),
+                content: None,
+            },
+        )
+        .unwrap();
+        BatchSession {
+            workspace: workspace.to_path_buf(),
+            project_id: "repo".to_string(),
+            ref_name: "main".to_string(),
+            conn,
+            index_set: None,
+        }
+    }
+
+    #[test]
+    fn answers_each_line_and_keeps_going_after_errors() {
+        let tmp = tempfile::tempdir().unwrap();
+        let session = session(tmp.path());
+        let input = concat!(
+            "{\"id\": 1, \"op\": \"describe\", \"symbol\": \"Pool\", \"history\": 0}\n",
+            "\n",
+            "not json\n",
+            "{\"id\": \"b\", \"op\": \"teleport\"}\n",
+            "{\"id\": 3, \"op\": \"search\", \"q\": \"pool\"}\n",
+            "{\"id\": 4, \"op\": \"describe\", \"symbol\": \"Missing\"}\n",
+        );
+        let mut output = Vec::new();
+        let summary = run_batch(&session, input.as_bytes(), &mut output).unwrap();
+        assert_eq!(
+            summary,
+            BatchSummary {
+                requests: 5,
+                errors: 4
+            }
+        );
+
+        let responses: Vec<Value> = String::from_utf8(output)
+            .unwrap()
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect();
+        assert_eq!(responses[0]["id"], 1);
+        assert_eq!(responses[0]["ok"], true);
+        assert_eq!(responses[0]["result"]["qualified_name"], "crate::Pool");
+        assert_eq!(responses[1]["id"], Value::Null);
+        assert!(
+            responses[1]["error"]
+                .as_str()
+                .unwrap()
+                .starts_with("invalid JSON")
+        );
+        assert_eq!(responses[2]["id"], "b");
+        assert!(responses[2]["error"].as_str().unwrap().contains("teleport"));
+        assert!(
+            responses[3]["error"]
+                .as_str()
+                .unwrap()
+                .contains("cruxe index")
+        );
+        assert_eq!(responses[4]["error"], "symbol `Missing` not found");
+    }
+}
@@ -0,0 +1,486 @@
+//! `cruxe daemon`: keep a workspace index hot and answer queries over a local
+//! socket.
+//!
+//! A watcher thread polls the workspace with the indexer's scan rules and
+//! fingerprints every indexable file by size and mtime. When the fingerprint
+//! changes and then stays put for one poll interval (so a burst of saves or a
+//! checkout triggers one run), it runs an incremental `cruxe index`; unchanged
+//! files are skipped by their manifest size/mtime, so a sync after an edit
+//! touches only the edited files.
+//!
+//! Other refs can be kept indexed alongside the checked-out one: those named
+//! with `--ref` and, with `--worktrees`, the branches of linked worktrees.
+//! Each is re-indexed from the object database when its tip moves, and the
+//! blob cache lets it reuse the extraction of every file it shares with a
+//! ref already indexed. Queries pick one with their `ref` argument.
+//!
+//! Clients connect to a Unix domain socket and speak the same newline-delimited
+//! JSON-RPC as the stdio MCP transport, one response line per request line.
+//! Indices and the state DB stay open and prewarmed between requests, which
+//! avoids the process start-up and cold index cost of one-shot CLI calls.
+//!
+//! With a metrics address, Prometheus metrics (update and query latency,
+//! index size) are also served over TCP on `GET /metrics`.
+
+use crate::http::HttpState;
+use crate::index_launcher::{IndexLaunchRequest, generate_job_id, spawn_index_process};
+use crate::notifications::{NullProgressNotifier, ProgressNotifier};
+use crate::protocol::{JsonRpcRequest, JsonRpcResponse};
+use cruxe_core::config::Config;
+use cruxe_core::types::{SymlinkPolicy, WorkspaceConfig};
+use cruxe_indexer::scanner;
+use std::collections::HashMap;
+use std::collections::hash_map::DefaultHasher;
+use std::hash::{Hash, Hasher};
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::{Duration, Instant, UNIX_EPOCH};
+use tracing::{info, warn};
+
+/// File name of the default socket, inside the project data directory.
+pub const DAEMON_SOCKET_FILE: &str = "daemon.sock";
+
+pub const DEFAULT_POLL_INTERVAL: Duration = Duration::from_millis(500);
+
+#[derive(Debug, Clone)]
+pub struct DaemonOptions {
+    /// Socket path; defaults to [`DAEMON_SOCKET_FILE`] in the project data dir.
+    pub socket_path: Option<PathBuf>,
+    pub poll_interval: Duration,
+    pub no_prewarm: bool,
+    /// `host:port` to serve `/metrics` on; none by default.
+    pub metrics_addr: Option<String>,
+    /// Refs to keep indexed besides the checked-out one.
+    pub refs: Vec<String>,
+    /// Also keep the branches checked out in linked worktrees indexed.
+    pub worktrees: bool,
+}
+
+impl Default for DaemonOptions {
+    fn default() -> Self {
+        Self {
+            socket_path: None,
+            poll_interval: DEFAULT_POLL_INTERVAL,
+            no_prewarm: false,
+            metrics_addr: None,
+            refs: Vec::new(),
+            worktrees: false,
+        }
+    }
+}
+
+/// Default socket path for a workspace.
+pub fn default_socket_path(config: &Config, workspace: &Path) -> PathBuf {
+    let project_id = cruxe_core::types::generate_project_id(&workspace.to_string_lossy());
+    config
+        .project_data_dir(&project_id)
+        .join(DAEMON_SOCKET_FILE)
+}
+
+/// Run the daemon until the process is terminated.
+#[cfg(unix)]
+pub fn run_daemon(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    options: DaemonOptions,
+) -> Result<(), Box<dyn std::error::Error>> {
+    use std::os::unix::net::{UnixListener, UnixStream};
+
+    let config = Config::load_with_file(Some(workspace), config_file)?;
+    let socket_path = options
+        .socket_path
+        .clone()
+        .unwrap_or_else(|| default_socket_path(&config, workspace));
+    if socket_path.exists() {
+        if UnixStream::connect(&socket_path).is_ok() {
+            return Err(
+                format!("a daemon is already listening on {}", socket_path.display()).into(),
+            );
+        }
+        // Left behind by a daemon that did not shut down cleanly.
+        std::fs::remove_file(&socket_path)?;
+    }
+    if let Some(parent) = socket_path.parent() {
+        std::fs::create_dir_all(parent)?;
+    }
+
+    let audit = cruxe_core::audit::AuditLog::from_config(&config)?.map(Arc::new);
+    let state = Arc::new(crate::http::open_http_state(
+        workspace,
+        config,
+        options.no_prewarm,
+        WorkspaceConfig::default(),
+        crate::server::ConnectionManager::new(),
+        audit,
+    )?);
+
+    spawn_watcher(
+        workspace,
+        config_file,
+        &state.config,
+        options.poll_interval,
+        &options.refs,
+        options.worktrees,
+    );
+    if let Some(addr) = &options.metrics_addr {
+        spawn_metrics_server(addr, Arc::clone(&state))?;
+    }
+
+    let listener = UnixListener::bind(&socket_path)?;
+    info!(socket = %socket_path.display(), "cruxe daemon listening");
+    for (connection_id, stream) in listener.incoming().enumerate() {
+        let stream = match stream {
+            Ok(stream) => stream,
+            Err(e) => {
+                warn!("daemon accept failed: {}", e);
+                continue;
+            }
+        };
+        let state = Arc::clone(&state);
+        std::thread::spawn(move || {
+            let scope = format!("socket-{connection_id}");
+            let reader = match stream.try_clone() {
+                Ok(reader) => reader,
+                Err(e) => {
+                    warn!("daemon connection setup failed: {}", e);
+                    return;
+                }
+            };
+            if let Err(e) = serve_connection(&state, &scope, reader, stream) {
+                warn!(session = %scope, "daemon connection closed: {}", e);
+            }
+        });
+    }
+    Ok(())
+}
+
+#[cfg(not(unix))]
+pub fn run_daemon(
+    _workspace: &Path,
+    _config_file: Option<&Path>,
+    _options: DaemonOptions,
+) -> Result<(), Box<dyn std::error::Error>> {
+    Err("cruxe daemon requires Unix domain sockets; use `cruxe serve-mcp --transport http`".into())
+}
+
+/// Serve `/metrics` on `addr` from a thread of its own; the socket loop
+/// stays synchronous. Binding happens before returning so a taken port
+/// fails start-up.
+#[cfg(unix)]
+fn spawn_metrics_server(
+    addr: &str,
+    state: Arc<HttpState>,
+) -> Result<(), Box<dyn std::error::Error>> {
+    let listener = std::net::TcpListener::bind(addr)?;
+    listener.set_nonblocking(true)?;
+    info!(addr, "cruxe daemon metrics listening");
+    std::thread::spawn(move || {
+        let runtime = match tokio::runtime::Builder::new_current_thread()
+            .enable_all()
+            .build()
+        {
+            Ok(runtime) => runtime,
+            Err(e) => {
+                warn!("failed to start metrics server: {}", e);
+                return;
+            }
+        };
+        runtime.block_on(async move {
+            let app = axum::Router::new()
+                .route(
+                    "/metrics",
+                    axum::routing::get(crate::metrics::metrics_handler),
+                )
+                .with_state(state);
+            let served = match tokio::net::TcpListener::from_std(listener) {
+                Ok(listener) => axum::serve(listener, app).await,
+                Err(e) => Err(e),
+            };
+            if let Err(e) = served {
+                warn!("metrics server stopped: {}", e);
+            }
+        });
+    });
+    Ok(())
+}
+
+/// Answer newline-delimited JSON-RPC requests until the client disconnects.
+fn serve_connection<R: std::io::Read, W: std::io::Write>(
+    state: &HttpState,
+    session_scope: &str,
+    reader: R,
+    mut writer: W,
+) -> std::io::Result<()> {
+    use std::io::BufRead;
+
+    for line in std::io::BufReader::new(reader).lines() {
+        let line = line?;
+        if line.trim().is_empty() {
+            continue;
+        }
+        let response = match serde_json::from_str::<JsonRpcRequest>(&line) {
+            Ok(request) => dispatch(state, &request, session_scope),
+            Err(e) => JsonRpcResponse::error(None, -32700, format!("Parse error: {}", e)),
+        };
+        let serialized = serde_json::to_string(&response)?;
+        writeln!(writer, "{}", serialized)?;
+        writer.flush()?;
+    }
+    Ok(())
+}
+
+fn dispatch(state: &HttpState, request: &JsonRpcRequest, session_scope: &str) -> JsonRpcResponse {
+    let runtime = crate::server::DispatchRuntime {
+        config: &state.config,
+        router: &state.router,
+        workspace: &state.workspace,
+        project_id: &state.project_id,
+        data_dir: &state.data_dir,
+        connection_manager: &state.connection_manager,
+        prewarm_status: &state.prewarm_status,
+        server_start: &state.server_start,
+    };
+    let transport = crate::server::TransportExecutionContext {
+        notifier: Arc::new(NullProgressNotifier) as Arc<dyn ProgressNotifier>,
+        progress_token: None,
+        session_scope: Some(session_scope),
+        transport_label: "socket",
+        log_workspace_resolution_failures: true,
+        log_degraded_sqlite_open: true,
+    };
+    crate::server::execute_transport_request(request, &runtime, &transport)
+}
+
+/// Start the watcher thread that keeps `workspace` indexed, along with
+/// `refs` and, with `worktrees`, the branches of linked worktrees; it runs
+/// until the process exits. Also used by `cruxe graph serve`.
+pub(crate) fn spawn_watcher(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    config: &Config,
+    poll_interval: Duration,
+    refs: &[String],
+    worktrees: bool,
+) {
+    let watcher = WatchLoop {
+        workspace: workspace.to_path_buf(),
+        config_file: config_file.map(Path::to_path_buf),
+        max_file_size: config.index.max_file_size,
+        languages: config.index.languages.clone(),
+        symlinks: config.index.symlink_policy(),
+        poll_interval,
+        refs: refs.to_vec(),
+        worktrees,
+    };
+    std::thread::spawn(move || watcher.run());
+}
+
+struct WatchLoop {
+    workspace: PathBuf,
+    config_file: Option<PathBuf>,
+    max_file_size: u64,
+    languages: Vec<String>,
+    symlinks: SymlinkPolicy,
+    poll_interval: Duration,
+    refs: Vec<String>,
+    worktrees: bool,
+}
+
+impl WatchLoop {
+    fn run(self) {
+        // Catch up with edits made while no daemon was running.
+        self.sync(None);
+        let mut tips = HashMap::new();
+        self.sync_refs(&mut tips);
+        let mut debounce = Debounce::new(self.fingerprint());
+        loop {
+            std::thread::sleep(self.poll_interval);
+            if debounce.observe(self.fingerprint(), Instant::now(), self.poll_interval) {
+                self.sync(None);
+            }
+            self.sync_refs(&mut tips);
+        }
+    }
+
+    fn fingerprint(&self) -> u64 {
+        workspace_fingerprint(
+            &self.workspace,
+            self.max_file_size,
+            &self.languages,
+            self.symlinks,
+        )
+    }
+
+    /// Refs kept indexed besides the checked-out branch, which the
+    /// working-tree sync already covers.
+    fn extra_refs(&self) -> Vec<String> {
+        let mut refs = self.refs.clone();
+        if self.worktrees {
+            refs.extend(cruxe_vcs::linked_worktree_branches(&self.workspace));
+        }
+        let current = cruxe_core::vcs::detect_head_branch(&self.workspace).ok();
+        refs.retain(|ref_name| Some(ref_name) != current.as_ref());
+        refs.sort();
+        refs.dedup();
+        refs
+    }
+
+    /// Index every extra ref whose tip moved since it was last indexed. A
+    /// failed run is retried once the tip moves again.
+    fn sync_refs(&self, tips: &mut HashMap<String, String>) {
+        for ref_name in self.extra_refs() {
+            let Some(tip) = cruxe_vcs::history::commit_of(&self.workspace, &ref_name) else {
+                continue;
+            };
+            if tips.get(&ref_name) == Some(&tip) {
+                continue;
+            }
+            self.sync(Some(&ref_name));
+            tips.insert(ref_name, tip);
+        }
+    }
+
+    /// Run an incremental `cruxe index` of the working tree, or of `ref_name`
+    /// as committed.
+    fn sync(&self, ref_name: Option<&str>) {
+        let started = Instant::now();
+        let job_id = generate_job_id();
+        let request = IndexLaunchRequest {
+            workspace: &self.workspace,
+            force: false,
+            ref_name,
+            config_path: self.config_file.as_deref(),
+            project_id: None,
+            storage_data_dir: None,
+            job_id: Some(&job_id),
+        };
+        let outcome = spawn_index_process(&request).and_then(|mut child| child.wait());
+        cruxe_core::metrics::observe_sync(
+            started.elapsed(),
+            outcome.as_ref().is_ok_and(|status| status.success()),
+        );
+        match outcome {
+            Ok(status) if status.success() => {
+                info!(
+                    ref_name,
+                    elapsed_ms = started.elapsed().as_millis() as u64,
+                    "daemon sync complete"
+                );
+            }
+            Ok(status) => warn!(ref_name, %status, "daemon sync failed"),
+            Err(e) => warn!(ref_name, "failed to run daemon sync: {}", e),
+        }
+    }
+}
+
+/// Waits for the workspace to settle after a change before asking for a sync.
+/// Also used by `cruxe watch`.
+pub struct Debounce {
+    synced: u64,
+    pending: Option<(u64, Instant)>,
+}
+
+impl Debounce {
+    pub fn new(synced: u64) -> Self {
+        Self {
+            synced,
+            pending: None,
+        }
+    }
+
+    /// Record the latest fingerprint. Returns true once a changed fingerprint
+    /// has been stable for `quiet`; the caller should then sync.
+    pub fn observe(&mut self, fingerprint: u64, now: Instant, quiet: Duration) -> bool {
+        match self.pending {
+            _ if fingerprint == self.synced => {
+                self.pending = None;
+                false
+            }
+            Some((pending, since)) if pending == fingerprint => {
+                if now.duration_since(since) < quiet {
+                    return false;
+                }
+                self.synced = fingerprint;
+                self.pending = None;
+                true
+            }
+            _ => {
+                self.pending = Some((fingerprint, now));
+                false
+            }
+        }
+    }
+}
+
+/// Hash of the path, size and mtime of every indexable file.
+pub fn workspace_fingerprint(
+    workspace: &Path,
+    max_file_size: u64,
+    languages: &[String],
+    symlinks: SymlinkPolicy,
+) -> u64 {
+    let mut files = scanner::scan_directory_with_ignores(
+        workspace,
+        max_file_size,
+        languages,
+        true,
+        symlinks,
+        &mut Vec::new(),
+    );
+    files.sort_by(|a, b| a.relative_path.cmp(&b.relative_path));
+    let mut hasher = DefaultHasher::new();
+    for file in files {
+        file.relative_path.hash(&mut hasher);
+        if let Ok(metadata) = std::fs::metadata(&file.path) {
+            metadata.len().hash(&mut hasher);
+            metadata
+                .modified()
+                .ok()
+                .and_then(|mtime| mtime.duration_since(UNIX_EPOCH).ok())
+                .map(|mtime| mtime.as_nanos())
+                .hash(&mut hasher);
+        }
+    }
+    hasher.finish()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn debounce_waits_for_a_quiet_period() {
+        let quiet = Duration::from_millis(500);
+        let start = Instant::now();
+        let mut debounce = Debounce::new(1);
+
+        assert!(!debounce.observe(1, start, quiet));
+        assert!(!debounce.observe(2, start, quiet));
+        // Still changing: the quiet period restarts.
+        assert!(!debounce.observe(3, start + quiet, quiet));
+        assert!(!debounce.observe(3, start + quiet + quiet / 2, quiet));
+        assert!(debounce.observe(3, start + quiet * 2, quiet));
+        // Synced; no further work until the next change.
+        assert!(!debounce.observe(3, start + quiet * 3, quiet));
+        // A change that is reverted before it settles needs no sync.
+        assert!(!debounce.observe(4, start + quiet * 4, quiet));
+        assert!(!debounce.observe(3, start + quiet * 5, quiet));
+        assert!(!debounce.observe(3, start + quiet * 6, quiet));
+    }
+
+    #[test]
+    fn fingerprint_tracks_indexable_files_only() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::write(dir.path().join("lib.rs"), "pub fn a() {}\n").unwrap();
+        let fingerprint =
+            || workspace_fingerprint(dir.path(), 1 << 20, &[], SymlinkPolicy::default());
+        let before = fingerprint();
+        assert_eq!(before, fingerprint());
+
+        std::fs::write(dir.path().join("notes.bin"), [0u8, 1, 2]).unwrap();
+        assert_eq!(before, fingerprint());
+
+        std::fs::write(dir.path().join("lib.rs"), "pub fn a() { b() }\n").unwrap();
+        assert_ne!(before, fingerprint());
+    }
+}
@@ -0,0 +1,513 @@
+//! `cruxe editor`: a JSON-RPC protocol on stdin/stdout for editor plugins
+//! that want more than LSP can carry — call graphs, hierarchies, context
+//! packs and whole-ref analyses — with results as plain JSON a custom panel
+//! can render.
+//!
+//! Messages use LSP's `Content-Length` framing, so the JSON-RPC client of
+//! any LSP library (`vscode-jsonrpc`, LSP4J) can speak it unchanged.
+//!
+//! Methods:
+//!
+//! - `initialize` — `{protocolVersion, serverInfo, ref, methods}`, where
+//!   `methods` lists every method below with a description and the JSON
+//!   Schema of its params
+//! - `cruxe/<tool>` — one method per MCP tool (`cruxe/search_code`,
+//!   `cruxe/get_call_graph`, `cruxe/build_context_pack`, ...); params are
+//!   the tool's arguments and the result is the tool's JSON payload, not
+//!   wrapped in MCP text content. `ref` defaults to the session ref.
+//! - `cruxe/findings` — `cruxe check` findings, filtered by `rule`, minimum
+//!   `severity` and `path` prefix, at most `limit`
+//! - `cruxe/deadCode` — `cruxe deadcode` candidates, with `allow` globs and
+//!   `include_exported` and `unused_exports` added to the `[deadcode]` config;
+//!   `include_generated` reports symbols of generated files too
+//! - `shutdown` and the `exit` notification, as in LSP
+//!
+//! A tool that answers with an error payload becomes a JSON-RPC error with
+//! code [`TOOL_ERROR`]; its `data` carries the tool's error `code`, `data`
+//! and response `metadata`.
+
+use crate::http::HttpState;
+use crate::lsp::{read_message, write_message};
+use crate::notifications::{NullProgressNotifier, ProgressNotifier};
+use crate::protocol::{JsonRpcError, JsonRpcRequest, JsonRpcResponse};
+use crate::tools::{self, ToolDefinition};
+use cruxe_core::config::Config;
+use cruxe_core::types::WorkspaceConfig;
+use cruxe_query::deadcode::{self, DeadCodeOptions};
+use cruxe_query::findings::{self, Profile, RuleSet, Severity};
+use rusqlite::Connection;
+use serde::Deserialize;
+use serde::de::DeserializeOwned;
+use serde_json::{Value, json};
+use std::io::{self, BufRead, Write};
+use std::path::Path;
+use std::sync::Arc;
+
+/// Version of the method set and result shapes; bumped on breaking changes.
+pub const EDITOR_PROTOCOL_VERSION: &str = "1";
+
+/// Prefix of every cruxe method.
+const METHOD_PREFIX: &str = "cruxe/";
+
+const DEFAULT_FINDINGS_LIMIT: usize = 200;
+
+const PARSE_ERROR: i32 = -32700;
+const INVALID_REQUEST: i32 = -32600;
+const METHOD_NOT_FOUND: i32 = -32601;
+const INVALID_PARAMS: i32 = -32602;
+const INTERNAL_ERROR: i32 = -32603;
+/// A tool answered with an error payload, e.g. an unknown symbol.
+pub const TOOL_ERROR: i32 = -32000;
+
+pub struct EditorSession {
+    state: HttpState,
+    ref_name: String,
+    tools: Vec<ToolDefinition>,
+}
+
+#[derive(Debug, Deserialize)]
+struct FindingsParams {
+    rule: Option<String>,
+    severity: Option<String>,
+    path: Option<String>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct DeadCodeParams {
+    #[serde(default)]
+    allow: Vec<String>,
+    #[serde(default)]
+    include_exported: bool,
+    #[serde(default)]
+    unused_exports: bool,
+    #[serde(default)]
+    include_generated: bool,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+impl EditorSession {
+    /// Open the index of `workspace`; `ref_name` is the default ref of every
+    /// method that takes one.
+    pub fn open(
+        workspace: &Path,
+        config_file: Option<&Path>,
+        ref_name: &str,
+    ) -> Result<Self, Box<dyn std::error::Error>> {
+        let config = Config::load_with_file(Some(workspace), config_file)?;
+        let state = crate::http::open_http_state(
+            workspace,
+            config,
+            false,
+            WorkspaceConfig::default(),
+            crate::server::ConnectionManager::new(),
+            None,
+        )?;
+        Ok(Self {
+            state,
+            ref_name: ref_name.to_string(),
+            tools: tools::list_tools(),
+        })
+    }
+
+    /// Answer one request; `None` for notifications.
+    pub fn handle(&self, request: &JsonRpcRequest) -> Option<JsonRpcResponse> {
+        let id = request.id.clone()?;
+        let result = match request.method.as_str() {
+            "initialize" => Ok(self.initialize()),
+            "shutdown" => Ok(Value::Null),
+            "cruxe/findings" => params(&request.params).and_then(|p| self.findings(p)),
+            "cruxe/deadCode" => params(&request.params).and_then(|p| self.dead_code(p)),
+            method => match method
+                .strip_prefix(METHOD_PREFIX)
+                .and_then(|name| self.tools.iter().find(|tool| tool.name == name))
+            {
+                Some(tool) => self.call_tool(tool, &request.params),
+                None => Err(error(
+                    METHOD_NOT_FOUND,
+                    format!("unknown method `{method}`"),
+                )),
+            },
+        };
+        Some(match result {
+            Ok(value) => JsonRpcResponse::success(Some(id), value),
+            Err(error) => JsonRpcResponse {
+                jsonrpc: "2.0".into(),
+                id: Some(id),
+                result: None,
+                error: Some(error),
+            },
+        })
+    }
+
+    fn initialize(&self) -> Value {
+        let mut methods: Vec<Value> = self
+            .tools
+            .iter()
+            .map(|tool| {
+                json!({
+                    "name": format!("{METHOD_PREFIX}{}", tool.name),
+                    "description": tool.description,
+                    "paramsSchema": tool.input_schema,
+                })
+            })
+            .collect();
+        methods.push(json!({
+            "name": "cruxe/findings",
+            "description": "Findings of the configured `cruxe check` rules.",
+            "paramsSchema": {
+                "type": "object",
+                "properties": {
+                    "rule": {"type": "string"},
+                    "severity": {"type": "string", "enum": ["info", "warning", "error"]},
+                    "path": {"type": "string", "description": "Path prefix"},
+                    "limit": {"type": "integer", "minimum": 1},
+                    "ref": {"type": "string"}
+                }
+            },
+        }));
+        methods.push(json!({
+            "name": "cruxe/deadCode",
+            "description": "Symbols unreachable from any entry point, or never referenced.",
+            "paramsSchema": {
+                "type": "object",
+                "properties": {
+                    "allow": {"type": "array", "items": {"type": "string"}},
+                    "include_exported": {"type": "boolean"},
+                    "unused_exports": {"type": "boolean"},
+                    "include_generated": {"type": "boolean"},
+                    "ref": {"type": "string"}
+                }
+            },
+        }));
+        json!({
+            "protocolVersion": EDITOR_PROTOCOL_VERSION,
+            "serverInfo": {
+                "name": "cruxe",
+                "version": env!("CARGO_PKG_VERSION"),
+            },
+            "ref": self.ref_name,
+            "methods": methods,
+        })
+    }
+
+    fn call_tool(&self, tool: &ToolDefinition, arguments: &Value) -> Result<Value, JsonRpcError> {
+        let mut arguments = match arguments {
+            Value::Null => json!({}),
+            Value::Object(_) => arguments.clone(),
+            _ => return Err(error(INVALID_PARAMS, "params must be an object")),
+        };
+        if tool.input_schema["properties"].get("ref").is_some() && arguments.get("ref").is_none() {
+            arguments["ref"] = json!(self.ref_name);
+        }
+        let request = JsonRpcRequest {
+            jsonrpc: "2.0".into(),
+            id: Some(json!(0)),
+            method: "tools/call".into(),
+            params: json!({"name": tool.name, "arguments": arguments}),
+        };
+        let state = &self.state;
+        let runtime = crate::server::DispatchRuntime {
+            config: &state.config,
+            router: &state.router,
+            workspace: &state.workspace,
+            project_id: &state.project_id,
+            data_dir: &state.data_dir,
+            connection_manager: &state.connection_manager,
+            prewarm_status: &state.prewarm_status,
+            server_start: &state.server_start,
+        };
+        let transport = crate::server::TransportExecutionContext {
+            notifier: Arc::new(NullProgressNotifier) as Arc<dyn ProgressNotifier>,
+            progress_token: None,
+            session_scope: Some("editor"),
+            transport_label: "editor",
+            log_workspace_resolution_failures: true,
+            log_degraded_sqlite_open: true,
+        };
+        let response = crate::server::execute_transport_request(&request, &runtime, &transport);
+        if let Some(error) = response.error {
+            return Err(error);
+        }
+        unwrap_tool_payload(response.result.unwrap_or(Value::Null))
+    }
+
+    fn findings(&self, params: FindingsParams) -> Result<Value, JsonRpcError> {
+        let min_severity = match params.severity.as_deref() {
+            Some(raw) => Severity::parse(raw).ok_or_else(|| {
+                error(
+                    INVALID_PARAMS,
+                    format!("unknown severity `{raw}` (expected info, warning or error)"),
+                )
+            })?,
+            None => Severity::Info,
+        };
+        let profile = self
+            .state
+            .config
+            .check
+            .profile
+            .as_deref()
+            .and_then(Profile::parse)
+            .unwrap_or_default();
+        let ref_name = params.ref_name.as_deref().unwrap_or(&self.ref_name);
+        let rule_set = RuleSet::from_config(&self.state.config.rules, profile)
+            .with_taint(&self.state.config.taint);
+        let mut found = self.with_conn(|conn| {
+            findings::run_checks(conn, &self.state.project_id, ref_name, &rule_set)
+                .map_err(|e| error(INTERNAL_ERROR, e.to_string()))
+        })?;
+        found.retain(|finding| {
+            finding.severity >= min_severity
+                && params
+                    .rule
+                    .as_deref()
+                    .is_none_or(|rule| finding.rule == rule)
+                && params
+                    .path
+                    .as_deref()
+                    .is_none_or(|prefix| finding.path.starts_with(prefix))
+        });
+        let total = found.len();
+        found.truncate(params.limit.unwrap_or(DEFAULT_FINDINGS_LIMIT).max(1));
+        Ok(json!({
+            "ref": ref_name,
+            "total": total,
+            "findings": found,
+        }))
+    }
+
+    fn dead_code(&self, params: DeadCodeParams) -> Result<Value, JsonRpcError> {
+        let config = &self.state.config.deadcode;
+        let options = DeadCodeOptions {
+            include_exported: params.include_exported || config.include_exported,
+            allow: config.allow.iter().chain(&params.allow).cloned().collect(),
+            unused_exports: params.unused_exports || config.unused_exports,
+            include_generated: params.include_generated,
+            ..DeadCodeOptions::default()
+        };
+        let ref_name = params.ref_name.as_deref().unwrap_or(&self.ref_name);
+        let report = self.with_conn(|conn| {
+            deadcode::find_dead_code(
+                conn,
+                &self.state.workspace,
+                &self.state.project_id,
+                ref_name,
+                &options,
+            )
+            .map_err(|e| match e {
+                deadcode::DeadCodeError::InvalidPattern(_) => error(INVALID_PARAMS, e.to_string()),
+                deadcode::DeadCodeError::State(_) => error(INTERNAL_ERROR, e.to_string()),
+            })
+        })?;
+        let mut result = json!(report);
+        result["ref"] = json!(ref_name);
+        Ok(result)
+    }
+
+    fn with_conn<T>(
+        &self,
+        f: impl FnOnce(&Connection) -> Result<T, JsonRpcError>,
+    ) -> Result<T, JsonRpcError> {
+        let handle = self
+            .state
+            .connection_manager
+            .get_or_open(&self.state.db_path)
+            .map_err(|e| {
+                error(
+                    INTERNAL_ERROR,
+                    format!("failed to open state DB: {e}. Run `cruxe index` first."),
+                )
+            })?;
+        let conn = handle
+            .lock()
+            .map_err(|e| error(INTERNAL_ERROR, e.to_string()))?;
+        f(&conn)
+    }
+}
+
+/// The JSON inside an MCP tool result's text content; an `error` payload
+/// becomes a [`TOOL_ERROR`].
+fn unwrap_tool_payload(result: Value) -> Result<Value, JsonRpcError> {
+    let payload = result["content"][0]["text"]
+        .as_str()
+        .and_then(|text| serde_json::from_str::<Value>(text).ok())
+        .ok_or_else(|| error(INTERNAL_ERROR, "tool returned no JSON content"))?;
+    match payload.get("error") {
+        Some(tool_error) => Err(JsonRpcError {
+            code: TOOL_ERROR,
+            message: tool_error["message"]
+                .as_str()
+                .unwrap_or("tool failed")
+                .to_string(),
+            data: Some(json!({
+                "code": tool_error["code"],
+                "data": tool_error.get("data"),
+                "metadata": payload.get("metadata"),
+            })),
+        }),
+        None => Ok(payload),
+    }
+}
+
+fn params<T: DeserializeOwned>(params: &Value) -> Result<T, JsonRpcError> {
+    let params = match params {
+        Value::Null => json!({}),
+        other => other.clone(),
+    };
+    serde_json::from_value(params).map_err(|e| error(INVALID_PARAMS, e.to_string()))
+}
+
+fn error(code: i32, message: impl Into<String>) -> JsonRpcError {
+    JsonRpcError {
+        code,
+        message: message.into(),
+        data: None,
+    }
+}
+
+/// Serve `input` until an `exit` notification or end of input. Returns
+/// whether the client sent `shutdown` first.
+pub fn run_editor<R: BufRead, W: Write>(
+    session: &EditorSession,
+    mut input: R,
+    mut output: W,
+) -> io::Result<bool> {
+    let mut shut_down = false;
+    while let Some(body) = read_message(&mut input)? {
+        let request: JsonRpcRequest = match serde_json::from_slice(&body) {
+            Ok(request) => request,
+            Err(e) => {
+                let response =
+                    JsonRpcResponse::error(None, PARSE_ERROR, format!("Parse error: {e}"));
+                write_message(&mut output, &response)?;
+                continue;
+            }
+        };
+        if request.method == "exit" {
+            return Ok(shut_down);
+        }
+        let response = if shut_down {
+            request.id.clone().map(|id| {
+                JsonRpcResponse::error(
+                    Some(id),
+                    INVALID_REQUEST,
+                    "server is shutting down".to_string(),
+                )
+            })
+        } else {
+            session.handle(&request)
+        };
+        shut_down |= request.method == "shutdown";
+        if let Some(response) = response {
+            write_message(&mut output, &response)?;
+        }
+    }
+    Ok(shut_down)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn session(workspace: &Path, storage: &Path) -> EditorSession {
+        let mut config = Config::default();
+        config.storage.data_dir = storage.to_string_lossy().to_string();
+        let state = crate::http::open_http_state(
+            workspace,
+            config,
+            true,
+            WorkspaceConfig::default(),
+            crate::server::ConnectionManager::new(),
+            None,
+        )
+        .unwrap();
+        EditorSession {
+            state,
+            ref_name: "main".to_string(),
+            tools: tools::list_tools(),
+        }
+    }
+
+    fn request(id: i64, method: &str, params: Value) -> JsonRpcRequest {
+        serde_json::from_value(json!({
+            "jsonrpc": "2.0",
+            "id": id,
+            "method": method,
+            "params": params,
+        }))
+        .unwrap()
+    }
+
+    #[test]
+    fn initialize_lists_every_tool_and_analysis() {
+        let workspace = tempfile::tempdir().unwrap();
+        let storage = tempfile::tempdir().unwrap();
+        let session = session(workspace.path(), storage.path());
+        let response = session
+            .handle(&request(1, "initialize", Value::Null))
+            .unwrap();
+        let result = response.result.unwrap();
+        assert_eq!(result["protocolVersion"], EDITOR_PROTOCOL_VERSION);
+        assert_eq!(result["ref"], "main");
+        let names: Vec<&str> = result["methods"]
+            .as_array()
+            .unwrap()
+            .iter()
+            .map(|method| method["name"].as_str().unwrap())
+            .collect();
+        for expected in [
+            "cruxe/search_code",
+            "cruxe/get_call_graph",
+            "cruxe/build_context_pack",
+            "cruxe/findings",
+            "cruxe/deadCode",
+        ] {
+            assert!(names.contains(&expected), "missing {expected} in {names:?}");
+        }
+        assert_eq!(names.len(), tools::list_tools().len() + 2);
+    }
+
+    #[test]
+    fn unknown_methods_and_bad_params_are_rejected() {
+        let workspace = tempfile::tempdir().unwrap();
+        let storage = tempfile::tempdir().unwrap();
+        let session = session(workspace.path(), storage.path());
+        let response = session
+            .handle(&request(1, "cruxe/nope", Value::Null))
+            .unwrap();
+        assert_eq!(response.error.unwrap().code, METHOD_NOT_FOUND);
+        let response = session
+            .handle(&request(2, "cruxe/findings", json!({"severity": "loud"})))
+            .unwrap();
+        assert_eq!(response.error.unwrap().code, INVALID_PARAMS);
+        assert!(
+            session
+                .handle(
+                    &serde_json::from_value(json!({"jsonrpc": "2.0", "method": "initialized"}))
+                        .unwrap()
+                )
+                .is_none()
+        );
+    }
+
+    #[test]
+    fn tool_payloads_are_unwrapped_and_errors_mapped() {
+        let ok = json!({"content": [{"type": "text", "text": "{\"results\":[]}"}]});
+        assert_eq!(unwrap_tool_payload(ok).unwrap(), json!({"results": []}));
+
+        let failed = json!({"content": [{"type": "text", "text": serde_json::to_string(&json!({
+            "error": {"code": "symbol_not_found", "message": "no symbol `Foo`"},
+            "metadata": {"ref": "main"},
+        })).unwrap()}]});
+        let error = unwrap_tool_payload(failed).unwrap_err();
+        assert_eq!(error.code, TOOL_ERROR);
+        assert_eq!(error.message, "no symbol `Foo`");
+        let data = error.data.unwrap();
+        assert_eq!(data["code"], "symbol_not_found");
+        assert_eq!(data["metadata"]["ref"], "main");
+    }
+}
@@ -0,0 +1,248 @@
+//! `cruxe graph serve`: browse the symbol graph of one ref in a web page.
+//!
+//! Routes:
+//! - `GET /` — the viewer page
+//! - `GET /api/meta` — `{repo, ref, generation, nodes, edges}`
+//! - `GET /api/graph?filter=&limit=` — nodes matching a filter expression
+//!   (see [`cruxe_query::graph_view`]); `400` with `{error}` if it does not
+//!   parse
+//! - `GET /api/neighbors?id=&depth=&limit=` — neighborhood of a node
+//! - `GET /api/path?from=&to=` — shortest path between two nodes
+//!
+//! The graph is reloaded when `PRAGMA data_version` shows another connection
+//! committed, and `generation` counts those reloads so the page knows when to
+//! refresh. Unless disabled, the daemon's watcher runs alongside and
+//! re-indexes the workspace on edits, so the page follows the code as it
+//! changes.
+
+use axum::extract::{Query, State};
+use axum::http::StatusCode;
+use axum::response::{Html, IntoResponse, Response};
+use axum::routing::get;
+use axum::{Json, Router};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_core::types::generate_project_id;
+use cruxe_query::graph_export;
+use cruxe_query::graph_view::{GraphFilter, GraphView};
+use rusqlite::Connection;
+use serde::Deserialize;
+use serde_json::json;
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tracing::info;
+
+const PAGE: &str = include_str!("graph_serve.html");
+
+const DEFAULT_LIMIT: usize = 300;
+const MAX_LIMIT: usize = 5000;
+const MAX_DEPTH: usize = 4;
+
+#[derive(Debug, Clone)]
+pub struct GraphServeOptions {
+    pub ref_name: String,
+    pub bind_addr: String,
+    pub port: u16,
+    /// Re-index the workspace when files change.
+    pub watch: bool,
+    pub poll_interval: Duration,
+}
+
+/// Serve the viewer until the process is terminated.
+pub async fn run_graph_server(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    options: GraphServeOptions,
+) -> Result<(), Box<dyn std::error::Error>> {
+    let config = Config::load_with_file(Some(workspace), config_file)?;
+    let project_id = generate_project_id(&workspace.to_string_lossy());
+    let state = Arc::new(GraphState {
+        db_path: config
+            .project_data_dir(&project_id)
+            .join(constants::STATE_DB_FILE),
+        project_id,
+        ref_name: options.ref_name.clone(),
+        loaded: Mutex::new(Loaded::default()),
+    });
+    // Fail now rather than on the first page load.
+    state.view()?;
+
+    if options.watch {
+        crate::daemon::spawn_watcher(
+            workspace,
+            config_file,
+            &config,
+            options.poll_interval,
+            &[],
+            false,
+        );
+    }
+
+    let app = Router::new()
+        .route("/", get(page_handler))
+        .route("/api/meta", get(meta_handler))
+        .route("/api/graph", get(graph_handler))
+        .route("/api/neighbors", get(neighbors_handler))
+        .route("/api/path", get(path_handler))
+        .with_state(state);
+    let addr = format!("{}:{}", options.bind_addr, options.port);
+    info!("Graph viewer listening on http://{}", addr);
+    let listener = tokio::net::TcpListener::bind(&addr).await?;
+    axum::serve(listener, app).await?;
+    Ok(())
+}
+
+struct GraphState {
+    db_path: PathBuf,
+    project_id: String,
+    ref_name: String,
+    loaded: Mutex<Loaded>,
+}
+
+#[derive(Default)]
+struct Loaded {
+    conn: Option<Connection>,
+    data_version: i64,
+    generation: u64,
+    view: Option<Arc<GraphView>>,
+}
+
+impl GraphState {
+    /// The current graph and its generation, reloaded if the DB changed.
+    fn view(&self) -> Result<(Arc<GraphView>, u64), StateError> {
+        let mut loaded = self.loaded.lock().unwrap_or_else(|e| e.into_inner());
+        if loaded.conn.is_none() {
+            loaded.conn = Some(cruxe_state::db::open_connection(&self.db_path)?);
+        }
+        let conn = loaded.conn.as_ref().expect("connection opened above");
+        let version: i64 = conn
+            .query_row("PRAGMA data_version", [], |row| row.get(0))
+            .map_err(StateError::sqlite)?;
+        if let Some(view) = &loaded.view
+            && version == loaded.data_version
+        {
+            return Ok((Arc::clone(view), loaded.generation));
+        }
+        let snapshot = graph_export::load_graph_snapshot(conn, &self.project_id, &self.ref_name)?;
+        let view = Arc::new(GraphView::new(snapshot));
+        loaded.data_version = version;
+        loaded.generation += 1;
+        loaded.view = Some(Arc::clone(&view));
+        Ok((view, loaded.generation))
+    }
+}
+
+/// Run `query` on the current graph off the async runtime.
+async fn with_view<F>(state: Arc<GraphState>, query: F) -> Response
+where
+    F: FnOnce(&GraphView, u64) -> Response + Send + 'static,
+{
+    let joined = tokio::task::spawn_blocking(move || {
+        let (view, generation) = state.view()?;
+        Ok::<_, StateError>(query(&view, generation))
+    })
+    .await;
+    match joined {
+        Ok(Ok(response)) => response,
+        Ok(Err(err)) => error_response(StatusCode::INTERNAL_SERVER_ERROR, err.to_string()),
+        Err(err) => error_response(StatusCode::INTERNAL_SERVER_ERROR, err.to_string()),
+    }
+}
+
+fn error_response(status: StatusCode, message: String) -> Response {
+    (status, Json(json!({ "error": message }))).into_response()
+}
+
+async fn page_handler() -> Html<&'static str> {
+    Html(PAGE)
+}
+
+async fn meta_handler(State(state): State<Arc<GraphState>>) -> Response {
+    with_view(state, |view, generation| {
+        let snapshot = view.snapshot();
+        Json(json!({
+            "repo": snapshot.repo,
+            "ref": snapshot.ref_name,
+            "generation": generation,
+            "nodes": snapshot.nodes.len(),
+            "edges": snapshot.edges.len(),
+        }))
+        .into_response()
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct GraphParams {
+    #[serde(default)]
+    filter: String,
+    limit: Option<usize>,
+}
+
+async fn graph_handler(
+    State(state): State<Arc<GraphState>>,
+    Query(params): Query<GraphParams>,
+) -> Response {
+    let filter = match GraphFilter::parse(&params.filter) {
+        Ok(filter) => filter,
+        Err(err) => return error_response(StatusCode::BAD_REQUEST, err),
+    };
+    let limit = clamp_limit(params.limit);
+    with_view(state, move |view, _| {
+        Json(view.filter(&filter, limit)).into_response()
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct NeighborParams {
+    id: String,
+    depth: Option<usize>,
+    limit: Option<usize>,
+}
+
+async fn neighbors_handler(
+    State(state): State<Arc<GraphState>>,
+    Query(params): Query<NeighborParams>,
+) -> Response {
+    let depth = params.depth.unwrap_or(1).clamp(1, MAX_DEPTH);
+    let limit = clamp_limit(params.limit);
+    with_view(state, move |view, _| {
+        match view.neighborhood(&params.id, depth, limit) {
+            Some(subgraph) => Json(subgraph).into_response(),
+            None => error_response(
+                StatusCode::NOT_FOUND,
+                format!("no node with id `{}`", params.id),
+            ),
+        }
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct PathParams {
+    from: String,
+    to: String,
+}
+
+async fn path_handler(
+    State(state): State<Arc<GraphState>>,
+    Query(params): Query<PathParams>,
+) -> Response {
+    with_view(state, move |view, _| {
+        match view.path(&params.from, &params.to) {
+            Some(path) => Json(path).into_response(),
+            None => error_response(
+                StatusCode::NOT_FOUND,
+                format!("no path from `{}` to `{}`", params.from, params.to),
+            ),
+        }
+    })
+    .await
+}
+
+fn clamp_limit(limit: Option<usize>) -> usize {
+    limit.unwrap_or(DEFAULT_LIMIT).clamp(1, MAX_LIMIT)
+}
@@ -0,0 +1,999 @@
+//! The gRPC flavour of `cruxe serve --http`: the `cruxe.query.v1.CruxeQuery`
+//! service of `docs/reference/cruxe-query.proto`, on the REST API's port.
+//! Clients connect with plaintext HTTP/2 and generate typed stubs from the
+//! `.proto`.
+//!
+//! Every RPC is server-streaming: results are encoded one message at a time
+//! on a blocking task and flow to the client through a bounded channel, so
+//! every reference to a hot symbol or a whole subgraph never has to be
+//! buffered as one response. The status goes out in the trailers. Only
+//! uncompressed messages are accepted.
+//!
+//! RPCs pass the same [`ApiGuard`] as the REST routes: without a valid
+//! bearer token (when `[[server.api_keys]]` are configured) they fail with
+//! `UNAUTHENTICATED`, rate-limited clients get `RESOURCE_EXHAUSTED`, request
+//! paths outside the key's `read_prefixes` get `PERMISSION_DENIED`, and
+//! result messages naming such paths are withheld. Every call is audited.
+
+use crate::access::Grant;
+use crate::api_guard::ApiGuard;
+use crate::limits::Rejection;
+use crate::rest::{RestState, clamp_limit};
+use axum::body::{Body, Bytes};
+use axum::extract::{ConnectInfo, State};
+use axum::http::{HeaderMap, HeaderValue, StatusCode, header};
+use axum::response::{IntoResponse, Response};
+use axum::routing::{MethodRouter, post};
+use axum::{Extension, Router};
+use cruxe_core::error::{ProtocolErrorCode, StateError};
+use cruxe_query::call_graph::{
+    self, CallGraphDirection, CallGraphEdgeResult, CallGraphError, CallGraphSymbol,
+};
+use cruxe_query::find_references::{self, FindReferencesError, ReferenceSymbol};
+use cruxe_query::graph_export::protobuf::{ProtoReader, ProtoValue, ProtoWriter};
+use cruxe_query::graph_export::{self, GraphEdge, GraphNode};
+use cruxe_query::graph_view::{GraphFilter, GraphView};
+use cruxe_query::{locate, search};
+use http_body::Frame;
+use rusqlite::Connection;
+use serde::Serialize;
+use serde_json::Value;
+use std::collections::HashSet;
+use std::convert::Infallible;
+use std::io;
+use std::net::SocketAddr;
+use std::pin::Pin;
+use std::sync::Arc;
+use std::task::{Context, Poll};
+use std::time::Instant;
+use tokio::sync::mpsc;
+
+const SERVICE: &str = "/cruxe.query.v1.CruxeQuery";
+
+/// Encoded messages waiting for a slow client before the query pauses.
+const STREAM_BUFFER: usize = 64;
+
+const CODE_OK: u32 = 0;
+const CODE_CANCELLED: u32 = 1;
+const CODE_INVALID_ARGUMENT: u32 = 3;
+const CODE_NOT_FOUND: u32 = 5;
+const CODE_PERMISSION_DENIED: u32 = 7;
+const CODE_RESOURCE_EXHAUSTED: u32 = 8;
+const CODE_UNIMPLEMENTED: u32 = 12;
+const CODE_INTERNAL: u32 = 13;
+const CODE_UNAUTHENTICATED: u32 = 16;
+
+/// Runs one RPC: decodes the request message and sends the results.
+type Rpc = fn(&RestState, &Connection, &[u8], &mut Sink) -> Result<(), Status>;
+
+/// The service's methods and their handlers.
+const RPCS: [(&str, Rpc); 5] = [
+    ("Search", search_rpc),
+    ("FindDefinitions", definitions_rpc),
+    ("FindReferences", references_rpc),
+    ("CallGraph", call_graph_rpc),
+    ("Subgraph", subgraph_rpc),
+];
+
+/// The service's routes, sharing `state` and `guard` with the REST API.
+pub(crate) fn routes(state: Arc<RestState>, guard: Arc<ApiGuard>) -> Router {
+    RPCS.into_iter()
+        .fold(Router::new(), |router, (method, handler)| {
+            router.route(
+                &format!("{SERVICE}/{method}"),
+                rpc(method, handler, Arc::clone(&guard)),
+            )
+        })
+        .with_state(state)
+}
+
+fn rpc(method: &'static str, handler: Rpc, guard: Arc<ApiGuard>) -> MethodRouter<Arc<RestState>> {
+    post(
+        move |State(state): State<Arc<RestState>>,
+              connect_info: Option<Extension<ConnectInfo<SocketAddr>>>,
+              headers: HeaderMap,
+              body: Bytes| {
+            let call = Call {
+                method,
+                guard,
+                remote: connect_info.map(|Extension(ConnectInfo(addr))| addr),
+            };
+            respond(state, call, headers, body, handler)
+        },
+    )
+}
+
+/// One incoming RPC, before authentication.
+struct Call {
+    method: &'static str,
+    guard: Arc<ApiGuard>,
+    remote: Option<SocketAddr>,
+}
+
+/// A gRPC status, sent as the `grpc-status` and `grpc-message` trailers.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Status {
+    code: u32,
+    message: String,
+}
+
+impl Status {
+    fn new(code: u32, message: impl Into<String>) -> Self {
+        Self {
+            code,
+            message: message.into(),
+        }
+    }
+
+    fn ok() -> Self {
+        Self::new(CODE_OK, "")
+    }
+
+    fn invalid_argument(message: impl Into<String>) -> Self {
+        Self::new(CODE_INVALID_ARGUMENT, message)
+    }
+
+    fn not_found(message: impl Into<String>) -> Self {
+        Self::new(CODE_NOT_FOUND, message)
+    }
+
+    fn permission_denied(message: impl Into<String>) -> Self {
+        Self::new(CODE_PERMISSION_DENIED, message)
+    }
+
+    /// The audit log outcome for this status.
+    fn outcome(&self) -> &'static str {
+        match self.code {
+            CODE_OK => "ok",
+            CODE_CANCELLED => "cancelled",
+            CODE_INVALID_ARGUMENT | CODE_UNIMPLEMENTED => ProtocolErrorCode::InvalidInput.as_str(),
+            CODE_NOT_FOUND => ProtocolErrorCode::ResultNotFound.as_str(),
+            CODE_PERMISSION_DENIED => ProtocolErrorCode::Forbidden.as_str(),
+            _ => ProtocolErrorCode::InternalError.as_str(),
+        }
+    }
+
+    fn trailers(&self) -> HeaderMap {
+        let mut trailers = HeaderMap::new();
+        trailers.insert("grpc-status", HeaderValue::from(self.code));
+        if !self.message.is_empty()
+            && let Ok(message) = HeaderValue::from_str(&percent_encode(&self.message))
+        {
+            trailers.insert("grpc-message", message);
+        }
+        trailers
+    }
+}
+
+impl From<StateError> for Status {
+    fn from(err: StateError) -> Self {
+        Self::new(CODE_INTERNAL, err.to_string())
+    }
+}
+
+impl From<Rejection> for Status {
+    fn from(rejection: Rejection) -> Self {
+        let code = match rejection {
+            Rejection::Unauthorized => CODE_UNAUTHENTICATED,
+            _ => CODE_RESOURCE_EXHAUSTED,
+        };
+        Self::new(code, rejection.message())
+    }
+}
+
+impl From<io::Error> for Status {
+    fn from(err: io::Error) -> Self {
+        Self::invalid_argument(format!("malformed request message: {err}"))
+    }
+}
+
+/// `grpc-message` escaping: bytes outside printable ASCII, and `%`.
+fn percent_encode(message: &str) -> String {
+    let mut encoded = String::with_capacity(message.len());
+    for byte in message.bytes() {
+        if (0x20..0x7f).contains(&byte) && byte != b'%' {
+            encoded.push(byte as char);
+        } else {
+            encoded.push_str(&format!("%{byte:02X}"));
+        }
+    }
+    encoded
+}
+
+enum Chunk {
+    Message(Bytes),
+    Status(Status),
+}
+
+/// The sending half of a response stream, used from the blocking task.
+struct Sink {
+    sender: mpsc::Sender<Chunk>,
+    /// The caller's grant; `None` when no API keys are configured.
+    grant: Option<Arc<Grant>>,
+    /// The decoded request, for the audit log.
+    arguments: Value,
+    sent: u64,
+    sent_bytes: u64,
+}
+
+impl Sink {
+    fn new(sender: mpsc::Sender<Chunk>, grant: Option<Arc<Grant>>) -> Self {
+        Self {
+            sender,
+            grant,
+            arguments: Value::Null,
+            sent: 0,
+            sent_bytes: 0,
+        }
+    }
+
+    fn record_request(&mut self, request: &impl Serialize) {
+        self.arguments = serde_json::to_value(request).unwrap_or_default();
+    }
+
+    /// Whether the caller may see `path`; an empty path names no file.
+    fn allows(&self, path: &str) -> bool {
+        path.is_empty()
+            || self
+                .grant
+                .as_ref()
+                .is_none_or(|grant| grant.allows_path(path))
+    }
+
+    /// Refuse a request naming `path` outside the caller's grant.
+    fn check_path(&self, path: &str) -> Result<(), Status> {
+        match &self.grant {
+            Some(grant) if !self.allows(path) => Err(Status::permission_denied(format!(
+                "credential {} may not read {path}",
+                grant.name
+            ))),
+            _ => Ok(()),
+        }
+    }
+
+    /// Send one message about the files in `paths`, or silently withhold it
+    /// when the caller may not see one of them; fails once the client has
+    /// gone away.
+    fn send(&mut self, paths: &[&str], message: ProtoWriter) -> Result<(), Status> {
+        if !paths.iter().all(|path| self.allows(path)) {
+            return Ok(());
+        }
+        let message = message.into_bytes();
+        let mut frame = Vec::with_capacity(5 + message.len());
+        frame.push(0);
+        frame.extend_from_slice(&(message.len() as u32).to_be_bytes());
+        frame.extend_from_slice(&message);
+        self.sent += 1;
+        self.sent_bytes += frame.len() as u64;
+        self.sender
+            .blocking_send(Chunk::Message(Bytes::from(frame)))
+            .map_err(|_| Status::new(CODE_CANCELLED, "client went away"))
+    }
+}
+
+/// Response body: the messages as data frames, then the status trailers.
+struct GrpcBody {
+    receiver: mpsc::Receiver<Chunk>,
+    done: bool,
+}
+
+impl http_body::Body for GrpcBody {
+    type Data = Bytes;
+    type Error = Infallible;
+
+    fn poll_frame(
+        self: Pin<&mut Self>,
+        cx: &mut Context<'_>,
+    ) -> Poll<Option<Result<Frame<Bytes>, Infallible>>> {
+        let this = self.get_mut();
+        if this.done {
+            return Poll::Ready(None);
+        }
+        let frame = match std::task::ready!(this.receiver.poll_recv(cx)) {
+            Some(Chunk::Message(bytes)) => Frame::data(bytes),
+            Some(Chunk::Status(status)) => {
+                this.done = true;
+                Frame::trailers(status.trailers())
+            }
+            // The query task panicked.
+            None => {
+                this.done = true;
+                Frame::trailers(Status::new(CODE_INTERNAL, "query failed").trailers())
+            }
+        };
+        Poll::Ready(Some(Ok(frame)))
+    }
+}
+
+/// The message of a unary request body: one uncompressed, length-prefixed
+/// frame.
+fn unframe(body: &Bytes) -> Result<Bytes, Status> {
+    if body.len() < 5 {
+        return Err(Status::invalid_argument("request has no message"));
+    }
+    if body[0] != 0 {
+        return Err(Status::new(
+            CODE_UNIMPLEMENTED,
+            "compressed messages are not supported",
+        ));
+    }
+    let len = u32::from_be_bytes([body[1], body[2], body[3], body[4]]) as usize;
+    if body.len() != 5 + len {
+        return Err(Status::invalid_argument(
+            "request must hold exactly one message",
+        ));
+    }
+    Ok(body.slice(5..))
+}
+
+async fn respond(
+    state: Arc<RestState>,
+    call: Call,
+    headers: HeaderMap,
+    body: Bytes,
+    handler: Rpc,
+) -> Response {
+    let is_grpc = headers
+        .get(header::CONTENT_TYPE)
+        .and_then(|value| value.to_str().ok())
+        .is_some_and(|value| value.starts_with("application/grpc"));
+    if !is_grpc {
+        return StatusCode::UNSUPPORTED_MEDIA_TYPE.into_response();
+    }
+
+    let started = Instant::now();
+    let Call {
+        method,
+        guard,
+        remote,
+    } = call;
+    let caller = match guard.authenticate(&headers, remote) {
+        Ok(caller) => caller,
+        Err(rejection) => return status_response(rejection.into()),
+    };
+    let admitted = guard.admit(&caller).map_err(Status::from);
+    let message = match admitted.and_then(|()| unframe(&body)) {
+        Ok(message) => message,
+        Err(status) => {
+            let summary = (status.outcome().to_string(), None, 0);
+            guard.audit(&caller, method, Value::Null, summary, started.elapsed());
+            return status_response(status);
+        }
+    };
+
+    let (sender, receiver) = mpsc::channel(STREAM_BUFFER);
+    tokio::task::spawn_blocking(move || {
+        let mut sink = Sink::new(sender, caller.grant.clone());
+        let status = state
+            .connect()
+            .map_err(Status::from)
+            .and_then(|conn| handler(&state, &conn, &message, &mut sink))
+            .err()
+            .unwrap_or_else(Status::ok);
+        let summary = (
+            status.outcome().to_string(),
+            Some(sink.sent),
+            sink.sent_bytes,
+        );
+        let arguments = std::mem::take(&mut sink.arguments);
+        guard.audit(&caller, method, arguments, summary, started.elapsed());
+        // Fails only when the client has gone away.
+        let _ = sink.sender.blocking_send(Chunk::Status(status));
+    });
+    stream_response(receiver)
+}
+
+/// A response carrying only `status`.
+fn status_response(status: Status) -> Response {
+    let (sender, receiver) = mpsc::channel(1);
+    let _ = sender.try_send(Chunk::Status(status));
+    stream_response(receiver)
+}
+
+fn stream_response(receiver: mpsc::Receiver<Chunk>) -> Response {
+    let mut response = Response::new(Body::new(GrpcBody {
+        receiver,
+        done: false,
+    }));
+    response.headers_mut().insert(
+        header::CONTENT_TYPE,
+        HeaderValue::from_static("application/grpc"),
+    );
+    response
+}
+
+fn ref_or_default<'a>(state: &'a RestState, requested: &'a str) -> &'a str {
+    if requested.is_empty() {
+        &state.ref_name
+    } else {
+        requested
+    }
+}
+
+fn non_empty(value: &str) -> Option<&str> {
+    (!value.is_empty()).then_some(value)
+}
+
+/// A request `limit`, where 0 means the REST API's default.
+fn default_limit(limit: u32) -> usize {
+    clamp_limit((limit > 0).then_some(limit as usize))
+}
+
+fn string(value: ProtoValue<'_>) -> io::Result<String> {
+    value.as_str().map(str::to_string)
+}
+
+#[derive(Debug, Default, PartialEq, Eq, Serialize)]
+struct SearchRequest {
+    query: String,
+    language: String,
+    limit: u32,
+    ref_name: String,
+}
+
+impl SearchRequest {
+    fn decode(buf: &[u8]) -> io::Result<Self> {
+        let mut request = Self::default();
+        let mut reader = ProtoReader::new(buf);
+        while let Some((field, value)) = reader.next_field()? {
+            match field {
+                1 => request.query = string(value)?,
+                2 => request.language = string(value)?,
+                3 => request.limit = value.as_u32()?,
+                4 => request.ref_name = string(value)?,
+                _ => {}
+            }
+        }
+        Ok(request)
+    }
+}
+
+fn search_rpc(
+    state: &RestState,
+    conn: &Connection,
+    message: &[u8],
+    sink: &mut Sink,
+) -> Result<(), Status> {
+    let request = SearchRequest::decode(message)?;
+    sink.record_request(&request);
+    if request.query.trim().is_empty() {
+        return Err(Status::invalid_argument("`query` must not be empty"));
+    }
+    let response = search::search_code(
+        &state.index_set,
+        Some(conn),
+        &request.query,
+        Some(ref_or_default(state, &request.ref_name)),
+        non_empty(&request.language),
+        default_limit(request.limit),
+        false,
+    )?;
+    for hit in &response.results {
+        let mut writer = ProtoWriter::new();
+        writer.string(1, &hit.result_type);
+        writer.string(2, &hit.path);
+        writer.uint64(3, u64::from(hit.line_start));
+        writer.uint64(4, u64::from(hit.line_end));
+        writer.string(5, hit.kind.as_deref().unwrap_or_default());
+        writer.string(6, hit.name.as_deref().unwrap_or_default());
+        writer.string(7, hit.qualified_name.as_deref().unwrap_or_default());
+        writer.string(8, &hit.language);
+        writer.string(9, hit.signature.as_deref().unwrap_or_default());
+        writer.float(10, hit.score);
+        writer.string(11, hit.snippet.as_deref().unwrap_or_default());
+        writer.string(12, hit.symbol_stable_id.as_deref().unwrap_or_default());
+        sink.send(&[&hit.path], writer)?;
+    }
+    Ok(())
+}
+
+#[derive(Debug, Default, PartialEq, Eq, Serialize)]
+struct DefinitionsRequest {
+    name: String,
+    kind: String,
+    language: String,
+    limit: u32,
+    ref_name: String,
+}
+
+impl DefinitionsRequest {
+    fn decode(buf: &[u8]) -> io::Result<Self> {
+        let mut request = Self::default();
+        let mut reader = ProtoReader::new(buf);
+        while let Some((field, value)) = reader.next_field()? {
+            match field {
+                1 => request.name = string(value)?,
+                2 => request.kind = string(value)?,
+                3 => request.language = string(value)?,
+                4 => request.limit = value.as_u32()?,
+                5 => request.ref_name = string(value)?,
+                _ => {}
+            }
+        }
+        Ok(request)
+    }
+}
+
+fn definitions_rpc(
+    state: &RestState,
+    _conn: &Connection,
+    message: &[u8],
+    sink: &mut Sink,
+) -> Result<(), Status> {
+    let request = DefinitionsRequest::decode(message)?;
+    sink.record_request(&request);
+    if request.name.is_empty() {
+        return Err(Status::invalid_argument("`name` must not be empty"));
+    }
+    let definitions = locate::locate_symbol(
+        &state.index_set.symbols,
+        &request.name,
+        non_empty(&request.kind),
+        None,
+        non_empty(&request.language),
+        Some(ref_or_default(state, &request.ref_name)),
+        default_limit(request.limit),
+    )?;
+    for definition in &definitions {
+        let mut writer = ProtoWriter::new();
+        writer.string(1, &definition.symbol_stable_id);
+        writer.string(2, &definition.name);
+        writer.string(3, &definition.qualified_name);
+        writer.string(4, &definition.kind);
+        writer.string(5, &definition.language);
+        writer.string(6, &definition.path);
+        writer.uint64(7, u64::from(definition.line_start));
+        writer.uint64(8, u64::from(definition.line_end));
+        writer.string(9, definition.signature.as_deref().unwrap_or_default());
+        sink.send(&[&definition.path], writer)?;
+    }
+    Ok(())
+}
+
+#[derive(Debug, Default, PartialEq, Eq, Serialize)]
+struct ReferencesRequest {
+    symbol: String,
+    kind: String,
+    limit: u32,
+    ref_name: String,
+}
+
+impl ReferencesRequest {
+    fn decode(buf: &[u8]) -> io::Result<Self> {
+        let mut request = Self::default();
+        let mut reader = ProtoReader::new(buf);
+        while let Some((field, value)) = reader.next_field()? {
+            match field {
+                1 => request.symbol = string(value)?,
+                2 => request.kind = string(value)?,
+                3 => request.limit = value.as_u32()?,
+                4 => request.ref_name = string(value)?,
+                _ => {}
+            }
+        }
+        Ok(request)
+    }
+}
+
+fn write_reference_symbol(writer: &mut ProtoWriter, symbol: &ReferenceSymbol) {
+    writer.string(1, &symbol.symbol_stable_id);
+    writer.string(2, &symbol.name);
+    writer.string(3, &symbol.qualified_name);
+    writer.string(4, &symbol.kind);
+    writer.string(6, &symbol.path);
+    writer.uint64(7, u64::from(symbol.line_start));
+    writer.uint64(8, u64::from(symbol.line_end.unwrap_or_default()));
+}
+
+fn references_rpc(
+    state: &RestState,
+    conn: &Connection,
+    message: &[u8],
+    sink: &mut Sink,
+) -> Result<(), Status> {
+    let request = ReferencesRequest::decode(message)?;
+    sink.record_request(&request);
+    // find_references reads 0 as "no limit".
+    let result = find_references::find_references(
+        conn,
+        &state.workspace,
+        &state.project_id,
+        ref_or_default(state, &request.ref_name),
+        non_empty(&request.kind),
+        &request.symbol,
+        request.limit as usize,
+    )
+    .map_err(|e| match e {
+        FindReferencesError::SymbolNotFound => {
+            Status::not_found(format!("symbol `{}` not found", request.symbol))
+        }
+        FindReferencesError::NoEdgesAvailable => {
+            Status::not_found("no reference edges are indexed for this ref")
+        }
+        FindReferencesError::State(e) => e.into(),
+    })?;
+    for reference in &result.references {
+        let mut writer = ProtoWriter::new();
+        writer.string(1, &reference.path);
+        writer.uint64(2, u64::from(reference.line_start));
+        writer.uint64(3, u64::from(reference.line_end.unwrap_or_default()));
+        writer.string(4, &reference.edge_type);
+        writer.string(5, reference.context.as_deref().unwrap_or_default());
+        writer.message(6, |symbol| {
+            write_reference_symbol(symbol, &reference.from_symbol)
+        });
+        sink.send(&[&reference.path, &reference.from_symbol.path], writer)?;
+    }
+    Ok(())
+}
+
+#[derive(Debug, Default, PartialEq, Eq, Serialize)]
+struct CallGraphRequest {
+    symbol: String,
+    path: String,
+    direction: String,
+    depth: u32,
+    limit: u32,
+    ref_name: String,
+}
+
+impl CallGraphRequest {
+    fn decode(buf: &[u8]) -> io::Result<Self> {
+        let mut request = Self::default();
+        let mut reader = ProtoReader::new(buf);
+        while let Some((field, value)) = reader.next_field()? {
+            match field {
+                1 => request.symbol = string(value)?,
+                2 => request.path = string(value)?,
+                3 => request.direction = string(value)?,
+                4 => request.depth = value.as_u32()?,
+                5 => request.limit = value.as_u32()?,
+                6 => request.ref_name = string(value)?,
+                _ => {}
+            }
+        }
+        Ok(request)
+    }
+}
+
+fn write_call_graph_symbol(writer: &mut ProtoWriter, symbol: &CallGraphSymbol) {
+    writer.string(1, &symbol.symbol_stable_id);
+    writer.string(2, &symbol.name);
+    writer.string(3, &symbol.qualified_name);
+    writer.string(4, &symbol.kind);
+    writer.string(6, &symbol.path);
+    writer.uint64(7, u64::from(symbol.line_start));
+    writer.uint64(8, u64::from(symbol.line_end));
+}
+
+fn call_graph_rpc(
+    state: &RestState,
+    conn: &Connection,
+    message: &[u8],
+    sink: &mut Sink,
+) -> Result<(), Status> {
+    let request = CallGraphRequest::decode(message)?;
+    sink.record_request(&request);
+    sink.check_path(&request.path)?;
+    let direction = non_empty(&request.direction).unwrap_or("both");
+    let direction = CallGraphDirection::parse(direction).ok_or_else(|| {
+        Status::invalid_argument(format!(
+            "unknown direction `{direction}` (expected callers, callees or both)"
+        ))
+    })?;
+    let query = call_graph::CallGraphRequest {
+        symbol_name: &request.symbol,
+        path: non_empty(&request.path),
+        direction,
+        depth: request.depth.max(1),
+        limit: default_limit(request.limit),
+    };
+    let graph = call_graph::get_call_graph(
+        conn,
+        &state.project_id,
+        ref_or_default(state, &request.ref_name),
+        &query,
+    )
+    .map_err(|e| match e {
+        CallGraphError::SymbolNotFound => {
+            Status::not_found(format!("symbol `{}` not found", request.symbol))
+        }
+        CallGraphError::State(e) => e.into(),
+    })?;
+
+    let edges = graph
+        .callers
+        .iter()
+        .map(|edge| ("caller", edge))
+        .chain(graph.callees.iter().map(|edge| ("callee", edge)));
+    for (direction, edge) in edges {
+        let paths = [edge.symbol.path.as_str(), edge.call_site.file.as_str()];
+        sink.send(&paths, call_edge(direction, edge))?;
+    }
+    Ok(())
+}
+
+fn call_edge(direction: &str, edge: &CallGraphEdgeResult) -> ProtoWriter {
+    let mut writer = ProtoWriter::new();
+    writer.string(1, direction);
+    writer.message(2, |symbol| write_call_graph_symbol(symbol, &edge.symbol));
+    writer.string(3, &edge.call_site.file);
+    writer.uint64(4, u64::from(edge.call_site.line));
+    writer.string(5, &edge.confidence);
+    writer.uint64(6, u64::from(edge.depth));
+    writer
+}
+
+#[derive(Debug, Default, PartialEq, Eq, Serialize)]
+struct SubgraphRequest {
+    root: String,
+    depth: u32,
+    filter: String,
+    limit: u32,
+    ref_name: String,
+}
+
+impl SubgraphRequest {
+    fn decode(buf: &[u8]) -> io::Result<Self> {
+        let mut request = Self::default();
+        let mut reader = ProtoReader::new(buf);
+        while let Some((field, value)) = reader.next_field()? {
+            match field {
+                1 => request.root = string(value)?,
+                2 => request.depth = value.as_u32()?,
+                3 => request.filter = string(value)?,
+                4 => request.limit = value.as_u32()?,
+                5 => request.ref_name = string(value)?,
+                _ => {}
+            }
+        }
+        Ok(request)
+    }
+}
+
+fn write_graph_node(writer: &mut ProtoWriter, node: &GraphNode) {
+    writer.string(1, &node.id);
+    writer.string(2, &node.name);
+    writer.string(3, &node.qualified_name);
+    writer.string(4, &node.kind);
+    writer.string(5, &node.language);
+    writer.string(6, &node.package);
+    writer.string(7, &node.path);
+    writer.uint64(8, u64::from(node.line_start));
+    writer.uint64(9, u64::from(node.line_end));
+    writer.string(10, node.signature.as_deref().unwrap_or_default());
+}
+
+fn write_graph_edge(writer: &mut ProtoWriter, edge: &GraphEdge) {
+    writer.string(1, &edge.source);
+    writer.string(2, &edge.target);
+    writer.string(3, &edge.kind);
+    writer.string(4, &edge.confidence);
+    writer.string(5, edge.file.as_deref().unwrap_or_default());
+    writer.uint64(6, u64::from(edge.line.unwrap_or_default()));
+}
+
+fn subgraph_rpc(
+    state: &RestState,
+    conn: &Connection,
+    message: &[u8],
+    sink: &mut Sink,
+) -> Result<(), Status> {
+    let request = SubgraphRequest::decode(message)?;
+    sink.record_request(&request);
+    let snapshot = graph_export::load_graph_snapshot(
+        conn,
+        &state.project_id,
+        ref_or_default(state, &request.ref_name),
+    )?;
+    let view = GraphView::new(snapshot);
+    let limit = match request.limit {
+        0 => usize::MAX,
+        limit => limit as usize,
+    };
+    let subgraph = if request.root.is_empty() {
+        let filter = GraphFilter::parse(&request.filter).map_err(Status::invalid_argument)?;
+        view.filter(&filter, limit)
+    } else {
+        let id = view
+            .snapshot()
+            .nodes
+            .iter()
+            .find(|node| node.id == request.root || node.qualified_name == request.root)
+            .map(|node| node.id.clone());
+        id.and_then(|id| view.neighborhood(&id, request.depth.max(1) as usize, limit))
+            .ok_or_else(|| Status::not_found(format!("node `{}` not found", request.root)))?
+    };
+
+    // Edges touching a withheld node would still reveal its id.
+    let hidden: HashSet<&str> = subgraph
+        .nodes
+        .iter()
+        .filter(|node| !sink.allows(&node.path))
+        .map(|node| node.id.as_str())
+        .collect();
+    for node in &subgraph.nodes {
+        let mut writer = ProtoWriter::new();
+        writer.message(1, |message| write_graph_node(message, node));
+        sink.send(&[&node.path], writer)?;
+    }
+    for edge in &subgraph.edges {
+        if hidden.contains(edge.source.as_str()) || hidden.contains(edge.target.as_str()) {
+            continue;
+        }
+        let mut writer = ProtoWriter::new();
+        writer.message(2, |message| write_graph_edge(message, edge));
+        sink.send(&[edge.file.as_deref().unwrap_or_default()], writer)?;
+    }
+    if subgraph.omitted > 0 {
+        let mut writer = ProtoWriter::new();
+        writer.uint64(3, subgraph.omitted as u64);
+        sink.send(writer)?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use http_body::Body as _;
+
+    fn frames(receiver: mpsc::Receiver<Chunk>) -> Vec<Frame<Bytes>> {
+        let mut body = GrpcBody {
+            receiver,
+            done: false,
+        };
+        let mut frames = Vec::new();
+        while let Some(frame) = futures::executor::block_on(std::future::poll_fn(|cx| {
+            Pin::new(&mut body).poll_frame(cx)
+        })) {
+            frames.push(frame.unwrap());
+        }
+        frames
+    }
+
+    #[test]
+    fn streams_framed_messages_then_status_trailers() {
+        let (sender, receiver) = mpsc::channel(STREAM_BUFFER);
+        let mut sink = Sink::new(sender, None);
+        let mut writer = ProtoWriter::new();
+        writer.string(1, "ab");
+        sink.send(&["a.go"], writer).unwrap();
+        let status = Status::not_found("symbol `ü` 100% gone");
+        sink.sender.blocking_send(Chunk::Status(status)).unwrap();
+        drop(sink);
+
+        let mut frames = frames(receiver).into_iter();
+        let data = frames.next().unwrap().into_data().unwrap();
+        assert_eq!(&data[..], &[0, 0, 0, 0, 4, 0x0a, 0x02, b'a', b'b']);
+        let trailers = frames.next().unwrap().into_trailers().unwrap();
+        assert_eq!(trailers["grpc-status"], "5");
+        assert_eq!(trailers["grpc-message"], "symbol `%C3%BC` 100%25 gone");
+        assert!(frames.next().is_none());
+
+        // A query task that dies without a status still ends the stream.
+        let (sender, receiver) = mpsc::channel::<Chunk>(1);
+        drop(sender);
+        let trailers = frames(receiver).remove(0).into_trailers().unwrap();
+        assert_eq!(trailers["grpc-status"], "13");
+    }
+
+    /// Run one RPC and return its `grpc-status` trailer.
+    async fn call_status(
+        method: &'static str,
+        token: Option<&str>,
+        message: ProtoWriter,
+    ) -> String {
+        let tmp = tempfile::tempdir().unwrap();
+        let (state, guard) = crate::rest::tests::keyed_state(tmp.path());
+        let handler = RPCS.iter().find(|(name, _)| *name == method).unwrap().1;
+        let mut headers = HeaderMap::new();
+        headers.insert(
+            header::CONTENT_TYPE,
+            HeaderValue::from_static("application/grpc"),
+        );
+        if let Some(token) = token {
+            headers.insert(
+                header::AUTHORIZATION,
+                format!("Bearer {token}").parse().unwrap(),
+            );
+        }
+        let message = message.into_bytes();
+        let mut body = vec![0];
+        body.extend_from_slice(&(message.len() as u32).to_be_bytes());
+        body.extend_from_slice(&message);
+        let call = Call {
+            method,
+            guard,
+            remote: None,
+        };
+        let response = respond(state, call, headers, Bytes::from(body), handler).await;
+        let mut body = response.into_body();
+        while let Some(frame) = std::future::poll_fn(|cx| Pin::new(&mut body).poll_frame(cx)).await
+        {
+            if let Ok(trailers) = frame.unwrap().into_trailers() {
+                return trailers["grpc-status"].to_str().unwrap().to_string();
+            }
+        }
+        panic!("stream ended without a status");
+    }
+
+    #[tokio::test]
+    async fn api_keys_guard_every_rpc() {
+        let mut search = ProtoWriter::new();
+        search.string(1, "validate_token");
+        assert_eq!(call_status("Search", None, search).await, "16");
+
+        let mut search = ProtoWriter::new();
+        search.string(1, "validate_token");
+        assert_eq!(call_status("Search", Some("wrong"), search).await, "16");
+
+        let mut search = ProtoWriter::new();
+        search.string(1, "validate_token");
+        assert_eq!(call_status("Search", Some("tok"), search).await, "0");
+
+        let mut call_graph = ProtoWriter::new();
+        call_graph.string(1, "validate_token");
+        call_graph.string(2, "src/internal/auth.go");
+        assert_eq!(call_status("CallGraph", Some("tok"), call_graph).await, "7");
+    }
+
+    #[test]
+    fn results_outside_the_grant_are_withheld() {
+        let grant = Grant {
+            name: "ci".to_string(),
+            role: crate::access::Role::Reader,
+            read_prefixes: vec!["src/public/".to_string()],
+        };
+        let (sender, mut receiver) = mpsc::channel(STREAM_BUFFER);
+        let mut sink = Sink::new(sender, Some(Arc::new(grant)));
+        sink.send(&["src/public/a.go"], ProtoWriter::new()).unwrap();
+        sink.send(&["src/internal/b.go"], ProtoWriter::new())
+            .unwrap();
+        sink.send(
+            &["src/public/a.go", "src/internal/b.go"],
+            ProtoWriter::new(),
+        )
+        .unwrap();
+        sink.send(&[""], ProtoWriter::new()).unwrap();
+        assert_eq!(sink.sent, 2);
+        drop(sink);
+        let mut delivered = 0;
+        while receiver.try_recv().is_ok() {
+            delivered += 1;
+        }
+        assert_eq!(delivered, 2);
+        assert!(Sink::new(mpsc::channel(1).0, None).allows("src/internal/b.go"));
+    }
+
+    #[test]
+    fn unframes_and_decodes_requests() {
+        let mut writer = ProtoWriter::new();
+        writer.string(1, "validate_token");
+        writer.string(3, "callers");
+        writer.uint64(4, 2);
+        writer.string(9, "ignored");
+        let message = writer.into_bytes();
+        let mut body = vec![0, 0, 0, 0, message.len() as u8];
+        body.extend_from_slice(&message);
+
+        let message = unframe(&Bytes::from(body.clone())).unwrap();
+        assert_eq!(
+            CallGraphRequest::decode(&message).unwrap(),
+            CallGraphRequest {
+                symbol: "validate_token".into(),
+                direction: "callers".into(),
+                depth: 2,
+                ..Default::default()
+            }
+        );
+
+        body[0] = 1;
+        let compressed = unframe(&Bytes::from(body.clone())).unwrap_err();
+        assert_eq!(compressed.code, CODE_UNIMPLEMENTED);
+        body[0] = 0;
+        body.pop();
+        let truncated = unframe(&Bytes::from(body)).unwrap_err();
+        assert_eq!(truncated.code, CODE_INVALID_ARGUMENT);
+    }
+}
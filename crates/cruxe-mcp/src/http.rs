@@ -3,22 +3,39 @@
 //! Provides a JSON-RPC over HTTP endpoint that reuses the same tool dispatch
 //! as the stdio transport. Routes:
 //! - `GET /health` — aggregated health/status
+//! - `GET /metrics` — Prometheus metrics; see [`crate::metrics`]
 //! - `POST /`      — JSON-RPC MCP handler
+//! - `GET /subscribe` — live graph deltas as Server-Sent Events; see
+//!   [`crate::subscribe`]
+//! - `GET /sse`, `POST /messages` — the MCP HTTP+SSE transport; see
+//!   [`crate::sse`] (single-project servers only)
+//!
+//! With `[[server.tenants]]` or `[[server.api_keys]]` configured, the routes
+//! require a bearer token and may serve many projects at once; see
+//! [`crate::tenants`] and [`crate::access`]. Every JSON-RPC request passes
+//! the `[server.limits]` checks in [`crate::limits`].
 
+use crate::access::Grant;
+use crate::limits::{Rejection, ServerLimits, estimate_cost};
 use crate::notifications::{NullProgressNotifier, ProgressNotifier};
 use crate::protocol::{JsonRpcRequest, JsonRpcResponse};
+use crate::subscribe::Subscriptions;
+use crate::tenants::RequestPermit;
 use crate::workspace_router::WorkspaceRouter;
+use axum::Extension;
 use axum::body::Bytes;
-use axum::extract::State;
+use axum::extract::{ConnectInfo, State};
 use axum::http::{HeaderMap, StatusCode};
 use axum::response::IntoResponse;
 use axum::routing::{get, post};
 use axum::{Json, Router};
+use cruxe_core::audit::{AuditEvent, AuditLog};
 use cruxe_core::config::Config;
 use cruxe_core::constants;
 use cruxe_core::error::ProtocolErrorCode;
 use cruxe_core::types::{SchemaStatus, WorkspaceConfig, generate_project_id};
 use serde_json::{Value, json};
+use std::net::SocketAddr;
 use std::path::PathBuf;
 use std::sync::atomic::{AtomicU8, Ordering};
 use std::sync::{Arc, Mutex};
@@ -38,6 +55,10 @@ pub struct HttpState {
     pub health_cache: Arc<Mutex<Option<(Instant, Value)>>>,
     pub server_start: Instant,
     pub router: WorkspaceRouter,
+    pub limits: ServerLimits,
+    /// Shared by every tenant of a server.
+    pub audit: Option<Arc<AuditLog>>,
+    pub subscriptions: Subscriptions,
 }
 
 const HEALTH_CACHE_TTL: Duration = Duration::from_secs(1);
@@ -52,6 +73,68 @@ pub async fn run_http_server(
     port: u16,
 ) -> Result<(), Box<dyn std::error::Error>> {
     let config = Config::load_with_file(Some(workspace), config_file)?;
+    if !config.server.tenants.is_empty() || !config.server.api_keys.is_empty() {
+        if workspace_config.auto_workspace {
+            return Err(
+                "--auto-workspace cannot be combined with [[server.tenants]] or [[server.api_keys]]"
+                    .into(),
+            );
+        }
+        let registry =
+            crate::tenants::TenantRegistry::open(&config, config_file, no_prewarm, workspace)?;
+        let app = Router::new()
+            .route("/health", get(crate::tenants::health_handler))
+            .route("/metrics", get(crate::tenants::metrics_handler))
+            .route("/", post(crate::tenants::jsonrpc_handler))
+            .route("/subscribe", get(crate::tenants::subscribe_handler))
+            .with_state(Arc::new(registry));
+        return serve(app, bind_addr, port).await;
+    }
+
+    let audit = AuditLog::from_config(&config)?.map(Arc::new);
+    let state = open_http_state(
+        workspace,
+        config,
+        no_prewarm,
+        workspace_config,
+        crate::server::ConnectionManager::new(),
+        audit,
+    )?;
+    let state = Arc::new(state);
+    let app = Router::new()
+        .route("/health", get(health_handler))
+        .route("/metrics", get(crate::metrics::metrics_handler))
+        .route("/", post(jsonrpc_handler))
+        .route("/subscribe", get(crate::subscribe::subscribe_handler))
+        .with_state(Arc::clone(&state))
+        .merge(crate::sse::routes(state));
+    serve(app, bind_addr, port).await
+}
+
+async fn serve(app: Router, bind_addr: &str, port: u16) -> Result<(), Box<dyn std::error::Error>> {
+    let addr = format!("{}:{}", bind_addr, port);
+    info!("MCP HTTP server listening on {}", addr);
+
+    let listener = tokio::net::TcpListener::bind(&addr).await?;
+    axum::serve(
+        listener,
+        app.into_make_service_with_connect_info::<SocketAddr>(),
+    )
+    .await?;
+
+    Ok(())
+}
+
+/// Open the per-project runtime behind the HTTP routes: recovers interrupted
+/// jobs, builds the workspace router, and starts prewarming.
+pub(crate) fn open_http_state(
+    workspace: &std::path::Path,
+    config: Config,
+    no_prewarm: bool,
+    workspace_config: WorkspaceConfig,
+    connection_manager: crate::server::ConnectionManager,
+    audit: Option<Arc<AuditLog>>,
+) -> Result<HttpState, Box<dyn std::error::Error>> {
     let project_id = generate_project_id(&workspace.to_string_lossy());
     let data_dir = config.project_data_dir(&project_id);
     let db_path = data_dir.join(constants::STATE_DB_FILE);
@@ -85,36 +168,32 @@ pub async fn run_http_server(
         std::thread::spawn(move || crate::server::prewarm_projects(ps, config_clone, project_ids));
     }
 
-    let state = Arc::new(HttpState {
+    let limits = ServerLimits::from_config(&config.server.limits);
+    let subscriptions = Subscriptions::from_config(&config.server.subscribe);
+    Ok(HttpState {
         config,
         workspace: workspace.to_path_buf(),
         project_id,
         data_dir,
         db_path,
-        connection_manager: Arc::new(crate::server::ConnectionManager::new()),
+        connection_manager: Arc::new(connection_manager),
         prewarm_status,
         warmset_enabled: !no_prewarm,
         health_cache: Arc::new(Mutex::new(None)),
         server_start: Instant::now(),
         router,
-    });
-
-    let app = Router::new()
-        .route("/health", get(health_handler))
-        .route("/", post(jsonrpc_handler))
-        .with_state(state);
-
-    let addr = format!("{}:{}", bind_addr, port);
-    info!("MCP HTTP server listening on {}", addr);
-
-    let listener = tokio::net::TcpListener::bind(&addr).await?;
-    axum::serve(listener, app).await?;
-
-    Ok(())
+        limits,
+        audit,
+        subscriptions,
+    })
 }
 
 /// GET /health — aggregated server health (T224).
 async fn health_handler(State(state): State<Arc<HttpState>>) -> impl IntoResponse {
+    health_response(state).await
+}
+
+pub(crate) async fn health_response(state: Arc<HttpState>) -> axum::response::Response {
     let result = tokio::task::spawn_blocking({
         let state = Arc::clone(&state);
         move || build_health_response(&state)
@@ -133,10 +212,52 @@ async fn health_handler(State(state): State<Arc<HttpState>>) -> impl IntoRespons
 /// POST / — JSON-RPC MCP handler (T225).
 async fn jsonrpc_handler(
     State(state): State<Arc<HttpState>>,
+    connect_info: Option<Extension<ConnectInfo<SocketAddr>>>,
     headers: HeaderMap,
     body: Bytes,
 ) -> impl IntoResponse {
-    let request: JsonRpcRequest = match serde_json::from_slice(&body) {
+    // Unauthenticated clients are identified by remote address.
+    let client = connect_info
+        .map(|Extension(ConnectInfo(addr))| addr.ip().to_string())
+        .unwrap_or_else(|| "unknown".to_string());
+    let caller = Caller {
+        client,
+        tenant: None,
+        grant: None,
+        permit: None,
+    };
+    jsonrpc_response(state, &headers, &body, caller).await
+}
+
+/// The party behind one HTTP request.
+pub(crate) struct Caller<'a> {
+    /// Credential name, or remote address when unauthenticated.
+    pub client: String,
+    pub tenant: Option<&'a str>,
+    pub grant: Option<&'a Grant>,
+    /// Tenant concurrency slot; held until the tool finishes, even when the
+    /// response has already timed out.
+    pub permit: Option<RequestPermit>,
+}
+
+impl Caller<'_> {
+    /// Key for the `[server.limits]` client windows.
+    fn limit_key(&self) -> String {
+        match self.tenant {
+            Some(tenant) => format!("{tenant}/{}", self.client),
+            None => self.client.clone(),
+        }
+    }
+}
+
+/// Parse, admit, dispatch, and audit one JSON-RPC request.
+pub(crate) async fn jsonrpc_response(
+    state: Arc<HttpState>,
+    headers: &HeaderMap,
+    body: &[u8],
+    mut caller: Caller<'_>,
+) -> axum::response::Response {
+    let request: JsonRpcRequest = match serde_json::from_slice(body) {
         Ok(req) => req,
         Err(e) => {
             let body = json!({
@@ -148,23 +269,201 @@ async fn jsonrpc_handler(
             return (StatusCode::BAD_REQUEST, Json(body)).into_response();
         }
     };
-    let session_scope = session_scope_from_headers(&headers);
-
-    let result = tokio::task::spawn_blocking({
-        let state = Arc::clone(&state);
-        move || handle_http_request(&state, &request, session_scope.as_deref())
-    })
-    .await;
 
-    match result {
+    let started = Instant::now();
+    let outcome = dispatch_request(&state, headers, &request, &mut caller).await;
+    if let Some(audit) = &state.audit
+        && request.method == "tools/call"
+    {
+        audit_request(
+            audit,
+            &state,
+            &request,
+            &caller,
+            &outcome,
+            started.elapsed(),
+        );
+    }
+    match outcome {
         Ok(response) => Json(response).into_response(),
-        Err(e) => {
-            let resp = JsonRpcResponse::error(None, -32603, format!("Internal error: {}", e));
-            Json(resp).into_response()
+        Err(rejection) => rejection.into_response(),
+    }
+}
+
+async fn dispatch_request(
+    state: &Arc<HttpState>,
+    headers: &HeaderMap,
+    request: &JsonRpcRequest,
+    caller: &mut Caller<'_>,
+) -> Result<JsonRpcResponse, Rejection> {
+    let cost = estimate_cost(request);
+    if let Some(max) = state.limits.exceeds_max_cost(cost) {
+        return Ok(limit_error(
+            request,
+            ProtocolErrorCode::QueryTooExpensive,
+            format!(
+                "estimated query cost {cost} exceeds the server maximum of {max}; \
+                 lower depth, limit, or token budget"
+            ),
+        ));
+    }
+    let client = caller.limit_key();
+    if let Err(rejection) = state.limits.admit(&client, cost, Instant::now()) {
+        tracing::debug!(client, cost, ?rejection, "Rejected HTTP request");
+        return Err(rejection);
+    }
+
+    if let Some(grant) = caller.grant
+        && let Err(denied) = grant.check_request(request)
+    {
+        return Ok(denied);
+    }
+    let session_scope = session_scope_from_headers(headers);
+
+    let timeout = state.limits.timeout();
+    let task = tokio::task::spawn_blocking({
+        let state = Arc::clone(state);
+        let request = request.clone();
+        let permit = caller.permit.take();
+        move || {
+            let _permit = permit;
+            handle_http_request(&state, &request, session_scope.as_deref())
         }
+    });
+    let result = match timeout {
+        Some(timeout) => match tokio::time::timeout(timeout, task).await {
+            Ok(result) => result,
+            Err(_) => {
+                warn!(
+                    client,
+                    method = %request.method,
+                    timeout_ms = timeout.as_millis() as u64,
+                    "HTTP request timed out; abandoning its response"
+                );
+                return Ok(limit_error(
+                    request,
+                    ProtocolErrorCode::QueryTimeout,
+                    format!("query exceeded {} ms", timeout.as_millis()),
+                ));
+            }
+        },
+        None => task.await,
+    };
+
+    Ok(match result {
+        Ok(response) => match caller.grant {
+            Some(grant) => grant.filter_response(response),
+            None => response,
+        },
+        Err(e) => JsonRpcResponse::error(None, -32603, format!("Internal error: {}", e)),
+    })
+}
+
+fn audit_request(
+    audit: &AuditLog,
+    state: &HttpState,
+    request: &JsonRpcRequest,
+    caller: &Caller<'_>,
+    outcome: &Result<JsonRpcResponse, Rejection>,
+    elapsed: Duration,
+) {
+    let (outcome, result_count, result_bytes) = match outcome {
+        Ok(response) => summarize_response(response),
+        Err(rejection) => (rejection.code().as_str().to_string(), None, 0),
+    };
+    let event = AuditEvent {
+        timestamp: cruxe_core::time::now_iso8601(),
+        action: "query".to_string(),
+        client: caller.client.clone(),
+        tenant: caller.tenant.map(str::to_string),
+        project_id: state.project_id.clone(),
+        operation: request
+            .params
+            .get("name")
+            .and_then(Value::as_str)
+            .unwrap_or_default()
+            .to_string(),
+        arguments: request
+            .params
+            .get("arguments")
+            .cloned()
+            .unwrap_or(Value::Null),
+        outcome,
+        result_count,
+        result_bytes,
+        duration_ms: elapsed.as_millis() as u64,
+    };
+    if let Err(err) = audit.record(event) {
+        warn!(
+            path = %audit.path().display(),
+            error = %err,
+            "Failed to write audit log entry"
+        );
+    }
+}
+
+/// `(outcome, result_count, result_bytes)` of a tool response: the payload's
+/// error code or `ok`, the length of `results` (else of all top-level arrays),
+/// and the payload size.
+fn summarize_response(response: &JsonRpcResponse) -> (String, Option<u64>, u64) {
+    if response.error.is_some() {
+        return (
+            ProtocolErrorCode::InternalError.as_str().to_string(),
+            None,
+            0,
+        );
+    }
+    let Some(text) = response
+        .result
+        .as_ref()
+        .and_then(|result| result.get("content"))
+        .and_then(|content| content.get(0))
+        .and_then(|item| item.get("text"))
+        .and_then(Value::as_str)
+    else {
+        return ("ok".to_string(), None, 0);
+    };
+    let payload: Value = serde_json::from_str(text).unwrap_or(Value::Null);
+    let outcome = payload
+        .get("error")
+        .and_then(|error| error.get("code"))
+        .and_then(Value::as_str)
+        .unwrap_or("ok")
+        .to_string();
+    (outcome, count_results(&payload), text.len() as u64)
+}
+
+/// The length of a payload's `results`, else of all its top-level arrays.
+pub(crate) fn count_results(payload: &Value) -> Option<u64> {
+    match payload.get("results").and_then(Value::as_array) {
+        Some(results) => Some(results.len() as u64),
+        None => payload.as_object().and_then(|map| {
+            let arrays: Vec<usize> = map
+                .values()
+                .filter_map(Value::as_array)
+                .map(Vec::len)
+                .collect();
+            (!arrays.is_empty()).then(|| arrays.iter().sum::<usize>() as u64)
+        }),
     }
 }
 
+fn limit_error(
+    request: &JsonRpcRequest,
+    code: ProtocolErrorCode,
+    message: String,
+) -> JsonRpcResponse {
+    crate::server::tool_text_response_public(
+        request.id.clone(),
+        json!({
+            "error": {
+                "code": code.as_str(),
+                "message": message,
+            }
+        }),
+    )
+}
+
 fn session_scope_from_headers(headers: &HeaderMap) -> Option<String> {
     headers
         .get("mcp-session-id")
@@ -445,6 +744,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         }
     }
 
@@ -498,6 +800,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let health = build_health_response(&state);
@@ -551,6 +856,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let request = JsonRpcRequest {
@@ -609,10 +917,14 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         });
 
         let response = jsonrpc_handler(
             State(state),
+            None,
             HeaderMap::new(),
             Bytes::from(r#"{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}"#),
         )
@@ -624,6 +936,88 @@ mod tests {
         assert!(parsed.get("result").is_some());
     }
 
+    #[tokio::test]
+    async fn jsonrpc_enforces_cost_cap_and_client_rate_limit() {
+        use axum::body::{Bytes, to_bytes};
+
+        let tmp = tempfile::tempdir().unwrap();
+        let mut state = build_test_state(tmp.path(), Config::default());
+        state.limits = ServerLimits::from_config(&cruxe_core::config::ServerLimitsConfig {
+            client_requests_per_minute: 1,
+            max_query_cost: 10,
+            ..Default::default()
+        });
+        let state = Arc::new(state);
+
+        let expensive = r#"{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_call_graph","arguments":{"symbol_name":"main","depth":5}}}"#;
+        let response = jsonrpc_handler(
+            State(Arc::clone(&state)),
+            None,
+            HeaderMap::new(),
+            Bytes::from(expensive),
+        )
+        .await
+        .into_response();
+        assert_eq!(response.status(), StatusCode::OK);
+        let body = to_bytes(response.into_body(), usize::MAX).await.unwrap();
+        let parsed: Value = serde_json::from_slice(&body).unwrap();
+        let text = parsed["result"]["content"][0]["text"].as_str().unwrap();
+        let payload: Value = serde_json::from_str(text).unwrap();
+        assert_eq!(payload["error"]["code"], "query_too_expensive");
+
+        let list = r#"{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}"#;
+        let first = jsonrpc_handler(
+            State(Arc::clone(&state)),
+            None,
+            HeaderMap::new(),
+            Bytes::from(list),
+        )
+        .await
+        .into_response();
+        assert_eq!(first.status(), StatusCode::OK);
+        let second = jsonrpc_handler(State(state), None, HeaderMap::new(), Bytes::from(list))
+            .await
+            .into_response();
+        assert_eq!(second.status(), StatusCode::TOO_MANY_REQUESTS);
+    }
+
+    #[tokio::test]
+    async fn tool_calls_are_written_to_the_audit_log() {
+        use axum::body::Bytes;
+
+        let tmp = tempfile::tempdir().unwrap();
+        let audit_path = tmp.path().join("audit.log");
+        let mut state = build_test_state(tmp.path(), Config::default());
+        state.audit = Some(Arc::new(AuditLog::open(&audit_path).unwrap()));
+        let state = Arc::new(state);
+
+        for request in [
+            r#"{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}"#,
+            r#"{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"search_code","arguments":{"query":"ValidateToken","ref":"main"}}}"#,
+        ] {
+            jsonrpc_handler(
+                State(Arc::clone(&state)),
+                None,
+                HeaderMap::new(),
+                Bytes::from(request),
+            )
+            .await
+            .into_response();
+        }
+
+        let content = std::fs::read_to_string(&audit_path).unwrap();
+        let lines: Vec<&str> = content.lines().collect();
+        assert_eq!(lines.len(), 1, "only tool calls are audited");
+        let entry: Value = serde_json::from_str(lines[0]).unwrap();
+        assert_eq!(entry["action"], "query");
+        assert_eq!(entry["client"], "unknown");
+        assert_eq!(entry["operation"], "search_code");
+        assert_eq!(entry["arguments"]["query"], "ValidateToken");
+        assert_eq!(entry["project_id"], state.project_id.as_str());
+        assert!(entry["outcome"].is_string());
+        assert_eq!(cruxe_core::audit::verify(&audit_path).unwrap(), 1);
+    }
+
     #[tokio::test]
     async fn jsonrpc_invalid_json_returns_bad_request() {
         use axum::body::{Bytes, to_bytes};
@@ -631,10 +1025,14 @@ mod tests {
         let tmp = tempfile::tempdir().unwrap();
         let state = Arc::new(build_test_state(tmp.path(), Config::default()));
 
-        let response =
-            jsonrpc_handler(State(state), HeaderMap::new(), Bytes::from("{invalid-json"))
-                .await
-                .into_response();
+        let response = jsonrpc_handler(
+            State(state),
+            None,
+            HeaderMap::new(),
+            Bytes::from("{invalid-json"),
+        )
+        .await
+        .into_response();
         assert_eq!(response.status(), StatusCode::BAD_REQUEST);
 
         let body = to_bytes(response.into_body(), usize::MAX).await.unwrap();
@@ -696,6 +1094,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let request = JsonRpcRequest {
@@ -818,6 +1219,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let http_health = build_health_response(&state);
@@ -903,6 +1307,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let http_request = JsonRpcRequest {
@@ -1071,6 +1478,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let health = build_health_response(&state);
@@ -1167,6 +1577,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let mut samples = Vec::new();
@@ -1233,6 +1646,9 @@ mod tests {
             health_cache: Arc::new(Mutex::new(None)),
             server_start: Instant::now(),
             router,
+            limits: ServerLimits::default(),
+            audit: None,
+            subscriptions: Subscriptions::default(),
         };
 
         let mut samples = Vec::new();
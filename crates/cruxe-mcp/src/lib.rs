@@ -1,7 +1,21 @@
+mod api_guard;
+pub mod access;
+pub mod batch;
+pub mod daemon;
+pub mod editor;
+pub mod graph_server;
+pub mod grpc;
 pub mod http;
 mod index_launcher;
+pub mod limits;
+pub mod lsp;
+pub mod metrics;
 pub mod notifications;
 pub mod protocol;
+pub mod rest;
 pub mod server;
+pub mod sse;
+pub mod subscribe;
+pub mod tenants;
 pub mod tools;
 pub mod workspace_router;
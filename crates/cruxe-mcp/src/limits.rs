@@ -0,0 +1,294 @@
+//! Request admission for the HTTP transport: per-client rate limits,
+//! per-query cost estimation, and query timeouts (`[server.limits]`).
+//!
+//! Every tool call gets an estimated cost from its tool and the arguments
+//! that widen its work (`limit`, `depth`, token budgets). A request costing
+//! more than `max_query_cost` is refused outright; otherwise its cost is
+//! charged to the client's per-minute budget alongside the request count.
+
+use crate::protocol::JsonRpcRequest;
+use axum::Json;
+use axum::http::{StatusCode, header};
+use axum::response::{IntoResponse, Response};
+use cruxe_core::config::ServerLimitsConfig;
+use cruxe_core::error::ProtocolErrorCode;
+use serde_json::{Value, json};
+use std::collections::HashMap;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+pub(crate) const RATE_WINDOW: Duration = Duration::from_secs(60);
+
+/// Expired client windows are swept once this many clients are tracked.
+const MAX_TRACKED_CLIENTS: usize = 4096;
+
+/// Base cost per tool; unlisted tools and non-tool methods cost 1.
+const TOOL_COSTS: &[(&str, u32)] = &[
+    ("search_code", 2),
+    ("find_references", 3),
+    ("find_related_symbols", 3),
+    ("get_symbol_hierarchy", 3),
+    ("explain_ranking", 3),
+    ("get_call_graph", 4),
+    ("get_code_context", 4),
+    ("compare_symbol_between_commits", 6),
+    ("build_context_pack", 8),
+    ("diff_context", 8),
+    ("sync_repo", 10),
+    ("index_repo", 20),
+];
+
+/// Result-count arguments; each started block of 20 multiplies the cost.
+const COUNT_ARGS: &[&str] = &["limit", "max_candidates"];
+
+/// Token budget arguments; each started block of 4000 multiplies the cost.
+const TOKEN_ARGS: &[&str] = &["max_tokens", "budget_tokens"];
+
+/// Matches the clamp applied by `get_call_graph`.
+const MAX_GRAPH_DEPTH: u64 = 5;
+
+/// Why a request was turned away before reaching a tool.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Rejection {
+    Unauthorized,
+    RateLimited,
+    TooManyConcurrent,
+    ClientRateLimited,
+    ClientCostExceeded,
+    TooManySubscribers,
+}
+
+impl Rejection {
+    fn status(self) -> StatusCode {
+        match self {
+            Self::Unauthorized => StatusCode::UNAUTHORIZED,
+            _ => StatusCode::TOO_MANY_REQUESTS,
+        }
+    }
+
+    pub(crate) fn code(self) -> ProtocolErrorCode {
+        match self {
+            Self::Unauthorized => ProtocolErrorCode::Unauthorized,
+            _ => ProtocolErrorCode::QuotaExceeded,
+        }
+    }
+
+    pub(crate) fn message(self) -> &'static str {
+        match self {
+            Self::Unauthorized => "missing or unknown bearer token",
+            Self::RateLimited => "tenant request rate quota exceeded",
+            Self::TooManyConcurrent => "tenant concurrent request quota exceeded",
+            Self::ClientRateLimited => "client request rate limit exceeded",
+            Self::ClientCostExceeded => "client query cost budget exceeded",
+            Self::TooManySubscribers => "graph subscription limit reached",
+        }
+    }
+}
+
+impl IntoResponse for Rejection {
+    fn into_response(self) -> Response {
+        let body = json!({
+            "error": {
+                "code": self.code().as_str(),
+                "message": self.message(),
+            }
+        });
+        let mut response = (self.status(), Json(body)).into_response();
+        if self == Self::Unauthorized {
+            response.headers_mut().insert(
+                header::WWW_AUTHENTICATE,
+                header::HeaderValue::from_static("Bearer"),
+            );
+        }
+        response
+    }
+}
+
+#[derive(Debug)]
+struct ClientWindow {
+    started: Instant,
+    requests: u32,
+    cost: u32,
+}
+
+/// Runtime form of [`ServerLimitsConfig`] with per-client windows.
+#[derive(Debug, Default)]
+pub struct ServerLimits {
+    requests_per_minute: u32,
+    cost_per_minute: u32,
+    max_query_cost: u32,
+    timeout: Option<Duration>,
+    clients: Mutex<HashMap<String, ClientWindow>>,
+}
+
+impl ServerLimits {
+    pub fn from_config(config: &ServerLimitsConfig) -> Self {
+        Self {
+            requests_per_minute: config.client_requests_per_minute,
+            cost_per_minute: config.client_cost_per_minute,
+            max_query_cost: config.max_query_cost,
+            timeout: (config.query_timeout_ms > 0)
+                .then(|| Duration::from_millis(config.query_timeout_ms)),
+            clients: Mutex::new(HashMap::new()),
+        }
+    }
+
+    pub fn timeout(&self) -> Option<Duration> {
+        self.timeout
+    }
+
+    /// The configured cap when `cost` exceeds it.
+    pub fn exceeds_max_cost(&self, cost: u32) -> Option<u32> {
+        (self.max_query_cost > 0 && cost > self.max_query_cost).then_some(self.max_query_cost)
+    }
+
+    /// Count one request of `cost` against `client`'s current window.
+    pub fn admit(&self, client: &str, cost: u32, now: Instant) -> Result<(), Rejection> {
+        if self.requests_per_minute == 0 && self.cost_per_minute == 0 {
+            return Ok(());
+        }
+        let mut clients = self.clients.lock().unwrap_or_else(|e| e.into_inner());
+        if clients.len() >= MAX_TRACKED_CLIENTS && !clients.contains_key(client) {
+            clients.retain(|_, window| now.duration_since(window.started) < RATE_WINDOW);
+        }
+        let window = clients
+            .entry(client.to_string())
+            .or_insert_with(|| ClientWindow {
+                started: now,
+                requests: 0,
+                cost: 0,
+            });
+        if now.duration_since(window.started) >= RATE_WINDOW {
+            *window = ClientWindow {
+                started: now,
+                requests: 0,
+                cost: 0,
+            };
+        }
+        if self.requests_per_minute > 0 && window.requests >= self.requests_per_minute {
+            return Err(Rejection::ClientRateLimited);
+        }
+        if self.cost_per_minute > 0 && window.cost.saturating_add(cost) > self.cost_per_minute {
+            return Err(Rejection::ClientCostExceeded);
+        }
+        window.requests += 1;
+        window.cost = window.cost.saturating_add(cost);
+        Ok(())
+    }
+}
+
+/// Estimated relative cost of executing `request`.
+pub fn estimate_cost(request: &JsonRpcRequest) -> u32 {
+    if request.method != "tools/call" {
+        return 1;
+    }
+    let tool = request
+        .params
+        .get("name")
+        .and_then(Value::as_str)
+        .unwrap_or("");
+    let base = TOOL_COSTS
+        .iter()
+        .find(|(name, _)| *name == tool)
+        .map_or(1, |(_, cost)| *cost) as u64;
+    let arguments = request.params.get("arguments");
+    let arg = |key: &str| {
+        arguments
+            .and_then(|args| args.get(key))
+            .and_then(Value::as_u64)
+    };
+
+    let mut cost = base;
+    for key in COUNT_ARGS {
+        if let Some(count) = arg(key) {
+            cost = cost.saturating_mul(count.div_ceil(20).max(1));
+        }
+    }
+    for key in TOKEN_ARGS {
+        if let Some(tokens) = arg(key) {
+            cost = cost.saturating_mul(tokens.div_ceil(4000).max(1));
+        }
+    }
+    if tool == "get_call_graph" {
+        // Each extra level can fan out again; both directions walk twice.
+        let depth = arg("depth").unwrap_or(1).clamp(1, MAX_GRAPH_DEPTH);
+        cost = cost.saturating_mul(1 << (depth - 1));
+        let direction = arguments
+            .and_then(|args| args.get("direction"))
+            .and_then(Value::as_str)
+            .unwrap_or("both");
+        if direction == "both" {
+            cost = cost.saturating_mul(2);
+        }
+    }
+    cost.min(u32::MAX as u64) as u32
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn call(tool: &str, arguments: Value) -> JsonRpcRequest {
+        JsonRpcRequest {
+            jsonrpc: "2.0".into(),
+            id: Some(json!(1)),
+            method: "tools/call".into(),
+            params: json!({"name": tool, "arguments": arguments}),
+        }
+    }
+
+    fn limits(requests: u32, cost: u32) -> ServerLimits {
+        ServerLimits::from_config(&ServerLimitsConfig {
+            client_requests_per_minute: requests,
+            client_cost_per_minute: cost,
+            max_query_cost: 100,
+            query_timeout_ms: 0,
+        })
+    }
+
+    #[test]
+    fn cost_grows_with_depth_limit_and_budget() {
+        let list = JsonRpcRequest {
+            jsonrpc: "2.0".into(),
+            id: None,
+            method: "tools/list".into(),
+            params: json!({}),
+        };
+        assert_eq!(estimate_cost(&list), 1);
+        assert_eq!(estimate_cost(&call("locate_symbol", json!({}))), 1);
+        assert_eq!(estimate_cost(&call("search_code", json!({"limit": 50}))), 6);
+        assert_eq!(
+            estimate_cost(&call("get_code_context", json!({"max_tokens": 8000}))),
+            8
+        );
+
+        let shallow = estimate_cost(&call(
+            "get_call_graph",
+            json!({"depth": 1, "direction": "callers"}),
+        ));
+        let deep = estimate_cost(&call("get_call_graph", json!({"depth": 50, "limit": 200})));
+        assert_eq!(shallow, 4);
+        assert_eq!(deep, 4 * 10 * 16 * 2);
+        assert_eq!(limits(0, 0).exceeds_max_cost(deep), Some(100));
+        assert_eq!(limits(0, 0).exceeds_max_cost(shallow), None);
+    }
+
+    #[test]
+    fn clients_have_separate_request_and_cost_windows() {
+        let start = Instant::now();
+        let rate = limits(2, 0);
+        assert!(rate.admit("a", 1, start).is_ok());
+        assert!(rate.admit("a", 1, start).is_ok());
+        assert_eq!(rate.admit("a", 1, start), Err(Rejection::ClientRateLimited));
+        assert!(rate.admit("b", 1, start).is_ok());
+        assert!(rate.admit("a", 1, start + RATE_WINDOW).is_ok());
+
+        let budget = limits(0, 10);
+        assert!(budget.admit("a", 8, start).is_ok());
+        assert_eq!(
+            budget.admit("a", 4, start),
+            Err(Rejection::ClientCostExceeded)
+        );
+        assert!(budget.admit("a", 2, start).is_ok());
+    }
+}
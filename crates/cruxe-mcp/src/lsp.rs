@@ -0,0 +1,870 @@
+//! `cruxe lsp`: a Language Server Protocol server on stdin/stdout that
+//! answers navigation requests from the index, so an editor gets the same
+//! definitions, references and call graph in every indexed language.
+//!
+//! Supported requests:
+//!
+//! - `textDocument/definition` and `textDocument/references`
+//! - `textDocument/documentSymbol` and `workspace/symbol`
+//! - `textDocument/prepareCallHierarchy`, `callHierarchy/incomingCalls`
+//!   and `callHierarchy/outgoingCalls`
+//!
+//! Parameters and locals resolve to their own declaration, and their
+//! references are the uses their scope binds.
+//!
+//! Answers reflect the index for the session ref and the files on disk,
+//! not unsaved editor buffers, so no document sync is offered. Keep the
+//! index current with `cruxe watch` or `cruxe daemon`.
+
+use crate::protocol::{JsonRpcRequest, JsonRpcResponse};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, generate_project_id};
+use cruxe_query::call_graph::{self, CallGraphDirection, CallGraphError, CallGraphRequest};
+use cruxe_query::fuzzy::{self, SymbolFilter};
+use cruxe_query::goto_definition::{self, DefinitionLookup, GotoDefinitionError, Position};
+use cruxe_query::locals;
+use cruxe_query::ref_sites::{self, RefKind};
+use cruxe_state::symbols::{self, OutlineSymbol};
+use rusqlite::Connection;
+use serde::Deserialize;
+use serde::de::DeserializeOwned;
+use serde_json::{Map, Value, json};
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::io::{self, BufRead, Write};
+use std::path::{Path, PathBuf};
+
+/// Symbols returned for one `workspace/symbol` query.
+const WORKSPACE_SYMBOL_LIMIT: usize = 100;
+/// Edges fetched for one incoming or outgoing call hierarchy request.
+const CALL_HIERARCHY_LIMIT: usize = 200;
+
+const PARSE_ERROR: i32 = -32700;
+const INVALID_REQUEST: i32 = -32600;
+const METHOD_NOT_FOUND: i32 = -32601;
+const INVALID_PARAMS: i32 = -32602;
+const INTERNAL_ERROR: i32 = -32603;
+
+#[derive(Debug)]
+enum LspError {
+    InvalidParams(String),
+    Internal(String),
+}
+
+impl From<StateError> for LspError {
+    fn from(e: StateError) -> Self {
+        Self::Internal(e.to_string())
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct TextDocumentIdentifier {
+    uri: String,
+}
+
+#[derive(Debug, Clone, Copy, Deserialize)]
+struct LspPosition {
+    line: u32,
+    character: u32,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct TextDocumentPositionParams {
+    text_document: TextDocumentIdentifier,
+    position: LspPosition,
+}
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct ReferenceContext {
+    #[serde(default)]
+    include_declaration: bool,
+}
+
+#[derive(Debug, Deserialize)]
+struct ReferenceParams {
+    #[serde(flatten)]
+    position: TextDocumentPositionParams,
+    #[serde(default)]
+    context: ReferenceContext,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct DocumentSymbolParams {
+    text_document: TextDocumentIdentifier,
+}
+
+#[derive(Debug, Deserialize)]
+struct WorkspaceSymbolParams {
+    query: String,
+}
+
+/// What a call hierarchy item carries between `prepareCallHierarchy` and
+/// the incoming/outgoing requests.
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct CallItemData {
+    qualified_name: String,
+    path: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct CallHierarchyItem {
+    data: CallItemData,
+}
+
+#[derive(Debug, Deserialize)]
+struct CallHierarchyCallsParams {
+    item: CallHierarchyItem,
+}
+
+/// The fields of an indexed symbol an LSP item is built from.
+struct SymbolSpan<'a> {
+    name: &'a str,
+    qualified_name: &'a str,
+    kind: &'a str,
+    path: &'a str,
+    line_start: u32,
+    line_end: u32,
+}
+
+/// File lines read on demand, to convert between the index's 1-based
+/// character columns and LSP's 0-based UTF-16 ones.
+struct Sources<'a> {
+    workspace: &'a Path,
+    files: RefCell<HashMap<String, Vec<String>>>,
+}
+
+impl<'a> Sources<'a> {
+    fn new(workspace: &'a Path) -> Self {
+        Self {
+            workspace,
+            files: RefCell::new(HashMap::new()),
+        }
+    }
+
+    /// The text of 1-based `line` of `path`, if the file is readable.
+    fn line(&self, path: &str, line: u32) -> Option<String> {
+        let mut files = self.files.borrow_mut();
+        let lines = files.entry(path.to_string()).or_insert_with(|| {
+            std::fs::read_to_string(self.workspace.join(path))
+                .map(|content| content.lines().map(str::to_string).collect())
+                .unwrap_or_default()
+        });
+        lines.get((line as usize).checked_sub(1)?).cloned()
+    }
+
+    /// The 1-based character column at UTF-16 offset `character`.
+    fn char_column(&self, path: &str, line: u32, character: u32) -> u32 {
+        let Some(text) = self.line(path, line) else {
+            return character + 1;
+        };
+        let mut units = 0;
+        let mut column = 1;
+        for c in text.chars() {
+            if units >= character as usize {
+                break;
+            }
+            units += c.len_utf16();
+            column += 1;
+        }
+        column
+    }
+
+    /// The UTF-16 offset of 1-based character `column`.
+    fn utf16_offset(&self, path: &str, line: u32, column: u32) -> u32 {
+        let chars = column.saturating_sub(1) as usize;
+        match self.line(path, line) {
+            Some(text) => text.chars().take(chars).map(char::len_utf16).sum::<usize>() as u32,
+            None => chars as u32,
+        }
+    }
+
+    /// The range of the first `name` on 1-based `line`, or an empty range
+    /// at the start of the line when it does not appear there.
+    fn name_range(&self, path: &str, line: u32, name: &str) -> Value {
+        let lsp_line = line.saturating_sub(1);
+        let span = self.line(path, line).and_then(|text| {
+            let offset = text.find(name)?;
+            let start = text[..offset].encode_utf16().count() as u32;
+            Some((start, start + name.encode_utf16().count() as u32))
+        });
+        let (start, end) = span.unwrap_or((0, 0));
+        range(lsp_line, start, lsp_line, end)
+    }
+}
+
+fn range(start_line: u32, start: u32, end_line: u32, end: u32) -> Value {
+    json!({
+        "start": { "line": start_line, "character": start },
+        "end": { "line": end_line, "character": end },
+    })
+}
+
+/// Whole lines `line_start..=line_end`, ending at the start of the next line.
+fn span_range(line_start: u32, line_end: u32) -> Value {
+    range(line_start.saturating_sub(1), 0, line_end.max(line_start), 0)
+}
+
+/// LSP `SymbolKind` for an indexed kind.
+fn lsp_symbol_kind(kind: &str) -> u8 {
+    match SymbolKind::parse_kind(kind) {
+        Some(SymbolKind::Module) => 2,
+        Some(SymbolKind::Class | SymbolKind::TypeAlias) => 5,
+        Some(SymbolKind::Method) => 6,
+        Some(SymbolKind::Enum) => 10,
+        Some(SymbolKind::Interface | SymbolKind::Trait) => 11,
+        Some(SymbolKind::Function) => 12,
+        Some(SymbolKind::Variable) | None => 13,
+        Some(SymbolKind::Constant) => 14,
+        Some(SymbolKind::Struct) => 23,
+    }
+}
+
+/// `auth::token` for `auth::token::validate`, `pkg.Type` for
+/// `pkg.Type.Method`.
+fn container_name(qualified_name: &str) -> Option<&str> {
+    qualified_name
+        .rsplit_once("::")
+        .or_else(|| qualified_name.rsplit_once('.'))
+        .map(|(container, _)| container)
+}
+
+fn percent_encode(path: &str) -> String {
+    let mut encoded = String::with_capacity(path.len());
+    for byte in path.bytes() {
+        if byte.is_ascii_alphanumeric() || b"-._~/".contains(&byte) {
+            encoded.push(byte as char);
+        } else {
+            encoded.push_str(&format!("%{byte:02X}"));
+        }
+    }
+    encoded
+}
+
+fn percent_decode(text: &str) -> String {
+    let bytes = text.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        let hex = bytes
+            .get(i + 1..i + 3)
+            .and_then(|hex| std::str::from_utf8(hex).ok())
+            .and_then(|hex| u8::from_str_radix(hex, 16).ok());
+        match (bytes[i], hex) {
+            (b'%', Some(byte)) => {
+                decoded.push(byte);
+                i += 3;
+            }
+            (byte, _) => {
+                decoded.push(byte);
+                i += 1;
+            }
+        }
+    }
+    String::from_utf8_lossy(&decoded).into_owned()
+}
+
+fn params<T: DeserializeOwned>(params: &Value) -> Result<T, LspError> {
+    serde_json::from_value(params.clone()).map_err(|e| LspError::InvalidParams(e.to_string()))
+}
+
+fn capabilities() -> Value {
+    json!({
+        "capabilities": {
+            "definitionProvider": true,
+            "referencesProvider": true,
+            "documentSymbolProvider": true,
+            "workspaceSymbolProvider": true,
+            "callHierarchyProvider": true,
+        },
+        "serverInfo": { "name": "cruxe", "version": env!("CARGO_PKG_VERSION") },
+    })
+}
+
+/// The index connection and scope shared by every request of a session.
+pub struct LspSession {
+    workspace: PathBuf,
+    project_id: String,
+    ref_name: String,
+    conn: Connection,
+}
+
+impl LspSession {
+    pub fn open(
+        workspace: &Path,
+        config_file: Option<&Path>,
+        ref_name: &str,
+    ) -> Result<Self, Box<dyn std::error::Error>> {
+        let config = Config::load_with_file(Some(workspace), config_file)?;
+        let project_id = generate_project_id(&workspace.to_string_lossy());
+        let conn = cruxe_state::db::open_for_query(
+            &config
+                .project_data_dir(&project_id)
+                .join(constants::STATE_DB_FILE),
+            config.storage.busy_timeout_ms,
+            config.storage.cache_size,
+            config.storage.mmap_size,
+        )?;
+        Ok(Self {
+            workspace: workspace.to_path_buf(),
+            project_id,
+            ref_name: ref_name.to_string(),
+            conn,
+        })
+    }
+
+    /// Answer one message. Notifications get no response.
+    pub fn handle(&self, request: &JsonRpcRequest) -> Option<JsonRpcResponse> {
+        let id = request.id.clone()?;
+        let sources = Sources::new(&self.workspace);
+        let result = match request.method.as_str() {
+            "initialize" => Ok(capabilities()),
+            "shutdown" => Ok(Value::Null),
+            "textDocument/definition" => self.definition(&request.params, &sources),
+            "textDocument/references" => self.references(&request.params, &sources),
+            "textDocument/documentSymbol" => self.document_symbols(&request.params, &sources),
+            "workspace/symbol" => self.workspace_symbols(&request.params),
+            "textDocument/prepareCallHierarchy" => {
+                self.prepare_call_hierarchy(&request.params, &sources)
+            }
+            "callHierarchy/incomingCalls" => {
+                self.calls(&request.params, CallGraphDirection::Callers, &sources)
+            }
+            "callHierarchy/outgoingCalls" => {
+                self.calls(&request.params, CallGraphDirection::Callees, &sources)
+            }
+            method => {
+                return Some(JsonRpcResponse::error(
+                    Some(id),
+                    METHOD_NOT_FOUND,
+                    format!("unsupported method `{method}`"),
+                ));
+            }
+        };
+        Some(match result {
+            Ok(result) => JsonRpcResponse::success(Some(id), result),
+            Err(LspError::InvalidParams(message)) => {
+                JsonRpcResponse::error(Some(id), INVALID_PARAMS, message)
+            }
+            Err(LspError::Internal(message)) => {
+                JsonRpcResponse::error(Some(id), INTERNAL_ERROR, message)
+            }
+        })
+    }
+
+    fn uri(&self, path: &str) -> String {
+        format!(
+            "file://{}",
+            percent_encode(&self.workspace.join(path).to_string_lossy())
+        )
+    }
+
+    /// The workspace-relative path of a `file://` URI inside the workspace.
+    fn relative_path(&self, uri: &str) -> Option<String> {
+        let path = percent_decode(uri.strip_prefix("file://")?);
+        let relative = Path::new(&path).strip_prefix(&self.workspace).ok()?;
+        Some(relative.to_string_lossy().replace('\\', "/"))
+    }
+
+    fn location(&self, path: &str, range: Value) -> Value {
+        json!({ "uri": self.uri(path), "range": range })
+    }
+
+    /// Resolve the identifier under an LSP position; `None` when there is
+    /// none or the file is outside the workspace or unreadable.
+    fn lookup(
+        &self,
+        params: &TextDocumentPositionParams,
+        sources: &Sources<'_>,
+    ) -> Result<Option<DefinitionLookup>, LspError> {
+        let Some(path) = self.relative_path(&params.text_document.uri) else {
+            return Ok(None);
+        };
+        let line = params.position.line + 1;
+        let position = Position {
+            column: sources.char_column(&path, line, params.position.character),
+            path,
+            line,
+        };
+        match goto_definition::goto_definition(
+            &self.conn,
+            &self.workspace,
+            &self.project_id,
+            &self.ref_name,
+            &position,
+        ) {
+            Ok(lookup) => Ok(Some(lookup)),
+            Err(GotoDefinitionError::State(e)) => Err(e.into()),
+            Err(_) => Ok(None),
+        }
+    }
+
+    fn definition(&self, params: &Value, sources: &Sources<'_>) -> Result<Value, LspError> {
+        let params: TextDocumentPositionParams = self::params(params)?;
+        let Some(lookup) = self.lookup(&params, sources)? else {
+            return Ok(Value::Null);
+        };
+        Ok(lookup
+            .definitions
+            .iter()
+            .map(|hit| {
+                let range = match hit.column {
+                    Some(column) => {
+                        let line = hit.line_start - 1;
+                        let end = column + hit.name.chars().count() as u32;
+                        range(
+                            line,
+                            sources.utf16_offset(&hit.path, hit.line_start, column),
+                            line,
+                            sources.utf16_offset(&hit.path, hit.line_start, end),
+                        )
+                    }
+                    None => sources.name_range(&hit.path, hit.line_start, &hit.name),
+                };
+                self.location(&hit.path, range)
+            })
+            .collect())
+    }
+
+    fn references(&self, params: &Value, sources: &Sources<'_>) -> Result<Value, LspError> {
+        let params: ReferenceParams = self::params(params)?;
+        let Some(lookup) = self.lookup(&params.position, sources)? else {
+            return Ok(json!([]));
+        };
+        let sites = match lookup.definitions.as_slice() {
+            // A local's references are the uses recorded for its binding.
+            [definition] if definition.column.is_some() => {
+                let local = locals::local_at(
+                    &self.conn,
+                    &self.project_id,
+                    &self.ref_name,
+                    &definition.path,
+                    definition.line_start,
+                    definition.column.unwrap_or_default(),
+                )?;
+                ref_sites::local_reference_sites(
+                    &self.conn,
+                    &self.workspace,
+                    &self.project_id,
+                    &self.ref_name,
+                    local.as_slice(),
+                )?
+            }
+            definitions => {
+                // A single definition narrows the scan to its qualified name.
+                let symbol = match definitions {
+                    [definition] => definition.qualified_name.as_str(),
+                    _ => lookup.identifier.as_str(),
+                };
+                ref_sites::find_reference_sites(
+                    &self.conn,
+                    &self.workspace,
+                    &self.project_id,
+                    &self.ref_name,
+                    symbol,
+                    &[],
+                )?
+                .references
+            }
+        };
+        Ok(sites
+            .iter()
+            .filter(|site| params.context.include_declaration || site.kind != RefKind::Definition)
+            .map(|site| {
+                let line = site.line - 1;
+                let range = range(
+                    line,
+                    sources.utf16_offset(&site.path, site.line, site.column),
+                    line,
+                    sources.utf16_offset(&site.path, site.line, site.end_column),
+                );
+                self.location(&site.path, range)
+            })
+            .collect())
+    }
+
+    fn document_symbols(&self, params: &Value, sources: &Sources<'_>) -> Result<Value, LspError> {
+        let params: DocumentSymbolParams = self::params(params)?;
+        let Some(path) = self.relative_path(&params.text_document.uri) else {
+            return Ok(json!([]));
+        };
+        let outline = symbols::get_file_outline_query(
+            &self.conn,
+            &self.project_id,
+            &self.ref_name,
+            &path,
+            false,
+        )?;
+        Ok(symbols::build_symbol_tree(outline)
+            .iter()
+            .map(|symbol| document_symbol(sources, &path, symbol))
+            .collect())
+    }
+
+    fn workspace_symbols(&self, params: &Value) -> Result<Value, LspError> {
+        let params: WorkspaceSymbolParams = self::params(params)?;
+        if params.query.trim().is_empty() {
+            return Ok(json!([]));
+        }
+        let hits = fuzzy::search_symbols(
+            &self.conn,
+            &self.project_id,
+            &self.ref_name,
+            params.query.trim(),
+            &SymbolFilter::default(),
+            WORKSPACE_SYMBOL_LIMIT,
+        )?;
+        Ok(hits
+            .into_iter()
+            .filter_map(|hit| {
+                let name = hit.name?;
+                let mut symbol = json!({
+                    "name": name,
+                    "kind": lsp_symbol_kind(hit.kind.as_deref().unwrap_or_default()),
+                    "location": self.location(&hit.path, span_range(hit.line_start, hit.line_end)),
+                });
+                if let Some(container) = hit.qualified_name.as_deref().and_then(container_name) {
+                    symbol["containerName"] = json!(container);
+                }
+                Some(symbol)
+            })
+            .collect())
+    }
+
+    fn call_item(&self, sources: &Sources<'_>, symbol: &SymbolSpan<'_>) -> Value {
+        json!({
+            "name": symbol.name,
+            "kind": lsp_symbol_kind(symbol.kind),
+            "detail": symbol.qualified_name,
+            "uri": self.uri(symbol.path),
+            "range": span_range(symbol.line_start, symbol.line_end),
+            "selectionRange": sources.name_range(symbol.path, symbol.line_start, symbol.name),
+            "data": { "qualifiedName": symbol.qualified_name, "path": symbol.path },
+        })
+    }
+
+    fn prepare_call_hierarchy(
+        &self,
+        params: &Value,
+        sources: &Sources<'_>,
+    ) -> Result<Value, LspError> {
+        let params: TextDocumentPositionParams = self::params(params)?;
+        let Some(lookup) = self.lookup(&params, sources)? else {
+            return Ok(Value::Null);
+        };
+        Ok(lookup
+            .definitions
+            .iter()
+            .map(|hit| {
+                self.call_item(
+                    sources,
+                    &SymbolSpan {
+                        name: &hit.name,
+                        qualified_name: &hit.qualified_name,
+                        kind: &hit.kind,
+                        path: &hit.path,
+                        line_start: hit.line_start,
+                        line_end: hit.line_end,
+                    },
+                )
+            })
+            .collect())
+    }
+
+    /// Incoming (`Callers`) or outgoing (`Callees`) calls of an item, one
+    /// entry per calling or called symbol with every call site in it.
+    fn calls(
+        &self,
+        params: &Value,
+        direction: CallGraphDirection,
+        sources: &Sources<'_>,
+    ) -> Result<Value, LspError> {
+        let params: CallHierarchyCallsParams = self::params(params)?;
+        let item = params.item.data;
+        let request = CallGraphRequest {
+            symbol_name: &item.qualified_name,
+            path: Some(&item.path),
+            direction,
+            depth: 1,
+            limit: CALL_HIERARCHY_LIMIT,
+        };
+        let graph = match call_graph::get_call_graph(
+            &self.conn,
+            &self.project_id,
+            &self.ref_name,
+            &request,
+        ) {
+            Ok(graph) => graph,
+            Err(CallGraphError::SymbolNotFound) => return Ok(json!([])),
+            Err(CallGraphError::State(e)) => return Err(e.into()),
+        };
+        let (edges, key) = match direction {
+            CallGraphDirection::Callers => (&graph.callers, "from"),
+            _ => (&graph.callees, "to"),
+        };
+
+        let mut groups: Vec<(&call_graph::CallGraphSymbol, Vec<Value>)> = Vec::new();
+        for edge in edges {
+            // Call sites are in the caller; highlight the callee's name there.
+            let callee = match direction {
+                CallGraphDirection::Callers => &graph.symbol.name,
+                _ => &edge.symbol.name,
+            };
+            let range = sources.name_range(&edge.call_site.file, edge.call_site.line, callee);
+            match groups
+                .iter_mut()
+                .find(|(symbol, _)| symbol.symbol_stable_id == edge.symbol.symbol_stable_id)
+            {
+                Some((_, ranges)) => ranges.push(range),
+                None => groups.push((&edge.symbol, vec![range])),
+            }
+        }
+        Ok(groups
+            .into_iter()
+            .map(|(symbol, ranges)| {
+                let item = self.call_item(
+                    sources,
+                    &SymbolSpan {
+                        name: &symbol.name,
+                        qualified_name: &symbol.qualified_name,
+                        kind: &symbol.kind,
+                        path: &symbol.path,
+                        line_start: symbol.line_start,
+                        line_end: symbol.line_end,
+                    },
+                );
+                let mut call = Map::new();
+                call.insert(key.to_string(), item);
+                call.insert("fromRanges".to_string(), Value::Array(ranges));
+                Value::Object(call)
+            })
+            .collect())
+    }
+}
+
+fn document_symbol(sources: &Sources<'_>, path: &str, symbol: &OutlineSymbol) -> Value {
+    let mut document_symbol = json!({
+        "name": symbol.name,
+        "kind": lsp_symbol_kind(&symbol.kind),
+        "range": span_range(symbol.line_start, symbol.line_end),
+        "selectionRange": sources.name_range(path, symbol.line_start, &symbol.name),
+        "children": symbol
+            .children
+            .iter()
+            .map(|child| document_symbol(sources, path, child))
+            .collect::<Vec<_>>(),
+    });
+    if let Some(signature) = &symbol.signature {
+        document_symbol["detail"] = json!(signature.trim());
+    }
+    document_symbol
+}
+
+/// Read one `Content-Length`-framed message body; `None` at end of input.
+pub(crate) fn read_message<R: BufRead>(input: &mut R) -> io::Result<Option<Vec<u8>>> {
+    let mut content_length = None;
+    let length = loop {
+        let mut header = String::new();
+        if input.read_line(&mut header)? == 0 {
+            return Ok(None);
+        }
+        let header = header.trim_end();
+        if header.is_empty() {
+            match content_length {
+                Some(length) => break length,
+                None => continue,
+            }
+        }
+        if let Some((name, value)) = header.split_once(':')
+            && name.trim().eq_ignore_ascii_case("content-length")
+        {
+            let length = value.trim().parse::<usize>().map_err(|e| {
+                io::Error::new(
+                    io::ErrorKind::InvalidData,
+                    format!("invalid Content-Length `{}`: {e}", value.trim()),
+                )
+            })?;
+            content_length = Some(length);
+        }
+    };
+    let mut body = vec![0; length];
+    input.read_exact(&mut body)?;
+    Ok(Some(body))
+}
+
+pub(crate) fn write_message<W: Write>(
+    output: &mut W,
+    response: &JsonRpcResponse,
+) -> io::Result<()> {
+    let body = serde_json::to_vec(response)?;
+    write!(output, "Content-Length: {}\r\n\r\n", body.len())?;
+    output.write_all(&body)?;
+    output.flush()
+}
+
+/// Serve `input` until an `exit` notification or end of input. Returns
+/// whether the client sent `shutdown` first; the process should exit
+/// non-zero otherwise.
+pub fn run_lsp<R: BufRead, W: Write>(
+    session: &LspSession,
+    mut input: R,
+    mut output: W,
+) -> io::Result<bool> {
+    let mut shut_down = false;
+    while let Some(body) = read_message(&mut input)? {
+        let request: JsonRpcRequest = match serde_json::from_slice(&body) {
+            Ok(request) => request,
+            Err(e) => {
+                let response =
+                    JsonRpcResponse::error(None, PARSE_ERROR, format!("Parse error: {e}"));
+                write_message(&mut output, &response)?;
+                continue;
+            }
+        };
+        if request.method == "exit" {
+            return Ok(shut_down);
+        }
+        let response = if shut_down {
+            request.id.clone().map(|id| {
+                JsonRpcResponse::error(
+                    Some(id),
+                    INVALID_REQUEST,
+                    "server is shutting down".to_string(),
+                )
+            })
+        } else {
+            session.handle(&request)
+        };
+        shut_down |= request.method == "shutdown";
+        if let Some(response) = response {
+            write_message(&mut output, &response)?;
+        }
+    }
+    Ok(shut_down)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolRecord;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, kind: SymbolKind, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "src/pool.rs".to_string(),
+            language: "rust".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("crate::{name}"),
+            kind,
+            signature: None,
+            line_start: line,
+            line_end: line,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn session(workspace: &Path) -> LspSession {
+        std::fs::create_dir_all(workspace.join("src")).unwrap();
+        std::fs::write(
+            workspace.join("src/pool.rs"),
+            "pub struct Pool;\nfn use_pool(p: Pool) {}\n",
+        )
+        .unwrap();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        symbols::insert_symbol(&conn, &symbol("Pool", SymbolKind::Struct, 1)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("use_pool", SymbolKind::Function, 2)).unwrap();
+        LspSession {
+            workspace: workspace.to_path_buf(),
+            project_id: "repo".to_string(),
+            ref_name: "main".to_string(),
+            conn,
+        }
+    }
+
+    fn frame(message: Value) -> Vec<u8> {
+        let body = message.to_string();
+        format!("Content-Length: {}\r\n\r\n{}", body.len(), body).into_bytes()
+    }
+
+    #[test]
+    fn answers_framed_requests_until_exit() {
+        let tmp = tempfile::tempdir().unwrap();
+        let session = session(tmp.path());
+        let uri = session.uri("src/pool.rs");
+        let mut input = Vec::new();
+        for message in [
+            json!({"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}),
+            json!({"jsonrpc": "2.0", "method": "initialized", "params": {}}),
+            json!({"jsonrpc": "2.0", "id": 2, "method": "textDocument/definition", "params": {
+                "textDocument": {"uri": uri}, "position": {"line": 1, "character": 16}
+            }}),
+            json!({"jsonrpc": "2.0", "id": 3, "method": "textDocument/documentSymbol", "params": {
+                "textDocument": {"uri": uri}
+            }}),
+            json!({"jsonrpc": "2.0", "id": 4, "method": "workspace/symbol", "params": {
+                "query": "use_pool"
+            }}),
+            json!({"jsonrpc": "2.0", "id": 5, "method": "textDocument/hover", "params": {}}),
+            json!({"jsonrpc": "2.0", "id": 6, "method": "shutdown"}),
+            json!({"jsonrpc": "2.0", "method": "exit"}),
+        ] {
+            input.extend(frame(message));
+        }
+
+        let mut output = Vec::new();
+        let clean = run_lsp(&session, input.as_slice(), &mut output).unwrap();
+        assert!(clean);
+
+        let mut reader = output.as_slice();
+        let mut responses = Vec::new();
+        while let Some(body) = read_message(&mut reader).unwrap() {
+            responses.push(serde_json::from_slice::<Value>(&body).unwrap());
+        }
+        assert_eq!(responses.len(), 6, "notifications get no response");
+        assert_eq!(
+            responses[0]["result"]["capabilities"]["callHierarchyProvider"],
+            true
+        );
+
+        let definition = &responses[1]["result"][0];
+        assert_eq!(definition["uri"], uri);
+        assert_eq!(definition["range"], range(0, 11, 0, 15));
+
+        let outline = responses[2]["result"].as_array().unwrap();
+        assert_eq!(outline.len(), 2);
+        assert_eq!(outline[0]["name"], "Pool");
+        assert_eq!(outline[0]["kind"], 23);
+        assert_eq!(outline[1]["selectionRange"], range(1, 3, 1, 11));
+
+        assert_eq!(responses[3]["result"][0]["name"], "use_pool");
+        assert_eq!(responses[3]["result"][0]["containerName"], "crate");
+        assert_eq!(responses[4]["error"]["code"], METHOD_NOT_FOUND);
+        assert_eq!(responses[5]["result"], Value::Null);
+    }
+
+    #[test]
+    fn file_uris_round_trip_through_percent_encoding() {
+        let tmp = tempfile::tempdir().unwrap();
+        let session = session(tmp.path());
+        let uri = session.uri("src/my file#1.rs");
+        assert!(uri.ends_with("/src/my%20file%231.rs"));
+        assert_eq!(
+            session.relative_path(&uri).as_deref(),
+            Some("src/my file#1.rs")
+        );
+        assert_eq!(session.relative_path("file:///elsewhere/x.rs"), None);
+    }
+}
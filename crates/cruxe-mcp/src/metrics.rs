@@ -0,0 +1,203 @@
+//! `GET /metrics`: Prometheus metrics of an HTTP server or daemon.
+//!
+//! Latencies and cache counters accumulate in [`cruxe_core::metrics`] as
+//! requests are served; index size, files and symbols are read from each
+//! project's state when scraped, so they are current without the indexer
+//! having to report them.
+
+use crate::http::HttpState;
+use axum::extract::State;
+use axum::http::{StatusCode, header};
+use axum::response::{IntoResponse, Response};
+use cruxe_core::metrics::{Family, MetricKind, Sample};
+use std::path::Path;
+use std::sync::Arc;
+use tracing::warn;
+
+/// Content type of the Prometheus text exposition format.
+const CONTENT_TYPE: &str = "text/plain; version=0.0.4; charset=utf-8";
+
+/// GET /metrics — metrics of a single-project server.
+pub(crate) async fn metrics_handler(State(state): State<Arc<HttpState>>) -> Response {
+    metrics_response(vec![state]).await
+}
+
+/// Render the process metrics plus index gauges of `states`.
+pub(crate) async fn metrics_response(states: Vec<Arc<HttpState>>) -> Response {
+    match tokio::task::spawn_blocking(move || render(&states)).await {
+        Ok(body) => ([(header::CONTENT_TYPE, CONTENT_TYPE)], body).into_response(),
+        Err(e) => (
+            StatusCode::INTERNAL_SERVER_ERROR,
+            format!("internal error: {e}"),
+        )
+            .into_response(),
+    }
+}
+
+fn render(states: &[Arc<HttpState>]) -> String {
+    let mut files = Vec::new();
+    let mut symbols = Vec::new();
+    let mut size = Vec::new();
+    let mut uptime = Vec::new();
+    for state in states {
+        let project = || ("project", state.project_id.clone());
+        match index_counts(state) {
+            Ok(counts) => {
+                for (ref_name, file_count, symbol_count) in counts {
+                    files.push(Sample {
+                        labels: vec![project(), ("ref", ref_name.clone())],
+                        value: file_count as f64,
+                    });
+                    symbols.push(Sample {
+                        labels: vec![project(), ("ref", ref_name)],
+                        value: symbol_count as f64,
+                    });
+                }
+            }
+            Err(e) => warn!(project_id = %state.project_id, "Failed to read index counts: {}", e),
+        }
+        size.push(Sample {
+            labels: vec![project()],
+            value: directory_size(&state.data_dir) as f64,
+        });
+        uptime.push(Sample {
+            labels: vec![project()],
+            value: state.server_start.elapsed().as_secs_f64(),
+        });
+    }
+    cruxe_core::metrics::render(&[
+        Family {
+            name: "cruxe_index_files",
+            help: "Files in the index, by ref.",
+            kind: MetricKind::Gauge,
+            samples: files,
+        },
+        Family {
+            name: "cruxe_index_symbols",
+            help: "Symbols in the index, by ref.",
+            kind: MetricKind::Gauge,
+            samples: symbols,
+        },
+        Family {
+            name: "cruxe_index_size_bytes",
+            help: "Disk size of the project's index and state.",
+            kind: MetricKind::Gauge,
+            samples: size,
+        },
+        Family {
+            name: "cruxe_uptime_seconds",
+            help: "Seconds since the project's runtime was opened.",
+            kind: MetricKind::Gauge,
+            samples: uptime,
+        },
+    ])
+}
+
+/// `(ref, files, symbols)` of every indexed ref of the project.
+fn index_counts(state: &HttpState) -> Result<Vec<(String, u64, u64)>, String> {
+    if !state.db_path.exists() {
+        return Ok(Vec::new());
+    }
+    let handle = state
+        .connection_manager
+        .get_or_open(&state.db_path)
+        .map_err(|e| e.to_string())?;
+    let conn = handle.lock().map_err(|e| e.to_string())?;
+    let mut stmt = conn
+        .prepare(
+            "SELECT m.\"ref\", COUNT(*),
+                    (SELECT COUNT(*) FROM symbol_relations s
+                     WHERE s.repo = m.repo AND s.\"ref\" = m.\"ref\")
+             FROM file_manifest m
+             WHERE m.repo = ?1
+             GROUP BY m.\"ref\"
+             ORDER BY m.\"ref\"",
+        )
+        .map_err(|e| e.to_string())?;
+    let rows = stmt
+        .query_map([&state.project_id], |row| {
+            Ok((
+                row.get::<_, String>(0)?,
+                row.get::<_, i64>(1)? as u64,
+                row.get::<_, i64>(2)? as u64,
+            ))
+        })
+        .map_err(|e| e.to_string())?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(|e| e.to_string())
+}
+
+fn directory_size(dir: &Path) -> u64 {
+    let Ok(entries) = std::fs::read_dir(dir) else {
+        return 0;
+    };
+    entries
+        .flatten()
+        .map(|entry| match entry.file_type() {
+            Ok(file_type) if file_type.is_dir() => directory_size(&entry.path()),
+            Ok(file_type) if file_type.is_file() => entry.metadata().map_or(0, |m| m.len()),
+            _ => 0,
+        })
+        .sum()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::server::ConnectionManager;
+    use axum::body::to_bytes;
+    use cruxe_core::config::Config;
+    use cruxe_core::types::WorkspaceConfig;
+    use cruxe_state::manifest::{ManifestEntry, upsert_manifest};
+
+    #[tokio::test]
+    async fn metrics_report_index_gauges_per_ref() {
+        let workspace = tempfile::tempdir().unwrap();
+        let storage = tempfile::tempdir().unwrap();
+        let mut config = Config::default();
+        config.storage.data_dir = storage.path().to_string_lossy().to_string();
+        let state = crate::http::open_http_state(
+            workspace.path(),
+            config,
+            true,
+            WorkspaceConfig::default(),
+            ConnectionManager::new(),
+            None,
+        )
+        .unwrap();
+        std::fs::create_dir_all(&state.data_dir).unwrap();
+        let conn = cruxe_state::db::open_connection(&state.db_path).unwrap();
+        cruxe_state::schema::create_tables(&conn).unwrap();
+        for path in ["a.rs", "b.rs"] {
+            upsert_manifest(
+                &conn,
+                &ManifestEntry {
+                    repo: state.project_id.clone(),
+                    r#ref: "main".to_string(),
+                    path: path.to_string(),
+                    content_hash: "h".to_string(),
+                    size_bytes: 1,
+                    mtime_ns: None,
+                    language: Some("rust".to_string()),
+                    indexed_at: "2026-01-01T00:00:00Z".to_string(),
+                },
+            )
+            .unwrap();
+        }
+        drop(conn);
+
+        let response = metrics_response(vec![Arc::new(state)]).await;
+        assert_eq!(response.status(), StatusCode::OK);
+        assert_eq!(response.headers()[header::CONTENT_TYPE], CONTENT_TYPE);
+        let body = to_bytes(response.into_body(), usize::MAX).await.unwrap();
+        let text = String::from_utf8(body.to_vec()).unwrap();
+        assert!(
+            text.lines()
+                .any(|line| line.starts_with("cruxe_index_files{")
+                    && line.ends_with("ref=\"main\"} 2")),
+            "{text}"
+        );
+        assert!(text.contains("# TYPE cruxe_query_duration_seconds histogram"));
+        assert!(text.contains("# TYPE cruxe_index_size_bytes gauge"));
+    }
+}
@@ -0,0 +1,725 @@
+//! `cruxe serve --http`: a read-only REST API over one workspace's index, for
+//! internal tools that would otherwise shell out to the CLI.
+//!
+//! Routes (all `GET`, JSON responses, errors as `{error}` with a 4xx/5xx
+//! status; `ref` defaults to the ref resolved at start-up):
+//! - `/openapi.json` — OpenAPI 3 description of the routes below
+//! - `/api/v1/health` — `{status, repo, ref}`
+//! - `/api/v1/search?q=&lang=&limit=&ref=` — ranked code search
+//! - `/api/v1/definitions?name=&kind=&lang=&limit=&ref=` — symbols by name,
+//!   or `?position=<file>:<line>:<col>` to resolve the identifier there
+//! - `/api/v1/references?symbol=&kind=&limit=&ref=` — references to a symbol
+//! - `/api/v1/call-graph?symbol=&path=&direction=&depth=&limit=&ref=` —
+//!   callers and/or callees of a symbol
+//! - `/api/v1/findings?rule=&severity=&path=&limit=&ref=` — `cruxe check`
+//!   findings, filtered by rule, minimum severity and path prefix
+//!
+//! The same port serves the gRPC flavour of these queries; see
+//! [`crate::grpc`].
+//!
+//! `/api/v1` requests go through [`ApiGuard`]: with `[[server.api_keys]]`
+//! configured they need a bearer token, path parameters outside the key's
+//! `read_prefixes` are refused with 403, and result objects outside them are
+//! dropped and counted in `access_filtered_count`. Without keys the server
+//! only listens on loopback. `[server.limits]` and `[audit]` apply as they do
+//! to the JSON-RPC server.
+//!
+//! Every request opens its own read-only SQLite connection off the async
+//! runtime; the Tantivy indices are opened once and shared.
+
+use crate::access::{self, Grant};
+use crate::api_guard::{ApiCaller, ApiGuard};
+use crate::http::count_results;
+use axum::body::{Body, to_bytes};
+use axum::extract::{ConnectInfo, Query, Request, State};
+use axum::http::{StatusCode, header};
+use axum::middleware::{self, Next};
+use axum::response::{IntoResponse, Response};
+use axum::routing::get;
+use axum::{Json, Router};
+use cruxe_core::config::Config;
+use cruxe_core::constants;
+use cruxe_core::error::{ProtocolErrorCode, StateError};
+use cruxe_core::types::generate_project_id;
+use cruxe_query::call_graph::{self, CallGraphDirection, CallGraphError, CallGraphRequest};
+use cruxe_query::find_references::{self, FindReferencesError};
+use cruxe_query::findings::{self, Profile, RuleSet, Severity};
+use cruxe_query::goto_definition::{self, GotoDefinitionError, Position};
+use cruxe_query::{locate, search};
+use cruxe_state::tantivy_index::IndexSet;
+use rusqlite::Connection;
+use serde::Deserialize;
+use serde_json::{Value, json};
+use std::collections::BTreeMap;
+use std::net::SocketAddr;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::Instant;
+use tracing::{info, warn};
+
+const OPENAPI_SPEC: &str = include_str!("rest_openapi.json");
+
+const DEFAULT_LIMIT: usize = 20;
+const MAX_LIMIT: usize = 1000;
+
+#[derive(Debug, Clone)]
+pub struct RestServeOptions {
+    pub ref_name: String,
+    pub bind_addr: String,
+    pub port: u16,
+}
+
+/// Serve the API until the process is terminated.
+pub async fn run_rest_server(
+    workspace: &Path,
+    config_file: Option<&Path>,
+    options: RestServeOptions,
+) -> Result<(), Box<dyn std::error::Error>> {
+    let config = Config::load_with_file(Some(workspace), config_file)?;
+    let project_id = generate_project_id(&workspace.to_string_lossy());
+    let data_dir = config.project_data_dir(&project_id);
+    let guard = ApiGuard::from_config(&config, &project_id)?;
+    guard.check_bind(&options.bind_addr)?;
+    let index_set = IndexSet::open_existing(&data_dir)
+        .map_err(|e| format!("failed to open indices: {e}. Run `cruxe index` first."))?;
+    let state = Arc::new(RestState {
+        db_path: data_dir.join(constants::STATE_DB_FILE),
+        config,
+        workspace: workspace.to_path_buf(),
+        project_id,
+        ref_name: options.ref_name.clone(),
+        index_set,
+    });
+    // Fail now rather than on the first request.
+    state.connect()?;
+
+    let app = router(state, Arc::new(guard));
+    let addr = format!("{}:{}", options.bind_addr, options.port);
+    info!("REST API listening on http://{}", addr);
+    let listener = tokio::net::TcpListener::bind(&addr).await?;
+    axum::serve(
+        listener,
+        app.into_make_service_with_connect_info::<SocketAddr>(),
+    )
+    .await?;
+    Ok(())
+}
+
+fn router(state: Arc<RestState>, guard: Arc<ApiGuard>) -> Router {
+    Router::new()
+        .route("/api/v1/health", get(health_handler))
+        .route("/api/v1/search", get(search_handler))
+        .route("/api/v1/definitions", get(definitions_handler))
+        .route("/api/v1/references", get(references_handler))
+        .route("/api/v1/call-graph", get(call_graph_handler))
+        .route("/api/v1/findings", get(findings_handler))
+        .route_layer(middleware::from_fn_with_state(
+            Arc::clone(&guard),
+            guard_request,
+        ))
+        .route("/openapi.json", get(openapi_handler))
+        .with_state(Arc::clone(&state))
+        .merge(crate::grpc::routes(state, guard))
+}
+
+/// Authenticate, rate-limit and audit one `/api/v1` request, holding its
+/// path parameters and results to the caller's grant.
+async fn guard_request(
+    State(guard): State<Arc<ApiGuard>>,
+    request: Request,
+    next: Next,
+) -> Response {
+    let started = Instant::now();
+    let remote = request
+        .extensions()
+        .get::<ConnectInfo<SocketAddr>>()
+        .map(|ConnectInfo(addr)| *addr);
+    let caller = match guard.authenticate(request.headers(), remote) {
+        Ok(caller) => caller,
+        Err(rejection) => return rejection.into_response(),
+    };
+    let operation = request
+        .uri()
+        .path()
+        .trim_start_matches("/api/v1/")
+        .to_string();
+    let params: BTreeMap<String, String> = Query::try_from_uri(request.uri())
+        .map(|Query(params)| params)
+        .unwrap_or_default();
+    let arguments = json!(params);
+    let audit = |summary: (String, Option<u64>, u64)| {
+        guard.audit(
+            &caller,
+            &operation,
+            arguments.clone(),
+            summary,
+            started.elapsed(),
+        );
+    };
+
+    if let Err(rejection) = guard.admit(&caller) {
+        audit((rejection.code().as_str().to_string(), None, 0));
+        return rejection.into_response();
+    }
+    if let Some(grant) = &caller.grant
+        && let Some(path) = denied_path(grant, &params)
+    {
+        audit((ProtocolErrorCode::Forbidden.as_str().to_string(), None, 0));
+        return error_response(
+            StatusCode::FORBIDDEN,
+            format!("credential {} may not read {path}", grant.name),
+        );
+    }
+
+    let response = match guard.timeout() {
+        Some(timeout) => match tokio::time::timeout(timeout, next.run(request)).await {
+            Ok(response) => response,
+            Err(_) => {
+                warn!(
+                    client = %caller.client,
+                    operation,
+                    timeout_ms = timeout.as_millis() as u64,
+                    "REST request timed out; abandoning its response"
+                );
+                audit((
+                    ProtocolErrorCode::QueryTimeout.as_str().to_string(),
+                    None,
+                    0,
+                ));
+                return error_response(
+                    StatusCode::GATEWAY_TIMEOUT,
+                    format!("query exceeded {} ms", timeout.as_millis()),
+                );
+            }
+        },
+        None => next.run(request).await,
+    };
+    let (response, summary) = filter_response(response, &caller, guard.audits()).await;
+    audit(summary);
+    response
+}
+
+/// The first path parameter `grant` does not cover, including the file of a
+/// `position`, parsed as the definitions handler parses it.
+fn denied_path(grant: &Grant, params: &BTreeMap<String, String>) -> Option<String> {
+    let position = params
+        .get("position")
+        .and_then(|position| Position::parse(position).ok())
+        .map(|position| position.path);
+    params
+        .iter()
+        .filter(|(key, _)| access::is_path_argument(key))
+        .map(|(_, path)| path.clone())
+        .chain(position)
+        .find(|path| !grant.allows_path(path))
+}
+
+/// Drop result objects outside the caller's grant from a JSON response, and
+/// summarize it for the audit log as `(outcome, result_count, result_bytes)`.
+/// The body is only buffered when it has to be filtered or counted.
+async fn filter_response(
+    response: Response,
+    caller: &ApiCaller,
+    count: bool,
+) -> (Response, (String, Option<u64>, u64)) {
+    let status = response.status();
+    let outcome = match status {
+        status if status.is_success() => "ok",
+        StatusCode::BAD_REQUEST => ProtocolErrorCode::InvalidInput.as_str(),
+        StatusCode::NOT_FOUND => ProtocolErrorCode::ResultNotFound.as_str(),
+        _ => ProtocolErrorCode::InternalError.as_str(),
+    }
+    .to_string();
+    let grant = caller
+        .grant
+        .as_deref()
+        .filter(|grant| !grant.read_prefixes.is_empty());
+    if !status.is_success() || (grant.is_none() && !count) {
+        return (response, (outcome, None, 0));
+    }
+
+    let (mut parts, body) = response.into_parts();
+    let bytes = match to_bytes(body, usize::MAX).await {
+        Ok(bytes) => bytes,
+        Err(err) => {
+            let message = format!("failed to read response: {err}");
+            return (
+                error_response(StatusCode::INTERNAL_SERVER_ERROR, message),
+                (
+                    ProtocolErrorCode::InternalError.as_str().to_string(),
+                    None,
+                    0,
+                ),
+            );
+        }
+    };
+    let Ok(mut payload) = serde_json::from_slice::<Value>(&bytes) else {
+        let size = bytes.len() as u64;
+        return (
+            Response::from_parts(parts, Body::from(bytes)),
+            (outcome, None, size),
+        );
+    };
+    if let Some(grant) = grant {
+        let removed = grant.prune(&mut payload);
+        if removed > 0 {
+            if payload.get("metadata").is_some_and(Value::is_object) {
+                payload["metadata"]["access_filtered_count"] = json!(removed);
+            } else if let Some(map) = payload.as_object_mut() {
+                map.insert("access_filtered_count".to_string(), json!(removed));
+            }
+        }
+    }
+    let body = serde_json::to_vec(&payload).unwrap_or_default();
+    parts.headers.remove(header::CONTENT_LENGTH);
+    let summary = (outcome, count_results(&payload), body.len() as u64);
+    (Response::from_parts(parts, Body::from(body)), summary)
+}
+
+pub(crate) struct RestState {
+    pub(crate) config: Config,
+    pub(crate) workspace: PathBuf,
+    pub(crate) project_id: String,
+    pub(crate) db_path: PathBuf,
+    pub(crate) ref_name: String,
+    pub(crate) index_set: IndexSet,
+}
+
+impl RestState {
+    pub(crate) fn connect(&self) -> Result<Connection, StateError> {
+        cruxe_state::db::open_for_query(
+            &self.db_path,
+            self.config.storage.busy_timeout_ms,
+            self.config.storage.cache_size,
+            self.config.storage.mmap_size,
+        )
+    }
+
+    fn ref_or_default<'a>(&'a self, requested: &'a Option<String>) -> &'a str {
+        requested.as_deref().unwrap_or(&self.ref_name)
+    }
+}
+
+struct ApiError {
+    status: StatusCode,
+    message: String,
+}
+
+impl ApiError {
+    fn bad_request(message: impl Into<String>) -> Self {
+        Self {
+            status: StatusCode::BAD_REQUEST,
+            message: message.into(),
+        }
+    }
+
+    fn not_found(message: impl Into<String>) -> Self {
+        Self {
+            status: StatusCode::NOT_FOUND,
+            message: message.into(),
+        }
+    }
+}
+
+impl From<StateError> for ApiError {
+    fn from(err: StateError) -> Self {
+        Self {
+            status: StatusCode::INTERNAL_SERVER_ERROR,
+            message: err.to_string(),
+        }
+    }
+}
+
+fn error_response(status: StatusCode, message: String) -> Response {
+    (status, Json(json!({ "error": message }))).into_response()
+}
+
+/// Run `handler` with a fresh connection off the async runtime.
+async fn with_conn<F>(state: Arc<RestState>, handler: F) -> Response
+where
+    F: FnOnce(&RestState, &Connection) -> Result<Response, ApiError> + Send + 'static,
+{
+    let joined = tokio::task::spawn_blocking(move || {
+        let conn = state.connect()?;
+        handler(&state, &conn)
+    })
+    .await;
+    match joined {
+        Ok(Ok(response)) => response,
+        Ok(Err(err)) => error_response(err.status, err.message),
+        Err(err) => error_response(StatusCode::INTERNAL_SERVER_ERROR, err.to_string()),
+    }
+}
+
+pub(crate) fn clamp_limit(limit: Option<usize>) -> usize {
+    limit.unwrap_or(DEFAULT_LIMIT).clamp(1, MAX_LIMIT)
+}
+
+async fn openapi_handler() -> Response {
+    ([(header::CONTENT_TYPE, "application/json")], OPENAPI_SPEC).into_response()
+}
+
+async fn health_handler(State(state): State<Arc<RestState>>) -> Response {
+    with_conn(state, |state, _| {
+        Ok(Json(json!({
+            "status": "ok",
+            "repo": state.project_id,
+            "ref": state.ref_name,
+        }))
+        .into_response())
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct SearchParams {
+    q: String,
+    lang: Option<String>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+async fn search_handler(
+    State(state): State<Arc<RestState>>,
+    Query(params): Query<SearchParams>,
+) -> Response {
+    with_conn(state, move |state, conn| {
+        if params.q.trim().is_empty() {
+            return Err(ApiError::bad_request("`q` must not be empty"));
+        }
+        let response = search::search_code(
+            &state.index_set,
+            Some(conn),
+            &params.q,
+            Some(state.ref_or_default(&params.ref_name)),
+            params.lang.as_deref(),
+            clamp_limit(params.limit),
+            false,
+        )?;
+        Ok(Json(response).into_response())
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct DefinitionParams {
+    name: Option<String>,
+    position: Option<String>,
+    kind: Option<String>,
+    lang: Option<String>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+async fn definitions_handler(
+    State(state): State<Arc<RestState>>,
+    Query(params): Query<DefinitionParams>,
+) -> Response {
+    with_conn(state, move |state, conn| {
+        let ref_name = state.ref_or_default(&params.ref_name);
+        match (&params.name, &params.position) {
+            (_, Some(position)) => {
+                let position =
+                    Position::parse(position).map_err(|e| ApiError::bad_request(e.to_string()))?;
+                let lookup = goto_definition::goto_definition(
+                    conn,
+                    &state.workspace,
+                    &state.project_id,
+                    ref_name,
+                    &position,
+                )
+                .map_err(|e| match e {
+                    GotoDefinitionError::InvalidPosition(_)
+                    | GotoDefinitionError::OutsideWorkspace { .. } => {
+                        ApiError::bad_request(e.to_string())
+                    }
+                    GotoDefinitionError::Unreadable { .. }
+                    | GotoDefinitionError::NoIdentifier { .. } => {
+                        ApiError::not_found(e.to_string())
+                    }
+                    GotoDefinitionError::State(e) => e.into(),
+                })?;
+                Ok(Json(lookup).into_response())
+            }
+            (Some(name), None) => {
+                let definitions = locate::locate_symbol(
+                    &state.index_set.symbols,
+                    name,
+                    params.kind.as_deref(),
+                    None,
+                    params.lang.as_deref(),
+                    Some(ref_name),
+                    clamp_limit(params.limit),
+                )?;
+                Ok(Json(json!({ "ref": ref_name, "definitions": definitions })).into_response())
+            }
+            (None, None) => Err(ApiError::bad_request("pass `name` or `position`")),
+        }
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct ReferenceParams {
+    symbol: String,
+    kind: Option<String>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+async fn references_handler(
+    State(state): State<Arc<RestState>>,
+    Query(params): Query<ReferenceParams>,
+) -> Response {
+    with_conn(state, move |state, conn| {
+        let result = find_references::find_references(
+            conn,
+            &state.workspace,
+            &state.project_id,
+            state.ref_or_default(&params.ref_name),
+            params.kind.as_deref(),
+            &params.symbol,
+            clamp_limit(params.limit),
+        )
+        .map_err(|e| match e {
+            FindReferencesError::SymbolNotFound => {
+                ApiError::not_found(format!("symbol `{}` not found", params.symbol))
+            }
+            FindReferencesError::NoEdgesAvailable => {
+                ApiError::not_found("no reference edges are indexed for this ref")
+            }
+            FindReferencesError::State(e) => e.into(),
+        })?;
+        Ok(Json(result).into_response())
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct CallGraphParams {
+    symbol: String,
+    path: Option<String>,
+    direction: Option<String>,
+    depth: Option<u32>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+async fn call_graph_handler(
+    State(state): State<Arc<RestState>>,
+    Query(params): Query<CallGraphParams>,
+) -> Response {
+    with_conn(state, move |state, conn| {
+        let direction = params.direction.as_deref().unwrap_or("both");
+        let direction = CallGraphDirection::parse(direction).ok_or_else(|| {
+            ApiError::bad_request(format!(
+                "unknown direction `{direction}` (expected callers, callees or both)"
+            ))
+        })?;
+        let request = CallGraphRequest {
+            symbol_name: &params.symbol,
+            path: params.path.as_deref(),
+            direction,
+            depth: params.depth.unwrap_or(1),
+            limit: clamp_limit(params.limit),
+        };
+        let graph = call_graph::get_call_graph(
+            conn,
+            &state.project_id,
+            state.ref_or_default(&params.ref_name),
+            &request,
+        )
+        .map_err(|e| match e {
+            CallGraphError::SymbolNotFound => {
+                ApiError::not_found(format!("symbol `{}` not found", params.symbol))
+            }
+            CallGraphError::State(e) => e.into(),
+        })?;
+        Ok(Json(graph).into_response())
+    })
+    .await
+}
+
+#[derive(Debug, Deserialize)]
+struct FindingParams {
+    rule: Option<String>,
+    severity: Option<String>,
+    path: Option<String>,
+    limit: Option<usize>,
+    #[serde(rename = "ref")]
+    ref_name: Option<String>,
+}
+
+async fn findings_handler(
+    State(state): State<Arc<RestState>>,
+    Query(params): Query<FindingParams>,
+) -> Response {
+    with_conn(state, move |state, conn| {
+        let min_severity = match params.severity.as_deref() {
+            Some(raw) => Severity::parse(raw).ok_or_else(|| {
+                ApiError::bad_request(format!(
+                    "unknown severity `{raw}` (expected info, warning or error)"
+                ))
+            })?,
+            None => Severity::Info,
+        };
+        let profile = state
+            .config
+            .check
+            .profile
+            .as_deref()
+            .and_then(Profile::parse)
+            .unwrap_or_default();
+        let ref_name = state.ref_or_default(&params.ref_name);
+        let rule_set =
+            RuleSet::from_config(&state.config.rules, profile).with_taint(&state.config.taint);
+        let mut found = findings::run_checks(conn, &state.project_id, ref_name, &rule_set)?;
+        found.retain(|finding| {
+            finding.severity >= min_severity
+                && params
+                    .rule
+                    .as_deref()
+                    .is_none_or(|rule| finding.rule == rule)
+                && params
+                    .path
+                    .as_deref()
+                    .is_none_or(|prefix| finding.path.starts_with(prefix))
+        });
+        let total = found.len();
+        found.truncate(clamp_limit(params.limit));
+        Ok(Json(json!({
+            "ref": ref_name,
+            "total": total,
+            "findings": found,
+        }))
+        .into_response())
+    })
+    .await
+}
+
+#[cfg(test)]
+pub(crate) mod tests {
+    use super::*;
+    use cruxe_core::config::ApiKeyConfig;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+
+    /// Serve `app` on an ephemeral loopback port.
+    async fn serve(app: Router) -> SocketAddr {
+        let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let addr = listener.local_addr().unwrap();
+        tokio::spawn(async move {
+            axum::serve(
+                listener,
+                app.into_make_service_with_connect_info::<SocketAddr>(),
+            )
+            .await
+        });
+        addr
+    }
+
+    /// The raw HTTP/1.1 response to a GET of `path`.
+    async fn get(addr: SocketAddr, path: &str, token: Option<&str>) -> String {
+        let mut stream = tokio::net::TcpStream::connect(addr).await.unwrap();
+        let auth = token
+            .map(|token| format!("Authorization: Bearer {token}\r\n"))
+            .unwrap_or_default();
+        let request =
+            format!("GET {path} HTTP/1.1\r\nHost: localhost\r\n{auth}Connection: close\r\n\r\n");
+        stream.write_all(request.as_bytes()).await.unwrap();
+        let mut response = String::new();
+        stream.read_to_string(&mut response).await.unwrap();
+        response
+    }
+
+    /// An empty index over `dir`, served to key `ci` (token `tok`), which
+    /// may only read `src/public`.
+    pub(crate) fn keyed_state(dir: &Path) -> (Arc<RestState>, Arc<ApiGuard>) {
+        let mut config = Config::default();
+        config.storage.data_dir = dir.join("data").to_string_lossy().to_string();
+        config.server.api_keys = vec![ApiKeyConfig {
+            name: "ci".to_string(),
+            token: Some("tok".to_string()),
+            read_prefixes: vec!["src/public".to_string()],
+            ..ApiKeyConfig::default()
+        }];
+        let project_id = generate_project_id(&dir.to_string_lossy());
+        let data_dir = config.project_data_dir(&project_id);
+        let db_path = data_dir.join(constants::STATE_DB_FILE);
+        let conn = cruxe_state::db::open_connection(&db_path).unwrap();
+        cruxe_state::schema::create_tables(&conn).unwrap();
+        let guard = Arc::new(ApiGuard::from_config(&config, &project_id).unwrap());
+        let state = Arc::new(RestState {
+            index_set: IndexSet::open(&data_dir).unwrap(),
+            db_path,
+            config,
+            workspace: dir.to_path_buf(),
+            project_id,
+            ref_name: constants::REF_LIVE.to_string(),
+        });
+        (state, guard)
+    }
+
+    #[tokio::test]
+    async fn api_keys_guard_every_query_route() {
+        let tmp = tempfile::tempdir().unwrap();
+        let (state, guard) = keyed_state(tmp.path());
+        let addr = serve(router(state, guard)).await;
+
+        for token in [None, Some("wrong")] {
+            let response = get(addr, "/api/v1/health", token).await;
+            assert!(response.starts_with("HTTP/1.1 401"), "{response}");
+        }
+        let response = get(addr, "/api/v1/health", Some("tok")).await;
+        assert!(response.starts_with("HTTP/1.1 200"), "{response}");
+        let response = get(addr, "/api/v1/findings?path=src/internal", Some("tok")).await;
+        assert!(response.starts_with("HTTP/1.1 403"), "{response}");
+        let response = get(
+            addr,
+            "/api/v1/definitions?position=src/internal/a.go:1:1",
+            Some("tok"),
+        )
+        .await;
+        assert!(response.starts_with("HTTP/1.1 403"), "{response}");
+        // The checked path is the whole file part, not what precedes its
+        // first `:`.
+        let response = get(
+            addr,
+            "/api/v1/definitions?position=src/public:x/../../internal/a.go:1:1",
+            Some("tok"),
+        )
+        .await;
+        assert!(response.starts_with("HTTP/1.1 403"), "{response}");
+
+        // The spec documents the API and stays public.
+        let response = get(addr, "/openapi.json", None).await;
+        assert!(response.starts_with("HTTP/1.1 200"), "{response}");
+    }
+
+    #[test]
+    fn openapi_spec_lists_every_route() {
+        let spec: serde_json::Value = serde_json::from_str(OPENAPI_SPEC).unwrap();
+        assert_eq!(spec["openapi"], "3.0.3");
+        let paths = spec["paths"].as_object().unwrap();
+        for route in [
+            "/api/v1/health",
+            "/api/v1/search",
+            "/api/v1/definitions",
+            "/api/v1/references",
+            "/api/v1/call-graph",
+            "/api/v1/findings",
+        ] {
+            assert!(paths.contains_key(route), "missing {route}");
+        }
+    }
+
+    #[test]
+    fn limits_are_clamped() {
+        assert_eq!(clamp_limit(None), DEFAULT_LIMIT);
+        assert_eq!(clamp_limit(Some(0)), 1);
+        assert_eq!(clamp_limit(Some(1_000_000)), MAX_LIMIT);
+    }
+}
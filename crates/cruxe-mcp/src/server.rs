@@ -169,8 +169,8 @@ impl ConnectionManager {
         }
     }
 
-    #[cfg(test)]
-    fn with_capacity(max_open_connections: usize) -> Self {
+    /// Manager with its own connection cap, e.g. one per hosted tenant.
+    pub fn with_capacity(max_open_connections: usize) -> Self {
         Self {
             connections: Mutex::new(HashMap::new()),
             max_open_connections: max_open_connections.max(1),
@@ -739,6 +739,18 @@ pub fn execute_transport_request(
     handle_request_with_ctx(request, &request_ctx)
 }
 
+fn is_known_tool(name: &str) -> bool {
+    static NAMES: OnceLock<HashSet<String>> = OnceLock::new();
+    NAMES
+        .get_or_init(|| {
+            tools::list_tools()
+                .into_iter()
+                .map(|tool| tool.name)
+                .collect()
+        })
+        .contains(name)
+}
+
 fn handle_request_with_ctx(request: &JsonRpcRequest, ctx: &RequestContext<'_>) -> JsonRpcResponse {
     match request.method.as_str() {
         "initialize" => JsonRpcResponse::success(
@@ -771,7 +783,8 @@ fn handle_request_with_ctx(request: &JsonRpcRequest, ctx: &RequestContext<'_>) -
                 .cloned()
                 .unwrap_or(json!({}));
 
-            handle_tool_call(ToolCallParams {
+            let started = Instant::now();
+            let response = handle_tool_call(ToolCallParams {
                 id: request.id.clone(),
                 tool_name,
                 arguments: &arguments,
@@ -786,7 +799,16 @@ fn handle_request_with_ctx(request: &JsonRpcRequest, ctx: &RequestContext<'_>) -
                 server_start: ctx.server_start,
                 notifier: ctx.notifier.clone(),
                 progress_token: ctx.progress_token.map(|s| s.to_string()),
-            })
+            });
+            // Unknown names share one label so callers cannot grow the
+            // metric without bound.
+            let label = if is_known_tool(tool_name) {
+                tool_name
+            } else {
+                "unknown"
+            };
+            cruxe_core::metrics::observe_query(label, started.elapsed());
+            response
         }
         _ => JsonRpcResponse::error(
             request.id.clone(),
@@ -892,6 +914,7 @@ fn build_metadata(
                 r#ref,
                 config.index.max_file_size,
                 Some(&config.index.languages),
+                config.index.symlink_policy(),
             );
             let mut metadata = ProtocolMetadata::new(r#ref);
             metadata.freshness_status = freshness::freshness_status(&freshness_result);
@@ -1182,6 +1205,7 @@ pub(crate) fn build_health_core_payload(request: HealthCoreRequest<'_>) -> Healt
                         .unwrap_or(constants::REF_LIVE),
                     config.index.max_file_size,
                     Some(&config.index.languages),
+                    config.index.symlink_policy(),
                 );
                 project_payload["freshness_status"] =
                     json!(freshness::freshness_status(&freshness_result));
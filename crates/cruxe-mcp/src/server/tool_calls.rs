@@ -394,6 +394,7 @@ mod tests {
             kind: Some("fn".to_string()),
             name: Some("foo".to_string()),
             qualified_name: Some("foo".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -419,6 +420,7 @@ mod tests {
             kind: None,
             name: None,
             qualified_name: None,
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -566,6 +566,7 @@ pub(super) fn handle_search_code(params: QueryToolParams<'_>) -> JsonRpcResponse
         policy_mode_override,
         policy_runtime: None,
         diversity_enabled,
+        in_docs: false,
     };
     match execute_search_with_optional_overlay(
         QueryExecutionContext {
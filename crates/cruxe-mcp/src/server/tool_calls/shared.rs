@@ -42,6 +42,7 @@ pub(super) fn check_and_enforce_freshness(
         effective_ref,
         config.index.max_file_size,
         Some(&config.index.languages),
+        config.index.symlink_policy(),
     );
     let policy_action = apply_freshness_policy(policy, &freshness_result);
     let metadata = build_metadata_with_freshness(effective_ref, schema_status, &freshness_result);
@@ -0,0 +1,269 @@
+//! MCP's HTTP+SSE transport, for clients that speak it instead of plain
+//! JSON-RPC over `POST /`:
+//!
+//! - `GET /sse` opens an event stream. Its first `endpoint` event carries the
+//!   URL to post requests to, `/messages?sessionId=<id>`.
+//! - `POST /messages?sessionId=<id>` takes one JSON-RPC message and answers
+//!   `202 Accepted`. The response arrives on the stream as a `message`
+//!   event. Notifications get no event.
+//!
+//! Messages go through the same limits, auditing and dispatch as `POST /`.
+//! Rejections (bad JSON, rate limits) are answered on the POST itself. A
+//! session ends when its stream is closed.
+
+use crate::http::{Caller, HttpState, jsonrpc_response};
+use axum::body::Bytes;
+use axum::extract::{ConnectInfo, Query, State};
+use axum::http::{HeaderMap, StatusCode};
+use axum::response::sse::{Event, KeepAlive, Sse};
+use axum::response::{IntoResponse, Response};
+use axum::routing::{get, post};
+use axum::{Extension, Json, Router};
+use cruxe_core::error::ProtocolErrorCode;
+use serde::Deserialize;
+use serde_json::{Value, json};
+use std::collections::HashMap;
+use std::hash::{BuildHasher, RandomState};
+use std::net::SocketAddr;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{Arc, Mutex};
+use tokio::sync::mpsc;
+
+/// Open SSE sessions of one server, by session id.
+pub(crate) struct SseState {
+    http: Arc<HttpState>,
+    sessions: Mutex<HashMap<String, mpsc::UnboundedSender<String>>>,
+    hasher: RandomState,
+    next_session: AtomicU64,
+}
+
+impl SseState {
+    /// An id other clients cannot guess from their own.
+    fn new_session_id(&self) -> String {
+        let counter = self.next_session.fetch_add(1, Ordering::Relaxed);
+        format!("{:016x}", self.hasher.hash_one(counter))
+    }
+}
+
+/// Removes its session once the stream holding it is dropped.
+struct SessionGuard {
+    state: Arc<SseState>,
+    id: String,
+}
+
+impl Drop for SessionGuard {
+    fn drop(&mut self) {
+        if let Ok(mut sessions) = self.state.sessions.lock() {
+            sessions.remove(&self.id);
+        }
+    }
+}
+
+#[derive(Debug, Deserialize)]
+pub(crate) struct MessageParams {
+    #[serde(rename = "sessionId")]
+    session_id: String,
+}
+
+/// The `/sse` and `/messages` routes for `http`'s project.
+pub(crate) fn routes(http: Arc<HttpState>) -> Router {
+    let state = Arc::new(SseState {
+        http,
+        sessions: Mutex::new(HashMap::new()),
+        hasher: RandomState::new(),
+        next_session: AtomicU64::new(0),
+    });
+    Router::new()
+        .route("/sse", get(open_stream))
+        .route("/messages", post(post_message))
+        .with_state(state)
+}
+
+/// GET /sse — open a session and stream its responses.
+pub(crate) async fn open_stream(State(state): State<Arc<SseState>>) -> Response {
+    let id = state.new_session_id();
+    let (sender, receiver) = mpsc::unbounded_channel();
+    if let Ok(mut sessions) = state.sessions.lock() {
+        sessions.insert(id.clone(), sender);
+    }
+    let endpoint = Event::default()
+        .event("endpoint")
+        .data(format!("/messages?sessionId={id}"));
+    let guard = SessionGuard {
+        state: Arc::clone(&state),
+        id,
+    };
+
+    let stream = futures::stream::unfold(
+        (Some(endpoint), receiver, guard),
+        |(mut endpoint, mut receiver, guard)| async move {
+            let event = match endpoint.take() {
+                Some(event) => event,
+                None => Event::default()
+                    .event("message")
+                    .data(receiver.recv().await?),
+            };
+            Some((Ok::<_, axum::Error>(event), (None, receiver, guard)))
+        },
+    );
+    Sse::new(stream)
+        .keep_alive(KeepAlive::default())
+        .into_response()
+}
+
+/// POST /messages — dispatch one message of a session.
+pub(crate) async fn post_message(
+    State(state): State<Arc<SseState>>,
+    Query(params): Query<MessageParams>,
+    connect_info: Option<Extension<ConnectInfo<SocketAddr>>>,
+    headers: HeaderMap,
+    body: Bytes,
+) -> Response {
+    let sender = state
+        .sessions
+        .lock()
+        .ok()
+        .and_then(|sessions| sessions.get(&params.session_id).cloned());
+    let Some(sender) = sender else {
+        let body = json!({
+            "error": {
+                "code": ProtocolErrorCode::InvalidInput.as_str(),
+                "message": format!("unknown or closed SSE session `{}`", params.session_id),
+            }
+        });
+        return (StatusCode::NOT_FOUND, Json(body)).into_response();
+    };
+
+    let client = connect_info
+        .map(|Extension(ConnectInfo(addr))| addr.ip().to_string())
+        .unwrap_or_else(|| "unknown".to_string());
+    let caller = Caller {
+        client,
+        tenant: None,
+        grant: None,
+        permit: None,
+    };
+    let response = jsonrpc_response(Arc::clone(&state.http), &headers, &body, caller).await;
+    if response.status() != StatusCode::OK {
+        return response;
+    }
+
+    let is_notification = serde_json::from_slice::<Value>(&body)
+        .is_ok_and(|message| message.get("id").is_none_or(Value::is_null));
+    if !is_notification {
+        match axum::body::to_bytes(response.into_body(), usize::MAX).await {
+            Ok(bytes) => {
+                // A send only fails once the stream has closed.
+                let _ = sender.send(String::from_utf8_lossy(&bytes).into_owned());
+            }
+            Err(e) => {
+                let body = json!({
+                    "error": {
+                        "code": ProtocolErrorCode::InternalError.as_str(),
+                        "message": format!("failed to read response: {}", e),
+                    }
+                });
+                return (StatusCode::INTERNAL_SERVER_ERROR, Json(body)).into_response();
+            }
+        }
+    }
+    StatusCode::ACCEPTED.into_response()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::config::Config;
+    use cruxe_core::types::WorkspaceConfig;
+    use futures::StreamExt;
+
+    fn state(workspace: &std::path::Path) -> Arc<SseState> {
+        let mut config = Config::default();
+        config.storage.data_dir = workspace.join(".cruxe").to_string_lossy().to_string();
+        let http = crate::http::open_http_state(
+            workspace,
+            config,
+            true,
+            WorkspaceConfig::default(),
+            crate::server::ConnectionManager::new(),
+            None,
+        )
+        .unwrap();
+        Arc::new(SseState {
+            http: Arc::new(http),
+            sessions: Mutex::new(HashMap::new()),
+            hasher: RandomState::new(),
+            next_session: AtomicU64::new(0),
+        })
+    }
+
+    /// The `data:` line of the next event on the stream.
+    async fn next_data<S>(stream: &mut S) -> String
+    where
+        S: futures::Stream<Item = Result<Bytes, axum::Error>> + Unpin,
+    {
+        let chunk = stream.next().await.unwrap().unwrap();
+        let text = String::from_utf8(chunk.to_vec()).unwrap();
+        text.lines()
+            .find_map(|line| line.strip_prefix("data: "))
+            .unwrap()
+            .to_string()
+    }
+
+    #[tokio::test]
+    async fn responses_arrive_on_the_session_stream() {
+        let tmp = tempfile::tempdir().unwrap();
+        let state = state(tmp.path());
+
+        let response = open_stream(State(Arc::clone(&state))).await;
+        assert_eq!(response.status(), StatusCode::OK);
+        let mut stream = response.into_body().into_data_stream();
+        let endpoint = next_data(&mut stream).await;
+        let session_id = endpoint
+            .strip_prefix("/messages?sessionId=")
+            .unwrap()
+            .to_string();
+
+        let post = |body: &'static str, session_id: String| {
+            post_message(
+                State(Arc::clone(&state)),
+                Query(MessageParams { session_id }),
+                None,
+                HeaderMap::new(),
+                Bytes::from(body),
+            )
+        };
+        let accepted = post(
+            r#"{"jsonrpc":"2.0","method":"notifications/initialized"}"#,
+            session_id.clone(),
+        )
+        .await;
+        assert_eq!(accepted.status(), StatusCode::ACCEPTED);
+        let accepted = post(
+            r#"{"jsonrpc":"2.0","id":7,"method":"tools/list","params":{}}"#,
+            session_id.clone(),
+        )
+        .await;
+        assert_eq!(accepted.status(), StatusCode::ACCEPTED);
+
+        // The notification produced no event; the first one is the list.
+        let message: Value = serde_json::from_str(&next_data(&mut stream).await).unwrap();
+        assert_eq!(message["id"], 7);
+        assert!(message["result"]["tools"].is_array());
+
+        let unknown = post(
+            r#"{"jsonrpc":"2.0","id":8,"method":"tools/list"}"#,
+            "nope".into(),
+        )
+        .await;
+        assert_eq!(unknown.status(), StatusCode::NOT_FOUND);
+
+        drop(stream);
+        let closed = post(
+            r#"{"jsonrpc":"2.0","id":9,"method":"tools/list"}"#,
+            session_id,
+        )
+        .await;
+        assert_eq!(closed.status(), StatusCode::NOT_FOUND);
+    }
+}
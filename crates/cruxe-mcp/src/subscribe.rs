@@ -0,0 +1,461 @@
+//! Live graph updates over Server-Sent Events: `GET /subscribe?ref=<ref>`.
+//!
+//! One poller per ref watches the state DB with `PRAGMA data_version`, which
+//! changes whenever another connection (the indexer, `sync_repo`) commits.
+//! After a change it reloads the ref's symbol graph, diffs it against the
+//! previous load and broadcasts the [`GraphDelta`] to every subscriber of
+//! that ref, so dashboards and editors follow re-indexing without polling.
+//! A poller stops once its last subscriber disconnects.
+//!
+//! Events on the stream:
+//! - `ready`: `{ref, poll_interval_ms}`, sent once when the stream opens
+//! - `delta`: `{ref, sequence, added_nodes, changed_nodes, removed_nodes,
+//!   added_edges, removed_edges}`
+//! - `resync`: `{ref, missed}`; the client fell behind and must refetch the
+//!   graph (for example with `cruxe export`)
+//!
+//! Credentials with `read_prefixes` only receive nodes under those prefixes
+//! and edges whose endpoints are both visible.
+
+use crate::access::Grant;
+use crate::http::HttpState;
+use crate::limits::Rejection;
+use axum::extract::{Query, State};
+use axum::response::sse::{Event, KeepAlive, Sse};
+use axum::response::{IntoResponse, Response};
+use cruxe_core::config::ServerSubscribeConfig;
+use cruxe_core::error::StateError;
+use cruxe_query::graph_export::{self, GraphDelta, GraphSnapshot};
+use rusqlite::Connection;
+use serde::Deserialize;
+use serde_json::json;
+use std::borrow::Cow;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::sync::broadcast;
+use tokio::sync::broadcast::error::RecvError;
+use tracing::warn;
+
+/// Deltas buffered per ref; subscribers further behind get `resync`.
+const FEED_CAPACITY: usize = 64;
+
+#[derive(Debug, Default, Deserialize)]
+pub struct SubscribeParams {
+    /// Ref to follow (default: resolved like tool calls without `ref`).
+    #[serde(default, rename = "ref")]
+    pub r#ref: Option<String>,
+}
+
+/// One broadcast change of a ref's graph.
+#[derive(Debug)]
+struct Update {
+    sequence: u64,
+    delta: GraphDelta,
+    /// Paths of the endpoints of `delta`'s edges, for prefix filtering.
+    endpoint_paths: HashMap<String, String>,
+}
+
+type Feeds = Arc<Mutex<HashMap<String, broadcast::Sender<Arc<Update>>>>>;
+
+/// Per-project subscription state: one feed (and poller) per followed ref.
+#[derive(Debug)]
+pub struct Subscriptions {
+    poll_interval: Duration,
+    max_subscribers: u32,
+    active: Arc<AtomicU32>,
+    feeds: Feeds,
+}
+
+impl Default for Subscriptions {
+    fn default() -> Self {
+        Self::from_config(&ServerSubscribeConfig::default())
+    }
+}
+
+/// Held by an open stream; frees its subscriber slot on drop.
+#[derive(Debug)]
+struct SubscriberSlot {
+    active: Arc<AtomicU32>,
+}
+
+impl Drop for SubscriberSlot {
+    fn drop(&mut self) {
+        self.active.fetch_sub(1, Ordering::AcqRel);
+    }
+}
+
+impl Subscriptions {
+    pub fn from_config(config: &ServerSubscribeConfig) -> Self {
+        Self {
+            poll_interval: Duration::from_millis(config.poll_interval_ms.max(100)),
+            max_subscribers: config.max_subscribers,
+            active: Arc::new(AtomicU32::new(0)),
+            feeds: Arc::new(Mutex::new(HashMap::new())),
+        }
+    }
+
+    fn try_acquire(&self) -> Result<SubscriberSlot, Rejection> {
+        let previous = self.active.fetch_add(1, Ordering::AcqRel);
+        let slot = SubscriberSlot {
+            active: Arc::clone(&self.active),
+        };
+        if previous >= self.max_subscribers {
+            return Err(Rejection::TooManySubscribers);
+        }
+        Ok(slot)
+    }
+
+    /// Join the feed for `ref_name`, starting its poller if needed.
+    fn subscribe(
+        &self,
+        db_path: &Path,
+        project_id: &str,
+        ref_name: &str,
+    ) -> broadcast::Receiver<Arc<Update>> {
+        let mut feeds = self.feeds.lock().unwrap_or_else(|e| e.into_inner());
+        if let Some(sender) = feeds.get(ref_name) {
+            return sender.subscribe();
+        }
+        let (sender, receiver) = broadcast::channel(FEED_CAPACITY);
+        feeds.insert(ref_name.to_string(), sender.clone());
+        let poller = Poller {
+            db_path: db_path.to_path_buf(),
+            project_id: project_id.to_string(),
+            ref_name: ref_name.to_string(),
+            conn: None,
+            data_version: 0,
+            current: None,
+            sequence: 0,
+        };
+        tokio::spawn(run_poller(
+            poller,
+            sender,
+            Arc::clone(&self.feeds),
+            self.poll_interval,
+        ));
+        receiver
+    }
+}
+
+/// Reloads one ref's graph whenever the state DB changes.
+struct Poller {
+    db_path: PathBuf,
+    project_id: String,
+    ref_name: String,
+    conn: Option<Connection>,
+    data_version: i64,
+    current: Option<GraphSnapshot>,
+    sequence: u64,
+}
+
+impl Poller {
+    /// The change since the last poll, if the DB changed and the graph with
+    /// it. The first successful poll only records a baseline.
+    fn poll(&mut self) -> Result<Option<Update>, StateError> {
+        if self.conn.is_none() {
+            self.conn = Some(cruxe_state::db::open_connection(&self.db_path)?);
+        }
+        let conn = self.conn.as_ref().expect("connection opened above");
+        let version: i64 = conn
+            .query_row("PRAGMA data_version", [], |row| row.get(0))
+            .map_err(StateError::sqlite)?;
+        if self.current.is_some() && version == self.data_version {
+            return Ok(None);
+        }
+        self.data_version = version;
+
+        let snapshot = graph_export::load_graph_snapshot(conn, &self.project_id, &self.ref_name)?;
+        let Some(previous) = self.current.replace(snapshot) else {
+            return Ok(None);
+        };
+        let current = self.current.as_ref().expect("snapshot stored above");
+        let delta = graph_export::diff_snapshots(&previous, current);
+        if delta.is_empty() {
+            return Ok(None);
+        }
+
+        let mut endpoint_paths = HashMap::new();
+        for edge in delta.added_edges.iter().chain(&delta.removed_edges) {
+            endpoint_paths.insert(edge.source.clone(), String::new());
+            endpoint_paths.insert(edge.target.clone(), String::new());
+        }
+        for node in previous.nodes.iter().chain(&current.nodes) {
+            if let Some(path) = endpoint_paths.get_mut(&node.id) {
+                path.clone_from(&node.path);
+            }
+        }
+        self.sequence += 1;
+        Ok(Some(Update {
+            sequence: self.sequence,
+            delta,
+            endpoint_paths,
+        }))
+    }
+}
+
+async fn run_poller(
+    mut poller: Poller,
+    sender: broadcast::Sender<Arc<Update>>,
+    feeds: Feeds,
+    interval: Duration,
+) {
+    let mut ticker = tokio::time::interval(interval);
+    loop {
+        ticker.tick().await;
+        {
+            // Checked under the feed lock so a concurrent subscribe either
+            // sees this feed alive or starts a new poller.
+            let mut feeds = feeds.lock().unwrap_or_else(|e| e.into_inner());
+            if sender.receiver_count() == 0 {
+                feeds.remove(&poller.ref_name);
+                return;
+            }
+        }
+
+        let joined = tokio::task::spawn_blocking(move || {
+            let result = poller.poll();
+            (poller, result)
+        })
+        .await;
+        let result = match joined {
+            Ok((returned, result)) => {
+                poller = returned;
+                result
+            }
+            Err(err) => {
+                warn!(error = %err, "Graph subscription poller failed");
+                return;
+            }
+        };
+        match result {
+            Ok(Some(update)) => {
+                let _ = sender.send(Arc::new(update));
+            }
+            Ok(None) => {}
+            Err(err) => {
+                // The index may not exist yet; keep watching.
+                poller.conn = None;
+                warn!(ref_name = %poller.ref_name, error = %err, "Graph subscription poll failed");
+            }
+        }
+    }
+}
+
+/// GET /subscribe — single-project server.
+pub(crate) async fn subscribe_handler(
+    State(state): State<Arc<HttpState>>,
+    Query(params): Query<SubscribeParams>,
+) -> Response {
+    subscribe_response(state, params, None).await
+}
+
+/// Open an event stream for `params.ref` of `state`'s project.
+pub(crate) async fn subscribe_response(
+    state: Arc<HttpState>,
+    params: SubscribeParams,
+    grant: Option<Arc<Grant>>,
+) -> Response {
+    let slot = match state.subscriptions.try_acquire() {
+        Ok(slot) => slot,
+        Err(rejection) => return rejection.into_response(),
+    };
+    let ref_name = {
+        let state = Arc::clone(&state);
+        tokio::task::spawn_blocking(move || {
+            let conn = cruxe_state::db::open_connection(&state.db_path).ok();
+            crate::server::resolve_tool_ref_public(
+                params.r#ref.as_deref(),
+                &state.workspace,
+                conn.as_ref(),
+                &state.project_id,
+            )
+        })
+        .await
+        .unwrap_or_else(|_| cruxe_core::constants::REF_LIVE.to_string())
+    };
+    let receiver = state
+        .subscriptions
+        .subscribe(&state.db_path, &state.project_id, &ref_name);
+    let ready = Event::default().event("ready").json_data(json!({
+        "ref": ref_name,
+        "poll_interval_ms": state.subscriptions.poll_interval.as_millis() as u64,
+    }));
+
+    let stream = futures::stream::unfold(
+        (Some(ready), receiver, ref_name, grant, slot),
+        |(mut ready, mut receiver, ref_name, grant, slot)| async move {
+            if let Some(event) = ready.take() {
+                return Some((event, (None, receiver, ref_name, grant, slot)));
+            }
+            let event = loop {
+                match receiver.recv().await {
+                    Ok(update) => {
+                        if let Some(delta) = visible_delta(&update, grant.as_deref()) {
+                            let mut data = serde_json::to_value(&*delta).unwrap_or_default();
+                            data["ref"] = json!(ref_name);
+                            data["sequence"] = json!(update.sequence);
+                            break Event::default().event("delta").json_data(data);
+                        }
+                    }
+                    Err(RecvError::Lagged(missed)) => {
+                        break Event::default()
+                            .event("resync")
+                            .json_data(json!({"ref": ref_name, "missed": missed}));
+                    }
+                    Err(RecvError::Closed) => return None,
+                }
+            };
+            Some((event, (None, receiver, ref_name, grant, slot)))
+        },
+    );
+    Sse::new(stream)
+        .keep_alive(KeepAlive::default())
+        .into_response()
+}
+
+/// The part of `update` that `grant` may see; `None` when nothing is left.
+fn visible_delta<'a>(update: &'a Update, grant: Option<&Grant>) -> Option<Cow<'a, GraphDelta>> {
+    let Some(grant) = grant.filter(|grant| !grant.read_prefixes.is_empty()) else {
+        return Some(Cow::Borrowed(&update.delta));
+    };
+    let nodes = |nodes: &[graph_export::GraphNode]| {
+        nodes
+            .iter()
+            .filter(|node| grant.allows_path(&node.path))
+            .cloned()
+            .collect::<Vec<_>>()
+    };
+    let edges = |edges: &[graph_export::GraphEdge]| {
+        edges
+            .iter()
+            .filter(|edge| {
+                [&edge.source, &edge.target].into_iter().all(|id| {
+                    update
+                        .endpoint_paths
+                        .get(id)
+                        .is_some_and(|path| !path.is_empty() && grant.allows_path(path))
+                })
+            })
+            .cloned()
+            .collect::<Vec<_>>()
+    };
+    let delta = GraphDelta {
+        added_nodes: nodes(&update.delta.added_nodes),
+        changed_nodes: nodes(&update.delta.changed_nodes),
+        removed_nodes: nodes(&update.delta.removed_nodes),
+        added_edges: edges(&update.delta.added_edges),
+        removed_edges: edges(&update.delta.removed_edges),
+    };
+    (!delta.is_empty()).then_some(Cow::Owned(delta))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::access::Role;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+
+    fn insert_symbol(conn: &Connection, id: &str, path: &str) {
+        cruxe_state::symbols::insert_symbol(
+            conn,
+            &SymbolRecord {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                commit: None,
+                path: path.to_string(),
+                language: "rust".to_string(),
+                symbol_id: format!("sym::{id}"),
+                symbol_stable_id: id.to_string(),
+                name: id.to_string(),
+                qualified_name: id.to_string(),
+                kind: SymbolKind::Function,
+                signature: None,
+                line_start: 1,
+                line_end: 3,
+                parent_symbol_id: None,
+                visibility: None,
+                content: None,
+            },
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn poller_reports_changes_committed_by_other_connections() {
+        let tmp = tempfile::tempdir().unwrap();
+        let db_path = tmp.path().join("state.db");
+        let writer = cruxe_state::db::open_connection(&db_path).unwrap();
+        cruxe_state::schema::create_tables(&writer).unwrap();
+        insert_symbol(&writer, "a", "src/public/api.rs");
+
+        let mut poller = Poller {
+            db_path,
+            project_id: "repo".to_string(),
+            ref_name: "main".to_string(),
+            conn: None,
+            data_version: 0,
+            current: None,
+            sequence: 0,
+        };
+        assert!(
+            poller.poll().unwrap().is_none(),
+            "first poll is the baseline"
+        );
+        assert!(poller.poll().unwrap().is_none(), "no commits, no update");
+
+        insert_symbol(&writer, "b", "src/private/key.rs");
+        cruxe_state::edges::insert_call_edges(
+            &writer,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "a".to_string(),
+                to_symbol_id: Some("b".to_string()),
+                to_name: None,
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "src/public/api.rs".to_string(),
+                source_line: 2,
+            }],
+        )
+        .unwrap();
+
+        let update = poller.poll().unwrap().expect("commit produces an update");
+        assert_eq!(update.sequence, 1);
+        assert_eq!(update.delta.added_nodes.len(), 1);
+        assert_eq!(update.delta.added_edges.len(), 1);
+        assert_eq!(update.endpoint_paths["b"], "src/private/key.rs");
+
+        let admin = visible_delta(&update, None).unwrap();
+        assert_eq!(admin.added_nodes[0].id, "b");
+        let reader = Grant {
+            name: "docs".to_string(),
+            role: Role::Reader,
+            read_prefixes: vec!["src/public/".to_string()],
+        };
+        assert!(
+            visible_delta(&update, Some(&reader)).is_none(),
+            "the new node and its edge are outside the reader's prefixes"
+        );
+    }
+
+    #[test]
+    fn subscriber_slots_are_capped_and_released() {
+        let subscriptions = Subscriptions::from_config(&ServerSubscribeConfig {
+            poll_interval_ms: 1000,
+            max_subscribers: 1,
+        });
+        let slot = subscriptions.try_acquire().unwrap();
+        assert_eq!(
+            subscriptions.try_acquire().unwrap_err(),
+            Rejection::TooManySubscribers
+        );
+        drop(slot);
+        assert!(subscriptions.try_acquire().is_ok());
+    }
+}
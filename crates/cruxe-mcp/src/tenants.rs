@@ -0,0 +1,628 @@
+//! Multi-tenant HTTP serving: one server process hosting many projects.
+//!
+//! Each `[[server.tenants]]` entry gets its own [`HttpState`] — config loaded
+//! from its workspace, SQLite connection cache, health cache, workspace
+//! router and prewarm state — so tenants never share cached handles. Requests
+//! authenticate with `Authorization: Bearer <token>` and are served only by
+//! the matching tenant. Workspace auto-discovery is disabled per tenant, so a
+//! `workspace` argument can only name projects registered in that tenant's
+//! own state database.
+
+use crate::access::{self, Grant, Role};
+use crate::http::{Caller, HttpState, health_response, jsonrpc_response, open_http_state};
+use crate::limits::{RATE_WINDOW, Rejection};
+use crate::metrics::metrics_response;
+use crate::server::ConnectionManager;
+use crate::subscribe::{SubscribeParams, subscribe_response};
+use axum::body::Bytes;
+use axum::extract::{Query, State};
+use axum::http::{HeaderMap, header};
+use axum::response::{IntoResponse, Response};
+use cruxe_core::audit::AuditLog;
+use cruxe_core::config::{ApiKeyConfig, Config, TenantConfig};
+use cruxe_core::types::WorkspaceConfig;
+use std::collections::HashSet;
+use std::path::Path;
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Instant;
+use tracing::info;
+
+/// Name of the tenant implied by API keys on a single-project server.
+pub const DEFAULT_TENANT: &str = "default";
+
+/// Invalid `[[server.tenants]]` or `[[server.api_keys]]` entry; `owner` is the
+/// tenant or key name.
+#[derive(Debug, thiserror::Error)]
+pub enum TenantConfigError {
+    #[error("server entry #{index} has an empty name")]
+    MissingName { index: usize },
+
+    #[error("{owner}: duplicate name")]
+    DuplicateName { owner: String },
+
+    #[error("{owner}: no token configured (set token or token_env)")]
+    MissingToken { owner: String },
+
+    #[error("{owner}: token is shared with another credential")]
+    DuplicateToken { owner: String },
+
+    #[error("{owner}: {reason}")]
+    Invalid { owner: String, reason: String },
+}
+
+/// Per-tenant request quotas. A limit of 0 means unlimited.
+#[derive(Debug)]
+struct Quota {
+    max_per_minute: u32,
+    max_concurrent: u32,
+    window: Mutex<(Instant, u32)>,
+    in_flight: Arc<AtomicU32>,
+}
+
+/// Held while a request runs; releases its concurrency slot on drop.
+#[derive(Debug)]
+pub struct RequestPermit {
+    in_flight: Arc<AtomicU32>,
+}
+
+impl Drop for RequestPermit {
+    fn drop(&mut self) {
+        self.in_flight.fetch_sub(1, Ordering::AcqRel);
+    }
+}
+
+impl Quota {
+    fn new(max_per_minute: u32, max_concurrent: u32) -> Self {
+        Self {
+            max_per_minute,
+            max_concurrent,
+            window: Mutex::new((Instant::now(), 0)),
+            in_flight: Arc::new(AtomicU32::new(0)),
+        }
+    }
+
+    fn try_acquire(&self, now: Instant) -> Result<RequestPermit, Rejection> {
+        if self.max_per_minute > 0 {
+            let mut window = self.window.lock().unwrap_or_else(|e| e.into_inner());
+            if now.duration_since(window.0) >= RATE_WINDOW {
+                *window = (now, 0);
+            }
+            if window.1 >= self.max_per_minute {
+                return Err(Rejection::RateLimited);
+            }
+            window.1 += 1;
+        }
+
+        let previous = self.in_flight.fetch_add(1, Ordering::AcqRel);
+        let permit = RequestPermit {
+            in_flight: Arc::clone(&self.in_flight),
+        };
+        if self.max_concurrent > 0 && previous >= self.max_concurrent {
+            return Err(Rejection::TooManyConcurrent);
+        }
+        Ok(permit)
+    }
+}
+
+pub struct Tenant {
+    pub name: String,
+    quota: Quota,
+    pub state: Arc<HttpState>,
+}
+
+impl Tenant {
+    pub fn try_acquire(&self) -> Result<RequestPermit, Rejection> {
+        self.quota.try_acquire(Instant::now())
+    }
+}
+
+/// The tenant and access grant behind an authenticated request.
+pub struct Principal {
+    pub tenant: Arc<Tenant>,
+    pub grant: Arc<Grant>,
+}
+
+struct Credential {
+    token: String,
+    tenant: Arc<Tenant>,
+    grant: Arc<Grant>,
+}
+
+pub struct TenantRegistry {
+    credentials: Vec<Credential>,
+}
+
+impl TenantRegistry {
+    /// Validate `config.server` and open every tenant's runtime. Without
+    /// `[[server.tenants]]`, `default_workspace` is served as the implicit
+    /// [`DEFAULT_TENANT`], reachable through API keys only.
+    pub fn open(
+        config: &Config,
+        config_file: Option<&Path>,
+        no_prewarm: bool,
+        default_workspace: &Path,
+    ) -> Result<Self, Box<dyn std::error::Error>> {
+        let implicit = config.server.tenants.is_empty();
+        let specs = if implicit {
+            vec![TenantConfig {
+                name: DEFAULT_TENANT.to_string(),
+                workspace: default_workspace.to_string_lossy().to_string(),
+                ..TenantConfig::default()
+            }]
+        } else {
+            config.server.tenants.clone()
+        };
+        let credentials = resolve_credentials(&specs, &config.server.api_keys, implicit)?;
+        let audit = AuditLog::from_config(config)?.map(Arc::new);
+
+        let mut tenants = Vec::with_capacity(specs.len());
+        for spec in &specs {
+            let invalid = |reason: String| TenantConfigError::Invalid {
+                owner: spec.name.clone(),
+                reason,
+            };
+            let workspace = std::fs::canonicalize(&spec.workspace)
+                .map_err(|e| invalid(format!("workspace {}: {e}", spec.workspace)))?;
+            let mut tenant_config = Config::load_with_file(Some(&workspace), config_file)
+                .map_err(|e| invalid(format!("config: {e}")))?;
+            // The server owns the storage root; tenants are separated by
+            // project id beneath it.
+            tenant_config.storage.data_dir = config.storage.data_dir.clone();
+            tenant_config.server.limits = config.server.limits.clone();
+            tenant_config.server.subscribe = config.server.subscribe.clone();
+            let connection_manager = match spec.max_open_connections {
+                0 => ConnectionManager::new(),
+                cap => ConnectionManager::with_capacity(cap),
+            };
+            let state = open_http_state(
+                &workspace,
+                tenant_config,
+                no_prewarm,
+                WorkspaceConfig::default(),
+                connection_manager,
+                audit.clone(),
+            )
+            .map_err(|e| invalid(e.to_string()))?;
+            info!(
+                tenant = %spec.name,
+                workspace = %workspace.display(),
+                project_id = %state.project_id,
+                "Serving tenant"
+            );
+            tenants.push(Arc::new(Tenant {
+                name: spec.name.clone(),
+                quota: Quota::new(spec.max_requests_per_minute, spec.max_concurrent_requests),
+                state: Arc::new(state),
+            }));
+        }
+
+        Ok(Self {
+            credentials: credentials
+                .into_iter()
+                .map(|(token, tenant_index, grant)| Credential {
+                    token,
+                    tenant: Arc::clone(&tenants[tenant_index]),
+                    grant: Arc::new(grant),
+                })
+                .collect(),
+        })
+    }
+
+    /// The principal owning `headers`' bearer token.
+    pub fn authenticate(&self, headers: &HeaderMap) -> Result<Principal, Rejection> {
+        let token = bearer_token(headers).ok_or(Rejection::Unauthorized)?;
+        // Compare against every credential so timing does not reveal which
+        // prefix of the list matched.
+        let mut found = None;
+        for credential in &self.credentials {
+            if constant_time_eq(credential.token.as_bytes(), token.as_bytes()) {
+                found = Some(Principal {
+                    tenant: Arc::clone(&credential.tenant),
+                    grant: Arc::clone(&credential.grant),
+                });
+            }
+        }
+        found.ok_or(Rejection::Unauthorized)
+    }
+}
+
+/// `[[server.api_keys]]` of a single-project server without tenants, such as
+/// the REST and gRPC APIs of `cruxe serve --http`.
+pub struct ApiKeys {
+    credentials: Vec<(String, Arc<Grant>)>,
+}
+
+impl ApiKeys {
+    /// The configured keys, or `None` when there are none. Keys may only name
+    /// the implicit [`DEFAULT_TENANT`].
+    pub fn from_config(config: &Config) -> Result<Option<Self>, TenantConfigError> {
+        if config.server.api_keys.is_empty() {
+            return Ok(None);
+        }
+        let implicit = [TenantConfig {
+            name: DEFAULT_TENANT.to_string(),
+            ..TenantConfig::default()
+        }];
+        let credentials = resolve_credentials(&implicit, &config.server.api_keys, true)?;
+        Ok(Some(Self {
+            credentials: credentials
+                .into_iter()
+                .map(|(token, _, grant)| (token, Arc::new(grant)))
+                .collect(),
+        }))
+    }
+
+    /// The grant of `headers`' bearer token.
+    pub fn authenticate(&self, headers: &HeaderMap) -> Result<Arc<Grant>, Rejection> {
+        let token = bearer_token(headers).ok_or(Rejection::Unauthorized)?;
+        let mut found = None;
+        for (candidate, grant) in &self.credentials {
+            if constant_time_eq(candidate.as_bytes(), token.as_bytes()) {
+                found = Some(Arc::clone(grant));
+            }
+        }
+        found.ok_or(Rejection::Unauthorized)
+    }
+}
+
+/// Validate tenant and API key entries and resolve their tokens. Returns
+/// `(token, tenant index, grant)` per credential, in config order.
+fn resolve_credentials(
+    specs: &[TenantConfig],
+    keys: &[ApiKeyConfig],
+    implicit_tenant: bool,
+) -> Result<Vec<(String, usize, Grant)>, TenantConfigError> {
+    let mut credentials: Vec<(String, usize, Grant)> = Vec::new();
+    let mut push = |token: String, tenant: usize, grant: Grant| {
+        if credentials.iter().any(|(existing, ..)| *existing == token) {
+            return Err(TenantConfigError::DuplicateToken { owner: grant.name });
+        }
+        credentials.push((token, tenant, grant));
+        Ok(())
+    };
+
+    let mut names = HashSet::new();
+    for (index, spec) in specs.iter().enumerate() {
+        if spec.name.is_empty() {
+            return Err(TenantConfigError::MissingName { index });
+        }
+        if !names.insert(spec.name.as_str()) {
+            return Err(TenantConfigError::DuplicateName {
+                owner: spec.name.clone(),
+            });
+        }
+        if implicit_tenant {
+            continue;
+        }
+        let token = resolve_secret(&spec.name, &spec.token, &spec.token_env)?;
+        push(token, index, Grant::admin(spec.name.clone()))?;
+    }
+
+    let mut key_names = HashSet::new();
+    for (index, key) in keys.iter().enumerate() {
+        if key.name.is_empty() {
+            return Err(TenantConfigError::MissingName { index });
+        }
+        if !key_names.insert(key.name.as_str()) {
+            return Err(TenantConfigError::DuplicateName {
+                owner: key.name.clone(),
+            });
+        }
+        let invalid = |reason: String| TenantConfigError::Invalid {
+            owner: key.name.clone(),
+            reason,
+        };
+        let role = Role::parse(&key.role)
+            .ok_or_else(|| invalid(format!("unknown role {:?}", key.role)))?;
+        let tenant = match (key.tenant.as_deref(), implicit_tenant) {
+            (None | Some(DEFAULT_TENANT), true) => 0,
+            (Some(name), _) => specs
+                .iter()
+                .position(|spec| spec.name == name)
+                .ok_or_else(|| invalid(format!("unknown tenant {name}")))?,
+            (None, false) => return Err(invalid("tenant is required".to_string())),
+        };
+        let token = resolve_secret(&key.name, &key.token, &key.token_env)?;
+        push(
+            token,
+            tenant,
+            Grant {
+                name: key.name.clone(),
+                role,
+                read_prefixes: key
+                    .read_prefixes
+                    .iter()
+                    .map(|prefix| access::normalize_prefix(prefix))
+                    .collect(),
+            },
+        )?;
+    }
+    Ok(credentials)
+}
+
+/// A configured token, or the value of its environment variable.
+fn resolve_secret(
+    owner: &str,
+    token: &Option<String>,
+    token_env: &Option<String>,
+) -> Result<String, TenantConfigError> {
+    token
+        .clone()
+        .or_else(|| {
+            token_env
+                .as_deref()
+                .and_then(|var| std::env::var(var).ok())
+                .map(|value| value.trim().to_string())
+                .filter(|value| !value.is_empty())
+        })
+        .ok_or_else(|| TenantConfigError::MissingToken {
+            owner: owner.to_string(),
+        })
+}
+
+fn bearer_token(headers: &HeaderMap) -> Option<&str> {
+    let value = headers.get(header::AUTHORIZATION)?.to_str().ok()?;
+    let (scheme, token) = value.trim().split_once(' ')?;
+    let token = token.trim();
+    (scheme.eq_ignore_ascii_case("bearer") && !token.is_empty()).then_some(token)
+}
+
+fn constant_time_eq(a: &[u8], b: &[u8]) -> bool {
+    if a.len() != b.len() {
+        return false;
+    }
+    a.iter().zip(b).fold(0u8, |acc, (x, y)| acc | (x ^ y)) == 0
+}
+
+/// GET /health — the authenticated tenant's health.
+pub(crate) async fn health_handler(
+    State(registry): State<Arc<TenantRegistry>>,
+    headers: HeaderMap,
+) -> Response {
+    match registry.authenticate(&headers) {
+        Ok(principal) => health_response(Arc::clone(&principal.tenant.state)).await,
+        Err(rejection) => rejection.into_response(),
+    }
+}
+
+/// GET /metrics — process metrics with the authenticated tenant's index
+/// gauges; other tenants' projects are not shown.
+pub(crate) async fn metrics_handler(
+    State(registry): State<Arc<TenantRegistry>>,
+    headers: HeaderMap,
+) -> Response {
+    match registry.authenticate(&headers) {
+        Ok(principal) => metrics_response(vec![Arc::clone(&principal.tenant.state)]).await,
+        Err(rejection) => rejection.into_response(),
+    }
+}
+
+/// POST / — JSON-RPC dispatched to the authenticated tenant, within quota and
+/// the credential's grant.
+pub(crate) async fn jsonrpc_handler(
+    State(registry): State<Arc<TenantRegistry>>,
+    headers: HeaderMap,
+    body: Bytes,
+) -> Response {
+    let principal = match registry.authenticate(&headers) {
+        Ok(principal) => principal,
+        Err(rejection) => return rejection.into_response(),
+    };
+    let tenant = &principal.tenant;
+    let permit = match tenant.try_acquire() {
+        Ok(permit) => permit,
+        Err(rejection) => {
+            tracing::debug!(tenant = %tenant.name, ?rejection, "Rejected tenant request");
+            return rejection.into_response();
+        }
+    };
+    let caller = Caller {
+        client: principal.grant.name.clone(),
+        tenant: Some(&tenant.name),
+        grant: Some(&principal.grant),
+        permit: Some(permit),
+    };
+    jsonrpc_response(Arc::clone(&tenant.state), &headers, &body, caller).await
+}
+
+/// GET /subscribe — graph deltas of the authenticated tenant, filtered by the
+/// credential's grant.
+pub(crate) async fn subscribe_handler(
+    State(registry): State<Arc<TenantRegistry>>,
+    headers: HeaderMap,
+    Query(params): Query<SubscribeParams>,
+) -> Response {
+    match registry.authenticate(&headers) {
+        Ok(principal) => {
+            subscribe_response(
+                Arc::clone(&principal.tenant.state),
+                params,
+                Some(Arc::clone(&principal.grant)),
+            )
+            .await
+        }
+        Err(rejection) => rejection.into_response(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use axum::body::to_bytes;
+    use axum::http::StatusCode;
+    use serde_json::Value;
+
+    fn spec(name: &str, workspace: &Path, token: &str) -> TenantConfig {
+        TenantConfig {
+            name: name.to_string(),
+            workspace: workspace.to_string_lossy().to_string(),
+            token: Some(token.to_string()),
+            ..TenantConfig::default()
+        }
+    }
+
+    fn key(name: &str, tenant: Option<&str>, token: &str, prefixes: &[&str]) -> ApiKeyConfig {
+        ApiKeyConfig {
+            name: name.to_string(),
+            token: Some(token.to_string()),
+            tenant: tenant.map(str::to_string),
+            read_prefixes: prefixes.iter().map(|p| p.to_string()).collect(),
+            ..ApiKeyConfig::default()
+        }
+    }
+
+    fn registry_with_keys(
+        specs: Vec<TenantConfig>,
+        keys: Vec<ApiKeyConfig>,
+        data_dir: &Path,
+        default_workspace: &Path,
+    ) -> TenantRegistry {
+        let mut config = Config::default();
+        config.storage.data_dir = data_dir.to_string_lossy().to_string();
+        config.server.tenants = specs;
+        config.server.api_keys = keys;
+        TenantRegistry::open(&config, None, true, default_workspace).unwrap()
+    }
+
+    fn registry(specs: Vec<TenantConfig>, data_dir: &Path) -> TenantRegistry {
+        registry_with_keys(specs, Vec::new(), data_dir, data_dir)
+    }
+
+    fn bearer(token: &str) -> HeaderMap {
+        let mut headers = HeaderMap::new();
+        headers.insert(
+            header::AUTHORIZATION,
+            format!("Bearer {token}").parse().unwrap(),
+        );
+        headers
+    }
+
+    #[test]
+    fn tokens_select_isolated_tenants() {
+        let tmp = tempfile::tempdir().unwrap();
+        let (alpha, beta) = (tmp.path().join("alpha"), tmp.path().join("beta"));
+        std::fs::create_dir_all(&alpha).unwrap();
+        std::fs::create_dir_all(&beta).unwrap();
+        let registry = registry(
+            vec![spec("alpha", &alpha, "tok-a"), spec("beta", &beta, "tok-b")],
+            &tmp.path().join("data"),
+        );
+
+        let a = registry.authenticate(&bearer("tok-a")).unwrap();
+        let b = registry.authenticate(&bearer("tok-b")).unwrap();
+        assert_eq!(
+            (a.tenant.name.as_str(), b.tenant.name.as_str()),
+            ("alpha", "beta")
+        );
+        assert_eq!(a.grant.role, Role::Admin);
+        assert_ne!(a.tenant.state.project_id, b.tenant.state.project_id);
+        assert!(!Arc::ptr_eq(
+            &a.tenant.state.connection_manager,
+            &b.tenant.state.connection_manager
+        ));
+
+        assert_eq!(
+            registry.authenticate(&bearer("tok-c")).err(),
+            Some(Rejection::Unauthorized)
+        );
+        assert_eq!(
+            registry.authenticate(&HeaderMap::new()).err(),
+            Some(Rejection::Unauthorized)
+        );
+    }
+
+    #[test]
+    fn tenant_specs_are_validated() {
+        let dir = Path::new("/tmp");
+        let resolve = |specs: &[TenantConfig], keys: &[ApiKeyConfig]| {
+            resolve_credentials(specs, keys, false).unwrap_err()
+        };
+        let err = resolve(&[spec("a", dir, "same"), spec("b", dir, "same")], &[]);
+        assert!(matches!(err, TenantConfigError::DuplicateToken { .. }));
+
+        let err = resolve(&[spec("a", dir, "x"), spec("a", dir, "y")], &[]);
+        assert!(matches!(err, TenantConfigError::DuplicateName { .. }));
+
+        let mut no_token = spec("a", dir, "x");
+        no_token.token = None;
+        no_token.token_env = Some("CRUXE_TEST_TENANT_TOKEN_UNSET".to_string());
+        let err = resolve(&[no_token], &[]);
+        assert!(matches!(err, TenantConfigError::MissingToken { .. }));
+
+        let tenants = [spec("a", dir, "x")];
+        let err = resolve(&tenants, &[key("ci", Some("b"), "k", &[])]);
+        assert!(matches!(err, TenantConfigError::Invalid { .. }));
+        let err = resolve(&tenants, &[key("ci", None, "k", &[])]);
+        assert!(matches!(err, TenantConfigError::Invalid { .. }));
+        let mut bad_role = key("ci", Some("a"), "k", &[]);
+        bad_role.role = "owner".to_string();
+        let err = resolve(&tenants, &[bad_role]);
+        assert!(matches!(err, TenantConfigError::Invalid { .. }));
+    }
+
+    #[test]
+    fn api_keys_guard_a_single_project_server() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("repo");
+        std::fs::create_dir_all(&workspace).unwrap();
+        let registry = registry_with_keys(
+            Vec::new(),
+            vec![key("docs-reader", None, "tok-r", &["./docs/"])],
+            &tmp.path().join("data"),
+            &workspace,
+        );
+
+        let principal = registry.authenticate(&bearer("tok-r")).unwrap();
+        assert_eq!(principal.tenant.name, DEFAULT_TENANT);
+        assert_eq!(principal.grant.role, Role::Reader);
+        assert_eq!(principal.grant.read_prefixes, ["docs/"]);
+        assert!(registry.authenticate(&HeaderMap::new()).is_err());
+    }
+
+    #[test]
+    fn quota_limits_rate_and_concurrency() {
+        let quota = Quota::new(2, 0);
+        let start = Instant::now();
+        assert!(quota.try_acquire(start).is_ok());
+        assert!(quota.try_acquire(start).is_ok());
+        assert_eq!(quota.try_acquire(start).err(), Some(Rejection::RateLimited));
+        assert!(quota.try_acquire(start + RATE_WINDOW).is_ok());
+
+        let quota = Quota::new(0, 1);
+        let held = quota.try_acquire(start).unwrap();
+        assert_eq!(
+            quota.try_acquire(start).err(),
+            Some(Rejection::TooManyConcurrent)
+        );
+        drop(held);
+        assert!(quota.try_acquire(start).is_ok());
+    }
+
+    #[tokio::test]
+    async fn unauthenticated_jsonrpc_is_rejected() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("alpha");
+        std::fs::create_dir_all(&workspace).unwrap();
+        let registry = Arc::new(registry(
+            vec![spec("alpha", &workspace, "tok-a")],
+            &tmp.path().join("data"),
+        ));
+        let request = r#"{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}"#;
+
+        let response = jsonrpc_handler(
+            State(Arc::clone(&registry)),
+            HeaderMap::new(),
+            Bytes::from(request),
+        )
+        .await;
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+        let body = to_bytes(response.into_body(), usize::MAX).await.unwrap();
+        let parsed: Value = serde_json::from_slice(&body).unwrap();
+        assert_eq!(parsed["error"]["code"], "unauthorized");
+
+        let response =
+            jsonrpc_handler(State(registry), bearer("tok-a"), Bytes::from(request)).await;
+        assert_eq!(response.status(), StatusCode::OK);
+    }
+}
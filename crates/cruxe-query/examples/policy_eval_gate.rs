@@ -79,6 +79,7 @@ fn sample_results() -> Vec<SearchResult> {
             kind: Some("function".to_string()),
             name: Some("authenticate".to_string()),
             qualified_name: Some("authenticate".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: Some("pub".to_string()),
@@ -102,6 +103,7 @@ fn sample_results() -> Vec<SearchResult> {
             kind: Some("constant".to_string()),
             name: Some("API_KEY".to_string()),
             qualified_name: Some("API_KEY".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: Some("private".to_string()),
@@ -128,6 +130,7 @@ fn sample_results() -> Vec<SearchResult> {
             kind: Some("function".to_string()),
             name: Some("notify".to_string()),
             qualified_name: Some("notify".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: Some("pub".to_string()),
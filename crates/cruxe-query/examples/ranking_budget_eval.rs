@@ -245,6 +245,7 @@ fn candidate(
         kind: Some(kind.to_string()),
         name: Some(name.to_string()),
         qualified_name: Some(qualified_name.to_string()),
+        canonical_id: None,
         language: "rust".to_string(),
         signature: None,
         visibility: Some("pub".to_string()),
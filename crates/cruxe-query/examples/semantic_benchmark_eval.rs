@@ -156,6 +156,7 @@ fn main() -> Result<(), Box<dyn Error>> {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: args.diversity_enabled,
+                in_docs: false,
             },
         )?;
         let latency_ms = start.elapsed().as_secs_f64() * 1000.0;
@@ -99,6 +99,18 @@ pub struct PlanController {
 
 impl PlanController {
     pub fn select(input: PlanSelectionInput<'_>) -> Self {
+        let controller = Self::choose(input, true);
+        record_selected_plan(controller.selected);
+        controller
+    }
+
+    /// Same choice as [`PlanController::select`] without counting it in the
+    /// plan telemetry; used to explain a query before running it.
+    pub fn preview(input: PlanSelectionInput<'_>) -> Self {
+        Self::choose(input, false)
+    }
+
+    fn choose(input: PlanSelectionInput<'_>, record: bool) -> Self {
         let (selected, selection_reason) = if !input.config.enabled {
             (QueryPlan::HybridStandard, SelectionReason::DisabledFallback)
         } else if input.config.allow_override {
@@ -131,36 +143,47 @@ impl PlanController {
         };
 
         // One-way guard: selected deep cannot execute without semantic runtime.
-        if controller.executed == QueryPlan::SemanticDeep && !input.semantic_runtime_available {
-            controller.downgrade(DowngradeReason::SemanticUnavailable);
+        if controller.executed == QueryPlan::SemanticDeep
+            && !input.semantic_runtime_available
+            && controller.step_down(DowngradeReason::SemanticUnavailable)
+            && record
+        {
+            record_downgrade_reason(DowngradeReason::SemanticUnavailable);
         }
         // If plan was forced to deep and runtime is still unavailable after one-step
         // downgrade, allow another one-way downgrade to lexical_fast.
         if controller.executed == QueryPlan::HybridStandard
             && !input.semantic_runtime_available
             && selection_reason == SelectionReason::Override
+            && controller.step_down(DowngradeReason::SemanticUnavailable)
+            && record
         {
-            controller.downgrade(DowngradeReason::SemanticUnavailable);
+            record_downgrade_reason(DowngradeReason::SemanticUnavailable);
         }
-
-        record_selected_plan(controller.selected);
         controller
     }
 
     pub fn downgrade(&mut self, reason: DowngradeReason) {
+        if self.step_down(reason) {
+            record_downgrade_reason(reason);
+        }
+    }
+
+    /// Move `executed` one plan down; false when already at the bottom.
+    fn step_down(&mut self, reason: DowngradeReason) -> bool {
         let next = match self.executed {
             QueryPlan::SemanticDeep => QueryPlan::HybridStandard,
             QueryPlan::HybridStandard => QueryPlan::LexicalFast,
             QueryPlan::LexicalFast => QueryPlan::LexicalFast,
         };
         if next == self.executed {
-            return;
+            return false;
         }
         self.executed = next;
         self.downgraded = true;
         self.downgrade_reason = Some(reason);
         self.downgrade_reason_flags |= downgrade_reason_flag(reason);
-        record_downgrade_reason(reason);
+        true
     }
 
     pub fn ensure_latency_budget(&mut self, elapsed_ms: u64, budget: PlanBudget) {
@@ -0,0 +1,275 @@
+//! Aliasing of content-identical symbols that live under several paths
+//! (a vendored copy next to the original, an internal fork, a module cache
+//! checked into the tree).
+//!
+//! Copies are symbols with the same name, kind and body hash at different
+//! paths. Each group gets one canonical symbol, preferring a path outside
+//! vendor-style directories, then the shortest path. Reference counts and
+//! dead-code analysis fold the copies into the canonical symbol so a function
+//! called only through its vendored twin is neither split nor reported dead.
+
+use crate::graph_export::GraphSnapshot;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+
+/// Bodies shorter than this (accessors, empty constructors) are too common to
+/// identify a copy.
+pub const MIN_ALIAS_BODY_BYTES: usize = 64;
+
+/// Path segments that mark copied third-party code.
+const VENDOR_SEGMENTS: &[&str] = &[
+    "vendor",
+    "third_party",
+    "third-party",
+    "node_modules",
+    "external",
+    "pkg/mod",
+];
+
+/// One canonical symbol and its copies.
+#[derive(Debug, Clone, Serialize)]
+pub struct AliasGroup {
+    pub canonical: AliasedSymbol,
+    pub aliases: Vec<AliasedSymbol>,
+}
+
+#[derive(Debug, Clone, Serialize, PartialEq, Eq)]
+pub struct AliasedSymbol {
+    pub symbol_id: String,
+    pub symbol_stable_id: String,
+    pub qualified_name: String,
+    pub path: String,
+    pub line_start: u32,
+}
+
+impl From<&SymbolRecord> for AliasedSymbol {
+    fn from(symbol: &SymbolRecord) -> Self {
+        Self {
+            symbol_id: symbol.symbol_id.clone(),
+            symbol_stable_id: symbol.symbol_stable_id.clone(),
+            qualified_name: symbol.qualified_name.clone(),
+            path: symbol.path.clone(),
+            line_start: symbol.line_start,
+        }
+    }
+}
+
+/// Alias groups of a repo/ref, indexed by every member id.
+#[derive(Debug, Clone, Default)]
+pub struct SymbolAliases {
+    groups: Vec<AliasGroup>,
+    /// Symbol id or stable id of any member -> index into `groups`.
+    by_id: HashMap<String, usize>,
+}
+
+impl SymbolAliases {
+    pub fn from_duplicates(duplicates: Vec<Vec<SymbolRecord>>) -> Self {
+        let mut aliases = Self::default();
+        for mut members in duplicates {
+            if members.len() < 2 {
+                continue;
+            }
+            members.sort_by(|a, b| canonical_order(&a.path, &b.path));
+            let group_index = aliases.groups.len();
+            for member in &members {
+                aliases.by_id.insert(member.symbol_id.clone(), group_index);
+                aliases
+                    .by_id
+                    .insert(member.symbol_stable_id.clone(), group_index);
+            }
+            aliases.groups.push(AliasGroup {
+                canonical: AliasedSymbol::from(&members[0]),
+                aliases: members[1..].iter().map(AliasedSymbol::from).collect(),
+            });
+        }
+        aliases
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.groups.is_empty()
+    }
+
+    pub fn groups(&self) -> &[AliasGroup] {
+        &self.groups
+    }
+
+    /// The group `id` (symbol id or stable id) belongs to.
+    pub fn group_of(&self, id: &str) -> Option<&AliasGroup> {
+        self.by_id.get(id).map(|&index| &self.groups[index])
+    }
+
+    /// Stable id of the canonical copy of `id`, or `id` itself.
+    pub fn canonical_id<'a>(&'a self, id: &'a str) -> &'a str {
+        self.group_of(id)
+            .map_or(id, |group| group.canonical.symbol_stable_id.as_str())
+    }
+
+    /// Fold copies into their canonical symbol: edges to or from a copy are
+    /// re-pointed at the canonical node and the copy nodes are dropped.
+    /// Returns the number of nodes removed.
+    pub fn apply_to_snapshot(&self, snapshot: &mut GraphSnapshot) -> usize {
+        if self.is_empty() {
+            return 0;
+        }
+        let present: HashSet<&str> = snapshot.nodes.iter().map(|n| n.id.as_str()).collect();
+        let mut rewrite: HashMap<String, String> = HashMap::new();
+        for group in &self.groups {
+            let canonical = group.canonical.symbol_stable_id.as_str();
+            if !present.contains(canonical) {
+                continue;
+            }
+            for alias in &group.aliases {
+                if alias.symbol_stable_id != canonical {
+                    rewrite.insert(alias.symbol_stable_id.clone(), canonical.to_string());
+                }
+            }
+        }
+        if rewrite.is_empty() {
+            return 0;
+        }
+
+        for edge in &mut snapshot.edges {
+            if let Some(canonical) = rewrite.get(&edge.source) {
+                edge.source = canonical.clone();
+            }
+            if let Some(canonical) = rewrite.get(&edge.target) {
+                edge.target = canonical.clone();
+            }
+        }
+        let before = snapshot.nodes.len();
+        snapshot
+            .nodes
+            .retain(|node| !rewrite.contains_key(&node.id));
+        before - snapshot.nodes.len()
+    }
+}
+
+/// Load the alias groups of a repo/ref.
+pub fn load_symbol_aliases(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<SymbolAliases, StateError> {
+    Ok(SymbolAliases::from_duplicates(
+        symbols::list_content_duplicates(conn, repo, ref_name, MIN_ALIAS_BODY_BYTES)?,
+    ))
+}
+
+/// Canonical copies first: outside vendor directories, then shorter paths,
+/// then by path.
+fn canonical_order(a: &str, b: &str) -> std::cmp::Ordering {
+    is_vendored(a)
+        .cmp(&is_vendored(b))
+        .then_with(|| a.len().cmp(&b.len()))
+        .then_with(|| a.cmp(b))
+}
+
+fn is_vendored(path: &str) -> bool {
+    let path = format!("/{}/", path.trim_matches('/'));
+    VENDOR_SEGMENTS
+        .iter()
+        .any(|segment| path.contains(&format!("/{segment}/")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::{GraphEdge, GraphNode};
+    use cruxe_core::types::SymbolKind;
+
+    fn record(path: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{path}"),
+            symbol_stable_id: format!("stable::{path}"),
+            name: "Parse".to_string(),
+            qualified_name: "Parse".to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: 3,
+            line_end: 20,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn node(id: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: id.to_string(),
+            kind: "function".to_string(),
+            language: "go".to_string(),
+            package: String::new(),
+            path: String::new(),
+            line_start: 1,
+            line_end: 2,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    #[test]
+    fn canonical_copy_prefers_first_party_then_short_paths() {
+        let aliases = SymbolAliases::from_duplicates(vec![vec![
+            record("vendor/github.com/acme/parse/parse.go"),
+            record("internal/forks/parse/parse.go"),
+            record("parse/parse.go"),
+        ]]);
+        let group = &aliases.groups()[0];
+        assert_eq!(group.canonical.path, "parse/parse.go");
+        assert_eq!(group.aliases[0].path, "internal/forks/parse/parse.go");
+        assert_eq!(
+            aliases.canonical_id("sym::vendor/github.com/acme/parse/parse.go"),
+            "stable::parse/parse.go"
+        );
+        assert_eq!(aliases.canonical_id("unrelated"), "unrelated");
+    }
+
+    #[test]
+    fn snapshot_folds_copies_into_canonical_node() {
+        let aliases = SymbolAliases::from_duplicates(vec![vec![
+            record("parse/parse.go"),
+            record("vendor/parse/parse.go"),
+        ]]);
+        let mut snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("stable::parse/parse.go"),
+                node("stable::vendor/parse/parse.go"),
+                node("main"),
+            ],
+            edges: vec![
+                edge("main", "stable::vendor/parse/parse.go"),
+                edge("stable::vendor/parse/parse.go", "main"),
+            ],
+            unresolved_edges: 0,
+        };
+
+        assert_eq!(aliases.apply_to_snapshot(&mut snapshot), 1);
+        let ids: Vec<&str> = snapshot.nodes.iter().map(|n| n.id.as_str()).collect();
+        assert_eq!(ids, ["stable::parse/parse.go", "main"]);
+        assert_eq!(snapshot.edges[0].target, "stable::parse/parse.go");
+        assert_eq!(snapshot.edges[1].source, "stable::parse/parse.go");
+    }
+}
@@ -0,0 +1,598 @@
+//! Exported API of an indexed ref, for `cruxe api`, and the compatibility
+//! diff between two refs, for `cruxe api diff`.
+//!
+//! An item is an exported function, method, type, constant or variable
+//! outside test files, plus the exported fields of Go and Rust structs,
+//! read from their stored bodies. Methods of unexported types are left out.
+//! Items are paired across refs by kind and qualified name; anything that
+//! disappears or changes shape breaks callers, anything new is additive.
+
+use crate::deadcode::is_exported;
+use crate::deps::package_name;
+use crate::impact::is_test_path;
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+
+#[derive(Debug, thiserror::Error)]
+pub enum ApiError {
+    #[error("ref `{0}` has no indexed symbols")]
+    RefNotIndexed(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ApiItem {
+    /// Symbol kind, or `field` for a struct field.
+    pub kind: String,
+    pub qualified_name: String,
+    pub package: String,
+    pub path: String,
+    pub line: u32,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+    /// A method of an interface or trait, which implementers must provide
+    /// when it is new.
+    #[serde(skip_serializing_if = "std::ops::Not::not")]
+    pub required: bool,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ApiSurface {
+    pub repo: String,
+    pub ref_name: String,
+    /// Items per package.
+    pub packages: BTreeMap<String, usize>,
+    /// In path and line order.
+    pub items: Vec<ApiItem>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum ApiChangeKind {
+    Added,
+    Removed,
+    SignatureChanged,
+    /// Same name, different package: importers must change their imports.
+    PackageChanged,
+}
+
+impl ApiChangeKind {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Added => "added",
+            Self::Removed => "removed",
+            Self::SignatureChanged => "signature_changed",
+            Self::PackageChanged => "package_changed",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum Compatibility {
+    Breaking,
+    Additive,
+}
+
+impl Compatibility {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Breaking => "breaking",
+            Self::Additive => "additive",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ApiChange {
+    pub change: ApiChangeKind,
+    pub compatibility: Compatibility,
+    /// The head item; the base one for removals.
+    pub item: ApiItem,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_signature: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_package: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ApiDiff {
+    pub repo: String,
+    pub base_ref: String,
+    pub head_ref: String,
+    pub breaking: usize,
+    pub additive: usize,
+    /// Smallest semver bump the changes call for: `major`, `minor` or
+    /// `patch`.
+    pub bump: String,
+    /// Breaking changes first, then by path and line.
+    pub changes: Vec<ApiChange>,
+}
+
+/// The exported API of `ref_name`, optionally only under `path_prefix`.
+pub fn extract_api(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path_prefix: Option<&str>,
+) -> Result<ApiSurface, ApiError> {
+    let records = symbols::list_symbols_for_ref(conn, repo, ref_name)?;
+    if records.is_empty() {
+        return Err(ApiError::RefNotIndexed(ref_name.to_string()));
+    }
+    let prefix = path_prefix.unwrap_or_default();
+    let mut parents: HashMap<&str, &SymbolRecord> = HashMap::new();
+    for record in &records {
+        parents.insert(record.symbol_stable_id.as_str(), record);
+        parents.entry(record.symbol_id.as_str()).or_insert(record);
+    }
+
+    let mut items = Vec::new();
+    for record in &records {
+        if !record.path.starts_with(prefix)
+            || is_test_path(&record.path)
+            || !is_api_kind(record)
+            || !is_exported(record)
+        {
+            continue;
+        }
+        let parent = record
+            .parent_symbol_id
+            .as_deref()
+            .and_then(|id| parents.get(id));
+        if parent.is_some_and(|parent| !is_exported(parent)) {
+            continue;
+        }
+        items.push(ApiItem {
+            kind: record.kind.as_str().to_string(),
+            qualified_name: record.qualified_name.clone(),
+            package: package_name(&record.path, 0),
+            path: record.path.clone(),
+            line: record.line_start,
+            signature: record.signature.as_deref().map(normalize),
+            required: record.kind == SymbolKind::Method
+                && parent.is_some_and(|parent| {
+                    matches!(parent.kind, SymbolKind::Interface | SymbolKind::Trait)
+                }),
+        });
+    }
+
+    for language in ["go", "rust"] {
+        symbols::for_each_struct_body(conn, repo, ref_name, language, |record| {
+            if record.path.starts_with(prefix)
+                && !is_test_path(&record.path)
+                && is_exported(&record)
+                && let Some(body) = record.content.as_deref()
+            {
+                items.extend(struct_fields(&record, body));
+            }
+            Ok(())
+        })?;
+    }
+
+    items.sort_by(|a, b| {
+        (&a.path, a.line, &a.qualified_name).cmp(&(&b.path, b.line, &b.qualified_name))
+    });
+    let mut packages = BTreeMap::new();
+    for item in &items {
+        *packages.entry(item.package.clone()).or_default() += 1;
+    }
+    Ok(ApiSurface {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        packages,
+        items,
+    })
+}
+
+/// Classify how the exported API changed from `base_ref` to `head_ref`.
+pub fn diff_api(
+    conn: &Connection,
+    repo: &str,
+    base_ref: &str,
+    head_ref: &str,
+    path_prefix: Option<&str>,
+) -> Result<ApiDiff, ApiError> {
+    let base = extract_api(conn, repo, base_ref, path_prefix)?;
+    let head = extract_api(conn, repo, head_ref, path_prefix)?;
+    Ok(compare_surfaces(repo, base, head))
+}
+
+fn compare_surfaces(repo: &str, base: ApiSurface, head: ApiSurface) -> ApiDiff {
+    let mut remaining: HashMap<(String, String), Vec<ApiItem>> = HashMap::new();
+    for item in head.items {
+        remaining
+            .entry((item.kind.clone(), item.qualified_name.clone()))
+            .or_default()
+            .push(item);
+    }
+
+    let mut changes = Vec::new();
+    for before in base.items {
+        let candidates = remaining
+            .get_mut(&(before.kind.clone(), before.qualified_name.clone()))
+            .filter(|candidates| !candidates.is_empty());
+        let Some(candidates) = candidates else {
+            changes.push(ApiChange {
+                change: ApiChangeKind::Removed,
+                compatibility: Compatibility::Breaking,
+                item: before,
+                old_signature: None,
+                old_package: None,
+            });
+            continue;
+        };
+        // Same-named items of several packages pair within their package.
+        let pos = candidates
+            .iter()
+            .position(|after| after.package == before.package)
+            .unwrap_or(0);
+        let after = candidates.remove(pos);
+        let change = if after.package != before.package {
+            ApiChangeKind::PackageChanged
+        } else if after.signature != before.signature {
+            ApiChangeKind::SignatureChanged
+        } else {
+            continue;
+        };
+        changes.push(ApiChange {
+            change,
+            compatibility: Compatibility::Breaking,
+            old_signature: (after.signature != before.signature)
+                .then_some(before.signature)
+                .flatten(),
+            old_package: (after.package != before.package).then_some(before.package),
+            item: after,
+        });
+    }
+    for after in remaining.into_values().flatten() {
+        changes.push(ApiChange {
+            change: ApiChangeKind::Added,
+            compatibility: if after.required {
+                Compatibility::Breaking
+            } else {
+                Compatibility::Additive
+            },
+            item: after,
+            old_signature: None,
+            old_package: None,
+        });
+    }
+
+    changes.sort_by(|a, b| {
+        (
+            a.compatibility,
+            &a.item.path,
+            a.item.line,
+            &a.item.qualified_name,
+        )
+            .cmp(&(
+                b.compatibility,
+                &b.item.path,
+                b.item.line,
+                &b.item.qualified_name,
+            ))
+    });
+    let count = |compatibility| {
+        changes
+            .iter()
+            .filter(|change| change.compatibility == compatibility)
+            .count()
+    };
+    let (breaking, additive) = (
+        count(Compatibility::Breaking),
+        count(Compatibility::Additive),
+    );
+    let bump = if breaking > 0 {
+        "major"
+    } else if additive > 0 {
+        "minor"
+    } else {
+        "patch"
+    };
+    ApiDiff {
+        repo: repo.to_string(),
+        base_ref: base.ref_name,
+        head_ref: head.ref_name,
+        breaking,
+        additive,
+        bump: bump.to_string(),
+        changes,
+    }
+}
+
+fn is_api_kind(record: &SymbolRecord) -> bool {
+    match record.kind {
+        SymbolKind::Module => false,
+        // Locals are not API, whatever their names look like.
+        SymbolKind::Variable | SymbolKind::Constant => record.parent_symbol_id.is_none(),
+        _ => true,
+    }
+}
+
+/// Exported fields of a struct body: capitalized in Go, `pub` in Rust.
+fn struct_fields(record: &SymbolRecord, body: &str) -> Vec<ApiItem> {
+    let Some(open) = body.find('{') else {
+        return Vec::new();
+    };
+    let close = body
+        .rfind('}')
+        .filter(|&close| close > open)
+        .unwrap_or(body.len());
+    let mut fields = Vec::new();
+    let mut depth = 0usize;
+    for (offset, raw) in body[open + 1..close].lines().enumerate() {
+        let line = raw.split("//").next().unwrap_or_default().trim();
+        let top_level = depth == 0;
+        depth = (depth + line.matches('{').count()).saturating_sub(line.matches('}').count());
+        if !top_level || line.is_empty() || line.starts_with("/*") || line.starts_with('*') {
+            continue;
+        }
+        let line = line.trim_end_matches(',');
+        let declared: Vec<(&str, String)> = match record.language.as_str() {
+            "go" => go_fields(line),
+            "rust" => line
+                .strip_prefix("pub ")
+                .and_then(|rest| rest.split_once(':'))
+                .map(|(name, _)| vec![(name.trim(), normalize(line))])
+                .unwrap_or_default(),
+            _ => Vec::new(),
+        };
+        for (name, signature) in declared {
+            fields.push(ApiItem {
+                kind: "field".to_string(),
+                qualified_name: format!("{}.{}", record.qualified_name, name),
+                package: package_name(&record.path, 0),
+                path: record.path.clone(),
+                line: record.line_start + offset as u32,
+                signature: Some(signature),
+                required: false,
+            });
+        }
+    }
+    fields
+}
+
+/// Exported fields declared on one line of a Go struct with their
+/// `Name Type` signatures: `A, B int`, `Name Type` with a tag, or an
+/// embedded `*pkg.Type`, which is named after the type.
+fn go_fields(line: &str) -> Vec<(&str, String)> {
+    let line = line.split('`').next().unwrap_or(line).trim();
+    let mut names = Vec::new();
+    let mut rest = line;
+    loop {
+        let end = rest
+            .find(|c: char| !(c.is_alphanumeric() || c == '_'))
+            .unwrap_or(rest.len());
+        names.push(&rest[..end]);
+        let tail = rest[end..].trim_start();
+        match tail.strip_prefix(',') {
+            Some(more) => rest = more.trim_start(),
+            None => {
+                rest = tail;
+                break;
+            }
+        }
+    }
+    let embedded =
+        line.starts_with('*') || (names.len() == 1 && (rest.is_empty() || rest.starts_with('.')));
+    let fields: Vec<(&str, String)> = if embedded {
+        let name = line.trim_start_matches('*');
+        vec![(name.rsplit('.').next().unwrap_or(name), normalize(line))]
+    } else {
+        names
+            .into_iter()
+            .map(|name| (name, normalize(&format!("{name} {rest}"))))
+            .collect()
+    };
+    fields
+        .into_iter()
+        .filter(|(name, _)| name.starts_with(|c: char| c.is_ascii_uppercase()))
+        .collect()
+}
+
+/// Signatures compared with whitespace runs collapsed.
+fn normalize(signature: &str) -> String {
+    signature.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_state::{db, schema};
+
+    fn symbol(
+        ref_name: &str,
+        name: &str,
+        kind: SymbolKind,
+        path: &str,
+        signature: &str,
+        content: Option<&str>,
+    ) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: ref_name.to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("{ref_name}::{path}::{name}"),
+            symbol_stable_id: format!("stable::{path}::{name}"),
+            name: name.rsplit('.').next().unwrap_or(name).to_string(),
+            qualified_name: format!("store.{name}"),
+            kind,
+            signature: Some(signature.to_string()),
+            line_start: 10,
+            line_end: 20,
+            parent_symbol_id: None,
+            visibility: None,
+            content: content.map(ToString::to_string),
+        }
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (tmp, conn)
+    }
+
+    fn seed(conn: &Connection) {
+        let base = [
+            symbol(
+                "v1",
+                "Open",
+                SymbolKind::Function,
+                "store/db.go",
+                "func Open(dsn string) (*DB, error)",
+                None,
+            ),
+            symbol(
+                "v1",
+                "Close",
+                SymbolKind::Function,
+                "store/db.go",
+                "func Close()",
+                None,
+            ),
+            symbol(
+                "v1",
+                "helper",
+                SymbolKind::Function,
+                "store/db.go",
+                "func helper()",
+                None,
+            ),
+            symbol(
+                "v1",
+                "Config",
+                SymbolKind::Struct,
+                "store/config.go",
+                "type Config struct",
+                Some("type Config struct {\n\tDSN string\n\tTimeout, Retries int\n\tcache bool\n}"),
+            ),
+        ];
+        let head = [
+            symbol(
+                "v2",
+                "Open",
+                SymbolKind::Function,
+                "store/db.go",
+                "func Open(dsn string, opts ...Option) (*DB, error)",
+                None,
+            ),
+            symbol(
+                "v2",
+                "Ping",
+                SymbolKind::Function,
+                "store/db.go",
+                "func Ping() error",
+                None,
+            ),
+            symbol(
+                "v2",
+                "helper",
+                SymbolKind::Function,
+                "store/db.go",
+                "func helper(x int)",
+                None,
+            ),
+            symbol(
+                "v2",
+                "Config",
+                SymbolKind::Struct,
+                "store/config.go",
+                "type Config struct",
+                Some("type Config struct {\n\tDSN string\n\tTimeout int\n\tLogger\n}"),
+            ),
+        ];
+        for record in base.iter().chain(&head) {
+            symbols::insert_symbol(conn, record).unwrap();
+        }
+    }
+
+    #[test]
+    fn extracts_exported_items_and_struct_fields() {
+        let (_tmp, conn) = setup();
+        seed(&conn);
+        let surface = extract_api(&conn, "repo", "v1", None).unwrap();
+        let names: Vec<(&str, &str)> = surface
+            .items
+            .iter()
+            .map(|item| (item.kind.as_str(), item.qualified_name.as_str()))
+            .collect();
+        assert_eq!(
+            names,
+            [
+                ("struct", "store.Config"),
+                ("field", "store.Config.DSN"),
+                ("field", "store.Config.Retries"),
+                ("field", "store.Config.Timeout"),
+                ("function", "store.Close"),
+                ("function", "store.Open"),
+            ]
+        );
+        assert_eq!(surface.packages["store"], 6);
+        assert!(matches!(
+            extract_api(&conn, "repo", "v9", None),
+            Err(ApiError::RefNotIndexed(_))
+        ));
+    }
+
+    #[test]
+    fn removals_and_signature_changes_break_additions_do_not() {
+        let (_tmp, conn) = setup();
+        seed(&conn);
+        let diff = diff_api(&conn, "repo", "v1", "v2", None).unwrap();
+        let changes: Vec<(&str, &str, &str)> = diff
+            .changes
+            .iter()
+            .map(|change| {
+                (
+                    change.compatibility.as_str(),
+                    change.change.as_str(),
+                    change.item.qualified_name.as_str(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            changes,
+            [
+                ("breaking", "removed", "store.Config.Retries"),
+                ("breaking", "removed", "store.Close"),
+                ("breaking", "signature_changed", "store.Open"),
+                ("additive", "added", "store.Config.Logger"),
+                ("additive", "added", "store.Ping"),
+            ]
+        );
+        assert_eq!(diff.bump, "major");
+        let open = &diff.changes[2];
+        assert_eq!(
+            open.old_signature.as_deref(),
+            Some("func Open(dsn string) (*DB, error)")
+        );
+    }
+
+    #[test]
+    fn go_field_lists_embedding_and_tags() {
+        let names = |line| -> Vec<(&str, String)> { go_fields(line) };
+        assert_eq!(
+            names("Name  string `json:\"name\"`"),
+            [("Name", "Name string".to_string())]
+        );
+        assert_eq!(
+            names("A, B, c int"),
+            [("A", "A int".to_string()), ("B", "B int".to_string())]
+        );
+        assert_eq!(
+            names("*http.Client"),
+            [("Client", "*http.Client".to_string())]
+        );
+        assert!(names("private int").is_empty());
+    }
+}
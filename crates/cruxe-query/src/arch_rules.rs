@@ -0,0 +1,507 @@
+//! Declarative architecture rules for `cruxe lint-arch`: which packages a
+//! package may call or import, and whether calls must go through
+//! interfaces. Every resolved call and import edge between two packages is
+//! checked against the rules of `.cruxe/rules.toml`.
+//!
+//! "Through an interface" is judged from the call graph alone: the callee
+//! must be a method whose name an interface or trait declares. A call the
+//! indexer resolved to a concrete method of that name passes, since a call
+//! on an interface value resolves the same way.
+
+use crate::graph_export::{GraphNode, GraphSnapshot, load_graph_snapshot};
+use crate::impls::go_interface_methods;
+use cruxe_core::config::{ArchRuleConfig, ArchRulesFile};
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolKind;
+use cruxe_state::symbols;
+use globset::{GlobBuilder, GlobMatcher, GlobSet, GlobSetBuilder};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+
+#[derive(Debug, thiserror::Error)]
+pub enum ArchRulesError {
+    #[error("rule `{rule}`: {reason}")]
+    InvalidRule { rule: String, reason: String },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, JsonSchema)]
+#[serde(rename_all = "kebab-case")]
+pub enum ArchConstraint {
+    /// A call into a package outside `may_call`.
+    MayCall,
+    MustNotCall,
+    /// An import of a package outside `may_import`.
+    MayImport,
+    MustNotImport,
+    /// A call to a concrete function with `via = "interface"`.
+    ViaInterface,
+}
+
+impl ArchConstraint {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::MayCall => "may-call",
+            Self::MustNotCall => "must-not-call",
+            Self::MayImport => "may-import",
+            Self::MustNotImport => "must-not-import",
+            Self::ViaInterface => "via-interface",
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ArchViolation {
+    pub rule: String,
+    pub constraint: ArchConstraint,
+    pub message: String,
+    /// Calling symbol, or importing file.
+    pub from: String,
+    /// Called or imported symbol.
+    pub to: String,
+    pub from_package: String,
+    pub to_package: String,
+    /// Location of the call or import; empty when the edge has none.
+    pub path: String,
+    pub line: u32,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ArchReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub rules: usize,
+    /// Calls and imports between two packages that were checked.
+    pub edges: usize,
+    pub violations: Vec<ArchViolation>,
+}
+
+#[derive(Debug, Clone)]
+struct CompiledRule {
+    name: String,
+    from: GlobMatcher,
+    may_call: Option<(GlobSet, Vec<String>)>,
+    must_not_call: GlobSet,
+    may_import: Option<(GlobSet, Vec<String>)>,
+    must_not_import: GlobSet,
+    via_interface: bool,
+    message: Option<String>,
+}
+
+/// Rules compiled from an [`ArchRulesFile`].
+#[derive(Debug, Clone, Default)]
+pub struct ArchRules {
+    rules: Vec<CompiledRule>,
+}
+
+impl ArchRules {
+    pub fn compile(file: &ArchRulesFile) -> Result<Self, ArchRulesError> {
+        let mut names = HashSet::new();
+        let rules = file
+            .rules
+            .iter()
+            .map(|rule| {
+                if !names.insert(rule.name.as_str()) {
+                    return Err(invalid(rule, "duplicate rule name".to_string()));
+                }
+                compile_rule(rule)
+            })
+            .collect::<Result<Vec<_>, _>>()?;
+        Ok(Self { rules })
+    }
+
+    pub fn len(&self) -> usize {
+        self.rules.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+}
+
+fn compile_rule(rule: &ArchRuleConfig) -> Result<CompiledRule, ArchRulesError> {
+    if rule.name.trim().is_empty() {
+        return Err(invalid(rule, "missing `name`".to_string()));
+    }
+    if rule.from.trim().is_empty() {
+        return Err(invalid(rule, "missing `from`".to_string()));
+    }
+    let via_interface = match rule.via.as_deref() {
+        None => false,
+        Some("interface" | "interfaces") => true,
+        Some(other) => {
+            return Err(invalid(
+                rule,
+                format!("unknown `via` value `{other}` (expected `interface`)"),
+            ));
+        }
+    };
+    let allow_list = |patterns: &Option<Vec<String>>| {
+        patterns
+            .as_ref()
+            .map(|patterns| Ok((glob_set(rule, patterns)?, patterns.clone())))
+            .transpose()
+    };
+    Ok(CompiledRule {
+        name: rule.name.clone(),
+        from: glob(rule, &rule.from)?.compile_matcher(),
+        may_call: allow_list(&rule.may_call)?,
+        must_not_call: glob_set(rule, &rule.must_not_call)?,
+        may_import: allow_list(&rule.may_import)?,
+        must_not_import: glob_set(rule, &rule.must_not_import)?,
+        via_interface,
+        message: rule.message.clone(),
+    })
+}
+
+fn invalid(rule: &ArchRuleConfig, reason: String) -> ArchRulesError {
+    ArchRulesError::InvalidRule {
+        rule: rule.name.clone(),
+        reason,
+    }
+}
+
+fn glob(rule: &ArchRuleConfig, pattern: &str) -> Result<globset::Glob, ArchRulesError> {
+    GlobBuilder::new(pattern.trim_end_matches('/'))
+        .literal_separator(true)
+        .build()
+        .map_err(|e| invalid(rule, format!("`{pattern}`: {e}")))
+}
+
+fn glob_set(rule: &ArchRuleConfig, patterns: &[String]) -> Result<GlobSet, ArchRulesError> {
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        builder.add(glob(rule, pattern)?);
+    }
+    builder.build().map_err(|e| invalid(rule, e.to_string()))
+}
+
+/// Check the call and import edges of `ref_name` against `rules`.
+pub fn lint_architecture(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    rules: &ArchRules,
+) -> Result<ArchReport, ArchRulesError> {
+    let snapshot = load_graph_snapshot(conn, repo, ref_name)?;
+    let interface_methods = interface_methods(conn, repo, ref_name)?;
+    Ok(check_snapshot(&snapshot, &interface_methods, rules))
+}
+
+/// Names of the methods declared by interfaces and traits: parsed from Go
+/// interface bodies, and the indexed children of other languages' ones.
+fn interface_methods(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<HashSet<String>, StateError> {
+    let mut names = HashSet::new();
+    let mut interfaces = HashSet::new();
+    let mut children: Vec<(String, String)> = Vec::new();
+    symbols::for_each_symbol_body(conn, repo, ref_name, |symbol| {
+        match symbol.kind {
+            SymbolKind::Interface | SymbolKind::Trait => {
+                if symbol.language == "go"
+                    && let Some(content) = &symbol.content
+                {
+                    let body: Vec<String> = content.lines().map(str::to_string).collect();
+                    names.extend(go_interface_methods(&body));
+                }
+                interfaces.insert(symbol.symbol_id);
+            }
+            SymbolKind::Method | SymbolKind::Function => {
+                if let Some(parent) = symbol.parent_symbol_id {
+                    children.push((parent, symbol.name));
+                }
+            }
+            _ => {}
+        }
+        Ok(())
+    })?;
+    names.extend(
+        children
+            .into_iter()
+            .filter(|(parent, _)| interfaces.contains(parent))
+            .map(|(_, name)| name),
+    );
+    Ok(names)
+}
+
+fn check_snapshot(
+    snapshot: &GraphSnapshot,
+    interface_methods: &HashSet<String>,
+    rules: &ArchRules,
+) -> ArchReport {
+    let nodes: HashMap<&str, &GraphNode> = snapshot
+        .nodes
+        .iter()
+        .map(|node| (node.id.as_str(), node))
+        .collect();
+    let mut edges = 0;
+    let mut violations = Vec::new();
+    for edge in &snapshot.edges {
+        let calls = match edge.kind.as_str() {
+            "calls" => true,
+            "imports" => false,
+            _ => continue,
+        };
+        let (Some(from), Some(to)) = (
+            nodes.get(edge.source.as_str()),
+            nodes.get(edge.target.as_str()),
+        ) else {
+            continue;
+        };
+        // Unresolved targets and external code belong to no package.
+        if to.kind == "unknown" || to.path.is_empty() || from.package == to.package {
+            continue;
+        }
+        edges += 1;
+        for rule in &rules.rules {
+            if !rule.from.is_match(&from.package) {
+                continue;
+            }
+            let broken = if calls {
+                call_violation(rule, &from.package, to, interface_methods)
+            } else {
+                import_violation(rule, &from.package, to)
+            };
+            let Some((constraint, message)) = broken else {
+                continue;
+            };
+            violations.push(ArchViolation {
+                rule: rule.name.clone(),
+                constraint,
+                message: match &rule.message {
+                    Some(explanation) => format!("{message}: {explanation}"),
+                    None => message,
+                },
+                from: from.qualified_name.clone(),
+                to: to.qualified_name.clone(),
+                from_package: from.package.clone(),
+                to_package: to.package.clone(),
+                path: edge.file.clone().unwrap_or_else(|| from.path.clone()),
+                line: edge.line.unwrap_or(from.line_start),
+            });
+        }
+    }
+    violations
+        .sort_by(|a, b| (&a.path, a.line, &a.rule, &a.to).cmp(&(&b.path, b.line, &b.rule, &b.to)));
+    violations.dedup();
+    ArchReport {
+        repo: snapshot.repo.clone(),
+        ref_name: snapshot.ref_name.clone(),
+        rules: rules.len(),
+        edges,
+        violations,
+    }
+}
+
+fn call_violation(
+    rule: &CompiledRule,
+    from: &str,
+    to: &GraphNode,
+    interface_methods: &HashSet<String>,
+) -> Option<(ArchConstraint, String)> {
+    let package = &to.package;
+    if rule.must_not_call.is_match(package) {
+        return Some((
+            ArchConstraint::MustNotCall,
+            format!("{from} must not call {package}"),
+        ));
+    }
+    if let Some((allowed, patterns)) = &rule.may_call
+        && !allowed.is_match(package)
+    {
+        return Some((
+            ArchConstraint::MayCall,
+            format!(
+                "{from} may only call {}, not {package}",
+                patterns.join(", ")
+            ),
+        ));
+    }
+    let through_interface = to.kind == "method" && interface_methods.contains(&to.name);
+    if rule.via_interface && !through_interface {
+        return Some((
+            ArchConstraint::ViaInterface,
+            format!(
+                "{from} may only call {package} through interfaces, not `{}`",
+                to.qualified_name
+            ),
+        ));
+    }
+    None
+}
+
+fn import_violation(
+    rule: &CompiledRule,
+    from: &str,
+    to: &GraphNode,
+) -> Option<(ArchConstraint, String)> {
+    let package = &to.package;
+    if rule.must_not_import.is_match(package) {
+        return Some((
+            ArchConstraint::MustNotImport,
+            format!("{from} must not import {package}"),
+        ));
+    }
+    if let Some((allowed, patterns)) = &rule.may_import
+        && !allowed.is_match(package)
+    {
+        return Some((
+            ArchConstraint::MayImport,
+            format!(
+                "{from} may only import {}, not {package}",
+                patterns.join(", ")
+            ),
+        ));
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+
+    fn node(id: &str, kind: &str, path: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.rsplit('.').next().unwrap_or(id).to_string(),
+            qualified_name: id.to_string(),
+            kind: kind.to_string(),
+            language: "go".to_string(),
+            package: path
+                .rsplit_once('/')
+                .map(|(dir, _)| dir.to_string())
+                .unwrap_or_default(),
+            path: path.to_string(),
+            line_start: 1,
+            line_end: 10,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str, kind: &str, line: u32) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: kind.to_string(),
+            confidence: "static".to_string(),
+            file: Some("internal/handlers/user.go".to_string()),
+            line: Some(line),
+        }
+    }
+
+    fn snapshot() -> GraphSnapshot {
+        GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("GetUser", "function", "internal/handlers/user.go"),
+                node("format", "function", "internal/handlers/user.go"),
+                node("Store.Find", "method", "internal/database/store.go"),
+                node("Store.rawQuery", "method", "internal/database/store.go"),
+                node("auth.NewToken", "function", "internal/auth/token.go"),
+                node("billing.Charge", "function", "internal/billing/charge.go"),
+                node(
+                    "file::internal/handlers/user.go",
+                    "file",
+                    "internal/handlers/user.go",
+                ),
+            ],
+            edges: vec![
+                edge("GetUser", "format", "calls", 3),
+                edge("GetUser", "Store.Find", "calls", 4),
+                edge("GetUser", "Store.rawQuery", "calls", 5),
+                edge("GetUser", "auth.NewToken", "calls", 6),
+                edge("GetUser", "billing.Charge", "calls", 7),
+                edge(
+                    "file::internal/handlers/user.go",
+                    "billing.Charge",
+                    "imports",
+                    2,
+                ),
+            ],
+            unresolved_edges: 0,
+        }
+    }
+
+    fn load(text: &str) -> Result<ArchRules, ArchRulesError> {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("rules.toml");
+        std::fs::write(&path, text).unwrap();
+        ArchRules::compile(&ArchRulesFile::load(&path).unwrap())
+    }
+
+    fn rules(text: &str) -> ArchRules {
+        load(text).unwrap()
+    }
+
+    #[test]
+    fn reports_calls_outside_the_allowed_packages_and_interfaces() {
+        let rules = rules(
+            r#"
+            [[rule]]
+            name = "handlers"
+            from = "**/handlers"
+            may_call = ["**/auth", "**/database"]
+            via = "interface"
+            must_not_import = ["internal/billing"]
+            message = "go through the service layer"
+            "#,
+        );
+        let interface_methods = HashSet::from(["Find".to_string()]);
+        let report = check_snapshot(&snapshot(), &interface_methods, &rules);
+        assert_eq!(report.edges, 5);
+        let found: Vec<(u32, ArchConstraint, &str)> = report
+            .violations
+            .iter()
+            .map(|violation| (violation.line, violation.constraint, violation.to.as_str()))
+            .collect();
+        assert_eq!(
+            found,
+            [
+                (2, ArchConstraint::MustNotImport, "billing.Charge"),
+                (5, ArchConstraint::ViaInterface, "Store.rawQuery"),
+                (6, ArchConstraint::ViaInterface, "auth.NewToken"),
+                (7, ArchConstraint::MayCall, "billing.Charge"),
+            ]
+        );
+        assert_eq!(
+            report.violations[3].message,
+            "internal/handlers may only call **/auth, **/database, not internal/billing: \
+             go through the service layer"
+        );
+    }
+
+    #[test]
+    fn rules_for_other_packages_do_not_apply() {
+        let rules = rules(
+            r#"
+            [[rule]]
+            name = "auth"
+            from = "internal/auth"
+            must_not_call = ["**"]
+            "#,
+        );
+        let report = check_snapshot(&snapshot(), &HashSet::new(), &rules);
+        assert!(report.violations.is_empty());
+    }
+
+    #[test]
+    fn invalid_rules_are_rejected() {
+        let err = load("[[rule]]\nname = \"a\"\nfrom = \"x\"\nvia = \"magic\"\n").unwrap_err();
+        assert!(err.to_string().contains("unknown `via` value"));
+        let err =
+            load("[[rule]]\nname = \"a\"\nfrom = \"x\"\n[[rule]]\nname = \"a\"\nfrom = \"y\"\n")
+                .unwrap_err();
+        assert!(err.to_string().contains("duplicate rule name"));
+        let err =
+            load("[[rule]]\nname = \"a\"\nfrom = \"x\"\nmust_not_call = [\"[\"]\n").unwrap_err();
+        assert!(err.to_string().starts_with("rule `a`:"));
+    }
+}
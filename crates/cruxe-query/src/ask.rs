@@ -0,0 +1,639 @@
+//! Natural-language questions over the index, for `cruxe ask`.
+//!
+//! The question is cut into terms (stop words dropped, words reduced to a
+//! crude stem so `expiry`, `expires` and `IsExpired` meet) and every symbol
+//! of the ref is scored with BM25 over its name, qualified name, doc
+//! comment, signature and body, the fields weighted in that order, and a
+//! term in the symbol's own name earns a bonus on top: a question asks where
+//! something is done, and symbols named for it are the answer. When
+//! `cruxe embed` has stored vectors for the ref, the question is embedded
+//! too and the nearest snippets form a second ranking; the two are fused
+//! with reciprocal rank fusion like hybrid search.
+
+use crate::hybrid;
+use crate::search::RRF_K;
+use cruxe_core::config::SearchConfig;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_indexer::doc_extract::doc_comment;
+use cruxe_state::{symbols, vector_index};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+use std::fmt::Write as _;
+use std::path::Path;
+
+pub const DEFAULT_LIMIT: usize = 10;
+
+/// Lines of a symbol shown with each hit.
+const SNIPPET_LINES: usize = 8;
+/// Nearest snippets fetched per requested hit.
+const SEMANTIC_FANOUT: usize = 3;
+const BM25_K1: f64 = 1.2;
+const BM25_B: f64 = 0.75;
+
+const NAME_WEIGHT: f64 = 3.0;
+const QUALIFIER_WEIGHT: f64 = 1.0;
+const DOC_WEIGHT: f64 = 1.5;
+const SIGNATURE_WEIGHT: f64 = 1.0;
+const BODY_WEIGHT: f64 = 0.5;
+/// Extra score, in units of a term's IDF, when the term is in the name.
+const NAME_MATCH_BOOST: f64 = 2.0;
+
+const STOP_WORDS: &[&str] = &[
+    "a", "an", "and", "any", "are", "be", "by", "can", "code", "do", "does", "for", "from", "how",
+    "i", "in", "is", "it", "of", "on", "or", "our", "the", "this", "that", "to", "we", "what",
+    "when", "where", "which", "who", "why", "with",
+];
+
+/// Suffixes cut by [`stem`], longest first.
+const SUFFIXES: &[&str] = &[
+    "ations", "ation", "ings", "ions", "ing", "ion", "ies", "ied", "es", "ed", "s", "y", "e",
+];
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct AskHit {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub score: f64,
+    /// Question terms found in the symbol (stemmed).
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub matched_terms: Vec<String>,
+    /// Whether the symbol was among the nearest stored vectors.
+    pub semantic: bool,
+    pub snippet: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct AskAnswer {
+    pub question: String,
+    pub terms: Vec<String>,
+    pub semantic_used: bool,
+    /// Why the vector ranking was not used, when it was not.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub semantic_note: Option<String>,
+    pub hits: Vec<AskHit>,
+}
+
+/// Rank the symbols of `ref_name` against `question`.
+pub fn ask(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    question: &str,
+    search_config: &SearchConfig,
+    limit: usize,
+) -> Result<AskAnswer, StateError> {
+    let mut sources = SourceCache::new(workspace);
+    let mut ranking = rank_symbols(
+        conn,
+        &mut sources,
+        project_id,
+        ref_name,
+        question,
+        search_config,
+        limit.max(1) * SEMANTIC_FANOUT,
+    )?;
+    ranking.matches.truncate(limit);
+
+    let hits = ranking
+        .matches
+        .into_iter()
+        .map(|matched| {
+            let symbol = &ranking.symbols[matched.index];
+            AskHit {
+                name: symbol.name.clone(),
+                qualified_name: symbol.qualified_name.clone(),
+                kind: symbol.kind.as_str().to_string(),
+                path: symbol.path.clone(),
+                line_start: symbol.line_start,
+                line_end: symbol.line_end,
+                score: matched.score,
+                matched_terms: matched.matched_terms,
+                semantic: matched.semantic,
+                snippet: sources.snippet(symbol),
+            }
+        })
+        .collect();
+
+    Ok(AskAnswer {
+        question: question.to_string(),
+        terms: ranking.terms,
+        semantic_used: ranking.semantic_used,
+        semantic_note: ranking.semantic_note,
+        hits,
+    })
+}
+
+/// Every symbol of a ref with those matching a text, best first.
+pub(crate) struct SymbolRanking {
+    pub(crate) symbols: Vec<SymbolRecord>,
+    pub(crate) terms: Vec<String>,
+    pub(crate) matches: Vec<SymbolMatch>,
+    pub(crate) semantic_used: bool,
+    pub(crate) semantic_note: Option<String>,
+}
+
+pub(crate) struct SymbolMatch {
+    /// Into [`SymbolRanking::symbols`].
+    pub(crate) index: usize,
+    /// Reciprocal rank fusion of the keyword and vector rankings.
+    pub(crate) score: f64,
+    pub(crate) matched_terms: Vec<String>,
+    pub(crate) semantic: bool,
+}
+
+/// Rank the symbols of `ref_name` against `text` by keywords and, when
+/// vectors are stored, by the `semantic_limit` nearest snippets.
+pub(crate) fn rank_symbols(
+    conn: &Connection,
+    sources: &mut SourceCache<'_>,
+    project_id: &str,
+    ref_name: &str,
+    text: &str,
+    search_config: &SearchConfig,
+    semantic_limit: usize,
+) -> Result<SymbolRanking, StateError> {
+    let terms = question_terms(text);
+    let all_symbols = symbols::list_symbols_for_ref(conn, project_id, ref_name)?;
+
+    let lexical = if terms.is_empty() {
+        Vec::new()
+    } else {
+        let documents: Vec<SymbolDocument> = all_symbols
+            .iter()
+            .map(|symbol| SymbolDocument::new(symbol, sources.doc(symbol)))
+            .collect();
+        rank_documents(&documents, &terms)
+    };
+
+    let mut semantic_note = None;
+    let mut semantic_ranked: Vec<usize> = Vec::new();
+    if vector_index::count_vectors_for_scope(conn, project_id, ref_name)? == 0 {
+        semantic_note = Some(
+            "no stored vectors for this ref; run `cruxe embed` to add meaning-based matches"
+                .to_string(),
+        );
+    } else {
+        match hybrid::semantic_query(
+            conn,
+            search_config,
+            text,
+            ref_name,
+            project_id,
+            semantic_limit,
+        ) {
+            Ok(output) => {
+                let by_stable_id: HashMap<&str, usize> = all_symbols
+                    .iter()
+                    .enumerate()
+                    .map(|(index, symbol)| (symbol.symbol_stable_id.as_str(), index))
+                    .collect();
+                let mut seen = HashSet::new();
+                for result in output.results {
+                    if let Some(index) = result
+                        .symbol_stable_id
+                        .as_deref()
+                        .and_then(|id| by_stable_id.get(id))
+                        && seen.insert(*index)
+                    {
+                        semantic_ranked.push(*index);
+                    }
+                }
+                if output.external_provider_blocked {
+                    semantic_note = Some(
+                        "external embedding provider blocked by privacy settings; used the local model"
+                            .to_string(),
+                    );
+                }
+            }
+            Err(err) => {
+                semantic_note = Some(format!("semantic ranking unavailable: {err}"));
+            }
+        }
+    }
+
+    let mut fused: HashMap<usize, (f64, Vec<String>, bool)> = HashMap::new();
+    for (rank, (index, _, matched)) in lexical.into_iter().enumerate() {
+        let entry = fused.entry(index).or_default();
+        entry.0 += 1.0 / (RRF_K + rank as f64 + 1.0);
+        entry.1 = matched;
+    }
+    for (rank, index) in semantic_ranked.iter().enumerate() {
+        let entry = fused.entry(*index).or_default();
+        entry.0 += 1.0 / (RRF_K + rank as f64 + 1.0);
+        entry.2 = true;
+    }
+    let mut matches: Vec<SymbolMatch> = fused
+        .into_iter()
+        .map(|(index, (score, matched_terms, semantic))| SymbolMatch {
+            index,
+            score,
+            matched_terms,
+            semantic,
+        })
+        .collect();
+    matches.sort_by(|a, b| {
+        b.score
+            .total_cmp(&a.score)
+            .then_with(|| all_symbols[a.index].path.cmp(&all_symbols[b.index].path))
+            .then_with(|| {
+                all_symbols[a.index]
+                    .line_start
+                    .cmp(&all_symbols[b.index].line_start)
+            })
+    });
+
+    Ok(SymbolRanking {
+        symbols: all_symbols,
+        terms,
+        matches,
+        semantic_used: !semantic_ranked.is_empty(),
+        semantic_note,
+    })
+}
+
+/// Plain-text rendering of an answer.
+pub fn render_text(answer: &AskAnswer) -> String {
+    let mut out = String::new();
+    if answer.hits.is_empty() {
+        let _ = writeln!(out, "No symbols match \"{}\".", answer.question);
+    }
+    for (rank, hit) in answer.hits.iter().enumerate() {
+        let mut why = hit.matched_terms.join(", ");
+        if hit.semantic {
+            if !why.is_empty() {
+                why.push_str(", ");
+            }
+            why.push_str("semantic");
+        }
+        let _ = writeln!(
+            out,
+            "{}. {} ({}) {}:{}  [{}]",
+            rank + 1,
+            hit.qualified_name,
+            hit.kind,
+            hit.path,
+            hit.line_start,
+            why
+        );
+        for line in hit.snippet.lines() {
+            let _ = writeln!(out, "     {line}");
+        }
+    }
+    if let Some(note) = &answer.semantic_note {
+        let _ = writeln!(out, "note: {note}");
+    }
+    out
+}
+
+/// One symbol as BM25 sees it: weighted term frequencies and length.
+struct SymbolDocument {
+    frequencies: HashMap<String, f64>,
+    length: f64,
+    name_terms: HashSet<String>,
+}
+
+impl SymbolDocument {
+    fn new(symbol: &SymbolRecord, doc: Option<String>) -> Self {
+        let mut document = Self {
+            frequencies: HashMap::new(),
+            length: 0.0,
+            name_terms: words(&symbol.name).iter().map(|word| stem(word)).collect(),
+        };
+        document.add(&symbol.name, NAME_WEIGHT);
+        let qualifier = symbol
+            .qualified_name
+            .strip_suffix(symbol.name.as_str())
+            .unwrap_or_default();
+        document.add(qualifier, QUALIFIER_WEIGHT);
+        if let Some(doc) = &doc {
+            document.add(doc, DOC_WEIGHT);
+        }
+        if let Some(signature) = &symbol.signature {
+            document.add(signature, SIGNATURE_WEIGHT);
+        }
+        if let Some(content) = &symbol.content {
+            document.add(content, BODY_WEIGHT);
+        }
+        document
+    }
+
+    fn add(&mut self, text: &str, weight: f64) {
+        for word in words(text) {
+            *self.frequencies.entry(stem(&word)).or_default() += weight;
+            self.length += weight;
+        }
+    }
+}
+
+/// BM25-rank documents against the terms: `(index, score, matched terms)`
+/// for every document matching at least one term, best first.
+fn rank_documents(
+    documents: &[SymbolDocument],
+    terms: &[String],
+) -> Vec<(usize, f64, Vec<String>)> {
+    if documents.is_empty() {
+        return Vec::new();
+    }
+    let count = documents.len() as f64;
+    let average_length = (documents
+        .iter()
+        .map(|document| document.length)
+        .sum::<f64>()
+        / count)
+        .max(1.0);
+    let idf: Vec<f64> = terms
+        .iter()
+        .map(|term| {
+            let frequency = documents
+                .iter()
+                .filter(|document| document.frequencies.contains_key(term))
+                .count() as f64;
+            (1.0 + (count - frequency + 0.5) / (frequency + 0.5)).ln()
+        })
+        .collect();
+
+    let mut ranked: Vec<(usize, f64, Vec<String>)> = documents
+        .iter()
+        .enumerate()
+        .filter_map(|(index, document)| {
+            let norm = BM25_K1 * (1.0 - BM25_B + BM25_B * document.length / average_length);
+            let mut score = 0.0;
+            let mut matched = Vec::new();
+            for (term, idf) in terms.iter().zip(&idf) {
+                let Some(&tf) = document.frequencies.get(term) else {
+                    continue;
+                };
+                score += idf * tf * (BM25_K1 + 1.0) / (tf + norm);
+                if document.name_terms.contains(term) {
+                    score += idf * NAME_MATCH_BOOST;
+                }
+                matched.push(term.clone());
+            }
+            (!matched.is_empty()).then_some((index, score, matched))
+        })
+        .collect();
+    ranked.sort_by(|a, b| b.1.total_cmp(&a.1).then_with(|| a.0.cmp(&b.0)));
+    ranked
+}
+
+/// Stemmed, de-duplicated question terms without stop words.
+fn question_terms(question: &str) -> Vec<String> {
+    let mut seen = HashSet::new();
+    words(question)
+        .into_iter()
+        .filter(|word| !STOP_WORDS.contains(&word.as_str()))
+        .map(|word| stem(&word))
+        .filter(|term| seen.insert(term.clone()))
+        .collect()
+}
+
+/// Lowercase words of `text`, identifiers split at case humps, underscores
+/// and digits: `parseJWTToken` gives `parse`, `jwt`, `token`.
+fn words(text: &str) -> Vec<String> {
+    let mut out = Vec::new();
+    for chunk in text.split(|c: char| !c.is_alphanumeric()) {
+        let chars: Vec<char> = chunk.chars().collect();
+        let mut start = 0;
+        for i in 1..chars.len() {
+            let (prev, cur) = (chars[i - 1], chars[i]);
+            let next_lower = chars.get(i + 1).is_some_and(|c| c.is_lowercase());
+            let boundary = (prev.is_lowercase() && cur.is_uppercase())
+                || (prev.is_uppercase() && cur.is_uppercase() && next_lower)
+                || (prev.is_ascii_digit() != cur.is_ascii_digit());
+            if boundary {
+                out.push(chars[start..i].iter().collect::<String>().to_lowercase());
+                start = i;
+            }
+        }
+        if start < chars.len() {
+            out.push(chars[start..].iter().collect::<String>().to_lowercase());
+        }
+    }
+    out.retain(|word| !word.chars().all(|c| c.is_ascii_digit()));
+    out
+}
+
+/// Crude suffix stripping: one suffix, then a trailing `at`, each only when
+/// four letters remain (`validation`, `validates` and `valid` → `valid`).
+fn stem(word: &str) -> String {
+    let mut stem = word;
+    for suffix in SUFFIXES {
+        if let Some(rest) = stem.strip_suffix(suffix)
+            && rest.len() >= 4
+        {
+            stem = rest;
+            break;
+        }
+    }
+    if let Some(rest) = stem.strip_suffix("at")
+        && rest.len() >= 4
+    {
+        stem = rest;
+    }
+    stem.to_string()
+}
+
+/// Source files read once per run, for doc comments and snippets.
+pub(crate) struct SourceCache<'a> {
+    workspace: &'a Path,
+    files: HashMap<String, Option<Vec<String>>>,
+}
+
+impl<'a> SourceCache<'a> {
+    pub(crate) fn new(workspace: &'a Path) -> Self {
+        Self {
+            workspace,
+            files: HashMap::new(),
+        }
+    }
+
+    pub(crate) fn lines(&mut self, path: &str) -> Option<&[String]> {
+        self.files
+            .entry(path.to_string())
+            .or_insert_with(|| {
+                std::fs::read_to_string(self.workspace.join(path))
+                    .ok()
+                    .map(|source| source.lines().map(str::to_string).collect())
+            })
+            .as_deref()
+    }
+
+    pub(crate) fn doc(&mut self, symbol: &SymbolRecord) -> Option<String> {
+        let lines = self.lines(&symbol.path)?;
+        doc_comment(lines, symbol.line_start, &symbol.language)
+    }
+
+    fn snippet(&mut self, symbol: &SymbolRecord) -> String {
+        let from_source = self.lines(&symbol.path).map(|lines| {
+            let start = (symbol.line_start.max(1) as usize - 1).min(lines.len());
+            let end = (symbol.line_end as usize)
+                .min(start + SNIPPET_LINES)
+                .clamp(start, lines.len());
+            lines[start..end].join("\n")
+        });
+        match from_source {
+            Some(snippet) if !snippet.is_empty() => snippet,
+            _ => symbol
+                .content
+                .as_deref()
+                .unwrap_or_default()
+                .lines()
+                .take(SNIPPET_LINES)
+                .collect::<Vec<_>>()
+                .join("\n"),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::{db, schema};
+
+    const HANDLER: &str = "package auth
+
+// AuthError represents an authentication failure with a machine-readable code.
+type AuthError struct {
+	Message string
+	Code    string
+}
+
+// Claims holds the decoded JWT claims extracted from a validated token.
+type Claims struct {
+	// Exp is the expiration time as a Unix timestamp.
+	Exp int64
+}
+
+// IsExpired reports whether the token has expired.
+func (c *Claims) IsExpired() bool {
+	return time.Now().Unix() > c.Exp
+}
+
+// ValidateToken is a package-level function that validates a bearer token.
+func ValidateToken(authHeader string, secret []byte) (*Claims, error) {
+	claims := &Claims{Exp: time.Now().Add(tokenTTL).Unix()}
+	if claims.IsExpired() {
+		return nil, &AuthError{Message: \"token has expired\", Code: \"EXPIRED\"}
+	}
+	return claims, nil
+}
+
+// RequireRole checks that the claims contain at least the given role level.
+func RequireRole(claims *Claims, minimum string) error {
+	return nil
+}
+";
+
+    fn record(
+        name: &str,
+        qualified_name: &str,
+        kind: SymbolKind,
+        lines: (u32, u32),
+    ) -> SymbolRecord {
+        let content = HANDLER
+            .lines()
+            .skip(lines.0 as usize - 1)
+            .take((lines.1 - lines.0 + 1) as usize)
+            .collect::<Vec<_>>()
+            .join("\n");
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "auth/handler.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified_name}"),
+            symbol_stable_id: format!("stable::{qualified_name}"),
+            name: name.to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind,
+            signature: content.lines().next().map(str::to_string),
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content),
+        }
+    }
+
+    #[test]
+    fn terms_meet_across_word_forms() {
+        assert_eq!(
+            question_terms("where do we validate JWT expiry?"),
+            vec!["valid", "jwt", "expir"]
+        );
+        assert_eq!(
+            words("parseJWTToken is_expired"),
+            vec!["parse", "jwt", "token", "is", "expired"]
+        );
+        for word in ["validation", "validates", "validated", "valid"] {
+            assert_eq!(stem(word), "valid", "{word}");
+        }
+        for word in ["expired", "expires", "expiration"] {
+            assert_eq!(stem(word), "expir", "{word}");
+        }
+    }
+
+    #[test]
+    fn jwt_expiry_question_surfaces_the_check_and_the_validator() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(dir.path().join("auth")).unwrap();
+        std::fs::write(dir.path().join("auth/handler.go"), HANDLER).unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            record("AuthError", "AuthError", SymbolKind::Struct, (4, 7)),
+            record("Claims", "Claims", SymbolKind::Struct, (10, 13)),
+            record(
+                "IsExpired",
+                "Claims.IsExpired",
+                SymbolKind::Method,
+                (16, 18),
+            ),
+            record(
+                "ValidateToken",
+                "ValidateToken",
+                SymbolKind::Function,
+                (21, 27),
+            ),
+            record("RequireRole", "RequireRole", SymbolKind::Function, (30, 32)),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+
+        let answer = ask(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "where do we validate JWT expiry?",
+            &SearchConfig::default(),
+            DEFAULT_LIMIT,
+        )
+        .unwrap();
+        let names: Vec<&str> = answer
+            .hits
+            .iter()
+            .map(|hit| hit.qualified_name.as_str())
+            .collect();
+        assert_eq!(names[0], "ValidateToken", "{names:?}");
+        assert!(names.contains(&"Claims.IsExpired"), "{names:?}");
+        assert!(!names.contains(&"RequireRole"), "{names:?}");
+        assert!(!answer.semantic_used);
+        assert!(answer.semantic_note.is_some());
+
+        let top = &answer.hits[0];
+        assert_eq!(top.matched_terms, vec!["valid", "expir"]);
+        assert!(top.snippet.starts_with("func ValidateToken("));
+        assert!(render_text(&answer).contains("1. ValidateToken (function) auth/handler.go:21"));
+    }
+}
@@ -2,6 +2,7 @@ use cruxe_core::error::StateError;
 use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
 use cruxe_state::{edges, symbols};
 use rusqlite::{Connection, ToSql, params, params_from_iter};
+use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::collections::{HashMap, HashSet, VecDeque};
 
@@ -33,7 +34,7 @@ pub enum CallGraphError {
     State(#[from] StateError),
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
 pub struct CallGraphSymbol {
     pub symbol_id: String,
     pub symbol_stable_id: String,
@@ -45,13 +46,13 @@ pub struct CallGraphSymbol {
     pub kind: String,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
 pub struct CallSite {
     pub file: String,
     pub line: u32,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
 pub struct CallGraphEdgeResult {
     pub symbol: CallGraphSymbol,
     pub call_site: CallSite,
@@ -59,7 +60,7 @@ pub struct CallGraphEdgeResult {
     pub depth: u32,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct CallGraphResult {
     pub symbol: CallGraphSymbol,
     pub callers: Vec<CallGraphEdgeResult>,
@@ -69,6 +70,32 @@ pub struct CallGraphResult {
     pub depth_applied: u32,
 }
 
+/// A caller or callee with the calls made from (or to) it, for tree views.
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct CallTreeNode {
+    pub symbol: CallGraphSymbol,
+    pub call_site: CallSite,
+    pub confidence: String,
+    /// Already expanded elsewhere in the tree, or a recursive call; its
+    /// children are not repeated.
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub repeated: bool,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub children: Vec<CallTreeNode>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct CallTree {
+    pub symbol: CallGraphSymbol,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub callers: Vec<CallTreeNode>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub callees: Vec<CallTreeNode>,
+    pub total_nodes: usize,
+    pub truncated: bool,
+    pub depth_applied: u32,
+}
+
 #[derive(Debug, Clone)]
 pub struct CallGraphRequest<'a> {
     pub symbol_name: &'a str,
@@ -131,6 +158,160 @@ pub fn get_call_graph(
     })
 }
 
+/// Like [`get_call_graph`], but keeps the path each caller or callee was
+/// reached through. Each symbol is expanded once; later occurrences are
+/// marked `repeated`. `limit` caps the total number of nodes.
+pub fn get_call_tree(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    request: &CallGraphRequest<'_>,
+) -> Result<CallTree, CallGraphError> {
+    let root = resolve_root_symbol(conn, repo, ref_name, request.symbol_name, request.path)?
+        .ok_or(CallGraphError::SymbolNotFound)?;
+    let mut walk = TreeWalk {
+        conn,
+        repo,
+        ref_name,
+        depth_limit: clamp_depth(request.depth),
+        budget: request.limit.max(1),
+        truncated: false,
+        mode: TraversalMode::Callers,
+        expanded: HashSet::new(),
+    };
+
+    let mut callers = Vec::new();
+    if matches!(
+        request.direction,
+        CallGraphDirection::Callers | CallGraphDirection::Both
+    ) {
+        walk.expanded = HashSet::from([root.symbol_stable_id.clone()]);
+        callers = walk.expand(&root.symbol_stable_id, 0)?;
+    }
+    let mut callees = Vec::new();
+    if matches!(
+        request.direction,
+        CallGraphDirection::Callees | CallGraphDirection::Both
+    ) {
+        walk.mode = TraversalMode::Callees;
+        walk.expanded = HashSet::from([root.symbol_stable_id.clone()]);
+        callees = walk.expand(&root.symbol_stable_id, 0)?;
+    }
+
+    let total_nodes = request.limit.max(1) - walk.budget;
+    Ok(CallTree {
+        symbol: to_call_graph_symbol(&root),
+        callers,
+        callees,
+        total_nodes,
+        truncated: walk.truncated,
+        depth_applied: walk.depth_limit,
+    })
+}
+
+struct TreeWalk<'a> {
+    conn: &'a Connection,
+    repo: &'a str,
+    ref_name: &'a str,
+    depth_limit: u32,
+    budget: usize,
+    truncated: bool,
+    mode: TraversalMode,
+    expanded: HashSet<String>,
+}
+
+impl TreeWalk<'_> {
+    fn expand(
+        &mut self,
+        symbol_stable_id: &str,
+        depth: u32,
+    ) -> Result<Vec<CallTreeNode>, StateError> {
+        if depth >= self.depth_limit {
+            return Ok(Vec::new());
+        }
+        let edges_for_symbol = match self.mode {
+            TraversalMode::Callers => {
+                edges::get_callers(self.conn, self.repo, self.ref_name, symbol_stable_id)?
+            }
+            TraversalMode::Callees => {
+                edges::get_callees(self.conn, self.repo, self.ref_name, symbol_stable_id)?
+            }
+        };
+        let resolved_targets = resolve_target_symbols_batch(
+            self.conn,
+            self.repo,
+            self.ref_name,
+            &edges_for_symbol,
+            self.mode,
+        )?;
+
+        let mut seen = HashSet::new();
+        let mut nodes = Vec::new();
+        for edge in edges_for_symbol {
+            let Some((target_id, target_symbol)) =
+                target_id_for_edge(&edge, self.mode).and_then(|id| resolved_targets.get(id))
+            else {
+                continue;
+            };
+            if !seen.insert((
+                target_id.clone(),
+                edge.source_file.clone(),
+                edge.source_line,
+            )) {
+                continue;
+            }
+            if self.budget == 0 {
+                self.truncated = true;
+                break;
+            }
+            self.budget -= 1;
+
+            // Leaves at the depth limit are never expanded, so they neither
+            // claim the symbol nor count as repeats.
+            let expandable = depth + 1 < self.depth_limit;
+            let repeated = expandable && self.expanded.contains(target_id);
+            let children = if expandable && !repeated {
+                self.expanded.insert(target_id.clone());
+                self.expand(target_id, depth + 1)?
+            } else {
+                Vec::new()
+            };
+            nodes.push(CallTreeNode {
+                symbol: target_symbol.clone(),
+                call_site: CallSite {
+                    file: edge.source_file,
+                    line: edge.source_line,
+                },
+                confidence: edge.confidence,
+                repeated,
+                children,
+            });
+        }
+        Ok(nodes)
+    }
+}
+
+/// Every transitive caller of one symbol, breadth first (used by impact
+/// analysis, which starts from stable ids rather than names).
+pub(crate) fn transitive_callers(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    symbol_stable_id: &str,
+    depth: u32,
+    limit: usize,
+) -> Result<(Vec<CallGraphEdgeResult>, bool), StateError> {
+    traverse_direction(
+        conn,
+        repo,
+        ref_name,
+        symbol_stable_id,
+        clamp_depth(depth),
+        limit,
+        TraversalMode::Callers,
+    )
+}
+
 #[derive(Debug, Clone, Copy, PartialEq, Eq)]
 enum TraversalMode {
     Callers,
@@ -320,7 +501,8 @@ fn query_symbols_by_field(
 
     Ok(records)
 }
-fn resolve_root_symbol(
+
+pub(crate) fn resolve_root_symbol(
     conn: &Connection,
     repo: &str,
     ref_name: &str,
@@ -399,7 +581,7 @@ fn row_to_symbol_record(row: &rusqlite::Row<'_>) -> rusqlite::Result<SymbolRecor
     })
 }
 
-fn to_call_graph_symbol(symbol: &SymbolRecord) -> CallGraphSymbol {
+pub(crate) fn to_call_graph_symbol(symbol: &SymbolRecord) -> CallGraphSymbol {
     CallGraphSymbol {
         symbol_id: symbol.symbol_id.clone(),
         symbol_stable_id: symbol.symbol_stable_id.clone(),
@@ -517,6 +699,85 @@ mod tests {
         assert_eq!(depth2.callees[1].depth, 2);
     }
 
+    #[test]
+    fn get_call_tree_nests_callers_and_marks_repeats() {
+        let conn = setup();
+        for record in [
+            symbol("stable-a", "a", "src/a.rs", 1),
+            symbol("stable-b", "b", "src/b.rs", 10),
+            symbol("stable-c", "c", "src/c.rs", 20),
+            symbol("stable-d", "d", "src/d.rs", 30),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        // b and c both call d; a calls b and c.
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("stable-a", Some("stable-b"), "src/a.rs", 2),
+                call("stable-a", Some("stable-c"), "src/a.rs", 3),
+                call("stable-b", Some("stable-d"), "src/b.rs", 11),
+                call("stable-c", Some("stable-d"), "src/c.rs", 21),
+            ],
+        )
+        .unwrap();
+
+        let request = |direction| CallGraphRequest {
+            symbol_name: "d",
+            path: None,
+            direction,
+            depth: 3,
+            limit: 20,
+        };
+        let tree =
+            get_call_tree(&conn, "repo", "main", &request(CallGraphDirection::Callers)).unwrap();
+        assert!(tree.callees.is_empty());
+        let names: Vec<_> = tree
+            .callers
+            .iter()
+            .map(|n| n.symbol.name.as_str())
+            .collect();
+        assert_eq!(names, vec!["b", "c"]);
+        assert_eq!(tree.callers[0].children[0].symbol.name, "a");
+        assert_eq!(tree.callers[0].children[0].call_site.line, 2);
+        // `a` was already expanded under `b`.
+        assert_eq!(tree.callers[1].children[0].symbol.name, "a");
+        assert!(tree.callers[1].children[0].repeated);
+        assert_eq!(tree.total_nodes, 4);
+
+        let limited = get_call_tree(
+            &conn,
+            "repo",
+            "main",
+            &CallGraphRequest {
+                limit: 2,
+                ..request(CallGraphDirection::Callers)
+            },
+        )
+        .unwrap();
+        assert!(limited.truncated);
+        assert_eq!(limited.total_nodes, 2);
+
+        let callees = get_call_tree(
+            &conn,
+            "repo",
+            "main",
+            &CallGraphRequest {
+                symbol_name: "a",
+                ..request(CallGraphDirection::Callees)
+            },
+        )
+        .unwrap();
+        assert_eq!(callees.callees.len(), 2);
+        assert_eq!(callees.callees[0].children[0].symbol.name, "d");
+        assert!(!callees.callees[0].children[0].repeated);
+        let repeated_d = &callees.callees[1].children[0];
+        assert_eq!(repeated_d.symbol.name, "d");
+        assert!(repeated_d.repeated);
+    }
+
     #[test]
     fn depth_cap_and_cycle_detection_prevent_infinite_traversal() {
         let conn = setup();
@@ -0,0 +1,444 @@
+//! `cruxe changed <base>..<head>`: the hunks of a commit range mapped onto
+//! the indexed symbols they touch and grouped by package, with each symbol
+//! flagged when it is exported or its signature changed. PR bots and
+//! selective test runners start from this list.
+//!
+//! Symbols come from the index of the head side, so line numbers match the
+//! new side of the diff. Code deleted together with its file has no symbols
+//! left to report; the file is listed as deleted.
+
+use crate::call_graph::{self, CallGraphSymbol};
+use crate::deadcode;
+use crate::diff_context::DiffLineRange;
+use crate::impact::{self, ChangedFile, ImpactError};
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::Path;
+
+/// One `@@ -a,b +c,d @@` hunk of a `git diff -U0`.
+#[derive(Debug, Clone, Copy, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct DiffHunk {
+    pub old_start: u32,
+    pub old_lines: u32,
+    pub new_start: u32,
+    pub new_lines: u32,
+}
+
+impl DiffHunk {
+    /// New-side lines; a pure deletion is the line it sits after.
+    fn new_range(&self) -> DiffLineRange {
+        let start = self.new_start.max(1);
+        DiffLineRange {
+            start,
+            end: start + self.new_lines.saturating_sub(1),
+        }
+    }
+
+    fn covers(&self, line_start: u32, line_end: u32) -> bool {
+        self.new_lines > 0
+            && self.new_start <= line_start
+            && line_end < self.new_start + self.new_lines
+    }
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct FileDiff {
+    pub path: String,
+    /// `added`, `deleted`, `modified` or `renamed`.
+    pub status: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_path: Option<String>,
+    pub hunks: Vec<DiffHunk>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ChangedSymbol {
+    pub symbol: CallGraphSymbol,
+    /// `added` when every line of the symbol is new, else `modified`.
+    pub change: String,
+    pub exported: bool,
+    /// A hunk touches the declaration lines of a symbol that already existed.
+    pub signature_changed: bool,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ChangedPackage {
+    /// The directory holding the files (see `cruxe impact`).
+    pub package: String,
+    pub files: Vec<FileDiff>,
+    pub symbols: Vec<ChangedSymbol>,
+    /// Exported symbols that were added or had their signature changed.
+    pub api_changes: usize,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ChangedReport {
+    pub range: String,
+    /// The indexed ref the symbols were read from.
+    #[serde(rename = "ref")]
+    pub r#ref: String,
+    pub packages: Vec<ChangedPackage>,
+    pub files_changed: usize,
+    pub symbols_changed: usize,
+    pub api_changes: usize,
+}
+
+/// The files and hunks `git diff <range>` reports in `workspace`, renames
+/// detected.
+pub fn diff_range(workspace: &Path, range: &str) -> Result<Vec<FileDiff>, ImpactError> {
+    let diff = impact::git_diff(workspace, range, &["-U0", "-M"])?;
+    Ok(parse_diff_hunks(&diff))
+}
+
+/// Files with their status and both sides of every hunk from `git diff -U0`
+/// output. Binary files and pure renames are listed without hunks.
+pub fn parse_diff_hunks(diff: &str) -> Vec<FileDiff> {
+    let mut files: Vec<FileDiff> = Vec::new();
+    for line in diff.lines() {
+        if let Some(header) = line.strip_prefix("diff --git ") {
+            // `a/<path> b/<path>`; the `---`/`+++` lines below refine it.
+            let path = header
+                .rsplit_once(" b/")
+                .map_or(header, |(_, path)| path)
+                .to_string();
+            files.push(FileDiff {
+                path,
+                status: "modified".to_string(),
+                old_path: None,
+                hunks: Vec::new(),
+            });
+            continue;
+        }
+        let Some(file) = files.last_mut() else {
+            continue;
+        };
+        if line.starts_with("new file mode") {
+            file.status = "added".to_string();
+        } else if line.starts_with("deleted file mode") {
+            file.status = "deleted".to_string();
+        } else if let Some(path) = line.strip_prefix("rename from ") {
+            file.status = "renamed".to_string();
+            file.old_path = Some(path.to_string());
+        } else if let Some(path) = line.strip_prefix("rename to ") {
+            file.path = path.to_string();
+        } else if let Some(path) = line.strip_prefix("--- ") {
+            if file.status == "deleted"
+                && let Some(path) = diff_path(path, "a/")
+            {
+                file.path = path;
+            }
+        } else if let Some(path) = line.strip_prefix("+++ ") {
+            if let Some(path) = diff_path(path, "b/") {
+                file.path = path;
+            }
+        } else if line.starts_with("@@ ")
+            && let Some(hunk) = parse_hunk(line)
+        {
+            file.hunks.push(hunk);
+        }
+    }
+    files
+}
+
+fn diff_path(path: &str, prefix: &str) -> Option<String> {
+    let path = path.split('\t').next().unwrap_or(path).trim();
+    if path == "/dev/null" {
+        return None;
+    }
+    Some(path.strip_prefix(prefix).unwrap_or(path).to_string())
+}
+
+/// `@@ -a[,b] +c[,d] @@`.
+fn parse_hunk(line: &str) -> Option<DiffHunk> {
+    let mut parts = line.split_whitespace().skip(1);
+    let (old_start, old_lines) = parse_side(parts.next()?.strip_prefix('-')?)?;
+    let (new_start, new_lines) = parse_side(parts.next()?.strip_prefix('+')?)?;
+    Some(DiffHunk {
+        old_start,
+        old_lines,
+        new_start,
+        new_lines,
+    })
+}
+
+fn parse_side(side: &str) -> Option<(u32, u32)> {
+    let mut parts = side.splitn(2, ',');
+    let start = parts.next()?.parse().ok()?;
+    let lines = match parts.next() {
+        Some(lines) => lines.parse().ok()?,
+        None => 1,
+    };
+    Some((start, lines))
+}
+
+/// Map `files` onto the innermost symbols of `ref_name` their hunks touch,
+/// grouped by package.
+pub fn changed_symbols(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    range: &str,
+    files: Vec<FileDiff>,
+) -> Result<ChangedReport, ImpactError> {
+    let mut packages: BTreeMap<String, ChangedPackage> = BTreeMap::new();
+    for file in files {
+        let package = packages
+            .entry(impact::package_of(&file.path))
+            .or_insert_with_key(|package| ChangedPackage {
+                package: package.clone(),
+                files: Vec::new(),
+                symbols: Vec::new(),
+                api_changes: 0,
+            });
+        if file.status != "deleted" && !file.hunks.is_empty() {
+            let records = symbols::list_symbols_in_file(conn, repo, ref_name, &file.path)?;
+            let lines = ChangedFile {
+                path: file.path.clone(),
+                ranges: file.hunks.iter().map(DiffHunk::new_range).collect(),
+                whole_file: file.status == "added",
+            };
+            for record in impact::changed_symbols_in_file(&records, &lines) {
+                package.symbols.push(classify(record, &file));
+            }
+        }
+        package.files.push(file);
+    }
+
+    let mut report = ChangedReport {
+        range: range.to_string(),
+        r#ref: ref_name.to_string(),
+        packages: Vec::new(),
+        files_changed: 0,
+        symbols_changed: 0,
+        api_changes: 0,
+    };
+    for mut package in packages.into_values() {
+        package.symbols.sort_by(|left, right| {
+            left.symbol
+                .path
+                .cmp(&right.symbol.path)
+                .then_with(|| left.symbol.line_start.cmp(&right.symbol.line_start))
+        });
+        package.api_changes = package
+            .symbols
+            .iter()
+            .filter(|symbol| {
+                symbol.exported && (symbol.change == "added" || symbol.signature_changed)
+            })
+            .count();
+        report.files_changed += package.files.len();
+        report.symbols_changed += package.symbols.len();
+        report.api_changes += package.api_changes;
+        report.packages.push(package);
+    }
+    Ok(report)
+}
+
+fn classify(record: &SymbolRecord, file: &FileDiff) -> ChangedSymbol {
+    let added = file.status == "added"
+        || file
+            .hunks
+            .iter()
+            .any(|hunk| hunk.old_lines == 0 && hunk.covers(record.line_start, record.line_end));
+    // The declaration runs from the first line for as many lines as the
+    // indexed signature spans.
+    let declaration_lines = record
+        .signature
+        .as_deref()
+        .map_or(1, |signature| signature.lines().count().max(1) as u32);
+    let declaration_end = (record.line_start + declaration_lines - 1).min(record.line_end);
+    let signature_changed = !added
+        && file.hunks.iter().any(|hunk| {
+            let range = hunk.new_range();
+            range.start <= declaration_end && record.line_start <= range.end
+        });
+    ChangedSymbol {
+        symbol: call_graph::to_call_graph_symbol(record),
+        change: if added { "added" } else { "modified" }.to_string(),
+        exported: deadcode::is_exported(record),
+        signature_changed,
+        signature: record.signature.clone(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, path: &str, signature: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "feature".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: name.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: Some(signature.to_string()),
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn parse_diff_hunks_reads_status_and_both_sides() {
+        let diff = "\
+diff --git a/pkg/auth/token.go b/pkg/auth/token.go
+index 1111111..2222222 100644
+--- a/pkg/auth/token.go
++++ b/pkg/auth/token.go
+@@ -10,2 +10,3 @@ func Validate() {
+@@ -40 +41,0 @@
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,5 +0,0 @@
+diff --git a/util.go b/pkg/util/util.go
+similarity index 100%
+rename from util.go
+rename to pkg/util/util.go
+diff --git a/pkg/api/new.go b/pkg/api/new.go
+new file mode 100644
+--- /dev/null
++++ b/pkg/api/new.go
+@@ -0,0 +1,4 @@
+";
+        let files = parse_diff_hunks(diff);
+        let summary: Vec<(&str, &str)> = files
+            .iter()
+            .map(|file| (file.path.as_str(), file.status.as_str()))
+            .collect();
+        assert_eq!(
+            summary,
+            vec![
+                ("pkg/auth/token.go", "modified"),
+                ("old.go", "deleted"),
+                ("pkg/util/util.go", "renamed"),
+                ("pkg/api/new.go", "added"),
+            ]
+        );
+        assert_eq!(
+            files[0].hunks,
+            vec![
+                DiffHunk {
+                    old_start: 10,
+                    old_lines: 2,
+                    new_start: 10,
+                    new_lines: 3,
+                },
+                DiffHunk {
+                    old_start: 40,
+                    old_lines: 1,
+                    new_start: 41,
+                    new_lines: 0,
+                },
+            ]
+        );
+        assert_eq!(files[2].old_path.as_deref(), Some("util.go"));
+        assert!(files[2].hunks.is_empty());
+    }
+
+    #[test]
+    fn changed_symbols_flags_added_exported_and_signature_changes() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            symbol(
+                "Validate",
+                "pkg/auth/token.go",
+                "func Validate(t string) error",
+                (3, 9),
+            ),
+            symbol("refresh", "pkg/auth/token.go", "func refresh()", (11, 15)),
+            symbol(
+                "Issue",
+                "pkg/auth/token.go",
+                "func Issue() string",
+                (17, 20),
+            ),
+            symbol(
+                "Untouched",
+                "pkg/auth/token.go",
+                "func Untouched()",
+                (22, 24),
+            ),
+            symbol("Serve", "cmd/server/main.go", "func Serve()", (5, 8)),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let diff = "\
+diff --git a/pkg/auth/token.go b/pkg/auth/token.go
+--- a/pkg/auth/token.go
++++ b/pkg/auth/token.go
+@@ -3 +3 @@
+@@ -12 +12,2 @@
+@@ -16,0 +17,4 @@
+diff --git a/cmd/server/main.go b/cmd/server/main.go
+--- a/cmd/server/main.go
++++ b/cmd/server/main.go
+@@ -7 +7 @@
+";
+        let report = changed_symbols(
+            &conn,
+            "repo",
+            "feature",
+            "main..feature",
+            parse_diff_hunks(diff),
+        )
+        .unwrap();
+
+        assert_eq!(report.files_changed, 2);
+        assert_eq!(report.symbols_changed, 4);
+        let packages: Vec<&str> = report
+            .packages
+            .iter()
+            .map(|package| package.package.as_str())
+            .collect();
+        assert_eq!(packages, vec!["cmd/server", "pkg/auth"]);
+
+        let auth = &report.packages[1];
+        let flags: Vec<(&str, &str, bool, bool)> = auth
+            .symbols
+            .iter()
+            .map(|changed| {
+                (
+                    changed.symbol.name.as_str(),
+                    changed.change.as_str(),
+                    changed.exported,
+                    changed.signature_changed,
+                )
+            })
+            .collect();
+        assert_eq!(
+            flags,
+            vec![
+                ("Validate", "modified", true, true),
+                ("refresh", "modified", false, false),
+                ("Issue", "added", true, false),
+            ]
+        );
+        assert_eq!(auth.api_changes, 2);
+
+        let server = &report.packages[0];
+        assert_eq!(server.symbols.len(), 1);
+        assert!(!server.symbols[0].signature_changed);
+        assert_eq!(report.api_changes, 2);
+    }
+}
@@ -0,0 +1,228 @@
+//! CODEOWNERS lookup for routing findings to the teams that own the code,
+//! and for the `owner:` term of `cruxe query symbols`.
+//!
+//! Follows GitHub's rules: the file is read from `.github/`, the root or
+//! `docs/`; patterns use gitignore syntax; the last matching line wins, and a
+//! matching line without owners leaves the path unowned. Individual owners
+//! can be folded into teams with [`CodeOwners::with_teams`].
+
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use std::collections::{BTreeMap, HashSet};
+use std::path::{Path, PathBuf};
+
+/// Owner key for paths no CODEOWNERS line assigns.
+pub const UNOWNED: &str = "(unowned)";
+
+const CODEOWNERS_LOCATIONS: &[&str] = &[".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"];
+
+#[derive(Debug, Clone)]
+struct OwnerRule {
+    matcher: GlobSet,
+    owners: Vec<String>,
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct CodeOwners {
+    rules: Vec<OwnerRule>,
+}
+
+impl CodeOwners {
+    /// Parse CODEOWNERS text. Lines with invalid patterns are skipped.
+    pub fn parse(text: &str) -> Self {
+        let rules = text
+            .lines()
+            .filter_map(|line| {
+                let line = line.split_once('#').map_or(line, |(code, _)| code).trim();
+                let mut fields = line.split_whitespace();
+                let pattern = fields.next()?;
+                Some(OwnerRule {
+                    matcher: pattern_matcher(pattern)?,
+                    owners: fields.map(str::to_string).collect(),
+                })
+            })
+            .collect();
+        Self { rules }
+    }
+
+    /// Load the first CODEOWNERS file found in the standard locations.
+    pub fn discover(workspace: &Path) -> Option<(PathBuf, Self)> {
+        CODEOWNERS_LOCATIONS.iter().find_map(|location| {
+            let path = workspace.join(location);
+            let text = std::fs::read_to_string(&path).ok()?;
+            Some((path, Self::parse(&text)))
+        })
+    }
+
+    /// Load `path` (workspace-relative) when given, otherwise the first file
+    /// in the standard locations. `Ok(None)` when there is none to discover;
+    /// an explicit path that cannot be read is an error.
+    pub fn load(workspace: &Path, path: Option<&str>) -> std::io::Result<Option<Self>> {
+        match path {
+            Some(path) => {
+                std::fs::read_to_string(workspace.join(path)).map(|text| Some(Self::parse(&text)))
+            }
+            None => Ok(Self::discover(workspace).map(|(_, owners)| owners)),
+        }
+    }
+
+    /// Replace owners that are members of a team (team -> members, as in
+    /// `[routing.teams]`) with the team. An owner in several teams becomes
+    /// each of them; owners in none are kept as written.
+    pub fn with_teams(mut self, teams: &BTreeMap<String, Vec<String>>) -> Self {
+        if teams.is_empty() {
+            return self;
+        }
+        for rule in &mut self.rules {
+            let mut mapped: Vec<String> = Vec::new();
+            for owner in &rule.owners {
+                let owner_teams: Vec<&String> = teams
+                    .iter()
+                    .filter(|(_, members)| {
+                        members
+                            .iter()
+                            .any(|member| member.eq_ignore_ascii_case(owner))
+                    })
+                    .map(|(team, _)| team)
+                    .collect();
+                if owner_teams.is_empty() {
+                    mapped.push(owner.clone());
+                }
+                mapped.extend(owner_teams.into_iter().cloned());
+            }
+            let mut seen = HashSet::new();
+            mapped.retain(|owner| seen.insert(owner.clone()));
+            rule.owners = mapped;
+        }
+        self
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+
+    /// Owners of a workspace-relative path; empty when unowned.
+    pub fn owners_of(&self, path: &str) -> &[String] {
+        let path = path.trim_start_matches("./").trim_start_matches('/');
+        self.rules
+            .iter()
+            .rev()
+            .find(|rule| rule.matcher.is_match(path))
+            .map(|rule| rule.owners.as_slice())
+            .unwrap_or_default()
+    }
+}
+
+/// Compile one gitignore-style pattern. A pattern matches the path itself
+/// and everything below it; patterns without an inner slash match at any
+/// depth.
+fn pattern_matcher(pattern: &str) -> Option<GlobSet> {
+    let dir_only = pattern.ends_with('/');
+    let trimmed = pattern.trim_end_matches('/');
+    let anchored = trimmed.starts_with('/') || trimmed.contains('/');
+    let trimmed = trimmed.trim_start_matches('/');
+    if trimmed.is_empty() {
+        // A bare `/` covers the whole repository.
+        return glob_set(&["**"]);
+    }
+    let base = if anchored {
+        trimmed.to_string()
+    } else {
+        format!("**/{trimmed}")
+    };
+    let below = format!("{base}/**");
+    if dir_only {
+        glob_set(&[&below])
+    } else {
+        glob_set(&[&base, &below])
+    }
+}
+
+fn glob_set(patterns: &[&str]) -> Option<GlobSet> {
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        builder.add(
+            GlobBuilder::new(pattern)
+                .literal_separator(true)
+                .build()
+                .ok()?,
+        );
+    }
+    builder.build().ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const SAMPLE: &str = "\
+# Default owners
+*                       @acme/core
+*.go                    @acme/go-reviewers
+/services/payments/     @acme/payments  # the payments team
+docs/                   @acme/docs
+services/**/generated   @acme/codegen
+/services/payments/vendor/
+";
+
+    #[test]
+    fn last_matching_line_wins() {
+        let owners = CodeOwners::parse(SAMPLE);
+        assert_eq!(owners.owners_of("README.md"), ["@acme/core"]);
+        assert_eq!(owners.owners_of("cmd/main.go"), ["@acme/go-reviewers"]);
+        assert_eq!(
+            owners.owners_of("services/payments/charge.go"),
+            ["@acme/payments"]
+        );
+        assert_eq!(owners.owners_of("docs/guide.md"), ["@acme/docs"]);
+        assert_eq!(
+            owners.owners_of("services/auth/v1/generated/api.go"),
+            ["@acme/codegen"]
+        );
+        assert!(
+            owners
+                .owners_of("services/payments/vendor/lib/x.go")
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn unanchored_directory_patterns_match_at_any_depth() {
+        let owners = CodeOwners::parse("docs/ @docs\nlogs @ops\n/build/ @build");
+        // A trailing slash alone does not anchor the pattern.
+        assert_eq!(owners.owners_of("pkg/docs/a.md"), ["@docs"]);
+        assert_eq!(owners.owners_of("logs"), ["@ops"]);
+        assert_eq!(owners.owners_of("app/logs/today.txt"), ["@ops"]);
+        assert_eq!(owners.owners_of("build/out.bin"), ["@build"]);
+        assert!(owners.owners_of("src/build/out.bin").is_empty());
+    }
+
+    #[test]
+    fn team_mapping_folds_members_into_teams() {
+        let teams = BTreeMap::from([
+            (
+                "@platform-team".to_string(),
+                vec!["@alice".to_string(), "bob@example.com".to_string()],
+            ),
+            ("@sre".to_string(), vec!["@Alice".to_string()]),
+        ]);
+        let owners =
+            CodeOwners::parse("/infra/ @alice @carol\n/deploy/ bob@example.com @platform-team\n")
+                .with_teams(&teams);
+        assert_eq!(
+            owners.owners_of("infra/main.tf"),
+            ["@platform-team", "@sre", "@carol"]
+        );
+        assert_eq!(owners.owners_of("deploy/run.sh"), ["@platform-team"]);
+    }
+
+    #[test]
+    fn discover_reads_standard_locations() {
+        let dir = tempfile::tempdir().unwrap();
+        assert!(CodeOwners::discover(dir.path()).is_none());
+        std::fs::create_dir_all(dir.path().join(".github")).unwrap();
+        std::fs::write(dir.path().join(".github/CODEOWNERS"), "* @all\n").unwrap();
+        let (path, owners) = CodeOwners::discover(dir.path()).unwrap();
+        assert!(path.ends_with(".github/CODEOWNERS"));
+        assert_eq!(owners.owners_of("x.rs"), ["@all"]);
+    }
+}
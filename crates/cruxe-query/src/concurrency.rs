@@ -0,0 +1,244 @@
+//! Concurrency map for `cruxe concurrency`: where Go code starts goroutines
+//! and declares channels, mutexes and WaitGroups, grouped by package.
+//!
+//! The sites are recorded at index time by
+//! [`cruxe_indexer::concurrency_extract`]; this only filters and counts
+//! them. Packages with the most sites come first, since that is where a
+//! race review or a new engineer should start reading.
+
+use crate::deps::package_name;
+use crate::todos::in_package;
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::concurrency;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::BTreeMap;
+
+/// Site kinds in the order they are reported.
+pub const KINDS: &[&str] = &["goroutine", "channel", "mutex", "waitgroup"];
+
+#[derive(Debug, thiserror::Error)]
+pub enum ConcurrencyError {
+    #[error("unknown kind `{0}`; expected goroutine, channel, mutex or waitgroup")]
+    UnknownKind(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct ConcurrencyOptions {
+    /// `goroutine`, `channel`, `mutex` and/or `waitgroup`; empty keeps all.
+    pub kinds: Vec<String>,
+    /// Only sites in this package or its subpackages.
+    pub package: Option<String>,
+    /// Only sites in files in scope.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ConcurrencySite {
+    pub kind: String,
+    /// What was found: `go s.serve`, `jobs: make(chan Job, 16)`.
+    pub detail: String,
+    /// Qualified name of the function or field the site belongs to.
+    pub symbol: Option<String>,
+    pub package: String,
+    pub path: String,
+    pub line: u32,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct PackageConcurrency {
+    pub package: String,
+    pub goroutines: usize,
+    pub channels: usize,
+    pub mutexes: usize,
+    pub waitgroups: usize,
+    pub total: usize,
+}
+
+impl PackageConcurrency {
+    fn count(&mut self, kind: &str) {
+        match kind {
+            "goroutine" => self.goroutines += 1,
+            "channel" => self.channels += 1,
+            "mutex" => self.mutexes += 1,
+            "waitgroup" => self.waitgroups += 1,
+            _ => return,
+        }
+        self.total += 1;
+    }
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ConcurrencyReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub total: usize,
+    /// Reported sites per kind.
+    pub by_kind: BTreeMap<String, usize>,
+    /// Most sites first, then by package name.
+    pub packages: Vec<PackageConcurrency>,
+    /// In path and line order.
+    pub sites: Vec<ConcurrencySite>,
+}
+
+/// The concurrency sites of `ref_name` that pass `options`.
+pub fn summarize(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &ConcurrencyOptions,
+) -> Result<ConcurrencyReport, ConcurrencyError> {
+    let mut kinds = Vec::new();
+    for kind in &options.kinds {
+        let kind = kind.trim().to_ascii_lowercase();
+        if !KINDS.contains(&kind.as_str()) {
+            return Err(ConcurrencyError::UnknownKind(kind));
+        }
+        kinds.push(kind);
+    }
+
+    let mut sites = Vec::new();
+    let mut by_package: BTreeMap<String, PackageConcurrency> = BTreeMap::new();
+    let mut by_kind = BTreeMap::new();
+    for record in concurrency::list_sites(conn, repo, ref_name)? {
+        if !kinds.is_empty() && !kinds.contains(&record.kind) {
+            continue;
+        }
+        if !options.scope.contains(&record.path) {
+            continue;
+        }
+        let package = package_name(&record.path, 0);
+        if let Some(wanted) = options.package.as_deref()
+            && !in_package(&package, wanted)
+        {
+            continue;
+        }
+        by_package
+            .entry(package.clone())
+            .or_insert_with(|| PackageConcurrency {
+                package: package.clone(),
+                ..PackageConcurrency::default()
+            })
+            .count(&record.kind);
+        *by_kind.entry(record.kind.clone()).or_default() += 1;
+        sites.push(ConcurrencySite {
+            kind: record.kind,
+            detail: record.detail,
+            symbol: record.symbol,
+            package,
+            path: record.path,
+            line: record.line,
+        });
+    }
+
+    let mut packages: Vec<PackageConcurrency> = by_package.into_values().collect();
+    packages.sort_by(|a, b| {
+        b.total
+            .cmp(&a.total)
+            .then_with(|| a.package.cmp(&b.package))
+    });
+    Ok(ConcurrencyReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        total: sites.len(),
+        by_kind,
+        packages,
+        sites,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::ConcurrencyRecord;
+    use cruxe_state::{db, schema};
+
+    fn site(path: &str, line: u32, kind: &str, detail: &str) -> ConcurrencyRecord {
+        ConcurrencyRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            kind: kind.to_string(),
+            detail: detail.to_string(),
+            symbol_id: None,
+            symbol: None,
+        }
+    }
+
+    #[test]
+    fn counts_sites_per_package_and_filters_by_kind_and_package() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let files = [
+            (
+                "worker/pool/pool.go",
+                vec![
+                    site("worker/pool/pool.go", 4, "mutex", "mu: sync.Mutex"),
+                    site("worker/pool/pool.go", 5, "channel", "jobs: chan Job"),
+                    site("worker/pool/pool.go", 20, "goroutine", "go p.drain"),
+                ],
+            ),
+            (
+                "worker/worker.go",
+                vec![site(
+                    "worker/worker.go",
+                    9,
+                    "waitgroup",
+                    "wg: sync.WaitGroup",
+                )],
+            ),
+            (
+                "server/server.go",
+                vec![site("server/server.go", 30, "goroutine", "go func literal")],
+            ),
+        ];
+        for (path, records) in &files {
+            concurrency::replace_for_file(&conn, "repo", "main", path, records).unwrap();
+        }
+
+        let report =
+            |options: ConcurrencyOptions| summarize(&conn, "repo", "main", &options).unwrap();
+        let all = report(ConcurrencyOptions::default());
+        assert_eq!(all.total, 5);
+        assert_eq!(all.by_kind["goroutine"], 2);
+        let packages: Vec<(&str, usize)> = all
+            .packages
+            .iter()
+            .map(|package| (package.package.as_str(), package.total))
+            .collect();
+        assert_eq!(packages, [("worker/pool", 3), ("server", 1), ("worker", 1)]);
+        assert_eq!(all.packages[0].mutexes, 1);
+        assert_eq!(all.sites[0].path, "server/server.go");
+
+        let workers = report(ConcurrencyOptions {
+            kinds: vec!["Goroutine".to_string(), "waitgroup".to_string()],
+            package: Some("worker".to_string()),
+            ..ConcurrencyOptions::default()
+        });
+        let details: Vec<&str> = workers
+            .sites
+            .iter()
+            .map(|site| site.detail.as_str())
+            .collect();
+        assert_eq!(details, ["go p.drain", "wg: sync.WaitGroup"]);
+
+        assert!(matches!(
+            summarize(
+                &conn,
+                "repo",
+                "main",
+                &ConcurrencyOptions {
+                    kinds: vec!["atomic".to_string()],
+                    ..ConcurrencyOptions::default()
+                }
+            ),
+            Err(ConcurrencyError::UnknownKind(kind)) if kind == "atomic"
+        ));
+    }
+}
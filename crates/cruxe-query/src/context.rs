@@ -105,6 +105,7 @@ pub fn get_code_context(
             policy_mode_override,
             policy_runtime: Some(policy_runtime.clone()),
             diversity_enabled: true,
+            in_docs: false,
         },
     )?;
     let total_candidates = search_response.results.len();
@@ -923,6 +923,7 @@ mod tests {
             kind: Some("function".to_string()),
             name: Some(format!("name_{result_id}")),
             qualified_name: Some(format!("qualified::{result_id}")),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: Some("fn demo()".to_string()),
             visibility: Some("public".to_string()),
@@ -0,0 +1,859 @@
+use crate::call_graph;
+use crate::deps::package_name;
+use crate::impact::{is_test_path, is_test_symbol};
+use crate::ref_sites::identifier_matches;
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord, is_anonymous_type_name};
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{edges, generated_files, manifest, symbols};
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::path::Path;
+
+const FILE_SOURCE_PREFIX: &str = "file::";
+
+/// Method names invoked by a language runtime or through interface/trait
+/// dispatch, which the static call graph never sees.
+const PROTOCOL_METHODS: &[&str] = &[
+    // Go
+    "String",
+    "Error",
+    "ServeHTTP",
+    "MarshalJSON",
+    "UnmarshalJSON",
+    "MarshalText",
+    "UnmarshalText",
+    "Len",
+    "Less",
+    "Swap",
+    "Read",
+    "Write",
+    "Close",
+    // Rust
+    "fmt",
+    "drop",
+    "from",
+    "into",
+    "default",
+    "clone",
+    "eq",
+    "partial_cmp",
+    "cmp",
+    "hash",
+    "deref",
+    "deref_mut",
+    "next",
+    "from_str",
+    "try_from",
+    "as_ref",
+    "serialize",
+    "deserialize",
+    // TypeScript
+    "constructor",
+    "toString",
+    "toJSON",
+];
+
+#[derive(Debug, thiserror::Error)]
+pub enum DeadCodeError {
+    #[error("invalid allow pattern {0}")]
+    InvalidPattern(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct DeadCodeOptions {
+    /// Report exported API too; by default it counts as an entry point.
+    pub include_exported: bool,
+    /// Globs over name, qualified name or path for symbols used through
+    /// reflection, code generation or other means invisible to the index.
+    pub allow: Vec<String>,
+    /// Also report exported symbols that nothing outside their own package
+    /// calls or mentions, across every indexed module of the workspace.
+    pub unused_exports: bool,
+    /// Only report symbols in files in scope. Reachability is still
+    /// computed over the whole index.
+    pub scope: PathScope,
+    /// Report symbols of generated files too. Either way they take part in
+    /// reachability.
+    pub include_generated: bool,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum DeadReason {
+    /// A function or method no entry point reaches through the call graph.
+    Unreachable,
+    /// A type or constant whose name appears nowhere but its definition.
+    Unreferenced,
+    /// Exported API that only its own package uses, or nothing at all.
+    UnusedExport,
+}
+
+impl DeadReason {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Unreachable => "unreachable",
+            Self::Unreferenced => "unreferenced",
+            Self::UnusedExport => "unused_export",
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct DeadSymbol {
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub reason: DeadReason,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct DeadCodeReport {
+    pub entry_points: usize,
+    pub reachable: usize,
+    /// Symbols skipped because an allowlist (exported API, `allow` globs,
+    /// protocol methods) covers them.
+    pub allowed: usize,
+    pub dead: Vec<DeadSymbol>,
+}
+
+/// Compute reachability from detected entry points (`main`, `init`, tests,
+/// top-level code, exported API) over the call graph and report what is
+/// left, plus types and constants nothing mentions.
+pub fn find_dead_code(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    options: &DeadCodeOptions,
+) -> Result<DeadCodeReport, DeadCodeError> {
+    let allow = allow_set(&options.allow)?;
+    let records = symbols::list_symbols_for_ref(conn, repo, ref_name)?;
+    let mut outgoing: HashMap<String, Vec<(Option<String>, Option<String>)>> = HashMap::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        outgoing
+            .entry(edge.from_symbol_id)
+            .or_default()
+            .push((edge.to_symbol_id, edge.to_name));
+        Ok(())
+    })?;
+
+    let mut by_id: HashMap<&str, usize> = HashMap::new();
+    let mut by_name: HashMap<&str, Vec<usize>> = HashMap::new();
+    let mut children: HashMap<&str, Vec<usize>> = HashMap::new();
+    for (idx, record) in records.iter().enumerate() {
+        by_id.insert(record.symbol_stable_id.as_str(), idx);
+        by_id.entry(record.symbol_id.as_str()).or_insert(idx);
+        by_name.entry(record.name.as_str()).or_default().push(idx);
+        if let Some(parent) = &record.parent_symbol_id {
+            children.entry(parent.as_str()).or_default().push(idx);
+        }
+    }
+
+    let mut allowed = 0usize;
+    let mut reachable = vec![false; records.len()];
+    let mut queue = VecDeque::new();
+    let mut entry_points = 0usize;
+    for (idx, record) in records.iter().enumerate() {
+        if is_entry_point(record) {
+            entry_points += 1;
+        } else if is_allowed(record, options, allow.as_ref()) {
+            allowed += 1;
+        } else {
+            continue;
+        }
+        reachable[idx] = true;
+        queue.push_back(idx);
+    }
+
+    // Top-level code and imports run (or are needed) whenever the file is
+    // loaded, so their targets are reachable.
+    let mut seen_names = HashSet::new();
+    let file_targets: Vec<(Option<String>, Option<String>)> = outgoing
+        .iter()
+        .filter(|(source, _)| source.starts_with(FILE_SOURCE_PREFIX))
+        .flat_map(|(_, targets)| targets.iter().cloned())
+        .collect();
+    for target in &file_targets {
+        mark_target(
+            target,
+            &by_id,
+            &by_name,
+            &mut seen_names,
+            &mut reachable,
+            &mut queue,
+        );
+    }
+
+    while let Some(idx) = queue.pop_front() {
+        let record = &records[idx];
+        for key in [&record.symbol_stable_id, &record.symbol_id] {
+            if let Some(targets) = outgoing.get(key.as_str()) {
+                for target in targets {
+                    mark_target(
+                        target,
+                        &by_id,
+                        &by_name,
+                        &mut seen_names,
+                        &mut reachable,
+                        &mut queue,
+                    );
+                }
+            }
+        }
+        // Closures and nested functions live and die with their parent.
+        for key in [&record.symbol_stable_id, &record.symbol_id] {
+            for &child in children.get(key.as_str()).into_iter().flatten() {
+                if is_callable(&records[child]) && !reachable[child] {
+                    reachable[child] = true;
+                    queue.push_back(child);
+                }
+            }
+        }
+    }
+
+    let mut dead = Vec::new();
+    let mut unreferenced_candidates = Vec::new();
+    for (idx, record) in records.iter().enumerate() {
+        if reachable[idx] {
+            continue;
+        }
+        if is_callable(record) {
+            dead.push(dead_symbol(record, DeadReason::Unreachable));
+        } else if is_declaration(record) {
+            unreferenced_candidates.push(record);
+        }
+    }
+
+    let counts = count_mentions(
+        conn,
+        workspace,
+        repo,
+        ref_name,
+        unreferenced_candidates
+            .iter()
+            .map(|record| record.name.as_str())
+            .collect(),
+    )?;
+    for record in unreferenced_candidates {
+        let definitions = by_name.get(record.name.as_str()).map_or(1, Vec::len);
+        if counts.get(record.name.as_str()).copied().unwrap_or(0) <= definitions {
+            dead.push(dead_symbol(record, DeadReason::Unreferenced));
+        }
+    }
+
+    if options.unused_exports {
+        let reported: HashSet<(&str, u32)> = dead
+            .iter()
+            .map(|symbol| (symbol.path.as_str(), symbol.line_start))
+            .collect();
+        let candidates: Vec<usize> = records
+            .iter()
+            .enumerate()
+            .filter(|(_, record)| {
+                is_exported(record)
+                    && (is_callable(record) || is_declaration(record))
+                    && !reported.contains(&(record.path.as_str(), record.line_start))
+                    && !is_entry_point(record)
+                    && !is_allowlisted(record, allow.as_ref())
+                    // A method name defined more than once may be reached
+                    // through an interface the call graph cannot resolve.
+                    && (record.kind != SymbolKind::Method
+                        || by_name.get(record.name.as_str()).map_or(0, Vec::len) <= 1)
+            })
+            .map(|(idx, _)| idx)
+            .collect();
+        let used = used_outside_package(
+            conn,
+            workspace,
+            repo,
+            ref_name,
+            &records,
+            &candidates,
+            &outgoing,
+            &by_id,
+            &by_name,
+        )?;
+        let mut unused: Vec<DeadSymbol> = candidates
+            .into_iter()
+            .filter(|idx| !used.contains(idx))
+            .map(|idx| dead_symbol(&records[idx], DeadReason::UnusedExport))
+            .collect();
+        dead.append(&mut unused);
+    }
+
+    dead.retain(|symbol| options.scope.contains(&symbol.path));
+    if !options.include_generated {
+        let generated = generated_files::paths_for_ref(conn, repo, ref_name)?;
+        dead.retain(|symbol| !generated.contains(&symbol.path));
+    }
+    dead.sort_by(|left, right| {
+        left.path
+            .cmp(&right.path)
+            .then_with(|| left.line_start.cmp(&right.line_start))
+    });
+    Ok(DeadCodeReport {
+        entry_points,
+        reachable: reachable.iter().filter(|&&value| value).count(),
+        allowed,
+        dead,
+    })
+}
+
+/// Resolved targets mark one symbol. An unresolved call by name marks every
+/// symbol with that name: dynamic dispatch may reach any of them.
+fn mark_target(
+    (to_symbol_id, to_name): &(Option<String>, Option<String>),
+    by_id: &HashMap<&str, usize>,
+    by_name: &HashMap<&str, Vec<usize>>,
+    seen_names: &mut HashSet<String>,
+    reachable: &mut [bool],
+    queue: &mut VecDeque<usize>,
+) {
+    let mut mark = |idx: usize| {
+        if !reachable[idx] {
+            reachable[idx] = true;
+            queue.push_back(idx);
+        }
+    };
+    if let Some(&idx) = to_symbol_id.as_deref().and_then(|id| by_id.get(id)) {
+        mark(idx);
+        return;
+    }
+    let Some(name) = to_name.as_deref() else {
+        return;
+    };
+    let name = name.rsplit("::").next().unwrap_or(name);
+    let name = name.rsplit('.').next().unwrap_or(name).trim();
+    if !seen_names.insert(name.to_string()) {
+        return;
+    }
+    for &idx in by_name.get(name).into_iter().flatten() {
+        mark(idx);
+    }
+}
+
+fn is_entry_point(record: &SymbolRecord) -> bool {
+    if !is_callable(record) {
+        return false;
+    }
+    let name = record.name.as_str();
+    let top_level = record.parent_symbol_id.is_none();
+    (top_level && name == "main")
+        || (top_level && record.language == "go" && name == "init")
+        || is_test_path(&record.path)
+        || is_test_symbol(&call_graph::to_call_graph_symbol(record))
+}
+
+fn is_allowed(record: &SymbolRecord, options: &DeadCodeOptions, allow: Option<&GlobSet>) -> bool {
+    (!options.include_exported && is_exported(record)) || is_allowlisted(record, allow)
+}
+
+/// Protocol methods and `allow` globs, which hold whatever else is reported.
+fn is_allowlisted(record: &SymbolRecord, allow: Option<&GlobSet>) -> bool {
+    if record.kind == SymbolKind::Method
+        && (PROTOCOL_METHODS.contains(&record.name.as_str())
+            || (record.name.starts_with("__") && record.name.ends_with("__")))
+    {
+        return true;
+    }
+    allow.is_some_and(|set| {
+        set.is_match(&record.name)
+            || set.is_match(&record.qualified_name)
+            || set.is_match(&record.path)
+    })
+}
+
+/// Visible outside its package by the language's own rules.
+pub(crate) fn is_exported(record: &SymbolRecord) -> bool {
+    is_exported_parts(
+        &record.language,
+        &record.name,
+        record.signature.as_deref(),
+        record.visibility.as_deref(),
+    )
+}
+
+/// [`is_exported`] for callers holding the fields rather than a record.
+pub(crate) fn is_exported_parts(
+    language: &str,
+    name: &str,
+    signature: Option<&str>,
+    visibility: Option<&str>,
+) -> bool {
+    if let Some(visibility) = visibility {
+        return matches!(
+            visibility.trim().to_ascii_lowercase().as_str(),
+            "pub" | "public" | "export"
+        );
+    }
+    let signature = signature.unwrap_or_default().trim_start();
+    match language {
+        "go" => name.starts_with(|c: char| c.is_ascii_uppercase()),
+        "rust" => signature.starts_with("pub ") || signature.starts_with("pub\t"),
+        "typescript" | "javascript" => signature.starts_with("export "),
+        "python" => !name.starts_with('_'),
+        _ => false,
+    }
+}
+
+fn is_callable(record: &SymbolRecord) -> bool {
+    matches!(record.kind, SymbolKind::Function | SymbolKind::Method)
+}
+
+/// Declarations reported when nothing mentions them; anonymous types are
+/// used where they are written.
+fn is_declaration(record: &SymbolRecord) -> bool {
+    matches!(
+        record.kind,
+        SymbolKind::Struct
+            | SymbolKind::Class
+            | SymbolKind::Enum
+            | SymbolKind::Trait
+            | SymbolKind::Interface
+            | SymbolKind::TypeAlias
+            | SymbolKind::Constant
+    ) && !is_anonymous_type_name(&record.name)
+}
+
+fn allow_set(patterns: &[String]) -> Result<Option<GlobSet>, DeadCodeError> {
+    if patterns.is_empty() {
+        return Ok(None);
+    }
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        let glob = GlobBuilder::new(pattern)
+            .build()
+            .map_err(|err| DeadCodeError::InvalidPattern(format!("`{pattern}`: {err}")))?;
+        builder.add(glob);
+    }
+    builder
+        .build()
+        .map(Some)
+        .map_err(|err| DeadCodeError::InvalidPattern(err.to_string()))
+}
+
+/// Whole-identifier occurrences of each name across the indexed files.
+fn count_mentions<'a>(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    names: HashSet<&'a str>,
+) -> Result<HashMap<&'a str, usize>, StateError> {
+    let mut counts = HashMap::new();
+    if names.is_empty() {
+        return Ok(counts);
+    }
+    for entry in manifest::get_all_entries(conn, repo, ref_name)? {
+        let Ok(content) = std::fs::read_to_string(workspace.join(&entry.path)) else {
+            continue;
+        };
+        for &name in &names {
+            if content.contains(name) {
+                *counts.entry(name).or_default() += identifier_matches(&content, name).len();
+            }
+        }
+    }
+    Ok(counts)
+}
+
+/// Candidates some symbol or file of another package calls or mentions.
+/// Packages are directories, as Go defines them; a call edge from another
+/// directory or a whole-identifier mention in another directory's indexed
+/// file counts as use.
+#[allow(clippy::too_many_arguments)]
+fn used_outside_package(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    records: &[SymbolRecord],
+    candidates: &[usize],
+    outgoing: &HashMap<String, Vec<(Option<String>, Option<String>)>>,
+    by_id: &HashMap<&str, usize>,
+    by_name: &HashMap<&str, Vec<usize>>,
+) -> Result<HashSet<usize>, StateError> {
+    let mut used = HashSet::new();
+    if candidates.is_empty() {
+        return Ok(used);
+    }
+    let wanted: HashSet<usize> = candidates.iter().copied().collect();
+    for (source, targets) in outgoing {
+        let source_path = match source.strip_prefix(FILE_SOURCE_PREFIX) {
+            Some(path) => path,
+            None => match by_id.get(source.as_str()) {
+                Some(&idx) => records[idx].path.as_str(),
+                None => continue,
+            },
+        };
+        let source_package = package_name(source_path, 0);
+        for (to_symbol_id, to_name) in targets {
+            let resolved = to_symbol_id.as_deref().and_then(|id| by_id.get(id));
+            let named = to_name.as_deref().map(|name| {
+                let name = name.rsplit("::").next().unwrap_or(name);
+                name.rsplit('.').next().unwrap_or(name).trim()
+            });
+            let hits = match (resolved, named) {
+                (Some(&idx), _) => vec![idx],
+                (None, Some(name)) => by_name.get(name).cloned().unwrap_or_default(),
+                (None, None) => Vec::new(),
+            };
+            for idx in hits {
+                if wanted.contains(&idx) && package_name(&records[idx].path, 0) != source_package {
+                    used.insert(idx);
+                }
+            }
+        }
+    }
+
+    let mut pending: Vec<usize> = candidates
+        .iter()
+        .copied()
+        .filter(|idx| !used.contains(idx))
+        .collect();
+    if pending.is_empty() {
+        return Ok(used);
+    }
+    for entry in manifest::get_all_entries(conn, repo, ref_name)? {
+        let Ok(content) = std::fs::read_to_string(workspace.join(&entry.path)) else {
+            continue;
+        };
+        let package = package_name(&entry.path, 0);
+        pending.retain(|&idx| {
+            let record = &records[idx];
+            let mentioned = package_name(&record.path, 0) != package
+                && content.contains(record.name.as_str())
+                && !identifier_matches(&content, &record.name).is_empty();
+            if mentioned {
+                used.insert(idx);
+            }
+            !mentioned
+        });
+        if pending.is_empty() {
+            break;
+        }
+    }
+    Ok(used)
+}
+
+fn dead_symbol(record: &SymbolRecord, reason: DeadReason) -> DeadSymbol {
+    DeadSymbol {
+        qualified_name: record.qualified_name.clone(),
+        kind: record.kind.as_str().to_string(),
+        path: record.path.clone(),
+        line_start: record.line_start,
+        line_end: record.line_end,
+        reason,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (tmp, conn)
+    }
+
+    fn symbol(name: &str, kind: SymbolKind, path: &str, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("app.{name}"),
+            kind,
+            signature: None,
+            line_start: line,
+            line_end: line + 3,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: Option<&str>, to_name: Option<&str>) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: to.map(|name| format!("stable::{name}")),
+            to_name: to_name.map(ToString::to_string),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: "app/main.go".to_string(),
+            source_line: 1,
+        }
+    }
+
+    fn add_file(conn: &Connection, workspace: &Path, path: &str, content: &str) {
+        let full = workspace.join(path);
+        std::fs::create_dir_all(full.parent().unwrap()).unwrap();
+        std::fs::write(&full, content).unwrap();
+        manifest::upsert_manifest(
+            conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: path.to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    fn seed(conn: &Connection, workspace: &Path) {
+        for record in [
+            symbol("main", SymbolKind::Function, "app/main.go", 1),
+            symbol("run", SymbolKind::Function, "app/main.go", 10),
+            symbol("helper", SymbolKind::Function, "app/util.go", 1),
+            symbol("orphan", SymbolKind::Function, "app/util.go", 10),
+            symbol("Exported", SymbolKind::Function, "app/util.go", 20),
+            symbol("handle", SymbolKind::Method, "app/handler.go", 1),
+            symbol("config", SymbolKind::Struct, "app/types.go", 1),
+            symbol("unusedLimit", SymbolKind::Constant, "app/types.go", 8),
+            symbol("TestRun", SymbolKind::Function, "app/main_test.go", 1),
+        ] {
+            symbols::insert_symbol(conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            conn,
+            "repo",
+            "main",
+            &[
+                call("main", Some("run"), None),
+                call("run", Some("helper"), None),
+                call("run", None, Some("h.handle")),
+            ],
+        )
+        .unwrap();
+        add_file(
+            conn,
+            workspace,
+            "app/types.go",
+            "type config struct{}\nconst unusedLimit = 3\n",
+        );
+        add_file(
+            conn,
+            workspace,
+            "app/main.go",
+            "func main() { run() }\nfunc run() { var c config; helper(); h.handle() }\n",
+        );
+    }
+
+    fn names(report: &DeadCodeReport) -> Vec<(&str, DeadReason)> {
+        report
+            .dead
+            .iter()
+            .map(|dead| (dead.qualified_name.as_str(), dead.reason))
+            .collect()
+    }
+
+    #[test]
+    fn reports_unreachable_functions_and_unreferenced_declarations() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        seed(&conn, &workspace);
+
+        let report = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions::default(),
+        )
+        .unwrap();
+        assert_eq!(
+            names(&report),
+            vec![
+                ("app.unusedLimit", DeadReason::Unreferenced),
+                ("app.orphan", DeadReason::Unreachable),
+            ]
+        );
+        // main and TestRun; Exported is allowed as public API.
+        assert_eq!(report.entry_points, 2);
+        assert_eq!(report.allowed, 1);
+    }
+
+    #[test]
+    fn generated_files_are_not_reported_unless_asked() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        seed(&conn, &workspace);
+        for record in [
+            symbol("decodeReq", SymbolKind::Function, "api/api.pb.go", 1),
+            symbol("unusedStub", SymbolKind::Function, "api/api.pb.go", 10),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[call("run", Some("decodeReq"), None)],
+        )
+        .unwrap();
+        generated_files::replace_for_file(&conn, "repo", "main", "api/api.pb.go", Some("protobuf"))
+            .unwrap();
+
+        let report = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions::default(),
+        )
+        .unwrap();
+        assert!(
+            !names(&report)
+                .iter()
+                .any(|(name, _)| *name == "app.unusedStub")
+        );
+
+        let report = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions {
+                include_generated: true,
+                ..DeadCodeOptions::default()
+            },
+        )
+        .unwrap();
+        assert!(names(&report).contains(&("app.unusedStub", DeadReason::Unreachable)));
+        // Calls into generated code still make it reachable.
+        assert!(
+            !names(&report)
+                .iter()
+                .any(|(name, _)| *name == "app.decodeReq")
+        );
+    }
+
+    #[test]
+    fn allowlists_can_be_widened_or_narrowed() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        seed(&conn, &workspace);
+
+        let report = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions {
+                include_exported: true,
+                allow: vec!["orph*".to_string()],
+                ..DeadCodeOptions::default()
+            },
+        )
+        .unwrap();
+        let dead = names(&report);
+        assert!(dead.contains(&("app.Exported", DeadReason::Unreachable)));
+        assert!(!dead.iter().any(|(name, _)| *name == "app.orphan"));
+
+        let err = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions {
+                include_exported: false,
+                allow: vec!["[".to_string()],
+                ..DeadCodeOptions::default()
+            },
+        )
+        .unwrap_err();
+        assert!(matches!(err, DeadCodeError::InvalidPattern(_)));
+    }
+
+    #[test]
+    fn unused_exports_need_a_caller_or_mention_from_another_package() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        seed(&conn, &workspace);
+        for record in [
+            symbol("Shared", SymbolKind::Function, "app/util.go", 30),
+            symbol("Internal", SymbolKind::Function, "app/util.go", 40),
+            symbol("Remote", SymbolKind::Function, "lib/remote.go", 1),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("run", Some("Internal"), None),
+                call("Remote", Some("Shared"), None),
+            ],
+        )
+        .unwrap();
+        add_file(
+            &conn,
+            &workspace,
+            "cmd/tool/main.go",
+            "func main() { app.Exported() }\n",
+        );
+
+        let report = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions {
+                unused_exports: true,
+                ..DeadCodeOptions::default()
+            },
+        )
+        .unwrap();
+        // Shared is called from lib and Exported mentioned from cmd/tool;
+        // Internal is only called inside app and Remote not at all.
+        assert_eq!(
+            names(&report),
+            vec![
+                ("app.unusedLimit", DeadReason::Unreferenced),
+                ("app.orphan", DeadReason::Unreachable),
+                ("app.Internal", DeadReason::UnusedExport),
+                ("app.Remote", DeadReason::UnusedExport),
+            ]
+        );
+
+        let scoped = find_dead_code(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            &DeadCodeOptions {
+                unused_exports: true,
+                scope: PathScope::new(&[], &["lib/".to_string()]).unwrap(),
+                ..DeadCodeOptions::default()
+            },
+        )
+        .unwrap();
+        assert_eq!(scoped.dead.len(), 3);
+        assert!(!names(&scoped).iter().any(|(name, _)| *name == "app.Remote"));
+    }
+}
@@ -0,0 +1,522 @@
+use crate::report::{ROOT_PACKAGE, package_cycles};
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+use std::fmt::Write as _;
+
+/// Node standing in for every external dependency with
+/// [`ExternalDeps::Collapse`].
+pub const EXTERNAL_NODE: &str = "(external)";
+
+const FILE_SOURCE_PREFIX: &str = "file::";
+
+/// What to do with imports that do not resolve to an indexed symbol.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum ExternalDeps {
+    /// One node per imported external name.
+    #[default]
+    Keep,
+    /// A single node for all external dependencies.
+    Collapse,
+    Hide,
+}
+
+impl ExternalDeps {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "keep" | "show" => Some(Self::Keep),
+            "collapse" => Some(Self::Collapse),
+            "hide" | "none" => Some(Self::Hide),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Keep => "keep",
+            Self::Collapse => "collapse",
+            Self::Hide => "hide",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct DepsOptions {
+    pub external: ExternalDeps,
+    /// Keep only the first N directory components of a package (0 keeps the
+    /// whole directory), e.g. 2 groups `crates/foo/src/x` as `crates/foo`.
+    pub group_depth: usize,
+    /// Only imports made by files in scope; the packages they import still
+    /// appear as targets.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct DepsNode {
+    pub name: String,
+    pub external: bool,
+    /// Member of an import cycle.
+    pub in_cycle: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct DepsEdge {
+    pub from: String,
+    pub to: String,
+    /// Import statements behind this edge.
+    pub imports: usize,
+    /// Both ends are in the same cycle.
+    pub in_cycle: bool,
+}
+
+/// Package-level import graph, as opposed to the symbol-level call graph.
+/// Packages are source directories.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct DepsGraph {
+    pub repo: String,
+    pub ref_name: String,
+    pub nodes: Vec<DepsNode>,
+    pub edges: Vec<DepsEdge>,
+    /// Strongly connected groups of internal packages, each sorted by name.
+    pub cycles: Vec<Vec<String>>,
+}
+
+pub fn build_deps_graph(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &DepsOptions,
+) -> Result<DepsGraph, StateError> {
+    let mut imports = Vec::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        if edge.edge_type == "imports" {
+            imports.push(edge);
+        }
+        Ok(())
+    })?;
+
+    let targets: BTreeSet<&str> = imports
+        .iter()
+        .filter_map(|edge| edge.to_symbol_id.as_deref())
+        .collect();
+    let mut target_paths: HashMap<String, String> = HashMap::new();
+    if !targets.is_empty() {
+        symbols::for_each_symbol_for_ref(conn, repo, ref_name, |symbol| {
+            if targets.contains(symbol.symbol_stable_id.as_str()) {
+                target_paths
+                    .entry(symbol.symbol_stable_id)
+                    .or_insert(symbol.path);
+            }
+            Ok(())
+        })?;
+    }
+
+    let mut internal = BTreeSet::new();
+    let mut external = BTreeSet::new();
+    let mut dependencies: BTreeMap<(String, String), usize> = BTreeMap::new();
+    for edge in &imports {
+        let Some(source_path) = edge.from_symbol_id.strip_prefix(FILE_SOURCE_PREFIX) else {
+            continue;
+        };
+        if !options.scope.contains(source_path) {
+            continue;
+        }
+        let from = package_name(source_path, options.group_depth);
+        internal.insert(from.clone());
+
+        let resolved = edge
+            .to_symbol_id
+            .as_ref()
+            .and_then(|id| target_paths.get(id));
+        let to = match resolved {
+            Some(path) => {
+                let to = package_name(path, options.group_depth);
+                internal.insert(to.clone());
+                to
+            }
+            None => {
+                // Resolved edges to symbols no longer indexed carry no name.
+                let name = edge.to_name.as_deref().unwrap_or_default().trim();
+                if name.is_empty() {
+                    continue;
+                }
+                let to = match options.external {
+                    ExternalDeps::Hide => continue,
+                    ExternalDeps::Collapse => EXTERNAL_NODE.to_string(),
+                    ExternalDeps::Keep => name.to_string(),
+                };
+                external.insert(to.clone());
+                to
+            }
+        };
+        if from != to {
+            *dependencies.entry((from, to)).or_default() += 1;
+        }
+    }
+
+    let internal_dependencies: BTreeMap<(String, String), usize> = dependencies
+        .iter()
+        .filter(|((_, to), _)| internal.contains(to))
+        .map(|(key, count)| (key.clone(), *count))
+        .collect();
+    let cycles = package_cycles(&internal_dependencies);
+    let cycle_of: HashMap<&str, usize> = cycles
+        .iter()
+        .enumerate()
+        .flat_map(|(idx, members)| members.iter().map(move |name| (name.as_str(), idx)))
+        .collect();
+
+    let mut nodes: Vec<DepsNode> = internal
+        .iter()
+        .map(|name| DepsNode {
+            name: name.clone(),
+            external: false,
+            in_cycle: cycle_of.contains_key(name.as_str()),
+        })
+        .collect();
+    // A name that is both an indexed package and an external import stays
+    // internal.
+    nodes.extend(
+        external
+            .into_iter()
+            .filter(|name| !internal.contains(name))
+            .map(|name| DepsNode {
+                name,
+                external: true,
+                in_cycle: false,
+            }),
+    );
+    let edges = dependencies
+        .into_iter()
+        .map(|((from, to), imports)| {
+            let in_cycle = matches!(
+                (cycle_of.get(from.as_str()), cycle_of.get(to.as_str())),
+                (Some(a), Some(b)) if a == b
+            );
+            DepsEdge {
+                from,
+                to,
+                imports,
+                in_cycle,
+            }
+        })
+        .collect();
+
+    Ok(DepsGraph {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        nodes,
+        edges,
+        cycles,
+    })
+}
+
+impl DepsGraph {
+    /// Keep only the cycles `keep` accepts, and clear the cycle flags of
+    /// nodes and edges that were only in dropped ones.
+    pub fn retain_cycles(&mut self, mut keep: impl FnMut(&[String]) -> bool) {
+        self.cycles.retain(|cycle| keep(cycle));
+        let cycle_of: HashMap<&str, usize> = self
+            .cycles
+            .iter()
+            .enumerate()
+            .flat_map(|(idx, members)| members.iter().map(move |name| (name.as_str(), idx)))
+            .collect();
+        for node in &mut self.nodes {
+            node.in_cycle &= cycle_of.contains_key(node.name.as_str());
+        }
+        for edge in &mut self.edges {
+            edge.in_cycle &= matches!(
+                (cycle_of.get(edge.from.as_str()), cycle_of.get(edge.to.as_str())),
+                (Some(a), Some(b)) if a == b
+            );
+        }
+    }
+}
+
+pub(crate) fn package_name(path: &str, group_depth: usize) -> String {
+    let Some((dir, _)) = path.rsplit_once('/') else {
+        return ROOT_PACKAGE.to_string();
+    };
+    if group_depth == 0 {
+        return dir.to_string();
+    }
+    dir.split('/')
+        .take(group_depth)
+        .collect::<Vec<_>>()
+        .join("/")
+}
+
+/// Graphviz DOT; external packages are dashed and cycles drawn in red.
+pub fn render_dot(graph: &DepsGraph) -> String {
+    let mut out = String::from("digraph deps {\n  rankdir=LR;\n  node [shape=box];\n");
+    for node in &graph.nodes {
+        let mut attrs = Vec::new();
+        if node.external {
+            attrs.push("style=dashed");
+        }
+        if node.in_cycle {
+            attrs.push("color=red");
+        }
+        if attrs.is_empty() {
+            let _ = writeln!(out, "  {};", dot_id(&node.name));
+        } else {
+            let _ = writeln!(out, "  {} [{}];", dot_id(&node.name), attrs.join(", "));
+        }
+    }
+    for edge in &graph.edges {
+        let _ = writeln!(
+            out,
+            "  {} -> {} [label=\"{}\"{}];",
+            dot_id(&edge.from),
+            dot_id(&edge.to),
+            edge.imports,
+            if edge.in_cycle { ", color=red" } else { "" }
+        );
+    }
+    out.push_str("}\n");
+    out
+}
+
+/// Mermaid flowchart; node ids are positional because package paths are not
+/// valid Mermaid identifiers.
+pub fn render_mermaid(graph: &DepsGraph) -> String {
+    let ids: HashMap<&str, String> = graph
+        .nodes
+        .iter()
+        .enumerate()
+        .map(|(idx, node)| (node.name.as_str(), format!("p{idx}")))
+        .collect();
+    let mut out = String::from("graph LR\n");
+    for node in &graph.nodes {
+        let class = match (node.external, node.in_cycle) {
+            (true, _) => ":::external",
+            (false, true) => ":::cycle",
+            (false, false) => "",
+        };
+        let _ = writeln!(
+            out,
+            "  {}[\"{}\"]{}",
+            ids[node.name.as_str()],
+            node.name.replace('"', "#quot;"),
+            class
+        );
+    }
+    let mut cycle_links = Vec::new();
+    for (idx, edge) in graph.edges.iter().enumerate() {
+        let _ = writeln!(
+            out,
+            "  {} -->|{}| {}",
+            ids[edge.from.as_str()],
+            edge.imports,
+            ids[edge.to.as_str()]
+        );
+        if edge.in_cycle {
+            cycle_links.push(idx.to_string());
+        }
+    }
+    out.push_str("  classDef external stroke-dasharray: 5 5;\n");
+    out.push_str("  classDef cycle stroke:#d00,stroke-width:2px;\n");
+    if !cycle_links.is_empty() {
+        let _ = writeln!(
+            out,
+            "  linkStyle {} stroke:#d00,stroke-width:2px;",
+            cycle_links.join(",")
+        );
+    }
+    out
+}
+
+fn dot_id(value: &str) -> String {
+    format!("\"{}\"", value.replace('\\', "\\\\").replace('"', "\\\""))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+    use rusqlite::params;
+
+    fn setup() -> Connection {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for (stable, path) in [
+            ("api-handler", "pkg/api/handler.go"),
+            ("store-db", "pkg/store/db.go"),
+            ("model-user", "pkg/model/user.go"),
+        ] {
+            symbols::insert_symbol(
+                &conn,
+                &SymbolRecord {
+                    repo: "repo".to_string(),
+                    r#ref: "main".to_string(),
+                    commit: None,
+                    path: path.to_string(),
+                    language: "go".to_string(),
+                    symbol_id: format!("sym::{stable}"),
+                    symbol_stable_id: stable.to_string(),
+                    name: stable.to_string(),
+                    qualified_name: stable.to_string(),
+                    kind: SymbolKind::Function,
+                    signature: None,
+                    line_start: 1,
+                    line_end: 5,
+                    parent_symbol_id: None,
+                    visibility: None,
+                    content: None,
+                },
+            )
+            .unwrap();
+        }
+        for (from, to_symbol, to_name) in [
+            ("file::pkg/api/handler.go", Some("store-db"), None),
+            ("file::pkg/api/handler.go", None, Some("fmt")),
+            ("file::pkg/store/db.go", Some("model-user"), None),
+            ("file::pkg/model/user.go", Some("store-db"), None),
+            ("file::pkg/model/user.go", None, Some("time")),
+            ("file::main.go", Some("api-handler"), None),
+        ] {
+            conn.execute(
+                "INSERT INTO symbol_edges (repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence)
+                 VALUES ('repo', 'main', ?1, ?2, ?3, 'imports', 'static')",
+                params![from, to_symbol, to_name],
+            )
+            .unwrap();
+        }
+        conn
+    }
+
+    fn edge_pairs(graph: &DepsGraph) -> Vec<(&str, &str)> {
+        graph
+            .edges
+            .iter()
+            .map(|edge| (edge.from.as_str(), edge.to.as_str()))
+            .collect()
+    }
+
+    #[test]
+    fn builds_package_graph_and_finds_cycles() {
+        let conn = setup();
+        let graph = build_deps_graph(&conn, "repo", "main", &DepsOptions::default()).unwrap();
+        assert_eq!(
+            edge_pairs(&graph),
+            vec![
+                (".", "pkg/api"),
+                ("pkg/api", "fmt"),
+                ("pkg/api", "pkg/store"),
+                ("pkg/model", "pkg/store"),
+                ("pkg/model", "time"),
+                ("pkg/store", "pkg/model"),
+            ]
+        );
+        assert_eq!(
+            graph.cycles,
+            vec![vec!["pkg/model".to_string(), "pkg/store".to_string()]]
+        );
+        let cycle_edges: Vec<&DepsEdge> = graph.edges.iter().filter(|edge| edge.in_cycle).collect();
+        assert_eq!(cycle_edges.len(), 2);
+        let fmt = graph.nodes.iter().find(|node| node.name == "fmt").unwrap();
+        assert!(fmt.external);
+    }
+
+    #[test]
+    fn dropped_cycles_clear_their_flags() {
+        let conn = setup();
+        let mut graph = build_deps_graph(&conn, "repo", "main", &DepsOptions::default()).unwrap();
+        graph.retain_cycles(|cycle| !cycle.contains(&"pkg/store".to_string()));
+        assert!(graph.cycles.is_empty());
+        assert!(graph.edges.iter().all(|edge| !edge.in_cycle));
+        assert!(graph.nodes.iter().all(|node| !node.in_cycle));
+    }
+
+    #[test]
+    fn external_deps_collapse_or_hide() {
+        let conn = setup();
+        let collapsed = build_deps_graph(
+            &conn,
+            "repo",
+            "main",
+            &DepsOptions {
+                external: ExternalDeps::Collapse,
+                group_depth: 0,
+                ..DepsOptions::default()
+            },
+        )
+        .unwrap();
+        let external: Vec<&str> = collapsed
+            .nodes
+            .iter()
+            .filter(|node| node.external)
+            .map(|node| node.name.as_str())
+            .collect();
+        assert_eq!(external, vec![EXTERNAL_NODE]);
+
+        let hidden = build_deps_graph(
+            &conn,
+            "repo",
+            "main",
+            &DepsOptions {
+                external: ExternalDeps::Hide,
+                group_depth: 1,
+                ..DepsOptions::default()
+            },
+        )
+        .unwrap();
+        assert!(hidden.nodes.iter().all(|node| !node.external));
+        // Grouped to `pkg`, the cycle becomes an internal edge and vanishes.
+        assert_eq!(edge_pairs(&hidden), vec![(".", "pkg")]);
+        assert!(hidden.cycles.is_empty());
+    }
+
+    #[test]
+    fn scope_keeps_imports_made_in_scope() {
+        let conn = setup();
+        let scoped = build_deps_graph(
+            &conn,
+            "repo",
+            "main",
+            &DepsOptions {
+                external: ExternalDeps::Hide,
+                scope: PathScope::new(&["pkg/api/**".to_string()], &[]).unwrap(),
+                ..DepsOptions::default()
+            },
+        )
+        .unwrap();
+        assert_eq!(edge_pairs(&scoped), vec![("pkg/api", "pkg/store")]);
+        assert!(scoped.cycles.is_empty());
+    }
+
+    #[test]
+    fn renderers_mark_cycles_and_externals() {
+        let conn = setup();
+        let graph = build_deps_graph(&conn, "repo", "main", &DepsOptions::default()).unwrap();
+
+        let dot = render_dot(&graph);
+        assert!(dot.starts_with("digraph deps {"));
+        assert!(dot.contains("\"fmt\" [style=dashed];"));
+        assert!(dot.contains("\"pkg/store\" -> \"pkg/model\" [label=\"1\", color=red];"));
+
+        let mermaid = render_mermaid(&graph);
+        assert!(mermaid.starts_with("graph LR\n"));
+        assert!(mermaid.contains("[\"fmt\"]:::external"));
+        assert!(mermaid.contains("[\"pkg/store\"]:::cycle"));
+        assert!(mermaid.contains("linkStyle 3,5 stroke:#d00"));
+    }
+
+    #[test]
+    fn external_deps_parse_aliases() {
+        assert_eq!(ExternalDeps::parse("show"), Some(ExternalDeps::Keep));
+        assert_eq!(
+            ExternalDeps::parse("Collapse"),
+            Some(ExternalDeps::Collapse)
+        );
+        assert_eq!(ExternalDeps::parse("none"), Some(ExternalDeps::Hide));
+        assert_eq!(ExternalDeps::parse("drop"), None);
+    }
+}
@@ -0,0 +1,455 @@
+//! One-shot summary of a symbol, for `cruxe describe`.
+//!
+//! The index does not store type relationships, so they are read from the
+//! source along with the doc comment ([`doc_comment`]): supertypes from the
+//! declaration header, and Rust trait impls from the `impl Trait for Type`
+//! lines the reference scan turns up. History is `git log -L` over the
+//! symbol's line range.
+
+use crate::graph_export::supertypes_from_source;
+use crate::ref_sites::{self, RefKind, bare_name};
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_indexer::doc_extract::doc_comment;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::HashSet;
+use std::path::Path;
+
+#[derive(Debug, thiserror::Error)]
+pub enum DescribeError {
+    #[error("symbol not found")]
+    SymbolNotFound,
+    #[error("ambiguous symbol ({} candidates)", candidates.len())]
+    Ambiguous { candidates: Vec<String> },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// A type the symbol extends, implements or embeds.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct Supertype {
+    pub name: String,
+    pub relation: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct Callee {
+    pub name: String,
+    /// Set when the call edge resolved to an indexed symbol.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub qualified_name: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub path: Option<String>,
+    /// First line in the described symbol that makes the call.
+    pub call_line: u32,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct HistoryEntry {
+    pub commit: String,
+    pub author: String,
+    pub date: String,
+    pub subject: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SymbolCard {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub visibility: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub parent: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub doc: Option<String>,
+    /// Distinct symbols with a call edge to this one.
+    pub callers: usize,
+    pub callees: Vec<Callee>,
+    pub supertypes: Vec<Supertype>,
+    /// Occurrences of the name other than its definitions.
+    pub references: usize,
+    pub history: Vec<HistoryEntry>,
+}
+
+/// Describe `symbol` (a bare or qualified name, optionally restricted to
+/// one file) in `ref_name`. Up to `history_limit` commits are listed.
+pub fn describe_symbol(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    path: Option<&str>,
+    history_limit: usize,
+) -> Result<SymbolCard, DescribeError> {
+    let sym = resolve_symbol(conn, project_id, ref_name, symbol, path)?;
+    let source: Vec<String> = std::fs::read_to_string(workspace.join(&sym.path))
+        .map(|content| content.lines().map(str::to_string).collect())
+        .unwrap_or_default();
+
+    let parent = match sym.parent_symbol_id.as_deref() {
+        Some(parent_id) => symbols::get_symbol_by_id(conn, project_id, ref_name, parent_id)?
+            .map(|parent| parent.qualified_name),
+        None => None,
+    };
+
+    let mut callers = HashSet::new();
+    for id in [&sym.symbol_stable_id, &sym.symbol_id] {
+        for edge in edges::get_callers(conn, project_id, ref_name, id)? {
+            callers.insert(edge.from_symbol_id);
+        }
+    }
+    let callees = callees(conn, project_id, ref_name, &sym)?;
+
+    let kind = sym.kind.as_str();
+    let mut supertypes: Vec<Supertype> = match sym.line_start {
+        0 => Vec::new(),
+        start => {
+            let first = start as usize - 1;
+            let last = (sym.line_end.max(start) as usize).min(source.len());
+            supertypes_from_source(&sym.language, kind, source.get(first..last).unwrap_or(&[]))
+                .into_iter()
+                .map(|(name, relation)| Supertype {
+                    name,
+                    relation: relation.as_str().to_string(),
+                })
+                .collect()
+        }
+    };
+
+    let sites = ref_sites::find_reference_sites(
+        conn,
+        workspace,
+        project_id,
+        ref_name,
+        &sym.qualified_name,
+        &[],
+    )?;
+    let mut references = 0;
+    for site in &sites.references {
+        if site.kind == RefKind::Definition {
+            continue;
+        }
+        references += 1;
+        if sym.language == "rust"
+            && let Some(name) = rust_impl_trait(&site.text, &sym.name)
+        {
+            let supertype = Supertype {
+                name,
+                relation: "implements".to_string(),
+            };
+            if !supertypes.contains(&supertype) {
+                supertypes.push(supertype);
+            }
+        }
+    }
+
+    let history = symbol_history(
+        workspace,
+        ref_name,
+        &sym.path,
+        sym.line_start,
+        sym.line_end,
+        history_limit,
+    );
+
+    Ok(SymbolCard {
+        doc: doc_comment(&source, sym.line_start, &sym.language),
+        kind: kind.to_string(),
+        name: sym.name,
+        qualified_name: sym.qualified_name,
+        language: sym.language,
+        path: sym.path,
+        line_start: sym.line_start,
+        line_end: sym.line_end,
+        signature: sym.signature,
+        visibility: sym.visibility,
+        parent,
+        callers: callers.len(),
+        callees,
+        supertypes,
+        references,
+        history,
+    })
+}
+
+/// The symbol `symbol` names, a bare or qualified name, optionally in one
+/// file.
+pub(crate) fn resolve_symbol(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    path: Option<&str>,
+) -> Result<SymbolRecord, DescribeError> {
+    let name = bare_name(symbol);
+    let mut matches = symbols::find_symbols_by_name(conn, project_id, ref_name, name, path)?;
+    if name != symbol {
+        matches.retain(|candidate| candidate.qualified_name == symbol);
+    }
+    match matches.len() {
+        0 => Err(DescribeError::SymbolNotFound),
+        1 => Ok(matches.remove(0)),
+        _ => Err(DescribeError::Ambiguous {
+            candidates: matches
+                .iter()
+                .map(|candidate| {
+                    format!(
+                        "{} ({}) {}:{}",
+                        candidate.qualified_name,
+                        candidate.kind.as_str(),
+                        candidate.path,
+                        candidate.line_start
+                    )
+                })
+                .collect(),
+        }),
+    }
+}
+
+/// Distinct call targets in call-site order.
+fn callees(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+) -> Result<Vec<Callee>, StateError> {
+    let mut calls = edges::get_callees(conn, project_id, ref_name, &sym.symbol_stable_id)?;
+    if calls.is_empty() {
+        calls = edges::get_callees(conn, project_id, ref_name, &sym.symbol_id)?;
+    }
+    calls.sort_by_key(|edge| edge.source_line);
+
+    let mut seen = HashSet::new();
+    let mut out = Vec::new();
+    for edge in calls {
+        let key = edge.to_symbol_id.clone().or(edge.to_name.clone());
+        if !seen.insert(key) {
+            continue;
+        }
+        let target = match edge.to_symbol_id.as_deref() {
+            Some(id) => symbols::get_symbol_by_stable_id(conn, project_id, ref_name, id)?,
+            None => None,
+        };
+        let callee = match target {
+            Some(target) => Callee {
+                name: target.name,
+                qualified_name: Some(target.qualified_name),
+                path: Some(target.path),
+                call_line: edge.source_line,
+            },
+            None => Callee {
+                name: edge
+                    .to_name
+                    .or(edge.to_symbol_id)
+                    .unwrap_or_else(|| "?".to_string()),
+                qualified_name: None,
+                path: None,
+                call_line: edge.source_line,
+            },
+        };
+        out.push(callee);
+    }
+    Ok(out)
+}
+
+/// `Trait` from `impl<T> path::Trait<T> for Type<T> {` when `Type` is `name`.
+fn rust_impl_trait(text: &str, name: &str) -> Option<String> {
+    let (trait_name, target) = rust_trait_impl(text)?;
+    (target == name).then(|| trait_name.to_string())
+}
+
+/// `(Trait, Type)` from `impl<T> path::Trait<T> for path::Type<T> {`, both
+/// without their paths and generic arguments.
+pub(crate) fn rust_trait_impl(text: &str) -> Option<(&str, &str)> {
+    let rest = text.strip_prefix("unsafe ").unwrap_or(text);
+    let rest = rest.strip_prefix("impl")?;
+    let rest = if rest.starts_with('<') {
+        let mut depth = 0usize;
+        let close = rest.char_indices().find_map(|(idx, ch)| {
+            match ch {
+                '<' => depth += 1,
+                '>' => {
+                    depth -= 1;
+                    if depth == 0 {
+                        return Some(idx);
+                    }
+                }
+                _ => {}
+            }
+            None
+        })?;
+        &rest[close + 1..]
+    } else {
+        rest.strip_prefix(' ')?
+    };
+    let (trait_part, target) = rest.split_once(" for ")?;
+    let target = target.trim_start().trim_start_matches('&');
+    let target = target
+        .split(|ch: char| !(ch.is_alphanumeric() || ch == '_' || ch == ':'))
+        .next()?
+        .rsplit("::")
+        .next()?;
+    let trait_name = trait_part.trim().trim_start_matches('!');
+    let trait_name = trait_name.split('<').next()?.rsplit("::").next()?.trim();
+    (!trait_name.is_empty() && !target.is_empty()).then_some((trait_name, target))
+}
+
+/// Recent commits touching lines `line_start..=line_end` of `path`, falling
+/// back to commits touching the file. Empty outside a git repository.
+fn symbol_history(
+    workspace: &Path,
+    ref_name: &str,
+    path: &str,
+    line_start: u32,
+    line_end: u32,
+    limit: usize,
+) -> Vec<HistoryEntry> {
+    if limit == 0 || !cruxe_core::vcs::is_git_repo(workspace) {
+        return Vec::new();
+    }
+    let revision = if ref_name == constants::REF_LIVE {
+        "HEAD"
+    } else {
+        ref_name
+    };
+    let git_log = |extra: &[String]| -> Option<Vec<HistoryEntry>> {
+        let output = std::process::Command::new("git")
+            .arg("-C")
+            .arg(workspace)
+            .arg("log")
+            .arg(format!("-n{limit}"))
+            .arg("--no-patch")
+            .arg("--date=short")
+            .arg("--format=%h%x09%an%x09%ad%x09%s")
+            .args(extra)
+            .output()
+            .ok()?;
+        if !output.status.success() {
+            return None;
+        }
+        let stdout = String::from_utf8_lossy(&output.stdout);
+        Some(
+            stdout
+                .lines()
+                .filter_map(|line| {
+                    let mut fields = line.splitn(4, '\t');
+                    Some(HistoryEntry {
+                        commit: fields.next()?.to_string(),
+                        author: fields.next()?.to_string(),
+                        date: fields.next()?.to_string(),
+                        subject: fields.next()?.to_string(),
+                    })
+                })
+                .collect(),
+        )
+    };
+
+    if line_start > 0 {
+        let range = format!("-L{},{}:{}", line_start, line_end.max(line_start), path);
+        if let Some(entries) = git_log(&[range, revision.to_string()]) {
+            return entries;
+        }
+    }
+    git_log(&[revision.to_string(), "--".to_string(), path.to_string()]).unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::manifest::{self, ManifestEntry};
+    use cruxe_state::{db, schema};
+
+    #[test]
+    fn rust_impl_trait_reads_the_implemented_trait() {
+        assert_eq!(
+            rust_impl_trait("impl<T: Clone> fmt::Display for Wrapper<T> {", "Wrapper").as_deref(),
+            Some("Display")
+        );
+        assert_eq!(rust_impl_trait("impl Wrapper {", "Wrapper"), None);
+        assert_eq!(
+            rust_impl_trait("impl From<Wrapper> for Other {", "Wrapper"),
+            None
+        );
+    }
+
+    #[test]
+    fn describe_collects_doc_calls_and_impls() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path();
+        let source = "/// A connection pool.\npub struct Pool;\n\nimpl Default for Pool {\n    fn default() -> Self { Pool }\n}\n\nfn open() -> Pool {\n    Pool::default()\n}\n";
+        std::fs::write(workspace.join("lib.rs"), source).unwrap();
+        manifest::upsert_manifest(
+            &conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "lib.rs".to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: source.len() as u64,
+                mtime_ns: None,
+                language: Some("rust".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+        for (name, kind, line_start, line_end) in [
+            ("Pool", SymbolKind::Struct, 2, 2),
+            ("open", SymbolKind::Function, 8, 10),
+        ] {
+            symbols::insert_symbol(
+                &conn,
+                &SymbolRecord {
+                    repo: "repo".to_string(),
+                    r#ref: "main".to_string(),
+                    commit: None,
+                    path: "lib.rs".to_string(),
+                    language: "rust".to_string(),
+                    symbol_id: format!("sym::{name}"),
+                    symbol_stable_id: format!("stable::{name}"),
+                    name: name.to_string(),
+                    qualified_name: format!("crate::{name}"),
+                    kind,
+                    signature: None,
+                    line_start,
+                    line_end,
+                    parent_symbol_id: None,
+                    visibility: None,
+                    content: None,
+                },
+            )
+            .unwrap();
+        }
+
+        let card = describe_symbol(&conn, workspace, "repo", "main", "Pool", None, 5).unwrap();
+        assert_eq!(card.qualified_name, "crate::Pool");
+        assert_eq!(card.doc.as_deref(), Some("A connection pool."));
+        assert_eq!(
+            card.supertypes,
+            vec![Supertype {
+                name: "Default".to_string(),
+                relation: "implements".to_string(),
+            }]
+        );
+        assert_eq!(card.references, 4);
+        assert!(card.history.is_empty());
+
+        let err = describe_symbol(&conn, workspace, "repo", "main", "crate::missing", None, 5)
+            .unwrap_err();
+        assert!(matches!(err, DescribeError::SymbolNotFound));
+    }
+}
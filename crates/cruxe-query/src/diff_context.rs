@@ -2,11 +2,12 @@ use cruxe_core::error::StateError;
 use cruxe_state::branch_state;
 use cruxe_vcs::{DiffEntry, FileChangeKind, Git2VcsAdapter, VcsAdapter};
 use rusqlite::{Connection, params_from_iter};
+use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::collections::{BTreeSet, HashMap, HashSet};
 use std::path::Path;
 
-#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
 pub struct DiffLineRange {
     pub start: u32,
     pub end: u32,
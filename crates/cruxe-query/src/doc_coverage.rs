@@ -0,0 +1,209 @@
+//! Documentation coverage for `cruxe doc-coverage`: which exported symbols
+//! have no doc comment, per package.
+//!
+//! The exported symbols are those `cruxe api` lists, without struct fields.
+//! Doc comments are read from the working tree with the same extraction the
+//! indexer uses for `cruxe search --docs`.
+
+use crate::api_surface::{self, ApiError};
+use cruxe_indexer::doc_extract::doc_comment;
+use cruxe_indexer::scanner::{PathScope, detect_language};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::path::Path;
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct UndocumentedSymbol {
+    pub kind: String,
+    pub qualified_name: String,
+    pub package: String,
+    pub path: String,
+    pub line: u32,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct PackageCoverage {
+    pub package: String,
+    pub exported: usize,
+    pub documented: usize,
+    /// Percentage of exported symbols with a doc comment.
+    pub coverage: f64,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct DocCoverageReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub exported: usize,
+    pub documented: usize,
+    pub coverage: f64,
+    /// Least documented first.
+    pub packages: Vec<PackageCoverage>,
+    /// In path and line order.
+    pub undocumented: Vec<UndocumentedSymbol>,
+}
+
+impl DocCoverageReport {
+    /// Coverage of the least documented package, or 100 without any.
+    pub fn min_package_coverage(&self) -> f64 {
+        self.packages
+            .iter()
+            .map(|package| package.coverage)
+            .fold(100.0, f64::min)
+    }
+}
+
+/// Doc coverage of the exported symbols of `ref_name`, optionally only
+/// under `path_prefix` and in files in `scope`, with sources read from
+/// `workspace`.
+pub fn doc_coverage(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    path_prefix: Option<&str>,
+    scope: &PathScope,
+) -> Result<DocCoverageReport, ApiError> {
+    let surface = api_surface::extract_api(conn, repo, ref_name, path_prefix)?;
+    let mut sources: HashMap<String, Vec<String>> = HashMap::new();
+    let mut packages: BTreeMap<String, (usize, usize)> = BTreeMap::new();
+    let mut undocumented = Vec::new();
+    for item in surface.items {
+        if item.kind == "field" || !scope.contains(&item.path) {
+            continue;
+        }
+        let source = sources.entry(item.path.clone()).or_insert_with(|| {
+            std::fs::read_to_string(workspace.join(&item.path))
+                .map(|content| content.lines().map(str::to_string).collect())
+                .unwrap_or_default()
+        });
+        let language = detect_language(Path::new(&item.path)).unwrap_or_default();
+        let documented = doc_comment(source.as_slice(), item.line, &language).is_some();
+        let counts = packages.entry(item.package.clone()).or_default();
+        counts.0 += 1;
+        if documented {
+            counts.1 += 1;
+        } else {
+            undocumented.push(UndocumentedSymbol {
+                kind: item.kind,
+                qualified_name: item.qualified_name,
+                package: item.package,
+                path: item.path,
+                line: item.line,
+            });
+        }
+    }
+
+    let mut packages: Vec<PackageCoverage> = packages
+        .into_iter()
+        .map(|(package, (exported, documented))| PackageCoverage {
+            package,
+            exported,
+            documented,
+            coverage: percent(documented, exported),
+        })
+        .collect();
+    packages.sort_by(|a, b| {
+        a.coverage
+            .total_cmp(&b.coverage)
+            .then_with(|| a.package.cmp(&b.package))
+    });
+    let exported = packages.iter().map(|package| package.exported).sum();
+    let documented = packages.iter().map(|package| package.documented).sum();
+    Ok(DocCoverageReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        exported,
+        documented,
+        coverage: percent(documented, exported),
+        packages,
+        undocumented,
+    })
+}
+
+/// `part` of `whole` in percent, rounded to one decimal; 100 for nothing.
+fn percent(part: usize, whole: usize) -> f64 {
+    if whole == 0 {
+        return 100.0;
+    }
+    (part as f64 * 1000.0 / whole as f64).round() / 10.0
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema, symbols};
+
+    fn function(path: &str, name: &str, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{path}::{name}"),
+            symbol_stable_id: format!("stable::{path}::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: Some(format!("func {name}()")),
+            line_start: line,
+            line_end: line,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(format!("func {name}() {{}}")),
+        }
+    }
+
+    #[test]
+    fn reports_undocumented_exported_symbols_per_package() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("workspace");
+        for dir in ["auth", "store"] {
+            std::fs::create_dir_all(workspace.join(dir)).unwrap();
+        }
+        std::fs::write(
+            workspace.join("auth/auth.go"),
+            "package auth\n\n// Validate checks a token.\nfunc Validate() {}\n\nfunc Refresh() {}\n\nfunc helper() {}\n",
+        )
+        .unwrap();
+        std::fs::write(
+            workspace.join("store/store.go"),
+            "package store\n\n// Open opens the store.\nfunc Open() {}\n",
+        )
+        .unwrap();
+
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            function("auth/auth.go", "Validate", 4),
+            function("auth/auth.go", "Refresh", 6),
+            function("auth/auth.go", "helper", 8),
+            function("store/store.go", "Open", 4),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let report = doc_coverage(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            None,
+            &PathScope::default(),
+        )
+        .unwrap();
+        assert_eq!((report.exported, report.documented), (3, 2));
+        assert_eq!(report.coverage, 66.7);
+        assert_eq!(report.packages[0].package, "auth");
+        assert_eq!(report.packages[0].coverage, 50.0);
+        assert_eq!(report.packages[1].coverage, 100.0);
+        assert_eq!(report.min_package_coverage(), 50.0);
+        assert_eq!(report.undocumented.len(), 1);
+        assert_eq!(report.undocumented[0].qualified_name, "Refresh");
+        assert_eq!(report.undocumented[0].line, 6);
+    }
+}
@@ -0,0 +1,595 @@
+//! Duplicated and near-duplicated functions, for `cruxe duplicates`.
+//!
+//! Each function or method body is reduced to a token stream in which
+//! identifiers, strings and numbers become placeholders, so copies with
+//! renamed variables or changed literals still look alike. Token 5-grams
+//! are hashed and winnowed into a fingerprint set per body; bodies whose
+//! sets overlap by at least the similarity threshold (Jaccard) are linked,
+//! and linked bodies form a cluster.
+
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{generated_files, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::hash_map::DefaultHasher;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::hash::{Hash, Hasher};
+
+/// Tokens per hashed n-gram.
+const GRAM: usize = 5;
+/// Consecutive n-gram hashes of which the smallest is kept.
+const WINDOW: usize = 4;
+/// Fingerprints shared by more bodies than this are boilerplate (error
+/// checks, getters) and are not used to pair bodies.
+const MAX_POSTINGS: usize = 64;
+
+/// Words kept as-is when normalizing, across the indexed languages; every
+/// other identifier becomes a placeholder.
+const KEYWORDS: &[&str] = &[
+    "and",
+    "as",
+    "async",
+    "await",
+    "break",
+    "case",
+    "catch",
+    "class",
+    "const",
+    "continue",
+    "def",
+    "default",
+    "defer",
+    "del",
+    "elif",
+    "else",
+    "enum",
+    "except",
+    "false",
+    "False",
+    "finally",
+    "fn",
+    "for",
+    "func",
+    "go",
+    "if",
+    "impl",
+    "import",
+    "in",
+    "interface",
+    "is",
+    "lambda",
+    "let",
+    "loop",
+    "map",
+    "match",
+    "mut",
+    "new",
+    "nil",
+    "None",
+    "not",
+    "null",
+    "or",
+    "pass",
+    "pub",
+    "raise",
+    "range",
+    "return",
+    "select",
+    "self",
+    "static",
+    "struct",
+    "super",
+    "switch",
+    "this",
+    "throw",
+    "true",
+    "True",
+    "try",
+    "type",
+    "typeof",
+    "undefined",
+    "var",
+    "while",
+    "with",
+    "yield",
+];
+
+#[derive(Debug, Clone)]
+pub struct DuplicateOptions {
+    /// Bodies shorter than this many lines are ignored.
+    pub min_lines: u32,
+    /// Bodies with fewer normalized tokens than this are ignored.
+    pub min_tokens: usize,
+    /// Lowest fingerprint similarity, 0.0..=1.0, that links two bodies.
+    pub min_similarity: f64,
+    /// Only bodies under this path prefix.
+    pub path_prefix: Option<String>,
+    /// Only bodies in files in scope.
+    pub scope: PathScope,
+    /// Compare bodies in generated files too.
+    pub include_generated: bool,
+}
+
+impl Default for DuplicateOptions {
+    fn default() -> Self {
+        Self {
+            min_lines: 6,
+            min_tokens: 40,
+            min_similarity: 0.85,
+            path_prefix: None,
+            scope: PathScope::default(),
+            include_generated: false,
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct DuplicateMember {
+    pub qualified_name: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    /// Normalized tokens in the body.
+    pub tokens: usize,
+}
+
+impl DuplicateMember {
+    pub fn lines(&self) -> u32 {
+        self.line_end.saturating_sub(self.line_start) + 1
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct DuplicateCluster {
+    /// Lowest similarity among the pairs that link the cluster, rounded to
+    /// two decimals.
+    pub similarity: f64,
+    /// Every member has the same normalized token stream: a copy that at
+    /// most renames identifiers or changes literals.
+    pub exact: bool,
+    /// Lines in the members beyond the longest one, i.e. what
+    /// consolidating them would remove.
+    pub duplicated_lines: u32,
+    pub members: Vec<DuplicateMember>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct DuplicateReport {
+    pub repo: String,
+    pub ref_name: String,
+    /// Function and method bodies compared.
+    pub functions: usize,
+    pub duplicated_lines: u32,
+    pub clusters: Vec<DuplicateCluster>,
+}
+
+struct Body {
+    member: DuplicateMember,
+    /// Hash of the whole normalized token stream.
+    shape: u64,
+    prints: HashSet<u64>,
+}
+
+/// Cluster the duplicated function and method bodies of `ref_name`, the
+/// ones with the most removable lines first.
+pub fn find_duplicates(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &DuplicateOptions,
+) -> Result<DuplicateReport, StateError> {
+    let generated = if options.include_generated {
+        HashSet::new()
+    } else {
+        generated_files::paths_for_ref(conn, repo, ref_name)?
+    };
+    let mut bodies: Vec<Body> = Vec::new();
+    symbols::for_each_callable_body(conn, repo, ref_name, |symbol| {
+        if options
+            .path_prefix
+            .as_deref()
+            .is_some_and(|prefix| !symbol.path.starts_with(prefix))
+            || !options.scope.contains(&symbol.path)
+            || generated.contains(&symbol.path)
+        {
+            return Ok(());
+        }
+        let Some(content) = symbol.content.as_deref() else {
+            return Ok(());
+        };
+        let tokens = normalized_tokens(&symbol.language, content);
+        let member = DuplicateMember {
+            qualified_name: symbol.qualified_name,
+            kind: symbol.kind.as_str().to_string(),
+            language: symbol.language,
+            path: symbol.path,
+            line_start: symbol.line_start,
+            line_end: symbol.line_end,
+            tokens: tokens.len(),
+        };
+        if member.lines() < options.min_lines || tokens.len() < options.min_tokens.max(GRAM) {
+            return Ok(());
+        }
+        bodies.push(Body {
+            member,
+            shape: hash_of(&tokens),
+            prints: fingerprints(&tokens),
+        });
+        Ok(())
+    })?;
+
+    // Candidate pairs: bodies sharing a fingerprint, or the same shape.
+    let mut postings: HashMap<u64, Vec<usize>> = HashMap::new();
+    for (idx, body) in bodies.iter().enumerate() {
+        for print in &body.prints {
+            postings.entry(*print).or_default().push(idx);
+        }
+    }
+    let mut shared: HashMap<(usize, usize), usize> = HashMap::new();
+    for members in postings.values() {
+        if members.len() < 2 || members.len() > MAX_POSTINGS {
+            continue;
+        }
+        for (pos, &left) in members.iter().enumerate() {
+            for &right in &members[pos + 1..] {
+                *shared.entry((left, right)).or_default() += 1;
+            }
+        }
+    }
+    let mut shapes: HashMap<(&str, u64), Vec<usize>> = HashMap::new();
+    for (idx, body) in bodies.iter().enumerate() {
+        shapes
+            .entry((body.member.language.as_str(), body.shape))
+            .or_default()
+            .push(idx);
+    }
+    for members in shapes.values() {
+        for (pos, &left) in members.iter().enumerate() {
+            for &right in &members[pos + 1..] {
+                shared.entry((left, right)).or_insert(0);
+            }
+        }
+    }
+
+    let mut links: Vec<(usize, usize, f64)> = Vec::new();
+    for ((left, right), common) in shared {
+        let (a, b) = (&bodies[left], &bodies[right]);
+        if a.member.language != b.member.language || nested(&a.member, &b.member) {
+            continue;
+        }
+        let similarity = if a.shape == b.shape {
+            1.0
+        } else {
+            let union = a.prints.len() + b.prints.len() - common;
+            common as f64 / union.max(1) as f64
+        };
+        if similarity >= options.min_similarity {
+            links.push((left, right, similarity));
+        }
+    }
+
+    let mut parent: Vec<usize> = (0..bodies.len()).collect();
+    for &(left, right, _) in &links {
+        let (a, b) = (find(&mut parent, left), find(&mut parent, right));
+        parent[a.max(b)] = a.min(b);
+    }
+    let mut groups: BTreeMap<usize, (Vec<usize>, f64)> = BTreeMap::new();
+    for &(left, _, similarity) in &links {
+        let root = find(&mut parent, left);
+        let group = groups.entry(root).or_insert((Vec::new(), 1.0));
+        group.1 = group.1.min(similarity);
+    }
+    for idx in 0..bodies.len() {
+        let root = find(&mut parent, idx);
+        if let Some(group) = groups.get_mut(&root) {
+            group.0.push(idx);
+        }
+    }
+
+    let mut clusters: Vec<DuplicateCluster> = groups
+        .into_values()
+        .map(|(members, similarity)| {
+            let exact = members
+                .iter()
+                .all(|idx| bodies[*idx].shape == bodies[members[0]].shape);
+            let mut members: Vec<DuplicateMember> = members
+                .into_iter()
+                .map(|idx| bodies[idx].member.clone())
+                .collect();
+            members.sort_by(|a, b| (&a.path, a.line_start).cmp(&(&b.path, b.line_start)));
+            let total: u32 = members.iter().map(DuplicateMember::lines).sum();
+            let longest = members
+                .iter()
+                .map(DuplicateMember::lines)
+                .max()
+                .unwrap_or(0);
+            DuplicateCluster {
+                similarity: (similarity * 100.0).round() / 100.0,
+                exact,
+                duplicated_lines: total - longest,
+                members,
+            }
+        })
+        .collect();
+    clusters.sort_by(|a, b| {
+        b.duplicated_lines.cmp(&a.duplicated_lines).then_with(|| {
+            let first = |cluster: &DuplicateCluster| {
+                cluster
+                    .members
+                    .first()
+                    .map(|member| (member.path.clone(), member.line_start))
+            };
+            first(a).cmp(&first(b))
+        })
+    });
+
+    Ok(DuplicateReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        functions: bodies.len(),
+        duplicated_lines: clusters
+            .iter()
+            .map(|cluster| cluster.duplicated_lines)
+            .sum(),
+        clusters,
+    })
+}
+
+/// A closure or nested function is part of its parent's body, not a copy.
+fn nested(a: &DuplicateMember, b: &DuplicateMember) -> bool {
+    a.path == b.path && a.line_start <= b.line_end && b.line_start <= a.line_end
+}
+
+fn find(parent: &mut [usize], idx: usize) -> usize {
+    let mut root = idx;
+    while parent[root] != root {
+        root = parent[root];
+    }
+    let mut node = idx;
+    while parent[node] != root {
+        let next = parent[node];
+        parent[node] = root;
+        node = next;
+    }
+    root
+}
+
+fn hash_of<T: Hash + ?Sized>(value: &T) -> u64 {
+    let mut hasher = DefaultHasher::new();
+    value.hash(&mut hasher);
+    hasher.finish()
+}
+
+/// Winnowed n-gram hashes: the smallest hash of every window of `WINDOW`
+/// consecutive n-grams, so any copied run of `GRAM + WINDOW - 1` tokens
+/// shares at least one fingerprint.
+fn fingerprints(tokens: &[String]) -> HashSet<u64> {
+    let grams: Vec<u64> = tokens.windows(GRAM).map(hash_of).collect();
+    if grams.len() <= WINDOW {
+        return grams.into_iter().collect();
+    }
+    grams
+        .windows(WINDOW)
+        .filter_map(|window| window.iter().min().copied())
+        .collect()
+}
+
+/// Tokens of a body without comments or whitespace, with identifiers
+/// (other than `KEYWORDS`), strings and numbers replaced by `I`, `S` and
+/// `N`.
+fn normalized_tokens(language: &str, body: &str) -> Vec<String> {
+    let hash_comments = language == "python";
+    let chars: Vec<char> = body.chars().collect();
+    let mut tokens = Vec::new();
+    let mut idx = 0;
+    while idx < chars.len() {
+        let ch = chars[idx];
+        let next = chars.get(idx + 1).copied();
+        if ch.is_whitespace() {
+            idx += 1;
+        } else if (hash_comments && ch == '#') || (!hash_comments && ch == '/' && next == Some('/'))
+        {
+            while idx < chars.len() && chars[idx] != '\n' {
+                idx += 1;
+            }
+        } else if !hash_comments && ch == '/' && next == Some('*') {
+            idx += 2;
+            while idx < chars.len() && !(chars[idx] == '*' && chars.get(idx + 1) == Some(&'/')) {
+                idx += 1;
+            }
+            idx += 2;
+        } else if ch == '"' || ch == '`' || (ch == '\'' && !is_lifetime(language, &chars, idx)) {
+            idx = string_end(&chars, idx);
+            tokens.push("S".to_string());
+        } else if ch.is_ascii_digit() {
+            while idx < chars.len()
+                && (chars[idx].is_alphanumeric() || matches!(chars[idx], '.' | '_'))
+            {
+                idx += 1;
+            }
+            tokens.push("N".to_string());
+        } else if ch.is_alphabetic() || ch == '_' || ch == '$' {
+            let start = idx;
+            while idx < chars.len()
+                && (chars[idx].is_alphanumeric() || chars[idx] == '_' || chars[idx] == '$')
+            {
+                idx += 1;
+            }
+            let word: String = chars[start..idx].iter().collect();
+            if KEYWORDS.contains(&word.as_str()) {
+                tokens.push(word);
+            } else {
+                tokens.push("I".to_string());
+            }
+        } else {
+            tokens.push(ch.to_string());
+            idx += 1;
+        }
+    }
+    tokens
+}
+
+/// `'a` in Rust is a lifetime unless it closes as a char literal (`'a'`,
+/// `'\n'`).
+fn is_lifetime(language: &str, chars: &[char], idx: usize) -> bool {
+    language == "rust" && chars.get(idx + 1) != Some(&'\\') && chars.get(idx + 2) != Some(&'\'')
+}
+
+/// Index just past the string literal opening at `start`, including
+/// Python triple quotes. Unterminated strings end at the line break.
+fn string_end(chars: &[char], start: usize) -> usize {
+    let quote = chars[start];
+    let triple = chars.get(start + 1) == Some(&quote) && chars.get(start + 2) == Some(&quote);
+    let mut idx = start + if triple { 3 } else { 1 };
+    while idx < chars.len() {
+        let ch = chars[idx];
+        if ch == '\\' && quote != '`' {
+            idx += 2;
+            continue;
+        }
+        if triple {
+            if ch == quote
+                && chars.get(idx + 1) == Some(&quote)
+                && chars.get(idx + 2) == Some(&quote)
+            {
+                return idx + 3;
+            }
+        } else if ch == quote {
+            return idx + 1;
+        } else if ch == '\n' && quote != '`' {
+            return idx;
+        }
+        idx += 1;
+    }
+    idx
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    const HANDLER: &str = r#"func HandleUser(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	user, err := store.Find(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(user)
+}"#;
+
+    fn body(name: &str, path: &str, line_start: u32, content: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end: line_start + content.lines().count() as u32 - 1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    #[test]
+    fn clusters_renamed_and_edited_copies() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let renamed = HANDLER
+            .replace("HandleUser", "HandleOrder")
+            .replace("user", "order")
+            .replace("\"id\"", "\"order_id\"");
+        let edited = HANDLER.replace(
+            "\tjson.NewEncoder(w).Encode(user)",
+            "\tw.Header().Set(\"Content-Type\", \"application/json\")\n\tjson.NewEncoder(w).Encode(user)",
+        );
+        let unrelated = "func Sum(values []int) int {\n\ttotal := 0\n\tfor _, v := range values {\n\t\ttotal += v\n\t}\n\tfor i := 0; i < 3; i++ {\n\t\ttotal *= 2\n\t}\n\treturn total\n}";
+        for record in [
+            body("HandleUser", "api/users.go", 10, HANDLER),
+            body("HandleOrder", "api/orders.go", 5, &renamed),
+            body("HandleAdmin", "admin/users.go", 20, &edited),
+            body("Sum", "util/sum.go", 1, unrelated),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let report = find_duplicates(&conn, "repo", "main", &DuplicateOptions::default()).unwrap();
+        assert_eq!(report.functions, 4);
+        assert_eq!(report.clusters.len(), 1);
+        let cluster = &report.clusters[0];
+        let names: Vec<&str> = cluster
+            .members
+            .iter()
+            .map(|member| member.qualified_name.as_str())
+            .collect();
+        assert_eq!(names, ["HandleAdmin", "HandleOrder", "HandleUser"]);
+        assert!(!cluster.exact);
+        assert_eq!(cluster.similarity, 0.89);
+        assert_eq!(cluster.duplicated_lines, 26);
+
+        let exact_only = DuplicateOptions {
+            min_similarity: 1.0,
+            ..DuplicateOptions::default()
+        };
+        let report = find_duplicates(&conn, "repo", "main", &exact_only).unwrap();
+        assert_eq!(report.clusters.len(), 1);
+        assert!(report.clusters[0].exact);
+        assert_eq!(report.clusters[0].members.len(), 2);
+
+        cruxe_state::generated_files::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "admin/users.go",
+            Some("header"),
+        )
+        .unwrap();
+        let report = find_duplicates(&conn, "repo", "main", &DuplicateOptions::default()).unwrap();
+        assert_eq!(report.functions, 3);
+        assert_eq!(report.clusters[0].members.len(), 2);
+        let with_generated = DuplicateOptions {
+            include_generated: true,
+            ..DuplicateOptions::default()
+        };
+        let report = find_duplicates(&conn, "repo", "main", &with_generated).unwrap();
+        assert_eq!(report.clusters[0].members.len(), 3);
+    }
+
+    #[test]
+    fn normalization_ignores_names_literals_and_comments() {
+        let a = normalized_tokens("go", "x := compute(\"a\", 1) // first\n");
+        let b = normalized_tokens("go", "total := compute(\"b\", 42) /* other */\n");
+        assert_eq!(a, b);
+        assert_eq!(a, ["I", ":", "=", "I", "(", "S", ",", "N", ")"]);
+        assert_eq!(
+            normalized_tokens("python", "return f'''a\nb''' # done"),
+            ["return", "I", "S"]
+        );
+        assert_eq!(
+            normalized_tokens("rust", "fn f<'a>(c: char) { '\\n' }"),
+            [
+                "fn", "I", "<", "'", "I", ">", "(", "I", ":", "I", ")", "{", "S", "}"
+            ]
+        );
+    }
+}
@@ -0,0 +1,487 @@
+//! Error propagation for `cruxe errors`: what a Go function does with the
+//! errors of the calls it makes, and where the errors it returns end up.
+//!
+//! Function bodies are classified by [`cruxe_indexer::error_flow`]. From the
+//! symbol, callers are followed through the recorded call edges for as long
+//! as they return the error on; a path ends at the first caller that logs,
+//! handles or drops it. Whether a discarded call returns an error is read
+//! from the signature of an indexed function of that name, or from a list of
+//! standard library calls whose errors are commonly dropped.
+
+use crate::call_graph::{self, CallGraphSymbol, clamp_depth, to_call_graph_symbol};
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_indexer::error_flow::{self, ErrorHandling, FunctionErrors};
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::cell::RefCell;
+use std::collections::{BTreeMap, HashMap, HashSet};
+
+/// Caller levels followed when `--depth` is not given.
+pub const DEFAULT_DEPTH: u32 = 4;
+
+/// Paths reported at most.
+const MAX_PATHS: usize = 200;
+
+/// Standard library calls that return an error.
+const KNOWN_ERROR_CALLS: &[&str] = &[
+    "json.Marshal",
+    "json.MarshalIndent",
+    "json.Unmarshal",
+    "xml.Marshal",
+    "xml.Unmarshal",
+    "io.Copy",
+    "io.ReadAll",
+    "io.WriteString",
+    "os.Chdir",
+    "os.Chmod",
+    "os.Mkdir",
+    "os.MkdirAll",
+    "os.Remove",
+    "os.RemoveAll",
+    "os.Rename",
+    "os.Setenv",
+    "os.WriteFile",
+    "strconv.Atoi",
+    "strconv.ParseBool",
+    "strconv.ParseFloat",
+    "strconv.ParseInt",
+];
+
+/// Methods that return an error on whatever receiver they are called.
+const KNOWN_ERROR_METHODS: &[&str] = &[
+    "Close",
+    "Commit",
+    "Decode",
+    "Encode",
+    "Exec",
+    "ExecContext",
+    "Flush",
+    "Ping",
+    "Rollback",
+    "Scan",
+    "SetDeadline",
+    "SetReadDeadline",
+    "SetWriteDeadline",
+    "Shutdown",
+    "Sync",
+];
+
+#[derive(Debug, thiserror::Error)]
+pub enum ErrorPathError {
+    #[error("symbol not found")]
+    SymbolNotFound,
+    #[error("`{0}` is not a Go function or method")]
+    NotGoFunction(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// A call inside the symbol and what happens to its error.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ErrorSiteResult {
+    pub line: u32,
+    pub callee: String,
+    /// `propagated`, `wrapped`, `flattened`, `logged`, `panicked`,
+    /// `dropped`, `handled`, `swallowed`, `ignored` or `unchecked`.
+    pub handling: String,
+    /// Line of the statement that decided the handling.
+    pub handled_at: u32,
+}
+
+/// A caller on a propagation path and what it does with the error.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ErrorHop {
+    pub function: String,
+    pub path: String,
+    /// Line of the call.
+    pub line: u32,
+    pub handling: String,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ErrorPath {
+    /// Direct caller first.
+    pub hops: Vec<ErrorHop>,
+    /// Handling of the last hop when it stops the error; `no_callers`,
+    /// `depth_limit` or `cycle` when the error is still being returned.
+    pub end: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ErrorReport {
+    pub symbol: CallGraphSymbol,
+    pub returns_error: bool,
+    /// Calls inside the symbol whose errors it receives, in line order.
+    pub sites: Vec<ErrorSiteResult>,
+    /// Where the errors the symbol returns end up.
+    pub paths: Vec<ErrorPath>,
+    /// Paths per `end`.
+    pub ends: BTreeMap<String, usize>,
+    pub truncated: bool,
+    pub depth_applied: u32,
+}
+
+/// Error sites of `symbol_name` and the caller paths its errors take.
+pub fn error_paths(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    symbol_name: &str,
+    path: Option<&str>,
+    depth: u32,
+) -> Result<ErrorReport, ErrorPathError> {
+    let root = call_graph::resolve_root_symbol(conn, repo, ref_name, symbol_name, path)?
+        .ok_or(ErrorPathError::SymbolNotFound)?;
+    if root.language != "go" || !matches!(root.kind, SymbolKind::Function | SymbolKind::Method) {
+        return Err(ErrorPathError::NotGoFunction(root.qualified_name));
+    }
+    let functions = GoFunctions::load(conn, repo, ref_name)?;
+    // Skeleton indexes keep no bodies: the symbol then has no sites, but
+    // its signature still tells whether it returns an error.
+    let root = functions
+        .get(&root.symbol_stable_id)
+        .cloned()
+        .unwrap_or(root);
+    let analysis = functions.analyze(&root);
+    let returns_error = analysis.returns_error
+        || root
+            .signature
+            .as_deref()
+            .is_some_and(error_flow::signature_returns_error);
+
+    let mut walk = PathWalk {
+        conn,
+        repo,
+        ref_name,
+        functions: &functions,
+        depth_limit: clamp_depth(depth),
+        paths: Vec::new(),
+        truncated: false,
+    };
+    if returns_error {
+        walk.follow(
+            &root,
+            &mut Vec::new(),
+            &mut HashSet::from([root.symbol_stable_id.clone()]),
+        )?;
+    }
+    let paths = walk.paths;
+    let mut ends = BTreeMap::new();
+    for path in &paths {
+        *ends.entry(path.end.clone()).or_default() += 1;
+    }
+    Ok(ErrorReport {
+        symbol: to_call_graph_symbol(&root),
+        returns_error,
+        sites: analysis
+            .sites
+            .into_iter()
+            .map(|site| ErrorSiteResult {
+                line: site.line,
+                callee: site.callee,
+                handling: site.handling.as_str().to_string(),
+                handled_at: site.handled_at,
+            })
+            .collect(),
+        paths,
+        ends,
+        truncated: walk.truncated,
+        depth_applied: walk.depth_limit,
+    })
+}
+
+/// The Go functions of a ref with their bodies, and which names return an
+/// error.
+struct GoFunctions {
+    by_id: HashMap<String, SymbolRecord>,
+    error_names: HashSet<String>,
+    analyzed: RefCell<HashMap<String, FunctionErrors>>,
+}
+
+impl GoFunctions {
+    fn load(conn: &Connection, repo: &str, ref_name: &str) -> Result<Self, StateError> {
+        let mut by_id = HashMap::new();
+        let mut error_names = HashSet::new();
+        symbols::for_each_function_body(conn, repo, ref_name, "go", |symbol| {
+            if symbol
+                .signature
+                .as_deref()
+                .is_some_and(error_flow::signature_returns_error)
+            {
+                error_names.insert(symbol.name.clone());
+            }
+            by_id.insert(symbol.symbol_stable_id.clone(), symbol);
+            Ok(())
+        })?;
+        Ok(Self {
+            by_id,
+            error_names,
+            analyzed: RefCell::new(HashMap::new()),
+        })
+    }
+
+    fn get(&self, id: &str) -> Option<&SymbolRecord> {
+        self.by_id
+            .get(id)
+            .or_else(|| self.by_id.values().find(|symbol| symbol.symbol_id == id))
+    }
+
+    fn analyze(&self, symbol: &SymbolRecord) -> FunctionErrors {
+        if let Some(analysis) = self.analyzed.borrow().get(&symbol.symbol_stable_id) {
+            return analysis.clone();
+        }
+        let calls_error = |callee: &str| {
+            let method = callee.rsplit('.').next().unwrap_or(callee);
+            KNOWN_ERROR_CALLS.contains(&callee)
+                || (callee.contains('.') && KNOWN_ERROR_METHODS.contains(&method))
+                || self.error_names.contains(method)
+        };
+        let analysis = symbol
+            .content
+            .as_deref()
+            .map_or_else(FunctionErrors::default, |content| {
+                error_flow::go_function_errors(content, symbol.line_start, &calls_error)
+            });
+        self.analyzed
+            .borrow_mut()
+            .insert(symbol.symbol_stable_id.clone(), analysis.clone());
+        analysis
+    }
+}
+
+struct PathWalk<'a> {
+    conn: &'a Connection,
+    repo: &'a str,
+    ref_name: &'a str,
+    functions: &'a GoFunctions,
+    depth_limit: u32,
+    paths: Vec<ErrorPath>,
+    truncated: bool,
+}
+
+impl PathWalk<'_> {
+    /// Extend `hops` with every caller of `callee`, recording a path where
+    /// the error stops.
+    fn follow(
+        &mut self,
+        callee: &SymbolRecord,
+        hops: &mut Vec<ErrorHop>,
+        on_path: &mut HashSet<String>,
+    ) -> Result<(), StateError> {
+        let functions = self.functions;
+        let callers = edges::get_callers(
+            self.conn,
+            self.repo,
+            self.ref_name,
+            &callee.symbol_stable_id,
+        )?;
+        let mut seen = HashSet::new();
+        let mut any = false;
+        for edge in callers {
+            let Some(caller) = functions.get(&edge.from_symbol_id) else {
+                continue;
+            };
+            if !seen.insert((caller.symbol_stable_id.clone(), edge.source_line)) {
+                continue;
+            }
+            if self.paths.len() >= MAX_PATHS {
+                self.truncated = true;
+                return Ok(());
+            }
+            any = true;
+            let handling = self.handling_at(caller, &callee.name, edge.source_line);
+            hops.push(ErrorHop {
+                function: caller.qualified_name.clone(),
+                path: caller.path.clone(),
+                line: edge.source_line,
+                handling: handling.as_str().to_string(),
+            });
+            if !handling.propagates() {
+                self.record(hops, handling.as_str());
+            } else if on_path.contains(&caller.symbol_stable_id) {
+                self.record(hops, "cycle");
+            } else if hops.len() as u32 >= self.depth_limit {
+                self.record(hops, "depth_limit");
+            } else {
+                on_path.insert(caller.symbol_stable_id.clone());
+                self.follow(caller, hops, on_path)?;
+                on_path.remove(&caller.symbol_stable_id);
+            }
+            hops.pop();
+        }
+        if !any && !hops.is_empty() {
+            self.record(hops, "no_callers");
+        }
+        Ok(())
+    }
+
+    fn record(&mut self, hops: &[ErrorHop], end: &str) {
+        self.paths.push(ErrorPath {
+            hops: hops.to_vec(),
+            end: end.to_string(),
+        });
+    }
+
+    /// What `caller` does with the error of its call to `name` on `line`. A
+    /// call used inside an expression (`if f() != nil`) counts as handled.
+    fn handling_at(&self, caller: &SymbolRecord, name: &str, line: u32) -> ErrorHandling {
+        let analysis = self.functions.analyze(caller);
+        let on_line: Vec<_> = analysis
+            .sites
+            .iter()
+            .filter(|site| site.line == line)
+            .collect();
+        on_line
+            .iter()
+            .find(|site| site.callee.rsplit('.').next() == Some(name))
+            .or(on_line.first())
+            .map_or(ErrorHandling::Handled, |site| site.handling)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::{db, schema};
+
+    const SOURCE: &str = r#"package app
+
+func load(path string) (*Config, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	return parse(data)
+}
+
+func Start(path string) error {
+	cfg, err := load(path)
+	if err != nil {
+		return err
+	}
+	_ = cfg
+	return nil
+}
+
+func main() {
+	if err := Start("app.toml"); err != nil {
+		log.Printf("start: %v", err)
+	}
+	body, _ := json.Marshal(cfg)
+	load("fallback.toml")
+}
+"#;
+
+    fn function(name: &str, signature: &str) -> SymbolRecord {
+        let lines: Vec<&str> = SOURCE.lines().collect();
+        let start = lines
+            .iter()
+            .position(|line| line.starts_with(&format!("func {name}(")))
+            .unwrap();
+        let end = start + lines[start..].iter().position(|line| *line == "}").unwrap();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "app/app.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("app.{name}"),
+            kind: SymbolKind::Function,
+            signature: Some(signature.to_string()),
+            line_start: start as u32 + 1,
+            line_end: end as u32 + 1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(lines[start..=end].join("\n")),
+        }
+    }
+
+    fn call(from: &str, to: &str, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: Some(format!("stable::{to}")),
+            to_name: Some(to.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: "app/app.go".to_string(),
+            source_line: line,
+        }
+    }
+
+    #[test]
+    fn follows_returned_errors_to_where_they_stop() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            function("load", "func load(path string) (*Config, error)"),
+            function("Start", "func Start(path string) error"),
+            function("main", "func main()"),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("Start", "load", 12),
+                call("main", "Start", 21),
+                call("main", "load", 25),
+            ],
+        )
+        .unwrap();
+
+        let report = error_paths(&conn, "repo", "main", "load", None, DEFAULT_DEPTH).unwrap();
+        assert!(report.returns_error);
+        let sites: Vec<(u32, &str, &str)> = report
+            .sites
+            .iter()
+            .map(|site| (site.line, site.callee.as_str(), site.handling.as_str()))
+            .collect();
+        assert_eq!(sites, [(4, "read", "wrapped"), (8, "parse", "propagated")]);
+
+        let paths: Vec<(Vec<(&str, u32, &str)>, &str)> = report
+            .paths
+            .iter()
+            .map(|path| {
+                (
+                    path.hops
+                        .iter()
+                        .map(|hop| (hop.function.as_str(), hop.line, hop.handling.as_str()))
+                        .collect(),
+                    path.end.as_str(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            paths,
+            [
+                (
+                    vec![("app.Start", 12, "propagated"), ("app.main", 21, "logged")],
+                    "logged"
+                ),
+                (vec![("app.main", 25, "ignored")], "ignored"),
+            ]
+        );
+        assert_eq!(report.ends["logged"], 1);
+
+        let main = error_paths(&conn, "repo", "main", "main", None, DEFAULT_DEPTH).unwrap();
+        assert!(!main.returns_error);
+        assert!(main.paths.is_empty());
+        assert!(
+            main.sites
+                .iter()
+                .any(|site| site.callee == "json.Marshal" && site.handling == "swallowed")
+        );
+    }
+}
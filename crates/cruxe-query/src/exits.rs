@@ -0,0 +1,496 @@
+//! Process exits for `cruxe exits`: which Go functions can end up calling
+//! `os.Exit`, a `Fatal` logger or an unrecovered `panic`, and through which
+//! calls.
+//!
+//! Exit calls are read from the stored function bodies by
+//! [`cruxe_indexer::exit_calls`]. From every function making one, the
+//! recorded call edges are followed backwards, so each function that can
+//! reach an exit gets its shortest call path to one. Panics stop at callers
+//! that defer a recover. Paths start from the functions in scope: those
+//! matching `--from`, or by default every function outside `main` packages,
+//! which are the ones allowed to decide that the process is done. Test files
+//! are left out.
+
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_indexer::exit_calls::{self, ExitKind};
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{edges, symbols};
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet, VecDeque};
+
+#[derive(Debug, thiserror::Error)]
+pub enum ExitError {
+    #[error("invalid --from pattern {0}")]
+    InvalidPattern(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ExitSite {
+    pub function: String,
+    pub path: String,
+    pub line: u32,
+    /// The called expression, e.g. `log.Fatalf` or `panic`.
+    pub call: String,
+    /// `exit` or `panic`.
+    pub kind: String,
+    /// Made inside a `go func() { ... }()` literal.
+    pub in_goroutine: bool,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ExitHop {
+    pub function: String,
+    pub path: String,
+    /// Line of the call to the next hop, or of the exit call on the last.
+    pub line: u32,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ExitPath {
+    /// `exit` or `panic`.
+    pub kind: String,
+    /// The function in scope first, the one making the exit call last.
+    pub hops: Vec<ExitHop>,
+    pub site: ExitSite,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ExitReport {
+    pub repo: String,
+    pub ref_name: String,
+    /// Functions the paths start from.
+    pub scope: usize,
+    /// Every exit call outside tests, in path and line order.
+    pub sites: Vec<ExitSite>,
+    /// The shortest path of each function in scope to an exit and to a
+    /// panic, when it has one.
+    pub paths: Vec<ExitPath>,
+}
+
+impl ExitReport {
+    /// Paths of one kind, `exit` or `panic`.
+    pub fn count(&self, kind: &str) -> usize {
+        self.paths.iter().filter(|path| path.kind == kind).count()
+    }
+}
+
+/// Call paths from the Go functions in scope to exit calls on `ref_name`.
+/// `from` holds path globs; empty means every function outside `main`
+/// packages. Paths start, and exit calls are listed, only in files in
+/// `files`; the calls in between may lie anywhere.
+pub fn find_exits(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    from: &[String],
+    files: &PathScope,
+) -> Result<ExitReport, ExitError> {
+    let from = glob_set(from)?;
+    let mut functions = Vec::new();
+    symbols::for_each_function_body(conn, repo, ref_name, "go", |symbol| {
+        if !symbol.path.ends_with("_test.go") {
+            functions.push(Function::new(symbol));
+        }
+        Ok(())
+    })?;
+
+    let mut index = HashMap::new();
+    for (at, function) in functions.iter().enumerate() {
+        index.entry(function.symbol_id.clone()).or_insert(at);
+        index.insert(function.stable_id.clone(), at);
+    }
+    let mut callers: HashMap<usize, Vec<(usize, u32)>> = HashMap::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        if edge.edge_type != "calls" {
+            return Ok(());
+        }
+        let caller = index.get(&edge.from_symbol_id);
+        let callee = edge.to_symbol_id.as_ref().and_then(|id| index.get(id));
+        if let (Some(&caller), Some(&callee)) = (caller, callee)
+            && caller != callee
+        {
+            callers
+                .entry(callee)
+                .or_default()
+                .push((caller, edge.source_line));
+        }
+        Ok(())
+    })?;
+    for list in callers.values_mut() {
+        list.sort_unstable();
+        list.dedup_by_key(|(caller, _)| *caller);
+    }
+
+    let main_packages: HashSet<&str> = functions
+        .iter()
+        .filter(|function| function.is_main)
+        .map(|function| directory(&function.path))
+        .collect();
+    let in_scope: Vec<usize> = (0..functions.len())
+        .filter(|&at| {
+            let path = &functions[at].path;
+            files.contains(path)
+                && match &from {
+                    Some(from) => from.is_match(path),
+                    None => !main_packages.contains(directory(path)),
+                }
+        })
+        .collect();
+
+    let mut paths = Vec::new();
+    for kind in [ExitKind::Exit, ExitKind::Panic] {
+        let steps = shortest_steps(&functions, &callers, kind);
+        for &start in &in_scope {
+            if steps.contains_key(&start) {
+                paths.push(exit_path(&functions, &steps, start, kind));
+            }
+        }
+    }
+
+    let sites = functions
+        .iter()
+        .filter(|function| files.contains(&function.path))
+        .flat_map(|function| {
+            function
+                .exits
+                .iter()
+                .map(|call| function.site(call))
+                .collect::<Vec<_>>()
+        })
+        .collect();
+    Ok(ExitReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        scope: in_scope.len(),
+        sites,
+        paths,
+    })
+}
+
+/// A Go function with its exit calls; the body itself is not kept.
+struct Function {
+    symbol_id: String,
+    stable_id: String,
+    qualified_name: String,
+    path: String,
+    /// A receiverless `main`, marking its directory as a `main` package.
+    is_main: bool,
+    exits: Vec<exit_calls::ExitCall>,
+    recovers: bool,
+}
+
+impl Function {
+    fn new(symbol: SymbolRecord) -> Self {
+        let analysis = symbol
+            .content
+            .as_deref()
+            .map(|content| exit_calls::go_function_exits(content, symbol.line_start))
+            .unwrap_or_default();
+        Self {
+            is_main: symbol.kind == SymbolKind::Function && symbol.name == "main",
+            symbol_id: symbol.symbol_id,
+            stable_id: symbol.symbol_stable_id,
+            qualified_name: symbol.qualified_name,
+            path: symbol.path,
+            exits: analysis.calls,
+            recovers: analysis.recovers,
+        }
+    }
+
+    fn site(&self, call: &exit_calls::ExitCall) -> ExitSite {
+        ExitSite {
+            function: self.qualified_name.clone(),
+            path: self.path.clone(),
+            line: call.line,
+            call: call.call.clone(),
+            kind: call.kind.as_str().to_string(),
+            in_goroutine: call.in_goroutine,
+        }
+    }
+
+    fn first_exit(&self, kind: ExitKind) -> Option<&exit_calls::ExitCall> {
+        self.exits.iter().find(|call| call.kind == kind)
+    }
+}
+
+/// How a function reaches an exit: by making the call itself, or by
+/// calling a function closer to one.
+#[derive(Debug, Clone, Copy)]
+enum Step {
+    Exit,
+    Call { callee: usize, line: u32 },
+}
+
+/// Breadth-first from every function making a `kind` exit call, up through
+/// the callers, so each reached function keeps its first step on a
+/// shortest path.
+fn shortest_steps(
+    functions: &[Function],
+    callers: &HashMap<usize, Vec<(usize, u32)>>,
+    kind: ExitKind,
+) -> HashMap<usize, Step> {
+    let mut steps = HashMap::new();
+    let mut queue = VecDeque::new();
+    for (at, function) in functions.iter().enumerate() {
+        if function.first_exit(kind).is_some() {
+            steps.insert(at, Step::Exit);
+            queue.push_back(at);
+        }
+    }
+    while let Some(callee) = queue.pop_front() {
+        for &(caller, line) in callers.get(&callee).into_iter().flatten() {
+            if kind == ExitKind::Panic && functions[caller].recovers {
+                continue;
+            }
+            if steps.contains_key(&caller) {
+                continue;
+            }
+            steps.insert(caller, Step::Call { callee, line });
+            queue.push_back(caller);
+        }
+    }
+    steps
+}
+
+fn exit_path(
+    functions: &[Function],
+    steps: &HashMap<usize, Step>,
+    start: usize,
+    kind: ExitKind,
+) -> ExitPath {
+    let mut hops = Vec::new();
+    let mut at = start;
+    loop {
+        let function = &functions[at];
+        match steps[&at] {
+            Step::Call { callee, line } => {
+                hops.push(hop(function, line));
+                at = callee;
+            }
+            Step::Exit => {
+                let call = function.first_exit(kind).expect("exit step has a call");
+                hops.push(hop(function, call.line));
+                return ExitPath {
+                    kind: kind.as_str().to_string(),
+                    hops,
+                    site: function.site(call),
+                };
+            }
+        }
+    }
+}
+
+fn hop(function: &Function, line: u32) -> ExitHop {
+    ExitHop {
+        function: function.qualified_name.clone(),
+        path: function.path.clone(),
+        line,
+    }
+}
+
+fn directory(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+fn glob_set(patterns: &[String]) -> Result<Option<GlobSet>, ExitError> {
+    if patterns.is_empty() {
+        return Ok(None);
+    }
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        let glob = GlobBuilder::new(pattern)
+            .build()
+            .map_err(|err| ExitError::InvalidPattern(format!("`{pattern}`: {err}")))?;
+        builder.add(glob);
+    }
+    builder
+        .build()
+        .map(Some)
+        .map_err(|err| ExitError::InvalidPattern(err.to_string()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::{db, schema};
+
+    fn function(path: &str, name: &str, content: &str) -> SymbolRecord {
+        let package = directory(path).rsplit('/').next().unwrap_or_default();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("{package}.{name}"),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: 10,
+            line_end: 10 + content.lines().count() as u32,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    fn call(from: &str, to: &str, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: Some(format!("stable::{to}")),
+            to_name: Some(to.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: String::new(),
+            source_line: line,
+        }
+    }
+
+    fn routes(report: &ExitReport) -> Vec<(&str, Vec<&str>, &str)> {
+        report
+            .paths
+            .iter()
+            .map(|path| {
+                (
+                    path.kind.as_str(),
+                    path.hops.iter().map(|hop| hop.function.as_str()).collect(),
+                    path.site.call.as_str(),
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn finds_shortest_paths_from_library_code_to_exits() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            function(
+                "cmd/app/main.go",
+                "main",
+                "func main() {\n\tif err := api.Serve(); err != nil {\n\t\tlog.Fatalf(\"serve: %v\", err)\n\t}\n}",
+            ),
+            function(
+                "api/server.go",
+                "Serve",
+                "func Serve() error {\n\treturn handle()\n}",
+            ),
+            function(
+                "api/handle.go",
+                "handle",
+                "func handle() error {\n\tcfg := mustConfig()\n\treturn store.Save(cfg)\n}",
+            ),
+            function(
+                "api/guard.go",
+                "Guarded",
+                "func Guarded() {\n\tdefer func() { recover() }()\n\tmustConfig()\n}",
+            ),
+            function(
+                "store/config.go",
+                "mustConfig",
+                "func mustConfig() Config {\n\tcfg, err := read()\n\tif err != nil {\n\t\tpanic(err)\n\t}\n\treturn cfg\n}",
+            ),
+            function(
+                "store/save.go",
+                "Save",
+                "func Save(cfg Config) error {\n\tif cfg.Broken {\n\t\tos.Exit(2)\n\t}\n\treturn nil\n}",
+            ),
+            function(
+                "store/save_test.go",
+                "TestSave",
+                "func TestSave(t *testing.T) {\n\tpanic(\"unreachable\")\n}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("main", "Serve", 11),
+                call("Serve", "handle", 11),
+                call("handle", "mustConfig", 11),
+                call("handle", "Save", 12),
+                call("Guarded", "mustConfig", 12),
+            ],
+        )
+        .unwrap();
+
+        let report = find_exits(&conn, "repo", "main", &[], &PathScope::default()).unwrap();
+        let sites: Vec<(&str, u32, &str)> = report
+            .sites
+            .iter()
+            .map(|site| (site.function.as_str(), site.line, site.call.as_str()))
+            .collect();
+        assert_eq!(
+            sites,
+            [
+                ("app.main", 12, "log.Fatalf"),
+                ("store.mustConfig", 13, "panic"),
+                ("store.Save", 12, "os.Exit"),
+            ]
+        );
+        assert_eq!(report.scope, 5);
+        assert_eq!(
+            routes(&report),
+            [
+                ("exit", vec!["api.handle", "store.Save"], "os.Exit"),
+                (
+                    "exit",
+                    vec!["api.Serve", "api.handle", "store.Save"],
+                    "os.Exit"
+                ),
+                ("exit", vec!["store.Save"], "os.Exit"),
+                ("panic", vec!["api.handle", "store.mustConfig"], "panic"),
+                (
+                    "panic",
+                    vec!["api.Serve", "api.handle", "store.mustConfig"],
+                    "panic"
+                ),
+                ("panic", vec!["store.mustConfig"], "panic"),
+            ]
+        );
+        assert_eq!(report.count("exit"), 3);
+
+        let from_main = find_exits(
+            &conn,
+            "repo",
+            "main",
+            &["cmd/**".to_string()],
+            &PathScope::default(),
+        )
+        .unwrap();
+        assert_eq!(from_main.scope, 1);
+        assert_eq!(
+            from_main.paths[0]
+                .hops
+                .iter()
+                .map(|hop| (hop.function.as_str(), hop.line))
+                .collect::<Vec<_>>(),
+            [("app.main", 12)]
+        );
+        assert!(matches!(
+            find_exits(
+                &conn,
+                "repo",
+                "main",
+                &["[".to_string()],
+                &PathScope::default()
+            ),
+            Err(ExitError::InvalidPattern(_))
+        ));
+    }
+}
@@ -0,0 +1,560 @@
+//! EXPLAIN for queries: what a search or call-graph traversal would do,
+//! computed without executing it.
+//!
+//! Search explains report the classified intent, which indices are scanned
+//! with what weight and how many documents each holds in scope, and the
+//! adaptive plans (with their fan-out and latency budgets) the query can end
+//! up on. Lexical confidence is only known after the lexical pass, so every
+//! plan reachable for the intent is listed with the confidence band that
+//! selects it.
+//!
+//! Call-graph explains walk the edge table by id only, level by level, to
+//! estimate how many symbols and edges each depth adds and whether the result
+//! limit would cut the traversal short.
+
+use crate::adaptive_plan::{PlanController, PlanSelectionInput, plan_budget};
+use crate::call_graph::{
+    CallGraphDirection, CallGraphError, CallGraphRequest, MAX_CALL_GRAPH_DEPTH, clamp_depth,
+    resolve_root_symbol,
+};
+use crate::intent::{IntentPolicy, classify_intent_with_policy};
+use crate::planner::build_plan_with_ref;
+use cruxe_core::config::SearchConfig;
+use cruxe_core::error::StateError;
+use cruxe_core::types::{QueryIntent, RefScope, SemanticMode};
+use cruxe_state::edges;
+use cruxe_state::tantivy_index::IndexSet;
+use rusqlite::Connection;
+use serde::Serialize;
+use std::collections::HashSet;
+use tantivy::Term;
+use tantivy::collector::Count;
+use tantivy::query::{AllQuery, BooleanQuery, Occur, Query, TermQuery};
+use tantivy::schema::IndexRecordOption;
+
+/// One tantivy index as the search would use it.
+#[derive(Debug, Clone, Serialize)]
+pub struct IndexScan {
+    pub index: &'static str,
+    pub used: bool,
+    /// RRF weight of this index's hits; 0 when unused.
+    pub weight: f32,
+    /// Documents matching the ref/language filters.
+    pub documents: u64,
+    /// Top hits fetched from the index before fusion.
+    pub fetch_limit: usize,
+}
+
+/// An adaptive plan the search can execute, with its budget.
+#[derive(Debug, Clone, Serialize)]
+pub struct PlanCandidate {
+    pub plan: &'static str,
+    pub reason: &'static str,
+    /// Lexical confidence band that leads to this plan.
+    pub when: String,
+    pub semantic_limit: usize,
+    pub lexical_fanout: usize,
+    pub semantic_fanout: usize,
+    pub latency_budget_ms: u64,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct SearchExplain {
+    pub query: String,
+    pub ref_name: String,
+    pub language: Option<String>,
+    pub intent: QueryIntent,
+    pub intent_confidence: f64,
+    pub limit: usize,
+    pub semantic_runtime_available: bool,
+    pub indexes: Vec<IndexScan>,
+    pub plans: Vec<PlanCandidate>,
+}
+
+/// Explain `search_code` for the same arguments without running it.
+pub fn explain_search(
+    index_set: &IndexSet,
+    conn: Option<&Connection>,
+    query: &str,
+    r#ref: Option<&str>,
+    language: Option<&str>,
+    limit: usize,
+    search_config: &SearchConfig,
+) -> Result<SearchExplain, StateError> {
+    let intent = classify_intent_with_policy(query, &IntentPolicy::from(&search_config.intent));
+    let ref_scope = match r#ref {
+        Some(explicit) => RefScope::explicit(explicit),
+        None => RefScope::live(),
+    };
+    let plan = build_plan_with_ref(intent.intent, ref_scope);
+    let ref_name = plan.ref_scope.r#ref.clone();
+
+    let mut indexes = Vec::new();
+    for (name, index, used, weight) in [
+        (
+            "symbols",
+            &index_set.symbols,
+            plan.search_symbols,
+            plan.symbol_weight,
+        ),
+        (
+            "snippets",
+            &index_set.snippets,
+            plan.search_snippets,
+            plan.snippet_weight,
+        ),
+        (
+            "files",
+            &index_set.files,
+            plan.search_files,
+            plan.file_weight,
+        ),
+    ] {
+        indexes.push(IndexScan {
+            index: name,
+            used,
+            weight: if used { weight } else { 0.0 },
+            documents: count_in_scope(index, &ref_name, language)?,
+            fetch_limit: if used { limit } else { 0 },
+        });
+    }
+
+    let semantic_runtime_available = conn.is_some()
+        && search_config.semantic_enabled()
+        && search_config.semantic_mode_typed() == SemanticMode::Hybrid;
+
+    Ok(SearchExplain {
+        query: query.to_string(),
+        ref_name,
+        language: language.map(str::to_string),
+        intent: intent.intent,
+        intent_confidence: intent.confidence,
+        limit,
+        semantic_runtime_available,
+        indexes,
+        plans: candidate_plans(
+            intent.intent,
+            semantic_runtime_available,
+            limit,
+            search_config,
+        ),
+    })
+}
+
+/// Plans selected across the lexical confidence range, one entry per band
+/// unless every band lands on the same plan.
+fn candidate_plans(
+    intent: QueryIntent,
+    semantic_runtime_available: bool,
+    limit: usize,
+    search_config: &SearchConfig,
+) -> Vec<PlanCandidate> {
+    let adaptive = &search_config.adaptive_plan;
+    let high = adaptive.high_confidence_threshold;
+    let low = adaptive.low_confidence_threshold;
+    let bands = [
+        (high, format!("lexical confidence >= {high:.2}")),
+        (
+            (high + low) / 2.0,
+            format!("lexical confidence in [{low:.2}, {high:.2})"),
+        ),
+        (0.0, format!("lexical confidence < {low:.2}")),
+    ];
+
+    let mut plans: Vec<PlanCandidate> = bands
+        .into_iter()
+        .map(|(confidence, when)| {
+            let controller = PlanController::preview(PlanSelectionInput {
+                intent,
+                lexical_confidence: confidence,
+                semantic_runtime_available,
+                override_plan: None,
+                config: adaptive,
+            });
+            let budget = plan_budget(controller.executed, limit, search_config);
+            PlanCandidate {
+                plan: controller.executed.as_str(),
+                reason: controller.selection_reason.as_str(),
+                when,
+                semantic_limit: budget.semantic_limit,
+                lexical_fanout: budget.lexical_fanout,
+                semantic_fanout: budget.semantic_fanout,
+                latency_budget_ms: budget.latency_budget_ms,
+            }
+        })
+        .collect();
+    if plans
+        .iter()
+        .all(|candidate| candidate.plan == plans[0].plan && candidate.reason == plans[0].reason)
+    {
+        plans.truncate(1);
+        plans[0].when = "any lexical confidence".to_string();
+    }
+    plans
+}
+
+fn count_in_scope(
+    index: &tantivy::Index,
+    ref_name: &str,
+    language: Option<&str>,
+) -> Result<u64, StateError> {
+    let schema = index.schema();
+    let mut clauses: Vec<(Occur, Box<dyn Query>)> = Vec::new();
+    if let Ok(field) = schema.get_field("ref") {
+        clauses.push((
+            Occur::Must,
+            Box::new(TermQuery::new(
+                Term::from_field_text(field, ref_name),
+                IndexRecordOption::Basic,
+            )),
+        ));
+    }
+    if let Some(lang) = language
+        && let Ok(field) = schema.get_field("language")
+    {
+        clauses.push((
+            Occur::Must,
+            Box::new(TermQuery::new(
+                Term::from_field_text(field, lang),
+                IndexRecordOption::Basic,
+            )),
+        ));
+    }
+    let query: Box<dyn Query> = if clauses.is_empty() {
+        Box::new(AllQuery)
+    } else {
+        Box::new(BooleanQuery::new(clauses))
+    };
+
+    let reader = index.reader().map_err(StateError::tantivy)?;
+    let count = reader
+        .searcher()
+        .search(&query, &Count)
+        .map_err(StateError::tantivy)?;
+    Ok(count as u64)
+}
+
+/// Symbols and edges a traversal reaches at one depth.
+#[derive(Debug, Clone, Serialize, PartialEq, Eq)]
+pub struct TraversalLevel {
+    pub depth: u32,
+    /// Symbols expanded at this depth.
+    pub frontier: usize,
+    /// Call edges leaving the frontier in the traversal direction.
+    pub edges: usize,
+    /// Symbols first reached through those edges.
+    pub new_symbols: usize,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct DirectionExplain {
+    pub direction: &'static str,
+    pub levels: Vec<TraversalLevel>,
+    pub estimated_edges: usize,
+    /// The result limit is reached before the depth limit.
+    pub truncated_by_limit: bool,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct CallGraphExplain {
+    pub symbol: String,
+    pub qualified_name: String,
+    pub path: String,
+    pub depth_requested: u32,
+    pub depth_applied: u32,
+    pub max_depth: u32,
+    pub limit: usize,
+    pub directions: Vec<DirectionExplain>,
+}
+
+/// Explain `get_call_graph` for `request` without resolving the edges.
+///
+/// Edge targets are followed by raw id, so unresolved callees and duplicate
+/// call sites are counted; the estimate is an upper bound on what the
+/// traversal emits.
+pub fn explain_call_graph(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    request: &CallGraphRequest<'_>,
+) -> Result<CallGraphExplain, CallGraphError> {
+    let root = resolve_root_symbol(conn, repo, ref_name, request.symbol_name, request.path)?
+        .ok_or(CallGraphError::SymbolNotFound)?;
+    let depth_applied = clamp_depth(request.depth);
+    let limit = request.limit.max(1);
+
+    let mut directions = Vec::new();
+    if matches!(
+        request.direction,
+        CallGraphDirection::Callers | CallGraphDirection::Both
+    ) {
+        directions.push(estimate_direction(
+            conn,
+            repo,
+            ref_name,
+            &root.symbol_stable_id,
+            depth_applied,
+            limit,
+            true,
+        )?);
+    }
+    if matches!(
+        request.direction,
+        CallGraphDirection::Callees | CallGraphDirection::Both
+    ) {
+        directions.push(estimate_direction(
+            conn,
+            repo,
+            ref_name,
+            &root.symbol_stable_id,
+            depth_applied,
+            limit,
+            false,
+        )?);
+    }
+
+    Ok(CallGraphExplain {
+        symbol: root.name,
+        qualified_name: root.qualified_name,
+        path: root.path,
+        depth_requested: request.depth,
+        depth_applied,
+        max_depth: MAX_CALL_GRAPH_DEPTH,
+        limit,
+        directions,
+    })
+}
+
+fn estimate_direction(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    root_id: &str,
+    depth_limit: u32,
+    limit: usize,
+    callers: bool,
+) -> Result<DirectionExplain, StateError> {
+    let mut visited = HashSet::from([root_id.to_string()]);
+    let mut frontier = vec![root_id.to_string()];
+    let mut levels = Vec::new();
+    let mut estimated_edges = 0usize;
+    let mut truncated_by_limit = false;
+
+    for depth in 1..=depth_limit {
+        if frontier.is_empty() {
+            break;
+        }
+        let mut edge_count = 0usize;
+        let mut next = Vec::new();
+        for id in &frontier {
+            let found = if callers {
+                edges::get_callers(conn, repo, ref_name, id)?
+            } else {
+                edges::get_callees(conn, repo, ref_name, id)?
+            };
+            for edge in found {
+                let target = if callers {
+                    Some(edge.from_symbol_id)
+                } else {
+                    edge.to_symbol_id
+                };
+                let Some(target) = target else {
+                    continue;
+                };
+                edge_count += 1;
+                if visited.insert(target.clone()) {
+                    next.push(target);
+                }
+            }
+        }
+        levels.push(TraversalLevel {
+            depth,
+            frontier: frontier.len(),
+            edges: edge_count,
+            new_symbols: next.len(),
+        });
+        estimated_edges += edge_count;
+        // The traversal stops at the limit; so does the estimate.
+        if estimated_edges > limit {
+            truncated_by_limit = true;
+            break;
+        }
+        frontier = next;
+    }
+
+    Ok(DirectionExplain {
+        direction: if callers { "callers" } else { "callees" },
+        levels,
+        estimated_edges,
+        truncated_by_limit,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema, symbols};
+
+    fn setup() -> Connection {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        conn
+    }
+
+    fn symbol(stable: &str, name: &str, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "src/lib.rs".to_string(),
+            language: "rust".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: stable.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: line,
+            line_end: line + 2,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: Option<&str>, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: to.map(ToString::to_string),
+            to_name: None,
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: "src/lib.rs".to_string(),
+            source_line: line,
+        }
+    }
+
+    fn request(
+        direction: CallGraphDirection,
+        depth: u32,
+        limit: usize,
+    ) -> CallGraphRequest<'static> {
+        CallGraphRequest {
+            symbol_name: "a",
+            path: None,
+            direction,
+            depth,
+            limit,
+        }
+    }
+
+    #[test]
+    fn call_graph_explain_counts_levels_and_clamps_depth() {
+        let conn = setup();
+        for record in [
+            symbol("stable-a", "a", 1),
+            symbol("stable-b", "b", 10),
+            symbol("stable-c", "c", 20),
+            symbol("stable-d", "d", 30),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("stable-a", Some("stable-b"), 2),
+                call("stable-a", Some("stable-c"), 3),
+                call("stable-a", None, 4),
+                call("stable-b", Some("stable-d"), 11),
+                call("stable-c", Some("stable-d"), 21),
+                call("stable-d", Some("stable-a"), 31),
+            ],
+        )
+        .unwrap();
+
+        let explain = explain_call_graph(
+            &conn,
+            "repo",
+            "main",
+            &request(CallGraphDirection::Callees, 99, 50),
+        )
+        .unwrap();
+        assert_eq!(explain.depth_requested, 99);
+        assert_eq!(explain.depth_applied, MAX_CALL_GRAPH_DEPTH);
+        let callees = &explain.directions[0];
+        assert_eq!(callees.direction, "callees");
+        assert_eq!(
+            callees.levels,
+            vec![
+                TraversalLevel {
+                    depth: 1,
+                    frontier: 1,
+                    edges: 2,
+                    new_symbols: 2,
+                },
+                TraversalLevel {
+                    depth: 2,
+                    frontier: 2,
+                    edges: 2,
+                    new_symbols: 1,
+                },
+                TraversalLevel {
+                    depth: 3,
+                    frontier: 1,
+                    edges: 1,
+                    new_symbols: 0,
+                },
+            ]
+        );
+        assert_eq!(callees.estimated_edges, 5);
+        assert!(!callees.truncated_by_limit);
+
+        let limited = explain_call_graph(
+            &conn,
+            "repo",
+            "main",
+            &request(CallGraphDirection::Both, 3, 1),
+        )
+        .unwrap();
+        assert_eq!(limited.directions.len(), 2);
+        assert_eq!(limited.directions[0].direction, "callers");
+        assert!(limited.directions[1].truncated_by_limit);
+        assert_eq!(limited.directions[1].levels.len(), 1);
+    }
+
+    #[test]
+    fn missing_symbol_is_reported() {
+        let conn = setup();
+        let err = explain_call_graph(
+            &conn,
+            "repo",
+            "main",
+            &request(CallGraphDirection::Callers, 1, 10),
+        )
+        .unwrap_err();
+        assert!(matches!(err, CallGraphError::SymbolNotFound));
+    }
+
+    #[test]
+    fn candidate_plans_cover_confidence_bands() {
+        let config = SearchConfig::default();
+        let lexical_only = candidate_plans(QueryIntent::NaturalLanguage, false, 10, &config);
+        assert_eq!(lexical_only.len(), 1);
+        assert_eq!(lexical_only[0].plan, "lexical_fast");
+        assert_eq!(lexical_only[0].when, "any lexical confidence");
+        assert_eq!(lexical_only[0].semantic_limit, 0);
+
+        let symbol = candidate_plans(QueryIntent::Symbol, true, 10, &config);
+        assert_eq!(symbol.len(), 3);
+        assert_eq!(symbol[0].plan, "lexical_fast");
+        assert_eq!(symbol[0].reason, "high_confidence_lexical_rule");
+        assert_eq!(symbol[2].plan, "hybrid_standard");
+        assert!(symbol[2].semantic_fanout > 0);
+    }
+}
@@ -0,0 +1,351 @@
+//! Queries across several independently indexed repositories (`--federated`
+//! and `[federation]`), e.g. every service that calls a shared library.
+//!
+//! Each index is queried on its own and every result names the index it came
+//! from. A call from one repository into another is never resolved at index
+//! time, so callers in other indexes are found by the callee name their
+//! unresolved call edges record. Search scores come from separate Tantivy
+//! indices and are only roughly comparable across indexes.
+
+use crate::call_graph::{
+    self, CallGraphDirection, CallGraphEdgeResult, CallGraphError, CallGraphRequest,
+    CallGraphSymbol, CallSite,
+};
+use crate::ref_sites::{self, RefKind, ReferenceSite};
+use crate::search::{SearchExecutionOptions, SearchResult, search_code_with_options};
+use cruxe_core::error::StateError;
+use cruxe_state::tantivy_index::IndexSet;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::HashSet;
+use std::path::Path;
+
+/// One index of the federation, opened by the caller.
+pub struct IndexSource<'a> {
+    /// Name results are attributed to.
+    pub name: &'a str,
+    /// Root of the indexed repository; references are read from its files.
+    pub workspace: &'a Path,
+    pub repo: &'a str,
+    pub ref_name: &'a str,
+    pub conn: &'a Connection,
+    pub index_set: &'a IndexSet,
+}
+
+/// How querying one index went.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct IndexOutcome {
+    pub name: String,
+    pub ref_name: String,
+    pub results: usize,
+    /// Why the index could not be queried; the others still are.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+/// A result and the index it came from.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct Attributed<T> {
+    pub index: String,
+    #[serde(flatten)]
+    pub item: T,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct Federated<T> {
+    pub query: String,
+    /// Every index queried, in the order given.
+    pub indexes: Vec<IndexOutcome>,
+    pub results: Vec<Attributed<T>>,
+    pub truncated: bool,
+}
+
+impl<T> Federated<T> {
+    /// Keep the first `limit` results; dropping any marks the response
+    /// truncated.
+    pub fn truncate(&mut self, limit: usize) {
+        if self.results.len() > limit {
+            self.results.truncate(limit);
+            self.truncated = true;
+        }
+    }
+}
+
+/// Run `query_index` on every source; a failing index is recorded in
+/// [`Federated::indexes`] rather than failing the whole query.
+fn federate<T, E: std::fmt::Display>(
+    sources: &[IndexSource<'_>],
+    query: &str,
+    mut query_index: impl FnMut(&IndexSource<'_>) -> Result<Vec<T>, E>,
+) -> Federated<T> {
+    let mut federated = Federated {
+        query: query.to_string(),
+        indexes: Vec::with_capacity(sources.len()),
+        results: Vec::new(),
+        truncated: false,
+    };
+    for source in sources {
+        let (results, error) = match query_index(source) {
+            Ok(items) => (items, None),
+            Err(err) => {
+                tracing::warn!(index = source.name, "federated query failed: {}", err);
+                (Vec::new(), Some(err.to_string()))
+            }
+        };
+        federated.indexes.push(IndexOutcome {
+            name: source.name.to_string(),
+            ref_name: source.ref_name.to_string(),
+            results: results.len(),
+            error,
+        });
+        federated
+            .results
+            .extend(results.into_iter().map(|item| Attributed {
+                index: source.name.to_string(),
+                item,
+            }));
+    }
+    federated
+}
+
+/// Search every index, best scores first.
+pub fn search(
+    sources: &[IndexSource<'_>],
+    query: &str,
+    language: Option<&str>,
+    limit: usize,
+    options: &SearchExecutionOptions,
+) -> Federated<SearchResult> {
+    let mut federated = federate(sources, query, |source| {
+        search_code_with_options(
+            source.index_set,
+            Some(source.conn),
+            query,
+            Some(source.ref_name),
+            language,
+            limit,
+            false,
+            options.clone(),
+        )
+        .map(|response| response.results)
+    });
+    federated
+        .results
+        .sort_by(|a, b| b.item.score.total_cmp(&a.item.score));
+    federated.truncate(limit);
+    federated
+}
+
+/// Every reference to `symbol` in every index, by index and position.
+pub fn references(
+    sources: &[IndexSource<'_>],
+    symbol: &str,
+    kinds: &[RefKind],
+) -> Federated<ReferenceSite> {
+    federate(sources, symbol, |source| {
+        ref_sites::find_reference_sites(
+            source.conn,
+            source.workspace,
+            source.repo,
+            source.ref_name,
+            symbol,
+            kinds,
+        )
+        .map(|sites| sites.references)
+    })
+}
+
+/// The callers of `symbol` in every index: the call graph of the index that
+/// defines it, up to `depth`, and the direct calls other indexes make to it
+/// by name. `limit` caps the callers kept overall.
+pub fn callers(
+    sources: &[IndexSource<'_>],
+    symbol: &str,
+    depth: u32,
+    limit: usize,
+) -> Federated<CallGraphEdgeResult> {
+    let mut federated = federate(sources, symbol, |source| {
+        callers_in(source, symbol, depth, limit)
+    });
+    federated.truncate(limit);
+    federated
+}
+
+fn callers_in(
+    source: &IndexSource<'_>,
+    symbol: &str,
+    depth: u32,
+    limit: usize,
+) -> Result<Vec<CallGraphEdgeResult>, StateError> {
+    // Callers name a symbol of another repository with its package
+    // (`ledger.Post`), which its own index may only know as `Post`.
+    let mut callers = Vec::new();
+    let bare = ref_sites::bare_name(symbol);
+    let names = if bare == symbol {
+        vec![symbol]
+    } else {
+        vec![symbol, bare]
+    };
+    for name in names {
+        let request = CallGraphRequest {
+            symbol_name: name,
+            path: None,
+            direction: CallGraphDirection::Callers,
+            depth,
+            limit,
+        };
+        match call_graph::get_call_graph(source.conn, source.repo, source.ref_name, &request) {
+            Ok(graph) => {
+                callers = graph.callers;
+                break;
+            }
+            Err(CallGraphError::SymbolNotFound) => continue,
+            Err(CallGraphError::State(err)) => return Err(err),
+        }
+    }
+    let mut seen: HashSet<(String, u32)> = callers
+        .iter()
+        .map(|edge| (edge.call_site.file.clone(), edge.call_site.line))
+        .collect();
+    for edge in
+        edges::get_unresolved_calls_to_name(source.conn, source.repo, source.ref_name, symbol)?
+    {
+        if !seen.insert((edge.source_file.clone(), edge.source_line)) {
+            continue;
+        }
+        let caller = symbols::get_symbol_by_stable_id(
+            source.conn,
+            source.repo,
+            source.ref_name,
+            &edge.from_symbol_id,
+        )?;
+        callers.push(CallGraphEdgeResult {
+            symbol: match caller {
+                Some(caller) => call_graph::to_call_graph_symbol(&caller),
+                None => {
+                    file_level_caller(&edge.from_symbol_id, &edge.source_file, edge.source_line)
+                }
+            },
+            call_site: CallSite {
+                file: edge.source_file,
+                line: edge.source_line,
+            },
+            confidence: edge.confidence,
+            depth: 1,
+        });
+    }
+    Ok(callers)
+}
+
+/// Calls made outside any symbol (module-level code) are attributed to
+/// their file.
+fn file_level_caller(symbol_id: &str, path: &str, line: u32) -> CallGraphSymbol {
+    CallGraphSymbol {
+        symbol_id: symbol_id.to_string(),
+        symbol_stable_id: symbol_id.to_string(),
+        name: path.to_string(),
+        qualified_name: path.to_string(),
+        path: path.to_string(),
+        line_start: line,
+        line_end: line,
+        kind: "file".to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    fn symbol(repo: &str, path: &str, name: &str, line_start: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: repo.to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end: line_start + 10,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(repo: &str, from: &str, to: Option<&str>, to_name: &str, file: &str) -> CallEdge {
+        CallEdge {
+            repo: repo.to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: to.map(|to| format!("stable::{to}")),
+            to_name: Some(to_name.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: file.to_string(),
+            source_line: 4,
+        }
+    }
+
+    #[test]
+    fn callers_are_found_in_every_index() {
+        let dir = tempfile::tempdir().unwrap();
+        let open = |name: &str| {
+            let conn = db::open_connection(&dir.path().join(format!("{name}.db"))).unwrap();
+            schema::create_tables(&conn).unwrap();
+            conn
+        };
+        let ledger = open("ledger");
+        symbols::insert_symbol(&ledger, &symbol("ledger", "post.go", "Post", 1)).unwrap();
+        symbols::insert_symbol(&ledger, &symbol("ledger", "batch.go", "PostAll", 1)).unwrap();
+        edges::insert_call_edges(
+            &ledger,
+            "ledger",
+            "main",
+            &[call("ledger", "PostAll", Some("Post"), "Post", "batch.go")],
+        )
+        .unwrap();
+        let billing = open("billing");
+        symbols::insert_symbol(&billing, &symbol("billing", "charge.go", "Charge", 1)).unwrap();
+        edges::insert_call_edges(
+            &billing,
+            "billing",
+            "main",
+            &[call("billing", "Charge", None, "ledger.Post", "charge.go")],
+        )
+        .unwrap();
+
+        let index_set = IndexSet::open(dir.path()).unwrap();
+        let source = |name, conn| IndexSource {
+            name,
+            workspace: dir.path(),
+            repo: name,
+            ref_name: "main",
+            conn,
+            index_set: &index_set,
+        };
+        let federated = callers(
+            &[source("ledger", &ledger), source("billing", &billing)],
+            "ledger.Post",
+            2,
+            10,
+        );
+
+        let callers: Vec<(&str, &str)> = federated
+            .results
+            .iter()
+            .map(|caller| (caller.index.as_str(), caller.item.symbol.name.as_str()))
+            .collect();
+        assert_eq!(callers, [("ledger", "PostAll"), ("billing", "Charge")]);
+        assert_eq!(federated.indexes[1].results, 1);
+        assert!(!federated.truncated);
+    }
+}
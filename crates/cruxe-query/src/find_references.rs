@@ -1,7 +1,8 @@
+use crate::aliases::{AliasedSymbol, load_symbol_aliases};
 use cruxe_core::error::StateError;
 use cruxe_core::types::{SourceLayer, SymbolRecord};
-use cruxe_state::{project, symbols, tombstones};
-use rusqlite::{Connection, params};
+use cruxe_state::{project, reference_fingerprints, symbols, tombstones};
+use rusqlite::{Connection, ToSql, params, params_from_iter};
 use serde::{Deserialize, Serialize};
 use std::collections::{HashMap, HashSet};
 use std::path::Path;
@@ -48,6 +49,10 @@ pub struct FindReferencesResult {
     pub references: Vec<ReferenceResult>,
     pub total_references: usize,
     pub unresolved_count: usize,
+    /// Content-identical copies of the symbol at other paths whose
+    /// references are included; see [`crate::aliases`].
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub aliases: Vec<AliasedSymbol>,
 }
 
 #[derive(Debug, Clone, PartialEq, Eq, Hash)]
@@ -85,10 +90,30 @@ pub fn find_references(
     };
 
     let target_result_symbol = symbol_to_reference_symbol(&target_symbol);
-    let target_ids = [
+    // References to a vendored or forked copy count for the symbol too.
+    let alias_ref = if project_row.vcs_mode && ref_name != project_row.default_ref {
+        project_row.default_ref.as_str()
+    } else {
+        ref_name
+    };
+    let aliases: Vec<AliasedSymbol> = load_symbol_aliases(conn, project_id, alias_ref)?
+        .group_of(&target_symbol.symbol_stable_id)
+        .map(|group| {
+            std::iter::once(&group.canonical)
+                .chain(&group.aliases)
+                .filter(|member| member.symbol_stable_id != target_symbol.symbol_stable_id)
+                .cloned()
+                .collect()
+        })
+        .unwrap_or_default();
+    let mut target_ids = vec![
         target_symbol.symbol_id.as_str(),
         target_symbol.symbol_stable_id.as_str(),
     ];
+    for alias in &aliases {
+        target_ids.push(alias.symbol_id.as_str());
+        target_ids.push(alias.symbol_stable_id.as_str());
+    }
 
     let no_edges = if project_row.vcs_mode && ref_name != project_row.default_ref {
         edge_count(conn, project_id, &project_row.default_ref)?
@@ -101,22 +126,67 @@ pub fn find_references(
         return Err(FindReferencesError::NoEdgesAvailable);
     }
 
-    let (base_rows, overlay_rows) = if project_row.vcs_mode && ref_name != project_row.default_ref {
-        let base_rows = query_edge_rows(
-            conn,
-            project_id,
-            &project_row.default_ref,
-            &target_ids,
-            kind_filter,
-        )?;
-        let overlay_rows = query_edge_rows(conn, project_id, ref_name, &target_ids, kind_filter)?;
-        (base_rows, overlay_rows)
-    } else {
-        (
-            query_edge_rows(conn, project_id, ref_name, &target_ids, kind_filter)?,
-            Vec::new(),
-        )
-    };
+    let target_name = target_symbol.name.as_str();
+    let (base_rows, overlay_rows, unresolved_count) =
+        if project_row.vcs_mode && ref_name != project_row.default_ref {
+            let default_ref = project_row.default_ref.as_str();
+            let base_candidates =
+                reference_candidates(conn, project_id, default_ref, target_name, &target_ids)?;
+            let overlay_candidates =
+                reference_candidates(conn, project_id, ref_name, target_name, &target_ids)?;
+            (
+                query_edge_rows(
+                    conn,
+                    project_id,
+                    default_ref,
+                    &target_ids,
+                    kind_filter,
+                    base_candidates.as_deref(),
+                )?,
+                query_edge_rows(
+                    conn,
+                    project_id,
+                    ref_name,
+                    &target_ids,
+                    kind_filter,
+                    overlay_candidates.as_deref(),
+                )?,
+                query_unresolved_count(
+                    conn,
+                    project_id,
+                    default_ref,
+                    target_name,
+                    base_candidates.as_deref(),
+                )? + query_unresolved_count(
+                    conn,
+                    project_id,
+                    ref_name,
+                    target_name,
+                    overlay_candidates.as_deref(),
+                )?,
+            )
+        } else {
+            let candidates =
+                reference_candidates(conn, project_id, ref_name, target_name, &target_ids)?;
+            (
+                query_edge_rows(
+                    conn,
+                    project_id,
+                    ref_name,
+                    &target_ids,
+                    kind_filter,
+                    candidates.as_deref(),
+                )?,
+                Vec::new(),
+                query_unresolved_count(
+                    conn,
+                    project_id,
+                    ref_name,
+                    target_name,
+                    candidates.as_deref(),
+                )?,
+            )
+        };
 
     let mut merged: HashMap<(String, String, String), ReferenceResult> = HashMap::new();
     let tombstone_paths = if project_row.vcs_mode && ref_name != project_row.default_ref {
@@ -168,23 +238,12 @@ pub fn find_references(
         references.truncate(limit);
     }
 
-    let unresolved_target = target_symbol.name.clone();
-    let unresolved_count = if project_row.vcs_mode && ref_name != project_row.default_ref {
-        query_unresolved_count(
-            conn,
-            project_id,
-            &project_row.default_ref,
-            &unresolved_target,
-        )? + query_unresolved_count(conn, project_id, ref_name, &unresolved_target)?
-    } else {
-        query_unresolved_count(conn, project_id, ref_name, &unresolved_target)?
-    };
-
     Ok(FindReferencesResult {
         symbol: target_result_symbol,
         references,
         total_references,
         unresolved_count,
+        aliases,
     })
 }
 
@@ -257,33 +316,46 @@ fn query_edge_rows(
     conn: &Connection,
     project_id: &str,
     ref_name: &str,
-    target_ids: &[&str; 2],
+    target_ids: &[&str],
     kind_filter: Option<&str>,
+    candidates: Option<&[String]>,
 ) -> Result<Vec<EdgeRow>, StateError> {
-    let mut sql = String::from(
+    let placeholders = std::iter::repeat_n("?", target_ids.len())
+        .collect::<Vec<_>>()
+        .join(", ");
+    let mut sql = format!(
         "SELECT from_symbol_id, to_symbol_id, edge_type \
          FROM symbol_edges \
-         WHERE repo = ?1 AND \"ref\" = ?2 \
-           AND (to_symbol_id = ?3 OR to_symbol_id = ?4)",
+         WHERE repo = ? AND \"ref\" = ? \
+           AND to_symbol_id IN ({placeholders})"
     );
     if kind_filter.is_some() {
-        sql.push_str(" AND edge_type = ?5");
+        sql.push_str(" AND edge_type = ?");
+    }
+    if let Some(candidates) = candidates {
+        sql.push_str(&candidate_filter_sql(candidates.len()));
     }
     sql.push_str(" ORDER BY from_symbol_id, to_symbol_id, edge_type");
     let mut stmt = conn.prepare(&sql).map_err(StateError::sqlite)?;
-    let rows = if let Some(kind) = kind_filter {
-        stmt.query_map(
-            params![project_id, ref_name, target_ids[0], target_ids[1], kind],
-            map_edge_row,
-        )
-        .map_err(StateError::sqlite)?
-    } else {
-        stmt.query_map(
-            params![project_id, ref_name, target_ids[0], target_ids[1]],
-            map_edge_row,
-        )
-        .map_err(StateError::sqlite)?
-    };
+    let mut bind_params: Vec<&dyn ToSql> = Vec::with_capacity(3 + target_ids.len());
+    bind_params.push(&project_id);
+    bind_params.push(&ref_name);
+    for target_id in target_ids {
+        bind_params.push(target_id);
+    }
+    if let Some(kind) = &kind_filter {
+        bind_params.push(kind);
+    }
+    if let Some(candidates) = candidates {
+        bind_params.push(&project_id);
+        bind_params.push(&ref_name);
+        for path in candidates {
+            bind_params.push(path);
+        }
+    }
+    let rows = stmt
+        .query_map(params_from_iter(bind_params), map_edge_row)
+        .map_err(StateError::sqlite)?;
     rows.collect::<Result<Vec<_>, _>>()
         .map_err(StateError::sqlite)
 }
@@ -307,34 +379,93 @@ fn edge_count(conn: &Connection, project_id: &str, ref_name: &str) -> Result<u64
     Ok(count.max(0) as u64)
 }
 
+/// Above this many candidate files the prefilter is not selective enough to be
+/// worth binding as SQL parameters, so the plain scan is used instead.
+const MAX_FINGERPRINT_CANDIDATES: usize = 512;
+
+/// Files on `ref_name` whose reference fingerprint may mention the target by
+/// name or by one of its ids. `None` means every file must be scanned: the
+/// ref has no fingerprints, or too many files pass for the filter to help.
+fn reference_candidates(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    target_name: &str,
+    target_ids: &[&str],
+) -> Result<Option<Vec<String>>, StateError> {
+    Ok(reference_fingerprints::candidate_paths(
+        conn,
+        project_id,
+        ref_name,
+        &[target_name],
+        target_ids,
+    )?
+    .filter(|candidates| candidates.len() <= MAX_FINGERPRINT_CANDIDATES))
+}
+
+/// SQL restricting call edges to `candidate_count` candidate files, bound as
+/// repo, ref, then the paths. Edges from files without a fingerprint (legacy
+/// rows, non-call edges) are always kept.
+fn candidate_filter_sql(candidate_count: usize) -> String {
+    let mut sql = String::from(
+        " AND (
+                edge_type <> 'calls'
+                OR source_file IS NULL
+                OR source_file NOT IN (
+                    SELECT path FROM file_reference_fingerprints
+                    WHERE repo = ? AND \"ref\" = ?
+                )",
+    );
+    if candidate_count > 0 {
+        let placeholders = std::iter::repeat_n("?", candidate_count)
+            .collect::<Vec<_>>()
+            .join(", ");
+        sql.push_str(&format!(
+            "\n                OR source_file IN ({placeholders})"
+        ));
+    }
+    sql.push_str("\n           )");
+    sql
+}
+
 fn query_unresolved_count(
     conn: &Connection,
     project_id: &str,
     ref_name: &str,
     target_name: &str,
+    candidates: Option<&[String]>,
 ) -> Result<usize, StateError> {
     let escaped = escape_like_pattern(target_name);
     let dotted_suffix = format!("%.{escaped}");
     let rust_suffix = format!("%::{escaped}");
+    let mut sql = String::from(
+        "SELECT COUNT(*) FROM symbol_edges
+         WHERE repo = ?1 AND \"ref\" = ?2
+           AND to_symbol_id IS NULL
+           AND (
+                to_name = ?3
+                OR to_name LIKE ?4 ESCAPE '\\'
+                OR to_name LIKE ?5 ESCAPE '\\'
+           )",
+    );
+    let mut values: Vec<String> = vec![
+        project_id.to_string(),
+        ref_name.to_string(),
+        target_name.to_string(),
+        dotted_suffix,
+        rust_suffix,
+    ];
+
+    // Files whose reference fingerprint rules out the target are skipped.
+    if let Some(candidates) = candidates {
+        sql.push_str(&candidate_filter_sql(candidates.len()));
+        values.push(project_id.to_string());
+        values.push(ref_name.to_string());
+        values.extend(candidates.iter().cloned());
+    }
+
     let count: i64 = conn
-        .query_row(
-            "SELECT COUNT(*) FROM symbol_edges
-             WHERE repo = ?1 AND \"ref\" = ?2
-               AND to_symbol_id IS NULL
-               AND (
-                    to_name = ?3
-                    OR to_name LIKE ?4 ESCAPE '\\'
-                    OR to_name LIKE ?5 ESCAPE '\\'
-               )",
-            params![
-                project_id,
-                ref_name,
-                target_name,
-                dotted_suffix,
-                rust_suffix
-            ],
-            |row| row.get(0),
-        )
+        .query_row(&sql, params_from_iter(values.iter()), |row| row.get(0))
         .map_err(StateError::sqlite)?;
     Ok(count.max(0) as usize)
 }
@@ -981,4 +1112,139 @@ mod tests {
 
         assert_eq!(result.unresolved_count, 3);
     }
+
+    #[test]
+    fn unresolved_count_uses_reference_fingerprints_without_losing_matches() {
+        let (_tmp, conn) = setup();
+        let call = |source_file: &str, to_name: &str, line: u32| CallEdge {
+            repo: "proj".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("file::{source_file}"),
+            to_symbol_id: None,
+            to_name: Some(to_name.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: source_file.to_string(),
+            source_line: line,
+        };
+        edges::replace_call_edges_for_files(
+            &conn,
+            "proj",
+            "main",
+            &[
+                (
+                    "src/a.rs".to_string(),
+                    vec![
+                        call("src/a.rs", "auth::validate_token", 1),
+                        call("src/a.rs", "helper", 2),
+                    ],
+                ),
+                ("src/b.rs".to_string(), vec![call("src/b.rs", "connect", 1)]),
+            ],
+        )
+        .unwrap();
+        // Legacy rows without a fingerprint must still be counted.
+        edges::insert_call_edges(
+            &conn,
+            "proj",
+            "main",
+            &[call("src/legacy.rs", "validate_token", 7)],
+        )
+        .unwrap();
+
+        let unresolved = |name: &str| {
+            let candidates = reference_candidates(&conn, "proj", "main", name, &[]).unwrap();
+            query_unresolved_count(&conn, "proj", "main", name, candidates.as_deref()).unwrap()
+        };
+        assert_eq!(unresolved("validate_token"), 2);
+        assert_eq!(unresolved("missing_symbol"), 0);
+    }
+
+    #[test]
+    fn find_references_skips_files_ruled_out_by_fingerprints() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("workspace");
+        std::fs::create_dir_all(workspace.join("src")).unwrap();
+        for file in ["src/a.rs", "src/b.rs"] {
+            std::fs::write(workspace.join(file), "fn caller() { check(); }\n").unwrap();
+        }
+        let now = "2026-02-25T00:00:00Z".to_string();
+        project::create_project(
+            &conn,
+            &cruxe_core::types::Project {
+                project_id: "proj".to_string(),
+                repo_root: workspace.to_string_lossy().to_string(),
+                display_name: Some("test".to_string()),
+                default_ref: "main".to_string(),
+                vcs_mode: false,
+                schema_version: 1,
+                parser_version: 1,
+                created_at: now.clone(),
+                updated_at: now,
+            },
+        )
+        .unwrap();
+        insert_symbol(
+            &conn,
+            "proj",
+            "main",
+            "sym-target",
+            "stable-target",
+            "validate_token",
+            "src/auth.rs",
+            10,
+        );
+        insert_symbol(
+            &conn, "proj", "main", "sym-a", "stable-a", "caller", "src/a.rs", 1,
+        );
+        insert_symbol(
+            &conn, "proj", "main", "sym-b", "stable-b", "caller", "src/b.rs", 1,
+        );
+
+        // Both files call the target through a renamed import, so only the
+        // resolved id (not the name) ties the call to `validate_token`.
+        let call = |source_file: &str, from: &str| CallEdge {
+            repo: "proj".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: Some("stable-target".to_string()),
+            to_name: Some("check".to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: source_file.to_string(),
+            source_line: 1,
+        };
+        edges::replace_call_edges_for_files(
+            &conn,
+            "proj",
+            "main",
+            &[
+                ("src/a.rs".to_string(), vec![call("src/a.rs", "sym-a")]),
+                ("src/b.rs".to_string(), vec![call("src/b.rs", "sym-b")]),
+            ],
+        )
+        .unwrap();
+
+        let paths = |conn: &Connection| {
+            find_references(conn, &workspace, "proj", "main", None, "validate_token", 20)
+                .unwrap()
+                .references
+                .into_iter()
+                .map(|reference| reference.path)
+                .collect::<Vec<_>>()
+        };
+        assert_eq!(paths(&conn), vec!["src/a.rs", "src/b.rs"]);
+
+        // A fingerprint that rules the target out keeps the scan away from
+        // b.rs entirely, even though its edge row is still present.
+        reference_fingerprints::upsert_fingerprint(
+            &conn,
+            "proj",
+            "main",
+            "src/b.rs",
+            &cruxe_core::fingerprint::ReferenceFingerprint::from_names(["connect"]),
+        )
+        .unwrap();
+        assert_eq!(paths(&conn), vec!["src/a.rs"]);
+    }
 }
@@ -0,0 +1,247 @@
+//! Known findings to leave out of reports (`cruxe baseline write`,
+//! `--baseline`).
+//!
+//! A baseline snapshots what the analyses report today — `cruxe check`
+//! findings, dead code, package import cycles and functions above
+//! [`COMPLEXITY_THRESHOLD`] — so a legacy codebase can adopt them and see
+//! only what changes make worse. Entries are keyed without line numbers, so
+//! an edit above a known finding does not make it new. Repeated identical
+//! findings are counted: a third copy of a baselined pair is new.
+//!
+//! Like the ratchet file, the baseline lives in the workspace and is meant
+//! to be committed. Unlike the ratchet, it never changes on its own; rewrite
+//! it once known findings are fixed, so they cannot come back unnoticed.
+
+use super::{ComplexityPeak, Finding};
+use crate::deadcode::DeadSymbol;
+use cruxe_core::error::StateError;
+use cruxe_core::time::now_iso8601;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, BTreeSet};
+use std::path::Path;
+
+/// Workspace-relative default location of the baseline file.
+pub const BASELINE_FILE: &str = ".cruxe/baseline.json";
+
+/// Functions above this [`super::complexity`] are baselined and reported.
+pub const COMPLEXITY_THRESHOLD: u32 = 15;
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Baseline {
+    /// Ref the snapshot was taken on.
+    #[serde(default)]
+    pub r#ref: String,
+    #[serde(default)]
+    pub created_at: String,
+    /// `<rule> <path> <symbol>: <message>` -> number of such findings.
+    #[serde(default)]
+    pub findings: BTreeMap<String, u32>,
+    /// `<path> <qualified name>` of every dead symbol.
+    #[serde(default)]
+    pub dead_code: BTreeSet<String>,
+    /// Sorted members of every import cycle, joined by `, `.
+    #[serde(default)]
+    pub cycles: BTreeSet<String>,
+    /// `<path> <symbol>` -> complexity of every function above the threshold.
+    #[serde(default)]
+    pub complexity: BTreeMap<String, u32>,
+}
+
+impl Baseline {
+    pub fn new(ref_name: &str) -> Self {
+        Self {
+            r#ref: ref_name.to_string(),
+            created_at: now_iso8601(),
+            ..Self::default()
+        }
+    }
+
+    /// `Ok(None)` when the file does not exist.
+    pub fn load(path: &Path) -> Result<Option<Self>, StateError> {
+        let raw = match std::fs::read_to_string(path) {
+            Ok(raw) => raw,
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(None),
+            Err(e) => return Err(e.into()),
+        };
+        serde_json::from_str(&raw)
+            .map(Some)
+            .map_err(|e| StateError::CorruptManifest(format!("{}: {}", path.display(), e)))
+    }
+
+    /// Write through a temp file so an interrupted run leaves the old file.
+    pub fn save(&self, path: &Path) -> Result<(), StateError> {
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)?;
+        }
+        let mut json = serde_json::to_string_pretty(self).map_err(std::io::Error::other)?;
+        json.push('\n');
+        let temp = path.with_extension("json.tmp");
+        std::fs::write(&temp, json)?;
+        std::fs::rename(&temp, path)?;
+        Ok(())
+    }
+
+    pub fn record_findings(&mut self, findings: &[Finding]) {
+        for finding in findings {
+            *self.findings.entry(finding_key(finding)).or_default() += 1;
+        }
+    }
+
+    pub fn record_dead_code(&mut self, dead: &[DeadSymbol]) {
+        self.dead_code.extend(dead.iter().map(dead_code_key));
+    }
+
+    pub fn record_cycles(&mut self, cycles: &[Vec<String>]) {
+        self.cycles
+            .extend(cycles.iter().map(|cycle| cycle_key(cycle)));
+    }
+
+    pub fn record_complexity(&mut self, functions: &[ComplexityPeak]) {
+        for function in functions {
+            self.complexity
+                .insert(complexity_key(function), function.complexity);
+        }
+    }
+
+    /// Findings beyond the baselined count of their key, in input order.
+    pub fn new_findings(&self, findings: Vec<Finding>) -> Vec<Finding> {
+        let mut remaining = self.findings.clone();
+        findings
+            .into_iter()
+            .filter(|finding| match remaining.get_mut(&finding_key(finding)) {
+                Some(count) if *count > 0 => {
+                    *count -= 1;
+                    false
+                }
+                _ => true,
+            })
+            .collect()
+    }
+
+    pub fn new_dead_code(&self, dead: Vec<DeadSymbol>) -> Vec<DeadSymbol> {
+        dead.into_iter()
+            .filter(|symbol| !self.dead_code.contains(&dead_code_key(symbol)))
+            .collect()
+    }
+
+    pub fn is_known_cycle(&self, cycle: &[String]) -> bool {
+        self.cycles.contains(&cycle_key(cycle))
+    }
+
+    /// Functions that crossed the threshold since the snapshot or grew more
+    /// complex than it recorded.
+    pub fn new_complexity(&self, functions: Vec<ComplexityPeak>) -> Vec<ComplexityPeak> {
+        functions
+            .into_iter()
+            .filter(|function| {
+                self.known_complexity(function)
+                    .is_none_or(|known| function.complexity > known)
+            })
+            .collect()
+    }
+
+    /// Complexity the snapshot recorded for `function`, if it was above the
+    /// threshold then.
+    pub fn known_complexity(&self, function: &ComplexityPeak) -> Option<u32> {
+        self.complexity.get(&complexity_key(function)).copied()
+    }
+}
+
+fn finding_key(finding: &Finding) -> String {
+    format!(
+        "{} {} {}: {}",
+        finding.rule, finding.path, finding.symbol, finding.message
+    )
+}
+
+fn dead_code_key(symbol: &DeadSymbol) -> String {
+    format!("{} {}", symbol.path, symbol.qualified_name)
+}
+
+/// Cycles are reported starting from any member; sorting makes the key
+/// independent of where.
+fn cycle_key(cycle: &[String]) -> String {
+    let mut members: Vec<&str> = cycle.iter().map(String::as_str).collect();
+    members.sort_unstable();
+    members.dedup();
+    members.join(", ")
+}
+
+fn complexity_key(function: &ComplexityPeak) -> String {
+    format!("{} {}", function.path, function.symbol)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::deadcode::DeadReason;
+    use crate::findings::{Confidence, Severity};
+
+    fn finding(line: u32) -> Finding {
+        Finding {
+            id: String::new(),
+            rule: "go/time-tick-leak".to_string(),
+            severity: Severity::Warning,
+            path: "poll.go".to_string(),
+            line,
+            symbol: "Poll".to_string(),
+            symbol_id: "sym::Poll".to_string(),
+            message: "time.Tick leaks its ticker".to_string(),
+            confidence: Confidence::Medium,
+            evidence: Vec::new(),
+            also_reported_by: Vec::new(),
+        }
+    }
+
+    fn function(symbol: &str, complexity: u32) -> ComplexityPeak {
+        ComplexityPeak {
+            complexity,
+            symbol: symbol.to_string(),
+            path: "parse.go".to_string(),
+            line: 1,
+        }
+    }
+
+    #[test]
+    fn only_findings_beyond_the_snapshot_are_new() {
+        let mut baseline = Baseline::new("main");
+        baseline.record_findings(&[finding(10), finding(20)]);
+        baseline.record_dead_code(&[DeadSymbol {
+            qualified_name: "unused".to_string(),
+            kind: "function".to_string(),
+            path: "util.go".to_string(),
+            line_start: 3,
+            line_end: 5,
+            reason: DeadReason::Unreachable,
+        }]);
+        baseline.record_cycles(&[vec!["a".to_string(), "b".to_string()]]);
+        baseline.record_complexity(&[function("Parse", 20)]);
+
+        // Moved lines keep their findings known; a third copy is new.
+        let new = baseline.new_findings(vec![finding(12), finding(22), finding(30)]);
+        assert_eq!(new.len(), 1);
+        assert_eq!(new[0].line, 30);
+
+        assert!(baseline.is_known_cycle(&["b".to_string(), "a".to_string()]));
+        assert!(!baseline.is_known_cycle(&["a".to_string(), "c".to_string()]));
+
+        let new = baseline.new_complexity(vec![
+            function("Parse", 20),
+            function("Lex", 16),
+            function("Parse", 21),
+        ]);
+        assert_eq!(new, [function("Lex", 16), function("Parse", 21)]);
+    }
+
+    #[test]
+    fn baseline_file_round_trips() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join(BASELINE_FILE);
+        assert_eq!(Baseline::load(&path).unwrap(), None);
+
+        let mut baseline = Baseline::new("main");
+        baseline.record_findings(&[finding(1)]);
+        baseline.save(&path).unwrap();
+        assert_eq!(Baseline::load(&path).unwrap(), Some(baseline));
+    }
+}
@@ -0,0 +1,384 @@
+//! Cancellation that stops short of the calls it should reach.
+//!
+//! `go/context-dropped` flags `context.Background()` and `context.TODO()` in
+//! a function that already has a context, and in a function without one
+//! whose caller has one, found through the recorded call edges: the chain
+//! loses the caller's deadline there. Fresh contexts inside a `go func`
+//! literal are left alone, since detaching background work from a request
+//! is what they are usually for. `go/blocking-call-without-context` flags
+//! database, HTTP, dial and process calls that have a variant taking a
+//! context. Like the body rules this reads text: a function has a context
+//! when its declaration takes a `context.Context` or an `*http.Request`.
+
+use super::go_misuse::{GO_FUNC, goroutine_body};
+use super::{Confidence, Evidence, EvidenceKind, Rule, RuleCheck, Severity};
+use cruxe_core::error::StateError;
+use cruxe_state::{edges, symbols};
+use regex::Regex;
+use rusqlite::Connection;
+use std::collections::HashMap;
+use std::sync::LazyLock;
+
+pub(super) static RULES: &[Rule] = &[
+    Rule {
+        id: "go/context-dropped",
+        language: "go",
+        summary: "context.Background or TODO replaces a context the caller has",
+        default_severity: Severity::Warning,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Context(ContextCheck::Dropped),
+    },
+    Rule {
+        id: "go/blocking-call-without-context",
+        language: "go",
+        summary: "blocking call that cannot be cancelled; a context variant exists",
+        default_severity: Severity::Warning,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Context(ContextCheck::Blocking),
+    },
+];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(super) enum ContextCheck {
+    Dropped,
+    Blocking,
+}
+
+static FRESH_CONTEXT: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\bcontext\.(?:Background|TODO)\(\)").expect("valid regex"));
+
+static CONTEXT_PARAM: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\b([A-Za-z_]\w*)\s+context\.Context\b").expect("valid regex"));
+
+static REQUEST_PARAM: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\b([A-Za-z_]\w*)\s+\*http\.Request\b").expect("valid regex"));
+
+/// `h.db.Query(`, `tx.Exec(`: database methods with a `...Context` twin.
+static DB_CALL: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"\b((?:[A-Za-z_]\w*\.)*[A-Za-z_]\w*)\.(Query|QueryRow|Exec|Prepare|Ping|Begin)\(")
+        .expect("valid regex")
+});
+
+/// Package-level calls with a context-taking replacement.
+static PACKAGE_CALL: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"\b(http\.(?:Get|Head|Post|PostForm|NewRequest)|net\.(?:Dial|DialTimeout)|exec\.Command)\(")
+        .expect("valid regex")
+});
+
+/// Receivers that hold a database handle, by their last name segment.
+fn is_database(receiver: &str) -> bool {
+    let name = receiver
+        .rsplit('.')
+        .next()
+        .unwrap_or(receiver)
+        .to_ascii_lowercase();
+    name.contains("db") || matches!(name.as_str(), "tx" | "conn" | "stmt" | "pool")
+}
+
+fn package_replacement(call: &str) -> &'static str {
+    match call {
+        "http.NewRequest" => "http.NewRequestWithContext",
+        "net.Dial" | "net.DialTimeout" => "net.Dialer.DialContext",
+        "exec.Command" => "exec.CommandContext",
+        _ => "http.NewRequestWithContext and Client.Do",
+    }
+}
+
+/// One hit of either rule.
+#[derive(Debug, Clone)]
+pub(super) struct Issue {
+    pub check: ContextCheck,
+    pub path: String,
+    pub line: u32,
+    pub symbol: String,
+    pub symbol_id: String,
+    pub message: String,
+    pub evidence: Vec<Evidence>,
+}
+
+struct Function {
+    id: String,
+    name: String,
+    qualified_name: String,
+    path: String,
+    line_start: u32,
+    code: String,
+    /// How the function's context is reached: `ctx`, `r.Context()`.
+    context: Option<String>,
+}
+
+impl Function {
+    fn line_of(&self, offset: usize) -> u32 {
+        self.line_start + self.code[..offset].matches('\n').count() as u32
+    }
+
+    fn is_entry(&self) -> bool {
+        matches!(self.name.as_str(), "main" | "init") || self.path.ends_with("_test.go")
+    }
+
+    fn issue(&self, check: ContextCheck, line: u32, message: String, detail: String) -> Issue {
+        Issue {
+            check,
+            path: self.path.clone(),
+            line,
+            symbol: self.qualified_name.clone(),
+            symbol_id: self.id.clone(),
+            message,
+            evidence: vec![Evidence::at(
+                EvidenceKind::Heuristic,
+                detail,
+                &self.path,
+                line,
+            )],
+        }
+    }
+}
+
+/// The context a declaration takes, as the expression that reads it.
+fn context_in_scope(code: &str) -> Option<String> {
+    let header = code.find('{').map_or(code, |at| &code[..at]);
+    if let Some(captures) = CONTEXT_PARAM.captures(header) {
+        return Some(captures[1].to_string());
+    }
+    REQUEST_PARAM
+        .captures(header)
+        .map(|captures| format!("{}.Context()", &captures[1]))
+}
+
+/// Both rules over every Go function of a repo/ref, ordered by path and
+/// line.
+pub(super) fn find_issues(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<Issue>, StateError> {
+    let mut functions = Vec::new();
+    symbols::for_each_function_body(conn, repo, ref_name, "go", |symbol| {
+        let Some(content) = symbol.content.as_deref() else {
+            return Ok(());
+        };
+        let code = super::blank_comments_and_strings(content);
+        functions.push(Function {
+            id: symbol.symbol_stable_id,
+            name: symbol.name,
+            qualified_name: symbol.qualified_name,
+            path: symbol.path,
+            line_start: symbol.line_start,
+            context: context_in_scope(&code),
+            code,
+        });
+        Ok(())
+    })?;
+    let by_id: HashMap<&str, &Function> = functions
+        .iter()
+        .map(|function| (function.id.as_str(), function))
+        .collect();
+
+    let mut issues = Vec::new();
+    for function in &functions {
+        if function.is_entry() {
+            continue;
+        }
+        for fresh in fresh_contexts(&function.code) {
+            let line = function.line_of(fresh.start);
+            let call = &function.code[fresh];
+            if let Some(context) = &function.context {
+                issues.push(function.issue(
+                    ContextCheck::Dropped,
+                    line,
+                    format!(
+                        "`{call}` discards the `{context}` that `{}` already has; pass it on so cancellation and deadlines reach the callee",
+                        function.name
+                    ),
+                    format!("`{call}` in {}, which takes `{context}`", function.name),
+                ));
+                continue;
+            }
+            let callers = edges::get_callers(conn, repo, ref_name, &function.id)?;
+            let Some((caller, context, edge)) = callers.iter().find_map(|edge| {
+                let caller = by_id.get(edge.from_symbol_id.as_str())?;
+                Some((caller, caller.context.as_deref()?, edge))
+            }) else {
+                continue;
+            };
+            let mut issue = function.issue(
+                ContextCheck::Dropped,
+                line,
+                format!(
+                    "`{call}` starts a new context although caller `{}` has `{context}`; take a context.Context parameter and pass it down",
+                    caller.qualified_name
+                ),
+                format!("`{call}` in {}, which takes no context", function.name),
+            );
+            issue.evidence.push(Evidence::at(
+                EvidenceKind::Edge,
+                format!(
+                    "{} has `{context}` and calls {}",
+                    caller.qualified_name, function.qualified_name
+                ),
+                &edge.source_file,
+                edge.source_line,
+            ));
+            issues.push(issue);
+        }
+        issues.extend(blocking_calls(function));
+    }
+    issues.sort_by(|a, b| (a.path.as_str(), a.line).cmp(&(b.path.as_str(), b.line)));
+    Ok(issues)
+}
+
+/// `context.Background()`/`TODO()` outside `go func` literals.
+fn fresh_contexts(code: &str) -> Vec<std::ops::Range<usize>> {
+    let goroutines: Vec<std::ops::Range<usize>> = GO_FUNC
+        .find_iter(code)
+        .filter_map(|go| goroutine_body(code, go.end()))
+        .collect();
+    FRESH_CONTEXT
+        .find_iter(code)
+        .map(|hit| hit.range())
+        .filter(|hit| !goroutines.iter().any(|span| span.contains(&hit.start)))
+        .collect()
+}
+
+fn blocking_calls(function: &Function) -> Vec<Issue> {
+    let mut hits = Vec::new();
+    for captures in DB_CALL.captures_iter(&function.code) {
+        let receiver = &captures[1];
+        if is_database(receiver) {
+            let at = captures.get(0).expect("group 0").start();
+            let call = format!("{receiver}.{}", &captures[2]);
+            hits.push((at, call, format!("{}Context", &captures[2])));
+        }
+    }
+    for captures in PACKAGE_CALL.captures_iter(&function.code) {
+        let call = captures.get(1).expect("group 1");
+        hits.push((
+            call.start(),
+            call.as_str().to_string(),
+            package_replacement(call.as_str()).to_string(),
+        ));
+    }
+    hits.into_iter()
+        .map(|(at, call, replacement)| {
+            let line = function.line_of(at);
+            let message = match &function.context {
+                Some(context) => format!(
+                    "`{call}` ignores the `{context}` in scope; use {replacement} with it"
+                ),
+                None => format!(
+                    "`{call}` cannot be cancelled or time out; use {replacement} with a context from the caller"
+                ),
+            };
+            function.issue(
+                ContextCheck::Blocking,
+                line,
+                message,
+                format!("`{call}` in {}", function.name),
+            )
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    fn function(name: &str, line_start: u32, content: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "handlers/users.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("handlers.{name}"),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end: line_start + content.lines().count() as u32,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    #[test]
+    fn flags_dropped_contexts_along_call_chains_and_blocking_calls() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            function(
+                "GetUser",
+                10,
+                "func GetUser(w http.ResponseWriter, r *http.Request) {\n\tu, err := load(r.URL.Query().Get(\"id\"))\n\tgo func() {\n\t\taudit(context.Background(), u)\n\t}()\n\tnotify(context.TODO(), u, err)\n}",
+            ),
+            function(
+                "load",
+                20,
+                "func load(id string) (*User, error) {\n\tctx, cancel := context.WithTimeout(context.Background(), time.Second)\n\tdefer cancel()\n\treturn store.Find(ctx, id)\n}",
+            ),
+            function(
+                "Find",
+                30,
+                "func (s *Store) Find(ctx context.Context, id string) (*User, error) {\n\trow := s.db.QueryRow(\"SELECT name FROM users WHERE id = $1\", id)\n\t_, err := s.db.QueryContext(ctx, \"SELECT 1\")\n\treturn scan(row, err)\n}",
+            ),
+            function(
+                "ping",
+                40,
+                "func ping(url string) error {\n\t_, err := http.Get(url)\n\t// context.Background()\n\treturn err\n}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "stable::GetUser".to_string(),
+                to_symbol_id: Some("stable::load".to_string()),
+                to_name: Some("load".to_string()),
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "handlers/users.go".to_string(),
+                source_line: 11,
+            }],
+        )
+        .unwrap();
+
+        let issues = find_issues(&conn, "repo", "main").unwrap();
+        let hits: Vec<(ContextCheck, u32, &str)> = issues
+            .iter()
+            .map(|issue| (issue.check, issue.line, issue.symbol.as_str()))
+            .collect();
+        assert_eq!(
+            hits,
+            [
+                (ContextCheck::Dropped, 15, "handlers.GetUser"),
+                (ContextCheck::Dropped, 21, "handlers.load"),
+                (ContextCheck::Blocking, 31, "handlers.Find"),
+                (ContextCheck::Blocking, 41, "handlers.ping"),
+            ]
+        );
+        assert_eq!(
+            issues[1].message,
+            "`context.Background()` starts a new context although caller `handlers.GetUser` has `r.Context()`; take a context.Context parameter and pass it down"
+        );
+        assert_eq!(issues[1].evidence[1].line, Some(11));
+        assert_eq!(
+            issues[2].message,
+            "`s.db.QueryRow` ignores the `ctx` in scope; use QueryRowContext with it"
+        );
+        assert_eq!(
+            issues[3].message,
+            "`http.Get` cannot be cancelled or time out; use http.NewRequestWithContext and Client.Do with a context from the caller"
+        );
+    }
+}
@@ -0,0 +1,52 @@
+//! `//go:embed` directives whose patterns capture nothing, which `go build`
+//! rejects, and embedded files nothing refers to. Directives are resolved
+//! against the working tree at index time.
+
+use super::{Confidence, Rule, RuleCheck, Severity};
+use cruxe_core::types::EmbedRecord;
+
+pub(super) static RULES: &[Rule] = &[
+    Rule {
+        id: "go/embed-missing-file",
+        language: "go",
+        summary: "//go:embed pattern matches no files",
+        default_severity: Severity::Error,
+        confidence: Confidence::High,
+        check: RuleCheck::Embed(missing_files),
+    },
+    Rule {
+        id: "go/embed-unreferenced-asset",
+        language: "go",
+        summary: "embedded file is never referenced by name",
+        default_severity: Severity::Info,
+        confidence: Confidence::Low,
+        check: RuleCheck::Embed(unreferenced_assets),
+    },
+];
+
+fn missing_files(embed: &EmbedRecord) -> Vec<String> {
+    embed
+        .missing
+        .iter()
+        .map(|pattern| format!("pattern `{pattern}` matches no files"))
+        .collect()
+}
+
+/// Files of an FS that is served or walked as a whole are reached without
+/// their names, so only named lookups are held to this.
+fn unreferenced_assets(embed: &EmbedRecord) -> Vec<String> {
+    if embed.served {
+        return Vec::new();
+    }
+    embed
+        .files
+        .iter()
+        .filter(|file| !file.referenced)
+        .map(|file| {
+            format!(
+                "`{}` ({} bytes) is embedded but its name appears nowhere in the package or its other embedded files",
+                file.path, file.size
+            )
+        })
+        .collect()
+}
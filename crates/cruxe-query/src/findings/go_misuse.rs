@@ -0,0 +1,274 @@
+//! Common Go API misuse.
+
+use super::{Confidence, FunctionBody, Rule, RuleCheck, RuleMatch, Severity};
+use regex::Regex;
+use std::collections::{BTreeMap, BTreeSet};
+use std::sync::LazyLock;
+
+pub(super) static RULES: &[Rule] = &[
+    Rule {
+        id: "go/http-body-not-closed",
+        language: "go",
+        summary: "http.Response body is never closed",
+        default_severity: Severity::Warning,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Body(http_body_not_closed),
+    },
+    Rule {
+        id: "go/time-tick-leak",
+        language: "go",
+        summary: "time.Tick outside main leaks its ticker",
+        default_severity: Severity::Warning,
+        confidence: Confidence::High,
+        check: RuleCheck::Body(time_tick_leak),
+    },
+    Rule {
+        id: "go/append-result-discarded",
+        language: "go",
+        summary: "append result is dropped or never leaves the function",
+        default_severity: Severity::Warning,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Body(append_result_discarded),
+    },
+    Rule {
+        id: "go/waitgroup-add-in-goroutine",
+        language: "go",
+        summary: "WaitGroup.Add is called inside the goroutine it counts",
+        default_severity: Severity::Error,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Body(waitgroup_add_in_goroutine),
+    },
+];
+
+/// `resp, err := http.Get(...)`, `client.Do(req)`, `s.httpClient.Post(...)`.
+static RESPONSE_ASSIGN: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(
+        r"\b([A-Za-z_]\w*)\s*,\s*[A-Za-z_]\w*\s*:?=\s*(?:[A-Za-z_]\w*\.)*(?:http|\w*[cC]lient)\.(?:Get|Head|Post|PostForm|Do)\(",
+    )
+    .expect("valid regex")
+});
+
+static TIME_TICK: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\btime\.Tick\(").expect("valid regex"));
+
+static BLANK_APPEND: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"(?m)^\s*_\s*=\s*append\(").expect("valid regex"));
+
+/// Slice parameters in a declaration header: `items []string`.
+static SLICE_PARAM: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\b([A-Za-z_]\w*)\s+\[\]").expect("valid regex"));
+
+pub(super) static GO_FUNC: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"\bgo\s+func\s*\(").expect("valid regex"));
+
+/// `var wg sync.WaitGroup`, `wg *sync.WaitGroup`, `wg := &sync.WaitGroup{}`.
+static WAITGROUP_DECL: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"\b([A-Za-z_]\w*)\s*(?::?=\s*&?|\*?)\s*sync\.WaitGroup\b").expect("valid regex")
+});
+
+static ADD_CALL: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"\b(?:[A-Za-z_]\w*\.)*([A-Za-z_]\w*)\.Add\(").expect("valid regex")
+});
+
+fn http_body_not_closed(body: &FunctionBody<'_>) -> Vec<RuleMatch> {
+    let mut first_assign: BTreeMap<&str, usize> = BTreeMap::new();
+    for captures in RESPONSE_ASSIGN.captures_iter(&body.code) {
+        let var = captures.get(1).expect("group 1");
+        if var.as_str() != "_" {
+            first_assign.entry(var.as_str()).or_insert(var.start());
+        }
+    }
+    first_assign
+        .into_iter()
+        .filter(|(var, _)| {
+            let var = regex::escape(var);
+            let closed = Regex::new(&format!(r"\b{var}\.Body\.Close\("))
+                .is_ok_and(|re| re.is_match(&body.code));
+            // Returning the response hands the body to the caller.
+            let returned = Regex::new(&format!(r"\breturn\b[^\n]*\b{var}\b"))
+                .is_ok_and(|re| re.is_match(&body.code));
+            !closed && !returned
+        })
+        .map(|(var, offset)| RuleMatch {
+            line: body.line_of(offset),
+            message: format!(
+                "response body of `{var}` is never closed; add `defer {var}.Body.Close()` after the error check"
+            ),
+        })
+        .collect()
+}
+
+fn time_tick_leak(body: &FunctionBody<'_>) -> Vec<RuleMatch> {
+    if matches!(body.name, "main" | "init") {
+        return Vec::new();
+    }
+    TIME_TICK
+        .find_iter(&body.code)
+        .map(|hit| RuleMatch {
+            line: body.line_of(hit.start()),
+            message: format!(
+                "time.Tick cannot be stopped and leaks its ticker once `{}` returns; use time.NewTicker and defer Stop",
+                body.name
+            ),
+        })
+        .collect()
+}
+
+fn append_result_discarded(body: &FunctionBody<'_>) -> Vec<RuleMatch> {
+    let mut hits: Vec<RuleMatch> = BLANK_APPEND
+        .find_iter(&body.code)
+        .map(|hit| RuleMatch {
+            line: body.line_of(hit.end()),
+            message: "result of append is assigned to `_`, so the appended slice is lost"
+                .to_string(),
+        })
+        .collect();
+
+    // A slice parameter grown in place only changes the local copy of the
+    // slice header unless it is returned.
+    let header_len = body.header().len();
+    let params: BTreeSet<&str> = SLICE_PARAM
+        .captures_iter(body.header())
+        .filter_map(|captures| captures.get(1).map(|name| name.as_str()))
+        .collect();
+    let code = &body.code[header_len..];
+    for param in params {
+        let param = regex::escape(param);
+        let Ok(grow) = Regex::new(&format!(r"\b{param}\s*=\s*append\(\s*{param}\b")) else {
+            continue;
+        };
+        let Some(hit) = grow.find(code) else {
+            continue;
+        };
+        let escapes = Regex::new(&format!(r"\breturn\b[^\n]*\b{param}\b|&{param}\b"))
+            .is_ok_and(|re| re.is_match(code));
+        if !escapes {
+            hits.push(RuleMatch {
+                line: body.line_of(header_len + hit.start()),
+                message: format!(
+                    "append to parameter `{param}` is lost when the function returns; return the slice or take a pointer"
+                ),
+            });
+        }
+    }
+    hits
+}
+
+fn waitgroup_add_in_goroutine(body: &FunctionBody<'_>) -> Vec<RuleMatch> {
+    let mut waitgroups: BTreeSet<&str> = WAITGROUP_DECL
+        .captures_iter(&body.code)
+        .filter_map(|captures| captures.get(1).map(|name| name.as_str()))
+        .collect();
+    waitgroups.insert("wg");
+
+    let mut lines = BTreeSet::new();
+    for go in GO_FUNC.find_iter(&body.code) {
+        let Some(span) = goroutine_body(&body.code, go.end()) else {
+            continue;
+        };
+        for captures in ADD_CALL.captures_iter(&body.code[span.clone()]) {
+            let receiver = captures.get(1).expect("group 1");
+            if waitgroups.contains(receiver.as_str()) {
+                lines.insert(body.line_of(span.start + receiver.start()));
+            }
+        }
+    }
+    lines
+        .into_iter()
+        .map(|line| RuleMatch {
+            line,
+            message: "WaitGroup.Add runs inside the goroutine it counts, so Wait can return before it; call Add before the `go` statement".to_string(),
+        })
+        .collect()
+}
+
+/// Byte range of the body of a `go func(...) { ... }` literal, given the
+/// offset just past `func(`.
+pub(super) fn goroutine_body(code: &str, params_start: usize) -> Option<std::ops::Range<usize>> {
+    let bytes = code.as_bytes();
+    let mut depth = 1usize;
+    let mut at = params_start;
+    // Skip the parameter list and result types up to the opening brace.
+    while at < bytes.len() {
+        match bytes[at] {
+            b'(' => depth += 1,
+            b')' => depth = depth.saturating_sub(1),
+            b'{' if depth == 0 => break,
+            _ => {}
+        }
+        at += 1;
+    }
+    let open = at;
+    let mut braces = 0usize;
+    while at < bytes.len() {
+        match bytes[at] {
+            b'{' => braces += 1,
+            b'}' => {
+                braces -= 1;
+                if braces == 0 {
+                    return Some(open + 1..at);
+                }
+            }
+            _ => {}
+        }
+        at += 1;
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::super::blank_comments_and_strings;
+    use super::*;
+
+    fn run(check: fn(&FunctionBody<'_>) -> Vec<RuleMatch>, name: &str, src: &str) -> Vec<usize> {
+        let body = FunctionBody {
+            name,
+            code: blank_comments_and_strings(src),
+        };
+        check(&body).into_iter().map(|hit| hit.line).collect()
+    }
+
+    #[test]
+    fn http_body_must_be_closed_or_returned() {
+        let leaky = "func fetch(url string) error {\n\tresp, err := http.Get(url)\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn nil\n}";
+        assert_eq!(run(http_body_not_closed, "fetch", leaky), [1]);
+
+        let closed = "func fetch(c *http.Client, req *http.Request) error {\n\tres, err := c.httpClient.Do(req)\n\tif err != nil {\n\t\treturn err\n\t}\n\tdefer res.Body.Close()\n\treturn nil\n}";
+        assert!(run(http_body_not_closed, "fetch", closed).is_empty());
+
+        let handed_off = "func open(url string) (*http.Response, error) {\n\tresp, err := http.DefaultClient.Get(url)\n\treturn resp, err\n}";
+        assert!(run(http_body_not_closed, "open", handed_off).is_empty());
+
+        let unrelated =
+            "func load(k string) error {\n\tv, err := cache.Get(k)\n\t_ = v\n\treturn err\n}";
+        assert!(run(http_body_not_closed, "load", unrelated).is_empty());
+    }
+
+    #[test]
+    fn time_tick_is_allowed_only_in_main() {
+        let src = "func poll() {\n\tfor range time.Tick(time.Second) {\n\t}\n}";
+        assert_eq!(run(time_tick_leak, "poll", src), [1]);
+        assert!(run(time_tick_leak, "main", src).is_empty());
+        let commented = "func poll() {\n\t// time.Tick(d)\n\tlog.Print(\"time.Tick(d)\")\n}";
+        assert!(run(time_tick_leak, "poll", commented).is_empty());
+    }
+
+    #[test]
+    fn append_to_unreturned_parameter_is_lost() {
+        let src = "func add(items []string, x string) {\n\titems = append(items, x)\n\t_ = append(items, x)\n}";
+        assert_eq!(run(append_result_discarded, "add", src), [2, 1]);
+
+        let returned = "func add(items []string, x string) []string {\n\titems = append(items, x)\n\treturn items\n}";
+        assert!(run(append_result_discarded, "add", returned).is_empty());
+    }
+
+    #[test]
+    fn waitgroup_add_belongs_before_the_go_statement() {
+        let racy = "func fanOut(jobs []Job) {\n\tvar group sync.WaitGroup\n\tfor _, job := range jobs {\n\t\tgo func(j Job) {\n\t\t\tgroup.Add(1)\n\t\t\tdefer group.Done()\n\t\t\tj.Run()\n\t\t}(job)\n\t}\n\tgroup.Wait()\n}";
+        assert_eq!(run(waitgroup_add_in_goroutine, "fanOut", racy), [4]);
+
+        let correct = "func fanOut(jobs []Job, s *Server) {\n\tfor _, job := range jobs {\n\t\ts.wg.Add(1)\n\t\tgo func() {\n\t\t\tdefer s.wg.Done()\n\t\t\tcounter.Add(1)\n\t\t}()\n\t}\n}";
+        assert!(run(waitgroup_add_in_goroutine, "fanOut", correct).is_empty());
+    }
+}
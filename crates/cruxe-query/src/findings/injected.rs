@@ -0,0 +1,31 @@
+//! Syntax errors in SQL, HTML and regex strings embedded in source. The
+//! strings are checked at index time; these rules report the failures.
+
+use super::{Confidence, Rule, RuleCheck, Severity};
+
+pub(super) static RULES: &[Rule] = &[
+    Rule {
+        id: "sql/invalid-statement",
+        language: "sql",
+        summary: "SQL string is malformed (unbalanced, unterminated or dangling syntax)",
+        default_severity: Severity::Error,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Injection,
+    },
+    Rule {
+        id: "regex/invalid-pattern",
+        language: "regex",
+        summary: "regular expression does not compile",
+        default_severity: Severity::Error,
+        confidence: Confidence::High,
+        check: RuleCheck::Injection,
+    },
+    Rule {
+        id: "html/malformed-markup",
+        language: "html",
+        summary: "HTML string has unterminated or mismatched tags",
+        default_severity: Severity::Warning,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Injection,
+    },
+];
@@ -0,0 +1,197 @@
+//! Thresholds that only move down (`cruxe check --ratchet`).
+//!
+//! The ratchet file records, per metric, the best value the default branch
+//! has reached: finding counts per rule and the highest function complexity.
+//! Every run fails if a metric is worse than its threshold; a passing run on
+//! the default branch lowers each threshold to the value it measured, so an
+//! improvement can never be silently undone. The file lives in the workspace
+//! and is meant to be committed with the code.
+
+use super::{ComplexityPeak, Finding, RuleSet};
+use cruxe_core::error::StateError;
+use cruxe_core::time::now_iso8601;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::Path;
+
+/// Workspace-relative location of the ratchet file.
+pub const RATCHET_FILE: &str = ".cruxe/ratchet.json";
+
+pub const MAX_COMPLEXITY: &str = "max_complexity";
+
+/// Metric name of the finding count of one rule.
+pub fn findings_metric(rule_id: &str) -> String {
+    format!("findings:{rule_id}")
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Ratchet {
+    /// Ref whose results last tightened the thresholds.
+    #[serde(default)]
+    pub r#ref: String,
+    #[serde(default)]
+    pub updated_at: String,
+    #[serde(default)]
+    pub thresholds: BTreeMap<String, u64>,
+}
+
+/// A metric that got worse than its threshold.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Regression {
+    pub metric: String,
+    pub threshold: u64,
+    pub actual: u64,
+}
+
+/// A threshold that was set or lowered.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Tightened {
+    pub metric: String,
+    pub from: Option<u64>,
+    pub to: u64,
+}
+
+impl Ratchet {
+    /// `Ok(None)` when the file does not exist yet.
+    pub fn load(path: &Path) -> Result<Option<Self>, StateError> {
+        let raw = match std::fs::read_to_string(path) {
+            Ok(raw) => raw,
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(None),
+            Err(e) => return Err(e.into()),
+        };
+        serde_json::from_str(&raw)
+            .map(Some)
+            .map_err(|e| StateError::CorruptManifest(format!("{}: {}", path.display(), e)))
+    }
+
+    /// Write through a temp file so an interrupted run leaves the old file.
+    pub fn save(&self, path: &Path) -> Result<(), StateError> {
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)?;
+        }
+        let mut json = serde_json::to_string_pretty(self).map_err(std::io::Error::other)?;
+        json.push('\n');
+        let temp = path.with_extension("json.tmp");
+        std::fs::write(&temp, json)?;
+        std::fs::rename(&temp, path)?;
+        Ok(())
+    }
+
+    /// Metrics above their threshold. Metrics without a threshold pass.
+    pub fn regressions(&self, metrics: &BTreeMap<String, u64>) -> Vec<Regression> {
+        metrics
+            .iter()
+            .filter_map(|(metric, &actual)| {
+                let &threshold = self.thresholds.get(metric)?;
+                (actual > threshold).then(|| Regression {
+                    metric: metric.clone(),
+                    threshold,
+                    actual,
+                })
+            })
+            .collect()
+    }
+
+    /// Lower every threshold to the measured value, and start tracking new
+    /// metrics at their current value.
+    pub fn tighten(&mut self, metrics: &BTreeMap<String, u64>, ref_name: &str) -> Vec<Tightened> {
+        let mut changes = Vec::new();
+        for (metric, &actual) in metrics {
+            let current = self.thresholds.get(metric).copied();
+            if current.is_none_or(|threshold| actual < threshold) {
+                self.thresholds.insert(metric.clone(), actual);
+                changes.push(Tightened {
+                    metric: metric.clone(),
+                    from: current,
+                    to: actual,
+                });
+            }
+        }
+        if !changes.is_empty() {
+            self.r#ref = ref_name.to_string();
+            self.updated_at = now_iso8601();
+        }
+        changes
+    }
+}
+
+/// Ratcheted metrics of one check run: the finding count of every enabled
+/// rule (zero included, so a cleaned-up rule stays clean) and, when known,
+/// the highest function complexity.
+pub fn measure(
+    findings: &[Finding],
+    rules: &RuleSet,
+    peak: Option<&ComplexityPeak>,
+) -> BTreeMap<String, u64> {
+    let mut metrics: BTreeMap<String, u64> = rules
+        .enabled()
+        .map(|(rule, _)| (findings_metric(rule.id), 0))
+        .collect();
+    for finding in findings {
+        *metrics.entry(findings_metric(&finding.rule)).or_default() += 1;
+    }
+    if let Some(peak) = peak {
+        metrics.insert(MAX_COMPLEXITY.to_string(), u64::from(peak.complexity));
+    }
+    metrics
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn metrics(pairs: &[(&str, u64)]) -> BTreeMap<String, u64> {
+        pairs
+            .iter()
+            .map(|(metric, value)| (metric.to_string(), *value))
+            .collect()
+    }
+
+    #[test]
+    fn thresholds_only_move_down() {
+        let mut ratchet = Ratchet::default();
+        let first = ratchet.tighten(
+            &metrics(&[("findings:go/time-tick-leak", 3), (MAX_COMPLEXITY, 12)]),
+            "main",
+        );
+        assert_eq!(first.len(), 2);
+        assert_eq!(ratchet.r#ref, "main");
+
+        // Better on one metric, worse on the other.
+        let run = metrics(&[("findings:go/time-tick-leak", 1), (MAX_COMPLEXITY, 14)]);
+        assert_eq!(
+            ratchet.regressions(&run),
+            [Regression {
+                metric: MAX_COMPLEXITY.to_string(),
+                threshold: 12,
+                actual: 14,
+            }]
+        );
+        let changes = ratchet.tighten(&run, "main");
+        assert_eq!(
+            changes,
+            [Tightened {
+                metric: "findings:go/time-tick-leak".to_string(),
+                from: Some(3),
+                to: 1,
+            }]
+        );
+        assert_eq!(ratchet.thresholds[MAX_COMPLEXITY], 12);
+        assert!(ratchet.tighten(&run, "main").is_empty());
+    }
+
+    #[test]
+    fn ratchet_file_round_trips() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join(RATCHET_FILE);
+        assert_eq!(Ratchet::load(&path).unwrap(), None);
+
+        let mut ratchet = Ratchet::default();
+        ratchet.tighten(&metrics(&[(MAX_COMPLEXITY, 7)]), "main");
+        ratchet.save(&path).unwrap();
+        assert_eq!(Ratchet::load(&path).unwrap(), Some(ratchet));
+
+        std::fs::write(&path, "not json").unwrap();
+        assert!(Ratchet::load(&path).is_err());
+    }
+}
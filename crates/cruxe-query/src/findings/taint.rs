@@ -0,0 +1,951 @@
+//! Request input reaching SQL and shell calls.
+//!
+//! Values read from request parameters and headers are followed through
+//! assignments, into the functions they are passed to and out of the
+//! functions that return them, until they reach the query argument of a
+//! database call or any argument of a process launch. Calls between indexed
+//! functions are resolved through the call edges recorded at index time,
+//! falling back to a unique function of the same name. Like the other body
+//! rules this reads text, not types: a sanitizer is any call named in the
+//! sanitizer list, and a value built from several variables is tainted by
+//! any of them.
+
+use super::{Confidence, Evidence, EvidenceKind, Rule, RuleCheck, Severity};
+use cruxe_core::config::TaintConfig;
+use cruxe_core::error::StateError;
+use cruxe_core::types::CallEdge;
+use cruxe_state::{edges, symbols};
+use regex::Regex;
+use rusqlite::Connection;
+use std::collections::{BTreeMap, HashMap};
+use std::sync::LazyLock;
+
+pub(super) static RULES: &[Rule] = &[
+    Rule {
+        id: "go/sql-injection",
+        language: "go",
+        summary: "request input reaches the query string of a SQL call",
+        default_severity: Severity::Error,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Taint(SinkKind::Sql),
+    },
+    Rule {
+        id: "go/command-injection",
+        language: "go",
+        summary: "request input reaches a process launch",
+        default_severity: Severity::Error,
+        confidence: Confidence::Medium,
+        check: RuleCheck::Taint(SinkKind::Command),
+    },
+];
+
+/// What a sink does with its arguments.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(super) enum SinkKind {
+    /// Only the query string is checked; bind arguments are safe.
+    Sql,
+    /// Every argument is checked.
+    Command,
+}
+
+impl SinkKind {
+    /// Key of the kind under `[taint.sinks]`.
+    fn as_str(self) -> &'static str {
+        match self {
+            Self::Sql => "sql",
+            Self::Command => "command",
+        }
+    }
+
+    fn advice(self) -> &'static str {
+        match self {
+            Self::Sql => "pass it as a query parameter instead",
+            Self::Command => "check it against an allowlist before running it",
+        }
+    }
+}
+
+/// Request parameters, headers, form values and cookies of `net/http` and
+/// the common routers.
+const SOURCES: &[&str] = &[
+    "Header.Get",
+    "Header.Values",
+    "Headers",
+    "URL.Query",
+    "URL.RawQuery",
+    "URL.Path",
+    "FormValue",
+    "PostFormValue",
+    "Form.Get",
+    "PostForm.Get",
+    "Cookie",
+    "PathValue",
+    "mux.Vars",
+    "Param",
+    "QueryParam",
+    "DefaultQuery",
+    "GetHeader",
+];
+
+const SQL_SINKS: &[&str] = &[
+    "db.Query",
+    "db.QueryRow",
+    "db.QueryContext",
+    "db.QueryRowContext",
+    "db.Exec",
+    "db.ExecContext",
+    "db.Execute",
+    "db.Prepare",
+    "db.PrepareContext",
+    "db.Raw",
+    "tx.Query",
+    "tx.QueryRow",
+    "tx.QueryContext",
+    "tx.QueryRowContext",
+    "tx.Exec",
+    "tx.ExecContext",
+];
+
+const COMMAND_SINKS: &[&str] = &[
+    "exec.Command",
+    "exec.CommandContext",
+    "syscall.Exec",
+    "os.StartProcess",
+];
+
+const SANITIZERS: &[&str] = &[
+    "strconv.Atoi",
+    "strconv.ParseInt",
+    "strconv.ParseUint",
+    "strconv.ParseFloat",
+    "strconv.ParseBool",
+    "strconv.Quote",
+    "url.QueryEscape",
+    "url.PathEscape",
+    "html.EscapeString",
+    "uuid.Parse",
+    "pq.QuoteIdentifier",
+    "pq.QuoteLiteral",
+    "len",
+];
+
+/// Interprocedural rounds before giving up on a fixpoint; each round carries
+/// taint one call deeper.
+const MAX_ROUNDS: usize = 16;
+
+const KEYWORDS: &[&str] = &[
+    "if",
+    "for",
+    "switch",
+    "select",
+    "func",
+    "return",
+    "go",
+    "defer",
+    "range",
+    "case",
+    "chan",
+    "map",
+    "struct",
+    "interface",
+    "var",
+    "const",
+    "type",
+    "else",
+];
+
+/// `pkg.Func(`, `h.db.Query(`, `handle(`.
+static CALL: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"((?:[A-Za-z_]\w*\.)*[A-Za-z_]\w*)\s*\(").expect("valid regex"));
+
+static IDENT: LazyLock<Regex> = LazyLock::new(|| Regex::new(r"[A-Za-z_]\w*").expect("valid regex"));
+
+/// Sources, sinks and sanitizers: the built-in lists plus `[taint]`.
+#[derive(Debug, Clone)]
+pub(super) struct Patterns {
+    sources: Vec<String>,
+    sinks: Vec<(SinkKind, String)>,
+    sanitizers: Vec<String>,
+}
+
+impl Patterns {
+    pub(super) fn new(config: &TaintConfig) -> Self {
+        let extend = |builtin: &[&str], extra: &[String]| -> Vec<String> {
+            builtin
+                .iter()
+                .map(|pattern| pattern.to_string())
+                .chain(extra.iter().map(|pattern| pattern.trim().to_string()))
+                .filter(|pattern| !pattern.is_empty())
+                .collect()
+        };
+        let configured = |kind: SinkKind| {
+            config
+                .sinks
+                .get(kind.as_str())
+                .map(Vec::as_slice)
+                .unwrap_or_default()
+        };
+        let mut sinks = Vec::new();
+        for (kind, builtin) in [
+            (SinkKind::Sql, SQL_SINKS),
+            (SinkKind::Command, COMMAND_SINKS),
+        ] {
+            sinks.extend(
+                extend(builtin, configured(kind))
+                    .into_iter()
+                    .map(|pattern| (kind, pattern)),
+            );
+        }
+        Self {
+            sources: extend(SOURCES, &config.sources),
+            sinks,
+            sanitizers: extend(SANITIZERS, &config.sanitizers),
+        }
+    }
+
+    /// Unknown `[taint.sinks]` kinds.
+    pub(super) fn warnings(config: &TaintConfig) -> Vec<String> {
+        config
+            .sinks
+            .keys()
+            .filter(|kind| !matches!(kind.as_str(), "sql" | "command"))
+            .map(|kind| format!("unknown sink kind `{kind}` in [taint.sinks] (sql, command)"))
+            .collect()
+    }
+
+    fn sink(&self, callee: &str) -> Option<(SinkKind, &str)> {
+        self.sinks
+            .iter()
+            .find(|(_, pattern)| selector_matches(callee, pattern))
+            .map(|(kind, pattern)| (*kind, pattern.as_str()))
+    }
+
+    fn is_sanitizer(&self, callee: &str) -> bool {
+        self.sanitizers
+            .iter()
+            .any(|pattern| selector_matches(callee, pattern))
+    }
+
+    /// First source read in `expr`.
+    fn source_in<'e>(&self, expr: &'e str) -> Option<&'e str> {
+        self.sources.iter().find_map(|pattern| {
+            find_selector(expr, pattern).map(|at| &expr[at..at + pattern.len()])
+        })
+    }
+}
+
+/// One path from a source to a sink.
+#[derive(Debug, Clone)]
+pub(super) struct Flow {
+    pub kind: SinkKind,
+    pub path: String,
+    pub line: u32,
+    pub symbol: String,
+    pub symbol_id: String,
+    pub message: String,
+    pub evidence: Vec<Evidence>,
+}
+
+/// How a value came to carry request input.
+#[derive(Debug, Clone)]
+struct Trace {
+    /// The source expression the value was read from.
+    origin: String,
+    steps: Vec<Evidence>,
+}
+
+impl Trace {
+    fn then(&self, kind: EvidenceKind, detail: String, path: &str, line: u32) -> Self {
+        let mut next = self.clone();
+        next.steps.push(Evidence::at(kind, detail, path, line));
+        next
+    }
+}
+
+/// A Go function body split into statements.
+struct Function {
+    id: String,
+    name: String,
+    qualified_name: String,
+    path: String,
+    params: Vec<String>,
+    statements: Vec<Statement>,
+}
+
+struct Statement {
+    line: u32,
+    text: String,
+}
+
+/// What one pass over a function found, given the taint of its parameters
+/// and the functions it calls.
+#[derive(Default)]
+struct Outcome {
+    returns: Option<Trace>,
+    /// Callee, parameter index and how the argument got tainted.
+    calls: Vec<(usize, usize, Trace)>,
+    flows: Vec<Flow>,
+}
+
+/// Follow request input through every Go function of a repo/ref and return
+/// each path that reaches a sink, ordered by path and line.
+pub(super) fn find_flows(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    patterns: &Patterns,
+) -> Result<Vec<Flow>, StateError> {
+    let mut functions = Vec::new();
+    symbols::for_each_function_body(conn, repo, ref_name, "go", |symbol| {
+        let Some(content) = symbol.content.as_deref() else {
+            return Ok(());
+        };
+        let code = super::blank_comments_and_strings(content);
+        functions.push(Function {
+            id: symbol.symbol_stable_id,
+            name: symbol.name,
+            qualified_name: symbol.qualified_name,
+            path: symbol.path,
+            params: parameter_names(&code),
+            statements: statements(&code, symbol.line_start),
+        });
+        Ok(())
+    })?;
+    let mut callees = Vec::with_capacity(functions.len());
+    for function in &functions {
+        callees.push(edges::get_callees(conn, repo, ref_name, &function.id)?);
+    }
+    let graph = Graph::new(&functions, &callees);
+
+    let mut seeds: Vec<BTreeMap<usize, Trace>> = vec![BTreeMap::new(); functions.len()];
+    let mut returns: Vec<Option<Trace>> = vec![None; functions.len()];
+    let mut flows = Vec::new();
+    for _ in 0..MAX_ROUNDS {
+        let mut changed = false;
+        flows.clear();
+        for (index, function) in functions.iter().enumerate() {
+            let outcome = analyze(index, function, &seeds[index], &returns, &graph, patterns);
+            if returns[index].is_none() && outcome.returns.is_some() {
+                returns[index] = outcome.returns;
+                changed = true;
+            }
+            for (callee, param, trace) in outcome.calls {
+                if param < functions[callee].params.len() && !seeds[callee].contains_key(&param) {
+                    seeds[callee].insert(param, trace);
+                    changed = true;
+                }
+            }
+            flows.extend(outcome.flows);
+        }
+        if !changed {
+            break;
+        }
+    }
+    flows.sort_by(|a, b| (a.path.as_str(), a.line).cmp(&(b.path.as_str(), b.line)));
+    flows.dedup_by(|a, b| (a.path.as_str(), a.line, a.kind) == (b.path.as_str(), b.line, b.kind));
+    Ok(flows)
+}
+
+/// Resolves calls between indexed functions.
+struct Graph<'a> {
+    functions: &'a [Function],
+    callees: &'a [Vec<CallEdge>],
+    by_id: HashMap<&'a str, usize>,
+    by_name: HashMap<&'a str, Vec<usize>>,
+}
+
+impl<'a> Graph<'a> {
+    fn new(functions: &'a [Function], callees: &'a [Vec<CallEdge>]) -> Self {
+        let mut by_id = HashMap::new();
+        let mut by_name: HashMap<&str, Vec<usize>> = HashMap::new();
+        for (index, function) in functions.iter().enumerate() {
+            by_id.insert(function.id.as_str(), index);
+            by_name
+                .entry(function.name.as_str())
+                .or_default()
+                .push(index);
+        }
+        Self {
+            functions,
+            callees,
+            by_id,
+            by_name,
+        }
+    }
+
+    /// The function `callee` names in a statement of `caller` at `line`:
+    /// the resolved call edge on that line, else the only function with that
+    /// name.
+    fn resolve(&self, caller: usize, line: u32, callee: &str) -> Option<usize> {
+        let name = last_segment(callee);
+        let edge = self.callees[caller].iter().find(|edge| {
+            edge.source_line == line
+                && edge.source_file == self.functions[caller].path
+                && edge
+                    .to_name
+                    .as_deref()
+                    .is_some_and(|to| last_segment(to) == name)
+        });
+        if let Some(edge) = edge {
+            return edge
+                .to_symbol_id
+                .as_deref()
+                .and_then(|id| self.by_id.get(id).copied());
+        }
+        match self.by_name.get(name).map(Vec::as_slice) {
+            Some([only]) => Some(*only),
+            _ => None,
+        }
+    }
+}
+
+fn analyze(
+    index: usize,
+    function: &Function,
+    seeds: &BTreeMap<usize, Trace>,
+    returns: &[Option<Trace>],
+    graph: &Graph<'_>,
+    patterns: &Patterns,
+) -> Outcome {
+    let mut tainted: HashMap<String, Trace> = seeds
+        .iter()
+        .filter_map(|(param, trace)| Some((function.params.get(*param)?.clone(), trace.clone())))
+        .collect();
+    let taint_of = |expr: &str, line: u32, tainted: &HashMap<String, Trace>| {
+        expression_taint(
+            expr, line, index, function, tainted, returns, graph, patterns,
+        )
+    };
+
+    // Twice, so a value tainted late in a loop body reaches its earlier lines.
+    for _ in 0..2 {
+        for statement in &function.statements {
+            let Some((targets, value)) = split_assignment(&statement.text) else {
+                continue;
+            };
+            let Some(trace) = taint_of(value, statement.line, &tainted) else {
+                continue;
+            };
+            let fresh: Vec<&str> = targets
+                .into_iter()
+                .filter(|target| !tainted.contains_key(*target))
+                .collect();
+            if fresh.is_empty() {
+                continue;
+            }
+            let step = trace.then(
+                EvidenceKind::DataFlow,
+                format!("assigned to `{}` in {}", fresh.join("`, `"), function.name),
+                &function.path,
+                statement.line,
+            );
+            for target in fresh {
+                tainted.insert(target.to_string(), step.clone());
+            }
+        }
+    }
+
+    let mut outcome = Outcome::default();
+    for statement in &function.statements {
+        let text = statement.text.as_str();
+        if let Some(value) = text.strip_prefix("return ")
+            && outcome.returns.is_none()
+            && let Some(trace) = taint_of(value, statement.line, &tainted)
+        {
+            outcome.returns = Some(trace.then(
+                EvidenceKind::DataFlow,
+                format!("returned from {}", function.name),
+                &function.path,
+                statement.line,
+            ));
+        }
+        for call in CALL.captures_iter(text) {
+            let callee = call.get(1).expect("group 1");
+            if KEYWORDS.contains(&callee.as_str()) || patterns.is_sanitizer(callee.as_str()) {
+                continue;
+            }
+            let args = call_arguments(text, call.get(0).expect("match").end());
+            if let Some((kind, sink)) = patterns.sink(callee.as_str()) {
+                let checked: &[&str] = match kind {
+                    SinkKind::Sql => {
+                        let query = usize::from(sink.ends_with("Context"));
+                        args.get(query..query + 1).unwrap_or_default()
+                    }
+                    SinkKind::Command => &args,
+                };
+                if let Some(trace) = checked
+                    .iter()
+                    .find_map(|arg| taint_of(arg, statement.line, &tainted))
+                {
+                    outcome.flows.push(flow(
+                        function,
+                        statement.line,
+                        kind,
+                        callee.as_str(),
+                        trace,
+                    ));
+                }
+                continue;
+            }
+            let Some(target) = graph.resolve(index, statement.line, callee.as_str()) else {
+                continue;
+            };
+            for (param, arg) in args.iter().enumerate() {
+                let Some(trace) = taint_of(arg, statement.line, &tainted) else {
+                    continue;
+                };
+                let callee_fn = &graph.functions[target];
+                let name = callee_fn.params.get(param).map_or("?", String::as_str);
+                outcome.calls.push((
+                    target,
+                    param,
+                    trace.then(
+                        EvidenceKind::Edge,
+                        format!(
+                            "{} passes it to {} as `{name}`",
+                            function.name, callee_fn.qualified_name
+                        ),
+                        &function.path,
+                        statement.line,
+                    ),
+                ));
+            }
+        }
+    }
+    outcome
+}
+
+fn flow(function: &Function, line: u32, kind: SinkKind, sink: &str, trace: Trace) -> Flow {
+    let trace = trace.then(
+        EvidenceKind::DataFlow,
+        format!("reaches `{sink}` in {}", function.name),
+        &function.path,
+        line,
+    );
+    Flow {
+        kind,
+        path: function.path.clone(),
+        line,
+        symbol: function.qualified_name.clone(),
+        symbol_id: function.id.clone(),
+        message: format!(
+            "request input from `{}` reaches `{sink}`; {}",
+            trace.origin,
+            kind.advice()
+        ),
+        evidence: trace.steps,
+    }
+}
+
+/// Taint of an expression: a source read in it, a tainted variable it
+/// mentions, or a call to a function that returns request input. A value
+/// wrapped in a sanitizer call is clean.
+#[allow(clippy::too_many_arguments)]
+fn expression_taint(
+    expr: &str,
+    line: u32,
+    index: usize,
+    function: &Function,
+    tainted: &HashMap<String, Trace>,
+    returns: &[Option<Trace>],
+    graph: &Graph<'_>,
+    patterns: &Patterns,
+) -> Option<Trace> {
+    let expr = expr.trim();
+    if let Some(call) = CALL.captures(expr)
+        && call.get(0).expect("match").start() == 0
+        && patterns.is_sanitizer(&call[1])
+    {
+        return None;
+    }
+    if let Some(source) = patterns.source_in(expr) {
+        return Some(Trace {
+            origin: source.to_string(),
+            steps: vec![Evidence::at(
+                EvidenceKind::DataFlow,
+                format!("`{source}` reads request input in {}", function.name),
+                &function.path,
+                line,
+            )],
+        });
+    }
+    for ident in IDENT.find_iter(expr) {
+        if expr[..ident.start()].ends_with('.') {
+            continue;
+        }
+        if let Some(trace) = tainted.get(ident.as_str()) {
+            return Some(trace.clone());
+        }
+    }
+    for call in CALL.captures_iter(expr) {
+        let callee = call.get(1).expect("group 1").as_str();
+        if KEYWORDS.contains(&callee) {
+            continue;
+        }
+        let Some(target) = graph.resolve(index, line, callee) else {
+            continue;
+        };
+        if let Some(trace) = &returns[target] {
+            return Some(trace.then(
+                EvidenceKind::Edge,
+                format!("{} gets it from `{callee}`", function.name),
+                &function.path,
+                line,
+            ));
+        }
+    }
+    None
+}
+
+/// Variables an assignment, declaration or `range` clause writes, and the
+/// expression it reads. Selector and index targets taint their base
+/// variable.
+fn split_assignment(statement: &str) -> Option<(Vec<&str>, &str)> {
+    let mut text = statement.trim();
+    for prefix in ["else ", "if ", "for ", "switch ", "var "] {
+        text = text.strip_prefix(prefix).unwrap_or(text).trim_start();
+    }
+    let bytes = text.as_bytes();
+    let mut depth = 0i32;
+    let mut at = None;
+    for (i, &b) in bytes.iter().enumerate() {
+        match b {
+            b'(' | b'[' => depth += 1,
+            b')' | b']' => depth -= 1,
+            b'=' if depth == 0 => {
+                let prev = i.checked_sub(1).map(|p| bytes[p]);
+                let next = bytes.get(i + 1).copied();
+                if next == Some(b'=') || matches!(prev, Some(b'=' | b'!' | b'<' | b'>')) {
+                    continue;
+                }
+                at = Some(i);
+                break;
+            }
+            _ => {}
+        }
+    }
+    let at = at?;
+    let lhs = text[..at].trim_end_matches([':', '+', '-', '*', '/', '|', '&']);
+    let value = text[at + 1..].trim();
+    let value = value.strip_prefix("range ").unwrap_or(value);
+    let targets: Vec<&str> = lhs
+        .split(',')
+        .filter_map(|target| {
+            let target = target.trim().trim_start_matches('*');
+            let target = target.split_whitespace().next()?;
+            let base = target.split(['.', '[']).next()?;
+            let is_ident = base
+                .chars()
+                .next()
+                .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+                && base.chars().all(|c| c.is_ascii_alphanumeric() || c == '_');
+            (is_ident && base != "_").then_some(base)
+        })
+        .collect();
+    (!targets.is_empty()).then_some((targets, value))
+}
+
+/// Parameter names of a Go function or method declaration, receiver
+/// excluded; empty for unnamed parameters.
+fn parameter_names(code: &str) -> Vec<String> {
+    let header = code.find('{').map_or(code, |at| &code[..at]);
+    let Some(rest) = header.trim_start().strip_prefix("func") else {
+        return Vec::new();
+    };
+    let mut rest = rest.trim_start();
+    if rest.starts_with('(') {
+        let Some(end) = closing(rest, 0) else {
+            return Vec::new();
+        };
+        rest = rest[end + 1..].trim_start();
+    }
+    let Some(open) = rest.find('(') else {
+        return Vec::new();
+    };
+    let Some(close) = closing(rest, open) else {
+        return Vec::new();
+    };
+    let pieces = split_top_level(&rest[open + 1..close]);
+    let named = pieces.iter().any(|piece| {
+        let mut words = piece.split_whitespace();
+        words.next().is_some_and(|first| !KEYWORDS.contains(&first)) && words.next().is_some()
+    });
+    if !named {
+        return Vec::new();
+    }
+    pieces
+        .iter()
+        .filter_map(|piece| piece.split_whitespace().next())
+        .map(str::to_string)
+        .collect()
+}
+
+/// Split a body into statements at line breaks, `;`, `{` and `}` outside
+/// parentheses and brackets; each keeps the absolute line it starts on.
+fn statements(code: &str, line_start: u32) -> Vec<Statement> {
+    let body = code.find('{').map_or("", |at| &code[at + 1..]);
+    let mut line = line_start + code[..code.len() - body.len()].matches('\n').count() as u32;
+    let mut out = Vec::new();
+    let mut current = String::new();
+    let mut current_line = line;
+    let mut depth = 0i32;
+    for c in body.chars() {
+        let ends = depth <= 0 && matches!(c, '\n' | ';' | '{' | '}');
+        if ends {
+            let text = current.split_whitespace().collect::<Vec<_>>().join(" ");
+            if !text.is_empty() {
+                out.push(Statement {
+                    line: current_line,
+                    text,
+                });
+            }
+            current.clear();
+        } else {
+            match c {
+                '(' | '[' => depth += 1,
+                ')' | ']' => depth -= 1,
+                _ => {}
+            }
+            if current.trim().is_empty() {
+                current_line = line;
+            }
+            current.push(c);
+        }
+        if c == '\n' {
+            line += 1;
+        }
+    }
+    out
+}
+
+/// Top-level, comma-separated arguments of the call whose `(` ends at
+/// `start`.
+fn call_arguments(text: &str, start: usize) -> Vec<&str> {
+    let Some(end) = closing(text, start - 1) else {
+        return split_top_level(&text[start..]);
+    };
+    split_top_level(&text[start..end])
+}
+
+/// Byte offset of the bracket closing the one at `open`.
+fn closing(text: &str, open: usize) -> Option<usize> {
+    let mut depth = 0i32;
+    for (i, b) in text.bytes().enumerate().skip(open) {
+        match b {
+            b'(' | b'[' | b'{' => depth += 1,
+            b')' | b']' | b'}' => {
+                depth -= 1;
+                if depth == 0 {
+                    return Some(i);
+                }
+            }
+            _ => {}
+        }
+    }
+    None
+}
+
+fn split_top_level(text: &str) -> Vec<&str> {
+    let mut parts = Vec::new();
+    let mut depth = 0i32;
+    let mut start = 0;
+    for (i, b) in text.bytes().enumerate() {
+        match b {
+            b'(' | b'[' | b'{' => depth += 1,
+            b')' | b']' | b'}' => depth -= 1,
+            b',' if depth == 0 => {
+                parts.push(text[start..i].trim());
+                start = i + 1;
+            }
+            _ => {}
+        }
+    }
+    parts.push(text[start..].trim());
+    parts.retain(|part| !part.is_empty());
+    parts
+}
+
+fn last_segment(name: &str) -> &str {
+    name.rsplit(['.', ':']).next().unwrap_or(name)
+}
+
+/// Whether a called name (`h.db.Query`) is `pattern` (`db.Query`) or ends
+/// with it at a `.`.
+fn selector_matches(callee: &str, pattern: &str) -> bool {
+    callee == pattern
+        || callee
+            .strip_suffix(pattern)
+            .is_some_and(|head| head.ends_with('.'))
+}
+
+/// Offset of `pattern` in `expr` where it is not part of a longer name.
+fn find_selector(expr: &str, pattern: &str) -> Option<usize> {
+    let is_ident = |c: char| c.is_ascii_alphanumeric() || c == '_';
+    expr.match_indices(pattern).map(|(at, _)| at).find(|&at| {
+        let before = expr[..at].chars().next_back();
+        let after = expr[at + pattern.len()..].chars().next();
+        !before.is_some_and(is_ident) && !after.is_some_and(is_ident)
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    #[test]
+    fn assignments_name_their_targets() {
+        assert_eq!(
+            split_assignment("rows, err := h.db.Query(q)"),
+            Some((vec!["rows", "err"], "h.db.Query(q)"))
+        );
+        assert_eq!(
+            split_assignment("for _, v := range items"),
+            Some((vec!["v"], "items"))
+        );
+        assert_eq!(
+            split_assignment("var q string = build(id)"),
+            Some((vec!["q"], "build(id)"))
+        );
+        assert_eq!(
+            split_assignment("u.Name += name"),
+            Some((vec!["u"], "name"))
+        );
+        assert_eq!(split_assignment("if a == b"), None);
+        assert_eq!(split_assignment("x <= limit"), None);
+    }
+
+    #[test]
+    fn parameters_skip_the_receiver_and_unnamed_types() {
+        assert_eq!(
+            parameter_names("func (h *H) get(id, name string, opts ...Option) error {"),
+            ["id", "name", "opts"]
+        );
+        assert!(parameter_names("func f(string, int) {").is_empty());
+        assert!(parameter_names("func f() {").is_empty());
+    }
+
+    #[test]
+    fn sinks_match_at_selector_boundaries() {
+        assert!(selector_matches("h.db.Query", "db.Query"));
+        assert!(selector_matches("exec.Command", "exec.Command"));
+        assert!(!selector_matches("mydb.Query", "db.Query"));
+        assert_eq!(find_selector("req.Headers[x]", "Headers"), Some(4));
+        assert_eq!(find_selector("req.HeadersMap[x]", "Headers"), None);
+    }
+
+    fn function(path: &str, name: &str, line_start: u32, content: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("handlers.{name}"),
+            kind: SymbolKind::Method,
+            signature: None,
+            line_start,
+            line_end: line_start + content.lines().count() as u32,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    #[test]
+    fn header_flows_through_calls_into_a_formatted_query() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            function(
+                "request.go",
+                "HandleRequest",
+                10,
+                "func (h *RequestHandler) HandleRequest(req *Request) *Response {\n\tclaims, err := h.authenticate(req)\n\tif err != nil {\n\t\treturn nil\n\t}\n\treturn h.handleGetUser(claims.Sub)\n}",
+            ),
+            function(
+                "request.go",
+                "authenticate",
+                20,
+                "func (h *RequestHandler) authenticate(req *Request) (*Claims, error) {\n\theader, ok := req.Headers[\"authorization\"]\n\tif !ok {\n\t\treturn nil, errMissing\n\t}\n\treturn h.auth.ValidateToken(header)\n}",
+            ),
+            function(
+                "request.go",
+                "handleGetUser",
+                30,
+                "func (h *RequestHandler) handleGetUser(userID string) *Response {\n\trows, err := h.db.Query(fmt.Sprintf(\"SELECT * FROM users WHERE id = '%s'\", userID))\n\t_, _ = h.db.Query(\"SELECT * FROM users WHERE id = $1\", userID)\n\treturn respond(rows, err)\n}",
+            ),
+            function(
+                "request.go",
+                "handleLookup",
+                40,
+                "func (h *RequestHandler) handleLookup(req *Request) {\n\tn, _ := strconv.Atoi(req.Headers[\"x-id\"])\n\th.db.Query(fmt.Sprintf(\"SELECT %d\", n))\n\texec.Command(\"sh\", \"-c\", req.Headers[\"x-cmd\"]).Run()\n}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+
+        let flows = find_flows(
+            &conn,
+            "repo",
+            "main",
+            &Patterns::new(&TaintConfig::default()),
+        )
+        .unwrap();
+        let hits: Vec<(SinkKind, u32, &str)> = flows
+            .iter()
+            .map(|flow| (flow.kind, flow.line, flow.symbol.as_str()))
+            .collect();
+        assert_eq!(
+            hits,
+            [
+                (SinkKind::Sql, 31, "handlers.handleGetUser"),
+                (SinkKind::Command, 43, "handlers.handleLookup"),
+            ]
+        );
+        assert_eq!(
+            flows[0].message,
+            "request input from `Headers` reaches `h.db.Query`; pass it as a query parameter instead"
+        );
+        let steps: Vec<(EvidenceKind, Option<u32>)> = flows[0]
+            .evidence
+            .iter()
+            .map(|step| (step.kind, step.line))
+            .collect();
+        assert_eq!(
+            steps,
+            [
+                (EvidenceKind::DataFlow, Some(21)),
+                (EvidenceKind::DataFlow, Some(21)),
+                (EvidenceKind::DataFlow, Some(25)),
+                (EvidenceKind::Edge, Some(11)),
+                (EvidenceKind::DataFlow, Some(11)),
+                (EvidenceKind::Edge, Some(15)),
+                (EvidenceKind::DataFlow, Some(31)),
+            ]
+        );
+    }
+
+    #[test]
+    fn configured_sources_and_sinks_are_added() {
+        let mut config = TaintConfig::default();
+        config.sources.push("ctx.Arg".to_string());
+        config
+            .sinks
+            .insert("sql".to_string(), vec!["store.RawQuery".to_string()]);
+        config.sinks.insert("shell".to_string(), Vec::new());
+        let patterns = Patterns::new(&config);
+        assert_eq!(patterns.source_in("ctx.Arg(0)"), Some("ctx.Arg"));
+        assert_eq!(
+            patterns.sink("s.store.RawQuery"),
+            Some((SinkKind::Sql, "store.RawQuery"))
+        );
+        assert!(patterns.sink("exec.Command").is_some());
+        assert_eq!(Patterns::warnings(&config).len(), 1);
+    }
+}
@@ -0,0 +1,13 @@
+//! Go templates reading fields their data does not have. The cross-check
+//! itself lives in [`crate::templates`].
+
+use super::{Confidence, Rule, RuleCheck, Severity};
+
+pub(super) static RULES: &[Rule] = &[Rule {
+    id: "go/template-unknown-field",
+    language: "go",
+    summary: "template reads a field the struct it is executed with does not have",
+    default_severity: Severity::Warning,
+    confidence: Confidence::Medium,
+    check: RuleCheck::Template,
+}];
@@ -1,4 +1,4 @@
-use cruxe_core::types::{FreshnessPolicy, FreshnessStatus};
+use cruxe_core::types::{FreshnessPolicy, FreshnessStatus, SymlinkPolicy};
 use cruxe_indexer::scanner;
 use rusqlite::Connection;
 use std::path::Path;
@@ -52,6 +52,7 @@ pub fn check_freshness(
         r#ref,
         cruxe_core::constants::MAX_FILE_SIZE,
         None,
+        SymlinkPolicy::default(),
     )
 }
 
@@ -62,6 +63,7 @@ pub fn check_freshness_with_scan_params(
     r#ref: &str,
     max_file_size: u64,
     languages: Option<&[String]>,
+    symlinks: SymlinkPolicy,
 ) -> FreshnessResult {
     let Some(conn) = conn else {
         // No DB connection — assume fresh (can't check)
@@ -90,6 +92,7 @@ pub fn check_freshness_with_scan_params(
             &branch_state.last_indexed_commit,
             max_file_size,
             languages,
+            symlinks,
         );
     }
 
@@ -144,6 +147,7 @@ fn check_single_version_freshness(
     fallback_last_indexed: &str,
     max_file_size: u64,
     languages: Option<&[String]>,
+    symlinks: SymlinkPolicy,
 ) -> FreshnessResult {
     if !workspace.exists() {
         return FreshnessResult::Fresh;
@@ -214,17 +218,26 @@ fn check_single_version_freshness(
         _ => indexed_languages.into_iter().collect(),
     };
     language_filter.sort();
-    let scanned = if language_filter.is_empty() {
-        scanner::scan_directory(workspace, max_file_size)
-    } else {
-        scanner::scan_directory_filtered(workspace, max_file_size, &language_filter)
-    };
+    let scanned = scanner::scan_directory_with_ignores(
+        workspace,
+        max_file_size,
+        &language_filter,
+        true,
+        symlinks,
+        &mut Vec::new(),
+    );
     let scanned_paths: std::collections::HashSet<String> =
         scanned.into_iter().map(|f| f.relative_path).collect();
 
+    // Files the last run skipped (binary, minified, ...) are never in the
+    // manifest.
+    let skipped_paths: std::collections::HashSet<String> =
+        cruxe_state::skipped_files::list_for_ref(conn, project_id, r#ref)
+            .map(|records| records.into_iter().map(|record| record.path).collect())
+            .unwrap_or_default();
     let new_indexable_paths: Vec<&str> = scanned_paths
         .iter()
-        .filter(|p| !manifest_paths.contains(*p))
+        .filter(|p| !manifest_paths.contains(*p) && !skipped_paths.contains(*p))
         .map(|p| p.as_str())
         .collect();
     if !new_indexable_paths.is_empty() {
@@ -0,0 +1,497 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use std::collections::HashSet;
+
+use crate::search::{SearchResult, StableResultIdInput, compute_stable_result_id};
+
+/// Kind, package and language scoping shared by lexical and fuzzy symbol hits.
+#[derive(Debug, Clone, Default)]
+pub struct SymbolFilter {
+    /// Keep only these kinds; empty keeps every kind.
+    pub kinds: Vec<SymbolKind>,
+    /// Directory prefix (`src/auth`) or qualified-name prefix (`auth::token`).
+    pub package: Option<String>,
+    pub language: Option<String>,
+}
+
+impl SymbolFilter {
+    /// Whether a lexical result survives the kind and package filters.
+    /// Results without a symbol kind (files, snippets) are dropped once a
+    /// kind filter is set.
+    pub fn matches_result(&self, result: &SearchResult) -> bool {
+        if !self.kinds.is_empty() {
+            let kind = result.kind.as_deref().and_then(SymbolKind::parse_kind);
+            if !kind.is_some_and(|kind| self.kinds.contains(&kind)) {
+                return false;
+            }
+        }
+        self.in_package(&result.path, result.qualified_name.as_deref())
+    }
+
+    pub(crate) fn matches_symbol(&self, symbol: &SymbolRecord) -> bool {
+        (self.kinds.is_empty() || self.kinds.contains(&symbol.kind))
+            && self
+                .language
+                .as_deref()
+                .is_none_or(|language| symbol.language == language)
+            && self.in_package(&symbol.path, Some(&symbol.qualified_name))
+    }
+
+    fn in_package(&self, path: &str, qualified_name: Option<&str>) -> bool {
+        let Some(package) = self.package.as_deref() else {
+            return true;
+        };
+        let dir = package.trim_end_matches('/');
+        if path == dir || path.starts_with(&format!("{dir}/")) {
+            return true;
+        }
+        qualified_name.is_some_and(|qualified| {
+            ["::", "."]
+                .iter()
+                .any(|sep| qualified.starts_with(&format!("{package}{sep}")))
+        })
+    }
+}
+
+/// Parse a comma-separated `--kind` list. `type` stands for every type-like
+/// kind (struct, class, enum, trait, interface, type alias).
+pub fn parse_kinds(spec: &str) -> Result<Vec<SymbolKind>, String> {
+    let mut kinds = Vec::new();
+    for token in spec.split(',').map(str::trim).filter(|t| !t.is_empty()) {
+        let token = token.to_ascii_lowercase();
+        let expanded = match token.as_str() {
+            "type" | "types" => vec![
+                SymbolKind::Struct,
+                SymbolKind::Class,
+                SymbolKind::Enum,
+                SymbolKind::Trait,
+                SymbolKind::Interface,
+                SymbolKind::TypeAlias,
+            ],
+            other => vec![
+                SymbolKind::parse_kind(other)
+                    .ok_or_else(|| format!("unknown symbol kind `{other}`"))?,
+            ],
+        };
+        for kind in expanded {
+            if !kinds.contains(&kind) {
+                kinds.push(kind);
+            }
+        }
+    }
+    Ok(kinds)
+}
+
+/// Whether `query` looks like a symbol name worth fuzzy-matching.
+pub fn is_identifier(query: &str) -> bool {
+    let mut chars = query.chars();
+    chars.next().is_some_and(|c| c.is_alphabetic() || c == '_')
+        && chars.all(|c| c.is_alphanumeric() || c == '_')
+}
+
+/// Score `name` against `query`, or `None` when it does not match.
+///
+/// Tiers, best first: exact, exact ignoring case, prefix, camel-hump
+/// (`hGU` → `handleGetUser`, `gu` → `get_user`) and plain subsequence.
+/// Within a tier, names closer in length to the query rank higher.
+pub fn score(query: &str, name: &str) -> Option<f32> {
+    if query.is_empty() || name.is_empty() {
+        return None;
+    }
+    let q: Vec<char> = query.chars().collect();
+    let n: Vec<char> = name.chars().collect();
+    let coverage = (q.len() as f32 / n.len() as f32).min(1.0);
+    if query == name {
+        return Some(1.0);
+    }
+    if query.eq_ignore_ascii_case(name) {
+        return Some(0.95);
+    }
+    if q.len() <= n.len() && q.iter().zip(&n).all(|(a, b)| chars_eq(*a, *b)) {
+        return Some(0.8 + 0.1 * coverage);
+    }
+    if hump_match(&q, &n) {
+        return Some(0.55 + 0.2 * coverage);
+    }
+    if subsequence(&q, &n) {
+        return Some(0.3 + 0.2 * coverage);
+    }
+    None
+}
+
+/// Fuzzy-match symbol names in a repo/ref, best first. Candidates are the
+/// names starting with the query's first character (in either case) and no
+/// shorter than the query, read through the name index. Every candidate is
+/// scored; only the best `limit` are held at a time.
+pub fn search_symbols(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    query: &str,
+    filter: &SymbolFilter,
+    limit: usize,
+) -> Result<Vec<SearchResult>, StateError> {
+    search_symbols_across(&[conn], repo, r#ref, query, filter, limit)
+}
+
+/// [`search_symbols`] over several state databases, such as the main index
+/// and its shards, ranked together.
+pub fn search_symbols_across(
+    conns: &[&Connection],
+    repo: &str,
+    r#ref: &str,
+    query: &str,
+    filter: &SymbolFilter,
+    limit: usize,
+) -> Result<Vec<SearchResult>, StateError> {
+    let Some(initial) = query.chars().next() else {
+        return Ok(Vec::new());
+    };
+    // Every tier needs the whole query inside the name.
+    let min_chars = query.chars().count();
+    // Hits are ranked and cut back to `limit` whenever the buffer fills, so
+    // memory stays bounded however many names share the initial.
+    let capacity = limit.max(1) * 2;
+    let mut hits: Vec<(f32, SymbolRecord)> = Vec::new();
+    for conn in conns {
+        symbols::for_each_symbol_with_initial(
+            conn,
+            repo,
+            r#ref,
+            initial,
+            min_chars,
+            None,
+            |symbol| {
+                if filter.matches_symbol(&symbol)
+                    && let Some(score) = score(query, &symbol.name)
+                {
+                    hits.push((score, symbol));
+                    if hits.len() >= capacity {
+                        rank_hits(&mut hits, limit);
+                    }
+                }
+                Ok(())
+            },
+        )?;
+    }
+    rank_hits(&mut hits, limit);
+    Ok(hits
+        .into_iter()
+        .map(|(score, symbol)| to_result(symbol, score))
+        .collect())
+}
+
+/// Sort hits best first and keep the top `limit`.
+fn rank_hits(hits: &mut Vec<(f32, SymbolRecord)>, limit: usize) {
+    hits.sort_by(|(a_score, a), (b_score, b)| {
+        b_score
+            .total_cmp(a_score)
+            .then_with(|| a.name.len().cmp(&b.name.len()))
+            .then_with(|| a.path.cmp(&b.path))
+            .then_with(|| a.line_start.cmp(&b.line_start))
+    });
+    hits.truncate(limit);
+}
+
+/// Merge fuzzy hits into lexical results by score. Lexical scores are
+/// scaled so the best lexical hit scores 1.0, the same as an exact fuzzy
+/// match; ties keep the lexical hit first. Duplicates (same path and start
+/// line) keep their best-ranked copy.
+pub fn merge(
+    lexical: Vec<SearchResult>,
+    fuzzy: Vec<SearchResult>,
+    limit: usize,
+) -> Vec<SearchResult> {
+    let top = lexical
+        .iter()
+        .map(|result| result.score)
+        .fold(0.0_f32, f32::max);
+    let mut ranked: Vec<(f32, SearchResult)> = lexical
+        .into_iter()
+        .map(|result| {
+            let scaled = if top > 0.0 { result.score / top } else { 0.0 };
+            (scaled, result)
+        })
+        .chain(fuzzy.into_iter().map(|result| (result.score, result)))
+        .collect();
+    // Stable, so equal scores keep lexical hits ahead of fuzzy ones.
+    ranked.sort_by(|(a, _), (b, _)| b.total_cmp(a));
+    let mut seen = HashSet::new();
+    ranked
+        .into_iter()
+        .map(|(_, result)| result)
+        .filter(|result| seen.insert((result.path.clone(), result.line_start)))
+        .take(limit)
+        .collect()
+}
+
+fn to_result(symbol: SymbolRecord, score: f32) -> SearchResult {
+    let kind = symbol.kind.as_str();
+    let result_id = compute_stable_result_id(StableResultIdInput {
+        result_type: "symbol",
+        repo: &symbol.repo,
+        ref_name: &symbol.r#ref,
+        path: &symbol.path,
+        line_start: symbol.line_start,
+        line_end: symbol.line_end,
+        kind,
+        name: &symbol.name,
+        qualified_name: &symbol.qualified_name,
+        language: &symbol.language,
+        symbol_stable_id: &symbol.symbol_stable_id,
+    });
+    SearchResult {
+        repo: symbol.repo,
+        result_id,
+        symbol_id: Some(symbol.symbol_id),
+        symbol_stable_id: Some(symbol.symbol_stable_id),
+        result_type: "symbol".to_string(),
+        path: symbol.path,
+        line_start: symbol.line_start,
+        line_end: symbol.line_end,
+        kind: Some(kind.to_string()),
+        name: Some(symbol.name),
+        qualified_name: Some(symbol.qualified_name),
+        canonical_id: None,
+        language: symbol.language,
+        signature: symbol.signature,
+        visibility: symbol.visibility,
+        score,
+        snippet: None,
+        chunk_type: None,
+        chunk_origin: None,
+        file_centrality: 0.0,
+        source_layer: None,
+        provenance: "fuzzy".to_string(),
+    }
+}
+
+fn chars_eq(a: char, b: char) -> bool {
+    a.to_lowercase().eq(b.to_lowercase())
+}
+
+/// Word starts: the first char, a char after `_`/`-`/`.`/`$`, an upper-case
+/// char after a lower-case one or a digit, the last capital of an acronym
+/// (`S` in `HTTPServer`) and the first digit of a run.
+fn word_starts(name: &[char]) -> Vec<bool> {
+    (0..name.len())
+        .map(|i| {
+            let c = name[i];
+            if matches!(c, '_' | '-' | '.' | '$') {
+                return false;
+            }
+            let Some(&prev) = i.checked_sub(1).and_then(|p| name.get(p)) else {
+                return true;
+            };
+            let next = name.get(i + 1).copied();
+            matches!(prev, '_' | '-' | '.' | '$')
+                || (c.is_uppercase() && (prev.is_lowercase() || prev.is_ascii_digit()))
+                || (c.is_uppercase()
+                    && prev.is_uppercase()
+                    && next.is_some_and(|next| next.is_lowercase()))
+                || (c.is_ascii_digit() && !prev.is_ascii_digit())
+        })
+        .collect()
+}
+
+/// Every query char either continues the current word or starts a later one.
+/// Upper-case query chars must land on a word start.
+fn hump_match(query: &[char], name: &[char]) -> bool {
+    let starts = word_starts(name);
+    // Failed (query index, name index, continuing) states; keeps the
+    // backtracking linear in practice.
+    let mut failed = HashSet::new();
+    hump_from(query, name, &starts, 0, 0, false, &mut failed)
+}
+
+fn hump_from(
+    query: &[char],
+    name: &[char],
+    starts: &[bool],
+    qi: usize,
+    ci: usize,
+    continuing: bool,
+    failed: &mut HashSet<(usize, usize, bool)>,
+) -> bool {
+    if qi == query.len() {
+        return true;
+    }
+    if failed.contains(&(qi, ci, continuing)) {
+        return false;
+    }
+    let q = query[qi];
+    let matched = (continuing
+        && !q.is_uppercase()
+        && name.get(ci).is_some_and(|&c| chars_eq(q, c))
+        && hump_from(query, name, starts, qi + 1, ci + 1, true, failed))
+        || (ci..name.len()).any(|j| {
+            starts[j]
+                && chars_eq(q, name[j])
+                && hump_from(query, name, starts, qi + 1, j + 1, true, failed)
+        });
+    if !matched {
+        failed.insert((qi, ci, continuing));
+    }
+    matched
+}
+
+fn subsequence(query: &[char], name: &[char]) -> bool {
+    let mut rest = name.iter();
+    query.iter().all(|&q| rest.any(|&c| chars_eq(q, c)))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, kind: SymbolKind, path: &str, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("{}.{name}", path.split('/').next().unwrap()),
+            kind,
+            signature: None,
+            line_start: line,
+            line_end: line + 5,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn camel_humps_and_snake_case_match() {
+        assert!(score("hGU", "handleGetUser").is_some());
+        assert!(score("gu", "get_user").is_some());
+        assert!(score("HS", "HTTPServer").is_some());
+        assert!(score("hgu", "handleGetUser").is_some());
+        // An upper-case query char must start a word.
+        let humps = |q: &str, n: &str| {
+            hump_match(
+                &q.chars().collect::<Vec<_>>(),
+                &n.chars().collect::<Vec<_>>(),
+            )
+        };
+        assert!(humps("gU", "getUser"));
+        assert!(!humps("GU", "getuser"));
+        assert_eq!(score("xyz", "handleGetUser"), None);
+    }
+
+    #[test]
+    fn tiers_rank_exact_before_prefix_before_humps() {
+        let exact = score("getUser", "getUser").unwrap();
+        let folded = score("getuser", "getUser").unwrap();
+        let prefix = score("getU", "getUserById").unwrap();
+        let hump = score("gUBI", "getUserById").unwrap();
+        let subsequence = score("gtsr", "getUser").unwrap();
+        assert!(exact > folded && folded > prefix && prefix > hump && hump > subsequence);
+        // Shorter names win within a tier.
+        assert!(
+            score("hGU", "handleGetUser").unwrap() > score("hGU", "handleGetUserByIdV2").unwrap()
+        );
+    }
+
+    #[test]
+    fn parse_kinds_expands_type() {
+        assert_eq!(
+            parse_kinds("func, method").unwrap(),
+            vec![SymbolKind::Function, SymbolKind::Method]
+        );
+        assert!(
+            parse_kinds("type")
+                .unwrap()
+                .contains(&SymbolKind::Interface)
+        );
+        assert!(parse_kinds("widget").is_err());
+    }
+
+    #[test]
+    fn search_symbols_applies_filters_and_ranks() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            symbol("handleGetUser", SymbolKind::Function, "api/users.go", 10),
+            symbol("HandleGroupUpdate", SymbolKind::Method, "api/groups.go", 20),
+            symbol("HttpGetUser", SymbolKind::Struct, "client/http.go", 5),
+            symbol("render", SymbolKind::Function, "api/view.go", 1),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let all =
+            search_symbols(&conn, "repo", "main", "hGU", &SymbolFilter::default(), 10).unwrap();
+        let names: Vec<_> = all.iter().map(|r| r.name.clone().unwrap()).collect();
+        assert_eq!(names.len(), 3);
+        assert_eq!(names[0], "HttpGetUser");
+        assert!(all.iter().all(|r| r.provenance == "fuzzy"));
+
+        let funcs = SymbolFilter {
+            kinds: parse_kinds("func,method").unwrap(),
+            package: Some("api".to_string()),
+            language: None,
+        };
+        let scoped = search_symbols(&conn, "repo", "main", "hGU", &funcs, 10).unwrap();
+        let names: Vec<_> = scoped.iter().map(|r| r.name.clone().unwrap()).collect();
+        assert_eq!(names, vec!["handleGetUser", "HandleGroupUpdate"]);
+    }
+
+    #[test]
+    fn best_matches_are_found_past_a_large_bucket() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        // More weak subsequence matches than any fixed candidate cap sort
+        // ahead of the exact match by name; it must still come first.
+        conn.execute_batch("BEGIN").unwrap();
+        for idx in 0..25_000 {
+            symbols::insert_symbol(
+                &conn,
+                &symbol(
+                    &format!("aa_x{idx:05}_yz"),
+                    SymbolKind::Function,
+                    "src/noise.rs",
+                    idx + 1,
+                ),
+            )
+            .unwrap();
+        }
+        conn.execute_batch("COMMIT").unwrap();
+        symbols::insert_symbol(
+            &conn,
+            &symbol("axyz", SymbolKind::Function, "src/lib.rs", 1),
+        )
+        .unwrap();
+
+        let hits =
+            search_symbols(&conn, "repo", "main", "axyz", &SymbolFilter::default(), 3).unwrap();
+        assert_eq!(hits.len(), 3);
+        assert_eq!(hits[0].name.as_deref(), Some("axyz"));
+    }
+
+    #[test]
+    fn merge_interleaves_by_score_and_dedupes() {
+        let lexical = vec![
+            to_result(symbol("getUserName", SymbolKind::Function, "a.go", 1), 4.0),
+            to_result(symbol("guard", SymbolKind::Function, "b.go", 1), 1.0),
+        ];
+        let fuzzy = vec![
+            to_result(symbol("getUser", SymbolKind::Function, "c.go", 1), 0.7),
+            to_result(symbol("getUserName", SymbolKind::Function, "a.go", 1), 0.6),
+        ];
+        let merged = merge(lexical, fuzzy, 10);
+        let names: Vec<_> = merged.iter().map(|r| r.name.clone().unwrap()).collect();
+        // `guard` scales to 0.25, below the 0.7 camel-hump hit.
+        assert_eq!(names, vec!["getUserName", "getUser", "guard"]);
+        assert_eq!(merged[0].score, 4.0, "scores are reported unscaled");
+    }
+}
@@ -0,0 +1,370 @@
+//! CI gates over analysis metrics: `--fail-on 'cycles>0,deadcode>50'`.
+//!
+//! Each analysis command reports a set of named metrics; a [`FailOn`] spec
+//! lists thresholds over them and [`FailOn::evaluate`] says which were
+//! crossed. Metric names are checked against [`METRICS`] when parsing, so a
+//! typo fails fast instead of silently never gating. The same spec can be
+//! passed to several commands: thresholds over metrics a command does not
+//! measure are reported as unmeasured rather than failing.
+
+use crate::deadcode::DeadCodeReport;
+use crate::deps::DepsGraph;
+use crate::doc_coverage::DocCoverageReport;
+use crate::duplicates::DuplicateReport;
+use crate::exits::ExitReport;
+use crate::findings::{ComplexityPeak, Finding, Severity};
+use crate::import_check::{ImportCheck, ImportCheckReport};
+use crate::stats::RepoStats;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::fmt;
+
+/// Every metric a command can report, with a short description.
+pub const METRICS: &[(&str, &str)] = &[
+    ("cycles", "package import cycles (deps)"),
+    ("packages", "internal packages (deps, stats)"),
+    (
+        "layer_violations",
+        "imports forbidden by [layers] (deps --check)",
+    ),
+    ("deadcode", "dead code candidates (deadcode)"),
+    (
+        "duplicates",
+        "clusters of duplicated functions (duplicates)",
+    ),
+    (
+        "duplicated_lines",
+        "lines in duplicates beyond each cluster's longest member (duplicates)",
+    ),
+    (
+        "doc_coverage",
+        "percent of exported symbols with a doc comment (doc-coverage)",
+    ),
+    (
+        "doc_coverage.min",
+        "doc coverage of the least documented package (doc-coverage)",
+    ),
+    (
+        "undocumented",
+        "exported symbols without a doc comment (doc-coverage)",
+    ),
+    (
+        "exit_paths",
+        "functions in scope that can reach os.Exit or a Fatal call (exits)",
+    ),
+    (
+        "panic_paths",
+        "functions in scope that can reach an unrecovered panic (exits)",
+    ),
+    ("findings", "findings of any severity (check)"),
+    ("findings.error", "error findings (check)"),
+    ("findings.warning", "warning findings (check)"),
+    ("findings.info", "info findings (check)"),
+    ("complexity.max", "highest function complexity (check)"),
+    ("files", "indexed files (stats)"),
+    ("loc", "lines of code (stats)"),
+    ("symbols", "indexed symbols (stats)"),
+    (
+        "function_length.avg",
+        "mean function length in lines (stats)",
+    ),
+    ("fanin.max", "highest function fan-in (stats)"),
+    ("fanin.p90", "90th percentile function fan-in (stats)"),
+    ("fanout.max", "highest function fan-out (stats)"),
+    ("fanout.p90", "90th percentile function fan-out (stats)"),
+];
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub enum Comparison {
+    #[serde(rename = ">")]
+    Gt,
+    #[serde(rename = ">=")]
+    Ge,
+    #[serde(rename = "<")]
+    Lt,
+    #[serde(rename = "<=")]
+    Le,
+    #[serde(rename = "==")]
+    Eq,
+    #[serde(rename = "!=")]
+    Ne,
+}
+
+impl Comparison {
+    // Two-character operators first so `>=` is not read as `>`.
+    const ALL: [(&'static str, Comparison); 6] = [
+        (">=", Self::Ge),
+        ("<=", Self::Le),
+        ("==", Self::Eq),
+        ("!=", Self::Ne),
+        (">", Self::Gt),
+        ("<", Self::Lt),
+    ];
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Gt => ">",
+            Self::Ge => ">=",
+            Self::Lt => "<",
+            Self::Le => "<=",
+            Self::Eq => "==",
+            Self::Ne => "!=",
+        }
+    }
+
+    fn holds(self, actual: f64, limit: f64) -> bool {
+        match self {
+            Self::Gt => actual > limit,
+            Self::Ge => actual >= limit,
+            Self::Lt => actual < limit,
+            Self::Le => actual <= limit,
+            Self::Eq => actual == limit,
+            Self::Ne => actual != limit,
+        }
+    }
+}
+
+/// One `metric OP value` condition; the gate fails when it holds.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Threshold {
+    pub metric: String,
+    pub op: Comparison,
+    pub value: f64,
+}
+
+impl fmt::Display for Threshold {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}{}{}", self.metric, self.op.as_str(), self.value)
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Violation {
+    pub threshold: Threshold,
+    pub actual: f64,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub struct GateOutcome {
+    pub violations: Vec<Violation>,
+    /// Thresholds over metrics the command does not report.
+    pub unmeasured: Vec<Threshold>,
+}
+
+impl GateOutcome {
+    pub fn passed(&self) -> bool {
+        self.violations.is_empty()
+    }
+}
+
+/// A parsed `--fail-on` spec: comma-separated thresholds, any of which
+/// failing fails the gate.
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub struct FailOn {
+    pub thresholds: Vec<Threshold>,
+}
+
+impl FailOn {
+    pub fn parse(spec: &str) -> Result<Self, String> {
+        let mut thresholds = Vec::new();
+        for part in spec
+            .split(',')
+            .map(str::trim)
+            .filter(|part| !part.is_empty())
+        {
+            let (pos, op_str, op) = Comparison::ALL
+                .iter()
+                .filter_map(|(op_str, op)| part.find(op_str).map(|pos| (pos, *op_str, *op)))
+                .min_by_key(|(pos, op_str, _)| (*pos, std::cmp::Reverse(op_str.len())))
+                .ok_or_else(|| {
+                    format!("`{part}`: expected METRIC OP VALUE with OP one of > >= < <= == !=")
+                })?;
+            let metric = part[..pos].trim();
+            let value = part[pos + op_str.len()..].trim();
+            if !METRICS.iter().any(|(name, _)| *name == metric) {
+                let known: Vec<&str> = METRICS.iter().map(|(name, _)| *name).collect();
+                return Err(format!(
+                    "`{part}`: unknown metric `{metric}` (known: {})",
+                    known.join(", ")
+                ));
+            }
+            let value: f64 = value
+                .parse()
+                .map_err(|_| format!("`{part}`: `{value}` is not a number"))?;
+            thresholds.push(Threshold {
+                metric: metric.to_string(),
+                op,
+                value,
+            });
+        }
+        if thresholds.is_empty() {
+            return Err("empty --fail-on spec".to_string());
+        }
+        Ok(Self { thresholds })
+    }
+
+    pub fn mentions(&self, metric: &str) -> bool {
+        self.thresholds.iter().any(|t| t.metric == metric)
+    }
+
+    pub fn evaluate(&self, metrics: &BTreeMap<String, f64>) -> GateOutcome {
+        let mut outcome = GateOutcome::default();
+        for threshold in &self.thresholds {
+            match metrics.get(&threshold.metric) {
+                Some(&actual) if threshold.op.holds(actual, threshold.value) => {
+                    outcome.violations.push(Violation {
+                        threshold: threshold.clone(),
+                        actual,
+                    });
+                }
+                Some(_) => {}
+                None => outcome.unmeasured.push(threshold.clone()),
+            }
+        }
+        outcome
+    }
+}
+
+pub fn deps_metrics(graph: &DepsGraph) -> BTreeMap<String, f64> {
+    BTreeMap::from([
+        ("cycles".to_string(), graph.cycles.len() as f64),
+        (
+            "packages".to_string(),
+            graph.nodes.iter().filter(|node| !node.external).count() as f64,
+        ),
+    ])
+}
+
+pub fn import_check_metrics(report: &ImportCheckReport) -> BTreeMap<String, f64> {
+    BTreeMap::from([
+        (
+            "cycles".to_string(),
+            report.count(ImportCheck::ImportCycle) as f64,
+        ),
+        (
+            "layer_violations".to_string(),
+            report.count(ImportCheck::LayerViolation) as f64,
+        ),
+        ("packages".to_string(), report.packages as f64),
+    ])
+}
+
+pub fn deadcode_metrics(report: &DeadCodeReport) -> BTreeMap<String, f64> {
+    BTreeMap::from([("deadcode".to_string(), report.dead.len() as f64)])
+}
+
+pub fn duplicates_metrics(report: &DuplicateReport) -> BTreeMap<String, f64> {
+    BTreeMap::from([
+        ("duplicates".to_string(), report.clusters.len() as f64),
+        (
+            "duplicated_lines".to_string(),
+            report.duplicated_lines as f64,
+        ),
+    ])
+}
+
+pub fn doc_coverage_metrics(report: &DocCoverageReport) -> BTreeMap<String, f64> {
+    BTreeMap::from([
+        ("doc_coverage".to_string(), report.coverage),
+        (
+            "doc_coverage.min".to_string(),
+            report.min_package_coverage(),
+        ),
+        ("undocumented".to_string(), report.undocumented.len() as f64),
+    ])
+}
+
+pub fn exits_metrics(report: &ExitReport) -> BTreeMap<String, f64> {
+    BTreeMap::from([
+        ("exit_paths".to_string(), report.count("exit") as f64),
+        ("panic_paths".to_string(), report.count("panic") as f64),
+    ])
+}
+
+/// `complexity.max` is only reported when the peak was measured.
+pub fn check_metrics(
+    findings: &[Finding],
+    peak: Option<&ComplexityPeak>,
+    measured_complexity: bool,
+) -> BTreeMap<String, f64> {
+    let mut metrics = BTreeMap::from([("findings".to_string(), findings.len() as f64)]);
+    for severity in [Severity::Error, Severity::Warning, Severity::Info] {
+        let count = findings.iter().filter(|f| f.severity == severity).count();
+        metrics.insert(format!("findings.{}", severity.as_str()), count as f64);
+    }
+    if measured_complexity {
+        metrics.insert(
+            "complexity.max".to_string(),
+            peak.map_or(0.0, |peak| f64::from(peak.complexity)),
+        );
+    }
+    metrics
+}
+
+pub fn stats_metrics(stats: &RepoStats) -> BTreeMap<String, f64> {
+    let totals = &stats.totals;
+    BTreeMap::from([
+        ("packages".to_string(), stats.packages.len() as f64),
+        ("files".to_string(), totals.files as f64),
+        ("loc".to_string(), totals.loc as f64),
+        ("symbols".to_string(), totals.symbols as f64),
+        (
+            "function_length.avg".to_string(),
+            totals.avg_function_length,
+        ),
+        ("fanin.max".to_string(), stats.fan_in.max as f64),
+        ("fanin.p90".to_string(), stats.fan_in.p90 as f64),
+        ("fanout.max".to_string(), stats.fan_out.max as f64),
+        ("fanout.p90".to_string(), stats.fan_out.p90 as f64),
+    ])
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_thresholds_and_rejects_unknown_metrics() {
+        let spec = FailOn::parse("cycles>0, deadcode>=50 ,complexity.max>25").unwrap();
+        let rendered: Vec<String> = spec.thresholds.iter().map(|t| t.to_string()).collect();
+        assert_eq!(
+            rendered,
+            vec!["cycles>0", "deadcode>=50", "complexity.max>25"]
+        );
+        assert_eq!(spec.thresholds[1].op, Comparison::Ge);
+        assert!(spec.mentions("complexity.max"));
+
+        assert!(
+            FailOn::parse("cycle>0")
+                .unwrap_err()
+                .contains("unknown metric")
+        );
+        assert!(
+            FailOn::parse("cycles>lots")
+                .unwrap_err()
+                .contains("not a number")
+        );
+        assert!(
+            FailOn::parse("cycles")
+                .unwrap_err()
+                .contains("expected METRIC OP VALUE")
+        );
+        assert!(FailOn::parse(" , ").is_err());
+    }
+
+    #[test]
+    fn evaluates_against_reported_metrics() {
+        let spec = FailOn::parse("cycles>0,deadcode>50,complexity.max>25").unwrap();
+        let metrics = BTreeMap::from([("cycles".to_string(), 2.0), ("deadcode".to_string(), 50.0)]);
+        let outcome = spec.evaluate(&metrics);
+        assert!(!outcome.passed());
+        assert_eq!(outcome.violations.len(), 1);
+        assert_eq!(outcome.violations[0].threshold.metric, "cycles");
+        assert_eq!(outcome.violations[0].actual, 2.0);
+        assert_eq!(outcome.unmeasured.len(), 1);
+        assert_eq!(outcome.unmeasured[0].metric, "complexity.max");
+
+        let metrics = BTreeMap::from([("cycles".to_string(), 0.0), ("deadcode".to_string(), 3.0)]);
+        assert!(spec.evaluate(&metrics).passed());
+    }
+}
@@ -0,0 +1,481 @@
+//! GitHub Actions output for analysis results: `--format github` prints
+//! workflow commands (`::warning file=...::message`) that the runner turns
+//! into inline PR annotations, and `--format github-check` prints a Checks
+//! API payload carrying the same annotations and a Markdown summary.
+//!
+//! Each analysis maps onto a [`GithubReport`]: findings of `cruxe check`,
+//! exported API changes of `cruxe diff`, dead code candidates and import
+//! cycles.
+
+use crate::deadcode::DeadCodeReport;
+use crate::deps::DepsGraph;
+use crate::findings::{Finding, Severity};
+use crate::symbol_diff::{ChangeKind, SymbolChange, SymbolDiff};
+use serde::Serialize;
+use serde_json::{Value, json};
+use std::fmt::Write;
+
+/// The Checks API accepts at most this many annotations per request.
+pub const MAX_CHECK_ANNOTATIONS: usize = 50;
+
+/// Summary tables stop after this many rows.
+const MAX_SUMMARY_ROWS: usize = 50;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum AnnotationLevel {
+    Notice,
+    Warning,
+    Failure,
+}
+
+impl AnnotationLevel {
+    /// Name of the workflow command; the Checks API calls errors `failure`.
+    fn command(self) -> &'static str {
+        match self {
+            Self::Notice => "notice",
+            Self::Warning => "warning",
+            Self::Failure => "error",
+        }
+    }
+}
+
+impl From<Severity> for AnnotationLevel {
+    fn from(severity: Severity) -> Self {
+        match severity {
+            Severity::Info => Self::Notice,
+            Severity::Warning => Self::Warning,
+            Severity::Error => Self::Failure,
+        }
+    }
+}
+
+/// One annotation. Without a `path` it only shows in the run's summary.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Annotation {
+    pub level: AnnotationLevel,
+    pub path: Option<String>,
+    pub line: u32,
+    pub end_line: u32,
+    pub title: String,
+    pub message: String,
+}
+
+impl Annotation {
+    /// The workflow command that creates this annotation.
+    pub fn workflow_command(&self) -> String {
+        let mut properties = Vec::new();
+        if let Some(path) = &self.path {
+            properties.push(format!("file={}", escape_property(path)));
+            if self.line > 0 {
+                properties.push(format!("line={}", self.line));
+                if self.end_line > self.line {
+                    properties.push(format!("endLine={}", self.end_line));
+                }
+            }
+        }
+        properties.push(format!("title={}", escape_property(&self.title)));
+        format!(
+            "::{} {}::{}",
+            self.level.command(),
+            properties.join(","),
+            escape_data(&self.message)
+        )
+    }
+
+    fn check_annotation(&self) -> Option<Value> {
+        let path = self.path.as_ref()?;
+        let line = self.line.max(1);
+        Some(json!({
+            "path": path,
+            "start_line": line,
+            "end_line": self.end_line.max(line),
+            "annotation_level": self.level,
+            "title": self.title,
+            "message": self.message,
+        }))
+    }
+}
+
+/// Annotations and a Markdown summary for one analysis.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct GithubReport {
+    pub title: String,
+    pub summary: String,
+    pub annotations: Vec<Annotation>,
+}
+
+impl GithubReport {
+    /// `failure` when any annotation is an error, else `success`.
+    pub fn conclusion(&self) -> &'static str {
+        let failed = self
+            .annotations
+            .iter()
+            .any(|annotation| annotation.level == AnnotationLevel::Failure);
+        if failed { "failure" } else { "success" }
+    }
+
+    /// Body for `POST /repos/{owner}/{repo}/check-runs`. Only the first
+    /// [`MAX_CHECK_ANNOTATIONS`] annotations with a file are included; the
+    /// summary says when some were left out.
+    pub fn check_run(&self, name: &str, head_sha: Option<&str>) -> Value {
+        let annotations: Vec<Value> = self
+            .annotations
+            .iter()
+            .filter_map(Annotation::check_annotation)
+            .collect();
+        let mut summary = self.summary.clone();
+        if annotations.len() > MAX_CHECK_ANNOTATIONS {
+            let _ = write!(
+                summary,
+                "\n_Showing the first {} of {} annotations._\n",
+                MAX_CHECK_ANNOTATIONS,
+                annotations.len()
+            );
+        }
+        let mut payload = json!({
+            "name": name,
+            "status": "completed",
+            "conclusion": self.conclusion(),
+            "output": {
+                "title": self.title,
+                "summary": summary,
+                "annotations": &annotations[..annotations.len().min(MAX_CHECK_ANNOTATIONS)],
+            },
+        });
+        if let Some(sha) = head_sha {
+            payload["head_sha"] = json!(sha);
+        }
+        payload
+    }
+}
+
+/// Findings of `cruxe check`, at their rule's severity.
+pub fn findings_report(findings: &[Finding]) -> GithubReport {
+    let count = |severity| {
+        findings
+            .iter()
+            .filter(|finding| finding.severity == severity)
+            .count()
+    };
+    let title = format!(
+        "{} finding(s): {} error, {} warning, {} info",
+        findings.len(),
+        count(Severity::Error),
+        count(Severity::Warning),
+        count(Severity::Info)
+    );
+    let rows: Vec<[String; 4]> = findings
+        .iter()
+        .map(|finding| {
+            [
+                finding.severity.as_str().to_string(),
+                format!("`{}`", finding.rule),
+                format!("`{}:{}`", finding.path, finding.line),
+                finding.message.clone(),
+            ]
+        })
+        .collect();
+    GithubReport {
+        summary: summary(
+            "cruxe check",
+            &title,
+            &["Severity", "Rule", "Location", "Message"],
+            &rows,
+        ),
+        title,
+        annotations: findings
+            .iter()
+            .map(|finding| Annotation {
+                level: finding.severity.into(),
+                path: Some(finding.path.clone()),
+                line: finding.line,
+                end_line: finding.line,
+                title: finding.rule.clone(),
+                message: if finding.symbol.is_empty() {
+                    finding.message.clone()
+                } else {
+                    format!("{} (in `{}`)", finding.message, finding.symbol)
+                },
+            })
+            .collect(),
+    }
+}
+
+/// Exported API changes of `cruxe diff`: additions as notices, everything
+/// that can break callers as warnings. Other changes are left out.
+pub fn diff_report(diff: &SymbolDiff) -> GithubReport {
+    let changes: Vec<_> = diff
+        .changes
+        .iter()
+        .filter(|change| change.api_changed)
+        .collect();
+    let title = format!(
+        "{} exported API change(s) between {} and {}",
+        changes.len(),
+        diff.base_ref,
+        diff.head_ref
+    );
+    let describe = |change: &SymbolChange| match change.change {
+        ChangeKind::Renamed => format!(
+            "`{}` renamed to `{}`",
+            change.old_qualified_name.as_deref().unwrap_or_default(),
+            change.qualified_name
+        ),
+        ChangeKind::SignatureChanged => format!(
+            "`{}` signature changed from `{}` to `{}`",
+            change.qualified_name,
+            change.old_signature.as_deref().unwrap_or_default().trim(),
+            change.signature.as_deref().unwrap_or_default().trim()
+        ),
+        other => format!(
+            "{} `{}` {}",
+            change.kind,
+            change.qualified_name,
+            other.as_str().replace('_', " ")
+        ),
+    };
+    let rows: Vec<[String; 3]> = changes
+        .iter()
+        .map(|change| {
+            [
+                change.change.as_str().to_string(),
+                format!("`{}`", change.qualified_name),
+                format!("`{}:{}`", change.path, change.line),
+            ]
+        })
+        .collect();
+    GithubReport {
+        summary: summary(
+            &format!("cruxe diff {}...{}", diff.base_ref, diff.head_ref),
+            &title,
+            &["Change", "Symbol", "Location"],
+            &rows,
+        ),
+        title,
+        annotations: changes
+            .iter()
+            .map(|change| {
+                let (level, title) = match change.change {
+                    ChangeKind::Added => (AnnotationLevel::Notice, "New API"),
+                    _ => (AnnotationLevel::Warning, "API change"),
+                };
+                Annotation {
+                    level,
+                    path: Some(change.path.clone()),
+                    line: change.line,
+                    end_line: change.line,
+                    title: title.to_string(),
+                    message: describe(change),
+                }
+            })
+            .collect(),
+    }
+}
+
+/// Dead code candidates of `cruxe deadcode`, as warnings.
+pub fn deadcode_report(report: &DeadCodeReport) -> GithubReport {
+    let title = format!("{} dead code candidate(s)", report.dead.len());
+    let rows: Vec<[String; 3]> = report
+        .dead
+        .iter()
+        .map(|dead| {
+            [
+                format!("`{}`", dead.qualified_name),
+                dead.reason.as_str().to_string(),
+                format!("`{}:{}`", dead.path, dead.line_start),
+            ]
+        })
+        .collect();
+    GithubReport {
+        summary: summary(
+            "cruxe deadcode",
+            &title,
+            &["Symbol", "Reason", "Location"],
+            &rows,
+        ),
+        title,
+        annotations: report
+            .dead
+            .iter()
+            .map(|dead| Annotation {
+                level: AnnotationLevel::Warning,
+                path: Some(dead.path.clone()),
+                line: dead.line_start,
+                end_line: dead.line_end,
+                title: "Dead code".to_string(),
+                message: format!(
+                    "{} `{}` is {}",
+                    dead.kind,
+                    dead.qualified_name,
+                    dead.reason.as_str()
+                ),
+            })
+            .collect(),
+    }
+}
+
+/// Import cycles of `cruxe deps`. Cycles span directories, so their
+/// annotations carry no file.
+pub fn deps_report(graph: &DepsGraph) -> GithubReport {
+    let title = format!("{} import cycle(s)", graph.cycles.len());
+    let path = |cycle: &[String]| {
+        let mut members: Vec<&str> = cycle.iter().map(String::as_str).collect();
+        members.extend(cycle.first().map(String::as_str));
+        members.join(" -> ")
+    };
+    let rows: Vec<[String; 1]> = graph
+        .cycles
+        .iter()
+        .map(|cycle| [format!("`{}`", path(cycle))])
+        .collect();
+    GithubReport {
+        summary: summary("cruxe deps", &title, &["Cycle"], &rows),
+        title,
+        annotations: graph
+            .cycles
+            .iter()
+            .map(|cycle| Annotation {
+                level: AnnotationLevel::Warning,
+                path: None,
+                line: 0,
+                end_line: 0,
+                title: "Import cycle".to_string(),
+                message: path(cycle),
+            })
+            .collect(),
+    }
+}
+
+/// A Markdown section: heading, one-line total and a table of `rows`.
+fn summary<const N: usize>(
+    heading: &str,
+    title: &str,
+    columns: &[&str; N],
+    rows: &[[String; N]],
+) -> String {
+    let mut out = format!("### {heading}\n\n{title}\n");
+    if rows.is_empty() {
+        return out;
+    }
+    let _ = writeln!(out, "\n| {} |", columns.join(" | "));
+    let _ = writeln!(out, "|{}", "---|".repeat(N));
+    for row in rows.iter().take(MAX_SUMMARY_ROWS) {
+        let cells: Vec<String> = row.iter().map(|cell| escape_cell(cell)).collect();
+        let _ = writeln!(out, "| {} |", cells.join(" | "));
+    }
+    if rows.len() > MAX_SUMMARY_ROWS {
+        let _ = writeln!(out, "\n_…and {} more._", rows.len() - MAX_SUMMARY_ROWS);
+    }
+    out
+}
+
+fn escape_cell(cell: &str) -> String {
+    cell.replace('|', "\\|").replace(['\r', '\n'], " ")
+}
+
+fn escape_data(value: &str) -> String {
+    value
+        .replace('%', "%25")
+        .replace('\r', "%0D")
+        .replace('\n', "%0A")
+}
+
+fn escape_property(value: &str) -> String {
+    escape_data(value).replace(':', "%3A").replace(',', "%2C")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::findings::Confidence;
+
+    fn finding(severity: Severity, line: u32) -> Finding {
+        Finding {
+            id: String::new(),
+            rule: "go/time-tick-leak".to_string(),
+            severity,
+            path: "pkg/poll.go".to_string(),
+            line,
+            symbol: "poll.Run".to_string(),
+            symbol_id: String::new(),
+            message: "time.Tick leaks its ticker\nuse time.NewTicker".to_string(),
+            confidence: Confidence::default(),
+            evidence: Vec::new(),
+            also_reported_by: Vec::new(),
+        }
+    }
+
+    #[test]
+    fn workflow_commands_escape_properties_and_data() {
+        let annotation = Annotation {
+            level: AnnotationLevel::Failure,
+            path: Some("a,b:c.go".to_string()),
+            line: 3,
+            end_line: 5,
+            title: "rule: x".to_string(),
+            message: "100% bad\nreally".to_string(),
+        };
+        assert_eq!(
+            annotation.workflow_command(),
+            "::error file=a%2Cb%3Ac.go,line=3,endLine=5,title=rule%3A x::100%25 bad%0Areally"
+        );
+
+        let unplaced = Annotation {
+            path: None,
+            ..annotation
+        };
+        assert_eq!(
+            unplaced.workflow_command(),
+            "::error title=rule%3A x::100%25 bad%0Areally"
+        );
+    }
+
+    #[test]
+    fn check_run_caps_annotations_and_fails_on_errors() {
+        let findings: Vec<Finding> = (1..=60)
+            .map(|line| finding(Severity::Warning, line))
+            .chain([finding(Severity::Error, 99)])
+            .collect();
+        let report = findings_report(&findings);
+        assert_eq!(report.annotations.len(), 61);
+        assert_eq!(report.annotations[60].level, AnnotationLevel::Failure);
+        assert!(
+            report
+                .title
+                .starts_with("61 finding(s): 1 error, 60 warning")
+        );
+        assert!(
+            report
+                .summary
+                .contains("| Severity | Rule | Location | Message |")
+        );
+        assert!(report.summary.contains("_…and 11 more._"));
+
+        let payload = report.check_run("cruxe check", Some("abc123"));
+        assert_eq!(payload["conclusion"], "failure");
+        assert_eq!(payload["head_sha"], "abc123");
+        let annotations = payload["output"]["annotations"].as_array().unwrap();
+        assert_eq!(annotations.len(), MAX_CHECK_ANNOTATIONS);
+        assert_eq!(annotations[0]["annotation_level"], "warning");
+        assert_eq!(annotations[0]["start_line"], 1);
+        assert!(
+            payload["output"]["summary"]
+                .as_str()
+                .unwrap()
+                .contains("first 50 of 61 annotations")
+        );
+
+        let clean = findings_report(&[]);
+        assert_eq!(
+            clean.check_run("cruxe check", None)["conclusion"],
+            "success"
+        );
+        assert!(
+            clean
+                .check_run("cruxe check", None)
+                .get("head_sha")
+                .is_none()
+        );
+    }
+}
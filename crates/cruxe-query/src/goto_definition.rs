@@ -0,0 +1,629 @@
+use cruxe_core::error::StateError;
+use cruxe_core::languages;
+use cruxe_core::types::{LocalRecord, SymbolRecord};
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::path::Path;
+
+use crate::locals;
+use crate::ref_sites::{identifier_matches, is_import_line};
+use crate::symbol_ids::CanonicalIds;
+
+#[derive(Debug, thiserror::Error)]
+pub enum GotoDefinitionError {
+    #[error("invalid position `{0}`: expected <file>:<line>:<col>")]
+    InvalidPosition(String),
+    #[error("cannot read {path}: {reason}")]
+    Unreadable { path: String, reason: String },
+    #[error("{path} is outside the workspace")]
+    OutsideWorkspace { path: String },
+    #[error("no identifier at {path}:{line}:{column}")]
+    NoIdentifier {
+        path: String,
+        line: u32,
+        column: u32,
+    },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// A 1-based source position; `column` counts characters.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+pub struct Position {
+    pub path: String,
+    pub line: u32,
+    pub column: u32,
+}
+
+impl Position {
+    /// Parse `<file>:<line>:<col>`. The file part may itself contain `:`.
+    pub fn parse(spec: &str) -> Result<Self, GotoDefinitionError> {
+        let invalid = || GotoDefinitionError::InvalidPosition(spec.to_string());
+        let mut parts = spec.rsplitn(3, ':');
+        let column = parts.next().and_then(|c| c.parse::<u32>().ok());
+        let line = parts.next().and_then(|l| l.parse::<u32>().ok());
+        let path = parts.next().filter(|p| !p.is_empty());
+        match (path, line, column) {
+            (Some(path), Some(line), Some(column)) if line > 0 && column > 0 => Ok(Self {
+                path: path.to_string(),
+                line,
+                column,
+            }),
+            _ => Err(invalid()),
+        }
+    }
+}
+
+/// Why a definition was chosen, strongest first.
+#[derive(
+    Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize, JsonSchema,
+)]
+#[serde(rename_all = "snake_case")]
+pub enum DefinitionVia {
+    /// The position is the declaration itself.
+    Declaration,
+    /// A parameter or local variable whose scope binds the position.
+    Local,
+    /// A call edge on the line was resolved to the symbol at index time.
+    CallEdge,
+    /// The qualifier (`auth.` in `auth.Validate`) names the symbol's package.
+    Qualifier,
+    SameFile,
+    SamePackage,
+    /// Only the name matches.
+    Name,
+}
+
+impl DefinitionVia {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Declaration => "declaration",
+            Self::Local => "local",
+            Self::CallEdge => "call_edge",
+            Self::Qualifier => "qualifier",
+            Self::SameFile => "same_file",
+            Self::SamePackage => "same_package",
+            Self::Name => "name",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct DefinitionHit {
+    pub via: DefinitionVia,
+    pub symbol_id: String,
+    pub name: String,
+    pub qualified_name: String,
+    /// See [`cruxe_core::canonical_id`].
+    pub canonical_id: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    /// Column of the declaration of a local; symbols are found by line.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub column: Option<u32>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+}
+
+/// The import an unindexed identifier comes from.
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct ExternalImport {
+    pub path: String,
+    pub line: u32,
+    pub text: String,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct DefinitionLookup {
+    pub position: Position,
+    pub identifier: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub qualifier: Option<String>,
+    /// Candidates of the strongest [`DefinitionVia`] found; more than one
+    /// means the name is ambiguous at that strength.
+    pub definitions: Vec<DefinitionHit>,
+    /// Set when nothing in the index matches but the file imports the
+    /// identifier or its qualifier, i.e. it lives in a dependency.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub external: Option<ExternalImport>,
+}
+
+/// Resolve the identifier at `position` (relative to `workspace`) to its
+/// definition in the index for `ref_name`.
+pub fn goto_definition(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    position: &Position,
+) -> Result<DefinitionLookup, GotoDefinitionError> {
+    let path = relative_path(workspace, &position.path);
+    let unreadable = |e: std::io::Error| GotoDefinitionError::Unreadable {
+        path: path.clone(),
+        reason: e.to_string(),
+    };
+    // Resolve `..` and symlinks before reading, so the file is the one the
+    // caller was allowed to name.
+    let root = workspace.canonicalize().map_err(unreadable)?;
+    let file = root.join(&path).canonicalize().map_err(unreadable)?;
+    if !file.starts_with(&root) {
+        return Err(GotoDefinitionError::OutsideWorkspace { path: path.clone() });
+    }
+    let content = std::fs::read_to_string(&file).map_err(unreadable)?;
+    let no_identifier = || GotoDefinitionError::NoIdentifier {
+        path: path.clone(),
+        line: position.line,
+        column: position.column,
+    };
+    let lines: Vec<&str> = content.lines().collect();
+    let line_text = lines
+        .get((position.line as usize).wrapping_sub(1))
+        .ok_or_else(no_identifier)?;
+    let (identifier, start, qualifier) =
+        identifier_at(line_text, position.column).ok_or_else(no_identifier)?;
+
+    // Inside a function body a parameter or local shadows every symbol of
+    // the name.
+    let column = line_text[..start].chars().count() as u32 + 1;
+    let local = match qualifier {
+        Some(_) => None,
+        None => locals::local_at(conn, project_id, ref_name, &path, position.line, column)?,
+    };
+    if let Some(local) = local {
+        let ids = CanonicalIds::load(conn, project_id, ref_name)?;
+        let via = if (local.line, local.column) == (position.line, column) {
+            DefinitionVia::Declaration
+        } else {
+            DefinitionVia::Local
+        };
+        return Ok(DefinitionLookup {
+            position: Position {
+                path,
+                line: position.line,
+                column: position.column,
+            },
+            identifier,
+            qualifier,
+            definitions: vec![local_definition(&ids, via, local)],
+            external: None,
+        });
+    }
+
+    let file_symbols = symbols::list_symbols_in_file(conn, project_id, ref_name, &path)?;
+    let mut hits: Vec<(DefinitionVia, SymbolRecord)> = Vec::new();
+
+    // The position is a declaration when it is the first occurrence of the
+    // name inside a same-named symbol's span.
+    for symbol in file_symbols.iter().filter(|s| s.name == identifier) {
+        if first_occurrence(&lines, &identifier, symbol) == Some((position.line, start)) {
+            hits.push((DefinitionVia::Declaration, symbol.clone()));
+        }
+    }
+
+    for edge in edges::get_call_edges_at(conn, project_id, ref_name, &path, position.line)? {
+        let Some(target) = edge.to_symbol_id.as_deref() else {
+            continue;
+        };
+        let symbol = match symbols::get_symbol_by_stable_id(conn, project_id, ref_name, target)? {
+            Some(symbol) => Some(symbol),
+            None => symbols::get_symbol_by_id(conn, project_id, ref_name, target)?,
+        };
+        if let Some(symbol) = symbol.filter(|s| s.name == identifier) {
+            hits.push((DefinitionVia::CallEdge, symbol));
+        }
+    }
+
+    let dir = parent_dir(&path);
+    for symbol in symbols::find_symbols_by_name(conn, project_id, ref_name, &identifier, None)? {
+        let via = if qualifier
+            .as_deref()
+            .is_some_and(|q| qualifier_matches(q, &symbol))
+        {
+            DefinitionVia::Qualifier
+        } else if symbol.path == path {
+            DefinitionVia::SameFile
+        } else if parent_dir(&symbol.path) == dir {
+            DefinitionVia::SamePackage
+        } else {
+            DefinitionVia::Name
+        };
+        hits.push((via, symbol));
+    }
+
+    let best = hits.iter().map(|(via, _)| *via).min();
+    let ids = CanonicalIds::load(conn, project_id, ref_name)?;
+    let mut definitions: Vec<DefinitionHit> = Vec::new();
+    for (via, symbol) in hits {
+        if Some(via) != best
+            || definitions
+                .iter()
+                .any(|hit| hit.symbol_id == symbol.symbol_id)
+        {
+            continue;
+        }
+        definitions.push(DefinitionHit {
+            via,
+            canonical_id: ids.id_of(&symbol.language, &symbol.path, &symbol.qualified_name),
+            symbol_id: symbol.symbol_id,
+            name: symbol.name,
+            qualified_name: symbol.qualified_name,
+            kind: symbol.kind.as_str().to_string(),
+            language: symbol.language,
+            path: symbol.path,
+            line_start: symbol.line_start,
+            line_end: symbol.line_end,
+            column: None,
+            signature: symbol.signature,
+        });
+    }
+
+    let external = if definitions.is_empty() {
+        find_import(&lines, &path, qualifier.as_deref().unwrap_or(&identifier))
+    } else {
+        None
+    };
+    Ok(DefinitionLookup {
+        position: Position {
+            path,
+            line: position.line,
+            column: position.column,
+        },
+        identifier,
+        qualifier,
+        definitions,
+        external,
+    })
+}
+
+fn local_definition(ids: &CanonicalIds, via: DefinitionVia, local: LocalRecord) -> DefinitionHit {
+    let language = Path::new(&local.path)
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .and_then(languages::detect_language_from_extension)
+        .unwrap_or_default();
+    let qualified_name = locals::qualified_name(&local);
+    DefinitionHit {
+        via,
+        symbol_id: format!("local:{}:{}:{}", local.path, local.line, local.column),
+        canonical_id: ids.id_of(language, &local.path, &qualified_name),
+        name: local.name,
+        qualified_name,
+        kind: local.kind,
+        language: language.to_string(),
+        path: local.path,
+        line_start: local.line,
+        line_end: local.line,
+        column: Some(local.column),
+        signature: None,
+    }
+}
+
+fn relative_path(workspace: &Path, path: &str) -> String {
+    let path = Path::new(path);
+    let relative = path.strip_prefix(workspace).unwrap_or(path);
+    relative
+        .to_string_lossy()
+        .trim_start_matches("./")
+        .replace('\\', "/")
+}
+
+fn parent_dir(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+/// The identifier under (or just before) `column`, its byte offset, and the
+/// identifier it is qualified by through `.`, `::` or `->`, if any.
+fn identifier_at(line: &str, column: u32) -> Option<(String, usize, Option<String>)> {
+    let is_ident = |c: char| c.is_alphanumeric() || c == '_' || c == '$';
+    let chars: Vec<(usize, char)> = line.char_indices().collect();
+    let mut idx = (column as usize).checked_sub(1)?;
+    if !chars.get(idx).is_some_and(|(_, c)| is_ident(*c)) {
+        // A cursor right after the identifier still selects it.
+        idx = idx.checked_sub(1)?;
+        if !chars.get(idx).is_some_and(|(_, c)| is_ident(*c)) {
+            return None;
+        }
+    }
+    let mut first = idx;
+    while first > 0 && is_ident(chars[first - 1].1) {
+        first -= 1;
+    }
+    let mut last = idx;
+    while last + 1 < chars.len() && is_ident(chars[last + 1].1) {
+        last += 1;
+    }
+    let start = chars[first].0;
+    let end = chars.get(last + 1).map_or(line.len(), |(i, _)| *i);
+    let identifier = line[start..end].to_string();
+    if identifier.starts_with(|c: char| c.is_ascii_digit()) {
+        return None;
+    }
+
+    let before = &line[..start];
+    let qualifier = [".", "::", "->"]
+        .iter()
+        .find_map(|sep| before.strip_suffix(sep))
+        .and_then(|prefix| {
+            let name: String = prefix
+                .chars()
+                .rev()
+                .take_while(|c| is_ident(*c))
+                .collect::<Vec<_>>()
+                .into_iter()
+                .rev()
+                .collect();
+            (!name.is_empty()).then_some(name)
+        });
+    Some((identifier, start, qualifier))
+}
+
+/// `auth` qualifies symbols whose qualified name has an `auth` segment
+/// before the name, or that live in an `auth` directory.
+fn qualifier_matches(qualifier: &str, symbol: &SymbolRecord) -> bool {
+    let segments: Vec<&str> = symbol
+        .qualified_name
+        .split(['.', ':'])
+        .filter(|segment| !segment.is_empty())
+        .collect();
+    segments
+        .iter()
+        .rev()
+        .skip(1)
+        .any(|segment| *segment == qualifier)
+        || parent_dir(&symbol.path).rsplit('/').next() == Some(qualifier)
+}
+
+/// (line, byte offset) of the first occurrence of `name` in `symbol`'s span.
+fn first_occurrence(lines: &[&str], name: &str, symbol: &SymbolRecord) -> Option<(u32, usize)> {
+    (symbol.line_start..=symbol.line_end).find_map(|line_no| {
+        let line = lines.get(line_no.checked_sub(1)? as usize)?;
+        identifier_matches(line, name)
+            .first()
+            .map(|start| (line_no, *start))
+    })
+}
+
+fn find_import(lines: &[&str], path: &str, name: &str) -> Option<ExternalImport> {
+    let mut in_go_imports = false;
+    for (idx, line) in lines.iter().enumerate() {
+        let trimmed = line.trim_start();
+        if trimmed.starts_with("import (") {
+            in_go_imports = true;
+            continue;
+        }
+        if in_go_imports && trimmed.starts_with(')') {
+            in_go_imports = false;
+            continue;
+        }
+        let imports = in_go_imports || is_import_line(trimmed);
+        // Go imports name the package by its last path segment.
+        let go_path_match = in_go_imports
+            && trimmed
+                .trim_matches('"')
+                .rsplit('/')
+                .next()
+                .is_some_and(|last| last.trim_end_matches('"') == name);
+        if imports && (go_path_match || !identifier_matches(line, name).is_empty()) {
+            return Some(ExternalImport {
+                path: path.to_string(),
+                line: idx as u32 + 1,
+                text: trimmed.trim_end().to_string(),
+            });
+        }
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind};
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, qualified: &str, path: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified}"),
+            symbol_stable_id: format!("stable::{qualified}"),
+            name: name.to_string(),
+            qualified_name: qualified.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn parse_position_accepts_colons_in_paths() {
+        let position = Position::parse("C:/src/main.go:12:5").unwrap();
+        assert_eq!(position.path, "C:/src/main.go");
+        assert_eq!((position.line, position.column), (12, 5));
+        assert!(Position::parse("main.go:12").is_err());
+        assert!(Position::parse("main.go:0:1").is_err());
+    }
+
+    #[test]
+    fn refuses_files_outside_the_workspace() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("repo");
+        std::fs::create_dir_all(&workspace).unwrap();
+        std::fs::write(tmp.path().join("secret.go"), "package secret\n").unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let err = goto_definition(
+            &conn,
+            &workspace,
+            "p",
+            "main",
+            &Position::parse("../secret.go:1:1").unwrap(),
+        )
+        .unwrap_err();
+        assert!(
+            matches!(err, GotoDefinitionError::OutsideWorkspace { .. }),
+            "{err}"
+        );
+    }
+
+    #[test]
+    fn identifier_at_finds_name_and_qualifier() {
+        let line = "\tok := auth.Validate(tok)";
+        let (name, start, qualifier) = identifier_at(line, 14).unwrap();
+        assert_eq!(name, "Validate");
+        assert_eq!(start, 12);
+        assert_eq!(qualifier.as_deref(), Some("auth"));
+        // Just past the end of the identifier.
+        assert_eq!(identifier_at("x := y", 2).unwrap().0, "x");
+        assert!(identifier_at("a  b", 3).is_none());
+    }
+
+    #[test]
+    fn resolves_by_call_edge_qualifier_and_import() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path();
+        std::fs::create_dir_all(workspace.join("auth")).unwrap();
+        std::fs::create_dir_all(workspace.join("billing")).unwrap();
+        std::fs::write(
+            workspace.join("main.go"),
+            "package main\n\nimport (\n\t\"net/http\"\n\t\"example.com/app/auth\"\n)\n\nfunc main() {\n\tauth.Validate(\"t\")\n\thttp.Get(\"x\")\n\tValidate()\n}\n",
+        )
+        .unwrap();
+        for record in [
+            symbol("main", "main.main", "main.go", (8, 12)),
+            symbol("Validate", "auth.Validate", "auth/token.go", (3, 9)),
+            symbol("Validate", "billing.Validate", "billing/card.go", (5, 7)),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "stable::main.main".to_string(),
+                to_symbol_id: Some("stable::auth.Validate".to_string()),
+                to_name: None,
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "main.go".to_string(),
+                source_line: 9,
+            }],
+        )
+        .unwrap();
+
+        let lookup = |spec: &str| {
+            goto_definition(
+                &conn,
+                workspace,
+                "repo",
+                "main",
+                &Position::parse(spec).unwrap(),
+            )
+            .unwrap()
+        };
+
+        let by_edge = lookup("main.go:9:8");
+        assert_eq!(by_edge.definitions.len(), 1);
+        assert_eq!(by_edge.definitions[0].via, DefinitionVia::CallEdge);
+        assert_eq!(by_edge.definitions[0].path, "auth/token.go");
+
+        // No edge on this line and no qualifier: both candidates tie.
+        let ambiguous = lookup("main.go:11:3");
+        assert_eq!(ambiguous.definitions.len(), 2);
+        assert!(
+            ambiguous
+                .definitions
+                .iter()
+                .all(|d| d.via == DefinitionVia::Name)
+        );
+
+        let declaration = lookup("main.go:8:7");
+        assert_eq!(declaration.definitions[0].via, DefinitionVia::Declaration);
+
+        let external = lookup("main.go:10:8");
+        assert!(external.definitions.is_empty());
+        let import = external.external.unwrap();
+        assert_eq!(import.line, 4);
+        assert_eq!(import.text, "\"net/http\"");
+    }
+
+    #[test]
+    fn locals_shadow_symbols_of_the_same_name() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path();
+        std::fs::write(
+            workspace.join("main.go"),
+            "package main\n\nfunc main() {\n\ttoken := \"t\"\n\tuse(token)\n}\n",
+        )
+        .unwrap();
+        for record in [
+            symbol("main", "main.main", "main.go", (3, 6)),
+            symbol("token", "auth.token", "auth/token.go", (1, 1)),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        cruxe_state::locals::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "main.go",
+            &[LocalRecord {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "main.go".to_string(),
+                name: "token".to_string(),
+                kind: "local".to_string(),
+                line: 4,
+                column: 2,
+                symbol_id: Some("stable::main.main".to_string()),
+                symbol: Some("main.main".to_string()),
+                uses: vec![
+                    cruxe_core::types::LocalUse {
+                        line: 4,
+                        column: 2,
+                        write: true,
+                    },
+                    cruxe_core::types::LocalUse {
+                        line: 5,
+                        column: 6,
+                        write: false,
+                    },
+                ],
+            }],
+        )
+        .unwrap();
+
+        let lookup = goto_definition(
+            &conn,
+            workspace,
+            "repo",
+            "main",
+            &Position::parse("main.go:5:8").unwrap(),
+        )
+        .unwrap();
+        assert_eq!(lookup.definitions.len(), 1);
+        let local = &lookup.definitions[0];
+        assert_eq!(local.via, DefinitionVia::Local);
+        assert_eq!(local.qualified_name, "main.main.token");
+        assert_eq!((local.line_start, local.column), (4, Some(2)));
+    }
+}
@@ -0,0 +1,470 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::{CallEdge, SymbolRecord};
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::io::{self, Write};
+use std::path::{Path, PathBuf};
+
+mod csv;
+mod cypher;
+mod delta;
+mod graphml;
+mod html;
+mod lsif;
+mod ndjson;
+mod pb;
+mod plantuml;
+pub mod protobuf;
+mod scip;
+mod usage;
+
+pub use csv::{EDGES_FILE, SYMBOLS_FILE, write_csv_tables};
+pub use delta::{GraphDelta, diff_snapshots};
+pub use ndjson::{StreamStats, stream_ndjson};
+pub use pb::{INDEX_PB_FILE, INDEX_SCHEMA_VERSION, IndexFile, read_index};
+pub(crate) use plantuml::{Relation, supertypes_from_source};
+
+/// File-level edge sources (imports, top-level calls) use this id prefix.
+const FILE_NODE_PREFIX: &str = "file::";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ExportFormat {
+    Graphml,
+    /// Sourcegraph SCIP protobuf index (`index.scip`).
+    Scip,
+    /// LSIF 0.4 dump, one JSON vertex/edge per line (`dump.lsif`).
+    Lsif,
+    /// One JSON object per symbol/edge per line; streamable.
+    Ndjson,
+    /// Separate `symbols.csv` and `edges.csv` tables; see [`write_csv_tables`].
+    Csv,
+    /// Single self-contained HTML page with an interactive graph viewer.
+    Html,
+    /// PlantUML class diagram, or a sequence diagram along
+    /// [`ExportOptions::call_path`].
+    Plantuml,
+    /// Neo4j Cypher script of idempotent `MERGE` statements.
+    Cypher,
+    /// Versioned protobuf index (`index.pb`); read back with [`read_index`].
+    Pb,
+    /// Per-symbol call and reference counts as one CSV table, for tracking
+    /// usage across CI runs.
+    Usage,
+}
+
+impl ExportFormat {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "graphml" => Some(Self::Graphml),
+            "scip" => Some(Self::Scip),
+            "lsif" => Some(Self::Lsif),
+            "ndjson" | "jsonl" => Some(Self::Ndjson),
+            "csv" => Some(Self::Csv),
+            "html" => Some(Self::Html),
+            "plantuml" | "puml" => Some(Self::Plantuml),
+            "cypher" | "neo4j" => Some(Self::Cypher),
+            "pb" | "protobuf" => Some(Self::Pb),
+            "usage" => Some(Self::Usage),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Graphml => "graphml",
+            Self::Scip => "scip",
+            Self::Lsif => "lsif",
+            Self::Ndjson => "ndjson",
+            Self::Csv => "csv",
+            Self::Html => "html",
+            Self::Plantuml => "plantuml",
+            Self::Cypher => "cypher",
+            Self::Pb => "pb",
+            Self::Usage => "usage",
+        }
+    }
+
+    /// Binary formats must not be written to an interactive terminal.
+    pub fn is_binary(self) -> bool {
+        matches!(self, Self::Scip | Self::Pb)
+    }
+
+    /// Formats made of several files, written into a directory.
+    pub fn writes_directory(self) -> bool {
+        matches!(self, Self::Csv)
+    }
+}
+
+/// Options shared by all exporters.
+#[derive(Debug, Clone, Default)]
+pub struct ExportOptions {
+    /// Workspace root used to read source lines for precise column ranges.
+    /// Without it, occurrence ranges cover whole lines.
+    pub source_root: Option<PathBuf>,
+    /// PlantUML only: symbol names from caller to callee. When set, a
+    /// sequence diagram of this call path replaces the class diagram.
+    pub call_path: Vec<String>,
+}
+
+/// A symbol (or synthetic file node) in an exported graph.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct GraphNode {
+    pub id: String,
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub language: String,
+    /// Directory containing the file, used as a coarse package grouping.
+    pub package: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+}
+
+impl GraphNode {
+    /// Lines of code spanned by the symbol.
+    pub fn loc(&self) -> u32 {
+        if self.line_start == 0 {
+            return 0;
+        }
+        self.line_end.max(self.line_start) - self.line_start + 1
+    }
+}
+
+/// A resolved edge between two nodes of an exported graph.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, Hash, JsonSchema)]
+pub struct GraphEdge {
+    pub source: String,
+    pub target: String,
+    pub kind: String,
+    pub confidence: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub file: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub line: Option<u32>,
+}
+
+/// Point-in-time view of the symbol graph for one repo/ref.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct GraphSnapshot {
+    pub repo: String,
+    pub ref_name: String,
+    pub nodes: Vec<GraphNode>,
+    pub edges: Vec<GraphEdge>,
+    /// Edges whose target could not be resolved to a symbol; not exported.
+    pub unresolved_edges: usize,
+}
+
+/// Load all symbols and resolved edges for a repo/ref.
+///
+/// Edge endpoints that are not indexed symbols (file-level sources, stale
+/// targets) become synthetic nodes so every exported edge is well-formed.
+pub fn load_graph_snapshot(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<GraphSnapshot, StateError> {
+    let mut nodes = Vec::new();
+    let mut node_index: HashMap<String, usize> = HashMap::new();
+    for symbol in symbols::list_symbols_for_ref(conn, repo, ref_name)? {
+        if node_index.contains_key(&symbol.symbol_stable_id) {
+            continue;
+        }
+        node_index.insert(symbol.symbol_stable_id.clone(), nodes.len());
+        nodes.push(node_from_symbol(symbol));
+    }
+
+    let mut graph_edges = Vec::new();
+    let mut unresolved_edges = 0usize;
+    for edge in edges::list_edges_for_ref(conn, repo, ref_name)? {
+        let Some(edge) = resolved_edge(edge) else {
+            unresolved_edges += 1;
+            continue;
+        };
+        for endpoint in [&edge.source, &edge.target] {
+            if !node_index.contains_key(endpoint) {
+                node_index.insert(endpoint.clone(), nodes.len());
+                nodes.push(synthetic_node(endpoint));
+            }
+        }
+        graph_edges.push(edge);
+    }
+
+    Ok(GraphSnapshot {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        nodes,
+        edges: graph_edges,
+        unresolved_edges,
+    })
+}
+
+/// Serialize a snapshot in the requested format.
+pub fn write_graph<W: Write>(
+    snapshot: &GraphSnapshot,
+    format: ExportFormat,
+    options: &ExportOptions,
+    writer: &mut W,
+) -> io::Result<()> {
+    match format {
+        ExportFormat::Graphml => graphml::write_graphml(snapshot, writer),
+        ExportFormat::Scip => scip::write_scip(snapshot, options, writer),
+        ExportFormat::Lsif => lsif::write_lsif(snapshot, options, writer),
+        ExportFormat::Ndjson => ndjson::write_ndjson(snapshot, writer),
+        ExportFormat::Html => html::write_html(snapshot, writer),
+        ExportFormat::Plantuml => plantuml::write_plantuml(snapshot, options, writer),
+        ExportFormat::Cypher => cypher::write_cypher(snapshot, writer),
+        ExportFormat::Pb => pb::write_pb(snapshot, writer),
+        ExportFormat::Usage => usage::write_usage(snapshot, writer),
+        ExportFormat::Csv => Err(io::Error::new(
+            io::ErrorKind::InvalidInput,
+            "csv export writes two tables; use write_csv_tables",
+        )),
+    }
+}
+
+/// Lazily loaded source lines used to turn line numbers into column ranges.
+struct SourceLines<'a> {
+    root: Option<&'a Path>,
+    files: HashMap<String, Option<Vec<String>>>,
+}
+
+impl<'a> SourceLines<'a> {
+    fn new(root: Option<&'a Path>) -> Self {
+        Self {
+            root,
+            files: HashMap::new(),
+        }
+    }
+
+    /// Zero-based `(line, start_byte, end_byte)` of `name` on a one-based
+    /// source line. Falls back to the trimmed line (or an empty range when
+    /// the source is unavailable).
+    fn name_range(&mut self, path: &str, line: u32, name: &str) -> (u32, u32, u32) {
+        let line0 = line.saturating_sub(1);
+        let Some(text) = self.line(path, line0) else {
+            return (line0, 0, 0);
+        };
+        if !name.is_empty()
+            && let Some(start) = text.find(name)
+        {
+            return (line0, start as u32, (start + name.len()) as u32);
+        }
+        let start = text.len() - text.trim_start().len();
+        (line0, start as u32, text.trim_end().len().max(start) as u32)
+    }
+
+    /// Convert a byte offset on a zero-based line to UTF-16 code units, as
+    /// required by LSP-style positions.
+    fn utf16_column(&mut self, path: &str, line0: u32, byte: u32) -> u32 {
+        let Some(text) = self.line(path, line0) else {
+            return byte;
+        };
+        let byte = (byte as usize).min(text.len());
+        text.get(..byte)
+            .map_or(byte, |prefix| prefix.encode_utf16().count()) as u32
+    }
+
+    fn line(&mut self, path: &str, line0: u32) -> Option<&str> {
+        let root = self.root?;
+        let lines = self.files.entry(path.to_string()).or_insert_with(|| {
+            std::fs::read_to_string(root.join(path))
+                .ok()
+                .map(|content| content.lines().map(str::to_string).collect())
+        });
+        lines.as_ref()?.get(line0 as usize).map(String::as_str)
+    }
+}
+
+fn node_from_symbol(symbol: SymbolRecord) -> GraphNode {
+    GraphNode {
+        id: symbol.symbol_stable_id,
+        package: package_for_path(&symbol.path),
+        name: symbol.name,
+        qualified_name: symbol.qualified_name,
+        kind: symbol.kind.as_str().to_string(),
+        language: symbol.language,
+        path: symbol.path,
+        line_start: symbol.line_start,
+        line_end: symbol.line_end,
+        signature: symbol.signature,
+    }
+}
+
+/// Convert a stored edge, or `None` when its target was never resolved.
+fn resolved_edge(edge: CallEdge) -> Option<GraphEdge> {
+    let target = edge.to_symbol_id?;
+    let has_site = !edge.source_file.is_empty();
+    Some(GraphEdge {
+        source: edge.from_symbol_id,
+        target,
+        kind: edge.edge_type,
+        confidence: edge.confidence,
+        file: has_site.then_some(edge.source_file),
+        line: (has_site && edge.source_line > 0).then_some(edge.source_line),
+    })
+}
+
+fn synthetic_node(id: &str) -> GraphNode {
+    if let Some(path) = id.strip_prefix(FILE_NODE_PREFIX) {
+        return GraphNode {
+            id: id.to_string(),
+            name: path.rsplit('/').next().unwrap_or(path).to_string(),
+            qualified_name: path.to_string(),
+            kind: "file".to_string(),
+            language: String::new(),
+            package: package_for_path(path),
+            path: path.to_string(),
+            line_start: 0,
+            line_end: 0,
+            signature: None,
+        };
+    }
+    GraphNode {
+        id: id.to_string(),
+        name: id.to_string(),
+        qualified_name: id.to_string(),
+        kind: "unknown".to_string(),
+        language: String::new(),
+        package: String::new(),
+        path: String::new(),
+        line_start: 0,
+        line_end: 0,
+        signature: None,
+    }
+}
+
+fn package_for_path(path: &str) -> String {
+    path.rsplit_once('/')
+        .map(|(dir, _)| dir.to_string())
+        .unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (tmp, conn)
+    }
+
+    fn insert_symbol(conn: &Connection, stable_id: &str, name: &str, path: &str, line: u32) {
+        symbols::insert_symbol(
+            conn,
+            &SymbolRecord {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                commit: None,
+                path: path.to_string(),
+                language: "rust".to_string(),
+                symbol_id: format!("sym::{stable_id}"),
+                symbol_stable_id: stable_id.to_string(),
+                name: name.to_string(),
+                qualified_name: name.to_string(),
+                kind: SymbolKind::Function,
+                signature: None,
+                line_start: line,
+                line_end: line + 4,
+                parent_symbol_id: None,
+                visibility: None,
+                content: None,
+            },
+        )
+        .unwrap();
+    }
+
+    fn call(from: &str, to: Option<&str>, to_name: Option<&str>, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: to.map(str::to_string),
+            to_name: to_name.map(str::to_string),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: "src/auth/handler.rs".to_string(),
+            source_line: line,
+        }
+    }
+
+    #[test]
+    fn export_format_parse_is_case_insensitive() {
+        assert_eq!(ExportFormat::parse("GraphML"), Some(ExportFormat::Graphml));
+        assert_eq!(ExportFormat::parse("scip"), Some(ExportFormat::Scip));
+        assert_eq!(ExportFormat::parse("lsif"), Some(ExportFormat::Lsif));
+        assert_eq!(ExportFormat::parse("jsonl"), Some(ExportFormat::Ndjson));
+        assert_eq!(ExportFormat::parse("CSV"), Some(ExportFormat::Csv));
+        assert_eq!(ExportFormat::parse("html"), Some(ExportFormat::Html));
+        assert_eq!(ExportFormat::parse("puml"), Some(ExportFormat::Plantuml));
+        assert_eq!(ExportFormat::parse("neo4j"), Some(ExportFormat::Cypher));
+        assert_eq!(ExportFormat::parse("protobuf"), Some(ExportFormat::Pb));
+        assert_eq!(ExportFormat::parse("usage"), Some(ExportFormat::Usage));
+        assert_eq!(ExportFormat::parse("svg"), None);
+    }
+
+    #[test]
+    fn snapshot_contains_symbols_resolved_edges_and_file_nodes() {
+        let (_tmp, conn) = setup();
+        insert_symbol(&conn, "stable-a", "handle", "src/auth/handler.rs", 10);
+        insert_symbol(&conn, "stable-b", "validate", "src/auth/token.rs", 3);
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("stable-a", Some("stable-b"), None, 12),
+                call("file::src/auth/handler.rs", Some("stable-a"), None, 1),
+                call("stable-a", None, Some("external::log"), 13),
+            ],
+        )
+        .unwrap();
+
+        let snapshot = load_graph_snapshot(&conn, "repo", "main").unwrap();
+        assert_eq!(snapshot.nodes.len(), 3);
+        assert_eq!(snapshot.edges.len(), 2);
+        assert_eq!(snapshot.unresolved_edges, 1);
+
+        let handle = snapshot.nodes.iter().find(|n| n.id == "stable-a").unwrap();
+        assert_eq!(handle.package, "src/auth");
+        assert_eq!(handle.loc(), 5);
+
+        let file_node = snapshot
+            .nodes
+            .iter()
+            .find(|n| n.id == "file::src/auth/handler.rs")
+            .unwrap();
+        assert_eq!(file_node.kind, "file");
+        assert_eq!(file_node.name, "handler.rs");
+    }
+
+    #[test]
+    fn source_lines_locate_names_and_fall_back_to_line_span() {
+        let tmp = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(tmp.path().join("src")).unwrap();
+        std::fs::write(
+            tmp.path().join("src/lib.rs"),
+            "fn main() {\n    run_server();\n}\n",
+        )
+        .unwrap();
+
+        let mut lines = SourceLines::new(Some(tmp.path()));
+        assert_eq!(lines.name_range("src/lib.rs", 2, "run_server"), (1, 4, 14));
+        assert_eq!(lines.name_range("src/lib.rs", 2, "missing"), (1, 4, 17));
+        assert_eq!(lines.name_range("src/nope.rs", 3, "x"), (2, 0, 0));
+        assert_eq!(
+            SourceLines::new(None).name_range("src/lib.rs", 1, "main"),
+            (0, 0, 0)
+        );
+    }
+}
@@ -0,0 +1,195 @@
+//! RFC 4180 CSV tables: `symbols.csv` and `edges.csv`.
+//!
+//! Both tables are streamed from SQLite row by row, like the NDJSON export,
+//! and carry a header row so they load directly into spreadsheets, DuckDB
+//! (`read_csv_auto`) or BI tools. Edges reference symbols by `id`.
+
+use super::{GraphEdge, GraphNode, StreamStats, node_from_symbol, resolved_edge};
+use cruxe_core::error::StateError;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use std::io::{self, Write};
+
+pub const SYMBOLS_FILE: &str = "symbols.csv";
+pub const EDGES_FILE: &str = "edges.csv";
+
+const SYMBOL_COLUMNS: &[&str] = &[
+    "id",
+    "name",
+    "qualified_name",
+    "kind",
+    "language",
+    "package",
+    "path",
+    "line_start",
+    "line_end",
+    "signature",
+];
+const EDGE_COLUMNS: &[&str] = &["source", "target", "kind", "confidence", "file", "line"];
+
+/// Stream the symbol and edge tables of a repo/ref to two writers.
+pub fn write_csv_tables<S: Write, E: Write>(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    symbols_out: &mut S,
+    edges_out: &mut E,
+) -> Result<StreamStats, StateError> {
+    let mut stats = StreamStats::default();
+
+    write_row(symbols_out, SYMBOL_COLUMNS).map_err(StateError::Io)?;
+    symbols::for_each_symbol_for_ref(conn, repo, ref_name, |symbol| {
+        write_symbol(symbols_out, &node_from_symbol(symbol)).map_err(StateError::Io)?;
+        stats.nodes += 1;
+        Ok(())
+    })?;
+
+    write_row(edges_out, EDGE_COLUMNS).map_err(StateError::Io)?;
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        match resolved_edge(edge) {
+            Some(edge) => {
+                write_edge(edges_out, &edge).map_err(StateError::Io)?;
+                stats.edges += 1;
+            }
+            None => stats.unresolved_edges += 1,
+        }
+        Ok(())
+    })?;
+
+    Ok(stats)
+}
+
+fn write_symbol<W: Write>(out: &mut W, node: &GraphNode) -> io::Result<()> {
+    write_row(
+        out,
+        &[
+            node.id.as_str(),
+            node.name.as_str(),
+            node.qualified_name.as_str(),
+            node.kind.as_str(),
+            node.language.as_str(),
+            node.package.as_str(),
+            node.path.as_str(),
+            node.line_start.to_string().as_str(),
+            node.line_end.to_string().as_str(),
+            node.signature.as_deref().unwrap_or_default(),
+        ],
+    )
+}
+
+fn write_edge<W: Write>(out: &mut W, edge: &GraphEdge) -> io::Result<()> {
+    write_row(
+        out,
+        &[
+            edge.source.as_str(),
+            edge.target.as_str(),
+            edge.kind.as_str(),
+            edge.confidence.as_str(),
+            edge.file.as_deref().unwrap_or_default(),
+            edge.line
+                .map(|line| line.to_string())
+                .unwrap_or_default()
+                .as_str(),
+        ],
+    )
+}
+
+pub(super) fn write_row<W: Write>(out: &mut W, fields: &[&str]) -> io::Result<()> {
+    for (idx, field) in fields.iter().enumerate() {
+        if idx > 0 {
+            out.write_all(b",")?;
+        }
+        out.write_all(escape_field(field).as_bytes())?;
+    }
+    out.write_all(b"\r\n")
+}
+
+/// Quote a field when it contains a delimiter, quote or line break, doubling
+/// embedded quotes.
+fn escape_field(value: &str) -> std::borrow::Cow<'_, str> {
+    if value.contains([',', '"', '\r', '\n']) {
+        format!("\"{}\"", value.replace('"', "\"\"")).into()
+    } else {
+        value.into()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    #[test]
+    fn escape_field_quotes_only_when_needed() {
+        assert_eq!(escape_field("plain"), "plain");
+        assert_eq!(escape_field("fn a(x, y)"), "\"fn a(x, y)\"");
+        assert_eq!(escape_field("say \"hi\""), "\"say \"\"hi\"\"\"");
+        assert_eq!(escape_field("two\nlines"), "\"two\nlines\"");
+    }
+
+    #[test]
+    fn tables_have_headers_and_one_row_per_record() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for (stable_id, name) in [("a", "caller"), ("b", "callee")] {
+            symbols::insert_symbol(
+                &conn,
+                &SymbolRecord {
+                    repo: "repo".to_string(),
+                    r#ref: "main".to_string(),
+                    commit: None,
+                    path: "src/lib.rs".to_string(),
+                    language: "rust".to_string(),
+                    symbol_id: format!("sym::{stable_id}"),
+                    symbol_stable_id: stable_id.to_string(),
+                    name: name.to_string(),
+                    qualified_name: name.to_string(),
+                    kind: SymbolKind::Function,
+                    signature: Some(format!("fn {name}(a: u8, b: u8)")),
+                    line_start: 1,
+                    line_end: 3,
+                    parent_symbol_id: None,
+                    visibility: None,
+                    content: None,
+                },
+            )
+            .unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "a".to_string(),
+                to_symbol_id: Some("b".to_string()),
+                to_name: None,
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "src/lib.rs".to_string(),
+                source_line: 2,
+            }],
+        )
+        .unwrap();
+
+        let (mut symbols_buf, mut edges_buf) = (Vec::new(), Vec::new());
+        let stats =
+            write_csv_tables(&conn, "repo", "main", &mut symbols_buf, &mut edges_buf).unwrap();
+        assert_eq!((stats.nodes, stats.edges), (2, 1));
+
+        let symbols_csv = String::from_utf8(symbols_buf).unwrap();
+        let rows: Vec<&str> = symbols_csv.lines().collect();
+        assert_eq!(rows.len(), 3);
+        assert!(rows[0].starts_with("id,name,qualified_name"));
+        assert!(rows[1].ends_with(",1,3,\"fn caller(a: u8, b: u8)\""));
+
+        let edges_csv = String::from_utf8(edges_buf).unwrap();
+        assert_eq!(
+            edges_csv,
+            "source,target,kind,confidence,file,line\r\na,b,calls,static,src/lib.rs,2\r\n"
+        );
+    }
+}
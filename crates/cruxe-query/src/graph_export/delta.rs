@@ -0,0 +1,138 @@
+//! Differences between two snapshots of the same repo/ref, used to stream
+//! incremental graph updates to subscribers.
+
+use super::{GraphEdge, GraphNode, GraphSnapshot};
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+
+/// Nodes and edges that appeared, changed or disappeared between snapshots.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct GraphDelta {
+    pub added_nodes: Vec<GraphNode>,
+    /// New version of nodes whose id was already present.
+    pub changed_nodes: Vec<GraphNode>,
+    pub removed_nodes: Vec<GraphNode>,
+    pub added_edges: Vec<GraphEdge>,
+    pub removed_edges: Vec<GraphEdge>,
+}
+
+impl GraphDelta {
+    pub fn is_empty(&self) -> bool {
+        self.added_nodes.is_empty()
+            && self.changed_nodes.is_empty()
+            && self.removed_nodes.is_empty()
+            && self.added_edges.is_empty()
+            && self.removed_edges.is_empty()
+    }
+}
+
+/// Compute what changed from `old` to `new`. Nodes match by id; edges match
+/// on all fields, counting duplicates, so a call site that moved lines shows
+/// up as one removed and one added edge.
+pub fn diff_snapshots(old: &GraphSnapshot, new: &GraphSnapshot) -> GraphDelta {
+    let mut delta = GraphDelta::default();
+
+    let old_nodes: HashMap<&str, &GraphNode> = old
+        .nodes
+        .iter()
+        .map(|node| (node.id.as_str(), node))
+        .collect();
+    let new_ids: HashSet<&str> = new.nodes.iter().map(|node| node.id.as_str()).collect();
+    for node in &new.nodes {
+        match old_nodes.get(node.id.as_str()) {
+            None => delta.added_nodes.push(node.clone()),
+            Some(previous) if *previous != node => delta.changed_nodes.push(node.clone()),
+            Some(_) => {}
+        }
+    }
+    delta.removed_nodes = old
+        .nodes
+        .iter()
+        .filter(|node| !new_ids.contains(node.id.as_str()))
+        .cloned()
+        .collect();
+
+    let mut old_edges: HashMap<&GraphEdge, usize> = HashMap::new();
+    for edge in &old.edges {
+        *old_edges.entry(edge).or_default() += 1;
+    }
+    for edge in &new.edges {
+        match old_edges.get_mut(edge) {
+            Some(count) if *count > 0 => *count -= 1,
+            _ => delta.added_edges.push(edge.clone()),
+        }
+    }
+    for edge in &old.edges {
+        if let Some(count) = old_edges.get_mut(edge)
+            && *count > 0
+        {
+            *count -= 1;
+            delta.removed_edges.push(edge.clone());
+        }
+    }
+    delta
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn node(id: &str, line: u32) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: id.to_string(),
+            kind: "function".to_string(),
+            language: "rust".to_string(),
+            package: "src".to_string(),
+            path: "src/lib.rs".to_string(),
+            line_start: line,
+            line_end: line + 2,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str, line: u32) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: Some("src/lib.rs".to_string()),
+            line: Some(line),
+        }
+    }
+
+    fn snapshot(nodes: Vec<GraphNode>, edges: Vec<GraphEdge>) -> GraphSnapshot {
+        GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes,
+            edges,
+            unresolved_edges: 0,
+        }
+    }
+
+    #[test]
+    fn diff_reports_added_changed_and_removed_entries() {
+        let old = snapshot(
+            vec![node("a", 1), node("b", 10), node("gone", 20)],
+            vec![edge("a", "b", 2), edge("a", "b", 2), edge("b", "gone", 11)],
+        );
+        let new = snapshot(
+            vec![node("a", 1), node("b", 12), node("c", 30)],
+            vec![edge("a", "b", 2), edge("c", "a", 31)],
+        );
+
+        let delta = diff_snapshots(&old, &new);
+        assert_eq!(delta.added_nodes, vec![node("c", 30)]);
+        assert_eq!(delta.changed_nodes, vec![node("b", 12)]);
+        assert_eq!(delta.removed_nodes, vec![node("gone", 20)]);
+        assert_eq!(delta.added_edges, vec![edge("c", "a", 31)]);
+        assert_eq!(
+            delta.removed_edges,
+            vec![edge("a", "b", 2), edge("b", "gone", 11)]
+        );
+        assert!(diff_snapshots(&new, &new).is_empty());
+    }
+}
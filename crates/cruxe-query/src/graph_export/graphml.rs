@@ -0,0 +1,167 @@
+use super::GraphSnapshot;
+use std::io::{self, Write};
+
+/// GraphML attribute keys as (id, type). Key ids double as attribute
+/// names so Gephi and yEd show readable column headers.
+const NODE_KEYS: &[(&str, &str)] = &[
+    ("label", "string"),
+    ("qualified_name", "string"),
+    ("kind", "string"),
+    ("language", "string"),
+    ("package", "string"),
+    ("file", "string"),
+    ("line", "int"),
+    ("loc", "int"),
+];
+
+const EDGE_KEYS: &[(&str, &str)] = &[
+    ("edge_kind", "string"),
+    ("confidence", "string"),
+    ("call_file", "string"),
+    ("call_line", "int"),
+];
+
+pub(super) fn write_graphml<W: Write>(snapshot: &GraphSnapshot, out: &mut W) -> io::Result<()> {
+    writeln!(out, r#"<?xml version="1.0" encoding="UTF-8"?>"#)?;
+    writeln!(
+        out,
+        r#"<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">"#
+    )?;
+    for (id, ty) in NODE_KEYS {
+        writeln!(
+            out,
+            r#"  <key id="{id}" for="node" attr.name="{id}" attr.type="{ty}"/>"#
+        )?;
+    }
+    for (id, ty) in EDGE_KEYS {
+        writeln!(
+            out,
+            r#"  <key id="{id}" for="edge" attr.name="{id}" attr.type="{ty}"/>"#
+        )?;
+    }
+    writeln!(
+        out,
+        r#"  <graph id="{}" edgedefault="directed">"#,
+        escape_xml(&format!("{}@{}", snapshot.repo, snapshot.ref_name))
+    )?;
+
+    for node in &snapshot.nodes {
+        writeln!(out, r#"    <node id="{}">"#, escape_xml(&node.id))?;
+        write_data(out, "label", &node.name)?;
+        write_data(out, "qualified_name", &node.qualified_name)?;
+        write_data(out, "kind", &node.kind)?;
+        write_data(out, "language", &node.language)?;
+        write_data(out, "package", &node.package)?;
+        write_data(out, "file", &node.path)?;
+        if node.line_start > 0 {
+            write_data(out, "line", &node.line_start.to_string())?;
+            write_data(out, "loc", &node.loc().to_string())?;
+        }
+        writeln!(out, "    </node>")?;
+    }
+
+    for (idx, edge) in snapshot.edges.iter().enumerate() {
+        writeln!(
+            out,
+            r#"    <edge id="e{idx}" source="{}" target="{}">"#,
+            escape_xml(&edge.source),
+            escape_xml(&edge.target)
+        )?;
+        write_data(out, "edge_kind", &edge.kind)?;
+        write_data(out, "confidence", &edge.confidence)?;
+        if let Some(file) = &edge.file {
+            write_data(out, "call_file", file)?;
+        }
+        if let Some(line) = edge.line {
+            write_data(out, "call_line", &line.to_string())?;
+        }
+        writeln!(out, "    </edge>")?;
+    }
+
+    writeln!(out, "  </graph>")?;
+    writeln!(out, "</graphml>")?;
+    Ok(())
+}
+
+fn write_data<W: Write>(out: &mut W, key: &str, value: &str) -> io::Result<()> {
+    if value.is_empty() {
+        return Ok(());
+    }
+    writeln!(
+        out,
+        r#"      <data key="{key}">{}</data>"#,
+        escape_xml(value)
+    )
+}
+
+fn escape_xml(value: &str) -> String {
+    let mut escaped = String::with_capacity(value.len());
+    for ch in value.chars() {
+        match ch {
+            '&' => escaped.push_str("&amp;"),
+            '<' => escaped.push_str("&lt;"),
+            '>' => escaped.push_str("&gt;"),
+            '"' => escaped.push_str("&quot;"),
+            '\'' => escaped.push_str("&apos;"),
+            // XML 1.0 forbids most control characters even when escaped.
+            c if (c as u32) < 0x20 && !matches!(c, '\t' | '\n' | '\r') => {}
+            c => escaped.push(c),
+        }
+    }
+    escaped
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::{GraphEdge, GraphNode};
+
+    fn node(id: &str, name: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: name.to_string(),
+            qualified_name: format!("auth::{name}"),
+            kind: "function".to_string(),
+            language: "rust".to_string(),
+            package: "src/auth".to_string(),
+            path: "src/auth/mod.rs".to_string(),
+            line_start: 4,
+            line_end: 9,
+            signature: None,
+        }
+    }
+
+    #[test]
+    fn graphml_output_has_keys_nodes_and_edges() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![node("a", "handle"), node("b", "Vec<T>")],
+            edges: vec![GraphEdge {
+                source: "a".to_string(),
+                target: "b".to_string(),
+                kind: "calls".to_string(),
+                confidence: "high".to_string(),
+                file: Some("src/auth/mod.rs".to_string()),
+                line: Some(5),
+            }],
+            unresolved_edges: 0,
+        };
+        let mut buf = Vec::new();
+        write_graphml(&snapshot, &mut buf).unwrap();
+        let xml = String::from_utf8(buf).unwrap();
+
+        assert!(xml.contains(r#"<key id="loc" for="node" attr.name="loc" attr.type="int"/>"#));
+        assert!(xml.contains(r#"<graph id="repo@main" edgedefault="directed">"#));
+        assert!(xml.contains(r#"<data key="label">Vec&lt;T&gt;</data>"#));
+        assert!(xml.contains(r#"<data key="loc">6</data>"#));
+        assert!(xml.contains(r#"<edge id="e0" source="a" target="b">"#));
+        assert!(xml.contains(r#"<data key="confidence">high</data>"#));
+        assert!(xml.trim_end().ends_with("</graphml>"));
+    }
+
+    #[test]
+    fn escape_xml_drops_invalid_control_characters() {
+        assert_eq!(escape_xml("a\u{1}b&\"c\""), "ab&amp;&quot;c&quot;");
+    }
+}
@@ -0,0 +1,143 @@
+//! Self-contained HTML viewer: the graph as JSON plus a small canvas viewer
+//! (pan/zoom, search, expand neighbors) in one file that opens offline.
+//!
+//! The viewer template lives in `viewer.html`. Nodes and edges are embedded
+//! as compact arrays (edges reference nodes by position) to keep large
+//! graphs small.
+
+use super::GraphSnapshot;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::io::{self, Write};
+
+const TEMPLATE: &str = include_str!("viewer.html");
+const TITLE_PLACEHOLDER: &str = "__CRUXE_TITLE__";
+const DATA_PLACEHOLDER: &str = "/*__CRUXE_GRAPH__*/";
+
+/// Nodes drawn before the user searches or expands anything.
+const INITIAL_NODES: usize = 40;
+
+#[derive(Serialize)]
+struct ViewerData<'a> {
+    title: String,
+    initial: usize,
+    /// `[id, name, qualified_name, kind, path, line]`
+    nodes: Vec<(&'a str, &'a str, &'a str, &'a str, &'a str, u32)>,
+    /// `[source index, target index, kind]`
+    edges: Vec<(usize, usize, &'a str)>,
+}
+
+pub(super) fn write_html<W: Write>(snapshot: &GraphSnapshot, out: &mut W) -> io::Result<()> {
+    let index: HashMap<&str, usize> = snapshot
+        .nodes
+        .iter()
+        .enumerate()
+        .map(|(idx, node)| (node.id.as_str(), idx))
+        .collect();
+    let data = ViewerData {
+        title: format!("cruxe graph · {}", snapshot.ref_name),
+        initial: INITIAL_NODES,
+        nodes: snapshot
+            .nodes
+            .iter()
+            .map(|node| {
+                (
+                    node.id.as_str(),
+                    node.name.as_str(),
+                    node.qualified_name.as_str(),
+                    node.kind.as_str(),
+                    node.path.as_str(),
+                    node.line_start,
+                )
+            })
+            .collect(),
+        edges: snapshot
+            .edges
+            .iter()
+            .filter_map(|edge| {
+                Some((
+                    *index.get(edge.source.as_str())?,
+                    *index.get(edge.target.as_str())?,
+                    edge.kind.as_str(),
+                ))
+            })
+            .collect(),
+    };
+    let json = serde_json::to_string(&data)?;
+
+    let (head, tail) = TEMPLATE
+        .split_once(DATA_PLACEHOLDER)
+        .expect("viewer template has a data placeholder");
+    out.write_all(
+        head.replace(TITLE_PLACEHOLDER, &escape_html(&data.title))
+            .as_bytes(),
+    )?;
+    out.write_all(escape_script(&json).as_bytes())?;
+    out.write_all(tail.as_bytes())
+}
+
+/// Keep embedded JSON from closing its `<script>` element: `<` never appears
+/// raw, which also rules out `<!--` and `</script>`.
+fn escape_script(json: &str) -> String {
+    json.replace('<', "\\u003c")
+}
+
+fn escape_html(text: &str) -> String {
+    text.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+        .replace('"', "&quot;")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::{GraphEdge, GraphNode};
+
+    fn node(id: &str, name: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: "function".to_string(),
+            language: "rust".to_string(),
+            package: "src".to_string(),
+            path: "src/lib.rs".to_string(),
+            line_start: 1,
+            line_end: 2,
+            signature: None,
+        }
+    }
+
+    #[test]
+    fn html_embeds_escaped_graph_data() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "feat/<x>".to_string(),
+            nodes: vec![node("a", "run"), node("b", "</script><b>")],
+            edges: vec![GraphEdge {
+                source: "a".to_string(),
+                target: "b".to_string(),
+                kind: "calls".to_string(),
+                confidence: "static".to_string(),
+                file: None,
+                line: None,
+            }],
+            unresolved_edges: 0,
+        };
+        let mut buf = Vec::new();
+        write_html(&snapshot, &mut buf).unwrap();
+        let html = String::from_utf8(buf).unwrap();
+
+        assert!(html.starts_with("<!DOCTYPE html>"));
+        assert!(html.contains("<title>cruxe graph · feat/&lt;x&gt;</title>"));
+        assert!(!html.contains(DATA_PLACEHOLDER));
+        assert_eq!(html.matches("</script>").count(), 2);
+
+        let start = html.find(r#"type="application/json">"#).unwrap() + 24;
+        let end = start + html[start..].find("</script>").unwrap();
+        let data: serde_json::Value = serde_json::from_str(&html[start..end]).unwrap();
+        assert_eq!(data["nodes"][1][1], "</script><b>");
+        assert_eq!(data["edges"][0], serde_json::json!([0, 1, "calls"]));
+    }
+}
@@ -0,0 +1,331 @@
+//! LSIF 0.4 dump writer (line-delimited JSON).
+//!
+//! Emits definitions, references and hovers per symbol using the standard
+//! `range -> resultSet -> {definitionResult, referenceResult, hoverResult}`
+//! layout, so existing LSIF consumers can load the dump without changes.
+
+use super::{ExportOptions, GraphNode, GraphSnapshot, SourceLines};
+use serde_json::{Value, json};
+use std::collections::{BTreeMap, HashMap};
+use std::io::{self, Write};
+
+const LSIF_VERSION: &str = "0.4.3";
+
+struct LsifWriter<'w, W: Write> {
+    out: &'w mut W,
+    next_id: u64,
+}
+
+impl<W: Write> LsifWriter<'_, W> {
+    fn vertex(&mut self, label: &str, fields: Value) -> io::Result<u64> {
+        self.emit("vertex", label, fields)
+    }
+
+    fn edge(&mut self, label: &str, fields: Value) -> io::Result<u64> {
+        self.emit("edge", label, fields)
+    }
+
+    fn emit(&mut self, kind: &str, label: &str, fields: Value) -> io::Result<u64> {
+        self.next_id += 1;
+        let mut element = json!({ "id": self.next_id, "type": kind, "label": label });
+        if let (Some(target), Value::Object(extra)) = (element.as_object_mut(), fields) {
+            target.extend(extra);
+        }
+        serde_json::to_writer(&mut *self.out, &element)?;
+        self.out.write_all(b"\n")?;
+        Ok(self.next_id)
+    }
+}
+
+/// Ranges in a single document, grouped for `contains` edges.
+#[derive(Default)]
+struct DocumentRanges {
+    language: String,
+    ranges: Vec<u64>,
+}
+
+pub(super) fn write_lsif<W: Write>(
+    snapshot: &GraphSnapshot,
+    options: &ExportOptions,
+    out: &mut W,
+) -> io::Result<()> {
+    let root = options.source_root.as_deref();
+    let root_uri = root
+        .map(|path| format!("file://{}", path.display()))
+        .unwrap_or_default();
+    let mut source = SourceLines::new(root);
+    let mut writer = LsifWriter { out, next_id: 0 };
+
+    writer.vertex(
+        "metaData",
+        json!({
+            "version": LSIF_VERSION,
+            "projectRoot": root_uri,
+            "positionEncoding": "utf-16",
+            "toolInfo": { "name": "cruxe", "version": env!("CARGO_PKG_VERSION") },
+        }),
+    )?;
+    let project = writer.vertex("project", json!({ "kind": "cruxe" }))?;
+
+    // Definitions first, so references can point at an existing resultSet.
+    let symbols: Vec<&GraphNode> = snapshot
+        .nodes
+        .iter()
+        .filter(|node| !node.path.is_empty() && node.line_start > 0)
+        .filter(|node| !matches!(node.kind.as_str(), "file" | "unknown"))
+        .collect();
+    let mut documents: BTreeMap<String, DocumentRanges> = BTreeMap::new();
+    let mut definitions: HashMap<&str, (u64, u64, String)> = HashMap::new();
+
+    for node in &symbols {
+        let range = emit_range(
+            &mut writer,
+            &mut source,
+            &node.path,
+            node.line_start,
+            &node.name,
+        )?;
+        let result_set = writer.vertex("resultSet", json!({}))?;
+        writer.edge("next", json!({ "outV": range, "inV": result_set }))?;
+        let hover = writer.vertex(
+            "hoverResult",
+            json!({ "result": { "contents": hover_contents(node) } }),
+        )?;
+        writer.edge(
+            "textDocument/hover",
+            json!({ "outV": result_set, "inV": hover }),
+        )?;
+
+        let doc = documents.entry(node.path.clone()).or_default();
+        if doc.language.is_empty() {
+            doc.language = node.language.clone();
+        }
+        doc.ranges.push(range);
+        definitions.insert(node.id.as_str(), (range, result_set, node.path.clone()));
+    }
+
+    let mut references: HashMap<&str, Vec<(u64, String)>> = HashMap::new();
+    let by_id: HashMap<&str, &GraphNode> = symbols
+        .iter()
+        .map(|node| (node.id.as_str(), *node))
+        .collect();
+    for edge in &snapshot.edges {
+        let (Some(file), Some(line)) = (edge.file.as_deref(), edge.line) else {
+            continue;
+        };
+        let Some(target) = by_id.get(edge.target.as_str()) else {
+            continue;
+        };
+        let range = emit_range(&mut writer, &mut source, file, line, &target.name)?;
+        let result_set = definitions[edge.target.as_str()].1;
+        writer.edge("next", json!({ "outV": range, "inV": result_set }))?;
+        documents
+            .entry(file.to_string())
+            .or_default()
+            .ranges
+            .push(range);
+        references
+            .entry(edge.target.as_str())
+            .or_default()
+            .push((range, file.to_string()));
+    }
+
+    // Documents are emitted after their ranges; `contains` edges tie them up.
+    let mut document_ids: HashMap<String, u64> = HashMap::new();
+    for (path, doc) in &documents {
+        let uri = if root_uri.is_empty() {
+            path.clone()
+        } else {
+            format!("{root_uri}/{path}")
+        };
+        let id = writer.vertex(
+            "document",
+            json!({ "uri": uri, "languageId": doc.language }),
+        )?;
+        writer.edge("contains", json!({ "outV": id, "inVs": doc.ranges }))?;
+        document_ids.insert(path.clone(), id);
+    }
+    if !document_ids.is_empty() {
+        let mut ids: Vec<u64> = document_ids.values().copied().collect();
+        ids.sort_unstable();
+        writer.edge("contains", json!({ "outV": project, "inVs": ids }))?;
+    }
+
+    for node in &symbols {
+        let (range, result_set, path) = &definitions[node.id.as_str()];
+        let definition = writer.vertex("definitionResult", json!({}))?;
+        writer.edge(
+            "textDocument/definition",
+            json!({ "outV": result_set, "inV": definition }),
+        )?;
+        writer.edge(
+            "item",
+            json!({ "outV": definition, "inVs": [range], "document": document_ids[path] }),
+        )?;
+
+        let reference = writer.vertex("referenceResult", json!({}))?;
+        writer.edge(
+            "textDocument/references",
+            json!({ "outV": result_set, "inV": reference }),
+        )?;
+        writer.edge(
+            "item",
+            json!({
+                "outV": reference,
+                "inVs": [range],
+                "document": document_ids[path],
+                "property": "definitions",
+            }),
+        )?;
+        let mut by_document: BTreeMap<u64, Vec<u64>> = BTreeMap::new();
+        for (ref_range, file) in references.get(node.id.as_str()).into_iter().flatten() {
+            by_document
+                .entry(document_ids[file])
+                .or_default()
+                .push(*ref_range);
+        }
+        for (document, ranges) in by_document {
+            writer.edge(
+                "item",
+                json!({
+                    "outV": reference,
+                    "inVs": ranges,
+                    "document": document,
+                    "property": "references",
+                }),
+            )?;
+        }
+    }
+
+    Ok(())
+}
+
+fn emit_range<W: Write>(
+    writer: &mut LsifWriter<'_, W>,
+    source: &mut SourceLines<'_>,
+    path: &str,
+    line: u32,
+    name: &str,
+) -> io::Result<u64> {
+    let (line0, start, end) = source.name_range(path, line, name);
+    let start = source.utf16_column(path, line0, start);
+    let end = source.utf16_column(path, line0, end);
+    writer.vertex(
+        "range",
+        json!({
+            "start": { "line": line0, "character": start },
+            "end": { "line": line0, "character": end },
+        }),
+    )
+}
+
+fn hover_contents(node: &GraphNode) -> Value {
+    let mut contents = Vec::new();
+    if let Some(signature) = node.signature.as_deref() {
+        contents.push(json!({ "language": node.language, "value": signature }));
+    }
+    contents.push(json!(format!(
+        "{} `{}` — {}:{}",
+        node.kind, node.qualified_name, node.path, node.line_start
+    )));
+    Value::Array(contents)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+
+    fn node(id: &str, name: &str, line: u32) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: "function".to_string(),
+            language: "rust".to_string(),
+            package: "src".to_string(),
+            path: "src/lib.rs".to_string(),
+            line_start: line,
+            line_end: line,
+            signature: Some(format!("fn {name}()")),
+        }
+    }
+
+    fn dump(snapshot: &GraphSnapshot, root: &std::path::Path) -> Vec<Value> {
+        let mut buf = Vec::new();
+        write_lsif(
+            snapshot,
+            &ExportOptions {
+                source_root: Some(root.to_path_buf()),
+                ..Default::default()
+            },
+            &mut buf,
+        )
+        .unwrap();
+        String::from_utf8(buf)
+            .unwrap()
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect()
+    }
+
+    #[test]
+    fn lsif_dump_links_definitions_references_and_hovers() {
+        let tmp = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(tmp.path().join("src")).unwrap();
+        std::fs::write(
+            tmp.path().join("src/lib.rs"),
+            "fn helper() {}\nfn main() { helper(); }\n",
+        )
+        .unwrap();
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![node("h", "helper", 1), node("m", "main", 2)],
+            edges: vec![GraphEdge {
+                source: "m".to_string(),
+                target: "h".to_string(),
+                kind: "calls".to_string(),
+                confidence: "high".to_string(),
+                file: Some("src/lib.rs".to_string()),
+                line: Some(2),
+            }],
+            unresolved_edges: 0,
+        };
+
+        let elements = dump(&snapshot, tmp.path());
+        assert_eq!(elements[0]["label"], "metaData");
+        assert_eq!(elements[0]["version"], LSIF_VERSION);
+
+        // Ids are unique and increasing.
+        let ids: Vec<u64> = elements.iter().map(|e| e["id"].as_u64().unwrap()).collect();
+        assert!(ids.windows(2).all(|pair| pair[0] < pair[1]));
+
+        let count = |label: &str| elements.iter().filter(|e| e["label"] == label).count();
+        assert_eq!(count("document"), 1);
+        assert_eq!(count("range"), 3);
+        assert_eq!(count("hoverResult"), 2);
+        assert_eq!(count("definitionResult"), 2);
+        assert_eq!(count("referenceResult"), 2);
+
+        let reference_range = elements
+            .iter()
+            .find(|e| {
+                e["label"] == "range" && e["start"]["line"] == 1 && e["start"]["character"] == 12
+            })
+            .expect("call-site range for helper()");
+        assert_eq!(reference_range["end"]["character"], 18);
+
+        let reference_items = elements
+            .iter()
+            .filter(|e| e["label"] == "item" && e["property"] == "references")
+            .count();
+        assert_eq!(reference_items, 1);
+
+        let hover = elements
+            .iter()
+            .find(|e| e["label"] == "hoverResult")
+            .unwrap();
+        assert_eq!(hover["result"]["contents"][0]["value"], "fn helper()");
+    }
+}
@@ -0,0 +1,204 @@
+//! Newline-delimited JSON: one `symbol` or `edge` object per line.
+//!
+//! The stream opens with a `meta` line and closes with a `summary` line, so
+//! consumers can tell a complete export from a truncated one. Unlike the
+//! other exporters, [`stream_ndjson`] never builds a [`GraphSnapshot`]: rows
+//! are written as SQLite yields them and memory stays flat on large indexes.
+//! The price is that synthetic endpoint nodes (file-level sources, stale
+//! targets) are not emitted; edges still reference them by id.
+
+use super::{GraphEdge, GraphNode, GraphSnapshot, node_from_symbol, resolved_edge};
+use cruxe_core::error::StateError;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use serde::Serialize;
+use std::io::{self, Write};
+
+#[derive(Serialize)]
+#[serde(tag = "type", rename_all = "snake_case")]
+enum Record<'a> {
+    Meta {
+        repo: &'a str,
+        #[serde(rename = "ref")]
+        ref_name: &'a str,
+    },
+    Symbol(&'a GraphNode),
+    Edge(&'a GraphEdge),
+    Summary(&'a StreamStats),
+}
+
+/// Counts written by an NDJSON export.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize)]
+pub struct StreamStats {
+    pub nodes: usize,
+    pub edges: usize,
+    /// Edges whose target could not be resolved to a symbol; not exported.
+    pub unresolved_edges: usize,
+}
+
+fn write_record<W: Write>(out: &mut W, record: &Record<'_>) -> io::Result<()> {
+    serde_json::to_writer(&mut *out, record)?;
+    out.write_all(b"\n")
+}
+
+pub(super) fn write_ndjson<W: Write>(snapshot: &GraphSnapshot, out: &mut W) -> io::Result<()> {
+    write_record(
+        out,
+        &Record::Meta {
+            repo: &snapshot.repo,
+            ref_name: &snapshot.ref_name,
+        },
+    )?;
+    for node in &snapshot.nodes {
+        write_record(out, &Record::Symbol(node))?;
+    }
+    for edge in &snapshot.edges {
+        write_record(out, &Record::Edge(edge))?;
+    }
+    write_record(
+        out,
+        &Record::Summary(&StreamStats {
+            nodes: snapshot.nodes.len(),
+            edges: snapshot.edges.len(),
+            unresolved_edges: snapshot.unresolved_edges,
+        }),
+    )
+}
+
+/// Stream every symbol and resolved edge of a repo/ref straight from SQLite
+/// to `out`, one JSON object per line.
+pub fn stream_ndjson<W: Write>(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    out: &mut W,
+) -> Result<StreamStats, StateError> {
+    let mut stats = StreamStats::default();
+    write_record(out, &Record::Meta { repo, ref_name }).map_err(StateError::Io)?;
+
+    symbols::for_each_symbol_for_ref(conn, repo, ref_name, |symbol| {
+        let node = node_from_symbol(symbol);
+        write_record(out, &Record::Symbol(&node)).map_err(StateError::Io)?;
+        stats.nodes += 1;
+        Ok(())
+    })?;
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        match resolved_edge(edge) {
+            Some(edge) => {
+                write_record(out, &Record::Edge(&edge)).map_err(StateError::Io)?;
+                stats.edges += 1;
+            }
+            None => stats.unresolved_edges += 1,
+        }
+        Ok(())
+    })?;
+
+    write_record(out, &Record::Summary(&stats)).map_err(StateError::Io)?;
+    Ok(stats)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+    use serde_json::Value;
+
+    fn lines(buf: Vec<u8>) -> Vec<Value> {
+        String::from_utf8(buf)
+            .unwrap()
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect()
+    }
+
+    #[test]
+    fn stream_emits_meta_symbols_edges_and_summary() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for (stable_id, name, line) in [("a", "caller", 1), ("b", "callee", 8)] {
+            symbols::insert_symbol(
+                &conn,
+                &SymbolRecord {
+                    repo: "repo".to_string(),
+                    r#ref: "main".to_string(),
+                    commit: None,
+                    path: "src/lib.rs".to_string(),
+                    language: "rust".to_string(),
+                    symbol_id: format!("sym::{stable_id}"),
+                    symbol_stable_id: stable_id.to_string(),
+                    name: name.to_string(),
+                    qualified_name: name.to_string(),
+                    kind: SymbolKind::Function,
+                    signature: None,
+                    line_start: line,
+                    line_end: line + 2,
+                    parent_symbol_id: None,
+                    visibility: None,
+                    content: None,
+                },
+            )
+            .unwrap();
+        }
+        let call = |to: Option<&str>, to_name: Option<&str>| CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: "a".to_string(),
+            to_symbol_id: to.map(str::to_string),
+            to_name: to_name.map(str::to_string),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: "src/lib.rs".to_string(),
+            source_line: 2,
+        };
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[call(Some("b"), None), call(None, Some("external::log"))],
+        )
+        .unwrap();
+
+        let mut buf = Vec::new();
+        let stats = stream_ndjson(&conn, "repo", "main", &mut buf).unwrap();
+        assert_eq!(
+            stats,
+            StreamStats {
+                nodes: 2,
+                edges: 1,
+                unresolved_edges: 1
+            }
+        );
+
+        let records = lines(buf);
+        let types: Vec<&str> = records
+            .iter()
+            .map(|record| record["type"].as_str().unwrap())
+            .collect();
+        assert_eq!(types, ["meta", "symbol", "symbol", "edge", "summary"]);
+        assert_eq!(records[0]["ref"], "main");
+        assert_eq!(records[1]["name"], "caller");
+        assert_eq!(records[3]["target"], "b");
+        assert_eq!(records[3]["line"], 2);
+        assert_eq!(records[4]["unresolved_edges"], 1);
+    }
+
+    #[test]
+    fn snapshot_writer_matches_stream_layout() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: Vec::new(),
+            edges: Vec::new(),
+            unresolved_edges: 3,
+        };
+        let mut buf = Vec::new();
+        write_ndjson(&snapshot, &mut buf).unwrap();
+        let records = lines(buf);
+        assert_eq!(records.len(), 2);
+        assert_eq!(records[0]["type"], "meta");
+        assert_eq!(records[1]["type"], "summary");
+        assert_eq!(records[1]["unresolved_edges"], 3);
+    }
+}
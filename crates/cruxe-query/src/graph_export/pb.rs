@@ -0,0 +1,322 @@
+//! Compact binary index (`index.pb`): the symbol graph of one repo/ref as a
+//! single protobuf message, for tools that want cruxe data without parsing
+//! large JSON exports.
+//!
+//! The schema is published in `docs/reference/cruxe-index.proto`. Every file
+//! starts with `schema_version`; additive changes (new fields) keep the
+//! version, since readers skip unknown fields. Anything else bumps
+//! [`INDEX_SCHEMA_VERSION`], and [`read_index`] refuses files newer than it
+//! understands. Edges reference symbols by position in `symbols`.
+
+use super::protobuf::{ProtoReader, ProtoWriter};
+use super::{GraphEdge, GraphNode, GraphSnapshot};
+use std::collections::HashMap;
+use std::io::{self, Read, Write};
+
+/// Version of `cruxe.index.v1.Index` written by this build.
+pub const INDEX_SCHEMA_VERSION: u32 = 1;
+
+/// Default file name for `cruxe index --format pb`.
+pub const INDEX_PB_FILE: &str = "index.pb";
+
+const GENERATOR: &str = concat!("cruxe ", env!("CARGO_PKG_VERSION"));
+
+// Index
+const INDEX_SCHEMA_VERSION_FIELD: u32 = 1;
+const INDEX_GENERATOR: u32 = 2;
+const INDEX_REPO: u32 = 3;
+const INDEX_REF: u32 = 4;
+const INDEX_SYMBOLS: u32 = 5;
+const INDEX_EDGES: u32 = 6;
+const INDEX_UNRESOLVED_EDGES: u32 = 7;
+// Symbol
+const SYMBOL_ID: u32 = 1;
+const SYMBOL_NAME: u32 = 2;
+const SYMBOL_QUALIFIED_NAME: u32 = 3;
+const SYMBOL_KIND: u32 = 4;
+const SYMBOL_LANGUAGE: u32 = 5;
+const SYMBOL_PACKAGE: u32 = 6;
+const SYMBOL_PATH: u32 = 7;
+const SYMBOL_LINE_START: u32 = 8;
+const SYMBOL_LINE_END: u32 = 9;
+const SYMBOL_SIGNATURE: u32 = 10;
+// Edge
+const EDGE_SOURCE: u32 = 1;
+const EDGE_TARGET: u32 = 2;
+const EDGE_KIND: u32 = 3;
+const EDGE_CONFIDENCE: u32 = 4;
+const EDGE_FILE: u32 = 5;
+const EDGE_LINE: u32 = 6;
+
+/// A decoded `index.pb` file.
+#[derive(Debug, Clone)]
+pub struct IndexFile {
+    pub schema_version: u32,
+    /// Tool and version that wrote the file, e.g. `cruxe 0.1.0`.
+    pub generator: String,
+    pub snapshot: GraphSnapshot,
+}
+
+pub(super) fn write_pb<W: Write>(snapshot: &GraphSnapshot, out: &mut W) -> io::Result<()> {
+    out.write_all(&encode_index(snapshot))
+}
+
+fn encode_index(snapshot: &GraphSnapshot) -> Vec<u8> {
+    let positions: HashMap<&str, u64> = snapshot
+        .nodes
+        .iter()
+        .enumerate()
+        .map(|(idx, node)| (node.id.as_str(), idx as u64))
+        .collect();
+
+    let mut index = ProtoWriter::new();
+    index.uint64(INDEX_SCHEMA_VERSION_FIELD, u64::from(INDEX_SCHEMA_VERSION));
+    index.string(INDEX_GENERATOR, GENERATOR);
+    index.string(INDEX_REPO, &snapshot.repo);
+    index.string(INDEX_REF, &snapshot.ref_name);
+    for node in &snapshot.nodes {
+        index.message(INDEX_SYMBOLS, |symbol| {
+            symbol.string(SYMBOL_ID, &node.id);
+            symbol.string(SYMBOL_NAME, &node.name);
+            symbol.string(SYMBOL_QUALIFIED_NAME, &node.qualified_name);
+            symbol.string(SYMBOL_KIND, &node.kind);
+            symbol.string(SYMBOL_LANGUAGE, &node.language);
+            symbol.string(SYMBOL_PACKAGE, &node.package);
+            symbol.string(SYMBOL_PATH, &node.path);
+            symbol.uint64(SYMBOL_LINE_START, u64::from(node.line_start));
+            symbol.uint64(SYMBOL_LINE_END, u64::from(node.line_end));
+            symbol.string(SYMBOL_SIGNATURE, node.signature.as_deref().unwrap_or(""));
+        });
+    }
+    for edge in &snapshot.edges {
+        // Snapshots always contain both endpoints; see `load_graph_snapshot`.
+        let (Some(source), Some(target)) = (
+            positions.get(edge.source.as_str()),
+            positions.get(edge.target.as_str()),
+        ) else {
+            continue;
+        };
+        index.message(INDEX_EDGES, |out| {
+            out.uint64(EDGE_SOURCE, *source);
+            out.uint64(EDGE_TARGET, *target);
+            out.string(EDGE_KIND, &edge.kind);
+            out.string(EDGE_CONFIDENCE, &edge.confidence);
+            out.string(EDGE_FILE, edge.file.as_deref().unwrap_or(""));
+            out.uint64(EDGE_LINE, u64::from(edge.line.unwrap_or(0)));
+        });
+    }
+    index.uint64(INDEX_UNRESOLVED_EDGES, snapshot.unresolved_edges as u64);
+    index.into_bytes()
+}
+
+/// Decode an `index.pb` file written by any cruxe release up to this one,
+/// plain or zstd-compressed.
+pub fn read_index<R: Read>(reader: &mut R) -> io::Result<IndexFile> {
+    let bytes = cruxe_state::artifact::read_all(reader)?;
+    decode_index(&bytes)
+}
+
+fn decode_index(bytes: &[u8]) -> io::Result<IndexFile> {
+    let mut schema_version = 0;
+    let mut generator = String::new();
+    let mut snapshot = GraphSnapshot {
+        repo: String::new(),
+        ref_name: String::new(),
+        nodes: Vec::new(),
+        edges: Vec::new(),
+        unresolved_edges: 0,
+    };
+    // Edges may precede symbols on the wire; endpoints are resolved last.
+    let mut raw_edges = Vec::new();
+
+    let mut reader = ProtoReader::new(bytes);
+    while let Some((field, value)) = reader.next_field()? {
+        match field {
+            INDEX_SCHEMA_VERSION_FIELD => schema_version = value.as_u32()?,
+            INDEX_GENERATOR => generator = value.as_str()?.to_string(),
+            INDEX_REPO => snapshot.repo = value.as_str()?.to_string(),
+            INDEX_REF => snapshot.ref_name = value.as_str()?.to_string(),
+            INDEX_SYMBOLS => snapshot.nodes.push(decode_symbol(value.as_bytes()?)?),
+            INDEX_EDGES => raw_edges.push(decode_edge(value.as_bytes()?)?),
+            INDEX_UNRESOLVED_EDGES => snapshot.unresolved_edges = value.as_u64()? as usize,
+            _ => {}
+        }
+    }
+
+    if schema_version == 0 {
+        return Err(invalid("not a cruxe index: missing schema_version"));
+    }
+    if schema_version > INDEX_SCHEMA_VERSION {
+        return Err(invalid(&format!(
+            "index schema version {schema_version} is newer than supported version {INDEX_SCHEMA_VERSION}"
+        )));
+    }
+
+    for (source, target, mut edge) in raw_edges {
+        let endpoint = |position: u64| {
+            snapshot
+                .nodes
+                .get(position as usize)
+                .map(|node| node.id.clone())
+                .ok_or_else(|| invalid(&format!("edge references missing symbol #{position}")))
+        };
+        edge.source = endpoint(source)?;
+        edge.target = endpoint(target)?;
+        snapshot.edges.push(edge);
+    }
+
+    Ok(IndexFile {
+        schema_version,
+        generator,
+        snapshot,
+    })
+}
+
+fn decode_symbol(bytes: &[u8]) -> io::Result<GraphNode> {
+    let mut node = GraphNode {
+        id: String::new(),
+        name: String::new(),
+        qualified_name: String::new(),
+        kind: String::new(),
+        language: String::new(),
+        package: String::new(),
+        path: String::new(),
+        line_start: 0,
+        line_end: 0,
+        signature: None,
+    };
+    let mut reader = ProtoReader::new(bytes);
+    while let Some((field, value)) = reader.next_field()? {
+        match field {
+            SYMBOL_ID => node.id = value.as_str()?.to_string(),
+            SYMBOL_NAME => node.name = value.as_str()?.to_string(),
+            SYMBOL_QUALIFIED_NAME => node.qualified_name = value.as_str()?.to_string(),
+            SYMBOL_KIND => node.kind = value.as_str()?.to_string(),
+            SYMBOL_LANGUAGE => node.language = value.as_str()?.to_string(),
+            SYMBOL_PACKAGE => node.package = value.as_str()?.to_string(),
+            SYMBOL_PATH => node.path = value.as_str()?.to_string(),
+            SYMBOL_LINE_START => node.line_start = value.as_u32()?,
+            SYMBOL_LINE_END => node.line_end = value.as_u32()?,
+            SYMBOL_SIGNATURE => node.signature = Some(value.as_str()?.to_string()),
+            _ => {}
+        }
+    }
+    Ok(node)
+}
+
+/// `(source position, target position, edge)`; endpoints are filled later.
+fn decode_edge(bytes: &[u8]) -> io::Result<(u64, u64, GraphEdge)> {
+    let (mut source, mut target) = (0, 0);
+    let mut edge = GraphEdge {
+        source: String::new(),
+        target: String::new(),
+        kind: String::new(),
+        confidence: String::new(),
+        file: None,
+        line: None,
+    };
+    let mut reader = ProtoReader::new(bytes);
+    while let Some((field, value)) = reader.next_field()? {
+        match field {
+            EDGE_SOURCE => source = value.as_u64()?,
+            EDGE_TARGET => target = value.as_u64()?,
+            EDGE_KIND => edge.kind = value.as_str()?.to_string(),
+            EDGE_CONFIDENCE => edge.confidence = value.as_str()?.to_string(),
+            EDGE_FILE => edge.file = Some(value.as_str()?.to_string()),
+            EDGE_LINE => edge.line = Some(value.as_u32()?),
+            _ => {}
+        }
+    }
+    Ok((source, target, edge))
+}
+
+fn invalid(message: &str) -> io::Error {
+    io::Error::new(io::ErrorKind::InvalidData, message.to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_state::artifact::ArtifactWriter;
+
+    fn node(id: &str, signature: Option<&str>) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("auth::{id}"),
+            kind: "function".to_string(),
+            language: "rust".to_string(),
+            package: "src/auth".to_string(),
+            path: "src/auth/token.rs".to_string(),
+            line_start: 4,
+            line_end: 12,
+            signature: signature.map(str::to_string),
+        }
+    }
+
+    #[test]
+    fn index_round_trips_through_reader() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("validate", Some("fn validate(t: &str)")),
+                node("check", None),
+            ],
+            edges: vec![
+                GraphEdge {
+                    source: "check".to_string(),
+                    target: "validate".to_string(),
+                    kind: "calls".to_string(),
+                    confidence: "static".to_string(),
+                    file: Some("src/auth/token.rs".to_string()),
+                    line: Some(9),
+                },
+                GraphEdge {
+                    source: "validate".to_string(),
+                    target: "check".to_string(),
+                    kind: "calls".to_string(),
+                    confidence: "heuristic".to_string(),
+                    file: None,
+                    line: None,
+                },
+            ],
+            unresolved_edges: 3,
+        };
+        let mut buf = Vec::new();
+        write_pb(&snapshot, &mut buf).unwrap();
+
+        let decoded = read_index(&mut buf.as_slice()).unwrap();
+        assert_eq!(decoded.schema_version, INDEX_SCHEMA_VERSION);
+        assert!(decoded.generator.starts_with("cruxe "));
+        assert_eq!(decoded.snapshot.repo, "repo");
+        assert_eq!(decoded.snapshot.ref_name, "main");
+        assert_eq!(decoded.snapshot.nodes, snapshot.nodes);
+        assert_eq!(decoded.snapshot.edges, snapshot.edges);
+        assert_eq!(decoded.snapshot.unresolved_edges, 3);
+
+        let mut compressed = ArtifactWriter::new(Vec::new(), true).unwrap();
+        write_pb(&snapshot, &mut compressed).unwrap();
+        let compressed = compressed.finish().unwrap();
+        let decoded_compressed = read_index(&mut compressed.as_slice()).unwrap();
+        assert_eq!(decoded_compressed.snapshot.nodes, snapshot.nodes);
+        assert_eq!(decoded_compressed.snapshot.edges, snapshot.edges);
+    }
+
+    #[test]
+    fn reader_rejects_newer_or_unversioned_files() {
+        let mut newer = ProtoWriter::new();
+        newer.uint64(
+            INDEX_SCHEMA_VERSION_FIELD,
+            u64::from(INDEX_SCHEMA_VERSION) + 1,
+        );
+        newer.string(INDEX_REPO, "repo");
+        let err = decode_index(&newer.into_bytes()).unwrap_err();
+        assert!(err.to_string().contains("newer than supported"));
+
+        let mut unversioned = ProtoWriter::new();
+        unversioned.string(INDEX_REPO, "repo");
+        let err = decode_index(&unversioned.into_bytes()).unwrap_err();
+        assert!(err.to_string().contains("missing schema_version"));
+    }
+}
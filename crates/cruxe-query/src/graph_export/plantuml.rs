@@ -0,0 +1,711 @@
+//! PlantUML diagrams: a class diagram of the indexed types, or a sequence
+//! diagram along one explicit call path ([`ExportOptions::call_path`]).
+//!
+//! Type relationships are not stored as graph edges, so the class diagram
+//! reads declaration headers (and Go struct/interface bodies) from
+//! [`ExportOptions::source_root`]. Without a source root only types and
+//! their members are drawn.
+
+use super::{ExportOptions, GraphNode, GraphSnapshot, SourceLines};
+use std::collections::{BTreeMap, HashMap};
+use std::io::{self, Write};
+
+/// Node kinds drawn as classifiers in the class diagram.
+const TYPE_KINDS: &[&str] = &["struct", "class", "enum", "trait", "interface"];
+
+/// Declaration headers longer than this many lines are truncated.
+const MAX_HEADER_LINES: u32 = 6;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum Relation {
+    Extends,
+    Implements,
+    /// Go struct embedding.
+    Embeds,
+}
+
+impl Relation {
+    pub(crate) fn as_str(self) -> &'static str {
+        match self {
+            Self::Extends => "extends",
+            Self::Implements => "implements",
+            Self::Embeds => "embeds",
+        }
+    }
+}
+
+pub(super) fn write_plantuml<W: Write>(
+    snapshot: &GraphSnapshot,
+    options: &ExportOptions,
+    out: &mut W,
+) -> io::Result<()> {
+    if options.call_path.is_empty() {
+        write_class_diagram(snapshot, options, out)
+    } else {
+        write_sequence_diagram(snapshot, &options.call_path, out)
+    }
+}
+
+fn write_class_diagram<W: Write>(
+    snapshot: &GraphSnapshot,
+    options: &ExportOptions,
+    out: &mut W,
+) -> io::Result<()> {
+    let types: Vec<&GraphNode> = snapshot
+        .nodes
+        .iter()
+        .filter(|node| TYPE_KINDS.contains(&node.kind.as_str()))
+        .collect();
+    let by_qualified: HashMap<&str, usize> = types
+        .iter()
+        .enumerate()
+        .map(|(idx, node)| (node.qualified_name.as_str(), idx))
+        .collect();
+    let mut by_name: HashMap<&str, Vec<usize>> = HashMap::new();
+    for (idx, node) in types.iter().enumerate() {
+        by_name.entry(node.name.as_str()).or_default().push(idx);
+    }
+
+    let mut members: Vec<Vec<&GraphNode>> = vec![Vec::new(); types.len()];
+    for node in &snapshot.nodes {
+        if let Some(owner) = owner_name(node).and_then(|owner| by_qualified.get(owner)) {
+            members[*owner].push(node);
+        }
+    }
+
+    // Resolve declared supertypes; unknown names become external classes.
+    let mut source = SourceLines::new(options.source_root.as_deref());
+    let mut relations = Vec::new();
+    let mut externals: BTreeMap<String, String> = BTreeMap::new();
+    for (idx, node) in types.iter().enumerate() {
+        for (name, relation) in declared_supertypes(node, &mut source) {
+            let target = match resolve_type(&name, node, &types, &by_name) {
+                Some(target) if target == idx => continue,
+                Some(target) => format!("T{target}"),
+                None => {
+                    let next = format!("X{}", externals.len());
+                    externals.entry(name).or_insert(next).clone()
+                }
+            };
+            relations.push((format!("T{idx}"), target, relation));
+        }
+    }
+
+    writeln!(out, "@startuml")?;
+    writeln!(
+        out,
+        "title {}",
+        escape(&format!("{} @ {}", snapshot.repo, snapshot.ref_name))
+    )?;
+    writeln!(out, "set namespaceSeparator none")?;
+    writeln!(out, "hide empty members")?;
+
+    let mut packages: BTreeMap<&str, Vec<usize>> = BTreeMap::new();
+    for (idx, node) in types.iter().enumerate() {
+        packages.entry(node.package.as_str()).or_default().push(idx);
+    }
+    for (package, indices) in &packages {
+        let indent = if package.is_empty() { "" } else { "  " };
+        if !package.is_empty() {
+            writeln!(out, "package \"{}\" {{", escape(package))?;
+        }
+        for idx in indices {
+            let node = types[*idx];
+            let (keyword, stereotype) = classifier(&node.kind);
+            write!(
+                out,
+                "{indent}{keyword} \"{}\" as T{idx}{stereotype}",
+                escape(&node.name)
+            )?;
+            if members[*idx].is_empty() {
+                writeln!(out)?;
+                continue;
+            }
+            writeln!(out, " {{")?;
+            for member in &members[*idx] {
+                let suffix = if matches!(member.kind.as_str(), "method" | "function") {
+                    "()"
+                } else {
+                    ""
+                };
+                writeln!(out, "{indent}  {}{suffix}", escape(&member.name))?;
+            }
+            writeln!(out, "{indent}}}")?;
+        }
+        if !package.is_empty() {
+            writeln!(out, "}}")?;
+        }
+    }
+    for (name, alias) in &externals {
+        writeln!(out, "class \"{}\" as {alias} <<external>>", escape(name))?;
+    }
+
+    for (from, to, relation) in &relations {
+        match relation {
+            Relation::Extends => writeln!(out, "{to} <|-- {from}")?,
+            Relation::Implements => writeln!(out, "{to} <|.. {from}")?,
+            Relation::Embeds => writeln!(out, "{from} *-- {to} : embeds")?,
+        }
+    }
+    writeln!(out, "@enduml")
+}
+
+fn write_sequence_diagram<W: Write>(
+    snapshot: &GraphSnapshot,
+    call_path: &[String],
+    out: &mut W,
+) -> io::Result<()> {
+    let steps = resolve_call_path(snapshot, call_path)?;
+
+    let mut participants: Vec<String> = Vec::new();
+    let mut lanes = Vec::with_capacity(steps.len());
+    for node in &steps {
+        let label = participant_label(node);
+        let lane = match participants.iter().position(|existing| *existing == label) {
+            Some(lane) => lane,
+            None => {
+                participants.push(label);
+                participants.len() - 1
+            }
+        };
+        lanes.push(lane);
+    }
+
+    writeln!(out, "@startuml")?;
+    writeln!(
+        out,
+        "title {}",
+        escape(&format!(
+            "{} @ {}",
+            call_path.join(" -> "),
+            snapshot.ref_name
+        ))
+    )?;
+    for (lane, label) in participants.iter().enumerate() {
+        writeln!(out, "participant \"{}\" as P{lane}", escape(label))?;
+    }
+    writeln!(out, "[-> P{} : {}()", lanes[0], escape(&steps[0].name))?;
+    writeln!(out, "activate P{}", lanes[0])?;
+    for step in 1..steps.len() {
+        writeln!(
+            out,
+            "P{} -> P{} : {}()",
+            lanes[step - 1],
+            lanes[step],
+            escape(&steps[step].name)
+        )?;
+        writeln!(out, "activate P{}", lanes[step])?;
+    }
+    for step in (1..steps.len()).rev() {
+        writeln!(out, "P{} --> P{}", lanes[step], lanes[step - 1])?;
+        writeln!(out, "deactivate P{}", lanes[step])?;
+    }
+    writeln!(out, "[<-- P{}", lanes[0])?;
+    writeln!(out, "deactivate P{}", lanes[0])?;
+    writeln!(out, "@enduml")
+}
+
+/// Map each call path entry (name or qualified name) to a node so that every
+/// consecutive pair is joined by a `calls` edge.
+fn resolve_call_path<'a>(
+    snapshot: &'a GraphSnapshot,
+    call_path: &[String],
+) -> io::Result<Vec<&'a GraphNode>> {
+    let mut calls: HashMap<&str, Vec<&str>> = HashMap::new();
+    for edge in &snapshot.edges {
+        if edge.kind == "calls" {
+            calls
+                .entry(edge.source.as_str())
+                .or_default()
+                .push(edge.target.as_str());
+        }
+    }
+    let candidates = |step: &str| -> io::Result<Vec<&'a GraphNode>> {
+        let step = step.trim();
+        let exact: Vec<&GraphNode> = snapshot
+            .nodes
+            .iter()
+            .filter(|node| node.qualified_name == step)
+            .collect();
+        let found = if exact.is_empty() {
+            snapshot
+                .nodes
+                .iter()
+                .filter(|node| node.name == step)
+                .collect()
+        } else {
+            exact
+        };
+        if found.is_empty() {
+            return Err(invalid_input(format!(
+                "unknown symbol in call path: {step}"
+            )));
+        }
+        Ok(found)
+    };
+    let calls_any = |from: &GraphNode, to: &[&GraphNode]| {
+        calls
+            .get(from.id.as_str())
+            .is_some_and(|targets| to.iter().any(|node| targets.contains(&node.id.as_str())))
+    };
+
+    let options: Vec<Vec<&GraphNode>> = call_path
+        .iter()
+        .map(|step| candidates(step.as_str()))
+        .collect::<io::Result<_>>()?;
+    let mut steps: Vec<&GraphNode> = Vec::with_capacity(options.len());
+    for (idx, choices) in options.iter().enumerate() {
+        let next = options.get(idx + 1).map(Vec::as_slice).unwrap_or_default();
+        let reachable: Vec<&GraphNode> = match steps.last() {
+            Some(prev) => choices
+                .iter()
+                .copied()
+                .filter(|node| calls_any(*prev, std::slice::from_ref(node)))
+                .collect(),
+            None => choices.clone(),
+        };
+        if reachable.is_empty() {
+            return Err(invalid_input(format!(
+                "no call edge from {} to {}",
+                call_path[idx - 1].trim(),
+                call_path[idx].trim()
+            )));
+        }
+        // Prefer a candidate that can continue the path.
+        let chosen = reachable
+            .iter()
+            .copied()
+            .find(|node| next.is_empty() || calls_any(node, next))
+            .unwrap_or(reachable[0]);
+        steps.push(chosen);
+    }
+    Ok(steps)
+}
+
+/// Qualified name of the type a member belongs to, from its qualified name.
+fn owner_name(node: &GraphNode) -> Option<&str> {
+    if TYPE_KINDS.contains(&node.kind.as_str()) {
+        return None;
+    }
+    let separator = if node.language == "rust" { "::" } else { "." };
+    node.qualified_name
+        .rsplit_once(separator)
+        .map(|(owner, _)| owner)
+}
+
+/// Sequence diagram lane: the owning type for methods, the file otherwise.
+fn participant_label(node: &GraphNode) -> String {
+    match owner_name(node) {
+        Some(owner) if node.kind == "method" => {
+            let separator = if node.language == "rust" { "::" } else { "." };
+            owner.rsplit(separator).next().unwrap_or(owner).to_string()
+        }
+        _ if !node.path.is_empty() => node.path.clone(),
+        _ => node.name.clone(),
+    }
+}
+
+fn classifier(kind: &str) -> (&'static str, &'static str) {
+    match kind {
+        "interface" => ("interface", ""),
+        "trait" => ("interface", " <<trait>>"),
+        "enum" => ("enum", ""),
+        "struct" => ("class", " <<struct>>"),
+        _ => ("class", ""),
+    }
+}
+
+/// Prefer a same-named type in the same package, then any indexed type.
+fn resolve_type(
+    name: &str,
+    from: &GraphNode,
+    types: &[&GraphNode],
+    by_name: &HashMap<&str, Vec<usize>>,
+) -> Option<usize> {
+    let matches = by_name.get(name)?;
+    matches
+        .iter()
+        .copied()
+        .find(|idx| types[*idx].package == from.package)
+        .or_else(|| matches.first().copied())
+}
+
+fn declared_supertypes(node: &GraphNode, source: &mut SourceLines) -> Vec<(String, Relation)> {
+    if node.line_start == 0 {
+        return Vec::new();
+    }
+    let last = if node.language == "go" {
+        node.line_end.max(node.line_start)
+    } else {
+        node.line_start + MAX_HEADER_LINES - 1
+    };
+    let mut lines = Vec::new();
+    for line in node.line_start..=last {
+        let Some(text) = source.line(&node.path, line - 1) else {
+            break;
+        };
+        lines.push(text.to_string());
+    }
+    supertypes_from_source(&node.language, &node.kind, &lines)
+}
+
+/// Supertypes declared by a type whose source starts at `lines[0]`: the
+/// declaration header, or for Go the whole struct/interface body.
+pub(crate) fn supertypes_from_source(
+    language: &str,
+    kind: &str,
+    lines: &[String],
+) -> Vec<(String, Relation)> {
+    if language == "go" {
+        let relation = if kind == "interface" {
+            Relation::Extends
+        } else {
+            Relation::Embeds
+        };
+        return go_embedded(lines)
+            .into_iter()
+            .map(|name| (name, relation))
+            .collect();
+    }
+
+    let mut header = String::new();
+    for text in lines.iter().take(MAX_HEADER_LINES as usize) {
+        header.push_str(text);
+        header.push(' ');
+        if text.contains('{') || text.trim_end().ends_with(':') {
+            break;
+        }
+    }
+    match language {
+        "python" => python_bases(&header),
+        "typescript" | "tsx" | "javascript" => typescript_heritage(&header),
+        "rust" if kind == "trait" => rust_supertraits(&header),
+        _ => Vec::new(),
+    }
+}
+
+/// `class Name(Base, pkg.Mixin, metaclass=Meta):`
+fn python_bases(header: &str) -> Vec<(String, Relation)> {
+    let Some(rest) = header.trim_start().strip_prefix("class ") else {
+        return Vec::new();
+    };
+    let Some(open) = rest.find('(') else {
+        return Vec::new();
+    };
+    if rest[..open].contains(':') {
+        return Vec::new();
+    }
+    let Some(close) = rest.rfind(')') else {
+        return Vec::new();
+    };
+    split_top_level(&rest[open + 1..close.max(open + 1)], ',')
+        .into_iter()
+        .filter(|base| !base.contains('='))
+        .map(simple_name)
+        .filter(|name| !name.is_empty() && name != "object")
+        .map(|name| (name, Relation::Extends))
+        .collect()
+}
+
+/// `class A<T> extends B<T> implements C, D {` / `interface A extends B, C {`
+fn typescript_heritage(header: &str) -> Vec<(String, Relation)> {
+    let header = header.split('{').next().unwrap_or(header);
+    let mut out = Vec::new();
+    let mut rest = header;
+    let extends_at = find_keyword(rest, "extends");
+    let implements_at = find_keyword(rest, "implements");
+    if let Some(start) = extends_at {
+        let end = implements_at.filter(|at| *at > start).unwrap_or(rest.len());
+        for name in split_top_level(&rest[start + "extends".len()..end], ',') {
+            out.push((simple_name(name), Relation::Extends));
+        }
+    }
+    if let Some(start) = implements_at {
+        rest = &rest[start + "implements".len()..];
+        for name in split_top_level(rest, ',') {
+            out.push((simple_name(name), Relation::Implements));
+        }
+    }
+    out.retain(|(name, _)| !name.is_empty());
+    out
+}
+
+/// `pub trait Name<T>: Base + Other<T> where ... {`
+fn rust_supertraits(header: &str) -> Vec<(String, Relation)> {
+    let Some(start) = find_keyword(header, "trait") else {
+        return Vec::new();
+    };
+    let after = &header[start + "trait".len()..];
+    let mut depth = 0usize;
+    let mut colon = None;
+    for (idx, ch) in after.char_indices() {
+        match ch {
+            '<' => depth += 1,
+            '>' => depth = depth.saturating_sub(1),
+            ':' if depth == 0 => {
+                colon = Some(idx);
+                break;
+            }
+            '{' if depth == 0 => break,
+            _ => {}
+        }
+    }
+    let Some(colon) = colon else {
+        return Vec::new();
+    };
+    let bounds = &after[colon + 1..];
+    let end = [find_keyword(bounds, "where"), bounds.find('{')]
+        .into_iter()
+        .flatten()
+        .min()
+        .unwrap_or(bounds.len());
+    split_top_level(&bounds[..end], '+')
+        .into_iter()
+        .filter(|bound| !bound.starts_with('\'') && !bound.starts_with('?'))
+        .map(simple_name)
+        .filter(|name| !name.is_empty())
+        .map(|name| (name, Relation::Extends))
+        .collect()
+}
+
+/// Embedded fields in a Go struct or interface body: lines naming only a
+/// type, optionally a pointer and optionally followed by a struct tag.
+fn go_embedded(body: &[String]) -> Vec<String> {
+    body.iter()
+        .skip(1)
+        .filter_map(|line| {
+            let line = line.split("//").next().unwrap_or("").trim();
+            let mut tokens = line.split_whitespace();
+            let first = tokens.next()?;
+            if tokens.next().is_some_and(|tag| !tag.starts_with('`')) {
+                return None;
+            }
+            let name = first.trim_start_matches('*');
+            let valid = name
+                .chars()
+                .all(|ch| ch.is_alphanumeric() || ch == '_' || ch == '.')
+                && name.chars().next().is_some_and(char::is_alphabetic);
+            valid.then(|| simple_name(name))
+        })
+        .collect()
+}
+
+/// Byte offset of `keyword` as a whole word outside generic arguments.
+fn find_keyword(text: &str, keyword: &str) -> Option<usize> {
+    text.match_indices(keyword).map(|(at, _)| at).find(|at| {
+        let before = text[..*at].chars().next_back();
+        let after = text[at + keyword.len()..].chars().next();
+        let nested = text[..*at].matches('<').count() > text[..*at].matches('>').count();
+        !nested
+            && before.is_none_or(|ch| !ch.is_alphanumeric() && ch != '_')
+            && after.is_none_or(|ch| !ch.is_alphanumeric() && ch != '_')
+    })
+}
+
+fn split_top_level(text: &str, separator: char) -> Vec<&str> {
+    let mut parts = Vec::new();
+    let mut depth = 0usize;
+    let mut start = 0;
+    for (idx, ch) in text.char_indices() {
+        match ch {
+            '<' | '(' | '[' => depth += 1,
+            '>' | ')' | ']' => depth = depth.saturating_sub(1),
+            _ if ch == separator && depth == 0 => {
+                parts.push(text[start..idx].trim());
+                start = idx + ch.len_utf8();
+            }
+            _ => {}
+        }
+    }
+    parts.push(text[start..].trim());
+    parts.retain(|part| !part.is_empty());
+    parts
+}
+
+/// `pkg.Base<T>` / `crate::a::Base` -> `Base`.
+fn simple_name(text: &str) -> String {
+    let text = text.trim();
+    let end = text.find(['<', '[', '(']).unwrap_or(text.len());
+    let path = text[..end].trim();
+    path.rsplit("::")
+        .next()
+        .and_then(|tail| tail.rsplit('.').next())
+        .unwrap_or(path)
+        .trim()
+        .to_string()
+}
+
+fn escape(text: &str) -> String {
+    text.replace('"', "'")
+}
+
+fn invalid_input(message: String) -> io::Error {
+    io::Error::new(io::ErrorKind::InvalidInput, message)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+
+    fn node(id: &str, name: &str, qualified: &str, kind: &str, language: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: name.to_string(),
+            qualified_name: qualified.to_string(),
+            kind: kind.to_string(),
+            language: language.to_string(),
+            package: "src".to_string(),
+            path: format!("src/{id}.src"),
+            line_start: 1,
+            line_end: 1,
+            signature: None,
+        }
+    }
+
+    fn call(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    fn render(snapshot: &GraphSnapshot, options: &ExportOptions) -> io::Result<String> {
+        let mut buf = Vec::new();
+        write_plantuml(snapshot, options, &mut buf)?;
+        Ok(String::from_utf8(buf).unwrap())
+    }
+
+    #[test]
+    fn header_parsers_find_supertypes() {
+        assert_eq!(
+            python_bases("class Admin(models.User, Mixin, metaclass=Meta):"),
+            vec![
+                ("User".to_string(), Relation::Extends),
+                ("Mixin".to_string(), Relation::Extends)
+            ]
+        );
+        assert_eq!(
+            typescript_heritage(
+                "export class Repo<T> extends Base<T> implements Store, Iterable<T> {"
+            ),
+            vec![
+                ("Base".to_string(), Relation::Extends),
+                ("Store".to_string(), Relation::Implements),
+                ("Iterable".to_string(), Relation::Implements)
+            ]
+        );
+        assert_eq!(
+            rust_supertraits(
+                "pub trait Index<'a>: Send + Sync + 'a + crate::Lookup<K> where K: Eq {"
+            ),
+            vec![
+                ("Send".to_string(), Relation::Extends),
+                ("Sync".to_string(), Relation::Extends),
+                ("Lookup".to_string(), Relation::Extends)
+            ]
+        );
+        let body: Vec<String> = [
+            "type Server struct {",
+            "\t*http.Server",
+            "\tLogger `json:\"-\"`",
+            "\tname string",
+            "\t// Comment",
+            "}",
+        ]
+        .iter()
+        .map(|line| line.to_string())
+        .collect();
+        assert_eq!(go_embedded(&body), vec!["Server", "Logger"]);
+    }
+
+    #[test]
+    fn class_diagram_lists_types_members_and_relations() {
+        let tmp = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(tmp.path().join("src")).unwrap();
+        std::fs::write(tmp.path().join("src/admin.src"), "class Admin(User):\n").unwrap();
+        std::fs::write(tmp.path().join("src/user.src"), "class User:\n").unwrap();
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("admin", "Admin", "auth.Admin", "class", "python"),
+                node("user", "User", "auth.User", "class", "python"),
+                node("login", "login", "auth.User.login", "method", "python"),
+            ],
+            edges: Vec::new(),
+            unresolved_edges: 0,
+        };
+        let uml = render(
+            &snapshot,
+            &ExportOptions {
+                source_root: Some(tmp.path().to_path_buf()),
+                ..Default::default()
+            },
+        )
+        .unwrap();
+
+        assert!(uml.starts_with("@startuml\n"));
+        assert!(uml.trim_end().ends_with("@enduml"));
+        assert!(uml.contains("package \"src\" {"));
+        assert!(uml.contains("  class \"User\" as T1 {\n    login()\n  }"));
+        assert!(uml.contains("T1 <|-- T0"));
+    }
+
+    #[test]
+    fn sequence_diagram_follows_call_edges() {
+        let mut handle = node(
+            "handle",
+            "HandleRequest",
+            "api.Server.HandleRequest",
+            "method",
+            "go",
+        );
+        handle.path = "api/server.go".to_string();
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("main", "main", "main", "function", "go"),
+                handle,
+                node("auth", "authenticate", "authenticate", "function", "go"),
+                node(
+                    "auth2",
+                    "authenticate",
+                    "other.authenticate",
+                    "function",
+                    "go",
+                ),
+            ],
+            edges: vec![call("main", "handle"), call("handle", "auth")],
+            unresolved_edges: 0,
+        };
+        let options = ExportOptions {
+            call_path: vec![
+                "main".to_string(),
+                "HandleRequest".to_string(),
+                "authenticate".to_string(),
+            ],
+            ..Default::default()
+        };
+        let uml = render(&snapshot, &options).unwrap();
+        assert!(uml.contains("participant \"Server\" as P1"));
+        assert!(uml.contains("P0 -> P1 : HandleRequest()"));
+        assert!(uml.contains("P1 -> P2 : authenticate()"));
+        assert!(uml.contains("participant \"src/auth.src\" as P2"));
+
+        let broken = ExportOptions {
+            call_path: vec!["authenticate".to_string(), "main".to_string()],
+            ..Default::default()
+        };
+        let err = render(&snapshot, &broken).unwrap_err();
+        assert!(
+            err.to_string()
+                .contains("no call edge from authenticate to main")
+        );
+    }
+}
@@ -0,0 +1,271 @@
+//! Minimal protobuf wire-format encoder and decoder for the binary formats
+//! and the gRPC API.
+//!
+//! Only the field types those schemas use are supported. Default values
+//! (empty strings, zero scalars) are omitted, matching proto3 semantics.
+
+use std::io;
+
+const WIRE_VARINT: u32 = 0;
+const WIRE_FIXED64: u32 = 1;
+const WIRE_LEN: u32 = 2;
+const WIRE_FIXED32: u32 = 5;
+
+#[derive(Debug, Default)]
+pub struct ProtoWriter {
+    buf: Vec<u8>,
+}
+
+impl ProtoWriter {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn into_bytes(self) -> Vec<u8> {
+        self.buf
+    }
+
+    pub fn int32(&mut self, field: u32, value: i32) {
+        if value == 0 {
+            return;
+        }
+        self.key(field, WIRE_VARINT);
+        // Negative int32 values are sign-extended to 64 bits on the wire.
+        self.varint(i64::from(value) as u64);
+    }
+
+    pub fn uint64(&mut self, field: u32, value: u64) {
+        if value == 0 {
+            return;
+        }
+        self.key(field, WIRE_VARINT);
+        self.varint(value);
+    }
+
+    pub fn float(&mut self, field: u32, value: f32) {
+        if value == 0.0 {
+            return;
+        }
+        self.key(field, WIRE_FIXED32);
+        self.buf.extend_from_slice(&value.to_le_bytes());
+    }
+
+    pub fn string(&mut self, field: u32, value: &str) {
+        if value.is_empty() {
+            return;
+        }
+        self.bytes(field, value.as_bytes());
+    }
+
+    /// Repeated string: every element is written, including empty ones.
+    pub fn repeated_string(&mut self, field: u32, values: &[String]) {
+        for value in values {
+            self.bytes(field, value.as_bytes());
+        }
+    }
+
+    pub fn packed_int32(&mut self, field: u32, values: &[i32]) {
+        if values.is_empty() {
+            return;
+        }
+        let mut packed = ProtoWriter::new();
+        for value in values {
+            packed.varint(i64::from(*value) as u64);
+        }
+        self.bytes(field, &packed.buf);
+    }
+
+    /// Embedded message. Always written, even when empty, so that presence
+    /// is preserved for singular message fields.
+    pub fn message(&mut self, field: u32, build: impl FnOnce(&mut ProtoWriter)) {
+        let mut nested = ProtoWriter::new();
+        build(&mut nested);
+        self.bytes(field, &nested.buf);
+    }
+
+    fn bytes(&mut self, field: u32, value: &[u8]) {
+        self.key(field, WIRE_LEN);
+        self.varint(value.len() as u64);
+        self.buf.extend_from_slice(value);
+    }
+
+    fn key(&mut self, field: u32, wire_type: u32) {
+        self.varint(u64::from((field << 3) | wire_type));
+    }
+
+    fn varint(&mut self, mut value: u64) {
+        while value >= 0x80 {
+            self.buf.push((value as u8) | 0x80);
+            value >>= 7;
+        }
+        self.buf.push(value as u8);
+    }
+}
+
+/// A decoded field value. Fixed-width fields are skipped by the reader.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ProtoValue<'a> {
+    Varint(u64),
+    Bytes(&'a [u8]),
+}
+
+impl<'a> ProtoValue<'a> {
+    pub fn as_u64(self) -> io::Result<u64> {
+        match self {
+            Self::Varint(value) => Ok(value),
+            Self::Bytes(_) => Err(invalid("expected a varint field")),
+        }
+    }
+
+    pub fn as_u32(self) -> io::Result<u32> {
+        u32::try_from(self.as_u64()?).map_err(|_| invalid("varint out of range for uint32"))
+    }
+
+    pub fn as_bytes(self) -> io::Result<&'a [u8]> {
+        match self {
+            Self::Bytes(bytes) => Ok(bytes),
+            Self::Varint(_) => Err(invalid("expected a length-delimited field")),
+        }
+    }
+
+    pub fn as_str(self) -> io::Result<&'a str> {
+        std::str::from_utf8(self.as_bytes()?).map_err(|_| invalid("string field is not UTF-8"))
+    }
+}
+
+/// Iterates the `(field number, value)` pairs of one message.
+pub struct ProtoReader<'a> {
+    buf: &'a [u8],
+    pos: usize,
+}
+
+impl<'a> ProtoReader<'a> {
+    pub fn new(buf: &'a [u8]) -> Self {
+        Self { buf, pos: 0 }
+    }
+
+    pub fn next_field(&mut self) -> io::Result<Option<(u32, ProtoValue<'a>)>> {
+        while self.pos < self.buf.len() {
+            let key = self.varint()?;
+            let field =
+                u32::try_from(key >> 3).map_err(|_| invalid("field number out of range"))?;
+            match (key & 0x7) as u32 {
+                WIRE_VARINT => return Ok(Some((field, ProtoValue::Varint(self.varint()?)))),
+                WIRE_LEN => {
+                    let len = usize::try_from(self.varint()?)
+                        .map_err(|_| invalid("length out of range"))?;
+                    return Ok(Some((field, ProtoValue::Bytes(self.take(len)?))));
+                }
+                WIRE_FIXED64 => {
+                    self.take(8)?;
+                }
+                WIRE_FIXED32 => {
+                    self.take(4)?;
+                }
+                other => return Err(invalid(&format!("unsupported wire type {other}"))),
+            }
+        }
+        Ok(None)
+    }
+
+    fn take(&mut self, len: usize) -> io::Result<&'a [u8]> {
+        let end = self
+            .pos
+            .checked_add(len)
+            .filter(|end| *end <= self.buf.len())
+            .ok_or_else(|| invalid("truncated message"))?;
+        let bytes = &self.buf[self.pos..end];
+        self.pos = end;
+        Ok(bytes)
+    }
+
+    fn varint(&mut self) -> io::Result<u64> {
+        let mut value = 0u64;
+        for shift in (0..64).step_by(7) {
+            let byte = *self
+                .buf
+                .get(self.pos)
+                .ok_or_else(|| invalid("truncated varint"))?;
+            self.pos += 1;
+            value |= u64::from(byte & 0x7f) << shift;
+            if byte & 0x80 == 0 {
+                return Ok(value);
+            }
+        }
+        Err(invalid("varint longer than 10 bytes"))
+    }
+}
+
+fn invalid(message: &str) -> io::Error {
+    io::Error::new(io::ErrorKind::InvalidData, message.to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn encodes_scalars_strings_and_nested_messages() {
+        let mut writer = ProtoWriter::new();
+        writer.int32(1, 150);
+        writer.string(2, "testing");
+        writer.message(3, |nested| nested.int32(1, 150));
+        assert_eq!(
+            writer.into_bytes(),
+            vec![
+                0x08, 0x96, 0x01, // field 1 = 150
+                0x12, 0x07, b't', b'e', b's', b't', b'i', b'n', b'g', // field 2
+                0x1a, 0x03, 0x08, 0x96, 0x01, // field 3 = { 1: 150 }
+            ]
+        );
+    }
+
+    #[test]
+    fn omits_defaults_and_packs_repeated_ints() {
+        let mut writer = ProtoWriter::new();
+        writer.int32(1, 0);
+        writer.string(2, "");
+        writer.packed_int32(4, &[3, 270, 86942]);
+        assert_eq!(
+            writer.into_bytes(),
+            vec![0x22, 0x06, 0x03, 0x8e, 0x02, 0x9e, 0xa7, 0x05]
+        );
+    }
+
+    #[test]
+    fn negative_int32_uses_ten_byte_varint() {
+        let mut writer = ProtoWriter::new();
+        writer.int32(1, -1);
+        let bytes = writer.into_bytes();
+        assert_eq!(bytes.len(), 11);
+        assert_eq!(bytes[10], 0x01);
+    }
+
+    #[test]
+    fn reader_round_trips_writer_output_and_skips_fixed_fields() {
+        let mut writer = ProtoWriter::new();
+        writer.uint64(1, 300);
+        writer.string(2, "héllo");
+        writer.message(3, |nested| nested.int32(1, 7));
+        let mut bytes = writer.into_bytes();
+        // field 9, fixed32: skipped.
+        bytes.extend_from_slice(&[0x4d, 1, 2, 3, 4]);
+
+        let mut reader = ProtoReader::new(&bytes);
+        let (field, value) = reader.next_field().unwrap().unwrap();
+        assert_eq!((field, value.as_u64().unwrap()), (1, 300));
+        let (field, value) = reader.next_field().unwrap().unwrap();
+        assert_eq!((field, value.as_str().unwrap()), (2, "héllo"));
+        let (field, value) = reader.next_field().unwrap().unwrap();
+        assert_eq!(field, 3);
+        let mut nested = ProtoReader::new(value.as_bytes().unwrap());
+        assert_eq!(
+            nested.next_field().unwrap(),
+            Some((1, ProtoValue::Varint(7)))
+        );
+        assert_eq!(reader.next_field().unwrap(), None);
+
+        let truncated = ProtoReader::new(&[0x12, 0x05, b'a']).next_field();
+        assert_eq!(truncated.unwrap_err().kind(), io::ErrorKind::InvalidData);
+    }
+}
@@ -0,0 +1,342 @@
+//! SCIP (`index.scip`) emitter.
+//!
+//! Field numbers follow the upstream `scip.proto` schema. Symbols use the
+//! `cruxe` scheme with a path-based descriptor chain, e.g.
+//! ``cruxe . myrepo . src/auth/`handler.rs`/AuthHandler#validate().``
+
+use super::protobuf::ProtoWriter;
+use super::{ExportOptions, GraphNode, GraphSnapshot, SourceLines};
+use std::collections::{BTreeMap, HashMap};
+use std::io::{self, Write};
+
+const SCHEME: &str = "cruxe";
+const TEXT_ENCODING_UTF8: i32 = 1;
+const POSITION_ENCODING_UTF8_BYTES: i32 = 1;
+const SYMBOL_ROLE_DEFINITION: i32 = 0x1;
+
+// SymbolInformation.Kind values used by cruxe symbol kinds.
+const KIND_CLASS: i32 = 7;
+const KIND_CONSTANT: i32 = 8;
+const KIND_ENUM: i32 = 11;
+const KIND_FUNCTION: i32 = 17;
+const KIND_INTERFACE: i32 = 21;
+const KIND_METHOD: i32 = 26;
+const KIND_MODULE: i32 = 29;
+const KIND_STRUCT: i32 = 49;
+const KIND_TRAIT: i32 = 53;
+const KIND_TYPE_ALIAS: i32 = 55;
+const KIND_VARIABLE: i32 = 61;
+
+struct Occurrence {
+    range: Vec<i32>,
+    symbol: String,
+    roles: i32,
+    enclosing_range: Vec<i32>,
+}
+
+#[derive(Default)]
+struct Document {
+    language: String,
+    occurrences: Vec<Occurrence>,
+    symbols: Vec<usize>,
+}
+
+pub(super) fn write_scip<W: Write>(
+    snapshot: &GraphSnapshot,
+    options: &ExportOptions,
+    out: &mut W,
+) -> io::Result<()> {
+    out.write_all(&encode_index(snapshot, options))
+}
+
+fn encode_index(snapshot: &GraphSnapshot, options: &ExportOptions) -> Vec<u8> {
+    let root = options.source_root.as_deref();
+    let package = root
+        .and_then(|path| path.file_name())
+        .map(|name| name.to_string_lossy().to_string())
+        .unwrap_or_else(|| snapshot.repo.clone());
+
+    let indexed: Vec<usize> = snapshot
+        .nodes
+        .iter()
+        .enumerate()
+        .filter(|(_, node)| is_indexed_symbol(node))
+        .map(|(idx, _)| idx)
+        .collect();
+    let monikers: HashMap<&str, String> = indexed
+        .iter()
+        .map(|idx| {
+            let node = &snapshot.nodes[*idx];
+            (node.id.as_str(), scip_symbol(&package, node))
+        })
+        .collect();
+
+    let mut source = SourceLines::new(root);
+    let mut documents: BTreeMap<&str, Document> = BTreeMap::new();
+
+    for idx in &indexed {
+        let node = &snapshot.nodes[*idx];
+        let (line, start, end) = source.name_range(&node.path, node.line_start, &node.name);
+        let doc = documents.entry(node.path.as_str()).or_default();
+        if doc.language.is_empty() {
+            doc.language = node.language.clone();
+        }
+        doc.occurrences.push(Occurrence {
+            range: vec![line as i32, start as i32, end as i32],
+            symbol: monikers[node.id.as_str()].clone(),
+            roles: SYMBOL_ROLE_DEFINITION,
+            enclosing_range: vec![
+                node.line_start.saturating_sub(1) as i32,
+                0,
+                node.line_end.max(node.line_start).saturating_sub(1) as i32,
+                0,
+            ],
+        });
+        doc.symbols.push(*idx);
+    }
+
+    let by_id: HashMap<&str, &GraphNode> = snapshot
+        .nodes
+        .iter()
+        .map(|node| (node.id.as_str(), node))
+        .collect();
+    for edge in &snapshot.edges {
+        let (Some(file), Some(line)) = (edge.file.as_deref(), edge.line) else {
+            continue;
+        };
+        let Some(symbol) = monikers.get(edge.target.as_str()) else {
+            continue;
+        };
+        let target = by_id[edge.target.as_str()];
+        let (line, start, end) = source.name_range(file, line, &target.name);
+        documents
+            .entry(file)
+            .or_default()
+            .occurrences
+            .push(Occurrence {
+                range: vec![line as i32, start as i32, end as i32],
+                symbol: symbol.clone(),
+                roles: 0,
+                enclosing_range: Vec::new(),
+            });
+    }
+
+    let mut index = ProtoWriter::new();
+    index.message(1, |metadata| {
+        metadata.message(2, |tool| {
+            tool.string(1, "cruxe");
+            tool.string(2, env!("CARGO_PKG_VERSION"));
+        });
+        if let Some(root) = root {
+            metadata.string(3, &format!("file://{}", root.display()));
+        }
+        metadata.int32(4, TEXT_ENCODING_UTF8);
+    });
+    for (path, mut doc) in documents {
+        doc.occurrences
+            .sort_by(|a, b| a.range.cmp(&b.range).then_with(|| a.symbol.cmp(&b.symbol)));
+        index.message(2, |document| {
+            document.string(1, path);
+            for occurrence in &doc.occurrences {
+                document.message(2, |occ| {
+                    occ.packed_int32(1, &occurrence.range);
+                    occ.string(2, &occurrence.symbol);
+                    occ.int32(3, occurrence.roles);
+                    occ.packed_int32(7, &occurrence.enclosing_range);
+                });
+            }
+            for idx in &doc.symbols {
+                let node = &snapshot.nodes[*idx];
+                document.message(3, |info| {
+                    info.string(1, &monikers[node.id.as_str()]);
+                    if let Some(signature) = node.signature.as_deref() {
+                        info.repeated_string(
+                            3,
+                            &[format!("```{}\n{signature}\n```", node.language)],
+                        );
+                    }
+                    info.int32(5, symbol_kind(&node.kind));
+                    info.string(6, &node.name);
+                });
+            }
+            document.string(4, &doc.language);
+            document.int32(6, POSITION_ENCODING_UTF8_BYTES);
+        });
+    }
+    index.into_bytes()
+}
+
+fn is_indexed_symbol(node: &GraphNode) -> bool {
+    !node.path.is_empty()
+        && node.line_start > 0
+        && !matches!(node.kind.as_str(), "file" | "unknown")
+}
+
+/// Build the SCIP symbol string for a node:
+/// `<scheme> <manager> <package> <version> <descriptors>`.
+fn scip_symbol(package: &str, node: &GraphNode) -> String {
+    let mut descriptors = String::new();
+    for segment in node.path.split('/').filter(|segment| !segment.is_empty()) {
+        descriptors.push_str(&escape_identifier(segment));
+        descriptors.push('/');
+    }
+
+    let segments: Vec<&str> = node
+        .qualified_name
+        .split("::")
+        .flat_map(|part| part.split('.'))
+        .filter(|part| !part.is_empty())
+        .collect();
+    let (name, parents) = segments
+        .split_last()
+        .map(|(last, rest)| (*last, rest))
+        .unwrap_or((node.name.as_str(), &[]));
+    let parent_suffix = if node.kind == "method" { '#' } else { '/' };
+    for parent in parents {
+        descriptors.push_str(&escape_identifier(parent));
+        descriptors.push(parent_suffix);
+    }
+    descriptors.push_str(&escape_identifier(name));
+    descriptors.push_str(match node.kind.as_str() {
+        "function" | "method" => "().",
+        "struct" | "class" | "enum" | "trait" | "interface" | "type_alias" => "#",
+        "module" => "/",
+        _ => ".",
+    });
+
+    format!(
+        "{SCHEME} . {} . {descriptors}",
+        escape_package_part(package)
+    )
+}
+
+fn symbol_kind(kind: &str) -> i32 {
+    match kind {
+        "function" => KIND_FUNCTION,
+        "method" => KIND_METHOD,
+        "struct" => KIND_STRUCT,
+        "class" => KIND_CLASS,
+        "enum" => KIND_ENUM,
+        "trait" => KIND_TRAIT,
+        "interface" => KIND_INTERFACE,
+        "constant" => KIND_CONSTANT,
+        "variable" => KIND_VARIABLE,
+        "type_alias" => KIND_TYPE_ALIAS,
+        "module" => KIND_MODULE,
+        _ => 0,
+    }
+}
+
+fn escape_identifier(value: &str) -> String {
+    let simple = !value.is_empty()
+        && value
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '_' | '+' | '-' | '$'));
+    if simple {
+        value.to_string()
+    } else {
+        format!("`{}`", value.replace('`', "``"))
+    }
+}
+
+/// Package parts are space-separated in the symbol grammar, so embedded
+/// spaces are doubled and empty parts become `.`.
+fn escape_package_part(value: &str) -> String {
+    if value.is_empty() {
+        ".".to_string()
+    } else {
+        value.replace(' ', "  ")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+
+    fn node(id: &str, name: &str, qualified: &str, kind: &str, path: &str, line: u32) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: name.to_string(),
+            qualified_name: qualified.to_string(),
+            kind: kind.to_string(),
+            language: "rust".to_string(),
+            package: String::new(),
+            path: path.to_string(),
+            line_start: line,
+            line_end: line + 2,
+            signature: Some(format!("fn {name}()")),
+        }
+    }
+
+    #[test]
+    fn scip_symbol_uses_path_and_kind_descriptors() {
+        let method = node(
+            "m",
+            "validate",
+            "AuthHandler::validate",
+            "method",
+            "src/auth/handler.rs",
+            3,
+        );
+        assert_eq!(
+            scip_symbol("my repo", &method),
+            "cruxe . my  repo . src/auth/`handler.rs`/AuthHandler#validate()."
+        );
+        let ty = node("t", "Config", "Config", "struct", "lib.rs", 1);
+        assert_eq!(scip_symbol("repo", &ty), "cruxe . repo . `lib.rs`/Config#");
+    }
+
+    #[test]
+    fn encode_index_emits_definitions_and_references() {
+        let tmp = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(tmp.path().join("src")).unwrap();
+        std::fs::write(
+            tmp.path().join("src/lib.rs"),
+            "fn helper() {}\nfn main() {\n    helper();\n}\n",
+        )
+        .unwrap();
+
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("h", "helper", "helper", "function", "src/lib.rs", 1),
+                node("m", "main", "main", "function", "src/lib.rs", 2),
+            ],
+            edges: vec![GraphEdge {
+                source: "m".to_string(),
+                target: "h".to_string(),
+                kind: "calls".to_string(),
+                confidence: "high".to_string(),
+                file: Some("src/lib.rs".to_string()),
+                line: Some(3),
+            }],
+            unresolved_edges: 0,
+        };
+        let bytes = encode_index(
+            &snapshot,
+            &ExportOptions {
+                source_root: Some(tmp.path().to_path_buf()),
+                ..Default::default()
+            },
+        );
+
+        // Index.metadata (field 1, length-delimited) comes first.
+        assert_eq!(bytes[0], 0x0a);
+        let text = String::from_utf8_lossy(&bytes);
+        assert!(text.contains("src/lib.rs"));
+        assert!(text.contains("`lib.rs`/helper()."));
+        assert!(text.contains("```rust\nfn helper()\n```"));
+        // Reference occurrence range [2, 4, 10] packed as field 1.
+        let reference = [0x0a, 0x03, 0x02, 0x04, 0x0a];
+        assert!(bytes.windows(reference.len()).any(|w| w == reference));
+    }
+
+    #[test]
+    fn escape_identifier_quotes_non_simple_names() {
+        assert_eq!(escape_identifier("snake_case"), "snake_case");
+        assert_eq!(escape_identifier("with space"), "`with space`");
+        assert_eq!(escape_identifier("a`b"), "`a``b`");
+    }
+}
@@ -0,0 +1,162 @@
+//! Per-symbol usage counters as a single CSV table, meant to be exported on
+//! every CI run and kept as an artifact:
+//!
+//! ```sh
+//! cruxe export --format usage --output usage-$(git rev-parse --short HEAD).csv
+//! ```
+//!
+//! Rows are keyed by the stable symbol id and sorted by it, so tables from
+//! successive runs join and diff line by line to show which APIs gain or lose
+//! callers over time. Every symbol gets a row, including unused ones with
+//! zero counts; synthetic file and unresolved nodes are left out.
+//!
+//! Columns: `ref`, `symbol_id`, `qualified_name`, `kind`, `language`,
+//! `path`, `calls` (incoming call edges), `references` (other incoming
+//! edges), `callers` (distinct calling nodes) and `caller_files` (distinct
+//! files the incoming edges come from).
+
+use super::GraphSnapshot;
+use super::csv::write_row;
+use std::collections::{HashMap, HashSet};
+use std::io::{self, Write};
+
+const HEADER: [&str; 10] = [
+    "ref",
+    "symbol_id",
+    "qualified_name",
+    "kind",
+    "language",
+    "path",
+    "calls",
+    "references",
+    "callers",
+    "caller_files",
+];
+
+#[derive(Default)]
+struct Usage<'a> {
+    calls: usize,
+    references: usize,
+    callers: HashSet<&'a str>,
+    caller_files: HashSet<&'a str>,
+}
+
+pub(super) fn write_usage<W: Write>(snapshot: &GraphSnapshot, out: &mut W) -> io::Result<()> {
+    let mut usage: HashMap<&str, Usage<'_>> = HashMap::new();
+    for edge in &snapshot.edges {
+        let entry = usage.entry(edge.target.as_str()).or_default();
+        if edge.kind == "calls" {
+            entry.calls += 1;
+        } else {
+            entry.references += 1;
+        }
+        entry.callers.insert(edge.source.as_str());
+        if let Some(file) = edge.file.as_deref() {
+            entry.caller_files.insert(file);
+        }
+    }
+
+    let mut nodes: Vec<_> = snapshot
+        .nodes
+        .iter()
+        .filter(|node| node.kind != "file" && node.kind != "unknown")
+        .collect();
+    nodes.sort_by(|a, b| a.id.cmp(&b.id));
+
+    write_row(out, &HEADER)?;
+    let empty = Usage::default();
+    for node in nodes {
+        let counts = usage.get(node.id.as_str()).unwrap_or(&empty);
+        write_row(
+            out,
+            &[
+                &snapshot.ref_name,
+                &node.id,
+                &node.qualified_name,
+                &node.kind,
+                &node.language,
+                &node.path,
+                &counts.calls.to_string(),
+                &counts.references.to_string(),
+                &counts.callers.len().to_string(),
+                &counts.caller_files.len().to_string(),
+            ],
+        )?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::{GraphEdge, GraphNode};
+
+    fn node(id: &str, kind: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("pkg::{id}"),
+            kind: kind.to_string(),
+            language: "rust".to_string(),
+            package: "src".to_string(),
+            path: "src/lib.rs".to_string(),
+            line_start: 1,
+            line_end: 3,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str, kind: &str, file: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: kind.to_string(),
+            confidence: "static".to_string(),
+            file: Some(file.to_string()),
+            line: Some(1),
+        }
+    }
+
+    #[test]
+    fn counts_incoming_edges_per_symbol_sorted_by_id() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("parse", "function"),
+                node("file::src/main.rs", "file"),
+                node("main", "function"),
+                node("unused", "function"),
+            ],
+            edges: vec![
+                edge("main", "parse", "calls", "src/main.rs"),
+                edge("main", "parse", "calls", "src/main.rs"),
+                edge("file::src/main.rs", "parse", "imports", "src/main.rs"),
+                edge("unused", "parse", "calls", "src/lib.rs"),
+            ],
+            unresolved_edges: 0,
+        };
+
+        let mut buf = Vec::new();
+        write_usage(&snapshot, &mut buf).unwrap();
+        let csv = String::from_utf8(buf).unwrap();
+        let rows: Vec<&str> = csv.split("\r\n").collect();
+        assert_eq!(
+            rows[0],
+            "ref,symbol_id,qualified_name,kind,language,path,calls,references,callers,caller_files"
+        );
+        assert_eq!(
+            rows[1],
+            "main,main,pkg::main,function,rust,src/lib.rs,0,0,0,0"
+        );
+        assert_eq!(
+            rows[2],
+            "main,parse,pkg::parse,function,rust,src/lib.rs,3,1,3,2"
+        );
+        assert_eq!(
+            rows[3],
+            "main,unused,pkg::unused,function,rust,src/lib.rs,0,0,0,0"
+        );
+        assert_eq!(rows[4], "");
+    }
+}
@@ -0,0 +1,446 @@
+//! Interactive queries over a loaded symbol graph, for `cruxe graph serve`:
+//! filter expressions, neighborhoods and shortest paths between two nodes.
+//!
+//! A filter is a list of whitespace-separated terms that must all match.
+//! `field:value` tests one attribute: `kind`, `lang`, `path` and `pkg` take
+//! case-insensitive globs, `name` a substring of the qualified name.
+//! `degree>N` and `degree<N` compare the number of edges touching the node.
+//! A bare word is a substring of the qualified name. `-` negates a term and
+//! `OR` between two terms accepts either.
+
+use crate::graph_export::{GraphEdge, GraphNode, GraphSnapshot};
+use globset::{GlobBuilder, GlobMatcher};
+use serde::Serialize;
+use std::collections::{HashMap, HashSet, VecDeque};
+
+/// A parsed filter expression.
+#[derive(Debug, Clone, Default)]
+pub struct GraphFilter {
+    /// Every group must match; a group matches when any of its terms does.
+    groups: Vec<Vec<Term>>,
+}
+
+#[derive(Debug, Clone)]
+struct Term {
+    negated: bool,
+    test: Test,
+}
+
+#[derive(Debug, Clone)]
+enum Test {
+    Kind(GlobMatcher),
+    Language(GlobMatcher),
+    Path(GlobMatcher),
+    Package(GlobMatcher),
+    Name(String),
+    DegreeAbove(usize),
+    DegreeBelow(usize),
+}
+
+impl GraphFilter {
+    /// Parse a filter expression; an empty expression matches every node.
+    pub fn parse(expr: &str) -> Result<Self, String> {
+        let mut groups: Vec<Vec<Term>> = Vec::new();
+        let mut join_next = false;
+        for token in expr.split_whitespace() {
+            if token == "OR" {
+                if groups.is_empty() || join_next {
+                    return Err("`OR` must sit between two terms".to_string());
+                }
+                join_next = true;
+                continue;
+            }
+            let term = parse_term(token)?;
+            match groups.last_mut() {
+                Some(group) if join_next => group.push(term),
+                _ => groups.push(vec![term]),
+            }
+            join_next = false;
+        }
+        if join_next {
+            return Err("`OR` must sit between two terms".to_string());
+        }
+        Ok(Self { groups })
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.groups.is_empty()
+    }
+
+    fn matches(&self, node: &GraphNode, degree: usize) -> bool {
+        self.groups
+            .iter()
+            .all(|group| group.iter().any(|term| term.matches(node, degree)))
+    }
+}
+
+impl Term {
+    fn matches(&self, node: &GraphNode, degree: usize) -> bool {
+        let hit = match &self.test {
+            Test::Kind(glob) => glob.is_match(&node.kind),
+            Test::Language(glob) => glob.is_match(&node.language),
+            Test::Path(glob) => glob.is_match(&node.path),
+            Test::Package(glob) => glob.is_match(&node.package),
+            Test::Name(needle) => node.qualified_name.to_lowercase().contains(needle),
+            Test::DegreeAbove(n) => degree > *n,
+            Test::DegreeBelow(n) => degree < *n,
+        };
+        hit != self.negated
+    }
+}
+
+fn parse_term(token: &str) -> Result<Term, String> {
+    let (negated, body) = match token.strip_prefix('-') {
+        Some(body) if !body.is_empty() => (true, body),
+        _ => (false, token),
+    };
+    let degree = |value: &str| {
+        value
+            .parse::<usize>()
+            .map_err(|_| format!("`{token}`: degree must be a number"))
+    };
+    let test = if let Some(value) = body.strip_prefix("degree>") {
+        Test::DegreeAbove(degree(value)?)
+    } else if let Some(value) = body.strip_prefix("degree<") {
+        Test::DegreeBelow(degree(value)?)
+    } else if let Some((field, value)) = body.split_once(':') {
+        if value.is_empty() {
+            return Err(format!("`{token}`: missing value"));
+        }
+        match field {
+            "kind" => Test::Kind(glob(value)?),
+            "lang" => Test::Language(glob(value)?),
+            "path" => Test::Path(glob(value)?),
+            "pkg" => Test::Package(glob(value)?),
+            "name" => Test::Name(value.to_lowercase()),
+            _ => {
+                return Err(format!(
+                    "unknown filter field `{field}` (expected kind, lang, path, pkg, name or degree)"
+                ));
+            }
+        }
+    } else {
+        Test::Name(body.to_lowercase())
+    };
+    Ok(Term { negated, test })
+}
+
+fn glob(pattern: &str) -> Result<GlobMatcher, String> {
+    GlobBuilder::new(pattern)
+        .case_insensitive(true)
+        .build()
+        .map(|glob| glob.compile_matcher())
+        .map_err(|err| format!("`{pattern}`: {err}"))
+}
+
+/// Nodes and the edges between them, as sent to the viewer.
+#[derive(Debug, Clone, Serialize)]
+pub struct Subgraph {
+    pub nodes: Vec<GraphNode>,
+    pub edges: Vec<GraphEdge>,
+    /// Nodes matched beyond the limit and left out.
+    pub omitted: usize,
+}
+
+/// Shortest path between two nodes.
+#[derive(Debug, Clone, Serialize)]
+pub struct GraphPath {
+    /// From the first node to the second.
+    pub nodes: Vec<GraphNode>,
+    pub edges: Vec<GraphEdge>,
+    /// Every edge points along the path; otherwise some are walked against
+    /// their direction because no directed path exists.
+    pub directed: bool,
+}
+
+/// A snapshot indexed for the queries above.
+pub struct GraphView {
+    snapshot: GraphSnapshot,
+    index: HashMap<String, usize>,
+    /// Edge positions by source and by target node.
+    outgoing: Vec<Vec<usize>>,
+    incoming: Vec<Vec<usize>>,
+}
+
+impl GraphView {
+    pub fn new(snapshot: GraphSnapshot) -> Self {
+        let index: HashMap<String, usize> = snapshot
+            .nodes
+            .iter()
+            .enumerate()
+            .map(|(idx, node)| (node.id.clone(), idx))
+            .collect();
+        let mut outgoing = vec![Vec::new(); snapshot.nodes.len()];
+        let mut incoming = vec![Vec::new(); snapshot.nodes.len()];
+        for (position, edge) in snapshot.edges.iter().enumerate() {
+            if let (Some(&source), Some(&target)) =
+                (index.get(&edge.source), index.get(&edge.target))
+            {
+                outgoing[source].push(position);
+                incoming[target].push(position);
+            }
+        }
+        Self {
+            snapshot,
+            index,
+            outgoing,
+            incoming,
+        }
+    }
+
+    pub fn snapshot(&self) -> &GraphSnapshot {
+        &self.snapshot
+    }
+
+    fn degree(&self, node: usize) -> usize {
+        self.outgoing[node].len() + self.incoming[node].len()
+    }
+
+    /// Nodes matching `filter`, most connected first, at most `limit`.
+    pub fn filter(&self, filter: &GraphFilter, limit: usize) -> Subgraph {
+        let mut matched: Vec<usize> = (0..self.snapshot.nodes.len())
+            .filter(|&node| filter.matches(&self.snapshot.nodes[node], self.degree(node)))
+            .collect();
+        matched.sort_by_key(|&node| std::cmp::Reverse(self.degree(node)));
+        let omitted = matched.len().saturating_sub(limit);
+        matched.truncate(limit);
+        self.subgraph(matched, omitted)
+    }
+
+    /// Nodes within `depth` edges of `id` in either direction, nearest
+    /// first, at most `limit`. `None` when `id` is not in the graph.
+    pub fn neighborhood(&self, id: &str, depth: usize, limit: usize) -> Option<Subgraph> {
+        let start = *self.index.get(id)?;
+        let mut seen = HashSet::from([start]);
+        let mut order = vec![start];
+        let mut frontier = vec![start];
+        let mut omitted = 0;
+        for _ in 0..depth {
+            let mut next = Vec::new();
+            for &node in &frontier {
+                for neighbor in self.neighbors(node) {
+                    if !seen.insert(neighbor) {
+                        continue;
+                    }
+                    if order.len() < limit {
+                        order.push(neighbor);
+                        next.push(neighbor);
+                    } else {
+                        omitted += 1;
+                    }
+                }
+            }
+            frontier = next;
+        }
+        Some(self.subgraph(order, omitted))
+    }
+
+    /// Shortest path from `from` to `to` along edge direction, or ignoring
+    /// direction when there is none. `None` when the nodes are unknown or
+    /// not connected.
+    pub fn path(&self, from: &str, to: &str) -> Option<GraphPath> {
+        let start = *self.index.get(from)?;
+        let goal = *self.index.get(to)?;
+        let (edges, directed) = match self.shortest_path(start, goal, true) {
+            Some(edges) => (edges, true),
+            None => (self.shortest_path(start, goal, false)?, false),
+        };
+        let mut nodes = vec![self.snapshot.nodes[start].clone()];
+        let mut at = start;
+        for &position in &edges {
+            let edge = &self.snapshot.edges[position];
+            at = if self.index[&edge.source] == at {
+                self.index[&edge.target]
+            } else {
+                self.index[&edge.source]
+            };
+            nodes.push(self.snapshot.nodes[at].clone());
+        }
+        Some(GraphPath {
+            nodes,
+            edges: edges
+                .into_iter()
+                .map(|position| self.snapshot.edges[position].clone())
+                .collect(),
+            directed,
+        })
+    }
+
+    /// Breadth-first search returning the edge positions of the path.
+    fn shortest_path(&self, start: usize, goal: usize, directed: bool) -> Option<Vec<usize>> {
+        // Node -> (previous node, edge taken to reach it).
+        let mut previous: HashMap<usize, (usize, usize)> = HashMap::new();
+        let mut seen = HashSet::from([start]);
+        let mut queue = VecDeque::from([start]);
+        while let Some(node) = queue.pop_front() {
+            if node == goal {
+                let mut edges = Vec::new();
+                let mut at = goal;
+                while let Some(&(prev, edge)) = previous.get(&at) {
+                    edges.push(edge);
+                    at = prev;
+                }
+                edges.reverse();
+                return Some(edges);
+            }
+            let forward = self.outgoing[node]
+                .iter()
+                .map(|&edge| (edge, self.index[&self.snapshot.edges[edge].target]));
+            let backward = self.incoming[node]
+                .iter()
+                .filter(|_| !directed)
+                .map(|&edge| (edge, self.index[&self.snapshot.edges[edge].source]));
+            for (edge, next) in forward.chain(backward) {
+                if seen.insert(next) {
+                    previous.insert(next, (node, edge));
+                    queue.push_back(next);
+                }
+            }
+        }
+        None
+    }
+
+    fn neighbors(&self, node: usize) -> impl Iterator<Item = usize> + '_ {
+        let targets = self.outgoing[node]
+            .iter()
+            .map(|&edge| self.index[&self.snapshot.edges[edge].target]);
+        let sources = self.incoming[node]
+            .iter()
+            .map(|&edge| self.index[&self.snapshot.edges[edge].source]);
+        targets.chain(sources)
+    }
+
+    fn subgraph(&self, nodes: Vec<usize>, omitted: usize) -> Subgraph {
+        let members: HashSet<usize> = nodes.iter().copied().collect();
+        let mut edges: Vec<usize> = nodes
+            .iter()
+            .flat_map(|&node| self.outgoing[node].iter().copied())
+            .filter(|&edge| members.contains(&self.index[&self.snapshot.edges[edge].target]))
+            .collect();
+        edges.sort_unstable();
+        Subgraph {
+            nodes: nodes
+                .into_iter()
+                .map(|node| self.snapshot.nodes[node].clone())
+                .collect(),
+            edges: edges
+                .into_iter()
+                .map(|edge| self.snapshot.edges[edge].clone())
+                .collect(),
+            omitted,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn node(id: &str, kind: &str, path: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("app::{id}"),
+            kind: kind.to_string(),
+            language: "rust".to_string(),
+            package: path.rsplit_once('/').map_or("", |(dir, _)| dir).to_string(),
+            path: path.to_string(),
+            line_start: 1,
+            line_end: 3,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    /// serve -> route -> handle -> load; audit -> load; Config stands alone.
+    fn view() -> GraphView {
+        GraphView::new(GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("serve", "function", "src/main.rs"),
+                node("route", "function", "src/api/router.rs"),
+                node("handle", "method", "src/api/handler.rs"),
+                node("load", "function", "src/db/load.rs"),
+                node("audit", "function", "src/db/audit.rs"),
+                node("Config", "struct", "src/config.rs"),
+            ],
+            edges: vec![
+                edge("serve", "route"),
+                edge("route", "handle"),
+                edge("handle", "load"),
+                edge("audit", "load"),
+            ],
+            unresolved_edges: 0,
+        })
+    }
+
+    fn ids(nodes: &[GraphNode]) -> Vec<&str> {
+        nodes.iter().map(|node| node.id.as_str()).collect()
+    }
+
+    #[test]
+    fn filters_combine_fields_negation_and_or() {
+        let view = view();
+        let run = |expr: &str| {
+            let mut hit = ids(&view.filter(&GraphFilter::parse(expr).unwrap(), 10).nodes)
+                .into_iter()
+                .map(str::to_string)
+                .collect::<Vec<_>>();
+            hit.sort();
+            hit
+        };
+        assert_eq!(run("pkg:src/api"), ["handle", "route"]);
+        assert_eq!(run("kind:FUNCTION -path:src/db/*"), ["route", "serve"]);
+        assert_eq!(run("kind:struct OR name:audit"), ["Config", "audit"]);
+        assert_eq!(run("degree>1"), ["handle", "load", "route"]);
+        assert_eq!(run("degree<1"), ["Config"]);
+        assert_eq!(run("").len(), 6);
+
+        let limited = view.filter(&GraphFilter::default(), 2);
+        assert_eq!(limited.omitted, 4);
+        assert_eq!(limited.nodes.len(), 2);
+
+        assert!(GraphFilter::parse("owner:me").is_err());
+        assert!(GraphFilter::parse("OR kind:struct").is_err());
+        assert!(GraphFilter::parse("degree>many").is_err());
+    }
+
+    #[test]
+    fn neighborhoods_expand_in_both_directions() {
+        let view = view();
+        let near = view.neighborhood("load", 1, 10).unwrap();
+        assert_eq!(ids(&near.nodes), ["load", "handle", "audit"]);
+        assert_eq!(near.edges.len(), 2);
+
+        let wider = view.neighborhood("load", 2, 3).unwrap();
+        assert_eq!(wider.nodes.len(), 3);
+        assert_eq!(wider.omitted, 1);
+        assert!(view.neighborhood("missing", 1, 10).is_none());
+    }
+
+    #[test]
+    fn paths_follow_edges_and_fall_back_to_undirected() {
+        let view = view();
+        let path = view.path("serve", "load").unwrap();
+        assert!(path.directed);
+        assert_eq!(ids(&path.nodes), ["serve", "route", "handle", "load"]);
+        assert_eq!(path.edges.len(), 3);
+
+        let path = view.path("audit", "handle").unwrap();
+        assert!(!path.directed);
+        assert_eq!(ids(&path.nodes), ["audit", "load", "handle"]);
+
+        assert!(view.path("serve", "Config").is_none());
+    }
+}
@@ -0,0 +1,415 @@
+//! Pattern search over the indexed files, annotated with the symbol index.
+//!
+//! Plain text search reports a line; this reports the line together with the
+//! innermost indexed symbol around it and the package (directory) it lives
+//! in. Patterns are regexes matched per line, or tree-sitter queries matched
+//! against each file's syntax tree (see [`cruxe_indexer::structural`]).
+
+use crate::ref_sites::EnclosingSymbol;
+use crate::report::ROOT_PACKAGE;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_indexer::structural::StructuralPattern;
+use cruxe_state::{manifest, symbols};
+use globset::{GlobBuilder, GlobSet, GlobSetBuilder};
+use regex::{Regex, RegexBuilder};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeSet;
+use std::path::Path;
+
+#[derive(Debug, thiserror::Error)]
+pub enum GrepError {
+    #[error("invalid pattern: {0}")]
+    InvalidPattern(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum PatternKind {
+    Regex,
+    Structural,
+}
+
+#[derive(Debug, Clone)]
+pub struct GrepOptions {
+    pub pattern: String,
+    pub kind: PatternKind,
+    /// Regex only; structural patterns match node types exactly.
+    pub ignore_case: bool,
+    /// Path globs; an empty list searches every indexed file.
+    pub paths: Vec<String>,
+    pub language: Option<String>,
+    pub limit: usize,
+}
+
+/// One match. Lines and columns are 1-based; columns count characters.
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct GrepMatch {
+    pub path: String,
+    pub line: u32,
+    pub column: u32,
+    /// Last line of a multi-line structural match.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub end_line: Option<u32>,
+    pub language: String,
+    pub package: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub enclosing: Option<EnclosingSymbol>,
+    pub text: String,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct GrepResults {
+    pub pattern: String,
+    pub kind: PatternKind,
+    pub files_scanned: usize,
+    pub total: usize,
+    pub truncated: bool,
+    /// Languages skipped because their grammar rejected a structural pattern.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub skipped_languages: Vec<String>,
+    pub matches: Vec<GrepMatch>,
+}
+
+enum Matcher {
+    Regex(Regex),
+    Structural(StructuralPattern),
+}
+
+/// Search the files indexed for `ref_name`, reading them from `workspace`.
+/// Matches are ordered by path and position; `total` counts past `limit`.
+pub fn grep(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    options: &GrepOptions,
+) -> Result<GrepResults, GrepError> {
+    let path_filter = build_globs(&options.paths)?;
+    let mut entries = manifest::get_all_entries(conn, project_id, ref_name)?;
+    entries.retain(|entry| {
+        path_filter
+            .as_ref()
+            .is_none_or(|globs| globs.is_match(&entry.path))
+            && options
+                .language
+                .as_deref()
+                .is_none_or(|language| entry.language.as_deref() == Some(language))
+    });
+    entries.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let matcher = match options.kind {
+        PatternKind::Regex => Matcher::Regex(
+            RegexBuilder::new(&options.pattern)
+                .case_insensitive(options.ignore_case)
+                .build()
+                .map_err(|err| GrepError::InvalidPattern(err.to_string()))?,
+        ),
+        PatternKind::Structural => {
+            let languages: BTreeSet<&str> = entries
+                .iter()
+                .filter_map(|entry| entry.language.as_deref())
+                .collect();
+            let languages: Vec<&str> = languages.into_iter().collect();
+            Matcher::Structural(
+                StructuralPattern::compile(&options.pattern, &languages)
+                    .map_err(GrepError::InvalidPattern)?,
+            )
+        }
+    };
+
+    let mut results = GrepResults {
+        pattern: options.pattern.clone(),
+        kind: options.kind,
+        files_scanned: 0,
+        total: 0,
+        truncated: false,
+        skipped_languages: match &matcher {
+            Matcher::Structural(pattern) => pattern
+                .rejected()
+                .iter()
+                .map(|(language, _)| language.clone())
+                .collect(),
+            Matcher::Regex(_) => Vec::new(),
+        },
+        matches: Vec::new(),
+    };
+    for entry in entries {
+        let language = entry.language.clone().unwrap_or_default();
+        if matches!(&matcher, Matcher::Structural(pattern) if !pattern.supports(&language)) {
+            continue;
+        }
+        let Ok(content) = std::fs::read_to_string(workspace.join(&entry.path)) else {
+            continue;
+        };
+        results.files_scanned += 1;
+        let hits = match &matcher {
+            Matcher::Regex(regex) => regex_hits(regex, &content),
+            Matcher::Structural(pattern) => match pattern.find_matches(&content, &language) {
+                Ok(found) => found
+                    .into_iter()
+                    .map(|m| Hit {
+                        line: m.line_start,
+                        column: content[line_start_byte(&content, m.start_byte)..m.start_byte]
+                            .chars()
+                            .count() as u32
+                            + 1,
+                        end_line: (m.line_end > m.line_start).then_some(m.line_end),
+                    })
+                    .collect(),
+                Err(err) => {
+                    tracing::debug!(path = %entry.path, %err, "skipping unparsable file");
+                    continue;
+                }
+            },
+        };
+        if hits.is_empty() {
+            continue;
+        }
+
+        let file_symbols = symbols::list_symbols_in_file(conn, project_id, ref_name, &entry.path)?;
+        let lines: Vec<&str> = content.lines().collect();
+        for hit in hits {
+            results.total += 1;
+            if results.matches.len() >= options.limit {
+                continue;
+            }
+            results.matches.push(GrepMatch {
+                path: entry.path.clone(),
+                line: hit.line,
+                column: hit.column,
+                end_line: hit.end_line,
+                language: language.clone(),
+                package: package_of(&entry.path),
+                enclosing: innermost_symbol(&file_symbols, hit.line),
+                text: lines
+                    .get(hit.line as usize - 1)
+                    .map(|line| line.trim().to_string())
+                    .unwrap_or_default(),
+            });
+        }
+    }
+    results.truncated = results.total > results.matches.len();
+    Ok(results)
+}
+
+struct Hit {
+    line: u32,
+    column: u32,
+    end_line: Option<u32>,
+}
+
+fn regex_hits(regex: &Regex, content: &str) -> Vec<Hit> {
+    let mut hits = Vec::new();
+    for (idx, line) in content.lines().enumerate() {
+        for found in regex.find_iter(line) {
+            hits.push(Hit {
+                line: idx as u32 + 1,
+                column: line[..found.start()].chars().count() as u32 + 1,
+                end_line: None,
+            });
+        }
+    }
+    hits
+}
+
+fn line_start_byte(content: &str, byte: usize) -> usize {
+    content[..byte].rfind('\n').map_or(0, |newline| newline + 1)
+}
+
+fn build_globs(patterns: &[String]) -> Result<Option<GlobSet>, GrepError> {
+    if patterns.is_empty() {
+        return Ok(None);
+    }
+    let mut builder = GlobSetBuilder::new();
+    for pattern in patterns {
+        let glob = GlobBuilder::new(pattern)
+            .build()
+            .map_err(|err| GrepError::InvalidPattern(format!("`{pattern}`: {err}")))?;
+        builder.add(glob);
+    }
+    builder
+        .build()
+        .map(Some)
+        .map_err(|err| GrepError::InvalidPattern(err.to_string()))
+}
+
+fn package_of(path: &str) -> String {
+    path.rsplit_once('/')
+        .map(|(dir, _)| dir.to_string())
+        .unwrap_or_else(|| ROOT_PACKAGE.to_string())
+}
+
+/// The smallest indexed symbol whose span contains `line`.
+fn innermost_symbol(symbols: &[SymbolRecord], line: u32) -> Option<EnclosingSymbol> {
+    symbols
+        .iter()
+        .filter(|symbol| symbol.line_start <= line && line <= symbol.line_end)
+        .min_by_key(|symbol| symbol.line_end - symbol.line_start)
+        .map(|symbol| EnclosingSymbol {
+            name: symbol.name.clone(),
+            qualified_name: symbol.qualified_name.clone(),
+            kind: symbol.kind.as_str().to_string(),
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, path: &str, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "rust".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("pool::{name}"),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn add_file(conn: &Connection, workspace: &Path, path: &str, content: &str) {
+        let full = workspace.join(path);
+        std::fs::create_dir_all(full.parent().unwrap()).unwrap();
+        std::fs::write(full, content).unwrap();
+        manifest::upsert_manifest(
+            conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some("rust".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    fn options(pattern: &str, kind: PatternKind) -> GrepOptions {
+        GrepOptions {
+            pattern: pattern.to_string(),
+            kind,
+            ignore_case: false,
+            paths: Vec::new(),
+            language: None,
+            limit: 50,
+        }
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        add_file(
+            &conn,
+            tmp.path(),
+            "src/pool.rs",
+            "fn grow() {\n    let n = size().unwrap();\n}\n\nfn shrink() {\n    drop(n);\n}\n",
+        );
+        add_file(
+            &conn,
+            tmp.path(),
+            "main.rs",
+            "fn main() {\n    grow();\n}\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("grow", "src/pool.rs", 1, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("shrink", "src/pool.rs", 5, 7)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("main", "main.rs", 1, 3)).unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn regex_matches_carry_enclosing_symbol_and_package() {
+        let (tmp, conn) = setup();
+        let results = grep(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            &options(r"gr[a-z]+\(", PatternKind::Regex),
+        )
+        .unwrap();
+        let found: Vec<(&str, u32, u32, &str, Option<&str>)> = results
+            .matches
+            .iter()
+            .map(|m| {
+                (
+                    m.path.as_str(),
+                    m.line,
+                    m.column,
+                    m.package.as_str(),
+                    m.enclosing.as_ref().map(|s| s.name.as_str()),
+                )
+            })
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("main.rs", 2, 5, ".", Some("main")),
+                ("src/pool.rs", 1, 4, "src", Some("grow")),
+            ]
+        );
+        assert_eq!(results.files_scanned, 2);
+
+        let mut limited = options("n", PatternKind::Regex);
+        limited.paths = vec!["src/**".to_string()];
+        limited.limit = 1;
+        let results = grep(&conn, tmp.path(), "repo", "main", &limited).unwrap();
+        assert_eq!(results.files_scanned, 1);
+        assert_eq!(results.matches.len(), 1);
+        assert!(results.truncated && results.total > 1);
+
+        let err = grep(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            &options("(", PatternKind::Regex),
+        );
+        assert!(matches!(err, Err(GrepError::InvalidPattern(_))));
+    }
+
+    #[test]
+    fn structural_matches_report_node_positions() {
+        let (tmp, conn) = setup();
+        let results = grep(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            &options(
+                r#"(call_expression function: (field_expression field: (field_identifier) @m (#eq? @m "unwrap"))) @match"#,
+                PatternKind::Structural,
+            ),
+        )
+        .unwrap();
+        assert_eq!(results.matches.len(), 1);
+        let hit = &results.matches[0];
+        assert_eq!(
+            (hit.path.as_str(), hit.line, hit.column),
+            ("src/pool.rs", 2, 13)
+        );
+        assert_eq!(hit.text, "let n = size().unwrap();");
+        assert_eq!(hit.enclosing.as_ref().unwrap().qualified_name, "pool::grow");
+    }
+}
@@ -0,0 +1,429 @@
+//! Hotspots for `cruxe hotspots`: functions that are both complex and
+//! frequently changed, the usual best predictor of where defects and
+//! refactoring payoff concentrate.
+//!
+//! Change frequency comes from `git log` over a window (`--since`). Every
+//! function is first scored with the commit count of its file; the best
+//! candidates are then rescored with the commits that touched their own
+//! lines (`git log -L`), which is too slow to run for every function.
+//! Refs indexed with `[index] blame` also report who last changed each
+//! hotspot and when. In a shallow clone only the commits after its boundary
+//! count: the boundary commits have no parents and would look like they
+//! changed every file.
+
+use crate::findings::complexity;
+use crate::query_expr::LastChange;
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{symbol_blame, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+use std::process::Command;
+
+/// Window used when neither `--since` nor `[hotspots] since` is set.
+pub const DEFAULT_SINCE: &str = "6 months ago";
+
+/// Candidates rescored with line history, per reported hotspot.
+const CANDIDATES_PER_HOTSPOT: usize = 3;
+
+#[derive(Debug, thiserror::Error)]
+pub enum HotspotError {
+    #[error("not a git repository")]
+    NotGitRepo,
+    #[error("git log failed: {0}")]
+    Git(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone)]
+pub struct HotspotOptions {
+    /// Any `git log --since` value, e.g. `6 months ago` or `2026-01-01`.
+    pub since: String,
+    /// Hotspots to report.
+    pub limit: usize,
+    /// Only functions under this path prefix.
+    pub path_prefix: Option<String>,
+    /// Only functions in files in scope.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct Hotspot {
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub lines: u32,
+    pub complexity: u32,
+    /// Commits in the window that changed the function's lines.
+    pub commits: u32,
+    /// Commits in the window that changed its file.
+    pub file_commits: u32,
+    /// Distinct authors of those file commits.
+    pub authors: u32,
+    /// `commits × complexity`.
+    pub score: u32,
+    /// The last commit to change the function, when blame was indexed.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub last_change: Option<LastChange>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct HotspotReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub since: String,
+    /// Commits in the window.
+    pub commits: u32,
+    /// Functions in files changed during the window.
+    pub functions: usize,
+    pub hotspots: Vec<Hotspot>,
+    /// The clone is shallow, so commits before its boundary are not counted
+    /// even inside the window.
+    pub shallow: bool,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+struct FileChurn {
+    commits: u32,
+    authors: HashSet<String>,
+}
+
+/// Rank the functions of `ref_name` by change frequency times complexity.
+pub fn find_hotspots(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    options: &HotspotOptions,
+) -> Result<HotspotReport, HotspotError> {
+    if !cruxe_core::vcs::is_git_repo(workspace) {
+        return Err(HotspotError::NotGitRepo);
+    }
+    let revision = if ref_name == constants::REF_LIVE {
+        "HEAD"
+    } else {
+        ref_name
+    };
+    let excluded: Vec<String> = cruxe_vcs::history::shallow_boundary(workspace)
+        .into_iter()
+        .map(|commit| format!("^{commit}"))
+        .collect();
+    let (commits, churn) = file_churn(workspace, revision, &excluded, &options.since)?;
+    let blame = symbol_blame::list_for_ref(conn, repo, ref_name)?;
+    let now = std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map_or(0, |elapsed| elapsed.as_secs() as i64);
+
+    let mut candidates: Vec<Hotspot> = Vec::new();
+    symbols::for_each_callable_body(conn, repo, ref_name, |symbol| {
+        if options
+            .path_prefix
+            .as_deref()
+            .is_some_and(|prefix| !symbol.path.starts_with(prefix))
+            || !options.scope.contains(&symbol.path)
+        {
+            return Ok(());
+        }
+        let (Some(file), Some(content)) = (churn.get(&symbol.path), symbol.content.as_deref())
+        else {
+            return Ok(());
+        };
+        let complexity = complexity(content);
+        let last_change = blame
+            .get(&symbol.symbol_stable_id)
+            .map(|blame| LastChange::from_blame(blame, now));
+        candidates.push(Hotspot {
+            qualified_name: symbol.qualified_name,
+            kind: symbol.kind.as_str().to_string(),
+            lines: symbol.line_end.saturating_sub(symbol.line_start) + 1,
+            path: symbol.path,
+            line_start: symbol.line_start,
+            line_end: symbol.line_end,
+            complexity,
+            commits: file.commits,
+            file_commits: file.commits,
+            authors: file.authors.len() as u32,
+            score: file.commits * complexity,
+            last_change,
+        });
+        Ok(())
+    })?;
+    let functions = candidates.len();
+
+    rank(&mut candidates);
+    candidates.truncate(options.limit.max(1) * CANDIDATES_PER_HOTSPOT);
+    for candidate in &mut candidates {
+        if let Some(commits) = line_commits(
+            workspace,
+            revision,
+            &excluded,
+            &options.since,
+            &candidate.path,
+            candidate.line_start,
+            candidate.line_end,
+        ) {
+            candidate.commits = commits;
+            candidate.score = commits * candidate.complexity;
+        }
+    }
+    candidates.retain(|candidate| candidate.commits > 0);
+    rank(&mut candidates);
+    candidates.truncate(options.limit.max(1));
+
+    Ok(HotspotReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        since: options.since.clone(),
+        commits,
+        functions,
+        hotspots: candidates,
+        shallow: !excluded.is_empty(),
+    })
+}
+
+fn rank(hotspots: &mut [Hotspot]) {
+    hotspots.sort_by(|a, b| {
+        b.score
+            .cmp(&a.score)
+            .then_with(|| b.lines.cmp(&a.lines))
+            .then_with(|| (&a.path, a.line_start).cmp(&(&b.path, b.line_start)))
+    });
+}
+
+/// Commits in the window and, per file they touched, the commit count and
+/// authors. Merges and renames are not followed; `excluded` are `^<commit>`
+/// arguments for commits to leave out.
+fn file_churn(
+    workspace: &Path,
+    revision: &str,
+    excluded: &[String],
+    since: &str,
+) -> Result<(u32, HashMap<String, FileChurn>), HotspotError> {
+    let output = Command::new("git")
+        .arg("-C")
+        .arg(workspace)
+        .args(["log", "--no-merges", "--no-renames", "--name-only"])
+        .arg(format!("--since={since}"))
+        .arg("--format=%x1e%an")
+        .arg(revision)
+        .args(excluded)
+        .arg("--")
+        .output()
+        .map_err(|e| HotspotError::Git(e.to_string()))?;
+    if !output.status.success() {
+        return Err(HotspotError::Git(
+            String::from_utf8_lossy(&output.stderr).trim().to_string(),
+        ));
+    }
+    Ok(parse_churn(&String::from_utf8_lossy(&output.stdout)))
+}
+
+/// `\x1e<author>` followed by the files of that commit, one per line.
+fn parse_churn(log: &str) -> (u32, HashMap<String, FileChurn>) {
+    let mut commits = 0;
+    let mut churn: HashMap<String, FileChurn> = HashMap::new();
+    for entry in log.split('\x1e').skip(1) {
+        let mut lines = entry.lines();
+        let author = lines.next().unwrap_or_default().to_string();
+        commits += 1;
+        for path in lines.map(str::trim).filter(|line| !line.is_empty()) {
+            let file = churn.entry(path.to_string()).or_default();
+            file.commits += 1;
+            file.authors.insert(author.clone());
+        }
+    }
+    (commits, churn)
+}
+
+/// Commits in the window that changed lines `line_start..=line_end` of
+/// `path`, as `git log -L` traces them back; `None` if git cannot.
+fn line_commits(
+    workspace: &Path,
+    revision: &str,
+    excluded: &[String],
+    since: &str,
+    path: &str,
+    line_start: u32,
+    line_end: u32,
+) -> Option<u32> {
+    if line_start == 0 {
+        return None;
+    }
+    let output = Command::new("git")
+        .arg("-C")
+        .arg(workspace)
+        .args(["log", "--no-merges", "--no-patch", "--format=%h"])
+        .arg(format!("--since={since}"))
+        .arg(format!(
+            "-L{},{}:{}",
+            line_start,
+            line_end.max(line_start),
+            path
+        ))
+        .arg(revision)
+        .args(excluded)
+        .output()
+        .ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    Some(
+        String::from_utf8_lossy(&output.stdout)
+            .lines()
+            .filter(|line| !line.trim().is_empty())
+            .count() as u32,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+
+    fn git(repo: &Path, args: &[&str]) {
+        let output = Command::new("git")
+            .args(args)
+            .current_dir(repo)
+            .output()
+            .unwrap();
+        assert!(
+            output.status.success(),
+            "git {:?} failed: {}",
+            args,
+            String::from_utf8_lossy(&output.stderr)
+        );
+    }
+
+    fn source(parse_branches: usize, render_edit: usize) -> String {
+        let mut text = String::from("package app\n\nfunc Parse(s string) int {\n");
+        for idx in 0..parse_branches {
+            text.push_str(&format!("\tif s == \"{idx}\" {{\n\t\treturn {idx}\n\t}}\n"));
+        }
+        text.push_str("\treturn -1\n}\n\nfunc Render() string {\n");
+        text.push_str(&format!("\treturn \"v{render_edit}\"\n}}\n"));
+        text
+    }
+
+    fn function(name: &str, text: &str) -> SymbolRecord {
+        let lines: Vec<&str> = text.lines().collect();
+        let start = lines
+            .iter()
+            .position(|line| line.starts_with(&format!("func {name}")))
+            .unwrap();
+        let end = start + lines[start..].iter().position(|line| *line == "}").unwrap();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "app/app.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: start as u32 + 1,
+            line_end: end as u32 + 1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(lines[start..=end].join("\n")),
+        }
+    }
+
+    #[test]
+    fn ranks_complex_frequently_changed_functions_first() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("workspace");
+        std::fs::create_dir_all(workspace.join("app")).unwrap();
+        git(&workspace, &["init"]);
+        git(&workspace, &["config", "user.email", "tests@example.com"]);
+        git(&workspace, &["config", "user.name", "Cruxe Tests"]);
+        std::fs::write(workspace.join("README.md"), "app\n").unwrap();
+        for (parse_branches, render_edit) in [(1, 0), (2, 0), (3, 0), (3, 1)] {
+            std::fs::write(
+                workspace.join("app/app.go"),
+                source(parse_branches, render_edit),
+            )
+            .unwrap();
+            git(&workspace, &["add", "."]);
+            git(&workspace, &["commit", "-m", "change"]);
+        }
+        git(&workspace, &["branch", "-M", "main"]);
+
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let text = source(3, 1);
+        for name in ["Parse", "Render"] {
+            symbols::insert_symbol(&conn, &function(name, &text)).unwrap();
+        }
+
+        let options = HotspotOptions {
+            since: "10 years ago".to_string(),
+            limit: 10,
+            path_prefix: None,
+            scope: PathScope::default(),
+        };
+        let report = find_hotspots(&conn, &workspace, "repo", "main", &options).unwrap();
+        assert_eq!(report.commits, 4);
+        assert_eq!(report.functions, 2);
+        let ranked: Vec<(&str, u32, u32, u32)> = report
+            .hotspots
+            .iter()
+            .map(|hotspot| {
+                (
+                    hotspot.qualified_name.as_str(),
+                    hotspot.commits,
+                    hotspot.file_commits,
+                    hotspot.complexity,
+                )
+            })
+            .collect();
+        assert_eq!(ranked[0], ("Parse", 3, 4, 4));
+        assert_eq!(ranked[1].0, "Render");
+        assert_eq!(report.hotspots[0].authors, 1);
+        assert_eq!(report.hotspots[0].score, 12);
+        assert!(!report.shallow);
+
+        // The boundary of a depth-2 clone does not count as changing the file.
+        let shallow = tmp.path().join("shallow");
+        git(
+            tmp.path(),
+            &[
+                "clone",
+                "--quiet",
+                "--depth",
+                "2",
+                &format!("file://{}", workspace.display()),
+                "shallow",
+            ],
+        );
+        let report = find_hotspots(&conn, &shallow, "repo", "main", &options).unwrap();
+        assert!(report.shallow);
+        assert_eq!(report.commits, 1);
+        let names: Vec<&str> = report
+            .hotspots
+            .iter()
+            .map(|hotspot| hotspot.qualified_name.as_str())
+            .collect();
+        assert_eq!(names, ["Render"]);
+    }
+
+    #[test]
+    fn parses_commit_authors_and_files() {
+        let log = "\x1eAda\n\napp/a.go\napp/b.go\n\x1eLin\n\napp/a.go\n\x1eAda\n";
+        let (commits, churn) = parse_churn(log);
+        assert_eq!(commits, 3);
+        assert_eq!(churn["app/a.go"].commits, 2);
+        assert_eq!(churn["app/a.go"].authors.len(), 2);
+        assert_eq!(churn["app/b.go"].commits, 1);
+    }
+}
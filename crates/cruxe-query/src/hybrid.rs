@@ -82,6 +82,7 @@ pub fn semantic_query(
                     kind: None,
                     name: None,
                     qualified_name: None,
+                    canonical_id: None,
                     language: matched.language,
                     signature: None,
                     visibility: None,
@@ -248,6 +249,7 @@ mod tests {
             kind: None,
             name: None,
             qualified_name: None,
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
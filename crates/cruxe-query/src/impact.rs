@@ -0,0 +1,614 @@
+use crate::call_graph::{self, CallGraphSymbol, CallSite};
+use crate::diff_context::DiffLineRange;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+use std::path::Path;
+
+#[derive(Debug, thiserror::Error)]
+pub enum ImpactError {
+    #[error("git diff {range} failed: {reason}")]
+    GitDiff { range: String, reason: String },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// One `--changed` argument: a workspace-relative file (every line counts as
+/// changed) or a git revision range passed to `git diff`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ChangeSpec {
+    File(String),
+    Range(String),
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ChangedFile {
+    pub path: String,
+    /// Changed line ranges on the new side; empty when `whole_file` is set.
+    pub ranges: Vec<DiffLineRange>,
+    pub whole_file: bool,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ImpactedSymbol {
+    pub symbol: CallGraphSymbol,
+    /// Call distance from the nearest changed symbol.
+    pub depth: u32,
+    /// Where this symbol calls into the changed code.
+    pub call_site: CallSite,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct ImpactReport {
+    pub changed_files: Vec<ChangedFile>,
+    pub changed_symbols: Vec<CallGraphSymbol>,
+    pub affected_symbols: Vec<ImpactedSymbol>,
+    pub affected_packages: Vec<String>,
+    pub affected_tests: Vec<CallGraphSymbol>,
+    /// Test files holding changed or affected code, including test files
+    /// whose cases are not named symbols (e.g. `it(...)` blocks).
+    pub test_files: Vec<String>,
+    pub truncated: bool,
+    pub depth_applied: u32,
+}
+
+/// Resolve `--changed` arguments into per-file line ranges. With no
+/// arguments, the uncommitted changes against `HEAD` are used.
+pub fn collect_changes(
+    workspace: &Path,
+    specs: &[ChangeSpec],
+) -> Result<Vec<ChangedFile>, ImpactError> {
+    let default_specs = [ChangeSpec::Range("HEAD".to_string())];
+    let specs = if specs.is_empty() {
+        &default_specs[..]
+    } else {
+        specs
+    };
+
+    let mut files = Vec::new();
+    for spec in specs {
+        match spec {
+            ChangeSpec::File(path) => files.push(ChangedFile {
+                path: path.clone(),
+                ranges: Vec::new(),
+                whole_file: true,
+            }),
+            ChangeSpec::Range(range) => files.extend(git_diff_lines(workspace, range)?),
+        }
+    }
+    Ok(merge_changed_files(files))
+}
+
+fn git_diff_lines(workspace: &Path, range: &str) -> Result<Vec<ChangedFile>, ImpactError> {
+    let diff = git_diff(workspace, range, &["-U0"])?;
+    Ok(parse_unified_diff(&diff))
+}
+
+/// Output of `git diff <args> <range>` in `workspace`. When it fails in a
+/// shallow clone, the error says so: the range likely reaches past its
+/// history.
+pub(crate) fn git_diff(
+    workspace: &Path,
+    range: &str,
+    args: &[&str],
+) -> Result<String, ImpactError> {
+    let output = std::process::Command::new("git")
+        .arg("-C")
+        .arg(workspace)
+        .arg("diff")
+        .args(args)
+        .args(["--no-color", "--no-ext-diff", range, "--"])
+        .output()
+        .map_err(|e| ImpactError::GitDiff {
+            range: range.to_string(),
+            reason: e.to_string(),
+        })?;
+    if !output.status.success() {
+        let mut reason = String::from_utf8_lossy(&output.stderr).trim().to_string();
+        if let Some(hint) = cruxe_vcs::missing_history_hint(workspace) {
+            reason = format!("{reason} ({hint})");
+        }
+        return Err(ImpactError::GitDiff {
+            range: range.to_string(),
+            reason,
+        });
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+/// Changed new-side line ranges per file from `git diff -U0` output. A pure
+/// deletion is recorded as the line it sits after, so the enclosing symbol
+/// still counts as changed; deleted files count as changed in full.
+pub fn parse_unified_diff(diff: &str) -> Vec<ChangedFile> {
+    let mut files: Vec<ChangedFile> = Vec::new();
+    let mut old_path: Option<String> = None;
+    for line in diff.lines() {
+        if let Some(path) = line.strip_prefix("--- ") {
+            old_path = strip_diff_prefix(path, "a/");
+        } else if let Some(path) = line.strip_prefix("+++ ") {
+            match strip_diff_prefix(path, "b/") {
+                Some(path) => files.push(ChangedFile {
+                    path,
+                    ranges: Vec::new(),
+                    whole_file: false,
+                }),
+                None => {
+                    if let Some(path) = old_path.take() {
+                        files.push(ChangedFile {
+                            path,
+                            ranges: Vec::new(),
+                            whole_file: true,
+                        });
+                    }
+                }
+            }
+        } else if line.starts_with("@@ ")
+            && let Some(file) = files.last_mut()
+            && !file.whole_file
+            && let Some(range) = parse_hunk_header(line)
+        {
+            file.ranges.push(range);
+        }
+    }
+    files
+}
+
+fn strip_diff_prefix(path: &str, prefix: &str) -> Option<String> {
+    let path = path.split('\t').next().unwrap_or(path).trim();
+    if path == "/dev/null" {
+        return None;
+    }
+    Some(path.strip_prefix(prefix).unwrap_or(path).to_string())
+}
+
+/// `@@ -a[,b] +c[,d] @@` → new-side lines `c..c+d-1`.
+fn parse_hunk_header(line: &str) -> Option<DiffLineRange> {
+    let new_side = line.split_whitespace().find(|part| part.starts_with('+'))?;
+    let mut parts = new_side[1..].splitn(2, ',');
+    let start: u32 = parts.next()?.parse().ok()?;
+    let count: u32 = match parts.next() {
+        Some(count) => count.parse().ok()?,
+        None => 1,
+    };
+    let start = start.max(1);
+    Some(DiffLineRange {
+        start,
+        end: start + count.saturating_sub(1),
+    })
+}
+
+fn merge_changed_files(files: Vec<ChangedFile>) -> Vec<ChangedFile> {
+    let mut merged: BTreeMap<String, ChangedFile> = BTreeMap::new();
+    for file in files {
+        let entry = merged
+            .entry(file.path.clone())
+            .or_insert_with(|| ChangedFile {
+                path: file.path.clone(),
+                ranges: Vec::new(),
+                whole_file: false,
+            });
+        entry.whole_file |= file.whole_file;
+        entry.ranges.extend(file.ranges);
+    }
+    merged
+        .into_values()
+        .map(|mut file| {
+            if file.whole_file {
+                file.ranges.clear();
+            }
+            file.ranges.sort_by_key(|range| (range.start, range.end));
+            file.ranges.dedup();
+            file
+        })
+        .collect()
+}
+
+/// Map changed lines to their innermost enclosing symbols, then walk the
+/// reverse call graph up to `depth` to find everything that may be affected.
+/// `limit` caps the number of affected (non-changed) symbols.
+pub fn analyze_impact(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    changed_files: Vec<ChangedFile>,
+    depth: u32,
+    limit: usize,
+) -> Result<ImpactReport, ImpactError> {
+    let mut changed = BTreeMap::new();
+    for file in &changed_files {
+        let file_symbols = symbols::list_symbols_in_file(conn, repo, ref_name, &file.path)?;
+        for symbol in changed_symbols_in_file(&file_symbols, file) {
+            changed
+                .entry(symbol.symbol_stable_id.clone())
+                .or_insert_with(|| call_graph::to_call_graph_symbol(symbol));
+        }
+    }
+
+    let mut budget = limit.max(1);
+    let mut truncated = false;
+    let mut affected: HashMap<String, ImpactedSymbol> = HashMap::new();
+    for stable_id in changed.keys() {
+        if budget == 0 {
+            truncated = true;
+            break;
+        }
+        let (callers, callers_truncated) =
+            call_graph::transitive_callers(conn, repo, ref_name, stable_id, depth, budget)?;
+        truncated |= callers_truncated;
+        for caller in callers {
+            if changed.contains_key(&caller.symbol.symbol_stable_id) {
+                continue;
+            }
+            match affected.get_mut(&caller.symbol.symbol_stable_id) {
+                Some(existing) => {
+                    if caller.depth < existing.depth {
+                        existing.depth = caller.depth;
+                        existing.call_site = caller.call_site;
+                    }
+                }
+                None => {
+                    budget = budget.saturating_sub(1);
+                    affected.insert(
+                        caller.symbol.symbol_stable_id.clone(),
+                        ImpactedSymbol {
+                            symbol: caller.symbol,
+                            depth: caller.depth,
+                            call_site: caller.call_site,
+                        },
+                    );
+                }
+            }
+        }
+    }
+
+    let changed_symbols: Vec<CallGraphSymbol> = changed.into_values().collect();
+    let mut affected_symbols: Vec<ImpactedSymbol> = affected.into_values().collect();
+    affected_symbols.sort_by(|left, right| {
+        left.depth
+            .cmp(&right.depth)
+            .then_with(|| left.symbol.path.cmp(&right.symbol.path))
+            .then_with(|| left.symbol.line_start.cmp(&right.symbol.line_start))
+    });
+
+    let all_symbols = changed_symbols
+        .iter()
+        .chain(affected_symbols.iter().map(|impacted| &impacted.symbol));
+    let mut packages = BTreeSet::new();
+    let mut test_files = BTreeSet::new();
+    let mut affected_tests = Vec::new();
+    for symbol in all_symbols {
+        packages.insert(package_of(&symbol.path));
+        if is_test_path(&symbol.path) {
+            test_files.insert(symbol.path.clone());
+        }
+        if is_test_symbol(symbol) {
+            affected_tests.push(symbol.clone());
+        }
+    }
+    for file in &changed_files {
+        packages.insert(package_of(&file.path));
+        if is_test_path(&file.path) {
+            test_files.insert(file.path.clone());
+        }
+    }
+    affected_tests.sort_by(|left, right| {
+        left.path
+            .cmp(&right.path)
+            .then_with(|| left.line_start.cmp(&right.line_start))
+    });
+
+    Ok(ImpactReport {
+        changed_files,
+        changed_symbols,
+        affected_symbols,
+        affected_packages: packages.into_iter().collect(),
+        affected_tests,
+        test_files: test_files.into_iter().collect(),
+        truncated,
+        depth_applied: call_graph::clamp_depth(depth),
+    })
+}
+
+/// Symbols touched by the change. For each range only the innermost
+/// overlapping symbols count: editing a method does not mark its whole class
+/// as changed, but editing a class field does.
+pub(crate) fn changed_symbols_in_file<'a>(
+    file_symbols: &'a [SymbolRecord],
+    file: &ChangedFile,
+) -> Vec<&'a SymbolRecord> {
+    if file.whole_file {
+        return file_symbols.iter().collect();
+    }
+    let mut hits: Vec<&SymbolRecord> = Vec::new();
+    for range in &file.ranges {
+        let overlapping: Vec<&SymbolRecord> = file_symbols
+            .iter()
+            .filter(|symbol| symbol.line_start <= range.end && range.start <= symbol.line_end)
+            .collect();
+        for symbol in &overlapping {
+            let has_inner = overlapping.iter().any(|other| {
+                other.symbol_stable_id != symbol.symbol_stable_id
+                    && symbol.line_start <= other.line_start
+                    && other.line_end <= symbol.line_end
+                    && (other.line_start, other.line_end) != (symbol.line_start, symbol.line_end)
+            });
+            if !has_inner
+                && !hits
+                    .iter()
+                    .any(|hit| hit.symbol_stable_id == symbol.symbol_stable_id)
+            {
+                hits.push(symbol);
+            }
+        }
+    }
+    hits
+}
+
+/// The directory holding a file, which is the package for Go and the closest
+/// cross-language approximation elsewhere.
+pub(crate) fn package_of(path: &str) -> String {
+    match path.rsplit_once('/') {
+        Some((dir, _)) => dir.to_string(),
+        None => ".".to_string(),
+    }
+}
+
+pub fn is_test_path(path: &str) -> bool {
+    let file_name = path.rsplit('/').next().unwrap_or(path);
+    let in_test_dir = path
+        .split('/')
+        .any(|segment| matches!(segment, "tests" | "test" | "__tests__" | "spec"));
+    in_test_dir
+        || file_name.ends_with("_test.go")
+        || file_name.ends_with("_test.py")
+        || (file_name.starts_with("test_") && file_name.ends_with(".py"))
+        || [".test.", ".spec."]
+            .iter()
+            .any(|marker| file_name.contains(marker))
+}
+
+/// Test functions by each language's runner convention: `TestXxx` and
+/// friends in Go `_test.go` files, `test_*` in Python test files, and Rust
+/// functions inside `tests` modules or integration-test directories.
+pub fn is_test_symbol(symbol: &CallGraphSymbol) -> bool {
+    if !matches!(symbol.kind.as_str(), "function" | "method") {
+        return false;
+    }
+    let name = symbol.name.as_str();
+    if symbol.path.ends_with("_test.go") {
+        return ["Test", "Benchmark", "Fuzz", "Example"]
+            .iter()
+            .any(|prefix| name.starts_with(prefix));
+    }
+    if symbol.path.ends_with(".py") {
+        return is_test_path(&symbol.path) && name.starts_with("test");
+    }
+    if symbol.path.ends_with(".rs") {
+        return symbol.qualified_name.contains("tests::")
+            || (is_test_path(&symbol.path) && !name.starts_with('_'));
+    }
+    false
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind};
+    use cruxe_state::{db, edges, schema};
+
+    fn setup() -> Connection {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        conn
+    }
+
+    fn symbol(stable: &str, name: &str, path: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{stable}"),
+            symbol_stable_id: stable.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: &str, file: &str, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: Some(to.to_string()),
+            to_name: None,
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: file.to_string(),
+            source_line: line,
+        }
+    }
+
+    #[test]
+    fn parse_unified_diff_reads_new_side_ranges() {
+        let diff = "\
+diff --git a/pkg/auth/token.go b/pkg/auth/token.go
+--- a/pkg/auth/token.go
++++ b/pkg/auth/token.go
+@@ -10,2 +10,3 @@ func Validate() {
+@@ -40 +41 @@
+@@ -50,3 +51,0 @@
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,5 +0,0 @@
+";
+        let files = parse_unified_diff(diff);
+        assert_eq!(files.len(), 2);
+        assert_eq!(files[0].path, "pkg/auth/token.go");
+        assert_eq!(
+            files[0].ranges,
+            vec![
+                DiffLineRange { start: 10, end: 12 },
+                DiffLineRange { start: 41, end: 41 },
+                DiffLineRange { start: 51, end: 51 },
+            ]
+        );
+        assert_eq!(files[1].path, "old.go");
+        assert!(files[1].whole_file);
+        assert!(files[1].ranges.is_empty());
+    }
+
+    #[test]
+    fn changed_lines_map_to_innermost_symbol() {
+        let records = vec![
+            symbol("class", "Server", "srv.py", (1, 30)),
+            symbol("method", "handle", "srv.py", (5, 12)),
+        ];
+        let inside_method = ChangedFile {
+            path: "srv.py".to_string(),
+            ranges: vec![DiffLineRange { start: 7, end: 8 }],
+            whole_file: false,
+        };
+        let hits = changed_symbols_in_file(&records, &inside_method);
+        assert_eq!(hits.len(), 1);
+        assert_eq!(hits[0].name, "handle");
+
+        let class_body = ChangedFile {
+            path: "srv.py".to_string(),
+            ranges: vec![DiffLineRange { start: 2, end: 2 }],
+            whole_file: false,
+        };
+        let hits = changed_symbols_in_file(&records, &class_body);
+        assert_eq!(hits.len(), 1);
+        assert_eq!(hits[0].name, "Server");
+    }
+
+    #[test]
+    fn analyze_impact_walks_callers_and_collects_tests() {
+        let conn = setup();
+        for record in [
+            symbol("parse", "parse", "pkg/config/parse.go", (10, 20)),
+            symbol("load", "Load", "pkg/config/load.go", (5, 15)),
+            symbol("serve", "Serve", "cmd/server/main.go", (3, 9)),
+            symbol("test-load", "TestLoad", "pkg/config/load_test.go", (1, 8)),
+            symbol("unrelated", "Other", "pkg/other/other.go", (1, 4)),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("load", "parse", "pkg/config/load.go", 7),
+                call("serve", "load", "cmd/server/main.go", 4),
+                call("test-load", "load", "pkg/config/load_test.go", 3),
+            ],
+        )
+        .unwrap();
+
+        let changes = vec![ChangedFile {
+            path: "pkg/config/parse.go".to_string(),
+            ranges: vec![DiffLineRange { start: 12, end: 12 }],
+            whole_file: false,
+        }];
+        let report = analyze_impact(&conn, "repo", "main", changes, 3, 100).unwrap();
+
+        assert_eq!(report.changed_symbols.len(), 1);
+        assert_eq!(report.changed_symbols[0].name, "parse");
+        let affected: Vec<(&str, u32)> = report
+            .affected_symbols
+            .iter()
+            .map(|impacted| (impacted.symbol.name.as_str(), impacted.depth))
+            .collect();
+        assert_eq!(affected, vec![("Load", 1), ("Serve", 2), ("TestLoad", 2)]);
+        assert_eq!(
+            report.affected_packages,
+            vec!["cmd/server".to_string(), "pkg/config".to_string()]
+        );
+        assert_eq!(report.affected_tests.len(), 1);
+        assert_eq!(report.affected_tests[0].name, "TestLoad");
+        assert_eq!(
+            report.test_files,
+            vec!["pkg/config/load_test.go".to_string()]
+        );
+        assert!(!report.truncated);
+
+        let shallow = analyze_impact(
+            &conn,
+            "repo",
+            "main",
+            vec![ChangedFile {
+                path: "pkg/config/parse.go".to_string(),
+                ranges: Vec::new(),
+                whole_file: true,
+            }],
+            1,
+            100,
+        )
+        .unwrap();
+        assert_eq!(shallow.affected_symbols.len(), 1);
+        assert!(shallow.affected_tests.is_empty());
+    }
+
+    #[test]
+    fn test_symbol_detection_follows_language_conventions() {
+        let make = |name: &str, qualified: &str, path: &str| CallGraphSymbol {
+            symbol_id: String::new(),
+            symbol_stable_id: String::new(),
+            name: name.to_string(),
+            qualified_name: qualified.to_string(),
+            path: path.to_string(),
+            line_start: 1,
+            line_end: 2,
+            kind: "function".to_string(),
+        };
+        assert!(is_test_symbol(&make(
+            "TestParse",
+            "TestParse",
+            "a/parse_test.go"
+        )));
+        assert!(!is_test_symbol(&make(
+            "helper",
+            "helper",
+            "a/parse_test.go"
+        )));
+        assert!(is_test_symbol(&make(
+            "test_parse",
+            "test_parse",
+            "tests/test_parse.py"
+        )));
+        assert!(!is_test_symbol(&make(
+            "test_parse",
+            "test_parse",
+            "app/parse.py"
+        )));
+        assert!(is_test_symbol(&make(
+            "parses",
+            "parser::tests::parses",
+            "src/parser.rs"
+        )));
+        assert!(!is_test_symbol(&make(
+            "parse",
+            "parser::parse",
+            "src/parser.rs"
+        )));
+        assert!(is_test_path("web/src/app.test.ts"));
+        assert!(!is_test_path("web/src/app.ts"));
+    }
+}
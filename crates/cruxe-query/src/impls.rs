@@ -0,0 +1,660 @@
+//! Concrete types that implement an interface, for `cruxe impls`.
+//!
+//! Go interfaces are satisfied implicitly, so Go types are matched by
+//! method set: the methods indexed with a type as their receiver must cover
+//! every method the interface declares, including those of embedded
+//! interfaces that are indexed. Receiver kinds (value or pointer),
+//! parameter types and methods promoted from embedded fields are not
+//! considered. Rust traits and TypeScript/Python interfaces are implemented
+//! explicitly, so their `impl Trait for Type` lines and class headers are
+//! found among the interface's reference sites.
+
+use crate::describe::rust_trait_impl;
+use crate::graph_export::{Relation, supertypes_from_source};
+use crate::ref_sites::{self, RefKind, bare_name};
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet, HashMap, HashSet};
+use std::path::Path;
+
+/// Lines of a class declaration searched for its heritage clause.
+const MAX_HEADER_LINES: u32 = 6;
+
+#[derive(Debug, thiserror::Error)]
+pub enum ImplsError {
+    #[error("interface not found")]
+    NotFound,
+    #[error("`{name}` is a {kind}, not an interface or trait")]
+    NotAnInterface { name: String, kind: String },
+    #[error("ambiguous interface ({} candidates)", candidates.len())]
+    Ambiguous { candidates: Vec<String> },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct Implementation {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line: u32,
+    /// How the type satisfies the interface: `method_set` (Go), `impl`
+    /// (Rust), `implements` or `extends` (class headers).
+    pub via: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ImplsReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub interface: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line: u32,
+    /// Methods a Go type needs, own and embedded; empty for other languages.
+    pub methods: Vec<String>,
+    /// Embedded interfaces that are not indexed, so their methods were not
+    /// required of implementations.
+    pub unresolved: Vec<String>,
+    pub implementations: Vec<Implementation>,
+}
+
+/// Every indexed type on `ref_name` that implements `interface` (a name or
+/// qualified name, optionally narrowed to the file `path`).
+pub fn find_implementations(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    interface: &str,
+    path: Option<&str>,
+) -> Result<ImplsReport, ImplsError> {
+    let target = resolve_interface(conn, repo, ref_name, interface, path)?;
+    let mut sources = SourceCache::new(workspace);
+    let mut report = ImplsReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        interface: target.qualified_name.clone(),
+        kind: target.kind.as_str().to_string(),
+        language: target.language.clone(),
+        path: target.path.clone(),
+        line: target.line_start,
+        methods: Vec::new(),
+        unresolved: Vec::new(),
+        implementations: Vec::new(),
+    };
+
+    if target.language == "go" {
+        let mut methods = BTreeSet::new();
+        let mut visited = HashSet::new();
+        go_method_set(
+            conn,
+            repo,
+            ref_name,
+            &target,
+            &mut sources,
+            &mut visited,
+            &mut methods,
+            &mut report.unresolved,
+        )?;
+        report.methods = methods.into_iter().collect();
+        if !report.methods.is_empty() {
+            report.implementations = go_implementations(conn, repo, ref_name, &report.methods)?;
+        }
+    } else {
+        report.implementations =
+            declared_implementations(conn, workspace, repo, ref_name, &target, &mut sources)?;
+    }
+    report.implementations.sort_by(|a, b| {
+        (&a.path, a.line, &a.qualified_name).cmp(&(&b.path, b.line, &b.qualified_name))
+    });
+    report.implementations.dedup();
+    Ok(report)
+}
+
+fn resolve_interface(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    interface: &str,
+    path: Option<&str>,
+) -> Result<SymbolRecord, ImplsError> {
+    let name = bare_name(interface);
+    let mut matches = symbols::find_symbols_by_name(conn, repo, ref_name, name, path)?;
+    if name != interface {
+        matches.retain(|candidate| candidate.qualified_name == interface);
+    }
+    let Some(other) = matches.first().cloned() else {
+        return Err(ImplsError::NotFound);
+    };
+    matches.retain(is_interface_like);
+    match matches.len() {
+        0 => Err(ImplsError::NotAnInterface {
+            name: other.qualified_name,
+            kind: other.kind.as_str().to_string(),
+        }),
+        1 => Ok(matches.remove(0)),
+        _ => Err(ImplsError::Ambiguous {
+            candidates: matches
+                .iter()
+                .map(|candidate| {
+                    format!(
+                        "{} ({}) {}:{}",
+                        candidate.qualified_name,
+                        candidate.kind.as_str(),
+                        candidate.path,
+                        candidate.line_start
+                    )
+                })
+                .collect(),
+        }),
+    }
+}
+
+/// Python has no interface declarations; its ABCs and protocols are classes.
+fn is_interface_like(symbol: &SymbolRecord) -> bool {
+    match symbol.kind {
+        SymbolKind::Interface | SymbolKind::Trait => true,
+        SymbolKind::Class => symbol.language == "python",
+        _ => false,
+    }
+}
+
+/// Collect the methods of a Go interface and, recursively, of the indexed
+/// interfaces it embeds. `error` contributes `Error`.
+#[allow(clippy::too_many_arguments)]
+fn go_method_set(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    interface: &SymbolRecord,
+    sources: &mut SourceCache<'_>,
+    visited: &mut HashSet<String>,
+    methods: &mut BTreeSet<String>,
+    unresolved: &mut Vec<String>,
+) -> Result<(), StateError> {
+    if !visited.insert(interface.symbol_id.clone()) {
+        return Ok(());
+    }
+    let body = sources.span(&interface.path, interface.line_start, interface.line_end);
+    methods.extend(go_interface_methods(&body));
+    for embedded in supertypes_from_source("go", "interface", &body) {
+        let name = embedded.0;
+        if name == "error" {
+            methods.insert("Error".to_string());
+            continue;
+        }
+        let candidates: Vec<SymbolRecord> =
+            symbols::find_symbols_by_name(conn, repo, ref_name, &name, None)?
+                .into_iter()
+                .filter(|candidate| {
+                    candidate.language == "go" && candidate.kind == SymbolKind::Interface
+                })
+                .collect();
+        let package = parent_dir(&interface.path);
+        let chosen = candidates
+            .iter()
+            .find(|candidate| parent_dir(&candidate.path) == package)
+            .or_else(|| candidates.first());
+        match chosen {
+            Some(inner) => go_method_set(
+                conn, repo, ref_name, inner, sources, visited, methods, unresolved,
+            )?,
+            None => {
+                if !unresolved.contains(&name) {
+                    unresolved.push(name);
+                }
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Method names declared in a Go interface body: `Name(args) results`. An
+/// inline `interface{ Close() error; Flush() error }` declares them on its
+/// first line.
+pub(crate) fn go_interface_methods(body: &[String]) -> Vec<String> {
+    let inline = body
+        .first()
+        .and_then(|line| line.split_once('{'))
+        .map(|(_, rest)| rest);
+    inline
+        .into_iter()
+        .chain(body.iter().skip(1).map(String::as_str))
+        .flat_map(|line| line.split("//").next().unwrap_or("").split(';'))
+        .filter_map(|member| {
+            let (name, _) = member.trim().split_once('(')?;
+            let valid = !name.is_empty()
+                && name.chars().all(|ch| ch.is_alphanumeric() || ch == '_')
+                && name.chars().next().is_some_and(char::is_alphabetic);
+            valid.then(|| name.to_string())
+        })
+        .collect()
+}
+
+/// Go types, per package directory, whose methods include all of `required`.
+fn go_implementations(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    required: &[String],
+) -> Result<Vec<Implementation>, StateError> {
+    let mut method_sets: HashMap<(String, String), HashSet<String>> = HashMap::new();
+    let mut types: BTreeMap<(String, String), SymbolRecord> = BTreeMap::new();
+    symbols::for_each_symbol_for_ref(conn, repo, ref_name, |symbol| {
+        if symbol.language != "go" {
+            return Ok(());
+        }
+        let package = parent_dir(&symbol.path).to_string();
+        match symbol.kind {
+            SymbolKind::Method => {
+                if let Some((receiver, _)) = symbol.qualified_name.rsplit_once('.') {
+                    method_sets
+                        .entry((package, receiver.to_string()))
+                        .or_default()
+                        .insert(symbol.name);
+                }
+            }
+            SymbolKind::Struct | SymbolKind::Class | SymbolKind::Enum | SymbolKind::TypeAlias => {
+                types
+                    .entry((package, symbol.name.clone()))
+                    .or_insert(symbol);
+            }
+            _ => {}
+        }
+        Ok(())
+    })?;
+
+    Ok(types
+        .into_iter()
+        .filter(|(key, _)| {
+            method_sets
+                .get(key)
+                .is_some_and(|methods| required.iter().all(|name| methods.contains(name)))
+        })
+        .map(|(_, symbol)| implementation(symbol, "method_set"))
+        .collect())
+}
+
+/// Rust `impl Trait for Type` blocks and class headers naming the interface.
+fn declared_implementations(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    interface: &SymbolRecord,
+    sources: &mut SourceCache<'_>,
+) -> Result<Vec<Implementation>, StateError> {
+    let sites = ref_sites::find_reference_sites(
+        conn,
+        workspace,
+        repo,
+        ref_name,
+        &interface.qualified_name,
+        &[],
+    )?;
+    let mut file_types: HashMap<String, Vec<SymbolRecord>> = HashMap::new();
+    let mut found = Vec::new();
+    for site in &sites.references {
+        if site.kind == RefKind::Definition {
+            continue;
+        }
+        if interface.language == "rust" {
+            let Some((trait_name, type_name)) = rust_trait_impl(&site.text) else {
+                continue;
+            };
+            if trait_name != interface.name {
+                continue;
+            }
+            let declared = symbols::find_symbols_by_name(conn, repo, ref_name, type_name, None)?
+                .into_iter()
+                .filter(|symbol| symbol.language == "rust" && is_type(symbol.kind))
+                .min_by_key(|symbol| symbol.path != site.path);
+            found.push(match declared {
+                Some(symbol) => implementation(symbol, "impl"),
+                // A trait implemented for a type that is not indexed, e.g. `Vec<T>`.
+                None => Implementation {
+                    name: type_name.to_string(),
+                    qualified_name: type_name.to_string(),
+                    kind: "type".to_string(),
+                    language: "rust".to_string(),
+                    path: site.path.clone(),
+                    line: site.line,
+                    via: "impl".to_string(),
+                },
+            });
+            continue;
+        }
+
+        if !file_types.contains_key(&site.path) {
+            let in_file = symbols::list_symbols_in_file(conn, repo, ref_name, &site.path)?
+                .into_iter()
+                .filter(|symbol| is_type(symbol.kind))
+                .collect();
+            file_types.insert(site.path.clone(), in_file);
+        }
+        for symbol in &file_types[&site.path] {
+            let header_end = symbol.line_start + MAX_HEADER_LINES - 1;
+            if site.line < symbol.line_start || site.line > header_end {
+                continue;
+            }
+            let header = sources.span(&symbol.path, symbol.line_start, header_end);
+            let relation = supertypes_from_source(&symbol.language, symbol.kind.as_str(), &header)
+                .into_iter()
+                .find(|(name, _)| *name == interface.name)
+                .map(|(_, relation)| relation);
+            if let Some(relation) = relation
+                && relation != Relation::Embeds
+            {
+                found.push(implementation(symbol.clone(), relation.as_str()));
+            }
+        }
+    }
+    Ok(found)
+}
+
+fn is_type(kind: SymbolKind) -> bool {
+    matches!(
+        kind,
+        SymbolKind::Struct | SymbolKind::Class | SymbolKind::Enum | SymbolKind::TypeAlias
+    )
+}
+
+fn implementation(symbol: SymbolRecord, via: &str) -> Implementation {
+    Implementation {
+        name: symbol.name,
+        qualified_name: symbol.qualified_name,
+        kind: symbol.kind.as_str().to_string(),
+        language: symbol.language,
+        path: symbol.path,
+        line: symbol.line_start,
+        via: via.to_string(),
+    }
+}
+
+/// Go packages are directories.
+fn parent_dir(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+struct SourceCache<'a> {
+    root: &'a Path,
+    files: HashMap<String, Vec<String>>,
+}
+
+impl<'a> SourceCache<'a> {
+    fn new(root: &'a Path) -> Self {
+        Self {
+            root,
+            files: HashMap::new(),
+        }
+    }
+
+    /// One-based lines `start..=end` of `path`, clamped to the file; empty
+    /// when the file cannot be read.
+    fn span(&mut self, path: &str, start: u32, end: u32) -> Vec<String> {
+        let lines = self.files.entry(path.to_string()).or_insert_with(|| {
+            std::fs::read_to_string(self.root.join(path))
+                .map(|content| content.lines().map(str::to_string).collect())
+                .unwrap_or_default()
+        });
+        if start == 0 {
+            return Vec::new();
+        }
+        let first = (start as usize - 1).min(lines.len());
+        let last = (end.max(start) as usize).min(lines.len());
+        lines[first..last].to_vec()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_state::manifest::{self, ManifestEntry};
+    use cruxe_state::{db, schema};
+
+    fn symbol(
+        language: &str,
+        path: &str,
+        name: &str,
+        qualified_name: &str,
+        kind: SymbolKind,
+        lines: (u32, u32),
+    ) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: language.to_string(),
+            symbol_id: format!("sym::{path}::{qualified_name}"),
+            symbol_stable_id: format!("stable::{path}::{qualified_name}"),
+            name: name.to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn add_file(conn: &Connection, workspace: &Path, path: &str, language: &str, content: &str) {
+        let file = workspace.join(path);
+        std::fs::create_dir_all(file.parent().unwrap()).unwrap();
+        std::fs::write(file, content).unwrap();
+        manifest::upsert_manifest(
+            conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some(language.to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn go_types_satisfy_an_interface_through_their_method_set() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path();
+        add_file(
+            &conn,
+            workspace,
+            "store/store.go",
+            "go",
+            "type Closer interface {\n\tClose() error\n}\n\ntype Store interface {\n\tCloser\n\tGet(key string) ([]byte, error) // by key\n\tPut(key string, value []byte) error\n}\n",
+        );
+        for record in [
+            symbol(
+                "go",
+                "store/store.go",
+                "Closer",
+                "Closer",
+                SymbolKind::Interface,
+                (1, 3),
+            ),
+            symbol(
+                "go",
+                "store/store.go",
+                "Store",
+                "Store",
+                SymbolKind::Interface,
+                (5, 9),
+            ),
+            symbol(
+                "go",
+                "store/mem.go",
+                "Mem",
+                "Mem",
+                SymbolKind::Struct,
+                (3, 5),
+            ),
+            symbol(
+                "go",
+                "store/mem.go",
+                "Get",
+                "Mem.Get",
+                SymbolKind::Method,
+                (7, 9),
+            ),
+            symbol(
+                "go",
+                "store/mem.go",
+                "Put",
+                "Mem.Put",
+                SymbolKind::Method,
+                (11, 13),
+            ),
+            symbol(
+                "go",
+                "store/mem.go",
+                "Close",
+                "Mem.Close",
+                SymbolKind::Method,
+                (15, 17),
+            ),
+            // Missing Close.
+            symbol(
+                "go",
+                "store/disk.go",
+                "Disk",
+                "Disk",
+                SymbolKind::Struct,
+                (3, 5),
+            ),
+            symbol(
+                "go",
+                "store/disk.go",
+                "Get",
+                "Disk.Get",
+                SymbolKind::Method,
+                (7, 9),
+            ),
+            symbol(
+                "go",
+                "store/disk.go",
+                "Put",
+                "Disk.Put",
+                SymbolKind::Method,
+                (11, 13),
+            ),
+            // Same type name and methods, other package.
+            symbol(
+                "go",
+                "cache/mem.go",
+                "Mem",
+                "Mem",
+                SymbolKind::Struct,
+                (3, 5),
+            ),
+            symbol(
+                "go",
+                "cache/mem.go",
+                "Get",
+                "Mem.Get",
+                SymbolKind::Method,
+                (7, 9),
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let report = find_implementations(&conn, workspace, "repo", "main", "Store", None).unwrap();
+        assert_eq!(report.methods, ["Close", "Get", "Put"]);
+        assert!(report.unresolved.is_empty());
+        let found: Vec<(&str, &str, &str)> = report
+            .implementations
+            .iter()
+            .map(|found| (found.path.as_str(), found.name.as_str(), found.via.as_str()))
+            .collect();
+        assert_eq!(found, [("store/mem.go", "Mem", "method_set")]);
+
+        let err = find_implementations(&conn, workspace, "repo", "main", "Mem", None).unwrap_err();
+        assert!(matches!(err, ImplsError::NotAnInterface { .. }));
+    }
+
+    #[test]
+    fn rust_traits_are_implemented_by_impl_blocks() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path();
+        add_file(
+            &conn,
+            workspace,
+            "src/lib.rs",
+            "rust",
+            "pub trait Render {\n    fn render(&self) -> String;\n}\n\npub struct Page;\n\nimpl Render for Page {\n    fn render(&self) -> String { String::new() }\n}\n\nimpl<T: Render> Render for Vec<T> {\n    fn render(&self) -> String { String::new() }\n}\n\nimpl Page {\n    fn render_all(pages: &[Page]) {}\n}\n",
+        );
+        for record in [
+            symbol(
+                "rust",
+                "src/lib.rs",
+                "Render",
+                "Render",
+                SymbolKind::Trait,
+                (1, 3),
+            ),
+            symbol(
+                "rust",
+                "src/lib.rs",
+                "Page",
+                "Page",
+                SymbolKind::Struct,
+                (5, 5),
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let report =
+            find_implementations(&conn, workspace, "repo", "main", "Render", None).unwrap();
+        let found: Vec<(&str, u32, &str)> = report
+            .implementations
+            .iter()
+            .map(|found| (found.name.as_str(), found.line, found.kind.as_str()))
+            .collect();
+        assert_eq!(found, [("Page", 5, "struct"), ("Vec", 11, "type")]);
+    }
+
+    #[test]
+    fn reads_method_names_from_an_interface_body() {
+        let body: Vec<String> = [
+            "type ReadCloser interface {",
+            "\tio.Reader",
+            "\t// Close releases the handle.",
+            "\tClose() error",
+            "\tSeek(offset int64, whence int) (int64, error)",
+            "}",
+        ]
+        .iter()
+        .map(|line| line.to_string())
+        .collect();
+        assert_eq!(go_interface_methods(&body), ["Close", "Seek"]);
+
+        let inline = [
+            "func Copy(dst interface{ Write(p []byte) (int, error); Flush() error }) {".to_string(),
+        ];
+        assert_eq!(go_interface_methods(&inline), ["Write", "Flush"]);
+    }
+}
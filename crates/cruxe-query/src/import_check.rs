@@ -0,0 +1,354 @@
+//! Whole-repository import checks behind `cruxe deps --check`: package
+//! import cycles and imports that cross a boundary forbidden under
+//! `[layers]`, each reported with the chain of imports responsible.
+
+use crate::deps::package_name;
+use crate::precommit::Layers;
+use crate::report::package_cycles;
+use cruxe_core::error::StateError;
+use cruxe_state::{edges, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet, HashMap, VecDeque};
+
+const FILE_SOURCE_PREFIX: &str = "file::";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, JsonSchema)]
+#[serde(rename_all = "kebab-case")]
+pub enum ImportCheck {
+    /// Packages that import each other, directly or through others.
+    ImportCycle,
+    /// An import from one layer into a layer it must not depend on.
+    LayerViolation,
+}
+
+impl ImportCheck {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::ImportCycle => "import-cycle",
+            Self::LayerViolation => "layer-violation",
+        }
+    }
+}
+
+/// One package-to-package step of a chain, located at an import statement
+/// behind it. `line` is 0 for edges indexed before import lines were kept.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ImportHop {
+    pub from: String,
+    pub to: String,
+    pub path: String,
+    pub line: u32,
+    /// File the import resolves to.
+    pub target_path: String,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ImportViolation {
+    pub check: ImportCheck,
+    pub message: String,
+    /// Packages of the cycle, sorted; empty for layer violations.
+    pub packages: Vec<String>,
+    /// For a cycle, the shortest chain from its first package back to
+    /// itself; for a layer violation, the offending import.
+    pub chain: Vec<ImportHop>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ImportCheckReport {
+    pub repo: String,
+    pub ref_name: String,
+    /// Indexed packages with at least one resolved import in or out.
+    pub packages: usize,
+    pub violations: Vec<ImportViolation>,
+}
+
+impl ImportCheckReport {
+    pub fn count(&self, check: ImportCheck) -> usize {
+        self.violations
+            .iter()
+            .filter(|violation| violation.check == check)
+            .count()
+    }
+}
+
+/// Check every resolved import of `ref_name` for package cycles and, when
+/// `layers` declares any, forbidden layer crossings.
+pub fn check_imports(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    layers: &Layers,
+) -> Result<ImportCheckReport, StateError> {
+    let mut imports: Vec<(String, String, u32)> = Vec::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        if edge.edge_type != "imports" {
+            return Ok(());
+        }
+        if let (Some(source), Some(target)) = (
+            edge.from_symbol_id.strip_prefix(FILE_SOURCE_PREFIX),
+            edge.to_symbol_id,
+        ) {
+            imports.push((source.to_string(), target, edge.source_line));
+        }
+        Ok(())
+    })?;
+    let targets: BTreeSet<&str> = imports
+        .iter()
+        .map(|(_, target, _)| target.as_str())
+        .collect();
+    let mut target_paths: HashMap<String, String> = HashMap::new();
+    if !targets.is_empty() {
+        symbols::for_each_symbol_for_ref(conn, repo, ref_name, |symbol| {
+            if targets.contains(symbol.symbol_stable_id.as_str()) {
+                target_paths
+                    .entry(symbol.symbol_stable_id)
+                    .or_insert(symbol.path);
+            }
+            Ok(())
+        })?;
+    }
+
+    let mut packages = BTreeSet::new();
+    let mut violations = Vec::new();
+    // The first import, by path and line, stands for each package edge.
+    let mut representative: BTreeMap<(String, String), ImportHop> = BTreeMap::new();
+    for (source, target, line) in &imports {
+        let Some(target_path) = target_paths.get(target) else {
+            continue;
+        };
+        let hop = ImportHop {
+            from: package_name(source, 0),
+            to: package_name(target_path, 0),
+            path: source.clone(),
+            line: *line,
+            target_path: target_path.clone(),
+        };
+        packages.insert(hop.from.clone());
+        packages.insert(hop.to.clone());
+        if let (Some(from), Some(to)) = (layers.layer_of(source), layers.layer_of(target_path))
+            && layers.forbids(from, to)
+        {
+            violations.push(ImportViolation {
+                check: ImportCheck::LayerViolation,
+                message: format!("layer `{from}` must not import layer `{to}`"),
+                packages: Vec::new(),
+                chain: vec![hop.clone()],
+            });
+        }
+        if hop.from == hop.to {
+            continue;
+        }
+        let key = (hop.from.clone(), hop.to.clone());
+        match representative.get(&key) {
+            Some(known) if (&known.path, known.line) <= (&hop.path, hop.line) => {}
+            _ => {
+                representative.insert(key, hop);
+            }
+        }
+    }
+
+    let dependencies: BTreeMap<(String, String), usize> =
+        representative.keys().map(|key| (key.clone(), 1)).collect();
+    for cycle in package_cycles(&dependencies) {
+        let chain = shortest_cycle(&cycle, &representative);
+        let route: Vec<&str> = chain
+            .iter()
+            .map(|hop| hop.from.as_str())
+            .chain(chain.first().map(|hop| hop.from.as_str()))
+            .collect();
+        violations.push(ImportViolation {
+            check: ImportCheck::ImportCycle,
+            message: format!("import cycle {}", route.join(" -> ")),
+            packages: cycle,
+            chain,
+        });
+    }
+
+    violations.sort_by(|a, b| {
+        let location = |violation: &ImportViolation| {
+            violation
+                .chain
+                .first()
+                .map(|hop| (hop.path.clone(), hop.line))
+                .unwrap_or_default()
+        };
+        (location(a), a.check.as_str()).cmp(&(location(b), b.check.as_str()))
+    });
+    Ok(ImportCheckReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        packages: packages.len(),
+        violations,
+    })
+}
+
+/// Breadth-first search inside the cycle's packages from its first member
+/// back to itself, so the chain is one a reader can follow import by import.
+fn shortest_cycle(
+    members: &[String],
+    representative: &BTreeMap<(String, String), ImportHop>,
+) -> Vec<ImportHop> {
+    let Some(start) = members.first() else {
+        return Vec::new();
+    };
+    let inside: BTreeSet<&str> = members.iter().map(String::as_str).collect();
+    let mut adjacency: BTreeMap<&str, Vec<&str>> = BTreeMap::new();
+    for (from, to) in representative.keys() {
+        if inside.contains(from.as_str()) && inside.contains(to.as_str()) {
+            adjacency.entry(from).or_default().push(to);
+        }
+    }
+
+    let mut previous: HashMap<&str, &str> = HashMap::new();
+    let mut queue = VecDeque::from([start.as_str()]);
+    while let Some(package) = queue.pop_front() {
+        for &next in adjacency.get(package).into_iter().flatten() {
+            if next == start {
+                let mut route = vec![package];
+                while let Some(&before) = previous.get(route[route.len() - 1]) {
+                    route.push(before);
+                }
+                route.reverse();
+                route.push(start);
+                return route
+                    .windows(2)
+                    .map(|pair| representative[&(pair[0].to_string(), pair[1].to_string())].clone())
+                    .collect();
+            }
+            if next != start && !previous.contains_key(next) {
+                previous.insert(next, package);
+                queue.push_back(next);
+            }
+        }
+    }
+    Vec::new()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::config::LayersConfig;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema};
+    use rusqlite::params;
+
+    fn setup() -> Connection {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for (stable, path) in [
+            ("handler", "pkg/handlers/user.go"),
+            ("service", "pkg/service/user.go"),
+            ("db", "pkg/database/db.go"),
+            ("model", "pkg/model/user.go"),
+        ] {
+            symbols::insert_symbol(
+                &conn,
+                &SymbolRecord {
+                    repo: "repo".to_string(),
+                    r#ref: "main".to_string(),
+                    commit: None,
+                    path: path.to_string(),
+                    language: "go".to_string(),
+                    symbol_id: format!("sym::{stable}"),
+                    symbol_stable_id: stable.to_string(),
+                    name: stable.to_string(),
+                    qualified_name: stable.to_string(),
+                    kind: SymbolKind::Function,
+                    signature: None,
+                    line_start: 1,
+                    line_end: 5,
+                    parent_symbol_id: None,
+                    visibility: None,
+                    content: None,
+                },
+            )
+            .unwrap();
+        }
+        for (from, to, line) in [
+            ("file::pkg/handlers/user.go", "service", 4),
+            ("file::pkg/handlers/user.go", "db", 5),
+            ("file::pkg/service/user.go", "db", 3),
+            ("file::pkg/database/db.go", "model", 3),
+            ("file::pkg/model/user.go", "service", 6),
+        ] {
+            conn.execute(
+                "INSERT INTO symbol_edges (repo, \"ref\", from_symbol_id, to_symbol_id, edge_type, confidence, source_file, source_line)
+                 VALUES ('repo', 'main', ?1, ?2, 'imports', 'static', ?3, ?4)",
+                params![from, to, from.trim_start_matches(FILE_SOURCE_PREFIX), line],
+            )
+            .unwrap();
+        }
+        conn
+    }
+
+    fn layers() -> Layers {
+        let mut config = LayersConfig::default();
+        config
+            .paths
+            .insert("handlers".to_string(), vec!["pkg/handlers/**".to_string()]);
+        config
+            .paths
+            .insert("database".to_string(), vec!["pkg/database/**".to_string()]);
+        config
+            .forbid
+            .insert("handlers".to_string(), vec!["database".to_string()]);
+        Layers::from_config(&config).unwrap()
+    }
+
+    #[test]
+    fn reports_cycles_and_layer_violations_with_their_imports() {
+        let conn = setup();
+        let report = check_imports(&conn, "repo", "main", &layers()).unwrap();
+        assert_eq!(report.packages, 4);
+        assert_eq!(report.count(ImportCheck::ImportCycle), 1);
+        assert_eq!(report.count(ImportCheck::LayerViolation), 1);
+
+        let cycle = report
+            .violations
+            .iter()
+            .find(|violation| violation.check == ImportCheck::ImportCycle)
+            .unwrap();
+        assert_eq!(cycle.packages, ["pkg/database", "pkg/model", "pkg/service"]);
+        assert_eq!(
+            cycle.message,
+            "import cycle pkg/database -> pkg/model -> pkg/service -> pkg/database"
+        );
+        let locations: Vec<(&str, u32)> = cycle
+            .chain
+            .iter()
+            .map(|hop| (hop.path.as_str(), hop.line))
+            .collect();
+        assert_eq!(
+            locations,
+            [
+                ("pkg/database/db.go", 3),
+                ("pkg/model/user.go", 6),
+                ("pkg/service/user.go", 3),
+            ]
+        );
+
+        let layer = report
+            .violations
+            .iter()
+            .find(|violation| violation.check == ImportCheck::LayerViolation)
+            .unwrap();
+        assert_eq!(
+            layer.message,
+            "layer `handlers` must not import layer `database`"
+        );
+        assert_eq!(layer.chain[0].path, "pkg/handlers/user.go");
+        assert_eq!(layer.chain[0].line, 5);
+        assert_eq!(layer.chain[0].target_path, "pkg/database/db.go");
+    }
+
+    #[test]
+    fn no_layers_means_only_cycles() {
+        let conn = setup();
+        let report = check_imports(&conn, "repo", "main", &Layers::default()).unwrap();
+        assert_eq!(report.count(ImportCheck::LayerViolation), 0);
+        assert_eq!(report.count(ImportCheck::ImportCycle), 1);
+    }
+}
@@ -1,30 +1,81 @@
 pub mod adaptive_plan;
+pub mod aliases;
+pub mod api_surface;
+pub mod arch_rules;
+pub mod ask;
 pub mod call_graph;
+pub mod changed;
+pub mod codeowners;
+pub mod concurrency;
 pub mod confidence;
 pub mod context;
 pub mod context_pack;
+pub mod deadcode;
+pub mod deps;
+pub mod describe;
 pub mod detail;
 pub mod diff_context;
+pub mod doc_coverage;
+pub mod duplicates;
+pub mod error_paths;
+pub mod exits;
+pub mod explain_plan;
 pub mod explain_ranking;
+pub mod federation;
+pub mod findings;
+pub mod gate;
 pub mod find_references;
 pub mod followup;
 pub mod freshness;
+pub mod fuzzy;
+pub mod github;
+pub mod goto_definition;
+pub mod graph_export;
+pub mod graph_view;
+pub mod grep;
 pub mod hierarchy;
+pub mod hotspots;
 pub mod hybrid;
+pub mod impact;
+pub mod impls;
+pub mod import_check;
 pub mod intent;
+pub mod locals;
 pub mod locate;
 pub mod overlay_merge;
 pub mod planner;
 pub mod policy;
+pub mod precommit;
+pub mod projects;
+pub mod query_expr;
 pub mod ranking;
+pub mod ref_sites;
 pub mod related;
+pub mod relevant;
+pub mod rename;
+pub mod repo_map;
+pub mod report;
 pub mod rerank;
 pub mod retrieval_eval;
+pub mod routes;
 mod scoring;
 pub mod search;
 pub mod semantic_advisor;
+pub mod shards;
+pub mod signature_search;
+pub mod snippet;
+pub mod stats;
+pub mod summarize;
 pub mod symbol_compare;
+pub mod symbol_context;
+pub mod symbol_diff;
+pub mod symbol_ids;
+pub mod tags;
+pub mod templates;
+pub mod test_map;
+pub mod todos;
 pub mod tombstone;
+pub mod where_used;
 
 #[cfg(test)]
 mod vcs_e2e;
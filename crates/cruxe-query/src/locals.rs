@@ -0,0 +1,150 @@
+//! Parameters and local variables recorded at index time, with every
+//! occurrence their scope binds: which one an occurrence in a function body
+//! refers to, and lookups by `function.name`.
+
+use cruxe_core::error::StateError;
+use cruxe_core::types::LocalRecord;
+use cruxe_state::locals;
+use rusqlite::Connection;
+use std::collections::HashSet;
+
+/// `HandleRequest.claims`: the local's name qualified by its function.
+pub fn qualified_name(local: &LocalRecord) -> String {
+    match &local.symbol {
+        Some(function) => format!("{function}.{}", local.name),
+        None => local.name.clone(),
+    }
+}
+
+/// The local the identifier starting at `line`:`column` (1-based, in
+/// characters) refers to; `None` when it is not a local.
+pub fn local_at(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    line: u32,
+    column: u32,
+) -> Result<Option<LocalRecord>, StateError> {
+    Ok(locals::list_for_file(conn, repo, ref_name, path)?
+        .into_iter()
+        .find(|local| {
+            local
+                .uses
+                .iter()
+                .any(|use_| use_.line == line && use_.column == column)
+        }))
+}
+
+/// Locals `spec` names as `function.name` (or `function::name`), where
+/// `function` is the function's name or the end of its qualified name.
+/// A bare name is left to the symbol index and matches nothing here.
+pub fn find(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    spec: &str,
+) -> Result<Vec<LocalRecord>, StateError> {
+    let Some((function, name)) = spec.rsplit_once("::").or_else(|| spec.rsplit_once('.')) else {
+        return Ok(Vec::new());
+    };
+    let mut found = locals::find_by_name(conn, repo, ref_name, name)?;
+    found.retain(|local| {
+        local.symbol.as_deref().is_some_and(|symbol| {
+            symbol == function
+                || symbol.ends_with(&format!(".{function}"))
+                || symbol.ends_with(&format!("::{function}"))
+        })
+    });
+    Ok(found)
+}
+
+/// (line, column) of every occurrence of a local in `path`.
+pub fn bound_positions(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<HashSet<(u32, u32)>, StateError> {
+    Ok(locals::list_for_file(conn, repo, ref_name, path)?
+        .iter()
+        .flat_map(|local| local.uses.iter().map(|use_| (use_.line, use_.column)))
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::LocalUse;
+    use cruxe_state::{db, schema};
+
+    fn local(name: &str, symbol: &str, line: u32) -> LocalRecord {
+        LocalRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: "api/handler.go".to_string(),
+            name: name.to_string(),
+            kind: "local".to_string(),
+            line,
+            column: 2,
+            symbol_id: Some(format!("stable::{symbol}")),
+            symbol: Some(symbol.to_string()),
+            uses: vec![
+                LocalUse {
+                    line,
+                    column: 2,
+                    write: true,
+                },
+                LocalUse {
+                    line: line + 1,
+                    column: 7,
+                    write: false,
+                },
+            ],
+        }
+    }
+
+    #[test]
+    fn finds_locals_by_function_and_position() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        locals::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "api/handler.go",
+            &[
+                local("claims", "api.Server.HandleRequest", 4),
+                local("claims", "api.Refresh", 20),
+            ],
+        )
+        .unwrap();
+
+        let found = find(&conn, "repo", "main", "HandleRequest.claims").unwrap();
+        assert_eq!(found.len(), 1);
+        assert_eq!(qualified_name(&found[0]), "api.Server.HandleRequest.claims");
+        assert_eq!(
+            find(&conn, "repo", "main", "Server.HandleRequest.claims")
+                .unwrap()
+                .len(),
+            1
+        );
+        assert!(find(&conn, "repo", "main", "claims").unwrap().is_empty());
+        assert!(find(&conn, "repo", "main", "Handle.claims").unwrap().is_empty());
+
+        let at = local_at(&conn, "repo", "main", "api/handler.go", 21, 7).unwrap();
+        assert_eq!(at.unwrap().symbol.as_deref(), Some("api.Refresh"));
+        assert!(
+            local_at(&conn, "repo", "main", "api/handler.go", 21, 8)
+                .unwrap()
+                .is_none()
+        );
+        assert_eq!(
+            bound_positions(&conn, "repo", "main", "api/handler.go")
+                .unwrap()
+                .len(),
+            4
+        );
+    }
+}
@@ -163,6 +163,7 @@ mod tests {
             kind: None,
             name: None,
             qualified_name: None,
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
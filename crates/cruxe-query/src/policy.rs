@@ -765,6 +765,7 @@ mod tests {
             kind: Some("function".to_string()),
             name: Some("demo".to_string()),
             qualified_name: Some("demo".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -0,0 +1,183 @@
+//! Projects of a monorepo for `cruxe projects`: the project roots recorded
+//! at index time by [`cruxe_indexer::project_discovery`], each with the
+//! indexed files and symbols it owns. A file is owned by the project with
+//! the deepest directory holding it; files outside every project are
+//! counted separately.
+
+use cruxe_core::error::StateError;
+use cruxe_state::workspace_projects::{self, WorkspaceProject};
+use cruxe_state::{manifest, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ProjectSummary {
+    #[serde(flatten)]
+    pub project: WorkspaceProject,
+    pub files: usize,
+    pub symbols: u64,
+    /// Files per language.
+    pub languages: BTreeMap<String, usize>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ProjectReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub total: usize,
+    /// Ordered by directory.
+    pub projects: Vec<ProjectSummary>,
+    /// Indexed files that belong to no project.
+    pub unowned_files: usize,
+}
+
+/// The projects of `ref_name` with the files and symbols each owns.
+pub fn list_projects(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<ProjectReport, StateError> {
+    let projects = workspace_projects::list_for_ref(conn, repo, ref_name)?;
+    let mut summaries: Vec<ProjectSummary> = projects
+        .iter()
+        .map(|project| ProjectSummary {
+            project: project.clone(),
+            files: 0,
+            symbols: 0,
+            languages: BTreeMap::new(),
+        })
+        .collect();
+    let index_of: HashMap<&str, usize> = projects
+        .iter()
+        .enumerate()
+        .map(|(index, project)| (project.dir.as_str(), index))
+        .collect();
+    let summary_of = |path: &str| {
+        workspace_projects::owner(&projects, path).map(|project| index_of[project.dir.as_str()])
+    };
+
+    let mut unowned_files = 0;
+    for entry in manifest::get_all_entries(conn, repo, ref_name)? {
+        let Some(index) = summary_of(&entry.path) else {
+            unowned_files += 1;
+            continue;
+        };
+        let summary = &mut summaries[index];
+        summary.files += 1;
+        if let Some(language) = entry.language {
+            *summary.languages.entry(language).or_default() += 1;
+        }
+    }
+    for (path, count) in symbols::symbol_counts_by_path(conn, repo, ref_name)? {
+        if let Some(index) = summary_of(&path) {
+            summaries[index].symbols += count;
+        }
+    }
+
+    Ok(ProjectReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        total: summaries.len(),
+        projects: summaries,
+        unowned_files,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{SymbolKind, SymbolRecord};
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    fn file(path: &str, language: &str) -> ManifestEntry {
+        ManifestEntry {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            content_hash: "hash".to_string(),
+            size_bytes: 10,
+            mtime_ns: None,
+            language: Some(language.to_string()),
+            indexed_at: "2026-01-01T00:00:00Z".to_string(),
+        }
+    }
+
+    fn symbol(path: &str, name: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{path}::{name}"),
+            symbol_stable_id: format!("stable::{path}::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: 1,
+            line_end: 3,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn files_and_symbols_count_toward_their_deepest_project() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let project = |name: &str, kind: &str, dir: &str| WorkspaceProject {
+            name: name.to_string(),
+            kind: kind.to_string(),
+            dir: dir.to_string(),
+        };
+        workspace_projects::replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                project("billing", "go", "services/billing"),
+                project("@acme/web", "node", "web"),
+            ],
+        )
+        .unwrap();
+        for entry in [
+            file("services/billing/invoice.go", "go"),
+            file("services/billing/charge.go", "go"),
+            file("web/src/app.ts", "typescript"),
+            file("web/src/legacy.js", "javascript"),
+            file("scripts/release.py", "python"),
+        ] {
+            manifest::upsert_manifest(&conn, &entry).unwrap();
+        }
+        for record in [
+            symbol("services/billing/invoice.go", "Invoice"),
+            symbol("services/billing/invoice.go", "Total"),
+            symbol("services/billing/charge.go", "Charge"),
+            symbol("scripts/release.py", "main"),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let report = list_projects(&conn, "repo", "main").unwrap();
+        let counts: Vec<(&str, usize, u64)> = report
+            .projects
+            .iter()
+            .map(|summary| {
+                (
+                    summary.project.name.as_str(),
+                    summary.files,
+                    summary.symbols,
+                )
+            })
+            .collect();
+        assert_eq!(counts, [("billing", 2, 3), ("@acme/web", 2, 0)]);
+        assert_eq!(report.projects[1].languages.len(), 2);
+        assert_eq!((report.total, report.unowned_files), (2, 1));
+    }
+}
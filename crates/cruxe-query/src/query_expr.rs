@@ -0,0 +1,1002 @@
+//! Boolean query expressions over the symbol graph, for `cruxe query symbols`
+//! and `cruxe query edges`:
+//!
+//! ```text
+//! kind:func AND package:handlers AND fanin > 5 AND NOT test
+//! owner:@platform-team AND fanin > 20
+//! (from.pkg:api OR from.pkg:web) to.pkg:db -kind:imports
+//! kind:func -submodule -generated
+//! kind:func exported fanin = 0 age >= 730
+//! ```
+//!
+//! `field:value` matches a case-insensitive glob, `field OP number` compares
+//! a count (`>`, `>=`, `<`, `<=`, `=`, `!=`), and a bare flag such as `test`
+//! tests a property. Any other bare word is a substring of the qualified
+//! name. Terms combine with `AND` (also implied between adjacent terms), `OR`
+//! and `NOT` (or a `-` prefix), with parentheses for grouping; `NOT` binds
+//! tightest, then `AND`, then `OR`. Values with spaces can be double-quoted.
+//!
+//! `author` and `age` (days since the symbol last changed) come from `git
+//! blame` and match only symbols of refs indexed with `[index] blame`.
+
+use crate::call_graph::CallGraphSymbol;
+use crate::codeowners::CodeOwners;
+use crate::deadcode;
+use crate::graph_export::{GraphEdge, GraphNode, GraphSnapshot};
+use crate::impact::{is_test_path, is_test_symbol};
+use cruxe_state::submodules::{self, Submodule};
+use cruxe_state::symbol_blame::SymbolBlame;
+use globset::{GlobBuilder, GlobMatcher};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+
+/// Fields a query may reference, so typos fail at parse time.
+#[derive(Debug, Clone, Copy)]
+pub struct QueryFields {
+    pub text: &'static [&'static str],
+    pub numeric: &'static [&'static str],
+    pub flags: &'static [&'static str],
+}
+
+pub const SYMBOL_FIELDS: QueryFields = QueryFields {
+    text: &[
+        "kind",
+        "name",
+        "package",
+        "pkg",
+        "path",
+        "lang",
+        "owner",
+        "submodule",
+        "author",
+    ],
+    numeric: &["fanin", "fanout", "degree", "loc", "line", "age"],
+    flags: &["test", "unowned", "submodule", "generated", "exported"],
+};
+
+pub const EDGE_FIELDS: QueryFields = QueryFields {
+    text: &[
+        "kind",
+        "confidence",
+        "path",
+        "from",
+        "to",
+        "from.kind",
+        "to.kind",
+        "from.pkg",
+        "to.pkg",
+        "from.owner",
+        "to.owner",
+        "from.submodule",
+        "to.submodule",
+    ],
+    numeric: &["line"],
+    flags: &["cross"],
+};
+
+/// A parsed query expression.
+#[derive(Debug, Clone)]
+pub enum QueryExpr {
+    /// The empty expression, which matches everything.
+    All,
+    Text {
+        field: String,
+        glob: GlobMatcher,
+    },
+    Compare {
+        field: String,
+        op: CompareOp,
+        value: i64,
+    },
+    Flag(String),
+    Name(String),
+    Not(Box<QueryExpr>),
+    And(Vec<QueryExpr>),
+    Or(Vec<QueryExpr>),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum CompareOp {
+    Gt,
+    Ge,
+    Lt,
+    Le,
+    Eq,
+    Ne,
+}
+
+impl CompareOp {
+    fn parse(op: &str) -> Option<Self> {
+        match op {
+            ">" => Some(Self::Gt),
+            ">=" => Some(Self::Ge),
+            "<" => Some(Self::Lt),
+            "<=" => Some(Self::Le),
+            "=" | "==" => Some(Self::Eq),
+            "!=" => Some(Self::Ne),
+            _ => None,
+        }
+    }
+
+    fn holds(self, left: i64, right: i64) -> bool {
+        match self {
+            Self::Gt => left > right,
+            Self::Ge => left >= right,
+            Self::Lt => left < right,
+            Self::Le => left <= right,
+            Self::Eq => left == right,
+            Self::Ne => left != right,
+        }
+    }
+}
+
+/// Something a query can be evaluated against.
+pub trait QuerySubject {
+    /// Every value of a text field; the term matches when any does.
+    fn text(&self, field: &str) -> Vec<&str>;
+    fn number(&self, field: &str) -> Option<i64>;
+    fn flag(&self, name: &str) -> bool;
+    fn qualified_name(&self) -> &str;
+}
+
+impl QueryExpr {
+    pub fn parse(expr: &str, fields: &QueryFields) -> Result<Self, String> {
+        let tokens = tokenize(expr)?;
+        if tokens.is_empty() {
+            return Ok(Self::All);
+        }
+        let mut parser = Parser {
+            tokens,
+            pos: 0,
+            fields,
+        };
+        let parsed = parser.or()?;
+        match parser.peek() {
+            None => Ok(parsed),
+            Some(Token::Close) => Err("unbalanced `)`".to_string()),
+            Some(token) => Err(format!("unexpected {}", token.describe())),
+        }
+    }
+
+    /// Whether any term reads `field` (a text or numeric field or a flag).
+    pub fn uses(&self, field: &str) -> bool {
+        match self {
+            Self::All | Self::Name(_) => false,
+            Self::Text { field: used, .. } | Self::Compare { field: used, .. } => used == field,
+            Self::Flag(name) => name == field,
+            Self::Not(inner) => inner.uses(field),
+            Self::And(terms) | Self::Or(terms) => terms.iter().any(|term| term.uses(field)),
+        }
+    }
+
+    pub fn matches(&self, subject: &dyn QuerySubject) -> bool {
+        match self {
+            Self::All => true,
+            Self::Text { field, glob } => {
+                subject.text(field).iter().any(|value| glob.is_match(value))
+            }
+            Self::Compare { field, op, value } => subject
+                .number(field)
+                .is_some_and(|actual| op.holds(actual, *value)),
+            Self::Flag(name) => subject.flag(name),
+            Self::Name(needle) => subject.qualified_name().to_lowercase().contains(needle),
+            Self::Not(inner) => !inner.matches(subject),
+            Self::And(terms) => terms.iter().all(|term| term.matches(subject)),
+            Self::Or(terms) => terms.iter().any(|term| term.matches(subject)),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Token {
+    Open,
+    Close,
+    Op(String),
+    Word(String),
+    /// A double-quoted string, never read as a keyword.
+    Quoted(String),
+}
+
+impl Token {
+    fn describe(&self) -> String {
+        match self {
+            Self::Open => "`(`".to_string(),
+            Self::Close => "`)`".to_string(),
+            Self::Op(op) => format!("`{op}`"),
+            Self::Word(word) => format!("`{word}`"),
+            Self::Quoted(text) => format!("\"{text}\""),
+        }
+    }
+
+    fn is_keyword(&self, keyword: &str) -> bool {
+        matches!(self, Self::Word(word) if word.eq_ignore_ascii_case(keyword))
+    }
+}
+
+fn tokenize(expr: &str) -> Result<Vec<Token>, String> {
+    let mut tokens = Vec::new();
+    let mut chars = expr.chars().peekable();
+    while let Some(&c) = chars.peek() {
+        match c {
+            c if c.is_whitespace() => {
+                chars.next();
+            }
+            '(' => {
+                chars.next();
+                tokens.push(Token::Open);
+            }
+            ')' => {
+                chars.next();
+                tokens.push(Token::Close);
+            }
+            '"' => {
+                chars.next();
+                let mut text = String::new();
+                loop {
+                    match chars.next() {
+                        Some('"') => break,
+                        Some(c) => text.push(c),
+                        None => return Err("unterminated `\"`".to_string()),
+                    }
+                }
+                tokens.push(Token::Quoted(text));
+            }
+            '<' | '>' | '=' | '!' => {
+                chars.next();
+                let mut op = c.to_string();
+                if chars.peek() == Some(&'=') {
+                    chars.next();
+                    op.push('=');
+                }
+                if CompareOp::parse(&op).is_none() {
+                    return Err(format!("unknown operator `{op}`"));
+                }
+                tokens.push(Token::Op(op));
+            }
+            _ => {
+                let mut word = String::new();
+                while let Some(&c) = chars.peek() {
+                    if c.is_whitespace() || matches!(c, '(' | ')' | '"' | '<' | '>' | '=' | '!') {
+                        break;
+                    }
+                    word.push(c);
+                    chars.next();
+                }
+                // `kind:"two words"` keeps the quoted value with its field.
+                if word.ends_with(':') && chars.peek() == Some(&'"') {
+                    chars.next();
+                    loop {
+                        match chars.next() {
+                            Some('"') => break,
+                            Some(c) => word.push(c),
+                            None => return Err("unterminated `\"`".to_string()),
+                        }
+                    }
+                }
+                tokens.push(Token::Word(word));
+            }
+        }
+    }
+    Ok(tokens)
+}
+
+struct Parser<'a> {
+    tokens: Vec<Token>,
+    pos: usize,
+    fields: &'a QueryFields,
+}
+
+impl Parser<'_> {
+    fn peek(&self) -> Option<&Token> {
+        self.tokens.get(self.pos)
+    }
+
+    fn next(&mut self) -> Option<Token> {
+        let token = self.tokens.get(self.pos).cloned();
+        self.pos += 1;
+        token
+    }
+
+    fn or(&mut self) -> Result<QueryExpr, String> {
+        let mut terms = vec![self.and()?];
+        while self.peek().is_some_and(|token| token.is_keyword("OR")) {
+            self.pos += 1;
+            terms.push(self.and()?);
+        }
+        Ok(if terms.len() == 1 {
+            terms.pop().unwrap_or(QueryExpr::All)
+        } else {
+            QueryExpr::Or(terms)
+        })
+    }
+
+    fn and(&mut self) -> Result<QueryExpr, String> {
+        let mut terms = vec![self.unary()?];
+        loop {
+            match self.peek() {
+                None | Some(Token::Close) => break,
+                Some(token) if token.is_keyword("OR") => break,
+                Some(token) if token.is_keyword("AND") => {
+                    self.pos += 1;
+                    terms.push(self.unary()?);
+                }
+                Some(_) => terms.push(self.unary()?),
+            }
+        }
+        Ok(if terms.len() == 1 {
+            terms.pop().unwrap_or(QueryExpr::All)
+        } else {
+            QueryExpr::And(terms)
+        })
+    }
+
+    fn unary(&mut self) -> Result<QueryExpr, String> {
+        match self.next() {
+            None => Err("expression ends where a term was expected".to_string()),
+            Some(Token::Open) => {
+                let inner = self.or()?;
+                match self.next() {
+                    Some(Token::Close) => Ok(inner),
+                    _ => Err("missing `)`".to_string()),
+                }
+            }
+            Some(token) if token.is_keyword("NOT") => Ok(QueryExpr::Not(Box::new(self.unary()?))),
+            Some(token @ (Token::Close | Token::Op(_))) => {
+                Err(format!("unexpected {}", token.describe()))
+            }
+            Some(token) if token.is_keyword("AND") || token.is_keyword("OR") => {
+                Err(format!("{} must sit between two terms", token.describe()))
+            }
+            Some(Token::Quoted(text)) => Ok(QueryExpr::Name(text.to_lowercase())),
+            Some(Token::Word(word)) => self.term(&word),
+        }
+    }
+
+    fn term(&mut self, word: &str) -> Result<QueryExpr, String> {
+        if let Some(body) = word.strip_prefix('-').filter(|body| !body.is_empty()) {
+            return Ok(QueryExpr::Not(Box::new(self.term(body)?)));
+        }
+        if let Some(Token::Op(op)) = self.peek().cloned() {
+            self.pos += 1;
+            let op = CompareOp::parse(&op).ok_or_else(|| format!("unknown operator `{op}`"))?;
+            let field = word.to_lowercase();
+            if !self.fields.numeric.contains(&field.as_str()) {
+                return Err(format!(
+                    "`{word}` cannot be compared (expected one of {})",
+                    self.fields.numeric.join(", ")
+                ));
+            }
+            let value = match self.next() {
+                Some(Token::Word(value)) => value
+                    .parse::<i64>()
+                    .map_err(|_| format!("`{word}`: `{value}` is not a number"))?,
+                other => {
+                    return Err(format!(
+                        "`{word}`: expected a number, found {}",
+                        other.map_or("the end".to_string(), |token| token.describe())
+                    ));
+                }
+            };
+            return Ok(QueryExpr::Compare { field, op, value });
+        }
+        if let Some((field, value)) = word.split_once(':') {
+            let field = field.to_lowercase();
+            if !self.fields.text.contains(&field.as_str()) {
+                return Err(format!(
+                    "unknown field `{field}` (expected one of {})",
+                    self.fields.text.join(", ")
+                ));
+            }
+            if value.is_empty() {
+                return Err(format!("`{word}`: missing value"));
+            }
+            let value = if field.ends_with("kind") {
+                kind_alias(value)
+            } else {
+                value
+            };
+            return Ok(QueryExpr::Text {
+                field,
+                glob: glob(value)?,
+            });
+        }
+        let lowered = word.to_lowercase();
+        if self.fields.flags.contains(&lowered.as_str()) {
+            return Ok(QueryExpr::Flag(lowered));
+        }
+        Ok(QueryExpr::Name(lowered))
+    }
+}
+
+/// Short spellings of symbol kinds, so `kind:func` reads naturally.
+fn kind_alias(kind: &str) -> &str {
+    match kind.to_ascii_lowercase().as_str() {
+        "func" | "fn" | "def" => "function",
+        "var" => "variable",
+        "const" => "constant",
+        "mod" => "module",
+        "iface" => "interface",
+        _ => kind,
+    }
+}
+
+fn glob(pattern: &str) -> Result<GlobMatcher, String> {
+    GlobBuilder::new(pattern)
+        .case_insensitive(true)
+        .build()
+        .map(|glob| glob.compile_matcher())
+        .map_err(|err| format!("`{pattern}`: {err}"))
+}
+
+/// A graph node with its connectivity, as matched by symbol queries.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SymbolRow {
+    #[serde(flatten)]
+    pub node: GraphNode,
+    pub fan_in: usize,
+    pub fan_out: usize,
+    pub test: bool,
+    /// Whether the symbol's file is generated code.
+    pub generated: bool,
+    /// CODEOWNERS owners of the symbol's file; empty when unowned.
+    pub owners: Vec<String>,
+    /// Name of the git submodule the symbol was indexed from.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub submodule: Option<String>,
+    /// Visible outside its package by the language's rules.
+    pub exported: bool,
+    /// The last commit to change the symbol, when blame was indexed.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub last_change: Option<LastChange>,
+}
+
+/// The last commit to change a symbol, per `git blame`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct LastChange {
+    pub commit: String,
+    pub author: String,
+    pub author_email: String,
+    /// Days since the change was authored.
+    pub age_days: u64,
+}
+
+impl LastChange {
+    pub fn from_blame(blame: &SymbolBlame, now: i64) -> Self {
+        Self {
+            commit: blame.commit.clone(),
+            author: blame.author.clone(),
+            author_email: blame.author_email.clone(),
+            age_days: blame.age_days(now),
+        }
+    }
+}
+
+impl QuerySubject for SymbolRow {
+    fn text(&self, field: &str) -> Vec<&str> {
+        let node = &self.node;
+        match field {
+            "kind" => vec![node.kind.as_str()],
+            "name" => vec![node.name.as_str(), node.qualified_name.as_str()],
+            "package" | "pkg" => package_values(&node.package),
+            "path" => vec![node.path.as_str()],
+            "lang" => vec![node.language.as_str()],
+            "owner" => self.owners.iter().map(String::as_str).collect(),
+            "submodule" => self.submodule.as_deref().into_iter().collect(),
+            "author" => self
+                .last_change
+                .iter()
+                .flat_map(|change| [change.author.as_str(), change.author_email.as_str()])
+                .collect(),
+            _ => Vec::new(),
+        }
+    }
+
+    fn number(&self, field: &str) -> Option<i64> {
+        let value = match field {
+            "age" => {
+                return self
+                    .last_change
+                    .as_ref()
+                    .map(|change| change.age_days as i64);
+            }
+            "fanin" => self.fan_in as i64,
+            "fanout" => self.fan_out as i64,
+            "degree" => (self.fan_in + self.fan_out) as i64,
+            "loc" => i64::from(self.node.loc()),
+            "line" => i64::from(self.node.line_start),
+            _ => return None,
+        };
+        Some(value)
+    }
+
+    fn flag(&self, name: &str) -> bool {
+        match name {
+            "test" => self.test,
+            "unowned" => self.owners.is_empty(),
+            "submodule" => self.submodule.is_some(),
+            "generated" => self.generated,
+            "exported" => self.exported,
+            _ => false,
+        }
+    }
+
+    fn qualified_name(&self) -> &str {
+        &self.node.qualified_name
+    }
+}
+
+/// A graph edge with both endpoints resolved, as matched by edge queries.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct EdgeRow {
+    pub from: GraphNode,
+    pub to: GraphNode,
+    #[serde(flatten)]
+    pub edge: GraphEdge,
+    /// CODEOWNERS owners of each endpoint's file.
+    pub from_owners: Vec<String>,
+    pub to_owners: Vec<String>,
+    /// Git submodule each endpoint was indexed from.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub from_submodule: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub to_submodule: Option<String>,
+}
+
+impl QuerySubject for EdgeRow {
+    fn text(&self, field: &str) -> Vec<&str> {
+        match field {
+            "kind" => vec![self.edge.kind.as_str()],
+            "confidence" => vec![self.edge.confidence.as_str()],
+            "path" => self.edge.file.as_deref().into_iter().collect(),
+            "from" => vec![self.from.name.as_str(), self.from.qualified_name.as_str()],
+            "to" => vec![self.to.name.as_str(), self.to.qualified_name.as_str()],
+            "from.kind" => vec![self.from.kind.as_str()],
+            "to.kind" => vec![self.to.kind.as_str()],
+            "from.pkg" => package_values(&self.from.package),
+            "to.pkg" => package_values(&self.to.package),
+            "from.owner" => self.from_owners.iter().map(String::as_str).collect(),
+            "to.owner" => self.to_owners.iter().map(String::as_str).collect(),
+            "from.submodule" => self.from_submodule.as_deref().into_iter().collect(),
+            "to.submodule" => self.to_submodule.as_deref().into_iter().collect(),
+            _ => Vec::new(),
+        }
+    }
+
+    fn number(&self, field: &str) -> Option<i64> {
+        match field {
+            "line" => self.edge.line.map(i64::from),
+            _ => None,
+        }
+    }
+
+    fn flag(&self, name: &str) -> bool {
+        name == "cross" && self.from.package != self.to.package
+    }
+
+    fn qualified_name(&self) -> &str {
+        &self.from.qualified_name
+    }
+}
+
+/// `package:handlers` matches `internal/handlers` as well as the full path.
+fn package_values(package: &str) -> Vec<&str> {
+    match package.rsplit_once('/') {
+        Some((_, last)) => vec![package, last],
+        None => vec![package],
+    }
+}
+
+/// Query results in graph order, capped at the requested limit.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct QueryMatches<T> {
+    pub repo: String,
+    pub ref_name: String,
+    pub total: usize,
+    pub truncated: bool,
+    pub matches: Vec<T>,
+}
+
+/// Symbols (not file nodes) matching `expr`, with their file's `owners`,
+/// the submodule among `submodules` holding it, whether it is one of the
+/// `generated` files and its `blame`, keyed by stable symbol id.
+pub fn query_symbols(
+    snapshot: &GraphSnapshot,
+    owners: &CodeOwners,
+    submodules: &[Submodule],
+    generated: &HashSet<String>,
+    blame: &HashMap<String, SymbolBlame>,
+    expr: &QueryExpr,
+    limit: usize,
+) -> QueryMatches<SymbolRow> {
+    let now = std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map_or(0, |elapsed| elapsed.as_secs() as i64);
+    let mut fan_in: HashMap<&str, usize> = HashMap::new();
+    let mut fan_out: HashMap<&str, usize> = HashMap::new();
+    for edge in &snapshot.edges {
+        if edge.source == edge.target {
+            continue;
+        }
+        *fan_out.entry(edge.source.as_str()).or_default() += 1;
+        *fan_in.entry(edge.target.as_str()).or_default() += 1;
+    }
+
+    let rows = snapshot
+        .nodes
+        .iter()
+        .filter(|node| node.kind != "file" && node.kind != "unknown")
+        .map(|node| SymbolRow {
+            fan_in: fan_in.get(node.id.as_str()).copied().unwrap_or(0),
+            fan_out: fan_out.get(node.id.as_str()).copied().unwrap_or(0),
+            test: is_test_path(&node.path) || is_test_symbol(&call_graph_symbol(node)),
+            generated: generated.contains(&node.path),
+            owners: owners.owners_of(&node.path).to_vec(),
+            submodule: submodule_name(submodules, &node.path),
+            exported: deadcode::is_exported_parts(
+                &node.language,
+                &node.name,
+                node.signature.as_deref(),
+                None,
+            ),
+            last_change: blame
+                .get(&node.id)
+                .map(|blame| LastChange::from_blame(blame, now)),
+            node: node.clone(),
+        });
+    collect(snapshot, rows, expr, limit)
+}
+
+/// Edges matching `expr`; edges whose endpoints are missing from the
+/// snapshot are skipped.
+pub fn query_edges(
+    snapshot: &GraphSnapshot,
+    owners: &CodeOwners,
+    submodules: &[Submodule],
+    expr: &QueryExpr,
+    limit: usize,
+) -> QueryMatches<EdgeRow> {
+    let nodes: HashMap<&str, &GraphNode> = snapshot
+        .nodes
+        .iter()
+        .map(|node| (node.id.as_str(), node))
+        .collect();
+    let rows = snapshot.edges.iter().filter_map(|edge| {
+        let from = *nodes.get(edge.source.as_str())?;
+        let to = *nodes.get(edge.target.as_str())?;
+        Some(EdgeRow {
+            from_owners: owners.owners_of(&from.path).to_vec(),
+            to_owners: owners.owners_of(&to.path).to_vec(),
+            from_submodule: submodule_name(submodules, &from.path),
+            to_submodule: submodule_name(submodules, &to.path),
+            from: from.clone(),
+            to: to.clone(),
+            edge: edge.clone(),
+        })
+    });
+    collect(snapshot, rows, expr, limit)
+}
+
+fn submodule_name(submodules: &[Submodule], path: &str) -> Option<String> {
+    submodules::origin(submodules, path).map(|submodule| submodule.name.clone())
+}
+
+fn collect<T: QuerySubject>(
+    snapshot: &GraphSnapshot,
+    rows: impl Iterator<Item = T>,
+    expr: &QueryExpr,
+    limit: usize,
+) -> QueryMatches<T> {
+    let mut total = 0;
+    let mut matches = Vec::new();
+    for row in rows.filter(|row| expr.matches(row)) {
+        total += 1;
+        if matches.len() < limit {
+            matches.push(row);
+        }
+    }
+    QueryMatches {
+        repo: snapshot.repo.clone(),
+        ref_name: snapshot.ref_name.clone(),
+        total,
+        truncated: total > matches.len(),
+        matches,
+    }
+}
+
+fn call_graph_symbol(node: &GraphNode) -> CallGraphSymbol {
+    CallGraphSymbol {
+        symbol_id: node.id.clone(),
+        symbol_stable_id: node.id.clone(),
+        name: node.name.clone(),
+        qualified_name: node.qualified_name.clone(),
+        path: node.path.clone(),
+        line_start: node.line_start,
+        line_end: node.line_end,
+        kind: node.kind.clone(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn node(id: &str, kind: &str, path: &str) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("app::{id}"),
+            kind: kind.to_string(),
+            language: "go".to_string(),
+            package: path
+                .rsplit_once('/')
+                .map(|(dir, _)| dir.to_string())
+                .unwrap_or_default(),
+            path: path.to_string(),
+            line_start: 1,
+            line_end: 10,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    fn snapshot() -> GraphSnapshot {
+        GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("Login", "function", "internal/handlers/auth.go"),
+                node("Logout", "function", "internal/handlers/auth.go"),
+                node("TestLogin", "function", "internal/handlers/auth_test.go"),
+                node("Session", "struct", "internal/db/session.go"),
+                node("Save", "method", "internal/db/session.go"),
+            ],
+            edges: vec![
+                edge("Login", "Save"),
+                edge("Logout", "Save"),
+                edge("TestLogin", "Login"),
+                edge("Login", "Logout"),
+            ],
+            unresolved_edges: 0,
+        }
+    }
+
+    fn owners() -> CodeOwners {
+        CodeOwners::parse("/internal/handlers/ @acme/web\n/internal/db/ @acme/platform\n")
+    }
+
+    fn symbol_ids(expr: &str) -> Vec<String> {
+        let expr = QueryExpr::parse(expr, &SYMBOL_FIELDS).unwrap();
+        query_symbols(
+            &snapshot(),
+            &owners(),
+            &[],
+            &HashSet::new(),
+            &HashMap::new(),
+            &expr,
+            10,
+        )
+        .matches
+        .into_iter()
+        .map(|row| row.node.id)
+        .collect()
+    }
+
+    #[test]
+    fn symbol_queries_combine_fields_counts_and_flags() {
+        assert_eq!(
+            symbol_ids("kind:func AND package:handlers AND fanout >= 2 AND NOT test"),
+            vec!["Login"]
+        );
+        assert_eq!(symbol_ids("test"), vec!["TestLogin"]);
+        assert_eq!(symbol_ids("fanin>1"), vec!["Save"]);
+        assert_eq!(
+            symbol_ids("(kind:struct OR kind:method) -pkg:handlers"),
+            vec!["Session", "Save"]
+        );
+        assert_eq!(
+            symbol_ids("kind:function OR kind:method AND name:Save"),
+            vec!["Login", "Logout", "TestLogin", "Save"]
+        );
+        assert_eq!(symbol_ids("logout"), vec!["Logout"]);
+        assert_eq!(symbol_ids("").len(), 5);
+    }
+
+    #[test]
+    fn edge_queries_see_both_endpoints() {
+        let expr = QueryExpr::parse("cross AND to.kind:method", &EDGE_FIELDS).unwrap();
+        let edges: Vec<(String, String)> = query_edges(&snapshot(), &owners(), &[], &expr, 10)
+            .matches
+            .into_iter()
+            .map(|row| (row.edge.source, row.edge.target))
+            .collect();
+        assert_eq!(
+            edges,
+            vec![
+                ("Login".to_string(), "Save".to_string()),
+                ("Logout".to_string(), "Save".to_string()),
+            ]
+        );
+
+        let limited = query_edges(&snapshot(), &owners(), &[], &QueryExpr::All, 1);
+        assert_eq!((limited.total, limited.truncated), (4, true));
+    }
+
+    #[test]
+    fn owner_terms_match_codeowners() {
+        assert_eq!(
+            symbol_ids("owner:@acme/platform AND fanin > 1"),
+            vec!["Save"]
+        );
+        assert_eq!(symbol_ids("owner:@ACME/web AND test"), vec!["TestLogin"]);
+        assert!(symbol_ids("unowned").is_empty());
+        let unowned = QueryExpr::parse("unowned", &SYMBOL_FIELDS).unwrap();
+        let rows = query_symbols(
+            &snapshot(),
+            &CodeOwners::default(),
+            &[],
+            &HashSet::new(),
+            &HashMap::new(),
+            &unowned,
+            10,
+        );
+        assert_eq!(rows.total, 5);
+
+        let expr =
+            QueryExpr::parse("from.owner:@acme/web to.owner:@acme/platform", &EDGE_FIELDS).unwrap();
+        assert!(expr.uses("to.owner"));
+        assert!(!expr.uses("owner"));
+        assert_eq!(query_edges(&snapshot(), &owners(), &[], &expr, 10).total, 2);
+    }
+
+    #[test]
+    fn submodule_terms_match_the_origin_of_each_symbol() {
+        let submodules = [Submodule {
+            name: "db-driver".to_string(),
+            path: "internal/db".to_string(),
+            url: None,
+            commit: None,
+        }];
+        let ids = |expr: &str| -> Vec<String> {
+            let expr = QueryExpr::parse(expr, &SYMBOL_FIELDS).unwrap();
+            query_symbols(
+                &snapshot(),
+                &owners(),
+                &submodules,
+                &HashSet::new(),
+                &HashMap::new(),
+                &expr,
+                10,
+            )
+            .matches
+            .into_iter()
+            .map(|row| row.node.id)
+            .collect()
+        };
+        assert_eq!(ids("submodule"), vec!["Session", "Save"]);
+        assert_eq!(ids("submodule:db-*"), vec!["Session", "Save"]);
+        assert_eq!(
+            ids("kind:function -submodule"),
+            vec!["Login", "Logout", "TestLogin"]
+        );
+
+        let expr =
+            QueryExpr::parse("to.submodule:db-driver -from.submodule:*", &EDGE_FIELDS).unwrap();
+        let edges = query_edges(&snapshot(), &owners(), &submodules, &expr, 10);
+        assert_eq!(edges.total, 2);
+    }
+
+    #[test]
+    fn generated_flag_matches_symbols_of_generated_files() {
+        let generated = HashSet::from(["internal/db/session.go".to_string()]);
+        let expr =
+            QueryExpr::parse("kind:method OR kind:function -generated", &SYMBOL_FIELDS).unwrap();
+        let rows = query_symbols(
+            &snapshot(),
+            &owners(),
+            &[],
+            &generated,
+            &HashMap::new(),
+            &expr,
+            10,
+        );
+        let ids: Vec<&str> = rows
+            .matches
+            .iter()
+            .map(|row| row.node.id.as_str())
+            .collect();
+        assert_eq!(ids, vec!["Login", "Logout", "TestLogin", "Save"]);
+        assert!(rows.matches[3].generated);
+
+        let expr = QueryExpr::parse("generated AND fanin > 1", &SYMBOL_FIELDS).unwrap();
+        let rows = query_symbols(
+            &snapshot(),
+            &owners(),
+            &[],
+            &generated,
+            &HashMap::new(),
+            &expr,
+            10,
+        );
+        assert_eq!(rows.total, 1);
+    }
+
+    #[test]
+    fn blame_terms_match_author_and_age() {
+        let now = std::time::SystemTime::now()
+            .duration_since(std::time::UNIX_EPOCH)
+            .unwrap()
+            .as_secs() as i64;
+        let blame = |id: &str, author: &str, days: i64| {
+            let entry = SymbolBlame {
+                symbol_stable_id: id.to_string(),
+                path: String::new(),
+                commit: "c".repeat(40),
+                author: author.to_string(),
+                author_email: format!("{}@example.com", author.to_lowercase()),
+                author_time: now - days * 86_400 - 60,
+            };
+            (id.to_string(), entry)
+        };
+        let blame = HashMap::from([
+            blame("Login", "Cy", 10),
+            blame("Logout", "Ana", 800),
+            blame("Session", "Bo", 900),
+        ]);
+        let ids = |expr: &str| -> Vec<String> {
+            let expr = QueryExpr::parse(expr, &SYMBOL_FIELDS).unwrap();
+            query_symbols(
+                &snapshot(),
+                &owners(),
+                &[],
+                &HashSet::new(),
+                &blame,
+                &expr,
+                10,
+            )
+            .matches
+            .into_iter()
+            .map(|row| row.node.id)
+            .collect()
+        };
+        assert_eq!(ids("exported age >= 730 fanin = 0"), vec!["Session"]);
+        assert_eq!(ids("author:ana*"), vec!["Logout"]);
+        assert_eq!(ids("author:bo@example.com"), vec!["Session"]);
+        assert_eq!(ids("age < 30"), vec!["Login"]);
+
+        let rows = query_symbols(
+            &snapshot(),
+            &owners(),
+            &[],
+            &HashSet::new(),
+            &blame,
+            &QueryExpr::parse("Logout", &SYMBOL_FIELDS).unwrap(),
+            10,
+        );
+        assert_eq!(rows.matches[0].last_change.as_ref().unwrap().age_days, 800);
+        assert!(rows.matches[0].exported);
+    }
+
+    #[test]
+    fn parse_errors_name_the_problem() {
+        let err = |expr: &str| QueryExpr::parse(expr, &SYMBOL_FIELDS).unwrap_err();
+        assert!(err("colour:red").contains("unknown field `colour`"));
+        assert!(err("kind > 3").contains("cannot be compared"));
+        assert!(err("fanin > many").contains("not a number"));
+        assert!(err("(kind:func").contains("missing `)`"));
+        assert!(err("kind:func)").contains("unbalanced"));
+        assert!(err("AND kind:func").contains("between two terms"));
+        assert!(err("kind:func OR").contains("ends where a term"));
+        assert!(err("name:\"open").contains("unterminated"));
+    }
+}
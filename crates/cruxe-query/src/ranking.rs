@@ -779,6 +779,7 @@ mod tests {
             kind: Some(kind.to_string()),
             name: Some(name.to_string()),
             qualified_name: Some(qn.to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -0,0 +1,586 @@
+//! Every textual reference to a symbol, with exact positions.
+//!
+//! [`crate::find_references`] walks the edge graph and reports one row per
+//! referencing symbol. This module instead scans the indexed files for the
+//! identifier itself, so it also sees reads, writes and imports that never
+//! become edges, and reports the line and column of each occurrence. Call
+//! sites backed by a resolved call edge are marked `resolved`.
+//!
+//! A parameter or local of the same name shadows the symbol inside its
+//! scope, so those occurrences are skipped. Locals themselves are named
+//! `function.name` (`HandleRequest.claims`); their sites come from the uses
+//! recorded at index time rather than from a scan.
+
+use cruxe_core::error::StateError;
+use cruxe_core::types::{LocalRecord, SymbolRecord};
+use cruxe_state::{edges, manifest, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::HashSet;
+use std::path::Path;
+
+use crate::locals;
+
+/// How a reference uses the symbol.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize, Deserialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum RefKind {
+    Definition,
+    Call,
+    Read,
+    Write,
+    Import,
+}
+
+impl RefKind {
+    pub const ALL: [RefKind; 5] = [
+        Self::Definition,
+        Self::Call,
+        Self::Read,
+        Self::Write,
+        Self::Import,
+    ];
+
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Self::Definition => "definition",
+            Self::Call => "call",
+            Self::Read => "read",
+            Self::Write => "write",
+            Self::Import => "import",
+        }
+    }
+
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "definition" | "def" => Some(Self::Definition),
+            "call" | "calls" => Some(Self::Call),
+            "read" | "reads" => Some(Self::Read),
+            "write" | "writes" => Some(Self::Write),
+            "import" | "imports" => Some(Self::Import),
+            _ => None,
+        }
+    }
+}
+
+/// The innermost indexed symbol around a reference.
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct EnclosingSymbol {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+}
+
+/// One occurrence of the identifier. Lines and columns are 1-based;
+/// columns count characters and `end_column` is exclusive.
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct ReferenceSite {
+    pub path: String,
+    pub line: u32,
+    pub column: u32,
+    pub end_column: u32,
+    pub kind: RefKind,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub enclosing: Option<EnclosingSymbol>,
+    /// Backed by a definition or a call edge resolved to the symbol, rather
+    /// than a name match alone.
+    pub resolved: bool,
+    pub text: String,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
+pub struct ReferenceSites {
+    pub symbol: String,
+    /// Indexed definitions of the name; zero for external symbols.
+    pub definitions: usize,
+    pub references: Vec<ReferenceSite>,
+}
+
+/// Scan the files indexed for `ref_name` for `symbol` (a bare or qualified
+/// name) and classify each occurrence. An empty `kinds` keeps every kind.
+pub fn find_reference_sites(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    kinds: &[RefKind],
+) -> Result<ReferenceSites, StateError> {
+    let name = bare_name(symbol);
+    let mut definitions = symbols::find_symbols_by_name(conn, project_id, ref_name, name, None)?;
+    if name != symbol {
+        definitions.retain(|def| def.qualified_name == symbol);
+    }
+    if definitions.is_empty() {
+        let found = locals::find(conn, project_id, ref_name, symbol)?;
+        if !found.is_empty() {
+            let references = local_reference_sites(conn, workspace, project_id, ref_name, &found)?;
+            return Ok(ReferenceSites {
+                symbol: symbol.to_string(),
+                definitions: found.len(),
+                references: filter_and_sort(references, kinds),
+            });
+        }
+    }
+
+    let mut resolved_calls: HashSet<(String, u32)> = HashSet::new();
+    for def in &definitions {
+        for id in [&def.symbol_id, &def.symbol_stable_id] {
+            for edge in edges::get_callers(conn, project_id, ref_name, id)? {
+                resolved_calls.insert((edge.source_file, edge.source_line));
+            }
+        }
+    }
+
+    let mut entries = manifest::get_all_entries(conn, project_id, ref_name)?;
+    entries.sort_by(|a, b| a.path.cmp(&b.path));
+    let mut references = Vec::new();
+    for entry in entries {
+        let Ok(content) = std::fs::read_to_string(workspace.join(&entry.path)) else {
+            continue;
+        };
+        if !content.contains(name) {
+            continue;
+        }
+        let file_symbols = symbols::list_symbols_in_file(conn, project_id, ref_name, &entry.path)?;
+        let file_defs: Vec<&SymbolRecord> = definitions
+            .iter()
+            .filter(|def| def.path == entry.path)
+            .collect();
+        // An external name may still be a local everywhere it appears; only
+        // an indexed symbol is known to be shadowed.
+        let shadowed = if definitions.is_empty() {
+            HashSet::new()
+        } else {
+            locals::bound_positions(conn, project_id, ref_name, &entry.path)?
+        };
+        scan_file(
+            &FileScan {
+                path: &entry.path,
+                language: entry.language.as_deref().unwrap_or(""),
+                content: &content,
+                name,
+                definitions: &file_defs,
+                symbols: &file_symbols,
+                resolved_calls: &resolved_calls,
+                shadowed: &shadowed,
+            },
+            &mut references,
+        );
+    }
+
+    Ok(ReferenceSites {
+        symbol: symbol.to_string(),
+        definitions: definitions.len(),
+        references: filter_and_sort(references, kinds),
+    })
+}
+
+/// The occurrences of `locals`, from the uses recorded at index time. Every
+/// site is resolved: the scope, not the name, ties it to the local.
+pub fn local_reference_sites(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    locals: &[LocalRecord],
+) -> Result<Vec<ReferenceSite>, StateError> {
+    let mut sites = Vec::new();
+    for local in locals {
+        let content = std::fs::read_to_string(workspace.join(&local.path)).unwrap_or_default();
+        let lines: Vec<&str> = content.lines().collect();
+        let file_symbols = symbols::list_symbols_in_file(conn, project_id, ref_name, &local.path)?;
+        let width = local.name.chars().count() as u32;
+        for use_ in &local.uses {
+            let line = lines
+                .get(use_.line.saturating_sub(1) as usize)
+                .copied()
+                .unwrap_or_default();
+            let rest: String = line
+                .chars()
+                .skip((use_.column - 1 + width) as usize)
+                .collect();
+            let kind = if (use_.line, use_.column) == (local.line, local.column) {
+                RefKind::Definition
+            } else if use_.write {
+                RefKind::Write
+            } else if classify_use(&rest) == RefKind::Call {
+                RefKind::Call
+            } else {
+                RefKind::Read
+            };
+            sites.push(ReferenceSite {
+                path: local.path.clone(),
+                line: use_.line,
+                column: use_.column,
+                end_column: use_.column + width,
+                kind,
+                enclosing: enclosing_symbol(&file_symbols, use_.line, &local.name, kind),
+                resolved: true,
+                text: line.trim().to_string(),
+            });
+        }
+    }
+    Ok(sites)
+}
+
+fn filter_and_sort(mut references: Vec<ReferenceSite>, kinds: &[RefKind]) -> Vec<ReferenceSite> {
+    if !kinds.is_empty() {
+        references.retain(|site| kinds.contains(&site.kind));
+    }
+    references.sort_by(|a, b| {
+        (a.kind != RefKind::Definition)
+            .cmp(&(b.kind != RefKind::Definition))
+            .then_with(|| a.path.cmp(&b.path))
+            .then_with(|| a.line.cmp(&b.line))
+            .then_with(|| a.column.cmp(&b.column))
+    });
+    references
+}
+
+/// `auth::validate` and `auth.Validate` reference `validate` and `Validate`.
+pub(crate) fn bare_name(symbol: &str) -> &str {
+    let after_path = symbol.rsplit("::").next().unwrap_or(symbol);
+    after_path.rsplit('.').next().unwrap_or(after_path)
+}
+
+struct FileScan<'a> {
+    path: &'a str,
+    language: &'a str,
+    content: &'a str,
+    name: &'a str,
+    definitions: &'a [&'a SymbolRecord],
+    symbols: &'a [SymbolRecord],
+    resolved_calls: &'a HashSet<(String, u32)>,
+    /// (line, column) of occurrences a parameter or local binds.
+    shadowed: &'a HashSet<(u32, u32)>,
+}
+
+fn scan_file(scan: &FileScan<'_>, out: &mut Vec<ReferenceSite>) {
+    let comment = if scan.language == "python" { "#" } else { "//" };
+    // The first occurrence inside a definition's span is its declaration.
+    let mut pending_defs: Vec<&SymbolRecord> = scan.definitions.to_vec();
+    let mut in_go_imports = false;
+    for (idx, line) in scan.content.lines().enumerate() {
+        let line_no = idx as u32 + 1;
+        let trimmed = line.trim_start();
+        if scan.language == "go" {
+            if trimmed.starts_with("import (") {
+                in_go_imports = true;
+            } else if in_go_imports && trimmed.starts_with(')') {
+                in_go_imports = false;
+            }
+        }
+        if trimmed.starts_with('*') || trimmed.starts_with("/*") {
+            continue;
+        }
+        let code = line.find(comment).map_or(line, |end| &line[..end]);
+        for start in identifier_matches(code, scan.name) {
+            let end = start + scan.name.len();
+            let column = code[..start].chars().count() as u32 + 1;
+            if scan.shadowed.contains(&(line_no, column)) {
+                continue;
+            }
+            let def_pos = pending_defs
+                .iter()
+                .position(|def| def.line_start <= line_no && line_no <= def.line_end);
+            let kind = if let Some(pos) = def_pos {
+                pending_defs.remove(pos);
+                RefKind::Definition
+            } else if in_go_imports || is_import_line(trimmed) {
+                RefKind::Import
+            } else {
+                classify_use(&code[end..])
+            };
+            let resolved = kind == RefKind::Definition
+                || (kind == RefKind::Call
+                    && scan
+                        .resolved_calls
+                        .contains(&(scan.path.to_string(), line_no)));
+            out.push(ReferenceSite {
+                path: scan.path.to_string(),
+                line: line_no,
+                column,
+                end_column: column + scan.name.chars().count() as u32,
+                kind,
+                enclosing: enclosing_symbol(scan.symbols, line_no, scan.name, kind),
+                resolved,
+                text: line.trim().to_string(),
+            });
+        }
+    }
+}
+
+/// Byte offsets of `name` in `code` as a whole identifier.
+pub(crate) fn identifier_matches(code: &str, name: &str) -> Vec<usize> {
+    let is_ident = |c: char| c.is_alphanumeric() || c == '_' || c == '$';
+    code.match_indices(name)
+        .map(|(start, _)| start)
+        .filter(|&start| {
+            let before = code[..start].chars().next_back();
+            let after = code[start + name.len()..].chars().next();
+            !before.is_some_and(is_ident) && !after.is_some_and(is_ident)
+        })
+        .collect()
+}
+
+pub(crate) fn is_import_line(trimmed: &str) -> bool {
+    [
+        "import ",
+        "use ",
+        "pub use ",
+        "pub(crate) use ",
+        "from ",
+        "extern crate ",
+    ]
+    .iter()
+    .any(|prefix| trimmed.starts_with(prefix))
+        || trimmed.contains("require(")
+}
+
+/// Classify a use by the text right after the identifier.
+fn classify_use(rest: &str) -> RefKind {
+    let rest = rest.trim_start();
+    if rest.starts_with('(') || rest.starts_with("::<") || rest.starts_with("!(") {
+        return RefKind::Call;
+    }
+    const WRITES: [&str; 14] = [
+        ":=", "+=", "-=", "*=", "/=", "%=", "|=", "&=", "^=", "<<=", ">>=", "++", "--", "??=",
+    ];
+    if WRITES.iter().any(|op| rest.starts_with(op))
+        || (rest.starts_with('=') && !rest.starts_with("==") && !rest.starts_with("=>"))
+    {
+        return RefKind::Write;
+    }
+    RefKind::Read
+}
+
+/// The innermost symbol whose span contains `line`, skipping the symbol
+/// being declared there.
+fn enclosing_symbol(
+    symbols: &[SymbolRecord],
+    line: u32,
+    name: &str,
+    kind: RefKind,
+) -> Option<EnclosingSymbol> {
+    symbols
+        .iter()
+        .filter(|symbol| symbol.line_start <= line && line <= symbol.line_end)
+        .filter(|symbol| !(kind == RefKind::Definition && symbol.name == name))
+        .min_by_key(|symbol| symbol.line_end - symbol.line_start)
+        .map(|symbol| EnclosingSymbol {
+            name: symbol.name.clone(),
+            qualified_name: symbol.qualified_name.clone(),
+            kind: symbol.kind.as_str().to_string(),
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, LocalUse, SymbolKind};
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, path: &str, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("api.{name}"),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn add_file(conn: &Connection, workspace: &Path, path: &str, content: &str) {
+        std::fs::write(workspace.join(path), content).unwrap();
+        manifest::upsert_manifest(
+            conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn classifies_definition_call_read_write_and_import() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path();
+
+        add_file(
+            &conn,
+            workspace,
+            "limit.go",
+            "package api\n\n// maxConns caps the pool.\nvar maxConns = 4\n\nfunc grow() {\n\tmaxConns += 1\n\tuse(maxConns)\n\tmaxConns()\n}\n",
+        );
+        add_file(
+            &conn,
+            workspace,
+            "other.go",
+            "package api\n\nimport maxConns \"x\"\n\nfunc other() { fmaxConns() }\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("maxConns", "limit.go", 4, 4)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("grow", "limit.go", 6, 10)).unwrap();
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "sym::grow".to_string(),
+                to_symbol_id: Some("sym::maxConns".to_string()),
+                to_name: None,
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "limit.go".to_string(),
+                source_line: 9,
+            }],
+        )
+        .unwrap();
+
+        let sites =
+            find_reference_sites(&conn, workspace, "repo", "main", "maxConns", &[]).unwrap();
+        assert_eq!(sites.definitions, 1);
+        let summary: Vec<_> = sites
+            .references
+            .iter()
+            .map(|site| (site.path.as_str(), site.line, site.column, site.kind))
+            .collect();
+        assert_eq!(
+            summary,
+            vec![
+                ("limit.go", 4, 5, RefKind::Definition),
+                ("limit.go", 7, 2, RefKind::Write),
+                ("limit.go", 8, 6, RefKind::Read),
+                ("limit.go", 9, 2, RefKind::Call),
+                ("other.go", 3, 8, RefKind::Import),
+            ]
+        );
+        let call = &sites.references[3];
+        assert!(call.resolved);
+        assert_eq!(call.end_column, 10);
+        assert_eq!(call.enclosing.as_ref().unwrap().name, "grow");
+        assert!(sites.references[0].enclosing.is_none());
+
+        let writes = find_reference_sites(
+            &conn,
+            workspace,
+            "repo",
+            "main",
+            "api.maxConns",
+            &[RefKind::Write],
+        )
+        .unwrap();
+        assert_eq!(writes.references.len(), 1);
+        assert_eq!(writes.references[0].line, 7);
+    }
+
+    #[test]
+    fn locals_shadow_symbols_and_are_named_by_function() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path();
+
+        add_file(
+            &conn,
+            workspace,
+            "limit.go",
+            "package api\n\nvar limit = 4\n\nfunc grow(limit int) {\n\tlimit = limit * 2\n\tuse(limit)\n}\n\nfunc size() int { return limit }\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("limit", "limit.go", 3, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("grow", "limit.go", 5, 8)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("size", "limit.go", 10, 10)).unwrap();
+        let use_at = |line, column, write| LocalUse {
+            line,
+            column,
+            write,
+        };
+        cruxe_state::locals::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "limit.go",
+            &[LocalRecord {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "limit.go".to_string(),
+                name: "limit".to_string(),
+                kind: "parameter".to_string(),
+                line: 5,
+                column: 11,
+                symbol_id: Some("stable::grow".to_string()),
+                symbol: Some("api.grow".to_string()),
+                uses: vec![
+                    use_at(5, 11, false),
+                    use_at(6, 2, true),
+                    use_at(6, 10, false),
+                    use_at(7, 6, false),
+                ],
+            }],
+        )
+        .unwrap();
+
+        let summary = |sites: &ReferenceSites| -> Vec<(u32, u32, RefKind)> {
+            sites
+                .references
+                .iter()
+                .map(|site| (site.line, site.column, site.kind))
+                .collect()
+        };
+        let global = find_reference_sites(&conn, workspace, "repo", "main", "limit", &[]).unwrap();
+        assert_eq!(
+            summary(&global),
+            vec![(3, 5, RefKind::Definition), (10, 26, RefKind::Read)]
+        );
+
+        let param =
+            find_reference_sites(&conn, workspace, "repo", "main", "grow.limit", &[]).unwrap();
+        assert_eq!(param.definitions, 1);
+        assert_eq!(
+            summary(&param),
+            vec![
+                (5, 11, RefKind::Definition),
+                (6, 2, RefKind::Write),
+                (6, 10, RefKind::Read),
+                (7, 6, RefKind::Read),
+            ]
+        );
+        assert!(param.references.iter().all(|site| site.resolved));
+        assert_eq!(param.references[3].enclosing.as_ref().unwrap().name, "grow");
+    }
+
+    #[test]
+    fn classify_use_distinguishes_comparisons_from_assignments() {
+        assert_eq!(classify_use(" = 1"), RefKind::Write);
+        assert_eq!(classify_use(" == 1"), RefKind::Read);
+        assert_eq!(classify_use(" => x"), RefKind::Read);
+        assert_eq!(classify_use("::<u8>()"), RefKind::Call);
+        assert_eq!(classify_use("++"), RefKind::Write);
+        assert_eq!(bare_name("auth::token::validate"), "validate");
+        assert_eq!(bare_name("pkg.Validate"), "Validate");
+    }
+}
@@ -0,0 +1,450 @@
+//! Files and symbols to look at for a task, for `cruxe relevant`.
+//!
+//! The task description is ranked against the symbols like a `cruxe ask`
+//! question (keywords, plus stored vectors when `cruxe embed` has run).
+//! The best matches become seeds, and the call graph around them adds the
+//! code a change would touch without naming the task's words: the route
+//! registration that calls `handleCreateUser`, the store method it calls.
+//! A symbol scores its own match plus its best proximity to a seed, which
+//! halves with every call in between; files add up their symbols. Every
+//! result says why it is there.
+
+use crate::ask::{self, SourceCache};
+use cruxe_core::config::SearchConfig;
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::edges;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap, VecDeque};
+use std::fmt::Write as _;
+use std::path::Path;
+
+pub const DEFAULT_LIMIT: usize = 15;
+
+/// Best matches whose neighbourhood is explored.
+const SEED_COUNT: usize = 5;
+/// Calls followed from a seed.
+const MAX_HOPS: usize = 2;
+/// Proximity of a direct caller or callee, relative to the seed's match.
+const HOP_DECAY: f64 = 0.5;
+/// Nearest snippets fetched per requested result.
+const SEMANTIC_FANOUT: usize = 3;
+/// Symbols named under each file.
+const FILE_SYMBOLS: usize = 5;
+
+#[derive(Debug, Clone, Default)]
+pub struct RelevantOptions {
+    /// Files and symbols returned, each.
+    pub limit: usize,
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct RelevantSymbol {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub score: f64,
+    /// Whether the symbol matched the task itself.
+    pub seed: bool,
+    pub reasons: Vec<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct RelevantFile {
+    pub path: String,
+    pub score: f64,
+    /// Its most relevant symbols, best first.
+    pub symbols: Vec<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct RelevantReport {
+    pub task: String,
+    pub terms: Vec<String>,
+    /// Qualified names of the matches the graph was explored from.
+    pub seeds: Vec<String>,
+    pub semantic_used: bool,
+    /// Why the vector ranking was not used, when it was not.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub semantic_note: Option<String>,
+    pub files: Vec<RelevantFile>,
+    pub symbols: Vec<RelevantSymbol>,
+}
+
+/// How a symbol was reached from a seed.
+#[derive(Debug, Clone, Copy)]
+struct Proximity {
+    score: f64,
+    seed: usize,
+    hops: usize,
+    /// For one hop: whether the seed calls the symbol.
+    called_by_seed: bool,
+}
+
+/// Rank files and symbols of `ref_name` for `task`.
+pub fn find_relevant(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    task: &str,
+    search_config: &SearchConfig,
+    options: &RelevantOptions,
+) -> Result<RelevantReport, StateError> {
+    let mut sources = SourceCache::new(workspace);
+    let ranking = ask::rank_symbols(
+        conn,
+        &mut sources,
+        project_id,
+        ref_name,
+        task,
+        search_config,
+        options.limit.max(1) * SEMANTIC_FANOUT,
+    )?;
+    let symbols = &ranking.symbols;
+
+    // Matches scaled so the best is 1.0.
+    let top = ranking.matches.first().map_or(0.0, |matched| matched.score);
+    let matches: HashMap<usize, (f64, &ask::SymbolMatch)> = ranking
+        .matches
+        .iter()
+        .map(|matched| (matched.index, (matched.score / top, matched)))
+        .collect();
+    let seeds: Vec<usize> = ranking
+        .matches
+        .iter()
+        .take(SEED_COUNT)
+        .map(|matched| matched.index)
+        .collect();
+
+    let mut by_id: HashMap<&str, usize> = HashMap::new();
+    for (index, symbol) in symbols.iter().enumerate() {
+        by_id.insert(symbol.symbol_stable_id.as_str(), index);
+        by_id.entry(symbol.symbol_id.as_str()).or_insert(index);
+    }
+    // (neighbour, whether the symbol calls it)
+    let mut adjacent: Vec<Vec<(usize, bool)>> = vec![Vec::new(); symbols.len()];
+    edges::for_each_edge_for_ref(conn, project_id, ref_name, |edge| {
+        if edge.edge_type != "calls" {
+            return Ok(());
+        }
+        let from = by_id.get(edge.from_symbol_id.as_str()).copied();
+        let to = edge
+            .to_symbol_id
+            .as_deref()
+            .and_then(|id| by_id.get(id))
+            .copied();
+        if let (Some(from), Some(to)) = (from, to)
+            && from != to
+        {
+            adjacent[from].push((to, true));
+            adjacent[to].push((from, false));
+        }
+        Ok(())
+    })?;
+
+    let mut proximity: HashMap<usize, Proximity> = HashMap::new();
+    for &seed in &seeds {
+        let seed_score = matches[&seed].0;
+        let mut hops: HashMap<usize, usize> = HashMap::from([(seed, 0)]);
+        let mut queue = VecDeque::from([seed]);
+        while let Some(node) = queue.pop_front() {
+            let distance = hops[&node];
+            if distance == MAX_HOPS {
+                continue;
+            }
+            for &(next, calls) in &adjacent[node] {
+                if hops.contains_key(&next) {
+                    continue;
+                }
+                hops.insert(next, distance + 1);
+                queue.push_back(next);
+                let reached = Proximity {
+                    score: seed_score * HOP_DECAY.powi(distance as i32 + 1),
+                    seed,
+                    hops: distance + 1,
+                    called_by_seed: node == seed && calls,
+                };
+                let best = proximity.entry(next).or_insert(reached);
+                if reached.score > best.score {
+                    *best = reached;
+                }
+            }
+        }
+    }
+
+    let mut candidates: Vec<usize> = matches
+        .keys()
+        .chain(proximity.keys())
+        .copied()
+        .filter(|&index| options.scope.contains(&symbols[index].path))
+        .collect();
+    candidates.sort_unstable();
+    candidates.dedup();
+    let mut ranked: Vec<RelevantSymbol> = candidates
+        .into_iter()
+        .map(|index| {
+            let symbol = &symbols[index];
+            let mut score = 0.0;
+            let mut reasons = Vec::new();
+            if let Some((matched_score, matched)) = matches.get(&index) {
+                score += matched_score;
+                if !matched.matched_terms.is_empty() {
+                    reasons.push(format!("matches {}", matched.matched_terms.join(", ")));
+                }
+                if matched.semantic {
+                    reasons.push("similar in meaning".to_string());
+                }
+            }
+            if let Some(reached) = proximity.get(&index) {
+                score += reached.score;
+                let seed = &symbols[reached.seed].qualified_name;
+                reasons.push(match (reached.hops, reached.called_by_seed) {
+                    (1, true) => format!("called by {seed}"),
+                    (1, false) => format!("calls {seed}"),
+                    (hops, _) => format!("{hops} calls from {seed}"),
+                });
+            }
+            RelevantSymbol {
+                name: symbol.name.clone(),
+                qualified_name: symbol.qualified_name.clone(),
+                kind: symbol.kind.as_str().to_string(),
+                path: symbol.path.clone(),
+                line_start: symbol.line_start,
+                line_end: symbol.line_end,
+                score,
+                seed: seeds.contains(&index),
+                reasons,
+            }
+        })
+        .collect();
+    ranked.sort_by(|a, b| {
+        b.score
+            .total_cmp(&a.score)
+            .then_with(|| a.path.cmp(&b.path))
+            .then_with(|| a.line_start.cmp(&b.line_start))
+    });
+
+    let mut by_file: BTreeMap<&str, (f64, Vec<&str>)> = BTreeMap::new();
+    for symbol in &ranked {
+        let file = by_file.entry(symbol.path.as_str()).or_default();
+        file.0 += symbol.score;
+        if file.1.len() < FILE_SYMBOLS {
+            file.1.push(symbol.qualified_name.as_str());
+        }
+    }
+    let mut files: Vec<RelevantFile> = by_file
+        .into_iter()
+        .map(|(path, (score, names))| RelevantFile {
+            path: path.to_string(),
+            score,
+            symbols: names.into_iter().map(str::to_string).collect(),
+        })
+        .collect();
+    files.sort_by(|a, b| {
+        b.score
+            .total_cmp(&a.score)
+            .then_with(|| a.path.cmp(&b.path))
+    });
+    files.truncate(options.limit);
+    ranked.truncate(options.limit);
+
+    Ok(RelevantReport {
+        task: task.to_string(),
+        terms: ranking.terms.clone(),
+        seeds: seeds
+            .iter()
+            .map(|&index| symbols[index].qualified_name.clone())
+            .collect(),
+        semantic_used: ranking.semantic_used,
+        semantic_note: ranking.semantic_note.clone(),
+        files,
+        symbols: ranked,
+    })
+}
+
+/// Plain-text rendering: files, then symbols with their reasons.
+pub fn render_text(report: &RelevantReport) -> String {
+    let mut out = String::new();
+    if report.symbols.is_empty() {
+        let _ = writeln!(out, "Nothing in the index matches \"{}\".", report.task);
+    } else {
+        let _ = writeln!(out, "Files:");
+        for (rank, file) in report.files.iter().enumerate() {
+            let _ = writeln!(
+                out,
+                "{:>3}. {}  ({:.2})  {}",
+                rank + 1,
+                file.path,
+                file.score,
+                file.symbols.join(", ")
+            );
+        }
+        let _ = writeln!(out);
+        let _ = writeln!(out, "Symbols:");
+        for (rank, symbol) in report.symbols.iter().enumerate() {
+            let _ = writeln!(
+                out,
+                "{:>3}. {} ({}) {}:{}  ({:.2})  [{}]",
+                rank + 1,
+                symbol.qualified_name,
+                symbol.kind,
+                symbol.path,
+                symbol.line_start,
+                symbol.score,
+                symbol.reasons.join("; ")
+            );
+        }
+    }
+    if let Some(note) = &report.semantic_note {
+        let _ = writeln!(out, "note: {note}");
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind, SymbolRecord};
+    use cruxe_state::{db, schema, symbols};
+
+    fn record(path: &str, qualified_name: &str, kind: SymbolKind, signature: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified_name}"),
+            symbol_stable_id: format!("stable::{qualified_name}"),
+            name: qualified_name.rsplit('.').next().unwrap().to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind,
+            signature: Some(signature.to_string()),
+            line_start: 10,
+            line_end: 20,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: &str) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: Some(format!("stable::{to}")),
+            to_name: Some(to.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: String::new(),
+            source_line: 1,
+        }
+    }
+
+    #[test]
+    fn graph_neighbours_of_the_matches_come_with_reasons() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            record(
+                "api/users.go",
+                "handleCreateUser",
+                SymbolKind::Function,
+                "func handleCreateUser(w http.ResponseWriter, r *http.Request)",
+            ),
+            record(
+                "api/users.go",
+                "validateUser",
+                SymbolKind::Function,
+                "func validateUser(u *User) error",
+            ),
+            record(
+                "api/orders.go",
+                "handleDeleteOrder",
+                SymbolKind::Function,
+                "func handleDeleteOrder(w http.ResponseWriter, r *http.Request)",
+            ),
+            record(
+                "api/router.go",
+                "RegisterRoutes",
+                SymbolKind::Function,
+                "func RegisterRoutes(mux *http.ServeMux)",
+            ),
+            record(
+                "store/db.go",
+                "Store.Insert",
+                SymbolKind::Method,
+                "func (s *Store) Insert(ctx context.Context, row any) error",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("RegisterRoutes", "handleCreateUser"),
+                call("RegisterRoutes", "handleDeleteOrder"),
+                call("handleCreateUser", "validateUser"),
+                call("handleCreateUser", "Store.Insert"),
+            ],
+        )
+        .unwrap();
+
+        let options = RelevantOptions {
+            limit: DEFAULT_LIMIT,
+            ..RelevantOptions::default()
+        };
+        let report = find_relevant(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "add rate limiting to the user creation endpoint",
+            &SearchConfig::default(),
+            &options,
+        )
+        .unwrap();
+        let by_name: HashMap<&str, &RelevantSymbol> = report
+            .symbols
+            .iter()
+            .map(|symbol| (symbol.qualified_name.as_str(), symbol))
+            .collect();
+
+        assert_eq!(report.symbols[0].qualified_name, "handleCreateUser");
+        assert!(report.symbols[0].seed);
+        assert_eq!(report.files[0].path, "api/users.go");
+        assert_eq!(
+            by_name["RegisterRoutes"].reasons,
+            vec!["calls handleCreateUser"]
+        );
+        assert_eq!(
+            by_name["Store.Insert"].reasons,
+            vec!["called by handleCreateUser"]
+        );
+        assert!(!by_name["RegisterRoutes"].seed);
+        // Two calls away through the router, and never named by the task.
+        assert_eq!(
+            by_name["handleDeleteOrder"].reasons,
+            vec!["2 calls from handleCreateUser"]
+        );
+        assert!(by_name["handleDeleteOrder"].score < by_name["RegisterRoutes"].score);
+        assert!(!report.semantic_used);
+
+        let text = render_text(&report);
+        assert!(
+            text.contains("RegisterRoutes (function) api/router.go:10"),
+            "{text}"
+        );
+    }
+}
@@ -0,0 +1,814 @@
+//! `cruxe rename`: every occurrence of a symbol found by [`crate::ref_sites`]
+//! rewritten to a new name, as whole files and a unified diff.
+//!
+//! Occurrences inside string literals (Go struct tags, JSON keys, log
+//! messages) and comments are left alone. When other indexed symbols share
+//! the name, only occurrences that certainly mean the renamed one are
+//! rewritten: its declarations, calls resolved to it, and other uses in its
+//! own directory that are not the declaration of a namesake. The rest are
+//! reported as skipped so they can be reviewed by hand.
+//!
+//! A parameter or local is renamed as `function.name`; only the uses its
+//! scope binds are rewritten.
+
+use crate::locals;
+use crate::ref_sites::{self, RefKind, ReferenceSite};
+use cruxe_core::error::StateError;
+use cruxe_core::languages;
+use cruxe_core::types::{LocalRecord, SymbolRecord};
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::Path;
+
+/// Lines of unchanged context around each change in the diff.
+const DIFF_CONTEXT: usize = 3;
+
+#[derive(Debug, thiserror::Error)]
+pub enum RenameError {
+    #[error("`{name}` is not a valid {language} identifier")]
+    InvalidName { name: String, language: String },
+    #[error("`{0}` is not defined in the index")]
+    NotFound(String),
+    #[error("`{symbol}` names several symbols ({}); pass the qualified name", candidates.join(", "))]
+    Ambiguous {
+        symbol: String,
+        candidates: Vec<String>,
+    },
+    #[error("`{name}` is already defined at {path}:{line}")]
+    Conflict {
+        name: String,
+        path: String,
+        line: u32,
+    },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// One file to rewrite.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct FileRename {
+    pub path: String,
+    pub occurrences: usize,
+    /// Unified diff of the change, relative to the workspace root.
+    pub diff: String,
+    /// Content the plan was made from; the file is not written when it has
+    /// changed since.
+    #[serde(skip)]
+    pub original: String,
+    #[serde(skip)]
+    pub updated: String,
+}
+
+/// An occurrence of the name that was not rewritten.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SkippedOccurrence {
+    pub path: String,
+    pub line: u32,
+    pub column: u32,
+    pub reason: String,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct RenamePlan {
+    pub symbol: String,
+    pub new_name: String,
+    pub occurrences: usize,
+    pub files: Vec<FileRename>,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub skipped: Vec<SkippedOccurrence>,
+}
+
+/// Plan renaming `symbol` (a bare or qualified name) to `new_name` in the
+/// files indexed for `ref_name`, as they are on disk now.
+pub fn plan_rename(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    new_name: &str,
+) -> Result<RenamePlan, RenameError> {
+    let name = ref_sites::bare_name(symbol);
+    let namesakes = symbols::find_symbols_by_name(conn, project_id, ref_name, name, None)?;
+    let (targets, others): (Vec<SymbolRecord>, Vec<SymbolRecord>) = namesakes
+        .into_iter()
+        .partition(|def| name == symbol || def.qualified_name == symbol);
+    let (sites, others) = if targets.is_empty() {
+        let found = locals::find(conn, project_id, ref_name, symbol)?;
+        if found.is_empty() {
+            return Err(RenameError::NotFound(symbol.to_string()));
+        }
+        check_identifier(new_name, language_of(&found[0].path))?;
+        check_local_rename(conn, project_id, ref_name, symbol, &found, new_name)?;
+        let sites =
+            ref_sites::local_reference_sites(conn, workspace, project_id, ref_name, &found)?;
+        // The scope already decided which occurrences are the local.
+        (sites, Vec::new())
+    } else {
+        check_identifier(new_name, &targets[0].language)?;
+        let sites = symbol_sites(
+            conn, workspace, project_id, ref_name, symbol, &targets, new_name,
+        )?;
+        (sites, others)
+    };
+
+    let mut by_file: BTreeMap<String, Vec<ReferenceSite>> = BTreeMap::new();
+    let mut skipped = Vec::new();
+    for site in sites {
+        match skip_reason(&site, &targets, &others) {
+            Some(reason) => skipped.push(SkippedOccurrence {
+                path: site.path,
+                line: site.line,
+                column: site.column,
+                reason,
+            }),
+            None => by_file.entry(site.path.clone()).or_default().push(site),
+        }
+    }
+
+    let mut files = Vec::new();
+    for (path, mut sites) in by_file {
+        let mut skip = |site: &ReferenceSite, reason: &str| {
+            skipped.push(SkippedOccurrence {
+                path: path.clone(),
+                line: site.line,
+                column: site.column,
+                reason: reason.to_string(),
+            });
+        };
+        let original = match std::fs::read_to_string(workspace.join(&path)) {
+            Ok(original) => original,
+            Err(err) => {
+                let reason = format!("file cannot be read: {err}");
+                for site in &sites {
+                    skip(site, &reason);
+                }
+                continue;
+            }
+        };
+        let language = language_of(&path);
+        let mut lines: Vec<String> = original.split_inclusive('\n').map(str::to_string).collect();
+        let mut occurrences = 0;
+        // Rightmost first, so earlier columns on the line stay valid.
+        sites.sort_by(|a, b| (b.line, b.column).cmp(&(a.line, a.column)));
+        for site in sites {
+            let index = site.line.checked_sub(1).map(|line| line as usize);
+            let Some(line) = index.and_then(|index| lines.get_mut(index)) else {
+                skip(&site, "line is outside the file");
+                continue;
+            };
+            let Some(start) = byte_offset(line, site.column) else {
+                skip(&site, "column is outside the line");
+                continue;
+            };
+            if in_string_literal(&line[..start], language) {
+                skip(&site, "inside a string literal");
+                continue;
+            }
+            // The index may be older than the file: the name must still be
+            // there, as a whole identifier.
+            let end = start + name.len();
+            let whole = line[start..].starts_with(name)
+                && !line[..start]
+                    .chars()
+                    .next_back()
+                    .is_some_and(|c| is_word_char(c, language))
+                && !line[end..]
+                    .chars()
+                    .next()
+                    .is_some_and(|c| is_word_char(c, language));
+            if !whole {
+                skip(&site, "text no longer matches the index");
+                continue;
+            }
+            line.replace_range(start..end, new_name);
+            occurrences += 1;
+        }
+        if occurrences == 0 {
+            continue;
+        }
+        let updated = lines.concat();
+        let diff = unified_diff(&path, &original, &updated);
+        files.push(FileRename {
+            path,
+            occurrences,
+            diff,
+            original,
+            updated,
+        });
+    }
+    skipped.sort_by(|a, b| (&a.path, a.line, a.column).cmp(&(&b.path, b.line, b.column)));
+
+    Ok(RenamePlan {
+        symbol: symbol.to_string(),
+        new_name: new_name.to_string(),
+        occurrences: files.iter().map(|file| file.occurrences).sum(),
+        files,
+        skipped,
+    })
+}
+
+/// Occurrences of the symbol `targets` hold, once it is known to be one
+/// symbol that `new_name` does not collide with.
+fn symbol_sites(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    targets: &[SymbolRecord],
+    new_name: &str,
+) -> Result<Vec<ReferenceSite>, RenameError> {
+    let mut candidates: Vec<String> = targets
+        .iter()
+        .map(|def| def.qualified_name.clone())
+        .collect();
+    candidates.sort();
+    candidates.dedup();
+    if candidates.len() > 1 {
+        return Err(RenameError::Ambiguous {
+            symbol: symbol.to_string(),
+            candidates,
+        });
+    }
+    let existing = symbols::find_symbols_by_name(conn, project_id, ref_name, new_name, None)?;
+    for def in targets {
+        let clash = existing
+            .iter()
+            .find(|existing| parent_dir(&existing.path) == parent_dir(&def.path));
+        if let Some(existing) = clash {
+            return Err(RenameError::Conflict {
+                name: new_name.to_string(),
+                path: existing.path.clone(),
+                line: existing.line_start,
+            });
+        }
+    }
+
+    let sites = ref_sites::find_reference_sites(
+        conn,
+        workspace,
+        project_id,
+        ref_name,
+        &candidates[0],
+        &[],
+    )?;
+    Ok(sites.references)
+}
+
+/// A local renames in one function only, and not onto another local of
+/// that function.
+fn check_local_rename(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    found: &[LocalRecord],
+    new_name: &str,
+) -> Result<(), RenameError> {
+    let mut candidates: Vec<String> = found.iter().map(locals::qualified_name).collect();
+    candidates.sort();
+    candidates.dedup();
+    if candidates.len() > 1 {
+        return Err(RenameError::Ambiguous {
+            symbol: symbol.to_string(),
+            candidates,
+        });
+    }
+    for local in found {
+        let clash = cruxe_state::locals::list_for_file(conn, project_id, ref_name, &local.path)?
+            .into_iter()
+            .find(|other| other.name == new_name && other.symbol_id == local.symbol_id);
+        if let Some(other) = clash {
+            return Err(RenameError::Conflict {
+                name: new_name.to_string(),
+                path: other.path,
+                line: other.line,
+            });
+        }
+    }
+    Ok(())
+}
+
+/// Why an occurrence of a name shared with `others` may not mean the
+/// renamed symbol.
+fn skip_reason(
+    site: &ReferenceSite,
+    targets: &[SymbolRecord],
+    others: &[SymbolRecord],
+) -> Option<String> {
+    if others.is_empty() || site.kind == RefKind::Definition {
+        return None;
+    }
+    if let Some(other) = others
+        .iter()
+        .find(|other| other.path == site.path && other.line_start == site.line)
+    {
+        return Some(format!("declares {}", other.qualified_name));
+    }
+    if site.kind == RefKind::Call {
+        return (!site.resolved).then(|| "call not resolved to the renamed symbol".to_string());
+    }
+    let dir = parent_dir(&site.path);
+    (!targets.iter().any(|def| parent_dir(&def.path) == dir))
+        .then(|| "name is shared with other symbols".to_string())
+}
+
+/// Refuse a `new_name` that is not an identifier in `language`.
+fn check_identifier(new_name: &str, language: &str) -> Result<(), RenameError> {
+    if is_identifier(new_name, language) {
+        return Ok(());
+    }
+    let language = match language {
+        "" => "source",
+        language => language,
+    };
+    Err(RenameError::InvalidName {
+        name: new_name.to_string(),
+        language: language.to_string(),
+    })
+}
+
+/// Whether `name` is a non-keyword identifier in `language`. Only
+/// JavaScript and TypeScript allow `$`; a lone `_` is a pattern in Rust.
+fn is_identifier(name: &str, language: &str) -> bool {
+    let mut chars = name.chars();
+    let well_formed = chars
+        .next()
+        .is_some_and(|first| is_word_char(first, language) && !first.is_numeric())
+        && chars.all(|c| is_word_char(c, language));
+    let reserved = match language {
+        "go" => GO_KEYWORDS,
+        "rust" => RUST_KEYWORDS,
+        "python" => PYTHON_KEYWORDS,
+        "typescript" | "javascript" => TYPESCRIPT_KEYWORDS,
+        _ => &[],
+    };
+    well_formed && !reserved.contains(&name) && !(language == "rust" && name == "_")
+}
+
+/// Whether `c` may appear in an identifier of `language`.
+fn is_word_char(c: char, language: &str) -> bool {
+    c.is_alphanumeric() || c == '_' || (c == '$' && matches!(language, "typescript" | "javascript"))
+}
+
+const GO_KEYWORDS: &[&str] = &[
+    "break",
+    "case",
+    "chan",
+    "const",
+    "continue",
+    "default",
+    "defer",
+    "else",
+    "fallthrough",
+    "for",
+    "func",
+    "go",
+    "goto",
+    "if",
+    "import",
+    "interface",
+    "map",
+    "package",
+    "range",
+    "return",
+    "select",
+    "struct",
+    "switch",
+    "type",
+    "var",
+];
+
+const RUST_KEYWORDS: &[&str] = &[
+    "as", "async", "await", "break", "const", "continue", "crate", "dyn", "else", "enum", "extern",
+    "false", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub",
+    "ref", "return", "self", "Self", "static", "struct", "super", "trait", "true", "type",
+    "unsafe", "use", "where", "while", "abstract", "become", "box", "do", "final", "gen", "macro",
+    "override", "priv", "try", "typeof", "unsized", "virtual", "yield",
+];
+
+const PYTHON_KEYWORDS: &[&str] = &[
+    "False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue",
+    "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import",
+    "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while",
+    "with", "yield",
+];
+
+/// Reserved words, not the contextual keywords (`type`, `async`, ...) that
+/// remain valid names.
+const TYPESCRIPT_KEYWORDS: &[&str] = &[
+    "break",
+    "case",
+    "catch",
+    "class",
+    "const",
+    "continue",
+    "debugger",
+    "default",
+    "delete",
+    "do",
+    "else",
+    "enum",
+    "export",
+    "extends",
+    "false",
+    "finally",
+    "for",
+    "function",
+    "if",
+    "import",
+    "in",
+    "instanceof",
+    "new",
+    "null",
+    "return",
+    "super",
+    "switch",
+    "this",
+    "throw",
+    "true",
+    "try",
+    "typeof",
+    "var",
+    "void",
+    "while",
+    "with",
+];
+
+fn parent_dir(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+fn language_of(path: &str) -> &'static str {
+    Path::new(path)
+        .extension()
+        .and_then(|ext| ext.to_str())
+        .and_then(languages::detect_language_from_extension)
+        .unwrap_or_default()
+}
+
+/// Byte offset of the 1-based character `column` of `line`.
+fn byte_offset(line: &str, column: u32) -> Option<usize> {
+    line.char_indices()
+        .nth(column.checked_sub(1)? as usize)
+        .map(|(offset, _)| offset)
+}
+
+/// Whether a string literal is still open at the end of `prefix`, the part
+/// of a line before an occurrence.
+fn in_string_literal(prefix: &str, language: &str) -> bool {
+    let delimiters: &[char] = match language {
+        "go" | "javascript" | "typescript" => &['"', '\'', '`'],
+        "python" => &['"', '\''],
+        // `'` also starts Rust lifetimes.
+        _ => &['"'],
+    };
+    let mut open: Option<char> = None;
+    let mut escaped = false;
+    for c in prefix.chars() {
+        match open {
+            Some(quote) => {
+                if escaped {
+                    escaped = false;
+                } else if c == '\\' && quote != '`' {
+                    escaped = true;
+                } else if c == quote {
+                    open = None;
+                }
+            }
+            None if delimiters.contains(&c) => open = Some(c),
+            None => {}
+        }
+    }
+    open.is_some()
+}
+
+/// A unified diff of `old` to `new`, which have the same lines apart from
+/// in-place edits.
+fn unified_diff(path: &str, old: &str, new: &str) -> String {
+    let old_lines: Vec<&str> = old.split_inclusive('\n').collect();
+    let new_lines: Vec<&str> = new.split_inclusive('\n').collect();
+    let changed: Vec<usize> = (0..old_lines.len())
+        .filter(|&idx| old_lines[idx] != new_lines[idx])
+        .collect();
+    let mut out = format!("--- a/{path}\n+++ b/{path}\n");
+    let mut idx = 0;
+    while idx < changed.len() {
+        let start = changed[idx].saturating_sub(DIFF_CONTEXT);
+        let mut end = changed[idx];
+        // Changes closer than twice the context share a hunk.
+        while idx + 1 < changed.len() && changed[idx + 1] <= end + 2 * DIFF_CONTEXT + 1 {
+            idx += 1;
+            end = changed[idx];
+        }
+        let end = (end + DIFF_CONTEXT + 1).min(old_lines.len());
+        let count = end - start;
+        out.push_str(&format!(
+            "@@ -{},{count} +{},{count} @@\n",
+            start + 1,
+            start + 1
+        ));
+        for line in start..end {
+            if old_lines[line] == new_lines[line] {
+                push_diff_line(&mut out, ' ', old_lines[line]);
+            } else {
+                push_diff_line(&mut out, '-', old_lines[line]);
+                push_diff_line(&mut out, '+', new_lines[line]);
+            }
+        }
+        idx += 1;
+    }
+    out
+}
+
+fn push_diff_line(out: &mut String, marker: char, line: &str) {
+    out.push(marker);
+    out.push_str(line);
+    if !line.ends_with('\n') {
+        out.push_str("\n\\ No newline at end of file\n");
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{LocalUse, SymbolKind};
+    use cruxe_state::manifest::{self, ManifestEntry};
+    use cruxe_state::{db, schema};
+
+    fn symbol(qualified_name: &str, path: &str, line_start: u32, line_end: u32) -> SymbolRecord {
+        let name = qualified_name.rsplit('.').next().unwrap();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified_name}"),
+            symbol_stable_id: format!("stable::{qualified_name}"),
+            name: name.to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind: SymbolKind::Struct,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn add_file(conn: &Connection, workspace: &Path, path: &str, content: &str) {
+        let file = workspace.join(path);
+        std::fs::create_dir_all(file.parent().unwrap()).unwrap();
+        std::fs::write(file, content).unwrap();
+        manifest::upsert_manifest(
+            conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn renames_code_but_not_struct_tags() {
+        let dir = tempfile::tempdir().unwrap();
+        let workspace = dir.path();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        add_file(
+            &conn,
+            workspace,
+            "api/user.go",
+            "package api\n\ntype Account struct {\n\tID string `json:\"Account\"`\n}\n",
+        );
+        add_file(
+            &conn,
+            workspace,
+            "api/handler.go",
+            "package api\n\nfunc load() *Account {\n\treturn &Account{}\n}\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("api.Account", "api/user.go", 3, 5)).unwrap();
+
+        let plan = plan_rename(&conn, workspace, "repo", "main", "Account", "User").unwrap();
+        assert_eq!(plan.occurrences, 3);
+        assert_eq!(plan.files.len(), 2);
+        let user = plan.files.iter().find(|f| f.path == "api/user.go").unwrap();
+        assert_eq!(
+            user.updated,
+            "package api\n\ntype User struct {\n\tID string `json:\"Account\"`\n}\n"
+        );
+        assert!(
+            user.diff
+                .contains("-type Account struct {\n+type User struct {\n"),
+            "{}",
+            user.diff
+        );
+        assert!(
+            user.diff
+                .starts_with("--- a/api/user.go\n+++ b/api/user.go\n@@ -1,5 +1,5 @@\n")
+        );
+        assert_eq!(plan.skipped.len(), 1);
+        assert_eq!(plan.skipped[0].reason, "inside a string literal");
+
+        assert!(matches!(
+            plan_rename(&conn, workspace, "repo", "main", "Account", "9lives"),
+            Err(RenameError::InvalidName { .. })
+        ));
+        // Go has no `$` in names and reserves its keywords.
+        for invalid in ["$user", "User$", "func"] {
+            assert!(matches!(
+                plan_rename(&conn, workspace, "repo", "main", "Account", invalid),
+                Err(RenameError::InvalidName { .. })
+            ));
+        }
+        assert!(matches!(
+            plan_rename(&conn, workspace, "repo", "main", "Missing", "Other"),
+            Err(RenameError::NotFound(_))
+        ));
+    }
+
+    #[test]
+    fn names_shared_with_other_symbols_need_care() {
+        let dir = tempfile::tempdir().unwrap();
+        let workspace = dir.path();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        add_file(
+            &conn,
+            workspace,
+            "api/user.go",
+            "package api\n\ntype Account struct{}\n",
+        );
+        add_file(
+            &conn,
+            workspace,
+            "db/row.go",
+            "package db\n\ntype Account struct{}\n",
+        );
+        add_file(
+            &conn,
+            workspace,
+            "db/load.go",
+            "package db\n\nvar a Account\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("api.Account", "api/user.go", 3, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("db.Account", "db/row.go", 3, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("api.User", "api/user.go", 5, 5)).unwrap();
+
+        assert!(matches!(
+            plan_rename(&conn, workspace, "repo", "main", "Account", "Member"),
+            Err(RenameError::Ambiguous { .. })
+        ));
+        assert!(matches!(
+            plan_rename(&conn, workspace, "repo", "main", "api.Account", "User"),
+            Err(RenameError::Conflict { .. })
+        ));
+
+        let plan = plan_rename(&conn, workspace, "repo", "main", "api.Account", "Member").unwrap();
+        assert_eq!(plan.files.len(), 1);
+        assert_eq!(plan.files[0].path, "api/user.go");
+        let reasons: Vec<&str> = plan.skipped.iter().map(|s| s.reason.as_str()).collect();
+        assert_eq!(
+            reasons,
+            ["name is shared with other symbols", "declares db.Account"]
+        );
+    }
+    #[test]
+    fn renames_a_local_within_its_scope() {
+        let dir = tempfile::tempdir().unwrap();
+        let workspace = dir.path();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        add_file(
+            &conn,
+            workspace,
+            "api/handler.go",
+            "package api\n\nvar claims = 1\n\nfunc Handle(token string) {\n\tclaims := parse(token)\n\tuse(claims, token)\n}\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("api.claims", "api/handler.go", 3, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("api.Handle", "api/handler.go", 5, 8)).unwrap();
+        let local = |name: &str, kind: &str, uses: &[(u32, u32)]| LocalRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: "api/handler.go".to_string(),
+            name: name.to_string(),
+            kind: kind.to_string(),
+            line: uses[0].0,
+            column: uses[0].1,
+            symbol_id: Some("stable::api.Handle".to_string()),
+            symbol: Some("api.Handle".to_string()),
+            uses: uses
+                .iter()
+                .map(|&(line, column)| LocalUse {
+                    line,
+                    column,
+                    write: false,
+                })
+                .collect(),
+        };
+        cruxe_state::locals::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "api/handler.go",
+            &[
+                local("token", "parameter", &[(5, 13), (6, 18), (7, 14)]),
+                local("claims", "local", &[(6, 2), (7, 6)]),
+            ],
+        )
+        .unwrap();
+
+        assert!(matches!(
+            plan_rename(&conn, workspace, "repo", "main", "Handle.claims", "token"),
+            Err(RenameError::Conflict { line: 5, .. })
+        ));
+        let plan =
+            plan_rename(&conn, workspace, "repo", "main", "Handle.claims", "parsed").unwrap();
+        assert_eq!(plan.occurrences, 2);
+        assert_eq!(
+            plan.files[0].updated,
+            "package api\n\nvar claims = 1\n\nfunc Handle(token string) {\n\tparsed := parse(token)\n\tuse(parsed, token)\n}\n"
+        );
+
+        // The global is not renamed where the local shadows it.
+        let plan = plan_rename(&conn, workspace, "repo", "main", "api.claims", "count").unwrap();
+        assert_eq!(plan.occurrences, 1);
+    }
+
+    #[test]
+    fn stale_sites_are_skipped_not_rewritten() {
+        let dir = tempfile::tempdir().unwrap();
+        let workspace = dir.path();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        // Indexed as `foo := 1` / `use(foo)`; edited since.
+        add_file(
+            &conn,
+            workspace,
+            "api/run.go",
+            "package api\n\nfunc Run() {\n\tfoobar := 1\n\tuse(x)\n}\n",
+        );
+        symbols::insert_symbol(&conn, &symbol("api.Run", "api/run.go", 3, 6)).unwrap();
+        let local = LocalRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: "api/run.go".to_string(),
+            name: "foo".to_string(),
+            kind: "local".to_string(),
+            line: 4,
+            column: 2,
+            symbol_id: Some("stable::api.Run".to_string()),
+            symbol: Some("api.Run".to_string()),
+            uses: [(4, 2), (5, 6), (5, 40), (9, 1)]
+                .into_iter()
+                .map(|(line, column)| LocalUse {
+                    line,
+                    column,
+                    write: false,
+                })
+                .collect(),
+        };
+        cruxe_state::locals::replace_for_file(&conn, "repo", "main", "api/run.go", &[local])
+            .unwrap();
+
+        let plan = plan_rename(&conn, workspace, "repo", "main", "Run.foo", "bar").unwrap();
+        assert_eq!(plan.occurrences, 0);
+        assert!(plan.files.is_empty());
+        let skipped: Vec<(u32, &str)> = plan
+            .skipped
+            .iter()
+            .map(|s| (s.line, s.reason.as_str()))
+            .collect();
+        assert_eq!(
+            skipped,
+            [
+                (4, "text no longer matches the index"),
+                (5, "text no longer matches the index"),
+                (5, "column is outside the line"),
+                (9, "line is outside the file"),
+            ]
+        );
+
+        std::fs::remove_file(workspace.join("api/run.go")).unwrap();
+        let plan = plan_rename(&conn, workspace, "repo", "main", "Run.foo", "bar").unwrap();
+        assert_eq!(plan.skipped.len(), 4);
+        assert!(
+            plan.skipped
+                .iter()
+                .all(|s| s.reason.starts_with("file cannot be read"))
+        );
+    }
+}
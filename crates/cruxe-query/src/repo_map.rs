@@ -0,0 +1,658 @@
+//! A ranked, compressed overview of the repository for coding agents, for
+//! `cruxe map`: the signatures of the most important types and functions,
+//! grouped by file, cut to a token budget.
+//!
+//! Importance is PageRank over a graph of symbols: a call or an import is
+//! an edge from the caller (or importing file) to the callee, and a
+//! signature naming a type is a lighter edge to that type. A type also
+//! collects the rank of its methods. Calls made by tests are left out, so
+//! heavily tested helpers do not outrank the code that uses them. As many
+//! symbols as fit the budget are shown, most important first; a method
+//! brings its type's line along for context.
+
+use crate::deps::package_name;
+use crate::impact::is_test_path;
+use cruxe_core::error::StateError;
+use cruxe_core::tokens::estimate_tokens;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{edges, generated_files, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fmt::Write as _;
+
+pub const DEFAULT_BUDGET_TOKENS: usize = 1024;
+
+const FILE_SOURCE_PREFIX: &str = "file::";
+const DAMPING: f64 = 0.85;
+const MAX_ITERATIONS: usize = 50;
+const TOLERANCE: f64 = 1e-9;
+/// Weight of a signature naming a type, relative to a call.
+const SIGNATURE_EDGE_WEIGHT: f64 = 0.5;
+const MAX_SIGNATURE_CHARS: usize = 160;
+const MAX_PACKAGES_LISTED: usize = 12;
+
+#[derive(Debug, thiserror::Error)]
+pub enum RepoMapError {
+    #[error("ref `{0}` has no indexed symbols")]
+    RefNotIndexed(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct RepoMapOptions {
+    pub budget_tokens: usize,
+    /// Only symbols of files in scope are shown; the whole graph still
+    /// counts toward their importance.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct MapSymbol {
+    pub qualified_name: String,
+    pub kind: String,
+    pub line: u32,
+    pub signature: String,
+    /// Relative to the most important symbol (1.0).
+    pub importance: f64,
+    /// Qualified name of the type the symbol is listed under.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub parent: Option<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct MapFile {
+    pub path: String,
+    pub package: String,
+    /// Fraction of the importance of every eligible symbol.
+    pub share: f64,
+    /// In source order, members right after their type.
+    pub symbols: Vec<MapSymbol>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct MapPackage {
+    pub name: String,
+    pub share: f64,
+    pub files: usize,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, JsonSchema)]
+pub struct RepoMap {
+    #[serde(rename = "ref")]
+    pub ref_name: String,
+    pub budget_tokens: usize,
+    pub used_tokens: usize,
+    /// Types and functions that could be shown.
+    pub symbols_total: usize,
+    pub symbols_shown: usize,
+    /// Most important first.
+    pub packages: Vec<MapPackage>,
+    /// Most important first.
+    pub files: Vec<MapFile>,
+}
+
+/// Rank the symbols of a ref and keep the most important ones that fit in
+/// `options.budget_tokens` once rendered with [`render_text`].
+pub fn build_repo_map(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &RepoMapOptions,
+) -> Result<RepoMap, RepoMapError> {
+    let records = symbols::list_symbols_for_ref(conn, repo, ref_name)?;
+    if records.is_empty() {
+        return Err(RepoMapError::RefNotIndexed(ref_name.to_string()));
+    }
+    let generated = generated_files::paths_for_ref(conn, repo, ref_name)?;
+
+    let mut by_id: HashMap<&str, usize> = HashMap::new();
+    let mut types_by_name: HashMap<&str, Vec<usize>> = HashMap::new();
+    for (idx, record) in records.iter().enumerate() {
+        by_id.insert(record.symbol_stable_id.as_str(), idx);
+        by_id.entry(record.symbol_id.as_str()).or_insert(idx);
+        if is_type(record.kind) {
+            types_by_name
+                .entry(record.name.as_str())
+                .or_default()
+                .push(idx);
+        }
+    }
+    let parent_of: Vec<Option<usize>> = records
+        .iter()
+        .map(|record| {
+            record
+                .parent_symbol_id
+                .as_deref()
+                .and_then(|parent| by_id.get(parent).copied())
+        })
+        .collect();
+
+    // Importing files are nodes of their own, after the symbols.
+    let mut file_nodes: HashMap<String, usize> = HashMap::new();
+    let mut weights: HashMap<(usize, usize), f64> = HashMap::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        if edge.edge_type != "calls" && edge.edge_type != "imports" {
+            return Ok(());
+        }
+        let Some(&to) = edge.to_symbol_id.as_deref().and_then(|id| by_id.get(id)) else {
+            return Ok(());
+        };
+        let from = match edge.from_symbol_id.strip_prefix(FILE_SOURCE_PREFIX) {
+            Some(path) if is_test_path(path) => return Ok(()),
+            Some(path) => {
+                let next = records.len() + file_nodes.len();
+                *file_nodes.entry(path.to_string()).or_insert(next)
+            }
+            None => match by_id.get(edge.from_symbol_id.as_str()) {
+                Some(&from) if !is_test_path(&records[from].path) => from,
+                _ => return Ok(()),
+            },
+        };
+        if from != to {
+            *weights.entry((from, to)).or_default() += 1.0;
+        }
+        Ok(())
+    })?;
+    for (idx, record) in records.iter().enumerate() {
+        if is_test_path(&record.path) {
+            continue;
+        }
+        let Some(signature) = record.signature.as_deref() else {
+            continue;
+        };
+        let names: HashSet<&str> = signature
+            .split(|c: char| !(c.is_alphanumeric() || c == '_'))
+            .filter(|word| !word.is_empty() && *word != record.name)
+            .collect();
+        for name in names {
+            let Some(targets) = types_by_name.get(name) else {
+                continue;
+            };
+            let weight = SIGNATURE_EDGE_WEIGHT / targets.len() as f64;
+            for &target in targets {
+                if target != idx {
+                    *weights.entry((idx, target)).or_default() += weight;
+                }
+            }
+        }
+    }
+
+    let ranks = pagerank(records.len() + file_nodes.len(), &weights);
+    let mut scores: Vec<f64> = ranks[..records.len()].to_vec();
+    for (idx, parent) in parent_of.iter().enumerate() {
+        if let Some(parent) = *parent
+            && is_type(records[parent].kind)
+        {
+            scores[parent] += ranks[idx];
+        }
+    }
+
+    let mut eligible: Vec<usize> = (0..records.len())
+        .filter(|&idx| {
+            let record = &records[idx];
+            (is_type(record.kind) || is_callable(record.kind))
+                && !parent_of[idx].is_some_and(|parent| is_callable(records[parent].kind))
+                && !is_test_path(&record.path)
+                && !generated.contains(&record.path)
+                && options.scope.contains(&record.path)
+        })
+        .collect();
+    eligible.sort_by(|&a, &b| {
+        scores[b]
+            .total_cmp(&scores[a])
+            .then_with(|| records[a].path.cmp(&records[b].path))
+            .then_with(|| records[a].line_start.cmp(&records[b].line_start))
+    });
+
+    let total: f64 = eligible.iter().map(|&idx| scores[idx]).sum();
+    let top = eligible.first().map_or(0.0, |&idx| scores[idx]);
+    let mut file_scores: HashMap<&str, f64> = HashMap::new();
+    let mut package_scores: BTreeMap<String, (f64, HashSet<&str>)> = BTreeMap::new();
+    for &idx in &eligible {
+        let path = records[idx].path.as_str();
+        *file_scores.entry(path).or_default() += scores[idx];
+        let package = package_scores
+            .entry(package_name(path, 0))
+            .or_insert_with(|| (0.0, HashSet::new()));
+        package.0 += scores[idx];
+        package.1.insert(path);
+    }
+    let share = |score: f64| if total > 0.0 { score / total } else { 0.0 };
+    let mut packages: Vec<MapPackage> = package_scores
+        .into_iter()
+        .map(|(name, (score, files))| MapPackage {
+            name,
+            share: share(score),
+            files: files.len(),
+        })
+        .collect();
+    packages.sort_by(|a, b| {
+        b.share
+            .total_cmp(&a.share)
+            .then_with(|| a.name.cmp(&b.name))
+    });
+
+    let ranked = Ranked {
+        records: &records,
+        scores: &scores,
+        parent_of: &parent_of,
+        top,
+        total,
+        file_scores: &file_scores,
+    };
+    let layout = |count: usize| {
+        let mut map = RepoMap {
+            ref_name: ref_name.to_string(),
+            budget_tokens: options.budget_tokens,
+            used_tokens: 0,
+            symbols_total: eligible.len(),
+            symbols_shown: 0,
+            packages: packages.clone(),
+            files: ranked.files(&eligible[..count]),
+        };
+        map.symbols_shown = map.files.iter().map(|file| file.symbols.len()).sum();
+        map.used_tokens = estimate_tokens(&render_text(&map));
+        map
+    };
+
+    // The most symbols whose rendering fits the budget.
+    let (mut low, mut high) = (0, eligible.len());
+    while low < high {
+        let mid = (low + high).div_ceil(2);
+        if layout(mid).used_tokens <= options.budget_tokens {
+            low = mid;
+        } else {
+            high = mid - 1;
+        }
+    }
+    Ok(layout(low))
+}
+
+/// Ranked symbols, laid out into files.
+struct Ranked<'a> {
+    records: &'a [SymbolRecord],
+    scores: &'a [f64],
+    parent_of: &'a [Option<usize>],
+    top: f64,
+    total: f64,
+    file_scores: &'a HashMap<&'a str, f64>,
+}
+
+impl Ranked<'_> {
+    /// Files of the `chosen` symbols and of the types of chosen members,
+    /// most important file first.
+    fn files(&self, chosen: &[usize]) -> Vec<MapFile> {
+        let mut shown: HashSet<usize> = chosen.iter().copied().collect();
+        for &idx in chosen {
+            if let Some(parent) = self.parent_of[idx]
+                && is_type(self.records[parent].kind)
+                && self.records[parent].path == self.records[idx].path
+            {
+                shown.insert(parent);
+            }
+        }
+        let mut by_file: BTreeMap<&str, Vec<usize>> = BTreeMap::new();
+        for &idx in &shown {
+            by_file
+                .entry(self.records[idx].path.as_str())
+                .or_default()
+                .push(idx);
+        }
+
+        let mut files: Vec<MapFile> = by_file
+            .into_iter()
+            .map(|(path, mut members)| {
+                members.sort_by_key(|&idx| (self.records[idx].line_start, idx));
+                let nested =
+                    |idx: usize| self.parent_of[idx].filter(|parent| shown.contains(parent));
+                let mut ordered = Vec::new();
+                for &idx in members.iter().filter(|&&idx| nested(idx).is_none()) {
+                    ordered.push(self.symbol(idx, None));
+                    for &member in members
+                        .iter()
+                        .filter(|&&member| nested(member) == Some(idx))
+                    {
+                        ordered.push(self.symbol(member, Some(idx)));
+                    }
+                }
+                MapFile {
+                    path: path.to_string(),
+                    package: package_name(path, 0),
+                    share: if self.total > 0.0 {
+                        self.file_scores.get(path).copied().unwrap_or(0.0) / self.total
+                    } else {
+                        0.0
+                    },
+                    symbols: ordered,
+                }
+            })
+            .collect();
+        files.sort_by(|a, b| {
+            b.share
+                .total_cmp(&a.share)
+                .then_with(|| a.path.cmp(&b.path))
+        });
+        files
+    }
+
+    fn symbol(&self, idx: usize, parent: Option<usize>) -> MapSymbol {
+        let record = &self.records[idx];
+        MapSymbol {
+            qualified_name: record.qualified_name.clone(),
+            kind: record.kind.as_str().to_string(),
+            line: record.line_start,
+            signature: signature_line(record),
+            importance: if self.top > 0.0 {
+                self.scores[idx] / self.top
+            } else {
+                0.0
+            },
+            parent: parent.map(|parent| self.records[parent].qualified_name.clone()),
+        }
+    }
+}
+
+/// PageRank with uniform teleport; the rank of nodes without outgoing
+/// edges is spread over every node.
+fn pagerank(nodes: usize, weights: &HashMap<(usize, usize), f64>) -> Vec<f64> {
+    if nodes == 0 {
+        return Vec::new();
+    }
+    let mut outgoing: Vec<Vec<(usize, f64)>> = vec![Vec::new(); nodes];
+    let mut out_weight = vec![0.0; nodes];
+    for (&(from, to), &weight) in weights {
+        outgoing[from].push((to, weight));
+        out_weight[from] += weight;
+    }
+    let base = (1.0 - DAMPING) / nodes as f64;
+    let mut rank = vec![1.0 / nodes as f64; nodes];
+    for _ in 0..MAX_ITERATIONS {
+        let dangling: f64 = (0..nodes)
+            .filter(|&node| out_weight[node] == 0.0)
+            .map(|node| rank[node])
+            .sum();
+        let mut next = vec![base + DAMPING * dangling / nodes as f64; nodes];
+        for (from, targets) in outgoing.iter().enumerate() {
+            for &(to, weight) in targets {
+                next[to] += DAMPING * rank[from] * weight / out_weight[from];
+            }
+        }
+        let delta: f64 = next
+            .iter()
+            .zip(&rank)
+            .map(|(next, rank)| (next - rank).abs())
+            .sum();
+        rank = next;
+        if delta < TOLERANCE {
+            break;
+        }
+    }
+    rank
+}
+
+/// The first line of the signature without the opening brace, or the kind
+/// and name when none was recorded.
+fn signature_line(record: &SymbolRecord) -> String {
+    let line = record
+        .signature
+        .as_deref()
+        .and_then(|signature| signature.lines().next())
+        .map(|line| line.trim().trim_end_matches('{').trim_end())
+        .filter(|line| !line.is_empty());
+    let Some(line) = line else {
+        return format!("{} {}", record.kind.as_str(), record.name);
+    };
+    if line.chars().count() <= MAX_SIGNATURE_CHARS {
+        return line.to_string();
+    }
+    let cut: String = line.chars().take(MAX_SIGNATURE_CHARS).collect();
+    format!("{}...", cut.trim_end())
+}
+
+fn is_type(kind: SymbolKind) -> bool {
+    matches!(
+        kind,
+        SymbolKind::Struct
+            | SymbolKind::Class
+            | SymbolKind::Enum
+            | SymbolKind::Trait
+            | SymbolKind::Interface
+            | SymbolKind::TypeAlias
+    )
+}
+
+fn is_callable(kind: SymbolKind) -> bool {
+    matches!(kind, SymbolKind::Function | SymbolKind::Method)
+}
+
+/// The map as compact text: the packages by importance, then each file
+/// with its signatures, members indented under their type.
+pub fn render_text(map: &RepoMap) -> String {
+    let mut out = String::new();
+    if !map.packages.is_empty() {
+        let listed: Vec<String> = map
+            .packages
+            .iter()
+            .take(MAX_PACKAGES_LISTED)
+            .map(|package| format!("{} ({:.0}%)", package.name, package.share * 100.0))
+            .collect();
+        let _ = writeln!(out, "Packages by importance: {}", listed.join(", "));
+    }
+    for file in &map.files {
+        let _ = writeln!(out);
+        let _ = writeln!(out, "{}:", file.path);
+        for symbol in &file.symbols {
+            let indent = if symbol.parent.is_some() {
+                "    "
+            } else {
+                "  "
+            };
+            let _ = writeln!(out, "{indent}{}", symbol.signature);
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::{db, schema};
+
+    fn record(
+        path: &str,
+        qualified_name: &str,
+        kind: SymbolKind,
+        line: u32,
+        signature: &str,
+        parent: Option<&str>,
+    ) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified_name}"),
+            symbol_stable_id: format!("stable::{qualified_name}"),
+            name: qualified_name.rsplit('.').next().unwrap().to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind,
+            signature: Some(signature.to_string()),
+            line_start: line,
+            line_end: line + 5,
+            parent_symbol_id: parent.map(|parent| format!("stable::{parent}")),
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: &str) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: Some(format!("stable::{to}")),
+            to_name: Some(to.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: String::new(),
+            source_line: 1,
+        }
+    }
+
+    fn indexed() -> (tempfile::TempDir, Connection) {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            record(
+                "auth/token.go",
+                "Claims",
+                SymbolKind::Struct,
+                5,
+                "type Claims struct {",
+                None,
+            ),
+            record(
+                "auth/token.go",
+                "Claims.IsExpired",
+                SymbolKind::Method,
+                10,
+                "func (c *Claims) IsExpired() bool {",
+                Some("Claims"),
+            ),
+            record(
+                "auth/token.go",
+                "ValidateToken",
+                SymbolKind::Function,
+                20,
+                "func ValidateToken(header string) (*Claims, error) {",
+                None,
+            ),
+            record(
+                "api/handler.go",
+                "Login",
+                SymbolKind::Function,
+                3,
+                "func Login(w http.ResponseWriter, r *http.Request) {",
+                None,
+            ),
+            record(
+                "api/handler.go",
+                "Logout",
+                SymbolKind::Function,
+                20,
+                "func Logout(w http.ResponseWriter, r *http.Request) {",
+                None,
+            ),
+            record(
+                "api/handler.go",
+                "helper",
+                SymbolKind::Function,
+                40,
+                "func helper() {",
+                None,
+            ),
+            record(
+                "auth/token_test.go",
+                "TestValidateToken",
+                SymbolKind::Function,
+                3,
+                "func TestValidateToken(t *testing.T) {",
+                None,
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("Login", "ValidateToken"),
+                call("Logout", "ValidateToken"),
+                call("ValidateToken", "Claims.IsExpired"),
+                call("TestValidateToken", "helper"),
+            ],
+        )
+        .unwrap();
+        (dir, conn)
+    }
+
+    #[test]
+    fn called_code_ranks_first_and_members_nest_under_their_type() {
+        let (_dir, conn) = indexed();
+        let options = RepoMapOptions {
+            budget_tokens: 10_000,
+            ..RepoMapOptions::default()
+        };
+        let map = build_repo_map(&conn, "repo", "main", &options).unwrap();
+        assert_eq!(map.symbols_total, 6);
+        assert_eq!(map.symbols_shown, 6);
+        assert_eq!(map.files[0].path, "auth/token.go");
+        assert_eq!(map.packages[0].name, "auth");
+
+        let importance: HashMap<&str, f64> = map
+            .files
+            .iter()
+            .flat_map(|file| &file.symbols)
+            .map(|symbol| (symbol.qualified_name.as_str(), symbol.importance))
+            .collect();
+        assert!(importance["ValidateToken"] > importance["Login"]);
+        assert!(importance["Claims"] > importance["Claims.IsExpired"]);
+        // A call from a test does not lift `helper` above its neighbours.
+        assert!((importance["helper"] - importance["Login"]).abs() < 1e-9);
+        assert!(!importance.contains_key("TestValidateToken"));
+
+        let text = render_text(&map);
+        assert!(
+            text.contains("auth/token.go:\n  type Claims struct\n    func (c *Claims) IsExpired() bool\n  func ValidateToken(header string) (*Claims, error)\n"),
+            "{text}"
+        );
+    }
+
+    #[test]
+    fn the_map_fits_the_budget() {
+        let (_dir, conn) = indexed();
+        let options = RepoMapOptions {
+            budget_tokens: 20,
+            ..RepoMapOptions::default()
+        };
+        let map = build_repo_map(&conn, "repo", "main", &options).unwrap();
+        assert!(map.used_tokens <= 20, "{}", render_text(&map));
+        assert!(map.symbols_shown > 0 && map.symbols_shown < map.symbols_total);
+        assert_eq!(map.used_tokens, estimate_tokens(&render_text(&map)));
+        // A member shown brings its type along.
+        for file in &map.files {
+            for symbol in &file.symbols {
+                if let Some(parent) = &symbol.parent {
+                    assert!(
+                        file.symbols
+                            .iter()
+                            .any(|other| &other.qualified_name == parent)
+                    );
+                }
+            }
+        }
+
+        let empty = RepoMapOptions {
+            budget_tokens: 0,
+            ..RepoMapOptions::default()
+        };
+        assert_eq!(
+            build_repo_map(&conn, "repo", "main", &empty)
+                .unwrap()
+                .symbols_shown,
+            0
+        );
+        assert!(matches!(
+            build_repo_map(&conn, "repo", "dev", &options),
+            Err(RepoMapError::RefNotIndexed(_))
+        ));
+    }
+}
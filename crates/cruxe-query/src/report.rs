@@ -0,0 +1,799 @@
+//! Architecture report built from a [`GraphSnapshot`], rendered as Markdown
+//! for design docs and reviews (`cruxe report`).
+//!
+//! Packages are the directories used by the graph export. Dead code is a
+//! heuristic: functions and methods with no incoming edge, minus obvious
+//! entry points. Calls through traits, reflection or FFI are invisible to the
+//! index, so the section lists candidates, not verdicts.
+//!
+//! The SQL tables section comes from SQL strings embedded in the code, not
+//! from the graph, and is filled in with [`sql_table_usage`]. The embedded
+//! assets section attributes the bytes `//go:embed` adds to a Go binary to
+//! the directives that add them; see [`embedded_asset_usage`].
+
+use crate::graph_export::{GraphNode, GraphSnapshot};
+use cruxe_core::types::{EmbedRecord, InjectionRecord};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+use std::fmt::Write as _;
+
+/// Display name for files at the repository root.
+pub(crate) const ROOT_PACKAGE: &str = ".";
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ReportFormat {
+    Markdown,
+}
+
+impl ReportFormat {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "markdown" | "md" => Some(Self::Markdown),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Markdown => "markdown",
+        }
+    }
+}
+
+#[derive(Debug, Clone)]
+pub struct ReportOptions {
+    /// Rows per ranked section (largest, most connected, dead code).
+    pub top: usize,
+}
+
+impl Default for ReportOptions {
+    fn default() -> Self {
+        Self { top: 10 }
+    }
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct ReportTotals {
+    pub symbols: usize,
+    pub files: usize,
+    pub packages: usize,
+    pub edges: usize,
+    pub unresolved_edges: usize,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PackageSummary {
+    pub package: String,
+    pub files: usize,
+    pub symbols: usize,
+    pub loc: u64,
+    pub languages: Vec<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SymbolMetric {
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line_start: u32,
+    pub loc: u32,
+    pub fan_in: usize,
+    pub fan_out: usize,
+}
+
+/// A table named in embedded SQL strings.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct SqlTableUsage {
+    pub table: String,
+    pub statements: usize,
+    pub files: Vec<String>,
+}
+
+/// Files one `//go:embed` directive compiles into the binary.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct EmbeddedAssets {
+    pub package: String,
+    pub variable: String,
+    pub path: String,
+    pub line: u32,
+    pub files: usize,
+    pub bytes: u64,
+    /// Of `bytes`, those in files nothing refers to by name.
+    pub unreferenced_bytes: u64,
+}
+
+/// Edges from one package to another.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PackageDependency {
+    pub from: String,
+    pub to: String,
+    pub edges: usize,
+}
+
+#[derive(Debug, Clone, Serialize)]
+pub struct ArchitectureReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub totals: ReportTotals,
+    pub packages: Vec<PackageSummary>,
+    pub largest: Vec<SymbolMetric>,
+    pub most_connected: Vec<SymbolMetric>,
+    pub dependencies: Vec<PackageDependency>,
+    /// Strongly connected groups of packages, each sorted by name.
+    pub cycles: Vec<Vec<String>>,
+    pub dead_code: Vec<SymbolMetric>,
+    /// All dead-code candidates, of which `dead_code` lists the largest.
+    pub dead_code_total: usize,
+    /// Tables used by embedded SQL, most used first; empty when the code
+    /// has none or they were not loaded.
+    pub sql_tables: Vec<SqlTableUsage>,
+    /// Embed directives, largest first; empty when there are none or they
+    /// were not loaded.
+    pub embedded_assets: Vec<EmbeddedAssets>,
+    /// Bytes embedded by every directive, of which `embedded_assets` lists
+    /// the largest.
+    pub embedded_bytes_total: u64,
+}
+
+pub fn build_report(snapshot: &GraphSnapshot, options: &ReportOptions) -> ArchitectureReport {
+    let index: HashMap<&str, &GraphNode> = snapshot
+        .nodes
+        .iter()
+        .map(|node| (node.id.as_str(), node))
+        .collect();
+    let mut fan_in: HashMap<&str, usize> = HashMap::new();
+    let mut fan_out: HashMap<&str, usize> = HashMap::new();
+    let mut dependencies: BTreeMap<(String, String), usize> = BTreeMap::new();
+    for edge in &snapshot.edges {
+        if edge.source == edge.target {
+            continue;
+        }
+        *fan_out.entry(edge.source.as_str()).or_default() += 1;
+        *fan_in.entry(edge.target.as_str()).or_default() += 1;
+
+        let (Some(source), Some(target)) = (
+            index.get(edge.source.as_str()),
+            index.get(edge.target.as_str()),
+        ) else {
+            continue;
+        };
+        if source.kind == "unknown" || target.kind == "unknown" {
+            continue;
+        }
+        let (from, to) = (package_name(source), package_name(target));
+        if from != to {
+            *dependencies.entry((from, to)).or_default() += 1;
+        }
+    }
+
+    let symbols: Vec<&GraphNode> = snapshot
+        .nodes
+        .iter()
+        .filter(|node| is_symbol(node))
+        .collect();
+    let metric = |node: &GraphNode| SymbolMetric {
+        qualified_name: node.qualified_name.clone(),
+        kind: node.kind.clone(),
+        path: node.path.clone(),
+        line_start: node.line_start,
+        loc: node.loc(),
+        fan_in: fan_in.get(node.id.as_str()).copied().unwrap_or(0),
+        fan_out: fan_out.get(node.id.as_str()).copied().unwrap_or(0),
+    };
+    let ranked = |mut metrics: Vec<SymbolMetric>, key: fn(&SymbolMetric) -> usize| {
+        metrics.sort_by(|a, b| {
+            key(b)
+                .cmp(&key(a))
+                .then_with(|| a.qualified_name.cmp(&b.qualified_name))
+        });
+        metrics
+    };
+
+    let all_metrics: Vec<SymbolMetric> = symbols.iter().map(|node| metric(*node)).collect();
+    let mut largest = ranked(all_metrics.clone(), |m| m.loc as usize);
+    largest.truncate(options.top);
+    let mut most_connected = ranked(
+        all_metrics
+            .into_iter()
+            .filter(|m| m.fan_in + m.fan_out > 0)
+            .collect(),
+        |m| m.fan_in + m.fan_out,
+    );
+    most_connected.truncate(options.top);
+
+    let mut dead_code = ranked(
+        symbols
+            .iter()
+            .filter(|node| is_dead_code_candidate(node, &fan_in))
+            .map(|node| metric(*node))
+            .collect(),
+        |m| m.loc as usize,
+    );
+    let dead_code_total = dead_code.len();
+    dead_code.truncate(options.top);
+
+    let mut packages: BTreeMap<String, (BTreeSet<&str>, usize, u64, BTreeSet<&str>)> =
+        BTreeMap::new();
+    for node in &symbols {
+        let entry = packages.entry(package_name(node)).or_default();
+        entry.0.insert(node.path.as_str());
+        entry.1 += 1;
+        entry.2 += u64::from(node.loc());
+        if !node.language.is_empty() {
+            entry.3.insert(node.language.as_str());
+        }
+    }
+    let files = packages.values().map(|(files, ..)| files.len()).sum();
+    let packages: Vec<PackageSummary> = packages
+        .into_iter()
+        .map(
+            |(package, (files, symbols, loc, languages))| PackageSummary {
+                package,
+                files: files.len(),
+                symbols,
+                loc,
+                languages: languages.into_iter().map(str::to_string).collect(),
+            },
+        )
+        .collect();
+
+    let cycles = package_cycles(&dependencies);
+    let mut dependencies: Vec<PackageDependency> = dependencies
+        .into_iter()
+        .map(|((from, to), edges)| PackageDependency { from, to, edges })
+        .collect();
+    dependencies.sort_by(|a, b| b.edges.cmp(&a.edges));
+
+    ArchitectureReport {
+        repo: snapshot.repo.clone(),
+        ref_name: snapshot.ref_name.clone(),
+        totals: ReportTotals {
+            symbols: symbols.len(),
+            files,
+            packages: packages.len(),
+            edges: snapshot.edges.len(),
+            unresolved_edges: snapshot.unresolved_edges,
+        },
+        packages,
+        largest,
+        most_connected,
+        dependencies,
+        cycles,
+        dead_code,
+        dead_code_total,
+        sql_tables: Vec::new(),
+        embedded_assets: Vec::new(),
+        embedded_bytes_total: 0,
+    }
+}
+
+/// Tables named by SQL injections, most statements first, at most `top`.
+pub fn sql_table_usage(injections: &[InjectionRecord], top: usize) -> Vec<SqlTableUsage> {
+    let mut usage: BTreeMap<&str, (usize, BTreeSet<&str>)> = BTreeMap::new();
+    for injection in injections {
+        for table in &injection.tables {
+            let (statements, files) = usage.entry(table.as_str()).or_default();
+            *statements += 1;
+            files.insert(injection.path.as_str());
+        }
+    }
+    let mut tables: Vec<SqlTableUsage> = usage
+        .into_iter()
+        .map(|(table, (statements, files))| SqlTableUsage {
+            table: table.to_string(),
+            statements,
+            files: files.into_iter().map(str::to_string).collect(),
+        })
+        .collect();
+    tables.sort_by(|a, b| {
+        b.statements
+            .cmp(&a.statements)
+            .then_with(|| a.table.cmp(&b.table))
+    });
+    tables.truncate(top);
+    tables
+}
+
+/// Size embedded by each directive, largest first, at most `top`, and the
+/// total over all of them. Served directives count nothing as unreferenced.
+pub fn embedded_asset_usage(embeds: &[EmbedRecord], top: usize) -> (Vec<EmbeddedAssets>, u64) {
+    let mut usage: Vec<EmbeddedAssets> = embeds
+        .iter()
+        .map(|embed| {
+            let package = match embed.path.rsplit_once('/') {
+                Some((dir, _)) => dir.to_string(),
+                None => ROOT_PACKAGE.to_string(),
+            };
+            let unreferenced_bytes = if embed.served {
+                0
+            } else {
+                embed
+                    .files
+                    .iter()
+                    .filter(|file| !file.referenced)
+                    .map(|file| file.size)
+                    .sum()
+            };
+            EmbeddedAssets {
+                package,
+                variable: embed.variable.clone(),
+                path: embed.path.clone(),
+                line: embed.line,
+                files: embed.files.len(),
+                bytes: embed.files.iter().map(|file| file.size).sum(),
+                unreferenced_bytes,
+            }
+        })
+        .collect();
+    let total = usage.iter().map(|assets| assets.bytes).sum();
+    usage.sort_by(|a, b| {
+        b.bytes
+            .cmp(&a.bytes)
+            .then_with(|| (a.path.as_str(), a.line).cmp(&(b.path.as_str(), b.line)))
+    });
+    usage.truncate(top);
+    (usage, total)
+}
+
+pub fn render_markdown(report: &ArchitectureReport) -> String {
+    let mut out = String::new();
+    let totals = &report.totals;
+    let _ = writeln!(out, "# Architecture report: `{}`\n", report.ref_name);
+    let _ = writeln!(
+        out,
+        "{} symbols in {} files across {} packages; {} resolved edges ({} unresolved).\n",
+        totals.symbols, totals.files, totals.packages, totals.edges, totals.unresolved_edges
+    );
+
+    out.push_str("## Packages\n\n");
+    table(
+        &mut out,
+        &["Package", "Files", "Symbols", "LOC", "Languages"],
+        report.packages.iter().map(|p| {
+            vec![
+                code(&p.package),
+                p.files.to_string(),
+                p.symbols.to_string(),
+                p.loc.to_string(),
+                p.languages.join(", "),
+            ]
+        }),
+    );
+
+    out.push_str("## Largest symbols\n\n");
+    symbol_table(&mut out, &report.largest);
+
+    out.push_str("## Most connected symbols\n\n");
+    symbol_table(&mut out, &report.most_connected);
+
+    out.push_str("## Package dependencies\n\n");
+    table(
+        &mut out,
+        &["From", "To", "Edges"],
+        report
+            .dependencies
+            .iter()
+            .map(|d| vec![code(&d.from), code(&d.to), d.edges.to_string()]),
+    );
+
+    out.push_str("## Dependency cycles\n\n");
+    if report.cycles.is_empty() {
+        out.push_str("No cycles between packages.\n\n");
+    } else {
+        for cycle in &report.cycles {
+            let members: Vec<String> = cycle.iter().map(|package| code(package)).collect();
+            let _ = writeln!(out, "- {}", members.join(" ↔ "));
+        }
+        out.push('\n');
+    }
+
+    out.push_str("## Dead code candidates\n\n");
+    if report.dead_code_total > report.dead_code.len() {
+        let _ = writeln!(
+            out,
+            "Showing the {} largest of {} functions and methods with no known callers.\n",
+            report.dead_code.len(),
+            report.dead_code_total
+        );
+    }
+    symbol_table(&mut out, &report.dead_code);
+
+    if !report.sql_tables.is_empty() {
+        out.push_str("## SQL tables\n\n");
+        table(
+            &mut out,
+            &["Table", "Statements", "Files"],
+            report.sql_tables.iter().map(|usage| {
+                let files: Vec<String> = usage.files.iter().map(|file| code(file)).collect();
+                vec![
+                    code(&usage.table),
+                    usage.statements.to_string(),
+                    files.join(", "),
+                ]
+            }),
+        );
+    }
+
+    if !report.embedded_assets.is_empty() {
+        out.push_str("## Embedded assets\n\n");
+        let _ = writeln!(
+            out,
+            "`//go:embed` adds {} bytes to the binaries.\n",
+            report.embedded_bytes_total
+        );
+        table(
+            &mut out,
+            &[
+                "Package",
+                "Variable",
+                "Location",
+                "Files",
+                "Bytes",
+                "Unreferenced bytes",
+            ],
+            report.embedded_assets.iter().map(|assets| {
+                vec![
+                    code(&assets.package),
+                    code(&assets.variable),
+                    format!("{}:{}", assets.path, assets.line),
+                    assets.files.to_string(),
+                    assets.bytes.to_string(),
+                    assets.unreferenced_bytes.to_string(),
+                ]
+            }),
+        );
+    }
+    out
+}
+
+fn symbol_table(out: &mut String, metrics: &[SymbolMetric]) {
+    table(
+        out,
+        &["Symbol", "Kind", "Location", "LOC", "Fan-in", "Fan-out"],
+        metrics.iter().map(|m| {
+            vec![
+                code(&m.qualified_name),
+                m.kind.clone(),
+                format!("{}:{}", m.path, m.line_start),
+                m.loc.to_string(),
+                m.fan_in.to_string(),
+                m.fan_out.to_string(),
+            ]
+        }),
+    );
+}
+
+fn table(out: &mut String, headers: &[&str], rows: impl Iterator<Item = Vec<String>>) {
+    let mut rows = rows.peekable();
+    if rows.peek().is_none() {
+        out.push_str("_None._\n\n");
+        return;
+    }
+    let _ = writeln!(out, "| {} |", headers.join(" | "));
+    let _ = writeln!(out, "|{}", " --- |".repeat(headers.len()));
+    for row in rows {
+        let cells: Vec<String> = row.iter().map(|cell| cell.replace('|', "\\|")).collect();
+        let _ = writeln!(out, "| {} |", cells.join(" | "));
+    }
+    out.push('\n');
+}
+
+fn code(value: &str) -> String {
+    format!("`{}`", value.replace('`', "'"))
+}
+
+fn package_name(node: &GraphNode) -> String {
+    if node.package.is_empty() {
+        ROOT_PACKAGE.to_string()
+    } else {
+        node.package.clone()
+    }
+}
+
+/// Indexed symbols, as opposed to the synthetic file/unknown endpoint nodes.
+fn is_symbol(node: &GraphNode) -> bool {
+    node.kind != "file" && node.kind != "unknown"
+}
+
+fn is_dead_code_candidate(node: &GraphNode, fan_in: &HashMap<&str, usize>) -> bool {
+    if node.kind != "function" && node.kind != "method" {
+        return false;
+    }
+    if fan_in.contains_key(node.id.as_str()) {
+        return false;
+    }
+    let is_entry_point = node.name == "main"
+        || node.name == "new"
+        || node.name.starts_with("test")
+        || node.path.contains("test");
+    !is_entry_point
+}
+
+/// Strongly connected components with more than one package (Tarjan).
+pub(crate) fn package_cycles(dependencies: &BTreeMap<(String, String), usize>) -> Vec<Vec<String>> {
+    let mut adjacency: BTreeMap<&str, Vec<&str>> = BTreeMap::new();
+    for (from, to) in dependencies.keys() {
+        adjacency.entry(from).or_default().push(to);
+        adjacency.entry(to).or_default();
+    }
+
+    struct Tarjan<'a> {
+        adjacency: &'a BTreeMap<&'a str, Vec<&'a str>>,
+        next_index: usize,
+        index: HashMap<&'a str, usize>,
+        lowlink: HashMap<&'a str, usize>,
+        stack: Vec<&'a str>,
+        on_stack: BTreeSet<&'a str>,
+        components: Vec<Vec<String>>,
+    }
+
+    impl<'a> Tarjan<'a> {
+        fn visit(&mut self, node: &'a str) {
+            self.index.insert(node, self.next_index);
+            self.lowlink.insert(node, self.next_index);
+            self.next_index += 1;
+            self.stack.push(node);
+            self.on_stack.insert(node);
+
+            let adjacency = self.adjacency;
+            for &next in &adjacency[node] {
+                if !self.index.contains_key(next) {
+                    self.visit(next);
+                    let low = self.lowlink[node].min(self.lowlink[next]);
+                    self.lowlink.insert(node, low);
+                } else if self.on_stack.contains(next) {
+                    let low = self.lowlink[node].min(self.index[next]);
+                    self.lowlink.insert(node, low);
+                }
+            }
+
+            if self.lowlink[node] == self.index[node] {
+                let mut component = Vec::new();
+                while let Some(member) = self.stack.pop() {
+                    self.on_stack.remove(member);
+                    component.push(member.to_string());
+                    if member == node {
+                        break;
+                    }
+                }
+                if component.len() > 1 {
+                    component.sort();
+                    self.components.push(component);
+                }
+            }
+        }
+    }
+
+    let mut tarjan = Tarjan {
+        adjacency: &adjacency,
+        next_index: 0,
+        index: HashMap::new(),
+        lowlink: HashMap::new(),
+        stack: Vec::new(),
+        on_stack: BTreeSet::new(),
+        components: Vec::new(),
+    };
+    for &node in adjacency.keys() {
+        if !tarjan.index.contains_key(node) {
+            tarjan.visit(node);
+        }
+    }
+    let mut components = tarjan.components;
+    components.sort();
+    components
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+    use cruxe_core::types::EmbeddedFile;
+
+    fn node(id: &str, kind: &str, path: &str, lines: (u32, u32)) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("crate::{id}"),
+            kind: kind.to_string(),
+            language: "rust".to_string(),
+            package: path
+                .rsplit_once('/')
+                .map(|(dir, _)| dir.to_string())
+                .unwrap_or_default(),
+            path: path.to_string(),
+            line_start: lines.0,
+            line_end: lines.1,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    fn snapshot() -> GraphSnapshot {
+        GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("main", "function", "src/main.rs", (1, 5)),
+                node("serve", "function", "src/api/server.rs", (1, 40)),
+                node("load", "function", "src/db/store.rs", (1, 10)),
+                node("notify", "function", "src/api/hooks.rs", (1, 8)),
+                node("unused", "function", "src/db/store.rs", (20, 45)),
+                node("Config", "struct", "src/db/store.rs", (50, 60)),
+            ],
+            edges: vec![
+                edge("main", "serve"),
+                edge("serve", "load"),
+                edge("load", "notify"),
+            ],
+            unresolved_edges: 2,
+        }
+    }
+
+    #[test]
+    fn report_ranks_symbols_and_finds_package_cycles() {
+        let report = build_report(&snapshot(), &ReportOptions { top: 2 });
+
+        assert_eq!(report.totals.symbols, 6);
+        assert_eq!(report.totals.files, 4);
+        assert_eq!(report.totals.packages, 3);
+        assert_eq!(
+            report
+                .packages
+                .iter()
+                .map(|p| p.package.as_str())
+                .collect::<Vec<_>>(),
+            ["src", "src/api", "src/db"]
+        );
+
+        assert_eq!(report.largest.len(), 2);
+        assert_eq!(report.largest[0].qualified_name, "crate::serve");
+        assert_eq!(
+            report.most_connected[0].fan_in + report.most_connected[0].fan_out,
+            2
+        );
+
+        assert_eq!(report.cycles, vec![vec!["src/api", "src/db"]]);
+        assert_eq!(report.dependencies.len(), 3);
+
+        let dead: Vec<&str> = report
+            .dead_code
+            .iter()
+            .map(|m| m.qualified_name.as_str())
+            .collect();
+        assert_eq!(dead, ["crate::unused"]);
+        assert_eq!(report.dead_code_total, 1);
+    }
+
+    #[test]
+    fn markdown_has_every_section_and_escapes_cells() {
+        let mut snapshot = snapshot();
+        snapshot.nodes[1].qualified_name = "crate::a|b".to_string();
+        let markdown = render_markdown(&build_report(&snapshot, &ReportOptions::default()));
+
+        for heading in [
+            "# Architecture report: `main`",
+            "## Packages",
+            "## Largest symbols",
+            "## Most connected symbols",
+            "## Package dependencies",
+            "## Dependency cycles",
+            "## Dead code candidates",
+        ] {
+            assert!(markdown.contains(heading), "missing {heading}");
+        }
+        assert!(markdown.contains("`crate::a\\|b`"));
+        assert!(markdown.contains("- `src/api` ↔ `src/db`"));
+    }
+
+    #[test]
+    fn empty_graph_renders_placeholders() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: Vec::new(),
+            edges: Vec::new(),
+            unresolved_edges: 0,
+        };
+        let markdown = render_markdown(&build_report(&snapshot, &ReportOptions::default()));
+        assert!(markdown.contains("_None._"));
+        assert!(markdown.contains("No cycles between packages."));
+    }
+
+    #[test]
+    fn sql_tables_rank_by_statement_count() {
+        let sql = |path: &str, tables: &[&str]| InjectionRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line: 1,
+            language: "sql".to_string(),
+            host: None,
+            symbol_id: None,
+            symbol: None,
+            content: String::new(),
+            tables: tables.iter().map(|table| table.to_string()).collect(),
+            error: None,
+        };
+        let usage = sql_table_usage(
+            &[
+                sql("store/users.go", &["users"]),
+                sql("store/orders.go", &["orders", "users"]),
+                sql("store/orders.go", &["orders"]),
+                sql("store/audit.go", &["audit"]),
+            ],
+            2,
+        );
+        assert_eq!(usage.len(), 2);
+        assert_eq!(usage[0].table, "orders");
+        assert_eq!(usage[0].files, ["store/orders.go"]);
+        assert_eq!(usage[1].statements, 2);
+        assert_eq!(usage[1].files, ["store/orders.go", "store/users.go"]);
+
+        let mut report = build_report(&snapshot(), &ReportOptions::default());
+        report.sql_tables = usage;
+        assert!(render_markdown(&report).contains("| `orders` | 2 | `store/orders.go` |"));
+    }
+
+    #[test]
+    fn embedded_assets_rank_by_size() {
+        let embed = |path: &str, variable: &str, sizes: &[(u64, bool)], served: bool| EmbedRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line: 3,
+            variable: variable.to_string(),
+            patterns: vec!["static".to_string()],
+            files: sizes
+                .iter()
+                .enumerate()
+                .map(|(idx, (size, referenced))| EmbeddedFile {
+                    path: format!("static/{idx}"),
+                    size: *size,
+                    referenced: *referenced,
+                })
+                .collect(),
+            missing: Vec::new(),
+            served,
+        };
+        let (usage, total) = embedded_asset_usage(
+            &[
+                embed("web/embed.go", "assets", &[(100, true), (40, false)], false),
+                embed("web/public.go", "public", &[(500, false)], true),
+                embed("main.go", "version", &[(8, true)], false),
+            ],
+            2,
+        );
+        assert_eq!(total, 648);
+        assert_eq!(usage.len(), 2);
+        assert_eq!(usage[0].variable, "public");
+        assert_eq!(usage[0].unreferenced_bytes, 0);
+        assert_eq!(usage[1].package, "web");
+        assert_eq!(usage[1].files, 2);
+        assert_eq!(usage[1].bytes, 140);
+        assert_eq!(usage[1].unreferenced_bytes, 40);
+
+        let mut report = build_report(&snapshot(), &ReportOptions::default());
+        report.embedded_assets = usage;
+        report.embedded_bytes_total = total;
+        let markdown = render_markdown(&report);
+        assert!(markdown.contains("`//go:embed` adds 648 bytes to the binaries."));
+        assert!(markdown.contains("| `web` | `assets` | web/embed.go:3 | 2 | 140 | 40 |"));
+    }
+
+    #[test]
+    fn report_format_parses_aliases() {
+        assert_eq!(ReportFormat::parse("MD"), Some(ReportFormat::Markdown));
+        assert_eq!(ReportFormat::parse("html"), None);
+    }
+}
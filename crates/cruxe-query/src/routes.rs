@@ -0,0 +1,316 @@
+//! HTTP routes for `cruxe routes`: each route recorded at index time by
+//! [`cruxe_indexer::route_extract`], linked to the symbol of its handler and
+//! the calls that handler makes.
+//!
+//! Handlers are recorded as written (`h.listUsers`, `handlers.Health`) and
+//! resolved here by their last name segment among functions and methods. A
+//! package qualifier matching a directory name picks that package's
+//! function; otherwise one next to the registration wins, since method
+//! values like `h.listUsers` usually sit in the same package as the router.
+
+use crate::call_graph::{
+    self, CallGraphDirection, CallGraphError, CallGraphRequest, CallGraphSymbol, CallTreeNode,
+};
+use cruxe_core::error::StateError;
+use cruxe_core::types::{RouteRecord, SymbolKind, SymbolRecord};
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::{routes, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::HashMap;
+
+/// Callees listed per handler before the tree is cut off.
+const CALLEE_LIMIT: usize = 50;
+
+#[derive(Debug, Clone, Default)]
+pub struct RouteOptions {
+    /// Methods to keep, e.g. `GET`; routes matching any method are kept
+    /// too. Empty keeps all.
+    pub methods: Vec<String>,
+    /// Only routes whose pattern starts with this.
+    pub prefix: Option<String>,
+    /// Levels of handler callees to include; 0 lists routes only.
+    pub depth: u32,
+    /// Only routes registered in files in scope.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct Route {
+    /// `GET`, `POST`, ..., or `*` for any method.
+    pub method: String,
+    pub route: String,
+    /// `net/http`, `chi`, `gin`, `echo`, `gorilla` or `switch`.
+    pub framework: String,
+    /// Where the route is registered.
+    pub path: String,
+    pub line: u32,
+    /// Qualified name of the function registering it.
+    pub registered_in: Option<String>,
+    /// Handler expression as written at the registration.
+    pub handler: String,
+    /// The handler's function or method, when it could be resolved.
+    pub handler_symbol: Option<CallGraphSymbol>,
+    /// Calls made by the handler, `depth` levels deep.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub callees: Vec<CallTreeNode>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct RouteReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub total: usize,
+    /// Routes whose handler resolved to a symbol.
+    pub resolved: usize,
+    /// Ordered by pattern, then method.
+    pub routes: Vec<Route>,
+}
+
+/// The routes of `ref_name` that pass `options`, with their handlers.
+pub fn list_routes(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &RouteOptions,
+) -> Result<RouteReport, StateError> {
+    let methods: Vec<String> = options
+        .methods
+        .iter()
+        .map(|method| method.trim().to_ascii_uppercase())
+        .collect();
+    let mut candidates: HashMap<String, Vec<SymbolRecord>> = HashMap::new();
+    let mut listed = Vec::new();
+    for record in routes::list_routes(conn, repo, ref_name)? {
+        if !methods.is_empty() && record.method != "*" && !methods.contains(&record.method) {
+            continue;
+        }
+        if !options.scope.contains(&record.path) {
+            continue;
+        }
+        if let Some(prefix) = options.prefix.as_deref()
+            && !record.route.starts_with(prefix)
+        {
+            continue;
+        }
+        let name = handler_name(&record.handler).to_string();
+        if !candidates.contains_key(&name) {
+            let functions = symbols::find_symbols_by_name(conn, repo, ref_name, &name, None)?
+                .into_iter()
+                .filter(|symbol| matches!(symbol.kind, SymbolKind::Function | SymbolKind::Method))
+                .collect();
+            candidates.insert(name.clone(), functions);
+        }
+        let handler = resolve_handler(&record, &candidates[&name]);
+        let callees = match handler {
+            Some(handler) if options.depth > 0 => {
+                handler_callees(conn, repo, ref_name, handler, options.depth)?
+            }
+            _ => Vec::new(),
+        };
+        listed.push(Route {
+            handler_symbol: handler.map(call_graph::to_call_graph_symbol),
+            callees,
+            method: record.method,
+            route: record.route,
+            framework: record.framework,
+            path: record.path,
+            line: record.line,
+            registered_in: record.symbol,
+            handler: record.handler,
+        });
+    }
+    let resolved = listed
+        .iter()
+        .filter(|route| route.handler_symbol.is_some())
+        .count();
+    Ok(RouteReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        total: listed.len(),
+        resolved,
+        routes: listed,
+    })
+}
+
+/// `listUsers` of `h.listUsers`.
+fn handler_name(handler: &str) -> &str {
+    handler.rsplit('.').next().unwrap_or(handler)
+}
+
+fn directory(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+fn resolve_handler<'a>(
+    record: &RouteRecord,
+    candidates: &'a [SymbolRecord],
+) -> Option<&'a SymbolRecord> {
+    let qualifier = record
+        .handler
+        .rsplit_once('.')
+        .map(|(qualifier, _)| qualifier);
+    let here = directory(&record.path);
+    candidates.iter().min_by_key(|symbol| {
+        let dir = directory(&symbol.path);
+        let package = dir.rsplit('/').next().unwrap_or(dir);
+        let qualified = qualifier.is_some_and(|qualifier| qualifier == package && dir != here);
+        (!qualified, dir != here, &symbol.path, symbol.line_start)
+    })
+}
+
+fn handler_callees(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    handler: &SymbolRecord,
+    depth: u32,
+) -> Result<Vec<CallTreeNode>, StateError> {
+    let request = CallGraphRequest {
+        symbol_name: &handler.name,
+        path: Some(&handler.path),
+        direction: CallGraphDirection::Callees,
+        depth,
+        limit: CALLEE_LIMIT,
+    };
+    match call_graph::get_call_tree(conn, repo, ref_name, &request) {
+        Ok(tree) => Ok(tree.callees),
+        Err(CallGraphError::SymbolNotFound) => Ok(Vec::new()),
+        Err(CallGraphError::State(err)) => Err(err),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::{db, edges, schema};
+
+    fn function(path: &str, name: &str, kind: SymbolKind, line_start: u32) -> SymbolRecord {
+        let package = directory(path).rsplit('/').next().unwrap_or_default();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{package}.{name}"),
+            symbol_stable_id: format!("stable::{package}.{name}"),
+            name: name.to_string(),
+            qualified_name: format!("{package}.{name}"),
+            kind,
+            signature: None,
+            line_start,
+            line_end: line_start + 5,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn route(method: &str, pattern: &str, handler: &str, line: u32) -> RouteRecord {
+        RouteRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: "api/routes.go".to_string(),
+            line,
+            method: method.to_string(),
+            route: pattern.to_string(),
+            handler: handler.to_string(),
+            framework: "chi".to_string(),
+            symbol_id: Some("stable::api.Routes".to_string()),
+            symbol: Some("api.Routes".to_string()),
+        }
+    }
+
+    #[test]
+    fn links_routes_to_handlers_and_their_callees() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            function("api/users.go", "listUsers", SymbolKind::Method, 10),
+            function("api/health.go", "Health", SymbolKind::Function, 3),
+            function("health/health.go", "Health", SymbolKind::Function, 3),
+            function("store/users.go", "All", SymbolKind::Method, 20),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "stable::api.listUsers".to_string(),
+                to_symbol_id: Some("stable::store.All".to_string()),
+                to_name: Some("All".to_string()),
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "api/users.go".to_string(),
+                source_line: 12,
+            }],
+        )
+        .unwrap();
+        routes::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "api/routes.go",
+            &[
+                route("GET", "/users", "h.listUsers", 5),
+                route("GET", "/healthz", "health.Health", 6),
+                route("GET", "/livez", "Health", 7),
+                route("*", "/static/", "http.FileServer", 8),
+                route("POST", "/users", "func literal", 9),
+            ],
+        )
+        .unwrap();
+
+        let list = |options: RouteOptions| list_routes(&conn, "repo", "main", &options).unwrap();
+        let all = list(RouteOptions {
+            depth: 2,
+            ..RouteOptions::default()
+        });
+        let handlers: Vec<(&str, &str, Option<&str>)> = all
+            .routes
+            .iter()
+            .map(|route| {
+                (
+                    route.method.as_str(),
+                    route.route.as_str(),
+                    route
+                        .handler_symbol
+                        .as_ref()
+                        .map(|symbol| symbol.path.as_str()),
+                )
+            })
+            .collect();
+        assert_eq!(
+            handlers,
+            [
+                ("GET", "/healthz", Some("health/health.go")),
+                ("GET", "/livez", Some("api/health.go")),
+                ("*", "/static/", None),
+                ("GET", "/users", Some("api/users.go")),
+                ("POST", "/users", None),
+            ]
+        );
+        assert_eq!((all.total, all.resolved), (5, 3));
+        let users = &all.routes[3];
+        assert_eq!(users.callees.len(), 1);
+        assert_eq!(users.callees[0].symbol.qualified_name, "store.All");
+
+        let posts = list(RouteOptions {
+            methods: vec!["post".to_string()],
+            prefix: Some("/users".to_string()),
+            depth: 0,
+            ..RouteOptions::default()
+        });
+        assert_eq!(posts.total, 1);
+        assert_eq!(posts.routes[0].handler, "func literal");
+        assert!(posts.routes[0].callees.is_empty());
+    }
+}
@@ -9,11 +9,12 @@ use cruxe_core::types::{
     PolicyMode, QueryIntent, RankingReasons, RankingSignalContribution, RefScope, SourceLayer,
     SymbolKind, SymbolRecord, SymbolRole,
 };
+use cruxe_indexer::doc_extract;
 use cruxe_state::tantivy_index::IndexSet;
 use rusqlite::Connection;
+use schemars::JsonSchema;
 use serde::{Deserialize, Serialize};
 use std::collections::{BTreeMap, HashMap, HashSet};
-use std::path::Path;
 use std::time::Instant;
 use tantivy::Term;
 use tantivy::collector::TopDocs;
@@ -36,7 +37,7 @@ use crate::{
     adaptive_plan::{
         DowngradeReason, PlanBudget, PlanController, PlanSelectionInput, QueryPlan, plan_budget,
     },
-    scoring,
+    scoring, symbol_ids,
 };
 
 /// Reciprocal Rank Fusion constant (standard value from the RRF paper).
@@ -49,7 +50,7 @@ const SIGNAL_FILE_CENTRALITY: &str = "centrality_boost";
 const FILE_CENTRALITY_WEIGHT: f64 = 1.0;
 
 /// A search result from search_code.
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct SearchResult {
     #[serde(skip_serializing, skip_deserializing, default)]
     pub repo: String,
@@ -68,6 +69,9 @@ pub struct SearchResult {
     pub name: Option<String>,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub qualified_name: Option<String>,
+    /// Stable, readable id of the symbol; see [`cruxe_core::canonical_id`].
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub canonical_id: Option<String>,
     pub language: String,
     #[serde(skip_serializing_if = "Option::is_none")]
     pub signature: Option<String>,
@@ -89,7 +93,7 @@ pub struct SearchResult {
 }
 
 /// A suggested next action for the AI agent.
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct SuggestedAction {
     pub tool: String,
     #[serde(skip_serializing_if = "Option::is_none")]
@@ -103,7 +107,7 @@ pub struct SuggestedAction {
 }
 
 /// Response for search_code.
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct SearchResponse {
     pub results: Vec<SearchResult>,
     pub query_intent: QueryIntent,
@@ -116,7 +120,7 @@ pub struct SearchResponse {
     pub ranking_reasons: Option<Vec<RankingReasons>>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct SearchMetadata {
     pub policy_mode: String,
     pub policy_blocked_count: usize,
@@ -174,7 +178,7 @@ pub struct SearchMetadata {
     pub warnings: Vec<String>,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Serialize, Deserialize, JsonSchema)]
 pub struct QueryPlanBudgetUsed {
     pub semantic_limit: usize,
     pub lexical_fanout: usize,
@@ -182,7 +186,7 @@ pub struct QueryPlanBudgetUsed {
     pub latency_budget_ms: u64,
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize, Default)]
+#[derive(Debug, Clone, Serialize, Deserialize, Default, JsonSchema)]
 pub struct ConfidenceStructuralDiagnostics {
     pub total_edges: u64,
     pub high_edges: u64,
@@ -206,6 +210,9 @@ pub struct SearchExecutionOptions {
     pub policy_mode_override: Option<PolicyMode>,
     pub policy_runtime: Option<PolicyRuntime>,
     pub diversity_enabled: bool,
+    /// Match only indexed doc comments and comment blocks
+    /// (`cruxe search --docs`).
+    pub in_docs: bool,
 }
 
 impl Default for SearchExecutionOptions {
@@ -219,12 +226,13 @@ impl Default for SearchExecutionOptions {
             policy_mode_override: None,
             policy_runtime: None,
             diversity_enabled: true,
+            in_docs: false,
         }
     }
 }
 
 /// Optional debug payload for search_code.
-#[derive(Debug, Clone, Serialize, Deserialize, Default)]
+#[derive(Debug, Clone, Serialize, Deserialize, Default, JsonSchema)]
 pub struct SearchDebugInfo {
     pub join_status: JoinStatus,
 }
@@ -238,7 +246,7 @@ pub struct VcsSearchContext<'a> {
 }
 
 /// Join metrics for snippet -> symbol enrichment.
-#[derive(Debug, Clone, Serialize, Deserialize, Default)]
+#[derive(Debug, Clone, Serialize, Deserialize, Default, JsonSchema)]
 pub struct JoinStatus {
     pub hits: usize,
     pub misses: usize,
@@ -310,6 +318,14 @@ pub fn search_code_with_options(
     let mut response_warnings = Vec::new();
 
     let mut all_results = Vec::new();
+    let doc_chunk_types: &[&str] = if options.in_docs {
+        &doc_extract::DOCS_CHUNK_TYPES
+    } else {
+        &[]
+    };
+    if options.in_docs && semantic_state.semantic_eligible() {
+        semantic_state.mark_skipped("in_docs");
+    }
 
     // Search each index and apply RRF (Reciprocal Rank Fusion) scoring.
     // RRF score per source = weight / (k + rank), where k=60 is the standard constant.
@@ -327,6 +343,7 @@ pub fn search_code_with_options(
                 ref_name: search_ref,
                 language,
                 role: options.role.as_deref(),
+                chunk_types: doc_chunk_types,
             },
             limit,
         )?;
@@ -335,7 +352,7 @@ pub fn search_code_with_options(
     }
 
     // Search snippets index
-    if plan.search_snippets {
+    if plan.search_snippets || options.in_docs {
         let mut results = search_index(
             &index_set.snippets,
             &mut debug,
@@ -346,6 +363,7 @@ pub fn search_code_with_options(
                 ref_name: search_ref,
                 language,
                 role: options.role.as_deref(),
+                chunk_types: doc_chunk_types,
             },
             limit,
         )?;
@@ -365,6 +383,7 @@ pub fn search_code_with_options(
                 ref_name: search_ref,
                 language,
                 role: options.role.as_deref(),
+                chunk_types: doc_chunk_types,
             },
             limit,
         )?;
@@ -680,6 +699,11 @@ pub fn search_code_with_options(
     }
     all_results.truncate(limit);
     let ranking_reasons = ranking_reasons.map(|reasons| reasons.into_iter().take(limit).collect());
+    if let Some(connection) = conn
+        && let Err(err) = symbol_ids::annotate(connection, effective_ref.as_str(), &mut all_results)
+    {
+        warn!(error = %err, "canonical symbol ids could not be computed");
+    }
 
     let confidence_threshold = options
         .search_config
@@ -781,6 +805,7 @@ pub fn search_code_with_options(
         total,
         "search_code"
     );
+    cruxe_core::stats::phase("query.search", query_start.elapsed());
 
     Ok(SearchResponse {
         results: all_results,
@@ -1017,11 +1042,8 @@ pub fn search_code_vcs_merged_with_options(
 }
 
 fn clone_connection_for_parallel(conn: &Connection) -> Option<Connection> {
-    let path = conn.path()?;
-    if path == ":memory:" {
-        return None;
-    }
-    cruxe_state::db::open_connection(Path::new(path)).ok()
+    // Same mode as `conn`, so read-only query connections stay memory-mapped.
+    cruxe_state::db::reopen(conn).ok()
 }
 
 const STRUCTURAL_CENTRALITY_WEIGHT: f64 = 1.0;
@@ -1773,6 +1795,8 @@ struct SearchScope<'a> {
     ref_name: Option<&'a str>,
     language: Option<&'a str>,
     role: Option<&'a str>,
+    /// Only snippets of these `chunk_type`s; empty keeps every snippet.
+    chunk_types: &'a [&'a str],
 }
 
 fn search_index(
@@ -1787,6 +1811,9 @@ fn search_index(
     if scope.role.is_some() && result_type != "symbol" {
         return Ok(Vec::new());
     }
+    if !scope.chunk_types.is_empty() && result_type != "snippet" {
+        return Ok(Vec::new());
+    }
 
     let reader = index.reader().map_err(StateError::tantivy)?;
     let searcher = reader.searcher();
@@ -1883,6 +1910,29 @@ fn search_index(
         } else {
             parsed_query
         };
+    // Doc-only searches narrow whatever the scope filters matched.
+    let final_query: Box<dyn tantivy::query::Query> = if !scope.chunk_types.is_empty()
+        && let Ok(chunk_type_field) = schema.get_field("chunk_type")
+    {
+        let any_type: Vec<(Occur, Box<dyn tantivy::query::Query>)> = scope
+            .chunk_types
+            .iter()
+            .map(|chunk_type| {
+                let term: Box<dyn tantivy::query::Query> = Box::new(TermQuery::new(
+                    Term::from_field_text(chunk_type_field, chunk_type),
+                    IndexRecordOption::Basic,
+                ));
+                (Occur::Should, term)
+            })
+            .collect();
+        let clauses: Vec<(Occur, Box<dyn tantivy::query::Query>)> = vec![
+            (Occur::Must, final_query),
+            (Occur::Must, Box::new(BooleanQuery::new(any_type))),
+        ];
+        Box::new(BooleanQuery::new(clauses))
+    } else {
+        final_query
+    };
 
     let top_docs = searcher
         .search(&final_query, &TopDocs::with_limit(limit))
@@ -1997,6 +2047,7 @@ fn search_index(
             kind,
             name: symbol_name,
             qualified_name,
+            canonical_id: None,
             language,
             signature: get_text("signature"),
             visibility: get_text("visibility"),
@@ -2201,21 +2252,21 @@ fn choose_best_symbol_match(
     })
 }
 
-struct StableResultIdInput<'a> {
-    result_type: &'a str,
-    repo: &'a str,
-    ref_name: &'a str,
-    path: &'a str,
-    line_start: u32,
-    line_end: u32,
-    kind: &'a str,
-    name: &'a str,
-    qualified_name: &'a str,
-    language: &'a str,
-    symbol_stable_id: &'a str,
+pub(crate) struct StableResultIdInput<'a> {
+    pub(crate) result_type: &'a str,
+    pub(crate) repo: &'a str,
+    pub(crate) ref_name: &'a str,
+    pub(crate) path: &'a str,
+    pub(crate) line_start: u32,
+    pub(crate) line_end: u32,
+    pub(crate) kind: &'a str,
+    pub(crate) name: &'a str,
+    pub(crate) qualified_name: &'a str,
+    pub(crate) language: &'a str,
+    pub(crate) symbol_stable_id: &'a str,
 }
 
-fn compute_stable_result_id(input: StableResultIdInput<'_>) -> String {
+pub(crate) fn compute_stable_result_id(input: StableResultIdInput<'_>) -> String {
     let StableResultIdInput {
         result_type,
         repo,
@@ -2360,6 +2411,7 @@ mod tests {
             kind: Some("function".to_string()),
             name: Some("demo".to_string()),
             qualified_name: Some("demo".to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -2386,6 +2438,7 @@ mod tests {
             kind: Some("function".to_string()),
             name: Some(symbol_stable_id.to_string()),
             qualified_name: Some(symbol_stable_id.to_string()),
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: Some("pub".to_string()),
@@ -2414,6 +2467,7 @@ mod tests {
                 kind: None,
                 name: None,
                 qualified_name: None,
+                canonical_id: None,
                 language: "rust".to_string(),
                 signature: None,
                 visibility: None,
@@ -2437,6 +2491,7 @@ mod tests {
                 kind: Some("function".to_string()),
                 name: Some("demo".to_string()),
                 qualified_name: Some("demo".to_string()),
+                canonical_id: None,
                 language: "rust".to_string(),
                 signature: None,
                 visibility: None,
@@ -3077,6 +3132,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3186,6 +3242,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3291,6 +3348,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3315,6 +3373,7 @@ mod tests {
             kind: None,
             name: None,
             qualified_name: None,
+            canonical_id: None,
             language: "rust".to_string(),
             signature: None,
             visibility: None,
@@ -3431,6 +3490,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3472,6 +3532,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3537,6 +3598,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3591,6 +3653,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3646,6 +3709,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3680,6 +3744,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3718,6 +3783,7 @@ mod tests {
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .unwrap();
@@ -3732,4 +3798,73 @@ mod tests {
             Some("semantic_unavailable")
         );
     }
+
+    #[test]
+    fn in_docs_matches_only_doc_comments_and_comments() {
+        let dir = tempdir().unwrap();
+        let index_set = IndexSet::open(dir.path()).unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let source = "package auth\n\n// Validate rejects expired session tokens.\nfunc Validate(token string) bool {\n\t// Fall back to the legacy signing keys.\n\treturn checkSignature(token)\n}\n";
+        let artifacts = cruxe_indexer::prepare::build_source_artifacts(
+            source,
+            "go",
+            "auth/auth.go",
+            "repo",
+            "main",
+            None,
+            true,
+            true,
+        );
+        let file = cruxe_indexer::prepare::build_file_record(
+            "repo",
+            "main",
+            "auth/auth.go",
+            "auth.go",
+            "go",
+            source,
+        );
+        cruxe_indexer::writer::write_file_records(
+            &index_set,
+            &conn,
+            &artifacts.symbols,
+            &artifacts.snippets,
+            &file,
+        )
+        .unwrap();
+
+        let search = |query: &str| {
+            search_code_with_options(
+                &index_set,
+                Some(&conn),
+                query,
+                Some("main"),
+                None,
+                10,
+                false,
+                SearchExecutionOptions {
+                    in_docs: true,
+                    ..SearchExecutionOptions::default()
+                },
+            )
+            .unwrap()
+        };
+        let response = search("expired session");
+        assert_eq!(response.results.len(), 1);
+        let hit = &response.results[0];
+        assert_eq!(hit.chunk_type.as_deref(), Some(doc_extract::DOC_CHUNK_TYPE));
+        assert_eq!(hit.name.as_deref(), Some("Validate"));
+        assert_eq!(hit.line_start, 4);
+        assert!(search("checkSignature").results.is_empty());
+
+        let response = search("legacy signing keys");
+        assert_eq!(response.results.len(), 1);
+        let hit = &response.results[0];
+        assert_eq!(
+            hit.chunk_type.as_deref(),
+            Some(doc_extract::COMMENT_CHUNK_TYPE)
+        );
+        assert_eq!(hit.name.as_deref(), Some("Validate"));
+        assert_eq!(hit.line_start, 5);
+    }
 }
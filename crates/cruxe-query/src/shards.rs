@@ -0,0 +1,179 @@
+//! Search across a sharded index.
+//!
+//! Every shard is searched on its own and the results are merged into one
+//! response. Scores come from separate Tantivy indices, so their term
+//! statistics differ slightly; shards hold disjoint paths, which keeps the
+//! merged ranking close to that of a single index.
+
+use crate::overlay_merge::search_merge_key;
+use crate::search::{
+    SearchExecutionOptions, SearchResponse, SearchResult, search_code_with_options,
+};
+use cruxe_core::error::StateError;
+use cruxe_core::types::OverlayMergeKey;
+use cruxe_state::tantivy_index::IndexSet;
+use rusqlite::Connection;
+use std::collections::HashMap;
+
+/// One searchable part of the logical index.
+pub struct ShardSource<'a> {
+    pub name: &'a str,
+    pub index_set: &'a IndexSet,
+    pub conn: Option<&'a Connection>,
+}
+
+/// Search the main index and every shard, then merge.
+#[allow(clippy::too_many_arguments)]
+pub fn search_sharded(
+    main: ShardSource<'_>,
+    shards: &[ShardSource<'_>],
+    local_repo: &str,
+    query: &str,
+    r#ref: Option<&str>,
+    language: Option<&str>,
+    limit: usize,
+    options: &SearchExecutionOptions,
+) -> Result<SearchResponse, StateError> {
+    let search = |source: &ShardSource<'_>| {
+        search_code_with_options(
+            source.index_set,
+            source.conn,
+            query,
+            r#ref,
+            language,
+            limit,
+            false,
+            options.clone(),
+        )
+    };
+    let merged = search(&main)?;
+    let mut shard_responses = Vec::with_capacity(shards.len());
+    for shard in shards {
+        match search(shard) {
+            Ok(response) => shard_responses.push(response),
+            Err(e) => {
+                // One unreadable shard should not hide the others.
+                tracing::warn!(shard = shard.name, "shard search failed: {}", e);
+            }
+        }
+    }
+    Ok(merge_shard_responses(
+        merged,
+        shard_responses,
+        local_repo,
+        limit,
+    ))
+}
+
+/// Fold shard responses into the main one.
+pub fn merge_shard_responses(
+    mut main: SearchResponse,
+    shards: Vec<SearchResponse>,
+    local_repo: &str,
+    limit: usize,
+) -> SearchResponse {
+    if shards.is_empty() {
+        return main;
+    }
+    let mut shard_results = Vec::with_capacity(shards.len());
+    for shard in shards {
+        main.total_candidates += shard.total_candidates;
+        main.metadata.warnings.extend(shard.metadata.warnings);
+        shard_results.push(shard.results);
+    }
+    let results = std::mem::take(&mut main.results);
+    main.results = merge_shard_results(results, shard_results, local_repo, limit);
+    main
+}
+
+/// Merge result lists by score. Results of a shard built on another machine
+/// carry that machine's project id, so every result is relabelled with
+/// `local_repo` before deduplication; the higher score wins a clash.
+fn merge_shard_results(
+    main: Vec<SearchResult>,
+    shards: Vec<Vec<SearchResult>>,
+    local_repo: &str,
+    limit: usize,
+) -> Vec<SearchResult> {
+    let mut merged: HashMap<OverlayMergeKey, SearchResult> = HashMap::new();
+    for mut result in main.into_iter().chain(shards.into_iter().flatten()) {
+        result.repo = local_repo.to_string();
+        let key = search_merge_key(&result);
+        if merged
+            .get(&key)
+            .is_none_or(|existing| existing.score < result.score)
+        {
+            merged.insert(key, result);
+        }
+    }
+    let mut results: Vec<SearchResult> = merged.into_values().collect();
+    results.sort_by(|a, b| {
+        b.score
+            .total_cmp(&a.score)
+            .then_with(|| a.path.cmp(&b.path))
+            .then_with(|| a.line_start.cmp(&b.line_start))
+    });
+    results.truncate(limit);
+    results
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn file_result(repo: &str, path: &str, score: f32) -> SearchResult {
+        SearchResult {
+            repo: repo.to_string(),
+            result_id: format!("file:{path}"),
+            symbol_id: None,
+            symbol_stable_id: None,
+            result_type: "file".to_string(),
+            path: path.to_string(),
+            line_start: 0,
+            line_end: 0,
+            kind: None,
+            name: None,
+            qualified_name: None,
+            canonical_id: None,
+            language: "go".to_string(),
+            signature: None,
+            visibility: None,
+            score,
+            snippet: None,
+            chunk_type: None,
+            chunk_origin: None,
+            file_centrality: 0.0,
+            source_layer: None,
+            provenance: "lexical".to_string(),
+        }
+    }
+
+    #[test]
+    fn shard_results_interleave_by_score_under_the_local_repo() {
+        let main = vec![
+            file_result("local", "cmd/main.go", 0.4),
+            file_result("local", "web/app.ts", 0.2),
+        ];
+        let shards = vec![
+            vec![file_result("remote-a", "services/payments/api.go", 0.9)],
+            vec![
+                file_result("remote-b", "web/app.ts", 0.6),
+                file_result("remote-b", "web/util.ts", 0.1),
+            ],
+        ];
+        let merged = merge_shard_results(main, shards, "local", 3);
+        let paths: Vec<(&str, f32)> = merged
+            .iter()
+            .map(|result| (result.path.as_str(), result.score))
+            .collect();
+        assert_eq!(
+            paths,
+            [
+                ("services/payments/api.go", 0.9),
+                ("web/app.ts", 0.6),
+                ("cmd/main.go", 0.4)
+            ]
+        );
+        assert!(merged.iter().all(|result| result.repo == "local"));
+    }
+}
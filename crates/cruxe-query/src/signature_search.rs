@@ -0,0 +1,750 @@
+//! `cruxe search --sig`: functions and methods matched by their parameter
+//! and result types rather than their names.
+//!
+//! A pattern is written like a Go function type,
+//! `func(*handlers.Request) *handlers.Response`; `fn`, `function` and `def`
+//! are accepted as the keyword too, or none at all, and parameter names are
+//! ignored. `_` stands for any one type, `..` (or `...`) for any number of
+//! them, and a `*` that does not start a type for any run of characters
+//! (`func(context.Context, ..) (*api.*Response, error)`, `Result<*>`).
+//! Omitted results match functions that return nothing.
+//!
+//! Types are compared as written, without type information. A
+//! package-qualified type in the pattern also matches the bare name inside
+//! that package, and untyped parameters (TypeScript, Python) only match `_`
+//! and `..`.
+
+use crate::fuzzy::SymbolFilter;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+
+/// Declaration text read for the header; bodies start well before this.
+const MAX_HEADER_CHARS: usize = 2000;
+
+/// Go keywords that start a type, so `chan int` is not a parameter `chan`.
+const GO_TYPE_KEYWORDS: &[&str] = &["chan", "func", "map", "struct", "interface"];
+
+#[derive(Debug, thiserror::Error)]
+pub enum SignatureError {
+    #[error("invalid signature pattern `{pattern}`: {reason}")]
+    InvalidPattern { pattern: String, reason: String },
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SignatureMatch {
+    pub name: String,
+    pub qualified_name: String,
+    pub kind: String,
+    pub language: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    /// Parameter types as written; an untyped parameter is empty.
+    pub params: Vec<String>,
+    pub results: Vec<String>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SignatureSearch {
+    pub repo: String,
+    pub ref_name: String,
+    pub pattern: String,
+    /// Matches before the limit was applied.
+    pub total: usize,
+    /// In path and line order.
+    pub matches: Vec<SignatureMatch>,
+}
+
+/// A parsed `--sig` pattern: normalized types, `_` and `..` per position.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SignaturePattern {
+    params: Vec<String>,
+    results: Vec<String>,
+}
+
+impl SignaturePattern {
+    pub fn parse(pattern: &str) -> Result<Self, SignatureError> {
+        let invalid = |reason: &str| SignatureError::InvalidPattern {
+            pattern: pattern.to_string(),
+            reason: reason.to_string(),
+        };
+        let text = pattern.trim();
+        let text = ["function", "func", "fn", "def"]
+            .iter()
+            .find_map(|keyword| {
+                text.strip_prefix(keyword)
+                    .filter(|rest| rest.trim_start().starts_with('('))
+            })
+            .unwrap_or(text)
+            .trim_start();
+        if !text.starts_with('(') {
+            return Err(invalid("expected a parameter list, e.g. `func(int) error`"));
+        }
+        let close = matching_close(text, 0).ok_or_else(|| invalid("unbalanced brackets"))?;
+        let rest = text[close + 1..].trim();
+        let rest = rest
+            .strip_prefix("->")
+            .or_else(|| rest.strip_prefix(':'))
+            .unwrap_or(rest)
+            .trim();
+        let results = if rest.starts_with('(') && matching_close(rest, 0) == Some(rest.len() - 1) {
+            go_types(&split_top_level(&rest[1..rest.len() - 1]))
+        } else if rest.is_empty() {
+            Vec::new()
+        } else {
+            vec![normalize(rest)]
+        };
+        Ok(Self {
+            params: go_types(&split_top_level(&text[1..close])),
+            results,
+        })
+    }
+
+    /// Whether declared types fit the pattern; `package` is the name of the
+    /// package the declaration is in.
+    fn matches(&self, params: &[String], results: &[String], package: Option<&str>) -> bool {
+        list_matches(&self.params, params, package) && list_matches(&self.results, results, package)
+    }
+}
+
+/// Functions and methods on `ref_name` whose declared parameter and result
+/// types match `pattern`, at most `limit` of them.
+pub fn search_signatures(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    pattern: &str,
+    filter: &SymbolFilter,
+    limit: usize,
+) -> Result<SignatureSearch, SignatureError> {
+    let parsed = SignaturePattern::parse(pattern)?;
+    let mut matches = Vec::new();
+    symbols::for_each_callable_body(conn, repo, ref_name, |symbol| {
+        if !filter.matches_symbol(&symbol) {
+            return Ok(());
+        }
+        let Some((params, results)) = declared_types(&symbol) else {
+            return Ok(());
+        };
+        if parsed.matches(&params, &results, package_name(&symbol.path)) {
+            matches.push(SignatureMatch {
+                kind: symbol.kind.as_str().to_string(),
+                name: symbol.name,
+                qualified_name: symbol.qualified_name,
+                language: symbol.language,
+                path: symbol.path,
+                line_start: symbol.line_start,
+                line_end: symbol.line_end,
+                params,
+                results,
+            });
+        }
+        Ok(())
+    })?;
+    let total = matches.len();
+    matches.truncate(limit);
+    Ok(SignatureSearch {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        pattern: pattern.to_string(),
+        total,
+        matches,
+    })
+}
+
+/// Go's package name for a file: its directory's name.
+fn package_name(path: &str) -> Option<&str> {
+    let (dir, _) = path.rsplit_once('/')?;
+    Some(dir.rsplit('/').next().unwrap_or(dir))
+}
+
+/// Parameter and result types of a function's declaration header.
+fn declared_types(symbol: &SymbolRecord) -> Option<(Vec<String>, Vec<String>)> {
+    let text = symbol.content.as_deref().or(symbol.signature.as_deref())?;
+    let end = text
+        .char_indices()
+        .nth(MAX_HEADER_CHARS)
+        .map_or(text.len(), |(at, _)| at);
+    let header = &text[..end];
+    let open = params_open(header, &symbol.name)?;
+    let close = matching_close(header, open)?;
+    let parts = split_top_level(&header[open + 1..close]);
+    let rest = header[close + 1..].trim_start();
+    let (params, results) = match symbol.language.as_str() {
+        "go" => {
+            let results = if rest.starts_with('(') {
+                let end = matching_close(rest, 0)?;
+                go_types(&split_top_level(&rest[1..end]))
+            } else {
+                single(take_type(rest, &["{"]))
+            };
+            (go_types(&parts), results)
+        }
+        "rust" => {
+            let params = parts
+                .iter()
+                .filter(|part| !is_rust_self(part))
+                .map(|part| annotated_type(part))
+                .collect();
+            let returned = rest.strip_prefix("->").map(str::trim_start).unwrap_or("");
+            (params, single(take_type(returned, &["{", ";", "where "])))
+        }
+        "typescript" | "javascript" => {
+            let params = parts
+                .iter()
+                .filter(|part| !part.starts_with("this:") && !part.starts_with("this "))
+                .map(|part| annotated_type(part))
+                .collect();
+            let returned = rest.strip_prefix(':').map(str::trim_start).unwrap_or("");
+            (params, single(take_type(returned, &["{", "=>", ";"])))
+        }
+        "python" => {
+            let params = parts
+                .iter()
+                .enumerate()
+                .filter(|(at, part)| {
+                    !(*at == 0 && matches!(part.as_str(), "self" | "cls"))
+                        && !matches!(part.as_str(), "*" | "/")
+                })
+                .map(|(_, part)| {
+                    let typed = annotated_type(part.trim_start_matches('*'));
+                    match find_top_level(&typed, '=') {
+                        Some(at) => normalize(&typed[..at]),
+                        None => typed,
+                    }
+                })
+                .collect();
+            let returned = rest.strip_prefix("->").map(str::trim_start).unwrap_or("");
+            (params, single(take_type(returned, &[":"])))
+        }
+        _ => return None,
+    };
+    Some((params, results))
+}
+
+/// Offset of the `(` opening `name`'s parameter list, past any type
+/// parameters (`Map[T any](`, `parse<T>(`).
+fn params_open(header: &str, name: &str) -> Option<usize> {
+    if name.is_empty() {
+        return None;
+    }
+    let mut from = 0;
+    while let Some(found) = header[from..].find(name) {
+        let start = from + found;
+        let end = start + name.len();
+        from = end;
+        if header[..start].chars().next_back().is_some_and(is_word) {
+            continue;
+        }
+        let mut at = end + whitespace_len(&header[end..]);
+        if header[at..].starts_with(['<', '[']) {
+            let Some(close) = matching_close(header, at) else {
+                continue;
+            };
+            at = close + 1;
+            at += whitespace_len(&header[at..]);
+        }
+        if header[at..].starts_with('(') {
+            return Some(at);
+        }
+    }
+    None
+}
+
+fn whitespace_len(text: &str) -> usize {
+    text.len() - text.trim_start().len()
+}
+
+/// Types of Go parameters or results: `a, b int` is two `int`s, and
+/// unnamed lists are types already. Pattern wildcards stay where they are.
+fn go_types(parts: &[String]) -> Vec<String> {
+    let named: Vec<Option<String>> = parts.iter().map(|part| go_named_type(part)).collect();
+    if named.iter().all(Option::is_none) {
+        return parts.iter().map(|part| normalize(part)).collect();
+    }
+    let mut types = Vec::new();
+    let mut pending = 0;
+    for (part, ty) in parts.iter().zip(named) {
+        match ty {
+            None if part == "_" || is_rest(part) => types.push(part.clone()),
+            Some(ty) => {
+                types.extend(std::iter::repeat_n(ty, pending + 1));
+                pending = 0;
+            }
+            None => pending += 1,
+        }
+    }
+    types
+}
+
+/// The type of a `name Type` parameter.
+fn go_named_type(part: &str) -> Option<String> {
+    let name_len = part.chars().take_while(|c| is_word(*c)).count();
+    let (name, rest) = part.split_at(name_len);
+    if name.is_empty()
+        || GO_TYPE_KEYWORDS.contains(&name)
+        || !rest.starts_with(char::is_whitespace)
+        || rest.trim().is_empty()
+    {
+        return None;
+    }
+    Some(normalize(rest))
+}
+
+/// The type after a top-level `name: Type`; empty when untyped.
+fn annotated_type(part: &str) -> String {
+    find_top_level(part, ':')
+        .map(|at| normalize(&part[at + 1..]))
+        .unwrap_or_default()
+}
+
+fn is_rust_self(part: &str) -> bool {
+    let part = part.trim_start_matches('&').trim_start();
+    let part = part.strip_prefix("mut ").unwrap_or(part).trim_start();
+    let part = part
+        .strip_prefix('\'')
+        .and_then(|lifetime| lifetime.split_once(' '))
+        .map_or(part, |(_, rest)| rest.trim_start());
+    let part = part.strip_prefix("mut ").unwrap_or(part);
+    part == "self" || part.starts_with("self:") || part.starts_with("self ")
+}
+
+/// The return type at the start of `text`, up to the first top-level
+/// terminator or end of line.
+fn take_type<'t>(text: &'t str, terminators: &[&str]) -> &'t str {
+    let mut depth = 0usize;
+    let mut previous = ' ';
+    for (at, c) in text.char_indices() {
+        if depth == 0 {
+            if c == '\n' {
+                return text[..at].trim();
+            }
+            // `interface{}` and `struct{...}` are types, `) T {` starts a body.
+            let starts_body = c != '{' || previous.is_whitespace() || at == 0;
+            if starts_body
+                && terminators
+                    .iter()
+                    .any(|terminator| text[at..].starts_with(terminator))
+            {
+                return text[..at].trim();
+            }
+        }
+        match c {
+            '(' | '[' | '{' | '<' => depth += 1,
+            ')' | ']' | '}' => depth = depth.saturating_sub(1),
+            '>' if !matches!(previous, '-' | '=') => depth = depth.saturating_sub(1),
+            _ => {}
+        }
+        previous = c;
+    }
+    text.trim()
+}
+
+/// A single declared result; nothing for `()`, `void` and `None`.
+fn single(ty: &str) -> Vec<String> {
+    match normalize(ty).as_str() {
+        "" | "()" | "void" | "None" => Vec::new(),
+        ty => vec![ty.to_string()],
+    }
+}
+
+/// Offset of the bracket closing the one at `open`.
+fn matching_close(text: &str, open: usize) -> Option<usize> {
+    let mut depth = 0usize;
+    let mut previous = ' ';
+    for (at, c) in text[open..].char_indices() {
+        match c {
+            '(' | '[' | '{' | '<' => depth += 1,
+            ')' | ']' | '}' => depth = depth.checked_sub(1)?,
+            '>' if !matches!(previous, '-' | '=') => depth = depth.checked_sub(1)?,
+            _ => {}
+        }
+        if depth == 0 {
+            return Some(open + at);
+        }
+        previous = c;
+    }
+    None
+}
+
+/// The `,`-separated parts of a list outside brackets, trimmed.
+fn split_top_level(text: &str) -> Vec<String> {
+    let mut parts = Vec::new();
+    let mut depth = 0usize;
+    let mut start = 0;
+    let mut previous = ' ';
+    for (at, c) in text.char_indices() {
+        match c {
+            '(' | '[' | '{' | '<' => depth += 1,
+            ')' | ']' | '}' => depth = depth.saturating_sub(1),
+            '>' if !matches!(previous, '-' | '=') => depth = depth.saturating_sub(1),
+            ',' if depth == 0 => {
+                parts.push(text[start..at].trim().to_string());
+                start = at + 1;
+            }
+            _ => {}
+        }
+        previous = c;
+    }
+    parts.push(text[start..].trim().to_string());
+    parts.retain(|part| !part.is_empty());
+    parts
+}
+
+fn find_top_level(text: &str, wanted: char) -> Option<usize> {
+    let mut depth = 0usize;
+    for (at, c) in text.char_indices() {
+        match c {
+            '(' | '[' | '{' | '<' => depth += 1,
+            ')' | ']' | '}' | '>' => depth = depth.saturating_sub(1),
+            _ if c == wanted && depth == 0 => return Some(at),
+            _ => {}
+        }
+    }
+    None
+}
+
+/// `[] *pkg.T` as `[]*pkg.T`: whitespace kept only between words.
+fn normalize(ty: &str) -> String {
+    let mut out = String::with_capacity(ty.len());
+    let mut space = false;
+    for c in ty.trim().chars() {
+        if c.is_whitespace() {
+            space = true;
+            continue;
+        }
+        if space && out.chars().next_back().is_some_and(is_word) && is_word(c) {
+            out.push(' ');
+        }
+        space = false;
+        out.push(c);
+    }
+    out
+}
+
+fn is_word(c: char) -> bool {
+    c.is_alphanumeric() || c == '_'
+}
+
+fn is_rest(slot: &str) -> bool {
+    matches!(slot, ".." | "...")
+}
+
+fn list_matches(slots: &[String], types: &[String], package: Option<&str>) -> bool {
+    match slots.split_first() {
+        None => types.is_empty(),
+        Some((slot, rest)) if is_rest(slot) => {
+            (0..=types.len()).any(|skip| list_matches(rest, &types[skip..], package))
+        }
+        Some((slot, rest)) => types.split_first().is_some_and(|(ty, tail)| {
+            slot_matches(slot, ty, package) && list_matches(rest, tail, package)
+        }),
+    }
+}
+
+fn slot_matches(slot: &str, ty: &str, package: Option<&str>) -> bool {
+    if slot == "_" {
+        return true;
+    }
+    if ty.is_empty() {
+        return false;
+    }
+    let pattern = pieces(slot);
+    let ty: Vec<char> = ty.chars().collect();
+    glob_matches(&pattern, &ty)
+        || package.is_some_and(|package| {
+            let local = unqualify(&pattern, package);
+            local != pattern && glob_matches(&local, &ty)
+        })
+}
+
+/// One character of a type pattern, or a `*` wildcard.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Piece {
+    Char(char),
+    Any,
+}
+
+/// A `*` is a pointer when it starts a type (`*T`, `[]*T`, `**T`) and a
+/// wildcard everywhere else (`api.*`, `*Handler`, `Result<*>`).
+fn pieces(slot: &str) -> Vec<Piece> {
+    let chars: Vec<char> = slot.chars().collect();
+    chars
+        .iter()
+        .enumerate()
+        .map(|(at, &c)| {
+            if c != '*' {
+                return Piece::Char(c);
+            }
+            let after_name = at > 0 && (is_word(chars[at - 1]) || chars[at - 1] == '.');
+            let before_type = chars
+                .get(at + 1)
+                .is_some_and(|&next| is_word(next) || matches!(next, '*' | '[' | '('));
+            if before_type && !after_name {
+                Piece::Char('*')
+            } else {
+                Piece::Any
+            }
+        })
+        .collect()
+}
+
+/// `pattern` with the `package.` qualifier dropped from the names it holds.
+fn unqualify(pattern: &[Piece], package: &str) -> Vec<Piece> {
+    let qualifier: Vec<Piece> = package.chars().chain(['.']).map(Piece::Char).collect();
+    let mut out: Vec<Piece> = Vec::with_capacity(pattern.len());
+    let mut at = 0;
+    while at < pattern.len() {
+        // `subhandlers.T` does not start with `handlers.`.
+        let boundary = !matches!(out.last(), Some(Piece::Char(c)) if is_word(*c) || *c == '.');
+        if boundary && pattern[at..].starts_with(&qualifier) {
+            at += qualifier.len();
+            continue;
+        }
+        out.push(pattern[at]);
+        at += 1;
+    }
+    out
+}
+
+fn glob_matches(pattern: &[Piece], ty: &[char]) -> bool {
+    match pattern.split_first() {
+        None => ty.is_empty(),
+        Some((Piece::Any, rest)) => (0..=ty.len()).any(|skip| glob_matches(rest, &ty[skip..])),
+        Some((Piece::Char(c), rest)) => ty.first() == Some(c) && glob_matches(rest, &ty[1..]),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::{db, schema};
+
+    fn function(name: &str, language: &str, path: &str, line: u32, content: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: language.to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.rsplit('.').next().unwrap_or(name).to_string(),
+            qualified_name: name.to_string(),
+            kind: if name.contains('.') {
+                SymbolKind::Method
+            } else {
+                SymbolKind::Function
+            },
+            signature: content.lines().next().map(str::to_string),
+            line_start: line,
+            line_end: line + 3,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    fn types(symbol: &SymbolRecord) -> (Vec<String>, Vec<String>) {
+        declared_types(symbol).unwrap()
+    }
+
+    #[test]
+    fn declared_types_are_read_per_language() {
+        assert_eq!(
+            types(&function(
+                "Server.Serve",
+                "go",
+                "server/server.go",
+                1,
+                "func (s *Server) Serve(ctx context.Context, a, b int, opts ...Option) (*Response, error) {\n\treturn nil, nil\n}"
+            )),
+            (
+                vec![
+                    "context.Context".to_string(),
+                    "int".to_string(),
+                    "int".to_string(),
+                    "...Option".to_string()
+                ],
+                vec!["*Response".to_string(), "error".to_string()]
+            )
+        );
+        assert_eq!(
+            types(&function(
+                "Empty",
+                "go",
+                "x/x.go",
+                1,
+                "func Empty[T any](chan int, map[string]T) interface{} {\n}"
+            )),
+            (
+                vec!["chan int".to_string(), "map[string]T".to_string()],
+                vec!["interface{}".to_string()]
+            )
+        );
+        assert_eq!(
+            types(&function(
+                "Parser.parse",
+                "rust",
+                "src/parse.rs",
+                1,
+                "pub fn parse<T: FromStr>(&mut self, input: &str, f: impl Fn(u8) -> bool) -> Result<T, Error>\nwhere\n    T: Debug,\n{\n}"
+            )),
+            (
+                vec!["&str".to_string(), "impl Fn(u8)->bool".to_string()],
+                vec!["Result<T,Error>".to_string()]
+            )
+        );
+        assert_eq!(
+            types(&function(
+                "Store.load",
+                "python",
+                "app/store.py",
+                1,
+                "def load(self, path: str, *names, retries: int = 3) -> None:\n    pass"
+            )),
+            (
+                vec!["str".to_string(), String::new(), "int".to_string()],
+                Vec::new()
+            )
+        );
+        assert_eq!(
+            types(&function(
+                "fetchUser",
+                "typescript",
+                "web/api.ts",
+                1,
+                "export async function fetchUser(id: string, opts?: Options): Promise<User> {\n}"
+            )),
+            (
+                vec!["string".to_string(), "Options".to_string()],
+                vec!["Promise<User>".to_string()]
+            )
+        );
+    }
+
+    #[test]
+    fn patterns_match_types_wildcards_and_package_local_names() {
+        let matches = |pattern: &str, symbol: &SymbolRecord| {
+            let (params, results) = types(symbol);
+            SignaturePattern::parse(pattern).unwrap().matches(
+                &params,
+                &results,
+                package_name(&symbol.path),
+            )
+        };
+        let handler = function(
+            "HandleUser",
+            "go",
+            "internal/handlers/user.go",
+            1,
+            "func HandleUser(req *Request) *Response {\n}",
+        );
+        assert!(matches(
+            "func(*handlers.Request) *handlers.Response",
+            &handler
+        ));
+        assert!(matches("(*Request) *Response", &handler));
+        assert!(matches("func(_) *handlers.*", &handler));
+        assert!(!matches("func(*handlers.Request)", &handler));
+        assert!(!matches("func(*api.Request) *api.Response", &handler));
+
+        let serve = function(
+            "Server.Serve",
+            "go",
+            "server/server.go",
+            1,
+            "func (s *Server) Serve(ctx context.Context, req *handlers.Request) (*handlers.Response, error) {\n}",
+        );
+        assert!(matches(
+            "func(ctx context.Context, req *handlers.Request) (*handlers.Response, error)",
+            &serve
+        ));
+        assert!(matches("func(.., *handlers.*) (_, error)", &serve));
+        assert!(matches("func(...) (..)", &serve));
+        assert!(!matches("func(context.Context) (_, error)", &serve));
+
+        let parse = function(
+            "parse",
+            "rust",
+            "src/parse.rs",
+            1,
+            "fn parse(input: &str, strict: bool) -> Result<Config, Error> {\n}",
+        );
+        assert!(matches("fn(&str, ..) -> Result<*>", &parse));
+        assert!(!matches("fn(&str) -> Result<*>", &parse));
+    }
+
+    #[test]
+    fn search_signatures_filters_and_reports_matches() {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            function(
+                "HandleUser",
+                "go",
+                "handlers/user.go",
+                3,
+                "func HandleUser(req *Request) *Response {\n\treturn nil\n}",
+            ),
+            function(
+                "HandleOrder",
+                "go",
+                "handlers/order.go",
+                8,
+                "func HandleOrder(req *Request) *Response {\n\treturn nil\n}",
+            ),
+            function(
+                "helper",
+                "go",
+                "handlers/util.go",
+                1,
+                "func helper(a, b int) string {\n\treturn \"\"\n}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let found = search_signatures(
+            &conn,
+            "repo",
+            "main",
+            "func(*handlers.Request) *handlers.Response",
+            &SymbolFilter::default(),
+            1,
+        )
+        .unwrap();
+        assert_eq!(found.total, 2);
+        assert_eq!(found.matches.len(), 1);
+        assert_eq!(found.matches[0].name, "HandleOrder");
+        assert_eq!(found.matches[0].params, ["*Request"]);
+
+        let scoped = SymbolFilter {
+            package: Some("handlers/util.go".to_string()),
+            ..SymbolFilter::default()
+        };
+        let found =
+            search_signatures(&conn, "repo", "main", "func(int, int) string", &scoped, 10).unwrap();
+        assert_eq!(found.total, 1);
+
+        assert!(matches!(
+            search_signatures(
+                &conn,
+                "repo",
+                "main",
+                "HandleUser",
+                &SymbolFilter::default(),
+                10
+            ),
+            Err(SignatureError::InvalidPattern { .. })
+        ));
+    }
+}
@@ -0,0 +1,739 @@
+//! The exact source of one symbol with byte offsets, for `cruxe snippet`,
+//! and on request what it takes to read it correctly: the comments above
+//! it, the imports it uses, the types it names and the places that call it.
+//!
+//! Ranges are whole lines as the index records them, read from the working
+//! tree, with byte offsets into the file (end exclusive) so an agent can
+//! read or patch exactly that span. `stale` is set when the symbol's file
+//! changed since it was indexed, in which case the lines may have moved.
+
+use crate::describe::{DescribeError, resolve_symbol};
+use crate::ref_sites::{identifier_matches, is_import_line};
+use crate::symbol_context::{leading_comment_start, referenced_types};
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::{edges, manifest, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+use std::fmt::Write as _;
+use std::path::Path;
+
+/// Lines shown on each side of a call site.
+const CALLER_CONTEXT_LINES: u32 = 2;
+/// Longest import statement followed across lines.
+const MAX_IMPORT_LINES: usize = 50;
+/// Words of an import statement that never name what it brings in.
+const IMPORT_KEYWORDS: &[&str] = &[
+    "as", "const", "crate", "default", "extern", "from", "import", "let", "pub", "require", "self",
+    "static", "super", "type", "typeof", "use", "var",
+];
+
+#[derive(Debug, thiserror::Error)]
+pub enum SnippetError {
+    #[error(transparent)]
+    Resolve(#[from] DescribeError),
+    #[error("cannot read {0} from the working tree")]
+    SourceUnavailable(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+/// Surroundings to add to the symbol's own range.
+#[derive(Debug, Clone, Copy, Default)]
+pub struct SnippetOptions {
+    pub with_doc: bool,
+    pub with_imports: bool,
+    pub with_types: bool,
+    /// Call sites shown, at most one per calling symbol.
+    pub with_callers: usize,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SourceRange {
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    /// Offset of the first byte of `line_start` in the file.
+    pub byte_start: usize,
+    /// Offset just past the last byte of `line_end`, before its newline.
+    pub byte_end: usize,
+    pub content: String,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SnippetType {
+    pub name: String,
+    pub kind: String,
+    #[serde(flatten)]
+    pub range: SourceRange,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct SnippetCaller {
+    pub name: String,
+    pub call_line: u32,
+    /// The call with up to two lines around it, within the caller.
+    #[serde(flatten)]
+    pub range: SourceRange,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct Snippet {
+    pub symbol: String,
+    pub kind: String,
+    pub language: String,
+    #[serde(rename = "ref")]
+    pub ref_name: String,
+    /// The file differs from the indexed version.
+    pub stale: bool,
+    pub definition: SourceRange,
+    /// Comments and attributes directly above the definition.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub doc: Option<SourceRange>,
+    /// Import statements of the file whose names the definition uses,
+    /// adjacent ones merged.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub imports: Vec<SourceRange>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub types: Vec<SnippetType>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub callers: Vec<SnippetCaller>,
+}
+
+/// Extract `symbol` (a bare or qualified name, optionally restricted to
+/// one file) in `ref_name` with the surroundings `options` asks for.
+pub fn extract_snippet(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    path: Option<&str>,
+    options: &SnippetOptions,
+) -> Result<Snippet, SnippetError> {
+    let sym = resolve_symbol(conn, project_id, ref_name, symbol, path)?;
+    let mut files = SourceFiles::new(workspace);
+    let file = files
+        .get(&sym.path)
+        .ok_or_else(|| SnippetError::SourceUnavailable(sym.path.clone()))?;
+    let stale = manifest::get_content_hash(conn, project_id, ref_name, &sym.path)?
+        .is_some_and(|hash| hash != blake3::hash(file.text.as_bytes()).to_hex().as_str());
+    let definition = file.range(&sym.path, sym.line_start, sym.line_end);
+
+    let doc = if options.with_doc {
+        let start = leading_comment_start(&file.lines, sym.line_start);
+        (start < sym.line_start).then(|| file.range(&sym.path, start, sym.line_start - 1))
+    } else {
+        None
+    };
+    let imports = if options.with_imports {
+        import_ranges(file, &sym, &definition.content)
+    } else {
+        Vec::new()
+    };
+
+    let mut types = Vec::new();
+    if options.with_types {
+        for target in referenced_types(conn, project_id, ref_name, &sym, &definition.content)? {
+            let nested = target.path == sym.path
+                && target.line_start >= sym.line_start
+                && target.line_end <= sym.line_end;
+            if nested {
+                continue;
+            }
+            if let Some(file) = files.get(&target.path) {
+                types.push(SnippetType {
+                    range: file.range(&target.path, target.line_start, target.line_end),
+                    name: target.qualified_name,
+                    kind: target.kind.as_str().to_string(),
+                });
+            }
+        }
+    }
+    let callers = callers(
+        conn,
+        project_id,
+        ref_name,
+        &sym,
+        options.with_callers,
+        &mut files,
+    )?;
+
+    Ok(Snippet {
+        symbol: sym.qualified_name,
+        kind: sym.kind.as_str().to_string(),
+        language: sym.language,
+        ref_name: ref_name.to_string(),
+        stale,
+        definition,
+        doc,
+        imports,
+        types,
+        callers,
+    })
+}
+
+/// Plain-text rendering in reading order: imports, doc comment,
+/// definition, types, callers, each under a `---` header with its lines
+/// and byte range.
+pub fn render_text(snippet: &Snippet) -> String {
+    let mut out = String::new();
+    if snippet.stale {
+        let _ = writeln!(
+            out,
+            "note: {} changed since it was indexed; ranges may be off until `cruxe sync`",
+            snippet.definition.path
+        );
+    }
+    for range in &snippet.imports {
+        section(&mut out, "imports", None, range);
+    }
+    if let Some(doc) = &snippet.doc {
+        section(&mut out, "doc", None, doc);
+    }
+    section(
+        &mut out,
+        "definition",
+        Some(&snippet.symbol),
+        &snippet.definition,
+    );
+    for found in &snippet.types {
+        section(&mut out, "type", Some(&found.name), &found.range);
+    }
+    for caller in &snippet.callers {
+        section(&mut out, "caller", Some(&caller.name), &caller.range);
+    }
+    out
+}
+
+fn section(out: &mut String, role: &str, name: Option<&str>, range: &SourceRange) {
+    let name = name.map(|name| format!(" {name}")).unwrap_or_default();
+    let _ = writeln!(
+        out,
+        "--- {role}{name} {}:{}-{} [{}..{}]",
+        range.path, range.line_start, range.line_end, range.byte_start, range.byte_end
+    );
+    let _ = writeln!(out, "{}", range.content);
+}
+
+/// The call sites of `sym`, one per calling symbol, in file and line order.
+fn callers(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+    limit: usize,
+    files: &mut SourceFiles,
+) -> Result<Vec<SnippetCaller>, StateError> {
+    if limit == 0 {
+        return Ok(Vec::new());
+    }
+    let mut calls = Vec::new();
+    for id in [&sym.symbol_stable_id, &sym.symbol_id] {
+        calls.extend(edges::get_callers(conn, project_id, ref_name, id)?);
+    }
+    calls.sort_by(|a, b| {
+        a.source_file
+            .cmp(&b.source_file)
+            .then_with(|| a.source_line.cmp(&b.source_line))
+    });
+
+    let mut seen = HashSet::new();
+    let mut found = Vec::new();
+    for edge in calls {
+        if found.len() == limit {
+            break;
+        }
+        if !seen.insert(edge.from_symbol_id.clone()) {
+            continue;
+        }
+        let caller = match symbols::get_symbol_by_stable_id(
+            conn,
+            project_id,
+            ref_name,
+            &edge.from_symbol_id,
+        )? {
+            Some(caller) => Some(caller),
+            None => symbols::get_symbol_by_id(conn, project_id, ref_name, &edge.from_symbol_id)?,
+        };
+        let Some(caller) = caller else {
+            continue;
+        };
+        let path = if edge.source_file.is_empty() {
+            caller.path.clone()
+        } else {
+            edge.source_file
+        };
+        let Some(file) = files.get(&path) else {
+            continue;
+        };
+        let line = edge.source_line.max(1);
+        let start = line
+            .saturating_sub(CALLER_CONTEXT_LINES)
+            .max(caller.line_start)
+            .max(1);
+        let end = (line + CALLER_CONTEXT_LINES).min(caller.line_end.max(line));
+        found.push(SnippetCaller {
+            name: caller.qualified_name,
+            call_line: line,
+            range: file.range(&path, start, end),
+        });
+    }
+    Ok(found)
+}
+
+/// Import statements of `file` binding a name `definition` uses, runs of
+/// adjacent ones merged into one range.
+fn import_ranges(file: &SourceFile, sym: &SymbolRecord, definition: &str) -> Vec<SourceRange> {
+    let mut used: Vec<(usize, usize)> = Vec::new();
+    for (start, end) in import_statements(&file.lines) {
+        let statement = file.lines[start - 1..end].join("\n");
+        let binds_used_name = bound_names(&statement, &sym.language)
+            .iter()
+            .any(|name| !identifier_matches(definition, name).is_empty());
+        if !binds_used_name {
+            continue;
+        }
+        match used.last_mut() {
+            Some(last) if last.1 + 1 == start => last.1 = end,
+            _ => used.push((start, end)),
+        }
+    }
+    used.into_iter()
+        .map(|(start, end)| file.range(&sym.path, start as u32, end as u32))
+        .collect()
+}
+
+/// One-based line ranges of the unindented import statements, each line
+/// of a Go `import ( ... )` block on its own.
+fn import_statements(lines: &[String]) -> Vec<(usize, usize)> {
+    let mut statements = Vec::new();
+    let mut in_go_block = false;
+    let mut idx = 0;
+    while idx < lines.len() {
+        let line = lines[idx].trim_end();
+        let trimmed = line.trim_start();
+        if in_go_block {
+            if trimmed.starts_with(')') {
+                in_go_block = false;
+            } else if !trimmed.is_empty() && !trimmed.starts_with("//") {
+                statements.push((idx + 1, idx + 1));
+            }
+            idx += 1;
+            continue;
+        }
+        if line.starts_with("import (") {
+            in_go_block = true;
+            idx += 1;
+            continue;
+        }
+        if !trimmed.is_empty() && trimmed.len() == line.len() && is_import_line(trimmed) {
+            let mut end = idx;
+            let mut depth = bracket_depth(line);
+            while depth > 0 && end + 1 < lines.len() && end - idx < MAX_IMPORT_LINES {
+                end += 1;
+                depth += bracket_depth(&lines[end]);
+            }
+            statements.push((idx + 1, end + 1));
+            idx = end + 1;
+            continue;
+        }
+        idx += 1;
+    }
+    statements
+}
+
+fn bracket_depth(line: &str) -> i32 {
+    line.chars()
+        .map(|c| match c {
+            '{' | '(' | '[' => 1,
+            '}' | ')' | ']' => -1,
+            _ => 0,
+        })
+        .sum()
+}
+
+/// Names an import statement brings into scope: the alias or last path
+/// segment of each item (`use std::io::{self, Read}` gives `Read`), the
+/// top-level module of a Python `import a.b`, the package name of a Go
+/// import path.
+fn bound_names(statement: &str, language: &str) -> Vec<String> {
+    let text = statement.split_whitespace().collect::<Vec<_>>().join(" ");
+    let text = text.trim_end_matches(';');
+    if language == "go" {
+        let text = text.strip_prefix("import ").unwrap_or(text);
+        let Some((alias, path)) = text.split_once('"') else {
+            return Vec::new();
+        };
+        let alias = alias.trim();
+        if !alias.is_empty() {
+            return vec![alias.to_string()];
+        }
+        let mut segments = path.trim_end_matches('"').rsplit('/');
+        let last = segments.next().unwrap_or_default();
+        let is_version = last
+            .strip_prefix('v')
+            .is_some_and(|rest| !rest.is_empty() && rest.chars().all(|c| c.is_ascii_digit()));
+        let name = match segments.next() {
+            Some(parent) if is_version => parent,
+            _ => last,
+        };
+        return vec![name.to_string()];
+    }
+
+    let (names, modules) = if let Some(rest) = text.strip_prefix("from ")
+        && let Some((_, names)) = rest.split_once(" import ")
+    {
+        (names, false)
+    } else if language == "python"
+        && let Some(names) = text.strip_prefix("import ")
+    {
+        (names, true)
+    } else if let Some((names, _)) = text.split_once(" from ") {
+        (names, false)
+    } else if let Some((names, _)) = text.split_once("require(") {
+        (names, false)
+    } else {
+        (text, false)
+    };
+
+    let mut bound = Vec::new();
+    for item in names.split(',') {
+        let item = item.trim();
+        let item = item.rsplit_once(" as ").map_or(item, |(_, alias)| alias);
+        let item = if modules {
+            item.split('.').next().unwrap_or(item)
+        } else {
+            item.rsplit(['.', ':']).next().unwrap_or(item)
+        };
+        let item = item.trim_matches(|c: char| !(c.is_alphanumeric() || c == '_'));
+        let name = item.rsplit(' ').next().unwrap_or(item);
+        let is_name = !name.is_empty()
+            && name != "_"
+            && name.chars().all(|c| c.is_alphanumeric() || c == '_')
+            && !IMPORT_KEYWORDS.contains(&name);
+        if is_name && !bound.iter().any(|seen| seen == name) {
+            bound.push(name.to_string());
+        }
+    }
+    bound
+}
+
+/// A working-tree file with the byte offset of each line.
+struct SourceFile {
+    text: String,
+    lines: Vec<String>,
+    line_starts: Vec<usize>,
+}
+
+impl SourceFile {
+    fn new(text: String) -> Self {
+        let lines = text.lines().map(str::to_string).collect();
+        let line_starts = std::iter::once(0)
+            .chain(text.match_indices('\n').map(|(newline, _)| newline + 1))
+            .filter(|&start| start == 0 || start < text.len())
+            .collect();
+        Self {
+            text,
+            lines,
+            line_starts,
+        }
+    }
+
+    /// Lines `start..=end` (one-based, clamped to the file).
+    fn range(&self, path: &str, start: u32, end: u32) -> SourceRange {
+        let count = self.line_starts.len();
+        let start = (start.max(1) as usize).min(count);
+        let end = (end as usize).clamp(start, count);
+        let byte_start = self.line_starts[start - 1];
+        let mut byte_end = self
+            .line_starts
+            .get(end)
+            .map_or(self.text.len(), |next| next - 1);
+        if self.text[..byte_end].ends_with('\r') {
+            byte_end -= 1;
+        }
+        SourceRange {
+            path: path.to_string(),
+            line_start: start as u32,
+            line_end: end as u32,
+            byte_start,
+            byte_end,
+            content: self.text[byte_start..byte_end].to_string(),
+        }
+    }
+}
+
+/// Working-tree files read once each; `None` for unreadable files.
+struct SourceFiles<'a> {
+    workspace: &'a Path,
+    files: HashMap<String, Option<SourceFile>>,
+}
+
+impl<'a> SourceFiles<'a> {
+    fn new(workspace: &'a Path) -> Self {
+        Self {
+            workspace,
+            files: HashMap::new(),
+        }
+    }
+
+    fn get(&mut self, path: &str) -> Option<&SourceFile> {
+        let workspace = self.workspace;
+        self.files
+            .entry(path.to_string())
+            .or_insert_with(|| {
+                std::fs::read_to_string(workspace.join(path))
+                    .ok()
+                    .map(SourceFile::new)
+            })
+            .as_ref()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind};
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    const AUTH: &str = "package auth
+
+import (
+\t\"errors\"
+\t\"net/http\"
+\t\"time\"
+)
+
+// Claims holds the token subject.
+type Claims struct {
+\tSubject string
+\tExp     time.Time
+}
+
+// Validate checks the request's bearer token.
+func Validate(r *http.Request) (*Claims, error) {
+\tclaims := &Claims{Subject: r.Header.Get(\"Authorization\")}
+\tif claims.Subject == \"\" {
+\t\treturn nil, errors.New(\"missing token\")
+\t}
+\treturn claims, nil
+}
+";
+
+    const LOGIN: &str = "package api
+
+func Login(w http.ResponseWriter, r *http.Request) {
+\tlog.Println(\"login\")
+\tclaims, err := auth.Validate(r)
+\tif err != nil {
+\t\treturn
+\t}
+\t_ = claims
+}
+";
+
+    fn record(name: &str, kind: SymbolKind, path: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("{}.{name}", path.split('/').next().unwrap()),
+            kind,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        for (path, content) in [("auth/auth.go", AUTH), ("api/login.go", LOGIN)] {
+            let full = tmp.path().join(path);
+            std::fs::create_dir_all(full.parent().unwrap()).unwrap();
+            std::fs::write(full, content).unwrap();
+        }
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for symbol in [
+            record("Claims", SymbolKind::Struct, "auth/auth.go", (10, 13)),
+            record("Validate", SymbolKind::Function, "auth/auth.go", (16, 22)),
+            record("Login", SymbolKind::Function, "api/login.go", (3, 10)),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[CallEdge {
+                repo: "repo".to_string(),
+                ref_name: "main".to_string(),
+                from_symbol_id: "stable::Login".to_string(),
+                to_symbol_id: Some("stable::Validate".to_string()),
+                to_name: Some("Validate".to_string()),
+                edge_type: "calls".to_string(),
+                confidence: "static".to_string(),
+                source_file: "api/login.go".to_string(),
+                source_line: 5,
+            }],
+        )
+        .unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn ranges_carry_exact_byte_offsets_and_surroundings_on_request() {
+        let (tmp, conn) = setup();
+        let bare = extract_snippet(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            "Validate",
+            None,
+            &SnippetOptions::default(),
+        )
+        .unwrap();
+        let definition = &bare.definition;
+        assert_eq!((definition.line_start, definition.line_end), (16, 22));
+        assert_eq!(definition.byte_start, AUTH.find("func Validate").unwrap());
+        assert_eq!(
+            &AUTH[definition.byte_start..definition.byte_end],
+            definition.content
+        );
+        assert!(definition.content.ends_with("return claims, nil\n}"));
+        assert!(bare.doc.is_none() && bare.imports.is_empty() && bare.callers.is_empty());
+        assert!(!bare.stale);
+
+        let options = SnippetOptions {
+            with_doc: true,
+            with_imports: true,
+            with_types: true,
+            with_callers: 1,
+        };
+        let full = extract_snippet(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            "auth.Validate",
+            None,
+            &options,
+        )
+        .unwrap();
+        assert_eq!(
+            full.doc.as_ref().map(|doc| doc.content.as_str()),
+            Some("// Validate checks the request's bearer token.")
+        );
+        // `time` is imported for Claims, not used by Validate.
+        assert_eq!(full.imports.len(), 1);
+        assert_eq!(full.imports[0].content, "\t\"errors\"\n\t\"net/http\"");
+        assert_eq!(
+            &AUTH[full.imports[0].byte_start..full.imports[0].byte_end],
+            full.imports[0].content
+        );
+        assert_eq!(full.types.len(), 1);
+        assert_eq!(full.types[0].name, "auth.Claims");
+        assert!(
+            full.types[0]
+                .range
+                .content
+                .starts_with("type Claims struct {")
+        );
+        assert_eq!(full.callers.len(), 1);
+        assert_eq!(full.callers[0].name, "api.Login");
+        assert_eq!(full.callers[0].call_line, 5);
+        assert_eq!(
+            (
+                full.callers[0].range.line_start,
+                full.callers[0].range.line_end
+            ),
+            (3, 7)
+        );
+        assert!(full.callers[0].range.content.contains("auth.Validate(r)"));
+
+        let text = render_text(&full);
+        assert!(text.contains("--- imports auth/auth.go:4-5 ["), "{text}");
+        assert!(text.contains("--- definition auth.Validate auth/auth.go:16-22 ["));
+
+        manifest::upsert_manifest(
+            &conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "auth/auth.go".to_string(),
+                content_hash: "indexed-before-an-edit".to_string(),
+                size_bytes: AUTH.len() as u64,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+        let stale = extract_snippet(
+            &conn,
+            tmp.path(),
+            "repo",
+            "main",
+            "Validate",
+            None,
+            &SnippetOptions::default(),
+        )
+        .unwrap();
+        assert!(stale.stale);
+    }
+
+    #[test]
+    fn import_statements_bind_their_last_segment_or_alias() {
+        assert_eq!(bound_names("use std::io::{self, Read};", "rust"), ["Read"]);
+        assert_eq!(
+            bound_names("use crate::deps::package_name as package;", "rust"),
+            ["package"]
+        );
+        assert_eq!(
+            bound_names(
+                "import {\n  Router,\n  Request as Req,\n} from 'express';",
+                "typescript"
+            ),
+            ["Router", "Req"]
+        );
+        assert_eq!(
+            bound_names("const jwt = require('jsonwebtoken');", "javascript"),
+            ["jwt"]
+        );
+        assert_eq!(
+            bound_names("from os import path as p, sep", "python"),
+            ["p", "sep"]
+        );
+        assert_eq!(bound_names("import os.path", "python"), ["os"]);
+        assert_eq!(bound_names("import java.util.List;", "java"), ["List"]);
+        assert_eq!(bound_names("\t\"net/http\"", "go"), ["http"]);
+        assert_eq!(
+            bound_names("\tjwt \"github.com/golang-jwt/jwt/v5\"", "go"),
+            ["jwt"]
+        );
+        assert_eq!(
+            bound_names("import \"github.com/golang-jwt/jwt/v5\"", "go"),
+            ["jwt"]
+        );
+
+        let lines: Vec<String> =
+            "use std::collections::{\n    HashMap,\n};\n\nfn main() {\n    use inner::thing;\n}\n"
+                .lines()
+                .map(str::to_string)
+                .collect();
+        assert_eq!(import_statements(&lines), [(1, 3)]);
+    }
+}
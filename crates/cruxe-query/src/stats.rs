@@ -0,0 +1,374 @@
+use crate::graph_export::{GraphNode, GraphSnapshot};
+use crate::report::{ROOT_PACKAGE, SymbolMetric};
+use cruxe_core::error::StateError;
+use cruxe_state::manifest;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::path::Path;
+
+/// One indexed file with its line counts.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct FileLines {
+    pub path: String,
+    pub language: String,
+    /// Non-blank lines.
+    pub loc: u64,
+}
+
+/// Counts for the whole repository, one package or one language.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, JsonSchema)]
+pub struct GroupStats {
+    pub name: String,
+    pub files: usize,
+    pub loc: u64,
+    pub symbols: usize,
+    pub symbols_by_kind: BTreeMap<String, usize>,
+    pub functions: usize,
+    /// Mean length in lines of functions and methods.
+    pub avg_function_length: f64,
+}
+
+/// Summary of a count distribution (nearest-rank percentiles).
+#[derive(Debug, Clone, Default, PartialEq, Serialize, JsonSchema)]
+pub struct Distribution {
+    pub min: usize,
+    pub p50: usize,
+    pub p90: usize,
+    pub p99: usize,
+    pub max: usize,
+    pub mean: f64,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct RepoStats {
+    pub repo: String,
+    pub ref_name: String,
+    pub totals: GroupStats,
+    pub packages: Vec<GroupStats>,
+    pub languages: Vec<GroupStats>,
+    /// Over functions and methods.
+    pub fan_in: Distribution,
+    pub fan_out: Distribution,
+    pub most_connected: Vec<SymbolMetric>,
+}
+
+/// Line counts for every file in the manifest, read from the working tree.
+/// Files that can no longer be read count with zero lines.
+pub fn load_file_lines(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<FileLines>, StateError> {
+    let mut files: Vec<FileLines> = manifest::get_all_entries(conn, repo, ref_name)?
+        .into_iter()
+        .map(|entry| {
+            let loc = std::fs::read_to_string(workspace.join(&entry.path))
+                .map(|content| {
+                    content
+                        .lines()
+                        .filter(|line| !line.trim().is_empty())
+                        .count() as u64
+                })
+                .unwrap_or(0);
+            FileLines {
+                language: entry.language.unwrap_or_default(),
+                path: entry.path,
+                loc,
+            }
+        })
+        .collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+    Ok(files)
+}
+
+pub fn build_stats(snapshot: &GraphSnapshot, files: &[FileLines], top: usize) -> RepoStats {
+    let mut fan_in: HashMap<&str, usize> = HashMap::new();
+    let mut fan_out: HashMap<&str, usize> = HashMap::new();
+    for edge in &snapshot.edges {
+        if edge.source == edge.target {
+            continue;
+        }
+        *fan_out.entry(edge.source.as_str()).or_default() += 1;
+        *fan_in.entry(edge.target.as_str()).or_default() += 1;
+    }
+
+    let symbols: Vec<&GraphNode> = snapshot
+        .nodes
+        .iter()
+        .filter(|node| node.kind != "file" && node.kind != "unknown")
+        .collect();
+    let file_languages: HashMap<&str, &str> = files
+        .iter()
+        .map(|file| (file.path.as_str(), file.language.as_str()))
+        .collect();
+
+    let mut totals = Accumulator::default();
+    let mut packages: BTreeMap<String, Accumulator> = BTreeMap::new();
+    let mut languages: BTreeMap<String, Accumulator> = BTreeMap::new();
+    for file in files {
+        let language = language_name(&file.language);
+        for acc in [
+            &mut totals,
+            packages.entry(package_of(&file.path)).or_default(),
+            languages.entry(language).or_default(),
+        ] {
+            acc.files += 1;
+            acc.loc += file.loc;
+        }
+    }
+    for node in &symbols {
+        let language = if node.language.is_empty() {
+            file_languages
+                .get(node.path.as_str())
+                .copied()
+                .unwrap_or_default()
+        } else {
+            node.language.as_str()
+        };
+        for acc in [
+            &mut totals,
+            packages.entry(package_of(&node.path)).or_default(),
+            languages.entry(language_name(language)).or_default(),
+        ] {
+            acc.add_symbol(node);
+        }
+    }
+
+    let callables: Vec<&&GraphNode> = symbols.iter().filter(|node| is_callable(node)).collect();
+    let fan_in_counts: Vec<usize> = callables
+        .iter()
+        .map(|node| fan_in.get(node.id.as_str()).copied().unwrap_or(0))
+        .collect();
+    let fan_out_counts: Vec<usize> = callables
+        .iter()
+        .map(|node| fan_out.get(node.id.as_str()).copied().unwrap_or(0))
+        .collect();
+
+    let mut most_connected: Vec<SymbolMetric> = symbols
+        .iter()
+        .map(|node| SymbolMetric {
+            qualified_name: node.qualified_name.clone(),
+            kind: node.kind.clone(),
+            path: node.path.clone(),
+            line_start: node.line_start,
+            loc: node.loc(),
+            fan_in: fan_in.get(node.id.as_str()).copied().unwrap_or(0),
+            fan_out: fan_out.get(node.id.as_str()).copied().unwrap_or(0),
+        })
+        .filter(|metric| metric.fan_in + metric.fan_out > 0)
+        .collect();
+    most_connected.sort_by(|a, b| {
+        (b.fan_in + b.fan_out)
+            .cmp(&(a.fan_in + a.fan_out))
+            .then_with(|| a.qualified_name.cmp(&b.qualified_name))
+    });
+    most_connected.truncate(top);
+
+    RepoStats {
+        repo: snapshot.repo.clone(),
+        ref_name: snapshot.ref_name.clone(),
+        totals: totals.finish("total".to_string()),
+        packages: packages
+            .into_iter()
+            .map(|(name, acc)| acc.finish(name))
+            .collect(),
+        languages: languages
+            .into_iter()
+            .map(|(name, acc)| acc.finish(name))
+            .collect(),
+        fan_in: distribution(fan_in_counts),
+        fan_out: distribution(fan_out_counts),
+        most_connected,
+    }
+}
+
+#[derive(Default)]
+struct Accumulator {
+    files: usize,
+    loc: u64,
+    symbols: usize,
+    symbols_by_kind: BTreeMap<String, usize>,
+    functions: usize,
+    function_lines: u64,
+}
+
+impl Accumulator {
+    fn add_symbol(&mut self, node: &GraphNode) {
+        self.symbols += 1;
+        *self.symbols_by_kind.entry(node.kind.clone()).or_default() += 1;
+        if is_callable(node) {
+            self.functions += 1;
+            self.function_lines += u64::from(node.loc());
+        }
+    }
+
+    fn finish(self, name: String) -> GroupStats {
+        GroupStats {
+            name,
+            files: self.files,
+            loc: self.loc,
+            symbols: self.symbols,
+            symbols_by_kind: self.symbols_by_kind,
+            functions: self.functions,
+            avg_function_length: if self.functions == 0 {
+                0.0
+            } else {
+                round1(self.function_lines as f64 / self.functions as f64)
+            },
+        }
+    }
+}
+
+fn distribution(mut values: Vec<usize>) -> Distribution {
+    if values.is_empty() {
+        return Distribution::default();
+    }
+    values.sort_unstable();
+    let rank = |p: usize| values[((values.len() * p).div_ceil(100)).max(1) - 1];
+    Distribution {
+        min: values[0],
+        p50: rank(50),
+        p90: rank(90),
+        p99: rank(99),
+        max: values[values.len() - 1],
+        mean: round1(values.iter().sum::<usize>() as f64 / values.len() as f64),
+    }
+}
+
+fn round1(value: f64) -> f64 {
+    (value * 10.0).round() / 10.0
+}
+
+fn is_callable(node: &GraphNode) -> bool {
+    node.kind == "function" || node.kind == "method"
+}
+
+fn package_of(path: &str) -> String {
+    path.rsplit_once('/')
+        .map(|(dir, _)| dir.to_string())
+        .unwrap_or_else(|| ROOT_PACKAGE.to_string())
+}
+
+fn language_name(language: &str) -> String {
+    if language.is_empty() {
+        "other".to_string()
+    } else {
+        language.to_string()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::graph_export::GraphEdge;
+
+    fn node(id: &str, kind: &str, path: &str, lines: (u32, u32)) -> GraphNode {
+        GraphNode {
+            id: id.to_string(),
+            name: id.to_string(),
+            qualified_name: format!("crate::{id}"),
+            kind: kind.to_string(),
+            language: "rust".to_string(),
+            package: path
+                .rsplit_once('/')
+                .map(|(dir, _)| dir.to_string())
+                .unwrap_or_default(),
+            path: path.to_string(),
+            line_start: lines.0,
+            line_end: lines.1,
+            signature: None,
+        }
+    }
+
+    fn edge(source: &str, target: &str) -> GraphEdge {
+        GraphEdge {
+            source: source.to_string(),
+            target: target.to_string(),
+            kind: "calls".to_string(),
+            confidence: "static".to_string(),
+            file: None,
+            line: None,
+        }
+    }
+
+    fn file(path: &str, language: &str, loc: u64) -> FileLines {
+        FileLines {
+            path: path.to_string(),
+            language: language.to_string(),
+            loc,
+        }
+    }
+
+    #[test]
+    fn stats_group_by_package_and_language() {
+        let snapshot = GraphSnapshot {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            nodes: vec![
+                node("main", "function", "main.rs", (1, 4)),
+                node("serve", "function", "src/api/server.rs", (1, 20)),
+                node("route", "method", "src/api/server.rs", (22, 31)),
+                node("Config", "struct", "src/api/server.rs", (40, 45)),
+            ],
+            edges: vec![
+                edge("main", "serve"),
+                edge("serve", "route"),
+                edge("main", "route"),
+                edge("route", "route"),
+            ],
+            unresolved_edges: 0,
+        };
+        let files = vec![
+            file("main.rs", "rust", 6),
+            file("src/api/server.rs", "rust", 40),
+            file("web/app.ts", "typescript", 12),
+        ];
+        let stats = build_stats(&snapshot, &files, 2);
+
+        assert_eq!(stats.totals.files, 3);
+        assert_eq!(stats.totals.loc, 58);
+        assert_eq!(stats.totals.symbols, 4);
+        assert_eq!(stats.totals.functions, 3);
+        // (4 + 20 + 10) / 3
+        assert_eq!(stats.totals.avg_function_length, 11.3);
+        assert_eq!(stats.totals.symbols_by_kind["function"], 2);
+
+        let packages: Vec<(&str, usize, u64)> = stats
+            .packages
+            .iter()
+            .map(|p| (p.name.as_str(), p.files, p.loc))
+            .collect();
+        assert_eq!(
+            packages,
+            vec![(".", 1, 6), ("src/api", 1, 40), ("web", 1, 12)]
+        );
+        let languages: Vec<(&str, usize)> = stats
+            .languages
+            .iter()
+            .map(|l| (l.name.as_str(), l.symbols))
+            .collect();
+        assert_eq!(languages, vec![("rust", 4), ("typescript", 0)]);
+
+        // Fan-in over main, serve, route: 0, 1, 2 (self-call ignored).
+        assert_eq!(stats.fan_in.max, 2);
+        assert_eq!(stats.fan_in.p50, 1);
+        assert_eq!(stats.fan_in.mean, 1.0);
+        assert_eq!(stats.fan_out.max, 2);
+
+        assert_eq!(stats.most_connected.len(), 2);
+        assert_eq!(stats.most_connected[0].qualified_name, "crate::main");
+    }
+
+    #[test]
+    fn distribution_uses_nearest_rank() {
+        let dist = distribution((1..=10).collect());
+        assert_eq!(
+            (dist.min, dist.p50, dist.p90, dist.p99, dist.max),
+            (1, 5, 9, 10, 10)
+        );
+        assert_eq!(distribution(Vec::new()), Distribution::default());
+    }
+}
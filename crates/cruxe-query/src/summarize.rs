@@ -0,0 +1,1287 @@
+//! Package summaries, for `cruxe summarize <package>`.
+//!
+//! A package is a directory and everything indexed below it. Its summary is
+//! built from the index: the purpose from the package's own documentation
+//! (a Rust `//!` block, a Go package comment, a Python module docstring, a
+//! leading JSDoc block, else the first paragraph of its README), the
+//! exported types the rest of the package leans on most, the longest call
+//! chains starting at functions nothing in the package calls, and the
+//! imports that leave the package. With a chat-completions backend the
+//! model also writes a prose overview from those facts.
+//!
+//! Summaries are stored per package and backend with a fingerprint of the
+//! package's file hashes and README; a summary is rebuilt once any of them
+//! changes.
+
+use crate::ask::SourceCache;
+use crate::deadcode::is_exported;
+use crate::deps::package_name;
+use crate::impact::is_test_path;
+use crate::ref_sites::identifier_matches;
+use cruxe_core::config::{SemanticConfig, SummarizeConfig};
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_state::embedding::is_loopback_endpoint;
+use cruxe_state::package_summaries::{self, CachedSummary};
+use cruxe_state::provider::{
+    ChatMessage, ChatProvider, FakeChatProvider, OpenAiChatProvider, ProviderAuth,
+};
+use cruxe_state::{edges, manifest, symbols};
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, BTreeSet, HashMap, HashSet, VecDeque};
+use std::fmt::Write as _;
+use std::path::Path;
+use std::time::Duration;
+
+pub const DEFAULT_CHAT_ENDPOINT: &str = "http://127.0.0.1:8080/v1/chat/completions";
+const DEFAULT_API_KEY_ENV: &str = "CRUXE_SUMMARIZE_API_KEY";
+const DEFAULT_TIMEOUT_MS: u64 = 60_000;
+
+/// Bumped when the summary layout changes, so stored summaries are rebuilt.
+const SUMMARY_FORMAT: &str = "1";
+const FILE_SOURCE_PREFIX: &str = "file::";
+const MAX_KEY_TYPES: usize = 8;
+const MAX_FLOWS: usize = 5;
+const MAX_FLOW_STEPS: usize = 6;
+const MAX_DEPS: usize = 20;
+const MAX_PURPOSE_CHARS: usize = 600;
+
+/// Files whose leading comment documents their directory, in the order
+/// they are read.
+const PACKAGE_DOC_FILES: &[&str] = &[
+    "doc.go",
+    "lib.rs",
+    "mod.rs",
+    "__init__.py",
+    "index.ts",
+    "index.tsx",
+    "index.js",
+    "main.rs",
+    "main.go",
+];
+
+#[derive(Debug, thiserror::Error)]
+pub enum SummarizeError {
+    #[error("no indexed files under `{0}` on ref `{1}`")]
+    PackageNotFound(String, String),
+    #[error("summarization backend failed: {0}")]
+    Backend(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum PurposeSource {
+    PackageDoc,
+    Readme,
+    /// Described from the package's contents; nothing documents it.
+    Inferred,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+pub struct KeyType {
+    pub qualified_name: String,
+    pub kind: String,
+    pub path: String,
+    pub line: u32,
+    pub methods: usize,
+    /// Other symbols of the package whose signature names the type.
+    pub mentions: usize,
+    /// First sentence of its doc comment.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub doc: Option<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+pub struct CallFlow {
+    /// Qualified names from the entry point down.
+    pub steps: Vec<String>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+pub struct DependencyUse {
+    pub name: String,
+    pub imports: usize,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize, JsonSchema)]
+pub struct PackageSummary {
+    pub package: String,
+    #[serde(rename = "ref")]
+    pub ref_name: String,
+    /// `heuristic`, `openai-compatible` or `fake`.
+    pub backend: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub model: Option<String>,
+    pub fingerprint: String,
+    /// Served from the summary cache.
+    #[serde(default)]
+    pub cached: bool,
+    pub files: usize,
+    pub symbols: usize,
+    /// Most files first.
+    pub languages: Vec<String>,
+    pub purpose: String,
+    pub purpose_source: PurposeSource,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub purpose_path: Option<String>,
+    /// Prose written by the chat backend.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub overview: Option<String>,
+    pub key_types: Vec<KeyType>,
+    pub call_flows: Vec<CallFlow>,
+    /// Imports that resolve to nothing indexed, most used first.
+    pub external_deps: Vec<DependencyUse>,
+    /// Other indexed packages the package imports, most used first.
+    pub internal_deps: Vec<DependencyUse>,
+}
+
+/// Where summaries come from.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum SummaryBackend {
+    Heuristic,
+    /// An OpenAI-compatible chat completions API.
+    Chat {
+        endpoint: String,
+        model: Option<String>,
+        auth: Option<ProviderAuth>,
+        requests_per_minute: Option<u32>,
+        timeout: Duration,
+    },
+    /// Deterministic overviews written without a model, for tests.
+    Fake {
+        model: Option<String>,
+    },
+}
+
+impl SummaryBackend {
+    /// The backend `[summarize]` selects. A chat endpoint off this machine
+    /// receives code, so it needs `search.semantic.external_provider_enabled`
+    /// and `allow_code_payload_to_external`; without them the endpoint is
+    /// returned as the error.
+    pub fn from_config(
+        config: &SummarizeConfig,
+        semantic: &SemanticConfig,
+    ) -> Result<Self, String> {
+        let model = config
+            .model
+            .as_deref()
+            .map(str::trim)
+            .filter(|model| !model.is_empty())
+            .map(str::to_string);
+        match config.backend() {
+            "heuristic" => return Ok(Self::Heuristic),
+            "fake" => return Ok(Self::Fake { model }),
+            _ => {}
+        }
+        let endpoint = chat_endpoint(config.endpoint.as_deref());
+        if !is_loopback_endpoint(&endpoint)
+            && !(semantic.external_provider_enabled && semantic.allow_code_payload_to_external)
+        {
+            return Err(endpoint);
+        }
+        Ok(Self::Chat {
+            endpoint,
+            model,
+            auth: ProviderAuth::from_env(
+                config.api_key_env.as_deref(),
+                DEFAULT_API_KEY_ENV,
+                config.auth_header.as_deref(),
+            ),
+            requests_per_minute: config.requests_per_minute,
+            timeout: Duration::from_millis(config.timeout_ms.unwrap_or(DEFAULT_TIMEOUT_MS).max(1)),
+        })
+    }
+
+    fn name(&self) -> &'static str {
+        match self {
+            Self::Heuristic => "heuristic",
+            Self::Chat { .. } => "openai-compatible",
+            Self::Fake { .. } => "fake",
+        }
+    }
+
+    fn model(&self) -> Option<&str> {
+        match self {
+            Self::Heuristic => None,
+            Self::Chat { model, .. } | Self::Fake { model } => model.as_deref(),
+        }
+    }
+
+    /// The model that writes overviews; none for `heuristic`.
+    fn chat_provider(&self) -> Result<Option<Box<dyn ChatProvider>>, StateError> {
+        Ok(match self {
+            Self::Heuristic => None,
+            Self::Chat {
+                endpoint,
+                model,
+                auth,
+                requests_per_minute,
+                timeout,
+            } => Some(Box::new(OpenAiChatProvider::new(
+                endpoint.clone(),
+                model.clone(),
+                auth.clone(),
+                *requests_per_minute,
+                *timeout,
+            )?)),
+            Self::Fake { model } => Some(Box::new(FakeChatProvider::new(model.clone()))),
+        })
+    }
+
+    /// Cache key: summaries of different models are kept apart.
+    fn cache_key(&self) -> String {
+        match self.model() {
+            Some(model) => format!("{}:{model}", self.name()),
+            None => self.name().to_string(),
+        }
+    }
+}
+
+/// Summarize `package` (a directory relative to the workspace root; `.` for
+/// the whole repository), from the cache when nothing changed since the
+/// stored summary was built, unless `refresh`.
+pub fn summarize(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    package: &str,
+    backend: &SummaryBackend,
+    refresh: bool,
+) -> Result<PackageSummary, SummarizeError> {
+    let package = normalize_package(package);
+    let mut entries: Vec<manifest::ManifestEntry> =
+        manifest::get_all_entries(conn, repo, ref_name)?
+            .into_iter()
+            .filter(|entry| in_package(&entry.path, &package))
+            .collect();
+    if entries.is_empty() {
+        return Err(SummarizeError::PackageNotFound(
+            display_package(&package),
+            ref_name.to_string(),
+        ));
+    }
+    entries.sort_by(|a, b| a.path.cmp(&b.path));
+    let readme = read_readme(workspace, &package);
+    let fingerprint = fingerprint(&entries, readme.as_ref(), backend);
+
+    let cache_key = backend.cache_key();
+    if !refresh
+        && let Some(stored) =
+            package_summaries::get(conn, repo, ref_name, &display_package(&package), &cache_key)?
+        && stored.fingerprint == fingerprint
+        && let Ok(mut summary) = serde_json::from_str::<PackageSummary>(&stored.summary)
+    {
+        summary.cached = true;
+        return Ok(summary);
+    }
+
+    let mut summary = build_summary(conn, workspace, repo, ref_name, &package, &entries, readme)?;
+    summary.backend = backend.name().to_string();
+    summary.model = backend.model().map(str::to_string);
+    summary.fingerprint = fingerprint.clone();
+    if let Some(mut provider) = backend.chat_provider()? {
+        summary.overview = Some(request_overview(provider.as_mut(), &summary)?);
+    }
+
+    let stored = CachedSummary {
+        fingerprint,
+        summary: serde_json::to_string(&summary).map_err(StateError::external)?,
+    };
+    package_summaries::put(conn, repo, ref_name, &summary.package, &cache_key, &stored)?;
+    Ok(summary)
+}
+
+fn build_summary(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    package: &str,
+    entries: &[manifest::ManifestEntry],
+    readme: Option<(String, String)>,
+) -> Result<PackageSummary, SummarizeError> {
+    let prefix = if package.is_empty() {
+        String::new()
+    } else {
+        format!("{package}/")
+    };
+    let records: Vec<SymbolRecord> =
+        symbols::list_symbols_by_path_prefix(conn, repo, ref_name, &prefix)?
+            .into_iter()
+            .filter(|record| in_package(&record.path, package))
+            .collect();
+
+    let mut language_files: BTreeMap<String, usize> = BTreeMap::new();
+    for entry in entries {
+        if let Some(language) = &entry.language {
+            *language_files.entry(language.clone()).or_default() += 1;
+        }
+    }
+    let mut languages: Vec<(String, usize)> = language_files.into_iter().collect();
+    languages.sort_by(|a, b| b.1.cmp(&a.1).then_with(|| a.0.cmp(&b.0)));
+
+    let mut sources = SourceCache::new(workspace);
+    let key_types = key_types(&records, &mut sources);
+
+    let mut by_id: HashMap<&str, usize> = HashMap::new();
+    for (idx, record) in records.iter().enumerate() {
+        by_id.insert(record.symbol_stable_id.as_str(), idx);
+        by_id.entry(record.symbol_id.as_str()).or_insert(idx);
+    }
+    let mut callees: Vec<BTreeSet<usize>> = vec![BTreeSet::new(); records.len()];
+    let mut imports: Vec<(Option<String>, Option<String>)> = Vec::new();
+    edges::for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        if edge.edge_type == "imports" {
+            if let Some(path) = edge.from_symbol_id.strip_prefix(FILE_SOURCE_PREFIX)
+                && in_package(path, package)
+            {
+                imports.push((edge.to_symbol_id, edge.to_name));
+            }
+        } else if edge.edge_type == "calls"
+            && let Some(&from) = by_id.get(edge.from_symbol_id.as_str())
+            && let Some(&to) = edge.to_symbol_id.as_deref().and_then(|id| by_id.get(id))
+            && from != to
+        {
+            callees[from].insert(to);
+        }
+        Ok(())
+    })?;
+    let call_flows = call_flows(&records, &callees);
+    let (external_deps, internal_deps) = dependencies(conn, repo, ref_name, package, imports)?;
+
+    let (purpose, purpose_source, purpose_path) = match package_doc(entries, package, &mut sources)
+    {
+        Some((path, doc)) => (doc, PurposeSource::PackageDoc, Some(path)),
+        None => match readme.and_then(|(path, text)| readme_paragraph(&text).map(|p| (path, p))) {
+            Some((path, paragraph)) => (paragraph, PurposeSource::Readme, Some(path)),
+            None => (
+                inferred_purpose(entries.len(), languages.first(), &records, &key_types),
+                PurposeSource::Inferred,
+                None,
+            ),
+        },
+    };
+
+    Ok(PackageSummary {
+        package: display_package(package),
+        ref_name: ref_name.to_string(),
+        backend: String::new(),
+        model: None,
+        fingerprint: String::new(),
+        cached: false,
+        files: entries.len(),
+        symbols: records.len(),
+        languages: languages
+            .into_iter()
+            .map(|(language, _)| language)
+            .collect(),
+        purpose,
+        purpose_source,
+        purpose_path,
+        overview: None,
+        key_types,
+        call_flows,
+        external_deps,
+        internal_deps,
+    })
+}
+
+/// Types outside tests, exported ones first, then by how much of the
+/// package refers to them: methods plus other signatures naming them.
+fn key_types(records: &[SymbolRecord], sources: &mut SourceCache) -> Vec<KeyType> {
+    let mut ranked = Vec::new();
+    for record in records {
+        if !is_type(record.kind) || is_test_path(&record.path) {
+            continue;
+        }
+        let is_member = |other: &SymbolRecord| {
+            other.parent_symbol_id.as_deref().is_some_and(|parent| {
+                parent == record.symbol_id || parent == record.symbol_stable_id
+            })
+        };
+        let methods = records
+            .iter()
+            .filter(|other| is_member(other) && is_callable(other.kind))
+            .count();
+        let mentions = records
+            .iter()
+            .filter(|other| other.symbol_stable_id != record.symbol_stable_id && !is_member(other))
+            .filter(|other| {
+                other.signature.as_deref().is_some_and(|signature| {
+                    !identifier_matches(signature, &record.name).is_empty()
+                })
+            })
+            .count();
+        ranked.push((
+            is_exported(record),
+            methods + mentions,
+            record,
+            methods,
+            mentions,
+        ));
+    }
+    ranked.sort_by(|a, b| {
+        b.0.cmp(&a.0)
+            .then_with(|| b.1.cmp(&a.1))
+            .then_with(|| a.2.path.cmp(&b.2.path))
+            .then_with(|| a.2.line_start.cmp(&b.2.line_start))
+    });
+    ranked
+        .into_iter()
+        .take(MAX_KEY_TYPES)
+        .map(|(_, _, record, methods, mentions)| KeyType {
+            qualified_name: record.qualified_name.clone(),
+            kind: record.kind.as_str().to_string(),
+            path: record.path.clone(),
+            line: record.line_start,
+            methods,
+            mentions,
+            doc: sources.doc(record).and_then(|doc| first_sentence(&doc)),
+        })
+        .collect()
+}
+
+/// The longest call chains inside the package. Chains start at callables
+/// outside tests that nothing in the package calls (exported ones first),
+/// and each step follows the callee that reaches the most.
+fn call_flows(records: &[SymbolRecord], callees: &[BTreeSet<usize>]) -> Vec<CallFlow> {
+    let in_scope = |idx: usize| is_callable(records[idx].kind) && !is_test_path(&records[idx].path);
+    let called: HashSet<usize> = callees.iter().flatten().copied().collect();
+    let reach: Vec<usize> = (0..records.len())
+        .map(|idx| reachable_count(idx, callees))
+        .collect();
+
+    let mut starts: Vec<usize> = (0..records.len())
+        .filter(|&idx| in_scope(idx) && !callees[idx].is_empty() && !called.contains(&idx))
+        .collect();
+    if starts.is_empty() {
+        // Every caller is called back (a cycle): start from exported ones.
+        starts = (0..records.len())
+            .filter(|&idx| in_scope(idx) && !callees[idx].is_empty() && is_exported(&records[idx]))
+            .collect();
+    }
+    starts.sort_by(|&a, &b| {
+        is_exported(&records[b])
+            .cmp(&is_exported(&records[a]))
+            .then_with(|| reach[b].cmp(&reach[a]))
+            .then_with(|| a.cmp(&b))
+    });
+
+    let mut flows = Vec::new();
+    for start in starts.into_iter().take(MAX_FLOWS) {
+        let mut steps = vec![start];
+        while steps.len() < MAX_FLOW_STEPS {
+            let current = steps[steps.len() - 1];
+            let next = callees[current]
+                .iter()
+                .copied()
+                .filter(|callee| !steps.contains(callee))
+                .max_by(|&a, &b| reach[a].cmp(&reach[b]).then_with(|| b.cmp(&a)));
+            let Some(next) = next else {
+                break;
+            };
+            steps.push(next);
+        }
+        flows.push(CallFlow {
+            steps: steps
+                .into_iter()
+                .map(|idx| records[idx].qualified_name.clone())
+                .collect(),
+        });
+    }
+    flows
+}
+
+fn reachable_count(start: usize, callees: &[BTreeSet<usize>]) -> usize {
+    let mut seen = HashSet::from([start]);
+    let mut queue = VecDeque::from([start]);
+    while let Some(idx) = queue.pop_front() {
+        for &callee in &callees[idx] {
+            if seen.insert(callee) {
+                queue.push_back(callee);
+            }
+        }
+    }
+    seen.len() - 1
+}
+
+/// Imports made by the package's files: (external, internal) by use.
+fn dependencies(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    package: &str,
+    imports: Vec<(Option<String>, Option<String>)>,
+) -> Result<(Vec<DependencyUse>, Vec<DependencyUse>), StateError> {
+    let mut target_paths: HashMap<String, Option<String>> = HashMap::new();
+    let mut external: BTreeMap<String, usize> = BTreeMap::new();
+    let mut internal: BTreeMap<String, usize> = BTreeMap::new();
+    for (to_symbol_id, to_name) in imports {
+        let resolved = match to_symbol_id {
+            Some(id) => {
+                if !target_paths.contains_key(&id) {
+                    let path = symbols::get_symbol_by_stable_id(conn, repo, ref_name, &id)?
+                        .map(|symbol| symbol.path);
+                    target_paths.insert(id.clone(), path);
+                }
+                target_paths[&id].clone()
+            }
+            None => None,
+        };
+        match resolved {
+            Some(path) if in_package(&path, package) => {}
+            Some(path) => *internal.entry(package_name(&path, 0)).or_default() += 1,
+            None => {
+                let name = to_name.as_deref().unwrap_or_default().trim();
+                if !name.is_empty() {
+                    *external.entry(name.to_string()).or_default() += 1;
+                }
+            }
+        }
+    }
+    Ok((by_use(external), by_use(internal)))
+}
+
+fn by_use(counts: BTreeMap<String, usize>) -> Vec<DependencyUse> {
+    let mut uses: Vec<DependencyUse> = counts
+        .into_iter()
+        .map(|(name, imports)| DependencyUse { name, imports })
+        .collect();
+    uses.sort_by(|a, b| b.imports.cmp(&a.imports).then_with(|| a.name.cmp(&b.name)));
+    uses.truncate(MAX_DEPS);
+    uses
+}
+
+/// The first documented file among the package's entry files (`doc.go`,
+/// `lib.rs`, `__init__.py`, ...), the Rust module file next to the
+/// directory, then the other files directly in it.
+fn package_doc(
+    entries: &[manifest::ManifestEntry],
+    package: &str,
+    sources: &mut SourceCache,
+) -> Option<(String, String)> {
+    let dir_of = |path: &str| path.rsplit_once('/').map_or("", |(dir, _)| dir).to_string();
+    let src_dir = if package.is_empty() {
+        "src".to_string()
+    } else {
+        format!("{package}/src")
+    };
+    let mut named: Vec<(usize, (String, String))> = Vec::new();
+    let mut plain: Vec<(String, String)> = Vec::new();
+    for entry in entries {
+        let dir = dir_of(&entry.path);
+        let file = entry.path.rsplit('/').next().unwrap_or(&entry.path);
+        let candidate = (
+            entry.path.clone(),
+            entry.language.clone().unwrap_or_default(),
+        );
+        match PACKAGE_DOC_FILES.iter().position(|name| *name == file) {
+            Some(rank) if dir == package || dir == src_dir => named.push((rank, candidate)),
+            None if dir == package && !is_test_path(&entry.path) => plain.push(candidate),
+            _ => {}
+        }
+    }
+    named.sort();
+    let mut paths: Vec<(String, String)> = named.into_iter().map(|(_, path)| path).collect();
+    if !package.is_empty() {
+        // The Rust module file `foo.rs` of `foo/`.
+        paths.push((format!("{package}.rs"), "rust".to_string()));
+    }
+    paths.extend(plain);
+
+    for (path, language) in paths {
+        if let Some(lines) = sources.lines(&path)
+            && let Some(doc) = file_doc(lines, &language).and_then(|doc| first_paragraph(&doc))
+        {
+            return Some((path, doc));
+        }
+    }
+    None
+}
+
+/// The comment that documents a whole file: leading `//!` lines in Rust,
+/// the comment above the `package` clause in Go, the module docstring in
+/// Python, a leading `/** */` block in TypeScript and JavaScript.
+fn file_doc<S: AsRef<str>>(lines: &[S], language: &str) -> Option<String> {
+    let lines: Vec<&str> = lines.iter().map(|line| line.as_ref().trim()).collect();
+    let mut doc = Vec::new();
+    match language {
+        "rust" => {
+            for line in lines.iter().skip_while(|line| line.is_empty()) {
+                let Some(text) = line.strip_prefix("//!") else {
+                    break;
+                };
+                doc.push(text.strip_prefix(' ').unwrap_or(text));
+            }
+        }
+        "go" => {
+            let clause = lines.iter().position(|line| line.starts_with("package "))?;
+            for line in lines[..clause].iter().rev() {
+                let Some(text) = line.strip_prefix("//") else {
+                    break;
+                };
+                doc.push(text.strip_prefix(' ').unwrap_or(text));
+            }
+            doc.reverse();
+        }
+        "python" => {
+            let first = lines
+                .iter()
+                .position(|line| !line.is_empty() && !line.starts_with('#'))?;
+            let quote = ["\"\"\"", "'''"]
+                .into_iter()
+                .find(|quote| lines[first].starts_with(quote))?;
+            let opening = &lines[first][quote.len()..];
+            if let Some((text, _)) = opening.split_once(quote) {
+                doc.push(text);
+            } else {
+                doc.push(opening);
+                for line in &lines[first + 1..] {
+                    if let Some((text, _)) = line.split_once(quote) {
+                        doc.push(text);
+                        break;
+                    }
+                    doc.push(line);
+                }
+            }
+        }
+        "typescript" | "javascript" => {
+            let first = lines.iter().position(|line| !line.is_empty())?;
+            let opening = lines[first].strip_prefix("/**")?;
+            for line in std::iter::once(opening).chain(lines[first + 1..].iter().copied()) {
+                if let Some((text, _)) = line.split_once("*/") {
+                    doc.push(text.trim_start_matches('*').trim());
+                    break;
+                }
+                doc.push(line.trim_start_matches('*').trim());
+            }
+        }
+        _ => return None,
+    }
+    let text = doc.join("\n");
+    let text = text.trim();
+    (!text.is_empty()).then(|| text.to_string())
+}
+
+fn read_readme(workspace: &Path, package: &str) -> Option<(String, String)> {
+    ["README.md", "README", "readme.md", "README.rst"]
+        .into_iter()
+        .find_map(|name| {
+            let path = if package.is_empty() {
+                name.to_string()
+            } else {
+                format!("{package}/{name}")
+            };
+            std::fs::read_to_string(workspace.join(&path))
+                .ok()
+                .map(|text| (path, text))
+        })
+}
+
+/// The first paragraph of prose in a README, past headings, badges, HTML
+/// and code blocks.
+fn readme_paragraph(text: &str) -> Option<String> {
+    let mut in_code = false;
+    let mut paragraph: Vec<&str> = Vec::new();
+    for line in text.lines() {
+        let line = line.trim();
+        if line.starts_with("```") {
+            in_code = !in_code;
+            continue;
+        }
+        let prose = !in_code
+            && !line.is_empty()
+            && !line.starts_with(['#', '<', '!', '[', '|', '='])
+            && !line.starts_with("---");
+        if prose {
+            paragraph.push(line);
+        } else if !paragraph.is_empty() {
+            break;
+        }
+    }
+    first_paragraph(&paragraph.join("\n"))
+}
+
+/// The first paragraph on one line, cut after a sentence when long.
+fn first_paragraph(text: &str) -> Option<String> {
+    let paragraph = text
+        .trim()
+        .split("\n\n")
+        .next()?
+        .lines()
+        .map(str::trim)
+        .collect::<Vec<_>>()
+        .join(" ");
+    if paragraph.is_empty() {
+        return None;
+    }
+    if paragraph.chars().count() <= MAX_PURPOSE_CHARS {
+        return Some(paragraph);
+    }
+    let cut: String = paragraph.chars().take(MAX_PURPOSE_CHARS).collect();
+    Some(match cut.rfind(". ") {
+        Some(end) => cut[..=end].to_string(),
+        None => format!("{}...", cut.trim_end()),
+    })
+}
+
+fn first_sentence(doc: &str) -> Option<String> {
+    let paragraph = first_paragraph(doc)?;
+    Some(match paragraph.find(". ") {
+        Some(end) => paragraph[..=end].to_string(),
+        None => paragraph,
+    })
+}
+
+fn inferred_purpose(
+    files: usize,
+    language: Option<&(String, usize)>,
+    records: &[SymbolRecord],
+    key_types: &[KeyType],
+) -> String {
+    let types = records.iter().filter(|record| is_type(record.kind)).count();
+    let functions = records
+        .iter()
+        .filter(|record| is_callable(record.kind))
+        .count();
+    let mut purpose = format!(
+        "{files} {}file(s) with {types} type(s) and {functions} function(s)",
+        language.map_or(String::new(), |(language, _)| format!("{language} "))
+    );
+    let names: Vec<String> = key_types
+        .iter()
+        .take(3)
+        .map(|key| format!("`{}`", key.qualified_name))
+        .collect();
+    if !names.is_empty() {
+        let _ = write!(purpose, ", built around {}", names.join(", "));
+    }
+    purpose.push('.');
+    purpose
+}
+
+/// Ask the chat backend for a prose overview of the facts in `summary`.
+fn request_overview(
+    provider: &mut dyn ChatProvider,
+    summary: &PackageSummary,
+) -> Result<String, SummarizeError> {
+    let messages = [
+        ChatMessage::system(
+            "You summarize software packages for engineers new to a codebase. \
+             Answer in 3 to 5 sentences of plain prose: what the package is for, \
+             its main types and how a call flows through it. No lists or headings.",
+        ),
+        ChatMessage::user(format!(
+            "Summarize the package `{}` from these facts extracted from its code:\n\n{}",
+            summary.package,
+            render_text(summary)
+        )),
+    ];
+    provider
+        .complete(&messages, 0.2)
+        .map_err(|error| match error {
+            StateError::External(message) => SummarizeError::Backend(message),
+            other => SummarizeError::State(other),
+        })
+}
+
+/// Chat completions URL from a configured endpoint, which may be the API's
+/// base URL.
+fn chat_endpoint(configured: Option<&str>) -> String {
+    match configured
+        .map(|value| value.trim().trim_end_matches('/'))
+        .filter(|value| !value.is_empty())
+    {
+        Some(endpoint) if endpoint.ends_with("/chat/completions") => endpoint.to_string(),
+        Some(endpoint) => format!("{endpoint}/chat/completions"),
+        None => DEFAULT_CHAT_ENDPOINT.to_string(),
+    }
+}
+
+fn fingerprint(
+    entries: &[manifest::ManifestEntry],
+    readme: Option<&(String, String)>,
+    backend: &SummaryBackend,
+) -> String {
+    let mut hasher = blake3::Hasher::new();
+    hasher.update(SUMMARY_FORMAT.as_bytes());
+    hasher.update(backend.cache_key().as_bytes());
+    for entry in entries {
+        hasher.update(format!("\n{}\0{}", entry.path, entry.content_hash).as_bytes());
+    }
+    if let Some((path, text)) = readme {
+        hasher.update(format!("\n{path}\0").as_bytes());
+        hasher.update(text.as_bytes());
+    }
+    let hex = hasher.finalize().to_hex();
+    hex[..16].to_string()
+}
+
+/// `./src/auth/` -> `src/auth`; the repository root is the empty string.
+fn normalize_package(package: &str) -> String {
+    let package = package
+        .trim()
+        .trim_start_matches("./")
+        .trim_end_matches('/');
+    if package == "." {
+        String::new()
+    } else {
+        package.replace('\\', "/")
+    }
+}
+
+fn display_package(package: &str) -> String {
+    if package.is_empty() {
+        ".".to_string()
+    } else {
+        package.to_string()
+    }
+}
+
+fn in_package(path: &str, package: &str) -> bool {
+    package.is_empty()
+        || path
+            .strip_prefix(package)
+            .is_some_and(|rest| rest.starts_with('/'))
+}
+
+fn is_type(kind: SymbolKind) -> bool {
+    matches!(
+        kind,
+        SymbolKind::Struct
+            | SymbolKind::Class
+            | SymbolKind::Enum
+            | SymbolKind::Trait
+            | SymbolKind::Interface
+            | SymbolKind::TypeAlias
+    )
+}
+
+fn is_callable(kind: SymbolKind) -> bool {
+    matches!(kind, SymbolKind::Function | SymbolKind::Method)
+}
+
+pub fn render_text(summary: &PackageSummary) -> String {
+    let mut out = String::new();
+    let _ = writeln!(
+        out,
+        "{} ({} file(s), {} symbol(s){})",
+        summary.package,
+        summary.files,
+        summary.symbols,
+        if summary.languages.is_empty() {
+            String::new()
+        } else {
+            format!("; {}", summary.languages.join(", "))
+        }
+    );
+    let _ = writeln!(out);
+    let _ = writeln!(out, "Purpose: {}", summary.purpose);
+    if let Some(overview) = &summary.overview {
+        let _ = writeln!(out);
+        let _ = writeln!(out, "{overview}");
+    }
+    if !summary.key_types.is_empty() {
+        let _ = writeln!(out);
+        let _ = writeln!(out, "Key types:");
+        for key in &summary.key_types {
+            let _ = write!(
+                out,
+                "  {} ({}) {}:{}",
+                key.qualified_name, key.kind, key.path, key.line
+            );
+            if let Some(doc) = &key.doc {
+                let _ = write!(out, " - {doc}");
+            }
+            let _ = writeln!(out);
+        }
+    }
+    if !summary.call_flows.is_empty() {
+        let _ = writeln!(out);
+        let _ = writeln!(out, "Main call flows:");
+        for flow in &summary.call_flows {
+            let _ = writeln!(out, "  {}", flow.steps.join(" -> "));
+        }
+    }
+    for (title, deps) in [
+        ("External dependencies", &summary.external_deps),
+        ("Depends on packages", &summary.internal_deps),
+    ] {
+        if deps.is_empty() {
+            continue;
+        }
+        let _ = writeln!(out);
+        let _ = writeln!(out, "{title}:");
+        for dep in deps {
+            let _ = writeln!(out, "  {} ({} import(s))", dep.name, dep.imports);
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::manifest::ManifestEntry;
+    use cruxe_state::{db, schema};
+
+    const DOC: &str = "// Package auth validates bearer tokens and checks roles.
+//
+// Tokens are JWTs signed with a shared secret.
+package auth
+";
+
+    const TOKEN: &str = "package auth
+
+import \"github.com/golang-jwt/jwt\"
+
+// Claims holds the decoded token claims. Exp is a Unix time.
+type Claims struct {
+	Exp int64
+}
+
+// Validator checks tokens against a secret.
+type Validator struct {
+	secret []byte
+}
+
+func (v *Validator) Validate(token string) (*Claims, error) {
+	return parse(token, v.secret)
+}
+
+func parse(token string, secret []byte) (*Claims, error) {
+	return decode(token)
+}
+
+func decode(token string) (*Claims, error) {
+	return &Claims{}, nil
+}
+
+func (c *Claims) Expired() bool {
+	return false
+}
+";
+
+    fn record(
+        path: &str,
+        qualified_name: &str,
+        kind: SymbolKind,
+        lines: (u32, u32),
+        parent: Option<&str>,
+    ) -> SymbolRecord {
+        let source = if path == "auth/token.go" { TOKEN } else { "" };
+        let name = qualified_name.rsplit('.').next().unwrap();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{qualified_name}"),
+            symbol_stable_id: format!("stable::{qualified_name}"),
+            name: name.to_string(),
+            qualified_name: qualified_name.to_string(),
+            kind,
+            signature: source
+                .lines()
+                .nth(lines.0 as usize - 1)
+                .map(|line| line.trim_end_matches(" {").to_string()),
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: parent.map(|parent| format!("stable::{parent}")),
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn edge(
+        from: &str,
+        to_symbol: Option<&str>,
+        to_name: Option<&str>,
+        edge_type: &str,
+    ) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: to_symbol.map(|id| format!("stable::{id}")),
+            to_name: to_name.map(str::to_string),
+            edge_type: edge_type.to_string(),
+            confidence: "static".to_string(),
+            source_file: "auth/token.go".to_string(),
+            source_line: 1,
+        }
+    }
+
+    fn manifest_entry(path: &str, hash: &str) -> ManifestEntry {
+        ManifestEntry {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            content_hash: hash.to_string(),
+            size_bytes: 1,
+            mtime_ns: None,
+            language: Some("go".to_string()),
+            indexed_at: "2026-01-01T00:00:00Z".to_string(),
+        }
+    }
+
+    #[test]
+    fn summary_covers_docs_types_flows_and_deps_and_is_cached() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(dir.path().join("auth")).unwrap();
+        std::fs::write(dir.path().join("auth/doc.go"), DOC).unwrap();
+        std::fs::write(dir.path().join("auth/token.go"), TOKEN).unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for path in ["auth/doc.go", "auth/token.go", "store/db.go"] {
+            manifest::upsert_manifest(&conn, &manifest_entry(path, "v1")).unwrap();
+        }
+        for symbol in [
+            record("auth/token.go", "Claims", SymbolKind::Struct, (6, 8), None),
+            record(
+                "auth/token.go",
+                "Validator",
+                SymbolKind::Struct,
+                (11, 13),
+                None,
+            ),
+            record(
+                "auth/token.go",
+                "Validator.Validate",
+                SymbolKind::Method,
+                (15, 17),
+                Some("Validator"),
+            ),
+            record(
+                "auth/token.go",
+                "parse",
+                SymbolKind::Function,
+                (19, 21),
+                None,
+            ),
+            record(
+                "auth/token.go",
+                "decode",
+                SymbolKind::Function,
+                (23, 25),
+                None,
+            ),
+            record(
+                "auth/token.go",
+                "Claims.Expired",
+                SymbolKind::Method,
+                (27, 29),
+                Some("Claims"),
+            ),
+            record("store/db.go", "DB", SymbolKind::Struct, (1, 1), None),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                edge("stable::Validator.Validate", Some("parse"), None, "calls"),
+                edge("stable::parse", Some("decode"), None, "calls"),
+                edge(
+                    "file::auth/token.go",
+                    None,
+                    Some("github.com/golang-jwt/jwt"),
+                    "imports",
+                ),
+                edge("file::auth/token.go", Some("DB"), Some("store"), "imports"),
+            ],
+        )
+        .unwrap();
+
+        let summary = summarize(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "./auth/",
+            &SummaryBackend::Heuristic,
+            false,
+        )
+        .unwrap();
+        assert_eq!(summary.package, "auth");
+        assert_eq!(summary.files, 2);
+        assert_eq!(summary.symbols, 6);
+        assert_eq!(summary.purpose_source, PurposeSource::PackageDoc);
+        assert_eq!(summary.purpose_path.as_deref(), Some("auth/doc.go"));
+        assert_eq!(
+            summary.purpose,
+            "Package auth validates bearer tokens and checks roles."
+        );
+        let types: Vec<(&str, usize, usize)> = summary
+            .key_types
+            .iter()
+            .map(|key| (key.qualified_name.as_str(), key.methods, key.mentions))
+            .collect();
+        assert_eq!(types, vec![("Claims", 1, 3), ("Validator", 1, 0)]);
+        assert_eq!(
+            summary.key_types[0].doc.as_deref(),
+            Some("Claims holds the decoded token claims.")
+        );
+        assert_eq!(
+            summary.call_flows,
+            vec![CallFlow {
+                steps: vec![
+                    "Validator.Validate".to_string(),
+                    "parse".to_string(),
+                    "decode".to_string()
+                ]
+            }]
+        );
+        assert_eq!(summary.external_deps[0].name, "github.com/golang-jwt/jwt");
+        assert_eq!(summary.internal_deps[0].name, "store");
+        assert!(!summary.cached);
+        assert!(render_text(&summary).contains("Validator.Validate -> parse -> decode"));
+
+        let again = summarize(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "auth",
+            &SummaryBackend::Heuristic,
+            false,
+        )
+        .unwrap();
+        assert!(again.cached);
+        assert_eq!(again.fingerprint, summary.fingerprint);
+
+        // A change in the package invalidates the stored summary; one
+        // elsewhere does not.
+        manifest::upsert_manifest(&conn, &manifest_entry("store/db.go", "v2")).unwrap();
+        let unrelated = summarize(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "auth",
+            &SummaryBackend::Heuristic,
+            false,
+        )
+        .unwrap();
+        assert!(unrelated.cached);
+        manifest::upsert_manifest(&conn, &manifest_entry("auth/token.go", "v2")).unwrap();
+        let changed = summarize(
+            &conn,
+            dir.path(),
+            "repo",
+            "main",
+            "auth",
+            &SummaryBackend::Heuristic,
+            false,
+        )
+        .unwrap();
+        assert!(!changed.cached);
+        assert_ne!(changed.fingerprint, summary.fingerprint);
+
+        // The fake chat backend writes a stable overview, cached apart from
+        // the heuristic summary.
+        let fake = SummaryBackend::Fake {
+            model: Some("test".to_string()),
+        };
+        let written = summarize(&conn, dir.path(), "repo", "main", "auth", &fake, false).unwrap();
+        assert_eq!(written.backend, "fake");
+        assert!(!written.cached);
+        assert!(
+            written
+                .overview
+                .as_deref()
+                .is_some_and(|overview| overview.starts_with("Fake reply"))
+        );
+        let reread = summarize(&conn, dir.path(), "repo", "main", "auth", &fake, false).unwrap();
+        assert!(reread.cached);
+        assert_eq!(reread.overview, written.overview);
+
+        assert!(matches!(
+            summarize(
+                &conn,
+                dir.path(),
+                "repo",
+                "main",
+                "billing",
+                &SummaryBackend::Heuristic,
+                false,
+            ),
+            Err(SummarizeError::PackageNotFound(..))
+        ));
+    }
+
+    #[test]
+    fn file_docs_and_endpoints_are_read_per_convention() {
+        assert_eq!(
+            file_doc(
+                &["//! Token parsing.", "//!", "//! More.", "", "use x;"],
+                "rust"
+            )
+            .as_deref(),
+            Some("Token parsing.\n\nMore.")
+        );
+        assert_eq!(
+            file_doc(
+                &["\"\"\"Billing helpers.", "", "Details.\"\"\"", "import os"],
+                "python"
+            )
+            .as_deref(),
+            Some("Billing helpers.\n\nDetails.")
+        );
+        assert_eq!(
+            file_doc(
+                &["/**", " * Routes of the API.", " */", "export {}"],
+                "typescript"
+            )
+            .as_deref(),
+            Some("Routes of the API.")
+        );
+        assert!(file_doc(&["//go:build linux", "", "package auth"], "go").is_none());
+        assert_eq!(
+            readme_paragraph("# Auth\n\n[![ci](badge)](ci)\n\nIssues and checks\ntokens.\n\nMore.")
+                .as_deref(),
+            Some("Issues and checks tokens.")
+        );
+
+        assert_eq!(chat_endpoint(None), DEFAULT_CHAT_ENDPOINT);
+        assert_eq!(
+            chat_endpoint(Some("http://127.0.0.1:8080/v1/")),
+            "http://127.0.0.1:8080/v1/chat/completions"
+        );
+        assert_eq!(
+            chat_endpoint(Some("https://api.openai.com/v1/chat/completions")),
+            "https://api.openai.com/v1/chat/completions"
+        );
+
+        let mut config = SummarizeConfig {
+            backend: Some("openai-compatible".to_string()),
+            endpoint: Some("https://api.example.com/v1".to_string()),
+            ..SummarizeConfig::default()
+        };
+        let semantic = SemanticConfig::default();
+        assert_eq!(
+            SummaryBackend::from_config(&config, &semantic),
+            Err("https://api.example.com/v1/chat/completions".to_string())
+        );
+        config.endpoint = None;
+        assert!(matches!(
+            SummaryBackend::from_config(&config, &semantic),
+            Ok(SummaryBackend::Chat { .. })
+        ));
+        config.backend = Some("fake".to_string());
+        config.endpoint = Some("https://api.example.com/v1".to_string());
+        assert_eq!(
+            SummaryBackend::from_config(&config, &semantic),
+            Ok(SummaryBackend::Fake { model: None })
+        );
+    }
+}
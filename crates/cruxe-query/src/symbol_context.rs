@@ -0,0 +1,889 @@
+//! Prompt-ready context for one symbol, for `cruxe context`: its
+//! definition, the types it mentions, what it calls, where it is called
+//! from and the configuration keys it reads, fitted to a token budget.
+//!
+//! Pieces are taken in order of relevance. A piece that does not fit in
+//! full is shortened (a callee or type to its signature, a caller to the
+//! calling line, a config file to the matching lines) and left out when
+//! even that does not fit. The definition always comes first, cut short
+//! when it alone exceeds the budget.
+
+use crate::describe::{DescribeError, resolve_symbol};
+use cruxe_core::error::StateError;
+use cruxe_core::tokens::estimate_tokens;
+use cruxe_core::types::{SymbolKind, SymbolRecord};
+use cruxe_indexer::scanner;
+use cruxe_state::{edges, symbols};
+use regex::Regex;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+use std::sync::LazyLock;
+
+pub const DEFAULT_BUDGET_TOKENS: usize = 8000;
+
+/// Identifiers of the definition looked up as type names.
+const MAX_TYPE_LOOKUPS: usize = 200;
+/// Lines of context around a call site or a config key.
+const WINDOW_LINES: usize = 2;
+/// Config files larger than this are not searched for keys.
+const MAX_CONFIG_FILE_BYTES: u64 = 256 * 1024;
+
+static IDENTIFIER: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"[A-Za-z_][A-Za-z0-9_]*").expect("identifier regex"));
+
+static CONFIG_KEY: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r#"["'`]([A-Za-z_][A-Za-z0-9_.\-]{2,63})["'`]"#).expect("config key regex")
+});
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum PieceRole {
+    Definition,
+    Type,
+    Callee,
+    Caller,
+    Config,
+}
+
+impl PieceRole {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Definition => "definition",
+            Self::Type => "type",
+            Self::Callee => "callee",
+            Self::Caller => "caller",
+            Self::Config => "config",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct ContextPiece {
+    pub role: PieceRole,
+    /// Qualified name of the symbol, or the path of a config file.
+    pub name: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub language: String,
+    pub relevance: f64,
+    pub tokens: usize,
+    /// Set when only a shortened excerpt fit in the budget.
+    pub trimmed: bool,
+    pub content: String,
+}
+
+/// A piece that did not fit, even shortened.
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct OmittedPiece {
+    pub role: PieceRole,
+    pub name: String,
+    pub path: String,
+    /// Tokens of its shortest form.
+    pub tokens: usize,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SymbolContext {
+    pub symbol: String,
+    #[serde(rename = "ref")]
+    pub ref_name: String,
+    pub budget_tokens: usize,
+    pub used_tokens: usize,
+    /// Included pieces, the definition first, then types, callees, callers
+    /// and config, each by relevance.
+    pub pieces: Vec<ContextPiece>,
+    pub omitted: Vec<OmittedPiece>,
+}
+
+/// A piece before budgeting: its full form and, when one exists, a shorter
+/// form to fall back on.
+struct Candidate {
+    role: PieceRole,
+    name: String,
+    path: String,
+    language: String,
+    relevance: f64,
+    full: Excerpt,
+    brief: Option<Excerpt>,
+}
+
+#[derive(Clone)]
+struct Excerpt {
+    line_start: u32,
+    line_end: u32,
+    content: String,
+}
+
+/// Assemble the context of `symbol` (a bare or qualified name, optionally
+/// restricted to one file) in `ref_name` within `budget_tokens`.
+pub fn build_symbol_context(
+    conn: &Connection,
+    workspace: &Path,
+    project_id: &str,
+    ref_name: &str,
+    symbol: &str,
+    path: Option<&str>,
+    budget_tokens: usize,
+) -> Result<SymbolContext, DescribeError> {
+    let sym = resolve_symbol(conn, project_id, ref_name, symbol, path)?;
+    let mut sources = SourceCache::new(workspace);
+
+    let definition = match sources.lines(&sym.path) {
+        Some(lines) => {
+            let start = leading_comment_start(lines, sym.line_start);
+            excerpt(lines, start, sym.line_end)
+        }
+        None => Excerpt {
+            line_start: sym.line_start,
+            line_end: sym.line_end,
+            content: sym.signature.clone().unwrap_or_default(),
+        },
+    };
+
+    let mut candidates = Vec::new();
+    candidates.extend(type_candidates(
+        conn,
+        project_id,
+        ref_name,
+        &sym,
+        &definition.content,
+        &mut sources,
+    )?);
+    candidates.extend(callee_candidates(
+        conn,
+        project_id,
+        ref_name,
+        &sym,
+        &mut sources,
+    )?);
+    candidates.extend(caller_candidates(
+        conn,
+        project_id,
+        ref_name,
+        &sym,
+        &mut sources,
+    )?);
+    candidates.extend(config_candidates(workspace, &definition.content));
+    candidates.sort_by(|a, b| {
+        b.relevance
+            .total_cmp(&a.relevance)
+            .then_with(|| a.role.cmp(&b.role))
+    });
+
+    let mut used = 0usize;
+    let mut pieces = Vec::new();
+    let definition_tokens = piece_tokens(&definition);
+    let (definition, trimmed) = if definition_tokens <= budget_tokens {
+        (definition, false)
+    } else {
+        (truncate_to(&definition, budget_tokens), true)
+    };
+    used += piece_tokens(&definition);
+    pieces.push(piece(
+        PieceRole::Definition,
+        sym.qualified_name.clone(),
+        sym.path.clone(),
+        sym.language.clone(),
+        1.0,
+        definition,
+        trimmed,
+    ));
+
+    let mut omitted = Vec::new();
+    for candidate in candidates {
+        let remaining = budget_tokens.saturating_sub(used);
+        let full_tokens = piece_tokens(&candidate.full);
+        let brief_tokens = candidate.brief.as_ref().map(piece_tokens);
+        let chosen = if full_tokens <= remaining {
+            Some((candidate.full, false))
+        } else if brief_tokens.is_some_and(|tokens| tokens <= remaining) {
+            candidate.brief.map(|brief| (brief, true))
+        } else {
+            None
+        };
+        match chosen {
+            Some((excerpt, trimmed)) => {
+                used += piece_tokens(&excerpt);
+                pieces.push(piece(
+                    candidate.role,
+                    candidate.name,
+                    candidate.path,
+                    candidate.language,
+                    candidate.relevance,
+                    excerpt,
+                    trimmed,
+                ));
+            }
+            None => omitted.push(OmittedPiece {
+                role: candidate.role,
+                tokens: brief_tokens.unwrap_or(full_tokens),
+                name: candidate.name,
+                path: candidate.path,
+            }),
+        }
+    }
+    // Stable: pieces of a role stay in relevance order.
+    pieces.sort_by_key(|piece| piece.role);
+
+    Ok(SymbolContext {
+        symbol: sym.qualified_name,
+        ref_name: ref_name.to_string(),
+        budget_tokens,
+        used_tokens: used,
+        pieces,
+        omitted,
+    })
+}
+
+/// Render a context as Markdown, one fenced block per piece.
+pub fn render_markdown(context: &SymbolContext) -> String {
+    let mut out = format!(
+        "# Context for {} (ref {}, {}/{} tokens)\n",
+        context.symbol, context.ref_name, context.used_tokens, context.budget_tokens
+    );
+    for piece in &context.pieces {
+        out.push_str(&format!(
+            "\n## {} {} ({}:{}-{}){}\n\n```{}\n{}\n```\n",
+            piece.role.as_str(),
+            piece.name,
+            piece.path,
+            piece.line_start,
+            piece.line_end,
+            if piece.trimmed { ", trimmed" } else { "" },
+            piece.language,
+            piece.content.trim_end()
+        ));
+    }
+    if !context.omitted.is_empty() {
+        out.push_str(&format!(
+            "\n{} more piece(s) did not fit: ",
+            context.omitted.len()
+        ));
+        let names: Vec<String> = context
+            .omitted
+            .iter()
+            .map(|omitted| format!("{} {}", omitted.role.as_str(), omitted.name))
+            .collect();
+        out.push_str(&names.join(", "));
+        out.push('\n');
+    }
+    out
+}
+
+fn piece(
+    role: PieceRole,
+    name: String,
+    path: String,
+    language: String,
+    relevance: f64,
+    excerpt: Excerpt,
+    trimmed: bool,
+) -> ContextPiece {
+    ContextPiece {
+        role,
+        tokens: piece_tokens(&excerpt),
+        name,
+        path,
+        line_start: excerpt.line_start,
+        line_end: excerpt.line_end,
+        language,
+        relevance,
+        trimmed,
+        content: excerpt.content,
+    }
+}
+
+/// Tokens of an excerpt plus its heading and fences.
+fn piece_tokens(excerpt: &Excerpt) -> usize {
+    estimate_tokens(&excerpt.content) + 8
+}
+
+/// The leading lines of `full` that fit in `budget` tokens, then `...`.
+fn truncate_to(full: &Excerpt, budget: usize) -> Excerpt {
+    let mut kept: Vec<&str> = Vec::new();
+    for line in full.content.lines() {
+        kept.push(line);
+        let candidate = Excerpt {
+            line_start: full.line_start,
+            line_end: full.line_start,
+            content: kept.join("\n"),
+        };
+        if piece_tokens(&candidate) > budget {
+            kept.pop();
+            break;
+        }
+    }
+    let line_end = full.line_start + kept.len().saturating_sub(1) as u32;
+    kept.push("...");
+    Excerpt {
+        line_start: full.line_start,
+        line_end,
+        content: kept.join("\n"),
+    }
+}
+
+/// Types the definition mentions, most relevant first.
+fn type_candidates(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+    definition: &str,
+    sources: &mut SourceCache,
+) -> Result<Vec<Candidate>, DescribeError> {
+    let mut candidates = Vec::new();
+    for target in referenced_types(conn, project_id, ref_name, sym, definition)? {
+        let relevance = 0.75 - 0.01 * candidates.len() as f64;
+        candidates.push(symbol_candidate(
+            PieceRole::Type,
+            target,
+            relevance.max(0.3),
+            sources,
+        ));
+    }
+    Ok(candidates)
+}
+
+/// Types `definition` (the source of `sym`) mentions by name, in order of
+/// first mention. A name defined more than once resolves to the definition
+/// nearest the symbol (same file, then same directory).
+pub(crate) fn referenced_types(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+    definition: &str,
+) -> Result<Vec<SymbolRecord>, StateError> {
+    let mut seen = HashSet::from([sym.name.as_str()]);
+    let mut types = Vec::new();
+    for identifier in IDENTIFIER.find_iter(definition).map(|m| m.as_str()) {
+        if seen.len() > MAX_TYPE_LOOKUPS {
+            break;
+        }
+        if !seen.insert(identifier) {
+            continue;
+        }
+        let mut named: Vec<SymbolRecord> =
+            symbols::find_symbols_by_name(conn, project_id, ref_name, identifier, None)?
+                .into_iter()
+                .filter(|candidate| is_type(candidate.kind) && candidate.language == sym.language)
+                .collect();
+        named.sort_by_key(|candidate| {
+            (
+                candidate.path != sym.path,
+                parent_dir(&candidate.path) != parent_dir(&sym.path),
+            )
+        });
+        types.extend(named.into_iter().next());
+    }
+    Ok(types)
+}
+
+/// Distinct resolved call targets, in call order.
+fn callee_candidates(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+    sources: &mut SourceCache,
+) -> Result<Vec<Candidate>, DescribeError> {
+    let mut calls = edges::get_callees(conn, project_id, ref_name, &sym.symbol_stable_id)?;
+    if calls.is_empty() {
+        calls = edges::get_callees(conn, project_id, ref_name, &sym.symbol_id)?;
+    }
+    calls.sort_by_key(|edge| edge.source_line);
+
+    let mut seen = HashSet::new();
+    let mut candidates = Vec::new();
+    for edge in calls {
+        let Some(id) = edge.to_symbol_id else {
+            continue;
+        };
+        if id == sym.symbol_stable_id || !seen.insert(id.clone()) {
+            continue;
+        }
+        let Some(target) = symbols::get_symbol_by_stable_id(conn, project_id, ref_name, &id)?
+        else {
+            continue;
+        };
+        let relevance = 0.7 - 0.01 * candidates.len() as f64;
+        candidates.push(symbol_candidate(
+            PieceRole::Callee,
+            target,
+            relevance.max(0.3),
+            sources,
+        ));
+    }
+    Ok(candidates)
+}
+
+/// One piece per calling symbol: the lines around its first call, or the
+/// calling line alone when those do not fit.
+fn caller_candidates(
+    conn: &Connection,
+    project_id: &str,
+    ref_name: &str,
+    sym: &SymbolRecord,
+    sources: &mut SourceCache,
+) -> Result<Vec<Candidate>, DescribeError> {
+    let mut calls = Vec::new();
+    for id in [&sym.symbol_stable_id, &sym.symbol_id] {
+        calls.extend(edges::get_callers(conn, project_id, ref_name, id)?);
+    }
+    let mut seen = HashSet::new();
+    let mut candidates = Vec::new();
+    for edge in calls {
+        if !seen.insert(edge.from_symbol_id.clone()) {
+            continue;
+        }
+        let caller = match symbols::get_symbol_by_stable_id(
+            conn,
+            project_id,
+            ref_name,
+            &edge.from_symbol_id,
+        )? {
+            Some(caller) => Some(caller),
+            None => symbols::get_symbol_by_id(conn, project_id, ref_name, &edge.from_symbol_id)?,
+        };
+        let Some(caller) = caller else {
+            continue;
+        };
+        let Some(lines) = sources.lines(&edge.source_file) else {
+            continue;
+        };
+        let line = edge.source_line.max(1);
+        let window_start = line
+            .saturating_sub(WINDOW_LINES as u32)
+            .max(caller.line_start)
+            .max(1);
+        let window_end = (line + WINDOW_LINES as u32).min(caller.line_end.max(line));
+        let mut full = excerpt(lines, window_start, window_end);
+        let header_line = caller.line_start.max(1);
+        if window_start > header_line
+            && let Some(header) = lines.get(header_line as usize - 1)
+        {
+            full.content = format!("{header}\n...\n{}", full.content);
+            full.line_start = header_line;
+        }
+        let relevance = 0.65 - 0.01 * candidates.len() as f64;
+        candidates.push(Candidate {
+            role: PieceRole::Caller,
+            name: caller.qualified_name,
+            path: edge.source_file,
+            language: caller.language,
+            relevance: relevance.max(0.3),
+            brief: Some(excerpt(lines, line, line)),
+            full,
+        });
+    }
+    Ok(candidates)
+}
+
+/// Config files that define a key the definition names in a string
+/// literal (`os.Getenv("DATABASE_URL")`, `cfg.get("server.port")`): the
+/// lines around each definition of the key, or those lines alone.
+fn config_candidates(workspace: &Path, definition: &str) -> Vec<Candidate> {
+    let mut keys: Vec<&str> = Vec::new();
+    for captures in CONFIG_KEY.captures_iter(definition) {
+        let key = captures.get(1).map_or("", |m| m.as_str());
+        let key = key.rsplit('.').next().unwrap_or(key);
+        if key.len() >= 3 && !keys.contains(&key) {
+            keys.push(key);
+        }
+    }
+    if keys.is_empty() {
+        return Vec::new();
+    }
+
+    let mut candidates = Vec::new();
+    for file in scanner::scan_config_files(workspace, MAX_CONFIG_FILE_BYTES, true) {
+        let Ok(content) = std::fs::read_to_string(&file.path) else {
+            continue;
+        };
+        let lines: Vec<String> = content.lines().map(str::to_string).collect();
+        let matches: Vec<usize> = lines
+            .iter()
+            .enumerate()
+            .filter(|(_, line)| keys.iter().any(|key| defines_key(line, key)))
+            .map(|(idx, _)| idx + 1)
+            .collect();
+        if matches.is_empty() {
+            continue;
+        }
+        candidates.push(Candidate {
+            role: PieceRole::Config,
+            name: file.relative_path.clone(),
+            path: file.relative_path,
+            language: file.language,
+            relevance: 0.5,
+            full: windows(&lines, &matches, WINDOW_LINES),
+            brief: Some(windows(&lines, &matches, 0)),
+        });
+    }
+    candidates
+}
+
+/// Whether a config line assigns `key`: `key:`, `key =`, `"key":` or
+/// `KEY=`.
+fn defines_key(line: &str, key: &str) -> bool {
+    let line = line.trim_start().trim_start_matches(['-', ' ']);
+    let rest = line
+        .strip_prefix('"')
+        .and_then(|rest| rest.strip_prefix(key))
+        .and_then(|rest| rest.strip_prefix('"'))
+        .or_else(|| line.strip_prefix(key));
+    rest.is_some_and(|rest| {
+        let rest = rest.trim_start();
+        rest.starts_with(':') || rest.starts_with('=')
+    })
+}
+
+/// Lines `line ± context` for each 1-based line in `matches`, joined with
+/// `...` across gaps.
+fn windows(lines: &[String], matches: &[usize], context: usize) -> Excerpt {
+    let mut ranges: Vec<(usize, usize)> = Vec::new();
+    for &line in matches {
+        let start = line.saturating_sub(context).max(1);
+        let end = (line + context).min(lines.len());
+        match ranges.last_mut() {
+            Some(last) if start <= last.1 + 1 => last.1 = last.1.max(end),
+            _ => ranges.push((start, end)),
+        }
+    }
+    let mut parts = Vec::new();
+    for &(start, end) in &ranges {
+        parts.push(lines[start - 1..end].join("\n"));
+    }
+    Excerpt {
+        line_start: ranges.first().map_or(1, |range| range.0) as u32,
+        line_end: ranges.last().map_or(1, |range| range.1) as u32,
+        content: parts.join("\n...\n"),
+    }
+}
+
+/// A type or callee: its whole definition, or its signature.
+fn symbol_candidate(
+    role: PieceRole,
+    target: SymbolRecord,
+    relevance: f64,
+    sources: &mut SourceCache,
+) -> Candidate {
+    let (full, first_line) = match sources.lines(&target.path) {
+        Some(lines) => (
+            excerpt(lines, target.line_start, target.line_end),
+            excerpt(lines, target.line_start, target.line_start),
+        ),
+        None => {
+            let signature = Excerpt {
+                line_start: target.line_start,
+                line_end: target.line_start,
+                content: target.signature.clone().unwrap_or_default(),
+            };
+            (signature.clone(), signature)
+        }
+    };
+    let brief = match target.signature.as_deref() {
+        Some(signature) if !signature.trim().is_empty() => Excerpt {
+            content: signature.trim().to_string(),
+            ..first_line
+        },
+        _ => first_line,
+    };
+    Candidate {
+        role,
+        name: target.qualified_name,
+        path: target.path,
+        language: target.language,
+        relevance,
+        full,
+        brief: Some(brief),
+    }
+}
+
+fn is_type(kind: SymbolKind) -> bool {
+    matches!(
+        kind,
+        SymbolKind::Struct
+            | SymbolKind::Class
+            | SymbolKind::Enum
+            | SymbolKind::Trait
+            | SymbolKind::Interface
+            | SymbolKind::TypeAlias
+    )
+}
+
+fn parent_dir(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+/// Lines `start..=end` (1-based, clamped to the file).
+fn excerpt(lines: &[String], start: u32, end: u32) -> Excerpt {
+    let start = (start.max(1) as usize).min(lines.len().max(1));
+    let end = (end as usize).clamp(start, lines.len().max(start));
+    Excerpt {
+        line_start: start as u32,
+        line_end: end as u32,
+        content: lines.get(start - 1..end).unwrap_or(&[]).join("\n"),
+    }
+}
+
+/// First line of the comments and attributes directly above `line_start`.
+pub(crate) fn leading_comment_start(lines: &[String], line_start: u32) -> u32 {
+    let mut start = line_start.max(1);
+    while start > 1 {
+        let above = lines
+            .get(start as usize - 2)
+            .map_or("", |line| line.trim_start());
+        let is_lead = ["//", "#", "/*", "*", "@"]
+            .iter()
+            .any(|prefix| above.starts_with(prefix));
+        if !is_lead {
+            break;
+        }
+        start -= 1;
+    }
+    start
+}
+
+/// Working-tree files read once each; `None` for unreadable files.
+struct SourceCache<'a> {
+    workspace: &'a Path,
+    files: HashMap<String, Option<Vec<String>>>,
+}
+
+impl<'a> SourceCache<'a> {
+    fn new(workspace: &'a Path) -> Self {
+        Self {
+            workspace,
+            files: HashMap::new(),
+        }
+    }
+
+    fn lines(&mut self, path: &str) -> Option<&[String]> {
+        let workspace = self.workspace;
+        self.files
+            .entry(path.to_string())
+            .or_insert_with(|| {
+                std::fs::read_to_string(workspace.join(path))
+                    .ok()
+                    .map(|content| content.lines().map(str::to_string).collect())
+            })
+            .as_deref()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::CallEdge;
+    use cruxe_state::{db, schema};
+
+    const AUTH: &str = "package auth
+
+// Claims holds the token subject.
+type Claims struct {
+	Subject string
+}
+
+// Validate parses a token.
+func Validate(token string) (*Claims, error) {
+	secret := os.Getenv(\"JWT_SECRET\")
+	return decode(token, secret)
+}
+
+func decode(token, secret string) (*Claims, error) {
+	return &Claims{Subject: token}, nil
+}
+";
+
+    const HANDLER: &str = "package api
+
+func Login(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(\"Authorization\")
+	claims, err := auth.Validate(token)
+	if err != nil {
+		return
+	}
+	_ = claims
+}
+";
+
+    fn record(name: &str, kind: SymbolKind, path: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("{}.{name}", parent_dir(path)),
+            kind,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: &str, file: &str, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: format!("stable::{from}"),
+            to_symbol_id: Some(format!("stable::{to}")),
+            to_name: None,
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: file.to_string(),
+            source_line: line,
+        }
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let workspace = tmp.path().join("ws");
+        for (path, content) in [
+            ("auth/auth.go", AUTH),
+            ("api/login.go", HANDLER),
+            (
+                "deploy/values.yaml",
+                "env:\n  JWT_SECRET: changeme\n  PORT: 8080\n",
+            ),
+        ] {
+            let full = workspace.join(path);
+            std::fs::create_dir_all(full.parent().unwrap()).unwrap();
+            std::fs::write(full, content).unwrap();
+        }
+        for symbol in [
+            record("Claims", SymbolKind::Struct, "auth/auth.go", (4, 6)),
+            record("Validate", SymbolKind::Function, "auth/auth.go", (9, 12)),
+            record("decode", SymbolKind::Function, "auth/auth.go", (14, 16)),
+            record("Login", SymbolKind::Function, "api/login.go", (3, 10)),
+        ] {
+            symbols::insert_symbol(&conn, &symbol).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("Validate", "decode", "auth/auth.go", 11),
+                call("Login", "Validate", "api/login.go", 5),
+            ],
+        )
+        .unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn pack_holds_definition_types_calls_and_config() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        let context = build_symbol_context(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            "Validate",
+            None,
+            DEFAULT_BUDGET_TOKENS,
+        )
+        .unwrap();
+
+        let roles: Vec<(PieceRole, &str)> = context
+            .pieces
+            .iter()
+            .map(|piece| (piece.role, piece.name.as_str()))
+            .collect();
+        assert_eq!(
+            roles,
+            vec![
+                (PieceRole::Definition, "auth.Validate"),
+                (PieceRole::Type, "auth.Claims"),
+                (PieceRole::Callee, "auth.decode"),
+                (PieceRole::Caller, "api.Login"),
+                (PieceRole::Config, "deploy/values.yaml"),
+            ]
+        );
+        let definition = &context.pieces[0];
+        assert_eq!(definition.line_start, 8);
+        assert!(
+            definition
+                .content
+                .starts_with("// Validate parses a token.")
+        );
+        assert!(context.pieces[3].content.contains("auth.Validate(token)"));
+        assert_eq!(
+            context.pieces[4].content,
+            "env:\n  JWT_SECRET: changeme\n  PORT: 8080"
+        );
+        assert!(context.omitted.is_empty());
+        assert!(context.used_tokens <= context.budget_tokens);
+
+        let markdown = render_markdown(&context);
+        assert!(markdown.starts_with("# Context for auth.Validate (ref main, "));
+        assert!(markdown.contains("## callee auth.decode (auth/auth.go:14-16)\n\n```go\n"));
+    }
+
+    #[test]
+    fn a_tight_budget_trims_pieces_then_leaves_them_out() {
+        let (tmp, conn) = setup();
+        let workspace = tmp.path().join("ws");
+        let full = build_symbol_context(&conn, &workspace, "repo", "main", "Validate", None, 8000)
+            .unwrap();
+        let definition_tokens = full.pieces[0].tokens;
+
+        // Room for the signature of Claims but not its body.
+        let context = build_symbol_context(
+            &conn,
+            &workspace,
+            "repo",
+            "main",
+            "auth.Validate",
+            None,
+            definition_tokens + 16,
+        )
+        .unwrap();
+        assert!(context.used_tokens <= context.budget_tokens);
+        assert_eq!(context.pieces.len(), 2);
+        assert!(!context.pieces[0].trimmed);
+        assert!(context.pieces[1].trimmed);
+        assert_eq!(context.pieces[1].content, "type Claims struct {");
+        let omitted: Vec<&str> = context
+            .omitted
+            .iter()
+            .map(|omitted| omitted.name.as_str())
+            .collect();
+        assert_eq!(omitted, ["auth.decode", "api.Login", "deploy/values.yaml"]);
+
+        let tiny =
+            build_symbol_context(&conn, &workspace, "repo", "main", "Validate", None, 12).unwrap();
+        assert_eq!(tiny.pieces.len(), 1);
+        assert!(tiny.pieces[0].trimmed);
+        assert!(tiny.pieces[0].content.ends_with("..."));
+
+        let err = build_symbol_context(&conn, &workspace, "repo", "main", "Missing", None, 100)
+            .unwrap_err();
+        assert!(matches!(err, DescribeError::SymbolNotFound));
+    }
+
+    #[test]
+    fn config_keys_match_assignments_only() {
+        assert!(defines_key("  JWT_SECRET: x", "JWT_SECRET"));
+        assert!(defines_key("JWT_SECRET=x", "JWT_SECRET"));
+        assert!(defines_key("  \"port\": 8080,", "port"));
+        assert!(defines_key("- port = 1", "port"));
+        assert!(!defines_key("  # set JWT_SECRET: x", "JWT_SECRET"));
+        assert!(!defines_key("  ports: [1]", "port"));
+    }
+}
@@ -0,0 +1,500 @@
+//! Symbol-level diff between two indexed refs, for `cruxe diff`.
+//!
+//! Symbols are paired by kind and qualified name. What is left unpaired is
+//! checked for renames: a removed and an added symbol of the same kind are
+//! one renamed symbol when the old body with the old name replaced by the
+//! new one is the new body (or, without stored bodies, when the signatures
+//! match that way in the same file). Changes to exported symbols are
+//! flagged as API changes.
+
+use crate::deadcode::is_exported;
+use crate::ref_sites::identifier_matches;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::{Connection, OptionalExtension, params};
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+
+#[derive(Debug, thiserror::Error)]
+pub enum SymbolDiffError {
+    #[error("ref `{0}` has no indexed symbols")]
+    RefNotIndexed(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize, JsonSchema)]
+#[serde(rename_all = "snake_case")]
+pub enum ChangeKind {
+    Added,
+    Removed,
+    Renamed,
+    SignatureChanged,
+    VisibilityChanged,
+    Moved,
+    /// Body changed with the signature intact; only reported on request.
+    Modified,
+}
+
+impl ChangeKind {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Added => "added",
+            Self::Removed => "removed",
+            Self::Renamed => "renamed",
+            Self::SignatureChanged => "signature_changed",
+            Self::VisibilityChanged => "visibility_changed",
+            Self::Moved => "moved",
+            Self::Modified => "modified",
+        }
+    }
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SymbolChange {
+    pub change: ChangeKind,
+    pub kind: String,
+    /// Name in the head ref; the base name for removed symbols.
+    pub qualified_name: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_qualified_name: Option<String>,
+    pub path: String,
+    pub line: u32,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_path: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub old_signature: Option<String>,
+    /// Exported in either ref.
+    pub exported: bool,
+    /// The change alters what other packages can see or call.
+    pub api_changed: bool,
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct SymbolDiffOptions {
+    /// Also report symbols whose body changed but signature did not.
+    pub include_body_changes: bool,
+    /// Only report changes to exported symbols.
+    pub exported_only: bool,
+    pub path_prefix: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct SymbolDiff {
+    pub repo: String,
+    pub base_ref: String,
+    pub head_ref: String,
+    /// Changes per [`ChangeKind::as_str`].
+    pub counts: BTreeMap<String, usize>,
+    pub api_changes: usize,
+    pub changes: Vec<SymbolChange>,
+}
+
+struct Entry {
+    record: SymbolRecord,
+    hash: String,
+    exported: bool,
+}
+
+pub fn diff_symbols(
+    conn: &Connection,
+    repo: &str,
+    base_ref: &str,
+    head_ref: &str,
+    options: &SymbolDiffOptions,
+) -> Result<SymbolDiff, SymbolDiffError> {
+    let base = load_entries(conn, repo, base_ref, options)?;
+    let head = load_entries(conn, repo, head_ref, options)?;
+
+    let mut head_by_key: HashMap<(String, String), Vec<usize>> = HashMap::new();
+    for (idx, entry) in head.iter().enumerate() {
+        head_by_key.entry(key(&entry.record)).or_default().push(idx);
+    }
+    let mut head_paired = vec![false; head.len()];
+    let mut removed = Vec::new();
+    let mut changes = Vec::new();
+    for before in &base {
+        let candidates = head_by_key.get(&key(&before.record));
+        // Several symbols can share a qualified name (overloads, one per
+        // file); prefer the one in the same file.
+        let paired = candidates.and_then(|idxs| {
+            let free = || idxs.iter().copied().filter(|&idx| !head_paired[idx]);
+            free()
+                .find(|&idx| head[idx].record.path == before.record.path)
+                .or_else(|| free().next())
+        });
+        match paired {
+            Some(idx) => {
+                head_paired[idx] = true;
+                if let Some(change) = compare(before, &head[idx], options) {
+                    changes.push(change);
+                }
+            }
+            None => removed.push(before),
+        }
+    }
+    let mut added: Vec<&Entry> = head
+        .iter()
+        .zip(&head_paired)
+        .filter(|(_, paired)| !**paired)
+        .map(|(entry, _)| entry)
+        .collect();
+
+    for before in removed {
+        let renamed_to = added
+            .iter()
+            .position(|after| is_rename(conn, repo, base_ref, head_ref, before, after));
+        match renamed_to {
+            Some(pos) => {
+                let after = added.remove(pos);
+                changes.push(change(ChangeKind::Renamed, Some(before), after));
+            }
+            None => changes.push(change(ChangeKind::Removed, None, before)),
+        }
+    }
+    changes.extend(
+        added
+            .into_iter()
+            .map(|after| change(ChangeKind::Added, None, after)),
+    );
+
+    if options.exported_only {
+        changes.retain(|change| change.exported);
+    }
+    changes.sort_by(|a, b| {
+        a.path
+            .cmp(&b.path)
+            .then_with(|| a.line.cmp(&b.line))
+            .then_with(|| a.qualified_name.cmp(&b.qualified_name))
+    });
+    let mut counts = BTreeMap::new();
+    for change in &changes {
+        *counts
+            .entry(change.change.as_str().to_string())
+            .or_default() += 1;
+    }
+    Ok(SymbolDiff {
+        repo: repo.to_string(),
+        base_ref: base_ref.to_string(),
+        head_ref: head_ref.to_string(),
+        counts,
+        api_changes: changes.iter().filter(|change| change.api_changed).count(),
+        changes,
+    })
+}
+
+fn load_entries(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    options: &SymbolDiffOptions,
+) -> Result<Vec<Entry>, SymbolDiffError> {
+    let mut hashes: HashMap<String, String> = HashMap::new();
+    {
+        let mut stmt = conn
+            .prepare(
+                "SELECT symbol_id, content_hash FROM symbol_relations
+                 WHERE repo = ?1 AND \"ref\" = ?2",
+            )
+            .map_err(StateError::sqlite)?;
+        let rows = stmt
+            .query_map(params![repo, ref_name], |row| {
+                Ok((row.get::<_, String>(0)?, row.get::<_, String>(1)?))
+            })
+            .map_err(StateError::sqlite)?;
+        for row in rows {
+            let (id, hash) = row.map_err(StateError::sqlite)?;
+            hashes.insert(id, hash);
+        }
+    }
+    if hashes.is_empty() {
+        return Err(SymbolDiffError::RefNotIndexed(ref_name.to_string()));
+    }
+
+    let prefix = options.path_prefix.as_deref().unwrap_or_default();
+    let mut entries = Vec::new();
+    symbols::for_each_symbol_for_ref(conn, repo, ref_name, |record| {
+        if record.path.starts_with(prefix) {
+            entries.push(Entry {
+                hash: hashes.remove(&record.symbol_id).unwrap_or_default(),
+                exported: is_exported(&record),
+                record,
+            });
+        }
+        Ok(())
+    })?;
+    Ok(entries)
+}
+
+fn key(record: &SymbolRecord) -> (String, String) {
+    (
+        record.kind.as_str().to_string(),
+        record.qualified_name.clone(),
+    )
+}
+
+/// The change between two symbols paired by name, if any worth reporting.
+fn compare(before: &Entry, after: &Entry, options: &SymbolDiffOptions) -> Option<SymbolChange> {
+    let kind = if normalize(&before.record.signature) != normalize(&after.record.signature) {
+        ChangeKind::SignatureChanged
+    } else if before.exported != after.exported {
+        ChangeKind::VisibilityChanged
+    } else if before.record.path != after.record.path {
+        ChangeKind::Moved
+    } else if options.include_body_changes && before.hash != after.hash {
+        ChangeKind::Modified
+    } else {
+        return None;
+    };
+    Some(change(kind, Some(before), after))
+}
+
+fn change(kind: ChangeKind, before: Option<&Entry>, after: &Entry) -> SymbolChange {
+    let exported = after.exported || before.is_some_and(|before| before.exported);
+    let api_changed = match kind {
+        ChangeKind::Moved | ChangeKind::Modified => false,
+        ChangeKind::VisibilityChanged => true,
+        _ => exported,
+    };
+    let differs = |a: &str, b: &str| (a != b).then(|| a.to_string());
+    SymbolChange {
+        change: kind,
+        kind: after.record.kind.as_str().to_string(),
+        qualified_name: after.record.qualified_name.clone(),
+        old_qualified_name: before.and_then(|before| {
+            differs(&before.record.qualified_name, &after.record.qualified_name)
+        }),
+        path: after.record.path.clone(),
+        line: after.record.line_start,
+        old_path: before.and_then(|before| differs(&before.record.path, &after.record.path)),
+        signature: after.record.signature.clone(),
+        old_signature: before
+            .filter(|before| before.record.signature != after.record.signature)
+            .and_then(|before| before.record.signature.clone()),
+        exported,
+        api_changed,
+    }
+}
+
+fn is_rename(
+    conn: &Connection,
+    repo: &str,
+    base_ref: &str,
+    head_ref: &str,
+    before: &Entry,
+    after: &Entry,
+) -> bool {
+    let (old, new) = (&before.record, &after.record);
+    if old.kind != new.kind || old.language != new.language || old.name == new.name {
+        return false;
+    }
+    if !before.hash.is_empty() && !after.hash.is_empty() {
+        let old_body = symbol_content(conn, repo, base_ref, &old.symbol_id);
+        let new_body = symbol_content(conn, repo, head_ref, &new.symbol_id);
+        if let (Some(old_body), Some(new_body)) = (old_body, new_body) {
+            return rename_identifier(&old_body, &old.name, &new.name) == new_body;
+        }
+    }
+    old.path == new.path
+        && old.signature.is_some()
+        && normalize(
+            &old.signature
+                .as_deref()
+                .map(|s| rename_identifier(s, &old.name, &new.name)),
+        ) == normalize(&new.signature)
+}
+
+fn symbol_content(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    symbol_id: &str,
+) -> Option<String> {
+    conn.query_row(
+        "SELECT content FROM symbol_relations
+         WHERE repo = ?1 AND \"ref\" = ?2 AND symbol_id = ?3",
+        params![repo, ref_name, symbol_id],
+        |row| row.get::<_, Option<String>>(0),
+    )
+    .optional()
+    .ok()
+    .flatten()
+    .flatten()
+}
+
+fn rename_identifier(text: &str, from: &str, to: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    let mut last = 0;
+    for start in identifier_matches(text, from) {
+        out.push_str(&text[last..start]);
+        out.push_str(to);
+        last = start + from.len();
+    }
+    out.push_str(&text[last..]);
+    out
+}
+
+/// Signatures compared with whitespace runs collapsed.
+fn normalize(signature: &Option<String>) -> Option<String> {
+    signature
+        .as_deref()
+        .map(|s| s.split_whitespace().collect::<Vec<_>>().join(" "))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::{db, schema};
+
+    fn insert(conn: &Connection, ref_name: &str, name: &str, signature: &str, body: &str) {
+        insert_at(conn, ref_name, "src/lib.rs", name, signature, body);
+    }
+
+    fn insert_at(
+        conn: &Connection,
+        ref_name: &str,
+        path: &str,
+        name: &str,
+        signature: &str,
+        body: &str,
+    ) {
+        symbols::insert_symbol(
+            conn,
+            &SymbolRecord {
+                repo: "repo".to_string(),
+                r#ref: ref_name.to_string(),
+                commit: None,
+                path: path.to_string(),
+                language: "rust".to_string(),
+                symbol_id: format!("{ref_name}::{path}::{name}"),
+                symbol_stable_id: format!("stable::{path}::{name}"),
+                name: name.to_string(),
+                qualified_name: format!("crate::{name}"),
+                kind: SymbolKind::Function,
+                signature: Some(signature.to_string()),
+                line_start: 1,
+                line_end: 3,
+                parent_symbol_id: None,
+                visibility: None,
+                content: Some(body.to_string()),
+            },
+        )
+        .unwrap();
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn classifies_added_removed_renamed_and_signature_changes() {
+        let (_tmp, conn) = setup();
+        insert(&conn, "main", "same", "pub fn same()", "pub fn same() {}");
+        insert(&conn, "feat", "same", "pub fn same()", "pub fn same() {}");
+        insert(&conn, "main", "gone", "fn gone()", "fn gone() { 1 }");
+        insert(
+            &conn,
+            "feat",
+            "fresh",
+            "pub fn fresh()",
+            "pub fn fresh() { 2 }",
+        );
+        insert(
+            &conn,
+            "main",
+            "old_name",
+            "pub fn old_name(a: u8)",
+            "pub fn old_name(a: u8) { a }",
+        );
+        insert(
+            &conn,
+            "feat",
+            "new_name",
+            "pub fn new_name(a: u8)",
+            "pub fn new_name(a: u8) { a }",
+        );
+        insert(
+            &conn,
+            "main",
+            "grow",
+            "pub fn grow(n: u8)",
+            "pub fn grow(n: u8) {}",
+        );
+        insert(
+            &conn,
+            "feat",
+            "grow",
+            "pub fn grow(n: u16)",
+            "pub fn grow(n: u16) {}",
+        );
+        insert(&conn, "main", "hide", "pub fn hide()", "pub fn hide() {}");
+        insert(&conn, "feat", "hide", "fn hide()", "fn hide() {}");
+        insert(&conn, "main", "body", "fn body()", "fn body() { 1 }");
+        insert(&conn, "feat", "body", "fn body()", "fn body() { 2 }");
+
+        let diff =
+            diff_symbols(&conn, "repo", "main", "feat", &SymbolDiffOptions::default()).unwrap();
+        let found: Vec<(&str, &str, bool)> = diff
+            .changes
+            .iter()
+            .map(|c| (c.change.as_str(), c.qualified_name.as_str(), c.api_changed))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("added", "crate::fresh", true),
+                ("removed", "crate::gone", false),
+                ("signature_changed", "crate::grow", true),
+                ("signature_changed", "crate::hide", true),
+                ("renamed", "crate::new_name", true),
+            ]
+        );
+        let renamed = &diff.changes[4];
+        assert_eq!(
+            renamed.old_qualified_name.as_deref(),
+            Some("crate::old_name")
+        );
+        assert_eq!(diff.api_changes, 4);
+        assert_eq!(diff.counts["signature_changed"], 2);
+
+        let with_bodies = diff_symbols(
+            &conn,
+            "repo",
+            "main",
+            "feat",
+            &SymbolDiffOptions {
+                include_body_changes: true,
+                exported_only: false,
+                path_prefix: None,
+            },
+        )
+        .unwrap();
+        assert_eq!(with_bodies.counts["modified"], 1);
+
+        assert!(matches!(
+            diff_symbols(&conn, "repo", "main", "nope", &SymbolDiffOptions::default()),
+            Err(SymbolDiffError::RefNotIndexed(name)) if name == "nope"
+        ));
+    }
+
+    #[test]
+    fn same_name_symbols_prefer_the_same_file_and_report_moves() {
+        let (_tmp, conn) = setup();
+        insert_at(&conn, "main", "a.rs", "run", "fn run()", "fn run() {}");
+        insert_at(&conn, "feat", "b.rs", "run", "fn run()", "fn run() {}");
+        let diff =
+            diff_symbols(&conn, "repo", "main", "feat", &SymbolDiffOptions::default()).unwrap();
+        assert_eq!(diff.changes.len(), 1);
+        assert_eq!(diff.changes[0].change, ChangeKind::Moved);
+        assert_eq!(diff.changes[0].old_path.as_deref(), Some("a.rs"));
+        assert!(!diff.changes[0].api_changed);
+    }
+}
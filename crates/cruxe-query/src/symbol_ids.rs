@@ -0,0 +1,212 @@
+//! Canonical symbol ids of indexed symbols (see
+//! [`cruxe_core::canonical_id`]) and the way back from an id to where the
+//! symbol is.
+
+use crate::search::SearchResult;
+use cruxe_core::canonical_id;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::go_modules::{self, GoModule};
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+
+/// Computes the canonical ids of one repo/ref; holds its Go modules.
+pub struct CanonicalIds {
+    go_modules: Vec<GoModule>,
+}
+
+impl CanonicalIds {
+    pub fn load(conn: &Connection, repo: &str, ref_name: &str) -> Result<Self, StateError> {
+        Ok(Self {
+            go_modules: go_modules::list_for_ref(conn, repo, ref_name)?,
+        })
+    }
+
+    pub fn id_of(&self, language: &str, path: &str, qualified_name: &str) -> String {
+        canonical_id::canonical_symbol_id(
+            language,
+            &self.package_of(language, path),
+            qualified_name,
+        )
+    }
+
+    fn package_of(&self, language: &str, path: &str) -> String {
+        let import_path = (language == "go")
+            .then(|| {
+                canonical_id::go_import_path(
+                    canonical_id::parent_dir(path),
+                    self.go_modules
+                        .iter()
+                        .map(|module| (module.module_path.as_str(), module.dir.as_str())),
+                )
+            })
+            .flatten();
+        canonical_id::package_of(language, path, import_path.as_deref())
+    }
+}
+
+/// Fill in the canonical id of every symbol result that has none.
+pub fn annotate(
+    conn: &Connection,
+    ref_name: &str,
+    results: &mut [SearchResult],
+) -> Result<(), StateError> {
+    let mut by_repo: HashMap<String, CanonicalIds> = HashMap::new();
+    for result in results.iter_mut() {
+        if result.canonical_id.is_some() {
+            continue;
+        }
+        let Some(qualified_name) = result.qualified_name.as_deref() else {
+            continue;
+        };
+        if !by_repo.contains_key(&result.repo) {
+            let ids = CanonicalIds::load(conn, &result.repo, ref_name)?;
+            by_repo.insert(result.repo.clone(), ids);
+        }
+        result.canonical_id =
+            Some(by_repo[&result.repo].id_of(&result.language, &result.path, qualified_name));
+    }
+    Ok(())
+}
+
+/// Where a canonical id points.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, JsonSchema)]
+pub struct ResolvedSymbol {
+    pub canonical_id: String,
+    pub symbol_stable_id: String,
+    pub path: String,
+    pub line_start: u32,
+    pub line_end: u32,
+    pub kind: String,
+    pub name: String,
+    pub qualified_name: String,
+    pub language: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub signature: Option<String>,
+}
+
+/// The symbols a canonical id names, ordered by path and line; several for
+/// overloads, none when the symbol is gone.
+pub fn resolve(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    id: &str,
+) -> Result<Vec<ResolvedSymbol>, StateError> {
+    let Some((language, rest)) = canonical_id::split(id) else {
+        return Ok(Vec::new());
+    };
+    let id = format!("{language} {rest}");
+    let ids = CanonicalIds::load(conn, repo, ref_name)?;
+    // The qualified name is a suffix of the id starting after a separator;
+    // each candidate is checked against the full id.
+    let separator = canonical_id::separator(language);
+    let starts = std::iter::once(0).chain(
+        rest.match_indices(separator)
+            .map(|(at, _)| at + separator.len()),
+    );
+    let mut resolved: Vec<ResolvedSymbol> = Vec::new();
+    for start in starts {
+        let qualified_name = &rest[start..];
+        for symbol in
+            symbols::find_symbols_by_qualified_name(conn, repo, ref_name, language, qualified_name)?
+        {
+            let canonical_id = ids.id_of(&symbol.language, &symbol.path, &symbol.qualified_name);
+            if canonical_id == id {
+                resolved.push(resolved_symbol(canonical_id, symbol));
+            }
+        }
+    }
+    resolved.sort_by(|a, b| (&a.path, a.line_start).cmp(&(&b.path, b.line_start)));
+    Ok(resolved)
+}
+
+fn resolved_symbol(canonical_id: String, symbol: SymbolRecord) -> ResolvedSymbol {
+    ResolvedSymbol {
+        canonical_id,
+        symbol_stable_id: symbol.symbol_stable_id,
+        path: symbol.path,
+        line_start: symbol.line_start,
+        line_end: symbol.line_end,
+        kind: symbol.kind.as_str().to_string(),
+        name: symbol.name,
+        qualified_name: symbol.qualified_name,
+        language: symbol.language,
+        signature: symbol.signature,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+    use cruxe_state::{db, schema};
+
+    fn symbol(path: &str, qualified_name: &str, line_start: u32) -> SymbolRecord {
+        let name = qualified_name.rsplit('.').next().unwrap().to_string();
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{path}::{qualified_name}"),
+            symbol_stable_id: format!("stable::{path}::{qualified_name}"),
+            name,
+            qualified_name: qualified_name.to_string(),
+            kind: SymbolKind::Method,
+            signature: None,
+            line_start,
+            line_end: line_start + 4,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn ids_resolve_back_to_their_symbols() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        go_modules::replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[GoModule {
+                module_path: "github.com/acme/api".to_string(),
+                dir: String::new(),
+            }],
+        )
+        .unwrap();
+        for record in [
+            symbol("internal/user/server.go", "Server.Handle", 12),
+            symbol("internal/admin/server.go", "Server.Handle", 30),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+
+        let ids = CanonicalIds::load(&conn, "repo", "main").unwrap();
+        let id = ids.id_of("go", "internal/user/server.go", "Server.Handle");
+        assert_eq!(id, "go github.com/acme/api/internal/user.Server.Handle");
+
+        let resolved = resolve(&conn, "repo", "main", &id).unwrap();
+        assert_eq!(resolved.len(), 1);
+        assert_eq!(resolved[0].path, "internal/user/server.go");
+        assert_eq!(resolved[0].line_start, 12);
+        assert!(
+            resolve(
+                &conn,
+                "repo",
+                "main",
+                "go github.com/acme/api.Server.Handle"
+            )
+            .unwrap()
+            .is_empty()
+        );
+        assert!(resolve(&conn, "repo", "main", "Server").unwrap().is_empty());
+    }
+}
@@ -0,0 +1,304 @@
+//! Editor tag files from the symbol index (`cruxe tags`): a universal-ctags
+//! compatible `tags` file for vim and an etags `TAGS` file for emacs.
+//!
+//! Paths are written as indexed, relative to the workspace root, so the file
+//! belongs at the root. ctags entries address symbols by line number; etags
+//! entries also carry the source line text and byte offset when the file is
+//! readable under `source_root`.
+
+use cruxe_core::types::SymbolRecord;
+use std::collections::{BTreeMap, HashMap};
+use std::io::{self, Write};
+use std::path::Path;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TagsFormat {
+    Ctags,
+    Etags,
+}
+
+impl TagsFormat {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value.trim().to_ascii_lowercase().as_str() {
+            "ctags" | "vim" => Some(Self::Ctags),
+            "etags" | "emacs" => Some(Self::Etags),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Ctags => "ctags",
+            Self::Etags => "etags",
+        }
+    }
+
+    /// Name editors look for by default.
+    pub fn default_file_name(self) -> &'static str {
+        match self {
+            Self::Ctags => "tags",
+            Self::Etags => "TAGS",
+        }
+    }
+}
+
+/// Write `symbols` as a sorted extended-format ctags file. Returns the number
+/// of tags written; symbols without a line or with tabs/newlines in their
+/// name or path cannot be represented and are skipped.
+pub fn write_ctags<W: Write>(symbols: &[SymbolRecord], out: &mut W) -> io::Result<usize> {
+    let scopes = scope_names(symbols);
+    let mut lines: Vec<String> = symbols
+        .iter()
+        .filter(|symbol| taggable(symbol))
+        .map(|symbol| {
+            let mut line = format!(
+                "{}\t{}\t{};\"\tkind:{}\tline:{}\tlanguage:{}",
+                symbol.name,
+                symbol.path,
+                symbol.line_start,
+                symbol.kind.as_str(),
+                symbol.line_start,
+                language_name(&symbol.language)
+            );
+            if let Some((kind, name)) = symbol
+                .parent_symbol_id
+                .as_deref()
+                .and_then(|parent| scopes.get(parent))
+            {
+                line.push_str(&format!("\t{kind}:{}", escape_field(name)));
+            }
+            line
+        })
+        .collect();
+    // Sorted by byte value so vim can binary-search (`!_TAG_FILE_SORTED 1`).
+    lines.sort();
+    lines.dedup();
+
+    writeln!(
+        out,
+        "!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/"
+    )?;
+    writeln!(
+        out,
+        "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/"
+    )?;
+    writeln!(out, "!_TAG_PROGRAM_NAME\tcruxe\t//")?;
+    for line in &lines {
+        writeln!(out, "{line}")?;
+    }
+    Ok(lines.len())
+}
+
+/// Write `symbols` as an etags file, one section per source file. Returns
+/// the number of tags written.
+pub fn write_etags<W: Write>(
+    symbols: &[SymbolRecord],
+    source_root: Option<&Path>,
+    out: &mut W,
+) -> io::Result<usize> {
+    let mut by_path: BTreeMap<&str, Vec<&SymbolRecord>> = BTreeMap::new();
+    for symbol in symbols.iter().filter(|symbol| taggable(symbol)) {
+        by_path
+            .entry(symbol.path.as_str())
+            .or_default()
+            .push(symbol);
+    }
+
+    let mut written = 0usize;
+    for (path, mut file_symbols) in by_path {
+        file_symbols.sort_by(|left, right| {
+            left.line_start
+                .cmp(&right.line_start)
+                .then_with(|| left.name.cmp(&right.name))
+        });
+        file_symbols.dedup_by(|a, b| a.line_start == b.line_start && a.name == b.name);
+        let source = source_root.and_then(|root| SourceFile::read(&root.join(path)));
+
+        let mut section = Vec::new();
+        for symbol in &file_symbols {
+            match source
+                .as_ref()
+                .and_then(|file| file.line(symbol.line_start))
+            {
+                Some((text, offset)) => {
+                    let pattern = match text.find(symbol.name.as_str()) {
+                        Some(at) => &text[..at + symbol.name.len()],
+                        None => text,
+                    };
+                    writeln!(
+                        section,
+                        "{pattern}\x7f{}\x01{},{offset}",
+                        symbol.name, symbol.line_start
+                    )?;
+                }
+                None => writeln!(
+                    section,
+                    "{}\x7f{}\x01{},",
+                    symbol.name, symbol.name, symbol.line_start
+                )?,
+            }
+        }
+        write!(out, "\x0c\n{path},{}\n", section.len())?;
+        out.write_all(&section)?;
+        written += file_symbols.len();
+    }
+    Ok(written)
+}
+
+fn taggable(symbol: &SymbolRecord) -> bool {
+    let unsafe_char = |c: char| matches!(c, '\t' | '\n' | '\r' | '\x7f' | '\x01' | '\x0c');
+    symbol.line_start > 0
+        && !symbol.name.is_empty()
+        && !symbol.name.contains(unsafe_char)
+        && !symbol.path.contains(unsafe_char)
+}
+
+/// `(kind, name)` of every symbol, by symbol id and stable id, for the ctags
+/// scope field.
+fn scope_names(symbols: &[SymbolRecord]) -> HashMap<&str, (&'static str, &str)> {
+    let mut scopes = HashMap::new();
+    for symbol in symbols {
+        let scope = (symbol.kind.as_str(), symbol.name.as_str());
+        scopes.insert(symbol.symbol_id.as_str(), scope);
+        scopes.insert(symbol.symbol_stable_id.as_str(), scope);
+    }
+    scopes
+}
+
+/// Language names as universal-ctags spells them.
+fn language_name(language: &str) -> String {
+    match language {
+        "rust" => "Rust".to_string(),
+        "python" => "Python".to_string(),
+        "go" => "Go".to_string(),
+        "typescript" => "TypeScript".to_string(),
+        "javascript" => "JavaScript".to_string(),
+        "java" => "Java".to_string(),
+        "cpp" => "C++".to_string(),
+        "csharp" => "C#".to_string(),
+        other => {
+            let mut chars = other.chars();
+            chars.next().map_or_else(String::new, |first| {
+                first.to_uppercase().collect::<String>() + chars.as_str()
+            })
+        }
+    }
+}
+
+/// Backslash and tab escapes for extended field values.
+fn escape_field(value: &str) -> String {
+    value.replace('\\', "\\\\").replace('\t', "\\t")
+}
+
+struct SourceFile {
+    text: String,
+    /// Byte offset of the start of each line.
+    line_starts: Vec<usize>,
+}
+
+impl SourceFile {
+    fn read(path: &Path) -> Option<Self> {
+        let text = std::fs::read_to_string(path).ok()?;
+        let line_starts = std::iter::once(0)
+            .chain(text.match_indices('\n').map(|(at, _)| at + 1))
+            .collect();
+        Some(Self { text, line_starts })
+    }
+
+    /// Text (without line terminator) and byte offset of a one-based line.
+    fn line(&self, line: u32) -> Option<(&str, usize)> {
+        let start = *self.line_starts.get((line as usize).checked_sub(1)?)?;
+        let rest = &self.text[start..];
+        let text = rest.split('\n').next().unwrap_or_default();
+        Some((text.strip_suffix('\r').unwrap_or(text), start))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolKind;
+
+    fn symbol(name: &str, kind: SymbolKind, path: &str, line: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "rust".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind,
+            signature: None,
+            line_start: line,
+            line_end: line + 2,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    #[test]
+    fn ctags_are_sorted_with_header_and_scope() {
+        let mut method = symbol("check", SymbolKind::Method, "src/token.rs", 5);
+        method.parent_symbol_id = Some("sym::Token".to_string());
+        let symbols = vec![
+            method,
+            symbol("Token", SymbolKind::Struct, "src/token.rs", 1),
+            symbol("bad\tname", SymbolKind::Function, "src/token.rs", 9),
+            symbol("unplaced", SymbolKind::Function, "src/token.rs", 0),
+        ];
+
+        let mut buf = Vec::new();
+        assert_eq!(write_ctags(&symbols, &mut buf).unwrap(), 2);
+        let tags = String::from_utf8(buf).unwrap();
+        let lines: Vec<&str> = tags.lines().collect();
+        assert!(lines[0].starts_with("!_TAG_FILE_FORMAT\t2\t"));
+        assert!(lines[1].starts_with("!_TAG_FILE_SORTED\t1\t"));
+        assert_eq!(
+            lines[3],
+            "Token\tsrc/token.rs\t1;\"\tkind:struct\tline:1\tlanguage:Rust"
+        );
+        assert_eq!(
+            lines[4],
+            "check\tsrc/token.rs\t5;\"\tkind:method\tline:5\tlanguage:Rust\tstruct:Token"
+        );
+        assert_eq!(lines.len(), 5);
+    }
+
+    #[test]
+    fn etags_sections_carry_line_text_and_offsets() {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::create_dir_all(dir.path().join("src")).unwrap();
+        std::fs::write(
+            dir.path().join("src/token.rs"),
+            "pub struct Token;\r\n\r\npub fn check() {}\r\n",
+        )
+        .unwrap();
+        let symbols = vec![
+            symbol("check", SymbolKind::Function, "src/token.rs", 3),
+            symbol("Token", SymbolKind::Struct, "src/token.rs", 1),
+            symbol("gone", SymbolKind::Function, "src/missing.rs", 4),
+        ];
+
+        let mut buf = Vec::new();
+        assert_eq!(
+            write_etags(&symbols, Some(dir.path()), &mut buf).unwrap(),
+            3
+        );
+        let tags = String::from_utf8(buf).unwrap();
+
+        let missing_entries = "gone\x7fgone\x014,\n";
+        let token_entries = "pub struct Token\x7fToken\x011,0\npub fn check\x7fcheck\x013,21\n";
+        assert_eq!(
+            tags,
+            format!(
+                "\x0c\nsrc/missing.rs,{}\n{missing_entries}\x0c\nsrc/token.rs,{}\n{token_entries}",
+                missing_entries.len(),
+                token_entries.len()
+            )
+        );
+    }
+}
@@ -0,0 +1,819 @@
+//! Go templates checked against the data they are executed with.
+//!
+//! Template files are parsed at index time (`go_templates` table); templates
+//! parsed from Go strings (`template.New("x").Parse(...)`) come from the
+//! embedded HTML strings. `Execute`/`ExecuteTemplate` call sites in Go code
+//! name the template and the struct passed as its data; every field chain
+//! the template reads is then walked through the indexed struct definitions.
+//!
+//! Anonymous structs (`data := struct{ Title string }{...}`, fields declared
+//! `Meta struct { ... }`) are followed through the nodes indexed for them.
+//!
+//! Like `cruxe check`, this works without type information: a chain is only
+//! reported when every step up to the missing field resolved to a struct
+//! defined in the repo. Methods, maps, interfaces, external types and data
+//! that cannot be traced to a composite literal, `var` or parameter are
+//! given the benefit of the doubt.
+
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SymbolKind, TemplateRecord, is_anonymous_type_name};
+use cruxe_indexer::go_template::{self, ELEMENT};
+use cruxe_state::{go_templates, injections, symbols};
+use regex::Regex;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::sync::LazyLock;
+
+static EXECUTE_TEMPLATE: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r#"\.ExecuteTemplate\(\s*[^,()]+,\s*"([^"]+)"\s*,\s*(&?[\w.]+)\s*([{)])"#)
+        .expect("valid regex")
+});
+static EXECUTE: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"(\w+)\.Execute\(\s*[^,()]+,\s*(&?[\w.]+)\s*([{)])").expect("valid regex")
+});
+/// Template a receiver was created from: `New("x")`, `Lookup("x")` or the
+/// first file of `ParseFiles`.
+static TEMPLATE_NAME: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r#"(?:New|Lookup)\(\s*"([^"]+)"\s*\)|ParseFiles\(\s*"([^"]+)""#)
+        .expect("valid regex")
+});
+/// `Name Type` or `A, B Type` inside a struct body.
+static FIELD: LazyLock<Regex> = LazyLock::new(|| {
+    Regex::new(r"^([A-Za-z_]\w*(?:\s*,\s*[A-Za-z_]\w*)*)\s+(.+)$").expect("valid regex")
+});
+/// Embedded field: `Type`, `*Type` or `pkg.Type`.
+static EMBEDDED: LazyLock<Regex> =
+    LazyLock::new(|| Regex::new(r"^\*?[A-Za-z_][\w.]*(?:\[.*\])?$").expect("valid regex"));
+
+/// A Go `Execute`/`ExecuteTemplate` call with a traceable data type.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ExecuteSite {
+    pub template: String,
+    pub data_type: String,
+    pub path: String,
+    pub line: u32,
+    /// Qualified name of the calling function or method.
+    pub symbol: String,
+    pub symbol_id: String,
+}
+
+/// A field a template reads that its data does not have.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct TemplateIssue {
+    pub template: String,
+    pub path: String,
+    pub line: u32,
+    /// The chain up to the missing step, e.g. `.User.Nmae`.
+    pub reference: String,
+    pub message: String,
+    pub site: ExecuteSite,
+}
+
+#[derive(Debug, Default)]
+struct GoStruct {
+    /// Named fields and their declared types.
+    fields: Vec<(String, String)>,
+    /// Types of embedded fields, as written.
+    embedded: Vec<String>,
+}
+
+/// Templates, execute sites and struct definitions of one repo/ref.
+pub struct TemplateIndex {
+    pub templates: Vec<TemplateRecord>,
+    pub sites: Vec<ExecuteSite>,
+    /// Named structs by name, anonymous ones by qualified name.
+    structs: HashMap<String, GoStruct>,
+    /// Anonymous structs by where they are declared (`render.data`,
+    /// `Page.Meta`): line and qualified name.
+    anonymous: HashMap<String, Vec<(u32, String)>>,
+    /// Where each anonymous struct is declared, by qualified name.
+    declared_at: HashMap<String, String>,
+    /// `Type.Method` of every Go method.
+    methods: HashSet<String>,
+}
+
+/// Result of walking a field chain from a data type.
+enum Walk {
+    /// Every step resolved; the chain's type as written.
+    Type(String),
+    /// A step could not be resolved without type information.
+    Unknown,
+    /// Step `index` is not readable on struct `owner`.
+    Problem {
+        index: usize,
+        owner: String,
+        unexported: bool,
+    },
+}
+
+/// The data argument of an execute call.
+enum Data {
+    Named(String),
+    /// An anonymous struct declared for the variable or, without one, in
+    /// the call itself.
+    Anonymous {
+        variable: Option<String>,
+    },
+}
+
+enum Lookup {
+    Field(String),
+    Method,
+    Unexported,
+    Missing,
+    Unknown,
+}
+
+/// Load the templates of a repo/ref and find their execute sites.
+pub fn load(conn: &Connection, repo: &str, ref_name: &str) -> Result<TemplateIndex, StateError> {
+    let mut templates = go_templates::list_templates(conn, repo, ref_name)?;
+    for injection in injections::list_injections(conn, repo, ref_name, Some("html"))? {
+        let Some(host) = injection.host.as_deref() else {
+            continue;
+        };
+        if !host.ends_with(".Parse") {
+            continue;
+        }
+        let Some(name) = TEMPLATE_NAME
+            .captures(host)
+            .and_then(|captures| captures.get(1))
+        else {
+            continue;
+        };
+        templates.extend(go_template::parse_template(
+            repo,
+            ref_name,
+            &injection.path,
+            name.as_str(),
+            "inline",
+            &injection.content,
+            injection.line,
+        ));
+    }
+
+    let mut structs: HashMap<String, GoStruct> = HashMap::new();
+    let mut anonymous: HashMap<String, Vec<(u32, String)>> = HashMap::new();
+    let mut declared_at = HashMap::new();
+    symbols::for_each_struct_body(conn, repo, ref_name, "go", |symbol| {
+        if let Some(content) = symbol.content.as_deref() {
+            let parsed = parse_struct(content);
+            let key = if is_anonymous_type_name(&symbol.name) {
+                let owner = symbol
+                    .qualified_name
+                    .strip_suffix(symbol.name.as_str())
+                    .and_then(|owner| owner.strip_suffix('.'))
+                    .unwrap_or_default()
+                    .to_string();
+                anonymous
+                    .entry(owner.clone())
+                    .or_default()
+                    .push((symbol.line_start, symbol.qualified_name.clone()));
+                declared_at.insert(symbol.qualified_name.clone(), owner);
+                symbol.qualified_name
+            } else {
+                symbol.name
+            };
+            let entry = structs.entry(key).or_default();
+            entry.fields.extend(parsed.fields);
+            entry.embedded.extend(parsed.embedded);
+        }
+        Ok(())
+    })?;
+
+    let mut methods = HashSet::new();
+    let mut sites = Vec::new();
+    symbols::for_each_function_body(conn, repo, ref_name, "go", |symbol| {
+        if symbol.kind == SymbolKind::Method {
+            methods.insert(symbol.qualified_name.clone());
+        }
+        let Some(content) = symbol.content.as_deref() else {
+            return Ok(());
+        };
+        for (offset, template, data) in execute_calls(content) {
+            let line = symbol.line_start + content[..offset].matches('\n').count() as u32;
+            let data_type = match data {
+                Data::Named(name) => name,
+                Data::Anonymous { variable } => {
+                    let owner = match &variable {
+                        Some(variable) => format!("{}.{variable}", symbol.qualified_name),
+                        None => symbol.qualified_name.clone(),
+                    };
+                    let declared = anonymous.get(&owner).into_iter().flatten();
+                    // A literal argument is the first anonymous struct from
+                    // the call on.
+                    let found = match variable {
+                        Some(_) => declared.min(),
+                        None => declared.filter(|(at, _)| *at >= line).min(),
+                    };
+                    match found {
+                        Some((_, key)) => key.clone(),
+                        None => continue,
+                    }
+                }
+            };
+            if !structs.contains_key(&data_type) {
+                continue;
+            }
+            sites.push(ExecuteSite {
+                template,
+                data_type,
+                path: symbol.path.clone(),
+                line,
+                symbol: symbol.qualified_name.clone(),
+                symbol_id: symbol.symbol_stable_id.clone(),
+            });
+        }
+        Ok(())
+    })?;
+
+    Ok(TemplateIndex {
+        templates,
+        sites,
+        structs,
+        anonymous,
+        declared_at,
+        methods,
+    })
+}
+
+impl TemplateIndex {
+    /// Fields read by templates that the data they are executed with does
+    /// not have, following `{{template "x" .Field}}` into callees. Ordered
+    /// by path and line.
+    pub fn check(&self) -> Vec<TemplateIssue> {
+        let mut by_name: HashMap<&str, Vec<&TemplateRecord>> = HashMap::new();
+        for template in &self.templates {
+            by_name
+                .entry(template.name.as_str())
+                .or_default()
+                .push(template);
+        }
+
+        let mut queue: VecDeque<(String, String, &ExecuteSite)> = self
+            .sites
+            .iter()
+            .map(|site| (site.template.clone(), site.data_type.clone(), site))
+            .collect();
+        let mut seen = HashSet::new();
+        let mut reported = HashSet::new();
+        let mut issues = Vec::new();
+        while let Some((name, data_type, site)) = queue.pop_front() {
+            if !seen.insert((name.clone(), data_type.clone())) {
+                continue;
+            }
+            for template in by_name.get(name.as_str()).into_iter().flatten() {
+                for field in &template.fields {
+                    let Walk::Problem {
+                        index,
+                        owner,
+                        unexported,
+                    } = self.walk(&data_type, &field.chain)
+                    else {
+                        continue;
+                    };
+                    let reference = render_chain(&field.chain[..=index]);
+                    if !reported.insert((template.path.clone(), field.line, reference.clone())) {
+                        continue;
+                    }
+                    let step = &field.chain[index];
+                    let problem = if unexported {
+                        format!("field `{step}` of `{owner}` is unexported")
+                    } else {
+                        format!("`{owner}` has no field or method `{step}`")
+                    };
+                    issues.push(TemplateIssue {
+                        template: template.name.clone(),
+                        path: template.path.clone(),
+                        line: field.line,
+                        message: format!(
+                            "`{reference}`: {problem} (data `{data_type}` from {}:{})",
+                            site.path, site.line
+                        ),
+                        reference,
+                        site: site.clone(),
+                    });
+                }
+                for call in &template.calls {
+                    let Some(arg) = &call.arg else {
+                        continue;
+                    };
+                    if let Walk::Type(ty) = self.walk(&data_type, arg)
+                        && let Some(callee_type) = self.struct_name(&ty)
+                        && self.structs.contains_key(callee_type)
+                    {
+                        queue.push_back((call.name.clone(), callee_type.to_string(), site));
+                    }
+                }
+            }
+        }
+        issues.sort_by(|a, b| {
+            (a.path.as_str(), a.line, a.reference.as_str()).cmp(&(
+                b.path.as_str(),
+                b.line,
+                b.reference.as_str(),
+            ))
+        });
+        issues
+    }
+
+    fn walk(&self, root: &str, chain: &[String]) -> Walk {
+        let mut current = root.to_string();
+        for (index, step) in chain.iter().enumerate() {
+            if step == ELEMENT {
+                match element_type(&current) {
+                    Some(element) => current = element.to_string(),
+                    None => return Walk::Unknown,
+                }
+                continue;
+            }
+            let Some(owner) = self.struct_name(&current) else {
+                return Walk::Unknown;
+            };
+            match self.lookup(owner, step, 0) {
+                Lookup::Field(ty) => current = ty,
+                Lookup::Method | Lookup::Unknown => return Walk::Unknown,
+                lookup @ (Lookup::Unexported | Lookup::Missing) => {
+                    return Walk::Problem {
+                        index,
+                        owner: owner.to_string(),
+                        unexported: matches!(lookup, Lookup::Unexported),
+                    };
+                }
+            }
+        }
+        Walk::Type(current)
+    }
+
+    fn lookup(&self, owner: &str, name: &str, depth: usize) -> Lookup {
+        let Some(definition) = self.structs.get(owner) else {
+            return Lookup::Unknown;
+        };
+        if self.methods.contains(&format!("{owner}.{name}")) {
+            return Lookup::Method;
+        }
+        if let Some((_, ty)) = definition.fields.iter().find(|(field, _)| field == name) {
+            if name.starts_with(|c: char| c.is_lowercase() || c == '_') {
+                return Lookup::Unexported;
+            }
+            return Lookup::Field(self.field_type(owner, name, ty));
+        }
+        let mut unknown = false;
+        for embedded in &definition.embedded {
+            let Some(embedded_name) = named_type(embedded) else {
+                unknown = true;
+                continue;
+            };
+            if embedded_name == name {
+                return Lookup::Field(embedded.clone());
+            }
+            if depth >= 8 {
+                unknown = true;
+                continue;
+            }
+            match self.lookup(embedded_name, name, depth + 1) {
+                Lookup::Missing => {}
+                Lookup::Unknown => unknown = true,
+                found => return found,
+            }
+        }
+        if unknown {
+            Lookup::Unknown
+        } else {
+            Lookup::Missing
+        }
+    }
+
+    /// The struct `ty` is: an indexed anonymous struct or a named type.
+    fn struct_name<'t>(&self, ty: &'t str) -> Option<&'t str> {
+        let ty = ty.trim().trim_start_matches('*');
+        if self.structs.contains_key(ty) {
+            Some(ty)
+        } else {
+            named_type(ty)
+        }
+    }
+
+    /// `ty` of field `field` of `owner`, with an anonymous struct type
+    /// (`struct {`, `[]struct{ ID int }`) replaced by its qualified name.
+    fn field_type(&self, owner: &str, field: &str, ty: &str) -> String {
+        let Some(at) = ty.find("struct") else {
+            return ty.to_string();
+        };
+        let (prefix, rest) = ty.split_at(at);
+        if !prefix
+            .chars()
+            .all(|c| matches!(c, '[' | ']' | '*') || c.is_ascii_digit())
+            || !rest["struct".len()..].trim_start().starts_with('{')
+        {
+            return ty.to_string();
+        }
+        let base = self.declared_at.get(owner).map_or(owner, String::as_str);
+        match self
+            .anonymous
+            .get(&format!("{base}.{field}"))
+            .and_then(|declared| declared.iter().min())
+        {
+            Some((_, key)) => format!("{prefix}{key}"),
+            None => ty.to_string(),
+        }
+    }
+}
+
+/// `.A.B` form of a chain; element steps render as `[]`.
+fn render_chain(chain: &[String]) -> String {
+    let mut out = String::new();
+    for step in chain {
+        if step != ELEMENT {
+            out.push('.');
+        }
+        out.push_str(step);
+    }
+    out
+}
+
+/// Name of a (possibly pointer, package-qualified or generic) named type;
+/// `None` for slices, maps, channels, functions and literal types.
+fn named_type(ty: &str) -> Option<&str> {
+    let ty = ty.trim().trim_start_matches('*');
+    if !ty.starts_with(|c: char| c.is_alphabetic() || c == '_')
+        || ty.starts_with("map[")
+        || ty.starts_with("chan ")
+        || ty.starts_with("func(")
+        || ty.starts_with("struct")
+        || ty.starts_with("interface")
+    {
+        return None;
+    }
+    let ty = ty.split('[').next().unwrap_or(ty);
+    let name = ty.rsplit('.').next().unwrap_or(ty);
+    (!name.is_empty() && name.chars().all(|c| c.is_alphanumeric() || c == '_')).then_some(name)
+}
+
+/// Element type of a slice, array or map (`[]T`, `[N]T`, `map[K]V`).
+fn element_type(ty: &str) -> Option<&str> {
+    let ty = ty.trim().trim_start_matches('*');
+    let rest = ty.strip_prefix("map[").or_else(|| ty.strip_prefix('['))?;
+    let mut depth = 1;
+    for (at, c) in rest.char_indices() {
+        match c {
+            '[' => depth += 1,
+            ']' => {
+                depth -= 1;
+                if depth == 0 {
+                    return Some(rest[at + 1..].trim());
+                }
+            }
+            _ => {}
+        }
+    }
+    None
+}
+
+/// Fields of a Go struct definition.
+fn parse_struct(content: &str) -> GoStruct {
+    let mut parsed = GoStruct::default();
+    let Some(open) = content.find('{') else {
+        return parsed;
+    };
+    let body = &content[open + 1..content.rfind('}').unwrap_or(content.len())];
+    let mut nested = 0usize;
+    for line in body.lines() {
+        let line = line.split("//").next().unwrap_or_default();
+        // Struct tags never affect the field's name or type.
+        let line: String = line.split('`').step_by(2).collect();
+        let line = line.trim();
+        let opens = line.matches('{').count();
+        let closes = line.matches('}').count();
+        if nested > 0 {
+            nested = (nested + opens).saturating_sub(closes);
+            continue;
+        }
+        if line.is_empty() {
+            continue;
+        }
+        nested = opens.saturating_sub(closes);
+        // `struct{ A int; B string }` declares its fields on one line.
+        for member in split_members(line) {
+            if EMBEDDED.is_match(member) {
+                parsed.embedded.push(member.to_string());
+            } else if let Some(captures) = FIELD.captures(member) {
+                let ty = captures[2].trim();
+                for name in captures[1].split(',') {
+                    parsed
+                        .fields
+                        .push((name.trim().to_string(), ty.to_string()));
+                }
+            }
+        }
+    }
+    parsed
+}
+
+/// The `;`-separated parts of a line outside braces, trimmed.
+fn split_members(line: &str) -> Vec<&str> {
+    let mut members = Vec::new();
+    let mut depth = 0usize;
+    let mut start = 0;
+    for (at, c) in line.char_indices() {
+        match c {
+            '{' | '(' | '[' => depth += 1,
+            '}' | ')' | ']' => depth = depth.saturating_sub(1),
+            ';' if depth == 0 => {
+                members.push(line[start..at].trim());
+                start = at + 1;
+            }
+            _ => {}
+        }
+    }
+    members.push(line[start..].trim());
+    members.retain(|member| !member.is_empty());
+    members
+}
+
+/// `(offset, template name, data)` of the execute calls in a function body
+/// whose template and data type can be traced within the body.
+fn execute_calls(content: &str) -> Vec<(usize, String, Data)> {
+    let mut calls = Vec::new();
+    for captures in EXECUTE_TEMPLATE.captures_iter(content) {
+        let whole = captures.get(0).expect("match");
+        if let Some(data_type) = data_type(content, &captures[2], &captures[3]) {
+            calls.push((whole.start(), captures[1].to_string(), data_type));
+        }
+    }
+    for captures in EXECUTE.captures_iter(content) {
+        let whole = captures.get(0).expect("match");
+        let Some(template) = receiver_template(content, &captures[1]) else {
+            continue;
+        };
+        if let Some(data_type) = data_type(content, &captures[2], &captures[3]) {
+            calls.push((whole.start(), template, data_type));
+        }
+    }
+    calls.sort_by_key(|(offset, _, _)| *offset);
+    calls
+}
+
+/// Template a receiver variable was assigned from in the body.
+fn receiver_template(content: &str, receiver: &str) -> Option<String> {
+    let assignment = Regex::new(&format!(r"\b{}\s*:?=\s*(.*)", regex::escape(receiver))).ok()?;
+    let source = assignment
+        .captures(content)
+        .and_then(|captures| captures.get(1))
+        .map_or(content, |value| value.as_str());
+    let captures = TEMPLATE_NAME.captures(source)?;
+    if let Some(name) = captures.get(1) {
+        return Some(name.as_str().to_string());
+    }
+    let file = captures.get(2)?.as_str();
+    Some(file.rsplit(['/', '\\']).next().unwrap_or(file).to_string())
+}
+
+/// Struct of the data argument: a composite literal, or a variable declared
+/// by composite literal, `var` or parameter.
+fn data_type(content: &str, argument: &str, follows: &str) -> Option<Data> {
+    let argument = argument.trim_start_matches('&');
+    if follows == "{" {
+        if argument == "struct" {
+            return Some(Data::Anonymous { variable: None });
+        }
+        return named_type(argument).map(|name| Data::Named(name.to_string()));
+    }
+    if argument.contains('.') || argument == "nil" {
+        return None;
+    }
+    let variable = regex::escape(argument);
+    let header = content.find('{').map_or(content, |at| &content[..at]);
+    let patterns = [
+        (format!(r"\b{variable}\s*:?=\s*&?([\w.]+)\s*\{{"), content),
+        (format!(r"\bvar\s+{variable}\s+\*?([\w.]+)"), content),
+        (format!(r"\b{variable}\s+\*?([\w.]+)"), header),
+    ];
+    for (pattern, haystack) in patterns {
+        let Ok(pattern) = Regex::new(&pattern) else {
+            continue;
+        };
+        if let Some(captures) = pattern.captures(haystack) {
+            if &captures[1] == "struct" {
+                return Some(Data::Anonymous {
+                    variable: Some(argument.to_string()),
+                });
+            }
+            return named_type(&captures[1]).map(|name| Data::Named(name.to_string()));
+        }
+    }
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::SymbolRecord;
+    use cruxe_state::{db, schema};
+
+    fn symbol(name: &str, kind: SymbolKind, line: u32, content: &str) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "web/handlers.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.rsplit('.').next().unwrap_or(name).to_string(),
+            qualified_name: name.to_string(),
+            kind,
+            signature: None,
+            line_start: line,
+            line_end: line + content.matches('\n').count() as u32,
+            parent_symbol_id: None,
+            visibility: None,
+            content: Some(content.to_string()),
+        }
+    }
+
+    #[test]
+    fn struct_fields_and_type_shapes_are_parsed() {
+        let parsed = parse_struct(
+            "type Page struct {\n\tTitle, Sub string `json:\"t\"`\n\t*Base\n\tmeta struct {\n\t\tX int\n\t}\n\tItems []*Item // rows\n\tsync.Mutex\n}",
+        );
+        let names: Vec<&str> = parsed
+            .fields
+            .iter()
+            .map(|(name, _)| name.as_str())
+            .collect();
+        assert_eq!(names, ["Title", "Sub", "meta", "Items"]);
+        assert_eq!(parsed.embedded, ["*Base", "sync.Mutex"]);
+
+        assert_eq!(named_type("*pkg.User"), Some("User"));
+        assert_eq!(named_type("List[T]"), Some("List"));
+        assert_eq!(named_type("[]Item"), None);
+        assert_eq!(element_type("[]*Item"), Some("*Item"));
+        assert_eq!(element_type("map[string][]Tag"), Some("[]Tag"));
+        assert_eq!(element_type("[4]Item"), Some("Item"));
+        assert_eq!(element_type("Item"), None);
+    }
+
+    #[test]
+    fn unknown_fields_are_reported_through_nested_templates() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            symbol(
+                "Page",
+                SymbolKind::Struct,
+                1,
+                "type Page struct {\n\tTitle string\n\tUser *User\n\tItems []Item\n\tmeta string\n\tExtra map[string]string\n}",
+            ),
+            symbol(
+                "User",
+                SymbolKind::Struct,
+                9,
+                "type User struct {\n\tBase\n\tName string\n}",
+            ),
+            symbol(
+                "Base",
+                SymbolKind::Struct,
+                13,
+                "type Base struct {\n\tID int\n}",
+            ),
+            symbol(
+                "Item",
+                SymbolKind::Struct,
+                16,
+                "type Item struct {\n\tLabel string\n}",
+            ),
+            symbol(
+                "User.Display",
+                SymbolKind::Method,
+                19,
+                "func (u *User) Display() string {\n\treturn u.Name\n}",
+            ),
+            symbol(
+                "render",
+                SymbolKind::Function,
+                30,
+                "func render(w io.Writer, p *Page) error {\n\tt := template.Must(template.ParseFiles(\"web/page.gohtml\"))\n\treturn t.Execute(w, p)\n}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        let source = "{{.Title}} {{.Titel}} {{.meta}} {{.Extra.anything}}\n\
+                      {{with .User}}{{.Name}} {{.ID}} {{.Display}} {{.Nmae}}{{end}}\n\
+                      {{range .Items}}{{template \"item\" .}}{{end}}\n\
+                      {{define \"item\"}}{{.Label}} {{.Lable}}{{end}}";
+        let records = go_template::parse_template(
+            "repo",
+            "main",
+            "web/page.gohtml",
+            "page.gohtml",
+            "file",
+            source,
+            1,
+        );
+        go_templates::replace_for_ref(&conn, "repo", "main", &records).unwrap();
+
+        let index = load(&conn, "repo", "main").unwrap();
+        assert_eq!(index.sites.len(), 1);
+        assert_eq!(index.sites[0].template, "page.gohtml");
+        assert_eq!(index.sites[0].data_type, "Page");
+        assert_eq!(index.sites[0].line, 32);
+
+        let issues = index.check();
+        let found: Vec<(u32, &str)> = issues
+            .iter()
+            .map(|issue| (issue.line, issue.reference.as_str()))
+            .collect();
+        assert_eq!(
+            found,
+            [
+                (1, ".Titel"),
+                (1, ".meta"),
+                (2, ".User.Nmae"),
+                (4, ".Lable")
+            ]
+        );
+        assert_eq!(
+            issues[0].message,
+            "`.Titel`: `Page` has no field or method `Titel` (data `Page` from web/handlers.go:32)"
+        );
+        assert_eq!(
+            issues[1].message,
+            "`.meta`: field `meta` of `Page` is unexported (data `Page` from web/handlers.go:32)"
+        );
+        assert_eq!(issues[3].template, "item");
+    }
+
+    #[test]
+    fn anonymous_structs_are_followed_as_data_and_field_types() {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            symbol(
+                "Page",
+                SymbolKind::Struct,
+                1,
+                "type Page struct {\n\tMeta struct {\n\t\tAuthor string\n\t}\n}",
+            ),
+            symbol(
+                "Page.Meta.struct{Author}",
+                SymbolKind::Struct,
+                2,
+                "struct {\n\t\tAuthor string\n\t}",
+            ),
+            symbol(
+                "render",
+                SymbolKind::Function,
+                10,
+                "func render(w io.Writer) error {\n\tt := template.Must(template.ParseFiles(\"web/page.gohtml\"))\n\tdata := struct {\n\t\tTitle string\n\t\tPage  *Page\n\t}{Title: \"home\"}\n\treturn t.Execute(w, data)\n}",
+            ),
+            symbol(
+                "render.data.struct{Title,Page}",
+                SymbolKind::Struct,
+                12,
+                "struct {\n\t\tTitle string\n\t\tPage  *Page\n\t}",
+            ),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        let records = go_template::parse_template(
+            "repo",
+            "main",
+            "web/page.gohtml",
+            "page.gohtml",
+            "file",
+            "{{.Title}} {{.Titel}} {{.Page.Meta.Author}} {{.Page.Meta.Autor}}",
+            1,
+        );
+        go_templates::replace_for_ref(&conn, "repo", "main", &records).unwrap();
+
+        let index = load(&conn, "repo", "main").unwrap();
+        assert_eq!(index.sites.len(), 1);
+        assert_eq!(index.sites[0].data_type, "render.data.struct{Title,Page}");
+        assert_eq!(index.sites[0].line, 16);
+
+        let issues = index.check();
+        let found: Vec<&str> = issues
+            .iter()
+            .map(|issue| issue.reference.as_str())
+            .collect();
+        assert_eq!(found, [".Page.Meta.Autor", ".Titel"]);
+        assert!(
+            issues[0]
+                .message
+                .contains("`Page.Meta.struct{Author}` has no field or method `Autor`")
+        );
+
+        let parsed =
+            parse_struct("struct{ Title string `json:\"t\"`; Tags []struct{ A int; B int } }");
+        let names: Vec<&str> = parsed
+            .fields
+            .iter()
+            .map(|(name, _)| name.as_str())
+            .collect();
+        assert_eq!(names, ["Title", "Tags"]);
+    }
+}
@@ -0,0 +1,475 @@
+//! The tests that exercise a symbol, for `cruxe tests-for`: test functions
+//! that reach it through the reverse call graph and, when per-test Go cover
+//! profiles are supplied, tests whose profile covers its lines.
+
+use crate::call_graph::{self, CallGraphSymbol};
+use crate::impact::is_test_symbol;
+use cruxe_core::error::StateError;
+use cruxe_core::types::SymbolRecord;
+use cruxe_state::symbols;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+
+#[derive(Debug, thiserror::Error)]
+pub enum TestMapError {
+    #[error("symbol not found")]
+    SymbolNotFound,
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(
+    Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize, JsonSchema,
+)]
+#[serde(rename_all = "snake_case")]
+pub enum TestEvidence {
+    /// The test calls the symbol, directly or through other functions.
+    CallGraph,
+    /// The test's cover profile executed the symbol's lines.
+    Coverage,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct CoveringTest {
+    pub test: CallGraphSymbol,
+    /// Call distance from the test to the symbol; 0 when only coverage
+    /// links them.
+    pub depth: u32,
+    pub evidence: Vec<TestEvidence>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq, JsonSchema)]
+pub struct TestsFor {
+    pub symbol: CallGraphSymbol,
+    pub tests: Vec<CoveringTest>,
+    pub test_files: Vec<String>,
+    /// Commands that run exactly these tests: one `go test` per Go package,
+    /// one `pytest` or `cargo test` per test elsewhere.
+    pub run: Vec<String>,
+    /// Cover profiles that hit the symbol but name a test that is not indexed.
+    pub unindexed_tests: Vec<String>,
+    pub truncated: bool,
+    pub depth_applied: u32,
+}
+
+/// One covered block of a Go cover profile.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CoverBlock {
+    /// As written in the profile, usually `module/path/file.go`.
+    pub file: String,
+    pub start_line: u32,
+    pub end_line: u32,
+}
+
+/// The blocks a single test executed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CoverageProfile {
+    pub test: String,
+    pub blocks: Vec<CoverBlock>,
+}
+
+impl CoverageProfile {
+    /// Parse a Go cover profile (`go test -coverprofile`) recorded for
+    /// `test` alone, keeping blocks that ran at least once.
+    pub fn parse_go(test: &str, text: &str) -> Self {
+        let blocks = text
+            .lines()
+            .filter(|line| !line.starts_with("mode:"))
+            .filter_map(|line| {
+                // file.go:12.34,15.2 3 1
+                let (file, rest) = line.rsplit_once(':')?;
+                let mut fields = rest.split_whitespace();
+                let (start, end) = fields.next()?.split_once(',')?;
+                let count: u64 = fields.nth(1)?.parse().ok()?;
+                let line_of =
+                    |position: &str| -> Option<u32> { position.split('.').next()?.parse().ok() };
+                (count > 0).then_some(CoverBlock {
+                    file: file.to_string(),
+                    start_line: line_of(start)?,
+                    end_line: line_of(end)?,
+                })
+            })
+            .collect();
+        Self {
+            test: test.to_string(),
+            blocks,
+        }
+    }
+
+    /// Whether a block of workspace-relative `path` overlaps the lines.
+    fn covers(&self, path: &str, line_start: u32, line_end: u32) -> bool {
+        self.blocks.iter().any(|block| {
+            (block.file == path || block.file.ends_with(&format!("/{path}")))
+                && block.start_line <= line_end
+                && line_start <= block.end_line
+        })
+    }
+}
+
+#[derive(Debug, Clone)]
+pub struct TestsForRequest<'a> {
+    /// Name, qualified name, or Go-style `package.Name`.
+    pub symbol: &'a str,
+    pub path: Option<&'a str>,
+    pub depth: u32,
+    /// Cap on callers walked.
+    pub limit: usize,
+    pub coverage: &'a [CoverageProfile],
+}
+
+/// Every test that exercises `request.symbol`, nearest first.
+pub fn tests_for(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    request: &TestsForRequest<'_>,
+) -> Result<TestsFor, TestMapError> {
+    let root = resolve_symbol(conn, repo, ref_name, request.symbol, request.path)?;
+    let (callers, truncated) = call_graph::transitive_callers(
+        conn,
+        repo,
+        ref_name,
+        &root.symbol_stable_id,
+        request.depth,
+        request.limit.max(1),
+    )?;
+
+    let mut tests: HashMap<String, CoveringTest> = HashMap::new();
+    for caller in callers {
+        if !is_test_symbol(&caller.symbol) {
+            continue;
+        }
+        let entry = tests
+            .entry(caller.symbol.symbol_stable_id.clone())
+            .or_insert_with(|| CoveringTest {
+                test: caller.symbol,
+                depth: caller.depth,
+                evidence: vec![TestEvidence::CallGraph],
+            });
+        entry.depth = entry.depth.min(caller.depth);
+    }
+
+    let mut unindexed_tests = Vec::new();
+    for profile in request.coverage {
+        if !profile.covers(&root.path, root.line_start, root.line_end) {
+            continue;
+        }
+        let Some(test) = find_test(conn, repo, ref_name, &profile.test)? else {
+            unindexed_tests.push(profile.test.clone());
+            continue;
+        };
+        let entry = tests
+            .entry(test.symbol_stable_id.clone())
+            .or_insert_with(|| CoveringTest {
+                test,
+                depth: 0,
+                evidence: Vec::new(),
+            });
+        if !entry.evidence.contains(&TestEvidence::Coverage) {
+            entry.evidence.push(TestEvidence::Coverage);
+        }
+    }
+
+    let mut tests: Vec<CoveringTest> = tests.into_values().collect();
+    tests.sort_by(|left, right| {
+        (left.depth == 0)
+            .cmp(&(right.depth == 0))
+            .then_with(|| left.depth.cmp(&right.depth))
+            .then_with(|| left.test.path.cmp(&right.test.path))
+            .then_with(|| left.test.line_start.cmp(&right.test.line_start))
+    });
+    let test_files: BTreeSet<String> = tests.iter().map(|found| found.test.path.clone()).collect();
+    Ok(TestsFor {
+        symbol: call_graph::to_call_graph_symbol(&root),
+        run: run_commands(&tests),
+        test_files: test_files.into_iter().collect(),
+        tests,
+        unindexed_tests,
+        truncated,
+        depth_applied: call_graph::clamp_depth(request.depth),
+    })
+}
+
+/// Like `cruxe callers`, plus `handlers.HandleRequest`: a Go package name
+/// (the last directory of the path) before a name or qualified name.
+fn resolve_symbol(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    symbol: &str,
+    path: Option<&str>,
+) -> Result<SymbolRecord, TestMapError> {
+    if let Some(found) = call_graph::resolve_root_symbol(conn, repo, ref_name, symbol, path)? {
+        return Ok(found);
+    }
+    let Some((package, rest)) = symbol.split_once('.') else {
+        return Err(TestMapError::SymbolNotFound);
+    };
+    let name = rest.rsplit('.').next().unwrap_or(rest);
+    symbols::find_symbols_by_name(conn, repo, ref_name, name, path)?
+        .into_iter()
+        .filter(|candidate| {
+            candidate.qualified_name == rest
+                && candidate
+                    .path
+                    .rsplit('/')
+                    .nth(1)
+                    .is_some_and(|dir| dir == package)
+        })
+        .min_by(|left, right| (&left.path, left.line_start).cmp(&(&right.path, right.line_start)))
+        .ok_or(TestMapError::SymbolNotFound)
+}
+
+/// The indexed test function a cover profile was recorded for.
+fn find_test(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    name: &str,
+) -> Result<Option<CallGraphSymbol>, StateError> {
+    Ok(
+        symbols::find_symbols_by_name(conn, repo, ref_name, name, None)?
+            .iter()
+            .map(call_graph::to_call_graph_symbol)
+            .find(is_test_symbol),
+    )
+}
+
+fn run_commands(tests: &[CoveringTest]) -> Vec<String> {
+    // Package directory -> (tests, benchmarks)
+    let mut go: BTreeMap<&str, (Vec<&str>, Vec<&str>)> = BTreeMap::new();
+    let mut commands = Vec::new();
+    for found in tests {
+        let test = &found.test;
+        if test.path.ends_with("_test.go") {
+            let dir = test.path.rsplit_once('/').map_or("", |(dir, _)| dir);
+            let (runs, benches) = go.entry(dir).or_default();
+            if test.name.starts_with("Benchmark") {
+                benches.push(&test.name);
+            } else {
+                runs.push(&test.name);
+            }
+        } else if test.path.ends_with(".py") {
+            commands.push(format!(
+                "pytest {}::{}",
+                test.path,
+                test.qualified_name.replace('.', "::")
+            ));
+        } else if test.path.ends_with(".rs") {
+            commands.push(format!("cargo test {}", test.qualified_name));
+        }
+    }
+
+    let mut go_commands = Vec::new();
+    for (dir, (runs, benches)) in go {
+        let package = if dir.is_empty() {
+            ".".to_string()
+        } else {
+            format!("./{dir}")
+        };
+        if !runs.is_empty() {
+            go_commands.push(format!("go test {package} -run '^({})$'", runs.join("|")));
+        }
+        if !benches.is_empty() {
+            go_commands.push(format!(
+                "go test {package} -run '^$' -bench '^({})$'",
+                benches.join("|")
+            ));
+        }
+    }
+    go_commands.extend(commands);
+    go_commands
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{CallEdge, SymbolKind};
+    use cruxe_state::{db, edges, schema};
+
+    fn symbol(stable: &str, name: &str, path: &str, lines: (u32, u32)) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: path.to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{stable}"),
+            symbol_stable_id: stable.to_string(),
+            name: name.to_string(),
+            qualified_name: name.to_string(),
+            kind: SymbolKind::Function,
+            signature: None,
+            line_start: lines.0,
+            line_end: lines.1,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn call(from: &str, to: &str, file: &str, line: u32) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: from.to_string(),
+            to_symbol_id: Some(to.to_string()),
+            to_name: None,
+            edge_type: "calls".to_string(),
+            confidence: "static".to_string(),
+            source_file: file.to_string(),
+            source_line: line,
+        }
+    }
+
+    fn setup() -> (tempfile::TempDir, Connection) {
+        let tmp = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        for record in [
+            symbol(
+                "handle",
+                "HandleRequest",
+                "pkg/handlers/handle.go",
+                (10, 30),
+            ),
+            symbol("route", "Route", "pkg/server/route.go", (5, 15)),
+            symbol(
+                "test-handle",
+                "TestHandleRequest",
+                "pkg/handlers/handle_test.go",
+                (1, 9),
+            ),
+            symbol(
+                "test-route",
+                "TestRoute",
+                "pkg/server/route_test.go",
+                (1, 9),
+            ),
+            symbol(
+                "bench-route",
+                "BenchmarkRoute",
+                "pkg/server/route_test.go",
+                (11, 19),
+            ),
+            symbol("test-e2e", "TestEndToEnd", "e2e/e2e_test.go", (1, 40)),
+        ] {
+            symbols::insert_symbol(&conn, &record).unwrap();
+        }
+        edges::insert_call_edges(
+            &conn,
+            "repo",
+            "main",
+            &[
+                call("test-handle", "handle", "pkg/handlers/handle_test.go", 4),
+                call("route", "handle", "pkg/server/route.go", 8),
+                call("test-route", "route", "pkg/server/route_test.go", 3),
+                call("bench-route", "route", "pkg/server/route_test.go", 14),
+            ],
+        )
+        .unwrap();
+        (tmp, conn)
+    }
+
+    #[test]
+    fn finds_tests_through_the_call_graph_and_cover_profiles() {
+        let (_tmp, conn) = setup();
+        let coverage = [
+            CoverageProfile::parse_go(
+                "TestEndToEnd",
+                "mode: set\nexample.com/app/pkg/handlers/handle.go:12.2,14.16 2 1\nexample.com/app/pkg/handlers/handle.go:40.2,41.3 1 0\n",
+            ),
+            // Ran, but never reached the handler.
+            CoverageProfile::parse_go(
+                "TestRoute",
+                "mode: set\nexample.com/app/pkg/handlers/handle.go:12.2,14.16 2 0\n",
+            ),
+            CoverageProfile::parse_go(
+                "TestGone",
+                "mode: set\nexample.com/app/pkg/handlers/handle.go:20.2,21.3 1 4\n",
+            ),
+        ];
+        let report = tests_for(
+            &conn,
+            "repo",
+            "main",
+            &TestsForRequest {
+                symbol: "handlers.HandleRequest",
+                path: None,
+                depth: 5,
+                limit: 100,
+                coverage: &coverage,
+            },
+        )
+        .unwrap();
+
+        assert_eq!(report.symbol.name, "HandleRequest");
+        let found: Vec<(&str, u32, &[TestEvidence])> = report
+            .tests
+            .iter()
+            .map(|found| {
+                (
+                    found.test.name.as_str(),
+                    found.depth,
+                    found.evidence.as_slice(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            found,
+            [
+                ("TestHandleRequest", 1, &[TestEvidence::CallGraph][..]),
+                ("TestRoute", 2, &[TestEvidence::CallGraph][..]),
+                ("BenchmarkRoute", 2, &[TestEvidence::CallGraph][..]),
+                ("TestEndToEnd", 0, &[TestEvidence::Coverage][..]),
+            ]
+        );
+        assert_eq!(report.unindexed_tests, ["TestGone"]);
+        assert_eq!(
+            report.run,
+            [
+                "go test ./e2e -run '^(TestEndToEnd)$'",
+                "go test ./pkg/handlers -run '^(TestHandleRequest)$'",
+                "go test ./pkg/server -run '^(TestRoute)$'",
+                "go test ./pkg/server -run '^$' -bench '^(BenchmarkRoute)$'",
+            ]
+        );
+
+        let shallow = tests_for(
+            &conn,
+            "repo",
+            "main",
+            &TestsForRequest {
+                symbol: "HandleRequest",
+                path: None,
+                depth: 1,
+                limit: 100,
+                coverage: &[],
+            },
+        )
+        .unwrap();
+        assert_eq!(shallow.tests.len(), 1);
+        assert_eq!(shallow.test_files, ["pkg/handlers/handle_test.go"]);
+    }
+
+    #[test]
+    fn unknown_symbols_are_reported() {
+        let (_tmp, conn) = setup();
+        let err = tests_for(
+            &conn,
+            "repo",
+            "main",
+            &TestsForRequest {
+                symbol: "server.HandleRequest",
+                path: None,
+                depth: 3,
+                limit: 100,
+                coverage: &[],
+            },
+        )
+        .unwrap_err();
+        assert!(matches!(err, TestMapError::SymbolNotFound));
+    }
+}
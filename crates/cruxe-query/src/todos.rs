@@ -0,0 +1,392 @@
+//! TODO inventory for `cruxe todos`: the TODO, FIXME and HACK comments and
+//! deprecation notices recorded at index time, with who wrote each one and
+//! how long ago.
+//!
+//! Authorship comes from `git blame`, run once per file for just the marker
+//! lines. Without git history the markers are still listed, but cannot be
+//! filtered by owner or age.
+
+use crate::deps::package_name;
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::todos;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::path::Path;
+use std::process::Command;
+
+/// Author mail git blame reports for lines that are not committed yet.
+const NOT_COMMITTED_MAIL: &str = "not.committed.yet";
+
+#[derive(Debug, thiserror::Error)]
+pub enum TodoError {
+    #[error("filtering by owner or age needs git history; not a git repository")]
+    NotGitRepo,
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct TodoOptions {
+    /// `todo`, `fixme`, `hack` and/or `deprecated`; empty keeps all.
+    pub markers: Vec<String>,
+    /// Only markers in this package or its subpackages.
+    pub package: Option<String>,
+    /// Blame author name or email, or the `TODO(name)` assignee.
+    pub owner: Option<String>,
+    /// Only markers whose line was last changed at least this long ago.
+    pub min_age_days: Option<u64>,
+    /// Only markers in files in scope.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct TodoItem {
+    pub marker: String,
+    pub text: String,
+    pub assignee: Option<String>,
+    /// Qualified name of the symbol the marker sits in or documents.
+    pub symbol: Option<String>,
+    pub package: String,
+    pub path: String,
+    pub line: u32,
+    /// Author of the line per `git blame`; `None` if uncommitted or unknown.
+    pub author: Option<String>,
+    pub author_email: Option<String>,
+    /// Days since the line was last changed.
+    pub age_days: Option<u64>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct TodoReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub total: usize,
+    /// Reported markers per kind.
+    pub by_marker: BTreeMap<String, usize>,
+    /// Oldest first; markers of unknown age last.
+    pub items: Vec<TodoItem>,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct BlameLine {
+    author: Option<String>,
+    email: Option<String>,
+    time: i64,
+}
+
+/// The markers of `ref_name` that pass `options`, blamed against
+/// `workspace`.
+pub fn list_todos(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    options: &TodoOptions,
+) -> Result<TodoReport, TodoError> {
+    let is_git = cruxe_core::vcs::is_git_repo(workspace);
+    if !is_git && (options.owner.is_some() || options.min_age_days.is_some()) {
+        return Err(TodoError::NotGitRepo);
+    }
+    let markers: Vec<String> = options
+        .markers
+        .iter()
+        .map(|marker| marker.trim().to_ascii_lowercase())
+        .collect();
+
+    let mut by_path: BTreeMap<String, Vec<TodoItem>> = BTreeMap::new();
+    for record in todos::list_todos(conn, repo, ref_name)? {
+        if !markers.is_empty() && !markers.contains(&record.marker) {
+            continue;
+        }
+        if !options.scope.contains(&record.path) {
+            continue;
+        }
+        let package = package_name(&record.path, 0);
+        if let Some(wanted) = options.package.as_deref()
+            && !in_package(&package, wanted)
+        {
+            continue;
+        }
+        by_path
+            .entry(record.path.clone())
+            .or_default()
+            .push(TodoItem {
+                marker: record.marker,
+                text: record.text,
+                assignee: record.assignee,
+                symbol: record.symbol,
+                package,
+                path: record.path,
+                line: record.line,
+                author: None,
+                author_email: None,
+                age_days: None,
+            });
+    }
+
+    let revision = (ref_name != constants::REF_LIVE).then_some(ref_name);
+    let now = std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map(|elapsed| elapsed.as_secs() as i64)
+        .unwrap_or_default();
+    let mut items = Vec::new();
+    for (path, mut file_items) in by_path {
+        if is_git {
+            let lines: Vec<u32> = file_items.iter().map(|item| item.line).collect();
+            let blamed = blame_lines(workspace, revision, &path, &lines);
+            for item in &mut file_items {
+                if let Some(blame) = blamed.get(&item.line) {
+                    item.author = blame.author.clone();
+                    item.author_email = blame.email.clone();
+                    item.age_days = Some((now - blame.time).max(0) as u64 / 86_400);
+                }
+            }
+        }
+        items.extend(file_items.into_iter().filter(|item| {
+            options
+                .owner
+                .as_deref()
+                .is_none_or(|owner| owned_by(item, owner))
+                && options
+                    .min_age_days
+                    .is_none_or(|min| item.age_days.is_some_and(|age| age >= min))
+        }));
+    }
+    items.sort_by(|a, b| {
+        b.age_days
+            .cmp(&a.age_days)
+            .then_with(|| (&a.path, a.line).cmp(&(&b.path, b.line)))
+    });
+
+    let mut by_marker = BTreeMap::new();
+    for item in &items {
+        *by_marker.entry(item.marker.clone()).or_default() += 1;
+    }
+    Ok(TodoReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        total: items.len(),
+        by_marker,
+        items,
+    })
+}
+
+pub(crate) fn in_package(package: &str, wanted: &str) -> bool {
+    let wanted = wanted.trim_matches('/');
+    package == wanted
+        || package
+            .strip_prefix(wanted)
+            .is_some_and(|rest| rest.starts_with('/'))
+}
+
+fn owned_by(item: &TodoItem, owner: &str) -> bool {
+    [&item.author, &item.author_email, &item.assignee]
+        .into_iter()
+        .flatten()
+        .any(|name| name.eq_ignore_ascii_case(owner))
+}
+
+/// Blame of the given lines of `path`, keyed by line; lines git cannot blame
+/// (e.g. an untracked file) are missing.
+fn blame_lines(
+    workspace: &Path,
+    revision: Option<&str>,
+    path: &str,
+    lines: &[u32],
+) -> HashMap<u32, BlameLine> {
+    let mut command = Command::new("git");
+    command
+        .arg("-C")
+        .arg(workspace)
+        .args(["blame", "--line-porcelain"]);
+    for line in lines.iter().filter(|line| **line > 0) {
+        command.arg(format!("-L{line},{line}"));
+    }
+    if let Some(revision) = revision {
+        command.arg(revision);
+    }
+    match command.arg("--").arg(path).output() {
+        Ok(output) if output.status.success() => {
+            parse_blame(&String::from_utf8_lossy(&output.stdout))
+        }
+        _ => HashMap::new(),
+    }
+}
+
+/// `git blame --line-porcelain` output: a `<sha> <orig> <final> [<n>]`
+/// header, `key value` lines, then the tab-prefixed source line.
+fn parse_blame(output: &str) -> HashMap<u32, BlameLine> {
+    let mut blamed = HashMap::new();
+    let mut line = None;
+    let mut current = BlameLine {
+        author: None,
+        email: None,
+        time: 0,
+    };
+    for text in output.lines() {
+        if text.starts_with('\t') {
+            if let Some(line) = line.take() {
+                blamed.insert(line, current.clone());
+            }
+            continue;
+        }
+        let (key, value) = text.split_once(' ').unwrap_or((text, ""));
+        match key {
+            "author" => current.author = Some(value.to_string()),
+            "author-mail" => {
+                let email = value.trim_start_matches('<').trim_end_matches('>');
+                current.email = Some(email.to_string());
+            }
+            "author-time" => current.time = value.parse().unwrap_or_default(),
+            _ if key.len() == 40 && key.bytes().all(|byte| byte.is_ascii_hexdigit()) => {
+                line = value.split(' ').nth(1).and_then(|line| line.parse().ok());
+                current = BlameLine {
+                    author: None,
+                    email: None,
+                    time: 0,
+                };
+            }
+            _ => {}
+        }
+        if current.email.as_deref() == Some(NOT_COMMITTED_MAIL) {
+            current.author = None;
+            current.email = None;
+        }
+    }
+    blamed
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::TodoRecord;
+    use cruxe_state::{db, schema};
+
+    fn git(repo: &Path, args: &[&str], date: &str) {
+        let output = Command::new("git")
+            .args(args)
+            .current_dir(repo)
+            .env("GIT_AUTHOR_DATE", date)
+            .env("GIT_COMMITTER_DATE", date)
+            .output()
+            .unwrap();
+        assert!(
+            output.status.success(),
+            "git {:?} failed: {}",
+            args,
+            String::from_utf8_lossy(&output.stderr)
+        );
+    }
+
+    fn record(path: &str, line: u32, marker: &str, assignee: Option<&str>) -> TodoRecord {
+        TodoRecord {
+            repo: "repo".to_string(),
+            r#ref: constants::REF_LIVE.to_string(),
+            path: path.to_string(),
+            line,
+            marker: marker.to_string(),
+            text: "tidy up".to_string(),
+            assignee: assignee.map(str::to_string),
+            symbol_id: None,
+            symbol: None,
+        }
+    }
+
+    #[test]
+    fn blames_markers_and_filters_by_owner_age_and_package() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path().join("workspace");
+        std::fs::create_dir_all(workspace.join("auth/token")).unwrap();
+        std::fs::create_dir_all(workspace.join("store")).unwrap();
+        let now = "2026-01-01T00:00:00";
+        git(&workspace, &["init"], now);
+        git(
+            &workspace,
+            &["config", "user.email", "ada@example.com"],
+            now,
+        );
+        git(&workspace, &["config", "user.name", "Ada"], now);
+        std::fs::write(
+            workspace.join("auth/token/token.go"),
+            "package token\n\n// TODO: rotate keys\n",
+        )
+        .unwrap();
+        git(&workspace, &["add", "."], now);
+        git(&workspace, &["commit", "-m", "old"], "2020-01-01T00:00:00");
+        std::fs::write(
+            workspace.join("store/store.go"),
+            "package store\n\n// FIXME(lin): leak\n",
+        )
+        .unwrap();
+
+        let conn = db::open_connection(&tmp.path().join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let token = record("auth/token/token.go", 3, "todo", None);
+        todos::replace_for_file(&conn, "repo", "live", &token.path, &[token.clone()]).unwrap();
+        let store = record("store/store.go", 3, "fixme", Some("lin"));
+        todos::replace_for_file(&conn, "repo", "live", &store.path, &[store.clone()]).unwrap();
+
+        let list = |options: TodoOptions| {
+            list_todos(&conn, &workspace, "repo", constants::REF_LIVE, &options).unwrap()
+        };
+        let all = list(TodoOptions::default());
+        assert_eq!(all.total, 2);
+        assert_eq!(all.by_marker["fixme"], 1);
+        assert_eq!(all.items[0].path, "auth/token/token.go");
+        assert_eq!(all.items[0].author.as_deref(), Some("Ada"));
+        assert_eq!(
+            all.items[0].author_email.as_deref(),
+            Some("ada@example.com")
+        );
+        assert!(all.items[0].age_days.unwrap() > 365 * 5);
+        // Untracked files have no blame.
+        assert_eq!(all.items[1].author, None);
+
+        let old = list(TodoOptions {
+            min_age_days: Some(365),
+            ..TodoOptions::default()
+        });
+        assert_eq!(old.total, 1);
+        let lin = list(TodoOptions {
+            owner: Some("LIN".to_string()),
+            ..TodoOptions::default()
+        });
+        assert_eq!(lin.items[0].path, "store/store.go");
+        let auth = list(TodoOptions {
+            package: Some("auth".to_string()),
+            markers: vec!["TODO".to_string()],
+            ..TodoOptions::default()
+        });
+        assert_eq!(auth.total, 1);
+        let none = list(TodoOptions {
+            markers: vec!["hack".to_string()],
+            ..TodoOptions::default()
+        });
+        assert_eq!(none.total, 0);
+    }
+
+    #[test]
+    fn parses_line_porcelain() {
+        let sha = "a".repeat(40);
+        let zero = "0".repeat(40);
+        let output = format!(
+            "{sha} 2 3 1\nauthor Ada\nauthor-mail <ada@example.com>\nauthor-time 86400\n\t// TODO\n\
+             {zero} 9 9 1\nauthor Not Committed Yet\nauthor-mail <not.committed.yet>\nauthor-time 99\n\t// HACK\n"
+        );
+        let blamed = parse_blame(&output);
+        assert_eq!(
+            blamed[&3],
+            BlameLine {
+                author: Some("Ada".to_string()),
+                email: Some("ada@example.com".to_string()),
+                time: 86_400,
+            }
+        );
+        assert_eq!(blamed[&9].author, None);
+        assert_eq!(blamed[&9].email, None);
+    }
+}
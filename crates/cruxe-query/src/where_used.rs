@@ -0,0 +1,288 @@
+//! `cruxe where-used --literal`: where a value appears in the indexed code.
+//!
+//! Literals are recorded at index time by
+//! [`cruxe_indexer::literal_extract`]: every constant's value, and string
+//! literals shaped like routes, environment variable names, error codes or
+//! URLs. A value held by a constant is mostly used through that constant,
+//! so the references to it are reported as well.
+
+use crate::ref_sites::{self, RefKind};
+use cruxe_core::error::StateError;
+use cruxe_indexer::scanner::PathScope;
+use cruxe_state::literals;
+use rusqlite::Connection;
+use schemars::JsonSchema;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::Path;
+
+/// Literal kinds in the order they are reported.
+pub const KINDS: &[&str] = &["route", "env", "code", "url", "constant"];
+
+#[derive(Debug, thiserror::Error)]
+pub enum WhereUsedError {
+    #[error("unknown kind `{0}`; expected route, env, code, url or constant")]
+    UnknownKind(String),
+    #[error(transparent)]
+    State(#[from] StateError),
+}
+
+#[derive(Debug, Clone, Default)]
+pub struct WhereUsedOptions {
+    /// The value to look for, without quotes.
+    pub literal: String,
+    /// Match values starting with `literal` rather than equal to it.
+    pub prefix: bool,
+    /// `route`, `env`, `code`, `url` and/or `constant`; empty keeps all.
+    pub kinds: Vec<String>,
+    /// Only literals in files in scope.
+    pub scope: PathScope,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct LiteralSite {
+    pub value: String,
+    /// `route`, `env`, `code`, `url` or `constant`.
+    pub kind: String,
+    pub path: String,
+    pub line: u32,
+    /// Qualified name of the constant the value defines, or of the function
+    /// or symbol it appears in.
+    pub symbol: Option<String>,
+    /// The site declares the constant `symbol` with this value.
+    pub defines: bool,
+}
+
+/// A reference to a constant holding the value.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct ConstantUse {
+    pub constant: String,
+    pub path: String,
+    pub line: u32,
+    pub column: u32,
+    pub kind: RefKind,
+    /// Qualified name of the symbol the reference is in.
+    pub enclosing: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, JsonSchema)]
+pub struct WhereUsedReport {
+    pub repo: String,
+    pub ref_name: String,
+    pub literal: String,
+    pub total: usize,
+    /// Sites per kind.
+    pub by_kind: BTreeMap<String, usize>,
+    /// In path and line order.
+    pub sites: Vec<LiteralSite>,
+    /// References to the constants among `sites`, by constant, path and
+    /// line.
+    pub constant_uses: Vec<ConstantUse>,
+}
+
+/// Where `options.literal` appears on `ref_name`, and where the constants
+/// holding it are used.
+pub fn where_used(
+    conn: &Connection,
+    workspace: &Path,
+    repo: &str,
+    ref_name: &str,
+    options: &WhereUsedOptions,
+) -> Result<WhereUsedReport, WhereUsedError> {
+    let mut kinds = Vec::new();
+    for kind in &options.kinds {
+        let kind = kind.trim().to_ascii_lowercase();
+        if !KINDS.contains(&kind.as_str()) {
+            return Err(WhereUsedError::UnknownKind(kind));
+        }
+        kinds.push(kind);
+    }
+
+    let records = if options.prefix {
+        literals::find_by_prefix(conn, repo, ref_name, &options.literal)?
+    } else {
+        literals::find_by_value(conn, repo, ref_name, &options.literal)?
+    };
+    let mut sites = Vec::new();
+    let mut by_kind = BTreeMap::new();
+    for record in records {
+        if !kinds.is_empty() && !kinds.contains(&record.kind) {
+            continue;
+        }
+        if !options.scope.contains(&record.path) {
+            continue;
+        }
+        *by_kind.entry(record.kind.clone()).or_insert(0) += 1;
+        sites.push(LiteralSite {
+            value: record.value,
+            kind: record.kind,
+            path: record.path,
+            line: record.line,
+            symbol: record.symbol,
+            defines: record.defines,
+        });
+    }
+
+    let mut constants: Vec<&str> = sites
+        .iter()
+        .filter(|site| site.defines)
+        .filter_map(|site| site.symbol.as_deref())
+        .collect();
+    constants.sort();
+    constants.dedup();
+    let mut constant_uses = Vec::new();
+    for constant in constants {
+        let references = ref_sites::find_reference_sites(
+            conn,
+            workspace,
+            repo,
+            ref_name,
+            constant,
+            &[RefKind::Call, RefKind::Read, RefKind::Write],
+        )?;
+        constant_uses.extend(
+            references
+                .references
+                .into_iter()
+                .filter(|site| options.scope.contains(&site.path))
+                .map(|site| ConstantUse {
+                    constant: constant.to_string(),
+                    path: site.path,
+                    line: site.line,
+                    column: site.column,
+                    kind: site.kind,
+                    enclosing: site.enclosing.map(|symbol| symbol.qualified_name),
+                }),
+        );
+    }
+
+    Ok(WhereUsedReport {
+        repo: repo.to_string(),
+        ref_name: ref_name.to_string(),
+        literal: options.literal.clone(),
+        total: sites.len(),
+        by_kind,
+        sites,
+        constant_uses,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use cruxe_core::types::{LiteralRecord, SymbolKind, SymbolRecord};
+    use cruxe_state::manifest::{self, ManifestEntry};
+    use cruxe_state::{db, schema, symbols};
+
+    fn symbol(name: &str, kind: SymbolKind, line_start: u32, line_end: u32) -> SymbolRecord {
+        SymbolRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            commit: None,
+            path: "api/routes.go".to_string(),
+            language: "go".to_string(),
+            symbol_id: format!("sym::{name}"),
+            symbol_stable_id: format!("stable::{name}"),
+            name: name.to_string(),
+            qualified_name: format!("api.{name}"),
+            kind,
+            signature: None,
+            line_start,
+            line_end,
+            parent_symbol_id: None,
+            visibility: None,
+            content: None,
+        }
+    }
+
+    fn literal(line: u32, kind: &str, defines: bool, symbol: &str) -> LiteralRecord {
+        LiteralRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: "api/routes.go".to_string(),
+            line,
+            value: "/api/user".to_string(),
+            kind: kind.to_string(),
+            defines,
+            symbol_id: Some(format!("stable::{symbol}")),
+            symbol: Some(format!("api.{symbol}")),
+        }
+    }
+
+    #[test]
+    fn reports_literal_sites_and_uses_of_constants_holding_them() {
+        let tmp = tempfile::tempdir().unwrap();
+        let workspace = tmp.path();
+        let conn = db::open_connection(&workspace.join("state.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let source = "package api\n\nconst RouteUser = \"/api/user\"\n\nfunc Register(mux *Mux) {\n\tmux.Handle(RouteUser, user)\n\tmux.Handle(\"/api/user\", legacy)\n}\n";
+        std::fs::create_dir_all(workspace.join("api")).unwrap();
+        std::fs::write(workspace.join("api/routes.go"), source).unwrap();
+        manifest::upsert_manifest(
+            &conn,
+            &ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "api/routes.go".to_string(),
+                content_hash: "hash".to_string(),
+                size_bytes: source.len() as u64,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+        symbols::insert_symbol(&conn, &symbol("RouteUser", SymbolKind::Constant, 3, 3)).unwrap();
+        symbols::insert_symbol(&conn, &symbol("Register", SymbolKind::Function, 5, 8)).unwrap();
+        literals::replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "api/routes.go",
+            &[
+                literal(3, "route", true, "RouteUser"),
+                literal(7, "route", false, "Register"),
+            ],
+        )
+        .unwrap();
+
+        let options = WhereUsedOptions {
+            literal: "/api/user".to_string(),
+            ..Default::default()
+        };
+        let report = where_used(&conn, workspace, "repo", "main", &options).unwrap();
+        assert_eq!(report.total, 2);
+        assert_eq!(report.by_kind.get("route"), Some(&2));
+        assert!(report.sites[0].defines);
+        assert_eq!(
+            report.constant_uses,
+            [ConstantUse {
+                constant: "api.RouteUser".to_string(),
+                path: "api/routes.go".to_string(),
+                line: 6,
+                column: 13,
+                kind: RefKind::Read,
+                enclosing: Some("api.Register".to_string()),
+            }]
+        );
+
+        let codes = WhereUsedOptions {
+            kinds: vec!["code".to_string()],
+            ..options.clone()
+        };
+        assert_eq!(
+            where_used(&conn, workspace, "repo", "main", &codes)
+                .unwrap()
+                .total,
+            0
+        );
+        let unknown = WhereUsedOptions {
+            kinds: vec!["regex".to_string()],
+            ..options
+        };
+        assert!(matches!(
+            where_used(&conn, workspace, "repo", "main", &unknown),
+            Err(WhereUsedError::UnknownKind(_))
+        ));
+    }
+}
@@ -119,6 +119,7 @@ fn run_eval(
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .expect("eval search invocation should succeed");
@@ -276,6 +277,7 @@ fn adaptive_plan_benchmark_asserts_plan_p95_budgets_and_downgrade_rates() {
                     policy_mode_override: None,
                     policy_runtime: None,
                     diversity_enabled: true,
+                    in_docs: false,
                 },
             )
             .expect("search invocation should succeed");
@@ -142,6 +142,7 @@ fn hybrid_mode_returns_semantic_match_for_conceptual_query_without_keyword_overl
             policy_mode_override: None,
             policy_runtime: None,
             diversity_enabled: true,
+            in_docs: false,
         },
     )
     .unwrap();
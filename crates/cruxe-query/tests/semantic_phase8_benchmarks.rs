@@ -475,6 +475,7 @@ fn run_natural_language_eval(
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .map_err(|err| format!("search failed for {}: {err}", case.id))?;
@@ -548,6 +549,7 @@ fn run_symbol_precision_eval(
                 policy_mode_override: None,
                 policy_runtime: None,
                 diversity_enabled: true,
+                in_docs: false,
             },
         )
         .map_err(|err| format!("symbol search failed for {}: {err}", case.query))?;
@@ -0,0 +1,156 @@
+//! Transparent zstd compression for index artifacts (`index.pb` and
+//! `cruxe export` output).
+//!
+//! Writers compress on request; readers look at the first bytes and
+//! decompress zstd frames, so plain and compressed files can be passed to
+//! the same commands without a flag.
+
+use std::fs::File;
+use std::io::{self, BufWriter, Read, Write};
+use std::path::{Path, PathBuf};
+
+/// First four bytes of every zstd frame.
+pub const ZSTD_MAGIC: [u8; 4] = [0x28, 0xB5, 0x2F, 0xFD];
+
+/// Extension of compressed artifacts.
+pub const ZSTD_EXTENSION: &str = "zst";
+
+const COMPRESSION_LEVEL: i32 = 3;
+
+/// Whether `bytes` start with a zstd frame.
+pub fn is_compressed(bytes: &[u8]) -> bool {
+    bytes.starts_with(&ZSTD_MAGIC)
+}
+
+/// Whether `path` names a compressed artifact (`*.zst`).
+pub fn has_zstd_extension(path: &Path) -> bool {
+    path.extension()
+        .is_some_and(|ext| ext.eq_ignore_ascii_case(ZSTD_EXTENSION))
+}
+
+/// `path` with `.zst` appended, unless it already ends in it.
+pub fn with_zstd_extension(path: &Path) -> PathBuf {
+    if has_zstd_extension(path) {
+        return path.to_path_buf();
+    }
+    let mut name = path.as_os_str().to_os_string();
+    name.push(".");
+    name.push(ZSTD_EXTENSION);
+    PathBuf::from(name)
+}
+
+/// The artifact bytes, decompressed if they are a zstd stream.
+pub fn decode(bytes: Vec<u8>) -> io::Result<Vec<u8>> {
+    if is_compressed(&bytes) {
+        zstd::decode_all(bytes.as_slice())
+    } else {
+        Ok(bytes)
+    }
+}
+
+/// Read a whole artifact, decompressing it if needed.
+pub fn read(path: &Path) -> io::Result<Vec<u8>> {
+    decode(std::fs::read(path)?)
+}
+
+/// Read everything from `reader`, decompressing it if needed.
+pub fn read_all<R: Read>(reader: &mut R) -> io::Result<Vec<u8>> {
+    let mut bytes = Vec::new();
+    reader.read_to_end(&mut bytes)?;
+    decode(bytes)
+}
+
+/// A writer that compresses its output when asked to. Call
+/// [`ArtifactWriter::finish`] to end the zstd frame; dropping it without
+/// finishing leaves a truncated file.
+pub enum ArtifactWriter<W: Write> {
+    Plain(W),
+    Zstd(zstd::Encoder<'static, W>),
+}
+
+impl<W: Write> ArtifactWriter<W> {
+    pub fn new(inner: W, compress: bool) -> io::Result<Self> {
+        if compress {
+            Ok(Self::Zstd(zstd::Encoder::new(inner, COMPRESSION_LEVEL)?))
+        } else {
+            Ok(Self::Plain(inner))
+        }
+    }
+
+    /// End the frame, flush and return the inner writer.
+    pub fn finish(self) -> io::Result<W> {
+        let mut inner = match self {
+            Self::Plain(inner) => inner,
+            Self::Zstd(encoder) => encoder.finish()?,
+        };
+        inner.flush()?;
+        Ok(inner)
+    }
+}
+
+impl ArtifactWriter<BufWriter<File>> {
+    /// Create `path`, compressing when `compress` is set or the path ends in
+    /// `.zst`.
+    pub fn create(path: &Path, compress: bool) -> io::Result<Self> {
+        let file = File::create(path)?;
+        Self::new(BufWriter::new(file), compress || has_zstd_extension(path))
+    }
+}
+
+impl<W: Write> Write for ArtifactWriter<W> {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        match self {
+            Self::Plain(inner) => inner.write(buf),
+            Self::Zstd(encoder) => encoder.write(buf),
+        }
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        match self {
+            Self::Plain(inner) => inner.flush(),
+            Self::Zstd(encoder) => encoder.flush(),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    #[test]
+    fn reads_plain_and_compressed_artifacts_alike() {
+        let dir = tempdir().unwrap();
+        let payload = b"{\"nodes\":[]}\n".repeat(200);
+
+        let plain = dir.path().join("graph.json");
+        let mut writer = ArtifactWriter::create(&plain, false).unwrap();
+        writer.write_all(&payload).unwrap();
+        writer.finish().unwrap();
+
+        let compressed = dir.path().join("graph.json.zst");
+        let mut writer = ArtifactWriter::create(&compressed, false).unwrap();
+        writer.write_all(&payload).unwrap();
+        writer.finish().unwrap();
+
+        let raw = std::fs::read(&compressed).unwrap();
+        assert!(is_compressed(&raw));
+        assert!(raw.len() < payload.len());
+        assert!(!is_compressed(&std::fs::read(&plain).unwrap()));
+        assert_eq!(read(&plain).unwrap(), payload);
+        assert_eq!(read(&compressed).unwrap(), payload);
+        assert_eq!(read_all(&mut raw.as_slice()).unwrap(), payload);
+    }
+
+    #[test]
+    fn zstd_extension_is_appended_once() {
+        assert_eq!(
+            with_zstd_extension(Path::new("out/index.pb")),
+            PathBuf::from("out/index.pb.zst")
+        );
+        assert_eq!(
+            with_zstd_extension(Path::new("out/index.pb.ZST")),
+            PathBuf::from("out/index.pb.ZST")
+        );
+    }
+}
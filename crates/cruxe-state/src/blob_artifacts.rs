@@ -0,0 +1,156 @@
+//! Extraction results per file version, shared by every ref of a project:
+//! a file with the same path and content on two branches is parsed once.
+//! Entries are keyed by content hash, so they never go stale; [`prune`]
+//! drops those no ref's manifest points at any more.
+
+use cruxe_core::error::StateError;
+use cruxe_core::time::now_iso8601;
+use rusqlite::{Connection, OptionalExtension, params};
+
+/// One file version's cached extraction.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct BlobArtifacts {
+    /// Ref the artifacts were built for; their symbol ids embed it.
+    pub built_ref: String,
+    /// Encoded artifacts, as the indexer wrote them.
+    pub artifacts: Vec<u8>,
+}
+
+/// The artifacts of `path` at `content_hash`, extracted as `language` with
+/// or without bodies.
+pub fn get(
+    conn: &Connection,
+    repo: &str,
+    path: &str,
+    content_hash: &str,
+    language: &str,
+    bodies: bool,
+) -> Result<Option<BlobArtifacts>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT built_ref, artifacts FROM blob_artifacts
+             WHERE repo = ?1 AND path = ?2 AND content_hash = ?3 AND language = ?4
+               AND bodies = ?5",
+        )
+        .map_err(StateError::sqlite)?;
+    stmt.query_row(params![repo, path, content_hash, language, bodies], |row| {
+        Ok(BlobArtifacts {
+            built_ref: row.get(0)?,
+            artifacts: row.get(1)?,
+        })
+    })
+    .optional()
+    .map_err(StateError::sqlite)
+}
+
+/// Store the artifacts of a file version, replacing an earlier entry.
+#[allow(clippy::too_many_arguments)]
+pub fn put(
+    conn: &Connection,
+    repo: &str,
+    path: &str,
+    content_hash: &str,
+    language: &str,
+    bodies: bool,
+    built_ref: &str,
+    artifacts: &[u8],
+) -> Result<(), StateError> {
+    conn.prepare_cached(
+        "INSERT OR REPLACE INTO blob_artifacts
+            (repo, path, content_hash, language, bodies, built_ref, artifacts, created_at)
+         VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)",
+    )
+    .map_err(StateError::sqlite)?
+    .execute(params![
+        repo,
+        path,
+        content_hash,
+        language,
+        bodies,
+        built_ref,
+        artifacts,
+        now_iso8601(),
+    ])
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Drop the entries of file versions no ref of `repo` has indexed; returns
+/// how many were removed.
+pub fn prune(conn: &Connection, repo: &str) -> Result<usize, StateError> {
+    conn.execute(
+        "DELETE FROM blob_artifacts
+         WHERE repo = ?1
+           AND NOT EXISTS (
+               SELECT 1 FROM file_manifest m
+               WHERE m.repo = blob_artifacts.repo
+                 AND m.path = blob_artifacts.path
+                 AND m.content_hash = blob_artifacts.content_hash
+           )",
+        params![repo],
+    )
+    .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, manifest, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn artifacts_are_shared_by_content_and_pruned_when_unreferenced() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        put(&conn, "repo", "lib.go", "h1", "go", true, "main", b"first").unwrap();
+        put(&conn, "repo", "lib.go", "h1", "go", true, "feat", b"second").unwrap();
+        put(
+            &conn, "repo", "lib.go", "h2", "go", true, "feat", b"changed",
+        )
+        .unwrap();
+
+        let hit = get(&conn, "repo", "lib.go", "h1", "go", true)
+            .unwrap()
+            .unwrap();
+        assert_eq!(hit.built_ref, "feat");
+        assert_eq!(hit.artifacts, b"second");
+        assert!(
+            get(&conn, "repo", "lib.go", "h1", "go", false)
+                .unwrap()
+                .is_none()
+        );
+        assert!(
+            get(&conn, "other", "lib.go", "h1", "go", true)
+                .unwrap()
+                .is_none()
+        );
+
+        manifest::upsert_manifest(
+            &conn,
+            &manifest::ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: "lib.go".to_string(),
+                content_hash: "h1".to_string(),
+                size_bytes: 10,
+                mtime_ns: None,
+                language: Some("go".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+        assert_eq!(prune(&conn, "repo").unwrap(), 1);
+        assert!(
+            get(&conn, "repo", "lib.go", "h1", "go", true)
+                .unwrap()
+                .is_some()
+        );
+        assert!(
+            get(&conn, "repo", "lib.go", "h2", "go", true)
+                .unwrap()
+                .is_none()
+        );
+    }
+}
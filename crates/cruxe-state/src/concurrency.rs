@@ -0,0 +1,127 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::ConcurrencyRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the concurrency sites recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[ConcurrencyRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO concurrency_sites
+                (repo, \"ref\", path, line, kind, detail, symbol_id, symbol)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.kind,
+            record.detail,
+            record.symbol_id,
+            record.symbol,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the concurrency sites of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM concurrency_sites WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Concurrency sites of a repo/ref ordered by path and line.
+pub fn list_sites(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<ConcurrencyRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, line, kind, detail, symbol_id, symbol
+             FROM concurrency_sites
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(ConcurrencyRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                kind: row.get(2)?,
+                detail: row.get(3)?,
+                symbol_id: row.get(4)?,
+                symbol: row.get(5)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, kind: &str) -> ConcurrencyRecord {
+        ConcurrencyRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            kind: kind.to_string(),
+            detail: "go s.serve".to_string(),
+            symbol_id: Some("stable::Start".to_string()),
+            symbol: Some("server.Start".to_string()),
+        }
+    }
+
+    #[test]
+    fn sites_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [record("a.go", 3, "goroutine"), record("a.go", 9, "mutex")];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "b.go",
+            &[record("b.go", 1, "channel")],
+        )
+        .unwrap();
+        let listed = list_sites(&conn, "repo", "main").unwrap();
+        assert_eq!(listed.len(), 3);
+        assert_eq!(listed[0], a[0]);
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(list_sites(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -1,5 +1,6 @@
+use crate::schema;
 use cruxe_core::error::StateError;
-use rusqlite::Connection;
+use rusqlite::{Connection, DatabaseName, OpenFlags};
 use std::path::Path;
 use tracing::info;
 
@@ -45,6 +46,86 @@ fn apply_pragmas(
     Ok(())
 }
 
+/// Open an existing state DB for reads only, with its first `mmap_size`
+/// bytes memory-mapped: pages are read straight from the OS page cache as
+/// queries touch them instead of being copied into SQLite's cache, so a
+/// large index answers its first query without warming up.
+pub fn open_read_only(
+    db_path: &Path,
+    busy_timeout_ms: u32,
+    cache_size: i32,
+    mmap_size: u64,
+) -> Result<Connection, StateError> {
+    let conn = Connection::open_with_flags(
+        db_path,
+        OpenFlags::SQLITE_OPEN_READ_ONLY
+            | OpenFlags::SQLITE_OPEN_URI
+            | OpenFlags::SQLITE_OPEN_NO_MUTEX,
+    )
+    .map_err(StateError::sqlite)?;
+    conn.execute_batch(&format!(
+        "PRAGMA busy_timeout = {};
+         PRAGMA cache_size = {};
+         PRAGMA mmap_size = {};",
+        busy_timeout_ms, cache_size, mmap_size
+    ))
+    .map_err(StateError::sqlite)?;
+    info!(?db_path, mmap_size, "SQLite connection opened read-only");
+    Ok(conn)
+}
+
+/// Connection for query-only commands: read-only and memory-mapped when the
+/// DB exists at the current schema; otherwise opened for writing and
+/// migrated, as every other command does.
+pub fn open_for_query(
+    db_path: &Path,
+    busy_timeout_ms: u32,
+    cache_size: i32,
+    mmap_size: u64,
+) -> Result<Connection, StateError> {
+    if db_path.exists() {
+        let conn = open_read_only(db_path, busy_timeout_ms, cache_size, mmap_size)?;
+        if schema::is_current(&conn)? {
+            return Ok(conn);
+        }
+    }
+    let conn = open_connection_with_config(db_path, busy_timeout_ms, cache_size)?;
+    schema::create_tables(&conn)?;
+    Ok(conn)
+}
+
+/// A second connection to the database behind `conn`, in the same mode and
+/// with the same cache and mmap settings, for a parallel reader.
+pub fn reopen(conn: &Connection) -> Result<Connection, StateError> {
+    let Some(path) = conn
+        .path()
+        .filter(|path| !path.is_empty() && *path != ":memory:")
+    else {
+        return Err(StateError::Sqlite(
+            "cannot reopen an in-memory database".to_string(),
+        ));
+    };
+    let pragma = |name: &str| -> Result<i64, StateError> {
+        conn.query_row(&format!("PRAGMA {name}"), [], |row| row.get(0))
+            .map_err(StateError::sqlite)
+    };
+    let busy_timeout_ms = pragma("busy_timeout")? as u32;
+    let cache_size = pragma("cache_size")? as i32;
+    if conn
+        .is_readonly(DatabaseName::Main)
+        .map_err(StateError::sqlite)?
+    {
+        open_read_only(
+            Path::new(path),
+            busy_timeout_ms,
+            cache_size,
+            pragma("mmap_size")?.max(0) as u64,
+        )
+    } else {
+        open_connection_with_config(Path::new(path), busy_timeout_ms, cache_size)
+    }
+}
+
 /// Run SQLite quick_check to verify database integrity.
 /// Returns Ok(true) if healthy, Ok(false) with error detail otherwise.
 pub fn check_sqlite_health(conn: &Connection) -> Result<(bool, Option<String>), StateError> {
@@ -99,4 +180,34 @@ mod tests {
             .unwrap();
         assert_eq!(cache, -32000);
     }
+
+    #[test]
+    fn query_connections_are_read_only_and_mapped_once_migrated() {
+        let dir = tempdir().unwrap();
+        let db_path = dir.path().join("state.db");
+
+        // A missing DB is created and migrated like any other.
+        let conn = open_for_query(&db_path, 5000, -64000, 1 << 20).unwrap();
+        assert!(!conn.is_readonly(DatabaseName::Main).unwrap());
+        drop(conn);
+
+        let conn = open_for_query(&db_path, 4000, -32000, 1 << 20).unwrap();
+        assert!(conn.is_readonly(DatabaseName::Main).unwrap());
+        let mmap: i64 = conn
+            .query_row("PRAGMA mmap_size", [], |row| row.get(0))
+            .unwrap();
+        assert_eq!(mmap, 1 << 20);
+        assert!(conn.execute_batch("CREATE TABLE t (x)").is_err());
+
+        let parallel = reopen(&conn).unwrap();
+        assert!(parallel.is_readonly(DatabaseName::Main).unwrap());
+        let timeout: i64 = parallel
+            .query_row("PRAGMA busy_timeout", [], |row| row.get(0))
+            .unwrap();
+        assert_eq!(timeout, 4000);
+        let mmap: i64 = parallel
+            .query_row("PRAGMA mmap_size", [], |row| row.get(0))
+            .unwrap();
+        assert_eq!(mmap, 1 << 20);
+    }
 }
@@ -1,3 +1,4 @@
+use crate::reference_fingerprints;
 use cruxe_core::edge_confidence::assign_edge_confidence;
 use cruxe_core::error::StateError;
 use cruxe_core::types::{CallEdge, SymbolEdge};
@@ -308,6 +309,66 @@ pub fn get_edges_by_type(
         .map_err(StateError::sqlite)
 }
 
+/// List every edge in a repo/ref with its call-site metadata (used by exporters).
+///
+/// Import edges carry no source location; their `source_file` is empty and
+/// `source_line` is zero.
+pub fn list_edges_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<CallEdge>, StateError> {
+    let mut edges = Vec::new();
+    for_each_edge_for_ref(conn, repo, ref_name, |edge| {
+        edges.push(edge);
+        Ok(())
+    })?;
+    Ok(edges)
+}
+
+/// Visit every edge in a repo/ref in [`list_edges_for_ref`] order without
+/// materializing the whole list. Stops at the first error from `visit`.
+pub fn for_each_edge_for_ref<F>(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    mut visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(CallEdge) -> Result<(), StateError>,
+{
+    let mut stmt = conn
+        .prepare(
+            "SELECT repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence,
+                    COALESCE(source_file, ''), COALESCE(source_line, 0)
+             FROM symbol_edges
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY from_symbol_id, edge_type, COALESCE(to_symbol_id, to_name), source_line",
+        )
+        .map_err(StateError::sqlite)?;
+
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(CallEdge {
+                repo: row.get(0)?,
+                ref_name: row.get(1)?,
+                from_symbol_id: row.get(2)?,
+                to_symbol_id: row.get(3)?,
+                to_name: row.get(4)?,
+                edge_type: row.get(5)?,
+                confidence: row.get::<_, Option<String>>(6)?.unwrap_or_default(),
+                source_file: row.get(7)?,
+                source_line: row.get::<_, i64>(8)?.max(0) as u32,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+
+    for row in rows {
+        visit(row.map_err(StateError::sqlite)?)?;
+    }
+    Ok(())
+}
+
 /// Insert extracted call edges for a repo/ref scope.
 pub fn insert_call_edges(
     conn: &Connection,
@@ -384,10 +445,18 @@ pub fn replace_call_edges_for_files(
             )
             .map_err(StateError::sqlite)?;
 
-        for (_, edges) in edges_by_file {
+        for (source_file, edges) in edges_by_file {
             for edge in edges {
                 execute_insert_call_edge(&mut insert_stmt, repo, ref_name, edge)?;
             }
+            let fingerprint = reference_fingerprints::fingerprint_for_call_edges(edges);
+            reference_fingerprints::upsert_fingerprint(
+                conn,
+                repo,
+                ref_name,
+                source_file,
+                &fingerprint,
+            )?;
         }
 
         Ok(())
@@ -458,7 +527,7 @@ pub fn delete_call_edges_for_file(
         params![repo, ref_name, source_file],
     )
     .map_err(StateError::sqlite)?;
-    Ok(())
+    reference_fingerprints::delete_fingerprint(conn, repo, ref_name, source_file)
 }
 
 /// Delete call edges that target any of the provided symbol stable IDs.
@@ -524,6 +593,46 @@ pub fn get_callers(
         .map_err(StateError::sqlite)
 }
 
+/// Call edges left unresolved at index time whose callee name is `name` or
+/// ends with it after a `.` or `::` qualifier: calls into code outside the
+/// index, such as a shared library indexed on its own.
+pub fn get_unresolved_calls_to_name(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    name: &str,
+) -> Result<Vec<CallEdge>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence, source_file, source_line
+             FROM symbol_edges
+             WHERE repo = ?1 AND \"ref\" = ?2 AND edge_type = 'calls' AND to_symbol_id IS NULL
+               AND to_name LIKE '%' || ?3
+             ORDER BY source_file, source_line, from_symbol_id",
+        )
+        .map_err(StateError::sqlite)?;
+
+    let rows = stmt
+        .query_map(params![repo, ref_name, name], map_call_edge_row)
+        .map_err(StateError::sqlite)?;
+
+    // LIKE is only a prefilter: it treats `_` as a wildcard and matches
+    // names that merely end with `name`.
+    let edges = rows
+        .collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)?;
+    Ok(edges
+        .into_iter()
+        .filter(|edge| {
+            edge.to_name.as_deref().is_some_and(|to_name| {
+                to_name.strip_suffix(name).is_some_and(|qualifier| {
+                    qualifier.is_empty() || qualifier.ends_with('.') || qualifier.ends_with("::")
+                })
+            })
+        })
+        .collect())
+}
+
 /// Get all callee call-edges originating from a symbol.
 pub fn get_callees(
     conn: &Connection,
@@ -548,6 +657,34 @@ pub fn get_callees(
         .map_err(StateError::sqlite)
 }
 
+/// Get the call-edges recorded on one source line (used by go-to-definition).
+pub fn get_call_edges_at(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    source_file: &str,
+    source_line: u32,
+) -> Result<Vec<CallEdge>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT repo, \"ref\", from_symbol_id, to_symbol_id, to_name, edge_type, confidence, source_file, source_line
+             FROM symbol_edges
+             WHERE repo = ?1 AND \"ref\" = ?2 AND edge_type = 'calls' AND source_file = ?3 AND source_line = ?4
+             ORDER BY COALESCE(to_symbol_id, to_name)",
+        )
+        .map_err(StateError::sqlite)?;
+
+    let rows = stmt
+        .query_map(
+            params![repo, ref_name, source_file, source_line],
+            map_call_edge_row,
+        )
+        .map_err(StateError::sqlite)?;
+
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
 fn map_call_edge_row(row: &rusqlite::Row<'_>) -> rusqlite::Result<CallEdge> {
     let source_line = row.get::<_, Option<i64>>(8)?.unwrap_or_default().max(0) as u32;
     Ok(CallEdge {
@@ -846,6 +983,92 @@ mod tests {
         );
     }
 
+    #[test]
+    fn call_edges_at_returns_only_the_requested_line() {
+        let conn = setup_test_db();
+        let calls = vec![
+            call_edge(
+                "sym::handler",
+                Some("sym::validate"),
+                None,
+                "src/handler.rs",
+                12,
+                "static",
+            ),
+            call_edge(
+                "sym::handler",
+                None,
+                Some("external::audit"),
+                "src/handler.rs",
+                13,
+                "heuristic",
+            ),
+            call_edge(
+                "sym::entry",
+                None,
+                Some("external::log"),
+                "src/entry.rs",
+                13,
+                "heuristic",
+            ),
+        ];
+        insert_call_edges(&conn, "my-repo", "main", &calls).unwrap();
+
+        let at_line = get_call_edges_at(&conn, "my-repo", "main", "src/handler.rs", 13).unwrap();
+        assert_eq!(at_line.len(), 1);
+        assert_eq!(at_line[0].to_name.as_deref(), Some("external::audit"));
+    }
+
+    #[test]
+    fn unresolved_calls_match_by_callee_name() {
+        let conn = setup_test_db();
+        let calls = vec![
+            call_edge(
+                "sym::charge",
+                None,
+                Some("ledger.Post"),
+                "billing/charge.go",
+                20,
+                "heuristic",
+            ),
+            call_edge(
+                "sym::refund",
+                None,
+                Some("Post"),
+                "billing/refund.go",
+                8,
+                "heuristic",
+            ),
+            call_edge(
+                "sym::audit",
+                None,
+                Some("ledger.Repost"),
+                "billing/audit.go",
+                3,
+                "heuristic",
+            ),
+            call_edge(
+                "sym::local",
+                Some("sym::post"),
+                None,
+                "billing/local.go",
+                5,
+                "static",
+            ),
+        ];
+        insert_call_edges(&conn, "my-repo", "main", &calls).unwrap();
+
+        let calls = get_unresolved_calls_to_name(&conn, "my-repo", "main", "Post").unwrap();
+        let files: Vec<&str> = calls.iter().map(|edge| edge.source_file.as_str()).collect();
+        assert_eq!(files, ["billing/charge.go", "billing/refund.go"]);
+        assert_eq!(
+            get_unresolved_calls_to_name(&conn, "my-repo", "main", "ledger.Post")
+                .unwrap()
+                .len(),
+            1
+        );
+    }
+
     #[test]
     fn test_call_edge_confidence_assignment_persists_resolved_external_and_unresolved_outcomes() {
         let conn = setup_test_db();
@@ -0,0 +1,130 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use std::collections::HashMap;
+
+/// What a file's stored vectors were computed from: a fingerprint over its
+/// embedded snippets and the model that produced them.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct EmbeddedFile {
+    pub fingerprint: String,
+    pub model_id: String,
+    pub model_version: String,
+}
+
+/// Record that the vectors of a file are up to date with `file`.
+pub fn record(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    file: &EmbeddedFile,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO embedded_files (repo, \"ref\", path, fingerprint, model_id, model_version)
+         VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+         ON CONFLICT(repo, \"ref\", path) DO UPDATE SET
+            fingerprint = excluded.fingerprint,
+            model_id = excluded.model_id,
+            model_version = excluded.model_version,
+            embedded_at = datetime('now')",
+        params![
+            repo,
+            ref_name,
+            path,
+            file.fingerprint,
+            file.model_id,
+            file.model_version
+        ],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Forget a file (its vectors were deleted).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM embedded_files WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Forget every file of a repo/ref.
+pub fn delete_for_ref(conn: &Connection, repo: &str, ref_name: &str) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM embedded_files WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Embedded files of a repo/ref, keyed by path.
+pub fn for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<HashMap<String, EmbeddedFile>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT path, fingerprint, model_id, model_version
+             FROM embedded_files WHERE repo = ?1 AND \"ref\" = ?2",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok((
+                row.get::<_, String>(0)?,
+                EmbeddedFile {
+                    fingerprint: row.get(1)?,
+                    model_id: row.get(2)?,
+                    model_version: row.get(3)?,
+                },
+            ))
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<HashMap<_, _>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn embedded(fingerprint: &str) -> EmbeddedFile {
+        EmbeddedFile {
+            fingerprint: fingerprint.to_string(),
+            model_id: "nomic-embed-text".to_string(),
+            model_version: "v1".to_string(),
+        }
+    }
+
+    #[test]
+    fn records_are_upserted_and_forgotten() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        record(&conn, "repo", "main", "src/a.rs", &embedded("one")).unwrap();
+        record(&conn, "repo", "main", "src/b.rs", &embedded("two")).unwrap();
+        record(&conn, "repo", "dev", "src/a.rs", &embedded("three")).unwrap();
+        record(&conn, "repo", "main", "src/a.rs", &embedded("four")).unwrap();
+        let files = for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(files.len(), 2);
+        assert_eq!(files["src/a.rs"], embedded("four"));
+
+        delete_for_file(&conn, "repo", "main", "src/b.rs").unwrap();
+        assert_eq!(for_ref(&conn, "repo", "main").unwrap().len(), 1);
+        delete_for_ref(&conn, "repo", "main").unwrap();
+        assert!(for_ref(&conn, "repo", "main").unwrap().is_empty());
+        assert_eq!(for_ref(&conn, "repo", "dev").unwrap().len(), 1);
+    }
+}
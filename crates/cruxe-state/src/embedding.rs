@@ -1,3 +1,4 @@
+use crate::provider::{ProviderAuth, RateLimiter};
 use cruxe_core::config::SemanticConfig;
 use cruxe_core::error::StateError;
 use fastembed::{EmbeddingModel, TextEmbedding, TextInitOptions};
@@ -11,6 +12,10 @@ use tracing::warn;
 
 const VOYAGE_EMBED_ENDPOINT: &str = "https://api.voyageai.com/v1/embeddings";
 const OPENAI_EMBED_ENDPOINT: &str = "https://api.openai.com/v1/embeddings";
+/// Default for `openai-compatible`: a llama.cpp server started with `--embeddings`.
+const OPENAI_COMPATIBLE_EMBED_ENDPOINT: &str = "http://127.0.0.1:8080/v1/embeddings";
+const DEFAULT_EMBEDDING_API_KEY_ENV: &str = "CRUXE_EMBEDDING_API_KEY";
+const DEFAULT_EMBEDDING_TIMEOUT_MS: u64 = 5_000;
 const MAX_EMBEDDING_HTTP_CLIENT_CACHE_ENTRIES: usize = 4;
 const DEFAULT_FASTEMBED_CACHE_CAPACITY: usize = 4096;
 type SharedTextEmbeddingRuntime = Arc<Mutex<TextEmbedding>>;
@@ -56,8 +61,12 @@ pub fn build_embedding_provider(
     let provider = semantic.embedding.provider.to_ascii_lowercase();
     let enable_runtime = fastembed_runtime_enabled();
     match provider.as_str() {
-        "voyage" | "openai" => {
-            if !semantic.allow_external_provider_calls() {
+        "voyage" | "openai" | "openai-compatible" => {
+            let endpoint =
+                resolve_embedding_endpoint(&provider, semantic.embedding.endpoint.as_deref());
+            // A server on this machine (llama.cpp, an ONNX runtime server, ...)
+            // never sees code leave the host, so the privacy gates do not apply.
+            if !is_loopback_endpoint(&endpoint) && !semantic.allow_external_provider_calls() {
                 // Privacy gates force local-only path.
                 let local = FastEmbedProvider::new(selection, enable_runtime);
                 return Ok(BuiltEmbeddingProvider {
@@ -66,18 +75,21 @@ pub fn build_embedding_provider(
                 });
             }
 
-            let external = ExternalEmbeddingProvider::new(
-                provider,
-                selection.profile.model_name.clone(),
-                selection.model_version.clone(),
-                selection.profile.dimensions,
-                selection.batch_size,
-            )?;
+            let external =
+                ExternalEmbeddingProvider::new(provider, endpoint, &selection, semantic)?;
             Ok(BuiltEmbeddingProvider {
                 provider: Box::new(external),
                 external_provider_blocked: false,
             })
         }
+        "fake" => Ok(BuiltEmbeddingProvider {
+            provider: Box::new(FakeEmbeddingProvider {
+                model_id: selection.profile.model_name,
+                model_version: selection.model_version,
+                dimensions: selection.profile.dimensions,
+            }),
+            external_provider_blocked: false,
+        }),
         _ => {
             let local = FastEmbedProvider::new(selection, enable_runtime);
             Ok(BuiltEmbeddingProvider {
@@ -88,6 +100,40 @@ pub fn build_embedding_provider(
     }
 }
 
+/// Full embeddings URL for an HTTP provider. A configured endpoint is a base
+/// URL (`http://host:8080/v1`) unless it already ends in `/embeddings`.
+fn resolve_embedding_endpoint(provider: &str, configured: Option<&str>) -> String {
+    match configured.map(str::trim).filter(|value| !value.is_empty()) {
+        Some(endpoint) if endpoint.trim_end_matches('/').ends_with("/embeddings") => {
+            endpoint.trim_end_matches('/').to_string()
+        }
+        Some(endpoint) => format!("{}/embeddings", endpoint.trim_end_matches('/')),
+        None => match provider {
+            "voyage" => VOYAGE_EMBED_ENDPOINT.to_string(),
+            "openai-compatible" => OPENAI_COMPATIBLE_EMBED_ENDPOINT.to_string(),
+            _ => OPENAI_EMBED_ENDPOINT.to_string(),
+        },
+    }
+}
+
+/// Whether `endpoint` is served on this machine (`localhost` or a loopback
+/// address), so requests to it keep code local.
+pub fn is_loopback_endpoint(endpoint: &str) -> bool {
+    let Ok(url) = reqwest::Url::parse(endpoint) else {
+        return false;
+    };
+    let Some(host) = url.host_str() else {
+        return false;
+    };
+    if host.eq_ignore_ascii_case("localhost") {
+        return true;
+    }
+    host.trim_start_matches('[')
+        .trim_end_matches(']')
+        .parse::<std::net::IpAddr>()
+        .is_ok_and(|ip| ip.is_loopback())
+}
+
 fn resolve_embedding_model(
     semantic: &SemanticConfig,
 ) -> Result<EmbeddingModelSelection, StateError> {
@@ -349,30 +395,37 @@ pub struct ExternalEmbeddingProvider {
     dimensions: usize,
     batch_size: usize,
     endpoint: String,
+    auth: Option<ProviderAuth>,
+    limiter: RateLimiter,
     client: Client,
 }
 
 impl ExternalEmbeddingProvider {
     fn new(
         provider: String,
-        model_id: String,
-        model_version: String,
-        dimensions: usize,
-        batch_size: usize,
+        endpoint: String,
+        selection: &EmbeddingModelSelection,
+        semantic: &SemanticConfig,
     ) -> Result<Self, StateError> {
-        let endpoint = match provider.as_str() {
-            "voyage" => VOYAGE_EMBED_ENDPOINT.to_string(),
-            "openai" => OPENAI_EMBED_ENDPOINT.to_string(),
-            _ => OPENAI_EMBED_ENDPOINT.to_string(),
-        };
-        let client = shared_embedding_http_client(Duration::from_secs(5))?;
+        let embedding = &semantic.embedding;
+        let timeout_ms = embedding
+            .timeout_ms
+            .unwrap_or(DEFAULT_EMBEDDING_TIMEOUT_MS)
+            .max(1);
+        let client = shared_embedding_http_client(Duration::from_millis(timeout_ms))?;
         Ok(Self {
             provider,
-            model_id,
-            model_version,
-            dimensions,
-            batch_size,
+            model_id: selection.profile.model_name.clone(),
+            model_version: selection.model_version.clone(),
+            dimensions: selection.profile.dimensions,
+            batch_size: selection.batch_size,
             endpoint,
+            auth: ProviderAuth::from_env(
+                embedding.api_key_env.as_deref(),
+                DEFAULT_EMBEDDING_API_KEY_ENV,
+                embedding.auth_header.as_deref(),
+            ),
+            limiter: RateLimiter::per_minute(embedding.requests_per_minute),
             client,
         })
     }
@@ -411,8 +464,10 @@ impl EmbeddingProvider for ExternalEmbeddingProvider {
             return Ok(Vec::new());
         }
 
-        let api_key = std::env::var("CRUXE_EMBEDDING_API_KEY")
-            .map_err(|_| StateError::external("missing_embedding_api_key"))?;
+        // Self-hosted OpenAI-compatible servers usually run without a key.
+        if self.auth.is_none() && self.provider != "openai-compatible" {
+            return Err(StateError::external("missing_embedding_api_key"));
+        }
         let mut all_vectors = Vec::with_capacity(inputs.len());
 
         for chunk in inputs.chunks(self.batch_size) {
@@ -429,10 +484,12 @@ impl EmbeddingProvider for ExternalEmbeddingProvider {
                 })
             };
 
-            let response = self
-                .client
-                .post(&self.endpoint)
-                .bearer_auth(&api_key)
+            self.limiter.wait();
+            let mut request = self.client.post(&self.endpoint);
+            if let Some(auth) = &self.auth {
+                request = auth.apply(request);
+            }
+            let response = request
                 .header("content-type", "application/json")
                 .json(&payload)
                 .send()
@@ -459,6 +516,35 @@ impl EmbeddingProvider for ExternalEmbeddingProvider {
     }
 }
 
+/// Embeds with [`deterministic_embedding`] alone: no model, no network.
+/// Equal inputs get equal vectors, so tests can assert on rankings.
+pub struct FakeEmbeddingProvider {
+    model_id: String,
+    model_version: String,
+    dimensions: usize,
+}
+
+impl EmbeddingProvider for FakeEmbeddingProvider {
+    fn model_id(&self) -> &str {
+        &self.model_id
+    }
+
+    fn model_version(&self) -> &str {
+        &self.model_version
+    }
+
+    fn dimensions(&self) -> usize {
+        self.dimensions
+    }
+
+    fn embed_batch(&mut self, inputs: &[String]) -> Result<Vec<Vec<f32>>, StateError> {
+        Ok(inputs
+            .iter()
+            .map(|input| deterministic_embedding(input, self.dimensions))
+            .collect())
+    }
+}
+
 #[derive(Debug, Deserialize)]
 struct EmbeddingApiResponse {
     data: Vec<EmbeddingData>,
@@ -696,6 +782,65 @@ mod tests {
         assert_eq!(built.provider.model_id(), "NomicEmbedTextV15Q");
     }
 
+    #[test]
+    fn loopback_compatible_server_bypasses_privacy_gates() {
+        let mut cfg = semantic_config();
+        cfg.embedding.provider = "openai-compatible".to_string();
+        cfg.embedding.model = "nomic-embed-text".to_string();
+        cfg.embedding.endpoint = Some("http://localhost:8080/v1".to_string());
+        cfg.external_provider_enabled = false;
+
+        let built = build_embedding_provider(&cfg).unwrap();
+        assert!(!built.external_provider_blocked);
+        assert_eq!(built.provider.model_id(), "nomic-embed-text");
+
+        cfg.embedding.endpoint = Some("https://embeddings.example.com/v1".to_string());
+        let built = build_embedding_provider(&cfg).unwrap();
+        assert!(built.external_provider_blocked);
+    }
+
+    #[test]
+    fn fake_provider_is_deterministic_and_offline() {
+        let mut cfg = semantic_config();
+        cfg.embedding.provider = "fake".to_string();
+        cfg.embedding.dimensions = 16;
+        cfg.external_provider_enabled = false;
+
+        let mut built = build_embedding_provider(&cfg).unwrap();
+        assert!(!built.external_provider_blocked);
+        let inputs = ["alpha".to_string(), "beta".to_string()];
+        let first = built.provider.embed_batch(&inputs).unwrap();
+        let second = built.provider.embed_batch(&inputs).unwrap();
+        assert_eq!(first, second);
+        assert_ne!(first[0], first[1]);
+        assert_eq!(first[0].len(), built.provider.dimensions());
+    }
+
+    #[test]
+    fn embedding_endpoints_resolve_from_base_urls() {
+        assert_eq!(
+            resolve_embedding_endpoint("openai-compatible", None),
+            OPENAI_COMPATIBLE_EMBED_ENDPOINT
+        );
+        assert_eq!(
+            resolve_embedding_endpoint("voyage", None),
+            VOYAGE_EMBED_ENDPOINT
+        );
+        assert_eq!(
+            resolve_embedding_endpoint("openai", Some("http://10.0.0.5:8000/v1/")),
+            "http://10.0.0.5:8000/v1/embeddings"
+        );
+        assert_eq!(
+            resolve_embedding_endpoint("openai", Some("http://gpu:9000/v1/embeddings")),
+            "http://gpu:9000/v1/embeddings"
+        );
+
+        assert!(is_loopback_endpoint("http://127.0.0.1:8080/v1/embeddings"));
+        assert!(is_loopback_endpoint("http://[::1]:8080/v1/embeddings"));
+        assert!(!is_loopback_endpoint("http://10.0.0.5:8000/v1/embeddings"));
+        assert!(!is_loopback_endpoint("not a url"));
+    }
+
     #[test]
     fn fastembed_runtime_flag_defaults_to_enabled() {
         assert!(parse_fastembed_runtime_flag(None));
@@ -1,7 +1,6 @@
 use cruxe_core::error::StateError;
 use cruxe_core::time::now_iso8601;
 use serde::{Deserialize, Serialize};
-use std::fs::File;
 use std::path::Path;
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -42,12 +41,16 @@ pub fn export_bundle(
         )));
     }
 
-    if let Some(parent) = bundle_path.parent() {
-        std::fs::create_dir_all(parent).map_err(StateError::Io)?;
-    }
+    let parent = match bundle_path.parent() {
+        Some(parent) if !parent.as_os_str().is_empty() => parent,
+        _ => Path::new("."),
+    };
+    std::fs::create_dir_all(parent).map_err(StateError::Io)?;
 
-    let file = File::create(bundle_path).map_err(StateError::Io)?;
-    let encoder = zstd::Encoder::new(file, 3).map_err(StateError::Io)?;
+    // Build the bundle in a sibling temp file and rename it into place, so an
+    // interrupted export never leaves a truncated bundle at `bundle_path`.
+    let tmp = tempfile::NamedTempFile::new_in(parent).map_err(StateError::Io)?;
+    let encoder = zstd::Encoder::new(tmp.as_file(), 3).map_err(StateError::Io)?;
     let mut tar = tar::Builder::new(encoder);
 
     let metadata_json = serde_json::to_vec_pretty(metadata)
@@ -68,6 +71,9 @@ pub fn export_bundle(
 
     let encoder = tar.into_inner().map_err(StateError::Io)?;
     encoder.finish().map_err(StateError::Io)?;
+    tmp.as_file().sync_all().map_err(StateError::Io)?;
+    tmp.persist(bundle_path)
+        .map_err(|err| StateError::Io(err.error))?;
     Ok(())
 }
 
@@ -102,4 +108,21 @@ mod tests {
         export_bundle(&data_dir, &out, &metadata).unwrap();
         assert!(out.exists());
     }
+
+    #[test]
+    fn export_replaces_bundle_without_leaving_temp_files() {
+        let tmp = tempfile::tempdir().unwrap();
+        let data_dir = tmp.path().join("data");
+        std::fs::create_dir_all(&data_dir).unwrap();
+        std::fs::write(data_dir.join("state.db"), b"sqlite-bytes").unwrap();
+        let out_dir = tmp.path().join("out");
+        std::fs::create_dir_all(&out_dir).unwrap();
+        let out = out_dir.join("bundle.tar.zst");
+        std::fs::write(&out, b"previous").unwrap();
+
+        let metadata = PortableStateMetadata::new(1, 1, "proj", "/tmp/repo");
+        export_bundle(&data_dir, &out, &metadata).unwrap();
+        assert_ne!(std::fs::read(&out).unwrap(), b"previous");
+        assert_eq!(std::fs::read_dir(&out_dir).unwrap().count(), 1);
+    }
 }
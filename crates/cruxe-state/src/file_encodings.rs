@@ -0,0 +1,108 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, OptionalExtension, params};
+use std::collections::HashMap;
+
+/// Record the encoding a file was transcoded from (`utf-16le`, `latin-1`,
+/// ...); `None`, for plain UTF-8, clears it.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    encoding: Option<&str>,
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    if let Some(encoding) = encoding {
+        conn.execute(
+            "INSERT INTO file_encodings (repo, \"ref\", path, encoding)
+             VALUES (?1, ?2, ?3, ?4)",
+            params![repo, ref_name, path, encoding],
+        )
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the record of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM file_encodings WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// The encoding a file was transcoded from; `None` for plain UTF-8.
+pub fn get_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<Option<String>, StateError> {
+    conn.query_row(
+        "SELECT encoding FROM file_encodings WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+        |row| row.get(0),
+    )
+    .optional()
+    .map_err(StateError::sqlite)
+}
+
+/// Encoding of every transcoded file of a repo/ref, by path.
+pub fn for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<HashMap<String, String>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT path, encoding FROM file_encodings WHERE repo = ?1 AND \"ref\" = ?2",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok((row.get(0)?, row.get(1)?))
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<HashMap<_, _>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn encodings_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        replace_for_file(&conn, "repo", "main", "src/App.cs", Some("utf-16le")).unwrap();
+        replace_for_file(&conn, "repo", "main", "src/Old.java", Some("latin-1")).unwrap();
+        replace_for_file(&conn, "repo", "main", "src/New.java", None).unwrap();
+        assert_eq!(
+            get_for_file(&conn, "repo", "main", "src/App.cs")
+                .unwrap()
+                .as_deref(),
+            Some("utf-16le")
+        );
+        assert_eq!(
+            get_for_file(&conn, "repo", "main", "src/New.java").unwrap(),
+            None
+        );
+        assert_eq!(for_ref(&conn, "repo", "main").unwrap().len(), 2);
+
+        replace_for_file(&conn, "repo", "main", "src/App.cs", None).unwrap();
+        delete_for_file(&conn, "repo", "main", "src/Old.java").unwrap();
+        assert!(for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
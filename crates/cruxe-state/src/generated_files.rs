@@ -0,0 +1,83 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use std::collections::HashSet;
+
+/// Record whether a file is generated code, `reason` naming what gave it
+/// away (`header`, `protobuf`, `mock`, ...); `None` clears the mark.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    reason: Option<&str>,
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    if let Some(reason) = reason {
+        conn.execute(
+            "INSERT INTO generated_files (repo, \"ref\", path, reason)
+             VALUES (?1, ?2, ?3, ?4)",
+            params![repo, ref_name, path, reason],
+        )
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the mark of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM generated_files WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Paths of the generated files of a repo/ref.
+pub fn paths_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<HashSet<String>, StateError> {
+    let mut stmt = conn
+        .prepare_cached("SELECT path FROM generated_files WHERE repo = ?1 AND \"ref\" = ?2")
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| row.get(0))
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<HashSet<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn marks_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        replace_for_file(&conn, "repo", "main", "api/api.pb.go", Some("protobuf")).unwrap();
+        replace_for_file(&conn, "repo", "main", "mocks/store.go", Some("mock")).unwrap();
+        replace_for_file(&conn, "repo", "main", "api/api.go", None).unwrap();
+        replace_for_file(&conn, "repo", "dev", "gen.go", Some("header")).unwrap();
+        let paths = paths_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(
+            paths,
+            HashSet::from(["api/api.pb.go".to_string(), "mocks/store.go".to_string()])
+        );
+
+        replace_for_file(&conn, "repo", "main", "api/api.pb.go", None).unwrap();
+        delete_for_file(&conn, "repo", "main", "mocks/store.go").unwrap();
+        assert!(paths_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
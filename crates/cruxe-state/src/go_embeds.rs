@@ -0,0 +1,184 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::EmbedRecord;
+use rusqlite::types::Type;
+use rusqlite::{Connection, params};
+
+/// Replace the `//go:embed` directives recorded for a Go file. Their files
+/// stay unresolved until [`update_resolution`].
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[EmbedRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO go_embeds (repo, \"ref\", path, line, variable, patterns)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.variable,
+            to_json(&record.patterns)?,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the directives of a Go file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM go_embeds WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Store the resolved files, missing patterns and served flag of each
+/// directive, matched by path and line.
+pub fn update_resolution(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    records: &[EmbedRecord],
+) -> Result<(), StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "UPDATE go_embeds SET files = ?5, missing = ?6, served = ?7
+             WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3 AND line = ?4",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            record.path,
+            record.line,
+            to_json(&record.files)?,
+            to_json(&record.missing)?,
+            record.served,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Directives of a repo/ref ordered by path and line.
+pub fn list_embeds(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<EmbedRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, line, variable, patterns, files, missing, served
+             FROM go_embeds
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(EmbedRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                variable: row.get(2)?,
+                patterns: from_json(row, 3)?,
+                files: from_json(row, 4)?,
+                missing: from_json(row, 5)?,
+                served: row.get(6)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+fn to_json<T: serde::Serialize>(value: &T) -> Result<String, StateError> {
+    serde_json::to_string(value).map_err(|err| StateError::CorruptManifest(err.to_string()))
+}
+
+fn from_json<T: serde::de::DeserializeOwned>(
+    row: &rusqlite::Row<'_>,
+    idx: usize,
+) -> rusqlite::Result<T> {
+    let json: String = row.get(idx)?;
+    serde_json::from_str(&json)
+        .map_err(|err| rusqlite::Error::FromSqlConversionFailure(idx, Type::Text, Box::new(err)))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use cruxe_core::types::EmbeddedFile;
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, variable: &str) -> EmbedRecord {
+        EmbedRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            variable: variable.to_string(),
+            patterns: vec!["static".to_string(), "missing/*".to_string()],
+            files: Vec::new(),
+            missing: Vec::new(),
+            served: false,
+        }
+    }
+
+    #[test]
+    fn directives_are_replaced_per_file_and_resolved_in_place() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let web = [
+            record("web/embed.go", 3, "assets"),
+            record("web/embed.go", 9, "public"),
+        ];
+        replace_for_file(&conn, "repo", "main", "web/embed.go", &web).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "cli/help.go",
+            &[record("cli/help.go", 5, "help")],
+        )
+        .unwrap();
+        assert_eq!(list_embeds(&conn, "repo", "main").unwrap().len(), 3);
+
+        let mut resolved = web[0].clone();
+        resolved.files = vec![EmbeddedFile {
+            path: "web/static/logo.png".to_string(),
+            size: 512,
+            referenced: false,
+        }];
+        resolved.missing = vec!["missing/*".to_string()];
+        resolved.served = true;
+        update_resolution(&conn, "repo", "main", std::slice::from_ref(&resolved)).unwrap();
+
+        replace_for_file(&conn, "repo", "main", "cli/help.go", &[]).unwrap();
+        assert_eq!(
+            list_embeds(&conn, "repo", "main").unwrap(),
+            vec![resolved, web[1].clone()]
+        );
+    }
+}
@@ -0,0 +1,141 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, OptionalExtension, params};
+
+/// A Go module of the workspace.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct GoModule {
+    /// Module path from its `module` directive, e.g. `example.com/acme/api`.
+    pub module_path: String,
+    /// Repository-relative directory of its `go.mod`; empty for the root.
+    pub dir: String,
+}
+
+/// Replace the modules recorded for a ref (every index run rediscovers them).
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    modules: &[GoModule],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM go_modules WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR IGNORE INTO go_modules (repo, \"ref\", module_path, dir)
+             VALUES (?1, ?2, ?3, ?4)",
+        )
+        .map_err(StateError::sqlite)?;
+    for module in modules {
+        stmt.execute(params![repo, ref_name, module.module_path, module.dir])
+            .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<GoModule>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT module_path, dir FROM go_modules
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY module_path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(GoModule {
+                module_path: row.get(0)?,
+                dir: row.get(1)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// Repository-relative directory of the package `import_path`, through the
+/// module with the longest matching path; `None` for packages outside the
+/// workspace.
+pub fn package_dir(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    import_path: &str,
+) -> Result<Option<String>, StateError> {
+    let module = conn
+        .query_row(
+            "SELECT module_path, dir FROM go_modules
+             WHERE repo = ?1 AND \"ref\" = ?2
+               AND (module_path = ?3 OR ?3 LIKE module_path || '/%')
+             ORDER BY length(module_path) DESC
+             LIMIT 1",
+            params![repo, ref_name, import_path],
+            |row| {
+                Ok(GoModule {
+                    module_path: row.get(0)?,
+                    dir: row.get(1)?,
+                })
+            },
+        )
+        .optional()
+        .map_err(StateError::sqlite)?;
+    Ok(module.map(|module| {
+        let rest = import_path[module.module_path.len()..].trim_start_matches('/');
+        match (module.dir.is_empty(), rest.is_empty()) {
+            (_, true) => module.dir,
+            (true, false) => rest.to_string(),
+            (false, false) => format!("{}/{rest}", module.dir),
+        }
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn import_paths_map_through_the_longest_module() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let module = |path: &str, dir: &str| GoModule {
+            module_path: path.to_string(),
+            dir: dir.to_string(),
+        };
+        replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                module("example.com/acme", ""),
+                module("example.com/acme/billing", "services/billing"),
+            ],
+        )
+        .unwrap();
+
+        let lookup = |path: &str| package_dir(&conn, "repo", "main", path).unwrap();
+        assert_eq!(
+            lookup("example.com/acme/billing/invoice").as_deref(),
+            Some("services/billing/invoice")
+        );
+        assert_eq!(
+            lookup("example.com/acme/billing").as_deref(),
+            Some("services/billing")
+        );
+        assert_eq!(lookup("example.com/acme/auth").as_deref(), Some("auth"));
+        // A shared prefix that is not a path boundary is a different module.
+        assert_eq!(lookup("example.com/acmebank/x"), None);
+        assert_eq!(lookup("github.com/pkg/errors"), None);
+
+        replace_for_ref(&conn, "repo", "main", &[]).unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -0,0 +1,128 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::TemplateRecord;
+use rusqlite::types::Type;
+use rusqlite::{Connection, params};
+
+/// Replace every template recorded for a repo/ref. Template files are few
+/// and cheap to parse, so each index run rewrites them all.
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    records: &[TemplateRecord],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM go_templates WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO go_templates (repo, \"ref\", path, name, kind, line, fields, calls)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        let fields = serde_json::to_string(&record.fields)
+            .map_err(|err| StateError::CorruptManifest(err.to_string()))?;
+        let calls = serde_json::to_string(&record.calls)
+            .map_err(|err| StateError::CorruptManifest(err.to_string()))?;
+        stmt.execute(params![
+            repo,
+            ref_name,
+            record.path,
+            record.name,
+            record.kind,
+            record.line,
+            fields,
+            calls,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Templates of a repo/ref ordered by path and line.
+pub fn list_templates(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<TemplateRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, name, kind, line, fields, calls
+             FROM go_templates
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            let fields: String = row.get(4)?;
+            let calls: String = row.get(5)?;
+            Ok(TemplateRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                name: row.get(1)?,
+                kind: row.get(2)?,
+                line: row.get(3)?,
+                fields: serde_json::from_str(&fields).map_err(|err| {
+                    rusqlite::Error::FromSqlConversionFailure(4, Type::Text, Box::new(err))
+                })?,
+                calls: serde_json::from_str(&calls).map_err(|err| {
+                    rusqlite::Error::FromSqlConversionFailure(5, Type::Text, Box::new(err))
+                })?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use cruxe_core::types::{TemplateCall, TemplateFieldRef};
+    use tempfile::tempdir;
+
+    fn record(path: &str, name: &str, line: u32) -> TemplateRecord {
+        TemplateRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            name: name.to_string(),
+            kind: "define".to_string(),
+            line,
+            fields: vec![TemplateFieldRef {
+                line: line + 1,
+                chain: vec!["User".to_string(), "Name".to_string()],
+            }],
+            calls: vec![TemplateCall {
+                name: "footer".to_string(),
+                line: line + 2,
+                arg: None,
+            }],
+        }
+    }
+
+    #[test]
+    fn templates_round_trip_and_are_replaced_per_ref() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let first = [record("web/b.tmpl", "b", 1), record("web/a.tmpl", "a", 4)];
+        replace_for_ref(&conn, "repo", "main", &first).unwrap();
+        replace_for_ref(&conn, "repo", "feat", &first[..1]).unwrap();
+        assert_eq!(
+            list_templates(&conn, "repo", "main").unwrap(),
+            vec![first[1].clone(), first[0].clone()]
+        );
+
+        replace_for_ref(&conn, "repo", "main", &first[..1]).unwrap();
+        assert_eq!(list_templates(&conn, "repo", "main").unwrap().len(), 1);
+        assert_eq!(list_templates(&conn, "repo", "feat").unwrap().len(), 1);
+    }
+}
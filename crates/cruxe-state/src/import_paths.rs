@@ -0,0 +1,167 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+
+/// A mapping from import specifiers to repository paths, derived from the
+/// `[languages]` settings of an index run: Python source roots and
+/// virtualenv packages, TypeScript `baseUrl` and `paths`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ImportPath {
+    /// `python` or `typescript`.
+    pub language: String,
+    /// Specifier with at most one `*`, e.g. `@app/*`. Python modules are
+    /// written with `/` separators.
+    pub pattern: String,
+    /// Repository-relative path the pattern stands for, `*` replaced by
+    /// what it matched; `None` when the pattern names a third-party package.
+    pub target: Option<String>,
+}
+
+/// What an import specifier maps to.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Mapping {
+    /// Repository path to look for, without an extension.
+    Path(String),
+    /// The specifier is a module of a third-party package.
+    External,
+}
+
+impl ImportPath {
+    /// Where `spec` maps to, or `None` when the pattern does not match it.
+    /// A package pattern matches the package and every module below it.
+    pub fn map(&self, spec: &str) -> Option<Mapping> {
+        let Some(target) = &self.target else {
+            let below = spec
+                .strip_prefix(self.pattern.as_str())
+                .is_some_and(|rest| rest.is_empty() || rest.starts_with('/'));
+            return below.then_some(Mapping::External);
+        };
+        let Some((prefix, suffix)) = self.pattern.split_once('*') else {
+            return (spec == self.pattern).then(|| Mapping::Path(target.clone()));
+        };
+        let matched = spec.strip_prefix(prefix)?.strip_suffix(suffix)?;
+        Some(Mapping::Path(target.replacen('*', matched, 1)))
+    }
+}
+
+/// Replace the mappings recorded for a ref (every index run rederives them).
+/// Mappings of a language are tried in the order given.
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    paths: &[ImportPath],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM import_paths WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR IGNORE INTO import_paths
+                (repo, \"ref\", language, position, pattern, target)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+        )
+        .map_err(StateError::sqlite)?;
+    for (position, path) in paths.iter().enumerate() {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path.language,
+            position as i64,
+            path.pattern,
+            path.target.as_deref().unwrap_or_default()
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+pub fn list_for_language(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    language: &str,
+) -> Result<Vec<ImportPath>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT language, pattern, target FROM import_paths
+             WHERE repo = ?1 AND \"ref\" = ?2 AND language = ?3
+             ORDER BY position",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name, language], |row| {
+            let target: String = row.get(2)?;
+            Ok(ImportPath {
+                language: row.get(0)?,
+                pattern: row.get(1)?,
+                target: (!target.is_empty()).then_some(target),
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn path(language: &str, pattern: &str, target: Option<&str>) -> ImportPath {
+        ImportPath {
+            language: language.to_string(),
+            pattern: pattern.to_string(),
+            target: target.map(str::to_string),
+        }
+    }
+
+    #[test]
+    fn patterns_map_specifiers_in_recorded_order() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                path("typescript", "@app/*", Some("web/src/app/*")),
+                path("typescript", "config", Some("web/src/config")),
+                path("python", "requests", None),
+                path("python", "*", Some("src/*")),
+            ],
+        )
+        .unwrap();
+
+        let typescript = list_for_language(&conn, "repo", "main", "typescript").unwrap();
+        assert_eq!(typescript.len(), 2);
+        assert_eq!(
+            typescript[0].map("@app/auth/jwt"),
+            Some(Mapping::Path("web/src/app/auth/jwt".to_string()))
+        );
+        assert_eq!(typescript[0].map("@apple/x"), None);
+        assert_eq!(
+            typescript[1].map("config"),
+            Some(Mapping::Path("web/src/config".to_string()))
+        );
+        assert_eq!(typescript[1].map("config/dev"), None);
+
+        let python = list_for_language(&conn, "repo", "main", "python").unwrap();
+        assert_eq!(python[0].map("requests/adapters"), Some(Mapping::External));
+        assert_eq!(python[0].map("requests_oauth"), None);
+        assert_eq!(
+            python[1].map("auth/jwt"),
+            Some(Mapping::Path("src/auth/jwt".to_string()))
+        );
+
+        replace_for_ref(&conn, "repo", "main", &[]).unwrap();
+        assert!(
+            list_for_language(&conn, "repo", "main", "python")
+                .unwrap()
+                .is_empty()
+        );
+    }
+}
@@ -0,0 +1,203 @@
+//! Write-ahead marker for full/incremental index runs.
+//!
+//! SQLite rows are auto-committed per statement while Tantivy only commits at
+//! the end of a run, so a process killed in between (OOM, CI timeout) leaves
+//! manifest hashes that claim files are indexed when their search documents
+//! were never committed. The journal records that a run is in flight: it is
+//! written (atomically, via rename) before the first write and removed only
+//! after both stores are committed. A journal found on disk whose lock is not
+//! held belongs to a dead process, and the next run must not trust the
+//! manifest of that ref.
+
+use cruxe_core::error::StateError;
+use fs4::FileExt;
+use serde::{Deserialize, Serialize};
+use std::fs::{File, OpenOptions};
+use std::io::Write;
+use std::path::{Path, PathBuf};
+
+const JOURNAL_FILE: &str = "index.journal";
+const JOURNAL_LOCK_FILE: &str = "index.journal.lock";
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct JournalEntry {
+    pub job_id: String,
+    #[serde(rename = "ref")]
+    pub r#ref: String,
+    pub pid: u32,
+    pub started_at: String,
+}
+
+/// An open journal. Holds the journal lock until committed or dropped; a
+/// dropped (uncommitted) journal stays on disk so the next run recovers.
+pub struct IndexJournal {
+    lock: File,
+    path: PathBuf,
+}
+
+impl IndexJournal {
+    /// Write the journal for `entry` and hold its lock for the run.
+    pub fn begin(data_dir: &Path, entry: &JournalEntry) -> Result<Self, StateError> {
+        std::fs::create_dir_all(data_dir).map_err(StateError::Io)?;
+        let lock = open_lock(data_dir)?;
+        lock.try_lock_exclusive()
+            .map_err(|err| lock_error(err, data_dir))?;
+
+        let path = journal_path(data_dir);
+        let payload = serde_json::to_vec(entry)
+            .map_err(|err| StateError::CorruptManifest(err.to_string()))?;
+        write_atomic(&path, &payload)?;
+        Ok(Self { lock, path })
+    }
+
+    /// Both stores are committed: remove the journal and release the lock.
+    pub fn commit(self) -> Result<(), StateError> {
+        match std::fs::remove_file(&self.path) {
+            Ok(()) => {}
+            Err(err) if err.kind() == std::io::ErrorKind::NotFound => {}
+            Err(err) => return Err(StateError::Io(err)),
+        }
+        if let Some(parent) = self.path.parent() {
+            sync_dir(parent);
+        }
+        Ok(())
+    }
+}
+
+impl Drop for IndexJournal {
+    fn drop(&mut self) {
+        let _ = self.lock.unlock();
+    }
+}
+
+/// Return the journal left behind by a run that died before committing, and
+/// clear it. Errors if another live process is still indexing.
+pub fn take_stale(data_dir: &Path) -> Result<Option<JournalEntry>, StateError> {
+    let path = journal_path(data_dir);
+    if !path.exists() {
+        return Ok(None);
+    }
+    let lock = open_lock(data_dir)?;
+    lock.try_lock_exclusive()
+        .map_err(|err| lock_error(err, data_dir))?;
+
+    // An unreadable journal still proves a run died mid-write; recover it
+    // with an empty entry so the caller distrusts every ref.
+    let entry = std::fs::read(&path)
+        .ok()
+        .and_then(|bytes| serde_json::from_slice::<JournalEntry>(&bytes).ok())
+        .unwrap_or_else(|| JournalEntry {
+            job_id: String::new(),
+            r#ref: String::new(),
+            pid: 0,
+            started_at: String::new(),
+        });
+    std::fs::remove_file(&path).map_err(StateError::Io)?;
+    let _ = lock.unlock();
+    Ok(Some(entry))
+}
+
+fn journal_path(data_dir: &Path) -> PathBuf {
+    data_dir.join(JOURNAL_FILE)
+}
+
+fn open_lock(data_dir: &Path) -> Result<File, StateError> {
+    OpenOptions::new()
+        .create(true)
+        .read(true)
+        .write(true)
+        .truncate(false)
+        .open(data_dir.join(JOURNAL_LOCK_FILE))
+        .map_err(StateError::Io)
+}
+
+fn lock_error(err: std::io::Error, data_dir: &Path) -> StateError {
+    if err.kind() == std::io::ErrorKind::WouldBlock {
+        StateError::maintenance_lock_busy(
+            "index",
+            data_dir.join(JOURNAL_LOCK_FILE).display().to_string(),
+        )
+    } else {
+        StateError::Io(err)
+    }
+}
+
+/// Write `payload` to a sibling temp file, fsync it, then rename over `path`
+/// so readers only ever observe the old or the new content.
+pub fn write_atomic(path: &Path, payload: &[u8]) -> Result<(), StateError> {
+    let dir = path.parent().unwrap_or_else(|| Path::new("."));
+    let mut tmp = tempfile::NamedTempFile::new_in(dir).map_err(StateError::Io)?;
+    tmp.write_all(payload).map_err(StateError::Io)?;
+    tmp.as_file().sync_all().map_err(StateError::Io)?;
+    tmp.persist(path).map_err(|err| StateError::Io(err.error))?;
+    sync_dir(dir);
+    Ok(())
+}
+
+/// Best effort: make the rename itself durable. Not supported on every
+/// platform, so failures are ignored.
+fn sync_dir(dir: &Path) {
+    if let Ok(handle) = File::open(dir) {
+        let _ = handle.sync_all();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn entry(job_id: &str) -> JournalEntry {
+        JournalEntry {
+            job_id: job_id.to_string(),
+            r#ref: "main".to_string(),
+            pid: std::process::id(),
+            started_at: "2026-01-01T00:00:00Z".to_string(),
+        }
+    }
+
+    #[test]
+    fn committed_journal_leaves_nothing_to_recover() {
+        let tmp = tempfile::tempdir().unwrap();
+        let journal = IndexJournal::begin(tmp.path(), &entry("job-1")).unwrap();
+        assert!(journal_path(tmp.path()).exists());
+        journal.commit().unwrap();
+        assert_eq!(take_stale(tmp.path()).unwrap(), None);
+    }
+
+    #[test]
+    fn abandoned_journal_is_recovered_once() {
+        let tmp = tempfile::tempdir().unwrap();
+        drop(IndexJournal::begin(tmp.path(), &entry("job-2")).unwrap());
+
+        let stale = take_stale(tmp.path()).unwrap().expect("stale journal");
+        assert_eq!(stale.job_id, "job-2");
+        assert_eq!(stale.r#ref, "main");
+        assert_eq!(take_stale(tmp.path()).unwrap(), None);
+    }
+
+    #[test]
+    fn live_journal_is_not_taken() {
+        let tmp = tempfile::tempdir().unwrap();
+        let _journal = IndexJournal::begin(tmp.path(), &entry("job-3")).unwrap();
+        let err = take_stale(tmp.path()).unwrap_err();
+        assert!(matches!(err, StateError::MaintenanceLockBusy { .. }));
+    }
+
+    #[test]
+    fn truncated_journal_is_still_recovered() {
+        let tmp = tempfile::tempdir().unwrap();
+        std::fs::write(journal_path(tmp.path()), b"{\"job_id\":").unwrap();
+        let stale = take_stale(tmp.path()).unwrap().expect("stale journal");
+        assert!(stale.r#ref.is_empty());
+    }
+
+    #[test]
+    fn write_atomic_replaces_existing_content() {
+        let tmp = tempfile::tempdir().unwrap();
+        let path = tmp.path().join("out.json");
+        write_atomic(&path, b"old").unwrap();
+        write_atomic(&path, b"new").unwrap();
+        assert_eq!(std::fs::read(&path).unwrap(), b"new");
+        assert_eq!(std::fs::read_dir(tmp.path()).unwrap().count(), 1);
+    }
+}
@@ -0,0 +1,108 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, OptionalExtension, params};
+
+/// Whether the last index run of a ref kept function bodies; `None` if the
+/// ref was never indexed with a recorded mode.
+pub fn bodies_indexed(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Option<bool>, StateError> {
+    conn.query_row(
+        "SELECT bodies FROM index_modes WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+        |row| row.get(0),
+    )
+    .optional()
+    .map_err(StateError::sqlite)
+}
+
+/// Record the mode of a finished index run.
+pub fn set_bodies_indexed(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    bodies: bool,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO index_modes (repo, \"ref\", bodies) VALUES (?1, ?2, ?3)
+         ON CONFLICT(repo, \"ref\") DO UPDATE SET bodies = excluded.bodies",
+        params![repo, ref_name, bodies],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Dependency indexing mode (`none`, `signatures` or `full`) of the last
+/// index run of a ref; `None` if it was never recorded.
+pub fn dependencies_indexed(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Option<String>, StateError> {
+    conn.query_row(
+        "SELECT dependencies FROM index_modes WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+        |row| row.get(0),
+    )
+    .optional()
+    .map(Option::flatten)
+    .map_err(StateError::sqlite)
+}
+
+/// Record the dependency indexing mode of a finished index run.
+pub fn set_dependencies_indexed(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    mode: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO index_modes (repo, \"ref\", dependencies) VALUES (?1, ?2, ?3)
+         ON CONFLICT(repo, \"ref\") DO UPDATE SET dependencies = excluded.dependencies",
+        params![repo, ref_name, mode],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn mode_is_recorded_per_ref() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        assert_eq!(bodies_indexed(&conn, "repo", "main").unwrap(), None);
+        set_bodies_indexed(&conn, "repo", "main", false).unwrap();
+        set_bodies_indexed(&conn, "repo", "feat", true).unwrap();
+        assert_eq!(bodies_indexed(&conn, "repo", "feat").unwrap(), Some(true));
+        assert_eq!(bodies_indexed(&conn, "repo", "main").unwrap(), Some(false));
+        set_bodies_indexed(&conn, "repo", "main", true).unwrap();
+        assert_eq!(bodies_indexed(&conn, "repo", "main").unwrap(), Some(true));
+    }
+
+    #[test]
+    fn dependency_mode_is_recorded_alongside_bodies() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        assert_eq!(dependencies_indexed(&conn, "repo", "main").unwrap(), None);
+        set_bodies_indexed(&conn, "repo", "main", false).unwrap();
+        assert_eq!(dependencies_indexed(&conn, "repo", "main").unwrap(), None);
+        set_dependencies_indexed(&conn, "repo", "main", "signatures").unwrap();
+        assert_eq!(
+            dependencies_indexed(&conn, "repo", "main")
+                .unwrap()
+                .as_deref(),
+            Some("signatures")
+        );
+        assert_eq!(bodies_indexed(&conn, "repo", "main").unwrap(), Some(false));
+    }
+}
@@ -0,0 +1,155 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::InjectionRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the embedded-language strings recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[InjectionRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO string_injections
+                (repo, \"ref\", path, line, language, host, symbol_id, symbol, content, tables, error)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.language,
+            record.host,
+            record.symbol_id,
+            record.symbol,
+            record.content,
+            record.tables.join(","),
+            record.error,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the embedded-language strings of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM string_injections WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Embedded-language strings of a repo/ref, optionally of one language,
+/// ordered by path and line.
+pub fn list_injections(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    language: Option<&str>,
+) -> Result<Vec<InjectionRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, line, language, host, symbol_id, symbol, content, tables, error
+             FROM string_injections
+             WHERE repo = ?1 AND \"ref\" = ?2 AND (?3 IS NULL OR language = ?3)
+             ORDER BY path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name, language], |row| {
+            let tables: String = row.get(7)?;
+            Ok(InjectionRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                language: row.get(2)?,
+                host: row.get(3)?,
+                symbol_id: row.get(4)?,
+                symbol: row.get(5)?,
+                content: row.get(6)?,
+                tables: tables
+                    .split(',')
+                    .filter(|table| !table.is_empty())
+                    .map(str::to_string)
+                    .collect(),
+                error: row.get(8)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, language: &str, tables: &[&str]) -> InjectionRecord {
+        InjectionRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            language: language.to_string(),
+            host: Some("db.Query".to_string()),
+            symbol_id: None,
+            symbol: None,
+            content: "SELECT id FROM users".to_string(),
+            tables: tables.iter().map(|table| table.to_string()).collect(),
+            error: None,
+        }
+    }
+
+    #[test]
+    fn records_are_replaced_per_file_and_filtered_by_language() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [
+            record("a.go", 3, "sql", &["users", "orders"]),
+            record("a.go", 9, "regex", &[]),
+        ];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "b.go",
+            &[record("b.go", 1, "sql", &[])],
+        )
+        .unwrap();
+        assert_eq!(
+            list_injections(&conn, "repo", "main", None).unwrap().len(),
+            3
+        );
+
+        let sql = list_injections(&conn, "repo", "main", Some("sql")).unwrap();
+        assert_eq!(sql[0], a[0]);
+        assert!(sql[1].tables.is_empty());
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(
+            list_injections(&conn, "repo", "main", None)
+                .unwrap()
+                .is_empty()
+        );
+    }
+}
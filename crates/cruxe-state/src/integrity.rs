@@ -0,0 +1,292 @@
+//! Consistency checks between the persisted index and the working tree,
+//! backing `cruxe doctor`.
+
+use crate::schema::CURRENT_SCHEMA_VERSION;
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use std::collections::BTreeSet;
+use std::path::Path;
+
+/// An edge whose endpoint no longer exists in `symbol_relations`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DanglingEdge {
+    pub from_symbol_id: String,
+    pub to_symbol_id: Option<String>,
+    pub edge_type: String,
+    /// File the edge was extracted from, when known. Re-indexing it rebuilds
+    /// the edge.
+    pub source_path: Option<String>,
+}
+
+/// Manifest entries that disagree with the files on disk.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct WorkingTreeDrift {
+    pub missing_files: Vec<String>,
+    pub hash_mismatches: Vec<String>,
+}
+
+/// Edges whose target symbol id, or whose (non-file) source symbol id, does
+/// not resolve within the same repo/ref.
+pub fn find_dangling_edges(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<DanglingEdge>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT e.from_symbol_id, e.to_symbol_id, e.edge_type, e.source_file
+             FROM symbol_edges e
+             WHERE e.repo = ?1 AND e.\"ref\" = ?2
+               AND (
+                 (e.to_symbol_id IS NOT NULL AND NOT EXISTS (
+                    SELECT 1 FROM symbol_relations s
+                    WHERE s.repo = e.repo AND s.\"ref\" = e.\"ref\"
+                      AND s.symbol_stable_id = e.to_symbol_id))
+                 OR (e.from_symbol_id NOT LIKE 'file::%' AND NOT EXISTS (
+                    SELECT 1 FROM symbol_relations s
+                    WHERE s.repo = e.repo AND s.\"ref\" = e.\"ref\"
+                      AND s.symbol_stable_id = e.from_symbol_id))
+               )
+             ORDER BY e.from_symbol_id, e.edge_type",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            let from_symbol_id: String = row.get(0)?;
+            let source_file: Option<String> = row.get(3)?;
+            let source_path = source_file.or_else(|| {
+                from_symbol_id
+                    .strip_prefix("file::")
+                    .map(ToString::to_string)
+            });
+            Ok(DanglingEdge {
+                from_symbol_id,
+                to_symbol_id: row.get(1)?,
+                edge_type: row.get(2)?,
+                source_path,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// Remove the edges reported by [`find_dangling_edges`]. Returns the number
+/// of rows deleted.
+pub fn delete_dangling_edges(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<usize, StateError> {
+    conn.execute(
+        "DELETE FROM symbol_edges
+         WHERE repo = ?1 AND \"ref\" = ?2
+           AND (
+             (to_symbol_id IS NOT NULL AND NOT EXISTS (
+                SELECT 1 FROM symbol_relations s
+                WHERE s.repo = symbol_edges.repo AND s.\"ref\" = symbol_edges.\"ref\"
+                  AND s.symbol_stable_id = symbol_edges.to_symbol_id))
+             OR (from_symbol_id NOT LIKE 'file::%' AND NOT EXISTS (
+                SELECT 1 FROM symbol_relations s
+                WHERE s.repo = symbol_edges.repo AND s.\"ref\" = symbol_edges.\"ref\"
+                  AND s.symbol_stable_id = symbol_edges.from_symbol_id))
+           )",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)
+}
+
+/// Paths that still have symbols but no manifest entry, i.e. symbols left
+/// behind for a file the index no longer tracks.
+pub fn find_orphan_symbol_paths(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<String>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT DISTINCT s.path FROM symbol_relations s
+             WHERE s.repo = ?1 AND s.\"ref\" = ?2
+               AND NOT EXISTS (
+                 SELECT 1 FROM file_manifest m
+                 WHERE m.repo = s.repo AND m.\"ref\" = s.\"ref\" AND m.path = s.path)
+             ORDER BY s.path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| row.get(0))
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// Compare manifest hashes for `ref_name` against the files under
+/// `repo_root`. Only meaningful for the ref checked out in the working tree.
+pub fn check_working_tree(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    repo_root: &Path,
+) -> Result<WorkingTreeDrift, StateError> {
+    let mut drift = WorkingTreeDrift::default();
+    for entry in crate::manifest::get_all_entries(conn, repo, ref_name)? {
+        match std::fs::read(repo_root.join(&entry.path)) {
+            Ok(bytes) => {
+                if blake3::hash(&bytes).to_hex().as_str() != entry.content_hash {
+                    drift.hash_mismatches.push(entry.path);
+                }
+            }
+            Err(err) if err.kind() == std::io::ErrorKind::NotFound => {
+                drift.missing_files.push(entry.path);
+            }
+            Err(err) => return Err(StateError::Io(err)),
+        }
+    }
+    drift.missing_files.sort();
+    drift.hash_mismatches.sort();
+    Ok(drift)
+}
+
+/// Highest applied schema migration, if the migrations table exists.
+pub fn applied_schema_version(conn: &Connection) -> Result<Option<u32>, StateError> {
+    match conn.query_row("SELECT MAX(version) FROM schema_migrations", [], |row| {
+        row.get::<_, Option<u32>>(0)
+    }) {
+        Ok(version) => Ok(version),
+        Err(rusqlite::Error::SqliteFailure(_, Some(message)))
+            if message.contains("no such table") =>
+        {
+            Ok(None)
+        }
+        Err(err) => Err(StateError::sqlite(err)),
+    }
+}
+
+/// Whether the database was migrated by a newer cruxe than this binary.
+pub fn schema_is_newer_than_binary(applied: Option<u32>) -> bool {
+    applied.is_some_and(|version| version > CURRENT_SCHEMA_VERSION)
+}
+
+/// Source paths that must be re-indexed to rebuild `edges`.
+pub fn affected_paths(edges: &[DanglingEdge]) -> Vec<String> {
+    edges
+        .iter()
+        .filter_map(|edge| edge.source_path.clone())
+        .collect::<BTreeSet<_>>()
+        .into_iter()
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, manifest, schema};
+
+    fn setup_test_db() -> (tempfile::TempDir, Connection) {
+        let dir = tempfile::tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (dir, conn)
+    }
+
+    fn insert_symbol(conn: &Connection, path: &str, stable_id: &str) {
+        conn.execute(
+            "INSERT INTO symbol_relations
+             (repo, \"ref\", path, symbol_id, symbol_stable_id, name, qualified_name, kind,
+              language, line_start, line_end, content_hash)
+             VALUES ('repo', 'main', ?1, ?2, ?2, ?2, ?2, 'function', 'rust', 1, 1, 'h')",
+            params![path, stable_id],
+        )
+        .unwrap();
+    }
+
+    fn insert_edge(conn: &Connection, from: &str, to: &str, source_file: Option<&str>) {
+        conn.execute(
+            "INSERT INTO symbol_edges
+             (repo, \"ref\", from_symbol_id, to_symbol_id, edge_type, source_file)
+             VALUES ('repo', 'main', ?1, ?2, 'calls', ?3)",
+            params![from, to, source_file],
+        )
+        .unwrap();
+    }
+
+    fn insert_manifest(conn: &Connection, path: &str, content: &[u8]) {
+        manifest::upsert_manifest(
+            conn,
+            &manifest::ManifestEntry {
+                repo: "repo".to_string(),
+                r#ref: "main".to_string(),
+                path: path.to_string(),
+                content_hash: blake3::hash(content).to_hex().to_string(),
+                size_bytes: content.len() as u64,
+                mtime_ns: None,
+                language: Some("rust".to_string()),
+                indexed_at: "2026-01-01T00:00:00Z".to_string(),
+            },
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn dangling_edges_are_found_and_deleted() {
+        let (_dir, conn) = setup_test_db();
+        insert_symbol(&conn, "src/a.rs", "a");
+        insert_symbol(&conn, "src/b.rs", "b");
+        insert_edge(&conn, "a", "b", Some("src/a.rs"));
+        insert_edge(&conn, "a", "gone", Some("src/a.rs"));
+        insert_edge(&conn, "file::src/b.rs", "gone", None);
+        insert_edge(&conn, "file::src/b.rs", "a", None);
+
+        let dangling = find_dangling_edges(&conn, "repo", "main").unwrap();
+        assert_eq!(dangling.len(), 2);
+        assert_eq!(affected_paths(&dangling), vec!["src/a.rs", "src/b.rs"]);
+
+        assert_eq!(delete_dangling_edges(&conn, "repo", "main").unwrap(), 2);
+        assert!(
+            find_dangling_edges(&conn, "repo", "main")
+                .unwrap()
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn orphan_symbols_have_no_manifest_entry() {
+        let (_dir, conn) = setup_test_db();
+        insert_symbol(&conn, "src/a.rs", "a");
+        insert_symbol(&conn, "src/gone.rs", "gone");
+        insert_manifest(&conn, "src/a.rs", b"fn a() {}\n");
+
+        let orphans = find_orphan_symbol_paths(&conn, "repo", "main").unwrap();
+        assert_eq!(orphans, vec!["src/gone.rs"]);
+    }
+
+    #[test]
+    fn working_tree_drift_reports_missing_and_changed_files() {
+        let (dir, conn) = setup_test_db();
+        let root = dir.path().join("repo");
+        std::fs::create_dir_all(root.join("src")).unwrap();
+        std::fs::write(root.join("src/same.rs"), b"fn same() {}\n").unwrap();
+        std::fs::write(root.join("src/edited.rs"), b"fn edited() { 1 }\n").unwrap();
+        insert_manifest(&conn, "src/same.rs", b"fn same() {}\n");
+        insert_manifest(&conn, "src/edited.rs", b"fn edited() {}\n");
+        insert_manifest(&conn, "src/deleted.rs", b"fn deleted() {}\n");
+
+        let drift = check_working_tree(&conn, "repo", "main", &root).unwrap();
+        assert_eq!(drift.missing_files, vec!["src/deleted.rs"]);
+        assert_eq!(drift.hash_mismatches, vec!["src/edited.rs"]);
+    }
+
+    #[test]
+    fn schema_version_skew_is_detected() {
+        let (_dir, conn) = setup_test_db();
+        let applied = applied_schema_version(&conn).unwrap();
+        assert_eq!(applied, Some(CURRENT_SCHEMA_VERSION));
+        assert!(!schema_is_newer_than_binary(applied));
+        assert!(schema_is_newer_than_binary(Some(
+            CURRENT_SCHEMA_VERSION + 1
+        )));
+
+        let bare = Connection::open_in_memory().unwrap();
+        assert_eq!(applied_schema_version(&bare).unwrap(), None);
+    }
+}
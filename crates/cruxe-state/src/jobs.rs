@@ -181,6 +181,23 @@ pub fn mark_interrupted_jobs(conn: &Connection) -> Result<usize, StateError> {
     Ok(count)
 }
 
+/// Mark a single job as interrupted if it is still active, e.g. when its
+/// process died without updating the row. Returns whether the row changed.
+pub fn mark_job_interrupted(
+    conn: &Connection,
+    job_id: &str,
+    error_message: &str,
+) -> Result<bool, StateError> {
+    let count = conn
+        .execute(
+            "UPDATE index_jobs SET status = 'interrupted', error_message = ?1, updated_at = ?2
+             WHERE job_id = ?3 AND status IN ('queued', 'running', 'validating')",
+            params![error_message, cruxe_core::time::now_iso8601(), job_id],
+        )
+        .map_err(StateError::sqlite)?;
+    Ok(count > 0)
+}
+
 /// Get interrupted jobs (for recovery reporting).
 pub fn get_interrupted_jobs(conn: &Connection) -> Result<Vec<IndexJob>, StateError> {
     let mut stmt = conn.prepare(
@@ -425,6 +442,27 @@ mod tests {
         assert_eq!(active.updated_at, "2026-01-01T01:00:00Z");
     }
 
+    #[test]
+    fn test_mark_job_interrupted_only_touches_active_job() {
+        let conn = setup_test_db();
+        insert_test_project(&conn, "proj_1");
+
+        let mut job = sample_job("proj_1");
+        job.status = JobStatus::Running.as_str().to_string();
+        create_job(&conn, &job).unwrap();
+
+        assert!(mark_job_interrupted(&conn, "job_001", "process exited").unwrap());
+        assert!(get_active_job(&conn, "proj_1").unwrap().is_none());
+        let interrupted = get_interrupted_jobs(&conn).unwrap();
+        assert_eq!(
+            interrupted[0].error_message.as_deref(),
+            Some("process exited")
+        );
+
+        // Already terminal: no further change.
+        assert!(!mark_job_interrupted(&conn, "job_001", "again").unwrap());
+    }
+
     #[test]
     fn test_update_job_status_to_published() {
         let conn = setup_test_db();
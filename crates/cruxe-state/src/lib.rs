@@ -1,20 +1,51 @@
+pub mod artifact;
+pub mod blob_artifacts;
 pub mod branch_state;
+pub mod concurrency;
 pub mod db;
 pub mod edges;
+pub mod embedded_files;
 pub mod embedding;
 pub mod export;
+pub mod file_encodings;
+pub mod generated_files;
+pub mod go_embeds;
+pub mod go_modules;
+pub mod go_templates;
 pub mod import;
+pub mod import_paths;
+pub mod index_journal;
+pub mod index_modes;
+pub mod injections;
+pub mod integrity;
 pub mod jobs;
+pub mod literals;
+pub mod locals;
 pub mod maintenance_lock;
 pub mod manifest;
 pub mod overlay_paths;
+pub mod package_summaries;
+pub mod parse_errors;
+pub mod plugin_findings;
 pub mod project;
+pub mod provider;
+pub mod reference_fingerprints;
+pub mod remote_cache;
+pub mod remote_origins;
+pub mod routes;
 pub mod schema;
+pub mod scip_upload;
 pub mod semantic_queue;
+pub mod shards;
+pub mod skipped_files;
+pub mod submodules;
+pub mod symbol_blame;
 pub mod symbols;
 pub mod tantivy_index;
+pub mod todos;
 pub mod tokenizers;
 pub mod tombstones;
 pub mod vector_index;
 pub mod workspace;
+pub mod workspace_projects;
 pub mod worktree_leases;
@@ -0,0 +1,176 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::LiteralRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the literals recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[LiteralRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO literals
+                (repo, \"ref\", path, line, value, kind, defines, symbol_id, symbol)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.value,
+            record.kind,
+            record.defines,
+            record.symbol_id,
+            record.symbol,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the literals of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM literals WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Literals of a repo/ref with exactly `value`, ordered by path and line.
+pub fn find_by_value(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    value: &str,
+) -> Result<Vec<LiteralRecord>, StateError> {
+    query(conn, repo, ref_name, "value = ?3", value)
+}
+
+/// Literals of a repo/ref whose value starts with `prefix`, ordered by path
+/// and line.
+pub fn find_by_prefix(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    prefix: &str,
+) -> Result<Vec<LiteralRecord>, StateError> {
+    // `substr` rather than LIKE, so `%` and `_` in values match literally.
+    query(
+        conn,
+        repo,
+        ref_name,
+        "substr(value, 1, length(?3)) = ?3",
+        prefix,
+    )
+}
+
+fn query(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    filter: &str,
+    arg: &str,
+) -> Result<Vec<LiteralRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(&format!(
+            "SELECT path, line, value, kind, defines, symbol_id, symbol
+             FROM literals
+             WHERE repo = ?1 AND \"ref\" = ?2 AND {filter}
+             ORDER BY path, line"
+        ))
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name, arg], |row| {
+            Ok(LiteralRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                value: row.get(2)?,
+                kind: row.get(3)?,
+                defines: row.get(4)?,
+                symbol_id: row.get(5)?,
+                symbol: row.get(6)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, value: &str, kind: &str) -> LiteralRecord {
+        LiteralRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            value: value.to_string(),
+            kind: kind.to_string(),
+            defines: false,
+            symbol_id: Some("stable::Handle".to_string()),
+            symbol: Some("api.Handle".to_string()),
+        }
+    }
+
+    #[test]
+    fn literals_are_found_by_value_and_prefix() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [
+            record("a.go", 3, "/api/user", "route"),
+            record("a.go", 9, "/api/user_%", "route"),
+        ];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "b.go",
+            &[record("b.go", 1, "/api/users", "route")],
+        )
+        .unwrap();
+        assert_eq!(
+            find_by_value(&conn, "repo", "main", "/api/user").unwrap(),
+            [a[0].clone()]
+        );
+        assert_eq!(
+            find_by_prefix(&conn, "repo", "main", "/api/user")
+                .unwrap()
+                .len(),
+            3
+        );
+        assert_eq!(
+            find_by_prefix(&conn, "repo", "main", "/api/user_%").unwrap(),
+            [a[1].clone()]
+        );
+
+        delete_for_file(&conn, "repo", "main", "a.go").unwrap();
+        assert!(
+            find_by_value(&conn, "repo", "main", "/api/user")
+                .unwrap()
+                .is_empty()
+        );
+    }
+}
@@ -0,0 +1,185 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::LocalRecord;
+use rusqlite::types::Type;
+use rusqlite::{Connection, params};
+
+const COLUMNS: &str = "path, name, kind, line, col, symbol_id, symbol, uses";
+
+/// Replace the parameters and local variables recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[LocalRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO local_bindings
+                (repo, \"ref\", path, name, kind, line, col, symbol_id, symbol, uses)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        let uses = serde_json::to_string(&record.uses)
+            .map_err(|err| StateError::CorruptManifest(err.to_string()))?;
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.name,
+            record.kind,
+            record.line,
+            record.column,
+            record.symbol_id,
+            record.symbol,
+            uses,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the locals of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM local_bindings WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Locals of one file ordered by declaration.
+pub fn list_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<Vec<LocalRecord>, StateError> {
+    query(conn, repo, ref_name, "path = ?3 ORDER BY line, col", path)
+}
+
+/// Locals named `name` anywhere in a repo/ref, ordered by path and line.
+pub fn find_by_name(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    name: &str,
+) -> Result<Vec<LocalRecord>, StateError> {
+    query(
+        conn,
+        repo,
+        ref_name,
+        "name = ?3 ORDER BY path, line, col",
+        name,
+    )
+}
+
+fn query(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    filter: &str,
+    value: &str,
+) -> Result<Vec<LocalRecord>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(&format!(
+            "SELECT {COLUMNS} FROM local_bindings WHERE repo = ?1 AND \"ref\" = ?2 AND {filter}"
+        ))
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name, value], |row| {
+            let uses: String = row.get(7)?;
+            Ok(LocalRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                name: row.get(1)?,
+                kind: row.get(2)?,
+                line: row.get(3)?,
+                column: row.get(4)?,
+                symbol_id: row.get(5)?,
+                symbol: row.get(6)?,
+                uses: serde_json::from_str(&uses).map_err(|err| {
+                    rusqlite::Error::FromSqlConversionFailure(7, Type::Text, Box::new(err))
+                })?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use cruxe_core::types::LocalUse;
+    use tempfile::tempdir;
+
+    fn record(path: &str, name: &str, line: u32) -> LocalRecord {
+        LocalRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            name: name.to_string(),
+            kind: "local".to_string(),
+            line,
+            column: 2,
+            symbol_id: Some("stable::HandleRequest".to_string()),
+            symbol: Some("api.HandleRequest".to_string()),
+            uses: vec![
+                LocalUse {
+                    line,
+                    column: 2,
+                    write: true,
+                },
+                LocalUse {
+                    line: line + 1,
+                    column: 9,
+                    write: false,
+                },
+            ],
+        }
+    }
+
+    #[test]
+    fn locals_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [record("a.go", "claims", 4), record("a.go", "err", 3)];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "b.go",
+            &[record("b.go", "claims", 7)],
+        )
+        .unwrap();
+
+        let listed = list_for_file(&conn, "repo", "main", "a.go").unwrap();
+        assert_eq!(listed, vec![a[1].clone(), a[0].clone()]);
+        assert_eq!(
+            find_by_name(&conn, "repo", "main", "claims").unwrap().len(),
+            2
+        );
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(
+            find_by_name(&conn, "repo", "main", "claims")
+                .unwrap()
+                .is_empty()
+        );
+    }
+}
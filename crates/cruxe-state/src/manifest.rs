@@ -74,6 +74,51 @@ pub fn delete_manifest(
     Ok(())
 }
 
+/// Clear the content hashes of a repo/ref (or every ref of the repo when
+/// `r#ref` is `None`) so the next index run re-processes each file while still
+/// treating it as previously indexed. Returns the number of rows touched.
+pub fn invalidate_hashes(
+    conn: &Connection,
+    repo: &str,
+    r#ref: Option<&str>,
+) -> Result<usize, StateError> {
+    let count = match r#ref {
+        Some(r#ref) => conn.execute(
+            "UPDATE file_manifest SET content_hash = '' WHERE repo = ?1 AND \"ref\" = ?2",
+            params![repo, r#ref],
+        ),
+        None => conn.execute(
+            "UPDATE file_manifest SET content_hash = '' WHERE repo = ?1",
+            params![repo],
+        ),
+    }
+    .map_err(StateError::sqlite)?;
+    Ok(count)
+}
+
+/// Clear the content hashes of specific paths so only those files are
+/// re-processed by the next index run.
+pub fn invalidate_paths(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    paths: &[String],
+) -> Result<usize, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "UPDATE file_manifest SET content_hash = ''
+             WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        )
+        .map_err(StateError::sqlite)?;
+    let mut count = 0;
+    for path in paths {
+        count += stmt
+            .execute(params![repo, r#ref, path])
+            .map_err(StateError::sqlite)?;
+    }
+    Ok(count)
+}
+
 /// Get file count for a repo/ref.
 pub fn file_count(conn: &Connection, repo: &str, r#ref: &str) -> Result<u64, StateError> {
     let count: i64 = conn
@@ -205,6 +250,35 @@ mod tests {
         assert!(result.is_ok());
     }
 
+    #[test]
+    fn test_invalidate_hashes_scoped_to_ref() {
+        let conn = setup_test_db();
+        let entry = sample_entry();
+        upsert_manifest(&conn, &entry).unwrap();
+        let mut other = sample_entry();
+        other.r#ref = "feat".to_string();
+        upsert_manifest(&conn, &other).unwrap();
+
+        assert_eq!(
+            invalidate_hashes(&conn, "my-repo", Some("main")).unwrap(),
+            1
+        );
+        let hash = get_content_hash(&conn, "my-repo", "main", &entry.path).unwrap();
+        assert_eq!(hash.as_deref(), Some(""));
+        let hash = get_content_hash(&conn, "my-repo", "feat", &other.path).unwrap();
+        assert_eq!(hash.as_deref(), Some("abc123def456"));
+
+        assert_eq!(
+            invalidate_paths(&conn, "my-repo", "feat", &[other.path.clone()]).unwrap(),
+            1
+        );
+        let hash = get_content_hash(&conn, "my-repo", "feat", &other.path).unwrap();
+        assert_eq!(hash.as_deref(), Some(""));
+
+        assert_eq!(invalidate_hashes(&conn, "my-repo", None).unwrap(), 2);
+        assert_eq!(file_count(&conn, "my-repo", "feat").unwrap(), 1);
+    }
+
     #[test]
     fn test_file_count() {
         let conn = setup_test_db();
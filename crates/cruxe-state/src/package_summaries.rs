@@ -0,0 +1,125 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, OptionalExtension, params};
+
+/// A stored `cruxe summarize` result: the summary as JSON and the
+/// fingerprint of the package contents it was built from.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CachedSummary {
+    pub fingerprint: String,
+    pub summary: String,
+}
+
+/// The stored summary of a package by a backend, if any.
+pub fn get(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    package: &str,
+    backend: &str,
+) -> Result<Option<CachedSummary>, StateError> {
+    conn.query_row(
+        "SELECT fingerprint, summary FROM package_summaries
+         WHERE repo = ?1 AND \"ref\" = ?2 AND package = ?3 AND backend = ?4",
+        params![repo, ref_name, package, backend],
+        |row| {
+            Ok(CachedSummary {
+                fingerprint: row.get(0)?,
+                summary: row.get(1)?,
+            })
+        },
+    )
+    .optional()
+    .map_err(StateError::sqlite)
+}
+
+/// Store (or replace) the summary of a package by a backend.
+pub fn put(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    package: &str,
+    backend: &str,
+    cached: &CachedSummary,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO package_summaries (repo, \"ref\", package, backend, fingerprint, summary)
+         VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+         ON CONFLICT(repo, \"ref\", package, backend) DO UPDATE SET
+            fingerprint = excluded.fingerprint,
+            summary = excluded.summary,
+            created_at = datetime('now')",
+        params![
+            repo,
+            ref_name,
+            package,
+            backend,
+            cached.fingerprint,
+            cached.summary
+        ],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Forget every stored summary of a repo/ref.
+pub fn delete_for_ref(conn: &Connection, repo: &str, ref_name: &str) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM package_summaries WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn cached(fingerprint: &str) -> CachedSummary {
+        CachedSummary {
+            fingerprint: fingerprint.to_string(),
+            summary: format!("{{\"fingerprint\":\"{fingerprint}\"}}"),
+        }
+    }
+
+    #[test]
+    fn summaries_are_kept_per_package_and_backend() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        put(&conn, "repo", "main", "auth", "heuristic", &cached("one")).unwrap();
+        put(
+            &conn,
+            "repo",
+            "main",
+            "auth",
+            "openai-compatible",
+            &cached("two"),
+        )
+        .unwrap();
+        put(&conn, "repo", "main", "auth", "heuristic", &cached("three")).unwrap();
+        assert_eq!(
+            get(&conn, "repo", "main", "auth", "heuristic").unwrap(),
+            Some(cached("three"))
+        );
+        assert_eq!(
+            get(&conn, "repo", "main", "auth", "openai-compatible").unwrap(),
+            Some(cached("two"))
+        );
+        assert!(
+            get(&conn, "repo", "dev", "auth", "heuristic")
+                .unwrap()
+                .is_none()
+        );
+
+        delete_for_ref(&conn, "repo", "main").unwrap();
+        assert!(
+            get(&conn, "repo", "main", "auth", "heuristic")
+                .unwrap()
+                .is_none()
+        );
+    }
+}
@@ -0,0 +1,115 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::ParseErrorRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the parse error regions recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[ParseErrorRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR REPLACE INTO parse_errors
+                (repo, \"ref\", path, start_line, end_line, kind)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.start_line,
+            record.end_line,
+            record.kind,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the parse error regions of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM parse_errors WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Parse error regions of a repo/ref ordered by path and line.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<ParseErrorRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, start_line, end_line, kind
+             FROM parse_errors
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, start_line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(ParseErrorRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                start_line: row.get(1)?,
+                end_line: row.get(2)?,
+                kind: row.get(3)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, start_line: u32, end_line: u32) -> ParseErrorRecord {
+        ParseErrorRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            start_line,
+            end_line,
+            kind: "syntax".to_string(),
+        }
+    }
+
+    #[test]
+    fn regions_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [record("a.go", 12, 18), record("a.go", 40, 40)];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(&conn, "repo", "main", "b.go", &[record("b.go", 1, 3)]).unwrap();
+        let listed = list_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(listed.len(), 3);
+        assert_eq!(listed[0], a[0]);
+        assert!(list_for_ref(&conn, "repo", "dev").unwrap().is_empty());
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
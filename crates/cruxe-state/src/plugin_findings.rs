@@ -0,0 +1,128 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::PluginFindingRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the plugin findings recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[PluginFindingRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO plugin_findings
+                (repo, \"ref\", path, plugin, rule, severity, line, symbol, message)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.plugin,
+            record.rule,
+            record.severity,
+            record.line,
+            record.symbol,
+            record.message,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the plugin findings of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM plugin_findings WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Plugin findings of a repo/ref ordered by path, line and plugin.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<PluginFindingRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, plugin, rule, severity, line, symbol, message
+             FROM plugin_findings
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line, plugin, rule",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(PluginFindingRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                plugin: row.get(1)?,
+                rule: row.get(2)?,
+                severity: row.get(3)?,
+                line: row.get(4)?,
+                symbol: row.get(5)?,
+                message: row.get(6)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, rule: &str) -> PluginFindingRecord {
+        PluginFindingRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            plugin: "naming".to_string(),
+            rule: rule.to_string(),
+            severity: "warning".to_string(),
+            line,
+            symbol: "api.getUser".to_string(),
+            message: "exported handlers start with a capital".to_string(),
+        }
+    }
+
+    #[test]
+    fn findings_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        // Two findings of one rule on one line are both kept.
+        let a = [
+            record("a.go", 7, "handler-case"),
+            record("a.go", 7, "handler-case"),
+        ];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(&conn, "repo", "main", "b.go", &[record("b.go", 3, "todo")]).unwrap();
+        let listed = list_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(listed.len(), 3);
+        assert_eq!(listed[0], a[0]);
+        assert!(list_for_ref(&conn, "repo", "dev").unwrap().is_empty());
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -0,0 +1,299 @@
+//! What model providers share beyond embeddings (see [`crate::embedding`]):
+//! the API key and the header it travels in, request pacing, and chat
+//! completions for features that have a model write prose
+//! (`cruxe summarize`).
+//!
+//! Each provider interface has a `fake` implementation that answers
+//! deterministically without leaving the process, so tests and offline runs
+//! go through the same code as a real model server.
+
+use cruxe_core::error::StateError;
+use reqwest::blocking::{Client, RequestBuilder};
+use serde::Serialize;
+use std::time::{Duration, Instant};
+
+const DEFAULT_AUTH_HEADER: &str = "authorization";
+
+/// An API key and the header it is sent in.
+#[derive(Clone, PartialEq, Eq)]
+pub struct ProviderAuth {
+    header: String,
+    key: String,
+}
+
+impl std::fmt::Debug for ProviderAuth {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("ProviderAuth")
+            .field("header", &self.header)
+            .finish_non_exhaustive()
+    }
+}
+
+impl ProviderAuth {
+    /// The key in the environment variable `env` (else `default_env`), sent
+    /// in `header` (else `authorization`); `None` when the variable is unset
+    /// or blank.
+    pub fn from_env(env: Option<&str>, default_env: &str, header: Option<&str>) -> Option<Self> {
+        let env = env
+            .map(str::trim)
+            .filter(|name| !name.is_empty())
+            .unwrap_or(default_env);
+        let key = std::env::var(env).ok()?;
+        Self::new(header, &key)
+    }
+
+    fn new(header: Option<&str>, key: &str) -> Option<Self> {
+        let key = key.trim();
+        if key.is_empty() {
+            return None;
+        }
+        let header = header
+            .map(|header| header.trim().to_ascii_lowercase())
+            .filter(|header| !header.is_empty())
+            .unwrap_or_else(|| DEFAULT_AUTH_HEADER.to_string());
+        Some(Self {
+            header,
+            key: key.to_string(),
+        })
+    }
+
+    /// `Bearer <key>` in `authorization`, the bare key in any other header.
+    fn header_value(&self) -> String {
+        if self.header == DEFAULT_AUTH_HEADER {
+            format!("Bearer {}", self.key)
+        } else {
+            self.key.clone()
+        }
+    }
+
+    pub fn apply(&self, request: RequestBuilder) -> RequestBuilder {
+        request.header(self.header.as_str(), self.header_value())
+    }
+}
+
+/// Spaces requests evenly so a run stays under a requests-per-minute limit.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RateLimiter {
+    interval: Option<Duration>,
+    next: Option<Instant>,
+}
+
+impl RateLimiter {
+    /// Unlimited when `requests_per_minute` is unset or zero.
+    pub fn per_minute(requests_per_minute: Option<u32>) -> Self {
+        Self {
+            interval: requests_per_minute
+                .filter(|requests| *requests > 0)
+                .map(|requests| Duration::from_secs(60) / requests),
+            next: None,
+        }
+    }
+
+    /// Block until the next request may go out.
+    pub fn wait(&mut self) {
+        let Some(interval) = self.interval else {
+            return;
+        };
+        let now = Instant::now();
+        let start = self.next.map_or(now, |next| next.max(now));
+        if start > now {
+            std::thread::sleep(start - now);
+        }
+        self.next = Some(start + interval);
+    }
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ChatMessage {
+    pub role: String,
+    pub content: String,
+}
+
+impl ChatMessage {
+    pub fn system(content: impl Into<String>) -> Self {
+        Self {
+            role: "system".to_string(),
+            content: content.into(),
+        }
+    }
+
+    pub fn user(content: impl Into<String>) -> Self {
+        Self {
+            role: "user".to_string(),
+            content: content.into(),
+        }
+    }
+}
+
+pub trait ChatProvider {
+    /// The model requested, when the provider names one; servers with a
+    /// single loaded model need none.
+    fn model_id(&self) -> Option<&str>;
+    /// The assistant's reply to `messages`, trimmed and never empty.
+    fn complete(
+        &mut self,
+        messages: &[ChatMessage],
+        temperature: f32,
+    ) -> Result<String, StateError>;
+}
+
+/// An OpenAI-compatible chat completions API: OpenAI itself, llama.cpp,
+/// vLLM or an inference gateway in front of them.
+pub struct OpenAiChatProvider {
+    endpoint: String,
+    model: Option<String>,
+    auth: Option<ProviderAuth>,
+    limiter: RateLimiter,
+    client: Client,
+}
+
+impl OpenAiChatProvider {
+    /// `endpoint` is the full chat completions URL.
+    pub fn new(
+        endpoint: String,
+        model: Option<String>,
+        auth: Option<ProviderAuth>,
+        requests_per_minute: Option<u32>,
+        timeout: Duration,
+    ) -> Result<Self, StateError> {
+        let client = Client::builder()
+            .timeout(timeout)
+            .build()
+            .map_err(StateError::external)?;
+        Ok(Self {
+            endpoint,
+            model,
+            auth,
+            limiter: RateLimiter::per_minute(requests_per_minute),
+            client,
+        })
+    }
+}
+
+impl ChatProvider for OpenAiChatProvider {
+    fn model_id(&self) -> Option<&str> {
+        self.model.as_deref()
+    }
+
+    fn complete(
+        &mut self,
+        messages: &[ChatMessage],
+        temperature: f32,
+    ) -> Result<String, StateError> {
+        let mut payload = serde_json::json!({
+            "messages": messages,
+            "temperature": temperature,
+        });
+        if let Some(model) = &self.model {
+            payload["model"] = serde_json::Value::String(model.clone());
+        }
+
+        self.limiter.wait();
+        let mut request = self.client.post(&self.endpoint).json(&payload);
+        if let Some(auth) = &self.auth {
+            request = auth.apply(request);
+        }
+        let endpoint = &self.endpoint;
+        let response = request
+            .send()
+            .map_err(|e| StateError::external(format!("{endpoint}: {e}")))?;
+        if !response.status().is_success() {
+            return Err(StateError::external(format!(
+                "{endpoint} answered HTTP {}",
+                response.status().as_u16()
+            )));
+        }
+        let body: serde_json::Value = response.json().map_err(StateError::external)?;
+        body["choices"][0]["message"]["content"]
+            .as_str()
+            .map(str::trim)
+            .filter(|content| !content.is_empty())
+            .map(str::to_string)
+            .ok_or_else(|| StateError::external(format!("{endpoint} returned no message")))
+    }
+}
+
+/// Answers every conversation with a fixed reply derived from its hash.
+#[derive(Debug, Clone, Default)]
+pub struct FakeChatProvider {
+    model: Option<String>,
+}
+
+impl FakeChatProvider {
+    pub fn new(model: Option<String>) -> Self {
+        Self { model }
+    }
+}
+
+impl ChatProvider for FakeChatProvider {
+    fn model_id(&self) -> Option<&str> {
+        self.model.as_deref()
+    }
+
+    fn complete(
+        &mut self,
+        messages: &[ChatMessage],
+        _temperature: f32,
+    ) -> Result<String, StateError> {
+        let mut hasher = blake3::Hasher::new();
+        for message in messages {
+            hasher.update(message.role.as_bytes());
+            hasher.update(&[0]);
+            hasher.update(message.content.as_bytes());
+            hasher.update(&[0]);
+        }
+        let digest = hasher.finalize().to_hex();
+        Ok(format!(
+            "Fake reply {} to {} message(s).",
+            &digest[..12],
+            messages.len()
+        ))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn auth_goes_in_the_configured_header() {
+        let bearer = ProviderAuth::new(None, " sk-123 ").unwrap();
+        assert_eq!(bearer.header, "authorization");
+        assert_eq!(bearer.header_value(), "Bearer sk-123");
+        assert!(!format!("{bearer:?}").contains("sk-123"));
+
+        let gateway = ProviderAuth::new(Some("X-Api-Key"), "gw-key").unwrap();
+        assert_eq!(gateway.header, "x-api-key");
+        assert_eq!(gateway.header_value(), "gw-key");
+
+        assert!(ProviderAuth::new(None, "  ").is_none());
+    }
+
+    #[test]
+    fn rate_limiter_spaces_requests_evenly() {
+        let unlimited = RateLimiter::per_minute(Some(0));
+        assert_eq!(unlimited.interval, None);
+
+        let mut limiter = RateLimiter::per_minute(Some(6000));
+        assert_eq!(limiter.interval, Some(Duration::from_millis(10)));
+        let started = Instant::now();
+        for _ in 0..4 {
+            limiter.wait();
+        }
+        assert!(started.elapsed() >= Duration::from_millis(30));
+    }
+
+    #[test]
+    fn fake_chat_replies_are_deterministic() {
+        let messages = [ChatMessage::system("Be brief."), ChatMessage::user("Hi")];
+        let mut fake = FakeChatProvider::new(Some("test-model".to_string()));
+        let first = fake.complete(&messages, 0.2).unwrap();
+        assert_eq!(first, fake.complete(&messages, 0.7).unwrap());
+        assert!(first.ends_with("to 2 message(s)."));
+        assert_ne!(
+            first,
+            fake.complete(&[ChatMessage::user("Hi")], 0.2).unwrap()
+        );
+        assert_eq!(fake.model_id(), Some("test-model"));
+    }
+}
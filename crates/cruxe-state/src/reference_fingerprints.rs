@@ -0,0 +1,199 @@
+use cruxe_core::error::StateError;
+use cruxe_core::fingerprint::ReferenceFingerprint;
+use cruxe_core::types::CallEdge;
+use rusqlite::{Connection, params};
+
+/// Build the fingerprint for one file from its extracted call edges.
+///
+/// Resolved target ids are included as well as names, so a call made through
+/// a renamed import still matches a lookup by the target's id.
+pub fn fingerprint_for_call_edges(call_edges: &[CallEdge]) -> ReferenceFingerprint {
+    ReferenceFingerprint::from_references(
+        call_edges.iter().filter_map(|edge| edge.to_name.as_deref()),
+        call_edges
+            .iter()
+            .filter_map(|edge| edge.to_symbol_id.as_deref()),
+    )
+}
+
+/// Insert or replace the reference fingerprint for a file.
+pub fn upsert_fingerprint(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    fingerprint: &ReferenceFingerprint,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO file_reference_fingerprints (repo, \"ref\", path, bloom, identifier_count)
+         VALUES (?1, ?2, ?3, ?4, ?5)
+         ON CONFLICT(repo, \"ref\", path) DO UPDATE SET
+            bloom = excluded.bloom,
+            identifier_count = excluded.identifier_count",
+        params![
+            repo,
+            ref_name,
+            path,
+            fingerprint.to_bytes(),
+            fingerprint.identifier_count()
+        ],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Remove the fingerprint for a file (file deleted or edges cleared).
+pub fn delete_fingerprint(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM file_reference_fingerprints WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Return files whose fingerprint may reference any of `names` or
+/// `symbol_ids`.
+///
+/// Returns `None` when the ref has no fingerprints at all (index built before
+/// fingerprints existed), in which case callers must fall back to a full scan.
+pub fn candidate_paths(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    names: &[&str],
+    symbol_ids: &[&str],
+) -> Result<Option<Vec<String>>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, bloom, identifier_count FROM file_reference_fingerprints
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok((
+                row.get::<_, String>(0)?,
+                row.get::<_, Vec<u8>>(1)?,
+                row.get::<_, u32>(2)?,
+            ))
+        })
+        .map_err(StateError::sqlite)?;
+
+    let mut seen_any = false;
+    let mut candidates = Vec::new();
+    for row in rows {
+        let (path, bloom, identifier_count) = row.map_err(StateError::sqlite)?;
+        seen_any = true;
+        match ReferenceFingerprint::from_bytes(&bloom, identifier_count) {
+            Some(fingerprint)
+                if !names.iter().any(|name| fingerprint.may_contain(name))
+                    && !symbol_ids.iter().any(|id| fingerprint.may_reference(id)) => {}
+            // Unknown layouts are treated as "may contain" to stay correct.
+            _ => candidates.push(path),
+        }
+    }
+    Ok(seen_any.then_some(candidates))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn setup_test_db() -> (tempfile::TempDir, Connection) {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        (dir, conn)
+    }
+
+    fn call_edge(to_name: &str) -> CallEdge {
+        CallEdge {
+            repo: "repo".to_string(),
+            ref_name: "main".to_string(),
+            from_symbol_id: "caller".to_string(),
+            to_symbol_id: None,
+            to_name: Some(to_name.to_string()),
+            edge_type: "calls".to_string(),
+            confidence: "low".to_string(),
+            source_file: "src/a.rs".to_string(),
+            source_line: 1,
+        }
+    }
+
+    #[test]
+    fn candidate_paths_is_none_without_fingerprints() {
+        let (_dir, conn) = setup_test_db();
+        assert_eq!(
+            candidate_paths(&conn, "repo", "main", &["anything"], &[]).unwrap(),
+            None
+        );
+    }
+
+    #[test]
+    fn candidate_paths_skips_files_that_cannot_reference_name() {
+        let (_dir, conn) = setup_test_db();
+        let a = fingerprint_for_call_edges(&[call_edge("auth::validate_token")]);
+        let b = fingerprint_for_call_edges(&[call_edge("db.Connect")]);
+        upsert_fingerprint(&conn, "repo", "main", "src/a.rs", &a).unwrap();
+        upsert_fingerprint(&conn, "repo", "main", "src/b.rs", &b).unwrap();
+
+        let candidates = candidate_paths(&conn, "repo", "main", &["validate_token"], &[])
+            .unwrap()
+            .unwrap();
+        assert_eq!(candidates, vec!["src/a.rs".to_string()]);
+
+        delete_fingerprint(&conn, "repo", "main", "src/a.rs").unwrap();
+        let candidates = candidate_paths(&conn, "repo", "main", &["validate_token"], &[])
+            .unwrap()
+            .unwrap();
+        assert!(candidates.is_empty());
+    }
+
+    #[test]
+    fn candidate_paths_match_calls_resolved_through_renamed_imports() {
+        let (_dir, conn) = setup_test_db();
+        let mut renamed = call_edge("check");
+        renamed.to_symbol_id = Some("sym::validate_token".to_string());
+        let a = fingerprint_for_call_edges(&[renamed]);
+        upsert_fingerprint(&conn, "repo", "main", "src/a.rs", &a).unwrap();
+
+        let by_name = candidate_paths(&conn, "repo", "main", &["validate_token"], &[])
+            .unwrap()
+            .unwrap();
+        assert!(by_name.is_empty());
+        let by_id = candidate_paths(
+            &conn,
+            "repo",
+            "main",
+            &["validate_token"],
+            &["sym::validate_token"],
+        )
+        .unwrap()
+        .unwrap();
+        assert_eq!(by_id, vec!["src/a.rs".to_string()]);
+    }
+
+    #[test]
+    fn fingerprints_from_older_layouts_are_always_candidates() {
+        let (_dir, conn) = setup_test_db();
+        conn.execute(
+            "INSERT INTO file_reference_fingerprints (repo, \"ref\", path, bloom, identifier_count)
+             VALUES ('repo', 'main', 'src/old.rs', ?1, 0)",
+            params![vec![0u8; 256]],
+        )
+        .unwrap();
+        let candidates = candidate_paths(&conn, "repo", "main", &["anything"], &[])
+            .unwrap()
+            .unwrap();
+        assert_eq!(candidates, vec!["src/old.rs".to_string()]);
+    }
+}
@@ -0,0 +1,300 @@
+//! Remote cache of exported state bundles, keyed by commit.
+//!
+//! Bundles are stored as `<namespace>/<commit>.tar.zst` under the cache URL.
+//! HTTP(S) caches use plain `PUT` and `GET`, optionally with a bearer token.
+//! `s3://` and `gs://` caches go through the `aws` and `gcloud` CLIs so their
+//! usual credential chains apply. Any other URL is a directory, such as a
+//! network mount.
+
+use cruxe_core::error::StateError;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+use std::time::Duration;
+
+const HTTP_TIMEOUT: Duration = Duration::from_secs(600);
+
+/// What `aws s3 cp` prints when the source key is missing: the HeadObject
+/// 404, or NoSuchKey from GetObject. A missing bucket or a denied request
+/// matches neither and stays an error.
+const S3_NOT_FOUND: &[&str] = &[
+    "An error occurred (404) when calling the HeadObject operation",
+    "An error occurred (NoSuchKey) when calling the GetObject operation",
+];
+
+/// What `gcloud storage cp` prints when the source object is missing.
+const GCS_NOT_FOUND: &[&str] = &[
+    "The following URLs matched no objects or files",
+    "No URLs matched",
+];
+
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum RemoteCache {
+    Http { base: String, token: Option<String> },
+    S3 { base: String },
+    Gcs { base: String },
+    Directory(PathBuf),
+}
+
+impl RemoteCache {
+    /// Cache at `url`; `token` is sent as a bearer token to HTTP(S) caches.
+    pub fn from_url(url: &str, token: Option<String>) -> Self {
+        let url = url.trim().trim_end_matches('/');
+        if url.starts_with("http://") || url.starts_with("https://") {
+            Self::Http {
+                base: url.to_string(),
+                token,
+            }
+        } else if url.starts_with("s3://") {
+            Self::S3 {
+                base: url.to_string(),
+            }
+        } else if url.starts_with("gs://") {
+            Self::Gcs {
+                base: url.to_string(),
+            }
+        } else {
+            Self::Directory(PathBuf::from(url.strip_prefix("file://").unwrap_or(url)))
+        }
+    }
+
+    /// Key of the bundle for `commit`.
+    pub fn object_key(namespace: &str, commit: &str) -> String {
+        format!("{}/{commit}.tar.zst", namespace.trim_matches('/'))
+    }
+
+    /// Full location of `key`, for messages.
+    pub fn location(&self, key: &str) -> String {
+        match self {
+            Self::Http { base, .. } | Self::S3 { base } | Self::Gcs { base } => {
+                format!("{base}/{key}")
+            }
+            Self::Directory(dir) => dir.join(key).display().to_string(),
+        }
+    }
+
+    /// Store the file at `source` under `key`, replacing any previous object.
+    pub fn upload(&self, key: &str, source: &Path) -> Result<(), StateError> {
+        match self {
+            Self::Http { token, .. } => {
+                let file = std::fs::File::open(source).map_err(StateError::Io)?;
+                let mut request = http_client()?.put(self.location(key)).body(file);
+                if let Some(token) = token {
+                    request = request.bearer_auth(token);
+                }
+                let response = request.send().map_err(StateError::external)?;
+                if !response.status().is_success() {
+                    return Err(StateError::external(format!(
+                        "PUT {} returned {}",
+                        self.location(key),
+                        response.status()
+                    )));
+                }
+                Ok(())
+            }
+            Self::S3 { .. } => {
+                run_cli("aws", &["s3", "cp"], source, &self.location(key)).map(|_| ())
+            }
+            Self::Gcs { .. } => {
+                run_cli("gcloud", &["storage", "cp"], source, &self.location(key)).map(|_| ())
+            }
+            Self::Directory(dir) => {
+                let target = dir.join(key);
+                let parent = target.parent().unwrap_or(dir);
+                std::fs::create_dir_all(parent).map_err(StateError::Io)?;
+                // Copy next to the target and rename, so concurrent pulls never
+                // see a half-written bundle.
+                let tmp = tempfile::NamedTempFile::new_in(parent).map_err(StateError::Io)?;
+                std::fs::copy(source, tmp.path()).map_err(StateError::Io)?;
+                tmp.persist(&target)
+                    .map_err(|err| StateError::Io(err.error))?;
+                Ok(())
+            }
+        }
+    }
+
+    /// Fetch `key` into `dest`. Returns `false` when the cache has no such
+    /// object.
+    pub fn download(&self, key: &str, dest: &Path) -> Result<bool, StateError> {
+        match self {
+            Self::Http { token, .. } => {
+                let mut request = http_client()?.get(self.location(key));
+                if let Some(token) = token {
+                    request = request.bearer_auth(token);
+                }
+                let mut response = request.send().map_err(StateError::external)?;
+                if response.status() == reqwest::StatusCode::NOT_FOUND {
+                    return Ok(false);
+                }
+                if !response.status().is_success() {
+                    return Err(StateError::external(format!(
+                        "GET {} returned {}",
+                        self.location(key),
+                        response.status()
+                    )));
+                }
+                let mut file = std::fs::File::create(dest).map_err(StateError::Io)?;
+                response.copy_to(&mut file).map_err(StateError::external)?;
+                Ok(true)
+            }
+            Self::S3 { .. } => run_cli_download(
+                "aws",
+                &["s3", "cp"],
+                &self.location(key),
+                dest,
+                S3_NOT_FOUND,
+            ),
+            Self::Gcs { .. } => run_cli_download(
+                "gcloud",
+                &["storage", "cp"],
+                &self.location(key),
+                dest,
+                GCS_NOT_FOUND,
+            ),
+            Self::Directory(dir) => {
+                let source = dir.join(key);
+                if !source.is_file() {
+                    return Ok(false);
+                }
+                std::fs::copy(&source, dest).map_err(StateError::Io)?;
+                Ok(true)
+            }
+        }
+    }
+}
+
+fn http_client() -> Result<reqwest::blocking::Client, StateError> {
+    reqwest::blocking::Client::builder()
+        .timeout(HTTP_TIMEOUT)
+        .build()
+        .map_err(StateError::external)
+}
+
+/// Run `program args.. from to`; the error carries the CLI's stderr.
+fn run_cli(program: &str, args: &[&str], from: &Path, to: &str) -> Result<(), StateError> {
+    let output = Command::new(program)
+        .args(args)
+        .arg(from)
+        .arg(to)
+        .output()
+        .map_err(|err| StateError::external(format!("failed to run `{program}`: {err}")))?;
+    if output.status.success() {
+        return Ok(());
+    }
+    Err(StateError::external(format!(
+        "`{program}` failed: {}",
+        String::from_utf8_lossy(&output.stderr).trim()
+    )))
+}
+
+/// Like [`run_cli`], but `Ok(false)` when stderr carries one of
+/// `not_found`, the CLI's message for a missing object.
+fn run_cli_download(
+    program: &str,
+    args: &[&str],
+    from: &str,
+    dest: &Path,
+    not_found: &[&str],
+) -> Result<bool, StateError> {
+    let output = Command::new(program)
+        .args(args)
+        .arg(from)
+        .arg(dest)
+        .output()
+        .map_err(|err| StateError::external(format!("failed to run `{program}`: {err}")))?;
+    if output.status.success() {
+        return Ok(true);
+    }
+    let stderr = String::from_utf8_lossy(&output.stderr);
+    if is_not_found(&stderr, not_found) {
+        return Ok(false);
+    }
+    Err(StateError::external(format!(
+        "`{program}` failed: {}",
+        stderr.trim()
+    )))
+}
+
+fn is_not_found(stderr: &str, markers: &[&str]) -> bool {
+    markers.iter().any(|marker| stderr.contains(marker))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    #[test]
+    fn urls_select_the_backend() {
+        assert_eq!(
+            RemoteCache::from_url("https://cache.example/cruxe/", Some("t".to_string())),
+            RemoteCache::Http {
+                base: "https://cache.example/cruxe".to_string(),
+                token: Some("t".to_string()),
+            }
+        );
+        assert!(matches!(
+            RemoteCache::from_url("s3://bucket/idx", None),
+            RemoteCache::S3 { .. }
+        ));
+        assert!(matches!(
+            RemoteCache::from_url("gs://bucket/idx", None),
+            RemoteCache::Gcs { .. }
+        ));
+        assert_eq!(
+            RemoteCache::from_url("file:///mnt/cache", None),
+            RemoteCache::Directory(PathBuf::from("/mnt/cache"))
+        );
+        assert_eq!(
+            RemoteCache::from_url("s3://bucket/idx", None)
+                .location(&RemoteCache::object_key("/api/", "abc")),
+            "s3://bucket/idx/api/abc.tar.zst"
+        );
+    }
+
+    #[test]
+    fn only_missing_objects_count_as_cache_misses() {
+        assert!(is_not_found(
+            "fatal error: An error occurred (404) when calling the HeadObject operation: \
+             Key \"idx/api/abc.tar.zst\" does not exist",
+            S3_NOT_FOUND,
+        ));
+        assert!(is_not_found(
+            "ERROR: (gcloud.storage.cp) The following URLs matched no objects or files:\n\
+             -gs://bucket/idx/api/abc.tar.zst",
+            GCS_NOT_FOUND,
+        ));
+        // A missing bucket, a denied request or a 404 from some other call is
+        // a misconfiguration, not a miss.
+        for stderr in [
+            "An error occurred (NoSuchBucket) when calling the ListObjectsV2 operation: \
+             The specified bucket does not exist",
+            "An error occurred (403) when calling the HeadObject operation: Forbidden",
+            "Could not connect to the endpoint URL: \"https://proxy:4040/\"",
+        ] {
+            assert!(!is_not_found(stderr, S3_NOT_FOUND), "{stderr}");
+        }
+        assert!(!is_not_found(
+            "ERROR: (gcloud.storage.cp) HTTPError 404: bucket not found",
+            GCS_NOT_FOUND,
+        ));
+    }
+
+    #[test]
+    fn directory_cache_round_trips_and_reports_missing_objects() {
+        let dir = tempdir().unwrap();
+        let cache = RemoteCache::Directory(dir.path().join("cache"));
+        let source = dir.path().join("bundle.tar.zst");
+        std::fs::write(&source, b"bundle").unwrap();
+
+        let key = RemoteCache::object_key("api", "abc");
+        cache.upload(&key, &source).unwrap();
+        let dest = dir.path().join("pulled.tar.zst");
+        assert!(cache.download(&key, &dest).unwrap());
+        assert_eq!(std::fs::read(&dest).unwrap(), b"bundle");
+        assert!(
+            !cache
+                .download(&RemoteCache::object_key("api", "def"), &dest)
+                .unwrap()
+        );
+    }
+}
@@ -0,0 +1,84 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, OptionalExtension, params};
+use schemars::JsonSchema;
+use serde::Serialize;
+
+/// Where a ref of a project indexed by URL (`cruxe index <url>`) was
+/// fetched from.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct RemoteOrigin {
+    pub url: String,
+    /// Full hash of the commit indexed.
+    pub commit: String,
+    pub fetched_at: String,
+}
+
+/// Record the origin of `ref_name`, replacing the one of an earlier fetch.
+pub fn record(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    origin: &RemoteOrigin,
+) -> Result<(), StateError> {
+    conn.execute(
+        "INSERT INTO remote_origins (repo, \"ref\", url, \"commit\", fetched_at)
+         VALUES (?1, ?2, ?3, ?4, ?5)
+         ON CONFLICT(repo, \"ref\") DO UPDATE SET
+            url = excluded.url,
+            \"commit\" = excluded.\"commit\",
+            fetched_at = excluded.fetched_at",
+        params![repo, ref_name, origin.url, origin.commit, origin.fetched_at],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// The origin of `ref_name`; `None` for refs indexed from a local working
+/// tree.
+pub fn get(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Option<RemoteOrigin>, StateError> {
+    conn.query_row(
+        "SELECT url, \"commit\", fetched_at FROM remote_origins
+         WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+        |row| {
+            Ok(RemoteOrigin {
+                url: row.get(0)?,
+                commit: row.get(1)?,
+                fetched_at: row.get(2)?,
+            })
+        },
+    )
+    .optional()
+    .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn a_later_fetch_replaces_the_origin_of_its_ref() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let origin = |commit: &str| RemoteOrigin {
+            url: "https://github.com/org/repo".to_string(),
+            commit: commit.to_string(),
+            fetched_at: "2026-01-01T00:00:00Z".to_string(),
+        };
+
+        record(&conn, "repo", "main", &origin("aaa")).unwrap();
+        record(&conn, "repo", "main", &origin("bbb")).unwrap();
+        record(&conn, "repo", "v1.0.0", &origin("ccc")).unwrap();
+
+        assert_eq!(get(&conn, "repo", "main").unwrap(), Some(origin("bbb")));
+        assert_eq!(get(&conn, "repo", "v1.0.0").unwrap(), Some(origin("ccc")));
+        assert_eq!(get(&conn, "repo", "dev").unwrap(), None);
+    }
+}
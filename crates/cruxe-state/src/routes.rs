@@ -0,0 +1,146 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::RouteRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the HTTP routes recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[RouteRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO http_routes
+                (repo, \"ref\", path, line, method, route, handler, framework, symbol_id, symbol)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.method,
+            record.route,
+            record.handler,
+            record.framework,
+            record.symbol_id,
+            record.symbol,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the HTTP routes of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM http_routes WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// HTTP routes of a repo/ref ordered by route pattern and method.
+pub fn list_routes(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<RouteRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, line, method, route, handler, framework, symbol_id, symbol
+             FROM http_routes
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY route, method, path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(RouteRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                method: row.get(2)?,
+                route: row.get(3)?,
+                handler: row.get(4)?,
+                framework: row.get(5)?,
+                symbol_id: row.get(6)?,
+                symbol: row.get(7)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, method: &str, route: &str) -> RouteRecord {
+        RouteRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line: 12,
+            method: method.to_string(),
+            route: route.to_string(),
+            handler: "h.listUsers".to_string(),
+            framework: "chi".to_string(),
+            symbol_id: Some("stable::Routes".to_string()),
+            symbol: Some("server.Routes".to_string()),
+        }
+    }
+
+    #[test]
+    fn routes_are_replaced_per_file_and_listed_by_pattern() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [
+            record("a.go", "POST", "/users"),
+            record("a.go", "GET", "/users"),
+        ];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "b.go",
+            &[record("b.go", "GET", "/health")],
+        )
+        .unwrap();
+        let listed: Vec<(String, String)> = list_routes(&conn, "repo", "main")
+            .unwrap()
+            .into_iter()
+            .map(|route| (route.method, route.route))
+            .collect();
+        assert_eq!(
+            listed,
+            [
+                ("GET".to_string(), "/health".to_string()),
+                ("GET".to_string(), "/users".to_string()),
+                ("POST".to_string(), "/users".to_string()),
+            ]
+        );
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(list_routes(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
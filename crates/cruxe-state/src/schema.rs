@@ -4,7 +4,7 @@ use rusqlite::Connection;
 use tracing::info;
 
 /// Current schema version. Bump this when adding a new migration step.
-pub const CURRENT_SCHEMA_VERSION: u32 = 15;
+pub const CURRENT_SCHEMA_VERSION: u32 = 41;
 
 /// Create all required SQLite tables per data-model.md and run any pending migrations.
 pub fn create_tables(conn: &Connection) -> Result<(), StateError> {
@@ -18,6 +18,29 @@ pub fn create_tables(conn: &Connection) -> Result<(), StateError> {
     Ok(())
 }
 
+/// Whether every migration up to `CURRENT_SCHEMA_VERSION` has been applied.
+/// Reads only, so it works on a read-only connection.
+pub fn is_current(conn: &Connection) -> Result<bool, StateError> {
+    let tracked: bool = conn
+        .query_row(
+            "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')",
+            [],
+            |row| row.get(0),
+        )
+        .map_err(StateError::sqlite)?;
+    if !tracked {
+        return Ok(false);
+    }
+    let applied: u32 = conn
+        .query_row(
+            "SELECT COALESCE(MAX(version), 0) FROM schema_migrations",
+            [],
+            |row| row.get(0),
+        )
+        .map_err(StateError::sqlite)?;
+    Ok(applied >= CURRENT_SCHEMA_VERSION)
+}
+
 /// Run incremental schema migrations up to `CURRENT_SCHEMA_VERSION`.
 ///
 /// The `schema_migrations` table tracks which version has been applied.
@@ -487,6 +510,454 @@ pub fn migrate(conn: &Connection) -> Result<(), StateError> {
             .map_err(StateError::sqlite)?;
             Ok(())
         },
+        // V16: per-file reference fingerprints used to prefilter find-references.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS file_reference_fingerprints (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    bloom BLOB NOT NULL,
+                    identifier_count INTEGER NOT NULL DEFAULT 0,
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V17: SQL, HTML and regex strings embedded in source, with parse errors.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS string_injections (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    language TEXT NOT NULL,
+                    host TEXT,
+                    symbol_id TEXT,
+                    symbol TEXT,
+                    content TEXT NOT NULL,
+                    tables TEXT NOT NULL DEFAULT '',
+                    error TEXT
+                );
+                CREATE INDEX IF NOT EXISTS idx_string_injections_file
+                    ON string_injections(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V18: Go templates with the data fields and templates they reference.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS go_templates (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    name TEXT NOT NULL,
+                    kind TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    fields TEXT NOT NULL DEFAULT '[]',
+                    calls TEXT NOT NULL DEFAULT '[]'
+                );
+                CREATE INDEX IF NOT EXISTS idx_go_templates_name
+                    ON go_templates(repo, \"ref\", name);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V19: `//go:embed` directives with the files they capture.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS go_embeds (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    variable TEXT NOT NULL,
+                    patterns TEXT NOT NULL DEFAULT '[]',
+                    files TEXT NOT NULL DEFAULT '[]',
+                    missing TEXT NOT NULL DEFAULT '[]',
+                    served INTEGER NOT NULL DEFAULT 0
+                );
+                CREATE INDEX IF NOT EXISTS idx_go_embeds_file
+                    ON go_embeds(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V20: per-ref index mode (full or signatures-only).
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS index_modes (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    bodies INTEGER NOT NULL DEFAULT 1,
+                    PRIMARY KEY(repo, \"ref\")
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V21: qualified-name index for prefix completion of symbol names.
+        |conn| {
+            conn.execute_batch(
+                "CREATE INDEX IF NOT EXISTS idx_symbol_relations_qualified_name
+                    ON symbol_relations(repo, \"ref\", qualified_name);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V22: Go modules of a go.work or multi-go.mod workspace.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS go_modules (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    module_path TEXT NOT NULL,
+                    dir TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", module_path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V23: TODO/FIXME/HACK comments and deprecation notices.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS todo_markers (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    marker TEXT NOT NULL,
+                    text TEXT NOT NULL,
+                    assignee TEXT,
+                    symbol_id TEXT,
+                    symbol TEXT
+                );
+                CREATE INDEX IF NOT EXISTS idx_todo_markers_file
+                    ON todo_markers(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V24: goroutine launches, channels, mutexes and WaitGroups.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS concurrency_sites (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    kind TEXT NOT NULL,
+                    detail TEXT NOT NULL,
+                    symbol_id TEXT,
+                    symbol TEXT
+                );
+                CREATE INDEX IF NOT EXISTS idx_concurrency_sites_file
+                    ON concurrency_sites(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V25: HTTP route registrations.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS http_routes (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    method TEXT NOT NULL,
+                    route TEXT NOT NULL,
+                    handler TEXT NOT NULL,
+                    framework TEXT NOT NULL,
+                    symbol_id TEXT,
+                    symbol TEXT
+                );
+                CREATE INDEX IF NOT EXISTS idx_http_routes_file
+                    ON http_routes(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V26: project roots of a monorepo.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS workspace_projects (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    dir TEXT NOT NULL,
+                    name TEXT NOT NULL,
+                    kind TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", dir)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V27: dependency indexing mode of the last index run.
+        // Idempotent: the column already exists in the base DDL for fresh installs.
+        |conn| {
+            let has_column: bool = conn
+                .query_row(
+                    "SELECT COUNT(*) > 0 FROM pragma_table_info('index_modes') WHERE name = 'dependencies'",
+                    [],
+                    |row| row.get(0),
+                )
+                .map_err(StateError::sqlite)?;
+            if !has_column {
+                conn.execute_batch("ALTER TABLE index_modes ADD COLUMN dependencies TEXT;")
+                    .map_err(StateError::sqlite)?;
+            }
+            Ok(())
+        },
+        // V28: git submodules descended into by the last index run.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS submodules (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    name TEXT NOT NULL,
+                    url TEXT,
+                    \"commit\" TEXT,
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V29: import path mappings from `[languages]` settings.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS import_paths (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    language TEXT NOT NULL,
+                    position INTEGER NOT NULL,
+                    pattern TEXT NOT NULL,
+                    target TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", language, position)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V30: origin URL and commit of refs indexed from a repository URL.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS remote_origins (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    url TEXT NOT NULL,
+                    \"commit\" TEXT NOT NULL,
+                    fetched_at TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\")
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V31: files recognized as generated code.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS generated_files (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    reason TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V32: per-file fingerprints of the stored embedding vectors.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS embedded_files (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    fingerprint TEXT NOT NULL,
+                    model_id TEXT NOT NULL,
+                    model_version TEXT NOT NULL,
+                    embedded_at TEXT NOT NULL DEFAULT (datetime('now')),
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V33: cached `cruxe summarize` results per package and backend.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS package_summaries (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    package TEXT NOT NULL,
+                    backend TEXT NOT NULL,
+                    fingerprint TEXT NOT NULL,
+                    summary TEXT NOT NULL,
+                    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+                    PRIMARY KEY(repo, \"ref\", package, backend)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V34: last commit to change each symbol, per `git blame`.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS symbol_blame (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    symbol_stable_id TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    \"commit\" TEXT NOT NULL,
+                    author TEXT NOT NULL,
+                    author_email TEXT NOT NULL,
+                    author_time INTEGER NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", symbol_stable_id)
+                );
+                CREATE INDEX IF NOT EXISTS idx_symbol_blame_path
+                    ON symbol_blame(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V35: extraction results per file version, shared between refs.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS blob_artifacts (
+                    repo TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    content_hash TEXT NOT NULL,
+                    language TEXT NOT NULL,
+                    bodies INTEGER NOT NULL,
+                    built_ref TEXT NOT NULL,
+                    artifacts BLOB NOT NULL,
+                    created_at TEXT NOT NULL,
+                    PRIMARY KEY(repo, path, content_hash, language, bodies)
+                );
+                CREATE INDEX IF NOT EXISTS idx_file_manifest_content
+                    ON file_manifest(repo, path, content_hash);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V36: regions of files the parser recovered around.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS parse_errors (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    start_line INTEGER NOT NULL,
+                    end_line INTEGER NOT NULL,
+                    kind TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", path, start_line)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V37: files in scope left out of the index, with why.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS skipped_files (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    reason TEXT NOT NULL,
+                    detail TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V38: findings of `[plugins]` analyzers, per file.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS plugin_findings (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    plugin TEXT NOT NULL,
+                    rule TEXT NOT NULL,
+                    severity TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    symbol TEXT NOT NULL,
+                    message TEXT NOT NULL
+                );
+                CREATE INDEX IF NOT EXISTS idx_plugin_findings_file
+                    ON plugin_findings(repo, \"ref\", path);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V39: encodings files were transcoded from.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS file_encodings (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    encoding TEXT NOT NULL,
+                    PRIMARY KEY(repo, \"ref\", path)
+                );",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V40: parameters and local variables with their uses.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS local_bindings (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    name TEXT NOT NULL,
+                    kind TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    col INTEGER NOT NULL,
+                    symbol_id TEXT,
+                    symbol TEXT,
+                    uses TEXT NOT NULL DEFAULT '[]'
+                );
+                CREATE INDEX IF NOT EXISTS idx_local_bindings_file
+                    ON local_bindings(repo, \"ref\", path);
+                CREATE INDEX IF NOT EXISTS idx_local_bindings_name
+                    ON local_bindings(repo, \"ref\", name);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
+        // V41: constant values and notable string literals.
+        |conn| {
+            conn.execute_batch(
+                "CREATE TABLE IF NOT EXISTS literals (
+                    repo TEXT NOT NULL,
+                    \"ref\" TEXT NOT NULL,
+                    path TEXT NOT NULL,
+                    line INTEGER NOT NULL,
+                    value TEXT NOT NULL,
+                    kind TEXT NOT NULL,
+                    defines INTEGER NOT NULL DEFAULT 0,
+                    symbol_id TEXT,
+                    symbol TEXT
+                );
+                CREATE INDEX IF NOT EXISTS idx_literals_file
+                    ON literals(repo, \"ref\", path);
+                CREATE INDEX IF NOT EXISTS idx_literals_value
+                    ON literals(repo, \"ref\", value);",
+            )
+            .map_err(StateError::sqlite)?;
+            Ok(())
+        },
     ];
 
     for version in (current + 1)..=(CURRENT_SCHEMA_VERSION) {
@@ -557,6 +1028,8 @@ CREATE INDEX IF NOT EXISTS idx_symbol_relations_lookup
     ON symbol_relations(repo, "ref", path, line_start);
 CREATE INDEX IF NOT EXISTS idx_symbol_relations_name
     ON symbol_relations(repo, "ref", name);
+CREATE INDEX IF NOT EXISTS idx_symbol_relations_qualified_name
+    ON symbol_relations(repo, "ref", qualified_name);
 CREATE INDEX IF NOT EXISTS idx_symbol_relations_symbol_id
     ON symbol_relations(repo, "ref", symbol_id);
 CREATE INDEX IF NOT EXISTS idx_symbol_relations_symbol_stable_id
@@ -702,6 +1175,279 @@ CREATE INDEX IF NOT EXISTS idx_semantic_enrichment_queue_scope_status
 CREATE INDEX IF NOT EXISTS idx_semantic_enrichment_queue_key_generation
     ON semantic_enrichment_queue(project_id, "ref", path, generation DESC);
 
+CREATE TABLE IF NOT EXISTS file_reference_fingerprints (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    bloom BLOB NOT NULL,
+    identifier_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS string_injections (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    host TEXT,
+    symbol_id TEXT,
+    symbol TEXT,
+    content TEXT NOT NULL,
+    tables TEXT NOT NULL DEFAULT '',
+    error TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_string_injections_file
+    ON string_injections(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS go_templates (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    fields TEXT NOT NULL DEFAULT '[]',
+    calls TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS idx_go_templates_name
+    ON go_templates(repo, "ref", name);
+
+CREATE TABLE IF NOT EXISTS go_embeds (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    variable TEXT NOT NULL,
+    patterns TEXT NOT NULL DEFAULT '[]',
+    files TEXT NOT NULL DEFAULT '[]',
+    missing TEXT NOT NULL DEFAULT '[]',
+    served INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_go_embeds_file
+    ON go_embeds(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS index_modes (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    bodies INTEGER NOT NULL DEFAULT 1,
+    dependencies TEXT,
+    PRIMARY KEY(repo, "ref")
+);
+
+CREATE TABLE IF NOT EXISTS go_modules (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    module_path TEXT NOT NULL,
+    dir TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", module_path)
+);
+
+CREATE TABLE IF NOT EXISTS todo_markers (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    marker TEXT NOT NULL,
+    text TEXT NOT NULL,
+    assignee TEXT,
+    symbol_id TEXT,
+    symbol TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_todo_markers_file
+    ON todo_markers(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS concurrency_sites (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    symbol_id TEXT,
+    symbol TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_concurrency_sites_file
+    ON concurrency_sites(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS http_routes (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    method TEXT NOT NULL,
+    route TEXT NOT NULL,
+    handler TEXT NOT NULL,
+    framework TEXT NOT NULL,
+    symbol_id TEXT,
+    symbol TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_http_routes_file
+    ON http_routes(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS workspace_projects (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    dir TEXT NOT NULL,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", dir)
+);
+
+CREATE TABLE IF NOT EXISTS submodules (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT,
+    "commit" TEXT,
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS import_paths (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    language TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    pattern TEXT NOT NULL,
+    target TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", language, position)
+);
+
+CREATE TABLE IF NOT EXISTS remote_origins (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    url TEXT NOT NULL,
+    "commit" TEXT NOT NULL,
+    fetched_at TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref")
+);
+
+CREATE TABLE IF NOT EXISTS generated_files (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS embedded_files (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    model_id TEXT NOT NULL,
+    model_version TEXT NOT NULL,
+    embedded_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS package_summaries (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    package TEXT NOT NULL,
+    backend TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY(repo, "ref", package, backend)
+);
+
+CREATE TABLE IF NOT EXISTS symbol_blame (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    symbol_stable_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    "commit" TEXT NOT NULL,
+    author TEXT NOT NULL,
+    author_email TEXT NOT NULL,
+    author_time INTEGER NOT NULL,
+    PRIMARY KEY(repo, "ref", symbol_stable_id)
+);
+CREATE INDEX IF NOT EXISTS idx_symbol_blame_path ON symbol_blame(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS blob_artifacts (
+    repo TEXT NOT NULL,
+    path TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    language TEXT NOT NULL,
+    bodies INTEGER NOT NULL,
+    built_ref TEXT NOT NULL,
+    artifacts BLOB NOT NULL,
+    created_at TEXT NOT NULL,
+    PRIMARY KEY(repo, path, content_hash, language, bodies)
+);
+CREATE INDEX IF NOT EXISTS idx_file_manifest_content ON file_manifest(repo, path, content_hash);
+
+CREATE TABLE IF NOT EXISTS parse_errors (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", path, start_line)
+);
+
+CREATE TABLE IF NOT EXISTS skipped_files (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS plugin_findings (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    plugin TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_plugin_findings_file ON plugin_findings(repo, "ref", path);
+
+CREATE TABLE IF NOT EXISTS file_encodings (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    encoding TEXT NOT NULL,
+    PRIMARY KEY(repo, "ref", path)
+);
+
+CREATE TABLE IF NOT EXISTS local_bindings (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    col INTEGER NOT NULL,
+    symbol_id TEXT,
+    symbol TEXT,
+    uses TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS idx_local_bindings_file ON local_bindings(repo, "ref", path);
+CREATE INDEX IF NOT EXISTS idx_local_bindings_name ON local_bindings(repo, "ref", name);
+
+CREATE TABLE IF NOT EXISTS literals (
+    repo TEXT NOT NULL,
+    "ref" TEXT NOT NULL,
+    path TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    value TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    defines INTEGER NOT NULL DEFAULT 0,
+    symbol_id TEXT,
+    symbol TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_literals_file ON literals(repo, "ref", path);
+CREATE INDEX IF NOT EXISTS idx_literals_value ON literals(repo, "ref", value);
+
 "#;
 
 #[cfg(test)]
@@ -737,6 +1483,30 @@ mod tests {
         assert!(tables.contains(&"semantic_vectors".to_string()));
         assert!(tables.contains(&"semantic_vector_meta".to_string()));
         assert!(tables.contains(&"semantic_enrichment_queue".to_string()));
+        assert!(tables.contains(&"file_reference_fingerprints".to_string()));
+        assert!(tables.contains(&"string_injections".to_string()));
+        assert!(tables.contains(&"go_templates".to_string()));
+        assert!(tables.contains(&"go_embeds".to_string()));
+        assert!(tables.contains(&"index_modes".to_string()));
+        assert!(tables.contains(&"go_modules".to_string()));
+        assert!(tables.contains(&"todo_markers".to_string()));
+        assert!(tables.contains(&"concurrency_sites".to_string()));
+        assert!(tables.contains(&"http_routes".to_string()));
+        assert!(tables.contains(&"workspace_projects".to_string()));
+        assert!(tables.contains(&"submodules".to_string()));
+        assert!(tables.contains(&"import_paths".to_string()));
+        assert!(tables.contains(&"remote_origins".to_string()));
+        assert!(tables.contains(&"generated_files".to_string()));
+        assert!(tables.contains(&"embedded_files".to_string()));
+        assert!(tables.contains(&"package_summaries".to_string()));
+        assert!(tables.contains(&"symbol_blame".to_string()));
+        assert!(tables.contains(&"blob_artifacts".to_string()));
+        assert!(tables.contains(&"parse_errors".to_string()));
+        assert!(tables.contains(&"plugin_findings".to_string()));
+        assert!(tables.contains(&"skipped_files".to_string()));
+        assert!(tables.contains(&"file_encodings".to_string()));
+        assert!(tables.contains(&"local_bindings".to_string()));
+        assert!(tables.contains(&"literals".to_string()));
     }
 
     #[test]
@@ -900,6 +1670,22 @@ mod tests {
         assert_eq!(version2, CURRENT_SCHEMA_VERSION);
     }
 
+    #[test]
+    fn is_current_only_after_every_migration_is_applied() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        assert!(!is_current(&conn).unwrap());
+        create_tables(&conn).unwrap();
+        assert!(is_current(&conn).unwrap());
+
+        conn.execute(
+            "DELETE FROM schema_migrations WHERE version = ?1",
+            [CURRENT_SCHEMA_VERSION],
+        )
+        .unwrap();
+        assert!(!is_current(&conn).unwrap());
+    }
+
     #[test]
     fn test_v13_backfills_confidence_provenance_from_legacy_rows() {
         let dir = tempdir().unwrap();
@@ -0,0 +1,398 @@
+//! Upload of SCIP indexes for `cruxe upload`.
+//!
+//! An `http(s)://` endpoint is a Sourcegraph instance: the index is gzipped
+//! and posted to `/.api/scip/upload`, the endpoint `src code-intel upload`
+//! uses, in parts when it is larger than one request may be. Any other
+//! endpoint (`gs://`, `s3://`, a directory) stores the index as a plain
+//! object through [`RemoteCache`].
+//!
+//! Every request is retried with exponential backoff on network errors,
+//! `429` and `5xx`; other statuses fail at once.
+
+use crate::remote_cache::RemoteCache;
+use cruxe_core::error::StateError;
+use flate2::Compression;
+use flate2::write::GzEncoder;
+use reqwest::StatusCode;
+use std::fs::File;
+use std::io::{self, BufReader, Read, Seek, SeekFrom};
+use std::path::Path;
+use std::sync::Arc;
+use std::time::Duration;
+
+const HTTP_TIMEOUT: Duration = Duration::from_secs(600);
+const UPLOAD_PATH: &str = "/.api/scip/upload";
+const MAX_BACKOFF: Duration = Duration::from_secs(30);
+
+/// Largest request body, as for `src code-intel upload`.
+pub const DEFAULT_MAX_PART_SIZE: u64 = 100 * 1024 * 1024;
+
+/// Called with the bytes sent so far and the total to send.
+pub type Progress = Arc<dyn Fn(u64, u64) + Send + Sync>;
+
+/// Where an index goes.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum UploadTarget {
+    Sourcegraph {
+        endpoint: String,
+        token: Option<String>,
+    },
+    Object(RemoteCache),
+}
+
+impl UploadTarget {
+    /// Target for `endpoint`; `token` is only used by Sourcegraph.
+    pub fn from_endpoint(endpoint: &str, token: Option<String>) -> Self {
+        let endpoint = endpoint.trim().trim_end_matches('/');
+        if endpoint.starts_with("http://") || endpoint.starts_with("https://") {
+            Self::Sourcegraph {
+                endpoint: endpoint.to_string(),
+                token,
+            }
+        } else {
+            Self::Object(RemoteCache::from_url(endpoint, None))
+        }
+    }
+}
+
+/// What the index describes.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct UploadMetadata {
+    /// Repository name as Sourcegraph knows it, e.g. `github.com/org/repo`.
+    pub repository: String,
+    /// Full commit hash.
+    pub commit: String,
+    /// Directory of the index relative to the repository root; empty for
+    /// the root itself.
+    pub root: String,
+    pub indexer_name: String,
+    pub indexer_version: String,
+}
+
+impl UploadMetadata {
+    /// Object key for non-Sourcegraph targets.
+    pub fn object_key(&self) -> String {
+        let root = self.root.trim_matches('/');
+        let mut key = self.repository.trim_matches('/').to_string();
+        key.push('/');
+        key.push_str(&self.commit);
+        if !root.is_empty() {
+            key.push('/');
+            key.push_str(root);
+        }
+        key.push_str("/index.scip");
+        key
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct UploadOptions {
+    /// Attempts per request, at least 1.
+    pub attempts: u32,
+    /// Bodies above this are sent in parts.
+    pub max_part_size: u64,
+}
+
+impl Default for UploadOptions {
+    fn default() -> Self {
+        Self {
+            attempts: 3,
+            max_part_size: DEFAULT_MAX_PART_SIZE,
+        }
+    }
+}
+
+/// Upload the SCIP file at `index`. Returns the Sourcegraph upload id, or
+/// the location of the stored object.
+pub fn upload_index(
+    target: &UploadTarget,
+    index: &Path,
+    metadata: &UploadMetadata,
+    options: &UploadOptions,
+    progress: Progress,
+) -> Result<String, StateError> {
+    match target {
+        UploadTarget::Sourcegraph { endpoint, token } => {
+            let staging = tempfile::tempdir().map_err(StateError::Io)?;
+            let gzipped = staging.path().join("index.scip.gz");
+            gzip(index, &gzipped)?;
+            let client = SourcegraphClient {
+                client: reqwest::blocking::Client::builder()
+                    .timeout(HTTP_TIMEOUT)
+                    .build()
+                    .map_err(StateError::external)?,
+                url: format!("{endpoint}{UPLOAD_PATH}"),
+                token: token.clone(),
+                attempts: options.attempts.max(1),
+            };
+            client.upload(&gzipped, metadata, options.max_part_size.max(1), progress)
+        }
+        UploadTarget::Object(cache) => {
+            let key = metadata.object_key();
+            let total = std::fs::metadata(index).map_err(StateError::Io)?.len();
+            progress(0, total);
+            with_retries(options.attempts.max(1), || {
+                cache.upload(&key, index).map_err(Attempt::Retry)
+            })?;
+            progress(total, total);
+            Ok(cache.location(&key))
+        }
+    }
+}
+
+fn gzip(source: &Path, dest: &Path) -> Result<(), StateError> {
+    let mut reader = BufReader::new(File::open(source).map_err(StateError::Io)?);
+    let mut encoder = GzEncoder::new(
+        File::create(dest).map_err(StateError::Io)?,
+        Compression::default(),
+    );
+    io::copy(&mut reader, &mut encoder).map_err(StateError::Io)?;
+    encoder.finish().map_err(StateError::Io)?;
+    Ok(())
+}
+
+/// Outcome of one failed attempt.
+enum Attempt {
+    Retry(StateError),
+    Fatal(StateError),
+}
+
+/// Run `request` up to `attempts` times, backing off 1s, 2s, 4s, ... between
+/// retryable failures.
+fn with_retries<T>(
+    attempts: u32,
+    mut request: impl FnMut() -> Result<T, Attempt>,
+) -> Result<T, StateError> {
+    let mut backoff = Duration::from_secs(1);
+    for attempt in 1.. {
+        match request() {
+            Ok(value) => return Ok(value),
+            Err(Attempt::Fatal(err)) => return Err(err),
+            Err(Attempt::Retry(err)) if attempt >= attempts => return Err(err),
+            Err(Attempt::Retry(err)) => {
+                tracing::warn!(
+                    "upload attempt {attempt}/{attempts} failed: {err}; retrying in {}s",
+                    backoff.as_secs()
+                );
+                std::thread::sleep(backoff);
+                backoff = (backoff * 2).min(MAX_BACKOFF);
+            }
+        }
+    }
+    unreachable!("the loop only ends by returning")
+}
+
+fn is_retryable(status: StatusCode) -> bool {
+    status == StatusCode::TOO_MANY_REQUESTS || status.is_server_error()
+}
+
+struct SourcegraphClient {
+    client: reqwest::blocking::Client,
+    url: String,
+    token: Option<String>,
+    attempts: u32,
+}
+
+impl SourcegraphClient {
+    fn upload(
+        &self,
+        gzipped: &Path,
+        metadata: &UploadMetadata,
+        max_part_size: u64,
+        progress: Progress,
+    ) -> Result<String, StateError> {
+        let total = std::fs::metadata(gzipped).map_err(StateError::Io)?.len();
+        let mut query = vec![
+            ("repository", metadata.repository.clone()),
+            ("commit", metadata.commit.clone()),
+            ("root", metadata.root.clone()),
+            ("indexerName", metadata.indexer_name.clone()),
+            ("indexerVersion", metadata.indexer_version.clone()),
+        ];
+        progress(0, total);
+
+        if total <= max_part_size {
+            let id = self.post(&query, Some((gzipped, 0, total)), total, &progress)?;
+            return upload_id(id);
+        }
+
+        let parts = total.div_ceil(max_part_size);
+        query.push(("multiPart", "true".to_string()));
+        query.push(("numParts", parts.to_string()));
+        let id = upload_id(self.post(&query, None, total, &progress)?)?;
+        for part in 0..parts {
+            let offset = part * max_part_size;
+            let len = max_part_size.min(total - offset);
+            let query = [("uploadId", id.clone()), ("index", part.to_string())];
+            self.post(&query, Some((gzipped, offset, len)), total, &progress)?;
+        }
+        self.post(
+            &[("uploadId", id.clone()), ("done", "true".to_string())],
+            None,
+            total,
+            &progress,
+        )?;
+        Ok(id)
+    }
+
+    /// POST `query` with `len` bytes of `file` from `offset` as the body,
+    /// returning the response body.
+    fn post(
+        &self,
+        query: &[(&str, String)],
+        body: Option<(&Path, u64, u64)>,
+        total: u64,
+        progress: &Progress,
+    ) -> Result<String, StateError> {
+        with_retries(self.attempts, || {
+            let mut request = self.client.post(&self.url).query(query);
+            if let Some(token) = &self.token {
+                request = request.header("Authorization", format!("token {token}"));
+            }
+            if let Some((path, offset, len)) = body {
+                let mut file = File::open(path).map_err(|e| Attempt::Fatal(StateError::Io(e)))?;
+                file.seek(SeekFrom::Start(offset))
+                    .map_err(|e| Attempt::Fatal(StateError::Io(e)))?;
+                let reader = ProgressReader {
+                    inner: file.take(len),
+                    sent: offset,
+                    total,
+                    progress: Arc::clone(progress),
+                };
+                request = request
+                    .header("Content-Type", "application/x-protobuf+scip")
+                    .body(reqwest::blocking::Body::sized(reader, len));
+            }
+            let response = request
+                .send()
+                .map_err(|e| Attempt::Retry(StateError::external(e)))?;
+            let status = response.status();
+            let text = response.text().unwrap_or_default();
+            if status.is_success() {
+                return Ok(text);
+            }
+            let err = StateError::external(format!(
+                "POST {} returned {}: {}",
+                self.url,
+                status,
+                text.trim()
+            ));
+            Err(if is_retryable(status) {
+                Attempt::Retry(err)
+            } else {
+                Attempt::Fatal(err)
+            })
+        })
+    }
+}
+
+/// The `id` of an upload response, `{"id": "42"}`.
+fn upload_id(body: String) -> Result<String, StateError> {
+    let value: serde_json::Value = serde_json::from_str(&body)
+        .map_err(|e| StateError::external(format!("unexpected upload response `{body}`: {e}")))?;
+    match &value["id"] {
+        serde_json::Value::String(id) => Ok(id.clone()),
+        serde_json::Value::Number(id) => Ok(id.to_string()),
+        _ => Err(StateError::external(format!(
+            "upload response has no id: `{body}`"
+        ))),
+    }
+}
+
+/// Reports every read to the progress callback.
+struct ProgressReader<R> {
+    inner: R,
+    sent: u64,
+    total: u64,
+    progress: Progress,
+}
+
+impl<R: Read> Read for ProgressReader<R> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        let read = self.inner.read(buf)?;
+        self.sent += read as u64;
+        (self.progress)(self.sent, self.total);
+        Ok(read)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::Mutex;
+
+    fn metadata() -> UploadMetadata {
+        UploadMetadata {
+            repository: "github.com/acme/api".to_string(),
+            commit: "0123456789abcdef0123456789abcdef01234567".to_string(),
+            root: String::new(),
+            indexer_name: "cruxe".to_string(),
+            indexer_version: "0.1.0".to_string(),
+        }
+    }
+
+    #[test]
+    fn endpoints_select_the_target() {
+        assert_eq!(
+            UploadTarget::from_endpoint("https://sourcegraph.example.com/", Some("t".into())),
+            UploadTarget::Sourcegraph {
+                endpoint: "https://sourcegraph.example.com".to_string(),
+                token: Some("t".to_string()),
+            }
+        );
+        assert!(matches!(
+            UploadTarget::from_endpoint("gs://indexes", None),
+            UploadTarget::Object(RemoteCache::Gcs { .. })
+        ));
+
+        let mut nested = metadata();
+        assert_eq!(
+            nested.object_key(),
+            "github.com/acme/api/0123456789abcdef0123456789abcdef01234567/index.scip"
+        );
+        nested.root = "services/billing/".to_string();
+        assert!(
+            nested
+                .object_key()
+                .ends_with("01234567/services/billing/index.scip")
+        );
+    }
+
+    #[test]
+    fn object_uploads_retry_and_report_progress() {
+        let tmp = tempfile::tempdir().unwrap();
+        let index = tmp.path().join("index.scip");
+        std::fs::write(&index, b"scip").unwrap();
+        let reports = Arc::new(Mutex::new(Vec::new()));
+        let seen = Arc::clone(&reports);
+        let target =
+            UploadTarget::from_endpoint(&tmp.path().join("bucket").to_string_lossy(), None);
+
+        let location = upload_index(
+            &target,
+            &index,
+            &metadata(),
+            &UploadOptions::default(),
+            Arc::new(move |sent, total| seen.lock().unwrap().push((sent, total))),
+        )
+        .unwrap();
+        assert!(location.ends_with("index.scip"));
+        assert_eq!(std::fs::read(&location).unwrap(), b"scip");
+        assert_eq!(*reports.lock().unwrap(), vec![(0, 4), (4, 4)]);
+
+        let mut calls = 0;
+        let result = with_retries(2, || {
+            calls += 1;
+            Err::<(), _>(Attempt::Fatal(StateError::external("403")))
+        });
+        assert!(result.is_err());
+        assert_eq!(calls, 1);
+    }
+
+    #[test]
+    fn upload_ids_may_be_strings_or_numbers() {
+        assert_eq!(upload_id(r#"{"id":"17"}"#.to_string()).unwrap(), "17");
+        assert_eq!(upload_id(r#"{"id":17}"#.to_string()).unwrap(), "17");
+        assert!(upload_id("<html>".to_string()).is_err());
+    }
+}
@@ -0,0 +1,68 @@
+//! On-disk layout of index shards.
+//!
+//! Each shard is a self-contained data directory (its own state DB and
+//! Tantivy indices) at `<data_dir>/shards/<name>`, so it can be built on
+//! another machine and moved in as a state bundle.
+
+use cruxe_core::constants;
+use cruxe_core::error::StateError;
+use std::path::{Path, PathBuf};
+
+const SHARDS_DIR: &str = "shards";
+
+/// Data directory of one shard.
+pub fn shard_data_dir(data_dir: &Path, name: &str) -> PathBuf {
+    data_dir.join(SHARDS_DIR).join(name)
+}
+
+/// Shard names are used as directory names.
+pub fn is_valid_shard_name(name: &str) -> bool {
+    !name.is_empty()
+        && name != "."
+        && name != ".."
+        && name
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '_' | '.'))
+}
+
+/// Names of the shards that have a state DB, sorted.
+pub fn list_built_shards(data_dir: &Path) -> Result<Vec<String>, StateError> {
+    let root = data_dir.join(SHARDS_DIR);
+    if !root.exists() {
+        return Ok(Vec::new());
+    }
+    let mut names = Vec::new();
+    for entry in std::fs::read_dir(&root)? {
+        let entry = entry?;
+        let name = entry.file_name().to_string_lossy().to_string();
+        if is_valid_shard_name(&name) && entry.path().join(constants::STATE_DB_FILE).exists() {
+            names.push(name);
+        }
+    }
+    names.sort();
+    Ok(names)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn lists_only_shards_with_a_state_db() {
+        let dir = tempfile::tempdir().unwrap();
+        assert!(list_built_shards(dir.path()).unwrap().is_empty());
+
+        for name in ["web", "payments", "partial"] {
+            std::fs::create_dir_all(shard_data_dir(dir.path(), name)).unwrap();
+        }
+        for name in ["web", "payments"] {
+            std::fs::write(
+                shard_data_dir(dir.path(), name).join(constants::STATE_DB_FILE),
+                b"",
+            )
+            .unwrap();
+        }
+        assert_eq!(list_built_shards(dir.path()).unwrap(), ["payments", "web"]);
+        assert!(!is_valid_shard_name("../escape"));
+    }
+}
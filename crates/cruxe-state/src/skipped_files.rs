@@ -0,0 +1,148 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::{SkipReason, SkippedFileRecord};
+use rusqlite::types::Type;
+use rusqlite::{Connection, params};
+
+/// Replace every skipped file recorded for a repo/ref. Skipped files are
+/// not in the manifest, so each index run looks at them all again.
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    records: &[SkippedFileRecord],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM skipped_files WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    for record in records {
+        record_skip(conn, repo, ref_name, record)?;
+    }
+    Ok(())
+}
+
+/// Record that a file was skipped, replacing what was recorded for it.
+pub fn record_skip(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    record: &SkippedFileRecord,
+) -> Result<(), StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR REPLACE INTO skipped_files (repo, \"ref\", path, reason, detail)
+             VALUES (?1, ?2, ?3, ?4, ?5)",
+        )
+        .map_err(StateError::sqlite)?;
+    stmt.execute(params![
+        repo,
+        ref_name,
+        record.path,
+        record.reason.as_str(),
+        record.detail,
+    ])
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Forget a skipped file (indexed again, or deleted).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM skipped_files WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Skipped files of a repo/ref ordered by path.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<SkippedFileRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, reason, detail
+             FROM skipped_files
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            let reason: String = row.get(1)?;
+            Ok(SkippedFileRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                reason: reason.parse::<SkipReason>().map_err(|_| {
+                    rusqlite::Error::InvalidColumnType(1, "reason".to_string(), Type::Text)
+                })?,
+                detail: row.get(2)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, reason: SkipReason) -> SkippedFileRecord {
+        SkippedFileRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            reason,
+            detail: String::new(),
+        }
+    }
+
+    #[test]
+    fn runs_replace_and_syncs_update_single_files() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                record("web/app.min.js", SkipReason::LongLines),
+                record("assets/logo.png.go", SkipReason::Binary),
+            ],
+        )
+        .unwrap();
+        record_skip(
+            &conn,
+            "repo",
+            "main",
+            &record("gen/huge.go", SkipReason::TooLarge),
+        )
+        .unwrap();
+        delete_for_file(&conn, "repo", "main", "web/app.min.js").unwrap();
+        let listed = list_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(
+            listed,
+            [
+                record("assets/logo.png.go", SkipReason::Binary),
+                record("gen/huge.go", SkipReason::TooLarge),
+            ]
+        );
+
+        replace_for_ref(&conn, "repo", "main", &[]).unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -0,0 +1,133 @@
+use crate::workspace_projects::dir_contains;
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use schemars::JsonSchema;
+use serde::Serialize;
+
+/// An initialized git submodule whose files were indexed with the
+/// superproject.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct Submodule {
+    /// Name from `.gitmodules`, usually the path it was added at.
+    pub name: String,
+    /// Repository-relative directory of the checkout.
+    pub path: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub url: Option<String>,
+    /// Commit checked out in the working tree.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub commit: Option<String>,
+}
+
+/// Replace the submodules recorded for a ref; empty when the last index run
+/// did not descend into them.
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    submodules: &[Submodule],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM submodules WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR IGNORE INTO submodules (repo, \"ref\", path, name, url, \"commit\")
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+        )
+        .map_err(StateError::sqlite)?;
+    for submodule in submodules {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            submodule.path,
+            submodule.name,
+            submodule.url,
+            submodule.commit
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Submodules of a repo/ref ordered by path.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<Submodule>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT name, path, url, \"commit\" FROM submodules
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(Submodule {
+                name: row.get(0)?,
+                path: row.get(1)?,
+                url: row.get(2)?,
+                commit: row.get(3)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// The submodule `path` was indexed from, if any. Nested submodules are not
+/// descended into, so at most one holds a path.
+pub fn origin<'a>(submodules: &'a [Submodule], path: &str) -> Option<&'a Submodule> {
+    submodules
+        .iter()
+        .find(|submodule| dir_contains(&submodule.path, path))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    #[test]
+    fn paths_resolve_to_their_submodule() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        let submodule = |name: &str, path: &str| Submodule {
+            name: name.to_string(),
+            path: path.to_string(),
+            url: Some(format!("https://example.com/{name}.git")),
+            commit: None,
+        };
+        replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                submodule("proto", "third_party/proto"),
+                submodule("ui", "web/ui"),
+            ],
+        )
+        .unwrap();
+        let submodules = list_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(submodules.len(), 2);
+        assert_eq!(
+            submodules[0].url.as_deref(),
+            Some("https://example.com/proto.git")
+        );
+
+        let name = |path: &str| origin(&submodules, path).map(|s| s.name.as_str());
+        assert_eq!(name("third_party/proto/api.proto"), Some("proto"));
+        assert_eq!(name("web/ui/src/app.ts"), Some("ui"));
+        assert_eq!(name("web/uix/app.ts"), None);
+        assert_eq!(name("main.go"), None);
+
+        replace_for_ref(&conn, "repo", "main", &[]).unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
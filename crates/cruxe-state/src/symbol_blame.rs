@@ -0,0 +1,162 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use std::collections::HashMap;
+
+/// The last commit to change any line of a symbol, per `git blame`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SymbolBlame {
+    pub symbol_stable_id: String,
+    pub path: String,
+    pub commit: String,
+    pub author: String,
+    pub author_email: String,
+    /// Author time, seconds since the Unix epoch.
+    pub author_time: i64,
+}
+
+impl SymbolBlame {
+    /// Whole days between the change and `now` (seconds since the epoch).
+    pub fn age_days(&self, now: i64) -> u64 {
+        (now - self.author_time).max(0) as u64 / 86_400
+    }
+}
+
+/// Replace the blame of the symbols of one file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    blame: &[SymbolBlame],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR REPLACE INTO symbol_blame
+                (repo, \"ref\", symbol_stable_id, path, \"commit\", author, author_email, author_time)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)",
+        )
+        .map_err(StateError::sqlite)?;
+    for entry in blame {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            entry.symbol_stable_id,
+            path,
+            entry.commit,
+            entry.author,
+            entry.author_email,
+            entry.author_time,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the blame of a file's symbols (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM symbol_blame WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// Blame of every symbol of a repo/ref, keyed by stable symbol id; empty
+/// when the ref was indexed without `[index] blame`.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<HashMap<String, SymbolBlame>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT symbol_stable_id, path, \"commit\", author, author_email, author_time
+             FROM symbol_blame WHERE repo = ?1 AND \"ref\" = ?2",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(SymbolBlame {
+                symbol_stable_id: row.get(0)?,
+                path: row.get(1)?,
+                commit: row.get(2)?,
+                author: row.get(3)?,
+                author_email: row.get(4)?,
+                author_time: row.get(5)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.map(|row| row.map(|blame| (blame.symbol_stable_id.clone(), blame)))
+        .collect::<Result<HashMap<_, _>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn blame(id: &str, path: &str, time: i64) -> SymbolBlame {
+        SymbolBlame {
+            symbol_stable_id: id.to_string(),
+            path: path.to_string(),
+            commit: "a".repeat(40),
+            author: "Ana".to_string(),
+            author_email: "ana@example.com".to_string(),
+            author_time: time,
+        }
+    }
+
+    #[test]
+    fn blame_is_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "auth/token.go",
+            &[
+                blame("validate", "auth/token.go", 100),
+                blame("issue", "auth/token.go", 200),
+            ],
+        )
+        .unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "db/store.go",
+            &[blame("save", "db/store.go", 300)],
+        )
+        .unwrap();
+        replace_for_file(
+            &conn,
+            "repo",
+            "main",
+            "auth/token.go",
+            &[blame("validate", "auth/token.go", 400)],
+        )
+        .unwrap();
+
+        let all = list_for_ref(&conn, "repo", "main").unwrap();
+        assert_eq!(all.len(), 2);
+        assert_eq!(all["validate"].author_time, 400);
+        assert!(!all.contains_key("issue"));
+
+        delete_for_file(&conn, "repo", "main", "db/store.go").unwrap();
+        assert_eq!(list_for_ref(&conn, "repo", "main").unwrap().len(), 1);
+        assert!(list_for_ref(&conn, "repo", "dev").unwrap().is_empty());
+        assert_eq!(blame("x", "x.go", 0).age_days(3 * 86_400 + 5), 3);
+    }
+}
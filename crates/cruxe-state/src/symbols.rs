@@ -87,6 +87,28 @@ pub fn symbol_count(conn: &Connection, repo: &str, r#ref: &str) -> Result<u64, S
     Ok(count as u64)
 }
 
+/// Symbol count of every file of a repo/ref that has symbols.
+pub fn symbol_counts_by_path(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+) -> Result<Vec<(String, u64)>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, COUNT(*) FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2
+             GROUP BY path",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, r#ref], |row| {
+            Ok((row.get(0)?, row.get::<_, i64>(1)? as u64))
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
 /// Find symbols by exact name in a repo/ref scope.
 /// If `path` is provided, results are constrained to that file.
 pub fn find_symbols_by_name(
@@ -127,6 +149,32 @@ pub fn find_symbols_by_name(
     }
 }
 
+/// Find symbols of `language` by exact qualified name in a repo/ref scope.
+pub fn find_symbols_by_qualified_name(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    language: &str,
+    qualified_name: &str,
+) -> Result<Vec<SymbolRecord>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT repo, \"ref\", \"commit\", path, symbol_id, symbol_stable_id, name, qualified_name, kind, language, line_start, line_end, signature, parent_symbol_id, visibility
+             FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND language = ?3 AND qualified_name = ?4
+             ORDER BY path, line_start",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(
+            params![repo, r#ref, language, qualified_name],
+            row_to_symbol_record,
+        )
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
 /// Fetch a symbol by symbol_id.
 pub fn get_symbol_by_id(
     conn: &Connection,
@@ -215,6 +263,157 @@ pub fn list_symbols_in_file(
         .map_err(StateError::sqlite)
 }
 
+/// List every symbol in a repo/ref, ordered by path and line (used by exporters).
+pub fn list_symbols_for_ref(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+) -> Result<Vec<SymbolRecord>, StateError> {
+    let mut symbols = Vec::new();
+    for_each_symbol_for_ref(conn, repo, r#ref, |symbol| {
+        symbols.push(symbol);
+        Ok(())
+    })?;
+    Ok(symbols)
+}
+
+/// Visit every symbol in a repo/ref in [`list_symbols_for_ref`] order without
+/// materializing the whole list. Stops at the first error from `visit`.
+pub fn for_each_symbol_for_ref<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    mut visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    let mut stmt = conn
+        .prepare(
+            "SELECT repo, \"ref\", \"commit\", path, symbol_id, symbol_stable_id, name, qualified_name, kind, language, line_start, line_end, signature, parent_symbol_id, visibility
+             FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line_start, symbol_stable_id",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, r#ref], row_to_symbol_record)
+        .map_err(StateError::sqlite)?;
+    for row in rows {
+        visit(row.map_err(StateError::sqlite)?)?;
+    }
+    Ok(())
+}
+
+/// Visit every function and method of `language` in a repo/ref with its
+/// stored body in `content`, in path/line order (used by `cruxe check`).
+pub fn for_each_function_body<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    language: &str,
+    visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    for_each_body(
+        conn,
+        repo,
+        r#ref,
+        Some(language),
+        &["function", "method"],
+        visit,
+    )
+}
+
+/// Visit every function and method of any language in a repo/ref with its
+/// stored body in `content`, in path/line order (used by `cruxe duplicates`).
+pub fn for_each_callable_body<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    for_each_body(conn, repo, r#ref, None, &["function", "method"], visit)
+}
+
+/// Visit every struct of `language` in a repo/ref with its stored body in
+/// `content`, in path/line order.
+pub fn for_each_struct_body<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    language: &str,
+    visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    for_each_body(conn, repo, r#ref, Some(language), &["struct"], visit)
+}
+
+/// Visit every symbol of any kind and language in a repo/ref that has a
+/// stored body, in path/line order. Nested symbols are visited on their own
+/// and again inside their parent's body.
+pub fn for_each_symbol_body<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    for_each_body(conn, repo, r#ref, None, &[], visit)
+}
+
+fn for_each_body<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    language: Option<&str>,
+    kinds: &[&str],
+    mut visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    let kinds = if kinds.is_empty() {
+        String::new()
+    } else {
+        let list = kinds
+            .iter()
+            .map(|kind| format!("'{kind}'"))
+            .collect::<Vec<_>>()
+            .join(", ");
+        format!("AND kind IN ({list})")
+    };
+    let mut stmt = conn
+        .prepare(&format!(
+            "SELECT repo, \"ref\", \"commit\", path, symbol_id, symbol_stable_id, name, qualified_name, kind, language, line_start, line_end, signature, parent_symbol_id, visibility, content
+             FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND (?3 IS NULL OR language = ?3)
+               {kinds} AND content IS NOT NULL
+             ORDER BY path, line_start, symbol_stable_id"
+        ))
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, r#ref, language], |row| {
+            let mut symbol = row_to_symbol_record(row)?;
+            symbol.content = row.get(15)?;
+            Ok(symbol)
+        })
+        .map_err(StateError::sqlite)?;
+    for row in rows {
+        visit(row.map_err(StateError::sqlite)?)?;
+    }
+    Ok(())
+}
+
 /// List symbols under a path prefix (used for module/package scopes).
 pub fn list_symbols_by_path_prefix(
     conn: &Connection,
@@ -238,6 +437,142 @@ pub fn list_symbols_by_path_prefix(
         .map_err(StateError::sqlite)
 }
 
+/// Distinct symbol names starting with `prefix`, for shell completion. A
+/// prefix containing `.` or `:` also matches qualified names. Both are
+/// range scans over the name indexes, so this stays fast on large repos.
+pub fn complete_symbol_names(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    prefix: &str,
+    limit: usize,
+) -> Result<Vec<String>, StateError> {
+    // Every string starting with `prefix` sorts below `prefix` + U+10FFFF.
+    let upper = format!("{prefix}\u{10FFFF}");
+    let column = if prefix.contains(['.', ':']) {
+        "qualified_name"
+    } else {
+        "name"
+    };
+    let sql = format!(
+        "SELECT DISTINCT {column} FROM symbol_relations
+         WHERE repo = ?1 AND \"ref\" = ?2 AND {column} >= ?3 AND {column} < ?4
+         ORDER BY {column}
+         LIMIT ?5"
+    );
+    let mut stmt = conn.prepare(&sql).map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, r#ref, prefix, upper, limit as i64], |row| {
+            row.get::<_, String>(0)
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// Symbols whose name starts with `initial` in either case and is at least
+/// `min_chars` characters long, in name order, at most `limit` per case when
+/// set. Range scans over the name index, so fuzzy name matching can draw
+/// candidates without reading every symbol.
+pub fn for_each_symbol_with_initial<F>(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    initial: char,
+    min_chars: usize,
+    limit: Option<usize>,
+    mut visit: F,
+) -> Result<(), StateError>
+where
+    F: FnMut(SymbolRecord) -> Result<(), StateError>,
+{
+    let mut stmt = conn
+        .prepare(
+            "SELECT repo, \"ref\", \"commit\", path, symbol_id, symbol_stable_id, name, qualified_name, kind, language, line_start, line_end, signature, parent_symbol_id, visibility
+             FROM symbol_relations
+             WHERE repo = ?1 AND \"ref\" = ?2 AND name >= ?3 AND name < ?4
+               AND length(name) >= ?5
+             ORDER BY name
+             LIMIT ?6",
+        )
+        .map_err(StateError::sqlite)?;
+    let mut cases: Vec<char> = initial
+        .to_lowercase()
+        .chain(initial.to_uppercase())
+        .collect();
+    cases.dedup();
+    // A negative LIMIT is no limit.
+    let limit = limit.map_or(-1, |limit| limit as i64);
+    for case in cases {
+        let lower = case.to_string();
+        // Every name starting with `case` sorts below `case` + U+10FFFF.
+        let upper = format!("{case}\u{10FFFF}");
+        let rows = stmt
+            .query_map(
+                params![repo, r#ref, lower, upper, min_chars as i64, limit],
+                row_to_symbol_record,
+            )
+            .map_err(StateError::sqlite)?;
+        for row in rows {
+            visit(row.map_err(StateError::sqlite)?)?;
+        }
+    }
+    Ok(())
+}
+
+/// Groups of symbols with the same name, kind and body hash found at more
+/// than one path: copies of the same code (vendored, forked). Bodies shorter
+/// than `min_body_bytes` are ignored so trivial one-liners do not match.
+/// Groups and their members are ordered by hash and path.
+pub fn list_content_duplicates(
+    conn: &Connection,
+    repo: &str,
+    r#ref: &str,
+    min_body_bytes: usize,
+) -> Result<Vec<Vec<SymbolRecord>>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT s.repo, s.\"ref\", s.\"commit\", s.path, s.symbol_id, s.symbol_stable_id, s.name, s.qualified_name, s.kind, s.language, s.line_start, s.line_end, s.signature, s.parent_symbol_id, s.visibility, s.content_hash
+             FROM symbol_relations s
+             JOIN (
+                 SELECT content_hash, kind, name
+                 FROM symbol_relations
+                 WHERE repo = ?1 AND \"ref\" = ?2 AND content_hash != '' AND length(content) >= ?3
+                 GROUP BY content_hash, kind, name
+                 HAVING COUNT(DISTINCT path) > 1
+             ) d ON d.content_hash = s.content_hash AND d.kind = s.kind AND d.name = s.name
+             WHERE s.repo = ?1 AND s.\"ref\" = ?2
+             ORDER BY s.content_hash, s.kind, s.name, s.path, s.line_start",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, r#ref, min_body_bytes as i64], |row| {
+            Ok((
+                (
+                    row.get::<_, String>(15)?,
+                    row.get::<_, String>(8)?,
+                    row.get::<_, String>(6)?,
+                ),
+                row_to_symbol_record(row)?,
+            ))
+        })
+        .map_err(StateError::sqlite)?;
+
+    let mut groups: Vec<Vec<SymbolRecord>> = Vec::new();
+    let mut current_key = None;
+    for row in rows {
+        let (key, symbol) = row.map_err(StateError::sqlite)?;
+        if current_key.as_ref() != Some(&key) {
+            groups.push(Vec::new());
+            current_key = Some(key);
+        }
+        if let Some(group) = groups.last_mut() {
+            group.push(symbol);
+        }
+    }
+    Ok(groups)
+}
+
 fn row_to_symbol_record(row: &rusqlite::Row<'_>) -> rusqlite::Result<SymbolRecord> {
     Ok(SymbolRecord {
         repo: row.get(0)?,
@@ -261,7 +596,7 @@ fn row_to_symbol_record(row: &rusqlite::Row<'_>) -> rusqlite::Result<SymbolRecor
 }
 
 /// A lightweight symbol record for file outlines (avoids full SymbolRecord overhead).
-#[derive(Debug, Clone, serde::Serialize, serde::Deserialize)]
+#[derive(Debug, Clone, serde::Serialize, serde::Deserialize, schemars::JsonSchema)]
 pub struct OutlineSymbol {
     pub symbol_id: String,
     pub name: String,
@@ -392,6 +727,93 @@ mod tests {
         }
     }
 
+    #[test]
+    fn complete_symbol_names_matches_prefixes() {
+        let conn = setup_test_db();
+        for (idx, (name, qualified)) in [
+            ("my_function", "crate::my_function"),
+            ("my_helper", "crate::util::my_helper"),
+            ("my_function", "crate::other::my_function"),
+            ("other", "crate::other"),
+        ]
+        .into_iter()
+        .enumerate()
+        {
+            let mut sym = sample_symbol();
+            sym.symbol_id = format!("sym_{idx}");
+            sym.symbol_stable_id = format!("stable_{idx}");
+            sym.name = name.to_string();
+            sym.qualified_name = qualified.to_string();
+            insert_symbol(&conn, &sym).unwrap();
+        }
+
+        let names = complete_symbol_names(&conn, "my-repo", "main", "my_", 10).unwrap();
+        assert_eq!(names, vec!["my_function", "my_helper"]);
+        let names = complete_symbol_names(&conn, "my-repo", "main", "my_", 1).unwrap();
+        assert_eq!(names, vec!["my_function"]);
+        let names = complete_symbol_names(&conn, "my-repo", "main", "crate::o", 10).unwrap();
+        assert_eq!(names, vec!["crate::other", "crate::other::my_function"]);
+        assert!(
+            complete_symbol_names(&conn, "my-repo", "other", "my_", 10)
+                .unwrap()
+                .is_empty()
+        );
+    }
+
+    #[test]
+    fn symbols_with_initial_match_either_case() {
+        let conn = setup_test_db();
+        for (idx, name) in ["handleGetUser", "HttpGetUser", "getUser", "h"]
+            .into_iter()
+            .enumerate()
+        {
+            let mut sym = sample_symbol();
+            sym.symbol_id = format!("sym_{idx}");
+            sym.symbol_stable_id = format!("stable_{idx}");
+            sym.name = name.to_string();
+            sym.qualified_name = format!("crate::{name}");
+            insert_symbol(&conn, &sym).unwrap();
+        }
+
+        let mut names = Vec::new();
+        for_each_symbol_with_initial(&conn, "my-repo", "main", 'h', 1, Some(10), |symbol| {
+            names.push(symbol.name);
+            Ok(())
+        })
+        .unwrap();
+        assert_eq!(names, vec!["h", "handleGetUser", "HttpGetUser"]);
+
+        let mut count = 0;
+        for_each_symbol_with_initial(&conn, "my-repo", "main", 'H', 1, Some(1), |_| {
+            count += 1;
+            Ok(())
+        })
+        .unwrap();
+        assert_eq!(count, 2, "the limit applies per case");
+    }
+
+    #[test]
+    fn symbols_with_initial_skip_names_shorter_than_min_chars() {
+        let conn = setup_test_db();
+        for (idx, name) in ["h", "hGU", "handleGetUser", "héé"].into_iter().enumerate() {
+            let mut sym = sample_symbol();
+            sym.symbol_id = format!("sym_{idx}");
+            sym.symbol_stable_id = format!("stable_{idx}");
+            sym.name = name.to_string();
+            sym.qualified_name = format!("crate::{name}");
+            insert_symbol(&conn, &sym).unwrap();
+        }
+
+        let mut names = Vec::new();
+        for_each_symbol_with_initial(&conn, "my-repo", "main", 'h', 3, None, |symbol| {
+            names.push(symbol.name);
+            Ok(())
+        })
+        .unwrap();
+        // Lengths count characters, not bytes.
+        assert_eq!(names, vec!["hGU", "handleGetUser", "héé"]);
+    }
+
     #[test]
     fn test_insert_and_find_symbol() {
         let conn = setup_test_db();
@@ -653,4 +1075,76 @@ mod tests {
         assert_eq!(found.len(), 1);
         assert_eq!(found[0].name, "func_a");
     }
+
+    #[test]
+    fn test_list_content_duplicates_groups_copies_across_paths() {
+        let conn = setup_test_db();
+        let body = "fn my_function(x: i32) -> bool { x > 0 }";
+        for (path, name, content) in [
+            ("src/lib.rs", "my_function", body),
+            ("vendor/dep/src/lib.rs", "my_function", body),
+            ("src/other.rs", "renamed", body),
+            ("src/tiny.rs", "new", "fn new() {}"),
+            ("vendor/dep/src/tiny.rs", "new", "fn new() {}"),
+        ] {
+            let mut sym = sample_symbol();
+            sym.path = path.to_string();
+            sym.name = name.to_string();
+            sym.symbol_id = format!("sym::{path}::{name}");
+            sym.symbol_stable_id = format!("stable::{path}::{name}");
+            sym.content = Some(content.to_string());
+            insert_symbol(&conn, &sym).unwrap();
+        }
+
+        let groups = list_content_duplicates(&conn, "my-repo", "main", 16).unwrap();
+        assert_eq!(groups.len(), 1);
+        let paths: Vec<&str> = groups[0].iter().map(|s| s.path.as_str()).collect();
+        assert_eq!(paths, ["src/lib.rs", "vendor/dep/src/lib.rs"]);
+
+        let groups = list_content_duplicates(&conn, "my-repo", "main", 0).unwrap();
+        assert_eq!(groups.len(), 2);
+    }
+
+    #[test]
+    fn test_for_each_function_body_filters_language_and_kind() {
+        let conn = setup_test_db();
+        for (name, kind, language) in [
+            ("handler", SymbolKind::Function, "go"),
+            ("Serve", SymbolKind::Method, "go"),
+            ("Server", SymbolKind::Struct, "go"),
+            ("helper", SymbolKind::Function, "rust"),
+        ] {
+            let mut sym = sample_symbol();
+            sym.name = name.to_string();
+            sym.kind = kind;
+            sym.language = language.to_string();
+            sym.symbol_id = format!("sym::{name}");
+            sym.symbol_stable_id = format!("stable::{name}");
+            sym.content = Some(format!("func {name}() {{}}"));
+            insert_symbol(&conn, &sym).unwrap();
+        }
+
+        let mut seen = Vec::new();
+        for_each_function_body(&conn, "my-repo", "main", "go", |symbol| {
+            seen.push((symbol.name, symbol.content));
+            Ok(())
+        })
+        .unwrap();
+        seen.sort();
+        assert_eq!(
+            seen,
+            [
+                ("Serve".to_string(), Some("func Serve() {}".to_string())),
+                ("handler".to_string(), Some("func handler() {}".to_string())),
+            ]
+        );
+
+        let mut structs = Vec::new();
+        for_each_struct_body(&conn, "my-repo", "main", "go", |symbol| {
+            structs.push(symbol.name);
+            Ok(())
+        })
+        .unwrap();
+        assert_eq!(structs, ["Server"]);
+    }
 }
@@ -1,12 +1,12 @@
 use cruxe_core::error::StateError;
 use std::io::ErrorKind;
 use std::path::Path;
-use tantivy::Index;
-use tantivy::Term;
 use tantivy::collector::TopDocs;
+use tantivy::directory::error::OpenReadError;
 use tantivy::query::TermQuery;
 use tantivy::schema::*;
-use tracing::info;
+use tantivy::{Index, TantivyError, Term};
+use tracing::{info, warn};
 
 use crate::tokenizers;
 
@@ -16,6 +16,9 @@ pub const SNIPPETS_INDEX: &str = "snippets";
 pub const FILES_INDEX: &str = "files";
 /// Tantivy index schema version for lexical index compatibility checks.
 pub const TANTIVY_SCHEMA_VERSION: u32 = 2;
+/// Tantivy writes this file when it creates an index and atomically replaces
+/// it on every commit, so segments it does not list were never committed.
+const META_FILE: &str = "meta.json";
 
 const REQUIRED_SYMBOL_FIELDS: &[&str] = &[
     "file_key",
@@ -104,10 +107,16 @@ fn open_or_create_index(
 ) -> Result<Index, StateError> {
     let index = if dir_is_empty(dir)? {
         Index::create_in_dir(dir, schema).map_err(StateError::tantivy)?
+    } else if !dir.join(META_FILE).exists() {
+        // Creation was interrupted before the index ever committed; nothing
+        // in the directory is reachable, so start over.
+        warn!(?dir, "Discarding partially created index");
+        std::fs::remove_dir_all(dir).map_err(StateError::Io)?;
+        std::fs::create_dir_all(dir).map_err(StateError::Io)?;
+        Index::create_in_dir(dir, schema).map_err(StateError::tantivy)?
     } else {
-        Index::open_in_dir(dir).map_err(|e| {
-            StateError::CorruptManifest(format!("failed to open index at {}: {}", dir.display(), e))
-        })?
+        Index::open_in_dir(dir)
+            .map_err(|e| open_error(e, format!("failed to open index at {}", dir.display())))?
     };
 
     validate_required_fields(&index, required_fields, index_name)?;
@@ -127,18 +136,33 @@ fn open_existing_index(
     }
 
     let index = Index::open_in_dir(dir).map_err(|e| {
-        StateError::CorruptManifest(format!(
-            "failed to open {} index at {}: {}",
-            index_name,
-            dir.display(),
-            e
-        ))
+        open_error(
+            e,
+            format!("failed to open {} index at {}", index_name, dir.display()),
+        )
     })?;
     validate_required_fields(&index, required_fields, index_name)?;
     tokenizers::register_tokenizers(index.tokenizers());
     Ok(index)
 }
 
+/// Classify a failure to open an index. Only an index whose metadata or
+/// schema cannot be parsed, or fails its checksum, is
+/// [`StateError::CorruptManifest`], which callers answer by discarding it;
+/// IO, permission and lock failures are passed on as they may clear by
+/// themselves.
+fn open_error(error: TantivyError, context: String) -> StateError {
+    match error {
+        TantivyError::DataCorruption(_)
+        | TantivyError::IncompatibleIndex(_)
+        | TantivyError::SchemaError(_)
+        | TantivyError::OpenReadError(OpenReadError::IncompatibleIndex(_)) => {
+            StateError::CorruptManifest(format!("{context}: {error}"))
+        }
+        error => StateError::tantivy(format!("{context}: {error}")),
+    }
+}
+
 fn validate_required_fields(
     index: &Index,
     required_fields: &[&str],
@@ -396,7 +420,7 @@ pub struct IndexSet {
 impl IndexSet {
     /// Open all three indices from a project data directory.
     ///
-    /// This resolves to `<data_dir>/base`.
+    /// This resolves to `<base_dir>/base`.
     pub fn open(base_dir: &Path) -> Result<Self, StateError> {
         let base = base_dir.join("base");
         Self::open_at(&base)
@@ -446,6 +470,20 @@ impl IndexSet {
     }
 }
 
+/// Remove the indices under `<data_dir>/base` so the next
+/// [`IndexSet::open`] starts empty. Returns whether anything was removed.
+///
+/// Used when the indices cannot be opened, e.g. after a crash mid-merge; the
+/// caller must also invalidate the manifest so every file is re-indexed.
+pub fn discard_index_set(data_dir: &Path) -> Result<bool, StateError> {
+    let base = data_dir.join("base");
+    if !base.exists() {
+        return Ok(false);
+    }
+    std::fs::remove_dir_all(&base).map_err(StateError::Io)?;
+    Ok(true)
+}
+
 /// Result of a Tantivy health check for a single index.
 #[derive(Debug, serde::Serialize)]
 pub struct TantivyIndexHealth {
@@ -560,6 +598,64 @@ mod tests {
         assert!(set.symbols.schema().get_field("symbol_exact").is_ok());
     }
 
+    #[test]
+    fn partially_created_index_is_recreated() {
+        let dir = tempdir().unwrap();
+        let symbols = dir.path().join(SYMBOLS_INDEX);
+        std::fs::create_dir_all(&symbols).unwrap();
+        std::fs::write(symbols.join("0f1e.idx"), b"half-written segment").unwrap();
+
+        let index = open_symbols_index(dir.path()).unwrap();
+        assert!(index.schema().get_field("symbol_exact").is_ok());
+        assert!(symbols.join(META_FILE).exists());
+        assert!(!symbols.join("0f1e.idx").exists());
+    }
+
+    #[test]
+    fn discarded_index_set_reopens_empty() {
+        let dir = tempdir().unwrap();
+        IndexSet::open(dir.path()).unwrap();
+        let meta = dir.path().join("base").join(FILES_INDEX).join(META_FILE);
+        std::fs::write(&meta, b"{ not json").unwrap();
+        assert!(matches!(
+            IndexSet::open(dir.path()),
+            Err(StateError::CorruptManifest(_))
+        ));
+
+        assert!(discard_index_set(dir.path()).unwrap());
+        assert!(IndexSet::open(dir.path()).is_ok());
+        assert!(!discard_index_set(dir.path().join("missing").as_path()).unwrap());
+    }
+
+    #[test]
+    fn io_errors_are_not_reported_as_corruption() {
+        let dir = tempdir().unwrap();
+        IndexSet::open(dir.path()).unwrap();
+        let meta = dir.path().join("base").join(FILES_INDEX).join(META_FILE);
+        let saved = std::fs::read(&meta).unwrap();
+
+        // Reading a directory fails with EISDIR, whoever runs the test.
+        std::fs::remove_file(&meta).unwrap();
+        std::fs::create_dir(&meta).unwrap();
+        let err = IndexSet::open(dir.path()).err().unwrap();
+        assert!(matches!(err, StateError::Tantivy(_)), "{err}");
+        std::fs::remove_dir(&meta).unwrap();
+        std::fs::write(&meta, &saved).unwrap();
+
+        #[cfg(unix)]
+        {
+            use std::os::unix::fs::PermissionsExt;
+            std::fs::set_permissions(&meta, std::fs::Permissions::from_mode(0o000)).unwrap();
+            // Root reads the file regardless of its mode.
+            if std::fs::read(&meta).is_err() {
+                let err = IndexSet::open(dir.path()).err().unwrap();
+                assert!(matches!(err, StateError::Tantivy(_)), "{err}");
+            }
+            std::fs::set_permissions(&meta, std::fs::Permissions::from_mode(0o644)).unwrap();
+        }
+        assert!(IndexSet::open(dir.path()).is_ok());
+    }
+
     #[test]
     fn test_index_set_open_at_explicit_root() {
         let dir = tempdir().unwrap();
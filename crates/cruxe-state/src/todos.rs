@@ -0,0 +1,123 @@
+use cruxe_core::error::StateError;
+use cruxe_core::types::TodoRecord;
+use rusqlite::{Connection, params};
+
+/// Replace the TODO markers recorded for a file.
+pub fn replace_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+    records: &[TodoRecord],
+) -> Result<(), StateError> {
+    delete_for_file(conn, repo, ref_name, path)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT INTO todo_markers
+                (repo, \"ref\", path, line, marker, text, assignee, symbol_id, symbol)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)",
+        )
+        .map_err(StateError::sqlite)?;
+    for record in records {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            path,
+            record.line,
+            record.marker,
+            record.text,
+            record.assignee,
+            record.symbol_id,
+            record.symbol,
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Remove the TODO markers of a file (file deleted or re-indexed).
+pub fn delete_for_file(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    path: &str,
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM todo_markers WHERE repo = ?1 AND \"ref\" = ?2 AND path = ?3",
+        params![repo, ref_name, path],
+    )
+    .map_err(StateError::sqlite)?;
+    Ok(())
+}
+
+/// TODO markers of a repo/ref ordered by path and line.
+pub fn list_todos(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<TodoRecord>, StateError> {
+    let mut stmt = conn
+        .prepare(
+            "SELECT path, line, marker, text, assignee, symbol_id, symbol
+             FROM todo_markers
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY path, line",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(TodoRecord {
+                repo: repo.to_string(),
+                r#ref: ref_name.to_string(),
+                path: row.get(0)?,
+                line: row.get(1)?,
+                marker: row.get(2)?,
+                text: row.get(3)?,
+                assignee: row.get(4)?,
+                symbol_id: row.get(5)?,
+                symbol: row.get(6)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn record(path: &str, line: u32, marker: &str) -> TodoRecord {
+        TodoRecord {
+            repo: "repo".to_string(),
+            r#ref: "main".to_string(),
+            path: path.to_string(),
+            line,
+            marker: marker.to_string(),
+            text: "handle retries".to_string(),
+            assignee: Some("ada".to_string()),
+            symbol_id: Some("stable::Fetch".to_string()),
+            symbol: Some("client.Fetch".to_string()),
+        }
+    }
+
+    #[test]
+    fn records_are_replaced_per_file() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+
+        let a = [record("a.go", 3, "todo"), record("a.go", 9, "fixme")];
+        replace_for_file(&conn, "repo", "main", "a.go", &a).unwrap();
+        replace_for_file(&conn, "repo", "main", "b.go", &[record("b.go", 1, "hack")]).unwrap();
+        let listed = list_todos(&conn, "repo", "main").unwrap();
+        assert_eq!(listed.len(), 3);
+        assert_eq!(listed[0], a[0]);
+
+        replace_for_file(&conn, "repo", "main", "a.go", &[]).unwrap();
+        delete_for_file(&conn, "repo", "main", "b.go").unwrap();
+        assert!(list_todos(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -1,5 +1,5 @@
 use cruxe_core::error::StateError;
-use rusqlite::{Connection, params};
+use rusqlite::{Connection, DatabaseName, params};
 use rusqlite::{params_from_iter, types::Value};
 use serde::{Deserialize, Serialize};
 use std::cmp::Ordering;
@@ -369,6 +369,17 @@ pub struct VectorMatch {
     pub score: f64,
 }
 
+/// Apply [`SEMANTIC_VECTOR_DDL`] unless the connection is read-only: those
+/// are only opened on DBs already at the current schema (see
+/// [`crate::db::open_for_query`]), which includes these tables.
+fn apply_semantic_ddl(conn: &Connection) -> Result<(), StateError> {
+    if conn.is_readonly(DatabaseName::Main).unwrap_or(false) {
+        return Ok(());
+    }
+    conn.execute_batch(SEMANTIC_VECTOR_DDL)
+        .map_err(StateError::sqlite)
+}
+
 pub fn ensure_schema(conn: &Connection) -> Result<(), StateError> {
     let namespace = cache_namespace(conn);
     if let Ok(cache) = schema_cache().lock()
@@ -377,8 +388,7 @@ pub fn ensure_schema(conn: &Connection) -> Result<(), StateError> {
         return Ok(());
     }
 
-    conn.execute_batch(SEMANTIC_VECTOR_DDL)
-        .map_err(StateError::sqlite)?;
+    apply_semantic_ddl(conn)?;
 
     if let Ok(mut cache) = schema_cache().lock() {
         if cache.len() >= VECTOR_SCHEMA_CACHE_LIMIT
@@ -318,8 +318,7 @@ pub(super) fn ensure_schema(conn: &Connection) -> Result<(), StateError> {
     // Reuse the canonical DDL (includes meta + SQLite vector tables).
     // The SQLite `semantic_vectors` table is harmless to create even when
     // LanceDB is the active backend — it simply stays empty.
-    conn.execute_batch(super::SEMANTIC_VECTOR_DDL)
-        .map_err(StateError::sqlite)?;
+    super::apply_semantic_ddl(conn)?;
 
     // Ensure LanceDB directory exists.
     let dir = lancedb_dir(conn);
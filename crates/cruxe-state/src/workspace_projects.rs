@@ -0,0 +1,135 @@
+use cruxe_core::error::StateError;
+use rusqlite::{Connection, params};
+use schemars::JsonSchema;
+use serde::Serialize;
+
+/// A project root of a monorepo: a directory with its own `go.mod`,
+/// `Cargo.toml` package or `package.json`.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, JsonSchema)]
+pub struct WorkspaceProject {
+    /// Name from the manifest, e.g. the last segment of a Go module path.
+    pub name: String,
+    /// `go`, `rust` or `node`.
+    pub kind: String,
+    /// Repository-relative directory of the manifest; empty for the root.
+    pub dir: String,
+}
+
+/// Replace the projects recorded for a ref (every index run rediscovers them).
+pub fn replace_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+    projects: &[WorkspaceProject],
+) -> Result<(), StateError> {
+    conn.execute(
+        "DELETE FROM workspace_projects WHERE repo = ?1 AND \"ref\" = ?2",
+        params![repo, ref_name],
+    )
+    .map_err(StateError::sqlite)?;
+    let mut stmt = conn
+        .prepare_cached(
+            "INSERT OR IGNORE INTO workspace_projects (repo, \"ref\", dir, name, kind)
+             VALUES (?1, ?2, ?3, ?4, ?5)",
+        )
+        .map_err(StateError::sqlite)?;
+    for project in projects {
+        stmt.execute(params![
+            repo,
+            ref_name,
+            project.dir,
+            project.name,
+            project.kind
+        ])
+        .map_err(StateError::sqlite)?;
+    }
+    Ok(())
+}
+
+/// Projects of a repo/ref ordered by directory.
+pub fn list_for_ref(
+    conn: &Connection,
+    repo: &str,
+    ref_name: &str,
+) -> Result<Vec<WorkspaceProject>, StateError> {
+    let mut stmt = conn
+        .prepare_cached(
+            "SELECT name, kind, dir FROM workspace_projects
+             WHERE repo = ?1 AND \"ref\" = ?2
+             ORDER BY dir",
+        )
+        .map_err(StateError::sqlite)?;
+    let rows = stmt
+        .query_map(params![repo, ref_name], |row| {
+            Ok(WorkspaceProject {
+                name: row.get(0)?,
+                kind: row.get(1)?,
+                dir: row.get(2)?,
+            })
+        })
+        .map_err(StateError::sqlite)?;
+    rows.collect::<Result<Vec<_>, _>>()
+        .map_err(StateError::sqlite)
+}
+
+/// Whether `path` lies under the project directory `dir`.
+pub fn dir_contains(dir: &str, path: &str) -> bool {
+    dir.is_empty()
+        || path
+            .strip_prefix(dir)
+            .is_some_and(|rest| rest.starts_with('/'))
+}
+
+/// The project owning `path`: the one with the deepest directory holding it.
+pub fn owner<'a>(projects: &'a [WorkspaceProject], path: &str) -> Option<&'a WorkspaceProject> {
+    projects
+        .iter()
+        .filter(|project| dir_contains(&project.dir, path))
+        .max_by_key(|project| project.dir.len())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{db, schema};
+    use tempfile::tempdir;
+
+    fn project(name: &str, kind: &str, dir: &str) -> WorkspaceProject {
+        WorkspaceProject {
+            name: name.to_string(),
+            kind: kind.to_string(),
+            dir: dir.to_string(),
+        }
+    }
+
+    #[test]
+    fn files_belong_to_the_deepest_project() {
+        let dir = tempdir().unwrap();
+        let conn = db::open_connection(&dir.path().join("test.db")).unwrap();
+        schema::create_tables(&conn).unwrap();
+        replace_for_ref(
+            &conn,
+            "repo",
+            "main",
+            &[
+                project("web", "node", "web"),
+                project("acme", "go", ""),
+                project("billing", "go", "services/billing"),
+            ],
+        )
+        .unwrap();
+        let projects = list_for_ref(&conn, "repo", "main").unwrap();
+        let dirs: Vec<&str> = projects.iter().map(|p| p.dir.as_str()).collect();
+        assert_eq!(dirs, ["", "services/billing", "web"]);
+
+        let name = |path: &str| owner(&projects, path).map(|p| p.name.as_str());
+        assert_eq!(name("services/billing/invoice.go"), Some("billing"));
+        assert_eq!(name("services/billingx/main.go"), Some("acme"));
+        assert_eq!(name("web/src/app.ts"), Some("web"));
+        assert_eq!(name("main.go"), Some("acme"));
+        assert_eq!(owner(&projects[1..], "main.go"), None);
+
+        replace_for_ref(&conn, "repo", "main", &[]).unwrap();
+        assert!(list_for_ref(&conn, "repo", "main").unwrap().is_empty());
+    }
+}
@@ -0,0 +1,148 @@
+use crate::commit_tree::with_repo;
+use crate::history::boundary_of;
+use cruxe_core::error::VcsError;
+use git2::{BlameOptions, Oid};
+use std::path::Path;
+
+/// Consecutive lines last changed by the same commit.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct BlameHunk {
+    /// First line, 1-based.
+    pub start_line: u32,
+    pub lines: u32,
+    /// Full commit id.
+    pub commit: String,
+    pub author: String,
+    pub author_email: String,
+    /// Author time, seconds since the Unix epoch.
+    pub time: i64,
+}
+
+/// Blame of `path` (repository-relative) as of `newest_commit` (default
+/// `HEAD`), applied to `content` so the line numbers match what was indexed
+/// even with uncommitted edits. Lines not committed yet are left out, and so
+/// are lines a shallow clone attributes to its boundary commit, which only
+/// appears to have added them.
+pub fn blame_file(
+    repo_root: &Path,
+    path: &str,
+    newest_commit: Option<&str>,
+    content: &str,
+) -> Result<Vec<BlameHunk>, VcsError> {
+    with_repo(repo_root, |repo| {
+        let mut options = BlameOptions::new();
+        if let Some(rev) = newest_commit {
+            let commit = repo
+                .revparse_single(rev)
+                .and_then(|object| object.peel_to_commit())
+                .map_err(|e| VcsError::GitError(format!("failed to resolve `{rev}`: {e}")))?;
+            options.newest_commit(commit.id());
+        }
+        let committed = repo
+            .blame_file(Path::new(path), Some(&mut options))
+            .map_err(|e| VcsError::GitError(format!("failed to blame {path}: {e}")))?;
+        let blame = committed
+            .blame_buffer(content.as_bytes())
+            .map_err(|e| VcsError::GitError(format!("failed to blame {path}: {e}")))?;
+        let boundary = boundary_of(repo);
+        Ok(blame
+            .iter()
+            .filter(|hunk| {
+                hunk.final_commit_id() != Oid::zero()
+                    && !boundary.contains(&hunk.final_commit_id().to_string())
+            })
+            .map(|hunk| {
+                let signature = hunk.final_signature();
+                BlameHunk {
+                    start_line: hunk.final_start_line() as u32,
+                    lines: hunk.lines_in_hunk() as u32,
+                    commit: hunk.final_commit_id().to_string(),
+                    author: String::from_utf8_lossy(signature.name_bytes()).into_owned(),
+                    author_email: String::from_utf8_lossy(signature.email_bytes()).into_owned(),
+                    time: signature.when().seconds(),
+                }
+            })
+            .collect())
+    })
+}
+
+/// The most recent hunk touching lines `start..=end`.
+pub fn last_change(hunks: &[BlameHunk], start: u32, end: u32) -> Option<&BlameHunk> {
+    hunks
+        .iter()
+        .filter(|hunk| hunk.start_line <= end && start < hunk.start_line + hunk.lines)
+        .max_by_key(|hunk| hunk.time)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use git2::Repository;
+
+    fn commit_file(repo: &Repository, path: &str, content: &str, author: &str, time: i64) {
+        std::fs::write(repo.workdir().unwrap().join(path), content).unwrap();
+        let mut index = repo.index().unwrap();
+        index.add_path(Path::new(path)).unwrap();
+        index.write().unwrap();
+        let tree = repo.find_tree(index.write_tree().unwrap()).unwrap();
+        let signature = git2::Signature::new(
+            author,
+            &format!("{author}@example.com"),
+            &git2::Time::new(time, 0),
+        )
+        .unwrap();
+        let parent = repo.head().ok().and_then(|head| head.peel_to_commit().ok());
+        let parents: Vec<&git2::Commit> = parent.iter().collect();
+        repo.commit(
+            Some("HEAD"),
+            &signature,
+            &signature,
+            "change",
+            &tree,
+            &parents,
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn blame_attributes_lines_to_their_last_commit() {
+        let dir = tempfile::tempdir().unwrap();
+        let repo = Repository::init(dir.path()).unwrap();
+        commit_file(&repo, "lib.go", "func A() {}\nfunc B() {}\n", "ana", 1_000);
+        commit_file(
+            &repo,
+            "lib.go",
+            "func A() {}\nfunc B() { b() }\n",
+            "bo",
+            2_000,
+        );
+        let first = repo
+            .head()
+            .unwrap()
+            .peel_to_commit()
+            .unwrap()
+            .parent_id(0)
+            .unwrap();
+
+        // An uncommitted third line is not attributed to anyone.
+        let content = "func A() {}\nfunc B() { b() }\nfunc C() {}\n";
+        let hunks = blame_file(dir.path(), "lib.go", None, content).unwrap();
+        assert_eq!(hunks.len(), 2);
+        assert_eq!(last_change(&hunks, 1, 1).unwrap().author, "ana");
+        let b = last_change(&hunks, 1, 2).unwrap();
+        assert_eq!((b.author.as_str(), b.time), ("bo", 2_000));
+        assert_eq!(b.author_email, "bo@example.com");
+        assert!(last_change(&hunks, 3, 3).is_none());
+
+        let past = blame_file(
+            dir.path(),
+            "lib.go",
+            Some(&first.to_string()),
+            "func A() {}\nfunc B() {}\n",
+        )
+        .unwrap();
+        assert_eq!(past.len(), 1);
+        assert_eq!(past[0].commit, first.to_string());
+        assert_eq!(past[0].lines, 2);
+    }
+}
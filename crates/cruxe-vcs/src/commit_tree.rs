@@ -0,0 +1,217 @@
+use crate::history::{fetch_missing_objects, history_info};
+use cruxe_core::error::VcsError;
+use git2::{ObjectType, Oid, Repository, TreeWalkMode, TreeWalkResult};
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+thread_local! {
+    // `Repository` is not `Sync`, so each indexing worker opens its own.
+    static OPEN_REPO: RefCell<Option<(PathBuf, Repository)>> = const { RefCell::new(None) };
+}
+
+/// One blob of a commit's tree.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TreeFile {
+    /// Repository-relative, `/`-separated.
+    pub path: String,
+    pub size: u64,
+}
+
+/// The files of a commit as stored in the object database, so a revision can
+/// be indexed without checking it out. Submodule entries and symlinks are
+/// left out.
+#[derive(Debug, Clone)]
+pub struct CommitTree {
+    repo_root: PathBuf,
+    /// Full commit id.
+    pub commit: String,
+    pub files: Vec<TreeFile>,
+    blobs: HashMap<String, Oid>,
+}
+
+/// The tree of the commit `rev` (a branch, tag or commit id) names; `None`
+/// when `repo_root` is not a git repository or `rev` names no commit. Blobs
+/// a partial clone does not have yet are fetched first.
+pub fn commit_tree(repo_root: &Path, rev: &str) -> Result<Option<CommitTree>, VcsError> {
+    let Ok(repo) = Repository::open(repo_root) else {
+        return Ok(None);
+    };
+    let Some(commit) = repo
+        .revparse_single(rev)
+        .ok()
+        .and_then(|object| object.peel_to_commit().ok())
+    else {
+        return Ok(None);
+    };
+    let tree = commit
+        .tree()
+        .map_err(|e| VcsError::GitError(format!("failed to load the tree of `{rev}`: {e}")))?;
+
+    let mut entries = Vec::new();
+    tree.walk(TreeWalkMode::PreOrder, |dir, entry| {
+        // Regular and executable files; not symlinks (0o120000) or gitlinks.
+        if entry.kind() == Some(ObjectType::Blob)
+            && entry.filemode() & 0o170000 == 0o100000
+            && let Some(name) = entry.name()
+        {
+            entries.push((format!("{dir}{name}"), entry.id()));
+        }
+        TreeWalkResult::Ok
+    })
+    .map_err(|e| VcsError::GitError(format!("failed to walk the tree of `{rev}`: {e}")))?;
+
+    let odb = repo
+        .odb()
+        .map_err(|e| VcsError::GitError(format!("failed to open the object database: {e}")))?;
+    // A partial clone has the tree but not necessarily its blobs.
+    let missing: Vec<String> = entries
+        .iter()
+        .filter(|(_, oid)| !odb.exists(*oid))
+        .map(|(_, oid)| oid.to_string())
+        .collect();
+    let refetched;
+    let odb = if !missing.is_empty() && history_info(repo_root).partial {
+        fetch_missing_objects(repo_root, &missing)?;
+        refetched = Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+            path: repo_root.display().to_string(),
+        })?;
+        refetched
+            .odb()
+            .map_err(|e| VcsError::GitError(format!("failed to open the object database: {e}")))?
+    } else {
+        odb
+    };
+    let mut files = Vec::with_capacity(entries.len());
+    let mut blobs = HashMap::with_capacity(entries.len());
+    for (path, oid) in entries {
+        let (size, _) = odb
+            .read_header(oid)
+            .map_err(|e| VcsError::GitError(format!("failed to read {path}: {e}")))?;
+        files.push(TreeFile {
+            path: path.clone(),
+            size: size as u64,
+        });
+        blobs.insert(path, oid);
+    }
+    Ok(Some(CommitTree {
+        repo_root: repo_root.to_path_buf(),
+        commit: commit.id().to_string(),
+        files,
+        blobs,
+    }))
+}
+
+impl CommitTree {
+    /// Content of the file at `path` in this commit; an error when it is not
+    /// in the tree or not UTF-8.
+    pub fn read_to_string(&self, path: &str) -> Result<String, VcsError> {
+        let bytes = self.read(path)?;
+        String::from_utf8(bytes).map_err(|_| VcsError::GitError(format!("{path} is not UTF-8")))
+    }
+
+    /// Raw content of the file at `path` in this commit.
+    pub fn read(&self, path: &str) -> Result<Vec<u8>, VcsError> {
+        let oid = *self.blobs.get(path).ok_or_else(|| {
+            VcsError::GitError(format!("{path} is not in commit {}", self.commit))
+        })?;
+        with_repo(&self.repo_root, |repo| {
+            let blob = repo
+                .find_blob(oid)
+                .map_err(|e| VcsError::GitError(format!("failed to read {path}: {e}")))?;
+            Ok(blob.content().to_vec())
+        })
+    }
+}
+
+/// Run `f` on this thread's handle to the repository at `repo_root`, opening
+/// it on first use.
+pub(crate) fn with_repo<T>(
+    repo_root: &Path,
+    f: impl FnOnce(&Repository) -> Result<T, VcsError>,
+) -> Result<T, VcsError> {
+    OPEN_REPO.with(|cell| {
+        let mut slot = cell.borrow_mut();
+        if slot.as_ref().is_none_or(|(root, _)| root != repo_root) {
+            let repo = Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+                path: repo_root.display().to_string(),
+            })?;
+            *slot = Some((repo_root.to_path_buf(), repo));
+        }
+        let (_, repo) = slot.as_ref().expect("repository opened above");
+        f(repo)
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn commit_all(repo: &Repository, message: &str) {
+        let mut index = repo.index().unwrap();
+        index
+            .add_all(["*"], git2::IndexAddOption::DEFAULT, None)
+            .unwrap();
+        index.write().unwrap();
+        let tree = repo.find_tree(index.write_tree().unwrap()).unwrap();
+        let signature = git2::Signature::now("test", "test@example.com").unwrap();
+        let parents: Vec<git2::Commit> = repo
+            .head()
+            .ok()
+            .and_then(|head| head.peel_to_commit().ok())
+            .into_iter()
+            .collect();
+        let parents: Vec<&git2::Commit> = parents.iter().collect();
+        repo.commit(
+            Some("HEAD"),
+            &signature,
+            &signature,
+            message,
+            &tree,
+            &parents,
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn commit_tree_reads_a_past_revision_without_the_worktree() {
+        let dir = tempfile::tempdir().unwrap();
+        let repo = Repository::init(dir.path()).unwrap();
+        std::fs::create_dir_all(dir.path().join("src")).unwrap();
+        std::fs::write(dir.path().join("src/lib.rs"), "fn first() {}\n").unwrap();
+        commit_all(&repo, "first");
+        let first = repo.head().unwrap().peel_to_commit().unwrap().id();
+        std::fs::write(dir.path().join("src/lib.rs"), "fn second() {}\n").unwrap();
+        std::fs::write(dir.path().join("main.go"), "package main\n").unwrap();
+        commit_all(&repo, "second");
+        std::fs::write(dir.path().join("src/lib.rs"), "fn uncommitted() {}\n").unwrap();
+
+        let past = commit_tree(dir.path(), &first.to_string())
+            .unwrap()
+            .unwrap();
+        assert_eq!(past.commit, first.to_string());
+        assert_eq!(
+            past.files,
+            vec![TreeFile {
+                path: "src/lib.rs".to_string(),
+                size: 14,
+            }]
+        );
+        assert_eq!(
+            past.read_to_string("src/lib.rs").unwrap(),
+            "fn first() {}\n"
+        );
+        assert!(past.read_to_string("main.go").is_err());
+
+        let head = commit_tree(dir.path(), "HEAD").unwrap().unwrap();
+        assert_eq!(head.files.len(), 2);
+        assert_eq!(
+            head.read_to_string("src/lib.rs").unwrap(),
+            "fn second() {}\n"
+        );
+
+        assert!(commit_tree(dir.path(), "no-such-branch").unwrap().is_none());
+        let plain = tempfile::tempdir().unwrap();
+        assert!(commit_tree(plain.path(), "main").unwrap().is_none());
+    }
+}
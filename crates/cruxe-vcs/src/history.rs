@@ -0,0 +1,254 @@
+//! Clones without their full history: shallow ones (`git clone --depth`,
+//! the default of most CI checkouts) end at grafted boundary commits, and
+//! partial ones (`--filter=blob:none`) fetch file contents on demand, which
+//! the git CLI does but libgit2 cannot.
+//!
+//! Nothing here is needed to index a checkout; the features that read
+//! history (overlay merge bases, diff ranges, churn, blame) use it to fetch
+//! more history when `[history] deepen` allows, or to say what is missing.
+
+use crate::remote::git;
+use cruxe_core::error::VcsError;
+use git2::Repository;
+use std::collections::HashSet;
+use std::io::Write;
+use std::path::Path;
+use std::process::{Command, Stdio};
+
+/// Upper bound on `git fetch --deepen` rounds for one operation.
+pub const MAX_DEEPEN_ROUNDS: u32 = 10;
+
+/// What a clone is missing.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct HistoryInfo {
+    /// History ends at grafted commits (`.git/shallow`).
+    pub shallow: bool,
+    /// Objects are fetched lazily from a promisor remote.
+    pub partial: bool,
+}
+
+/// Shallow and partial status of the repository at `repo_root`; both unset
+/// when it is not a git repository.
+pub fn history_info(repo_root: &Path) -> HistoryInfo {
+    let Ok(repo) = Repository::open(repo_root) else {
+        return HistoryInfo::default();
+    };
+    let partial = repo.config().is_ok_and(|config| {
+        config.get_string("extensions.partialclone").is_ok()
+            || config
+                .entries(Some(r"remote\..*\.promisor"))
+                .is_ok_and(|mut entries| {
+                    let mut promisor = false;
+                    while let Some(Ok(entry)) = entries.next() {
+                        promisor |= entry.value() == Some("true");
+                    }
+                    promisor
+                })
+    });
+    HistoryInfo {
+        shallow: repo.is_shallow(),
+        partial,
+    }
+}
+
+/// Full id of the commit `rev` names; `None` when it is not in the clone
+/// (a branch a single-branch clone did not fetch, say).
+pub fn commit_of(repo_root: &Path, rev: &str) -> Option<String> {
+    let repo = Repository::open(repo_root).ok()?;
+    let commit = repo.revparse_single(rev).ok()?.peel_to_commit().ok()?;
+    Some(commit.id().to_string())
+}
+
+/// Commits a shallow clone's history is cut at: they are present, but their
+/// parents are not, so they look like root commits that add every file.
+pub fn shallow_boundary(repo_root: &Path) -> HashSet<String> {
+    let Ok(repo) = Repository::open(repo_root) else {
+        return HashSet::new();
+    };
+    boundary_of(&repo)
+}
+
+pub(crate) fn boundary_of(repo: &Repository) -> HashSet<String> {
+    let Ok(content) = std::fs::read_to_string(repo.commondir().join("shallow")) else {
+        return HashSet::new();
+    };
+    content
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty())
+        .map(str::to_string)
+        .collect()
+}
+
+/// Fetch `commits` more commits of history from the default remote.
+pub fn deepen(repo_root: &Path, commits: u32) -> Result<(), VcsError> {
+    git(
+        repo_root,
+        &[
+            "fetch",
+            "--quiet",
+            "--no-tags",
+            &format!("--deepen={commits}"),
+        ],
+    )?;
+    Ok(())
+}
+
+/// Fetch the history back to `since` (any `git log --since` value).
+pub fn deepen_since(repo_root: &Path, since: &str) -> Result<(), VcsError> {
+    git(
+        repo_root,
+        &[
+            "fetch",
+            "--quiet",
+            "--no-tags",
+            &format!("--shallow-since={since}"),
+        ],
+    )?;
+    Ok(())
+}
+
+/// Run `f`, and while it fails in a shallow clone, deepen the clone by
+/// `commits` and retry, at most [`MAX_DEEPEN_ROUNDS`] times. With `commits`
+/// 0, or when fetching fails, the first error is returned as is.
+pub fn with_deepening<T, E>(
+    repo_root: &Path,
+    commits: u32,
+    mut f: impl FnMut() -> Result<T, E>,
+) -> Result<T, E> {
+    let mut result = f();
+    let mut rounds = 0;
+    while result.is_err()
+        && commits > 0
+        && rounds < MAX_DEEPEN_ROUNDS
+        && history_info(repo_root).shallow
+    {
+        if let Err(err) = deepen(repo_root, commits) {
+            tracing::warn!(error = %err, "Failed to deepen the shallow clone");
+            break;
+        }
+        rounds += 1;
+        result = f();
+    }
+    result
+}
+
+/// Have git fetch the objects `oids` of a partial clone from its promisor
+/// remote, which libgit2 cannot do: `git cat-file` fetches every missing
+/// object it is asked about.
+pub(crate) fn fetch_missing_objects(repo_root: &Path, oids: &[String]) -> Result<(), VcsError> {
+    let mut child = Command::new("git")
+        .arg("-C")
+        .arg(repo_root)
+        .args(["cat-file", "--batch-check"])
+        .env("GIT_TERMINAL_PROMPT", "0")
+        .stdin(Stdio::piped())
+        .stdout(Stdio::null())
+        .stderr(Stdio::piped())
+        .spawn()
+        .map_err(|e| VcsError::GitError(format!("failed to run git: {e}")))?;
+    if let Some(mut stdin) = child.stdin.take() {
+        let request = oids
+            .iter()
+            .map(|oid| format!("{oid}\n"))
+            .collect::<String>();
+        stdin
+            .write_all(request.as_bytes())
+            .map_err(|e| VcsError::GitError(format!("failed to run git: {e}")))?;
+    }
+    let output = child
+        .wait_with_output()
+        .map_err(|e| VcsError::GitError(format!("failed to run git: {e}")))?;
+    if !output.status.success() {
+        return Err(VcsError::GitError(format!(
+            "failed to fetch {} missing object(s): {}",
+            oids.len(),
+            String::from_utf8_lossy(&output.stderr).trim()
+        )));
+    }
+    Ok(())
+}
+
+/// Why a history-dependent git operation may have failed, to append to its
+/// error; `None` when the clone has all of its history.
+pub fn missing_history_hint(repo_root: &Path) -> Option<String> {
+    let info = history_info(repo_root);
+    info.shallow.then(|| {
+        "the repository is a shallow clone and may not contain these commits; \
+         run `git fetch --unshallow` or set `[history] deepen` to fetch more history on demand"
+            .to_string()
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn commit(repo: &Repository, content: &str) -> git2::Oid {
+        std::fs::write(repo.workdir().unwrap().join("lib.go"), content).unwrap();
+        let mut index = repo.index().unwrap();
+        index.add_path(Path::new("lib.go")).unwrap();
+        index.write().unwrap();
+        let tree = repo.find_tree(index.write_tree().unwrap()).unwrap();
+        let signature = git2::Signature::now("test", "test@example.com").unwrap();
+        let parent = repo.head().ok().and_then(|head| head.peel_to_commit().ok());
+        let parents: Vec<&git2::Commit> = parent.iter().collect();
+        repo.commit(Some("HEAD"), &signature, &signature, "c", &tree, &parents)
+            .unwrap()
+    }
+
+    fn clone(source: &Path, dest: &Path, args: &[&str]) {
+        let url = format!("file://{}", source.display());
+        let status = std::process::Command::new("git")
+            .arg("clone")
+            .arg("--quiet")
+            .args(args)
+            .arg(&url)
+            .arg(dest)
+            .status()
+            .unwrap();
+        assert!(status.success());
+    }
+
+    #[test]
+    fn shallow_clones_are_detected_and_deepened_on_demand() {
+        let upstream_dir = tempfile::tempdir().unwrap();
+        let upstream = Repository::init(upstream_dir.path()).unwrap();
+        let first = commit(&upstream, "package lib\n");
+        commit(&upstream, "package lib\n\nfunc A() {}\n");
+        let tip = commit(&upstream, "package lib\n\nfunc A() { a() }\n");
+
+        let full = history_info(upstream_dir.path());
+        assert_eq!(full, HistoryInfo::default());
+        assert!(missing_history_hint(upstream_dir.path()).is_none());
+
+        let clone_dir = tempfile::tempdir().unwrap();
+        let dest = clone_dir.path().join("shallow");
+        clone(upstream_dir.path(), &dest, &["--depth", "1"]);
+        assert!(history_info(&dest).shallow);
+        assert_eq!(shallow_boundary(&dest), HashSet::from([tip.to_string()]));
+        assert!(missing_history_hint(&dest).unwrap().contains("shallow"));
+        assert_eq!(commit_of(&dest, "HEAD"), Some(tip.to_string()));
+        assert_eq!(commit_of(&dest, &first.to_string()), None);
+
+        let has_first = || {
+            Repository::open(&dest)
+                .unwrap()
+                .find_commit(first)
+                .map(|_| ())
+        };
+        assert!(with_deepening(&dest, 0, has_first).is_err());
+        with_deepening(&dest, 1, has_first).unwrap();
+        assert!(!history_info(&dest).shallow);
+        assert!(shallow_boundary(&dest).is_empty());
+
+        upstream
+            .config()
+            .unwrap()
+            .set_bool("uploadpack.allowFilter", true)
+            .unwrap();
+        let partial = clone_dir.path().join("partial");
+        clone(upstream_dir.path(), &partial, &["--filter=blob:none"]);
+        assert!(history_info(&partial).partial);
+    }
+}
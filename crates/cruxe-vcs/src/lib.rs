@@ -1,12 +1,24 @@
 pub mod adapter;
+pub mod blame;
+pub mod commit_tree;
 pub mod diff;
 pub mod git2_adapter;
+pub mod history;
+pub mod remote;
+pub mod staged;
+pub mod submodules;
 pub mod worktree;
 
 pub use adapter::VcsAdapter;
+pub use blame::{BlameHunk, blame_file, last_change};
+pub use commit_tree::{CommitTree, TreeFile, commit_tree};
 pub use diff::{DiffEntry, FileChangeKind};
 pub use git2_adapter::Git2VcsAdapter;
-pub use worktree::{WorktreeManager, normalize_ref_name};
+pub use history::{HistoryInfo, history_info, missing_history_hint, with_deepening};
+pub use remote::{RemoteCheckout, RemoteSpec, fetch_shallow};
+pub use staged::{StagedFile, staged_changes};
+pub use submodules::initialized_submodules;
+pub use worktree::{WorktreeManager, linked_worktree_branches, normalize_ref_name};
 
 #[cfg(test)]
 mod tests {
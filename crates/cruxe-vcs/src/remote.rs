@@ -0,0 +1,311 @@
+use cruxe_core::error::VcsError;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+/// A repository named by URL, optionally at a ref:
+/// `https://github.com/org/repo@v1.2.0`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RemoteSpec {
+    /// URL as git takes it, without the `@ref` suffix.
+    pub url: String,
+    /// Branch, tag or commit; `None` for the remote's default branch.
+    pub ref_name: Option<String>,
+}
+
+/// The checkout a fetch left behind.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RemoteCheckout {
+    /// Local branch holding the fetched commit, named after the ref.
+    pub ref_name: String,
+    /// Full hash of the fetched commit.
+    pub commit: String,
+}
+
+impl RemoteSpec {
+    /// Parse `url[@ref]`; `None` for anything that is not a repository URL
+    /// (`https://`, `http://`, `ssh://`, `git://`, `file://` or scp-like
+    /// `git@host:org/repo`), such as a local path. The `@ref` suffix is only
+    /// looked for after the last `/`, so an `@` in user info or in a
+    /// directory of the path stays part of the URL.
+    pub fn parse(spec: &str) -> Option<Self> {
+        if spec.starts_with('-') {
+            return None;
+        }
+        let path_start = match spec.split_once("://") {
+            Some((scheme, rest)) => {
+                if !["https", "http", "ssh", "git", "file"].contains(&scheme) {
+                    return None;
+                }
+                spec.len() - rest.len() + rest.find('/')?
+            }
+            None => {
+                let (host, _) = spec.split_once(':')?;
+                if !host.contains('@') || host.contains('/') {
+                    return None;
+                }
+                host.len() + 1
+            }
+        };
+        let last_segment = path_start + spec[path_start..].rfind('/').map_or(0, |i| i + 1);
+        let (url, ref_name) = match spec[last_segment..].rsplit_once('@') {
+            Some((name, ref_name)) if !ref_name.is_empty() => (
+                format!("{}{name}", &spec[..last_segment]),
+                Some(ref_name.to_string()),
+            ),
+            _ => (spec.to_string(), None),
+        };
+        Some(Self { url, ref_name })
+    }
+
+    /// The URL without credentials, fit to be recorded or shown.
+    pub fn public_url(&self) -> String {
+        match self.url.split_once("://") {
+            Some((scheme, rest)) => {
+                let host_end = rest.find('/').unwrap_or(rest.len());
+                let rest = match rest[..host_end].rsplit_once('@') {
+                    Some((_, host)) => format!("{host}{}", &rest[host_end..]),
+                    None => rest.to_string(),
+                };
+                format!("{scheme}://{rest}")
+            }
+            None => self.url.clone(),
+        }
+    }
+
+    /// Relative directory for the clone of this repository in a cache:
+    /// host and path, without credentials or a `.git` suffix.
+    pub fn cache_path(&self) -> PathBuf {
+        let rest = self
+            .url
+            .split_once("://")
+            .map_or(self.url.as_str(), |(_, rest)| rest);
+        // User info ends before the host: at the first `/`, or the `:` of an
+        // scp-like URL.
+        let host_end = rest.find(['/', ':']).unwrap_or(rest.len());
+        let rest = match rest[..host_end].rfind('@') {
+            Some(at) => &rest[at + 1..],
+            None => rest,
+        };
+        let rest = rest.trim_end_matches('/').trim_end_matches(".git");
+        rest.split(['/', ':', '\\'])
+            .filter(|part| !part.is_empty() && *part != "." && *part != "..")
+            .collect()
+    }
+}
+
+/// Fetch the tip of `spec` into the repository at `dest` with depth 1,
+/// creating it on first use, and check it out on a branch named after the
+/// ref. Earlier checkouts and untracked files in `dest` are discarded.
+pub fn fetch_shallow(spec: &RemoteSpec, dest: &Path) -> Result<RemoteCheckout, VcsError> {
+    if spec.url.starts_with('-') {
+        return Err(VcsError::GitError(format!("invalid URL: {}", spec.url)));
+    }
+    if let Some(ref_name) = &spec.ref_name {
+        check_ref_name(ref_name)?;
+    }
+    if !dest.join(".git").exists() {
+        std::fs::create_dir_all(dest)
+            .map_err(|e| VcsError::GitError(format!("failed to create {}: {e}", dest.display())))?;
+        git(dest, &["init", "--quiet"])?;
+        git(
+            dest,
+            &["remote", "add", "--end-of-options", "origin", &spec.url],
+        )?;
+    } else {
+        git(
+            dest,
+            &["remote", "set-url", "--end-of-options", "origin", &spec.url],
+        )?;
+    }
+    let ref_name = match &spec.ref_name {
+        Some(ref_name) => ref_name.clone(),
+        None => {
+            // Named by the remote, so no more trusted than a user's ref.
+            let ref_name = default_branch(dest)?;
+            check_ref_name(&ref_name)?;
+            ref_name
+        }
+    };
+    git(
+        dest,
+        &[
+            "fetch",
+            "--quiet",
+            "--depth",
+            "1",
+            "--no-tags",
+            "--end-of-options",
+            "origin",
+            &ref_name,
+        ],
+    )?;
+    git(
+        dest,
+        &[
+            "checkout",
+            "--quiet",
+            "--force",
+            "-B",
+            &ref_name,
+            "FETCH_HEAD",
+        ],
+    )?;
+    git(dest, &["clean", "--quiet", "-ffdx"])?;
+    let commit = git(dest, &["rev-parse", "HEAD"])?;
+    Ok(RemoteCheckout { ref_name, commit })
+}
+
+/// Refuse a ref git would read as an option or that is not a valid ref
+/// name, before it reaches `git fetch` and `git checkout -B`.
+fn check_ref_name(ref_name: &str) -> Result<(), VcsError> {
+    let invalid = || VcsError::GitError(format!("invalid ref name: {ref_name}"));
+    if ref_name.starts_with('-') {
+        return Err(invalid());
+    }
+    let status = Command::new("git")
+        .args(["check-ref-format", "--allow-onelevel", ref_name])
+        .status()
+        .map_err(|e| VcsError::GitError(format!("failed to run git: {e}")))?;
+    if !status.success() {
+        return Err(invalid());
+    }
+    Ok(())
+}
+
+/// Branch `HEAD` of `origin` points to.
+fn default_branch(repo: &Path) -> Result<String, VcsError> {
+    let listing = git(repo, &["ls-remote", "--symref", "origin", "HEAD"])?;
+    listing
+        .lines()
+        .find_map(|line| {
+            let target = line.strip_prefix("ref: ")?.split_whitespace().next()?;
+            target.strip_prefix("refs/heads/").map(str::to_string)
+        })
+        .ok_or_else(|| VcsError::GitError("remote has no default branch".to_string()))
+}
+
+/// Run git in `repo`, returning its trimmed standard output.
+pub(crate) fn git(repo: &Path, args: &[&str]) -> Result<String, VcsError> {
+    let output = Command::new("git")
+        .arg("-C")
+        .arg(repo)
+        .args(args)
+        .env("GIT_TERMINAL_PROMPT", "0")
+        .output()
+        .map_err(|e| VcsError::GitError(format!("failed to run git: {e}")))?;
+    if !output.status.success() {
+        return Err(VcsError::GitError(format!(
+            "git {} failed: {}",
+            args.first().unwrap_or(&""),
+            String::from_utf8_lossy(&output.stderr).trim()
+        )));
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).trim().to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use git2::Repository;
+
+    #[test]
+    fn parses_urls_with_an_optional_ref() {
+        let parse = |spec: &str| RemoteSpec::parse(spec).map(|s| (s.url, s.ref_name));
+        assert_eq!(
+            parse("https://github.com/org/repo@v1.2.0"),
+            Some((
+                "https://github.com/org/repo".to_string(),
+                Some("v1.2.0".to_string())
+            ))
+        );
+        assert_eq!(
+            parse("https://user@example.com/org/repo.git"),
+            Some(("https://user@example.com/org/repo.git".to_string(), None))
+        );
+        assert_eq!(
+            parse("git@github.com:org/repo@release-2"),
+            Some((
+                "git@github.com:org/repo".to_string(),
+                Some("release-2".to_string())
+            ))
+        );
+        assert_eq!(parse("./repo"), None);
+        assert_eq!(parse("C:/src/repo"), None);
+        assert_eq!(parse("ftp://example.com/repo"), None);
+
+        let spec = RemoteSpec::parse("https://token@github.com/org/repo.git@main").unwrap();
+        assert_eq!(spec.cache_path(), PathBuf::from("github.com/org/repo"));
+        assert_eq!(spec.public_url(), "https://github.com/org/repo.git");
+    }
+
+    #[test]
+    fn at_signs_outside_the_last_segment_stay_in_the_url() {
+        let spec = RemoteSpec::parse("https://example.com/team@corp/repo").unwrap();
+        assert_eq!(spec.url, "https://example.com/team@corp/repo");
+        assert_eq!(spec.ref_name, None);
+        assert_eq!(
+            spec.cache_path(),
+            PathBuf::from("example.com/team@corp/repo")
+        );
+
+        let spec = RemoteSpec::parse("ssh://git@example.com/team@corp/repo.git@v2").unwrap();
+        assert_eq!(spec.url, "ssh://git@example.com/team@corp/repo.git");
+        assert_eq!(spec.ref_name.as_deref(), Some("v2"));
+        assert_eq!(
+            spec.cache_path(),
+            PathBuf::from("example.com/team@corp/repo")
+        );
+
+        let spec = RemoteSpec::parse("git@github.com:org/repo").unwrap();
+        assert_eq!(spec.cache_path(), PathBuf::from("github.com/org/repo"));
+        assert_eq!(RemoteSpec::parse("-oProxyCommand=x@host:repo"), None);
+    }
+
+    #[test]
+    fn refs_that_read_as_options_are_refused() {
+        let dest = tempfile::tempdir().unwrap();
+        for ref_name in ["--upload-pack=touch /tmp/pwned", "-B", "bad..ref", "a b"] {
+            let spec = RemoteSpec {
+                url: "file:///nonexistent".to_string(),
+                ref_name: Some(ref_name.to_string()),
+            };
+            let err = fetch_shallow(&spec, dest.path()).unwrap_err();
+            assert!(err.to_string().contains("invalid ref name"), "{err}");
+        }
+        assert!(!dest.path().join(".git").exists());
+        assert!(check_ref_name("v1.2.0").is_ok());
+        assert!(check_ref_name("feature/x").is_ok());
+    }
+
+    #[test]
+    fn fetches_the_default_branch_and_a_named_ref() {
+        let upstream_dir = tempfile::tempdir().unwrap();
+        let upstream = Repository::init(upstream_dir.path()).unwrap();
+        std::fs::write(upstream_dir.path().join("lib.go"), "package lib\n").unwrap();
+        let mut index = upstream.index().unwrap();
+        index
+            .add_all(["*"], git2::IndexAddOption::DEFAULT, None)
+            .unwrap();
+        index.write().unwrap();
+        let tree = upstream.find_tree(index.write_tree().unwrap()).unwrap();
+        let signature = git2::Signature::now("test", "test@example.com").unwrap();
+        let commit = upstream
+            .commit(Some("HEAD"), &signature, &signature, "init", &tree, &[])
+            .unwrap();
+        upstream
+            .branch("release", &upstream.find_commit(commit).unwrap(), false)
+            .unwrap();
+        let default = upstream.head().unwrap().shorthand().unwrap().to_string();
+
+        let url = format!("file://{}", upstream_dir.path().display());
+        let dest = tempfile::tempdir().unwrap();
+        let checkout = fetch_shallow(&RemoteSpec::parse(&url).unwrap(), dest.path()).unwrap();
+        assert_eq!(checkout.ref_name, default);
+        assert_eq!(checkout.commit, commit.to_string());
+        assert!(dest.path().join("lib.go").is_file());
+
+        let spec = RemoteSpec::parse(&format!("{url}@release")).unwrap();
+        let checkout = fetch_shallow(&spec, dest.path()).unwrap();
+        assert_eq!(checkout.ref_name, "release");
+    }
+}
@@ -0,0 +1,119 @@
+use crate::diff::{DiffEntry, FileChangeKind};
+use cruxe_core::error::VcsError;
+use git2::{DiffFindOptions, DiffOptions, Repository};
+use std::path::Path;
+
+/// One file of the staged change set, as it would be committed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct StagedFile {
+    pub entry: DiffEntry,
+    /// Staged content; `None` for deletions and non-UTF-8 blobs.
+    pub content: Option<String>,
+}
+
+/// Files staged in the index relative to HEAD, with their staged content
+/// (not the working tree's). Before the first commit every staged file is
+/// an addition.
+pub fn staged_changes(repo_root: &Path) -> Result<Vec<StagedFile>, VcsError> {
+    let repo = Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+        path: repo_root.display().to_string(),
+    })?;
+    let head_tree = match repo.head() {
+        Ok(head) => Some(
+            head.peel_to_tree()
+                .map_err(|e| VcsError::GitError(format!("failed to load HEAD tree: {e}")))?,
+        ),
+        Err(e) if e.code() == git2::ErrorCode::UnbornBranch => None,
+        Err(e) => return Err(VcsError::GitError(format!("failed to read HEAD: {e}"))),
+    };
+    let index = repo
+        .index()
+        .map_err(|e| VcsError::GitError(format!("failed to read the index: {e}")))?;
+
+    let mut diff_opts = DiffOptions::new();
+    diff_opts.include_typechange(true);
+    let mut diff = repo
+        .diff_tree_to_index(head_tree.as_ref(), Some(&index), Some(&mut diff_opts))
+        .map_err(|e| VcsError::GitError(format!("failed to compute staged diff: {e}")))?;
+    let mut find_opts = DiffFindOptions::new();
+    find_opts.renames(true);
+    diff.find_similar(Some(&mut find_opts))
+        .map_err(|e| VcsError::GitError(format!("failed to detect renames: {e}")))?;
+
+    let mut out = Vec::new();
+    for delta in diff.deltas() {
+        let old_path = delta
+            .old_file()
+            .path()
+            .map(|p| p.to_string_lossy().to_string());
+        let new_path = delta
+            .new_file()
+            .path()
+            .map(|p| p.to_string_lossy().to_string());
+        let entry = match delta.status() {
+            git2::Delta::Added => new_path.map(DiffEntry::added),
+            git2::Delta::Deleted => old_path.map(DiffEntry::deleted),
+            git2::Delta::Renamed => match (old_path, new_path) {
+                (Some(old_path), Some(new_path)) => Some(DiffEntry::renamed(old_path, new_path)),
+                _ => None,
+            },
+            _ => new_path.or(old_path).map(DiffEntry::modified),
+        };
+        let Some(entry) = entry else {
+            continue;
+        };
+        let content = if entry.kind == FileChangeKind::Deleted {
+            None
+        } else {
+            let blob = repo
+                .find_blob(delta.new_file().id())
+                .map_err(|e| VcsError::GitError(format!("failed to read {}: {e}", entry.path)))?;
+            String::from_utf8(blob.content().to_vec()).ok()
+        };
+        out.push(StagedFile { entry, content });
+    }
+    Ok(out)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn staged_changes_read_the_index_not_the_worktree() {
+        let dir = tempfile::tempdir().unwrap();
+        let repo = Repository::init(dir.path()).unwrap();
+        let stage = |files: &[&str]| {
+            let mut index = repo.index().unwrap();
+            for file in files {
+                index.add_path(Path::new(file)).unwrap();
+            }
+            index.write().unwrap();
+        };
+        std::fs::write(dir.path().join("a.rs"), "fn a() {}\n").unwrap();
+        stage(&["a.rs"]);
+        assert_eq!(
+            staged_changes(dir.path()).unwrap(),
+            vec![StagedFile {
+                entry: DiffEntry::added("a.rs"),
+                content: Some("fn a() {}\n".to_string()),
+            }]
+        );
+
+        let tree = repo
+            .find_tree(repo.index().unwrap().write_tree().unwrap())
+            .unwrap();
+        let signature = git2::Signature::now("test", "test@example.com").unwrap();
+        repo.commit(Some("HEAD"), &signature, &signature, "init", &tree, &[])
+            .unwrap();
+        std::fs::write(dir.path().join("a.rs"), "fn staged() {}\n").unwrap();
+        stage(&["a.rs"]);
+        std::fs::write(dir.path().join("a.rs"), "fn unstaged() {}\n").unwrap();
+        std::fs::write(dir.path().join("b.rs"), "fn b() {}\n").unwrap();
+
+        let staged = staged_changes(dir.path()).unwrap();
+        assert_eq!(staged.len(), 1);
+        assert_eq!(staged[0].entry, DiffEntry::modified("a.rs"));
+        assert_eq!(staged[0].content.as_deref(), Some("fn staged() {}\n"));
+    }
+}
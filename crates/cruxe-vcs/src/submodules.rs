@@ -0,0 +1,80 @@
+use cruxe_core::error::VcsError;
+use cruxe_state::submodules::Submodule;
+use git2::Repository;
+use std::path::Path;
+
+/// Submodules of the repository at `repo_root` that are checked out in its
+/// working tree, ordered by path. Submodules never initialized (`git
+/// submodule update --init`) have an empty directory and are left out, as
+/// are submodules of submodules.
+pub fn initialized_submodules(repo_root: &Path) -> Result<Vec<Submodule>, VcsError> {
+    let repo = Repository::open(repo_root).map_err(|_| VcsError::NotGitRepo {
+        path: repo_root.display().to_string(),
+    })?;
+    let declared = repo
+        .submodules()
+        .map_err(|e| VcsError::GitError(format!("failed to read .gitmodules: {e}")))?;
+    let mut out: Vec<Submodule> = declared
+        .iter()
+        .filter(|submodule| submodule.open().is_ok())
+        .map(|submodule| Submodule {
+            name: submodule.name().unwrap_or_default().to_string(),
+            path: submodule.path().to_string_lossy().replace('\\', "/"),
+            url: submodule.url().map(str::to_string),
+            commit: submodule.workdir_id().map(|id| id.to_string()),
+        })
+        .collect();
+    out.sort_by(|a, b| a.path.cmp(&b.path));
+    Ok(out)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn commit_all(repo: &Repository) {
+        let mut index = repo.index().unwrap();
+        index
+            .add_all(["*"], git2::IndexAddOption::DEFAULT, None)
+            .unwrap();
+        index.write().unwrap();
+        let tree = repo.find_tree(index.write_tree().unwrap()).unwrap();
+        let signature = git2::Signature::now("test", "test@example.com").unwrap();
+        repo.commit(Some("HEAD"), &signature, &signature, "init", &tree, &[])
+            .unwrap();
+    }
+
+    #[test]
+    fn lists_only_checked_out_submodules() {
+        let upstream_dir = tempfile::tempdir().unwrap();
+        let upstream = Repository::init(upstream_dir.path()).unwrap();
+        std::fs::write(upstream_dir.path().join("lib.go"), "package lib\n").unwrap();
+        commit_all(&upstream);
+
+        let dir = tempfile::tempdir().unwrap();
+        let repo = Repository::init(dir.path()).unwrap();
+        assert!(initialized_submodules(dir.path()).unwrap().is_empty());
+
+        let url = upstream_dir.path().to_string_lossy().to_string();
+        let mut added = repo
+            .submodule(&url, Path::new("third_party/lib"), true)
+            .unwrap();
+        added.clone(None).unwrap();
+        added.add_finalize().unwrap();
+        std::fs::write(
+            dir.path().join(".gitmodules"),
+            format!(
+                "{}[submodule \"docs\"]\n\tpath = docs\n\turl = {url}\n",
+                std::fs::read_to_string(dir.path().join(".gitmodules")).unwrap()
+            ),
+        )
+        .unwrap();
+
+        let submodules = initialized_submodules(dir.path()).unwrap();
+        assert_eq!(submodules.len(), 1);
+        assert_eq!(submodules[0].name, "third_party/lib");
+        assert_eq!(submodules[0].path, "third_party/lib");
+        assert_eq!(submodules[0].url.as_deref(), Some(url.as_str()));
+        assert!(submodules[0].commit.is_some());
+    }
+}
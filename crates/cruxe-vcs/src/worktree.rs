@@ -187,6 +187,34 @@ where
     }
 }
 
+/// Branches checked out in the linked worktrees (`git worktree add`) of the
+/// repository at `repo_root`. Detached and pruned worktrees are left out.
+pub fn linked_worktree_branches(repo_root: &Path) -> Vec<String> {
+    let Ok(repo) = git2::Repository::open(repo_root) else {
+        return Vec::new();
+    };
+    let Ok(names) = repo.worktrees() else {
+        return Vec::new();
+    };
+    let mut branches: Vec<String> = names
+        .iter()
+        .flatten()
+        .filter_map(|name| repo.find_worktree(name).ok())
+        .filter(|worktree| worktree.validate().is_ok())
+        .filter_map(|worktree| git2::Repository::open_from_worktree(&worktree).ok())
+        .filter_map(|linked| {
+            let head = linked.head().ok()?;
+            if !head.is_branch() {
+                return None;
+            }
+            head.shorthand().map(str::to_string)
+        })
+        .collect();
+    branches.sort();
+    branches.dedup();
+    branches
+}
+
 pub fn normalize_ref_name(ref_name: &str) -> String {
     let mut out = String::with_capacity(ref_name.len());
     for ch in ref_name.chars() {
@@ -221,6 +249,21 @@ mod tests {
         repo
     }
 
+    #[test]
+    fn linked_worktree_branches_lists_checked_out_branches() {
+        let dir = tempfile::tempdir().unwrap();
+        let repo = init_repo(dir.path());
+        assert!(linked_worktree_branches(dir.path()).is_empty());
+
+        let linked = tempfile::tempdir().unwrap();
+        repo.worktree("feat", &linked.path().join("feat"), None)
+            .unwrap();
+        assert_eq!(linked_worktree_branches(dir.path()), vec!["feat"]);
+
+        let plain = tempfile::tempdir().unwrap();
+        assert!(linked_worktree_branches(plain.path()).is_empty());
+    }
+
     #[test]
     fn normalize_ref_name_is_deterministic() {
         assert_eq!(normalize_ref_name("feat/auth#1"), "feat-auth-1");